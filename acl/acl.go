@@ -0,0 +1,241 @@
+package acl
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/dotwaffle/inettools/iprange"
+	"github.com/dotwaffle/inettools/portrange"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Action is what an access list does with the packets an entry matches.
+type Action string
+
+// Actions of entries.
+const (
+	Permit Action = "permit"
+	Deny   Action = "deny"
+)
+
+// portProtocols are the protocols whose packets have ports: TCP, UDP, DCCP, SCTP, and UDP-Lite.
+var portProtocols = map[uint8]bool{6: true, 17: true, 33: true, 132: true, 136: true}
+
+// protocolNames are the names used in text for common protocols; others are written as numbers.
+var protocolNames = map[uint8]string{
+	1: "icmp", 6: "tcp", 17: "udp", 33: "dccp", 47: "gre", 50: "esp", 58: "ipv6-icmp", 132: "sctp", 136: "udplite",
+}
+
+// Entry is a rule of an access list, matching packets by their five-tuple. Fields that are nil match anything.
+type Entry struct {
+	Action    Action
+	Protocols []uint8      // IP protocol numbers, sorted.
+	Src       *iprange.Set // Source addresses.
+	Dst       *iprange.Set // Destination addresses.
+	SrcPorts  portrange.List
+	DstPorts  portrange.List
+}
+
+// Match reports whether a packet matches the entry. Only packets of protocols with ports, such as TCP and UDP, match
+// an entry with ports.
+func (e *Entry) Match(src, dst net.IP, proto uint8, sport, dport uint16) bool {
+	if e.Protocols != nil {
+		i := sort.Search(len(e.Protocols), func(i int) bool { return e.Protocols[i] >= proto })
+		if i == len(e.Protocols) || e.Protocols[i] != proto {
+			return false
+		}
+	}
+	if (e.SrcPorts != nil || e.DstPorts != nil) && !portProtocols[proto] {
+		return false
+	}
+	return (e.Src == nil || e.Src.Contains(src)) && (e.Dst == nil || e.Dst.Contains(dst)) &&
+		(e.SrcPorts == nil || e.SrcPorts.Contains(sport)) && (e.DstPorts == nil || e.DstPorts.Contains(dport))
+}
+
+// String formats the entry as ParseEntry reads it, such as "permit proto tcp dst 192.0.2.0/24 dport 80,443".
+func (e *Entry) String() string {
+	parts := []string{string(e.Action)}
+	if e.Protocols != nil {
+		protos := make([]string, 0, len(e.Protocols))
+		for _, p := range e.Protocols {
+			protos = append(protos, protocolName(p))
+		}
+		parts = append(parts, "proto", strings.Join(protos, ","))
+	}
+	for _, field := range []struct {
+		name  string
+		set   *iprange.Set
+		ports portrange.List
+	}{{"src", e.Src, e.SrcPorts}, {"dst", e.Dst, e.DstPorts}} {
+		if field.set != nil {
+			strs := []string{}
+			for _, pfx := range field.set.IPNets() {
+				strs = append(strs, pfx.String())
+			}
+			parts = append(parts, field.name, strings.Join(strs, ","))
+		}
+		if field.ports != nil {
+			parts = append(parts, field.name[:1]+"port", field.ports.String())
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// protocolName returns the name of a protocol, or its number if it has none.
+func protocolName(p uint8) string {
+	if name, ok := protocolNames[p]; ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+// ParseEntry parses an entry written as an action followed by any of the fields proto, src, sport, dst, and dport,
+// each with a comma-separated list of values: protocol names or numbers, prefixes or address ranges, and port ranges.
+func ParseEntry(s string) (*Entry, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields)%2 != 1 {
+		return nil, fmt.Errorf("invalid entry %q", s)
+	}
+	e := &Entry{Action: Action(strings.ToLower(fields[0]))}
+	if e.Action != Permit && e.Action != Deny {
+		return nil, fmt.Errorf("invalid action %q", fields[0])
+	}
+	for i := 1; i < len(fields); i += 2 {
+		var err error
+		switch value := fields[i+1]; strings.ToLower(fields[i]) {
+		case "proto":
+			e.Protocols, err = parseProtocols(value)
+		case "src":
+			e.Src, err = parseSet(value)
+		case "dst":
+			e.Dst, err = parseSet(value)
+		case "sport":
+			e.SrcPorts, err = portrange.Parse(value)
+		case "dport":
+			e.DstPorts, err = portrange.Parse(value)
+		default:
+			err = fmt.Errorf("unknown field %q", fields[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// parseProtocols parses a comma-separated list of protocol names or numbers, returning them sorted.
+func parseProtocols(s string) ([]uint8, error) {
+	seen := map[uint8]bool{}
+	protos := []uint8{}
+	for _, field := range strings.Split(s, ",") {
+		p, err := parseProtocol(field)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[p] {
+			seen[p] = true
+			protos = append(protos, p)
+		}
+	}
+	sort.Slice(protos, func(i, j int) bool { return protos[i] < protos[j] })
+	return protos, nil
+}
+
+// parseProtocol parses a protocol name or number.
+func parseProtocol(s string) (uint8, error) {
+	for p, name := range protocolNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol %q", s)
+	}
+	return uint8(n), nil
+}
+
+// parseSet parses a comma-separated list of prefixes, address ranges, or addresses.
+func parseSet(s string) (*iprange.Set, error) {
+	set := &iprange.Set{}
+	for _, field := range strings.Split(s, ",") {
+		r, err := iprange.Parse(field)
+		if err != nil {
+			return nil, err
+		}
+		if err := set.Add(r); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// ACL is an ordered list of entries, where the first entry a packet matches decides what is done with it.
+type ACL struct {
+	Entries []*Entry
+	Default Action // The action for packets that match no entry, or Deny if empty.
+}
+
+// defaultAction returns the action for packets that match no entry.
+func (a *ACL) defaultAction() Action {
+	if a.Default == "" {
+		return Deny
+	}
+	return a.Default
+}
+
+// Match returns the action for a packet, and the entry that matched it, or nil if none did.
+func (a *ACL) Match(src, dst net.IP, proto uint8, sport, dport uint16) (Action, *Entry) {
+	for _, e := range a.Entries {
+		if e.Match(src, dst, proto, sport, dport) {
+			return e.Action, e
+		}
+	}
+	return a.defaultAction(), nil
+}
+
+// Parse reads an access list with an entry on each line, as ParseEntry reads them, ignoring blank lines and comments
+// starting with #. A line "default permit" or "default deny" sets the default action.
+func Parse(r io.Reader) (*ACL, error) {
+	a := &ACL{}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		switch {
+		case len(fields) == 0:
+		case strings.EqualFold(fields[0], "default"):
+			if len(fields) != 2 || (Action(fields[1]) != Permit && Action(fields[1]) != Deny) {
+				return nil, fmt.Errorf("line %d: invalid default %q", line, text)
+			}
+			a.Default = Action(fields[1])
+		default:
+			e, err := ParseEntry(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			a.Entries = append(a.Entries, e)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Write writes the access list as Parse reads it.
+func (a *ACL) Write(w io.Writer) error {
+	for _, e := range a.Entries {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "default %s\n", a.defaultAction())
+	return err
+}
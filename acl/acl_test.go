@@ -0,0 +1,122 @@
+package acl
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+)
+
+const list = `# Web servers
+permit proto tcp dst 192.0.2.0/24,2001:db8::/32 dport 80,443
+permit proto udp src 198.51.100.53 sport 53 dst 192.0.2.10
+deny proto icmp src 203.0.113.0-203.0.113.127
+permit proto ICMP,ipv6-icmp
+default deny
+`
+
+func TestMatch(t *testing.T) {
+	a, err := Parse(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+
+	tests := map[string]struct {
+		src, dst     string
+		proto        uint8
+		sport, dport uint16
+		want         Action
+		wantEntry    int
+	}{
+		"Web": {
+			src: "198.51.100.1", dst: "192.0.2.80", proto: 6, sport: 40000, dport: 443,
+			want: Permit, wantEntry: 0,
+		},
+		"WebIPv6": {
+			src: "2001:db8:1::1", dst: "2001:db8::80", proto: 6, sport: 40000, dport: 80,
+			want: Permit, wantEntry: 0,
+		},
+		"WrongPort": {
+			src: "198.51.100.1", dst: "192.0.2.80", proto: 6, sport: 40000, dport: 22,
+			want: Deny, wantEntry: -1,
+		},
+		"UDPWeb": {
+			src: "198.51.100.1", dst: "192.0.2.80", proto: 17, sport: 40000, dport: 443,
+			want: Deny, wantEntry: -1,
+		},
+		"DNS": {
+			src: "198.51.100.53", dst: "192.0.2.10", proto: 17, sport: 53, dport: 1024,
+			want: Permit, wantEntry: 1,
+		},
+		"DNSSpoofed": {
+			src: "198.51.100.54", dst: "192.0.2.10", proto: 17, sport: 53, dport: 1024,
+			want: Deny, wantEntry: -1,
+		},
+		"ICMPDenied": {
+			src: "203.0.113.5", dst: "192.0.2.1", proto: 1,
+			want: Deny, wantEntry: 2,
+		},
+		"ICMP": {
+			src: "203.0.113.200", dst: "192.0.2.1", proto: 1,
+			want: Permit, wantEntry: 3,
+		},
+		"GRE": {
+			src: "203.0.113.200", dst: "192.0.2.1", proto: 47,
+			want: Deny, wantEntry: -1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			action, e := a.Match(net.ParseIP(test.src), net.ParseIP(test.dst), test.proto, test.sport, test.dport)
+			if diff := cmp.Diff(test.want, action); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			entry := -1
+			for i := range a.Entries {
+				if a.Entries[i] == e {
+					entry = i
+				}
+			}
+			if diff := cmp.Diff(test.wantEntry, entry); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	a, err := Parse(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := a.Write(&buf); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	want := "permit proto tcp dst 192.0.2.0/24,2001:db8::/32 dport 80,443\n" +
+		"permit proto udp src 198.51.100.53/32 sport 53 dst 192.0.2.10/32\n" +
+		"deny proto icmp src 203.0.113.0/25\n" +
+		"permit proto icmp,ipv6-icmp\n" +
+		"default deny\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	for _, bad := range []string{
+		"allow proto tcp",
+		"permit proto",
+		"permit proto tcp,bogus",
+		"permit dst 192.0.2.0/33",
+		"permit dport 80-70",
+		"permit ttl 64",
+	} {
+		if _, err := ParseEntry(bad); err == nil {
+			t.Errorf("ParseEntry(%q): got no error", bad)
+		}
+	}
+	if _, err := Parse(strings.NewReader("default maybe\n")); err == nil {
+		t.Errorf("Parse: got no error for invalid default")
+	}
+}
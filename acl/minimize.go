@@ -0,0 +1,209 @@
+package acl
+
+import (
+	"github.com/dotwaffle/inettools/iprange"
+	"github.com/dotwaffle/inettools/portrange"
+	"sort"
+)
+
+// relation compares a field of two entries, reporting whether the first covers all of the second, whether they have
+// any value in common, and the union of the two. A nil field matches anything.
+type relation struct {
+	covers   bool
+	overlaps bool
+	union    func(e *Entry)
+}
+
+// fields compares each field of a with those of b. Overlaps may be reported for fields that do not overlap, as entries
+// with ports do not match every protocol, which only makes Minimize do less.
+func fields(a, b *Entry) []relation {
+	return []relation{
+		protocols(a.Protocols, b.Protocols),
+		sets(a.Src, b.Src, func(e *Entry, s *iprange.Set) { e.Src = s }),
+		sets(a.Dst, b.Dst, func(e *Entry, s *iprange.Set) { e.Dst = s }),
+		ports(a.SrcPorts, b.SrcPorts, func(e *Entry, l portrange.List) { e.SrcPorts = l }),
+		ports(a.DstPorts, b.DstPorts, func(e *Entry, l portrange.List) { e.DstPorts = l }),
+	}
+}
+
+// protocols compares lists of protocols.
+func protocols(a, b []uint8) relation {
+	in := func(list []uint8, p uint8) bool {
+		for _, q := range list {
+			if p == q {
+				return true
+			}
+		}
+		return false
+	}
+	r := relation{covers: true, overlaps: a == nil || b == nil}
+	if a != nil {
+		r.covers = b != nil
+		for _, p := range b {
+			r.covers = r.covers && in(a, p)
+			r.overlaps = r.overlaps || in(a, p)
+		}
+	}
+	r.union = func(e *Entry) {
+		if a == nil || b == nil {
+			e.Protocols = nil
+			return
+		}
+		union := append([]uint8(nil), a...)
+		for _, p := range b {
+			if !in(a, p) {
+				union = append(union, p)
+			}
+		}
+		sort.Slice(union, func(i, j int) bool { return union[i] < union[j] })
+		e.Protocols = union
+	}
+	return r
+}
+
+// sets compares sets of addresses.
+func sets(a, b *iprange.Set, set func(e *Entry, s *iprange.Set)) relation {
+	r := relation{
+		covers:   a == nil || (b != nil && a.Superset(b)),
+		overlaps: a == nil || b == nil || a.Overlaps(b),
+	}
+	r.union = func(e *Entry) {
+		if a == nil || b == nil {
+			set(e, nil)
+		} else {
+			set(e, a.Union(b))
+		}
+	}
+	return r
+}
+
+// ports compares lists of ports.
+func ports(a, b portrange.List, set func(e *Entry, l portrange.List)) relation {
+	r := relation{
+		covers:   a == nil || (b != nil && a.Superset(b)),
+		overlaps: a == nil || b == nil || a.Overlaps(b),
+	}
+	r.union = func(e *Entry) {
+		if a == nil || b == nil {
+			set(e, nil)
+		} else {
+			set(e, a.Union(b))
+		}
+	}
+	return r
+}
+
+// covers reports whether a matches every packet b does.
+func covers(a, b *Entry) bool {
+	for _, r := range fields(a, b) {
+		if !r.covers {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether a and b might both match a packet.
+func overlaps(a, b *Entry) bool {
+	for _, r := range fields(a, b) {
+		if !r.overlaps {
+			return false
+		}
+	}
+	return true
+}
+
+// union returns an entry that matches exactly the packets a or b match, and true, if there is one: if they have the
+// same action and differ in at most one field.
+func union(a, b *Entry) (*Entry, bool) {
+	if a.Action != b.Action {
+		return nil, false
+	}
+	u := *a
+	differ := 0
+	reverse := fields(b, a)
+	for i, r := range fields(a, b) {
+		if r.covers && reverse[i].covers {
+			continue
+		}
+		differ++
+		r.union(&u)
+	}
+	return &u, differ <= 1
+}
+
+// Minimize returns an access list with the same effect on every packet, with fewer entries where it can: entries that
+// no packet reaches are removed, as are those that only repeat what a later entry or the default would do, and entries
+// with the same action that differ in a single field are merged.
+func (a *ACL) Minimize() *ACL {
+	entries := append([]*Entry(nil), a.Entries...)
+	def := a.defaultAction()
+
+	// between reports whether any entry between i and j has a different action to e and might match a packet it does.
+	between := func(i, j int, e *Entry) bool {
+		for k := i + 1; k < j; k++ {
+			if entries[k].Action != e.Action && overlaps(entries[k], e) {
+				return true
+			}
+		}
+		return false
+	}
+	remove := func(i int) {
+		entries = append(entries[:i], entries[i+1:]...)
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		// An entry covered by an earlier one is never reached.
+	shadowed:
+		for j := 1; j < len(entries); j++ {
+			for i := 0; i < j; i++ {
+				if covers(entries[i], entries[j]) {
+					remove(j)
+					j--
+					changed = true
+					continue shadowed
+				}
+			}
+		}
+
+		// An entry is redundant if the packets it matches would get the same action without it: if every later entry
+		// that might match them has the same action as the default, or a later entry with the same action covers it
+		// and nothing in between does otherwise.
+	redundant:
+		for i := 0; i < len(entries); i++ {
+			e := entries[i]
+			if e.Action == def && !between(i, len(entries), e) {
+				remove(i)
+				i--
+				changed = true
+				continue
+			}
+			for j := i + 1; j < len(entries); j++ {
+				if entries[j].Action == e.Action && covers(entries[j], e) && !between(i, j, e) {
+					remove(i)
+					i--
+					changed = true
+					continue redundant
+				}
+			}
+		}
+
+		// An entry can be merged into an earlier one with the same action if nothing in between with a different
+		// action might match its packets.
+	merged:
+		for j := 1; j < len(entries); j++ {
+			for i := 0; i < j; i++ {
+				if u, ok := union(entries[i], entries[j]); ok && !between(i, j, entries[j]) {
+					entries[i] = u
+					remove(j)
+					j--
+					changed = true
+					continue merged
+				}
+			}
+		}
+	}
+	return &ACL{Entries: entries, Default: a.Default}
+}
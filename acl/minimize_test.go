@@ -0,0 +1,132 @@
+package acl
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestMinimize(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		want  string
+	}{
+		"Merge": {
+			input: "permit proto tcp dst 192.0.2.0/25 dport 80\n" +
+				"permit proto tcp dst 192.0.2.128/25 dport 80\n" +
+				"permit proto tcp dst 192.0.2.0/24 dport 443\n",
+			want: "permit proto tcp dst 192.0.2.0/24 dport 80,443\n" +
+				"default deny\n",
+		},
+		"Shadowed": {
+			input: "deny src 203.0.113.0/24\n" +
+				"permit proto tcp src 203.0.113.7 dport 22\n" +
+				"permit proto tcp dport 22\n",
+			want: "deny src 203.0.113.0/24\n" +
+				"permit proto tcp dport 22\n" +
+				"default deny\n",
+		},
+		"Default": {
+			input: "permit proto tcp dport 22\n" +
+				"deny proto udp\n" +
+				"permit proto udp dport 53\n" +
+				"default deny\n",
+			want: "permit proto tcp dport 22\n" +
+				"default deny\n",
+		},
+		"CoveredLater": {
+			input: "permit proto tcp dst 192.0.2.1 dport 80\n" +
+				"deny proto udp\n" +
+				"permit proto tcp dport 80\n" +
+				"default permit\n",
+			want: "deny proto udp\n" +
+				"default permit\n",
+		},
+		"Blocked": {
+			input: "permit proto tcp dst 192.0.2.1 dport 80\n" +
+				"deny proto tcp src 198.51.100.0/24\n" +
+				"permit proto tcp dst 192.0.2.2 dport 80\n",
+			want: "permit proto tcp dst 192.0.2.1/32 dport 80\n" +
+				"deny proto tcp src 198.51.100.0/24\n" +
+				"permit proto tcp dst 192.0.2.2/32 dport 80\n" +
+				"default deny\n",
+		},
+		"Protocols": {
+			input: "permit proto tcp dport 53\n" +
+				"permit proto udp dport 53\n" +
+				"permit proto sctp dport 53\n",
+			want: "permit proto tcp,udp,sctp dport 53\n" +
+				"default deny\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			a, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			min := a.Minimize()
+			var buf bytes.Buffer
+			if err := min.Write(&buf); err != nil {
+				t.Fatalf("write err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			equivalent(t, a, min)
+		})
+	}
+}
+
+func TestMinimizeRandom(t *testing.T) {
+	// Random access lists over a small space of packets must keep their effect on every one of them.
+	rng := rand.New(rand.NewSource(1))
+	pick := func(options ...string) string {
+		return options[rng.Intn(len(options))]
+	}
+	for i := 0; i < 200; i++ {
+		var lines []string
+		for j := rng.Intn(8); j >= 0; j-- {
+			lines = append(lines, strings.Join([]string{
+				pick("permit", "deny"),
+				pick("", "proto tcp", "proto udp", "proto tcp,udp", "proto icmp"),
+				pick("", "src 192.0.2.0/30", "src 192.0.2.0/31", "src 192.0.2.2/31", "src 192.0.2.1"),
+				pick("", "dst 198.51.100.0/31", "dst 198.51.100.1"),
+				pick("", "dport 1-2", "dport 2-3", "dport 3", "dport 1"),
+			}, " "))
+		}
+		lines = append(lines, "default "+pick("permit", "deny"))
+		a, err := Parse(strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			t.Fatalf("parse err: %v", err)
+		}
+		equivalent(t, a, a.Minimize())
+	}
+}
+
+// equivalent checks that two access lists decide the same for a small space of packets.
+func equivalent(t *testing.T, a, b *ACL) {
+	t.Helper()
+	addrs := []string{"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3", "198.51.100.0", "198.51.100.1", "203.0.113.7"}
+	for _, src := range addrs {
+		for _, dst := range addrs {
+			for _, proto := range []uint8{1, 6, 17, 132} {
+				for port := uint16(0); port < 5; port++ {
+					wantAction, _ := a.Match(net.ParseIP(src), net.ParseIP(dst), proto, port, port)
+					gotAction, _ := b.Match(net.ParseIP(src), net.ParseIP(dst), proto, port, port)
+					if gotAction != wantAction {
+						var before, after bytes.Buffer
+						a.Write(&before)
+						b.Write(&after)
+						t.Fatalf("%s to %s proto %d port %d: got %s, want %s\nbefore:\n%s\nafter:\n%s",
+							src, dst, proto, port, gotAction, wantAction, before.String(), after.String())
+					}
+				}
+			}
+		}
+	}
+}
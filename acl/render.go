@@ -0,0 +1,321 @@
+package acl
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dotwaffle/inettools/iprange"
+	"io"
+	"net"
+	"strings"
+)
+
+// Defaults used by Options whose fields are not set.
+const (
+	DefaultTable = "inettools"
+	DefaultChain = "acl"
+)
+
+// Options control the rendering of access lists as firewall rules.
+type Options struct {
+	Table string // The nftables table, of the inet family, or DefaultTable if empty. iptables uses the filter table.
+	Chain string // The chain, which also prefixes the names of sets, or DefaultChain if empty.
+	// The nftables hook, such as "input", to attach the chain to with the default action as its policy. If empty, the
+	// chain is a regular chain to jump to, ending in a rule with the default action, as it always is for iptables.
+	Hook string
+}
+
+// table returns the nftables table.
+func (o *Options) table() string {
+	if o == nil || o.Table == "" {
+		return DefaultTable
+	}
+	return o.Table
+}
+
+// chain returns the chain.
+func (o *Options) chain() string {
+	if o == nil || o.Chain == "" {
+		return DefaultChain
+	}
+	return o.Chain
+}
+
+// addrSet is a named set of prefixes of a single family, which rules with more than one prefix match against.
+type addrSet struct {
+	name   string
+	family int
+	pfxs   []*net.IPNet
+}
+
+// addrs are the addresses a rule matches: nil for any, a single prefix, or a set.
+type addrs struct {
+	pfx *net.IPNet
+	set *addrSet
+}
+
+// rule is an entry restricted to a single family, as firewalls match addresses of one family at a time.
+type rule struct {
+	entry     *Entry
+	family    int // 4 or 6, or 0 if the rule matches no addresses and so applies to both.
+	src, dst  addrs
+	protocols []uint8 // Nil for any.
+}
+
+// plan turns the entries of an access list into rules, with sets for entries with more than one prefix. Identical sets
+// are shared between rules, and entries that match nothing are left out.
+func plan(a *ACL, opts *Options) ([]rule, []*addrSet) {
+	var rules []rule
+	var sets []*addrSet
+	byElements := map[string]*addrSet{}
+	match := func(pfxs []*net.IPNet, family int, name string) addrs {
+		if len(pfxs) == 1 {
+			return addrs{pfx: pfxs[0]}
+		}
+		key := fmt.Sprint(family, pfxs)
+		if s, ok := byElements[key]; ok {
+			return addrs{set: s}
+		}
+		s := &addrSet{name: fmt.Sprintf("%s_%s%d", opts.chain(), name, family), family: family, pfxs: pfxs}
+		byElements[key] = s
+		sets = append(sets, s)
+		return addrs{set: s}
+	}
+
+	for i, e := range a.Entries {
+		// Only protocols with ports match an entry with ports.
+		protocols := e.Protocols
+		if e.SrcPorts != nil || e.DstPorts != nil {
+			protocols = nil
+			for p := 0; p < 256; p++ {
+				if portProtocols[uint8(p)] && (e.Protocols == nil || containsProtocol(e.Protocols, uint8(p))) {
+					protocols = append(protocols, uint8(p))
+				}
+			}
+			if len(protocols) == 0 {
+				continue
+			}
+		}
+		if e.Src == nil && e.Dst == nil {
+			rules = append(rules, rule{entry: e, protocols: protocols})
+			continue
+		}
+		for _, family := range []int{4, 6} {
+			src, dst := familyPrefixes(e.Src, family), familyPrefixes(e.Dst, family)
+			if (e.Src != nil && len(src) == 0) || (e.Dst != nil && len(dst) == 0) {
+				continue
+			}
+			r := rule{entry: e, family: family, protocols: protocols}
+			if e.Src != nil {
+				r.src = match(src, family, fmt.Sprintf("%d_src", i))
+			}
+			if e.Dst != nil {
+				r.dst = match(dst, family, fmt.Sprintf("%d_dst", i))
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules, sets
+}
+
+// containsProtocol reports whether protos holds p.
+func containsProtocol(protos []uint8, p uint8) bool {
+	for _, q := range protos {
+		if p == q {
+			return true
+		}
+	}
+	return false
+}
+
+// familyPrefixes returns the prefixes of a set of the given family, or nil if the set is nil.
+func familyPrefixes(s *iprange.Set, family int) []*net.IPNet {
+	if s == nil {
+		return nil
+	}
+	var pfxs []*net.IPNet
+	for _, pfx := range s.IPNets() {
+		if (pfx.IP.To4() != nil) == (family == 4) {
+			pfxs = append(pfxs, pfx)
+		}
+	}
+	return pfxs
+}
+
+// verdicts are the nftables and iptables verdicts for each action.
+var verdicts = map[Action][2]string{Permit: {"accept", "ACCEPT"}, Deny: {"drop", "DROP"}}
+
+// WriteNFT renders an access list as an nftables script for nft -f, which replaces the table in a single transaction.
+// Entries with more than one prefix match against named interval sets, which fwset.NFTSet can keep up to date.
+func WriteNFT(w io.Writer, a *ACL, opts *Options) error {
+	rules, sets := plan(a, opts)
+	var b bytes.Buffer
+	table := "inet " + opts.table()
+	fmt.Fprintf(&b, "table %s {}\ndelete table %s\ntable %s {\n", table, table, table)
+	for _, s := range sets {
+		strs := make([]string, 0, len(s.pfxs))
+		for _, pfx := range s.pfxs {
+			strs = append(strs, pfx.String())
+		}
+		fmt.Fprintf(&b, "\tset %s {\n\t\ttype ipv%d_addr\n\t\tflags interval\n\t\telements = { %s }\n\t}\n",
+			s.name, s.family, strings.Join(strs, ", "))
+	}
+
+	fmt.Fprintf(&b, "\tchain %s {\n", opts.chain())
+	if opts != nil && opts.Hook != "" {
+		fmt.Fprintf(&b, "\t\ttype filter hook %s priority 0; policy %s;\n", opts.Hook, verdicts[a.defaultAction()][0])
+	}
+	for _, r := range rules {
+		var parts []string
+		family := map[int]string{4: "ip", 6: "ip6"}[r.family]
+		for _, field := range []struct {
+			name string
+			addrs
+		}{{"saddr", r.src}, {"daddr", r.dst}} {
+			switch {
+			case field.pfx != nil:
+				parts = append(parts, fmt.Sprintf("%s %s %v", family, field.name, field.pfx))
+			case field.set != nil:
+				parts = append(parts, fmt.Sprintf("%s %s @%s", family, field.name, field.set.name))
+			}
+		}
+		if r.protocols != nil {
+			parts = append(parts, "meta l4proto "+nftList(protocolStrings(r.protocols)))
+		}
+		if r.entry.SrcPorts != nil {
+			parts = append(parts, "th sport "+nftList(strings.Split(r.entry.SrcPorts.String(), ",")))
+		}
+		if r.entry.DstPorts != nil {
+			parts = append(parts, "th dport "+nftList(strings.Split(r.entry.DstPorts.String(), ",")))
+		}
+		parts = append(parts, verdicts[r.entry.Action][0])
+		fmt.Fprintf(&b, "\t\t%s\n", strings.Join(parts, " "))
+	}
+	if opts == nil || opts.Hook == "" {
+		fmt.Fprintf(&b, "\t\t%s\n", verdicts[a.defaultAction()][0])
+	}
+	b.WriteString("\t}\n}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// nftList formats values as a single value, or an anonymous set if there are several.
+func nftList(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "{ " + strings.Join(values, ", ") + " }"
+}
+
+// protocolStrings returns the names of protocols.
+func protocolStrings(protos []uint8) []string {
+	names := make([]string, 0, len(protos))
+	for _, p := range protos {
+		names = append(names, protocolName(p))
+	}
+	return names
+}
+
+// maxMultiport is the most ports the iptables multiport match takes, with ranges counting as two.
+const maxMultiport = 15
+
+// WriteIPTables renders an access list as input for iptables-restore, or ip6tables-restore if ipv6 is set, as a chain
+// in the filter table that ends with the default action. Entries with more than one prefix match against the ipsets
+// that WriteIPSets renders, which must be restored first.
+func WriteIPTables(w io.Writer, a *ACL, ipv6 bool, opts *Options) error {
+	rules, _ := plan(a, opts)
+	family := 4
+	if ipv6 {
+		family = 6
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*filter\n:%s - [0:0]\n", opts.chain())
+	for _, r := range rules {
+		if r.family != 0 && r.family != family {
+			continue
+		}
+		var addrArgs []string
+		for _, field := range []struct {
+			flag, dir string
+			addrs
+		}{{"-s", "src", r.src}, {"-d", "dst", r.dst}} {
+			switch {
+			case field.pfx != nil:
+				addrArgs = append(addrArgs, field.flag, field.pfx.String())
+			case field.set != nil:
+				addrArgs = append(addrArgs, "-m", "set", "--match-set", field.set.name, field.dir)
+			}
+		}
+
+		// iptables matches a single protocol, and a limited number of ports, in each rule.
+		protocols := []string{""}
+		if r.protocols != nil {
+			protocols = protocolStrings(r.protocols)
+		}
+		for _, proto := range protocols {
+			for _, sport := range portArgs("--sport", r.entry.SrcPorts.String()) {
+				for _, dport := range portArgs("--dport", r.entry.DstPorts.String()) {
+					args := append([]string{"-A", opts.chain()}, addrArgs...)
+					if proto != "" {
+						args = append(args, "-p", proto)
+					}
+					args = append(append(args, sport...), dport...)
+					args = append(args, "-j", verdicts[r.entry.Action][1])
+					fmt.Fprintln(&b, strings.Join(args, " "))
+				}
+			}
+		}
+	}
+	fmt.Fprintf(&b, "-A %s -j %s\nCOMMIT\n", opts.chain(), verdicts[a.defaultAction()][1])
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// portArgs returns the iptables arguments matching a list of ports, which may need several rules, or a single empty
+// list of arguments if any port matches.
+func portArgs(flag, list string) [][]string {
+	if list == "" {
+		return [][]string{nil}
+	}
+	ports := strings.Split(strings.ReplaceAll(list, "-", ":"), ",")
+	var args [][]string
+	for len(ports) > 0 {
+		n, size := 0, 0
+		for n < len(ports) {
+			count := 1
+			if strings.Contains(ports[n], ":") {
+				count = 2
+			}
+			if size+count > maxMultiport {
+				break
+			}
+			size += count
+			n++
+		}
+		if n == 1 {
+			args = append(args, []string{flag, ports[0]})
+		} else {
+			args = append(args, []string{"-m", "multiport", flag + "s", strings.Join(ports[:n], ",")})
+		}
+		ports = ports[n:]
+	}
+	return args
+}
+
+// WriteIPSets renders the sets of prefixes that WriteIPTables refers to as input for ipset restore, replacing the
+// elements of any sets that already exist. Set names longer than the 31 characters ipset allows are an error.
+func WriteIPSets(w io.Writer, a *ACL, opts *Options) error {
+	_, sets := plan(a, opts)
+	var b bytes.Buffer
+	for _, s := range sets {
+		if len(s.name) > 31 {
+			return fmt.Errorf("set name %q is too long for ipset", s.name)
+		}
+		family := map[int]string{4: "inet", 6: "inet6"}[s.family]
+		fmt.Fprintf(&b, "create %s hash:net family %s -exist\nflush %s\n", s.name, family, s.name)
+		for _, pfx := range s.pfxs {
+			fmt.Fprintf(&b, "add %s %v\n", s.name, pfx)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
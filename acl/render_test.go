@@ -0,0 +1,172 @@
+package acl
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"strings"
+	"testing"
+)
+
+const renderList = `permit proto tcp dst 192.0.2.0/24,198.51.100.0/24,2001:db8::/32 dport 80,443,8000-8100
+permit proto udp src 198.51.100.53 sport 53
+deny src 203.0.113.0/24,192.0.2.0/24
+permit proto icmp,ipv6-icmp
+permit proto icmp dport 7
+default deny
+`
+
+func TestWriteNFT(t *testing.T) {
+	a, err := Parse(strings.NewReader(renderList))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+
+	tests := map[string]struct {
+		opts *Options
+		want string
+	}{
+		"Chain": {
+			want: "table inet inettools {}\n" +
+				"delete table inet inettools\n" +
+				"table inet inettools {\n" +
+				"\tset acl_0_dst4 {\n" +
+				"\t\ttype ipv4_addr\n" +
+				"\t\tflags interval\n" +
+				"\t\telements = { 192.0.2.0/24, 198.51.100.0/24 }\n" +
+				"\t}\n" +
+				"\tset acl_2_src4 {\n" +
+				"\t\ttype ipv4_addr\n" +
+				"\t\tflags interval\n" +
+				"\t\telements = { 192.0.2.0/24, 203.0.113.0/24 }\n" +
+				"\t}\n" +
+				"\tchain acl {\n" +
+				"\t\tip daddr @acl_0_dst4 meta l4proto tcp th dport { 80, 443, 8000-8100 } accept\n" +
+				"\t\tip6 daddr 2001:db8::/32 meta l4proto tcp th dport { 80, 443, 8000-8100 } accept\n" +
+				"\t\tip saddr 198.51.100.53/32 meta l4proto udp th sport 53 accept\n" +
+				"\t\tip saddr @acl_2_src4 drop\n" +
+				"\t\tmeta l4proto { icmp, ipv6-icmp } accept\n" +
+				"\t\tdrop\n" +
+				"\t}\n" +
+				"}\n",
+		},
+		"Hook": {
+			opts: &Options{Table: "filter", Chain: "input", Hook: "input"},
+			want: "table inet filter {}\n" +
+				"delete table inet filter\n" +
+				"table inet filter {\n" +
+				"\tset input_0_dst4 {\n" +
+				"\t\ttype ipv4_addr\n" +
+				"\t\tflags interval\n" +
+				"\t\telements = { 192.0.2.0/24, 198.51.100.0/24 }\n" +
+				"\t}\n" +
+				"\tset input_2_src4 {\n" +
+				"\t\ttype ipv4_addr\n" +
+				"\t\tflags interval\n" +
+				"\t\telements = { 192.0.2.0/24, 203.0.113.0/24 }\n" +
+				"\t}\n" +
+				"\tchain input {\n" +
+				"\t\ttype filter hook input priority 0; policy drop;\n" +
+				"\t\tip daddr @input_0_dst4 meta l4proto tcp th dport { 80, 443, 8000-8100 } accept\n" +
+				"\t\tip6 daddr 2001:db8::/32 meta l4proto tcp th dport { 80, 443, 8000-8100 } accept\n" +
+				"\t\tip saddr 198.51.100.53/32 meta l4proto udp th sport 53 accept\n" +
+				"\t\tip saddr @input_2_src4 drop\n" +
+				"\t\tmeta l4proto { icmp, ipv6-icmp } accept\n" +
+				"\t}\n" +
+				"}\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteNFT(&buf, a, test.opts); err != nil {
+				t.Fatalf("write err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestWriteIPTables(t *testing.T) {
+	ports := "1-2,4-5,7-8,10-11,13-14,16-17,19-20,22-23"
+	a, err := Parse(strings.NewReader(renderList + "permit proto tcp,udp dport " + ports + "\n"))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+
+	tests := map[string]struct {
+		ipv6 bool
+		want string
+	}{
+		"IPv4": {
+			want: "*filter\n" +
+				":acl - [0:0]\n" +
+				"-A acl -m set --match-set acl_0_dst4 dst -p tcp -m multiport --dports 80,443,8000:8100 -j ACCEPT\n" +
+				"-A acl -s 198.51.100.53/32 -p udp --sport 53 -j ACCEPT\n" +
+				"-A acl -m set --match-set acl_2_src4 src -j DROP\n" +
+				"-A acl -p icmp -j ACCEPT\n" +
+				"-A acl -p ipv6-icmp -j ACCEPT\n" +
+				"-A acl -p tcp -m multiport --dports 1:2,4:5,7:8,10:11,13:14,16:17,19:20 -j ACCEPT\n" +
+				"-A acl -p tcp --dport 22:23 -j ACCEPT\n" +
+				"-A acl -p udp -m multiport --dports 1:2,4:5,7:8,10:11,13:14,16:17,19:20 -j ACCEPT\n" +
+				"-A acl -p udp --dport 22:23 -j ACCEPT\n" +
+				"-A acl -j DROP\n" +
+				"COMMIT\n",
+		},
+		"IPv6": {
+			ipv6: true,
+			want: "*filter\n" +
+				":acl - [0:0]\n" +
+				"-A acl -d 2001:db8::/32 -p tcp -m multiport --dports 80,443,8000:8100 -j ACCEPT\n" +
+				"-A acl -p icmp -j ACCEPT\n" +
+				"-A acl -p ipv6-icmp -j ACCEPT\n" +
+				"-A acl -p tcp -m multiport --dports 1:2,4:5,7:8,10:11,13:14,16:17,19:20 -j ACCEPT\n" +
+				"-A acl -p tcp --dport 22:23 -j ACCEPT\n" +
+				"-A acl -p udp -m multiport --dports 1:2,4:5,7:8,10:11,13:14,16:17,19:20 -j ACCEPT\n" +
+				"-A acl -p udp --dport 22:23 -j ACCEPT\n" +
+				"-A acl -j DROP\n" +
+				"COMMIT\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteIPTables(&buf, a, test.ipv6, nil); err != nil {
+				t.Fatalf("write err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestWriteIPSets(t *testing.T) {
+	// An entry with only IPv4 sources and only IPv6 destinations matches nothing, so needs no sets.
+	a, err := Parse(strings.NewReader(renderList + "permit src 192.0.2.0/24,203.0.113.0/24 dst 2001:db8::/32\n"))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteIPSets(&buf, a, nil); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	want := "create acl_0_dst4 hash:net family inet -exist\n" +
+		"flush acl_0_dst4\n" +
+		"add acl_0_dst4 192.0.2.0/24\n" +
+		"add acl_0_dst4 198.51.100.0/24\n" +
+		"create acl_2_src4 hash:net family inet -exist\n" +
+		"flush acl_2_src4\n" +
+		"add acl_2_src4 192.0.2.0/24\n" +
+		"add acl_2_src4 203.0.113.0/24\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	if err := WriteIPSets(&buf, a, &Options{Chain: strings.Repeat("x", 30)}); err == nil {
+		t.Errorf("WriteIPSets: got no error for long set name")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/yl2chen/cidranger"
 	"net"
 	"sort"
+	"strings"
 )
 
 func removeContained(pfxs []*net.IPNet) ([]*net.IPNet, error) {
@@ -106,18 +107,63 @@ func IPNets(pfxs []*net.IPNet) ([]*net.IPNet, error) {
 	return mergeAdjacent(contained), nil
 }
 
-// Strings is a convenience function that accepts a slice of CIDR prefix strings instead of net.IPNet structs.
+// Exclude aggregates pfxs after removing the addresses covered by the excluded prefixes, splitting prefixes that only
+// partly overlap an exclusion into the smallest set of prefixes covering what remains.
+func Exclude(pfxs, excluded []*net.IPNet) ([]*net.IPNet, error) {
+	remaining, err := removeContained(pfxs)
+	if err != nil {
+		return nil, err
+	}
+	for _, ex := range excluded {
+		var kept []*net.IPNet
+		for _, pfx := range remaining {
+			kept = append(kept, subtract(pfx, ex)...)
+		}
+		remaining = kept
+	}
+	return IPNets(remaining)
+}
+
+// subtract returns the prefixes covering the addresses of pfx that are not within ex.
+func subtract(pfx, ex *net.IPNet) []*net.IPNet {
+	pfxLen, bits := pfx.Mask.Size()
+	exLen, exBits := ex.Mask.Size()
+	switch {
+	case bits != exBits, !pfx.Contains(ex.IP) && !ex.Contains(pfx.IP):
+		return []*net.IPNet{pfx}
+	case exLen <= pfxLen:
+		return nil
+	}
+
+	// Split the prefix in two: the half without the exclusion is kept whole, and the exclusion is subtracted from the
+	// other half.
+	lower := &net.IPNet{IP: pfx.IP.Mask(pfx.Mask), Mask: net.CIDRMask(pfxLen+1, bits)}
+	upper := &net.IPNet{IP: append(net.IP(nil), lower.IP...), Mask: lower.Mask}
+	upper.IP[pfxLen/8] |= 0x80 >> uint(pfxLen%8)
+	if lower.Contains(ex.IP) {
+		return append(subtract(lower, ex), upper)
+	}
+	return append(subtract(upper, ex), lower)
+}
+
+// Strings is a convenience function that accepts a slice of CIDR prefix strings instead of net.IPNet structs. Prefixes
+// starting with "!" are excluded, as with Exclude, regardless of where they appear.
 func Strings(pfxs []string) ([]string, error) {
 	ipNets := make([]*net.IPNet, 0, len(pfxs))
+	var excluded []*net.IPNet
 	for _, pfx := range pfxs {
-		_, ipNet, err := net.ParseCIDR(pfx)
+		_, ipNet, err := net.ParseCIDR(strings.TrimPrefix(pfx, "!"))
 		if err != nil {
 			return nil, err
 		}
+		if strings.HasPrefix(pfx, "!") {
+			excluded = append(excluded, ipNet)
+			continue
+		}
 		ipNets = append(ipNets, ipNet)
 	}
 
-	ipNets, err := IPNets(ipNets)
+	ipNets, err := Exclude(ipNets, excluded)
 	if err != nil {
 		return nil, err
 	}
@@ -128,4 +174,4 @@ func Strings(pfxs []string) ([]string, error) {
 	}
 
 	return ipNetStrs, nil
-}
\ No newline at end of file
+}
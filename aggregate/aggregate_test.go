@@ -154,6 +154,71 @@ func TestAggregate(t *testing.T) {
 	}
 }
 
+func TestExclude(t *testing.T) {
+	tests := map[string]struct {
+		input []string
+		want  []string
+	}{
+		"Hole": {
+			input: []string{"10.0.0.0/8", "!10.1.2.0/24"},
+			want: []string{
+				"10.0.0.0/16",
+				"10.1.0.0/23",
+				"10.1.3.0/24",
+				"10.1.4.0/22",
+				"10.1.8.0/21",
+				"10.1.16.0/20",
+				"10.1.32.0/19",
+				"10.1.64.0/18",
+				"10.1.128.0/17",
+				"10.2.0.0/15",
+				"10.4.0.0/14",
+				"10.8.0.0/13",
+				"10.16.0.0/12",
+				"10.32.0.0/11",
+				"10.64.0.0/10",
+				"10.128.0.0/9",
+			},
+		},
+		"ExclusionFirst": {
+			input: []string{"!192.0.2.128/25", "192.0.2.0/25", "192.0.2.128/25"},
+			want:  []string{"192.0.2.0/25"},
+		},
+		"Covering": {
+			input: []string{"192.0.2.0/25", "198.51.100.0/24", "!192.0.2.0/24"},
+			want:  []string{"198.51.100.0/24"},
+		},
+		"Everything": {
+			input: []string{"2001:db8::/32", "!::/0"},
+			want:  []string{},
+		},
+		"Unrelated": {
+			input: []string{"192.0.2.0/24", "!198.51.100.0/24", "!2001:db8::/32"},
+			want:  []string{"192.0.2.0/24"},
+		},
+		"IPv6": {
+			input: []string{"2001:db8::/47", "!2001:db8::/48", "!2001:db8:1::/49"},
+			want:  []string{"2001:db8:1:8000::/49"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Strings(tc.input)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	if _, err := Strings([]string{"!192.0.2.0/33"}); err == nil {
+		t.Fatalf("invalid exclusion: got nil err")
+	}
+}
+
 func benchmarkIPNets(l int, b *testing.B) {
 	pfxs := make([]*net.IPNet, 1<<(32-l))
 	switch {
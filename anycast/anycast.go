@@ -0,0 +1,195 @@
+package anycast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/httpprobe"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults used by a Prober whose fields are not set.
+const (
+	DefaultCount    = 5
+	DefaultInterval = time.Second
+)
+
+// Names queried in the CHAOS class for the identity of a DNS server: id.server of RFC 4892, and the older convention
+// of BIND.
+const (
+	IDServer     = "id.server."
+	HostnameBind = "hostname.bind."
+)
+
+// ErrNoIdentity is returned when a service answered, but did not say which instance it is.
+var ErrNoIdentity = errors.New("instance did not identify itself")
+
+// Query asks an anycast service once which instance answered, returning its identity and the round-trip time.
+type Query func(ctx context.Context) (instance string, rtt time.Duration, err error)
+
+// DNS returns a query for the identity of the DNS server c sends to. It asks for the TXT record of id.server in the
+// CHAOS class, and the NSID of RFC 5001 alongside it, falling back to hostname.bind if neither is given. The round-trip
+// time is that of the first query.
+func DNS(c *dnsutil.Client) Query {
+	return func(ctx context.Context) (string, time.Duration, error) {
+		var first time.Duration
+		for i, name := range []string{IDServer, HostnameBind} {
+			edns := dnsutil.EDNS{UDPSize: dnsutil.DefaultUDPSize}
+			if c.EDNS != nil {
+				edns = *c.EDNS
+			}
+			edns.Options = []dnsutil.EDNSOption{{Code: dnsutil.OptionNSID}}
+			q := &dnsutil.Message{
+				Questions: []dnsutil.Question{{Name: name, Type: dnsutil.TypeTXT, Class: dnsutil.ClassCHAOS}},
+				EDNS:      &edns,
+			}
+			resp, rtt, err := c.Exchange(ctx, q)
+			if err != nil {
+				return "", 0, err
+			}
+			if i == 0 {
+				first = rtt
+			}
+			for _, rr := range dnsutil.Answers(resp, name, dnsutil.TypeTXT) {
+				if txt, ok := rr.Data.(*dnsutil.TXT); ok && len(txt.Strings) > 0 {
+					return strings.Join(txt.Strings, ""), first, nil
+				}
+			}
+			if resp.EDNS != nil {
+				if opt := resp.EDNS.Option(dnsutil.OptionNSID); opt != nil && len(opt.Data) > 0 {
+					return string(opt.Data), first, nil
+				}
+			}
+		}
+		return "", first, fmt.Errorf("%w: %s", ErrNoIdentity, c.Server)
+	}
+}
+
+// HTTP returns a query fetching url, taking the identity of the instance from a header of the response, such as
+// X-Served-By or CF-Ray; only its first value is used. The round-trip time is the time to connect, which is the
+// network's share of the probe, or the time to the first byte of the response if no connection was made.
+func HTTP(p *httpprobe.Prober, url, header string) Query {
+	return func(ctx context.Context) (string, time.Duration, error) {
+		res, err := p.Probe(ctx, url)
+		if err != nil {
+			return "", 0, err
+		}
+		rtt := res.Timings.Connect
+		if rtt == 0 {
+			rtt = res.Timings.TTFB
+		}
+		instance := res.Header.Get(header)
+		if instance == "" {
+			return "", rtt, fmt.Errorf("%w: no %s header from %s", ErrNoIdentity, header, url)
+		}
+		return instance, rtt, nil
+	}
+}
+
+// Instance summarises the answers from one instance of a service.
+type Instance struct {
+	Name      string
+	Count     int
+	MinRTT    time.Duration
+	MeanRTT   time.Duration
+	MaxRTT    time.Duration
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Catchment summarises which instances of a service answered a run of queries from this vantage point.
+type Catchment struct {
+	Instances []Instance // By the number of answers, most first, and then by name.
+	Failures  int        // Queries that failed, or were answered without an identity.
+	Changes   int        // The times the instance answering differed from the one that answered before.
+	LastErr   error      // The error of the last query that failed.
+}
+
+// Instance returns the instance that answered most often, or nil if none did.
+func (c *Catchment) Instance() *Instance {
+	if len(c.Instances) == 0 {
+		return nil
+	}
+	return &c.Instances[0]
+}
+
+// Prober runs a series of queries against an anycast service, to find which instances the local vantage point is in
+// the catchment of and the latency to each. The zero value is usable.
+type Prober struct {
+	Count    int           // The number of queries, or DefaultCount if zero.
+	Interval time.Duration // The time between queries, or DefaultInterval if zero.
+}
+
+// Run runs the queries, stopping early if the context is done. An error is returned only if no query was answered
+// with an identity, along with the catchment.
+func (p *Prober) Run(ctx context.Context, q Query) (*Catchment, error) {
+	count, interval := p.Count, p.Interval
+	if count <= 0 {
+		count = DefaultCount
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	c := &Catchment{}
+	byName := map[string]*Instance{}
+	sums := map[string]time.Duration{}
+	var last string
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+queries:
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				c.LastErr = ctx.Err()
+				break queries
+			case <-ticker.C:
+			}
+		}
+		name, rtt, err := q(ctx)
+		if err != nil {
+			c.Failures++
+			c.LastErr = err
+			continue
+		}
+		now := time.Now()
+		inst := byName[name]
+		if inst == nil {
+			inst = &Instance{Name: name, MinRTT: rtt, FirstSeen: now}
+			byName[name] = inst
+		}
+		if last != "" && name != last {
+			c.Changes++
+		}
+		last = name
+		inst.Count++
+		inst.LastSeen = now
+		sums[name] += rtt
+		if rtt < inst.MinRTT {
+			inst.MinRTT = rtt
+		}
+		if rtt > inst.MaxRTT {
+			inst.MaxRTT = rtt
+		}
+	}
+
+	for name, inst := range byName {
+		inst.MeanRTT = sums[name] / time.Duration(inst.Count)
+		c.Instances = append(c.Instances, *inst)
+	}
+	sort.Slice(c.Instances, func(i, j int) bool {
+		a, b := c.Instances[i], c.Instances[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	if len(c.Instances) == 0 {
+		return c, c.LastErr
+	}
+	return c, nil
+}
@@ -0,0 +1,135 @@
+package anycast
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/httpprobe"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// server answers identity queries as a DNS server would, from canned answers to each name.
+type server struct {
+	txt  map[string]string
+	nsid string
+}
+
+func (s *server) Exchange(_ context.Context, q *dnsutil.Message) (*dnsutil.Message, time.Duration, error) {
+	resp := &dnsutil.Message{ID: q.ID, Response: true, Questions: q.Questions}
+	question := q.Questions[0]
+	if question.Class != dnsutil.ClassCHAOS || q.EDNS == nil || q.EDNS.Option(dnsutil.OptionNSID) == nil {
+		return nil, 0, errors.New("unexpected query")
+	}
+	if txt, ok := s.txt[question.Name]; ok {
+		resp.Answers = []dnsutil.RR{{Name: question.Name, Type: dnsutil.TypeTXT, Class: dnsutil.ClassCHAOS,
+			Data: &dnsutil.TXT{Strings: []string{txt}}}}
+	} else {
+		resp.RCode = dnsutil.RCodeRefused
+	}
+	if s.nsid != "" {
+		resp.EDNS = &dnsutil.EDNS{Options: []dnsutil.EDNSOption{{Code: dnsutil.OptionNSID, Data: []byte(s.nsid)}}}
+	}
+	return resp, 10 * time.Millisecond, nil
+}
+
+func TestDNS(t *testing.T) {
+	tests := map[string]struct {
+		server  *server
+		want    string
+		wantErr error
+	}{
+		"IDServer":     {server: &server{txt: map[string]string{IDServer: "lhr1", HostnameBind: "ns1"}}, want: "lhr1"},
+		"NSID":         {server: &server{nsid: "ams2"}, want: "ams2"},
+		"HostnameBind": {server: &server{txt: map[string]string{HostnameBind: "ns1"}}, want: "ns1"},
+		"Anonymous":    {server: &server{}, wantErr: ErrNoIdentity},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := dnsutil.NewClient("192.0.2.53")
+			c.Transport = test.server
+			got, rtt, err := DNS(c)(context.Background())
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got err %v, want %v", err, test.wantErr)
+			}
+			if got != test.want || rtt != 10*time.Millisecond {
+				t.Fatalf("got %q in %v, want %q", got, rtt, test.want)
+			}
+		})
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "cache-fra1")
+	}))
+	defer srv.Close()
+	p := &httpprobe.Prober{Timeout: 5 * time.Second}
+	got, rtt, err := HTTP(p, srv.URL, "X-Served-By")(context.Background())
+	if err != nil {
+		t.Fatalf("query err: %v", err)
+	}
+	if got != "cache-fra1" || rtt <= 0 {
+		t.Fatalf("got %q in %v", got, rtt)
+	}
+	if _, _, err := HTTP(p, srv.URL, "CF-Ray")(context.Background()); !errors.Is(err, ErrNoIdentity) {
+		t.Fatalf("got err %v, want ErrNoIdentity", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	answers := []struct {
+		name string
+		rtt  time.Duration
+		err  error
+	}{
+		{"lhr1", 10 * time.Millisecond, nil},
+		{"lhr1", 20 * time.Millisecond, nil},
+		{"", 0, errors.New("timeout")},
+		{"ams2", 30 * time.Millisecond, nil},
+		{"lhr1", 30 * time.Millisecond, nil},
+	}
+	i := 0
+	q := func(context.Context) (string, time.Duration, error) {
+		a := answers[i]
+		i++
+		return a.name, a.rtt, a.err
+	}
+	p := &Prober{Count: len(answers), Interval: time.Millisecond}
+	got, err := p.Run(context.Background(), q)
+	if err != nil {
+		t.Fatalf("run err: %v", err)
+	}
+	want := &Catchment{
+		Instances: []Instance{
+			{Name: "lhr1", Count: 3, MinRTT: 10 * time.Millisecond, MeanRTT: 20 * time.Millisecond,
+				MaxRTT: 30 * time.Millisecond},
+			{Name: "ams2", Count: 1, MinRTT: 30 * time.Millisecond, MeanRTT: 30 * time.Millisecond,
+				MaxRTT: 30 * time.Millisecond},
+		},
+		Failures: 1,
+		Changes:  2,
+	}
+	for i := range got.Instances {
+		if got.Instances[i].FirstSeen.IsZero() || got.Instances[i].LastSeen.Before(got.Instances[i].FirstSeen) {
+			t.Fatalf("instance %s seen from %v to %v", got.Instances[i].Name, got.Instances[i].FirstSeen,
+				got.Instances[i].LastSeen)
+		}
+		got.Instances[i].FirstSeen, got.Instances[i].LastSeen = time.Time{}, time.Time{}
+	}
+	got.LastErr = nil
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if got.Instance().Name != "lhr1" {
+		t.Fatalf("got instance %v", got.Instance().Name)
+	}
+
+	failing := func(context.Context) (string, time.Duration, error) { return "", 0, ErrNoIdentity }
+	if _, err := p.Run(context.Background(), failing); !errors.Is(err, ErrNoIdentity) {
+		t.Fatalf("got err %v, want ErrNoIdentity", err)
+	}
+}
@@ -0,0 +1,152 @@
+package asrel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Relationship is the relationship of a neighbouring AS to an AS.
+type Relationship int
+
+// Relationships of neighbours.
+const (
+	None     Relationship = iota // The ASes are not known to be neighbours.
+	Customer                     // The neighbour is a customer of the AS.
+	Provider                     // The neighbour is a provider of the AS.
+	Peer                         // The neighbour and the AS peer settlement-free.
+)
+
+func (r Relationship) String() string {
+	switch r {
+	case None:
+		return "none"
+	case Customer:
+		return "customer"
+	case Provider:
+		return "provider"
+	case Peer:
+		return "peer"
+	}
+	return "Relationship(" + strconv.Itoa(int(r)) + ")"
+}
+
+// reverse returns the relationship as seen from the neighbour.
+func (r Relationship) reverse() Relationship {
+	switch r {
+	case Customer:
+		return Provider
+	case Provider:
+		return Customer
+	}
+	return r
+}
+
+// Graph holds the relationships between ASes. It is not safe for concurrent modification.
+type Graph struct {
+	rels map[uint32]map[uint32]Relationship
+}
+
+// NewGraph returns an empty graph.
+func NewGraph() *Graph {
+	return &Graph{rels: map[uint32]map[uint32]Relationship{}}
+}
+
+// Add records the relationship of a neighbour to an AS, and the reverse relationship, replacing any already known.
+func (g *Graph) Add(as, neighbour uint32, rel Relationship) {
+	g.set(as, neighbour, rel)
+	g.set(neighbour, as, rel.reverse())
+}
+
+// set records the relationship of a neighbour to an AS.
+func (g *Graph) set(as, neighbour uint32, rel Relationship) {
+	m := g.rels[as]
+	if m == nil {
+		m = map[uint32]Relationship{}
+		g.rels[as] = m
+	}
+	m[neighbour] = rel
+}
+
+// Relationship returns the relationship of a neighbour to an AS.
+func (g *Graph) Relationship(as, neighbour uint32) Relationship {
+	return g.rels[as][neighbour]
+}
+
+// Neighbours returns the neighbours of an AS with a relationship to it, in order.
+func (g *Graph) Neighbours(as uint32, rel Relationship) []uint32 {
+	var asns []uint32
+	for n, r := range g.rels[as] {
+		if r == rel {
+			asns = append(asns, n)
+		}
+	}
+	sort.Slice(asns, func(i, j int) bool { return asns[i] < asns[j] })
+	return asns
+}
+
+// CustomerCone returns the ASes reachable from an AS by following links to customers, including itself, in order.
+// These are the ASes whose routes it is expected to announce to its peers and providers.
+func (g *Graph) CustomerCone(as uint32) []uint32 {
+	seen := map[uint32]bool{as: true}
+	for queue := []uint32{as}; len(queue) > 0; queue = queue[1:] {
+		for n, r := range g.rels[queue[0]] {
+			if r == Customer && !seen[n] {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	cone := make([]uint32, 0, len(seen))
+	for n := range seen {
+		cone = append(cone, n)
+	}
+	sort.Slice(cone, func(i, j int) bool { return cone[i] < cone[j] })
+	return cone
+}
+
+// Len returns the number of ASes with known relationships.
+func (g *Graph) Len() int {
+	return len(g.rels)
+}
+
+// Parse reads AS relationships in the format published by CAIDA, of lines of two ASNs and a relationship separated by
+// |: -1 if the first is a provider of the second, and 0 if they are peers. Any further fields, such as the source of
+// the serial-2 format, are ignored, as are lines starting with #. Relationships are added to g, or a new graph if it
+// is nil, which is returned.
+func Parse(r io.Reader, g *Graph) (*Graph, error) {
+	if g == nil {
+		g = NewGraph()
+	}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "|")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: want two asns and a relationship", line)
+		}
+		a, errA := strconv.ParseUint(fields[0], 10, 32)
+		b, errB := strconv.ParseUint(fields[1], 10, 32)
+		if errA != nil || errB != nil {
+			return nil, fmt.Errorf("line %d: invalid asn", line)
+		}
+		switch fields[2] {
+		case "-1":
+			g.Add(uint32(a), uint32(b), Customer)
+		case "0":
+			g.Add(uint32(a), uint32(b), Peer)
+		default:
+			return nil, fmt.Errorf("line %d: unknown relationship %q", line, fields[2])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
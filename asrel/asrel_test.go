@@ -0,0 +1,110 @@
+package asrel
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"strings"
+	"testing"
+)
+
+// testGraph has two tier-1 peers, 1 and 2, with customers 10 and 20, which peer, and 10 has a customer 100.
+const testGraph = `# source:topology|BGP
+1|2|0
+1|10|-1
+2|20|-1|bgp
+10|20|0
+10|100|-1
+`
+
+func TestParse(t *testing.T) {
+	g, err := Parse(strings.NewReader(testGraph), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tests := map[string]struct {
+		as, neighbour uint32
+		want          Relationship
+	}{
+		"Customer": {1, 10, Customer},
+		"Provider": {10, 1, Provider},
+		"Peer":     {20, 10, Peer},
+		"None":     {1, 100, None},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := g.Relationship(tc.as, tc.neighbour); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+	if diff := cmp.Diff([]uint32{1, 10, 100}, g.CustomerCone(1)); diff != "" {
+		t.Fatalf("cone: %v", diff)
+	}
+	if diff := cmp.Diff([]uint32{1, 100}, append(g.Neighbours(10, Provider), g.Neighbours(10, Customer)...)); diff != "" {
+		t.Fatalf("neighbours: %v", diff)
+	}
+	if g.Len() != 5 {
+		t.Fatalf("got %d ases, want 5", g.Len())
+	}
+
+	for _, input := range []string{"1|2\n", "1|x|0\n", "1|2|1\n"} {
+		if _, err := Parse(strings.NewReader(input), nil); err == nil {
+			t.Fatalf("%q: got no error", input)
+		}
+	}
+}
+
+func TestLeak(t *testing.T) {
+	g, err := Parse(strings.NewReader(testGraph), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tests := map[string]struct {
+		path        []uint32
+		want        *Leak
+		wantUnknown []int
+	}{
+		"UpPeerDown": {path: []uint32{20, 2, 1, 10, 100}},
+		"Prepended":  {path: []uint32{20, 10, 10, 10, 100}},
+		"Unknown":    {path: []uint32{64496, 20, 10, 100}, wantUnknown: []int{0}},
+		// 10 sends a route learned from its provider 1 to its peer 20.
+		"ProviderToPeer": {path: []uint32{20, 10, 1}, want: &Leak{AS: 10, Index: 1, LearnedFrom: 1, Learned: Provider,
+			SentTo: 20, Sent: Peer}},
+		// 10 sends a route learned from its peer 20 to its provider 1.
+		"PeerToProvider": {path: []uint32{2, 1, 10, 20}, want: &Leak{AS: 10, Index: 2, LearnedFrom: 20, Learned: Peer,
+			SentTo: 1, Sent: Provider}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			leak, unknown := g.Leak(tc.path)
+			if diff := cmp.Diff(tc.want, leak); diff != "" {
+				t.Fatalf("leak: %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantUnknown, unknown); diff != "" {
+				t.Fatalf("unknown: %v", diff)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	path := []uint32{64500, 64501, 64501, 64502, 64502, 64502}
+	if diff := cmp.Diff([]uint32{64500, 64501, 64502}, Collapse(path)); diff != "" {
+		t.Fatalf("collapse: %v", diff)
+	}
+	if n := Prepends(path); n != 3 {
+		t.Fatalf("got %d prepends, want 3", n)
+	}
+	if HasLoop(path) || !HasLoop([]uint32{1, 2, 1}) {
+		t.Fatalf("loops detected wrongly")
+	}
+
+	got := Compare(path, []uint32{64510, 64503, 64502})
+	want := Comparison{SameOrigin: true, CommonSuffix: 1, Added: []uint32{64510, 64503},
+		Removed: []uint32{64500, 64501}, PrependDelta: -3}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("compare: %v", diff)
+	}
+	if c := Compare(path, path); !c.Equal || c.CommonSuffix != 3 {
+		t.Fatalf("got %+v comparing a path with itself", c)
+	}
+}
@@ -0,0 +1,111 @@
+package asrel
+
+// Collapse returns an AS path without prepending, each run of an ASN repeated replaced by a single instance.
+func Collapse(path []uint32) []uint32 {
+	collapsed := make([]uint32, 0, len(path))
+	for i, asn := range path {
+		if i == 0 || asn != path[i-1] {
+			collapsed = append(collapsed, asn)
+		}
+	}
+	return collapsed
+}
+
+// Prepends returns the number of ASNs in an AS path that repeat the one before them.
+func Prepends(path []uint32) int {
+	return len(path) - len(Collapse(path))
+}
+
+// HasLoop returns whether an AS appears in an AS path more than once, other than by prepending.
+func HasLoop(path []uint32) bool {
+	seen := map[uint32]bool{}
+	for _, asn := range Collapse(path) {
+		if seen[asn] {
+			return true
+		}
+		seen[asn] = true
+	}
+	return false
+}
+
+// Leak is a violation of the valley-free export rules by an AS in a path: announcing a route learned from a provider
+// or peer to another provider or peer, as in route leaks of types 1 to 4 of RFC 7908.
+type Leak struct {
+	AS          uint32
+	Index       int          // The position of the AS in the collapsed path.
+	LearnedFrom uint32       // The neighbour the AS learned the route from, towards the origin.
+	Learned     Relationship // Its relationship to the AS.
+	SentTo      uint32       // The neighbour the AS announced the route to, towards the receiver.
+	Sent        Relationship // Its relationship to the AS.
+}
+
+// Leak returns the first leak in an AS path, listed from the neighbour of the receiver to the origin as in BGP, or nil
+// if the path is valley-free as far as the relationships of its links are known. Links whose relationship is unknown
+// are assumed not to be the cause of a leak, and are returned in unknown as the indexes of their ASes nearer the
+// receiver in the collapsed path.
+func (g *Graph) Leak(path []uint32) (leak *Leak, unknown []int) {
+	path = Collapse(path)
+	// Walking from the origin, the route may climb from customers to providers, cross one peering, then only descend
+	// to customers. Once it has crossed a peering or descended, it may not climb or cross another.
+	descending := false
+	var learned Relationship
+	for i := len(path) - 2; i >= 0; i-- {
+		sender, receiver := path[i+1], path[i]
+		rel := g.Relationship(sender, receiver)
+		if rel == None {
+			unknown, learned = append(unknown, i), None
+			continue
+		}
+		if descending && (rel == Provider || rel == Peer) && leak == nil {
+			leak = &Leak{AS: sender, Index: i + 1, LearnedFrom: path[i+2], Learned: learned, SentTo: receiver, Sent: rel}
+		}
+		if rel == Peer || rel == Customer {
+			descending = true
+		}
+		learned = rel.reverse()
+	}
+	return leak, unknown
+}
+
+// Comparison describes how an AS path differs from a previous one.
+type Comparison struct {
+	Equal        bool     // Whether the paths are identical, including prepending.
+	SameOrigin   bool     // Whether the paths end in the same AS.
+	CommonSuffix int      // The number of ASes the collapsed paths share, from the origin.
+	Added        []uint32 // The ASes in the new path but not the old, in path order.
+	Removed      []uint32 // The ASes in the old path but not the new, in path order.
+	LengthDelta  int      // The change in length of the collapsed path.
+	PrependDelta int      // The change in the number of prepends.
+}
+
+// Compare compares an AS path with a previous one.
+func Compare(prev, cur []uint32) Comparison {
+	c := Comparison{Equal: len(prev) == len(cur), PrependDelta: Prepends(cur) - Prepends(prev)}
+	for i := 0; c.Equal && i < len(prev); i++ {
+		c.Equal = prev[i] == cur[i]
+	}
+	o, n := Collapse(prev), Collapse(cur)
+	c.LengthDelta = len(n) - len(o)
+	c.SameOrigin = len(o) > 0 && len(n) > 0 && o[len(o)-1] == n[len(n)-1]
+	for c.CommonSuffix < len(o) && c.CommonSuffix < len(n) &&
+		o[len(o)-1-c.CommonSuffix] == n[len(n)-1-c.CommonSuffix] {
+		c.CommonSuffix++
+	}
+	c.Added, c.Removed = difference(n, o), difference(o, n)
+	return c
+}
+
+// difference returns the ASes in a but not b, in order.
+func difference(a, b []uint32) []uint32 {
+	inB := map[uint32]bool{}
+	for _, asn := range b {
+		inB[asn] = true
+	}
+	var diff []uint32
+	for _, asn := range a {
+		if !inB[asn] {
+			diff = append(diff, asn)
+		}
+	}
+	return diff
+}
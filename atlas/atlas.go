@@ -0,0 +1,427 @@
+package atlas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/icmp"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/dotwaffle/inettools/scheduler"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Type is the type of an Atlas measurement.
+type Type string
+
+// Types of measurement that can be decoded.
+const (
+	TypePing       Type = "ping"
+	TypeTraceroute Type = "traceroute"
+	TypeDNS        Type = "dns"
+)
+
+// Errors returned while decoding results.
+var (
+	ErrUnsupportedType = errors.New("unsupported measurement type")
+	ErrTimeout         = errors.New("timeout")
+)
+
+// Result is a single result of a RIPE Atlas measurement, decoded into the types of this module's own probes so that
+// they can be analysed together.
+type Result struct {
+	Measurement     int // The measurement ID.
+	Probe           int // The ID of the probe that measured.
+	Type            Type
+	Time            time.Time
+	From            net.IP // The public address of the probe.
+	Source          net.IP // The address the probe measured from, which may be private.
+	Destination     net.IP
+	DestinationName string // The name measured, or the address if it was given as one.
+
+	// The measurement: a *udpprobe.Stats for a ping, with the RTTs of ICMP echoes in place of UDP ones, a
+	// *pathprobe.Report for a traceroute, or the *dnsutil.Message in response to a DNS query. It is nil if the
+	// measurement failed.
+	Value interface{}
+	RTT   time.Duration // The response time of a DNS query.
+	Err   error         // Why the measurement failed, as reported by the probe.
+}
+
+// Scheduler returns the result as if from a job of a scheduler, such as for sink.FromResult, named after the
+// measurement and targeting the destination. A traceroute that did not reach its destination fails with
+// scheduler.ErrNotReached, as a scheduler.Path probe does.
+func (r *Result) Scheduler() scheduler.Result {
+	res := scheduler.Result{
+		Job:      "atlas-" + strconv.Itoa(r.Measurement),
+		Target:   r.DestinationName,
+		Start:    r.Time,
+		Duration: r.RTT,
+		Value:    r.Value,
+		Err:      r.Err,
+	}
+	if res.Target == "" && r.Destination != nil {
+		res.Target = r.Destination.String()
+	}
+	if report, ok := r.Value.(*pathprobe.Report); ok && !report.Reached && res.Err == nil {
+		res.Err = scheduler.ErrNotReached
+	}
+	return res
+}
+
+// Decode decodes results as downloaded from the Atlas API: a JSON array of results, or a stream of results one after
+// another, as from the streaming API or with format=txt.
+func Decode(r io.Reader) ([]*Result, error) {
+	dec := json.NewDecoder(r)
+	var raws []json.RawMessage
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			var list []json.RawMessage
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, err
+			}
+			raws = append(raws, list...)
+			continue
+		}
+		raws = append(raws, raw)
+	}
+
+	var results []*Result
+	for _, raw := range raws {
+		rs, err := Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rs...)
+	}
+	return results, nil
+}
+
+// result is the JSON of a result, with the fields of every type that can be decoded.
+type result struct {
+	Type      Type            `json:"type"`
+	MsmID     int             `json:"msm_id"`
+	PrbID     int             `json:"prb_id"`
+	Timestamp int64           `json:"timestamp"`
+	From      string          `json:"from"`
+	SrcAddr   string          `json:"src_addr"`
+	DstAddr   string          `json:"dst_addr"`
+	DstName   string          `json:"dst_name"`
+	Sent      int             `json:"sent"`
+	Result    json.RawMessage `json:"result"`
+	ResultSet []dnsResult     `json:"resultset"`
+	Error     json.RawMessage `json:"error"`
+}
+
+// Parse decodes a single result. DNS measurements made with every resolver of the probe give a result for each.
+func Parse(b []byte) ([]*Result, error) {
+	var raw result
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	r := &Result{
+		Measurement:     raw.MsmID,
+		Probe:           raw.PrbID,
+		Type:            raw.Type,
+		Time:            time.Unix(raw.Timestamp, 0).UTC(),
+		From:            net.ParseIP(raw.From),
+		Source:          net.ParseIP(raw.SrcAddr),
+		Destination:     net.ParseIP(raw.DstAddr),
+		DestinationName: raw.DstName,
+	}
+	if r.DestinationName == "" {
+		r.DestinationName = raw.DstAddr
+	}
+
+	switch raw.Type {
+	case TypePing:
+		var replies []reply
+		if err := json.Unmarshal(raw.Result, &replies); err != nil {
+			return nil, fmt.Errorf("ping %d: %w", raw.MsmID, err)
+		}
+		r.Value = ping(r.Time, raw.Sent, replies)
+		return []*Result{r}, nil
+	case TypeTraceroute:
+		var hops []hop
+		if err := json.Unmarshal(raw.Result, &hops); err != nil {
+			return nil, fmt.Errorf("traceroute %d: %w", raw.MsmID, err)
+		}
+		report, err := traceroute(r.Destination, hops)
+		if err != nil {
+			return nil, fmt.Errorf("traceroute %d: %w", raw.MsmID, err)
+		}
+		r.Value = report
+		return []*Result{r}, nil
+	case TypeDNS:
+		sets := raw.ResultSet
+		if sets == nil {
+			sets = []dnsResult{{Time: raw.Timestamp, DstAddr: raw.DstAddr, Result: raw.Result, Error: raw.Error}}
+		}
+		var results []*Result
+		for _, set := range sets {
+			dr := *r
+			if set.Time != 0 {
+				dr.Time = time.Unix(set.Time, 0).UTC()
+			}
+			if set.DstAddr != "" {
+				dr.Destination = net.ParseIP(set.DstAddr)
+				if raw.DstName == "" {
+					dr.DestinationName = set.DstAddr
+				}
+			}
+			if err := set.decode(&dr); err != nil {
+				return nil, fmt.Errorf("dns %d: %w", raw.MsmID, err)
+			}
+			results = append(results, &dr)
+		}
+		return results, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedType, raw.Type)
+}
+
+// reply is a reply to a ping, or a timeout or error in its place.
+type reply struct {
+	RTT   *float64 `json:"rtt"` // In milliseconds.
+	Dup   int      `json:"dup"`
+	Error string   `json:"error"`
+}
+
+// ping summarises the replies to a ping.
+func ping(t time.Time, sent int, replies []reply) *udpprobe.Stats {
+	stats := &udpprobe.Stats{Sent: sent}
+	var sum, sumSquares float64
+	for _, r := range replies {
+		if r.Dup != 0 {
+			stats.Duplicates++
+			continue
+		}
+		s := udpprobe.Sample{Seq: uint32(len(stats.Samples)), Sent: t, Lost: r.RTT == nil}
+		stats.Samples = append(stats.Samples, s)
+		if r.RTT == nil {
+			continue
+		}
+		rtt := time.Duration(*r.RTT * float64(time.Millisecond))
+		stats.Samples[len(stats.Samples)-1].RTT = rtt
+		stats.Received++
+		if stats.Received == 1 || rtt < stats.MinRTT {
+			stats.MinRTT = rtt
+		}
+		if rtt > stats.MaxRTT {
+			stats.MaxRTT = rtt
+		}
+		sum += float64(rtt)
+		sumSquares += float64(rtt) * float64(rtt)
+	}
+	if stats.Sent == 0 {
+		stats.Sent = len(stats.Samples)
+	}
+	if stats.Received > 0 {
+		mean := sum / float64(stats.Received)
+		stats.MeanRTT = time.Duration(mean)
+		stats.StdDevRTT = time.Duration(math.Sqrt(math.Max(sumSquares/float64(stats.Received)-mean*mean, 0)))
+	}
+	return stats
+}
+
+// hop is the replies to the packets sent with one TTL of a traceroute.
+type hop struct {
+	Hop    int     `json:"hop"`
+	Error  string  `json:"error"`
+	Result []probe `json:"result"`
+}
+
+// probe is the reply to one packet of a traceroute, or a timeout in its place.
+type probe struct {
+	From    string          `json:"from"`
+	RTT     *float64        `json:"rtt"` // In milliseconds.
+	Err     json.RawMessage `json:"err"` // The ICMP unreachable code, as a letter or a number.
+	Late    int             `json:"late"`
+	Dup     bool            `json:"dup"`
+	X       string          `json:"x"`
+	ICMPExt *struct {
+		Obj []struct {
+			Class int `json:"class"`
+			Type  int `json:"type"`
+			MPLS  []struct {
+				Label uint32 `json:"label"`
+				Exp   uint8  `json:"exp"`
+				S     int    `json:"s"`
+				TTL   uint8  `json:"ttl"`
+			} `json:"mpls"`
+		} `json:"obj"`
+	} `json:"icmpext"`
+}
+
+// unreachable maps the letters Atlas reports ICMP unreachable codes as to errors.
+var unreachable = map[string]error{
+	"N": icmp.ErrNetworkUnreachable,
+	"H": icmp.ErrHostUnreachable,
+	"A": icmp.ErrAdministrativelyBlocked,
+	"P": icmp.ErrProtocolUnreachable,
+	"p": icmp.ErrPortUnreachable,
+}
+
+// traceroute builds a path report from the hops of a traceroute. Hops reporting an error instead of replies, such as
+// when the probe could not send, are left empty.
+func traceroute(dst net.IP, hops []hop) (*pathprobe.Report, error) {
+	report := &pathprobe.Report{Destination: dst}
+	sort.SliceStable(hops, func(i, j int) bool { return hops[i].Hop < hops[j].Hop })
+	for _, h := range hops {
+		if h.Hop < 1 || h.Hop > 255 {
+			return nil, fmt.Errorf("invalid hop %d", h.Hop)
+		}
+		for len(report.Hops) < h.Hop {
+			report.Hops = append(report.Hops, pathprobe.Hop{TTL: len(report.Hops) + 1})
+		}
+		ph := &report.Hops[h.Hop-1]
+		var sum, sumSquares float64
+		for _, p := range h.Result {
+			if p.Late != 0 || p.Dup {
+				continue
+			}
+			ph.Sent++
+			if p.RTT == nil {
+				continue
+			}
+			from := net.ParseIP(p.From)
+			if from == nil {
+				return nil, fmt.Errorf("hop %d: invalid address %q", h.Hop, p.From)
+			}
+			seen := false
+			for _, addr := range ph.Addrs {
+				seen = seen || addr.Equal(from)
+			}
+			if !seen {
+				ph.Addrs = append(ph.Addrs, from)
+			}
+			rtt := time.Duration(*p.RTT * float64(time.Millisecond))
+			ph.Received++
+			ph.Last = rtt
+			if ph.Received == 1 || rtt < ph.Best {
+				ph.Best = rtt
+			}
+			if rtt > ph.Worst {
+				ph.Worst = rtt
+			}
+			sum += float64(rtt)
+			sumSquares += float64(rtt) * float64(rtt)
+			if err := probeErr(p.Err); err != nil {
+				ph.Err = err
+			}
+			if p.ICMPExt != nil {
+				ph.MPLS = nil
+				for _, obj := range p.ICMPExt.Obj {
+					for _, l := range obj.MPLS {
+						ph.MPLS = append(ph.MPLS, icmp.MPLSLabel{
+							Label: l.Label, TC: l.Exp, BottomOfStack: l.S != 0, TTL: l.TTL,
+						})
+					}
+				}
+			}
+			if from.Equal(dst) {
+				report.Reached = true
+			}
+		}
+		if ph.Received > 0 {
+			mean := sum / float64(ph.Received)
+			ph.Mean = time.Duration(mean)
+			ph.StdDev = time.Duration(math.Sqrt(math.Max(sumSquares/float64(ph.Received)-mean*mean, 0)))
+		}
+		if ph.Sent > report.Rounds {
+			report.Rounds = ph.Sent
+		}
+	}
+	return report, nil
+}
+
+// probeErr returns the error of an ICMP unreachable code reported by a traceroute, or nil if there is none.
+func probeErr(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var letter string
+	if err := json.Unmarshal(raw, &letter); err == nil {
+		if err, ok := unreachable[letter]; ok {
+			return err
+		}
+		return fmt.Errorf("%w: %s", icmp.ErrUnreachable, letter)
+	}
+	return fmt.Errorf("%w: code %s", icmp.ErrUnreachable, raw)
+}
+
+// dnsResult is the response to a DNS query, or the error in its place.
+type dnsResult struct {
+	Time    int64           `json:"time"`
+	DstAddr string          `json:"dst_addr"`
+	Result  json.RawMessage `json:"result"`
+	Error   json.RawMessage `json:"error"`
+}
+
+// decode decodes the response to a DNS query into r.
+func (d dnsResult) decode(r *Result) error {
+	if len(d.Error) > 0 && string(d.Error) != "null" {
+		var e struct {
+			Timeout  *int   `json:"timeout"`
+			Socket   string `json:"socket"`
+			AddrInfo string `json:"getaddrinfo"`
+		}
+		if err := json.Unmarshal(d.Error, &e); err != nil {
+			return err
+		}
+		switch {
+		case e.Timeout != nil:
+			r.Err = ErrTimeout
+			r.RTT = time.Duration(*e.Timeout) * time.Millisecond
+		case e.Socket != "":
+			r.Err = errors.New(e.Socket)
+		case e.AddrInfo != "":
+			r.Err = errors.New(e.AddrInfo)
+		default:
+			r.Err = fmt.Errorf("error %s", d.Error)
+		}
+		return nil
+	}
+
+	var res struct {
+		ABuf string  `json:"abuf"`
+		RT   float64 `json:"rt"` // In milliseconds.
+	}
+	if err := json.Unmarshal(d.Result, &res); err != nil {
+		return err
+	}
+	r.RTT = time.Duration(res.RT * float64(time.Millisecond))
+	b, err := base64.StdEncoding.DecodeString(res.ABuf)
+	if err != nil {
+		return fmt.Errorf("abuf: %w", err)
+	}
+	msg, err := dnsutil.Unpack(b)
+	if err != nil {
+		return fmt.Errorf("abuf: %w", err)
+	}
+	r.Value = msg
+	if msg.RCode != dnsutil.RCodeSuccess {
+		r.Err = &dnsutil.RCodeError{Name: queryName(msg), Server: r.DestinationName, RCode: msg.RCode}
+	}
+	return nil
+}
+
+// queryName returns the name queried for in msg, or an empty string if it has no question.
+func queryName(msg *dnsutil.Message) string {
+	if len(msg.Questions) == 0 {
+		return ""
+	}
+	return msg.Questions[0].Name
+}
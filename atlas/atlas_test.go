@@ -0,0 +1,209 @@
+package atlas
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/icmp"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/dotwaffle/inettools/scheduler"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pingResult = `{"af":4,"avg":11,"dst_addr":"192.0.2.1","dst_name":"example.com","dup":0,"from":"198.51.100.7",
+"fw":5020,"lts":12,"max":12,"min":10,"msm_id":1001,"prb_id":6001,"proto":"ICMP","rcvd":2,"sent":3,"size":48,
+"src_addr":"10.0.0.2","step":240,"timestamp":1622548800,"ttl":54,"type":"ping",
+"result":[{"rtt":10},{"x":"*"},{"rtt":12},{"rtt":12.5,"dup":1}]}`
+
+const tracerouteResult = `{"af":4,"dst_addr":"192.0.2.1","dst_name":"192.0.2.1","endtime":1622548802,
+"from":"198.51.100.7","fw":5020,"lts":12,"msm_id":5001,"paris_id":1,"prb_id":6001,"proto":"ICMP","size":48,
+"src_addr":"10.0.0.2","timestamp":1622548800,"type":"traceroute","result":[
+{"hop":1,"result":[{"from":"10.0.0.1","rtt":1,"size":76,"ttl":64},{"from":"10.0.0.1","rtt":3,"size":76,"ttl":64},
+{"x":"*"}]},
+{"hop":3,"result":[{"from":"203.0.113.1","rtt":5,"size":140,"ttl":253,"icmpext":{"version":1,"rfc4884":0,
+"obj":[{"class":1,"type":1,"mpls":[{"exp":0,"label":16004,"s":1,"ttl":1}]}]}},{"x":"*"},{"x":"*"}]},
+{"hop":4,"result":[{"from":"192.0.2.1","rtt":8,"size":48,"ttl":60,"err":"H"},{"from":"192.0.2.1","rtt":9,
+"late":1}]}]}`
+
+func dnsJSON(t *testing.T, rcode int) string {
+	msg := &dnsutil.Message{Response: true, RCode: rcode, Questions: []dnsutil.Question{
+		{Name: "example.com.", Type: dnsutil.TypeA, Class: 1},
+	}}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack err: %v", err)
+	}
+	return `{"fw":5020,"lts":20,"msm_id":30001,"prb_id":6001,"timestamp":1622548800,"type":"dns",
+"from":"198.51.100.7","resultset":[
+{"af":4,"dst_addr":"192.0.2.53","lts":20,"proto":"UDP","result":{"ANCOUNT":0,"ARCOUNT":0,"ID":1,"NSCOUNT":0,
+"QDCOUNT":1,"abuf":"` + base64.StdEncoding.EncodeToString(b) + `","rt":25.5,"size":29},"time":1622548801},
+{"af":4,"dst_addr":"192.0.2.54","error":{"timeout":5000},"lts":20,"proto":"UDP","time":1622548802}]}`
+}
+
+func TestParsePing(t *testing.T) {
+	rs, err := Parse([]byte(pingResult))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	start := time.Unix(1622548800, 0).UTC()
+	want := []*Result{{
+		Measurement:     1001,
+		Probe:           6001,
+		Type:            TypePing,
+		Time:            start,
+		From:            net.ParseIP("198.51.100.7"),
+		Source:          net.ParseIP("10.0.0.2"),
+		Destination:     net.ParseIP("192.0.2.1"),
+		DestinationName: "example.com",
+		Value: &udpprobe.Stats{
+			Sent:       3,
+			Received:   2,
+			Duplicates: 1,
+			MinRTT:     10 * time.Millisecond,
+			MeanRTT:    11 * time.Millisecond,
+			MaxRTT:     12 * time.Millisecond,
+			StdDevRTT:  time.Millisecond,
+			Samples: []udpprobe.Sample{
+				{Seq: 0, Sent: start, RTT: 10 * time.Millisecond},
+				{Seq: 1, Sent: start, Lost: true},
+				{Seq: 2, Sent: start, RTT: 12 * time.Millisecond},
+			},
+		},
+	}}
+	if diff := cmp.Diff(want, rs, cmp.AllowUnexported(udpprobe.Sample{})); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestParseTraceroute(t *testing.T) {
+	rs, err := Parse([]byte(tracerouteResult))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	report, ok := rs[0].Value.(*pathprobe.Report)
+	if !ok {
+		t.Fatalf("got %T, want a path report", rs[0].Value)
+	}
+	if !report.Reached || report.Rounds != 3 || len(report.Hops) != 4 {
+		t.Fatalf("got %+v, want 4 hops in 3 rounds reaching the destination", report)
+	}
+
+	type hop struct {
+		TTL, Sent, Received int
+		Addrs               []string
+		Best, Mean, Worst   time.Duration
+		MPLS                []icmp.MPLSLabel
+	}
+	var got []hop
+	for _, h := range report.Hops {
+		var addrs []string
+		for _, addr := range h.Addrs {
+			addrs = append(addrs, addr.String())
+		}
+		got = append(got, hop{h.TTL, h.Sent, h.Received, addrs, h.Best, h.Mean, h.Worst, h.MPLS})
+	}
+	ms := time.Millisecond
+	want := []hop{
+		{TTL: 1, Sent: 3, Received: 2, Addrs: []string{"10.0.0.1"}, Best: ms, Mean: 2 * ms, Worst: 3 * ms},
+		{TTL: 2},
+		{TTL: 3, Sent: 3, Received: 1, Addrs: []string{"203.0.113.1"}, Best: 5 * ms, Mean: 5 * ms, Worst: 5 * ms,
+			MPLS: []icmp.MPLSLabel{{Label: 16004, BottomOfStack: true, TTL: 1}}},
+		{TTL: 4, Sent: 1, Received: 1, Addrs: []string{"192.0.2.1"}, Best: 8 * ms, Mean: 8 * ms, Worst: 8 * ms},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if !errors.Is(report.Hops[3].Err, icmp.ErrHostUnreachable) {
+		t.Fatalf("got %v, want %v", report.Hops[3].Err, icmp.ErrHostUnreachable)
+	}
+
+	res := rs[0].Scheduler()
+	if res.Job != "atlas-5001" || res.Target != "192.0.2.1" || res.Err != nil {
+		t.Fatalf("got %+v", res)
+	}
+	report.Reached = false
+	if res := rs[0].Scheduler(); !errors.Is(res.Err, scheduler.ErrNotReached) {
+		t.Fatalf("got %v, want %v", res.Err, scheduler.ErrNotReached)
+	}
+}
+
+func TestParseDNS(t *testing.T) {
+	tests := map[string]struct {
+		rcode   int
+		wantErr error
+	}{
+		"Success":  {rcode: dnsutil.RCodeSuccess},
+		"NXDOMAIN": {rcode: dnsutil.RCodeNameError, wantErr: dnsutil.ErrNXDomain},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rs, err := Parse([]byte(dnsJSON(t, test.rcode)))
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			if len(rs) != 2 {
+				t.Fatalf("got %d results, want one for each resolver", len(rs))
+			}
+
+			msg, ok := rs[0].Value.(*dnsutil.Message)
+			if !ok || msg.RCode != test.rcode || msg.Questions[0].Name != "example.com." {
+				t.Fatalf("got %+v", rs[0].Value)
+			}
+			if rs[0].DestinationName != "192.0.2.53" || rs[0].RTT != 25500*time.Microsecond {
+				t.Fatalf("got %+v", rs[0])
+			}
+			if test.wantErr == nil && rs[0].Err != nil || test.wantErr != nil && !errors.Is(rs[0].Err, test.wantErr) {
+				t.Fatalf("got %v, want %v", rs[0].Err, test.wantErr)
+			}
+
+			if rs[1].Value != nil || !errors.Is(rs[1].Err, ErrTimeout) || rs[1].RTT != 5*time.Second {
+				t.Fatalf("got %+v, want a timeout", rs[1])
+			}
+			if !rs[1].Time.Equal(time.Unix(1622548802, 0)) {
+				t.Fatalf("got time %v", rs[1].Time)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		"Array":       {input: "[" + pingResult + "," + tracerouteResult + "]", want: []int{1001, 5001}},
+		"Stream":      {input: pingResult + "\n" + tracerouteResult + "\n", want: []int{1001, 5001}},
+		"Empty":       {input: "[]"},
+		"Unsupported": {input: `[{"type":"sslcert","msm_id":1}]`, wantErr: true},
+		"Invalid":     {input: `[{"type":"ping"`, wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rs, err := Decode(strings.NewReader(test.input))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode err: %v", err)
+			}
+			var got []int
+			for _, r := range rs {
+				got = append(got, r.Measurement)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package bfd
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/packet"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Session whose fields are not set.
+const (
+	DefaultInterval   = 300 * time.Millisecond
+	DefaultDetectMult = 3
+)
+
+// slowInterval is the shortest interval at which control packets may be sent while a session is not up.
+const slowInterval = time.Second
+
+// Change is a change of state of a session.
+type Change struct {
+	Time time.Time
+	From packet.BFDState
+	To   packet.BFDState
+	Diag packet.BFDDiag // The reason for the change.
+}
+
+// Session is a single-hop BFD session with one peer in asynchronous mode, as defined by RFC 5880 and RFC 5881, without
+// authentication or the echo function. It is safe to call State while Run is running.
+type Session struct {
+	Peer          *net.UDPAddr  // The peer; its port defaults to packet.BFDPort.
+	DesiredMinTx  time.Duration // The interval to send control packets at once up, or DefaultInterval if zero.
+	RequiredMinRx time.Duration // The interval control packets can be received at, or DefaultInterval if zero.
+	DetectMult    uint8         // The number of packets that may be lost, or DefaultDetectMult if zero.
+	Discriminator uint32        // The local discriminator, or a random one if zero.
+
+	// OnChange, if set, is called by Run with each change of state.
+	OnChange func(*Change)
+
+	mu                 sync.Mutex
+	state              packet.BFDState
+	diag               packet.BFDDiag
+	remoteState        packet.BFDState
+	remoteDisc         uint32
+	remoteMinRx        time.Duration
+	remoteDesiredMinTx time.Duration
+	remoteDetectMult   uint8
+	poll               bool // A poll sequence is in progress.
+	rng                *rand.Rand
+	changes            []*Change // Changes not yet passed to OnChange.
+}
+
+// State returns the state of the session and the diagnostic code explaining it.
+func (s *Session) State() (packet.BFDState, packet.BFDDiag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, s.diag
+}
+
+// Listen opens a UDP socket on address for a session. On Linux, it sends with a TTL of 255, as RFC 5881 requires so
+// that peers can reject packets from further away.
+func Listen(address string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	local := conn.LocalAddr().(*net.UDPAddr)
+	if err := setTTL(conn, local.IP.To4() == nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// received is a packet read from the socket.
+type received struct {
+	b    packet.BFD
+	from net.Addr
+}
+
+// Run runs the session over conn, which must receive the control packets sent by the peer, until the context is done
+// or reading from conn fails, returning the error. When the context is done, the peer is told the session is
+// administratively down. Run does not close conn.
+func (s *Session) Run(ctx context.Context, conn net.PacketConn) error {
+	peer, err := s.init()
+	if err != nil {
+		return err
+	}
+
+	packets, errc, stop := make(chan received), make(chan error, 1), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		read(conn, packets, errc, stop)
+	}()
+	defer func() {
+		close(stop)
+		conn.SetReadDeadline(time.Now())
+		wg.Wait()
+		conn.SetReadDeadline(time.Time{})
+	}()
+
+	tx, detect := time.NewTimer(0), time.NewTimer(0)
+	defer tx.Stop()
+	defer detect.Stop()
+	stopTimer(detect)
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.change(packet.BFDAdminDown, packet.BFDDiagAdminDown)
+			s.mu.Unlock()
+			s.notify()
+			s.send(conn, peer, false)
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case p := <-packets:
+			s.mu.Lock()
+			from := s.state
+			ok, final := s.receive(p.b, p.from, peer)
+			to := s.state
+			detectTime := time.Duration(s.remoteDetectMult) * maxDuration(s.RequiredMinRx, s.remoteDesiredMinTx)
+			s.mu.Unlock()
+			s.notify()
+			if !ok {
+				continue
+			}
+			resetTimer(detect, detectTime)
+			if final {
+				s.send(conn, peer, true)
+			}
+			if to != from {
+				// The intervals have changed, so the next packet is sent now rather than at the old rate.
+				resetTimer(tx, 0)
+			}
+		case <-detect.C:
+			s.mu.Lock()
+			if s.state == packet.BFDInit || s.state == packet.BFDUp {
+				s.change(packet.BFDDown, packet.BFDDiagControlDetectExpired)
+				s.remoteDisc, s.remoteState = 0, packet.BFDDown
+			}
+			s.mu.Unlock()
+			s.notify()
+			resetTimer(tx, 0)
+		case <-tx.C:
+			// Failures to send are not fatal: the peer detects them as it would lost packets.
+			s.send(conn, peer, false)
+			if interval := s.txInterval(); interval > 0 {
+				tx.Reset(interval)
+			} else {
+				tx.Reset(slowInterval)
+			}
+		}
+	}
+}
+
+// init sets the defaults and initial state of the session, returning the address of the peer.
+func (s *Session) init() (*net.UDPAddr, error) {
+	if s.Peer == nil {
+		return nil, errors.New("bfd session without peer")
+	}
+	peer := *s.Peer
+	if peer.Port == 0 {
+		peer.Port = packet.BFDPort
+	}
+	if s.DesiredMinTx <= 0 {
+		s.DesiredMinTx = DefaultInterval
+	}
+	if s.RequiredMinRx <= 0 {
+		s.RequiredMinRx = DefaultInterval
+	}
+	if s.DetectMult == 0 {
+		s.DetectMult = DefaultDetectMult
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	for s.Discriminator == 0 {
+		s.Discriminator = s.rng.Uint32()
+	}
+	s.state, s.diag = packet.BFDDown, packet.BFDDiagNone
+	s.remoteState, s.remoteDisc, s.remoteMinRx = packet.BFDDown, 0, time.Microsecond
+	s.remoteDesiredMinTx, s.remoteDetectMult, s.poll, s.changes = 0, 0, false, nil
+	return &peer, nil
+}
+
+// read reads packets from conn until it fails or stop is closed.
+func read(conn net.PacketConn, packets chan<- received, errc chan<- error, stop <-chan struct{}) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err != nil {
+			errc <- err
+			return
+		}
+		p := received{b: packet.BFD(append([]byte(nil), buf[:n]...)), from: from}
+		select {
+		case packets <- p:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// receive processes a control packet as RFC 5880 section 6.8.6 describes, returning whether it was accepted and
+// whether it polled, so must be answered. The lock must be held.
+func (s *Session) receive(b packet.BFD, from net.Addr, peer *net.UDPAddr) (ok, final bool) {
+	if addr, _ := from.(*net.UDPAddr); addr == nil || !addr.IP.Equal(peer.IP) {
+		return false, false
+	}
+	if b.Valid() != nil || b.Flags()&packet.BFDFlagAuth != 0 {
+		return false, false
+	}
+	if your := b.YourDiscriminator(); your != 0 && your != s.Discriminator {
+		return false, false
+	}
+	s.remoteDisc, s.remoteState = b.MyDiscriminator(), b.State()
+	s.remoteMinRx, s.remoteDesiredMinTx, s.remoteDetectMult = b.RequiredMinRx(), b.DesiredMinTx(), b.DetectMult()
+	if b.Flags()&packet.BFDFlagFinal != 0 {
+		s.poll = false
+	}
+	if s.state == packet.BFDAdminDown {
+		return false, false
+	}
+
+	switch {
+	case s.remoteState == packet.BFDAdminDown:
+		if s.state != packet.BFDDown {
+			s.change(packet.BFDDown, packet.BFDDiagNeighborDown)
+		}
+	case s.state == packet.BFDDown && s.remoteState == packet.BFDDown:
+		s.change(packet.BFDInit, packet.BFDDiagNone)
+	case s.state == packet.BFDDown && s.remoteState == packet.BFDInit,
+		s.state == packet.BFDInit && s.remoteState != packet.BFDDown:
+		s.change(packet.BFDUp, packet.BFDDiagNone)
+	case s.state == packet.BFDUp && s.remoteState == packet.BFDDown:
+		s.change(packet.BFDDown, packet.BFDDiagNeighborDown)
+	}
+	return true, b.Flags()&packet.BFDFlagPoll != 0
+}
+
+// change moves the session to a new state, queueing the change for notify. The lock must be held.
+func (s *Session) change(to packet.BFDState, diag packet.BFDDiag) {
+	from := s.state
+	if to == from {
+		return
+	}
+	s.state, s.diag = to, diag
+	if to == packet.BFDUp && s.DesiredMinTx < slowInterval {
+		// The desired interval falls from the slow rate used while down, which the peer must be polled to confirm.
+		s.poll = true
+	}
+	s.changes = append(s.changes, &Change{Time: time.Now(), From: from, To: to, Diag: diag})
+}
+
+// notify passes the changes made since it was last called to OnChange, without the lock held, so that it may call
+// State.
+func (s *Session) notify() {
+	s.mu.Lock()
+	changes := s.changes
+	s.changes = nil
+	s.mu.Unlock()
+	if s.OnChange == nil {
+		return
+	}
+	for _, c := range changes {
+		s.OnChange(c)
+	}
+}
+
+// desiredMinTx returns the interval advertised as desired: the configured one once up, and no less than a second
+// otherwise. The lock must be held.
+func (s *Session) desiredMinTx() time.Duration {
+	if s.state == packet.BFDUp {
+		return s.DesiredMinTx
+	}
+	return maxDuration(s.DesiredMinTx, slowInterval)
+}
+
+// txInterval returns the interval until the next periodic packet, jittered as RFC 5880 section 6.8.7 requires, or
+// zero if the peer wishes to receive none.
+func (s *Session) txInterval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.remoteMinRx == 0 {
+		return 0
+	}
+	interval := maxDuration(s.desiredMinTx(), s.remoteMinRx)
+	// Packets are sent between 75% and 100% of the interval, or 90% with a detection multiplier of one.
+	jitter := 25
+	if s.DetectMult == 1 {
+		jitter = 15
+	}
+	return interval * time.Duration(100-jitter+s.rng.Intn(jitter)) / 100
+}
+
+// send sends a control packet to the peer, as a final if it answers a poll.
+func (s *Session) send(conn net.PacketConn, peer *net.UDPAddr, final bool) error {
+	s.mu.Lock()
+	f := packet.BFDFields{
+		Diag:              s.diag,
+		State:             s.state,
+		DetectMult:        s.DetectMult,
+		MyDiscriminator:   s.Discriminator,
+		YourDiscriminator: s.remoteDisc,
+		DesiredMinTx:      s.desiredMinTx(),
+		RequiredMinRx:     s.RequiredMinRx,
+	}
+	switch {
+	case final:
+		f.Flags = packet.BFDFlagFinal
+	case s.poll:
+		f.Flags = packet.BFDFlagPoll
+	}
+	s.mu.Unlock()
+
+	b := packet.BFD(make([]byte, packet.BFDHeaderLen))
+	if err := b.Encode(&f); err != nil {
+		return err
+	}
+	_, err := conn.WriteTo(b, peer)
+	return err
+}
+
+// stopTimer stops a timer, draining its channel.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// resetTimer stops a timer and starts it again to fire after d.
+func resetTimer(t *time.Timer, d time.Duration) {
+	stopTimer(t)
+	t.Reset(d)
+}
+
+// maxDuration returns the longer of two durations.
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,105 @@
+package bfd
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/packet"
+	"net"
+	"testing"
+	"time"
+)
+
+// pair returns two sessions, each with the socket it runs on, configured as each other's peers.
+func pair(t *testing.T) (a, b *Session, aConn, bConn *net.UDPConn) {
+	t.Helper()
+	aConn, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { aConn.Close() })
+	bConn, err = Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { bConn.Close() })
+	fast := 20 * time.Millisecond
+	a = &Session{Peer: bConn.LocalAddr().(*net.UDPAddr), DesiredMinTx: fast, RequiredMinRx: fast}
+	b = &Session{Peer: aConn.LocalAddr().(*net.UDPAddr), DesiredMinTx: fast, RequiredMinRx: fast}
+	return a, b, aConn, bConn
+}
+
+// run runs a session in the background, returning a channel receiving its changes and one receiving its error.
+func run(ctx context.Context, s *Session, conn net.PacketConn) (<-chan *Change, <-chan error) {
+	changes, errc := make(chan *Change, 16), make(chan error, 1)
+	s.OnChange = func(c *Change) {
+		if state, _ := s.State(); state != c.To {
+			panic("state does not match change")
+		}
+		changes <- c
+	}
+	go func() { errc <- s.Run(ctx, conn) }()
+	return changes, errc
+}
+
+// waitFor waits for a session to change to a state, returning the change.
+func waitFor(t *testing.T, changes <-chan *Change, to packet.BFDState) *Change {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case c := <-changes:
+			if c.To == to {
+				return c
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %v", to)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	t.Run("AdminDown", func(t *testing.T) {
+		a, b, aConn, bConn := pair(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		bctx, bcancel := context.WithCancel(ctx)
+		aChanges, _ := run(ctx, a, aConn)
+		bChanges, berrc := run(bctx, b, bConn)
+		waitFor(t, aChanges, packet.BFDUp)
+		waitFor(t, bChanges, packet.BFDUp)
+
+		bcancel()
+		if err := <-berrc; err != context.Canceled {
+			t.Fatalf("run err: %v", err)
+		}
+		if state, diag := b.State(); state != packet.BFDAdminDown || diag != packet.BFDDiagAdminDown {
+			t.Fatalf("got state %v, diag %v", state, diag)
+		}
+		if c := waitFor(t, aChanges, packet.BFDDown); c.Diag != packet.BFDDiagNeighborDown {
+			t.Fatalf("got diag %v", c.Diag)
+		}
+	})
+
+	t.Run("DetectionTimeExpired", func(t *testing.T) {
+		a, b, aConn, bConn := pair(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		aChanges, _ := run(ctx, a, aConn)
+		_, berrc := run(ctx, b, bConn)
+		waitFor(t, aChanges, packet.BFDUp)
+
+		// Closing the socket stops the session without telling the peer.
+		bConn.Close()
+		if err := <-berrc; err == nil {
+			t.Fatalf("run returned without error")
+		}
+		if c := waitFor(t, aChanges, packet.BFDDown); c.Diag != packet.BFDDiagControlDetectExpired {
+			t.Fatalf("got diag %v", c.Diag)
+		}
+	})
+
+	t.Run("NoPeer", func(t *testing.T) {
+		if err := (&Session{}).Run(context.Background(), nil); err == nil {
+			t.Fatalf("ran a session without a peer")
+		}
+	})
+}
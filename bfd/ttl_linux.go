@@ -0,0 +1,31 @@
+// +build linux
+
+package bfd
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// setTTL sets the TTL, and the hop limit if the socket is IPv6, of the packets sent on conn to 255.
+func setTTL(conn *net.UDPConn, v6 bool) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		if serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, 255); serr != nil {
+			serr = os.NewSyscallError("setsockopt IP_TTL", serr)
+			return
+		}
+		if v6 {
+			serr = os.NewSyscallError("setsockopt IPV6_UNICAST_HOPS",
+				syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, 255))
+		}
+	}); err != nil {
+		return err
+	}
+	return serr
+}
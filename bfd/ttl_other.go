@@ -0,0 +1,10 @@
+// +build !linux
+
+package bfd
+
+import "net"
+
+// setTTL is only implemented on Linux; elsewhere, packets are sent with the default TTL.
+func setTTL(*net.UDPConn, bool) error {
+	return nil
+}
@@ -0,0 +1,113 @@
+package bgp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Origin is the origin attribute of a route.
+type Origin string
+
+// Origins of routes.
+const (
+	OriginIGP        Origin = "IGP"
+	OriginEGP        Origin = "EGP"
+	OriginIncomplete Origin = "Incomplete"
+)
+
+// Community is an RFC 1997 community.
+type Community struct {
+	ASN   uint16
+	Value uint16
+}
+
+// ParseCommunity parses a community in the form asn:value.
+func ParseCommunity(s string) (Community, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Community{}, fmt.Errorf("invalid community %q", s)
+	}
+	asn, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return Community{}, fmt.Errorf("invalid community %q", s)
+	}
+	value, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return Community{}, fmt.Errorf("invalid community %q", s)
+	}
+	return Community{ASN: uint16(asn), Value: uint16(value)}, nil
+}
+
+func (c Community) String() string {
+	return strconv.Itoa(int(c.ASN)) + ":" + strconv.Itoa(int(c.Value))
+}
+
+// Well-known communities.
+var (
+	Blackhole         = Community{65535, 666}
+	NoExport          = Community{65535, 65281}
+	NoAdvertise       = Community{65535, 65282}
+	NoExportSubconfed = Community{65535, 65283}
+)
+
+// LargeCommunity is an RFC 8092 large community.
+type LargeCommunity struct {
+	Global uint32
+	Local1 uint32
+	Local2 uint32
+}
+
+func (c LargeCommunity) String() string {
+	return strconv.FormatUint(uint64(c.Global), 10) + ":" + strconv.FormatUint(uint64(c.Local1), 10) + ":" +
+		strconv.FormatUint(uint64(c.Local2), 10)
+}
+
+// ExtendedCommunity is an RFC 4360 extended community, such as a route target.
+type ExtendedCommunity struct {
+	Type          string // Such as "rt" for a route target or "ro" for a route origin.
+	Administrator string // An ASN or an IPv4 address.
+	Value         uint32
+}
+
+func (c ExtendedCommunity) String() string {
+	return c.Type + ":" + c.Administrator + ":" + strconv.FormatUint(uint64(c.Value), 10)
+}
+
+// Route is a BGP route, as learned from a peer.
+type Route struct {
+	Prefix    *net.IPNet
+	Table     string // The routing table holding the route, if known.
+	Protocol  string // The session the route was learned over, such as the name of a BIRD protocol.
+	Primary   bool   // Whether the route is the best of those to the prefix.
+	NextHop   net.IP
+	Interface string
+	Origin    Origin
+	// The AS path, from the neighbour to the origin. AS sets are flattened into the path in the order they are given.
+	ASPath    []uint32
+	LocalPref uint32
+	MED       uint32
+
+	Communities         []Community
+	LargeCommunities    []LargeCommunity
+	ExtendedCommunities []ExtendedCommunity
+}
+
+// OriginAS returns the AS that originated the route, the last in its path, or zero if the path is empty.
+func (r *Route) OriginAS() uint32 {
+	if len(r.ASPath) == 0 {
+		return 0
+	}
+	return r.ASPath[len(r.ASPath)-1]
+}
+
+// HasCommunity reports whether the route carries a community.
+func (r *Route) HasCommunity(c Community) bool {
+	for _, rc := range r.Communities {
+		if rc == c {
+			return true
+		}
+	}
+	return false
+}
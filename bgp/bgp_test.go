@@ -0,0 +1,62 @@
+package bgp
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestParseCommunity(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    Community
+		wantErr bool
+	}{
+		"Valid":     {input: "64496:100", want: Community{64496, 100}},
+		"Blackhole": {input: "65535:666", want: Blackhole},
+		"Large":     {input: "64496:1:2", wantErr: true},
+		"TooBig":    {input: "65536:1", wantErr: true},
+		"NotNumber": {input: "a:1", wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseCommunity(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if got.String() != test.input {
+				t.Fatalf("got %q, want %q", got.String(), test.input)
+			}
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	r := &Route{ASPath: []uint32{64496, 64497}, Communities: []Community{{64496, 1}, NoExport}}
+	if got := r.OriginAS(); got != 64497 {
+		t.Fatalf("got origin AS%d, want AS64497", got)
+	}
+	if !r.HasCommunity(NoExport) || r.HasCommunity(Blackhole) {
+		t.Fatalf("got wrong communities from %v", r.Communities)
+	}
+	if got := (&Route{}).OriginAS(); got != 0 {
+		t.Fatalf("got origin AS%d for an empty path", got)
+	}
+	for _, test := range []struct{ got, want string }{
+		{LargeCommunity{64496, 1, 2}.String(), "64496:1:2"},
+		{ExtendedCommunity{"rt", "64496", 100}.String(), "rt:64496:100"},
+	} {
+		if test.got != test.want {
+			t.Fatalf("got %q, want %q", test.got, test.want)
+		}
+	}
+}
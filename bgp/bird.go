@@ -0,0 +1,216 @@
+package bgp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// birdCode matches the reply codes that prefix the lines of BIRD's control socket, as relayed by some looking glasses.
+var birdCode = regexp.MustCompile(`^[0-9]{4}[ -]`)
+
+// ParseBIRD reads routes from the output of BIRD's "show route all", from BIRD 1 or 2, or a looking glass relaying it.
+// Attributes that are not understood are ignored, as are routes that are not BGP routes, which have no BGP origin.
+// Routes originated within the local AS are kept, with an empty AS path.
+func ParseBIRD(r io.Reader) ([]Route, error) {
+	var routes []Route
+	var table string
+	var prefix *net.IPNet
+	var cur *Route
+	raw := false // Whether the output is from the control socket, whose lines are prefixed by reply codes.
+	flush := func() {
+		if cur != nil && cur.Origin != "" {
+			routes = append(routes, *cur)
+		}
+		cur = nil
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if loc := birdCode.FindStringIndex(line); loc != nil {
+			line, raw = line[loc[1]:], true
+		} else if raw && strings.HasPrefix(line, " ") {
+			// A line continuing the reply of the line before.
+			line = line[1:]
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "", strings.HasPrefix(trimmed, "BIRD "), trimmed == "Network not found":
+			continue
+		case strings.HasPrefix(trimmed, "Table ") && strings.HasSuffix(trimmed, ":"):
+			flush()
+			table = strings.TrimSuffix(strings.TrimPrefix(trimmed, "Table "), ":")
+			continue
+		case (strings.HasPrefix(trimmed, "via ") || strings.HasPrefix(trimmed, "dev ")) && !strings.Contains(trimmed, "["):
+			// The next hop of the route, on a line of its own in BIRD 2; multipath routes have more than one.
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: next hop without a route", n)
+			}
+			if cur.NextHop == nil {
+				cur.NextHop, cur.Interface = parseVia(strings.Fields(trimmed))
+			}
+			continue
+		case line[0] == '\t' || strings.Contains(trimmed, ": "):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: attribute without a route", n)
+			}
+			if err := cur.setBIRDAttribute(trimmed); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			continue
+		}
+
+		// The first line of a route starts with the prefix, unless it is another route to the previous prefix.
+		flush()
+		fields := strings.Fields(trimmed)
+		if line[0] != ' ' && line[0] != '\t' {
+			_, pfx, err := net.ParseCIDR(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			prefix, fields = pfx, fields[1:]
+		}
+		if prefix == nil {
+			return nil, fmt.Errorf("line %d: route without a prefix", n)
+		}
+		cur = &Route{Prefix: prefix, Table: table}
+		cur.parseBIRDSummary(fields)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return routes, nil
+}
+
+// parseVia parses the next hop of a route, "via 192.0.2.1 on eth0", or "dev eth0" for a directly connected one.
+func parseVia(fields []string) (net.IP, string) {
+	var ip net.IP
+	var dev string
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "via":
+			ip = net.ParseIP(fields[i+1])
+		case "on", "dev":
+			dev = fields[i+1]
+		}
+	}
+	return ip, dev
+}
+
+// parseBIRDSummary parses the summary of a route following its prefix, such as
+// "unicast [peer1 2021-06-01 12:00:00] * (100) [AS64496i]", or in BIRD 1 "via 192.0.2.1 on eth0 [peer1 12:00] * (100)".
+func (r *Route) parseBIRDSummary(fields []string) {
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case f == "via" || f == "dev":
+			r.NextHop, r.Interface = parseVia(fields[i:])
+		case f == "*":
+			r.Primary = true
+		case strings.HasPrefix(f, "[") && r.Protocol == "":
+			r.Protocol = strings.TrimSuffix(strings.TrimPrefix(f, "["), "]")
+		}
+	}
+}
+
+// setBIRDAttribute records an attribute of a route, such as "BGP.as_path: 64496 64497".
+func (r *Route) setBIRDAttribute(line string) error {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return nil
+	}
+	name, value := line[:i], strings.TrimSpace(line[i+1:])
+	switch name {
+	case "BGP.origin":
+		switch value {
+		case "IGP":
+			r.Origin = OriginIGP
+		case "EGP":
+			r.Origin = OriginEGP
+		default:
+			r.Origin = OriginIncomplete
+		}
+	case "BGP.as_path":
+		r.ASPath = []uint32{}
+		for _, f := range strings.Fields(strings.NewReplacer("{", " ", "}", " ").Replace(value)) {
+			asn, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid as path %q", value)
+			}
+			r.ASPath = append(r.ASPath, uint32(asn))
+		}
+	case "BGP.next_hop":
+		// BIRD lists the global and link-local addresses of IPv6 next hops.
+		if ip := net.ParseIP(strings.Fields(value + " ")[0]); ip != nil && r.NextHop == nil {
+			r.NextHop = ip
+		}
+	case "BGP.local_pref", "BGP.med":
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", name, value)
+		}
+		if name == "BGP.med" {
+			r.MED = uint32(v)
+		} else {
+			r.LocalPref = uint32(v)
+		}
+	case "BGP.community":
+		for _, t := range tuples(value) {
+			c, err := ParseCommunity(strings.Join(t, ":"))
+			if err != nil {
+				return err
+			}
+			r.Communities = append(r.Communities, c)
+		}
+	case "BGP.large_community":
+		for _, t := range tuples(value) {
+			var v [3]uint64
+			if len(t) != 3 {
+				return fmt.Errorf("invalid large community %q", value)
+			}
+			for j := range v {
+				var err error
+				if v[j], err = strconv.ParseUint(t[j], 10, 32); err != nil {
+					return fmt.Errorf("invalid large community %q", value)
+				}
+			}
+			r.LargeCommunities = append(r.LargeCommunities, LargeCommunity{uint32(v[0]), uint32(v[1]), uint32(v[2])})
+		}
+	case "BGP.ext_community":
+		for _, t := range tuples(value) {
+			if len(t) != 3 {
+				return fmt.Errorf("invalid extended community %q", value)
+			}
+			v, err := strconv.ParseUint(t[2], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid extended community %q", value)
+			}
+			r.ExtendedCommunities = append(r.ExtendedCommunities, ExtendedCommunity{t[0], t[1], uint32(v)})
+		}
+	}
+	return nil
+}
+
+// tuples splits BIRD's list of tuples, such as "(64496,1) (64496, 2)", into the values of each.
+func tuples(s string) [][]string {
+	var ts [][]string
+	for _, part := range strings.Split(s, "(") {
+		part = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(part), ")"))
+		if part == "" {
+			continue
+		}
+		var t []string
+		for _, v := range strings.Split(part, ",") {
+			t = append(t, strings.TrimSpace(v))
+		}
+		ts = append(ts, t)
+	}
+	return ts
+}
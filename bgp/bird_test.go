@@ -0,0 +1,199 @@
+package bgp
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+)
+
+const bird2 = `BIRD 2.0.8 ready.
+Table master4:
+192.0.2.0/24         unicast [rs_as64496 2021-06-01 12:00:00] * (100) [AS64497i]
+	via 198.51.100.1 on eth1
+	Type: BGP univ
+	BGP.origin: IGP
+	BGP.as_path: 64496 64497
+	BGP.next_hop: 198.51.100.1
+	BGP.local_pref: 100
+	BGP.community: (64496,1) (65535,666)
+	BGP.large_community: (64496, 1, 2)
+	BGP.ext_community: (rt, 64496, 100)
+                     unicast [rs_as64498 2021-06-01 12:00:05] (100) [AS64497?]
+	via 198.51.100.2 on eth1
+	Type: BGP univ
+	BGP.origin: Incomplete
+	BGP.as_path: 64498 {64499 64497}
+	BGP.next_hop: 198.51.100.2
+	BGP.med: 10
+	BGP.local_pref: 100
+198.51.100.0/24      unicast [direct1 2021-06-01] * (240)
+	dev eth1
+	Type: device univ
+
+Table master6:
+2001:db8::/32        unicast [rs_as64496 2021-06-01 12:00:00] * (100) [AS64496i]
+	via 2001:db8:ffff::1 on eth1
+	Type: BGP univ
+	BGP.origin: IGP
+	BGP.as_path: 64496
+	BGP.next_hop: 2001:db8:ffff::1 fe80::1
+	BGP.local_pref: 100
+`
+
+const bird1 = `192.0.2.0/24       via 198.51.100.1 on eth1 [rs_as64496 2021-06-01] * (100) [AS64497i]
+	Type: BGP unicast univ
+	BGP.origin: IGP
+	BGP.as_path: 64496 64497
+	BGP.next_hop: 198.51.100.1
+	BGP.local_pref: 100
+	BGP.community: (64496,1)
+                   via 198.51.100.2 on eth1 [rs_as64498 2021-06-01] (100) [AS64497?]
+	Type: BGP unicast univ
+	BGP.origin: Incomplete
+	BGP.as_path: 64498 64497
+	BGP.next_hop: 198.51.100.2
+	BGP.local_pref: 100
+`
+
+const birdRaw = `0001 BIRD 2.0.8 ready.
+1007-Table master4:
+ 192.0.2.0/24         unicast [rs_as64496 12:00:00.000] * (100) [AS64497i]
+1008-	Type: BGP univ
+1012-	BGP.origin: IGP
+ 	BGP.as_path: 64496 64497
+ 	BGP.next_hop: 198.51.100.1
+0000 
+`
+
+// summary is the parts of a route checked by the tests.
+type summary struct {
+	Prefix, Table, Protocol, NextHop, Interface string
+	Primary                                     bool
+	Origin                                      Origin
+	ASPath                                      []uint32
+	LocalPref, MED                              uint32
+	Communities                                 []Community
+	LargeCommunities                            []LargeCommunity
+	ExtendedCommunities                         []ExtendedCommunity
+}
+
+func summarise(routes []Route) []summary {
+	var ss []summary
+	for _, r := range routes {
+		ss = append(ss, summary{
+			Prefix: r.Prefix.String(), Table: r.Table, Protocol: r.Protocol, NextHop: r.NextHop.String(),
+			Interface: r.Interface, Primary: r.Primary, Origin: r.Origin, ASPath: r.ASPath, LocalPref: r.LocalPref,
+			MED: r.MED, Communities: r.Communities, LargeCommunities: r.LargeCommunities,
+			ExtendedCommunities: r.ExtendedCommunities,
+		})
+	}
+	return ss
+}
+
+func TestParseBIRD(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    []summary
+		wantErr bool
+	}{
+		"BIRD2": {
+			input: bird2,
+			want: []summary{
+				{
+					Prefix: "192.0.2.0/24", Table: "master4", Protocol: "rs_as64496", NextHop: "198.51.100.1",
+					Interface: "eth1", Primary: true, Origin: OriginIGP, ASPath: []uint32{64496, 64497},
+					LocalPref: 100, Communities: []Community{{64496, 1}, Blackhole},
+					LargeCommunities:    []LargeCommunity{{64496, 1, 2}},
+					ExtendedCommunities: []ExtendedCommunity{{"rt", "64496", 100}},
+				},
+				{
+					Prefix: "192.0.2.0/24", Table: "master4", Protocol: "rs_as64498", NextHop: "198.51.100.2",
+					Interface: "eth1", Origin: OriginIncomplete, ASPath: []uint32{64498, 64499, 64497},
+					LocalPref: 100, MED: 10,
+				},
+				{
+					Prefix: "2001:db8::/32", Table: "master6", Protocol: "rs_as64496", NextHop: "2001:db8:ffff::1",
+					Interface: "eth1", Primary: true, Origin: OriginIGP, ASPath: []uint32{64496}, LocalPref: 100,
+				},
+			},
+		},
+		"BIRD1": {
+			input: bird1,
+			want: []summary{
+				{
+					Prefix: "192.0.2.0/24", Protocol: "rs_as64496", NextHop: "198.51.100.1", Interface: "eth1",
+					Primary: true, Origin: OriginIGP, ASPath: []uint32{64496, 64497}, LocalPref: 100,
+					Communities: []Community{{64496, 1}},
+				},
+				{
+					Prefix: "192.0.2.0/24", Protocol: "rs_as64498", NextHop: "198.51.100.2", Interface: "eth1",
+					Origin: OriginIncomplete, ASPath: []uint32{64498, 64497}, LocalPref: 100,
+				},
+			},
+		},
+		"ControlSocket": {
+			input: birdRaw,
+			want: []summary{{
+				Prefix: "192.0.2.0/24", Table: "master4", Protocol: "rs_as64496", NextHop: "198.51.100.1",
+				Primary: true, Origin: OriginIGP, ASPath: []uint32{64496, 64497},
+			}},
+		},
+		"EmptyASPath": {
+			input: "192.0.2.0/24 unicast [ibgp1 12:00] * (100)\n\tvia 198.51.100.1 on eth1\n\tBGP.origin: IGP\n" +
+				"\tBGP.as_path: \n\tBGP.local_pref: 200\n198.51.100.0/24 unicast [static1 12:00] * (200)\n" +
+				"\tdev eth1\n",
+			want: []summary{{
+				Prefix: "192.0.2.0/24", Protocol: "ibgp1", NextHop: "198.51.100.1", Interface: "eth1", Primary: true,
+				Origin: OriginIGP, ASPath: []uint32{}, LocalPref: 200,
+			}},
+		},
+		"NotFound": {input: "Network not found\n"},
+		"BadPrefix": {
+			input:   "192.0.2.0/33 unicast [peer 12:00] * (100)\n",
+			wantErr: true,
+		},
+		"BadASPath": {
+			input:   "192.0.2.0/24 unicast [peer 12:00] * (100)\n\tBGP.as_path: 64496 AS64497\n",
+			wantErr: true,
+		},
+		"BadCommunity": {
+			input:   "192.0.2.0/24 unicast [peer 12:00] * (100)\n\tBGP.community: (64496,1,2)\n",
+			wantErr: true,
+		},
+		"AttributeFirst": {
+			input:   "\tBGP.origin: IGP\n",
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			routes, err := ParseBIRD(strings.NewReader(test.input))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, summarise(routes)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestParseBIRDNextHop(t *testing.T) {
+	// A route without a next hop line takes the BGP next hop.
+	routes, err := ParseBIRD(strings.NewReader("192.0.2.0/24 unicast [peer 12:00] * (100)\n\tBGP.origin: IGP\n" +
+		"\tBGP.as_path: 64496\n\tBGP.next_hop: 198.51.100.9\n"))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	if len(routes) != 1 || !routes[0].NextHop.Equal(net.ParseIP("198.51.100.9")) {
+		t.Fatalf("got %+v", routes)
+	}
+}
@@ -0,0 +1,17 @@
+package bgp
+
+import (
+	"net"
+	"time"
+)
+
+// Update is a BGP UPDATE message as received from a peer, such as by a route collector or over BMP. Each announced
+// route carries the path attributes of the message.
+type Update struct {
+	Time      time.Time
+	Collector string // The route collector that received the update, such as "rrc00", if known.
+	Peer      net.IP // The address of the peer the update was received from.
+	PeerAS    uint32
+	Announced []Route
+	Withdrawn []*net.IPNet
+}
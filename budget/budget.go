@@ -0,0 +1,203 @@
+package budget
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Budget whose fields are not set.
+const (
+	DefaultPrefixLen4 = 24
+	DefaultPrefixLen6 = 48
+)
+
+// sweepEvery is the number of new buckets after which idle buckets are discarded.
+const sweepEvery = 1024
+
+// Limit is the rate of a token bucket.
+type Limit struct {
+	Rate  float64 // Packets per second, or unlimited if not positive.
+	Burst int     // The packets that may be sent at once after a pause, or one if not positive.
+}
+
+// Budget bounds the rate of the probes sent by a program, both in total and to each destination and prefix, so that
+// probing subsystems sharing it cannot together overwhelm a network, or a host that rate limits its ICMP errors. Each
+// limit is a token bucket. It is safe for concurrent use, and the zero value imposes no limits.
+type Budget struct {
+	Global         Limit
+	PerDestination Limit
+	PerPrefix      Limit
+	// The lengths of the prefixes PerPrefix applies to, or DefaultPrefixLen4 and DefaultPrefixLen6 if zero.
+	PrefixLen4 int
+	PrefixLen6 int
+
+	mu      sync.Mutex
+	global  bucket
+	dsts    map[[net.IPv6len]byte]*bucket
+	pfxs    map[[net.IPv6len]byte]*bucket
+	created int // The buckets created since idle buckets were last discarded.
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket, which may leave it in debt, and returns the time until the debt is repaid.
+func (b *bucket) take(l Limit, now time.Time) time.Duration {
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if b.tokens += now.Sub(b.last).Seconds() * l.Rate; b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.Rate * float64(time.Second))
+}
+
+// idle reports whether the bucket would be full by now, so that discarding it changes nothing.
+func (b *bucket) idle(l Limit, now time.Time) bool {
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst
+}
+
+// Wait blocks until a probe may be sent to dst, or until the context is done. The probe is counted against the budget
+// as soon as Wait is called, so that concurrent callers queue behind each other, unless the context is done first.
+func (b *Budget) Wait(ctx context.Context, dst net.IP) error {
+	delay, refund := b.reserve(dst, time.Now(), false)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		refund()
+		return ctx.Err()
+	}
+}
+
+// Allow reports whether a probe may be sent to dst now, counting it against the budget if so.
+func (b *Budget) Allow(dst net.IP) bool {
+	delay, _ := b.reserve(dst, time.Now(), true)
+	return delay <= 0
+}
+
+// reserve takes a token from each bucket that applies to dst, returning the time until all are repaid, and a function
+// returning the tokens. If onlyNow is set and the tokens are not available at once, none are taken.
+func (b *Budget) reserve(dst net.IP, now time.Time, onlyNow bool) (time.Duration, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	type taken struct {
+		bucket *bucket
+		limit  Limit
+	}
+	var buckets []taken
+	if b.Global.Rate > 0 {
+		buckets = append(buckets, taken{&b.global, b.Global})
+	}
+	if b.PerDestination.Rate > 0 || b.PerPrefix.Rate > 0 {
+		b.sweep(now)
+	}
+	if b.PerDestination.Rate > 0 {
+		var k [net.IPv6len]byte
+		copy(k[:], dst.To16())
+		buckets = append(buckets, taken{b.get(&b.dsts, k), b.PerDestination})
+	}
+	if b.PerPrefix.Rate > 0 {
+		buckets = append(buckets, taken{b.get(&b.pfxs, b.prefix(dst)), b.PerPrefix})
+	}
+
+	var saved []bucket
+	if onlyNow {
+		for _, t := range buckets {
+			saved = append(saved, *t.bucket)
+		}
+	}
+	var delay time.Duration
+	for _, t := range buckets {
+		if d := t.bucket.take(t.limit, now); d > delay {
+			delay = d
+		}
+	}
+	if onlyNow && delay > 0 {
+		for i, t := range buckets {
+			*t.bucket = saved[i]
+		}
+	}
+	return delay, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, t := range buckets {
+			t.bucket.tokens++
+		}
+	}
+}
+
+// get returns the bucket of a key, creating it if there is none.
+func (b *Budget) get(m *map[[net.IPv6len]byte]*bucket, k [net.IPv6len]byte) *bucket {
+	if *m == nil {
+		*m = map[[net.IPv6len]byte]*bucket{}
+	}
+	bk, ok := (*m)[k]
+	if !ok {
+		bk = &bucket{}
+		(*m)[k] = bk
+		b.created++
+	}
+	return bk
+}
+
+// prefix returns the key of the prefix containing dst.
+func (b *Budget) prefix(dst net.IP) [net.IPv6len]byte {
+	var k [net.IPv6len]byte
+	if ip4 := dst.To4(); ip4 != nil {
+		bits := b.PrefixLen4
+		if bits <= 0 {
+			bits = DefaultPrefixLen4
+		}
+		copy(k[:], ip4.Mask(net.CIDRMask(bits, 8*net.IPv4len)).To16())
+		return k
+	}
+	bits := b.PrefixLen6
+	if bits <= 0 {
+		bits = DefaultPrefixLen6
+	}
+	copy(k[:], dst.To16().Mask(net.CIDRMask(bits, 8*net.IPv6len)))
+	return k
+}
+
+// sweep discards idle buckets, once enough have been created since it last did, so that probing many destinations
+// does not grow the budget without bound.
+func (b *Budget) sweep(now time.Time) {
+	if b.created < sweepEvery {
+		return
+	}
+	b.created = 0
+	for k, bk := range b.dsts {
+		if bk.idle(b.PerDestination, now) {
+			delete(b.dsts, k)
+		}
+	}
+	for k, bk := range b.pfxs {
+		if bk.idle(b.PerPrefix, now) {
+			delete(b.pfxs, k)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package budget
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	type probe struct {
+		dst string
+		at  time.Duration // After the start.
+	}
+	tests := map[string]struct {
+		budget *Budget
+		probes []probe
+		want   []time.Duration // The delay of each probe.
+	}{
+		"Unlimited": {
+			budget: &Budget{},
+			probes: []probe{{"192.0.2.1", 0}, {"192.0.2.1", 0}},
+			want:   []time.Duration{0, 0},
+		},
+		"Global": {
+			budget: &Budget{Global: Limit{Rate: 10, Burst: 2}},
+			probes: []probe{{"192.0.2.1", 0}, {"198.51.100.1", 0}, {"203.0.113.1", 0}, {"192.0.2.1", 0},
+				{"192.0.2.1", time.Second}},
+			want: []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond, 0},
+		},
+		"PerDestination": {
+			budget: &Budget{PerDestination: Limit{Rate: 1}},
+			probes: []probe{{"192.0.2.1", 0}, {"192.0.2.2", 0}, {"192.0.2.1", 0}, {"192.0.2.1", 500 * time.Millisecond}},
+			want:   []time.Duration{0, 0, time.Second, 1500 * time.Millisecond},
+		},
+		"PerPrefix": {
+			budget: &Budget{PerPrefix: Limit{Rate: 2}},
+			probes: []probe{{"192.0.2.1", 0}, {"192.0.2.200", 0}, {"192.0.3.1", 0}, {"2001:db8:0:1::1", 0},
+				{"2001:db8:0:2::1", 0}, {"2001:db8:1::1", 0}},
+			want: []time.Duration{0, 500 * time.Millisecond, 0, 0, 500 * time.Millisecond, 0},
+		},
+		"Combined": {
+			budget: &Budget{Global: Limit{Rate: 100}, PerDestination: Limit{Rate: 1}, PrefixLen4: 16},
+			probes: []probe{{"192.0.2.1", 0}, {"192.0.2.2", 0}, {"192.0.2.1", 0}},
+			want:   []time.Duration{0, 10 * time.Millisecond, time.Second},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			var got []time.Duration
+			for _, p := range test.probes {
+				delay, _ := test.budget.reserve(net.ParseIP(p.dst), start.Add(p.at), false)
+				got = append(got, delay)
+			}
+			// Floating point rounding may leave delays a nanosecond out.
+			approx := cmp.Comparer(func(a, b time.Duration) bool { return a-b < 2 && b-a < 2 })
+			if diff := cmp.Diff(test.want, got, approx); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	b := &Budget{Global: Limit{Rate: 1, Burst: 2}, PerDestination: Limit{Rate: 1}}
+	dst := net.ParseIP("192.0.2.1")
+	if !b.Allow(dst) {
+		t.Fatalf("first probe not allowed")
+	}
+	if b.Allow(dst) {
+		t.Fatalf("second probe allowed")
+	}
+	// The refused probe took nothing from the global bucket.
+	if !b.Allow(net.ParseIP("192.0.2.2")) {
+		t.Fatalf("probe to another destination not allowed")
+	}
+}
+
+func TestWait(t *testing.T) {
+	b := &Budget{PerDestination: Limit{Rate: 20}}
+	dst := net.ParseIP("2001:db8::1")
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.Wait(context.Background(), dst); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("three probes took %v, want at least 100ms", elapsed)
+	}
+
+	// A cancelled wait returns its token, so the next caller waits no longer for it.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx, dst); err != context.DeadlineExceeded {
+		t.Fatalf("got err %v, want deadline exceeded", err)
+	}
+	start = time.Now()
+	if err := b.Wait(context.Background(), dst); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 60*time.Millisecond {
+		t.Fatalf("wait after a cancelled one took %v", elapsed)
+	}
+}
@@ -0,0 +1,678 @@
+package bwtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults used by a Client or Server whose fields are not set.
+const (
+	DefaultDuration    = 10 * time.Second
+	DefaultInterval    = time.Second
+	DefaultFrameSize   = 128 << 10
+	DefaultPacketSize  = 1200
+	DefaultRate        = 10000000 // Bits per second, for UDP tests.
+	DefaultMaxDuration = time.Minute
+)
+
+// maxFrameSize is the largest frame the server will send, which bounds the memory a client can make it allocate.
+const maxFrameSize = 1 << 20
+
+// magic identifies the protocol, and its version, at the start of every test.
+const magic = 0x42575431
+
+// udpHeaderLen is the length of the header at the start of each datagram of a UDP test: the test ID, then the
+// sequence number.
+const udpHeaderLen = 16
+
+// linger is how long the server keeps counting the datagrams of a UDP test after the client says it has finished, to
+// allow for those still in flight.
+const linger = 250 * time.Millisecond
+
+// Direction is the kind of test to run, named from the point of view of the client.
+type Direction uint8
+
+// The kinds of test.
+const (
+	Upload    Direction = iota + 1 // The client sends over TCP.
+	Download                       // The server sends over TCP.
+	UDPUpload                      // The client sends UDP datagrams at a fixed rate.
+)
+
+// String returns the name of the direction.
+func (d Direction) String() string {
+	switch d {
+	case Upload:
+		return "upload"
+	case Download:
+		return "download"
+	case UDPUpload:
+		return "udp-upload"
+	}
+	return fmt.Sprintf("direction %d", uint8(d))
+}
+
+// hello starts a test, and is sent by the client on the TCP connection.
+type hello struct {
+	Magic     uint32
+	Direction Direction
+	Pad       [3]uint8
+	Duration  uint32 // In milliseconds.
+	Interval  uint32 // How often the sender samples a TCP test, in milliseconds.
+	Size      uint32 // The frame or datagram size.
+	Rate      uint64 // The rate of UDP tests, in bits per second.
+	ID        uint64 // Identifies the datagrams of a UDP test.
+}
+
+// Status codes sent by the server in response to a hello.
+const (
+	statusOK = iota
+	statusBadRequest
+	statusTooLong
+)
+
+// receiverReport is sent by the receiver of a TCP test once the sender has finished.
+type receiverReport struct {
+	Bytes uint64
+	Nanos uint64
+}
+
+// senderReport is sent by the sender of a TCP test in reply to the receiver report, followed by Count intervals.
+type senderReport struct {
+	Retransmits uint32
+	Count       uint32
+}
+
+// intervalReport is the wire form of an Interval.
+type intervalReport struct {
+	Elapsed     uint64
+	Bytes       uint64
+	RTT         uint32 // In microseconds.
+	Retransmits uint32
+}
+
+// udpDone is sent by the client once it has sent the datagrams of a UDP test.
+type udpDone struct {
+	Sent uint64
+}
+
+// udpReport is sent by the server in reply to udpDone.
+type udpReport struct {
+	Received   uint64
+	Bytes      uint64
+	OutOfOrder uint64
+	Nanos      uint64
+}
+
+// Interval is a sample of the progress of a TCP test, taken by the sender.
+type Interval struct {
+	Elapsed     time.Duration // Since the start of the test.
+	Bytes       int64         // Written to the socket during the interval.
+	RTT         time.Duration // The smoothed RTT of the connection, where available.
+	Retransmits uint32        // Segments retransmitted during the interval, where available.
+}
+
+// Result describes a completed test. The byte counts and durations are those seen by the receiver, so that the goodput
+// reflects what actually arrived.
+type Result struct {
+	Direction Direction
+	Bytes     int64
+	Duration  time.Duration
+
+	// For TCP tests, the retransmissions and samples taken by the sender, where available.
+	Retransmits uint32
+	Intervals   []Interval
+
+	// For UDP tests, the datagrams sent and received, and those that arrived after a later one.
+	Sent       uint64
+	Received   uint64
+	OutOfOrder uint64
+}
+
+// Goodput returns the rate at which data arrived, in bits per second.
+func (r *Result) Goodput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) * 8 / r.Duration.Seconds()
+}
+
+// Loss returns the proportion of the datagrams of a UDP test that did not arrive.
+func (r *Result) Loss() float64 {
+	if r.Sent == 0 || r.Received >= r.Sent {
+		return 0
+	}
+	return float64(r.Sent-r.Received) / float64(r.Sent)
+}
+
+// Client runs tests against a Server. The zero value is usable.
+type Client struct {
+	Duration time.Duration // The length of the test, or DefaultDuration if zero.
+	Interval time.Duration // How often the sender samples a TCP test, or DefaultInterval if zero.
+	Size     int           // The frame size of TCP tests or datagram size of UDP tests, or a default if zero.
+	Rate     uint64        // The rate of UDP tests in bits per second, or DefaultRate if zero.
+}
+
+// Run runs a test against the server at address, a host and port on which it accepts both TCP and UDP.
+func (c *Client) Run(ctx context.Context, address string, direction Direction) (*Result, error) {
+	duration := c.Duration
+	if duration <= 0 {
+		duration = DefaultDuration
+	}
+	size := c.Size
+	if size <= 0 {
+		size = DefaultFrameSize
+		if direction == UDPUpload {
+			size = DefaultPacketSize
+		}
+	}
+	if direction == UDPUpload && size < udpHeaderLen {
+		return nil, fmt.Errorf("datagram size %d too small", size)
+	}
+	rate := c.Rate
+	if rate == 0 {
+		rate = DefaultRate
+	}
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Abandon the test if the context is done, by closing the connection out from under it.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	h := hello{
+		Magic:     magic,
+		Direction: direction,
+		Duration:  uint32(duration / time.Millisecond),
+		Interval:  uint32(interval / time.Millisecond),
+		Size:      uint32(size),
+		Rate:      rate,
+		ID:        binary.BigEndian.Uint64(id[:]),
+	}
+	if err := binary.Write(conn, binary.BigEndian, &h); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	var status uint8
+	if err := binary.Read(conn, binary.BigEndian, &status); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	switch status {
+	case statusOK:
+	case statusTooLong:
+		return nil, fmt.Errorf("server rejected test duration %v", duration)
+	default:
+		return nil, fmt.Errorf("server rejected test: status %d", status)
+	}
+
+	result := &Result{Direction: direction}
+	switch direction {
+	case Upload:
+		err = upload(conn, h, result)
+	case Download:
+		err = download(conn, result)
+	case UDPUpload:
+		err = udpUpload(ctx, conn, address, h, result)
+	default:
+		err = fmt.Errorf("unknown direction %d", direction)
+	}
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	return result, nil
+}
+
+// upload sends for the test, then exchanges reports with the server.
+func upload(conn net.Conn, h hello, result *Result) error {
+	report, intervals, err := send(conn, h)
+	if err != nil {
+		return err
+	}
+	var rr receiverReport
+	if err := binary.Read(conn, binary.BigEndian, &rr); err != nil {
+		return err
+	}
+	if err := writeSenderReport(conn, report, intervals); err != nil {
+		return err
+	}
+	result.Bytes, result.Duration = int64(rr.Bytes), time.Duration(rr.Nanos)
+	result.Retransmits, result.Intervals = report.Retransmits, fromReports(intervals)
+	return nil
+}
+
+// download receives for the test, then exchanges reports with the server.
+func download(conn net.Conn, result *Result) error {
+	rr, err := receive(conn)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(conn, binary.BigEndian, &rr); err != nil {
+		return err
+	}
+	report, intervals, err := readSenderReport(conn)
+	if err != nil {
+		return err
+	}
+	result.Bytes, result.Duration = int64(rr.Bytes), time.Duration(rr.Nanos)
+	result.Retransmits, result.Intervals = report.Retransmits, fromReports(intervals)
+	return nil
+}
+
+// udpUpload sends datagrams at the test rate, then collects the report of what arrived from the server.
+func udpUpload(ctx context.Context, conn net.Conn, address string, h hello, result *Result) error {
+	var d net.Dialer
+	udp, err := d.DialContext(ctx, "udp", address)
+	if err != nil {
+		return err
+	}
+	defer udp.Close()
+
+	b := make([]byte, h.Size)
+	binary.BigEndian.PutUint64(b, h.ID)
+	gap := time.Duration(float64(time.Second) * float64(8*h.Size) / float64(h.Rate))
+	start := time.Now()
+	end := start.Add(time.Duration(h.Duration) * time.Millisecond)
+
+	// Send whatever is due at each wakeup, so that the rate holds even though sleeps are coarser than the gap.
+	var seq uint64
+	for now := start; now.Before(end); now = time.Now() {
+		for due := uint64(now.Sub(start)/gap) + 1; seq < due; seq++ {
+			binary.BigEndian.PutUint64(b[8:], seq)
+			// Errors such as a full socket buffer or an ICMP unreachable are losses like any other.
+			udp.Write(b)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		time.Sleep(gap)
+	}
+
+	if err := binary.Write(conn, binary.BigEndian, &udpDone{Sent: seq}); err != nil {
+		return err
+	}
+	var report udpReport
+	if err := binary.Read(conn, binary.BigEndian, &report); err != nil {
+		return err
+	}
+	result.Sent, result.Received, result.OutOfOrder = seq, report.Received, report.OutOfOrder
+	result.Bytes, result.Duration = int64(report.Bytes), time.Duration(report.Nanos)
+	return nil
+}
+
+// send writes frames for the duration of the test, sampling the connection at each interval, and finishes with an
+// empty frame.
+func send(conn net.Conn, h hello) (senderReport, []intervalReport, error) {
+	duration := time.Duration(h.Duration) * time.Millisecond
+	interval := time.Duration(h.Interval) * time.Millisecond
+	frame := make([]byte, 4+h.Size)
+	binary.BigEndian.PutUint32(frame, h.Size)
+
+	var sent int64
+	var intervals []intervalReport
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastBytes int64
+		var lastRetrans uint32
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				total := atomic.LoadInt64(&sent)
+				ir := intervalReport{Elapsed: uint64(now.Sub(start)), Bytes: uint64(total - lastBytes)}
+				if rtt, retrans, ok := sample(conn); ok {
+					ir.RTT, ir.Retransmits = uint32(rtt/time.Microsecond), retrans-lastRetrans
+					lastRetrans = retrans
+				}
+				lastBytes = total
+				intervals = append(intervals, ir)
+			}
+		}
+	}()
+
+	end := start.Add(duration)
+	var err error
+	for time.Now().Before(end) {
+		conn.SetWriteDeadline(end)
+		var n int
+		if n, err = conn.Write(frame); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// The test ended part way through a frame, so the rest of it must still be sent to keep the framing.
+				conn.SetWriteDeadline(time.Time{})
+				var m int
+				m, err = conn.Write(frame[n:])
+				n += m
+			}
+		}
+		atomic.AddInt64(&sent, int64(n))
+		if err != nil {
+			break
+		}
+	}
+	close(done)
+	<-sampled
+	if err != nil {
+		return senderReport{}, nil, err
+	}
+	conn.SetWriteDeadline(time.Time{})
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return senderReport{}, nil, err
+	}
+
+	var report senderReport
+	if _, retrans, ok := sample(conn); ok {
+		report.Retransmits = retrans
+	}
+	report.Count = uint32(len(intervals))
+	return report, intervals, nil
+}
+
+// receive reads frames until the empty frame that ends the test, and reports what arrived.
+func receive(conn net.Conn) (receiverReport, error) {
+	var report receiverReport
+	var start time.Time
+	for {
+		var l uint32
+		if err := binary.Read(conn, binary.BigEndian, &l); err != nil {
+			return report, err
+		}
+		if start.IsZero() {
+			start = time.Now()
+		}
+		if l == 0 {
+			report.Nanos = uint64(time.Since(start))
+			return report, nil
+		}
+		n, err := io.CopyN(ioutil.Discard, conn, int64(l))
+		report.Bytes += uint64(n)
+		if err != nil {
+			return report, err
+		}
+	}
+}
+
+// writeSenderReport sends the sender report and its intervals.
+func writeSenderReport(w io.Writer, report senderReport, intervals []intervalReport) error {
+	if err := binary.Write(w, binary.BigEndian, &report); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, intervals)
+}
+
+// readSenderReport receives the sender report and its intervals.
+func readSenderReport(r io.Reader) (senderReport, []intervalReport, error) {
+	var report senderReport
+	if err := binary.Read(r, binary.BigEndian, &report); err != nil {
+		return report, nil, err
+	}
+	// Guard against an absurd count, as a test samples at most a few hundred times.
+	if report.Count > 1<<16 {
+		return report, nil, fmt.Errorf("too many intervals: %d", report.Count)
+	}
+	intervals := make([]intervalReport, report.Count)
+	if err := binary.Read(r, binary.BigEndian, intervals); err != nil {
+		return report, nil, err
+	}
+	return report, intervals, nil
+}
+
+// fromReports converts intervals from their wire form.
+func fromReports(reports []intervalReport) []Interval {
+	var intervals []Interval
+	for _, r := range reports {
+		intervals = append(intervals, Interval{
+			Elapsed:     time.Duration(r.Elapsed),
+			Bytes:       int64(r.Bytes),
+			RTT:         time.Duration(r.RTT) * time.Microsecond,
+			Retransmits: r.Retransmits,
+		})
+	}
+	return intervals
+}
+
+// contextErr returns the error of ctx if it is done, as that explains the failure better than the error it caused.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// udpTest accumulates the datagrams received for a UDP test.
+type udpTest struct {
+	received, bytes, outOfOrder uint64
+	next                        uint64 // The sequence number after the highest seen.
+	first, last                 time.Time
+}
+
+// Server accepts tests from clients on a TCP listener, and the datagrams of UDP tests on a UDP socket, normally on the
+// same port.
+type Server struct {
+	ln          net.Listener
+	udp         net.PacketConn
+	maxDuration time.Duration
+
+	mu    sync.Mutex
+	tests map[uint64]*udpTest
+	err   error
+}
+
+// Listen opens TCP and UDP sockets on address, such as ":5201", and starts serving tests on them, of up to
+// DefaultMaxDuration.
+func Listen(address string) (*Server, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	// An ephemeral port is only known once the TCP socket is open, so the UDP socket follows it.
+	udp, err := net.ListenPacket("udp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return NewServer(ln, udp, DefaultMaxDuration), nil
+}
+
+// NewServer starts serving tests of up to maxDuration on ln, and the datagrams of UDP tests on udp, which may be nil to
+// refuse UDP tests.
+func NewServer(ln net.Listener, udp net.PacketConn, maxDuration time.Duration) *Server {
+	s := &Server{
+		ln:          ln,
+		udp:         udp,
+		maxDuration: maxDuration,
+		tests:       make(map[uint64]*udpTest),
+	}
+	go s.serve()
+	if udp != nil {
+		go s.serveUDP()
+	}
+	return s
+}
+
+// Addr returns the address of the TCP listener.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Err returns the error that stopped the server, or nil if it is still running or was stopped by Close.
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the server from accepting new tests. TCP tests already running continue until they finish, but UDP tests
+// stop counting datagrams.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	return err
+}
+
+// setErr records the error that stopped the server, unless it was stopped by Close.
+func (s *Server) setErr(err error) {
+	if errors.Is(err, net.ErrClosed) {
+		return
+	}
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// serve accepts connections until the listener is closed.
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle runs a single test. Failures are the client's concern, and are not reported.
+func (s *Server) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	var h hello
+	if err := binary.Read(conn, binary.BigEndian, &h); err != nil || h.Magic != magic {
+		return
+	}
+	duration := time.Duration(h.Duration) * time.Millisecond
+	status := uint8(statusOK)
+	switch {
+	case duration > s.maxDuration:
+		status = statusTooLong
+	case h.Size == 0, h.Size > maxFrameSize, h.Direction == Download && h.Interval == 0:
+		status = statusBadRequest
+	case h.Direction == UDPUpload && (s.udp == nil || h.Size < udpHeaderLen || h.Rate == 0):
+		status = statusBadRequest
+	case h.Direction != Upload && h.Direction != Download && h.Direction != UDPUpload:
+		status = statusBadRequest
+	}
+	if err := binary.Write(conn, binary.BigEndian, status); err != nil || status != statusOK {
+		return
+	}
+
+	// Allow for the test itself, and a generous margin for the exchanges either side of it.
+	conn.SetDeadline(time.Now().Add(duration + 30*time.Second))
+	switch h.Direction {
+	case Upload:
+		rr, err := receive(conn)
+		if err != nil {
+			return
+		}
+		if err := binary.Write(conn, binary.BigEndian, &rr); err != nil {
+			return
+		}
+		readSenderReport(conn)
+
+	case Download:
+		report, intervals, err := send(conn, h)
+		if err != nil {
+			return
+		}
+		var rr receiverReport
+		if err := binary.Read(conn, binary.BigEndian, &rr); err != nil {
+			return
+		}
+		writeSenderReport(conn, report, intervals)
+
+	case UDPUpload:
+		s.mu.Lock()
+		s.tests[h.ID] = &udpTest{}
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			delete(s.tests, h.ID)
+			s.mu.Unlock()
+		}()
+
+		var done udpDone
+		if err := binary.Read(conn, binary.BigEndian, &done); err != nil {
+			return
+		}
+		time.Sleep(linger)
+
+		s.mu.Lock()
+		t := s.tests[h.ID]
+		report := udpReport{Received: t.received, Bytes: t.bytes, OutOfOrder: t.outOfOrder}
+		if t.received > 0 {
+			report.Nanos = uint64(t.last.Sub(t.first))
+		}
+		s.mu.Unlock()
+		binary.Write(conn, binary.BigEndian, &report)
+	}
+}
+
+// serveUDP counts the datagrams of running UDP tests until the socket is closed.
+func (s *Server) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		if n < udpHeaderLen {
+			continue
+		}
+		now := time.Now()
+		id, seq := binary.BigEndian.Uint64(buf), binary.BigEndian.Uint64(buf[8:])
+
+		s.mu.Lock()
+		if t, ok := s.tests[id]; ok {
+			if t.received == 0 {
+				t.first = now
+			}
+			t.received++
+			t.bytes += uint64(n)
+			t.last = now
+			if seq < t.next {
+				t.outOfOrder++
+			} else {
+				t.next = seq + 1
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,79 @@
+package bwtest
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer s.Close()
+	address := s.Addr().String()
+	ctx := context.Background()
+
+	for _, direction := range []Direction{Upload, Download} {
+		direction := direction
+		t.Run(direction.String(), func(t *testing.T) {
+			c := &Client{Duration: 300 * time.Millisecond, Interval: 100 * time.Millisecond}
+			res, err := c.Run(ctx, address, direction)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if res.Bytes == 0 || res.Duration < 250*time.Millisecond || res.Duration > time.Second {
+				t.Fatalf("got %d bytes in %v", res.Bytes, res.Duration)
+			}
+			if res.Goodput() <= 0 {
+				t.Fatalf("got goodput %v", res.Goodput())
+			}
+			if len(res.Intervals) < 2 || len(res.Intervals) > 3 {
+				t.Fatalf("got %d intervals, want 2 or 3", len(res.Intervals))
+			}
+			var sent int64
+			for _, i := range res.Intervals {
+				sent += i.Bytes
+				if runtime.GOOS == "linux" && i.RTT <= 0 {
+					t.Errorf("interval %+v has no rtt", i)
+				}
+			}
+			if sent > res.Bytes {
+				t.Errorf("intervals sent %d bytes, more than the %d received", sent, res.Bytes)
+			}
+		})
+	}
+
+	t.Run("UDP", func(t *testing.T) {
+		c := &Client{Duration: 200 * time.Millisecond, Size: 1000, Rate: 4000000}
+		res, err := c.Run(ctx, address, UDPUpload)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		// 500 datagrams a second for a fifth of a second.
+		if res.Sent < 95 || res.Sent > 105 {
+			t.Errorf("sent %d datagrams, want 100", res.Sent)
+		}
+		if res.Loss() > 0.05 || res.Bytes != int64(res.Received)*1000 {
+			t.Errorf("got %+v, loss %v", res, res.Loss())
+		}
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		c := &Client{Duration: time.Hour}
+		if _, err := c.Run(ctx, address, Upload); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		c := &Client{Duration: 10 * time.Second}
+		if _, err := c.Run(ctx, address, Download); err != context.DeadlineExceeded {
+			t.Fatalf("got %v, want deadline exceeded", err)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+// +build linux
+
+package bwtest
+
+import (
+	"github.com/dotwaffle/inettools/tcpinfo"
+	"net"
+	"time"
+)
+
+// sample returns the smoothed RTT of a TCP connection, and the segments it has retransmitted in total.
+func sample(conn net.Conn) (time.Duration, uint32, bool) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return 0, 0, false
+	}
+	info, err := tcpinfo.Get(tcpConn)
+	if err != nil {
+		return 0, 0, false
+	}
+	return time.Duration(info.Rtt) * time.Microsecond, info.Total_retrans, true
+}
@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/pcap"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrUnsupportedPlatform is returned on platforms where packets cannot be captured.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// Capture describes a live capture of the packets on an interface, using AF_PACKET on Linux and BPF devices on the
+// BSDs, both of which need privileges. The filter runs in the kernel, so unwanted packets are never copied out.
+type Capture struct {
+	// The interface to capture on. On Linux, leaving it empty captures on every interface, with the link-layer
+	// headers replaced by Linux cooked headers; elsewhere it is required.
+	Interface string
+	Filter    *Filter
+	// The octets to keep of each packet, or pcap.DefaultSnapLen if zero.
+	SnapLen int
+	// Capture packets addressed to other hosts, too.
+	Promiscuous bool
+}
+
+// Handle is an open capture.
+type Handle struct {
+	LinkType pcap.LinkType // The link-layer header of the packets, which the filter was compiled for.
+	SnapLen  int
+	f        *os.File
+	rc       syscall.RawConn
+	buf      []byte
+	pending  []byte // Packets read from a BPF device but not yet returned.
+	cooked   bool   // The socket receives packets without their link-layer headers, which are rebuilt.
+}
+
+// Open opens the capture.
+func (c *Capture) Open() (*Handle, error) {
+	snapLen := c.SnapLen
+	if snapLen <= 0 {
+		snapLen = pcap.DefaultSnapLen
+	}
+	return open(c, snapLen)
+}
+
+// ReadPacket returns the next packet accepted by the filter, waiting for one to arrive.
+func (h *Handle) ReadPacket() (*pcap.Packet, error) {
+	return h.read()
+}
+
+// SetReadDeadline sets the time after which ReadPacket returns an error that is a timeout.
+func (h *Handle) SetReadDeadline(t time.Time) error {
+	return h.f.SetReadDeadline(t)
+}
+
+// Close closes the capture, unblocking any ReadPacket.
+func (h *Handle) Close() error {
+	return h.f.Close()
+}
+
+// Run calls fn with each packet captured, until fn returns false or the context is done.
+func (h *Handle) Run(ctx context.Context, fn func(*pcap.Packet) bool) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			h.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	for {
+		p, err := h.ReadPacket()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if !fn(p) {
+			return nil
+		}
+	}
+}
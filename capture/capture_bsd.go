@@ -0,0 +1,159 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/pcap"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// bufferLen is the size of the buffer asked of a BPF device, which reads fill with as many packets as have arrived.
+const bufferLen = 1 << 20
+
+// Data link types of BPF devices (DLT_*), which differ from the link types of pcap files for raw IP.
+var linkTypes = map[int]pcap.LinkType{
+	0:  pcap.LinkTypeNull,
+	1:  pcap.LinkTypeEthernet,
+	12: pcap.LinkTypeRaw,
+	14: pcap.LinkTypeRaw,
+}
+
+// open opens a BPF device on the interface.
+func open(c *Capture, snapLen int) (*Handle, error) {
+	if c.Interface == "" {
+		return nil, errors.New("capture needs an interface")
+	}
+	fd, err := openDevice()
+	if err != nil {
+		return nil, err
+	}
+	h, err := setup(fd, c, snapLen)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// A non-blocking descriptor is registered with the runtime poller, so reads block only the calling goroutine and
+	// are interrupted by Close.
+	h.f = os.NewFile(uintptr(fd), "bpf")
+	if h.rc, err = h.f.SyscallConn(); err != nil {
+		h.f.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// openDevice opens the first BPF device that is not in use.
+func openDevice() (int, error) {
+	for i := -1; i < 256; i++ {
+		name := "/dev/bpf"
+		if i >= 0 {
+			name = fmt.Sprintf("/dev/bpf%d", i)
+		}
+		fd, err := syscall.Open(name, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+		if err == syscall.EBUSY || err == syscall.ENOENT && i < 0 {
+			continue
+		}
+		if err != nil {
+			return -1, os.NewSyscallError("open "+name, err)
+		}
+		return fd, nil
+	}
+	return -1, errors.New("no free bpf device")
+}
+
+// setup attaches a BPF device to the interface, and sets the filter for its data link type, which flushes any packets
+// queued before it.
+func setup(fd int, c *Capture, snapLen int) (*Handle, error) {
+	// The buffer must be sized before the interface is attached, and reads must ask for all of it.
+	syscall.SetBpfBuflen(fd, bufferLen)
+	buflen, err := syscall.BpfBuflen(fd)
+	if err != nil {
+		return nil, os.NewSyscallError("ioctl BIOCGBLEN", err)
+	}
+	if err := syscall.SetBpfInterface(fd, c.Interface); err != nil {
+		return nil, os.NewSyscallError("ioctl BIOCSETIF", err)
+	}
+	dlt, err := syscall.BpfDatalink(fd)
+	if err != nil {
+		return nil, os.NewSyscallError("ioctl BIOCGDLT", err)
+	}
+	linkType, ok := linkTypes[dlt]
+	if !ok {
+		return nil, fmt.Errorf("unsupported data link type %d of %s", dlt, c.Interface)
+	}
+	prog, err := c.Filter.Compile(linkType, snapLen)
+	if err != nil {
+		return nil, err
+	}
+	insns := make([]syscall.BpfInsn, len(prog))
+	for i, in := range prog {
+		insns[i] = syscall.BpfInsn{Code: in.Op, Jt: in.Jt, Jf: in.Jf, K: in.K}
+	}
+	if err := syscall.SetBpf(fd, insns); err != nil {
+		return nil, os.NewSyscallError("ioctl BIOCSETF", err)
+	}
+	if err := syscall.SetBpfImmediate(fd, 1); err != nil {
+		return nil, os.NewSyscallError("ioctl BIOCIMMEDIATE", err)
+	}
+	if c.Promiscuous {
+		if err := syscall.SetBpfPromisc(fd, 1); err != nil {
+			return nil, os.NewSyscallError("ioctl BIOCPROMISC", err)
+		}
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	return &Handle{LinkType: linkType, SnapLen: snapLen, buf: make([]byte, buflen)}, nil
+}
+
+// read returns the next packet from the buffer, first reading more from the device if it is empty.
+func (h *Handle) read() (*pcap.Packet, error) {
+	for len(h.pending) == 0 {
+		var n int
+		var readErr error
+		if err := h.rc.Read(func(fd uintptr) bool {
+			n, readErr = syscall.Read(int(fd), h.buf)
+			return readErr != syscall.EAGAIN
+		}); err != nil {
+			return nil, err
+		}
+		if readErr != nil {
+			return nil, os.NewSyscallError("read", readErr)
+		}
+		h.pending = h.buf[:n]
+	}
+
+	var hdr syscall.BpfHdr
+	if len(h.pending) < int(unsafe.Sizeof(hdr)) {
+		h.pending = nil
+		return nil, errors.New("bpf header truncated")
+	}
+	hdr = *(*syscall.BpfHdr)(unsafe.Pointer(&h.pending[0]))
+	start, end := int(hdr.Hdrlen), int(hdr.Hdrlen)+int(hdr.Caplen)
+	if end > len(h.pending) {
+		h.pending = nil
+		return nil, errors.New("bpf packet truncated")
+	}
+	p := &pcap.Packet{
+		Timestamp: time.Unix(int64(hdr.Tstamp.Sec), int64(hdr.Tstamp.Usec)*int64(time.Microsecond)),
+		Data:      append([]byte(nil), h.pending[start:end]...),
+		Length:    int(hdr.Datalen),
+	}
+	// Each packet starts on a word boundary, which is four octets on Darwin, and the size of a long elsewhere.
+	align := int(unsafe.Sizeof(uintptr(0)))
+	if runtime.GOOS == "darwin" {
+		align = 4
+	}
+	if next := (end + align - 1) &^ (align - 1); next < len(h.pending) {
+		h.pending = h.pending[next:]
+	} else {
+		h.pending = nil
+	}
+	return p, nil
+}
@@ -0,0 +1,190 @@
+// +build linux
+
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/pcap"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ethPAll is the protocol of a packet socket receiving every protocol (ETH_P_ALL).
+const ethPAll = 0x0003
+
+// sllHeaderLen is the length of a Linux cooked header.
+const sllHeaderLen = 16
+
+// Hardware types of interfaces (ARPHRD_*), by the link-layer header their packet sockets see.
+var (
+	ethernetHardware = map[int]bool{1: true, 772: true}                           // Ethernet and loopback.
+	rawHardware      = map[int]bool{512: true, 768: true, 769: true, 65534: true} // PPP, IPIP, IP6IP6, and tun.
+)
+
+// packetMreq asks a packet socket to join a link-layer group, or to make its interface promiscuous (struct
+// packet_mreq).
+type packetMreq struct {
+	ifindex int32
+	typ     uint16
+	alen    uint16
+	address [8]byte
+}
+
+// htons converts a 16-bit value to network byte order, as packet sockets require of the protocol.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// open opens a packet socket, with the filter attached before it is bound so that no other packets are queued.
+func open(c *Capture, snapLen int) (*Handle, error) {
+	h := &Handle{SnapLen: snapLen, buf: make([]byte, snapLen)}
+	sockType, ifindex, filterType := syscall.SOCK_RAW, 0, pcap.LinkTypeRaw
+	if c.Interface == "" {
+		if c.Promiscuous {
+			return nil, errors.New("promiscuous capture needs an interface")
+		}
+		// Interfaces differ in their link-layer headers, so they are received without them, and cooked headers
+		// rebuilt in their place.
+		sockType, h.cooked, h.LinkType = syscall.SOCK_DGRAM, true, pcap.LinkTypeLinuxSLL
+	} else {
+		ifi, err := net.InterfaceByName(c.Interface)
+		if err != nil {
+			return nil, err
+		}
+		if h.LinkType, err = linkType(c.Interface); err != nil {
+			return nil, err
+		}
+		ifindex, filterType = ifi.Index, h.LinkType
+	}
+	prog, err := c.Filter.Compile(filterType, snapLen)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, sockType|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := setup(fd, prog, ifindex, c.Promiscuous); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// A non-blocking descriptor is registered with the runtime poller, so reads block only the calling goroutine and
+	// are interrupted by Close.
+	h.f = os.NewFile(uintptr(fd), "packet")
+	if h.rc, err = h.f.SyscallConn(); err != nil {
+		h.f.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// setup attaches the filter to a packet socket, binds it, and asks for timestamps.
+func setup(fd int, prog Program, ifindex int, promiscuous bool) error {
+	filter := make([]syscall.SockFilter, len(prog))
+	for i, in := range prog {
+		filter[i] = syscall.SockFilter{Code: in.Op, Jt: in.Jt, Jf: in.Jf, K: in.K}
+	}
+	if err := syscall.AttachLsf(fd, filter); err != nil {
+		return os.NewSyscallError("setsockopt SO_ATTACH_FILTER", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(ethPAll), Ifindex: ifindex}); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	if promiscuous {
+		// syscall has no wrapper for struct packet_mreq, so it is passed as the bytes of a string instead.
+		mreq := packetMreq{ifindex: int32(ifindex), typ: syscall.PACKET_MR_PROMISC}
+		b := (*[unsafe.Sizeof(mreq)]byte)(unsafe.Pointer(&mreq))
+		if err := syscall.SetsockoptString(fd, syscall.SOL_PACKET, syscall.PACKET_ADD_MEMBERSHIP,
+			string(b[:])); err != nil {
+			return os.NewSyscallError("setsockopt PACKET_ADD_MEMBERSHIP", err)
+		}
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1); err != nil {
+		return os.NewSyscallError("setsockopt SO_TIMESTAMPNS", err)
+	}
+	return nil
+}
+
+// linkType returns the link-layer header the packet sockets of an interface see, from its hardware type.
+func linkType(ifname string) (pcap.LinkType, error) {
+	b, err := ioutil.ReadFile("/sys/class/net/" + ifname + "/type")
+	if err != nil {
+		return 0, err
+	}
+	hwType, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("hardware type of %s: %w", ifname, err)
+	}
+	switch {
+	case ethernetHardware[hwType]:
+		return pcap.LinkTypeEthernet, nil
+	case rawHardware[hwType]:
+		return pcap.LinkTypeRaw, nil
+	}
+	return 0, fmt.Errorf("unsupported hardware type %d of %s", hwType, ifname)
+}
+
+// read receives the next packet, with the time the kernel received it.
+func (h *Handle) read() (*pcap.Packet, error) {
+	var oob [64]byte
+	var n, oobn int
+	var from syscall.Sockaddr
+	var recvErr error
+	if err := h.rc.Read(func(fd uintptr) bool {
+		// MSG_TRUNC returns the length of the packet, even when it is longer than the buffer.
+		n, oobn, _, from, recvErr = syscall.Recvmsg(int(fd), h.buf, oob[:], syscall.MSG_TRUNC)
+		return recvErr != syscall.EAGAIN
+	}); err != nil {
+		return nil, err
+	}
+	if recvErr != nil {
+		return nil, os.NewSyscallError("recvmsg", recvErr)
+	}
+
+	data := h.buf[:n]
+	if n > len(h.buf) {
+		data = h.buf
+	}
+	p := &pcap.Packet{Timestamp: timestamp(oob[:oobn]), Length: n}
+	if !h.cooked {
+		p.Data = append([]byte(nil), data...)
+		return p, nil
+	}
+	sa, ok := from.(*syscall.SockaddrLinklayer)
+	if !ok {
+		return nil, errors.New("packet without link-layer address")
+	}
+	hdr := make([]byte, sllHeaderLen, sllHeaderLen+len(data))
+	binary.BigEndian.PutUint16(hdr[0:], uint16(sa.Pkttype))
+	binary.BigEndian.PutUint16(hdr[2:], sa.Hatype)
+	binary.BigEndian.PutUint16(hdr[4:], uint16(sa.Halen))
+	copy(hdr[6:14], sa.Addr[:])
+	binary.BigEndian.PutUint16(hdr[14:], htons(sa.Protocol))
+	p.Data, p.Length = append(hdr, data...), sllHeaderLen+n
+	return p, nil
+}
+
+// timestamp extracts the time from the SCM_TIMESTAMPNS message in out-of-band data, or returns the current time if
+// there is none.
+func timestamp(oob []byte) time.Time {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Now()
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level == syscall.SOL_SOCKET && msg.Header.Type == syscall.SCM_TIMESTAMPNS &&
+			len(msg.Data) >= int(unsafe.Sizeof(syscall.Timespec{})) {
+			return time.Unix((*syscall.Timespec)(unsafe.Pointer(&msg.Data[0])).Unix())
+		}
+	}
+	return time.Now()
+}
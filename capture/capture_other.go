@@ -0,0 +1,17 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package capture
+
+import (
+	"github.com/dotwaffle/inettools/pcap"
+)
+
+// open is not supported on this platform.
+func open(c *Capture, snapLen int) (*Handle, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// read is not supported on this platform.
+func (h *Handle) read() (*pcap.Packet, error) {
+	return nil, ErrUnsupportedPlatform
+}
@@ -0,0 +1,489 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/iprange"
+	"github.com/dotwaffle/inettools/pcap"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// MaxInstructions is the longest program the Linux kernel accepts, and so the longest Compile returns.
+const MaxInstructions = 4096
+
+// Filter selects IPv4 and IPv6 packets by their addresses, ports, and protocol. Each field left empty matches any
+// packet, and a packet must match every field that is set. Ports are matched in TCP, UDP, and SCTP packets that are
+// not fragments, and for IPv6, only where no extension headers precede the transport header, as with tcpdump.
+type Filter struct {
+	Hosts     *iprange.Set // Either the source or the destination address is in the set.
+	Src       *iprange.Set
+	Dst       *iprange.Set
+	Ports     []uint16 // Either the source or the destination port is in the list.
+	SrcPorts  []uint16
+	DstPorts  []uint16
+	Protocols []uint8 // The IP protocol, or for IPv6 the first next header.
+}
+
+// protocolNames are the protocols that may be given by name in a filter.
+var protocolNames = map[string]uint8{"icmp": 1, "tcp": 6, "udp": 17, "icmp6": 58, "sctp": 132}
+
+// ParseFilter parses a filter written as terms in the manner of tcpdump, such as "src net 192.0.2.0/24 port 443".
+// The terms are host or net followed by an address, prefix or range; port followed by a number; and a protocol name
+// (tcp, udp, sctp, icmp, or icmp6) or proto followed by a number. Addresses and ports may be preceded by src or dst.
+// Terms of the same kind are alternatives, so "port 80 port 443" matches either port, and terms of different kinds
+// must all match; the word "and" may be written between terms, but "or" and "not" are not supported.
+func ParseFilter(s string) (*Filter, error) {
+	f := &Filter{}
+	words := strings.Fields(s)
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if word == "and" {
+			continue
+		}
+		if p, ok := protocolNames[word]; ok {
+			f.Protocols = append(f.Protocols, p)
+			continue
+		}
+		dir := ""
+		if word == "src" || word == "dst" {
+			if i++; i == len(words) {
+				return nil, fmt.Errorf("%s needs host, net or port", word)
+			}
+			dir, word = word, words[i]
+		}
+		if i++; i == len(words) {
+			return nil, fmt.Errorf("%s needs a value", word)
+		}
+		value := words[i]
+
+		switch word {
+		case "host", "net":
+			r, err := iprange.Parse(value)
+			if err != nil {
+				return nil, err
+			}
+			if word == "host" && !r.First.Equal(r.Last) {
+				return nil, fmt.Errorf("host %s is not a single address", value)
+			}
+			set := map[string]**iprange.Set{"": &f.Hosts, "src": &f.Src, "dst": &f.Dst}[dir]
+			if *set == nil {
+				*set = &iprange.Set{}
+			}
+			if err := (*set).Add(r); err != nil {
+				return nil, err
+			}
+		case "port":
+			port, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port %q", value)
+			}
+			ports := map[string]*[]uint16{"": &f.Ports, "src": &f.SrcPorts, "dst": &f.DstPorts}[dir]
+			*ports = append(*ports, uint16(port))
+		case "proto":
+			if dir != "" {
+				return nil, fmt.Errorf("%s proto is not supported", dir)
+			}
+			p, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid protocol %q", value)
+			}
+			f.Protocols = append(f.Protocols, uint8(p))
+		default:
+			return nil, fmt.Errorf("unknown term %q", word)
+		}
+	}
+	return f, nil
+}
+
+// empty reports whether the filter matches every packet, including those that are not IP.
+func (f *Filter) empty() bool {
+	return f == nil || f.Hosts == nil && f.Src == nil && f.Dst == nil && len(f.Ports) == 0 && len(f.SrcPorts) == 0 &&
+		len(f.DstPorts) == 0 && len(f.Protocols) == 0
+}
+
+// Compile compiles the filter to a classic BPF program for packets of the given link type, which accepts up to
+// snapLen octets of each packet it matches. An empty or nil filter accepts every packet, including those that are not
+// IP; otherwise only IPv4 and IPv6 packets are accepted.
+func (f *Filter) Compile(linkType pcap.LinkType, snapLen int) (Program, error) {
+	accept := uint32(snapLen)
+	if f.empty() {
+		return Program{{Op: opRet | srcK, K: accept}}, nil
+	}
+
+	a := &assembler{}
+	v4, v6 := a.newLabel(), a.newLabel()
+	var off uint32
+	switch linkType {
+	case pcap.LinkTypeEthernet, pcap.LinkTypeLinuxSLL:
+		etherType := uint32(12)
+		off = 14
+		if linkType == pcap.LinkTypeLinuxSLL {
+			etherType, off = 14, 16
+		}
+		a.emit(opLd|sizeH|modeAbs, etherType)
+		a.jumpIfEqual(0x0800, v4)
+		a.jumpIfEqual(0x86dd, v6)
+	case pcap.LinkTypeRaw:
+		a.emit(opLd|sizeB|modeAbs, 0)
+		a.emit(opALU|aluAnd|srcK, 0xf0)
+		a.jumpIfEqual(0x40, v4)
+		a.jumpIfEqual(0x60, v6)
+	case pcap.LinkTypeNull:
+		// The address family is in the byte order of the host, which a filter cannot know, so both are matched.
+		off = 4
+		a.emit(opLd|sizeW|modeAbs, 0)
+		a.jumpIfEqual(2, v4)
+		a.jumpIfEqual(2<<24, v4)
+		for _, family := range []uint32{24, 28, 30} {
+			a.jumpIfEqual(family, v6)
+			a.jumpIfEqual(family<<24, v6)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported link type %d", linkType)
+	}
+	a.emit(opRet|srcK, 0)
+
+	a.place(v4)
+	f.family(a, ipv4Layout(off), accept)
+	a.place(v6)
+	f.family(a, ipv6Layout(off), accept)
+
+	prog, err := a.assemble()
+	if err != nil {
+		return nil, err
+	}
+	if len(prog) > MaxInstructions {
+		return nil, fmt.Errorf("filter compiles to %d instructions, more than %d", len(prog), MaxInstructions)
+	}
+	return prog, nil
+}
+
+// layout is where the fields of an IP header are, as offsets from the start of the packet.
+type layout struct {
+	v4              bool
+	src, dst, proto uint32
+	off             uint32 // The start of the IP header.
+	addrLen         int
+}
+
+// ipv4Layout returns the layout of an IPv4 header starting at off.
+func ipv4Layout(off uint32) layout {
+	return layout{v4: true, src: off + 12, dst: off + 16, proto: off + 9, off: off, addrLen: net.IPv4len}
+}
+
+// ipv6Layout returns the layout of an IPv6 header starting at off.
+func ipv6Layout(off uint32) layout {
+	return layout{src: off + 8, dst: off + 24, proto: off + 6, off: off, addrLen: net.IPv6len}
+}
+
+// family emits the tests for packets of one family: a clause for each field that is set, whose alternatives each jump
+// past the rest of the clause when they match, and which rejects the packet when none does.
+func (f *Filter) family(a *assembler, l layout, accept uint32) {
+	// A clause is a list of alternatives, of which at least one must match. Each alternative is given the label to
+	// jump to when it matches.
+	var clauses []func(matched label)
+	for _, c := range []struct {
+		set  *iprange.Set
+		offs []uint32
+	}{{f.Hosts, []uint32{l.src, l.dst}}, {f.Src, []uint32{l.src}}, {f.Dst, []uint32{l.dst}}} {
+		if c.set == nil {
+			continue
+		}
+		var pfxs []*net.IPNet
+		for _, pfx := range c.set.IPNets() {
+			if len(pfx.IP) == l.addrLen {
+				pfxs = append(pfxs, pfx)
+			}
+		}
+		offs := c.offs
+		clauses = append(clauses, func(matched label) {
+			for _, off := range offs {
+				for _, pfx := range pfxs {
+					a.prefix(off, pfx, matched)
+				}
+			}
+		})
+	}
+	if len(f.Protocols) > 0 {
+		clauses = append(clauses, func(matched label) {
+			a.emit(opLd|sizeB|modeAbs, l.proto)
+			for _, p := range f.Protocols {
+				a.jumpIfEqual(uint32(p), matched)
+			}
+		})
+	}
+	for _, c := range []struct {
+		ports []uint16
+		offs  []uint32
+	}{{f.Ports, []uint32{0, 2}}, {f.SrcPorts, []uint32{0}}, {f.DstPorts, []uint32{2}}} {
+		if len(c.ports) == 0 {
+			continue
+		}
+		c := c
+		clauses = append(clauses, func(matched label) {
+			a.transport(l)
+			for _, off := range c.offs {
+				if l.v4 {
+					a.emit(opLd|sizeH|modeInd, l.off+off)
+				} else {
+					a.emit(opLd|sizeH|modeAbs, l.off+40+off)
+				}
+				for _, port := range c.ports {
+					a.jumpIfEqual(uint32(port), matched)
+				}
+			}
+		})
+	}
+
+	for _, clause := range clauses {
+		next := a.newLabel()
+		clause(next)
+		a.emit(opRet|srcK, 0)
+		a.place(next)
+	}
+	a.emit(opRet|srcK, accept)
+}
+
+// prefix emits a test of whether the address at off is within pfx, which jumps to matched if it is, and otherwise
+// continues after the test.
+func (a *assembler) prefix(off uint32, pfx *net.IPNet, matched label) {
+	ones, _ := pfx.Mask.Size()
+	if ones == 0 {
+		a.jump(matched)
+		return
+	}
+	// Each word of the prefix is compared in turn, and a mismatch skips the rest of the test.
+	type word struct{ value, mask uint32 }
+	var words []word
+	for i := 0; i*32 < ones; i++ {
+		ip, mask := pfx.IP[4*i:4*i+4], pfx.Mask[4*i:4*i+4]
+		words = append(words, word{
+			value: uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3]),
+			mask:  uint32(mask[0])<<24 | uint32(mask[1])<<16 | uint32(mask[2])<<8 | uint32(mask[3]),
+		})
+	}
+	remaining := 1 // The jump to matched.
+	for _, w := range words {
+		remaining += 2
+		if w.mask != 0xffffffff {
+			remaining++
+		}
+	}
+	for i, w := range words {
+		a.emit(opLd|sizeW|modeAbs, off+uint32(4*i))
+		remaining--
+		if w.mask != 0xffffffff {
+			a.emit(opALU|aluAnd|srcK, w.mask)
+			remaining--
+		}
+		remaining--
+		a.prog = append(a.prog, Instruction{Op: opJmp | jmpJEQ | srcK, Jf: uint8(remaining), K: w.value})
+	}
+	a.jump(matched)
+}
+
+// transport emits tests that reject packets whose ports cannot be read, and for IPv4, loads the length of the IP
+// header into the index register.
+func (a *assembler) transport(l layout) {
+	ok := a.newLabel()
+	a.emit(opLd|sizeB|modeAbs, l.proto)
+	for _, p := range []uint32{6, 17, 132} {
+		a.jumpIfEqual(p, ok)
+	}
+	a.emit(opRet|srcK, 0)
+	a.place(ok)
+	if l.v4 {
+		// Only the first fragment holds the ports.
+		a.emit(opLd|sizeH|modeAbs, l.off+6)
+		a.prog = append(a.prog, Instruction{Op: opJmp | jmpJSET | srcK, Jf: 1, K: 0x1fff})
+		a.emit(opRet|srcK, 0)
+		a.emit(opLdx|sizeB|modeMsh, l.off)
+	}
+}
+
+// Classic BPF opcodes, from linux/filter.h and net/bpf.h.
+const (
+	opLd    = 0x00
+	opLdx   = 0x01
+	opALU   = 0x04
+	opJmp   = 0x05
+	opRet   = 0x06
+	sizeW   = 0x00
+	sizeH   = 0x08
+	sizeB   = 0x10
+	modeAbs = 0x20
+	modeInd = 0x40
+	modeMsh = 0xa0
+	aluAnd  = 0x50
+	jmpJA   = 0x00
+	jmpJEQ  = 0x10
+	jmpJGT  = 0x20
+	jmpJGE  = 0x30
+	jmpJSET = 0x40
+	srcK    = 0x00
+)
+
+// Instruction is a classic BPF instruction, laid out as the kernel expects.
+type Instruction struct {
+	Op     uint16
+	Jt, Jf uint8
+	K      uint32
+}
+
+// Program is a classic BPF program, as attached to a socket to filter the packets it receives.
+type Program []Instruction
+
+// String disassembles the program, one instruction to a line.
+func (p Program) String() string {
+	var b strings.Builder
+	for i, in := range p {
+		fmt.Fprintf(&b, "(%03d) %s\n", i, in.disassemble(i))
+	}
+	return b.String()
+}
+
+// disassemble formats an instruction at index i, in the manner of tcpdump -d.
+func (in Instruction) disassemble(i int) string {
+	sizes := map[uint16]string{sizeW: "", sizeH: "h", sizeB: "b"}
+	switch in.Op &^ (sizeW | sizeH | sizeB) {
+	case opLd | modeAbs:
+		return fmt.Sprintf("ld%-6s [%d]", sizes[in.Op&0x18], in.K)
+	case opLd | modeInd:
+		return fmt.Sprintf("ld%-6s [x + %d]", sizes[in.Op&0x18], in.K)
+	}
+	switch in.Op {
+	case opLdx | sizeB | modeMsh:
+		return fmt.Sprintf("ldxb     4*([%d]&0xf)", in.K)
+	case opALU | aluAnd | srcK:
+		return fmt.Sprintf("and      #%#x", in.K)
+	case opJmp | jmpJA:
+		return fmt.Sprintf("ja       %d", i+1+int(in.K))
+	case opJmp | jmpJEQ | srcK, opJmp | jmpJGT | srcK, opJmp | jmpJGE | srcK, opJmp | jmpJSET | srcK:
+		names := map[uint16]string{jmpJEQ: "jeq", jmpJGT: "jgt", jmpJGE: "jge", jmpJSET: "jset"}
+		return fmt.Sprintf("%-8s #%#-14x jt %d\tjf %d", names[in.Op&0xf0], in.K, i+1+int(in.Jt), i+1+int(in.Jf))
+	case opRet | srcK:
+		return fmt.Sprintf("ret      #%d", in.K)
+	}
+	return fmt.Sprintf("unknown  %#04x %d %d %#x", in.Op, in.Jt, in.Jf, in.K)
+}
+
+// Match runs the program over a packet, as the kernel would, and reports whether it accepts the packet.
+func (p Program) Match(pkt []byte) bool {
+	var acc, x uint32
+	load := func(off uint32, size uint16) (uint32, bool) {
+		n := map[uint16]uint32{sizeW: 4, sizeH: 2, sizeB: 1}[size]
+		if uint64(off)+uint64(n) > uint64(len(pkt)) {
+			return 0, false
+		}
+		var v uint32
+		for _, b := range pkt[off : off+n] {
+			v = v<<8 | uint32(b)
+		}
+		return v, true
+	}
+	for pc := 0; pc < len(p); pc++ {
+		in := p[pc]
+		var ok bool
+		switch in.Op &^ (sizeW | sizeH | sizeB) {
+		case opLd | modeAbs:
+			if acc, ok = load(in.K, in.Op&0x18); !ok {
+				return false
+			}
+			continue
+		case opLd | modeInd:
+			if acc, ok = load(x+in.K, in.Op&0x18); !ok {
+				return false
+			}
+			continue
+		}
+		switch in.Op {
+		case opLdx | sizeB | modeMsh:
+			v, ok := load(in.K, sizeB)
+			if !ok {
+				return false
+			}
+			x = 4 * (v & 0xf)
+		case opALU | aluAnd | srcK:
+			acc &= in.K
+		case opJmp | jmpJA:
+			pc += int(in.K)
+		case opJmp | jmpJEQ | srcK, opJmp | jmpJGT | srcK, opJmp | jmpJGE | srcK, opJmp | jmpJSET | srcK:
+			var cond bool
+			switch in.Op & 0xf0 {
+			case jmpJEQ:
+				cond = acc == in.K
+			case jmpJGT:
+				cond = acc > in.K
+			case jmpJGE:
+				cond = acc >= in.K
+			case jmpJSET:
+				cond = acc&in.K != 0
+			}
+			if cond {
+				pc += int(in.Jt)
+			} else {
+				pc += int(in.Jf)
+			}
+		case opRet | srcK:
+			return in.K != 0
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// label is a position in a program, which jumps can refer to before it is placed.
+type label int
+
+// assembler builds a program whose unconditional jumps refer to labels, as conditional jumps only reach 255
+// instructions ahead.
+type assembler struct {
+	prog   Program
+	labels []int         // The position of each label, or -1 until it is placed.
+	jumps  map[int]label // The unconditional jumps to resolve, by their index.
+}
+
+// newLabel returns a label to be placed later.
+func (a *assembler) newLabel() label {
+	a.labels = append(a.labels, -1)
+	return label(len(a.labels) - 1)
+}
+
+// place places a label at the next instruction.
+func (a *assembler) place(l label) {
+	a.labels[l] = len(a.prog)
+}
+
+// emit emits an instruction that does not jump.
+func (a *assembler) emit(op uint16, k uint32) {
+	a.prog = append(a.prog, Instruction{Op: op, K: k})
+}
+
+// jump emits an unconditional jump to a label.
+func (a *assembler) jump(l label) {
+	if a.jumps == nil {
+		a.jumps = map[int]label{}
+	}
+	a.jumps[len(a.prog)] = l
+	a.prog = append(a.prog, Instruction{Op: opJmp | jmpJA})
+}
+
+// jumpIfEqual emits a jump to a label taken if the accumulator equals k.
+func (a *assembler) jumpIfEqual(k uint32, l label) {
+	a.prog = append(a.prog, Instruction{Op: opJmp | jmpJEQ | srcK, Jf: 1, K: k})
+	a.jump(l)
+}
+
+// assemble resolves the jumps, and returns the program.
+func (a *assembler) assemble() (Program, error) {
+	for i, l := range a.jumps {
+		if a.labels[l] < 0 {
+			return nil, errors.New("jump to unplaced label")
+		}
+		a.prog[i].K = uint32(a.labels[l] - i - 1)
+	}
+	return a.prog, nil
+}
@@ -0,0 +1,264 @@
+package capture
+
+import (
+	"fmt"
+	"github.com/dotwaffle/inettools/iprange"
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/dotwaffle/inettools/pcap"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+)
+
+// datagram returns an IP packet carrying a UDP or TCP header between the given addresses and ports.
+func datagram(t *testing.T, proto uint8, src, dst string, sport, dport uint16) []byte {
+	t.Helper()
+	srcIP, dstIP := net.ParseIP(src), net.ParseIP(dst)
+	hdrLen := packet.IPv6HeaderLen
+	if srcIP.To4() != nil {
+		srcIP, dstIP, hdrLen = srcIP.To4(), dstIP.To4(), packet.IPv4MinLen
+	}
+	b := make([]byte, hdrLen+packet.TCPMinLen)
+	// The ports are at the same place in UDP and TCP headers.
+	b[hdrLen], b[hdrLen+1], b[hdrLen+2], b[hdrLen+3] = byte(sport>>8), byte(sport), byte(dport>>8), byte(dport)
+	var err error
+	if hdrLen == packet.IPv4MinLen {
+		err = packet.IPv4(b).Encode(&packet.IPv4Fields{TTL: 64, Protocol: proto, Src: srcIP, Dst: dstIP})
+	} else {
+		err = packet.IPv6(b).Encode(&packet.IPv6Fields{NextHeader: proto, HopLimit: 64, Src: srcIP, Dst: dstIP})
+	}
+	if err != nil {
+		t.Fatalf("encode err: %v", err)
+	}
+	return b
+}
+
+// frame prepends a link-layer header of the given type to an IP packet.
+func frame(linkType pcap.LinkType, ip []byte) []byte {
+	etherType := []byte{0x08, 0x00}
+	if ip[0]>>4 == 6 {
+		etherType = []byte{0x86, 0xdd}
+	}
+	var hdr []byte
+	switch linkType {
+	case pcap.LinkTypeEthernet:
+		hdr = append(make([]byte, 12), etherType...)
+	case pcap.LinkTypeLinuxSLL:
+		hdr = append(make([]byte, 14), etherType...)
+	case pcap.LinkTypeNull:
+		hdr = []byte{2, 0, 0, 0}
+		if ip[0]>>4 == 6 {
+			hdr = []byte{0, 0, 0, 30}
+		}
+	}
+	return append(hdr, ip...)
+}
+
+func TestParseFilter(t *testing.T) {
+	set := func(ranges ...string) *iprange.Set {
+		s := &iprange.Set{}
+		for _, r := range ranges {
+			parsed, _ := iprange.Parse(r)
+			s.Add(parsed)
+		}
+		return s
+	}
+
+	tests := map[string]struct {
+		filter  string
+		want    *Filter
+		wantErr bool
+	}{
+		"Empty": {
+			want: &Filter{},
+		},
+		"Terms": {
+			filter: "host 192.0.2.1 and src net 2001:db8::/32 dst net 198.51.100.1-198.51.100.9 port 80 port 443 " +
+				"src port 53 dst port 123 tcp proto 47",
+			want: &Filter{
+				Hosts:     set("192.0.2.1"),
+				Src:       set("2001:db8::/32"),
+				Dst:       set("198.51.100.1-198.51.100.9"),
+				Ports:     []uint16{80, 443},
+				SrcPorts:  []uint16{53},
+				DstPorts:  []uint16{123},
+				Protocols: []uint8{6, 47},
+			},
+		},
+		"HostRange": {
+			filter:  "host 192.0.2.0/24",
+			wantErr: true,
+		},
+		"MissingValue": {
+			filter:  "src port",
+			wantErr: true,
+		},
+		"BadPort": {
+			filter:  "port 65536",
+			wantErr: true,
+		},
+		"Or": {
+			filter:  "port 80 or port 443",
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseFilter(test.filter)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: %v, want error %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got, cmp.Comparer(func(a, b *iprange.Set) bool {
+				return a == nil && b == nil || a != nil && b != nil && a.Equal(b)
+			})); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := map[string]struct {
+		filter string
+		match  []string // Packets the filter matches, as proto src dst sport dport.
+		miss   []string
+	}{
+		"Empty": {
+			match: []string{"17 192.0.2.1 192.0.2.2 1 2", "6 2001:db8::1 2001:db8::2 1 2"},
+		},
+		"Host": {
+			filter: "host 192.0.2.1 host 2001:db8::1",
+			match: []string{
+				"17 192.0.2.1 198.51.100.1 1 2", "17 198.51.100.1 192.0.2.1 1 2",
+				"6 2001:db8::1 2001:db8::9 1 2", "6 2001:db8::9 2001:db8::1 1 2",
+			},
+			miss: []string{"17 192.0.2.2 198.51.100.1 1 2", "6 2001:db8::2 2001:db8::9 1 2"},
+		},
+		"SrcNet": {
+			filter: "src net 192.0.2.0/25 src net 2001:db8:1::/48 src net 2001:db8:2::/47",
+			match: []string{
+				"17 192.0.2.127 198.51.100.1 1 2", "6 2001:db8:1:ffff::1 ::1 1 2", "6 2001:db8:3::1 ::1 1 2",
+			},
+			miss: []string{
+				"17 192.0.2.128 198.51.100.1 1 2", "17 198.51.100.1 192.0.2.1 1 2", "6 2001:db8:4::1 ::1 1 2",
+			},
+		},
+		"DstRange": {
+			// A range is covered by 198.51.100.1/32, 198.51.100.2/31, 198.51.100.4/30, and 198.51.100.8/32.
+			filter: "dst net 198.51.100.1-198.51.100.8",
+			match:  []string{"17 192.0.2.1 198.51.100.1 1 2", "17 192.0.2.1 198.51.100.8 1 2"},
+			miss:   []string{"17 192.0.2.1 198.51.100.0 1 2", "17 192.0.2.1 198.51.100.9 1 2"},
+		},
+		"FamilyWithoutPrefixes": {
+			filter: "net 0.0.0.0/0",
+			match:  []string{"17 192.0.2.1 198.51.100.1 1 2"},
+			miss:   []string{"17 2001:db8::1 2001:db8::2 1 2"},
+		},
+		"Ports": {
+			filter: "tcp port 443 port 80",
+			match: []string{
+				"6 192.0.2.1 198.51.100.1 443 50000", "6 192.0.2.1 198.51.100.1 50000 80",
+				"6 2001:db8::1 2001:db8::2 50000 443",
+			},
+			miss: []string{
+				"17 192.0.2.1 198.51.100.1 443 50000", "6 192.0.2.1 198.51.100.1 50000 8080",
+				"58 2001:db8::1 2001:db8::2 50000 443",
+			},
+		},
+		"DirectedPorts": {
+			filter: "src port 53 dst port 5353 udp",
+			match:  []string{"17 192.0.2.1 198.51.100.1 53 5353"},
+			miss:   []string{"17 192.0.2.1 198.51.100.1 5353 53", "6 192.0.2.1 198.51.100.1 53 5353"},
+		},
+		"Combined": {
+			filter: "src host 192.0.2.1 dst net 192.0.2.0/24 dst port 22",
+			match:  []string{"6 192.0.2.1 192.0.2.9 1 22"},
+			miss: []string{
+				"6 192.0.2.1 192.0.2.9 1 23", "6 192.0.2.2 192.0.2.9 1 22", "6 192.0.2.1 198.51.100.1 1 22",
+				"6 2001:db8::1 2001:db8::2 1 22",
+			},
+		},
+	}
+	for name, test := range tests {
+		for _, linkType := range []pcap.LinkType{
+			pcap.LinkTypeEthernet, pcap.LinkTypeRaw, pcap.LinkTypeLinuxSLL, pcap.LinkTypeNull,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, err := ParseFilter(test.filter)
+				if err != nil {
+					t.Fatalf("parse err: %v", err)
+				}
+				prog, err := f.Compile(linkType, 96)
+				if err != nil {
+					t.Fatalf("compile err: %v", err)
+				}
+				for _, want := range []struct {
+					packets []string
+					match   bool
+				}{{test.match, true}, {test.miss, false}} {
+					for _, p := range want.packets {
+						var proto uint8
+						var src, dst string
+						var sport, dport uint16
+						if _, err := fmt.Sscan(p, &proto, &src, &dst, &sport, &dport); err != nil {
+							t.Fatalf("bad packet %q: %v", p, err)
+						}
+						if got := prog.Match(frame(linkType, datagram(t, proto, src, dst, sport, dport))); got != want.match {
+							t.Fatalf("link type %d: %s: got match %v, want %v\n%v", linkType, p, got, want.match, prog)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCompileFragment(t *testing.T) {
+	f, _ := ParseFilter("port 53")
+	prog, err := f.Compile(pcap.LinkTypeRaw, 96)
+	if err != nil {
+		t.Fatalf("compile err: %v", err)
+	}
+	b := datagram(t, packet.ProtocolUDP, "192.0.2.1", "192.0.2.2", 53, 53)
+	if !prog.Match(b) {
+		t.Fatalf("first fragment did not match")
+	}
+	// A later fragment holds no ports, so it is not matched even if its data happens to look like them.
+	packet.IPv4(b).SetFlagsFragmentOffset(0, 10)
+	if prog.Match(b) {
+		t.Fatalf("later fragment matched")
+	}
+	if prog.Match(b[:packet.IPv4MinLen+2]) {
+		t.Fatalf("truncated packet matched")
+	}
+}
+
+func TestProgramString(t *testing.T) {
+	f, _ := ParseFilter("udp")
+	prog, err := f.Compile(pcap.LinkTypeEthernet, 65535)
+	if err != nil {
+		t.Fatalf("compile err: %v", err)
+	}
+	want := []string{
+		"(000) ldh      [12]",
+		"(001) jeq      #0x800          jt 2\tjf 3",
+		"(002) ja       6",
+		"(003) jeq      #0x86dd         jt 4\tjf 5",
+		"(004) ja       11",
+		"(005) ret      #0",
+		"(006) ldb      [23]",
+		"(007) jeq      #0x11           jt 8\tjf 9",
+		"(008) ja       10",
+		"(009) ret      #0",
+		"(010) ret      #65535",
+		"(011) ldb      [20]",
+		"(012) jeq      #0x11           jt 13\tjf 14",
+		"(013) ja       15",
+		"(014) ret      #0",
+		"(015) ret      #65535",
+	}
+	if diff := cmp.Diff(want, strings.Split(strings.TrimSuffix(prog.String(), "\n"), "\n")); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
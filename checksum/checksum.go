@@ -0,0 +1,103 @@
+package checksum
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// Sum returns the one's complement sum of the 16-bit big-endian words of b, added to initial, padding an odd trailing
+// byte with zero. The result is folded to 16 bits but not complemented, so it can be fed back in as the initial value
+// for the next buffer; all buffers except the last must then have an even length.
+func Sum(b []byte, initial uint32) uint32 {
+	s := uint64(initial)
+
+	// Sum 32-bit words into a 64-bit accumulator, eight at a time, deferring the carries until the end. The carries
+	// cannot overflow the accumulator for any buffer that fits in memory, and the end-around carry makes the byte
+	// grouping irrelevant once folded.
+	for len(b) >= 32 {
+		s += uint64(binary.BigEndian.Uint32(b[0:]))
+		s += uint64(binary.BigEndian.Uint32(b[4:]))
+		s += uint64(binary.BigEndian.Uint32(b[8:]))
+		s += uint64(binary.BigEndian.Uint32(b[12:]))
+		s += uint64(binary.BigEndian.Uint32(b[16:]))
+		s += uint64(binary.BigEndian.Uint32(b[20:]))
+		s += uint64(binary.BigEndian.Uint32(b[24:]))
+		s += uint64(binary.BigEndian.Uint32(b[28:]))
+		b = b[32:]
+	}
+	for len(b) >= 4 {
+		s += uint64(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+	if len(b) >= 2 {
+		s += uint64(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		s += uint64(b[0]) << 8
+	}
+
+	return uint32(fold(s))
+}
+
+// Fold folds the carries of a one's complement sum, such as one returned by Sum or PseudoHeader, and returns its
+// complement, which is the value to place in a checksum field.
+func Fold(sum uint32) uint16 {
+	return ^fold(uint64(sum))
+}
+
+// Checksum returns the Internet checksum of b, as described in RFC 1071, starting from a partial sum such as that of
+// a pseudo-header. Computing the checksum of data that includes a correct checksum field results in zero.
+func Checksum(b []byte, initial uint32) uint16 {
+	return Fold(Sum(b, initial))
+}
+
+// PseudoHeader returns the partial sum of the pseudo-header that TCP, UDP and ICMPv6 include in their checksums, for
+// an upper-layer packet of the given protocol and length. The address family is taken from the addresses; if either
+// is not IPv4, both are treated as IPv6.
+func PseudoHeader(protocol uint8, src, dst net.IP, length int) uint32 {
+	var s uint32
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		s = Sum(src4, 0)
+		s = Sum(dst4, s)
+	} else {
+		s = Sum(src.To16(), 0)
+		s = Sum(dst.To16(), s)
+	}
+	return uint32(fold(uint64(s) + uint64(protocol) + uint64(length>>16) + uint64(length&0xffff)))
+}
+
+// Update returns the checksum that results from changing a 16-bit word covered by the checksum old from one value to
+// another, without summing the rest of the data again. It uses equation 3 of RFC 1624, which, unlike the earlier
+// method of RFC 1141, never produces a checksum of 0xffff when a recomputation would not.
+func Update(old, from, to uint16) uint16 {
+	// HC' = ~(~HC + ~m + m')
+	return Fold(uint32(^old) + uint32(^from) + uint32(to))
+}
+
+// Update32 is like Update, for a 32-bit field aligned to a 16-bit boundary, such as an IPv4 address or a TCP sequence
+// number.
+func Update32(old uint16, from, to uint32) uint16 {
+	s := uint32(^old) + uint32(^uint16(from>>16)) + uint32(^uint16(from)) + (to >> 16) + (to & 0xffff)
+	return Fold(s)
+}
+
+// UpdateBytes is like Update, for a field of any even length aligned to a 16-bit boundary, such as an IPv6 address.
+// The old and new contents of the field must be the same length; if they are not, or the length is odd, old is
+// returned unchanged.
+func UpdateBytes(old uint16, from, to []byte) uint16 {
+	if len(from) != len(to) || len(from)%2 != 0 {
+		return old
+	}
+	// Subtracting the old contents is the same as adding their complement, and the complement of a one's complement
+	// sum is the sum of the complements.
+	return Fold(uint32(^old) + uint32(^uint16(Sum(from, 0))) + Sum(to, 0))
+}
+
+// fold reduces a one's complement sum to 16 bits by repeatedly adding the carries back in.
+func fold(s uint64) uint16 {
+	for s > 0xffff {
+		s = (s >> 16) + (s & 0xffff)
+	}
+	return uint16(s)
+}
@@ -0,0 +1,137 @@
+package checksum
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// naive is the straightforward word-at-a-time sum from RFC 1071, used as a reference.
+func naive(b []byte) uint16 {
+	var s uint32
+	for len(b) >= 2 {
+		s += uint32(b[0])<<8 | uint32(b[1])
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		s += uint32(b[0]) << 8
+	}
+	for s > 0xffff {
+		s = (s >> 16) + (s & 0xffff)
+	}
+	return ^uint16(s)
+}
+
+func TestChecksum(t *testing.T) {
+	// The example from section 3 of RFC 1071.
+	b := []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}
+	if got := Sum(b, 0); got != 0xddf2 {
+		t.Fatalf("sum: got %04x, want ddf2", got)
+	}
+	if got := Checksum(b, 0); got != 0x220d {
+		t.Fatalf("checksum: got %04x, want 220d", got)
+	}
+
+	// Every length up to a few iterations of the unrolled loop, with random and all-ones data to exercise carries.
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+		buf := make([]byte, n)
+		r.Read(buf)
+		ones := make([]byte, n)
+		for i := range ones {
+			ones[i] = 0xff
+		}
+		for _, data := range [][]byte{buf, ones} {
+			if got, want := Checksum(data, 0), naive(data); got != want {
+				t.Fatalf("length %d: got %04x, want %04x", n, got, want)
+			}
+		}
+	}
+}
+
+func TestChained(t *testing.T) {
+	b := make([]byte, 101)
+	rand.New(rand.NewSource(2)).Read(b)
+	if got, want := Checksum(b[64:], Sum(b[:64], 0)), Checksum(b, 0); got != want {
+		t.Fatalf("got %04x, want %04x", got, want)
+	}
+}
+
+func TestPseudoHeader(t *testing.T) {
+	tests := map[string]struct {
+		src, dst string
+		want     []byte
+	}{
+		"IPv4": {
+			src:  "192.0.2.1",
+			dst:  "198.51.100.2",
+			want: []byte{192, 0, 2, 1, 198, 51, 100, 2, 0, 6, 0, 20},
+		},
+		"IPv6": {
+			src: "2001:db8::1",
+			dst: "2001:db8::2",
+			want: append(append(append([]byte{}, net.ParseIP("2001:db8::1")...), net.ParseIP("2001:db8::2")...),
+				0, 0, 0, 20, 0, 0, 0, 6),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Fold(PseudoHeader(6, net.ParseIP(tc.src), net.ParseIP(tc.dst), 20))
+			if want := naive(tc.want); got != want {
+				t.Fatalf("got %04x, want %04x", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 1000; i++ {
+		b := make([]byte, 40)
+		r.Read(b)
+		// Include the edge cases of fields that are all zeros or all ones.
+		switch i {
+		case 0:
+			copy(b[12:20], []byte{0, 0, 0, 0, 0, 0, 0, 0})
+		case 1:
+			copy(b[12:20], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+		}
+		old := Checksum(b, 0)
+
+		// A 16-bit field.
+		from := binary.BigEndian.Uint16(b[10:])
+		to := uint16(r.Uint32())
+		binary.BigEndian.PutUint16(b[10:], to)
+		if got, want := Update(old, from, to), Checksum(b, 0); got != want {
+			t.Fatalf("update %04x to %04x: got %04x, want %04x", from, to, got, want)
+		}
+		old = Checksum(b, 0)
+
+		// A 32-bit field, such as an address being rewritten by NAT.
+		from32 := binary.BigEndian.Uint32(b[12:])
+		to32 := r.Uint32()
+		binary.BigEndian.PutUint32(b[12:], to32)
+		if got, want := Update32(old, from32, to32), Checksum(b, 0); got != want {
+			t.Fatalf("update32 %08x to %08x: got %04x, want %04x", from32, to32, got, want)
+		}
+		old = Checksum(b, 0)
+
+		// A larger field, such as an IPv6 address.
+		fromBytes := append([]byte{}, b[16:32]...)
+		r.Read(b[16:32])
+		if got, want := UpdateBytes(old, fromBytes, b[16:32]), Checksum(b, 0); got != want {
+			t.Fatalf("update bytes: got %04x, want %04x", got, want)
+		}
+	}
+}
+
+func BenchmarkChecksum(b *testing.B) {
+	buf := make([]byte, 1500)
+	rand.New(rand.NewSource(4)).Read(buf)
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		Checksum(buf, 0)
+	}
+}
@@ -0,0 +1,199 @@
+package cloudranges
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Provider is a cloud provider that publishes the address ranges it uses.
+type Provider string
+
+// Providers with published address ranges.
+const (
+	AWS   Provider = "aws"
+	GCP   Provider = "gcp"
+	Azure Provider = "azure"
+)
+
+// URLs the providers publish their address ranges at. Azure publishes service tags weekly at a URL that changes with
+// each release, linked from https://www.microsoft.com/en-us/download/details.aspx?id=56519, so has no fixed URL.
+const (
+	AWSURL = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+	GCPURL = "https://www.gstatic.com/ipranges/cloud.json"
+)
+
+// ErrNoURL is returned when fetching the ranges of a provider without a fixed URL, and none is supplied.
+var ErrNoURL = errors.New("no url for provider")
+
+// Prefix is a prefix used by a cloud provider, tagged with the service and region using it. Providers often list a
+// prefix more than once, such as for each service within a broader one.
+type Prefix struct {
+	Prefix   *net.IPNet
+	Provider Provider
+	Service  string // Such as "S3" for AWS, "Google Cloud" for GCP, or the service tag "Storage" for Azure.
+	Region   string // Such as "eu-west-1", "europe-west1", or "westeurope", or empty or "GLOBAL" if not regional.
+}
+
+// Parse reads the published address ranges of a provider.
+func Parse(r io.Reader, p Provider) ([]Prefix, error) {
+	switch p {
+	case AWS:
+		return ParseAWS(r)
+	case GCP:
+		return ParseGCP(r)
+	case Azure:
+		return ParseAzure(r)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", p)
+	}
+}
+
+// ParseAWS reads the AWS ip-ranges.json format.
+func ParseAWS(r io.Reader) ([]Prefix, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPPrefix   string `json:"ip_prefix"`
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+			Service    string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPPrefix   string `json:"ip_prefix"`
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+			Service    string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, err
+	}
+	var pfxs []Prefix
+	for _, e := range append(feed.Prefixes, feed.IPv6Prefixes...) {
+		pfx, err := parsePrefix(e.IPPrefix + e.IPv6Prefix)
+		if err != nil {
+			return nil, err
+		}
+		pfxs = append(pfxs, Prefix{Prefix: pfx, Provider: AWS, Service: e.Service, Region: e.Region})
+	}
+	return pfxs, nil
+}
+
+// ParseGCP reads the GCP cloud.json format, or the goog.json format of all Google prefixes, which has no services or
+// regions.
+func ParseGCP(r io.Reader) ([]Prefix, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, err
+	}
+	var pfxs []Prefix
+	for _, e := range feed.Prefixes {
+		pfx, err := parsePrefix(e.IPv4Prefix + e.IPv6Prefix)
+		if err != nil {
+			return nil, err
+		}
+		pfxs = append(pfxs, Prefix{Prefix: pfx, Provider: GCP, Service: e.Service, Region: e.Scope})
+	}
+	return pfxs, nil
+}
+
+// ParseAzure reads the Azure service tags format. The service is the part of the tag name before any region, such as
+// "Storage" for both "Storage" and "Storage.WestEurope", as network security groups refer to them.
+func ParseAzure(r io.Reader) ([]Prefix, error) {
+	var feed struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, err
+	}
+	var pfxs []Prefix
+	for _, v := range feed.Values {
+		service := v.Name
+		if i := strings.IndexByte(service, '.'); i >= 0 {
+			service = service[:i]
+		}
+		for _, s := range v.Properties.AddressPrefixes {
+			pfx, err := parsePrefix(s)
+			if err != nil {
+				return nil, err
+			}
+			pfxs = append(pfxs, Prefix{Prefix: pfx, Provider: Azure, Service: service, Region: v.Properties.Region})
+		}
+	}
+	return pfxs, nil
+}
+
+// parsePrefix parses a prefix in CIDR notation.
+func parsePrefix(s string) (*net.IPNet, error) {
+	_, pfx, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix %q", s)
+	}
+	return pfx, nil
+}
+
+// Fetch fetches and parses the published address ranges of a provider from url, or from the provider's usual URL if
+// url is empty.
+func Fetch(ctx context.Context, p Provider, url string) ([]Prefix, error) {
+	if url == "" {
+		url = map[Provider]string{AWS: AWSURL, GCP: GCPURL}[p]
+		if url == "" {
+			return nil, fmt.Errorf("%s: %w", p, ErrNoURL)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", url, resp.Status)
+	}
+	return Parse(resp.Body, p)
+}
+
+// Filter returns the prefixes used by a service in a region, ignoring case. An empty service or region matches any.
+func Filter(pfxs []Prefix, service, region string) []Prefix {
+	var filtered []Prefix
+	for _, p := range pfxs {
+		if (service == "" || strings.EqualFold(p.Service, service)) && (region == "" || strings.EqualFold(p.Region, region)) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// IPNets returns the prefixes without their tags, ready for aggregation, leaving out those listed more than once.
+func IPNets(pfxs []Prefix) []*net.IPNet {
+	seen := map[string]bool{}
+	var nets []*net.IPNet
+	for _, p := range pfxs {
+		if s := p.Prefix.String(); !seen[s] {
+			seen[s] = true
+			nets = append(nets, p.Prefix)
+		}
+	}
+	return nets
+}
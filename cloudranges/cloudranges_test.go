@@ -0,0 +1,199 @@
+package cloudranges
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const awsFeed = `{
+  "syncToken": "1700000000",
+  "createDate": "2023-11-14-22-13-20",
+  "prefixes": [
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "AMAZON"},
+    {"ip_prefix": "52.218.0.0/17", "region": "eu-west-1", "service": "AMAZON"},
+    {"ip_prefix": "52.218.0.0/17", "region": "eu-west-1", "service": "S3"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2a05:d07a:a000::/40", "region": "eu-west-1", "service": "S3"}
+  ]
+}`
+
+const gcpFeed = `{
+  "syncToken": "1700000000000",
+  "creationTime": "2023-11-14T22:13:20.000000",
+  "prefixes": [
+    {"ipv4Prefix": "34.1.208.0/20", "service": "Google Cloud", "scope": "africa-south1"},
+    {"ipv6Prefix": "2600:1900:8000::/44", "service": "Google Cloud", "scope": "europe-west1"}
+  ]
+}`
+
+const azureFeed = `{
+  "changeNumber": 250,
+  "cloud": "Public",
+  "values": [
+    {
+      "name": "Storage.WestEurope",
+      "id": "Storage.WestEurope",
+      "properties": {
+        "changeNumber": 30,
+        "region": "westeurope",
+        "regionId": 18,
+        "platform": "Azure",
+        "systemService": "AzureStorage",
+        "addressPrefixes": ["13.69.40.0/24", "2603:1020:206:1::/64"]
+      }
+    },
+    {
+      "name": "AzureFrontDoor.Frontend",
+      "id": "AzureFrontDoor.Frontend",
+      "properties": {"region": "", "addressPrefixes": ["13.107.246.0/24"]}
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		provider Provider
+		input    string
+		want     []string
+		wantErr  bool
+	}{
+		"AWS": {
+			provider: AWS,
+			input:    awsFeed,
+			want: []string{
+				"3.5.140.0/22 AMAZON ap-northeast-2",
+				"52.218.0.0/17 AMAZON eu-west-1",
+				"52.218.0.0/17 S3 eu-west-1",
+				"2a05:d07a:a000::/40 S3 eu-west-1",
+			},
+		},
+		"GCP": {
+			provider: GCP,
+			input:    gcpFeed,
+			want: []string{
+				"34.1.208.0/20 Google Cloud africa-south1",
+				"2600:1900:8000::/44 Google Cloud europe-west1",
+			},
+		},
+		"Azure": {
+			provider: Azure,
+			input:    azureFeed,
+			want: []string{
+				"13.69.40.0/24 Storage westeurope",
+				"2603:1020:206:1::/64 Storage westeurope",
+				"13.107.246.0/24 AzureFrontDoor ",
+			},
+		},
+		"InvalidPrefix": {
+			provider: GCP,
+			input:    `{"prefixes": [{"ipv4Prefix": "34.1.208.0/33"}]}`,
+			wantErr:  true,
+		},
+		"InvalidJSON": {
+			provider: AWS,
+			input:    `{"prefixes": [`,
+			wantErr:  true,
+		},
+		"UnknownProvider": {
+			provider: "oracle",
+			input:    `{}`,
+			wantErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pfxs, err := Parse(strings.NewReader(test.input), test.provider)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			var got []string
+			for _, p := range pfxs {
+				if p.Provider != test.provider {
+					t.Errorf("%v: got provider %q, want %q", p.Prefix, p.Provider, test.provider)
+				}
+				got = append(got, p.Prefix.String()+" "+p.Service+" "+p.Region)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	pfxs, err := ParseAWS(strings.NewReader(awsFeed))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+
+	tests := map[string]struct {
+		service, region string
+		want            []string
+	}{
+		"S3": {
+			service: "s3",
+			region:  "EU-WEST-1",
+			want:    []string{"52.218.0.0/17", "2a05:d07a:a000::/40"},
+		},
+		"Region": {
+			region: "eu-west-1",
+			want:   []string{"52.218.0.0/17", "2a05:d07a:a000::/40"},
+		},
+		"All": {
+			want: []string{"3.5.140.0/22", "52.218.0.0/17", "2a05:d07a:a000::/40"},
+		},
+		"None": {
+			service: "S3",
+			region:  "ap-northeast-2",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, pfx := range IPNets(Filter(pfxs, test.service, test.region)) {
+				got = append(got, pfx.String())
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cloud.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(gcpFeed))
+	}))
+	defer srv.Close()
+
+	pfxs, err := Fetch(context.Background(), GCP, srv.URL+"/cloud.json")
+	if err != nil {
+		t.Fatalf("fetch err: %v", err)
+	}
+	if diff := cmp.Diff(2, len(pfxs)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if _, err := Fetch(context.Background(), GCP, srv.URL+"/missing.json"); err == nil {
+		t.Errorf("Fetch: got no error for missing feed")
+	}
+	if _, err := Fetch(context.Background(), Azure, ""); err == nil {
+		t.Errorf("Fetch: got no error for Azure without a URL")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/dotwaffle/inettools/aggregate"
+	"github.com/dotwaffle/inettools/feed"
+	"github.com/dotwaffle/inettools/prefixlist"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+// runAggregate reads prefixes from files or stdin, and writes their aggregate.
+func runAggregate(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("aggregate", "[file ...]", stderr)
+	only4 := fs.Bool("4", false, "only keep IPv4 prefixes")
+	only6 := fs.Bool("6", false, "only keep IPv6 prefixes")
+	maxLen4 := fs.Int("max-length4", 0, "drop IPv4 prefixes longer than this `length` before aggregating")
+	maxLen6 := fs.Int("max-length6", 0, "drop IPv6 prefixes longer than this `length` before aggregating")
+	format := fs.String("format", "plain", fmt.Sprintf("output `syntax`, one of %v", prefixlist.Syntaxes))
+	name := fs.String("name", prefixlist.DefaultName, "`name` of the prefix list in router syntaxes")
+	deny := fs.Bool("deny", false, "deny rather than permit the prefixes in router syntaxes")
+	inputFormat := fs.String("input", string(feed.FormatAuto), fmt.Sprintf("input `format`, one of %v", feed.Formats))
+	column := fs.Int("column", 0, "the `column` of CSV input holding prefixes, counting from zero")
+	field := fs.String("field", "", "the `name` of the fields of JSON input holding prefixes, rather than an array")
+	diffFile := fs.String("diff", "", "write the changes from the list in `file`, as prefixes or IOS configuration, "+
+		"rather than the whole list")
+	cacheDir := fs.String("cache", "", "reuse lists aggregated from identical input in an earlier run, kept in `dir`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	syntax, err := prefixlist.ParseSyntax(*format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+	in := input{column: *column, field: *field}
+	if in.format, err = feed.ParseFormat(*inputFormat); err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+	if *only4 && *only6 {
+		fmt.Fprintln(stderr, "-4 and -6 are mutually exclusive")
+		return errUsage
+	}
+
+	var pfxs, excluded []*net.IPNet
+	if fs.NArg() == 0 {
+		if pfxs, excluded, err = readInput(stdin, "stdin", in); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		filePfxs, fileExcluded, err := readInput(f, path, in)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		pfxs = append(pfxs, filePfxs...)
+		excluded = append(excluded, fileExcluded...)
+	}
+
+	kept := pfxs[:0]
+	for _, pfx := range pfxs {
+		ones, bits := pfx.Mask.Size()
+		v4 := bits == 8*net.IPv4len
+		switch {
+		case v4 && *only6, !v4 && *only4:
+		case v4 && *maxLen4 > 0 && ones > *maxLen4:
+		case !v4 && *maxLen6 > 0 && ones > *maxLen6:
+		default:
+			kept = append(kept, pfx)
+		}
+	}
+	var agg []*net.IPNet
+	if *cacheDir != "" {
+		agg, err = (&prefixlist.Cache{Dir: *cacheDir}).Compile(kept, excluded)
+	} else {
+		agg, err = aggregate.Exclude(kept, excluded)
+	}
+	if err != nil {
+		return err
+	}
+	opts := &prefixlist.Options{Name: *name, Deny: *deny}
+	if *diffFile == "" {
+		return prefixlist.Write(stdout, agg, syntax, opts)
+	}
+	old, err := readEntries(*diffFile, opts)
+	if err != nil {
+		return err
+	}
+	return prefixlist.WriteDelta(stdout, prefixlist.Diff(old, agg, opts), syntax, opts)
+}
+
+// readEntries reads the current prefix list from a file. If the file holds IOS prefix list entries with the right name
+// they are used as they are, with their sequence numbers; otherwise it is read as prefixes, aggregated, and numbered as
+// they would have been written.
+func readEntries(path string, opts *prefixlist.Options) ([]prefixlist.Entry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := prefixlist.ParseIOS(bytes.NewReader(b), opts.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(entries) > 0 {
+		return entries, nil
+	}
+	pfxs, excluded, err := readPrefixes(bytes.NewReader(b), path)
+	if err != nil {
+		return nil, err
+	}
+	agg, err := aggregate.Exclude(pfxs, excluded)
+	if err != nil {
+		return nil, err
+	}
+	return prefixlist.Number(agg, opts), nil
+}
+
+// input is how the aggregate command reads its input.
+type input struct {
+	format feed.Format
+	column int
+	field  string
+}
+
+// readInput reads prefixes in the input format, detecting it if needed. Text is read by readPrefixes, so it may also
+// hold exclusions.
+func readInput(r io.Reader, name string, in input) (pfxs, excluded []*net.IPNet, err error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	format := in.format
+	if format == feed.FormatAuto {
+		format = feed.Detect(b)
+	}
+	if format == feed.FormatText {
+		return readPrefixes(bytes.NewReader(b), name)
+	}
+	if pfxs, err = feed.Parse(bytes.NewReader(b), format, in.column, in.field); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return pfxs, nil, nil
+}
+
+// readPrefixes reads prefixes, one or more to a line separated by spaces or commas, ignoring blank lines and comments
+// starting with #. Addresses without a length are taken as single hosts, and prefixes starting with ! are returned
+// separately as exclusions.
+func readPrefixes(r io.Reader, name string) (pfxs, excluded []*net.IPNet, err error) {
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			pfx, err := parsePrefix(strings.TrimPrefix(field, "!"))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+			if strings.HasPrefix(field, "!") {
+				excluded = append(excluded, pfx)
+			} else {
+				pfxs = append(pfxs, pfx)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return pfxs, excluded, nil
+}
+
+// parsePrefix parses a prefix in CIDR notation, or a single address.
+func parsePrefix(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, pfx, err := net.ParseCIDR(s)
+		return pfx, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid prefix %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
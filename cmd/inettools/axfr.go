@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/prefixlist"
+	"io"
+)
+
+// runAXFR transfers a zone from a DNS server, and writes the addresses of its A and AAAA records aggregated into
+// prefixes, such as to build a list of the hosts a zone points at.
+func runAXFR(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("axfr", "-server addr -zone zone", stderr)
+	server := fs.String("server", "", "the `address` of a DNS server that allows the zone to be transferred")
+	zone := fs.String("zone", "", "the `zone` to transfer")
+	format := fs.String("format", "plain", fmt.Sprintf("output `syntax`, one of %v", prefixlist.Syntaxes))
+	name := fs.String("name", prefixlist.DefaultName, "`name` of the prefix list in router syntaxes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *server == "" || *zone == "" || fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "-server and -zone are required, and no arguments are taken")
+		fs.Usage()
+		return errUsage
+	}
+	syntax, err := prefixlist.ParseSyntax(*format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+
+	t, err := dnsutil.NewClient(*server).AXFR(context.Background(), *zone)
+	if err != nil {
+		return err
+	}
+	return prefixlist.Write(stdout, dnsutil.AddressSet(t.Records).IPNets(), syntax, &prefixlist.Options{Name: *name})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/ipcalc"
+	"io"
+	"net"
+)
+
+// calcResult is the JSON form of the description of a prefix.
+type calcResult struct {
+	Address   string   `json:"address"`
+	Prefix    string   `json:"prefix"`
+	Netmask   string   `json:"netmask"`
+	Wildcard  string   `json:"wildcard"`
+	Network   string   `json:"network"`
+	Broadcast string   `json:"broadcast,omitempty"`
+	First     string   `json:"first"`
+	Last      string   `json:"last"`
+	Addresses string   `json:"addresses"`
+	Hosts     string   `json:"hosts"`
+	Split     []string `json:"split,omitempty"`
+}
+
+// runCalc describes each prefix given, in the manner of ipcalc.
+func runCalc(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("calc", "prefix ...", stderr)
+	split := fs.Int("split", 0, "also list the subnets of this prefix `length`")
+	asJSON := fs.Bool("json", false, "write JSON rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	var results []calcResult
+	for i, arg := range fs.Args() {
+		info, err := ipcalc.Parse(arg)
+		if err != nil {
+			return err
+		}
+		var subnets []*net.IPNet
+		if *split > 0 {
+			if subnets, err = ipcalc.Split(info.Prefix, *split); err != nil {
+				return err
+			}
+		}
+		if *asJSON {
+			results = append(results, newCalcResult(info, subnets))
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		writeCalc(stdout, info, subnets)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	return nil
+}
+
+// newCalcResult converts the description of a prefix to its JSON form.
+func newCalcResult(info *ipcalc.Info, subnets []*net.IPNet) calcResult {
+	r := calcResult{
+		Address:   info.Address.String(),
+		Prefix:    info.Prefix.String(),
+		Netmask:   net.IP(info.Mask).String(),
+		Wildcard:  net.IP(info.Wildcard).String(),
+		Network:   info.Network.String(),
+		First:     info.First.String(),
+		Last:      info.Last.String(),
+		Addresses: info.Addresses.String(),
+		Hosts:     info.Hosts.String(),
+	}
+	if info.Broadcast != nil {
+		r.Broadcast = info.Broadcast.String()
+	}
+	for _, s := range subnets {
+		r.Split = append(r.Split, s.String())
+	}
+	return r
+}
+
+// writeCalc writes the description of a prefix as text, with the binary form of each address alongside it.
+func writeCalc(w io.Writer, info *ipcalc.Info, subnets []*net.IPNet) {
+	width := 20
+	if info.Bits == 128 {
+		width = 46
+	}
+	line := func(label string, value interface{}, binary []byte) {
+		if binary == nil {
+			fmt.Fprintf(w, "%-10s %v\n", label+":", value)
+			return
+		}
+		fmt.Fprintf(w, "%-10s %-*v %s\n", label+":", width, value, ipcalc.Binary(binary))
+	}
+	line("Address", info.Address, info.Address)
+	line("Netmask", fmt.Sprintf("%v = %d", net.IP(info.Mask), info.Length), info.Mask)
+	line("Wildcard", net.IP(info.Wildcard), info.Wildcard)
+	line("Network", info.Prefix, info.Network)
+	if info.Broadcast != nil {
+		line("Broadcast", info.Broadcast, info.Broadcast)
+	}
+	line("HostMin", info.First, info.First)
+	line("HostMax", info.Last, info.Last)
+	line("Addresses", info.Addresses, nil)
+	line("Hosts", info.Hosts, nil)
+	if len(subnets) > 0 {
+		fmt.Fprintf(w, "\nSubnets (%d):\n", len(subnets))
+		for _, s := range subnets {
+			fmt.Fprintf(w, "  %v\n", s)
+		}
+	}
+}
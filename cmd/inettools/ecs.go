@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/feed"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// runECS reads prefixes from files or stdin, queries a DNS server for a name on behalf of each with the EDNS Client
+// Subnet option, and writes the prefixes grouped by the answer they were given, showing how geo-DNS steers them.
+func runECS(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("ecs", "-server addr -name name [file ...]", stderr)
+	server := fs.String("server", "", "the `address` of the DNS server, a resolver that passes the option on or an "+
+		"authoritative server that accepts it")
+	name := fs.String("name", "", "the `name` to query")
+	qtypeFlag := fs.String("type", "A", "the record `type` to query, A or AAAA")
+	inputFormat := fs.String("input", string(feed.FormatAuto), fmt.Sprintf("input `format`, one of %v", feed.Formats))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *server == "" || *name == "" {
+		fmt.Fprintln(stderr, "-server and -name are required")
+		fs.Usage()
+		return errUsage
+	}
+	var qtype uint16
+	switch strings.ToUpper(*qtypeFlag) {
+	case "A":
+		qtype = dnsutil.TypeA
+	case "AAAA":
+		qtype = dnsutil.TypeAAAA
+	default:
+		fmt.Fprintf(stderr, "unsupported record type %q\n", *qtypeFlag)
+		fs.Usage()
+		return errUsage
+	}
+	var in input
+	var err error
+	if in.format, err = feed.ParseFormat(*inputFormat); err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+
+	var pfxs []*net.IPNet
+	if fs.NArg() == 0 {
+		if pfxs, _, err = readInput(stdin, "stdin", in); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		filePfxs, _, err := readInput(f, path, in)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		pfxs = append(pfxs, filePfxs...)
+	}
+
+	answers, err := dnsutil.NewClient(*server).MapSubnets(context.Background(), *name, qtype, pfxs)
+	if err != nil {
+		return err
+	}
+	scopes := map[string]string{}
+	for _, a := range answers {
+		scopes[a.Subnet.String()] = "no ecs in response"
+		if a.Scope != nil {
+			scopes[a.Subnet.String()] = fmt.Sprintf("scope /%d", a.Scope.ScopeLength)
+		}
+	}
+	for _, g := range dnsutil.GroupAnswers(answers) {
+		answer := strings.Join(g.Answers, " ")
+		switch {
+		case g.RCode != dnsutil.RCodeSuccess:
+			answer = dnsutil.RCodeString(g.RCode)
+		case answer == "":
+			answer = "no answer"
+		}
+		fmt.Fprintln(stdout, answer)
+		for _, subnet := range g.Subnets {
+			fmt.Fprintf(stdout, "  %v %s\n", subnet, scopes[subnet.String()])
+		}
+	}
+	return nil
+}
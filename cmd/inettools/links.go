@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/ipcalc"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+)
+
+// linkResult is the JSON form of a numbered link.
+type linkResult struct {
+	Index  int           `json:"index"`
+	Prefix string        `json:"prefix"`
+	A      linkEndResult `json:"a"`
+	B      linkEndResult `json:"b"`
+}
+
+// linkEndResult is the JSON form of one side of a link.
+type linkEndResult struct {
+	Device  string `json:"device"`
+	Address string `json:"address"`
+}
+
+// runLinks numbers point-to-point links between pairs of devices read from stdin, from each pool given.
+func runLinks(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("links", "pool ...", stderr)
+	length4 := fs.Int("length4", 31, "the `length` of the prefixes of IPv4 links, 30 or 31")
+	length6 := fs.Int("length6", 127, "the `length` of the prefixes of IPv6 links, 126 or 127")
+	asJSON := fs.Bool("json", false, "write JSON rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "pairs of devices are read from stdin, one pair to a line")
+		fs.Usage()
+		return errUsage
+	}
+	pairs, err := readPairs(stdin)
+	if err != nil {
+		return err
+	}
+
+	var links []ipcalc.Link
+	for _, arg := range fs.Args() {
+		_, pool, err := net.ParseCIDR(arg)
+		if err != nil {
+			return err
+		}
+		length := *length6
+		if pool.IP.To4() != nil {
+			length = *length4
+		}
+		poolLinks, err := ipcalc.Links(pool, length, pairs)
+		if err != nil {
+			return err
+		}
+		links = append(links, poolLinks...)
+	}
+
+	if *asJSON {
+		results := []linkResult{}
+		for _, l := range links {
+			results = append(results, linkResult{
+				Index:  l.Index,
+				Prefix: l.Prefix.String(),
+				A:      linkEndResult{Device: l.A.Device, Address: l.A.Addr.String()},
+				B:      linkEndResult{Device: l.B.Device, Address: l.B.Addr.String()},
+			})
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Link\tPrefix\tA\tA Address\tB\tB Address")
+	for _, l := range links {
+		fmt.Fprintf(tw, "%d\t%v\t%s\t%v\t%s\t%v\n", l.Index, l.Prefix, l.A.Device, l.A.Addr, l.B.Device, l.B.Addr)
+	}
+	return tw.Flush()
+}
+
+// readPairs reads pairs of device names, separated by spaces, commas, or a dash, ignoring blank lines and comments
+// starting with #.
+func readPairs(r io.Reader) ([][2]string, error) {
+	var pairs [][2]string
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(fields) == 1 {
+			fields = strings.Split(fields[0], "-")
+		}
+		switch len(fields) {
+		case 0:
+			continue
+		case 2:
+			pairs = append(pairs, [2]string{fields[0], fields[1]})
+		default:
+			return nil, fmt.Errorf("stdin:%d: want two devices, got %q", line, s.Text())
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("stdin: %w", err)
+	}
+	return pairs, nil
+}
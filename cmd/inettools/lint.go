@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/prefixlist"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// lintResult is the JSON form of a finding, with the file it was found in.
+type lintResult struct {
+	File string `json:"file"`
+	prefixlist.Finding
+}
+
+// runLint checks prefix files for problems, optionally fixing them, and fails if any problems remain.
+func runLint(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("lint", "[file ...]", stderr)
+	fix := fs.Bool("fix", false, "rewrite files in canonical form, or write stdin to stdout in canonical form")
+	asJSON := fs.Bool("json", false, "write findings as JSON rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	results := []lintResult{}
+	remaining := 0
+	check := func(name string, r io.Reader, w io.Writer) error {
+		var findings []prefixlist.Finding
+		var err error
+		if *fix {
+			findings, err = prefixlist.Canonicalize(r, w)
+		} else {
+			findings, err = prefixlist.Lint(r)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, f := range findings {
+			results = append(results, lintResult{File: name, Finding: f})
+			if !*fix || !f.Problem.Fixable() {
+				remaining++
+			}
+		}
+		return nil
+	}
+
+	if fs.NArg() == 0 {
+		if err := check("stdin", stdin, stdout); err != nil {
+			return err
+		}
+		// The canonical form of stdin has been written to stdout, so the findings go to stderr.
+		if *fix {
+			stdout = stderr
+		}
+	}
+	for _, path := range fs.Args() {
+		if err := lintFile(path, *fix, check); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			fmt.Fprintf(stdout, "%s:%d: %s: %s: %s\n", r.File, r.Line, r.Entry, r.Problem, r.Detail)
+		}
+	}
+	if remaining > 0 {
+		return fmt.Errorf("%d problems found", remaining)
+	}
+	return nil
+}
+
+// lintFile checks a file, replacing it with its canonical form if fix is set and it changed.
+func lintFile(path string, fix bool, check func(name string, r io.Reader, w io.Writer) error) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := check(path, bytes.NewReader(b), &out); err != nil {
+		return err
+	}
+	if !fix || bytes.Equal(b, out.Bytes()) {
+		return nil
+	}
+
+	// Write the canonical form alongside the file, and rename it into place, so the file is never left half written.
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
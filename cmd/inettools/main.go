@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errUsage is returned by commands given invalid arguments, once they have explained the problem.
+var errUsage = errors.New("usage")
+
+// command is a subcommand of inettools.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// commands lists the subcommands, in the order they are shown in the usage.
+var commands = []command{
+	{"aggregate", "aggregate a list of prefixes", runAggregate},
+	{"axfr", "transfer a DNS zone and aggregate the addresses it holds", runAXFR},
+	{"calc", "describe a prefix and plan its subnets", runCalc},
+	{"ecs", "show how a DNS server steers prefixes, using the EDNS Client Subnet option", runECS},
+	{"links", "number point-to-point links between pairs of devices", runLinks},
+	{"lint", "check prefix files for problems, and fix them", runLint},
+	{"passive", "estimate RTT, retransmissions and throughput of TCP flows in pcap files", runPassive},
+	{"path", "trace the path to a destination and measure each hop", runPath},
+	{"plan", "divide a prefix between named requirements, with room to grow", runPlan},
+	{"roas", "generate ROAs authorising announcements, and check existing ROAs for risks", runROAs},
+	{"rpsl", "write RPSL route objects registering the origin of prefixes in an IRR database", runRPSL},
+	{"sample", "choose representative addresses of a list of prefixes, such as probe targets", runSample},
+	{"sockets", "list sockets with their TCP statistics", runSockets},
+	{"tree", "show how a list of prefixes nests", runTree},
+	{"watch", "watch BGP updates for unexpected origins and more specifics of prefixes", runWatch},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the subcommand named by the first argument, and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(args[1:], stdin, stdout, stderr)
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp), errors.Is(err, errUsage):
+			return 2
+		}
+		fmt.Fprintf(stderr, "inettools %s: %v\n", cmd.name, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "inettools: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+// usage lists the subcommands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: inettools <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run inettools <command> -h for the flags of a command.")
+}
+
+// newFlagSet returns a flag set for a subcommand, which reports errors rather than exiting.
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: inettools %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
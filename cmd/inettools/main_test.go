@@ -0,0 +1,947 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/hijack"
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/dotwaffle/inettools/pcap"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "extra.txt")
+	if err := ioutil.WriteFile(file, []byte("198.51.100.0/24\n2001:db8:1::/48\n"), 0o644); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	excl := filepath.Join(dir, "exclude.txt")
+	if err := ioutil.WriteFile(excl, []byte("!198.51.100.128/25, !2001:db8:1:8000::/49\n"), 0o644); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	running := filepath.Join(dir, "running.txt")
+	config := "ip prefix-list PREFIXES seq 5 permit 10.0.0.0/8\nip prefix-list PREFIXES seq 10 permit 192.0.2.0/25\n"
+	if err := ioutil.WriteFile(running, []byte(config), 0o644); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	input := "# Customers\n192.0.2.0/25\n192.0.2.128/25 # second half\n\n2001:db8::1, 10.0.0.0/8\n10.1.2.0/28\n"
+	cache := filepath.Join(dir, "cache")
+
+	tests := map[string]struct {
+		args       []string
+		input      string
+		want       string
+		wantStatus int
+	}{
+		"Stdin": {
+			args:  []string{"aggregate"},
+			input: input,
+			want:  "10.0.0.0/8\n192.0.2.0/24\n2001:db8::1/128\n",
+		},
+		"Files": {
+			args: []string{"aggregate", "-6", file, file},
+			want: "2001:db8:1::/48\n",
+		},
+		"MaxLength": {
+			args:  []string{"aggregate", "-4", "-max-length4", "24", "-format", "json"},
+			input: "192.0.2.0/25\n192.0.2.128/25\n198.51.100.0/24\n",
+			want:  "[\n  \"198.51.100.0/24\"\n]\n",
+		},
+		"Junos": {
+			args:  []string{"aggregate", "-format", "junos", "-name", "BOGONS"},
+			input: "10.0.0.0/9\n10.128.0.0/9\n",
+			want:  "set policy-options prefix-list BOGONS 10.0.0.0/8\n",
+		},
+		"Exclusions": {
+			args: []string{"aggregate", file, excl},
+			want: "198.51.100.0/25\n2001:db8:1::/49\n",
+		},
+		"DiffIOS": {
+			args:  []string{"aggregate", "-format", "ios", "-diff", running},
+			input: input,
+			want: "ip prefix-list PREFIXES seq 15 permit 192.0.2.0/24\n" +
+				"ipv6 prefix-list PREFIXES seq 5 permit 2001:db8::1/128\n" +
+				"no ip prefix-list PREFIXES seq 10\n",
+		},
+		"DiffPrefixes": {
+			args:  []string{"aggregate", "-diff", file},
+			input: "198.51.100.0/25\n198.51.100.128/25\n2001:db8:2::/48\n",
+			want:  "+2001:db8:2::/48\n-2001:db8:1::/48\n",
+		},
+		"Cache": {
+			args:  []string{"aggregate", "-cache", cache},
+			input: input,
+			want:  "10.0.0.0/8\n192.0.2.0/24\n2001:db8::1/128\n",
+		},
+		"CacheAgain": {
+			args:  []string{"aggregate", "-cache", cache},
+			input: input,
+			want:  "10.0.0.0/8\n192.0.2.0/24\n2001:db8::1/128\n",
+		},
+		"CSV": {
+			args:  []string{"aggregate", "-column", "1"},
+			input: "name,prefix\na,192.0.2.0/25\nb,192.0.2.128/25\n",
+			want:  "192.0.2.0/24\n",
+		},
+		"JSON": {
+			args:  []string{"aggregate", "-field", "ip_prefix"},
+			input: `{"prefixes": [{"ip_prefix": "192.0.2.0/25"}, {"ip_prefix": "192.0.2.128/25"}]}`,
+			want:  "192.0.2.0/24\n",
+		},
+		"RPSL": {
+			args:  []string{"aggregate", "-input", "rpsl"},
+			input: "route: 192.0.2.0/25\norigin: AS64496\n\nroute: 192.0.2.128/25\norigin: AS64496\n",
+			want:  "192.0.2.0/24\n",
+		},
+		"BadInput": {
+			args:       []string{"aggregate", "-input", "xml"},
+			wantStatus: 2,
+		},
+		"Invalid": {
+			args:       []string{"aggregate"},
+			input:      "192.0.2.0/24\n192.0.2.300/32\n",
+			wantStatus: 1,
+		},
+		"BadFormat": {
+			args:       []string{"aggregate", "-format", "xml"},
+			wantStatus: 2,
+		},
+		"UnknownCommand": {
+			args:       []string{"frobnicate"},
+			wantStatus: 2,
+		},
+		"NoCommand": {
+			wantStatus: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.input), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+	if files, err := ioutil.ReadDir(cache); err != nil || len(files) != 1 {
+		t.Fatalf("got %d cached lists, err %v, want 1", len(files), err)
+	}
+}
+
+func TestCalc(t *testing.T) {
+	tests := map[string]struct {
+		args       []string
+		want       string
+		wantStatus int
+	}{
+		"Text": {
+			args: []string{"calc", "-split", "25", "192.0.2.10/24"},
+			want: "Address:   192.0.2.10           11000000.00000000.00000010.00001010\n" +
+				"Netmask:   255.255.255.0 = 24   11111111.11111111.11111111.00000000\n" +
+				"Wildcard:  0.0.0.255            00000000.00000000.00000000.11111111\n" +
+				"Network:   192.0.2.0/24         11000000.00000000.00000010.00000000\n" +
+				"Broadcast: 192.0.2.255          11000000.00000000.00000010.11111111\n" +
+				"HostMin:   192.0.2.1            11000000.00000000.00000010.00000001\n" +
+				"HostMax:   192.0.2.254          11000000.00000000.00000010.11111110\n" +
+				"Addresses: 256\n" +
+				"Hosts:     254\n" +
+				"\n" +
+				"Subnets (2):\n" +
+				"  192.0.2.0/25\n" +
+				"  192.0.2.128/25\n",
+		},
+		"JSON": {
+			args: []string{"calc", "-json", "2001:db8::/127"},
+			want: "[\n  {\n" +
+				"    \"address\": \"2001:db8::\",\n" +
+				"    \"prefix\": \"2001:db8::/127\",\n" +
+				"    \"netmask\": \"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe\",\n" +
+				"    \"wildcard\": \"::1\",\n" +
+				"    \"network\": \"2001:db8::\",\n" +
+				"    \"first\": \"2001:db8::\",\n" +
+				"    \"last\": \"2001:db8::1\",\n" +
+				"    \"addresses\": \"2\",\n" +
+				"    \"hosts\": \"2\"\n" +
+				"  }\n]\n",
+		},
+		"BadSplit": {
+			args:       []string{"calc", "-split", "8", "192.0.2.0/24"},
+			wantStatus: 1,
+		},
+		"NoPrefix": {
+			args:       []string{"calc"},
+			wantStatus: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(""), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestSockets(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sockets are only listed on Linux")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer conn.Close()
+	peer, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	defer peer.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	t.Run("Listening", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if status := run([]string{"sockets", "-listening", "-port", port}, nil, &stdout, &stderr); status != 0 {
+			t.Fatalf("status: got %d, want 0: %s", status, stderr.String())
+		}
+		// The backlog shown depends on net.core.somaxconn, so only the other columns are compared.
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("got %d lines, want a header and the listener: %s", len(lines), stdout.String())
+		}
+		fields := strings.Fields(lines[1])
+		got := append(fields[:2:2], fields[3:]...)
+		want := []string{"LISTEN", "0", ln.Addr().String(), "0.0.0.0:0", "-", "-", "-", "-"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if status := run([]string{"sockets", "-json", "-prefix", "127.0.0.0/8", "-port", port}, nil, &stdout,
+			&stderr); status != 0 {
+			t.Fatalf("status: got %d, want 0: %s", status, stderr.String())
+		}
+		var results []socketResult
+		if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+			t.Fatalf("unmarshal err: %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("got %d sockets, want both ends of the connection: %s", len(results), stdout.String())
+		}
+		for _, r := range results {
+			if r.Protocol != "tcp" || r.State != "ESTAB" || r.Cwnd == 0 || r.RTT == 0 {
+				t.Fatalf("unexpected socket %+v", r)
+			}
+		}
+	})
+
+	t.Run("Exclusive", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if status := run([]string{"sockets", "-listening", "-all"}, nil, &stdout, &stderr); status != 2 {
+			t.Fatalf("status: got %d, want 2", status)
+		}
+	})
+}
+
+func TestPath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("paths are only probed on Linux")
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		result := runPathJSON(t, "-count", "2", "-interval", "10ms", "-timeout", "200ms", "127.0.0.1")
+		want := []string{"127.0.0.1"}
+		if !result.Reached || result.Rounds != 2 || len(result.Hops) != 1 || result.Hops[0].Received != 2 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+		if diff := cmp.Diff(want, result.Hops[0].Hosts); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("SocketOptions", func(t *testing.T) {
+		result := runPathJSON(t, "-count", "1", "-timeout", "200ms", "-tos", "32", "-device", "lo", "127.0.0.1")
+		if !result.Reached || len(result.Hops) != 1 || result.Hops[0].Received != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	})
+
+	t.Run("Source", func(t *testing.T) {
+		result := runPathJSON(t, "-count", "1", "-timeout", "200ms", "-source", "127.0.0.1", "127.0.0.1")
+		if !result.Reached || len(result.Hops) != 1 || result.Hops[0].Received != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	})
+
+	t.Run("Annotated", func(t *testing.T) {
+		ixps := filepath.Join(t.TempDir(), "ixps.txt")
+		if err := ioutil.WriteFile(ixps, []byte("# Loopback.\n127.0.0.0/8 Loop IX\n"), 0o644); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+		result := runPathJSON(t, "-count", "1", "-timeout", "200ms", "-n", "-ixps", ixps, "127.0.0.1")
+		if len(result.Hops) != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+		want := []hostAnnotation{{Bogon: true, IXP: "Loop IX"}}
+		if diff := cmp.Diff(want, result.Hops[0].Annotations); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"path"}, {"path", "-4", "-6", "localhost"}, {"path", "a", "b"}, {"path", "-tos", "256", "localhost"},
+			{"path", "-source", "bogus", "localhost"},
+		} {
+			var stdout, stderr bytes.Buffer
+			if status := run(args, nil, &stdout, &stderr); status != 2 {
+				t.Fatalf("%v: status: got %d, want 2", args, status)
+			}
+		}
+	})
+}
+
+// runPathJSON runs the path command with JSON output and the given arguments, skipping the test if probing is not
+// permitted.
+func runPathJSON(t *testing.T, args ...string) pathResult {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	status := run(append([]string{"path", "-json"}, args...), nil, &stdout, &stderr)
+	if status == 1 && strings.Contains(stderr.String(), "operation not permitted") {
+		t.Skip("raw ICMP sockets require CAP_NET_RAW")
+	}
+	if status != 0 {
+		t.Fatalf("status: got %d, want 0: %s", status, stderr.String())
+	}
+	var result pathResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal err: %v", err)
+	}
+	return result
+}
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "prefixes.txt")
+	input := "10.1.2.3/8 # host bits\n2001:DB8::/32\n10.0.0.0/8\n"
+	if err := ioutil.WriteFile(file, []byte(input), 0o600); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+
+	tests := map[string]struct {
+		args       []string
+		input      string
+		want       string
+		wantFile   string
+		wantStatus int
+	}{
+		"Lint": {
+			args: []string{"lint", file},
+			want: file + ":1: 10.1.2.3/8: host-bits: host bits set, the prefix is 10.0.0.0/8\n" +
+				file + ":2: 2001:DB8::/32: mixed-case: upper case in IPv6 address\n" +
+				file + ":3: 10.0.0.0/8: duplicate: duplicate of 10.0.0.0/8 on line 1\n",
+			wantFile:   input,
+			wantStatus: 1,
+		},
+		"Stdin": {
+			args:  []string{"lint", "-fix"},
+			input: "192.0.2.1\n0.0.0.0/0\n",
+			want:  "192.0.2.1/32\n0.0.0.0/0\n",
+			// The default route cannot be fixed.
+			wantFile:   input,
+			wantStatus: 1,
+		},
+		"Fix": {
+			args: []string{"lint", "-fix", file},
+			want: file + ":1: 10.1.2.3/8: host-bits: host bits set, the prefix is 10.0.0.0/8\n" +
+				file + ":2: 2001:DB8::/32: mixed-case: upper case in IPv6 address\n" +
+				file + ":3: 10.0.0.0/8: duplicate: duplicate of 10.0.0.0/8 on line 1\n",
+			wantFile: "10.0.0.0/8 # host bits\n2001:db8::/32\n",
+		},
+		"Clean": {
+			args:     []string{"lint", "-json", file},
+			want:     "[]\n",
+			wantFile: "10.0.0.0/8 # host bits\n2001:db8::/32\n",
+		},
+	}
+
+	// The subtests run in order, as fixing the file changes it for those that follow.
+	for _, name := range []string{"Lint", "Stdin", "Fix", "Clean"} {
+		test := tests[name]
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.input), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatalf("read err: %v", err)
+			}
+			if diff := cmp.Diff(test.wantFile, string(b)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+	tests := map[string]struct {
+		args       []string
+		input      string
+		want       string
+		wantStatus int
+	}{
+		"PerBlock": {
+			args:  []string{"sample"},
+			input: "192.0.2.0/23\n2001:db8::/48\n",
+			want:  "192.0.2.1\n192.0.3.1\n2001:db8::1\n",
+		},
+		"Max": {
+			args:  []string{"sample", "-4", "16", "-per-block", "2", "-max", "4"},
+			input: "10.0.0.0/14\n",
+			want:  "10.0.0.1\n10.0.0.2\n10.2.0.1\n10.2.0.2\n",
+		},
+		"BadLength": {
+			args:       []string{"sample", "-4", "33"},
+			wantStatus: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.input), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	tests := map[string]struct {
+		args       []string
+		input      string
+		want       string
+		wantStatus int
+	}{
+		"Text": {
+			args:  []string{"tree"},
+			input: "10.1.0.0/16\n10.0.0.0/8\n10.1.2.0/24\n192.0.2.0/24\n",
+			want: "10.0.0.0/8 (1 subnet, 0.39% covered)\n  10.1.0.0/16 (1 subnet, 0.39% covered)\n" +
+				"    10.1.2.0/24\n192.0.2.0/24\n",
+		},
+		"Aggregate": {
+			args:  []string{"tree", "-aggregate", "-format", "dot"},
+			input: "192.0.2.0/25\n192.0.2.128/25\n",
+			want: "digraph prefixes {\n\trankdir=LR;\n\tnode [shape=box];\n\t\"192.0.2.0/24\";\n" +
+				"\t\"192.0.2.0/24\" -> \"192.0.2.0/25\";\n\t\"192.0.2.0/24\" -> \"192.0.2.128/25\";\n" +
+				"\t\"192.0.2.0/25\";\n\t\"192.0.2.128/25\";\n}\n",
+		},
+		"BadFormat": {
+			args:       []string{"tree", "-format", "svg"},
+			wantStatus: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.input), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tests := map[string]struct {
+		args       []string
+		want       string
+		wantStatus int
+	}{
+		"Text": {
+			args: []string{"plan", "-growth", "0", "192.0.2.0/24", "lan:/26 x2, p2p:/31 x3"},
+			want: "Name    Block           Count    First           Last\n" +
+				"lan     192.0.2.0/25    2 x /26  192.0.2.0/26    192.0.2.64/26\n" +
+				"p2p     192.0.2.128/29  3 x /31  192.0.2.128/31  192.0.2.132/31\n" +
+				"(free)  192.0.2.136/29\n" +
+				"(free)  192.0.2.144/28\n" +
+				"(free)  192.0.2.160/27\n" +
+				"(free)  192.0.2.192/26\n",
+		},
+		"NoRequirements": {
+			args:       []string{"plan", "192.0.2.0/24"},
+			wantStatus: 2,
+		},
+		"TooLarge": {
+			args:       []string{"plan", "192.0.2.0/24", "lan:/24 x2"},
+			wantStatus: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(""), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestLinks(t *testing.T) {
+	tests := map[string]struct {
+		args       []string
+		input      string
+		want       string
+		wantStatus int
+	}{
+		"Text": {
+			args:  []string{"links", "-length4", "30", "192.0.2.0/24", "2001:db8::/64"},
+			input: "core1 core2\n# spine\ncore1-edge1\n",
+			want: "Link  Prefix           A      A Address    B      B Address\n" +
+				"1     192.0.2.0/30     core1  192.0.2.1    core2  192.0.2.2\n" +
+				"2     192.0.2.4/30     core1  192.0.2.5    edge1  192.0.2.6\n" +
+				"1     2001:db8::/127   core1  2001:db8::   core2  2001:db8::1\n" +
+				"2     2001:db8::2/127  core1  2001:db8::2  edge1  2001:db8::3\n",
+		},
+		"JSON": {
+			args:  []string{"links", "-json", "192.0.2.0/31"},
+			input: "a,b\n",
+			want: "[\n  {\n    \"index\": 1,\n    \"prefix\": \"192.0.2.0/31\",\n" +
+				"    \"a\": {\n      \"device\": \"a\",\n      \"address\": \"192.0.2.0\"\n    },\n" +
+				"    \"b\": {\n      \"device\": \"b\",\n      \"address\": \"192.0.2.1\"\n    }\n  }\n]\n",
+		},
+		"BadPair": {
+			args:       []string{"links", "192.0.2.0/24"},
+			input:      "a b c\n",
+			wantStatus: 1,
+		},
+		"NoPool": {
+			args:       []string{"links"},
+			wantStatus: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.input), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestPassive(t *testing.T) {
+	// A handshake between 192.0.2.1:40000 and 198.51.100.1:80, ten milliseconds apart, without a link-layer header.
+	client, server := net.IPv4(192, 0, 2, 1), net.IPv4(198, 51, 100, 1)
+	var capture bytes.Buffer
+	w, err := pcap.NewWriter(&capture, pcap.LinkTypeRaw, 0)
+	if err != nil {
+		t.Fatalf("writer err: %v", err)
+	}
+	start := time.Unix(1600000000, 0)
+	for i, f := range []packet.TCPFields{
+		{SrcPort: 40000, DstPort: 80, Seq: 1, Flags: packet.TCPFlagSYN},
+		{SrcPort: 80, DstPort: 40000, Seq: 100, Ack: 2, Flags: packet.TCPFlagSYN | packet.TCPFlagACK},
+		{SrcPort: 40000, DstPort: 80, Seq: 2, Ack: 101, Flags: packet.TCPFlagACK},
+	} {
+		src, dst := client, server
+		if f.SrcPort == 80 {
+			src, dst = server, client
+		}
+		b := make([]byte, packet.IPv4MinLen+packet.TCPMinLen)
+		if err := packet.TCP(b[packet.IPv4MinLen:]).Encode(&f, src, dst); err != nil {
+			t.Fatalf("tcp encode err: %v", err)
+		}
+		ip := &packet.IPv4Fields{TTL: 64, Protocol: packet.ProtocolTCP, Src: src, Dst: dst}
+		if err := packet.IPv4(b).Encode(ip); err != nil {
+			t.Fatalf("ipv4 encode err: %v", err)
+		}
+		at := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		if err := w.WritePacket(&pcap.Packet{Timestamp: at, Data: b}); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+	}
+
+	tests := map[string]struct {
+		args       []string
+		input      string
+		want       string
+		wantStatus int
+	}{
+		"Text": {
+			args:  []string{"passive"},
+			input: capture.String(),
+			want: "Client           Server           Packets  Retrans  Handshake  RTT                Throughput\n" +
+				"192.0.2.1:40000  198.51.100.1:80  2/1      0/0      20.000ms   10.000ms/10.000ms  0bps/0bps\n",
+		},
+		"NotPcap": {
+			args:       []string{"passive"},
+			input:      "not a capture",
+			wantStatus: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.input), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("parse err: %v", err)
+		}
+		return n
+	}
+
+	t.Run("Parse", func(t *testing.T) {
+		tests := map[string]struct {
+			arg     string
+			want    hijack.Watch
+			wantErr bool
+		}{
+			"Prefix": {arg: "192.0.2.0/24", want: hijack.Watch{Prefix: cidr("192.0.2.0/24")}},
+			"Origins": {arg: "2001:db8::/32=AS64496,64497", want: hijack.Watch{Prefix: cidr("2001:db8::/32"),
+				Origins: []uint32{64496, 64497}}},
+			"MaxLength": {arg: "192.0.2.0/23^24=64496", want: hijack.Watch{Prefix: cidr("192.0.2.0/23"),
+				Origins: []uint32{64496}, MaxLength: 24}},
+			"BadPrefix": {arg: "192.0.2.0=64496", wantErr: true},
+			"BadASN":    {arg: "192.0.2.0/24=ASX", wantErr: true},
+			"BadLength": {arg: "192.0.2.0/24^x", wantErr: true},
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				got, err := parseWatch(tc.arg)
+				if (err != nil) != tc.wantErr {
+					t.Fatalf("got err %v", err)
+				}
+				if diff := cmp.Diff(tc.want, got); !tc.wantErr && diff != "" {
+					t.Fatalf("%v", diff)
+				}
+			})
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"watch"}, {"watch", "bogus"}, {"watch", "192.0.2.0/24^16"},
+		} {
+			var stdout, stderr bytes.Buffer
+			if status := run(args, nil, &stdout, &stderr); status != 2 {
+				t.Fatalf("%v: status: got %d, want 2", args, status)
+			}
+		}
+	})
+}
+
+func TestROAs(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "roas.csv")
+	err := ioutil.WriteFile(existing, []byte("ASN,IP Prefix,Max Length,Trust Anchor\n"+
+		"AS64496,198.51.100.0/22,24,ripe\nAS64496,2001:db8::/32,32,ripe\n"), 0o644)
+	if err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	announced := "198.51.100.0/23 AS64496\n198.51.100.0/24 64496 # a comment\n198.51.101.0/24 AS64496\n\n" +
+		"2001:db8::/32 AS64496\n2001:db8:1::/48 AS64497\n"
+
+	tests := map[string]struct {
+		args       []string
+		stdin      string
+		want       string
+		wantStatus int
+	}{
+		"Generate": {
+			args:  []string{"roas"},
+			stdin: announced,
+			want: "ASN,IP Prefix,Max Length,Trust Anchor\n" +
+				"AS64496,198.51.100.0/23,24,\n" +
+				"AS64496,2001:db8::/32,32,\n" +
+				"AS64497,2001:db8:1::/48,48,\n",
+		},
+		"Existing": {
+			args:  []string{"roas", "-existing", existing},
+			stdin: announced,
+			want: "risk unannounced-more-specifics: AS64496 198.51.100.0/22-24 authorises 4 unannounced prefixes\n" +
+				"risk invalid-announcement: 2001:db8:1::/48 from AS64497\n" +
+				"add AS64496,198.51.100.0/23,24\n" +
+				"add AS64497,2001:db8:1::/48,48\n" +
+				"remove AS64496,198.51.100.0/22,24\n",
+		},
+		"BIRD": {
+			args: []string{"roas", "-bird", "-asn", "64496"},
+			stdin: "Table master4:\n" +
+				"192.0.2.0/24         unicast [ibgp1 2021-01-01] * (100) [i]\n" +
+				"\tType: BGP univ\n" +
+				"\tBGP.origin: IGP\n" +
+				"\tBGP.as_path: \n" +
+				"198.51.100.0/24      unicast [peer1 2021-01-01] * (100) [AS64497i]\n" +
+				"\tvia 192.0.2.1 on eth0\n" +
+				"\tType: BGP univ\n" +
+				"\tBGP.origin: IGP\n" +
+				"\tBGP.as_path: 64500 64497\n",
+			want: "ASN,IP Prefix,Max Length,Trust Anchor\n" +
+				"AS64496,192.0.2.0/24,24,\n" +
+				"AS64497,198.51.100.0/24,24,\n",
+		},
+		"BadLine": {
+			args:       []string{"roas"},
+			stdin:      "192.0.2.0/24\n",
+			wantStatus: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestRPSL(t *testing.T) {
+	tests := map[string]struct {
+		args       []string
+		want       string
+		wantStatus int
+	}{
+		"Routes": {
+			args: []string{"rpsl", "-origin", "AS64496", "-mnt-by", "MAINT-A, MAINT-B", "-source", "radb",
+				"-descr", "Example"},
+			want: "route:          192.0.2.0/24\ndescr:          Example\norigin:         AS64496\n" +
+				"mnt-by:         MAINT-A\nmnt-by:         MAINT-B\nsource:         RADB\n\n" +
+				"route6:         2001:db8::/32\ndescr:          Example\norigin:         AS64496\n" +
+				"mnt-by:         MAINT-A\nmnt-by:         MAINT-B\nsource:         RADB\n",
+		},
+		"ASSet": {
+			args: []string{"rpsl", "-origin", "64496", "-mnt-by", "MAINT-A", "-source", "RADB", "-as-set", "AS-EXAMPLE",
+				"-members", "AS64497,AS-CUSTOMERS", "-contact", "EX1-RADB"},
+			want: "route:          192.0.2.0/24\norigin:         AS64496\nmnt-by:         MAINT-A\nsource:         RADB\n\n" +
+				"route6:         2001:db8::/32\norigin:         AS64496\nmnt-by:         MAINT-A\nsource:         RADB\n\n" +
+				"as-set:         AS-EXAMPLE\nmembers:        AS64496\nmembers:        AS64497\n" +
+				"members:        AS-CUSTOMERS\nadmin-c:        EX1-RADB\ntech-c:         EX1-RADB\n" +
+				"mnt-by:         MAINT-A\nsource:         RADB\n",
+		},
+		"NoOrigin": {
+			args:       []string{"rpsl", "-mnt-by", "MAINT-A", "-source", "RADB"},
+			wantStatus: 2,
+		},
+		"InvalidASSet": {
+			args:       []string{"rpsl", "-origin", "64496", "-mnt-by", "MAINT-A", "-source", "RADB", "-as-set", "X"},
+			wantStatus: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader("192.0.2.0/24\n2001:db8::/32\n"), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestECS(t *testing.T) {
+	// A server steering 192.0.2.0/24 to one address and everything else to another.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q, err := dnsutil.Unpack(buf[:n])
+			if err != nil {
+				continue
+			}
+			resp := &dnsutil.Message{ID: q.ID, Response: true, Questions: q.Questions,
+				EDNS: &dnsutil.EDNS{UDPSize: dnsutil.DefaultUDPSize}}
+			cs, _ := dnsutil.ParseClientSubnet(q.EDNS.Option(dnsutil.OptionClientSubnet))
+			ip, scope := net.IP{203, 0, 113, 2}, uint8(0)
+			if cs.Prefix.IP.Equal(net.IP{192, 0, 2, 0}) {
+				ip, scope = net.IP{203, 0, 113, 1}, 24
+			}
+			cs.ScopeLength = scope
+			opt, _ := cs.Option()
+			resp.EDNS.Options = []dnsutil.EDNSOption{opt}
+			resp.Answers = []dnsutil.RR{{Name: q.Questions[0].Name, Type: dnsutil.TypeA, Class: dnsutil.ClassINET,
+				TTL: 60, Data: &dnsutil.A{IP: ip}}}
+			b, _ := resp.Pack()
+			conn.WriteTo(b, addr)
+		}
+	}()
+
+	tests := map[string]struct {
+		args       []string
+		want       string
+		wantStatus int
+	}{
+		"Steering": {
+			args: []string{"ecs", "-server", conn.LocalAddr().String(), "-name", "cdn.example"},
+			want: "203.0.113.2\n  198.51.100.0/24 scope /0\n  2001:db8::/32 scope /0\n" +
+				"203.0.113.1\n  192.0.2.0/24 scope /24\n",
+		},
+		"NoName": {
+			args:       []string{"ecs", "-server", conn.LocalAddr().String()},
+			wantStatus: 2,
+		},
+		"Type": {
+			args:       []string{"ecs", "-server", conn.LocalAddr().String(), "-name", "cdn.example", "-type", "MX"},
+			wantStatus: 2,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader("192.0.2.0/24\n198.51.100.0/24\n2001:db8::/32\n"), &stdout,
+				&stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestAXFR(t *testing.T) {
+	// A server transferring a zone in one message.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b, err := dnsutil.ReadTCP(conn)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			q, _ := dnsutil.Unpack(b)
+			resp := &dnsutil.Message{ID: q.ID, Response: true, Questions: q.Questions}
+			soa := dnsutil.RR{Name: "example.", Type: dnsutil.TypeSOA, Class: dnsutil.ClassINET, TTL: 3600,
+				Data: &dnsutil.SOA{MName: "ns1.example.", RName: "hostmaster.example.", Serial: 1}}
+			resp.Answers = []dnsutil.RR{soa}
+			for _, ip := range []string{"192.0.2.2", "192.0.2.3", "2001:db8::1"} {
+				rr := dnsutil.RR{Name: "host.example.", Class: dnsutil.ClassINET, TTL: 60}
+				if v4 := net.ParseIP(ip).To4(); v4 != nil {
+					rr.Type, rr.Data = dnsutil.TypeA, &dnsutil.A{IP: v4}
+				} else {
+					rr.Type, rr.Data = dnsutil.TypeAAAA, &dnsutil.AAAA{IP: net.ParseIP(ip)}
+				}
+				resp.Answers = append(resp.Answers, rr)
+			}
+			resp.Answers = append(resp.Answers, soa)
+			if b, err := resp.Pack(); err == nil {
+				dnsutil.WriteTCP(conn, b)
+			}
+			conn.Close()
+		}
+	}()
+
+	tests := map[string]struct {
+		args       []string
+		want       string
+		wantStatus int
+	}{
+		"Zone": {
+			args: []string{"axfr", "-server", ln.Addr().String(), "-zone", "example"},
+			want: "192.0.2.2/31\n2001:db8::1/128\n",
+		},
+		"NoZone": {
+			args:       []string{"axfr", "-server", ln.Addr().String()},
+			wantStatus: 2,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(""), &stdout, &stderr)
+			if status != test.wantStatus {
+				t.Fatalf("status: got %d, want %d: %s", status, test.wantStatus, stderr.String())
+			}
+			if diff := cmp.Diff(test.want, stdout.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/passive"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// flowResult is the JSON form of a flow.
+type flowResult struct {
+	Client       string          `json:"client"`
+	Server       string          `json:"server"`
+	Start        time.Time       `json:"start"`
+	Duration     float64         `json:"duration_ms"`
+	HandshakeRTT float64         `json:"handshake_rtt_ms,omitempty"`
+	Forward      directionResult `json:"forward"`
+	Reverse      directionResult `json:"reverse"`
+	Closed       bool            `json:"closed"`
+}
+
+// directionResult is the JSON form of the traffic in one direction of a flow.
+type directionResult struct {
+	Packets     int     `json:"packets"`
+	Bytes       int64   `json:"bytes"`
+	Retransmits int     `json:"retransmits"`
+	RTTSamples  int     `json:"rtt_samples"`
+	MinRTT      float64 `json:"min_rtt_ms,omitempty"`
+	MeanRTT     float64 `json:"mean_rtt_ms,omitempty"`
+	MaxRTT      float64 `json:"max_rtt_ms,omitempty"`
+	Throughput  float64 `json:"throughput_bps"`
+}
+
+// runPassive estimates the RTT, retransmissions, and throughput of the TCP flows in pcap files.
+func runPassive(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("passive", "[file.pcap...]", stderr)
+	asJSON := fs.Bool("json", false, "write JSON rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var flows []*passive.Flow
+	if fs.NArg() == 0 {
+		var err error
+		if flows, err = passive.ReadPcap(stdin); err != nil {
+			return fmt.Errorf("stdin: %w", err)
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		fileFlows, err := passive.ReadPcap(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		flows = append(flows, fileFlows...)
+	}
+
+	if *asJSON {
+		results := make([]flowResult, 0, len(flows))
+		for _, f := range flows {
+			fwd, rev := f.Throughput()
+			results = append(results, flowResult{
+				Client:       f.Client.String(),
+				Server:       f.Server.String(),
+				Start:        f.Start.UTC(),
+				Duration:     millis(f.Duration()),
+				HandshakeRTT: millis(f.HandshakeRTT),
+				Forward:      newDirectionResult(&f.Forward, fwd),
+				Reverse:      newDirectionResult(&f.Reverse, rev),
+				Closed:       f.Closed,
+			})
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	// Each pair of figures is for the forward direction, then the reverse.
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Client\tServer\tPackets\tRetrans\tHandshake\tRTT\tThroughput")
+	for _, f := range flows {
+		handshake := "-"
+		if f.HandshakeRTT > 0 {
+			handshake = fmt.Sprintf("%.3fms", millis(f.HandshakeRTT))
+		}
+		fwd, rev := f.Throughput()
+		fmt.Fprintf(tw, "%v\t%v\t%d/%d\t%d/%d\t%s\t%s/%s\t%s/%s\n", f.Client, f.Server,
+			f.Forward.Packets, f.Reverse.Packets, f.Forward.Retransmits, f.Reverse.Retransmits, handshake,
+			formatRTT(&f.Forward), formatRTT(&f.Reverse), formatRate(fwd), formatRate(rev))
+	}
+	return tw.Flush()
+}
+
+// newDirectionResult converts the traffic in one direction of a flow to its JSON form.
+func newDirectionResult(d *passive.Direction, throughput float64) directionResult {
+	return directionResult{
+		Packets:     d.Packets,
+		Bytes:       d.Bytes,
+		Retransmits: d.Retransmits,
+		RTTSamples:  d.RTTSamples,
+		MinRTT:      millis(d.MinRTT),
+		MeanRTT:     millis(d.MeanRTT()),
+		MaxRTT:      millis(d.MaxRTT),
+		Throughput:  throughput,
+	}
+}
+
+// formatRTT formats the mean RTT of a direction, or - if it has no samples.
+func formatRTT(d *passive.Direction) string {
+	if d.RTTSamples == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.3fms", millis(d.MeanRTT()))
+}
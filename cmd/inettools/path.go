@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/flow"
+	"github.com/dotwaffle/inettools/mmdb"
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/dotwaffle/inettools/sockopt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// pathResult is the JSON form of a path report.
+type pathResult struct {
+	Destination string      `json:"destination"`
+	Rounds      int         `json:"rounds"`
+	Reached     bool        `json:"reached"`
+	Hops        []hopResult `json:"hops"`
+}
+
+// hopResult is the JSON form of the statistics of a hop.
+type hopResult struct {
+	TTL      int      `json:"ttl"`
+	Hosts    []string `json:"hosts"`
+	Sent     int      `json:"sent"`
+	Received int      `json:"received"`
+	Loss     float64  `json:"loss_percent"`
+	Last     float64  `json:"last_ms"`
+	Mean     float64  `json:"avg_ms"`
+	Best     float64  `json:"best_ms"`
+	Worst    float64  `json:"worst_ms"`
+	StdDev   float64  `json:"stddev_ms"`
+	Error    string   `json:"error,omitempty"`
+	MPLS     []uint32 `json:"mpls,omitempty"`
+	// Annotations describe Hosts, in the same order, if the path was annotated.
+	Annotations []hostAnnotation `json:"annotations,omitempty"`
+}
+
+// hostAnnotation is the JSON form of the annotation of a host.
+type hostAnnotation struct {
+	Name    string `json:"name,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	ASN     uint32 `json:"asn,omitempty"`
+	Country string `json:"country,omitempty"`
+	Bogon   bool   `json:"bogon,omitempty"`
+	IXP     string `json:"ixp,omitempty"`
+}
+
+// runPath traces the path to a destination repeatedly, in the manner of mtr, and reports the loss and latency of each
+// hop.
+func runPath(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("path", "destination", stderr)
+	only4 := fs.Bool("4", false, "use IPv4")
+	only6 := fs.Bool("6", false, "use IPv6")
+	count := fs.Int("count", pathprobe.DefaultCount, "the number of `rounds`, or 0 to continue until interrupted")
+	interval := fs.Duration("interval", pathprobe.DefaultInterval, "the `time` between rounds")
+	timeout := fs.Duration("timeout", pathprobe.DefaultTimeout, "how long to wait for an answer")
+	maxHops := fs.Int("max-hops", pathprobe.DefaultMaxHops, "the largest `TTL` probed")
+	size := fs.Int("size", pathprobe.DefaultSize, "the `size` of each probe's ICMP message")
+	source := fs.String("source", "", "the `address` to send the probes from")
+	mark := fs.Uint("mark", 0, "the firewall `mark` of the probes, to select a routing table")
+	tos := fs.Uint("tos", 0, "the traffic `class` of the probes")
+	device := fs.String("device", "", "the `interface` or VRF device to send the probes through")
+	annotate := fs.Bool("annotate", false, "show the name, origin AS, and bogon or exchange status of each host")
+	noNames := fs.Bool("n", false, "do not look up the names of hosts when annotating")
+	routesFile := fs.String("routes", "", "annotate with the origin ASes of the routes in `file`, the output of BIRD's "+
+		"\"show route all\"")
+	ixpsFile := fs.String("ixps", "", "annotate with the exchanges in `file`, of lines holding a peering LAN prefix "+
+		"and the name of its exchange")
+	mmdbFiles := fs.String("mmdb", "", "annotate with the origin ASes and countries in the MaxMind DB `files`, "+
+		"separated by commas")
+	live := fs.Bool("live", false, "redraw the report after every round")
+	asJSON := fs.Bool("json", false, "write JSON rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	if *only4 && *only6 {
+		fmt.Fprintln(stderr, "-4 and -6 are mutually exclusive")
+		return errUsage
+	}
+	if *mark > math.MaxUint32 || *tos > math.MaxUint8 {
+		fmt.Fprintln(stderr, "-mark or -tos out of range")
+		return errUsage
+	}
+	var src net.IP
+	if *source != "" {
+		if src = net.ParseIP(*source); src == nil {
+			fmt.Fprintf(stderr, "invalid source address %q\n", *source)
+			return errUsage
+		}
+	}
+
+	// Interrupting the probe ends it early, still reporting what was gathered.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	dst, err := resolve(ctx, fs.Arg(0), *only4, *only6)
+	if err != nil {
+		return err
+	}
+
+	var a *pathprobe.Annotator
+	if *annotate || *routesFile != "" || *ixpsFile != "" || *mmdbFiles != "" {
+		if a, err = newAnnotator(*routesFile, *ixpsFile, *mmdbFiles); err != nil {
+			return err
+		}
+		a.SkipNames = *noNames
+	}
+
+	p := &pathprobe.Prober{MaxHops: *maxHops, Count: *count, Interval: *interval, Timeout: *timeout, Size: *size}
+	p.Source, p.Socket = src, sockopt.Options{Mark: uint32(*mark), TOS: uint8(*tos), Device: *device}
+	if *count == 0 {
+		p.Count = math.MaxInt32
+	}
+	if *live && !*asJSON {
+		p.Progress = func(r *pathprobe.Report) {
+			if a != nil {
+				a.Annotate(ctx, r)
+			}
+			// Clear the terminal, and draw the report from the top.
+			fmt.Fprint(stdout, "\x1b[H\x1b[2J")
+			writePath(stdout, fs.Arg(0), r)
+		}
+	}
+	report, err := p.Run(ctx, dst)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	if a != nil {
+		a.Annotate(ctx, report)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newPathResult(report))
+	}
+	if !*live {
+		return writePath(stdout, fs.Arg(0), report)
+	}
+	return nil
+}
+
+// resolve returns the address of a host, optionally restricted to one family.
+func resolve(ctx context.Context, host string, only4, only6 bool) (net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		v4 := addr.IP.To4() != nil
+		if (!only4 || v4) && (!only6 || !v4) {
+			return addr.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("no suitable address for %s", host)
+}
+
+// newAnnotator returns an annotator using the routes, exchanges and MaxMind DBs in files, where they are given. The
+// routes take precedence over the databases.
+func newAnnotator(routesFile, ixpsFile, mmdbFiles string) (*pathprobe.Annotator, error) {
+	routes := flow.NewEnricher()
+	if routesFile != "" {
+		f, err := os.Open(routesFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		rs, err := bgp.ParseBIRD(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", routesFile, err)
+		}
+		for i := range rs {
+			if rs[i].Primary {
+				if err := routes.AddRoute(rs[i].Prefix, rs[i].OriginAS()); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if mmdbFiles != "" {
+		for _, path := range strings.Split(mmdbFiles, ",") {
+			db, err := mmdb.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			routes.AddMMDB(db)
+		}
+	}
+	a := pathprobe.NewAnnotator(routes)
+	if ixpsFile == "" {
+		return a, nil
+	}
+	f, err := os.Open(ixpsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		_, pfx, err := net.ParseCIDR(fields[0])
+		if err != nil || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want a prefix and an exchange name", ixpsFile, n)
+		}
+		if err := a.AddIXP(pfx, strings.Join(fields[1:], " ")); err != nil {
+			return nil, err
+		}
+	}
+	return a, s.Err()
+}
+
+// hostName describes an address that answered probes, with its annotation if it has one.
+func hostName(addr net.IP, a *pathprobe.Annotation) string {
+	if a == nil {
+		return addr.String()
+	}
+	host := addr.String()
+	if a.Name != "" {
+		host = fmt.Sprintf("%s (%v)", a.Name, addr)
+	}
+	if a.ASN != 0 {
+		host += fmt.Sprintf(" [AS%d]", a.ASN)
+	}
+	if a.Country != "" {
+		host += fmt.Sprintf(" [%s]", a.Country)
+	}
+	if a.IXP != "" {
+		host += fmt.Sprintf(" [IX: %s]", a.IXP)
+	}
+	if a.Bogon {
+		host += " [bogon]"
+	}
+	return host
+}
+
+// writePath writes a path report as a table.
+func writePath(w io.Writer, name string, r *pathprobe.Report) error {
+	fmt.Fprintf(w, "Path to %s (%v), %d rounds\n", name, r.Destination, r.Rounds)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Hop\tHost\tLoss%\tSnt\tLast\tAvg\tBest\tWrst\tStDev")
+	for i := range r.Hops {
+		hop := &r.Hops[i]
+		host := "???"
+		if len(hop.Addrs) > 0 {
+			hosts := make([]string, 0, len(hop.Addrs))
+			for j, addr := range hop.Addrs {
+				var a *pathprobe.Annotation
+				if j < len(hop.Annotations) {
+					a = &hop.Annotations[j]
+				}
+				hosts = append(hosts, hostName(addr, a))
+			}
+			host = strings.Join(hosts, " ")
+		}
+		for _, label := range hop.MPLS {
+			lbl := strconv.FormatUint(uint64(label.Label), 10)
+			if label.Label <= packet.MaxReservedLabel {
+				lbl += " (" + packet.LabelName(label.Label) + ")"
+			}
+			host += fmt.Sprintf(" [MPLS: Lbl %s TC %d S %t TTL %d]", lbl, label.TC, label.BottomOfStack, label.TTL)
+		}
+		if hop.Err != nil {
+			host += fmt.Sprintf(" (%v)", hop.Err)
+		}
+		fmt.Fprintf(tw, "%d.\t%s\t%.1f%%\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\n", hop.TTL, host, 100*hop.Loss(),
+			hop.Sent, millis(hop.Last), millis(hop.Mean), millis(hop.Best), millis(hop.Worst), millis(hop.StdDev))
+	}
+	return tw.Flush()
+}
+
+// newPathResult converts a path report to its JSON form.
+func newPathResult(r *pathprobe.Report) pathResult {
+	result := pathResult{
+		Destination: r.Destination.String(),
+		Rounds:      r.Rounds,
+		Reached:     r.Reached,
+		Hops:        make([]hopResult, 0, len(r.Hops)),
+	}
+	for i := range r.Hops {
+		hop := &r.Hops[i]
+		h := hopResult{
+			TTL:      hop.TTL,
+			Hosts:    make([]string, 0, len(hop.Addrs)),
+			Sent:     hop.Sent,
+			Received: hop.Received,
+			Loss:     100 * hop.Loss(),
+			Last:     millis(hop.Last),
+			Mean:     millis(hop.Mean),
+			Best:     millis(hop.Best),
+			Worst:    millis(hop.Worst),
+			StdDev:   millis(hop.StdDev),
+		}
+		for _, addr := range hop.Addrs {
+			h.Hosts = append(h.Hosts, addr.String())
+		}
+		if hop.Err != nil {
+			h.Error = hop.Err.Error()
+		}
+		for _, label := range hop.MPLS {
+			h.MPLS = append(h.MPLS, label.Label)
+		}
+		for _, a := range hop.Annotations {
+			ha := hostAnnotation{Name: a.Name, ASN: a.ASN, Country: a.Country, Bogon: a.Bogon, IXP: a.IXP}
+			if a.Prefix != nil {
+				ha.Prefix = a.Prefix.String()
+			}
+			h.Annotations = append(h.Annotations, ha)
+		}
+		result.Hops = append(result.Hops, h)
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/iprange"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+)
+
+// planResult is the JSON form of an address plan.
+type planResult struct {
+	Supernet    string             `json:"supernet"`
+	Allocations []allocationResult `json:"allocations"`
+	Free        []string           `json:"free"`
+}
+
+// allocationResult is the JSON form of the block reserved for a requirement.
+type allocationResult struct {
+	Name     string   `json:"name"`
+	Length   int      `json:"length"`
+	Count    int      `json:"count"`
+	Block    string   `json:"block"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// runPlan divides a supernet between named requirements.
+func runPlan(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("plan", "supernet requirement ...", stderr)
+	growth := fs.Float64("growth", 1, "reserve room for this `fraction` more of each requirement, before rounding up")
+	asJSON := fs.Bool("json", false, "write JSON, listing every prefix, rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintln(stderr, `requirements are written as name:/length xcount, such as "lan:/24 x40"`)
+		fs.Usage()
+		return errUsage
+	}
+	_, supernet, err := net.ParseCIDR(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	reqs, err := iprange.ParseRequirements(strings.Join(fs.Args()[1:], ","))
+	if err != nil {
+		return err
+	}
+	plan, err := iprange.NewPlan(supernet, reqs, *growth)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		r := planResult{Supernet: plan.Supernet.String(), Free: []string{}}
+		for _, a := range plan.Allocations {
+			ar := allocationResult{Name: a.Name, Length: a.Length, Count: a.Count, Block: a.Block.String()}
+			for _, pfx := range a.Prefixes {
+				ar.Prefixes = append(ar.Prefixes, pfx.String())
+			}
+			r.Allocations = append(r.Allocations, ar)
+		}
+		for _, pfx := range plan.Free {
+			r.Free = append(r.Free, pfx.String())
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Name\tBlock\tCount\tFirst\tLast")
+	for _, a := range plan.Allocations {
+		fmt.Fprintf(tw, "%s\t%v\t%d x /%d\t%v\t%v\n", a.Name, a.Block, a.Count, a.Length, a.Prefixes[0],
+			a.Prefixes[len(a.Prefixes)-1])
+	}
+	for _, pfx := range plan.Free {
+		fmt.Fprintf(tw, "(free)\t%v\n", pfx)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/rpki"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runROAs reads announcements from files or stdin, and writes the ROAs authorising them, or the changes to make to
+// existing ROAs to authorise them and the risks of the existing ROAs.
+func runROAs(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("roas", "[file ...]", stderr)
+	bird := fs.Bool("bird", false, "read routes as output by BIRD's show route all, rather than lines of prefix and asn")
+	localAS := fs.Uint("asn", 0, "the `ASN` originating BIRD routes with an empty AS path, which are otherwise skipped")
+	existingFile := fs.String("existing", "", "write the changes to the ROAs in `file`, and their risks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *localAS > 1<<32-1 {
+		fmt.Fprintln(stderr, "-asn out of range")
+		return errUsage
+	}
+	read := func(r io.Reader, name string) ([]rpki.Announcement, error) {
+		if !*bird {
+			return readAnnouncements(r, name)
+		}
+		routes, err := bgp.ParseBIRD(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		var announced []rpki.Announcement
+		for i := range routes {
+			origin := routes[i].OriginAS()
+			if len(routes[i].ASPath) == 0 {
+				origin = uint32(*localAS)
+			}
+			if routes[i].Primary && origin != 0 {
+				announced = append(announced, rpki.Announcement{Prefix: routes[i].Prefix, Origin: origin})
+			}
+		}
+		return announced, nil
+	}
+
+	var announced []rpki.Announcement
+	if fs.NArg() == 0 {
+		var err error
+		if announced, err = read(stdin, "stdin"); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		fileAnnounced, err := read(f, path)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		announced = append(announced, fileAnnounced...)
+	}
+	roas := rpki.Generate(announced)
+
+	if *existingFile == "" {
+		fmt.Fprintln(stdout, "ASN,IP Prefix,Max Length,Trust Anchor")
+		for _, roa := range roas {
+			fmt.Fprintf(stdout, "%s,%s\n", roaString(roa), roa.TrustAnchor)
+		}
+		return nil
+	}
+	f, err := os.Open(*existingFile)
+	if err != nil {
+		return err
+	}
+	existing, err := rpki.Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", *existingFile, err)
+	}
+	for _, risk := range rpki.Check(existing, announced) {
+		fmt.Fprintf(stdout, "risk %v\n", risk)
+	}
+	had, want := map[string]bool{}, map[string]bool{}
+	for _, roa := range existing {
+		had[roaString(roa)] = true
+	}
+	for _, roa := range roas {
+		want[roaString(roa)] = true
+		if !had[roaString(roa)] {
+			fmt.Fprintf(stdout, "add %s\n", roaString(roa))
+		}
+	}
+	for _, roa := range existing {
+		if s := roaString(roa); !want[s] {
+			fmt.Fprintf(stdout, "remove %s\n", s)
+			want[s] = true
+		}
+	}
+	return nil
+}
+
+// roaString returns the ASN, prefix and maximum length of a ROA, separated by commas.
+func roaString(roa rpki.ROA) string {
+	maxLen := roa.MaxLength
+	if maxLen == 0 {
+		maxLen, _ = roa.Prefix.Mask.Size()
+	}
+	return fmt.Sprintf("AS%d,%v,%d", roa.ASN, roa.Prefix, maxLen)
+}
+
+// readAnnouncements reads lines of a prefix and the ASN originating it, with or without the AS prefix, ignoring blank
+// lines and comments starting with #.
+func readAnnouncements(r io.Reader, name string) ([]rpki.Announcement, error) {
+	var announced []rpki.Announcement
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a prefix and an asn", name, line)
+		}
+		_, pfx, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[1]), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid asn %q", name, line, fields[1])
+		}
+		announced = append(announced, rpki.Announcement{Prefix: pfx, Origin: uint32(asn)})
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return announced, nil
+}
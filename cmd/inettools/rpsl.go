@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dotwaffle/inettools/feed"
+	"github.com/dotwaffle/inettools/rpsl"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runRPSL reads prefixes from files or stdin, and writes the RPSL route and route6 objects registering their origin,
+// and optionally an as-set, to submit to an IRR database.
+func runRPSL(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("rpsl", "-origin asn -mnt-by maintainer -source db [file ...]", stderr)
+	originFlag := fs.String("origin", "", "the `ASN` originating the prefixes")
+	mntBy := fs.String("mnt-by", "", "the `maintainers` of the objects, separated by commas")
+	source := fs.String("source", "", "the IRR `database` holding the objects, such as RADB")
+	descr := fs.String("descr", "", "a `description` of the objects")
+	asSet := fs.String("as-set", "", "also write an as-set `name`d, whose members are the origin and -members")
+	members := fs.String("members", "", "further `members` of the as-set, ASNs or as-sets separated by commas")
+	contacts := fs.String("contact", "", "the admin-c and tech-c `handle` of the as-set")
+	inputFormat := fs.String("input", string(feed.FormatAuto), fmt.Sprintf("input `format`, one of %v", feed.Formats))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	origin, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(*originFlag), "AS"), 10, 32)
+	if err != nil || *mntBy == "" || *source == "" {
+		fmt.Fprintln(stderr, "-origin, -mnt-by and -source are required")
+		fs.Usage()
+		return errUsage
+	}
+	var in input
+	if in.format, err = feed.ParseFormat(*inputFormat); err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+	md := rpsl.Metadata{MntBy: splitList(*mntBy), Source: *source}
+	if *descr != "" {
+		md.Descr = []string{*descr}
+	}
+
+	var pfxs []*net.IPNet
+	if fs.NArg() == 0 {
+		if pfxs, _, err = readInput(stdin, "stdin", in); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		filePfxs, _, err := readInput(f, path, in)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		pfxs = append(pfxs, filePfxs...)
+	}
+	objs, err := rpsl.Routes(pfxs, uint32(origin), md)
+	if err != nil {
+		return err
+	}
+	if *asSet != "" {
+		setMD := md
+		if *contacts != "" {
+			setMD.AdminC, setMD.TechC = splitList(*contacts), splitList(*contacts)
+		}
+		set, err := rpsl.ASSet(*asSet, append([]string{strconv.FormatUint(origin, 10)}, splitList(*members)...), setMD)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, set)
+	}
+	return rpsl.Write(stdout, objs)
+}
+
+// splitList splits a list separated by commas, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dotwaffle/inettools/feed"
+	"github.com/dotwaffle/inettools/iprange"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+)
+
+// runSample reads prefixes from files or stdin, and writes representative addresses of them, such as probe targets.
+func runSample(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("sample", "[file ...]", stderr)
+	len4 := fs.Int("4", iprange.DefaultSampleLen4, "the `length` of the IPv4 blocks sampled")
+	len6 := fs.Int("6", iprange.DefaultSampleLen6, "the `length` of the IPv6 blocks sampled")
+	perBlock := fs.Int("per-block", 1, "the `number` of addresses chosen from each block")
+	maxTargets := fs.Int("max", 0, "the most addresses chosen, spread evenly across the prefixes, or 0 for no limit")
+	random := fs.Bool("random", false, "choose blocks and addresses at random, rather than repeatably")
+	inputFormat := fs.String("input", string(feed.FormatAuto), fmt.Sprintf("input `format`, one of %v", feed.Formats))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *len4 <= 0 || *len4 > 32 || *len6 <= 0 || *len6 > 128 || *perBlock <= 0 || *maxTargets < 0 {
+		fmt.Fprintln(stderr, "-4, -6, -per-block or -max out of range")
+		return errUsage
+	}
+	var in input
+	var err error
+	if in.format, err = feed.ParseFormat(*inputFormat); err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+
+	var pfxs []*net.IPNet
+	if fs.NArg() == 0 {
+		if pfxs, _, err = readInput(stdin, "stdin", in); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		filePfxs, _, err := readInput(f, path, in)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		pfxs = append(pfxs, filePfxs...)
+	}
+
+	policy := iprange.SamplePolicy{PrefixLen4: *len4, PrefixLen6: *len6, PerBlock: *perBlock, Max: *maxTargets}
+	if *random {
+		policy.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	ips, err := iprange.FromIPNets(pfxs).Sample(policy)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		fmt.Fprintln(stdout, ip)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/sockdiag"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// socketResult is the JSON form of a socket.
+type socketResult struct {
+	Protocol     string  `json:"protocol"`
+	State        string  `json:"state"`
+	Local        string  `json:"local"`
+	Remote       string  `json:"remote"`
+	RecvQueue    uint32  `json:"recv_queue"`
+	SendQueue    uint32  `json:"send_queue"`
+	UID          uint32  `json:"uid"`
+	Congestion   string  `json:"congestion,omitempty"`
+	RTT          float64 `json:"rtt_ms,omitempty"`
+	MinRTT       float64 `json:"min_rtt_ms,omitempty"`
+	Cwnd         uint32  `json:"cwnd,omitempty"`
+	Retrans      uint32  `json:"retrans,omitempty"`
+	DeliveryRate float64 `json:"delivery_rate_bps,omitempty"`
+}
+
+// runSockets lists sockets with their TCP statistics, in the manner of ss.
+func runSockets(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("sockets", "", stderr)
+	udp := fs.Bool("udp", false, "list UDP rather than TCP sockets")
+	listening := fs.Bool("listening", false, "only list listening TCP and unconnected UDP sockets")
+	all := fs.Bool("all", false, "list sockets in every state")
+	prefix := fs.String("prefix", "", "only list sockets whose remote address is within this `prefix`")
+	port := fs.Int("port", 0, "only list sockets with this local or remote `port`")
+	asJSON := fs.Bool("json", false, "write JSON rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if *listening && *all {
+		fmt.Fprintln(stderr, "-listening and -all are mutually exclusive")
+		return errUsage
+	}
+
+	f := &sockdiag.Filter{Protocol: sockdiag.TCP, Port: *port, Info: true}
+	if *udp {
+		f.Protocol = sockdiag.UDP
+	}
+	if *prefix != "" {
+		pfx, err := parsePrefix(*prefix)
+		if err != nil {
+			return err
+		}
+		f.Prefix = pfx
+	}
+	// As with ss, listening and unconnected sockets are only shown when asked for.
+	switch {
+	case *listening:
+		f.States = []sockdiag.State{sockdiag.Listen, sockdiag.Close}
+	case !*all:
+		for s := sockdiag.Established; s <= sockdiag.NewSynRecv; s++ {
+			if s != sockdiag.Listen && s != sockdiag.Close {
+				f.States = append(f.States, s)
+			}
+		}
+	}
+
+	sockets, err := sockdiag.List(f)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		results := make([]socketResult, 0, len(sockets))
+		for i := range sockets {
+			results = append(results, newSocketResult(&sockets[i]))
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "State\tRecv-Q\tSend-Q\tLocal\tRemote\tRTT\tCwnd\tRetrans\tDelivery")
+	for _, s := range sockets {
+		rtt, cwnd, retrans, rate := "-", "-", "-", "-"
+		if s.Info != nil && s.State != sockdiag.Listen {
+			rtt = fmt.Sprintf("%.3fms", millis(s.Info.SmoothedRTT()))
+			cwnd = fmt.Sprint(s.Info.SndCwnd)
+			retrans = fmt.Sprint(s.Info.TotalRetrans)
+			rate = formatRate(s.Info.DeliveryRateBits())
+		}
+		fmt.Fprintf(tw, "%v\t%d\t%d\t%v\t%v\t%s\t%s\t%s\t%s\n",
+			s.State, s.RecvQueue, s.SendQueue, s.Local, s.Remote, rtt, cwnd, retrans, rate)
+	}
+	return tw.Flush()
+}
+
+// newSocketResult converts a socket to its JSON form.
+func newSocketResult(s *sockdiag.Socket) socketResult {
+	r := socketResult{
+		Protocol:   "tcp",
+		State:      s.State.String(),
+		Local:      s.Local.String(),
+		Remote:     s.Remote.String(),
+		RecvQueue:  s.RecvQueue,
+		SendQueue:  s.SendQueue,
+		UID:        s.UID,
+		Congestion: s.Congestion,
+	}
+	if s.Protocol == sockdiag.UDP {
+		r.Protocol = "udp"
+	}
+	if s.Info != nil && s.State != sockdiag.Listen {
+		r.RTT = millis(s.Info.SmoothedRTT())
+		r.MinRTT = millis(s.Info.MinimumRTT())
+		r.Cwnd = s.Info.SndCwnd
+		r.Retrans = s.Info.TotalRetrans
+		r.DeliveryRate = s.Info.DeliveryRateBits()
+	}
+	return r
+}
+
+// millis returns a duration in fractional milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// formatRate formats a rate in bits per second with a decimal unit prefix, as ss does.
+func formatRate(bps float64) string {
+	for _, unit := range []struct {
+		scale  float64
+		suffix string
+	}{{1e9, "Gbps"}, {1e6, "Mbps"}, {1e3, "Kbps"}} {
+		if bps >= unit.scale {
+			return fmt.Sprintf("%.1f%s", bps/unit.scale, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%.0fbps", bps)
+}
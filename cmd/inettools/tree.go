@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dotwaffle/inettools/aggregate"
+	"github.com/dotwaffle/inettools/feed"
+	"github.com/dotwaffle/inettools/prefixtree"
+	"io"
+	"net"
+	"os"
+)
+
+// runTree reads prefixes from files or stdin, and shows how they nest.
+func runTree(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("tree", "[file ...]", stderr)
+	format := fs.String("format", "text", fmt.Sprintf("output `format`, one of %v", prefixtree.Formats))
+	aggregated := fs.Bool("aggregate", false, "add the aggregates of the prefixes as the roots of the tree")
+	inputFormat := fs.String("input", string(feed.FormatAuto), fmt.Sprintf("input `format`, one of %v", feed.Formats))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	outFormat, err := prefixtree.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+	var in input
+	if in.format, err = feed.ParseFormat(*inputFormat); err != nil {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return errUsage
+	}
+
+	var pfxs []*net.IPNet
+	if fs.NArg() == 0 {
+		if pfxs, _, err = readInput(stdin, "stdin", in); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		filePfxs, _, err := readInput(f, path, in)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		pfxs = append(pfxs, filePfxs...)
+	}
+
+	if *aggregated {
+		// Aggregating sorts its argument, so it is given a copy.
+		agg, err := aggregate.IPNets(append([]*net.IPNet(nil), pfxs...))
+		if err != nil {
+			return err
+		}
+		pfxs = append(pfxs, agg...)
+	}
+	return prefixtree.Write(stdout, prefixtree.Build(pfxs), outFormat)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/hijack"
+	"github.com/dotwaffle/inettools/rislive"
+	"github.com/dotwaffle/inettools/rpki"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertResult is the JSON form of an alert.
+type alertResult struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Watched  string    `json:"watched"`
+	Expected []uint32  `json:"expected"`
+	Prefix   string    `json:"prefix"`
+	Origin   uint32    `json:"origin"`
+	ASPath   []uint32  `json:"as_path"`
+	Peer     string    `json:"peer"`
+	PeerAS   uint32    `json:"peer_as"`
+	RPKI     string    `json:"rpki"`
+}
+
+// runWatch watches the BGP updates seen by RIS Live for unexpected origins and more specifics of prefixes.
+func runWatch(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("watch", "prefix[^maxlen][=asn,...] ...", stderr)
+	risURL := fs.String("url", rislive.DefaultURL, "the `URL` of the RIS Live stream")
+	host := fs.String("host", "", "watch the updates of one route `collector`, such as rrc00")
+	roasFile := fs.String("roas", "", "validate alerts against the ROAs in `file`, as exported by an RPKI validator")
+	asJSON := fs.Bool("json", false, "write each alert as a line of JSON rather than text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	m := hijack.NewMonitor()
+	c := &rislive.Client{
+		URL:     *risURL,
+		OnError: func(err error) { fmt.Fprintf(stderr, "ris live: %v\n", err) },
+	}
+	for _, arg := range fs.Args() {
+		w, err := parseWatch(arg)
+		if err == nil {
+			err = m.Watch(w)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return errUsage
+		}
+		c.Filters = append(c.Filters, rislive.Filter{Host: *host, Prefix: w.Prefix, MoreSpecific: true})
+	}
+	if *roasFile != "" {
+		f, err := os.Open(*roasFile)
+		if err != nil {
+			return err
+		}
+		roas, err := rpki.Parse(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", *roasFile, err)
+		}
+		m.ROAs = rpki.NewTable()
+		for _, roa := range roas {
+			if err := m.ROAs.Add(roa); err != nil {
+				return fmt.Errorf("%s: %w", *roasFile, err)
+			}
+		}
+	}
+
+	enc := json.NewEncoder(stdout)
+	m.OnAlert = func(a hijack.Alert) {
+		if !*asJSON {
+			fmt.Fprintf(stdout, "%s %v\n", a.Time.Format(time.RFC3339), a)
+			return
+		}
+		enc.Encode(alertResult{
+			Time:     a.Time,
+			Kind:     a.Kind.String(),
+			Watched:  a.Watched.String(),
+			Expected: a.Expected,
+			Prefix:   a.Prefix.String(),
+			Origin:   a.Origin,
+			ASPath:   a.ASPath,
+			Peer:     a.Peer.String(),
+			PeerAS:   a.PeerAS,
+			RPKI:     a.RPKI.String(),
+		})
+	}
+
+	// Watching continues until interrupted.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	updates := make(chan bgp.Update, 64)
+	go c.Run(ctx, updates)
+	if err := m.Run(ctx, updates); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// parseWatch parses a prefix to watch, optionally followed by ^ and the length of the longest more specifics expected,
+// and by = and the ASes expected to originate it, separated by commas.
+func parseWatch(s string) (hijack.Watch, error) {
+	var w hijack.Watch
+	spec, origins := s, ""
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		spec, origins = s[:i], s[i+1:]
+	}
+	if i := strings.IndexByte(spec, '^'); i >= 0 {
+		n, err := strconv.Atoi(spec[i+1:])
+		if err != nil {
+			return w, fmt.Errorf("invalid max length in %q", s)
+		}
+		spec, w.MaxLength = spec[:i], n
+	}
+	var err error
+	if _, w.Prefix, err = net.ParseCIDR(spec); err != nil {
+		return w, fmt.Errorf("invalid prefix in %q", s)
+	}
+	if origins == "" {
+		return w, nil
+	}
+	for _, o := range strings.Split(origins, ",") {
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(o), "AS"), 10, 32)
+		if err != nil {
+			return w, fmt.Errorf("invalid asn %q in %q", o, s)
+		}
+		w.Origins = append(w.Origins, uint32(asn))
+	}
+	return w, nil
+}
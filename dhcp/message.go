@@ -0,0 +1,206 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// MessageType is the type of a DHCPv4 message, carried in OptionMessageType.
+type MessageType uint8
+
+// DHCPv4 message types, from RFC 2132.
+const (
+	MessageDiscover MessageType = 1
+	MessageOffer    MessageType = 2
+	MessageRequest  MessageType = 3
+	MessageDecline  MessageType = 4
+	MessageAck      MessageType = 5
+	MessageNak      MessageType = 6
+	MessageRelease  MessageType = 7
+	MessageInform   MessageType = 8
+)
+
+// DHCPv4 option codes, from RFC 2132.
+const (
+	OptionPad          = 0
+	OptionSubnetMask   = 1
+	OptionRouter       = 3
+	OptionDNS          = 6
+	OptionHostname     = 12
+	OptionDomainName   = 15
+	OptionLeaseTime    = 51
+	OptionMessageType  = 53
+	OptionServerID     = 54
+	OptionParamRequest = 55
+	OptionMessage      = 56
+	OptionClientID     = 61
+	OptionEnd          = 255
+)
+
+// BOOTP operations.
+const (
+	OpRequest = 1
+	OpReply   = 2
+)
+
+// FlagBroadcast asks servers to broadcast their replies, for clients that cannot receive unicast before they have an
+// address.
+const FlagBroadcast = 0x8000
+
+// headerLen is the length of the fixed BOOTP header, and minLen the shortest message some servers accept.
+const (
+	headerLen = 236
+	minLen    = 300
+)
+
+// magic is the cookie that precedes the options.
+var magic = []byte{99, 130, 83, 99}
+
+// Options are the options of a DHCPv4 message, by code. Options split across several instances, as described by
+// RFC 3396, are joined.
+type Options map[uint8][]byte
+
+// IP returns an option holding an IPv4 address, or nil if it is missing or not one.
+func (o Options) IP(code uint8) net.IP {
+	if b := o[code]; len(b) == net.IPv4len {
+		return net.IP(append([]byte(nil), b...))
+	}
+	return nil
+}
+
+// IPs returns an option holding a list of IPv4 addresses.
+func (o Options) IPs(code uint8) []net.IP {
+	b := o[code]
+	var ips []net.IP
+	for ; len(b) >= net.IPv4len; b = b[net.IPv4len:] {
+		ips = append(ips, net.IP(append([]byte(nil), b[:net.IPv4len]...)))
+	}
+	return ips
+}
+
+// Duration returns an option holding a number of seconds, or zero if it is missing.
+func (o Options) Duration(code uint8) time.Duration {
+	if b := o[code]; len(b) == 4 {
+		return time.Duration(binary.BigEndian.Uint32(b)) * time.Second
+	}
+	return 0
+}
+
+// Message is a DHCPv4 message.
+type Message struct {
+	Op           uint8 // OpRequest or OpReply.
+	XID          uint32
+	Secs         uint16
+	Flags        uint16
+	ClientAddr   net.IP // ciaddr: the address of a client that already has one.
+	YourAddr     net.IP // yiaddr: the address offered or assigned to the client.
+	ServerAddr   net.IP // siaddr: the next server, for network booting.
+	RelayAddr    net.IP // giaddr: the relay agent that forwarded the message.
+	HardwareAddr net.HardwareAddr
+	Options      Options
+}
+
+// Type returns the message type, or zero if the message has none.
+func (m *Message) Type() MessageType {
+	if b := m.Options[OptionMessageType]; len(b) == 1 {
+		return MessageType(b[0])
+	}
+	return 0
+}
+
+// Marshal encodes the message, with its options in order of code after the message type, padded to the 300 octets
+// some servers require.
+func (m *Message) Marshal() []byte {
+	b := make([]byte, headerLen, minLen)
+	b[0], b[1], b[2] = m.Op, 1, byte(len(m.HardwareAddr))
+	binary.BigEndian.PutUint32(b[4:], m.XID)
+	binary.BigEndian.PutUint16(b[8:], m.Secs)
+	binary.BigEndian.PutUint16(b[10:], m.Flags)
+	for i, ip := range []net.IP{m.ClientAddr, m.YourAddr, m.ServerAddr, m.RelayAddr} {
+		if ip4 := ip.To4(); ip4 != nil {
+			copy(b[12+4*i:], ip4)
+		}
+	}
+	copy(b[28:44], m.HardwareAddr)
+	b = append(b, magic...)
+
+	codes := make([]int, 0, len(m.Options))
+	for code := range m.Options {
+		if code != OptionMessageType {
+			codes = append(codes, int(code))
+		}
+	}
+	sort.Ints(codes)
+	if _, ok := m.Options[OptionMessageType]; ok {
+		codes = append([]int{OptionMessageType}, codes...)
+	}
+	for _, code := range codes {
+		data := m.Options[uint8(code)]
+		for {
+			n := len(data)
+			if n > 255 {
+				n = 255
+			}
+			b = append(b, byte(code), byte(n))
+			b = append(b, data[:n]...)
+			if data = data[n:]; len(data) == 0 {
+				break
+			}
+		}
+	}
+	b = append(b, OptionEnd)
+	for len(b) < minLen {
+		b = append(b, OptionPad)
+	}
+	return b
+}
+
+// ParseMessage decodes a DHCPv4 message. The options overloaded into the server name and file fields are not read.
+func ParseMessage(b []byte) (*Message, error) {
+	if len(b) < headerLen+len(magic) {
+		return nil, errors.New("message too short")
+	}
+	if string(b[headerLen:headerLen+len(magic)]) != string(magic) {
+		return nil, errors.New("missing magic cookie")
+	}
+	hlen := int(b[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid hardware address length %d", hlen)
+	}
+	ip := func(off int) net.IP { return net.IP(append([]byte(nil), b[off:off+net.IPv4len]...)) }
+	m := &Message{
+		Op:           b[0],
+		XID:          binary.BigEndian.Uint32(b[4:]),
+		Secs:         binary.BigEndian.Uint16(b[8:]),
+		Flags:        binary.BigEndian.Uint16(b[10:]),
+		ClientAddr:   ip(12),
+		YourAddr:     ip(16),
+		ServerAddr:   ip(20),
+		RelayAddr:    ip(24),
+		HardwareAddr: net.HardwareAddr(append([]byte(nil), b[28:28+hlen]...)),
+		Options:      Options{},
+	}
+
+	opts := b[headerLen+len(magic):]
+	for len(opts) > 0 {
+		code := opts[0]
+		if code == OptionEnd {
+			break
+		}
+		if code == OptionPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, fmt.Errorf("option %d truncated", code)
+		}
+		n := 2 + int(opts[1])
+		m.Options[code] = append(m.Options[code], opts[2:n]...)
+		opts = opts[n:]
+	}
+	return m, nil
+}
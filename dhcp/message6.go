@@ -0,0 +1,148 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// MessageType6 is the type of a DHCPv6 message.
+type MessageType6 uint8
+
+// DHCPv6 message types, from RFC 8415.
+const (
+	MessageSolicit   MessageType6 = 1
+	MessageAdvertise MessageType6 = 2
+	MessageRequest6  MessageType6 = 3
+	MessageReply     MessageType6 = 7
+)
+
+// DHCPv6 option codes, from RFC 8415 and RFC 3646.
+const (
+	Option6ClientID    = 1
+	Option6ServerID    = 2
+	Option6IANA        = 3
+	Option6IAAddr      = 5
+	Option6ORO         = 6
+	Option6Preference  = 7
+	Option6ElapsedTime = 8
+	Option6StatusCode  = 13
+	Option6DNS         = 23
+	Option6DomainList  = 24
+)
+
+// Status6 is a DHCPv6 status code.
+type Status6 uint16
+
+// DHCPv6 status codes, from RFC 8415.
+const (
+	StatusSuccess      Status6 = 0
+	StatusUnspecFail   Status6 = 1
+	StatusNoAddrsAvail Status6 = 2
+	StatusNoBinding    Status6 = 3
+	StatusNotOnLink    Status6 = 4
+	StatusUseMulticast Status6 = 5
+)
+
+// Options6 are the options of a DHCPv6 message, by code. Where an option appears more than once, the first is kept.
+type Options6 map[uint16][]byte
+
+// IPs returns an option holding a list of IPv6 addresses.
+func (o Options6) IPs(code uint16) []net.IP {
+	b := o[code]
+	var ips []net.IP
+	for ; len(b) >= net.IPv6len; b = b[net.IPv6len:] {
+		ips = append(ips, net.IP(append([]byte(nil), b[:net.IPv6len]...)))
+	}
+	return ips
+}
+
+// Domains returns an option holding a list of domain names in DNS wire format.
+func (o Options6) Domains(code uint16) []string {
+	b := o[code]
+	var names []string
+	var labels []string
+	for len(b) > 0 {
+		n := int(b[0])
+		if 1+n > len(b) {
+			break
+		}
+		if n == 0 {
+			names = append(names, strings.Join(labels, ".")+".")
+			labels = nil
+		} else {
+			labels = append(labels, string(b[1:1+n]))
+		}
+		b = b[1+n:]
+	}
+	return names
+}
+
+// Message6 is a DHCPv6 message between a client and a server.
+type Message6 struct {
+	Type    MessageType6
+	XID     uint32 // The transaction ID, of which only the lower 24 bits are sent.
+	Options Options6
+}
+
+// Marshal encodes the message, with its options in order of code.
+func (m *Message6) Marshal() []byte {
+	b := []byte{byte(m.Type), byte(m.XID >> 16), byte(m.XID >> 8), byte(m.XID)}
+	codes := make([]int, 0, len(m.Options))
+	for code := range m.Options {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		b = appendOption6(b, uint16(code), m.Options[uint16(code)])
+	}
+	return b
+}
+
+// appendOption6 appends a DHCPv6 option to b.
+func appendOption6(b []byte, code uint16, data []byte) []byte {
+	b = append(b, byte(code>>8), byte(code), byte(len(data)>>8), byte(len(data)))
+	return append(b, data...)
+}
+
+// ParseMessage6 decodes a DHCPv6 message between a client and a server.
+func ParseMessage6(b []byte) (*Message6, error) {
+	if len(b) < 4 {
+		return nil, errors.New("message too short")
+	}
+	m := &Message6{
+		Type:    MessageType6(b[0]),
+		XID:     uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]),
+		Options: Options6{},
+	}
+	err := walkOptions6(b[4:], func(code uint16, data []byte) {
+		if _, ok := m.Options[code]; !ok {
+			m.Options[code] = data
+		}
+	})
+	return m, err
+}
+
+// walkOptions6 calls fn with each of the options encoded in b, in order.
+func walkOptions6(b []byte, fn func(code uint16, data []byte)) error {
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return errors.New("option truncated")
+		}
+		code, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return fmt.Errorf("option %d truncated", code)
+		}
+		fn(code, append([]byte(nil), b[4:4+n]...))
+		b = b[4+n:]
+	}
+	return nil
+}
+
+// duidLL returns the DUID-LL of a client with an Ethernet address, as described by RFC 8415.
+func duidLL(hw net.HardwareAddr) []byte {
+	return append([]byte{0, 3, 0, 1}, hw...)
+}
@@ -0,0 +1,93 @@
+package dhcp
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	m := &Message{
+		Op:           OpReply,
+		XID:          0x3903f326,
+		Flags:        FlagBroadcast,
+		ClientAddr:   net.IPv4zero.To4(),
+		YourAddr:     net.IPv4(192, 0, 2, 10).To4(),
+		ServerAddr:   net.IPv4zero.To4(),
+		RelayAddr:    net.IPv4(192, 0, 2, 1).To4(),
+		HardwareAddr: net.HardwareAddr{0x02, 0, 0x5e, 0x10, 0, 1},
+		Options: Options{
+			OptionMessageType: {byte(MessageOffer)},
+			OptionServerID:    {192, 0, 2, 2},
+			OptionRouter:      {192, 0, 2, 1, 192, 0, 2, 254},
+			OptionLeaseTime:   {0, 0, 0x0e, 0x10},
+			// Longer than one option can hold, so it is split and joined again.
+			OptionDomainName: []byte(strings.Repeat("a", 300)),
+		},
+	}
+	b := m.Marshal()
+	if b[headerLen+len(magic)] != OptionMessageType {
+		t.Errorf("message type is not the first option")
+	}
+	got, err := ParseMessage(b)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	if diff := cmp.Diff(m, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if got.Type() != MessageOffer {
+		t.Errorf("got type %d, want %d", got.Type(), MessageOffer)
+	}
+	if diff := cmp.Diff([]net.IP{{192, 0, 2, 1}, {192, 0, 2, 254}}, got.Options.IPs(OptionRouter)); diff != "" {
+		t.Errorf("%v", diff)
+	}
+	if got.Options.Duration(OptionLeaseTime) != time.Hour {
+		t.Errorf("got lease %v, want 1h", got.Options.Duration(OptionLeaseTime))
+	}
+
+	short := (&Message{Op: OpRequest}).Marshal()
+	if len(short) != minLen {
+		t.Errorf("got length %d, want padding to %d", len(short), minLen)
+	}
+	for name, b := range map[string][]byte{
+		"Short":     short[:100],
+		"NoCookie":  make([]byte, minLen),
+		"Truncated": append(append([]byte(nil), short[:headerLen+len(magic)]...), OptionRouter, 8, 192, 0),
+	} {
+		if _, err := ParseMessage(b); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestMessage6(t *testing.T) {
+	m := &Message6{
+		Type: MessageAdvertise,
+		XID:  0xabcdef,
+		Options: Options6{
+			Option6ServerID:   {0, 1, 0, 1, 1, 2, 3, 4},
+			Option6DNS:        net.ParseIP("2001:db8::53"),
+			Option6DomainList: []byte("\x07example\x03com\x00\x03lab\x07example\x03net\x00"),
+		},
+	}
+	b := m.Marshal()
+	if diff := cmp.Diff([]byte{2, 0xab, 0xcd, 0xef, 0, 2, 0, 8}, b[:8]); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	got, err := ParseMessage6(b)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	if diff := cmp.Diff(m, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if diff := cmp.Diff([]string{"example.com.", "lab.example.net."}, got.Options.Domains(Option6DomainList)); diff != "" {
+		t.Errorf("%v", diff)
+	}
+	if _, err := ParseMessage6(b[:len(b)-1]); err == nil {
+		t.Errorf("truncated: got no error")
+	}
+}
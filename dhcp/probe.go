@@ -0,0 +1,332 @@
+package dhcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/sockopt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Defaults used by a Prober whose fields are not set.
+const (
+	DefaultTimeout = 3 * time.Second
+	DefaultServer  = "255.255.255.255:67"
+	DefaultLocal   = ":68"
+	DefaultServer6 = "[ff02::1:2]:547" // All DHCPv6 relay agents and servers, on the link of the interface.
+	DefaultLocal6  = "[::]:546"
+)
+
+// ErrNoResponse is returned when no server answers before the timeout.
+var ErrNoResponse = errors.New("no response")
+
+// Prober asks DHCP servers what they would offer, without accepting it, so that no lease is committed: a DISCOVER
+// collects OFFERs, and a SOLICIT collects ADVERTISEs. Listening on the client ports usually requires privileges, and
+// each Prober needs an Interface or a HardwareAddr.
+type Prober struct {
+	// The interface to probe through, which the socket is bound to. Its hardware address identifies the client,
+	// unless HardwareAddr is set.
+	Interface    string
+	HardwareAddr net.HardwareAddr
+	// The address to send to, or DefaultServer or DefaultServer6 if empty, which need Interface for IPv6. A server
+	// or relay can be probed directly by its address.
+	Server string
+	// The address to listen on, or DefaultLocal or DefaultLocal6 if empty.
+	Local string
+	// How long to collect responses for, or DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// Offer is what a DHCPv4 server offered.
+type Offer struct {
+	Server     net.IP   // The server identifier, or the address the offer came from if it has none.
+	From       net.Addr // The address the offer came from, which may be a relay.
+	Address    net.IP   // The address offered.
+	SubnetMask net.IPMask
+	Routers    []net.IP
+	DNS        []net.IP
+	Domain     string
+	Lease      time.Duration
+	Routes     []Route // Classless static routes, from option 121 or else 249.
+	RTT        time.Duration
+	Message    *Message // The offer, with all its options.
+}
+
+// Advertisement is what a DHCPv6 server advertised.
+type Advertisement struct {
+	Server        []byte   // The DUID of the server.
+	From          net.Addr // The address the advertisement came from, which may be a relay.
+	Addresses     []net.IP // The addresses offered for the non-temporary association.
+	Status        Status6  // The status of the association, such as StatusNoAddrsAvail.
+	StatusMessage string   // The message accompanying a status other than success.
+	Preference    int      // The preference of the server, from 0 to 255, which clients choose by.
+	DNS           []net.IP
+	Domains       []string
+	RTT           time.Duration
+	Options       Options6 // All the options of the advertisement.
+}
+
+// Discover broadcasts a DISCOVER and returns the OFFERs received before the timeout, in the order they arrived.
+func (p *Prober) Discover(ctx context.Context) ([]*Offer, error) {
+	hw, err := p.hardwareAddr()
+	if err != nil {
+		return nil, err
+	}
+	server, err := net.ResolveUDPAddr("udp4", p.server(DefaultServer))
+	if err != nil {
+		return nil, err
+	}
+	xid, err := newXID()
+	if err != nil {
+		return nil, err
+	}
+	req := &Message{
+		Op:           OpRequest,
+		XID:          xid,
+		Flags:        FlagBroadcast,
+		HardwareAddr: hw,
+		Options: Options{
+			OptionMessageType: {byte(MessageDiscover)},
+			OptionClientID:    append([]byte{1}, hw...),
+			OptionParamRequest: {
+				OptionSubnetMask, OptionRouter, OptionDNS, OptionDomainName, OptionLeaseTime, OptionServerID,
+				OptionClasslessRoutes, OptionMSClasslessRoutes,
+			},
+		},
+	}
+
+	var offers []*Offer
+	x := exchange{network: "udp4", local: p.local(DefaultLocal), to: server, req: req.Marshal()}
+	err = p.exchange(ctx, x, func(b []byte, from net.Addr, rtt time.Duration) {
+		m, err := ParseMessage(b)
+		if err != nil || m.Op != OpReply || m.XID != xid || m.Type() != MessageOffer {
+			return
+		}
+		offer := newOffer(m, from)
+		offer.RTT = rtt
+		offers = append(offers, offer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(offers) == 0 {
+		return nil, ErrNoResponse
+	}
+	return offers, nil
+}
+
+// newOffer describes an OFFER.
+func newOffer(m *Message, from net.Addr) *Offer {
+	o := &Offer{
+		Server:  m.Options.IP(OptionServerID),
+		From:    from,
+		Address: m.YourAddr,
+		Routers: m.Options.IPs(OptionRouter),
+		DNS:     m.Options.IPs(OptionDNS),
+		Domain:  string(m.Options[OptionDomainName]),
+		Lease:   m.Options.Duration(OptionLeaseTime),
+		Message: m,
+	}
+	if o.Server == nil {
+		if udp, ok := from.(*net.UDPAddr); ok {
+			o.Server = udp.IP
+		}
+	}
+	if mask := m.Options[OptionSubnetMask]; len(mask) == net.IPv4len {
+		o.SubnetMask = net.IPMask(append([]byte(nil), mask...))
+	}
+	for _, code := range []uint8{OptionClasslessRoutes, OptionMSClasslessRoutes} {
+		if b, ok := m.Options[code]; ok {
+			o.Routes, _ = UnmarshalRoutes(b)
+			break
+		}
+	}
+	return o
+}
+
+// Solicit multicasts a SOLICIT for a non-temporary address and returns the ADVERTISEs received before the timeout, in
+// the order they arrived.
+func (p *Prober) Solicit(ctx context.Context) ([]*Advertisement, error) {
+	hw, err := p.hardwareAddr()
+	if err != nil {
+		return nil, err
+	}
+	server, err := net.ResolveUDPAddr("udp6", p.server(DefaultServer6))
+	if err != nil {
+		return nil, err
+	}
+	if server.IP.IsLinkLocalMulticast() && server.Zone == "" {
+		if p.Interface == "" {
+			return nil, fmt.Errorf("multicast to %v needs an interface", server)
+		}
+		server.Zone = p.Interface
+	}
+	xid, err := newXID()
+	if err != nil {
+		return nil, err
+	}
+	xid &= 0xffffff
+	clientID := duidLL(hw)
+	// The IAID only needs to be stable for the client, and leaving T1 and T2 zero lets the server choose them.
+	iana := make([]byte, 12)
+	copy(iana, hw[len(hw)-4:])
+	req := &Message6{
+		Type: MessageSolicit,
+		XID:  xid,
+		Options: Options6{
+			Option6ClientID:    clientID,
+			Option6IANA:        iana,
+			Option6ElapsedTime: {0, 0},
+			Option6ORO:         {0, Option6DNS, 0, Option6DomainList},
+		},
+	}
+
+	var ads []*Advertisement
+	x := exchange{network: "udp6", local: p.local(DefaultLocal6), to: server, req: req.Marshal()}
+	err = p.exchange(ctx, x, func(b []byte, from net.Addr, rtt time.Duration) {
+		m, err := ParseMessage6(b)
+		if err != nil || m.Type != MessageAdvertise || m.XID != xid || !bytes.Equal(m.Options[Option6ClientID], clientID) {
+			return
+		}
+		ad := newAdvertisement(m, from)
+		ad.RTT = rtt
+		ads = append(ads, ad)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ads) == 0 {
+		return nil, ErrNoResponse
+	}
+	return ads, nil
+}
+
+// newAdvertisement describes an ADVERTISE, taking the status of the association in preference to that of the message.
+func newAdvertisement(m *Message6, from net.Addr) *Advertisement {
+	a := &Advertisement{
+		Server:  m.Options[Option6ServerID],
+		From:    from,
+		DNS:     m.Options.IPs(Option6DNS),
+		Domains: m.Options.Domains(Option6DomainList),
+		Options: m.Options,
+	}
+	if pref := m.Options[Option6Preference]; len(pref) == 1 {
+		a.Preference = int(pref[0])
+	}
+	status := func(b []byte) {
+		if len(b) >= 2 {
+			a.Status, a.StatusMessage = Status6(binary.BigEndian.Uint16(b)), string(b[2:])
+		}
+	}
+	status(m.Options[Option6StatusCode])
+	if iana := m.Options[Option6IANA]; len(iana) >= 12 {
+		walkOptions6(iana[12:], func(code uint16, data []byte) {
+			switch {
+			case code == Option6IAAddr && len(data) >= 24:
+				a.Addresses = append(a.Addresses, net.IP(data[:net.IPv6len]))
+			case code == Option6StatusCode:
+				status(data)
+			}
+		})
+	}
+	return a
+}
+
+// exchange sends a request from a socket listening on local, and passes each datagram received before the timeout to
+// fn, with the time since the request was sent. Cancelling the context takes effect at the timeout.
+func (p *Prober) exchange(ctx context.Context, x exchange, fn func(b []byte, from net.Addr, rtt time.Duration)) error {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		if err := control(c); err != nil {
+			return err
+		}
+		return (&sockopt.Options{Device: p.Interface}).Control(network, address, c)
+	}}
+	pc, err := lc.ListenPacket(ctx, x.network, x.local)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	pc.SetReadDeadline(deadline)
+	start := time.Now()
+	if _, err := pc.WriteTo(x.req, x.to); err != nil {
+		return err
+	}
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		fn(buf[:n], from, time.Since(start))
+	}
+}
+
+// exchange is a request, where to send it, and where to listen for responses.
+type exchange struct {
+	network, local string
+	to             *net.UDPAddr
+	req            []byte
+}
+
+// hardwareAddr returns the hardware address identifying the client.
+func (p *Prober) hardwareAddr() (net.HardwareAddr, error) {
+	if len(p.HardwareAddr) > 0 {
+		if len(p.HardwareAddr) < 4 || len(p.HardwareAddr) > 16 {
+			return nil, fmt.Errorf("invalid hardware address %v", p.HardwareAddr)
+		}
+		return p.HardwareAddr, nil
+	}
+	if p.Interface == "" {
+		return nil, errors.New("no interface or hardware address")
+	}
+	ifi, err := net.InterfaceByName(p.Interface)
+	if err != nil {
+		return nil, err
+	}
+	if len(ifi.HardwareAddr) < 4 {
+		return nil, fmt.Errorf("%s has no hardware address", p.Interface)
+	}
+	return ifi.HardwareAddr, nil
+}
+
+// server returns the address to send to.
+func (p *Prober) server(def string) string {
+	if p.Server != "" {
+		return p.Server
+	}
+	return def
+}
+
+// local returns the address to listen on.
+func (p *Prober) local(def string) string {
+	if p.Local != "" {
+		return p.Local
+	}
+	return def
+}
+
+// newXID returns a random transaction ID.
+func newXID() (uint32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
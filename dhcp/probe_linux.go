@@ -0,0 +1,26 @@
+// +build linux
+
+package dhcp
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// control allows the socket to broadcast, and to share the client port with other DHCP clients on the host.
+func control(c syscall.RawConn) error {
+	var sockErr error
+	if err := c.Control(func(fd uintptr) {
+		for _, opt := range []int{syscall.SO_BROADCAST, syscall.SO_REUSEADDR} {
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, opt, 1); sockErr != nil {
+				return
+			}
+		}
+	}); err != nil {
+		return fmt.Errorf("rawConn control err: %w", err)
+	}
+	if sockErr != nil {
+		return fmt.Errorf("setsockopt: %w", sockErr)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package dhcp
+
+import "syscall"
+
+// control is only implemented on Linux, so elsewhere the socket may be unable to broadcast.
+func control(c syscall.RawConn) error {
+	return nil
+}
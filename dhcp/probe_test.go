@@ -0,0 +1,190 @@
+package dhcp
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer answers each request read from pc with the responses built by reply, until pc is closed.
+func fakeServer(pc net.PacketConn, reply func(req []byte) [][]byte) {
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		for _, resp := range reply(buf[:n]) {
+			pc.WriteTo(resp, from)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer pc.Close()
+	routes, _ := MarshalRoutes([]Route{{
+		Destination: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+		Gateway:     net.IP{192, 0, 2, 1},
+	}})
+	go fakeServer(pc, func(b []byte) [][]byte {
+		req, err := ParseMessage(b)
+		if err != nil || req.Type() != MessageDiscover {
+			return nil
+		}
+		offer := func(server, addr byte) []byte {
+			return (&Message{
+				Op:           OpReply,
+				XID:          req.XID,
+				YourAddr:     net.IP{192, 0, 2, addr},
+				HardwareAddr: req.HardwareAddr,
+				Options: Options{
+					OptionMessageType:     {byte(MessageOffer)},
+					OptionServerID:        {192, 0, 2, server},
+					OptionSubnetMask:      {255, 255, 255, 0},
+					OptionRouter:          {192, 0, 2, 1},
+					OptionDNS:             {192, 0, 2, 53},
+					OptionDomainName:      []byte("example.net"),
+					OptionLeaseTime:       {0, 0, 0x0e, 0x10},
+					OptionClasslessRoutes: routes,
+				},
+			}).Marshal()
+		}
+		// A stale reply with the wrong transaction ID is ignored, and both servers' offers are collected.
+		stale := &Message{Op: OpReply, XID: req.XID + 1, Options: Options{OptionMessageType: {byte(MessageOffer)}}}
+		return [][]byte{stale.Marshal(), offer(2, 100), offer(3, 200)}
+	})
+
+	p := &Prober{
+		HardwareAddr: net.HardwareAddr{0x02, 0, 0x5e, 0x10, 0, 1},
+		Server:       pc.LocalAddr().String(),
+		Local:        "127.0.0.1:0",
+		Timeout:      200 * time.Millisecond,
+	}
+	offers, err := p.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	type summary struct {
+		Server, Address, Mask, Domain string
+		Routers, DNS                  []net.IP
+		Lease                         time.Duration
+		Routes                        []string
+	}
+	var got []summary
+	for _, o := range offers {
+		if o.RTT <= 0 || o.From == nil {
+			t.Errorf("got rtt %v from %v", o.RTT, o.From)
+		}
+		s := summary{o.Server.String(), o.Address.String(), o.SubnetMask.String(), o.Domain, o.Routers, o.DNS,
+			o.Lease, nil}
+		for _, r := range o.Routes {
+			s.Routes = append(s.Routes, r.String())
+		}
+		got = append(got, s)
+	}
+	want := []summary{
+		{"192.0.2.2", "192.0.2.100", "ffffff00", "example.net", []net.IP{{192, 0, 2, 1}}, []net.IP{{192, 0, 2, 53}},
+			time.Hour, []string{"10.0.0.0/8 via 192.0.2.1"}},
+		{"192.0.2.3", "192.0.2.200", "ffffff00", "example.net", []net.IP{{192, 0, 2, 1}}, []net.IP{{192, 0, 2, 53}},
+			time.Hour, []string{"10.0.0.0/8 via 192.0.2.1"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	t.Run("NoResponse", func(t *testing.T) {
+		silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer silent.Close()
+		p := *p
+		p.Server = silent.LocalAddr().String()
+		if _, err := p.Discover(context.Background()); err != ErrNoResponse {
+			t.Fatalf("got %v, want %v", err, ErrNoResponse)
+		}
+	})
+}
+
+func TestSolicit(t *testing.T) {
+	pc, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	defer pc.Close()
+	go fakeServer(pc, func(b []byte) [][]byte {
+		req, err := ParseMessage6(b)
+		if err != nil || req.Type != MessageSolicit {
+			return nil
+		}
+		iaaddr := appendOption6(nil, Option6IAAddr, append(net.ParseIP("2001:db8::100"), 0, 0, 0x0e, 0x10, 0, 0, 0x1c, 0x20))
+		full := append(append([]byte(nil), req.Options[Option6IANA][:4]...), make([]byte, 8)...)
+		full = appendOption6(full, Option6StatusCode, append([]byte{0, byte(StatusNoAddrsAvail)}, "pool full"...))
+		return [][]byte{
+			(&Message6{Type: MessageAdvertise, XID: req.XID, Options: Options6{
+				Option6ClientID:   req.Options[Option6ClientID],
+				Option6ServerID:   {0, 3, 0, 1, 2, 0, 0x5e, 0, 0, 1},
+				Option6IANA:       append(append([]byte(nil), req.Options[Option6IANA]...), iaaddr...),
+				Option6Preference: {255},
+				Option6DNS:        net.ParseIP("2001:db8::53"),
+			}}).Marshal(),
+			(&Message6{Type: MessageAdvertise, XID: req.XID, Options: Options6{
+				Option6ClientID: req.Options[Option6ClientID],
+				Option6ServerID: {0, 3, 0, 1, 2, 0, 0x5e, 0, 0, 2},
+				Option6IANA:     full,
+			}}).Marshal(),
+		}
+	})
+
+	p := &Prober{
+		HardwareAddr: net.HardwareAddr{0x02, 0, 0x5e, 0x10, 0, 1},
+		Server:       pc.LocalAddr().String(),
+		Local:        "[::1]:0",
+		Timeout:      200 * time.Millisecond,
+	}
+	ads, err := p.Solicit(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	type summary struct {
+		Server        []byte
+		Addresses     []net.IP
+		Status        Status6
+		StatusMessage string
+		Preference    int
+		DNS           []net.IP
+	}
+	var got []summary
+	for _, a := range ads {
+		got = append(got, summary{a.Server, a.Addresses, a.Status, a.StatusMessage, a.Preference, a.DNS})
+	}
+	want := []summary{
+		{
+			Server:     []byte{0, 3, 0, 1, 2, 0, 0x5e, 0, 0, 1},
+			Addresses:  []net.IP{net.ParseIP("2001:db8::100")},
+			Preference: 255,
+			DNS:        []net.IP{net.ParseIP("2001:db8::53")},
+		},
+		{
+			Server:        []byte{0, 3, 0, 1, 2, 0, 0x5e, 0, 0, 2},
+			Status:        StatusNoAddrsAvail,
+			StatusMessage: "pool full",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	t.Run("NeedsInterface", func(t *testing.T) {
+		p := &Prober{HardwareAddr: p.HardwareAddr}
+		if _, err := p.Solicit(context.Background()); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+}
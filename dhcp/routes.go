@@ -0,0 +1,69 @@
+package dhcp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Option codes carrying classless static routes.
+const (
+	OptionClasslessRoutes   = 121 // RFC 3442.
+	OptionMSClasslessRoutes = 249 // Microsoft's code for the same encoding, used by older Windows clients.
+)
+
+// Route is a classless static route. A Gateway of 0.0.0.0 means the destination is on the link.
+type Route struct {
+	Destination *net.IPNet
+	Gateway     net.IP
+}
+
+// String formats the route as destination via gateway.
+func (r Route) String() string {
+	return fmt.Sprintf("%v via %v", r.Destination, r.Gateway)
+}
+
+// MarshalRoutes encodes routes as the value of a classless static route option: for each, the prefix length, the
+// significant octets of the destination, and the gateway. The encoding is limited to IPv4.
+func MarshalRoutes(routes []Route) ([]byte, error) {
+	var b []byte
+	for _, r := range routes {
+		if r.Destination == nil {
+			return nil, errors.New("route without destination")
+		}
+		ones, bits := r.Destination.Mask.Size()
+		dst, gw := r.Destination.IP.To4(), r.Gateway.To4()
+		if bits != 8*net.IPv4len || dst == nil {
+			return nil, fmt.Errorf("%v: destination is not IPv4", r)
+		}
+		if gw == nil {
+			return nil, fmt.Errorf("%v: gateway is not IPv4", r)
+		}
+		b = append(b, byte(ones))
+		b = append(b, dst.Mask(r.Destination.Mask)[:(ones+7)/8]...)
+		b = append(b, gw...)
+	}
+	return b, nil
+}
+
+// UnmarshalRoutes decodes the value of a classless static route option.
+func UnmarshalRoutes(b []byte) ([]Route, error) {
+	var routes []Route
+	for len(b) > 0 {
+		ones := int(b[0])
+		if ones > 8*net.IPv4len {
+			return nil, fmt.Errorf("invalid prefix length %d", ones)
+		}
+		n := (ones + 7) / 8
+		if len(b) < 1+n+net.IPv4len {
+			return nil, errors.New("truncated route")
+		}
+		dst := make(net.IP, net.IPv4len)
+		copy(dst, b[1:1+n])
+		mask := net.CIDRMask(ones, 8*net.IPv4len)
+		gw := append(net.IP(nil), b[1+n:1+n+net.IPv4len]...)
+		routes = append(routes, Route{Destination: &net.IPNet{IP: dst.Mask(mask), Mask: mask}, Gateway: gw})
+		b = b[1+n+net.IPv4len:]
+	}
+	return routes, nil
+}
@@ -0,0 +1,85 @@
+package dhcp
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	route := func(dst, gw string) Route {
+		_, pfx, err := net.ParseCIDR(dst)
+		if err != nil {
+			panic(err)
+		}
+		return Route{Destination: pfx, Gateway: net.ParseIP(gw).To4()}
+	}
+
+	tests := map[string]struct {
+		routes []Route
+		want   []byte
+	}{
+		// The destination encodings are the examples of RFC 3442 section 3.
+		"RFC3442": {
+			routes: []Route{
+				route("0.0.0.0/0", "192.0.2.1"),
+				route("10.0.0.0/8", "192.0.2.1"),
+				route("10.0.0.0/24", "192.0.2.1"),
+				route("10.17.0.0/16", "192.0.2.1"),
+				route("10.27.129.0/24", "192.0.2.1"),
+				route("10.229.0.128/25", "192.0.2.1"),
+				route("10.198.122.47/32", "0.0.0.0"),
+			},
+			want: []byte{
+				0, 192, 0, 2, 1,
+				8, 10, 192, 0, 2, 1,
+				24, 10, 0, 0, 192, 0, 2, 1,
+				16, 10, 17, 192, 0, 2, 1,
+				24, 10, 27, 129, 192, 0, 2, 1,
+				25, 10, 229, 0, 128, 192, 0, 2, 1,
+				32, 10, 198, 122, 47, 0, 0, 0, 0,
+			},
+		},
+		"Empty": {},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := MarshalRoutes(test.routes)
+			if err != nil {
+				t.Fatalf("marshal err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, b); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			routes, err := UnmarshalRoutes(b)
+			if err != nil {
+				t.Fatalf("unmarshal err: %v", err)
+			}
+			if diff := cmp.Diff(test.routes, routes); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestRoutesErrors(t *testing.T) {
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	for name, routes := range map[string][]Route{
+		"IPv6":      {{Destination: v6, Gateway: net.ParseIP("192.0.2.1")}},
+		"NoGateway": {{Destination: v4}},
+		"NoDest":    {{Gateway: net.ParseIP("192.0.2.1")}},
+	} {
+		if _, err := MarshalRoutes(routes); err == nil {
+			t.Errorf("%s: marshal got no error", name)
+		}
+	}
+	for name, b := range map[string][]byte{
+		"Length":    {33, 10, 0, 0, 0, 0, 192, 0, 2, 1},
+		"Truncated": {24, 10, 0, 0, 192, 0, 2},
+	} {
+		if _, err := UnmarshalRoutes(b); err == nil {
+			t.Errorf("%s: unmarshal got no error", name)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package dnsutil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultWorkers is the number of lookups a BulkPTR has in flight at once if Workers is not set.
+const DefaultWorkers = 16
+
+// PTRResult is the outcome of a reverse lookup of a single address by a BulkPTR. Addresses without a PTR record
+// commonly fail with an error matching ErrNXDomain, which callers annotating output will usually ignore.
+type PTRResult struct {
+	IP     net.IP
+	Hosts  []Host
+	Server string // The server that answered, or that the last attempt was sent to.
+	Err    error
+}
+
+// BulkPTR resolves large numbers of addresses to names, spreading the queries over a set of resolvers while limiting
+// both the number in flight and the rate each resolver receives, so that annotating a traceroute, a flow export or the
+// output of a scan does not trip the rate limits of a shared resolver.
+type BulkPTR struct {
+	Clients []*Client // The resolvers to use, in turn.
+	Workers int       // The number of lookups in flight at once, or DefaultWorkers if zero.
+	Rate    float64   // The most queries per second sent to each resolver, or unlimited if zero.
+}
+
+// NewBulkPTR returns a BulkPTR using the default number of workers, that sends at most rate queries per second to each
+// of the given resolvers.
+func NewBulkPTR(rate float64, clients ...*Client) *BulkPTR {
+	return &BulkPTR{Clients: clients, Workers: DefaultWorkers, Rate: rate}
+}
+
+// Resolve starts resolving every address received from in, delivering the results on the returned channel in the order
+// the lookups complete. The channel is closed once in is closed and every lookup has finished, or once ctx is done.
+func (b *BulkPTR) Resolve(ctx context.Context, in <-chan net.IP) <-chan PTRResult {
+	out := make(chan PTRResult)
+	if len(b.Clients) == 0 {
+		go func() {
+			defer close(out)
+			for ip := range in {
+				select {
+				case out <- PTRResult{IP: ip, Err: errors.New("no resolvers")}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out
+	}
+
+	limiters := make([]*limiter, len(b.Clients))
+	for i := range limiters {
+		limiters[i] = newLimiter(b.Rate)
+	}
+
+	workers := b.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		next int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var ip net.IP
+				select {
+				case v, ok := <-in:
+					if !ok {
+						return
+					}
+					ip = v
+				case <-ctx.Done():
+					return
+				}
+
+				// Take the resolvers in turn, so that the load is spread evenly whatever their speed.
+				mu.Lock()
+				n := next
+				next = (next + 1) % len(b.Clients)
+				mu.Unlock()
+
+				result := PTRResult{IP: ip, Server: b.Clients[n].address()}
+				if result.Err = limiters[n].wait(ctx); result.Err == nil {
+					result.Hosts, result.Err = b.Clients[n].LookupPTR(ctx, ip)
+				}
+				select {
+				case out <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// ResolveAll resolves a list of addresses, returning the results in the same order as the addresses.
+func (b *BulkPTR) ResolveAll(ctx context.Context, ips []net.IP) []PTRResult {
+	in := make(chan net.IP)
+	go func() {
+		defer close(in)
+		for _, ip := range ips {
+			select {
+			case in <- ip:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Results arrive in completion order, so put them back in place by address. The same address may be listed more
+	// than once, in which case each copy gets the same result.
+	byIP := make(map[string]PTRResult, len(ips))
+	for r := range b.Resolve(ctx, in) {
+		byIP[string(r.IP.To16())] = r
+	}
+	results := make([]PTRResult, len(ips))
+	for i, ip := range ips {
+		r, ok := byIP[string(ip.To16())]
+		if !ok {
+			r = PTRResult{IP: ip, Err: ctx.Err()}
+		}
+		results[i] = r
+	}
+	return results
+}
+
+// ResolvePrefixes resolves every address within the given prefixes, delivering the results in the order of the
+// prefixes and of the addresses within them. Large prefixes, particularly IPv6 ones, contain far too many addresses to
+// finish, so callers should bound the work with ctx.
+func (b *BulkPTR) ResolvePrefixes(ctx context.Context, pfxs []*net.IPNet) <-chan PTRResult {
+	workers := b.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	// Addresses are queued in the order they are sent, and the results of those that finish early are held back until
+	// those before them have been delivered. Only so many may be waiting, so that a slow lookup does not leave the
+	// rest of a large prefix piling up behind it.
+	var (
+		mu    sync.Mutex
+		queue []string
+	)
+	window := make(chan struct{}, 4*workers)
+	in := make(chan net.IP)
+	go func() {
+		defer close(in)
+		for ip := range Addresses(ctx, pfxs) {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			mu.Lock()
+			queue = append(queue, string(ip.To16()))
+			mu.Unlock()
+			select {
+			case in <- ip:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	out := make(chan PTRResult)
+	go func() {
+		defer close(out)
+		// Overlapping prefixes list the same address more than once, so each may have several results waiting.
+		waiting := map[string][]PTRResult{}
+		for r := range b.Resolve(ctx, in) {
+			key := string(r.IP.To16())
+			waiting[key] = append(waiting[key], r)
+			for {
+				mu.Lock()
+				if len(queue) == 0 || len(waiting[queue[0]]) == 0 {
+					mu.Unlock()
+					break
+				}
+				key := queue[0]
+				queue = queue[1:]
+				mu.Unlock()
+
+				next := waiting[key][0]
+				if waiting[key] = waiting[key][1:]; len(waiting[key]) == 0 {
+					delete(waiting, key)
+				}
+				select {
+				case out <- next:
+				case <-ctx.Done():
+					return
+				}
+				<-window
+			}
+		}
+	}()
+	return out
+}
+
+// Addresses returns a channel delivering every address within the given prefixes in turn, which is closed after the
+// last one, or once ctx is done.
+func Addresses(ctx context.Context, pfxs []*net.IPNet) <-chan net.IP {
+	out := make(chan net.IP)
+	go func() {
+		defer close(out)
+		for _, pfx := range pfxs {
+			ip := pfx.IP.Mask(pfx.Mask)
+			if ip == nil {
+				continue
+			}
+			for ; pfx.Contains(ip); ip = nextIP(ip) {
+				select {
+				case out <- ip:
+				case <-ctx.Done():
+					return
+				}
+				// Stop at the end of the address space rather than wrapping around to the start.
+				if isLast(ip) {
+					break
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// nextIP returns the address following ip, wrapping around after the last address.
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// isLast reports whether ip is the last address of its family.
+func isLast(ip net.IP) bool {
+	for _, b := range ip {
+		if b != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// limiter spaces out events so that no more than a given number happen each second. It allows no bursts, as a resolver
+// is more likely to object to a burst than to a steady rate.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newLimiter returns a limiter allowing rate events per second, or any number if rate is not positive.
+func newLimiter(rate float64) *limiter {
+	l := &limiter{}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+// wait blocks until the next event is allowed, or until ctx is done.
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+
+	// Reserve the next slot, so that concurrent waiters queue behind each other.
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,493 @@
+package dnsutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/sockopt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Defaults used by NewClient.
+const (
+	DefaultTimeout = 2 * time.Second
+	DefaultRetries = 2
+)
+
+// maxTCPLen is the largest message that can be framed over TCP.
+const maxTCPLen = 0xffff
+
+// Errors matched by RCodeError, so that errors.Is can be used to check for common failures.
+var (
+	ErrNXDomain   = errors.New("no such domain")
+	ErrServerFail = errors.New("server failure")
+	ErrRefused    = errors.New("query refused")
+)
+
+// rcodeNames are the mnemonics of the common response codes.
+var rcodeNames = map[int]string{
+	RCodeSuccess:        "NOERROR",
+	RCodeFormatError:    "FORMERR",
+	RCodeServerFailure:  "SERVFAIL",
+	RCodeNameError:      "NXDOMAIN",
+	RCodeNotImplemented: "NOTIMP",
+	RCodeRefused:        "REFUSED",
+	RCodeBadVersion:     "BADVERS",
+}
+
+// RCodeString returns the mnemonic of a response code, such as NXDOMAIN.
+func RCodeString(rcode int) string {
+	if s, ok := rcodeNames[rcode]; ok {
+		return s
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// RCodeError is returned when a server answers with an unsuccessful response code.
+type RCodeError struct {
+	Name   string
+	Server string
+	RCode  int
+}
+
+// Error satisfies the error interface.
+func (e *RCodeError) Error() string {
+	return fmt.Sprintf("dnsutil: lookup %s on %s: %s", e.Name, e.Server, RCodeString(e.RCode))
+}
+
+// Is allows the error to be matched against ErrNXDomain, ErrServerFail and ErrRefused with errors.Is.
+func (e *RCodeError) Is(target error) bool {
+	switch target {
+	case ErrNXDomain:
+		return e.RCode == RCodeNameError
+	case ErrServerFail:
+		return e.RCode == RCodeServerFailure
+	case ErrRefused:
+		return e.RCode == RCodeRefused
+	}
+	return false
+}
+
+// Client sends queries to a single, explicitly chosen server, rather than whatever the system is configured to use.
+// The zero value of each field other than Server is usable, but NewClient provides better defaults.
+type Client struct {
+	Server      string        // The host and port of the server; a bare address uses port 53.
+	Timeout     time.Duration // The time allowed for each attempt, or DefaultTimeout if zero.
+	Retries     int           // The number of times an unanswered UDP query is sent again.
+	TCP         bool          // Always use TCP, rather than only when a UDP response is truncated.
+	NoRecursion bool          // Clear the recursion desired flag, as is usual when querying an authoritative server.
+	EDNS        *EDNS         // Attached to every query, unless nil.
+	// Source is the address queries are sent from, or nil to let the host choose. It is checked against the server
+	// and Socket.Device with sockopt.CheckSource.
+	Source net.IP
+	Socket sockopt.Options // Steers queries, such as by binding to a VRF device.
+
+	// Transport carries queries instead of plain DNS over UDP and TCP if set, in which case Server only names the
+	// server in errors and the other transport fields are unused.
+	Transport Transport
+}
+
+// Transport carries a query to a server and returns the response and the round-trip time, without treating an
+// unsuccessful response code as an error. A Client is itself a Transport using plain DNS.
+type Transport interface {
+	Exchange(ctx context.Context, query *Message) (*Message, time.Duration, error)
+}
+
+// NewClient returns a Client for server, with the default timeout and retries, and EDNS enabled with the default UDP
+// payload size.
+func NewClient(server string) *Client {
+	return &Client{
+		Server:  server,
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		EDNS:    &EDNS{UDPSize: DefaultUDPSize},
+	}
+}
+
+// address returns the server address with a port, or the server as given if a transport is set.
+func (c *Client) address() string {
+	if c.Transport != nil {
+		return c.Server
+	}
+	return withPort(c.Server, "53")
+}
+
+// withPort returns server with the given port, unless it already has one.
+func withPort(server, port string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), port)
+}
+
+// NewQuery returns a query for name and qtype in the Internet class, with the flags and EDNS of the client.
+func (c *Client) NewQuery(name string, qtype uint16) *Message {
+	return &Message{
+		RecursionDesired: !c.NoRecursion,
+		Questions:        []Question{{Name: Fqdn(name), Type: qtype, Class: ClassINET}},
+		EDNS:             c.EDNS,
+	}
+}
+
+// Exchange sends a query and returns the response and the round-trip time of the attempt that was answered. The ID
+// of the query is replaced with a random one. Unless the client has a transport, UDP is used unless the client says
+// otherwise, falling back to TCP if the response is truncated. An unsuccessful response code is not treated as an
+// error.
+func (c *Client) Exchange(ctx context.Context, query *Message) (*Message, time.Duration, error) {
+	q := *query
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, 0, err
+	}
+	q.ID = binary.BigEndian.Uint16(id[:])
+	if c.Transport != nil {
+		return c.Transport.Exchange(ctx, &q)
+	}
+	b, err := q.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !c.TCP {
+		resp, rtt, err := c.exchangeUDP(ctx, &q, b)
+		if err != nil || !resp.Truncated {
+			return resp, rtt, err
+		}
+	}
+	return c.exchangeTCP(ctx, &q, b)
+}
+
+// timeout returns the time allowed for each attempt.
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+// exchangeUDP sends a packed query over UDP, retrying if no response arrives in time.
+func (c *Client) exchangeUDP(ctx context.Context, q *Message, b []byte) (*Message, time.Duration, error) {
+	conn, err := c.dial(ctx, "udp")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxTCPLen)
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		conn.SetDeadline(deadline(ctx, start.Add(c.timeout())))
+		if _, err := conn.Write(b); err != nil {
+			return nil, 0, contextErr(ctx, err)
+		}
+
+		resp, err := readMatching(conn, q, buf)
+		if err == nil {
+			return resp, time.Since(start), nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() || attempt >= c.Retries || ctx.Err() != nil {
+			return nil, 0, contextErr(ctx, err)
+		}
+	}
+}
+
+// dial connects to the server from the source address, if there is one.
+func (c *Client) dial(ctx context.Context, network string) (net.Conn, error) {
+	d := net.Dialer{Control: c.Socket.Control}
+	if c.Source != nil {
+		if network == "udp" {
+			d.LocalAddr = &net.UDPAddr{IP: c.Source}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: c.Source}
+		}
+	}
+	conn, err := d.DialContext(ctx, network, c.address())
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if err := sockopt.CheckSource(c.Source, net.ParseIP(host), c.Socket.Device); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// readMatching reads datagrams until one is a response to the query, ignoring any that are not, as they may be late
+// responses to earlier attempts or spoofed.
+func readMatching(conn net.Conn, q *Message, buf []byte) (*Message, error) {
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := Unpack(buf[:n])
+		if err != nil || !isResponse(q, resp) {
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// exchangeTCP sends a packed query over TCP, as a single attempt.
+func (c *Client) exchangeTCP(ctx context.Context, q *Message, b []byte) (*Message, time.Duration, error) {
+	if len(b) > maxTCPLen {
+		return nil, 0, fmt.Errorf("query too long: %d bytes", len(b))
+	}
+	start := time.Now()
+	conn, err := c.dial(ctx, "tcp")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline(ctx, start.Add(c.timeout())))
+
+	if err := WriteTCP(conn, b); err != nil {
+		return nil, 0, contextErr(ctx, err)
+	}
+	for {
+		msg, err := ReadTCP(conn)
+		if err != nil {
+			return nil, 0, contextErr(ctx, err)
+		}
+		resp, err := Unpack(msg)
+		if err != nil {
+			return nil, 0, err
+		}
+		if isResponse(q, resp) {
+			return resp, time.Since(start), nil
+		}
+	}
+}
+
+// WriteTCP writes a message to a stream, preceded by its length as DNS over TCP requires.
+func WriteTCP(w io.Writer, msg []byte) error {
+	b := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(b, uint16(len(msg)))
+	_, err := w.Write(append(b, msg...))
+	return err
+}
+
+// ReadTCP reads a length-prefixed message from a stream.
+func ReadTCP(r io.Reader) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// isResponse reports whether resp answers q, by matching the ID and question.
+func isResponse(q, resp *Message) bool {
+	if !resp.Response || resp.ID != q.ID || len(resp.Questions) != len(q.Questions) {
+		return false
+	}
+	for i := range q.Questions {
+		if !strings.EqualFold(q.Questions[i].Name, resp.Questions[i].Name) ||
+			q.Questions[i].Type != resp.Questions[i].Type || q.Questions[i].Class != resp.Questions[i].Class {
+			return false
+		}
+	}
+	return true
+}
+
+// contextErr returns the error of ctx if it is done, as that explains a timeout better than the error it caused. The
+// socket deadline can expire fractionally before the context notices, so a passed deadline counts as done.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// deadline returns the earlier of t and the deadline of ctx.
+func deadline(ctx context.Context, t time.Time) time.Time {
+	if d, ok := ctx.Deadline(); ok && d.Before(t) {
+		return d
+	}
+	return t
+}
+
+// Query sends a query for name and qtype, returning the response, or an RCodeError if the response code was not
+// successful.
+func (c *Client) Query(ctx context.Context, name string, qtype uint16) (*Message, error) {
+	resp, _, err := c.Exchange(ctx, c.NewQuery(name, qtype))
+	if err != nil {
+		return nil, err
+	}
+	if resp.RCode != RCodeSuccess {
+		return resp, &RCodeError{Name: Fqdn(name), Server: c.address(), RCode: resp.RCode}
+	}
+	return resp, nil
+}
+
+// Address is an address found by LookupA or LookupAAAA.
+type Address struct {
+	IP  net.IP
+	TTL time.Duration
+}
+
+// Host is a host name found by LookupPTR or LookupNS.
+type Host struct {
+	Name string
+	TTL  time.Duration
+}
+
+// Text is a record found by LookupTXT. The strings of the record are concatenated, as is usual for SPF and others.
+type Text struct {
+	Text string
+	TTL  time.Duration
+}
+
+// Answers returns the records of qtype answering a query for name, following any CNAME records in the answer section.
+func Answers(resp *Message, name string, qtype uint16) []RR {
+	// Collect every name that the query name is an alias of.
+	owners := map[string]bool{strings.ToLower(Fqdn(name)): true}
+	for changed := true; changed; {
+		changed = false
+		for _, rr := range resp.Answers {
+			cname, ok := rr.Data.(*CNAME)
+			if !ok || !owners[strings.ToLower(rr.Name)] || owners[strings.ToLower(cname.Target)] {
+				continue
+			}
+			owners[strings.ToLower(cname.Target)] = true
+			changed = true
+		}
+	}
+
+	var result []RR
+	for _, rr := range resp.Answers {
+		if rr.Type == qtype && owners[strings.ToLower(rr.Name)] {
+			result = append(result, rr)
+		}
+	}
+	return result
+}
+
+// lookup queries for name and qtype, and returns the matching answers.
+func (c *Client) lookup(ctx context.Context, name string, qtype uint16) ([]RR, error) {
+	resp, err := c.Query(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return Answers(resp, name, qtype), nil
+}
+
+// LookupA returns the IPv4 addresses of name. A name with no addresses is not an error, and returns none.
+func (c *Client) LookupA(ctx context.Context, name string) ([]Address, error) {
+	rrs, err := c.lookup(ctx, name, TypeA)
+	if err != nil {
+		return nil, err
+	}
+	var result []Address
+	for _, rr := range rrs {
+		if a, ok := rr.Data.(*A); ok {
+			result = append(result, Address{IP: a.IP, TTL: ttl(rr)})
+		}
+	}
+	return result, nil
+}
+
+// LookupAAAA returns the IPv6 addresses of name. A name with no addresses is not an error, and returns none.
+func (c *Client) LookupAAAA(ctx context.Context, name string) ([]Address, error) {
+	rrs, err := c.lookup(ctx, name, TypeAAAA)
+	if err != nil {
+		return nil, err
+	}
+	var result []Address
+	for _, rr := range rrs {
+		if a, ok := rr.Data.(*AAAA); ok {
+			result = append(result, Address{IP: a.IP, TTL: ttl(rr)})
+		}
+	}
+	return result, nil
+}
+
+// LookupPTR returns the names the address maps back to.
+func (c *Client) LookupPTR(ctx context.Context, ip net.IP) ([]Host, error) {
+	name, err := ReverseName(ip)
+	if err != nil {
+		return nil, err
+	}
+	rrs, err := c.lookup(ctx, name, TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	var result []Host
+	for _, rr := range rrs {
+		if ptr, ok := rr.Data.(*PTR); ok {
+			result = append(result, Host{Name: ptr.Host, TTL: ttl(rr)})
+		}
+	}
+	return result, nil
+}
+
+// LookupNS returns the name servers of name.
+func (c *Client) LookupNS(ctx context.Context, name string) ([]Host, error) {
+	rrs, err := c.lookup(ctx, name, TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	var result []Host
+	for _, rr := range rrs {
+		if ns, ok := rr.Data.(*NS); ok {
+			result = append(result, Host{Name: ns.Host, TTL: ttl(rr)})
+		}
+	}
+	return result, nil
+}
+
+// LookupTXT returns the TXT records of name.
+func (c *Client) LookupTXT(ctx context.Context, name string) ([]Text, error) {
+	rrs, err := c.lookup(ctx, name, TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	var result []Text
+	for _, rr := range rrs {
+		if txt, ok := rr.Data.(*TXT); ok {
+			result = append(result, Text{Text: strings.Join(txt.Strings, ""), TTL: ttl(rr)})
+		}
+	}
+	return result, nil
+}
+
+// ttl returns the TTL of a record as a duration.
+func ttl(rr RR) time.Duration {
+	return time.Duration(rr.TTL) * time.Second
+}
+
+// ReverseName returns the name under in-addr.arpa or ip6.arpa used to look up the PTR records of an address.
+func ReverseName(ip net.IP) (string, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return "", fmt.Errorf("invalid address %v", ip)
+	}
+	const hex = "0123456789abcdef"
+	var sb strings.Builder
+	for i := len(ip16) - 1; i >= 0; i-- {
+		sb.WriteByte(hex[ip16[i]&0xf])
+		sb.WriteByte('.')
+		sb.WriteByte(hex[ip16[i]>>4])
+		sb.WriteByte('.')
+	}
+	sb.WriteString("ip6.arpa.")
+	return sb.String(), nil
+}
@@ -0,0 +1,817 @@
+package dnsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	msg := &Message{
+		ID:                 0xbeef,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   true,
+		RecursionAvailable: true,
+		RCode:              RCodeBadVersion,
+		Questions:          []Question{{Name: "www.example.com.", Type: TypeA, Class: ClassINET}},
+		Answers: []RR{
+			{Name: "www.example.com.", Type: TypeCNAME, Class: ClassINET, TTL: 60,
+				Data: &CNAME{Target: "web.Example.com."}},
+			{Name: "web.example.com.", Type: TypeA, Class: ClassINET, TTL: 300,
+				Data: &A{IP: net.IP{192, 0, 2, 1}}},
+			{Name: "web.example.com.", Type: TypeAAAA, Class: ClassINET, TTL: 300,
+				Data: &AAAA{IP: net.ParseIP("2001:db8::1")}},
+			{Name: "example.com.", Type: TypeMX, Class: ClassINET, TTL: 3600,
+				Data: &MX{Preference: 10, Host: "mail.example.com."}},
+			{Name: "example.com.", Type: TypeTXT, Class: ClassINET, TTL: 3600,
+				Data: &TXT{Strings: []string{"v=spf1 -all", ""}}},
+			{Name: "_sip._udp.example.com.", Type: TypeSRV, Class: ClassINET, TTL: 3600,
+				Data: &SRV{Priority: 1, Weight: 2, Port: 5060, Target: "sip.example.net."}},
+			{Name: `odd\.label\032here.example.com.`, Type: 65280, Class: ClassINET, TTL: 1,
+				Data: &Unknown{RRType: 65280, Data: []byte{1, 2, 3}}},
+		},
+		Authority: []RR{
+			{Name: "example.com.", Type: TypeSOA, Class: ClassINET, TTL: 3600, Data: &SOA{
+				MName: "ns1.example.com.", RName: "hostmaster.example.com.", Serial: 2021030101,
+				Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300,
+			}},
+		},
+		Additional: []RR{
+			{Name: "ns1.example.com.", Type: TypeNS, Class: ClassINET, TTL: 3600, Data: &NS{Host: "ns1.example.com."}},
+		},
+		EDNS: &EDNS{UDPSize: 4096, DNSSECOK: true, Options: []EDNSOption{{Code: OptionNSID, Data: []byte("ns1")}}},
+	}
+
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack err: %v", err)
+	}
+	// Compression should make repeated names much shorter than writing them out in full.
+	if count := strings.Count(string(b), "\x07example\x03com\x00"); count != 1 {
+		t.Fatalf("example.com written %d times, want once", count)
+	}
+
+	got, err := Unpack(b)
+	if err != nil {
+		t.Fatalf("unpack err: %v", err)
+	}
+	if diff := cmp.Diff(msg, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	header := []byte{0, 1, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}
+	tests := map[string][]byte{
+		"ShortHeader":  header[:11],
+		"ShortName":    append(append([]byte{}, header...), 3, 'w', 'w'),
+		"PointerLoop":  append(append([]byte{}, header...), 0xc0, 12, 0, 1, 0, 1),
+		"NoQuestionTC": append(append([]byte{}, header...), 0),
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Unpack(b); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestClientSubnet(t *testing.T) {
+	tests := map[string]struct {
+		prefix string
+		want   []byte
+	}{
+		"IPv4":      {"192.0.2.77/24", []byte{0, 1, 24, 0, 192, 0, 2}},
+		"IPv4Odd":   {"198.51.100.0/22", []byte{0, 1, 22, 0, 198, 51, 100}},
+		"IPv6":      {"2001:db8:1234::/48", []byte{0, 2, 48, 0, 0x20, 0x01, 0x0d, 0xb8, 0x12, 0x34}},
+		"Anonymous": {"0.0.0.0/0", []byte{0, 1, 0, 0}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, pfx, _ := net.ParseCIDR(tc.prefix)
+			opt, err := (&ClientSubnet{Prefix: pfx}).Option()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, opt.Data); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			cs, err := ParseClientSubnet(&opt)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			if cs.Prefix.String() != pfx.String() {
+				t.Fatalf("got %v, want %v", cs.Prefix, pfx)
+			}
+		})
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":   "1.2.0.192.in-addr.arpa.",
+		"2001:db8::1": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+	}
+	for ip, want := range tests {
+		if got, err := ReverseName(net.ParseIP(ip)); err != nil || got != want {
+			t.Fatalf("%s: got %q, err %v, want %q", ip, got, err, want)
+		}
+	}
+}
+
+// testServer answers queries on the same loopback port over both UDP and TCP, using handler to build the response.
+func testServer(t *testing.T, handler func(q *Message, tcp bool) *Message) string {
+	var udp net.PacketConn
+	var tcp net.Listener
+	for attempt := 0; ; attempt++ {
+		var err error
+		if udp, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatalf("listen udp err: %v", err)
+		}
+		if tcp, err = net.Listen("tcp", udp.LocalAddr().String()); err == nil {
+			break
+		}
+		udp.Close()
+		if attempt > 10 {
+			t.Fatalf("listen tcp err: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	respond := func(b []byte, tcp bool) []byte {
+		return testRespond(b, func(q *Message) *Message { return handler(q, tcp) })
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if out := respond(buf[:n], false); out != nil {
+				udp.WriteTo(out, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				b, err := ReadTCP(conn)
+				if err != nil {
+					return
+				}
+				if out := respond(b, true); out != nil {
+					WriteTCP(conn, out)
+				}
+			}()
+		}
+	}()
+
+	return udp.LocalAddr().String()
+}
+
+// testRespond answers a packed query using handler to build the response, returning nil if there is to be none.
+func testRespond(b []byte, handler func(q *Message) *Message) []byte {
+	q, err := Unpack(b)
+	if err != nil {
+		return nil
+	}
+	resp := handler(q)
+	if resp == nil {
+		return nil
+	}
+	resp.ID, resp.Response, resp.Questions = q.ID, true, q.Questions
+	out, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func TestClient(t *testing.T) {
+	var dropped bool
+	server := testServer(t, func(q *Message, tcp bool) *Message {
+		name, resp := q.Questions[0].Name, &Message{}
+		switch {
+		case name == "nxdomain.example.":
+			resp.RCode = RCodeNameError
+		case name == "big.example." && !tcp:
+			resp.Truncated = true
+		case name == "big.example.":
+			for i := 0; i < 100; i++ {
+				resp.Answers = append(resp.Answers, RR{Name: name, Type: TypeA, Class: ClassINET, TTL: 60,
+					Data: &A{IP: net.IP{192, 0, 2, byte(i)}}})
+			}
+		case name == "silent.example.":
+			return nil
+		case name == "lossy.example." && !dropped:
+			// Drop the first attempt, so that it has to be retried.
+			dropped = true
+			return nil
+		case q.Questions[0].Type == TypeTXT:
+			resp.Answers = []RR{{Name: name, Type: TypeTXT, Class: ClassINET, TTL: 30,
+				Data: &TXT{Strings: []string{"v=spf1 ", "-all"}}}}
+		case q.Questions[0].Type == TypePTR:
+			resp.Answers = []RR{{Name: name, Type: TypePTR, Class: ClassINET, TTL: 86400,
+				Data: &PTR{Host: "host.example."}}}
+		default:
+			// Answer via an alias, echoing any client subnet back with a scope.
+			resp.Answers = []RR{
+				{Name: name, Type: TypeCNAME, Class: ClassINET, TTL: 10, Data: &CNAME{Target: "alias.example."}},
+				{Name: "alias.example.", Type: TypeA, Class: ClassINET, TTL: 20, Data: &A{IP: net.IP{192, 0, 2, 1}}},
+				{Name: "unrelated.example.", Type: TypeA, Class: ClassINET, TTL: 20, Data: &A{IP: net.IP{192, 0, 2, 2}}},
+			}
+			if q.EDNS != nil {
+				resp.EDNS = &EDNS{UDPSize: DefaultUDPSize}
+				if opt := q.EDNS.Option(OptionClientSubnet); opt != nil {
+					cs, _ := ParseClientSubnet(opt)
+					cs.ScopeLength = 16
+					echo, _ := cs.Option()
+					resp.EDNS.Options = []EDNSOption{echo}
+				}
+			}
+		}
+		return resp
+	})
+
+	c := NewClient(server)
+	c.Timeout = 200 * time.Millisecond
+	ctx := context.Background()
+
+	t.Run("CNAME", func(t *testing.T) {
+		got, err := c.LookupA(ctx, "www.example")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		want := []Address{{IP: net.IP{192, 0, 2, 1}, TTL: 20 * time.Second}}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("Source", func(t *testing.T) {
+		for _, tcp := range []bool{false, true} {
+			src := *c
+			src.Source, src.TCP = net.IPv4(127, 0, 0, 1), tcp
+			if _, err := src.LookupA(ctx, "www.example"); err != nil {
+				t.Fatalf("tcp %v: err: %v", tcp, err)
+			}
+			src.Source = net.IPv6loopback
+			if _, err := src.LookupA(ctx, "www.example"); err == nil {
+				t.Fatalf("tcp %v: got no error from an IPv6 source", tcp)
+			}
+		}
+	})
+
+	t.Run("NXDOMAIN", func(t *testing.T) {
+		_, err := c.LookupA(ctx, "nxdomain.example")
+		if !errors.Is(err, ErrNXDomain) {
+			t.Fatalf("got %v, want nxdomain", err)
+		}
+	})
+
+	t.Run("TruncatedFallsBackToTCP", func(t *testing.T) {
+		got, err := c.LookupA(ctx, "big.example")
+		if err != nil || len(got) != 100 {
+			t.Fatalf("got %d addresses, err %v", len(got), err)
+		}
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		if _, err := c.LookupA(ctx, "lossy.example"); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	})
+
+	t.Run("TXT", func(t *testing.T) {
+		got, err := c.LookupTXT(ctx, "example")
+		if err != nil || len(got) != 1 || got[0].Text != "v=spf1 -all" || got[0].TTL != 30*time.Second {
+			t.Fatalf("got %+v, err %v", got, err)
+		}
+	})
+
+	t.Run("PTR", func(t *testing.T) {
+		got, err := c.LookupPTR(ctx, net.ParseIP("192.0.2.1"))
+		if err != nil || len(got) != 1 || got[0].Name != "host.example." {
+			t.Fatalf("got %+v, err %v", got, err)
+		}
+	})
+
+	t.Run("ClientSubnet", func(t *testing.T) {
+		_, pfx, _ := net.ParseCIDR("198.51.100.0/24")
+		opt, _ := (&ClientSubnet{Prefix: pfx}).Option()
+		ecs := *c
+		ecs.EDNS = &EDNS{UDPSize: DefaultUDPSize, Options: []EDNSOption{opt}}
+		resp, err := ecs.Query(ctx, "www.example", TypeA)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		cs, err := ParseClientSubnet(resp.EDNS.Option(OptionClientSubnet))
+		if err != nil || cs.ScopeLength != 16 {
+			t.Fatalf("got %+v, err %v", cs, err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if _, err := c.LookupA(ctx, "silent.example"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want deadline exceeded", err)
+		}
+	})
+}
+
+func TestBulkPTR(t *testing.T) {
+	// Each server names the even addresses after itself, and has no record for the odd ones.
+	var mu sync.Mutex
+	queries := map[string]int{}
+	newServer := func(label string) *Client {
+		server := testServer(t, func(q *Message, tcp bool) *Message {
+			name, resp := q.Questions[0].Name, &Message{}
+			mu.Lock()
+			queries[label]++
+			mu.Unlock()
+			if octet := strings.SplitN(name, ".", 2)[0]; octet[len(octet)-1]%2 == 1 {
+				resp.RCode = RCodeNameError
+				return resp
+			}
+			resp.Answers = []RR{{Name: name, Type: TypePTR, Class: ClassINET, TTL: 3600,
+				Data: &PTR{Host: label + ".example."}}}
+			return resp
+		})
+		return NewClient(server)
+	}
+
+	const rate = 200
+	bulk := NewBulkPTR(rate, newServer("a"), newServer("b"))
+	ctx := context.Background()
+
+	var ips []net.IP
+	for i := 0; i < 10; i++ {
+		ips = append(ips, net.IP{192, 0, 2, byte(i)})
+	}
+	start := time.Now()
+	results := bulk.ResolveAll(ctx, ips)
+
+	// Each resolver sees half of the queries, spaced out by the rate limit.
+	if elapsed, min := time.Since(start), time.Duration(len(ips)/2-1)*time.Second/rate; elapsed < min {
+		t.Errorf("took %v, want at least %v", elapsed, min)
+	}
+	mu.Lock()
+	if diff := cmp.Diff(map[string]int{"a": len(ips) / 2, "b": len(ips) / 2}, queries); diff != "" {
+		t.Errorf("%v", diff)
+	}
+	mu.Unlock()
+
+	for i, r := range results {
+		if !r.IP.Equal(ips[i]) {
+			t.Fatalf("result %d is for %v, want %v", i, r.IP, ips[i])
+		}
+		if i%2 == 1 {
+			if !errors.Is(r.Err, ErrNXDomain) {
+				t.Errorf("%v: got %v, want nxdomain", r.IP, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil || len(r.Hosts) != 1 || !strings.HasSuffix(r.Hosts[0].Name, ".example.") {
+			t.Errorf("%v: got %+v, err %v", r.IP, r.Hosts, r.Err)
+		}
+	}
+
+	t.Run("Prefixes", func(t *testing.T) {
+		_, pfx, _ := net.ParseCIDR("198.51.100.0/30")
+		seen := map[string]bool{}
+		for r := range bulk.ResolvePrefixes(ctx, []*net.IPNet{pfx}) {
+			seen[r.IP.String()] = r.Err == nil
+		}
+		want := map[string]bool{"198.51.100.0": true, "198.51.100.1": false, "198.51.100.2": true, "198.51.100.3": false}
+		if diff := cmp.Diff(want, seen); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("PrefixOrder", func(t *testing.T) {
+		// The even addresses are answered slowly, so that the lookups finish out of order.
+		server := testServer(t, func(q *Message, tcp bool) *Message {
+			name := q.Questions[0].Name
+			if octet := strings.SplitN(name, ".", 2)[0]; octet[len(octet)-1]%2 == 0 {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return &Message{Answers: []RR{{Name: name, Type: TypePTR, Class: ClassINET, TTL: 3600,
+				Data: &PTR{Host: "host.example."}}}}
+		})
+		bulk := &BulkPTR{Clients: []*Client{NewClient(server)}, Workers: 4}
+		var pfxs []*net.IPNet
+		for _, s := range []string{"198.51.100.8/30", "192.0.2.0/31", "203.0.113.5/32"} {
+			_, pfx, _ := net.ParseCIDR(s)
+			pfxs = append(pfxs, pfx)
+		}
+		var got []string
+		for r := range bulk.ResolvePrefixes(ctx, pfxs) {
+			if r.Err != nil {
+				t.Fatalf("%v: err %v", r.IP, r.Err)
+			}
+			got = append(got, r.IP.String())
+		}
+		want := []string{"198.51.100.8", "198.51.100.9", "198.51.100.10", "198.51.100.11", "192.0.2.0", "192.0.2.1",
+			"203.0.113.5"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		_, pfx, _ := net.ParseCIDR("2001:db8::/64")
+		results := bulk.ResolvePrefixes(ctx, []*net.IPNet{pfx})
+		for i := 0; i < 3; i++ {
+			<-results
+		}
+		cancel()
+		for range results {
+		}
+	})
+}
+
+func TestAddresses(t *testing.T) {
+	tests := map[string]struct {
+		pfxs []string
+		want []string
+	}{
+		"Host": {
+			pfxs: []string{"192.0.2.1/32"},
+			want: []string{"192.0.2.1"},
+		},
+		"Several": {
+			pfxs: []string{"192.0.2.6/31", "2001:db8::/127"},
+			want: []string{"192.0.2.6", "192.0.2.7", "2001:db8::", "2001:db8::1"},
+		},
+		"EndOfSpace": {
+			pfxs: []string{"255.255.255.254/31"},
+			want: []string{"255.255.255.254", "255.255.255.255"},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var pfxs []*net.IPNet
+			for _, s := range tc.pfxs {
+				_, pfx, _ := net.ParseCIDR(s)
+				pfxs = append(pfxs, pfx)
+			}
+			var got []string
+			for ip := range Addresses(context.Background(), pfxs) {
+				got = append(got, ip.String())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestTransports(t *testing.T) {
+	answer := func(label string) func(q *Message) *Message {
+		return func(q *Message) *Message {
+			return &Message{Answers: []RR{{Name: q.Questions[0].Name, Type: TypeTXT, Class: ClassINET, TTL: 60,
+				Data: &TXT{Strings: []string{label}}}}}
+		}
+	}
+
+	// The HTTPS test server provides a certificate for 127.0.0.1, which the TLS server borrows.
+	var mu sync.Mutex
+	var methods []string
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		var b []byte
+		if r.Method == http.MethodGet {
+			b, _ = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		} else {
+			b, _ = ioutil.ReadAll(r.Body)
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(testRespond(b, answer("https")))
+	}))
+	defer doh.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(doh.Certificate())
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: doh.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go func() {
+				defer conn.Close()
+				for {
+					b, err := ReadTCP(conn)
+					if err != nil {
+						return
+					}
+					WriteTCP(conn, testRespond(b, answer("tls")))
+				}
+			}()
+		}
+	}()
+
+	ctx := context.Background()
+	lookup := func(t *testing.T, c *Client, want string) {
+		t.Helper()
+		got, err := c.LookupTXT(ctx, "example")
+		if err != nil || len(got) != 1 || got[0].Text != want {
+			t.Fatalf("got %+v, err %v, want %q", got, err, want)
+		}
+	}
+
+	t.Run("TLS", func(t *testing.T) {
+		c := NewTLSClient(ln.Addr().String(), &tls.Config{RootCAs: roots})
+		defer c.Transport.(*TLSTransport).Close()
+		for i := 0; i < 3; i++ {
+			lookup(t, c, "tls")
+		}
+		if n := atomic.LoadInt32(&accepted); n != 1 {
+			t.Fatalf("%d connections, want 1", n)
+		}
+	})
+
+	t.Run("TLSUntrusted", func(t *testing.T) {
+		c := NewTLSClient(ln.Addr().String(), nil)
+		if _, err := c.LookupTXT(ctx, "example"); err == nil {
+			t.Fatalf("untrusted certificate accepted")
+		}
+	})
+
+	t.Run("HTTPS", func(t *testing.T) {
+		for _, get := range []bool{false, true} {
+			c := NewHTTPSClient(doh.URL + "/dns-query")
+			c.Transport.(*HTTPSTransport).Client = doh.Client()
+			c.Transport.(*HTTPSTransport).GET = get
+			lookup(t, c, "https")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if diff := cmp.Diff([]string{http.MethodPost, http.MethodGet}, methods); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		// Nothing listens on the first server, so the query moves on to plain DNS.
+		dead, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		dead.Close()
+		plain := NewClient(testServer(t, func(q *Message, tcp bool) *Message { return answer("plain")(q) }))
+		c := &Client{Server: "fallback", Transport: Fallback{
+			&TLSTransport{Address: dead.Addr().String(), Config: &tls.Config{RootCAs: roots}},
+			plain,
+		}}
+		lookup(t, c, "plain")
+
+		c.Transport = Fallback{&TLSTransport{Address: dead.Addr().String()}}
+		if _, err := c.LookupTXT(ctx, "example"); err == nil {
+			t.Fatalf("got no error with every transport failing")
+		}
+	})
+}
+
+func TestECS(t *testing.T) {
+	// A CDN steering 192.0.2.0/24 to one point of presence and everything else to another, and ignoring the option
+	// for other names.
+	cidr := func(s string) *net.IPNet {
+		_, pfx, _ := net.ParseCIDR(s)
+		return pfx
+	}
+	steer := cidr("192.0.2.0/24")
+	server := testServer(t, func(q *Message, tcp bool) *Message {
+		name, resp := q.Questions[0].Name, &Message{EDNS: &EDNS{UDPSize: DefaultUDPSize}}
+		if q.EDNS == nil || q.EDNS.Option(OptionCookie) == nil {
+			resp.RCode = RCodeRefused
+			return resp
+		}
+		if name != "cdn.example." {
+			resp.Answers = []RR{{Name: name, Type: TypeA, Class: ClassINET, TTL: 60, Data: &A{IP: net.IP{198, 51, 100, 1}}}}
+			return resp
+		}
+		cs, _ := ParseClientSubnet(q.EDNS.Option(OptionClientSubnet))
+		ip, scope := net.IP{203, 0, 113, 2}, uint8(8)
+		if steer.Contains(cs.Prefix.IP) {
+			ip, scope = net.IP{203, 0, 113, 1}, 24
+		}
+		cs.ScopeLength = scope
+		echo, _ := cs.Option()
+		resp.EDNS.Options = []EDNSOption{echo}
+		resp.Answers = []RR{{Name: name, Type: TypeA, Class: ClassINET, TTL: 60, Data: &A{IP: ip}}}
+		return resp
+	})
+
+	c := NewClient(server)
+	// The client's own options are kept, and any client subnet of its own replaced.
+	c.EDNS.Options = []EDNSOption{{Code: OptionCookie, Data: make([]byte, 8)},
+		{Code: OptionClientSubnet, Data: []byte{0, 1, 0, 0}}}
+	pfxs := []*net.IPNet{cidr("192.0.2.0/24"), cidr("198.51.100.0/24"), cidr("2001:db8::/48"),
+		cidr("192.0.2.128/25")}
+	answers, err := c.MapSubnets(context.Background(), "cdn.example", TypeA, pfxs)
+	if err != nil {
+		t.Fatalf("map err: %v", err)
+	}
+	if len(answers) != len(pfxs) {
+		t.Fatalf("got %d answers", len(answers))
+	}
+	if a := answers[0]; !a.Tailored() || a.ScopePrefix().String() != "192.0.2.0/24" {
+		t.Fatalf("got scope %v", a.ScopePrefix())
+	}
+	if a := answers[2]; a.ScopePrefix().String() != "2000::/8" {
+		t.Fatalf("got scope %v", a.ScopePrefix())
+	}
+
+	var got []string
+	for _, g := range GroupAnswers(answers) {
+		var subnets []string
+		for _, s := range g.Subnets {
+			subnets = append(subnets, s.String())
+		}
+		got = append(got, strings.Join(g.Answers, ",")+" "+strings.Join(subnets, ","))
+	}
+	want := []string{"203.0.113.1 192.0.2.0/24,192.0.2.128/25", "203.0.113.2 198.51.100.0/24,2001:db8::/48"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	plain, err := c.QuerySubnet(context.Background(), "www.example", TypeA, cidr("192.0.2.0/24"))
+	if err != nil {
+		t.Fatalf("query err: %v", err)
+	}
+	if plain.Tailored() || plain.ScopePrefix() != nil || plain.Answers[0] != "198.51.100.1" {
+		t.Fatalf("got %+v", plain)
+	}
+	if _, err := c.QuerySubnet(context.Background(), "www.example", TypeA, &net.IPNet{}); err == nil {
+		t.Fatalf("queried with an invalid subnet")
+	}
+}
+
+// testTransferServer answers each query over TCP with the messages handler returns, whose IDs are set to the query's
+// and whose first repeats the question. It returns the address of the server.
+func testTransferServer(t *testing.T, handler func(q *Message) []*Message) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				b, err := ReadTCP(conn)
+				if err != nil {
+					return
+				}
+				q, err := Unpack(b)
+				if err != nil {
+					return
+				}
+				for i, resp := range handler(q) {
+					resp.ID, resp.Response = q.ID, true
+					if i == 0 {
+						resp.Questions = q.Questions
+					}
+					out, err := resp.Pack()
+					if err != nil || WriteTCP(conn, out) != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestTransfer(t *testing.T) {
+	soa := func(serial uint32) RR {
+		return RR{Name: "example.", Type: TypeSOA, Class: ClassINET, TTL: 3600, Data: &SOA{MName: "ns1.example.",
+			RName: "hostmaster.example.", Serial: serial, Refresh: 3600, Retry: 600, Expire: 86400, Minimum: 60}}
+	}
+	a := func(name string, ip string) RR {
+		if v4 := net.ParseIP(ip).To4(); v4 != nil {
+			return RR{Name: name, Type: TypeA, Class: ClassINET, TTL: 60, Data: &A{IP: v4}}
+		}
+		return RR{Name: name, Type: TypeAAAA, Class: ClassINET, TTL: 60, Data: &AAAA{IP: net.ParseIP(ip)}}
+	}
+	ns := RR{Name: "example.", Type: TypeNS, Class: ClassINET, TTL: 3600, Data: &NS{Host: "ns1.example."}}
+	zone := []RR{soa(3), ns, a("ns1.example.", "192.0.2.2"), a("www.example.", "192.0.2.3"),
+		a("www.example.", "2001:db8::80"), a("mail.example.", "198.51.100.25")}
+
+	server := testTransferServer(t, func(q *Message) []*Message {
+		if q.Questions[0].Name != "example." {
+			return []*Message{{RCode: RCodeRefused}}
+		}
+		if q.Questions[0].Type == TypeAXFR {
+			// The zone is split across messages, as large zones are.
+			return []*Message{{Answers: zone[:3]}, {Answers: append(append([]RR{}, zone[3:]...), soa(3))}}
+		}
+		switch q.Authority[0].Data.(*SOA).Serial {
+		case 3:
+			return []*Message{{Answers: []RR{soa(3)}}}
+		case 1:
+			return []*Message{{Answers: []RR{soa(3), soa(1), a("www.example.", "192.0.2.9"), soa(2),
+				a("www.example.", "192.0.2.3")}}, {Answers: []RR{soa(2), soa(3), a("mail.example.", "198.51.100.25"),
+				soa(3)}}}
+		}
+		return []*Message{{Answers: append(append([]RR{}, zone...), soa(3))}}
+	})
+	c := NewClient(server)
+	ctx := context.Background()
+
+	axfr, err := c.AXFR(ctx, "example")
+	if err != nil {
+		t.Fatalf("axfr err: %v", err)
+	}
+	if axfr.Serial != 3 || axfr.Incremental || len(axfr.Records) != len(zone) {
+		t.Fatalf("got %+v", axfr)
+	}
+	var got []string
+	for _, pfx := range AddressSet(axfr.Records).IPNets() {
+		got = append(got, pfx.String())
+	}
+	// The two adjacent addresses of the zone aggregate into one prefix.
+	want := []string{"192.0.2.2/31", "198.51.100.25/32", "2001:db8::80/128"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	upToDate, err := c.IXFR(ctx, "example", 3)
+	if err != nil {
+		t.Fatalf("ixfr err: %v", err)
+	}
+	if !upToDate.Incremental || len(upToDate.Deltas) != 0 || upToDate.Serial != 3 {
+		t.Fatalf("got %+v", upToDate)
+	}
+
+	ixfr, err := c.IXFR(ctx, "example", 1)
+	if err != nil {
+		t.Fatalf("ixfr err: %v", err)
+	}
+	if !ixfr.Incremental || len(ixfr.Deltas) != 2 {
+		t.Fatalf("got %+v", ixfr)
+	}
+	var deltas []string
+	for _, d := range ixfr.Deltas {
+		deltas = append(deltas, fmt.Sprintf("%d-%d -%d +%d", d.From, d.To, len(d.Deleted), len(d.Added)))
+	}
+	if diff := cmp.Diff([]string{"1-2 -1 +1", "2-3 -0 +1"}, deltas); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	full, err := c.IXFR(ctx, "example", 0)
+	if err != nil {
+		t.Fatalf("ixfr err: %v", err)
+	}
+	if full.Incremental || len(full.Records) != len(zone) {
+		t.Fatalf("got %+v", full)
+	}
+
+	if _, err := c.AXFR(ctx, "other.example"); !errors.Is(err, ErrRefused) {
+		t.Fatalf("got err %v, want ErrRefused", err)
+	}
+}
@@ -0,0 +1,141 @@
+package dnsutil
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ECSAnswer is the answer to a query sent with an EDNS Client Subnet option, as returned by Client.QuerySubnet.
+type ECSAnswer struct {
+	Subnet *net.IPNet // The subnet sent.
+	// Scope is the client subnet option of the response, whose ScopeLength is the prefix length the answer is valid
+	// for: zero if it is valid for every client, or longer than the subnet if the server wanted a more specific one. It
+	// is nil if the server ignored the option.
+	Scope   *ClientSubnet
+	RCode   int
+	Answers []string // The data of the answering records, in presentation format and sorted.
+	RTT     time.Duration
+}
+
+// Tailored reports whether the answer was chosen for the subnet, rather than being valid for every client.
+func (a *ECSAnswer) Tailored() bool {
+	return a.Scope != nil && a.Scope.ScopeLength > 0
+}
+
+// ScopePrefix returns the prefix the answer is valid for: the subnet sent, shortened or lengthened to the scope
+// length. It is nil if the server ignored the option.
+func (a *ECSAnswer) ScopePrefix() *net.IPNet {
+	if a.Scope == nil {
+		return nil
+	}
+	_, bits := a.Subnet.Mask.Size()
+	scope := int(a.Scope.ScopeLength)
+	if scope > bits {
+		scope = bits
+	}
+	mask := net.CIDRMask(scope, bits)
+	return &net.IPNet{IP: a.Subnet.IP.Mask(mask), Mask: mask}
+}
+
+// QuerySubnet sends a query for name and qtype with an EDNS Client Subnet option for subnet, replacing any the client
+// would attach, as a recursive resolver does on behalf of a client within it. Most authoritative servers only honour
+// the option from resolvers they know, but some public resolvers pass on one set by the client. An unsuccessful
+// response code is not treated as an error.
+func (c *Client) QuerySubnet(ctx context.Context, name string, qtype uint16, subnet *net.IPNet) (*ECSAnswer, error) {
+	cs := &ClientSubnet{Prefix: subnet}
+	opt, err := cs.Option()
+	if err != nil {
+		return nil, err
+	}
+	edns := EDNS{UDPSize: DefaultUDPSize}
+	if c.EDNS != nil {
+		edns = *c.EDNS
+	}
+	edns.Options = append([]EDNSOption{opt}, c.optionsWithout(OptionClientSubnet)...)
+	q := c.NewQuery(name, qtype)
+	q.EDNS = &edns
+
+	resp, rtt, err := c.Exchange(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	a := &ECSAnswer{
+		Subnet: &net.IPNet{IP: subnet.IP.Mask(subnet.Mask), Mask: subnet.Mask},
+		RCode:  resp.RCode,
+		RTT:    rtt,
+	}
+	if resp.EDNS != nil {
+		if o := resp.EDNS.Option(OptionClientSubnet); o != nil {
+			// A malformed option is treated as the server ignoring the one sent.
+			a.Scope, _ = ParseClientSubnet(o)
+		}
+	}
+	for _, rr := range Answers(resp, name, qtype) {
+		a.Answers = append(a.Answers, rr.Data.String())
+	}
+	sort.Strings(a.Answers)
+	return a, nil
+}
+
+// optionsWithout returns the EDNS options the client attaches to queries, other than those with a code.
+func (c *Client) optionsWithout(code uint16) []EDNSOption {
+	if c.EDNS == nil {
+		return nil
+	}
+	var opts []EDNSOption
+	for _, o := range c.EDNS.Options {
+		if o.Code != code {
+			opts = append(opts, o)
+		}
+	}
+	return opts
+}
+
+// MapSubnets sends a query for name and qtype on behalf of each prefix in turn, returning the answers in the same
+// order. It stops at the first query that fails. GroupAnswers then shows which prefixes were given the same answer.
+func (c *Client) MapSubnets(ctx context.Context, name string, qtype uint16, pfxs []*net.IPNet) ([]*ECSAnswer, error) {
+	answers := make([]*ECSAnswer, 0, len(pfxs))
+	for _, subnet := range pfxs {
+		a, err := c.QuerySubnet(ctx, name, qtype, subnet)
+		if err != nil {
+			return answers, err
+		}
+		answers = append(answers, a)
+	}
+	return answers, nil
+}
+
+// AnswerGroup is a set of subnets that were given the same answer, such as those a CDN steers to one point of
+// presence.
+type AnswerGroup struct {
+	RCode   int
+	Answers []string
+	Subnets []*net.IPNet // In the order they were queried.
+}
+
+// GroupAnswers groups subnets by the answers they were given, which shows how a server maps clients to answers. Groups
+// are sorted by the number of subnets in them, most first, and then by their answers.
+func GroupAnswers(answers []*ECSAnswer) []*AnswerGroup {
+	byKey := map[string]*AnswerGroup{}
+	var groups []*AnswerGroup
+	for _, a := range answers {
+		key := RCodeString(a.RCode) + "\n" + strings.Join(a.Answers, "\n")
+		g := byKey[key]
+		if g == nil {
+			g = &AnswerGroup{RCode: a.RCode, Answers: a.Answers}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.Subnets = append(g.Subnets, a.Subnet)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].Subnets) != len(groups[j].Subnets) {
+			return len(groups[i].Subnets) > len(groups[j].Subnets)
+		}
+		return strings.Join(groups[i].Answers, " ") < strings.Join(groups[j].Answers, " ")
+	})
+	return groups
+}
@@ -0,0 +1,147 @@
+package dnsutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// EDNS option codes.
+const (
+	OptionNSID         = 3
+	OptionClientSubnet = 8
+	OptionCookie       = 10
+	OptionPadding      = 12
+)
+
+// DefaultUDPSize is the EDNS UDP payload size recommended by DNS Flag Day 2020, which avoids IP fragmentation on
+// almost every path.
+const DefaultUDPSize = 1232
+
+// EDNS holds the contents of the OPT pseudo-record of a message, as described by RFC 6891.
+type EDNS struct {
+	UDPSize  uint16 // The largest UDP response the sender can receive.
+	Version  uint8
+	DNSSECOK bool // The sender can handle DNSSEC records.
+	Options  []EDNSOption
+}
+
+// EDNSOption is a single option carried in the OPT pseudo-record.
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+// Option returns the first option with the given code, or nil if there is none.
+func (e *EDNS) Option(code uint16) *EDNSOption {
+	for i := range e.Options {
+		if e.Options[i].Code == code {
+			return &e.Options[i]
+		}
+	}
+	return nil
+}
+
+// rr encodes the EDNS information as an OPT pseudo-record, including the upper bits of the response code.
+func (e *EDNS) rr(rcode int) RR {
+	ttl := uint32(rcode>>4)<<24 | uint32(e.Version)<<16
+	if e.DNSSECOK {
+		ttl |= 1 << 15
+	}
+	var data []byte
+	for _, opt := range e.Options {
+		data = appendUint16(data, opt.Code)
+		data = appendUint16(data, uint16(len(opt.Data)))
+		data = append(data, opt.Data...)
+	}
+	return RR{
+		Name:  ".",
+		Type:  TypeOPT,
+		Class: e.UDPSize,
+		TTL:   ttl,
+		Data:  &Unknown{RRType: TypeOPT, Data: data},
+	}
+}
+
+// ednsFromRR decodes an OPT pseudo-record. Malformed options are ignored, as they are the sender's problem rather than
+// a reason to discard the whole response.
+func ednsFromRR(rr RR) *EDNS {
+	e := &EDNS{
+		UDPSize:  rr.Class,
+		Version:  uint8(rr.TTL >> 16),
+		DNSSECOK: rr.TTL&(1<<15) != 0,
+	}
+	if u, ok := rr.Data.(*Unknown); ok {
+		for b := u.Data; len(b) >= 4; {
+			code, l := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+			if 4+l > len(b) {
+				break
+			}
+			e.Options = append(e.Options, EDNSOption{Code: code, Data: b[4 : 4+l]})
+			b = b[4+l:]
+		}
+	}
+	return e
+}
+
+// ClientSubnet is the EDNS Client Subnet option of RFC 7871, which tells an authoritative server where the client
+// behind a recursive resolver is, and tells the resolver how widely the answer applies.
+type ClientSubnet struct {
+	Prefix      *net.IPNet
+	ScopeLength uint8 // Set in responses to the prefix length the answer is valid for.
+}
+
+// Option encodes the client subnet as an EDNS option. Only the significant octets of the address are sent, with any
+// host bits cleared, as the RFC requires.
+func (cs *ClientSubnet) Option() (EDNSOption, error) {
+	if cs.Prefix == nil {
+		return EDNSOption{}, errors.New("nil prefix")
+	}
+	ones, bits := cs.Prefix.Mask.Size()
+	family, ip := uint16(2), cs.Prefix.IP.Mask(cs.Prefix.Mask).To16()
+	if bits == 8*net.IPv4len {
+		family, ip = 1, cs.Prefix.IP.Mask(cs.Prefix.Mask).To4()
+	}
+	if ip == nil || bits == 0 {
+		return EDNSOption{}, fmt.Errorf("invalid prefix %v", cs.Prefix)
+	}
+
+	data := appendUint16(nil, family)
+	data = append(data, uint8(ones), cs.ScopeLength)
+	data = append(data, ip[:(ones+7)/8]...)
+	return EDNSOption{Code: OptionClientSubnet, Data: data}, nil
+}
+
+// ParseClientSubnet decodes an EDNS Client Subnet option.
+func ParseClientSubnet(opt *EDNSOption) (*ClientSubnet, error) {
+	if opt.Code != OptionClientSubnet {
+		return nil, fmt.Errorf("not a client subnet option: code %d", opt.Code)
+	}
+	if len(opt.Data) < 4 {
+		return nil, errors.New("client subnet option too short")
+	}
+	family, source, scope := binary.BigEndian.Uint16(opt.Data), int(opt.Data[2]), opt.Data[3]
+
+	var bits int
+	switch family {
+	case 1:
+		bits = 8 * net.IPv4len
+	case 2:
+		bits = 8 * net.IPv6len
+	default:
+		return nil, fmt.Errorf("unknown client subnet family %d", family)
+	}
+	addr := opt.Data[4:]
+	if source > bits || len(addr) != (source+7)/8 {
+		return nil, fmt.Errorf("invalid client subnet prefix length %d for %d octets", source, len(addr))
+	}
+
+	ip := make(net.IP, bits/8)
+	copy(ip, addr)
+	mask := net.CIDRMask(source, bits)
+	return &ClientSubnet{
+		Prefix:      &net.IPNet{IP: ip.Mask(mask), Mask: mask},
+		ScopeLength: scope,
+	}, nil
+}
@@ -0,0 +1,446 @@
+package dnsutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Resource record types.
+const (
+	TypeA     = 1
+	TypeNS    = 2
+	TypeCNAME = 5
+	TypeSOA   = 6
+	TypePTR   = 12
+	TypeMX    = 15
+	TypeTXT   = 16
+	TypeAAAA  = 28
+	TypeSRV   = 33
+	TypeOPT   = 41
+	TypeIXFR  = 251
+	TypeAXFR  = 252
+	TypeANY   = 255
+)
+
+// Classes.
+const (
+	ClassINET  = 1
+	ClassCHAOS = 3
+	ClassANY   = 255
+)
+
+// Response codes. Those above 15 can only be carried with EDNS.
+const (
+	RCodeSuccess        = 0
+	RCodeFormatError    = 1
+	RCodeServerFailure  = 2
+	RCodeNameError      = 3
+	RCodeNotImplemented = 4
+	RCodeRefused        = 5
+	RCodeBadVersion     = 16
+)
+
+// Limits imposed by the protocol.
+const (
+	headerLen     = 12
+	maxNameLen    = 255
+	maxLabelLen   = 63
+	maxPointers   = 64
+	pointerMask   = 0xc0
+	maxCompressed = 0x3fff
+)
+
+// errShort is returned when a message ends part way through something.
+var errShort = errors.New("dns message truncated")
+
+// Question is an entry from the question section of a message.
+type Question struct {
+	Name  string // Fully qualified, in presentation format.
+	Type  uint16
+	Class uint16
+}
+
+// RR is a resource record.
+type RR struct {
+	Name  string // Fully qualified, in presentation format.
+	Type  uint16
+	Class uint16
+	TTL   uint32 // In seconds.
+	Data  RData
+}
+
+// Message is a DNS message, as described by RFC 1035. The OPT pseudo-record of EDNS is not included in Additional,
+// but is instead decoded into EDNS, which also holds the upper bits of the response code.
+type Message struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticData      bool
+	CheckingDisabled   bool
+	RCode              int
+
+	Questions  []Question
+	Answers    []RR
+	Authority  []RR
+	Additional []RR
+
+	EDNS *EDNS
+}
+
+// Pack encodes the message, compressing names where possible.
+func (m *Message) Pack() ([]byte, error) {
+	b := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(b, m.ID)
+
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xf) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	if m.AuthenticData {
+		flags |= 1 << 5
+	}
+	if m.CheckingDisabled {
+		flags |= 1 << 4
+	}
+	flags |= uint16(m.RCode & 0xf)
+	binary.BigEndian.PutUint16(b[2:], flags)
+
+	additional := len(m.Additional)
+	if m.EDNS != nil {
+		additional++
+	} else if m.RCode > 0xf {
+		return nil, fmt.Errorf("rcode %d requires edns", m.RCode)
+	}
+	for i, n := range []int{len(m.Questions), len(m.Answers), len(m.Authority), additional} {
+		if n > 0xffff {
+			return nil, errors.New("too many records")
+		}
+		binary.BigEndian.PutUint16(b[4+2*i:], uint16(n))
+	}
+
+	comp := make(map[string]int)
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name, comp); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, q.Type)
+		b = appendUint16(b, q.Class)
+	}
+	for _, section := range [][]RR{m.Answers, m.Authority, m.Additional} {
+		for i := range section {
+			if b, err = appendRR(b, &section[i], comp); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if m.EDNS != nil {
+		rr := m.EDNS.rr(m.RCode)
+		if b, err = appendRR(b, &rr, comp); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Unpack decodes a message.
+func Unpack(b []byte) (*Message, error) {
+	if len(b) < headerLen {
+		return nil, errShort
+	}
+	flags := binary.BigEndian.Uint16(b[2:])
+	m := &Message{
+		ID:                 binary.BigEndian.Uint16(b),
+		Response:           flags&(1<<15) != 0,
+		Opcode:             uint8(flags>>11) & 0xf,
+		Authoritative:      flags&(1<<10) != 0,
+		Truncated:          flags&(1<<9) != 0,
+		RecursionDesired:   flags&(1<<8) != 0,
+		RecursionAvailable: flags&(1<<7) != 0,
+		AuthenticData:      flags&(1<<5) != 0,
+		CheckingDisabled:   flags&(1<<4) != 0,
+		RCode:              int(flags & 0xf),
+	}
+	qd, an, ns, ar := binary.BigEndian.Uint16(b[4:]), binary.BigEndian.Uint16(b[6:]),
+		binary.BigEndian.Uint16(b[8:]), binary.BigEndian.Uint16(b[10:])
+
+	off := headerLen
+	for i := 0; i < int(qd); i++ {
+		name, next, err := unpackName(b, off)
+		if err != nil {
+			return nil, fmt.Errorf("question %d: %w", i, err)
+		}
+		if next+4 > len(b) {
+			return nil, errShort
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[next:]),
+			Class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+
+	sections := []*[]RR{&m.Answers, &m.Authority, &m.Additional}
+	for s, count := range []uint16{an, ns, ar} {
+		for i := 0; i < int(count); i++ {
+			rr, next, err := unpackRR(b, off)
+			if err != nil {
+				return nil, fmt.Errorf("record %d of section %d: %w", i, s+1, err)
+			}
+			off = next
+
+			if rr.Type == TypeOPT && s == 2 {
+				if m.EDNS != nil {
+					return nil, errors.New("multiple opt records")
+				}
+				m.EDNS = ednsFromRR(rr)
+				m.RCode |= int(rr.TTL>>24) << 4
+				continue
+			}
+			*sections[s] = append(*sections[s], rr)
+		}
+	}
+
+	return m, nil
+}
+
+// appendUint16 appends a big-endian 16-bit value.
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// appendUint32 appends a big-endian 32-bit value.
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendRR appends a resource record, filling in the length of its data once it is known.
+func appendRR(b []byte, rr *RR, comp map[string]int) ([]byte, error) {
+	var err error
+	if b, err = appendName(b, rr.Name, comp); err != nil {
+		return nil, err
+	}
+	b = appendUint16(b, rr.Type)
+	b = appendUint16(b, rr.Class)
+	b = appendUint32(b, rr.TTL)
+	lenOff := len(b)
+	b = append(b, 0, 0)
+	if rr.Data != nil {
+		if b, err = rr.Data.pack(b, comp); err != nil {
+			return nil, fmt.Errorf("%s: %w", rr.Name, err)
+		}
+	}
+	rdLen := len(b) - lenOff - 2
+	if rdLen > 0xffff {
+		return nil, fmt.Errorf("%s: record data too long", rr.Name)
+	}
+	binary.BigEndian.PutUint16(b[lenOff:], uint16(rdLen))
+	return b, nil
+}
+
+// unpackRR decodes the resource record at off, returning the offset following it.
+func unpackRR(b []byte, off int) (RR, int, error) {
+	name, off, err := unpackName(b, off)
+	if err != nil {
+		return RR{}, 0, err
+	}
+	if off+10 > len(b) {
+		return RR{}, 0, errShort
+	}
+	rr := RR{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(b[off:]),
+		Class: binary.BigEndian.Uint16(b[off+2:]),
+		TTL:   binary.BigEndian.Uint32(b[off+4:]),
+	}
+	rdLen := int(binary.BigEndian.Uint16(b[off+8:]))
+	off += 10
+	if off+rdLen > len(b) {
+		return RR{}, 0, errShort
+	}
+	if rr.Data, err = unpackRData(b, off, rdLen, rr.Type); err != nil {
+		return RR{}, 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return rr, off + rdLen, nil
+}
+
+// Fqdn returns name with a trailing dot, making it fully qualified.
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") && !strings.HasSuffix(name, `\.`) {
+		return name
+	}
+	return name + "."
+}
+
+// splitLabels converts a name in presentation format into wire format labels, handling \. and \DDD escapes.
+func splitLabels(name string) ([][]byte, error) {
+	name = Fqdn(name)
+	if name == "." {
+		return nil, nil
+	}
+
+	var labels [][]byte
+	var label []byte
+	total := 1
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '\\':
+			if i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]) {
+				v := int(name[i+1]-'0')*100 + int(name[i+2]-'0')*10 + int(name[i+3]-'0')
+				if v > 255 {
+					return nil, fmt.Errorf("invalid escape in %q", name)
+				}
+				label = append(label, byte(v))
+				i += 3
+			} else if i+1 < len(name) {
+				label = append(label, name[i+1])
+				i++
+			} else {
+				return nil, fmt.Errorf("trailing backslash in %q", name)
+			}
+		case c == '.':
+			if len(label) == 0 {
+				return nil, fmt.Errorf("empty label in %q", name)
+			}
+			if len(label) > maxLabelLen {
+				return nil, fmt.Errorf("label too long in %q", name)
+			}
+			labels = append(labels, label)
+			total += 1 + len(label)
+			label = nil
+		default:
+			label = append(label, c)
+		}
+	}
+	if total > maxNameLen {
+		return nil, fmt.Errorf("name too long: %q", name)
+	}
+	return labels, nil
+}
+
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// appendName appends a name in wire format, using a pointer to an earlier occurrence of any suffix it shares. If comp
+// is nil, no compression is done, as required within the data of most record types.
+func appendName(b []byte, name string, comp map[string]int) ([]byte, error) {
+	labels, err := splitLabels(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range labels {
+		if comp != nil {
+			key := suffixKey(labels[i:])
+			if ptr, ok := comp[key]; ok {
+				return appendUint16(b, uint16(pointerMask<<8|ptr)), nil
+			}
+			if len(b) <= maxCompressed {
+				comp[key] = len(b)
+			}
+		}
+		b = append(b, byte(len(labels[i])))
+		b = append(b, labels[i]...)
+	}
+	return append(b, 0), nil
+}
+
+// suffixKey returns a map key for a sequence of labels. It is case-sensitive, so that compression never changes the
+// case of a name, which would defeat the use of random case as extra entropy in queries.
+func suffixKey(labels [][]byte) string {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteByte(byte(len(l)))
+		sb.Write(l)
+	}
+	return sb.String()
+}
+
+// unpackName decodes the possibly compressed name at off, returning it in presentation format along with the offset
+// following it.
+func unpackName(b []byte, off int) (string, int, error) {
+	var sb strings.Builder
+	next, pointers, total := -1, 0, 1
+	for {
+		if off >= len(b) {
+			return "", 0, errShort
+		}
+		c := int(b[off])
+		switch c & pointerMask {
+		case 0:
+			if c == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				if sb.Len() == 0 {
+					return ".", next, nil
+				}
+				return sb.String(), next, nil
+			}
+			if off+1+c > len(b) {
+				return "", 0, errShort
+			}
+			total += 1 + c
+			if total > maxNameLen {
+				return "", 0, errors.New("name too long")
+			}
+			writeLabel(&sb, b[off+1:off+1+c])
+			sb.WriteByte('.')
+			off += 1 + c
+
+		case pointerMask:
+			if off+2 > len(b) {
+				return "", 0, errShort
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			pointers++
+			if pointers > maxPointers {
+				return "", 0, errors.New("too many compression pointers")
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & maxCompressed)
+
+		default:
+			return "", 0, fmt.Errorf("unsupported label type %#x", c&pointerMask)
+		}
+	}
+}
+
+// writeLabel writes a label in presentation format, escaping dots, backslashes and unprintable octets.
+func writeLabel(sb *strings.Builder, label []byte) {
+	for _, c := range label {
+		switch {
+		case c == '.' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < '!' || c > '~':
+			fmt.Fprintf(sb, "\\%03d", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
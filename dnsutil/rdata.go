@@ -0,0 +1,281 @@
+package dnsutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RData is the type-specific data of a resource record. Types not otherwise understood are represented by Unknown.
+type RData interface {
+	// Type returns the record type the data belongs to.
+	Type() uint16
+	// String returns the data in presentation format.
+	String() string
+
+	pack(b []byte, comp map[string]int) ([]byte, error)
+}
+
+// A is the data of an A record.
+type A struct {
+	IP net.IP
+}
+
+// AAAA is the data of an AAAA record.
+type AAAA struct {
+	IP net.IP
+}
+
+// NS is the data of an NS record.
+type NS struct {
+	Host string
+}
+
+// CNAME is the data of a CNAME record.
+type CNAME struct {
+	Target string
+}
+
+// PTR is the data of a PTR record.
+type PTR struct {
+	Host string
+}
+
+// MX is the data of an MX record.
+type MX struct {
+	Preference uint16
+	Host       string
+}
+
+// TXT is the data of a TXT record, which is one or more strings of up to 255 octets each.
+type TXT struct {
+	Strings []string
+}
+
+// SOA is the data of an SOA record.
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+// SRV is the data of an SRV record.
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// Unknown is the data of a record whose type is not otherwise understood.
+type Unknown struct {
+	RRType uint16
+	Data   []byte
+}
+
+// Type satisfies RData.
+func (*A) Type() uint16         { return TypeA }
+func (*AAAA) Type() uint16      { return TypeAAAA }
+func (*NS) Type() uint16        { return TypeNS }
+func (*CNAME) Type() uint16     { return TypeCNAME }
+func (*PTR) Type() uint16       { return TypePTR }
+func (*MX) Type() uint16        { return TypeMX }
+func (*TXT) Type() uint16       { return TypeTXT }
+func (*SOA) Type() uint16       { return TypeSOA }
+func (*SRV) Type() uint16       { return TypeSRV }
+func (r *Unknown) Type() uint16 { return r.RRType }
+
+// String satisfies RData.
+func (r *A) String() string     { return r.IP.String() }
+func (r *AAAA) String() string  { return r.IP.String() }
+func (r *NS) String() string    { return r.Host }
+func (r *CNAME) String() string { return r.Target }
+func (r *PTR) String() string   { return r.Host }
+func (r *MX) String() string    { return fmt.Sprintf("%d %s", r.Preference, r.Host) }
+func (r *TXT) String() string {
+	quoted := make([]string, len(r.Strings))
+	for i, s := range r.Strings {
+		quoted[i] = strconv.Quote(s)
+	}
+	return strings.Join(quoted, " ")
+}
+func (r *SOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", r.MName, r.RName, r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum)
+}
+func (r *SRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target)
+}
+func (r *Unknown) String() string {
+	// The generic format of RFC 3597.
+	return fmt.Sprintf(`\# %d %x`, len(r.Data), r.Data)
+}
+
+func (r *A) pack(b []byte, _ map[string]int) ([]byte, error) {
+	ip := r.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("not an ipv4 address: %v", r.IP)
+	}
+	return append(b, ip...), nil
+}
+
+func (r *AAAA) pack(b []byte, _ map[string]int) ([]byte, error) {
+	ip := r.IP.To16()
+	if ip == nil {
+		return nil, fmt.Errorf("not an ipv6 address: %v", r.IP)
+	}
+	return append(b, ip...), nil
+}
+
+func (r *NS) pack(b []byte, comp map[string]int) ([]byte, error) { return appendName(b, r.Host, comp) }
+func (r *CNAME) pack(b []byte, comp map[string]int) ([]byte, error) {
+	return appendName(b, r.Target, comp)
+}
+func (r *PTR) pack(b []byte, comp map[string]int) ([]byte, error) { return appendName(b, r.Host, comp) }
+
+func (r *MX) pack(b []byte, comp map[string]int) ([]byte, error) {
+	return appendName(appendUint16(b, r.Preference), r.Host, comp)
+}
+
+func (r *TXT) pack(b []byte, _ map[string]int) ([]byte, error) {
+	for _, s := range r.Strings {
+		if len(s) > 255 {
+			return nil, fmt.Errorf("txt string too long: %d octets", len(s))
+		}
+		b = append(b, byte(len(s)))
+		b = append(b, s...)
+	}
+	return b, nil
+}
+
+func (r *SOA) pack(b []byte, comp map[string]int) ([]byte, error) {
+	b, err := appendName(b, r.MName, comp)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = appendName(b, r.RName, comp); err != nil {
+		return nil, err
+	}
+	for _, v := range []uint32{r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum} {
+		b = appendUint32(b, v)
+	}
+	return b, nil
+}
+
+func (r *SRV) pack(b []byte, _ map[string]int) ([]byte, error) {
+	b = appendUint16(b, r.Priority)
+	b = appendUint16(b, r.Weight)
+	b = appendUint16(b, r.Port)
+	// RFC 2782 forbids compression of the target.
+	return appendName(b, r.Target, nil)
+}
+
+func (r *Unknown) pack(b []byte, _ map[string]int) ([]byte, error) {
+	return append(b, r.Data...), nil
+}
+
+// unpackRData decodes the data of a record of the given type, which occupies length octets at off. Names within it
+// may be compressed, so the whole message is needed.
+func unpackRData(msg []byte, off, length int, typ uint16) (RData, error) {
+	data := msg[off : off+length]
+	end := off + length
+
+	// name decodes a name that must lie entirely within the record data.
+	name := func(at int) (string, int, error) {
+		return unpackName(msg[:end], at)
+	}
+
+	switch typ {
+	case TypeA:
+		if length != net.IPv4len {
+			return nil, fmt.Errorf("invalid a record length %d", length)
+		}
+		return &A{IP: append(net.IP(nil), data...)}, nil
+
+	case TypeAAAA:
+		if length != net.IPv6len {
+			return nil, fmt.Errorf("invalid aaaa record length %d", length)
+		}
+		return &AAAA{IP: append(net.IP(nil), data...)}, nil
+
+	case TypeNS, TypeCNAME, TypePTR:
+		host, _, err := name(off)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case TypeNS:
+			return &NS{Host: host}, nil
+		case TypeCNAME:
+			return &CNAME{Target: host}, nil
+		}
+		return &PTR{Host: host}, nil
+
+	case TypeMX:
+		if length < 3 {
+			return nil, errShort
+		}
+		host, _, err := name(off + 2)
+		if err != nil {
+			return nil, err
+		}
+		return &MX{Preference: binary.BigEndian.Uint16(data), Host: host}, nil
+
+	case TypeTXT:
+		txt := &TXT{}
+		for rest := data; len(rest) > 0; {
+			l := int(rest[0])
+			if 1+l > len(rest) {
+				return nil, errShort
+			}
+			txt.Strings = append(txt.Strings, string(rest[1:1+l]))
+			rest = rest[1+l:]
+		}
+		return txt, nil
+
+	case TypeSOA:
+		mname, next, err := name(off)
+		if err != nil {
+			return nil, err
+		}
+		rname, next, err := name(next)
+		if err != nil {
+			return nil, err
+		}
+		if end-next != 20 {
+			return nil, fmt.Errorf("invalid soa record length %d", length)
+		}
+		v := msg[next:end]
+		return &SOA{
+			MName:   mname,
+			RName:   rname,
+			Serial:  binary.BigEndian.Uint32(v),
+			Refresh: binary.BigEndian.Uint32(v[4:]),
+			Retry:   binary.BigEndian.Uint32(v[8:]),
+			Expire:  binary.BigEndian.Uint32(v[12:]),
+			Minimum: binary.BigEndian.Uint32(v[16:]),
+		}, nil
+
+	case TypeSRV:
+		if length < 7 {
+			return nil, errShort
+		}
+		target, _, err := name(off + 6)
+		if err != nil {
+			return nil, err
+		}
+		return &SRV{
+			Priority: binary.BigEndian.Uint16(data),
+			Weight:   binary.BigEndian.Uint16(data[2:]),
+			Port:     binary.BigEndian.Uint16(data[4:]),
+			Target:   target,
+		}, nil
+	}
+
+	return &Unknown{RRType: typ, Data: append([]byte(nil), data...)}, nil
+}
@@ -0,0 +1,254 @@
+package dnsutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// mediaType is the content type of DNS messages carried over HTTPS.
+const mediaType = "application/dns-message"
+
+// NewTLSClient returns a Client using DNS over TLS to server, where a bare address uses port 853. The certificate of
+// the server is verified against the host part of server unless config says otherwise, and config may be nil.
+func NewTLSClient(server string, config *tls.Config) *Client {
+	return &Client{
+		Server:    server,
+		EDNS:      &EDNS{UDPSize: DefaultUDPSize},
+		Transport: &TLSTransport{Address: server, Config: config},
+	}
+}
+
+// NewHTTPSClient returns a Client using DNS over HTTPS to the given URL, such as https://dns.example/dns-query.
+func NewHTTPSClient(url string) *Client {
+	return &Client{
+		Server:    url,
+		EDNS:      &EDNS{UDPSize: DefaultUDPSize},
+		Transport: &HTTPSTransport{URL: url},
+	}
+}
+
+// TLSTransport carries queries over DNS over TLS, as described by RFC 7858. The connection is kept open between
+// queries, which are sent one at a time, so that the cost of the handshake is only paid once.
+type TLSTransport struct {
+	Address string        // The host and port of the server; a bare address uses port 853.
+	Config  *tls.Config   // Used for the connection, or the default configuration if nil.
+	Timeout time.Duration // The time allowed for each query, or DefaultTimeout if zero.
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Exchange satisfies Transport.
+func (t *TLSTransport) Exchange(ctx context.Context, q *Message) (*Message, time.Duration, error) {
+	b, err := q.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(b) > maxTCPLen {
+		return nil, 0, fmt.Errorf("query too long: %d bytes", len(b))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		reused := t.conn != nil
+		if !reused {
+			if t.conn, err = t.dial(ctx); err != nil {
+				return nil, 0, contextErr(ctx, err)
+			}
+		}
+		resp, rtt, err := t.exchange(ctx, q, b)
+		if err == nil {
+			return resp, rtt, nil
+		}
+		t.conn.Close()
+		t.conn = nil
+
+		// The server may have closed an idle connection, which is only discovered by trying to use it, so a failure on
+		// a reused connection is retried once on a new one.
+		if !reused || ctx.Err() != nil {
+			return nil, 0, contextErr(ctx, err)
+		}
+	}
+}
+
+// dial opens a new connection to the server.
+func (t *TLSTransport) dial(ctx context.Context) (net.Conn, error) {
+	d := &tls.Dialer{
+		NetDialer: &net.Dialer{Deadline: deadline(ctx, time.Now().Add(t.timeout()))},
+		Config:    t.Config,
+	}
+	return d.DialContext(ctx, "tcp", withPort(t.Address, "853"))
+}
+
+// exchange sends a packed query on the open connection and waits for the response.
+func (t *TLSTransport) exchange(ctx context.Context, q *Message, b []byte) (*Message, time.Duration, error) {
+	start := time.Now()
+	t.conn.SetDeadline(deadline(ctx, start.Add(t.timeout())))
+	if err := WriteTCP(t.conn, b); err != nil {
+		return nil, 0, err
+	}
+	for {
+		msg, err := ReadTCP(t.conn)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := Unpack(msg)
+		if err != nil {
+			return nil, 0, err
+		}
+		if isResponse(q, resp) {
+			return resp, time.Since(start), nil
+		}
+	}
+}
+
+// timeout returns the time allowed for each query.
+func (t *TLSTransport) timeout() time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Close closes the connection to the server, if one is open. The transport remains usable, and will open a new
+// connection when next needed.
+func (t *TLSTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// HTTPSTransport carries queries over DNS over HTTPS, as described by RFC 8484. Connections are reused, and HTTP/2
+// used where the server offers it, as far as the HTTP client allows.
+type HTTPSTransport struct {
+	URL     string        // The URL of the server, such as https://dns.example/dns-query.
+	Client  *http.Client  // Used to send requests, or http.DefaultClient if nil.
+	GET     bool          // Send queries with GET rather than POST, which makes the responses cacheable.
+	Timeout time.Duration // The time allowed for each query, or DefaultTimeout if zero.
+}
+
+// Exchange satisfies Transport.
+func (t *HTTPSTransport) Exchange(ctx context.Context, q *Message) (*Message, time.Duration, error) {
+	query := *q
+	if t.GET {
+		// RFC 8484 asks for an ID of zero, so that identical queries have identical URLs and can share a cache entry.
+		query.ID = 0
+	}
+	b, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	timeout := DefaultTimeout
+	if t.Timeout > 0 {
+		timeout = t.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := t.request(ctx, b)
+	if err != nil {
+		return nil, 0, err
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, contextErr(ctx, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%s: %s", t.URL, res.Status)
+	}
+	if ct, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err != nil || ct != mediaType {
+		return nil, 0, fmt.Errorf("%s: unexpected content type %q", t.URL, res.Header.Get("Content-Type"))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxTCPLen+1))
+	if err != nil {
+		return nil, 0, contextErr(ctx, err)
+	}
+	if len(body) > maxTCPLen {
+		return nil, 0, fmt.Errorf("%s: response too long", t.URL)
+	}
+	rtt := time.Since(start)
+
+	resp, err := Unpack(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isResponse(&query, resp) {
+		return nil, 0, fmt.Errorf("%s: response does not match query", t.URL)
+	}
+	return resp, rtt, nil
+}
+
+// request builds the HTTP request carrying a packed query.
+func (t *HTTPSTransport) request(ctx context.Context, b []byte) (*http.Request, error) {
+	var req *http.Request
+	if t.GET {
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return nil, err
+		}
+		params := u.Query()
+		params.Set("dns", base64.RawURLEncoding.EncodeToString(b))
+		u.RawQuery = params.Encode()
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if req, err = http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(b)); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+	}
+	req.Header.Set("Accept", mediaType)
+	return req, nil
+}
+
+// Fallback is a Transport that tries each of its transports in order until one returns a response, so that encrypted
+// transports can be preferred with plain DNS behind them. A response with an unsuccessful response code is still a
+// response, and is returned rather than trying the next transport.
+type Fallback []Transport
+
+// Exchange satisfies Transport.
+func (f Fallback) Exchange(ctx context.Context, q *Message) (*Message, time.Duration, error) {
+	if len(f) == 0 {
+		return nil, 0, errors.New("no transports")
+	}
+	var err error
+	for _, t := range f {
+		var resp *Message
+		var rtt time.Duration
+		if resp, rtt, err = t.Exchange(ctx, q); err == nil {
+			return resp, rtt, nil
+		}
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+	}
+	return nil, 0, fmt.Errorf("all %d transports failed, last: %w", len(f), err)
+}
@@ -0,0 +1,180 @@
+package dnsutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/iprange"
+	"net"
+	"time"
+)
+
+// Transfer is a zone transferred by AXFR or IXFR.
+type Transfer struct {
+	Zone   string
+	Serial uint32 // The serial of the zone as transferred.
+	// Records holds the whole zone, starting with its SOA record, unless the transfer was incremental.
+	Records []RR
+	// Incremental reports whether the server sent only the differences from the serial asked for, in Deltas, rather
+	// than the whole zone. A zone that has not changed since the serial is incremental with no deltas.
+	Incremental bool
+	Deltas      []Delta
+}
+
+// Delta is a change to a zone from one serial to the next, as sent by IXFR.
+type Delta struct {
+	From, To uint32
+	Deleted  []RR
+	Added    []RR
+}
+
+// AXFR transfers the whole of a zone from the server, as described by RFC 5936. Transfers always use TCP, whatever the
+// client says, and are only permitted by most servers to the addresses of secondaries.
+func (c *Client) AXFR(ctx context.Context, zone string) (*Transfer, error) {
+	q := &Message{Questions: []Question{{Name: Fqdn(zone), Type: TypeAXFR, Class: ClassINET}}}
+	rrs, err := c.transfer(ctx, q, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Transfer{Zone: Fqdn(zone), Serial: rrs[0].Data.(*SOA).Serial, Records: rrs[:len(rrs)-1]}, nil
+}
+
+// IXFR transfers the changes to a zone since a serial from the server, as described by RFC 1995. The server may send
+// the whole zone instead, such as when it no longer has the history, in which case the transfer is not incremental.
+func (c *Client) IXFR(ctx context.Context, zone string, serial uint32) (*Transfer, error) {
+	q := &Message{
+		Questions: []Question{{Name: Fqdn(zone), Type: TypeIXFR, Class: ClassINET}},
+		Authority: []RR{{Name: Fqdn(zone), Type: TypeSOA, Class: ClassINET, Data: &SOA{MName: ".", RName: ".",
+			Serial: serial}}},
+	}
+	rrs, err := c.transfer(ctx, q, true)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transfer{Zone: Fqdn(zone), Serial: rrs[0].Data.(*SOA).Serial}
+	if len(rrs) == 1 {
+		t.Incremental = true
+		return t, nil
+	}
+	if rrs[1].Type != TypeSOA {
+		t.Records = rrs[:len(rrs)-1]
+		return t, nil
+	}
+
+	// Each delta is the old SOA record, the records deleted, the new SOA record and the records added.
+	t.Incremental = true
+	var d *Delta
+	added := false
+	for _, rr := range rrs[1 : len(rrs)-1] {
+		soa, isSOA := rr.Data.(*SOA)
+		switch {
+		case isSOA && (d == nil || added):
+			t.Deltas = append(t.Deltas, Delta{From: soa.Serial})
+			d, added = &t.Deltas[len(t.Deltas)-1], false
+		case isSOA:
+			d.To, added = soa.Serial, true
+		case added:
+			d.Added = append(d.Added, rr)
+		default:
+			d.Deleted = append(d.Deleted, rr)
+		}
+	}
+	return t, nil
+}
+
+// transfer sends a transfer query over TCP and reads the records of the responses up to and including the SOA record
+// that ends the transfer. A response of a single SOA record ends an incremental transfer of a zone that is up to date.
+func (c *Client) transfer(ctx context.Context, query *Message, incremental bool) ([]RR, error) {
+	q := *query
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	q.ID = binary.BigEndian.Uint16(id[:])
+	b, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dial(ctx, "tcp")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline(ctx, time.Now().Add(c.timeout())))
+	if err := WriteTCP(conn, b); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+
+	var rrs []RR
+	var serial uint32
+	soas := 0 // The SOA records with the serial of the zone, which mark the end of the transfer.
+	for first := true; ; first = false {
+		// Each message is given the full timeout, as a large zone may take many to send.
+		conn.SetDeadline(deadline(ctx, time.Now().Add(c.timeout())))
+		msg, err := ReadTCP(conn)
+		if err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		resp, err := Unpack(msg)
+		if err != nil {
+			return nil, err
+		}
+		// Messages after the first need not repeat the question, so are matched only by ID.
+		if !resp.Response || resp.ID != q.ID || (first && !isResponse(&q, resp)) {
+			return nil, errors.New("zone transfer response does not match query")
+		}
+		if resp.RCode != RCodeSuccess {
+			return nil, &RCodeError{Name: q.Questions[0].Name, Server: c.address(), RCode: resp.RCode}
+		}
+		for _, rr := range resp.Answers {
+			soa, isSOA := rr.Data.(*SOA)
+			if len(rrs) == 0 {
+				if !isSOA {
+					return nil, fmt.Errorf("zone transfer of %s does not start with an soa record", q.Questions[0].Name)
+				}
+				serial = soa.Serial
+			}
+			rrs = append(rrs, rr)
+			if isSOA && soa.Serial == serial {
+				soas++
+			}
+			// A whole zone ends at its second SOA record, and an incremental transfer at its third with the serial of
+			// the zone: the new SOA record of the last delta, and then the closing one.
+			full := !incremental || (len(rrs) > 1 && rrs[1].Type != TypeSOA)
+			if len(rrs) > 1 && isSOA && (full || soas == 3) {
+				return rrs, nil
+			}
+		}
+		if incremental && first && len(rrs) == 1 {
+			return rrs, nil
+		}
+		if len(resp.Answers) == 0 {
+			return nil, fmt.Errorf("zone transfer of %s ended early", q.Questions[0].Name)
+		}
+	}
+}
+
+// AddressSet returns the addresses of the A and AAAA records among rrs, such as those of a zone, as a set whose
+// IPNets method aggregates them into the fewest prefixes.
+func AddressSet(rrs []RR) *iprange.Set {
+	s := &iprange.Set{}
+	for _, rr := range rrs {
+		var ip net.IP
+		switch data := rr.Data.(type) {
+		case *A:
+			ip = data.IP.To4()
+		case *AAAA:
+			ip = data.IP.To16()
+		default:
+			continue
+		}
+		if ip == nil {
+			continue
+		}
+		bits := 8 * len(ip)
+		s.AddIPNet(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return s
+}
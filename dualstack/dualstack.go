@@ -0,0 +1,183 @@
+package dualstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultFallbackDelay is how long the Happy Eyeballs race waits for the preferred family before also trying the
+// other, as recommended by RFC 8305.
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// ErrNoAddress is the error of a family the target has no address in.
+var ErrNoAddress = errors.New("no address in family")
+
+// Family is an address family.
+type Family string
+
+// Address families.
+const (
+	IPv4 Family = "ipv4"
+	IPv6 Family = "ipv6"
+)
+
+// Result is the outcome of measuring one address family of a target.
+type Result struct {
+	IP   net.IP
+	RTT  time.Duration // The typical round-trip time, such as the mean.
+	Loss float64       // The proportion of probes that went unanswered, from 0 to 1.
+	Err  error         // Why the family could not be measured, such as ErrNoAddress; the other fields are then zero.
+}
+
+// Prober measures the round-trip time and loss to a single address.
+type Prober func(ctx context.Context, ip net.IP) (*Result, error)
+
+// Comparison is the outcome of the same measurement over both address families of a target.
+type Comparison struct {
+	Host string
+	IPv4 Result
+	IPv6 Result
+	// The family a Happy Eyeballs connection to the target used, or empty if no race was run or neither connected.
+	HappyEyeballs Family
+	RaceErr       error // Why the race failed, if it did.
+}
+
+// Both reports whether both families were measured.
+func (c *Comparison) Both() bool {
+	return c.IPv4.Err == nil && c.IPv6.Err == nil
+}
+
+// RTTDelta returns how much longer the round-trip time is over IPv6 than IPv4, which is negative if IPv6 is faster,
+// or zero unless both families were measured.
+func (c *Comparison) RTTDelta() time.Duration {
+	if !c.Both() {
+		return 0
+	}
+	return c.IPv6.RTT - c.IPv4.RTT
+}
+
+// LossDelta returns how much higher the loss is over IPv6 than IPv4, which is negative if IPv6 loses less, or zero
+// unless both families were measured.
+func (c *Comparison) LossDelta() float64 {
+	if !c.Both() {
+		return 0
+	}
+	return c.IPv6.Loss - c.IPv4.Loss
+}
+
+// Comparer runs measurements over both address families of a target concurrently. The zero value is usable, but runs
+// no Happy Eyeballs race.
+type Comparer struct {
+	Resolver *net.Resolver // Used to find the addresses of the target, or net.DefaultResolver if nil.
+	// A TCP port of the target to race connections to, as a Happy Eyeballs client would, or zero for no race.
+	Port          int
+	FallbackDelay time.Duration // The head start of the preferred family in the race, or DefaultFallbackDelay if zero.
+}
+
+// Compare measures host, a name or address, with probe over each family it has an address in, using the first address
+// of each, and races a connection to it if the comparer has a port. It only fails if host has no address at all.
+func (c *Comparer) Compare(ctx context.Context, host string, probe Prober) (*Comparison, error) {
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	out := &Comparison{
+		Host: host,
+		IPv4: Result{Err: fmt.Errorf("%w: %s has no IPv4 address", ErrNoAddress, host)},
+		IPv6: Result{Err: fmt.Errorf("%w: %s has no IPv6 address", ErrNoAddress, host)},
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if r := out.result(addr.IP); r.IP == nil {
+			r.IP, r.Err = addr.IP, nil
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, ip := range ips {
+		wg.Add(1)
+		go func(ip net.IP) {
+			defer wg.Done()
+			r := out.result(ip)
+			res, err := probe(ctx, ip)
+			if err != nil {
+				*r = Result{IP: ip, Err: err}
+				return
+			}
+			r.RTT, r.Loss = res.RTT, res.Loss
+		}(ip)
+	}
+	if c.Port != 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out.HappyEyeballs, out.RaceErr = c.race(ctx, host)
+		}()
+	}
+	wg.Wait()
+	return out, nil
+}
+
+// result returns the result of the family of ip.
+func (c *Comparison) result(ip net.IP) *Result {
+	if ip.To4() != nil {
+		return &c.IPv4
+	}
+	return &c.IPv6
+}
+
+// race connects to the target with the Happy Eyeballs algorithm of the net package, returning the family that won.
+func (c *Comparer) race(ctx context.Context, host string) (Family, error) {
+	d := net.Dialer{Resolver: c.Resolver, FallbackDelay: c.FallbackDelay}
+	if d.FallbackDelay <= 0 {
+		d.FallbackDelay = DefaultFallbackDelay
+	}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(c.Port)))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().(*net.TCPAddr).IP.To4() != nil {
+		return IPv4, nil
+	}
+	return IPv6, nil
+}
+
+// Path measures addresses with a path probe, as ping would, from the answers of the destination itself. A
+// destination that never answered has a loss of one.
+func Path(p *pathprobe.Prober) Prober {
+	return func(ctx context.Context, ip net.IP) (*Result, error) {
+		report, err := p.Run(ctx, ip)
+		if err != nil {
+			return nil, err
+		}
+		if !report.Reached {
+			return &Result{IP: ip, Loss: 1}, nil
+		}
+		hop := &report.Hops[len(report.Hops)-1]
+		return &Result{IP: ip, RTT: hop.Mean, Loss: hop.Loss()}, nil
+	}
+}
+
+// UDP measures addresses with UDP probes to a responder listening on port.
+func UDP(p *udpprobe.Prober, port int) Prober {
+	return func(ctx context.Context, ip net.IP) (*Result, error) {
+		stats, err := p.Run(ctx, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		if err != nil {
+			return nil, err
+		}
+		return &Result{IP: ip, RTT: stats.MeanRTT, Loss: stats.Loss()}, nil
+	}
+}
@@ -0,0 +1,133 @@
+package dualstack
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"net"
+	"testing"
+	"time"
+)
+
+// testResolver returns a resolver answering every name with 127.0.0.1 and ::1, from a DNS server on the loopback.
+func testResolver(t *testing.T) *net.Resolver {
+	t.Helper()
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q, err := dnsutil.Unpack(buf[:n])
+			if err != nil || len(q.Questions) != 1 {
+				continue
+			}
+			resp := &dnsutil.Message{ID: q.ID, Response: true, Questions: q.Questions}
+			rr := dnsutil.RR{Name: q.Questions[0].Name, Type: q.Questions[0].Type, Class: dnsutil.ClassINET, TTL: 60}
+			switch q.Questions[0].Type {
+			case dnsutil.TypeA:
+				rr.Data = &dnsutil.A{IP: net.IPv4(127, 0, 0, 1).To4()}
+				resp.Answers = []dnsutil.RR{rr}
+			case dnsutil.TypeAAAA:
+				rr.Data = &dnsutil.AAAA{IP: net.IPv6loopback}
+				resp.Answers = []dnsutil.RR{rr}
+			}
+			if b, err := resp.Pack(); err == nil {
+				server.WriteTo(b, addr)
+			}
+		}
+	}()
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", server.LocalAddr().String())
+		},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ctx := context.Background()
+	resolver := testResolver(t)
+
+	t.Run("Fake", func(t *testing.T) {
+		c := &Comparer{Resolver: resolver}
+		got, err := c.Compare(ctx, "dual.example", func(ctx context.Context, ip net.IP) (*Result, error) {
+			if ip.To4() != nil {
+				return &Result{RTT: 30 * time.Millisecond, Loss: 0.1}, nil
+			}
+			return &Result{RTT: 20 * time.Millisecond, Loss: 0.3}, nil
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !got.IPv4.IP.Equal(net.IPv4(127, 0, 0, 1)) || !got.IPv6.IP.Equal(net.IPv6loopback) || !got.Both() {
+			t.Fatalf("got %+v, want both families measured", got)
+		}
+		if d := got.LossDelta(); got.RTTDelta() != -10*time.Millisecond || d < 0.199 || d > 0.201 {
+			t.Fatalf("got rtt delta %v, loss delta %v", got.RTTDelta(), got.LossDelta())
+		}
+		if got.HappyEyeballs != "" {
+			t.Fatalf("got winner %q without a race", got.HappyEyeballs)
+		}
+	})
+
+	t.Run("OneFamily", func(t *testing.T) {
+		var c Comparer
+		got, err := c.Compare(ctx, "192.0.2.1", func(ctx context.Context, ip net.IP) (*Result, error) {
+			return nil, errors.New("unreachable")
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if got.IPv4.Err == nil || !errors.Is(got.IPv6.Err, ErrNoAddress) || got.Both() || got.RTTDelta() != 0 {
+			t.Fatalf("got %+v", got)
+		}
+	})
+
+	t.Run("UDP", func(t *testing.T) {
+		r, err := udpprobe.Listen("[::]:0")
+		if err != nil {
+			t.Skipf("listen err: %v", err)
+		}
+		defer r.Close()
+		ln, err := net.Listen("tcp", "[::]:0")
+		if err != nil {
+			t.Skipf("listen err: %v", err)
+		}
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+
+		c := &Comparer{Resolver: resolver, Port: ln.Addr().(*net.TCPAddr).Port}
+		p := &udpprobe.Prober{Count: 10, Interval: time.Millisecond, Timeout: 100 * time.Millisecond}
+		got, err := c.Compare(ctx, "dual.example", UDP(p, r.Addr().(*net.UDPAddr).Port))
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if got.IPv6.Err != nil {
+			t.Skipf("IPv6 err: %v", got.IPv6.Err)
+		}
+		if !got.Both() || got.IPv4.Loss != 0 || got.IPv6.Loss != 0 || got.IPv4.RTT <= 0 || got.IPv6.RTT <= 0 {
+			t.Fatalf("got %+v", got)
+		}
+		// The net package prefers IPv6, which wins easily over the loopback.
+		if got.HappyEyeballs != IPv6 || got.RaceErr != nil {
+			t.Fatalf("got winner %q, err %v", got.HappyEyeballs, got.RaceErr)
+		}
+	})
+}
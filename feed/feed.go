@@ -0,0 +1,296 @@
+package feed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/aggregate"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used by feeds whose fields are not set.
+const (
+	DefaultInterval = time.Hour
+	DefaultTimeout  = time.Minute
+)
+
+// ErrTooFew is returned when a feed holds fewer prefixes than its minimum, as a truncated or emptied feed would.
+var ErrTooFew = errors.New("too few prefixes")
+
+// Feed is a remote list of prefixes, fetched over HTTP or HTTPS. Fetches are conditional on the ETag and
+// Last-Modified validators of the previous response, so unchanged feeds cost little, and the prefixes are validated and
+// aggregated before replacing those from earlier fetches. A feed whose fetch fails keeps its previous prefixes.
+type Feed struct {
+	URL         string
+	Format      Format        // The format of the feed, or FormatText if empty.
+	Column      int           // The column of CSV records holding prefixes, counting from zero.
+	Field       string        // The name of the JSON fields holding prefixes, or empty for an array of prefixes.
+	Header      http.Header   // Added to each request.
+	Client      *http.Client  // The client to fetch with, or http.DefaultClient if nil.
+	Timeout     time.Duration // How long a fetch may take, or DefaultTimeout if zero.
+	Interval    time.Duration // How often Run fetches the feed, or DefaultInterval if zero.
+	MinPrefixes int           // The fewest prefixes accepted from a fetch, after aggregation, or one if zero.
+	// A file the prefixes and validators are saved to after each change, and loaded from by Load, so that a restarted
+	// process has prefixes before the feed can be fetched, and need not fetch it again if it is unchanged.
+	CacheFile string
+
+	mu           sync.Mutex
+	pfxs         []*net.IPNet
+	etag         string
+	lastModified string
+	fetched      time.Time
+}
+
+// Update is a notification from Run: either new prefixes, or an error fetching them.
+type Update struct {
+	Prefixes []*net.IPNet // The aggregated prefixes, which are the previous ones if Err is set.
+	Err      error
+}
+
+// Prefixes returns the aggregated prefixes of the feed, or nil if it has not been fetched or loaded.
+func (f *Feed) Prefixes() []*net.IPNet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pfxs
+}
+
+// Fetched returns the time the feed was last fetched successfully, whether or not it had changed.
+func (f *Feed) Fetched() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetched
+}
+
+// Fetch fetches the feed, reporting whether its prefixes changed.
+func (f *Feed) Fetch(ctx context.Context) (bool, error) {
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	for k, v := range f.Header {
+		req.Header[k] = v
+	}
+	f.mu.Lock()
+	if f.pfxs != nil {
+		if f.etag != "" {
+			req.Header.Set("If-None-Match", f.etag)
+		}
+		if f.lastModified != "" {
+			req.Header.Set("If-Modified-Since", f.lastModified)
+		}
+	}
+	f.mu.Unlock()
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		f.mu.Lock()
+		f.fetched = time.Now()
+		f.mu.Unlock()
+		return false, nil
+	default:
+		return false, fmt.Errorf("fetch %s: %s", f.URL, resp.Status)
+	}
+
+	pfxs, err := f.parse(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", f.URL, err)
+	}
+	f.mu.Lock()
+	changed := !equal(f.pfxs, pfxs)
+	f.pfxs = pfxs
+	f.etag, f.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	f.fetched = time.Now()
+	f.mu.Unlock()
+	return changed, f.save()
+}
+
+// parse reads, validates, and aggregates the prefixes of the feed.
+func (f *Feed) parse(r io.Reader) ([]*net.IPNet, error) {
+	pfxs, err := Parse(r, f.Format, f.Column, f.Field)
+	if err != nil {
+		return nil, err
+	}
+	if pfxs, err = aggregate.IPNets(pfxs); err != nil {
+		return nil, err
+	}
+	min := f.MinPrefixes
+	if min == 0 {
+		min = 1
+	}
+	if len(pfxs) < min {
+		return nil, fmt.Errorf("%w: %d, want at least %d", ErrTooFew, len(pfxs), min)
+	}
+	return pfxs, nil
+}
+
+// equal reports whether two aggregated lists of prefixes are the same.
+func equal(a, b []*net.IPNet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// Cache files hold the validators of the response the prefixes came from in comments, followed by the prefixes.
+const (
+	cacheETag         = "# etag: "
+	cacheLastModified = "# last-modified: "
+)
+
+// save writes the prefixes and validators to the cache file, if there is one, replacing it atomically.
+func (f *Feed) save() error {
+	if f.CacheFile == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	f.mu.Lock()
+	fmt.Fprintf(&b, "# %s\n", f.URL)
+	if f.etag != "" {
+		fmt.Fprintf(&b, "%s%s\n", cacheETag, f.etag)
+	}
+	if f.lastModified != "" {
+		fmt.Fprintf(&b, "%s%s\n", cacheLastModified, f.lastModified)
+	}
+	for _, pfx := range f.pfxs {
+		fmt.Fprintln(&b, pfx)
+	}
+	f.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.CacheFile), filepath.Base(f.CacheFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.CacheFile)
+}
+
+// Load reads the prefixes and validators saved in the cache file, if there is one and it exists.
+func (f *Feed) Load() error {
+	if f.CacheFile == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(f.CacheFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var etag, lastModified string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if text := s.Text(); strings.HasPrefix(text, cacheETag) {
+			etag = strings.TrimPrefix(text, cacheETag)
+		} else if strings.HasPrefix(text, cacheLastModified) {
+			lastModified = strings.TrimPrefix(text, cacheLastModified)
+		}
+	}
+	pfxs, err := ParseText(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.CacheFile, err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pfxs = pfxs
+	if f.pfxs == nil {
+		f.pfxs = []*net.IPNet{}
+	}
+	f.etag, f.lastModified = etag, lastModified
+	return nil
+}
+
+// Run loads the cache file and fetches the feed at once and then every interval, until ctx is done, when the returned
+// channel is closed. An update is sent with the prefixes each time they change, starting with those from the cache,
+// and with the error each time a fetch fails. Updates must be received for the feed to be fetched again.
+func (f *Feed) Run(ctx context.Context) <-chan Update {
+	updates := make(chan Update)
+	interval := f.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	send := func(u Update) bool {
+		select {
+		case updates <- u:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(updates)
+		if err := f.Load(); err != nil {
+			if !send(Update{Err: err}) {
+				return
+			}
+		} else if pfxs := f.Prefixes(); pfxs != nil {
+			if !send(Update{Prefixes: pfxs}) {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			changed, err := f.Fetch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			switch {
+			case err != nil:
+				if !send(Update{Prefixes: f.Prefixes(), Err: err}) {
+					return
+				}
+			case changed:
+				if !send(Update{Prefixes: f.Prefixes()}) {
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates
+}
@@ -0,0 +1,146 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// server serves a feed with an ETag, counting the requests that were answered in full.
+type server struct {
+	mu     sync.Mutex
+	body   string
+	status int
+	full   int
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	etag := fmt.Sprintf("%q", fmt.Sprintf("%x", len(s.body)))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.full++
+	w.Header().Set("ETag", etag)
+	fmt.Fprint(w, s.body)
+}
+
+func (s *server) set(body string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.status = body, status
+}
+
+func strs(pfxs []*net.IPNet) []string {
+	var strs []string
+	for _, pfx := range pfxs {
+		strs = append(strs, pfx.String())
+	}
+	return strs
+}
+
+func TestFetch(t *testing.T) {
+	s := &server{body: "192.0.2.0/25\n192.0.2.128/25\n2001:db8::/32\n"}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	cache := filepath.Join(t.TempDir(), "feed.txt")
+	f := &Feed{URL: srv.URL, CacheFile: cache}
+	ctx := context.Background()
+
+	changed, err := f.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("fetch err: %v", err)
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "2001:db8::/32"}, strs(f.Prefixes())); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if !changed {
+		t.Errorf("first fetch: not changed")
+	}
+	if f.Fetched().IsZero() {
+		t.Errorf("first fetch: no fetch time")
+	}
+
+	// An unchanged feed is not sent again.
+	if changed, err = f.Fetch(ctx); err != nil || changed {
+		t.Fatalf("second fetch: got %v, %v, want false, nil", changed, err)
+	}
+	if diff := cmp.Diff(1, s.full); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// A failed fetch, or one with too few prefixes, keeps the previous prefixes.
+	s.set("", http.StatusInternalServerError)
+	if _, err = f.Fetch(ctx); err == nil {
+		t.Fatalf("failed fetch: got no error")
+	}
+	s.set("# emptied\n", 0)
+	if _, err = f.Fetch(ctx); !errors.Is(err, ErrTooFew) {
+		t.Fatalf("emptied fetch: got %v, want %v", err, ErrTooFew)
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "2001:db8::/32"}, strs(f.Prefixes())); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// A new feed with the same cache starts with the cached prefixes, and a conditional fetch.
+	s.set("192.0.2.0/25\n192.0.2.128/25\n2001:db8::/32\n", 0)
+	g := &Feed{URL: srv.URL, CacheFile: cache}
+	if err := g.Load(); err != nil {
+		t.Fatalf("load err: %v", err)
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "2001:db8::/32"}, strs(g.Prefixes())); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if changed, err = g.Fetch(ctx); err != nil || changed {
+		t.Fatalf("cached fetch: got %v, %v, want false, nil", changed, err)
+	}
+	// Only the first fetch and the emptied one were answered in full.
+	if diff := cmp.Diff(2, s.full); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := &server{body: `{"prefixes": [{"ip_prefix": "192.0.2.0/24"}]}`}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	f := &Feed{URL: srv.URL, Format: FormatJSON, Field: "ip_prefix", Interval: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := f.Run(ctx)
+	u := <-updates
+	if diff := cmp.Diff([]string{"192.0.2.0/24"}, strs(u.Prefixes)); diff != "" || u.Err != nil {
+		t.Fatalf("first update: %v %v", u.Err, diff)
+	}
+
+	s.set(`{"prefixes": [{"ip_prefix": "192.0.2.0/24"}, {"ip_prefix": "198.51.100.0/24"}]}`, 0)
+	u = <-updates
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "198.51.100.0/24"}, strs(u.Prefixes)); diff != "" || u.Err != nil {
+		t.Fatalf("second update: %v %v", u.Err, diff)
+	}
+
+	s.set("", http.StatusNotFound)
+	u = <-updates
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "198.51.100.0/24"}, strs(u.Prefixes)); diff != "" || u.Err == nil {
+		t.Fatalf("failed update: %v %v", u.Err, diff)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
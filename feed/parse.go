@@ -0,0 +1,264 @@
+package feed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// Format is the format of a prefix feed.
+type Format string
+
+// Formats of prefix feeds.
+const (
+	FormatAuto Format = "auto" // Detected from the content, as Detect does.
+	FormatText Format = "text" // One or more prefixes to a line, with comments starting with # or ;.
+	FormatCSV  Format = "csv"  // Prefixes in a column of CSV records.
+	FormatJSON Format = "json" // Prefixes in an array of strings, or in fields of objects.
+	FormatRPSL Format = "rpsl" // Prefixes of RPSL route and route6 objects, such as from an IRR database dump.
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatAuto, FormatText, FormatCSV, FormatJSON, FormatRPSL}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == strings.ToLower(s) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+// Detect returns the format of b: JSON if it starts with an array or object, RPSL if it has route or route6
+// attributes, text if every field of every line is a prefix, or otherwise CSV if it has commas. Anything else is taken
+// as text, which fails to parse.
+func Detect(b []byte) Format {
+	trimmed := bytes.TrimSpace(b)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		return FormatJSON
+	}
+	text := true
+	for _, line := range strings.Split(string(b), "\n") {
+		if _, ok := rpslRoute(line); ok {
+			return FormatRPSL
+		}
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if _, err := parsePrefix(strings.TrimPrefix(field, "!")); err != nil {
+				text = false
+			}
+		}
+	}
+	if !text && bytes.IndexByte(b, ',') >= 0 {
+		return FormatCSV
+	}
+	return FormatText
+}
+
+// Parse reads prefixes in the given format, detecting it if it is FormatAuto. Column is the CSV column holding
+// prefixes, and field the name of JSON fields holding them, as for ParseCSV and ParseJSON.
+func Parse(r io.Reader, format Format, column int, field string) ([]*net.IPNet, error) {
+	if format == FormatAuto {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		r, format = bytes.NewReader(b), Detect(b)
+	}
+	switch format {
+	case FormatText, "":
+		return ParseText(r)
+	case FormatCSV:
+		return ParseCSV(r, column)
+	case FormatJSON:
+		return ParseJSON(r, field)
+	case FormatRPSL:
+		return ParseRPSL(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// ParseText reads prefixes, one or more to a line separated by spaces or commas, ignoring blank lines and comments
+// starting with # or ;. Addresses without a length are taken as single hosts.
+func ParseText(r io.Reader) ([]*net.IPNet, error) {
+	var pfxs []*net.IPNet
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexAny(text, "#;"); i >= 0 {
+			text = text[:i]
+		}
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			pfx, err := parsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			pfxs = append(pfxs, pfx)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return pfxs, nil
+}
+
+// ParseCSV reads prefixes from a column of CSV records, counting from zero. Records starting with # are skipped, as is
+// the first record if it is a header that does not hold a prefix.
+func ParseCSV(r io.Reader, column int) ([]*net.IPNet, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var pfxs []*net.IPNet
+	for record := 1; ; record++ {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return pfxs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if column >= len(fields) {
+			return nil, fmt.Errorf("record %d: no column %d", record, column)
+		}
+		pfx, err := parsePrefix(strings.TrimSpace(fields[column]))
+		if err != nil {
+			if record == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("record %d: %w", record, err)
+		}
+		pfxs = append(pfxs, pfx)
+	}
+}
+
+// ParseJSON reads prefixes from a JSON document. If field is empty, the document must be an array of prefixes;
+// otherwise the prefixes are the values of every field with that name, at any depth, as in the feeds of most cloud
+// providers, where it is named "ip_prefix" or "ipv4Prefix". A field may also hold an array of prefixes.
+func ParseJSON(r io.Reader, field string) ([]*net.IPNet, error) {
+	if field == "" {
+		var strs []string
+		if err := json.NewDecoder(r).Decode(&strs); err != nil {
+			return nil, err
+		}
+		return parsePrefixes(strs)
+	}
+
+	var doc interface{}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var strs []string
+	var walk func(v interface{}, named bool) error
+	walk = func(v interface{}, named bool) error {
+		switch v := v.(type) {
+		case string:
+			if named {
+				strs = append(strs, v)
+			}
+		case []interface{}:
+			for _, e := range v {
+				if err := walk(e, named); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			for k, e := range v {
+				if err := walk(e, k == field); err != nil {
+					return err
+				}
+			}
+		default:
+			if named && v != nil {
+				return fmt.Errorf("field %q holds %v rather than a prefix", field, v)
+			}
+		}
+		return nil
+	}
+	if err := walk(doc, false); err != nil {
+		return nil, err
+	}
+	return parsePrefixes(strs)
+}
+
+// ParseRPSL reads the prefixes of route and route6 objects in RPSL, ignoring every other attribute and object.
+func ParseRPSL(r io.Reader) ([]*net.IPNet, error) {
+	var pfxs []*net.IPNet
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		value, ok := rpslRoute(s.Text())
+		if !ok {
+			continue
+		}
+		pfx, err := parsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return pfxs, nil
+}
+
+// rpslRoute returns the value of a route or route6 attribute, without any comment, and whether the line is one.
+func rpslRoute(line string) (string, bool) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return "", false
+	}
+	if name := strings.ToLower(line[:i]); name != "route" && name != "route6" {
+		return "", false
+	}
+	value := line[i+1:]
+	if j := strings.IndexByte(value, '#'); j >= 0 {
+		value = value[:j]
+	}
+	return strings.TrimSpace(value), true
+}
+
+// parsePrefixes parses a list of prefixes.
+func parsePrefixes(strs []string) ([]*net.IPNet, error) {
+	pfxs := make([]*net.IPNet, 0, len(strs))
+	for _, s := range strs {
+		pfx, err := parsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	return pfxs, nil
+}
+
+// parsePrefix parses a prefix in CIDR notation, or a single address.
+func parsePrefix(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q", s)
+		}
+		return pfx, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid prefix %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
@@ -0,0 +1,156 @@
+package feed
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const rpsl = `route:          192.0.2.0/24
+descr:          Example route # with a comment
+origin:         AS64496
+mnt-by:         MAINT-EXAMPLE
+source:         RIPE
+
+ROUTE6:         2001:db8::/32 # upper case attribute
+origin:         AS64496
+source:         RIPE
+`
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		format  Format
+		column  int
+		field   string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		"Text": {
+			format: FormatText,
+			input:  "; Spamhaus DROP List\n192.0.2.0/24 ; SBL1\n198.51.100.0/24, 2001:db8::/32 # two\n\n203.0.113.7\n",
+			want:   []string{"192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32", "203.0.113.7/32"},
+		},
+		"TextInvalid": {
+			format:  FormatText,
+			input:   "192.0.2.0/24\n192.0.2.0/33\n",
+			wantErr: true,
+		},
+		"CSV": {
+			format: FormatCSV,
+			column: 1,
+			input:  "name,prefix,country\n# comment\nfoo,192.0.2.0/24,GB\nbar, 2001:db8::/32,DE\n",
+			want:   []string{"192.0.2.0/24", "2001:db8::/32"},
+		},
+		"CSVNoHeader": {
+			format: FormatCSV,
+			input:  "192.0.2.0/24,GB\n198.51.100.0/24,DE\n",
+			want:   []string{"192.0.2.0/24", "198.51.100.0/24"},
+		},
+		"CSVMissingColumn": {
+			format:  FormatCSV,
+			column:  2,
+			input:   "192.0.2.0/24,GB\n",
+			wantErr: true,
+		},
+		"CSVInvalid": {
+			format:  FormatCSV,
+			input:   "prefix\n192.0.2.0/24\nbogus\n",
+			wantErr: true,
+		},
+		"JSONArray": {
+			format: FormatJSON,
+			input:  `["192.0.2.0/24", "2001:db8::/32"]`,
+			want:   []string{"192.0.2.0/24", "2001:db8::/32"},
+		},
+		"JSONField": {
+			format: FormatJSON,
+			field:  "prefix",
+			input: `{"lists": [{"name": "a", "prefix": "192.0.2.0/24"}, {"name": "b", "prefix": "198.51.100.0/24"}],` +
+				`"other": {"prefix": ["2001:db8::/32"], "name": "192.0.2.0/24"}}`,
+			want: []string{"192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"},
+		},
+		"JSONFieldNumber": {
+			format:  FormatJSON,
+			field:   "prefix",
+			input:   `[{"prefix": 24}]`,
+			wantErr: true,
+		},
+		"JSONInvalid": {
+			format:  FormatJSON,
+			input:   `["192.0.2.0/24", "bogus"]`,
+			wantErr: true,
+		},
+		"RPSL": {
+			format: FormatRPSL,
+			input:  rpsl,
+			want:   []string{"192.0.2.0/24", "2001:db8::/32"},
+		},
+		"RPSLInvalid": {
+			format:  FormatRPSL,
+			input:   "route: 192.0.2.0/24\norigin: AS64496\n\nroute: 192.0.2.0/33\n",
+			wantErr: true,
+		},
+		"Auto": {
+			format: FormatAuto,
+			input:  "prefix,country\n192.0.2.0/24,GB\n",
+			want:   []string{"192.0.2.0/24"},
+		},
+		"UnknownFormat": {
+			format:  "xml",
+			input:   "<prefix>192.0.2.0/24</prefix>",
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pfxs, err := Parse(strings.NewReader(test.input), test.format, test.column, test.field)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			got := []string{}
+			for _, pfx := range pfxs {
+				got = append(got, pfx.String())
+			}
+			// JSON objects have no order.
+			sort.Strings(got)
+			sort.Strings(test.want)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		want  Format
+	}{
+		"Text":           {input: "# list\n192.0.2.0/24\n!192.0.2.128/25, 2001:db8::/32\n", want: FormatText},
+		"TextSemicolons": {input: "; Spamhaus DROP List\n192.0.2.0/24 ; SBL1\n", want: FormatText},
+		"CSV":            {input: "192.0.2.0/24,GB,GB-LND,London,\n", want: FormatCSV},
+		"CSVHeader":      {input: "prefix,asn\n192.0.2.0/24,64496\n", want: FormatCSV},
+		"JSONArray":      {input: "  [\"192.0.2.0/24\"]", want: FormatJSON},
+		"JSONObject":     {input: "{\"prefixes\": []}", want: FormatJSON},
+		"RPSL":           {input: rpsl, want: FormatRPSL},
+		"Invalid":        {input: "not a prefix\n", want: FormatText},
+		"Empty":          {want: FormatText},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, Detect([]byte(test.input))); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package feed
+
+import (
+	"github.com/dotwaffle/inettools/iprange"
+	"net"
+	"sync"
+)
+
+// Delta is a change to a set of addresses, as the fewest prefixes added and removed.
+type Delta struct {
+	Added   []*net.IPNet
+	Removed []*net.IPNet
+}
+
+// Empty reports whether the delta changes nothing.
+func (d Delta) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Watcher holds a set of addresses that is replaced as a whole, such as from a feed or a file, and notifies subscribers
+// of what each replacement changed. Sets given to and returned by a watcher must not be modified.
+type Watcher struct {
+	mu   sync.Mutex
+	set  *iprange.Set
+	subs map[int]func(Delta)
+	next int
+}
+
+// NewWatcher returns a watcher holding set, or an empty set if it is nil.
+func NewWatcher(set *iprange.Set) *Watcher {
+	if set == nil {
+		set = &iprange.Set{}
+	}
+	return &Watcher{set: set, subs: map[int]func(Delta){}}
+}
+
+// Set returns the current set.
+func (w *Watcher) Set() *iprange.Set {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.set
+}
+
+// Replace replaces the set, returning the change, which subscribers are notified of before it returns unless it is
+// empty.
+func (w *Watcher) Replace(set *iprange.Set) Delta {
+	if set == nil {
+		set = &iprange.Set{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d := Delta{Added: set.Difference(w.set).IPNets(), Removed: w.set.Difference(set).IPNets()}
+	w.set = set
+	if !d.Empty() {
+		for _, fn := range w.subs {
+			fn(d)
+		}
+	}
+	return d
+}
+
+// Subscribe calls fn with the change made by each replacement of the set, in order, starting at once with the whole
+// of the current set as added, so that applying each delta in turn keeps a copy of the set. Replacements wait for fn,
+// which must not call the watcher. The returned function stops the calls.
+func (w *Watcher) Subscribe(fn func(Delta)) (cancel func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.next
+	w.next++
+	w.subs[id] = fn
+	if d := (Delta{Added: w.set.IPNets()}); !d.Empty() {
+		fn(d)
+	}
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Watch replaces the set with the prefixes of each update without an error, until updates is closed, such as by the
+// context of Feed.Run being done.
+func (w *Watcher) Watch(updates <-chan Update) {
+	for u := range updates {
+		if u.Err == nil {
+			w.Replace(iprange.FromIPNets(u.Prefixes))
+		}
+	}
+}
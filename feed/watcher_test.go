@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"github.com/dotwaffle/inettools/iprange"
+	"github.com/google/go-cmp/cmp"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestWatcher(t *testing.T) {
+	set := func(strs ...string) *iprange.Set {
+		s := &iprange.Set{}
+		for _, str := range strs {
+			r, err := iprange.Parse(str)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			s.Add(r)
+		}
+		return s
+	}
+	type delta struct {
+		Added, Removed []string
+	}
+	var got []delta
+	w := NewWatcher(set("192.0.2.0/24"))
+	cancel := w.Subscribe(func(d Delta) {
+		got = append(got, delta{strs(d.Added), strs(d.Removed)})
+	})
+
+	w.Replace(set("192.0.2.0/25", "198.51.100.0/24"))
+	w.Replace(set("192.0.2.0/25", "198.51.100.0/24"))
+	w.Replace(set("192.0.2.0/24", "2001:db8::/32"))
+	cancel()
+	w.Replace(nil)
+
+	want := []delta{
+		{Added: []string{"192.0.2.0/24"}},
+		{Added: []string{"198.51.100.0/24"}, Removed: []string{"192.0.2.128/25"}},
+		{Added: []string{"192.0.2.128/25", "2001:db8::/32"}, Removed: []string{"198.51.100.0/24"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if w.Set().Len() != 0 {
+		t.Fatalf("got %v, want empty set", w.Set().Ranges())
+	}
+}
+
+func TestWatcherRandom(t *testing.T) {
+	// Applying every delta to a replica of the set must give the same set as the watcher.
+	rng := rand.New(rand.NewSource(1))
+	random := func() *iprange.Set {
+		s := &iprange.Set{}
+		for i := rng.Intn(8); i > 0; i-- {
+			ip := net.IPv4(10, 0, byte(rng.Intn(4)), byte(rng.Intn(256)))
+			s.AddIPNet(&net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(24+rng.Intn(9), 32)})
+		}
+		return s
+	}
+
+	w := NewWatcher(random())
+	replica := &iprange.Set{}
+	w.Subscribe(func(d Delta) {
+		for _, pfx := range d.Removed {
+			replica.RemoveIPNet(pfx)
+		}
+		for _, pfx := range d.Added {
+			replica.AddIPNet(pfx)
+		}
+	})
+	for i := 0; i < 200; i++ {
+		w.Replace(random())
+		if !replica.Equal(w.Set()) {
+			t.Fatalf("got %v, want %v", replica.Ranges(), w.Set().Ranges())
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	w := NewWatcher(nil)
+	updates := make(chan Update, 3)
+	updates <- Update{Prefixes: []*net.IPNet{{IP: net.IP{192, 0, 2, 0}, Mask: net.CIDRMask(24, 32)}}}
+	updates <- Update{Err: ErrTooFew}
+	close(updates)
+	w.Watch(updates)
+	if diff := cmp.Diff([]string{"192.0.2.0/24"}, strs(w.Set().IPNets())); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
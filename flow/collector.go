@@ -0,0 +1,100 @@
+package flow
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// maxPacketLen is the largest export packet that can be received over UDP.
+const maxPacketLen = 65535
+
+// Collector receives export packets in any of the supported formats on a socket, decodes them, and delivers the flow
+// records they contain on a channel. Packets that cannot be decoded are counted by the decoder and otherwise ignored.
+type Collector struct {
+	conn    net.PacketConn
+	decoder *Decoder
+	records chan Record
+
+	mu  sync.Mutex
+	err error
+}
+
+// Listen opens a UDP socket on address, such as ":2055", ":4739" or ":6343", and starts collecting from it.
+func Listen(address string) (*Collector, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewCollector(conn, nil, 1024), nil
+}
+
+// NewCollector starts collecting from conn, decoding with decoder, or a new Decoder if it is nil. Up to buffer records
+// are queued for the reader of Records; once the queue is full, reading from the socket pauses, and further export
+// packets queue in the socket or are dropped by the kernel, which can be seen with the udpinfo package.
+func NewCollector(conn net.PacketConn, decoder *Decoder, buffer int) *Collector {
+	if decoder == nil {
+		decoder = NewDecoder()
+	}
+	c := &Collector{
+		conn:    conn,
+		decoder: decoder,
+		records: make(chan Record, buffer),
+	}
+	go c.run()
+	return c
+}
+
+// run reads and decodes export packets until the socket is closed or fails.
+func (c *Collector) run() {
+	defer close(c.records)
+
+	buf := make([]byte, maxPacketLen)
+	for {
+		n, addr, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				c.mu.Lock()
+				c.err = err
+				c.mu.Unlock()
+			}
+			return
+		}
+
+		var exporter net.IP
+		if udpAddr, ok := addr.(*net.UDPAddr); ok {
+			exporter = udpAddr.IP
+		}
+		records, err := c.decoder.Decode(exporter, buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, r := range records {
+			c.records <- r
+		}
+	}
+}
+
+// Records returns the channel on which decoded flow records are delivered. It is closed once the collector stops,
+// after which Err reports why.
+func (c *Collector) Records() <-chan Record {
+	return c.records
+}
+
+// Decoder returns the decoder used by the collector, for access to its statistics.
+func (c *Collector) Decoder() *Decoder {
+	return c.decoder
+}
+
+// Err returns the error that stopped the collector, or nil if it is still running or was stopped by Close.
+func (c *Collector) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close stops the collector by closing its socket. Records already decoded remain available on the channel, which
+// must still be drained for the collector to finish.
+func (c *Collector) Close() error {
+	return c.conn.Close()
+}
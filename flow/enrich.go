@@ -0,0 +1,243 @@
+package flow
+
+import (
+	"github.com/dotwaffle/inettools/geofeed"
+	"github.com/dotwaffle/inettools/lpm"
+	"github.com/dotwaffle/inettools/mmdb"
+	"net"
+	"sync"
+)
+
+// DefaultBogons are the special-purpose prefixes that should never appear as the source or destination of traffic on
+// the public Internet, as registered by RFC 6890 and its updates. Multicast is included, as it is not expected to be
+// routed between networks.
+var DefaultBogons = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/8",
+	"100::/64",
+	"2001:2::/48",
+	"2001:10::/28",
+	"2001:db8::/32",
+	"3ffe::/16",
+	"fc00::/7",
+	"fe80::/10",
+	"fec0::/10",
+	"ff00::/8",
+}
+
+// Annotation describes what is known about one of the addresses of a flow.
+type Annotation struct {
+	Prefix  *net.IPNet // The longest matching route, or nil if there is none.
+	ASN     uint32     // The origin AS of the route, or zero if unknown.
+	Bogon   bool       // The address should never be seen on the public Internet.
+	Country string     // The ISO 3166-1 alpha-2 code of the longest matching geofeed entry, if any.
+}
+
+// EnrichedRecord is a flow record, annotated with what is known about its source and destination addresses.
+type EnrichedRecord struct {
+	Record
+	Src Annotation
+	Dst Annotation
+}
+
+// route is the value stored in the routing table of an Enricher.
+type route struct {
+	asn uint32
+}
+
+// Enricher annotates flow records with routing, bogon and geolocation information from longest-prefix-match tables,
+// and from any sources added to it.
+// It is safe for concurrent use, and the tables may be updated while records are being enriched.
+type Enricher struct {
+	mu     sync.RWMutex
+	routes *lpm.Table
+	bogons *lpm.Table
+	geo    *lpm.Table
+	srcs   []Source
+}
+
+// Source is a database of what is known about addresses, such as a MaxMind DB, consulted by an Enricher for what its
+// own tables do not know.
+type Source interface {
+	// Annotate looks up what the source knows about an address. Errors are treated as knowing nothing.
+	Annotate(ip net.IP) (Annotation, error)
+}
+
+// NewEnricher returns an Enricher with no routes or geofeed entries, recognising DefaultBogons as bogons.
+func NewEnricher() *Enricher {
+	e := &Enricher{
+		routes: lpm.New(),
+		bogons: lpm.New(),
+		geo:    lpm.New(),
+	}
+	for _, s := range DefaultBogons {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		if err := e.bogons.Insert(pfx, nil); err != nil {
+			panic(err)
+		}
+	}
+	return e
+}
+
+// AddRoute adds a route to the table used to find the prefix and origin AS of addresses, replacing the origin AS of an
+// identical prefix already present. The ASN may be zero if it is not known.
+func (e *Enricher) AddRoute(pfx *net.IPNet, asn uint32) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.routes.Insert(pfx, route{asn: asn})
+}
+
+// AddBogon adds a prefix to those considered to be bogons, such as space that is unallocated or reserved locally.
+func (e *Enricher) AddBogon(pfx *net.IPNet) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.bogons.Insert(pfx, nil)
+}
+
+// AddGeofeed adds the entries of a geofeed, as parsed by geofeed.Parse, used to find the country of addresses. Entries
+// without a country are ignored.
+func (e *Enricher) AddGeofeed(entries []geofeed.Entry) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, entry := range entries {
+		if entry.Country == "" {
+			continue
+		}
+		if err := e.geo.Insert(entry.Prefix, entry.Country); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSource adds a database consulted for the prefix, origin AS and country of addresses, where neither the tables nor
+// the sources added before it know them.
+func (e *Enricher) AddSource(src Source) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.srcs = append(e.srcs, src)
+}
+
+// AddMMDB adds a MaxMind DB as a source, such as a GeoLite2 Country or ASN database. The network of an address is used
+// as its prefix only where the database also knows its AS.
+func (e *Enricher) AddMMDB(db *mmdb.Reader) {
+	e.AddSource(mmdbSource{db})
+}
+
+// mmdbSource is a Source backed by a MaxMind DB.
+type mmdbSource struct {
+	db *mmdb.Reader
+}
+
+func (s mmdbSource) Annotate(ip net.IP) (Annotation, error) {
+	var a Annotation
+	res, err := s.db.Lookup(ip)
+	if err != nil {
+		return a, err
+	}
+	a.ASN, a.Country = res.ASN(), res.Country()
+	if a.ASN != 0 {
+		a.Prefix = res.Network
+	}
+	return a, nil
+}
+
+// Enrich annotates a flow record. If no route matches an address, the prefix length reported by the exporter is used
+// instead, and likewise its AS if the route has none, where the record has them.
+func (e *Enricher) Enrich(r Record) EnrichedRecord {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return EnrichedRecord{
+		Record: r,
+		Src:    e.annotate(r.SrcAddr, r.SrcMask, r.SrcAS),
+		Dst:    e.annotate(r.DstAddr, r.DstMask, r.DstAS),
+	}
+}
+
+// Annotate looks up what is known about an address.
+func (e *Enricher) Annotate(ip net.IP) Annotation {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.annotate(ip, 0, 0)
+}
+
+// annotate looks an address up in each of the tables, which must be locked by the caller.
+func (e *Enricher) annotate(ip net.IP, mask uint8, asn uint32) Annotation {
+	var a Annotation
+	if ip == nil {
+		return a
+	}
+
+	if entry, err := e.routes.Lookup(ip); err == nil && entry != nil {
+		a.Prefix, a.ASN = entry.Prefix, entry.Value.(route).asn
+	} else if mask > 0 {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		if int(mask) <= bits {
+			m := net.CIDRMask(int(mask), bits)
+			a.Prefix, a.ASN = &net.IPNet{IP: ip.Mask(m), Mask: m}, asn
+		}
+	}
+	if a.ASN == 0 {
+		a.ASN = asn
+	}
+
+	if entry, err := e.bogons.Lookup(ip); err == nil && entry != nil {
+		a.Bogon = true
+	}
+	if entry, err := e.geo.Lookup(ip); err == nil && entry != nil {
+		a.Country = entry.Value.(string)
+	}
+
+	for _, src := range e.srcs {
+		if a.Prefix != nil && a.ASN != 0 && a.Country != "" {
+			break
+		}
+		sa, err := src.Annotate(ip)
+		if err != nil {
+			continue
+		}
+		if a.Prefix == nil && a.ASN == 0 {
+			a.Prefix, a.ASN = sa.Prefix, sa.ASN
+		} else if a.ASN == 0 {
+			a.ASN = sa.ASN
+		}
+		if a.Country == "" {
+			a.Country = sa.Country
+		}
+	}
+
+	return a
+}
+
+// Pipe starts a pipeline stage that enriches every record received from in, delivering the results on the returned
+// channel, which has room for buffer records and is closed once in is closed. It is typically fed from the Records
+// channel of a Collector.
+func (e *Enricher) Pipe(in <-chan Record, buffer int) <-chan EnrichedRecord {
+	out := make(chan EnrichedRecord, buffer)
+	go func() {
+		defer close(out)
+		for r := range in {
+			out <- e.Enrich(r)
+		}
+	}()
+	return out
+}
@@ -0,0 +1,132 @@
+package flow
+
+import (
+	"errors"
+	"github.com/dotwaffle/inettools/geofeed"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestEnrich(t *testing.T) {
+	e := NewEnricher()
+	for pfx, asn := range map[string]uint32{
+		"1.0.0.0/8":           64496,
+		"1.1.1.0/24":          13335,
+		"2606:4700::/32":      13335,
+		"2606:4700:4700::/48": 0,
+	} {
+		if err := e.AddRoute(mustCIDR(pfx), asn); err != nil {
+			t.Fatalf("add route err: %v", err)
+		}
+	}
+	feed, err := geofeed.Parse(strings.NewReader("1.1.1.0/24,AU,,,\n1.1.1.1,US,,,\n"))
+	if err != nil {
+		t.Fatalf("geofeed err: %v", err)
+	}
+	if err := e.AddGeofeed(feed); err != nil {
+		t.Fatalf("add geofeed err: %v", err)
+	}
+
+	tests := map[string]struct {
+		record  Record
+		wantSrc Annotation
+		wantDst Annotation
+	}{
+		"LongestMatch": {
+			record:  Record{SrcAddr: net.ParseIP("1.1.1.1"), DstAddr: net.ParseIP("1.2.3.4")},
+			wantSrc: Annotation{Prefix: mustCIDR("1.1.1.0/24"), ASN: 13335, Country: "US"},
+			wantDst: Annotation{Prefix: mustCIDR("1.0.0.0/8"), ASN: 64496},
+		},
+		"BogonFallback": {
+			record: Record{SrcAddr: net.ParseIP("10.1.2.3"), SrcMask: 16, SrcAS: 64512,
+				DstAddr: net.ParseIP("1.1.1.2")},
+			wantSrc: Annotation{Prefix: mustCIDR("10.1.0.0/16"), ASN: 64512, Bogon: true},
+			wantDst: Annotation{Prefix: mustCIDR("1.1.1.0/24"), ASN: 13335, Country: "AU"},
+		},
+		"RouteWithoutASN": {
+			record:  Record{SrcAddr: net.ParseIP("2606:4700:4700::1111"), SrcAS: 13335},
+			wantSrc: Annotation{Prefix: mustCIDR("2606:4700:4700::/48"), ASN: 13335},
+		},
+		"NoMatch": {
+			record:  Record{SrcAddr: net.ParseIP("2001:db8::1"), DstAddr: net.ParseIP("9.9.9.9")},
+			wantSrc: Annotation{Bogon: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := e.Enrich(tc.record)
+			if diff := cmp.Diff(tc.wantSrc, got.Src); diff != "" {
+				t.Fatalf("src: %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantDst, got.Dst); diff != "" {
+				t.Fatalf("dst: %v", diff)
+			}
+		})
+	}
+}
+
+func TestPipe(t *testing.T) {
+	in := make(chan Record, 2)
+	in <- Record{SrcAddr: net.ParseIP("192.168.1.1")}
+	in <- Record{SrcAddr: net.ParseIP("8.8.8.8")}
+	close(in)
+
+	var bogons []bool
+	for r := range NewEnricher().Pipe(in, 0) {
+		bogons = append(bogons, r.Src.Bogon)
+	}
+	if diff := cmp.Diff([]bool{true, false}, bogons); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+// staticSource knows the annotation of the addresses in a single prefix.
+type staticSource struct {
+	pfx *net.IPNet
+	a   Annotation
+}
+
+func (s staticSource) Annotate(ip net.IP) (Annotation, error) {
+	if !s.pfx.Contains(ip) {
+		return Annotation{}, errors.New("not found")
+	}
+	return s.a, nil
+}
+
+func TestSources(t *testing.T) {
+	e := NewEnricher()
+	if err := e.AddRoute(mustCIDR("1.1.1.0/24"), 13335); err != nil {
+		t.Fatalf("add route err: %v", err)
+	}
+	e.AddSource(staticSource{mustCIDR("1.0.0.0/8"), Annotation{Country: "AU"}})
+	e.AddSource(staticSource{mustCIDR("1.0.0.0/8"), Annotation{Prefix: mustCIDR("1.0.0.0/16"), ASN: 64496,
+		Country: "US"}})
+
+	tests := map[string]struct {
+		ip   string
+		want Annotation
+	}{
+		// The route is kept, and the country taken from the first source knowing it.
+		"Route":   {"1.1.1.1", Annotation{Prefix: mustCIDR("1.1.1.0/24"), ASN: 13335, Country: "AU"}},
+		"NoRoute": {"1.0.0.1", Annotation{Prefix: mustCIDR("1.0.0.0/16"), ASN: 64496, Country: "AU"}},
+		"Unknown": {"8.8.8.8", Annotation{}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, e.Annotate(net.ParseIP(tc.ip))); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
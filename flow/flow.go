@@ -0,0 +1,254 @@
+package flow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Export protocol versions, as found in the first two octets of every export packet.
+const (
+	VersionNetFlow5 = 5
+	VersionNetFlow9 = 9
+	VersionIPFIX    = 10
+)
+
+// Information element identifiers understood by Record. NetFlow v9 field types share these numbers, as IPFIX was
+// derived from it.
+const (
+	FieldOctetDeltaCount             = 1
+	FieldPacketDeltaCount            = 2
+	FieldProtocolIdentifier          = 4
+	FieldIPClassOfService            = 5
+	FieldTCPControlBits              = 6
+	FieldSourceTransportPort         = 7
+	FieldSourceIPv4Address           = 8
+	FieldSourceIPv4PrefixLength      = 9
+	FieldIngressInterface            = 10
+	FieldDestinationTransportPort    = 11
+	FieldDestinationIPv4Address      = 12
+	FieldDestinationIPv4PrefixLength = 13
+	FieldEgressInterface             = 14
+	FieldIPNextHopIPv4Address        = 15
+	FieldBGPSourceASNumber           = 16
+	FieldBGPDestinationASNumber      = 17
+	FieldFlowEndSysUpTime            = 21
+	FieldFlowStartSysUpTime          = 22
+	FieldSourceIPv6Address           = 27
+	FieldDestinationIPv6Address      = 28
+	FieldSourceIPv6PrefixLength      = 29
+	FieldDestinationIPv6PrefixLength = 30
+	FieldSamplingInterval            = 34
+	FieldSamplerRandomInterval       = 50
+	FieldIPNextHopIPv6Address        = 62
+	FieldOctetTotalCount             = 85
+	FieldPacketTotalCount            = 86
+	FieldFlowStartSeconds            = 150
+	FieldFlowEndSeconds              = 151
+	FieldFlowStartMilliseconds       = 152
+	FieldFlowEndMilliseconds         = 153
+	FieldSamplingPacketInterval      = 305
+)
+
+// ErrUnknownVersion is returned when decoding a packet that is not NetFlow v5, v9, IPFIX or sFlow v5.
+var ErrUnknownVersion = errors.New("unknown flow export version")
+
+// Field is a single value from a NetFlow v9 or IPFIX data record, as described by its template.
+type Field struct {
+	Type       uint16
+	Enterprise uint32 // Non-zero for enterprise-specific IPFIX information elements.
+	Value      []byte
+}
+
+// Record is a single flow, normalised from any of the supported export formats. Fields not present in the export are
+// left at their zero values.
+type Record struct {
+	Exporter          net.IP // The address the export packet was received from.
+	Version           uint16
+	ObservationDomain uint32    // The IPFIX observation domain, NetFlow v9 source ID, v5 engine, or sFlow sub-agent.
+	Exported          time.Time // When the export packet was sent; sFlow does not say, so it is left unset.
+
+	SrcAddr  net.IP
+	DstAddr  net.IP
+	NextHop  net.IP
+	SrcMask  uint8
+	DstMask  uint8
+	SrcPort  uint16
+	DstPort  uint16
+	Protocol uint8
+	TOS      uint8
+	TCPFlags uint8
+	SrcAS    uint32
+	DstAS    uint32
+	InputIf  uint32
+	OutputIf uint32
+
+	Packets uint64
+	Bytes   uint64
+	Start   time.Time
+	End     time.Time
+
+	// SamplingInterval is the packet sampling rate in effect, such that Packets and Bytes should be multiplied by it
+	// to estimate the true traffic volume. Zero or one means the flow was not sampled, or the rate is unknown.
+	SamplingInterval uint32
+
+	// Fields holds every value of a NetFlow v9 or IPFIX record, including those not otherwise understood.
+	Fields []Field
+}
+
+// Stats counts the work done by a Decoder.
+type Stats struct {
+	Packets         uint64 // Export packets decoded, whether or not they contained records.
+	Records         uint64 // Flow records returned.
+	MissingTemplate uint64 // Data sets skipped because their template had not yet been received.
+	Malformed       uint64 // Export packets that could not be decoded.
+}
+
+// Decoder decodes NetFlow v5, NetFlow v9 and IPFIX export packets, and sFlow v5 datagrams. The v9 and IPFIX formats are
+// described by templates sent periodically by each exporter, so a Decoder remembers the templates it has seen; data
+// arriving before its template is skipped. A Decoder is safe for concurrent use.
+type Decoder struct {
+	mu        sync.Mutex
+	templates map[templateKey]*template
+	sampling  map[domainKey]uint32
+	stats     Stats
+}
+
+// NewDecoder returns a Decoder with no templates.
+func NewDecoder() *Decoder {
+	return &Decoder{
+		templates: make(map[templateKey]*template),
+		sampling:  make(map[domainKey]uint32),
+	}
+}
+
+// Stats returns the counters of the decoder so far.
+func (d *Decoder) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// Decode decodes an export packet received from exporter, learning any templates it contains, and returns the flow
+// records in it. Records refer to copies of the data, so the buffer may be reused once Decode returns.
+func (d *Decoder) Decode(exporter net.IP, b []byte) ([]Record, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records, err := d.decode(exporter, b)
+	if err != nil {
+		d.stats.Malformed++
+		return nil, err
+	}
+	d.stats.Packets++
+	d.stats.Records += uint64(len(records))
+	return records, nil
+}
+
+// decode dispatches on the version of the export packet.
+func (d *Decoder) decode(exporter net.IP, b []byte) ([]Record, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("export packet too short: %d bytes", len(b))
+	}
+	// sFlow has a 32-bit version number, so its first two octets are always zero.
+	if len(b) >= 4 && binary.BigEndian.Uint32(b) == 5 {
+		return decodeSFlow(exporter, b)
+	}
+	switch version := binary.BigEndian.Uint16(b); version {
+	case VersionNetFlow5:
+		return decodeNetFlow5(exporter, b)
+	case VersionNetFlow9:
+		return d.decodeNetFlow9(exporter, b)
+	case VersionIPFIX:
+		return d.decodeIPFIX(exporter, b)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+}
+
+// exporterKey returns a comparable representation of the exporter address.
+func exporterKey(ip net.IP) string {
+	return string(ip.To16())
+}
+
+// uintValue returns an unsigned integer of up to 8 octets, allowing for the reduced-size encoding of RFC 7011.
+func uintValue(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// setField stores a value in the matching field of the record, if it is one that Record understands. Times relative
+// to the uptime of the exporter are converted using boot, the time at which it started, if known.
+func (r *Record) setField(typ uint16, v []byte, boot time.Time) {
+	switch typ {
+	case FieldOctetDeltaCount, FieldOctetTotalCount:
+		r.Bytes = uintValue(v)
+	case FieldPacketDeltaCount, FieldPacketTotalCount:
+		r.Packets = uintValue(v)
+	case FieldProtocolIdentifier:
+		r.Protocol = uint8(uintValue(v))
+	case FieldIPClassOfService:
+		r.TOS = uint8(uintValue(v))
+	case FieldTCPControlBits:
+		r.TCPFlags = uint8(uintValue(v))
+	case FieldSourceTransportPort:
+		r.SrcPort = uint16(uintValue(v))
+	case FieldDestinationTransportPort:
+		r.DstPort = uint16(uintValue(v))
+	case FieldSourceIPv4Address, FieldSourceIPv6Address:
+		r.SrcAddr = ipValue(v)
+	case FieldDestinationIPv4Address, FieldDestinationIPv6Address:
+		r.DstAddr = ipValue(v)
+	case FieldIPNextHopIPv4Address, FieldIPNextHopIPv6Address:
+		r.NextHop = ipValue(v)
+	case FieldSourceIPv4PrefixLength, FieldSourceIPv6PrefixLength:
+		r.SrcMask = uint8(uintValue(v))
+	case FieldDestinationIPv4PrefixLength, FieldDestinationIPv6PrefixLength:
+		r.DstMask = uint8(uintValue(v))
+	case FieldIngressInterface:
+		r.InputIf = uint32(uintValue(v))
+	case FieldEgressInterface:
+		r.OutputIf = uint32(uintValue(v))
+	case FieldBGPSourceASNumber:
+		r.SrcAS = uint32(uintValue(v))
+	case FieldBGPDestinationASNumber:
+		r.DstAS = uint32(uintValue(v))
+	case FieldSamplingInterval, FieldSamplerRandomInterval, FieldSamplingPacketInterval:
+		r.SamplingInterval = uint32(uintValue(v))
+	case FieldFlowStartSeconds:
+		r.Start = time.Unix(int64(uintValue(v)), 0).UTC()
+	case FieldFlowEndSeconds:
+		r.End = time.Unix(int64(uintValue(v)), 0).UTC()
+	case FieldFlowStartMilliseconds:
+		r.Start = msTime(uintValue(v))
+	case FieldFlowEndMilliseconds:
+		r.End = msTime(uintValue(v))
+	case FieldFlowStartSysUpTime:
+		if !boot.IsZero() {
+			r.Start = boot.Add(time.Duration(uintValue(v)) * time.Millisecond)
+		}
+	case FieldFlowEndSysUpTime:
+		if !boot.IsZero() {
+			r.End = boot.Add(time.Duration(uintValue(v)) * time.Millisecond)
+		}
+	}
+}
+
+// ipValue copies an IPv4 or IPv6 address, returning nil for any other length.
+func ipValue(v []byte) net.IP {
+	if len(v) != net.IPv4len && len(v) != net.IPv6len {
+		return nil
+	}
+	return append(net.IP(nil), v...)
+}
+
+// msTime converts milliseconds since the Unix epoch to a time.
+func msTime(ms uint64) time.Time {
+	return time.Unix(int64(ms/1000), int64(ms%1000)*int64(time.Millisecond)).UTC()
+}
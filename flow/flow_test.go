@@ -0,0 +1,341 @@
+package flow
+
+import (
+	"encoding/binary"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// exportTime is the time all of the test export packets claim to have been sent.
+var exportTime = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// set wraps a body in a set header with the given ID, as used by both NetFlow v9 and IPFIX.
+func set(id uint16, body ...byte) []byte {
+	b := make([]byte, 4, 4+len(body))
+	binary.BigEndian.PutUint16(b, id)
+	binary.BigEndian.PutUint16(b[2:], uint16(4+len(body)))
+	return append(b, body...)
+}
+
+// u16 and u32 return big-endian encodings, for building packets.
+func u16(v uint16) []byte { return []byte{byte(v >> 8), byte(v)} }
+func u32(v uint32) []byte { return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)} }
+
+// cat concatenates byte slices.
+func cat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// netflow9 builds a NetFlow v9 packet with an uptime of one hour.
+func netflow9(sourceID uint32, sets ...[]byte) []byte {
+	return cat(u16(VersionNetFlow9), u16(uint16(len(sets))), u32(3600000), u32(uint32(exportTime.Unix())), u32(1),
+		u32(sourceID), cat(sets...))
+}
+
+// ipfix builds an IPFIX message.
+func ipfix(domain uint32, sets ...[]byte) []byte {
+	body := cat(sets...)
+	return cat(u16(VersionIPFIX), u16(uint16(ipfixHeaderLen+len(body))), u32(uint32(exportTime.Unix())), u32(1),
+		u32(domain), body)
+}
+
+// withoutFields returns the records with their raw fields removed, as those are checked separately.
+func withoutFields(records []Record) []Record {
+	out := make([]Record, len(records))
+	for i, r := range records {
+		r.Fields = nil
+		out[i] = r
+	}
+	return out
+}
+
+func TestNetFlow5(t *testing.T) {
+	record := cat(
+		[]byte{192, 0, 2, 1}, []byte{198, 51, 100, 2}, []byte{203, 0, 113, 1},
+		u16(3), u16(4), u32(10), u32(1500),
+		u32(3599000), u32(3600000),
+		u16(443), u16(51515), []byte{0, 0x12, 6, 0xb8},
+		u16(64496), u16(64511), []byte{24, 16, 0, 0},
+	)
+	b := cat(u16(VersionNetFlow5), u16(1), u32(3600000), u32(uint32(exportTime.Unix())), u32(0), u32(1),
+		[]byte{1, 2}, u16(0x4000|100), record)
+
+	got, err := NewDecoder().Decode(net.ParseIP("192.0.2.254"), b)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := []Record{{
+		Exporter:          net.ParseIP("192.0.2.254"),
+		Version:           VersionNetFlow5,
+		ObservationDomain: 0x0102,
+		Exported:          exportTime,
+		SrcAddr:           net.IP{192, 0, 2, 1},
+		DstAddr:           net.IP{198, 51, 100, 2},
+		NextHop:           net.IP{203, 0, 113, 1},
+		SrcMask:           24,
+		DstMask:           16,
+		SrcPort:           443,
+		DstPort:           51515,
+		Protocol:          6,
+		TOS:               0xb8,
+		TCPFlags:          0x12,
+		SrcAS:             64496,
+		DstAS:             64511,
+		InputIf:           3,
+		OutputIf:          4,
+		Packets:           10,
+		Bytes:             1500,
+		Start:             exportTime.Add(-time.Second),
+		End:               exportTime,
+		SamplingInterval:  100,
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestNetFlow9(t *testing.T) {
+	d := NewDecoder()
+	exporter := net.ParseIP("2001:db8::1")
+
+	template := set(netflow9TemplateSet, cat(
+		u16(256), u16(5),
+		u16(FieldSourceIPv6Address), u16(16),
+		u16(FieldDestinationIPv6Address), u16(16),
+		u16(FieldOctetDeltaCount), u16(4),
+		u16(FieldFlowStartSysUpTime), u16(4),
+		u16(FieldProtocolIdentifier), u16(1),
+	)...)
+	options := set(netflow9OptionsTemplateSet, cat(
+		u16(257), u16(4), u16(4),
+		u16(1), u16(4), // The system scope.
+		u16(FieldSamplingInterval), u16(4),
+		[]byte{0, 0}, // Padding.
+	)...)
+	data := set(256, cat(
+		net.ParseIP("2001:db8:1::1"), net.ParseIP("2001:db8:2::1"), u32(9000), u32(3000000), []byte{17},
+		[]byte{0, 0, 0}, // Padding.
+	)...)
+	sampling := set(257, cat(u32(0), u32(1000))...)
+
+	// Data arriving before its template can't be decoded.
+	got, err := d.Decode(exporter, netflow9(7, data))
+	if err != nil || len(got) != 0 || d.Stats().MissingTemplate != 1 {
+		t.Fatalf("got %d records, err %v, stats %+v", len(got), err, d.Stats())
+	}
+
+	// Once the templates and sampling interval are known, it can.
+	if _, err := d.Decode(exporter, netflow9(7, template, options, sampling)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	got, err = d.Decode(exporter, netflow9(7, data))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := []Record{{
+		Exporter:          exporter,
+		Version:           VersionNetFlow9,
+		ObservationDomain: 7,
+		Exported:          exportTime,
+		SrcAddr:           net.ParseIP("2001:db8:1::1"),
+		DstAddr:           net.ParseIP("2001:db8:2::1"),
+		Protocol:          17,
+		Bytes:             9000,
+		Start:             exportTime.Add(-10 * time.Minute),
+		SamplingInterval:  1000,
+	}}
+	if diff := cmp.Diff(want, withoutFields(got)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if len(got[0].Fields) != 5 {
+		t.Fatalf("got %d fields, want 5", len(got[0].Fields))
+	}
+
+	// Templates are specific to the exporter and source ID.
+	if got, _ := d.Decode(exporter, netflow9(8, data)); len(got) != 0 {
+		t.Fatalf("decoded %d records with another source id's template", len(got))
+	}
+	if got, _ := d.Decode(net.ParseIP("2001:db8::2"), netflow9(7, data)); len(got) != 0 {
+		t.Fatalf("decoded %d records with another exporter's template", len(got))
+	}
+}
+
+func TestIPFIX(t *testing.T) {
+	d := NewDecoder()
+	exporter := net.ParseIP("192.0.2.254")
+
+	// A template with an enterprise-specific, variable length element.
+	template := set(ipfixTemplateSet, cat(
+		u16(300), u16(4),
+		u16(FieldSourceIPv4Address), u16(4),
+		u16(FieldPacketDeltaCount), u16(varLength),
+		u16(0x8000|1), u16(varLength), u32(32473),
+		u16(FieldFlowEndMilliseconds), u16(8),
+	)...)
+	end := uint64(exportTime.UnixNano() / int64(time.Millisecond))
+	data := set(300, cat(
+		[]byte{192, 0, 2, 1}, []byte{2}, u16(1234), []byte{3}, []byte("abc"), u32(uint32(end>>32)), u32(uint32(end)),
+		// The same again, but using the three octet variable length encoding.
+		[]byte{192, 0, 2, 2}, []byte{1, 7}, []byte{255}, u16(1), []byte("d"), u32(uint32(end>>32)), u32(uint32(end)),
+	)...)
+
+	got, err := d.Decode(exporter, ipfix(1, template, data))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	proto := Record{Exporter: exporter, Version: VersionIPFIX, ObservationDomain: 1, Exported: exportTime,
+		End: exportTime}
+	want := []Record{proto, proto}
+	want[0].SrcAddr, want[0].Packets = net.IP{192, 0, 2, 1}, 1234
+	want[1].SrcAddr, want[1].Packets = net.IP{192, 0, 2, 2}, 7
+	if diff := cmp.Diff(want, withoutFields(got)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if f := got[1].Fields[2]; f.Enterprise != 32473 || f.Type != 1 || string(f.Value) != "d" {
+		t.Fatalf("unexpected enterprise field: %+v", f)
+	}
+
+	// Withdrawing the template stops the data being decoded.
+	withdraw := set(ipfixTemplateSet, cat(u16(300), u16(0))...)
+	if got, err := d.Decode(exporter, ipfix(1, withdraw, data)); err != nil || len(got) != 0 {
+		t.Fatalf("got %d records, err %v after withdrawal", len(got), err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"Empty":          {},
+		"UnknownVersion": u16(7),
+		"ShortNetFlow5":  cat(u16(VersionNetFlow5), u16(1), make([]byte, 20)),
+		"SetLength":      netflow9(1, []byte{1, 0, 0, 200}),
+		"IPFIXLength":    cat(u16(VersionIPFIX), u16(100), make([]byte, 12)),
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := NewDecoder()
+			if _, err := d.Decode(nil, b); err == nil {
+				t.Fatalf("expected error")
+			}
+			if d.Stats().Malformed != 1 {
+				t.Fatalf("malformed packet not counted")
+			}
+		})
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	conn, err := net.Dial("udp", c.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer conn.Close()
+
+	b := cat(u16(VersionNetFlow5), u16(1), make([]byte, 20), make([]byte, netflow5RecordLen))
+	if _, err := conn.Write(b); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	select {
+	case r := <-c.Records():
+		if !r.Exporter.Equal(net.IPv4(127, 0, 0, 1)) || r.Version != VersionNetFlow5 {
+			t.Fatalf("unexpected record: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for record")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("close err: %v", err)
+	}
+	for range c.Records() {
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("err after close: %v", err)
+	}
+}
+
+// sflowRecord wraps data in the format and length header used by sFlow samples and records.
+func sflowRecord(format uint32, data ...byte) []byte {
+	return cat(u32(format), u32(uint32(len(data))), data)
+}
+
+func TestSFlow(t *testing.T) {
+	// An Ethernet frame with a VLAN tag, carrying a TCP SYN over IPv4.
+	frame := cat(
+		make([]byte, 12), u16(0x8100), u16(100), u16(0x0800),
+		[]byte{0x45, 0x10, 0x05, 0xdc, 0, 0, 0x40, 0, 64, 6, 0, 0, 192, 0, 2, 1, 198, 51, 100, 2},
+		u16(40000), u16(22), u32(1), u32(0), []byte{0x50, 0x02}, u16(0xffff), u32(0),
+		[]byte{0, 0}, // Padding to a multiple of four.
+	)
+	header := sflowRecord(sflowRawPacketHeader, cat(u32(HeaderProtocolEthernet), u32(1518), u32(4),
+		u32(uint32(len(frame)-2)), frame)...)
+	router := sflowRecord(sflowExtendedRouter, cat(u32(1), []byte{203, 0, 113, 1}, u32(24), u32(22))...)
+	gateway := sflowRecord(sflowExtendedGateway, cat(u32(1), []byte{203, 0, 113, 1}, u32(64500), u32(64496),
+		u32(64497), u32(1), u32(2), u32(2), u32(64510), u32(64511), u32(0), u32(0))...)
+	flowSample := sflowRecord(sflowFlowSample, cat(u32(1), u32(7), u32(2048), u32(4096), u32(0), u32(7), u32(9),
+		u32(3), header, router, gateway)...)
+
+	counters := sflowRecord(sflowGenericInterface, cat(u32(7), u32(6), u32(0), u32(1000000000), u32(1), u32(3),
+		u32(0), u32(123456), make([]byte, 6*4), u32(0), u32(654321), make([]byte, 6*4))...)
+	counterSample := sflowRecord(sflowCounterSample, cat(u32(2), u32(7), u32(1), counters)...)
+
+	b := cat(u32(5), u32(1), []byte{192, 0, 2, 254}, u32(3), u32(10), u32(60000), u32(2), flowSample, counterSample)
+
+	dg, err := DecodeSFlow(b)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !dg.Agent.Equal(net.ParseIP("192.0.2.254")) || dg.SubAgentID != 3 || dg.Uptime != time.Minute ||
+		len(dg.FlowSamples) != 1 || len(dg.CounterSamples) != 1 {
+		t.Fatalf("unexpected datagram: %+v", dg)
+	}
+	if ifc := dg.CounterSamples[0].Interface; ifc == nil || ifc.Index != 7 || ifc.Speed != 1000000000 ||
+		ifc.InOctets != 123456 || ifc.OutOctets != 654321 {
+		t.Fatalf("unexpected interface counters: %+v", ifc)
+	}
+
+	got, err := NewDecoder().Decode(net.ParseIP("192.0.2.254"), b)
+	if err != nil {
+		t.Fatalf("decode err: %v", err)
+	}
+	want := []Record{{
+		Exporter:          net.ParseIP("192.0.2.254"),
+		Version:           VersionSFlow5,
+		ObservationDomain: 3,
+		SrcAddr:           net.IP{192, 0, 2, 1},
+		DstAddr:           net.IP{198, 51, 100, 2},
+		NextHop:           net.IP{203, 0, 113, 1},
+		SrcMask:           24,
+		DstMask:           22,
+		SrcPort:           40000,
+		DstPort:           22,
+		Protocol:          6,
+		TOS:               0x10,
+		TCPFlags:          0x02,
+		SrcAS:             64496,
+		DstAS:             64511,
+		InputIf:           7,
+		OutputIf:          9,
+		Packets:           1,
+		Bytes:             1518,
+		SamplingInterval:  2048,
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// A truncated datagram is an error rather than a partial result.
+	if _, err := DecodeSFlow(b[:len(b)-8]); err == nil {
+		t.Fatalf("expected error for truncated datagram")
+	}
+}
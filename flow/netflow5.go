@@ -0,0 +1,65 @@
+package flow
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Sizes of the fixed-format NetFlow v5 header and records.
+const (
+	netflow5HeaderLen = 24
+	netflow5RecordLen = 48
+)
+
+// decodeNetFlow5 decodes a NetFlow v5 export packet, which has a fixed record format and needs no templates.
+func decodeNetFlow5(exporter net.IP, b []byte) ([]Record, error) {
+	if len(b) < netflow5HeaderLen {
+		return nil, fmt.Errorf("netflow v5 header too short: %d bytes", len(b))
+	}
+	count := int(binary.BigEndian.Uint16(b[2:]))
+	if len(b) < netflow5HeaderLen+count*netflow5RecordLen {
+		return nil, fmt.Errorf("netflow v5 packet too short for %d records: %d bytes", count, len(b))
+	}
+
+	// Times in the records are relative to the uptime of the exporter, which the header relates to wall-clock time.
+	uptime := binary.BigEndian.Uint32(b[4:])
+	exported := time.Unix(int64(binary.BigEndian.Uint32(b[8:])), int64(binary.BigEndian.Uint32(b[12:]))).UTC()
+	boot := exported.Add(-time.Duration(uptime) * time.Millisecond)
+	domain := uint32(b[20])<<8 | uint32(b[21])
+	// The top two bits of the sampling field are the sampling mode, and the rest is the interval.
+	sampling := uint32(binary.BigEndian.Uint16(b[22:]) & 0x3fff)
+
+	records := make([]Record, 0, count)
+	for i := 0; i < count; i++ {
+		rec := b[netflow5HeaderLen+i*netflow5RecordLen:]
+		records = append(records, Record{
+			Exporter:          exporter,
+			Version:           VersionNetFlow5,
+			ObservationDomain: domain,
+			Exported:          exported,
+			SrcAddr:           ipValue(rec[0:4]),
+			DstAddr:           ipValue(rec[4:8]),
+			NextHop:           ipValue(rec[8:12]),
+			InputIf:           uint32(binary.BigEndian.Uint16(rec[12:])),
+			OutputIf:          uint32(binary.BigEndian.Uint16(rec[14:])),
+			Packets:           uint64(binary.BigEndian.Uint32(rec[16:])),
+			Bytes:             uint64(binary.BigEndian.Uint32(rec[20:])),
+			Start:             boot.Add(time.Duration(binary.BigEndian.Uint32(rec[24:])) * time.Millisecond),
+			End:               boot.Add(time.Duration(binary.BigEndian.Uint32(rec[28:])) * time.Millisecond),
+			SrcPort:           binary.BigEndian.Uint16(rec[32:]),
+			DstPort:           binary.BigEndian.Uint16(rec[34:]),
+			TCPFlags:          rec[37],
+			Protocol:          rec[38],
+			TOS:               rec[39],
+			SrcAS:             uint32(binary.BigEndian.Uint16(rec[40:])),
+			DstAS:             uint32(binary.BigEndian.Uint16(rec[42:])),
+			SrcMask:           rec[44],
+			DstMask:           rec[45],
+			SamplingInterval:  sampling,
+		})
+	}
+
+	return records, nil
+}
@@ -0,0 +1,488 @@
+package flow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/packet"
+	"net"
+	"time"
+)
+
+// VersionSFlow5 marks records decoded from sFlow v5 datagrams. sFlow numbers its versions independently of NetFlow,
+// so this is not the value found on the wire, where it would clash with NetFlow v5.
+const VersionSFlow5 = 0x5f05
+
+// sFlow sample formats, in the standard enterprise.
+const (
+	sflowFlowSample            = 1
+	sflowCounterSample         = 2
+	sflowExpandedFlowSample    = 3
+	sflowExpandedCounterSample = 4
+)
+
+// sFlow flow and counter record formats, in the standard enterprise.
+const (
+	sflowRawPacketHeader    = 1
+	sflowExtendedSwitch     = 1001
+	sflowExtendedRouter     = 1002
+	sflowExtendedGateway    = 1003
+	sflowGenericInterface   = 1
+	sflowGenericCountersLen = 88
+)
+
+// Header protocols of a sampled packet header.
+const (
+	HeaderProtocolEthernet = 1
+	HeaderProtocolIPv4     = 11
+	HeaderProtocolIPv6     = 12
+)
+
+// Datagram is a decoded sFlow v5 datagram, as sent by an agent.
+type Datagram struct {
+	Agent          net.IP
+	SubAgentID     uint32
+	Sequence       uint32
+	Uptime         time.Duration
+	FlowSamples    []FlowSample
+	CounterSamples []CounterSample
+}
+
+// RawRecord is a flow or counter record in a format not otherwise understood.
+type RawRecord struct {
+	Format uint32 // The enterprise number in the top 20 bits, and the format within it in the bottom 12.
+	Data   []byte
+}
+
+// FlowSample is a sampled packet, along with what the agent knew about how it would be forwarded.
+type FlowSample struct {
+	Sequence      uint32
+	SourceIDType  uint32
+	SourceIDIndex uint32
+	SamplingRate  uint32
+	SamplePool    uint32
+	Drops         uint32
+	Input         uint32
+	Output        uint32
+
+	Header  *SampledHeader
+	Switch  *ExtendedSwitch
+	Router  *ExtendedRouter
+	Gateway *ExtendedGateway
+	Unknown []RawRecord
+}
+
+// SampledHeader is the start of a sampled packet.
+type SampledHeader struct {
+	Protocol    uint32 // One of the HeaderProtocol constants, or another value from the sFlow specification.
+	FrameLength uint32 // The length of the whole packet, before sampling truncated it.
+	Stripped    uint32 // The number of octets removed from the packet before the header was taken.
+	Header      []byte
+}
+
+// ExtendedSwitch holds the layer 2 forwarding information of a flow sample.
+type ExtendedSwitch struct {
+	SrcVLAN     uint32
+	SrcPriority uint32
+	DstVLAN     uint32
+	DstPriority uint32
+}
+
+// ExtendedRouter holds the layer 3 forwarding information of a flow sample.
+type ExtendedRouter struct {
+	NextHop net.IP
+	SrcMask uint32
+	DstMask uint32
+}
+
+// ExtendedGateway holds the BGP information of a flow sample.
+type ExtendedGateway struct {
+	NextHop   net.IP
+	AS        uint32 // The AS of the router.
+	SrcAS     uint32
+	SrcPeerAS uint32
+	DstASPath []uint32 // The AS path to the destination, flattened; the last entry is the origin AS.
+}
+
+// CounterSample holds the counters of a data source, such as an interface.
+type CounterSample struct {
+	Sequence      uint32
+	SourceIDType  uint32
+	SourceIDIndex uint32
+
+	Interface *InterfaceCounters
+	Unknown   []RawRecord
+}
+
+// InterfaceCounters are the generic interface counters of a counter sample.
+type InterfaceCounters struct {
+	Index            uint32
+	Type             uint32
+	Speed            uint64
+	Direction        uint32
+	Status           uint32
+	InOctets         uint64
+	InUcastPkts      uint32
+	InMulticastPkts  uint32
+	InBroadcastPkts  uint32
+	InDiscards       uint32
+	InErrors         uint32
+	InUnknownProtos  uint32
+	OutOctets        uint64
+	OutUcastPkts     uint32
+	OutMulticastPkts uint32
+	OutBroadcastPkts uint32
+	OutDiscards      uint32
+	OutErrors        uint32
+	Promiscuous      uint32
+}
+
+// errTruncated is returned by xdr once it runs out of data.
+var errTruncated = errors.New("sflow datagram truncated")
+
+// xdr reads the XDR encoding used by sFlow, remembering the first error so that it only needs checking at the end.
+type xdr struct {
+	b   []byte
+	err error
+}
+
+// uint32 reads a 32-bit unsigned integer.
+func (x *xdr) uint32() uint32 {
+	if x.err != nil || len(x.b) < 4 {
+		x.err = errTruncated
+		return 0
+	}
+	v := binary.BigEndian.Uint32(x.b)
+	x.b = x.b[4:]
+	return v
+}
+
+// uint64 reads a 64-bit unsigned integer.
+func (x *xdr) uint64() uint64 {
+	return uint64(x.uint32())<<32 | uint64(x.uint32())
+}
+
+// opaque reads n octets, skipping the padding that follows them up to a multiple of four.
+func (x *xdr) opaque(n uint32) []byte {
+	padded := (uint64(n) + 3) &^ 3
+	if x.err != nil || uint64(len(x.b)) < padded {
+		x.err = errTruncated
+		return nil
+	}
+	v := x.b[:n:n]
+	x.b = x.b[padded:]
+	return v
+}
+
+// address reads an address preceded by its type.
+func (x *xdr) address() net.IP {
+	switch typ := x.uint32(); typ {
+	case 1:
+		return ipValue(x.opaque(net.IPv4len))
+	case 2:
+		return ipValue(x.opaque(net.IPv6len))
+	case 0:
+		return nil
+	default:
+		if x.err == nil {
+			x.err = fmt.Errorf("unknown sflow address type %d", typ)
+		}
+		return nil
+	}
+}
+
+// DecodeSFlow decodes an sFlow v5 datagram. Slices in the result refer to the supplied buffer rather than copying it.
+func DecodeSFlow(b []byte) (*Datagram, error) {
+	x := &xdr{b: b}
+	if version := x.uint32(); x.err == nil && version != 5 {
+		return nil, fmt.Errorf("%w: sflow %d", ErrUnknownVersion, version)
+	}
+	d := &Datagram{
+		Agent:      x.address(),
+		SubAgentID: x.uint32(),
+		Sequence:   x.uint32(),
+		Uptime:     time.Duration(x.uint32()) * time.Millisecond,
+	}
+
+	for n := x.uint32(); n > 0 && x.err == nil; n-- {
+		format, data := x.uint32(), x.opaque(x.uint32())
+		if x.err != nil {
+			break
+		}
+		s := &xdr{b: data}
+		switch format {
+		case sflowFlowSample, sflowExpandedFlowSample:
+			d.FlowSamples = append(d.FlowSamples, decodeFlowSample(s, format == sflowExpandedFlowSample))
+		case sflowCounterSample, sflowExpandedCounterSample:
+			d.CounterSamples = append(d.CounterSamples, decodeCounterSample(s, format == sflowExpandedCounterSample))
+		}
+		if s.err != nil {
+			return nil, fmt.Errorf("sflow sample format %d: %w", format, s.err)
+		}
+	}
+	if x.err != nil {
+		return nil, x.err
+	}
+
+	return d, nil
+}
+
+// decodeSourceID reads a data source, which is packed into one word unless the sample is in the expanded format.
+func decodeSourceID(x *xdr, expanded bool) (typ, index uint32) {
+	if expanded {
+		return x.uint32(), x.uint32()
+	}
+	id := x.uint32()
+	return id >> 24, id & 0xffffff
+}
+
+// decodeFlowSample decodes a flow sample and its records.
+func decodeFlowSample(x *xdr, expanded bool) FlowSample {
+	var fs FlowSample
+	fs.Sequence = x.uint32()
+	fs.SourceIDType, fs.SourceIDIndex = decodeSourceID(x, expanded)
+	fs.SamplingRate = x.uint32()
+	fs.SamplePool = x.uint32()
+	fs.Drops = x.uint32()
+	if expanded {
+		// Interfaces are a format and a value; only the value is of interest here.
+		x.uint32()
+		fs.Input = x.uint32()
+		x.uint32()
+		fs.Output = x.uint32()
+	} else {
+		// The top two bits of the compact form are the format.
+		fs.Input = x.uint32() & 0x3fffffff
+		fs.Output = x.uint32() & 0x3fffffff
+	}
+
+	for n := x.uint32(); n > 0 && x.err == nil; n-- {
+		format, data := x.uint32(), x.opaque(x.uint32())
+		r := &xdr{b: data}
+		switch format {
+		case sflowRawPacketHeader:
+			fs.Header = &SampledHeader{
+				Protocol:    r.uint32(),
+				FrameLength: r.uint32(),
+				Stripped:    r.uint32(),
+			}
+			fs.Header.Header = r.opaque(r.uint32())
+		case sflowExtendedSwitch:
+			fs.Switch = &ExtendedSwitch{
+				SrcVLAN:     r.uint32(),
+				SrcPriority: r.uint32(),
+				DstVLAN:     r.uint32(),
+				DstPriority: r.uint32(),
+			}
+		case sflowExtendedRouter:
+			fs.Router = &ExtendedRouter{
+				NextHop: r.address(),
+				SrcMask: r.uint32(),
+				DstMask: r.uint32(),
+			}
+		case sflowExtendedGateway:
+			fs.Gateway = decodeExtendedGateway(r)
+		default:
+			fs.Unknown = append(fs.Unknown, RawRecord{Format: format, Data: data})
+		}
+		if r.err != nil && x.err == nil {
+			x.err = fmt.Errorf("flow record format %d: %w", format, r.err)
+		}
+	}
+
+	return fs
+}
+
+// decodeExtendedGateway decodes the BGP information of a flow sample, ignoring the communities and local preference.
+func decodeExtendedGateway(x *xdr) *ExtendedGateway {
+	g := &ExtendedGateway{
+		NextHop:   x.address(),
+		AS:        x.uint32(),
+		SrcAS:     x.uint32(),
+		SrcPeerAS: x.uint32(),
+	}
+	for segments := x.uint32(); segments > 0 && x.err == nil; segments-- {
+		// Each segment is a type, set or sequence, followed by a count of ASNs.
+		x.uint32()
+		for n := x.uint32(); n > 0 && x.err == nil; n-- {
+			g.DstASPath = append(g.DstASPath, x.uint32())
+		}
+	}
+	return g
+}
+
+// decodeCounterSample decodes a counter sample and its records.
+func decodeCounterSample(x *xdr, expanded bool) CounterSample {
+	var cs CounterSample
+	cs.Sequence = x.uint32()
+	cs.SourceIDType, cs.SourceIDIndex = decodeSourceID(x, expanded)
+
+	for n := x.uint32(); n > 0 && x.err == nil; n-- {
+		format, data := x.uint32(), x.opaque(x.uint32())
+		if format != sflowGenericInterface || len(data) < sflowGenericCountersLen {
+			cs.Unknown = append(cs.Unknown, RawRecord{Format: format, Data: data})
+			continue
+		}
+		r := &xdr{b: data}
+		cs.Interface = &InterfaceCounters{
+			Index:            r.uint32(),
+			Type:             r.uint32(),
+			Speed:            r.uint64(),
+			Direction:        r.uint32(),
+			Status:           r.uint32(),
+			InOctets:         r.uint64(),
+			InUcastPkts:      r.uint32(),
+			InMulticastPkts:  r.uint32(),
+			InBroadcastPkts:  r.uint32(),
+			InDiscards:       r.uint32(),
+			InErrors:         r.uint32(),
+			InUnknownProtos:  r.uint32(),
+			OutOctets:        r.uint64(),
+			OutUcastPkts:     r.uint32(),
+			OutMulticastPkts: r.uint32(),
+			OutBroadcastPkts: r.uint32(),
+			OutDiscards:      r.uint32(),
+			OutErrors:        r.uint32(),
+			Promiscuous:      r.uint32(),
+		}
+	}
+
+	return cs
+}
+
+// decodeSFlow decodes an sFlow datagram into a record for each flow sample, so that it can be handled in the same way
+// as NetFlow and IPFIX. Counter samples are not flows, and are only available through DecodeSFlow.
+func decodeSFlow(exporter net.IP, b []byte) ([]Record, error) {
+	d, err := DecodeSFlow(b)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(d.FlowSamples))
+	for i := range d.FlowSamples {
+		r := d.FlowSamples[i].Record()
+		r.Exporter = exporter
+		r.ObservationDomain = d.SubAgentID
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Record summarises the sample as a flow of one packet, taking the addresses, ports and protocol from the sampled
+// header. The Exporter, ObservationDomain and Exported fields are left for the caller to fill in, and the addresses are
+// copied so that the record does not refer to the datagram.
+func (fs *FlowSample) Record() Record {
+	r := Record{
+		Version:          VersionSFlow5,
+		InputIf:          fs.Input,
+		OutputIf:         fs.Output,
+		Packets:          1,
+		SamplingInterval: fs.SamplingRate,
+	}
+
+	if h := fs.Header; h != nil {
+		r.Bytes = uint64(h.FrameLength)
+		switch h.Protocol {
+		case HeaderProtocolEthernet:
+			r.setHeader(skipEthernet(h.Header))
+		case HeaderProtocolIPv4, HeaderProtocolIPv6:
+			r.setHeader(h.Header)
+		}
+	}
+	if rt := fs.Router; rt != nil {
+		r.NextHop = append(net.IP(nil), rt.NextHop...)
+		r.SrcMask, r.DstMask = uint8(rt.SrcMask), uint8(rt.DstMask)
+	}
+	if g := fs.Gateway; g != nil {
+		r.SrcAS = g.SrcAS
+		if len(g.DstASPath) > 0 {
+			r.DstAS = g.DstASPath[len(g.DstASPath)-1]
+		}
+		if r.NextHop == nil {
+			r.NextHop = append(net.IP(nil), g.NextHop...)
+		}
+	}
+
+	return r
+}
+
+// skipEthernet returns the network layer of an Ethernet frame, skipping any VLAN tags, or nil if it is not IP.
+func skipEthernet(b []byte) []byte {
+	if len(b) < 14 {
+		return nil
+	}
+	etherType, b := binary.BigEndian.Uint16(b[12:]), b[14:]
+	for (etherType == 0x8100 || etherType == 0x88a8) && len(b) >= 4 {
+		etherType, b = binary.BigEndian.Uint16(b[2:]), b[4:]
+	}
+	if etherType != 0x0800 && etherType != 0x86dd {
+		return nil
+	}
+	return b
+}
+
+// setHeader fills in the fields of the record found in a sampled IP header. Sampled headers are usually truncated, so
+// the lengths in the IP header can't be relied upon.
+func (r *Record) setHeader(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+
+	var transport []byte
+	switch b[0] >> 4 {
+	case 4:
+		ip := packet.IPv4(b)
+		if len(b) < packet.IPv4MinLen || ip.HeaderLen() < packet.IPv4MinLen || ip.HeaderLen() > len(b) {
+			return
+		}
+		r.SrcAddr = append(net.IP(nil), ip.Src()...)
+		r.DstAddr = append(net.IP(nil), ip.Dst()...)
+		r.Protocol, r.TOS = ip.Protocol(), ip.TOS()
+		// Only the first fragment holds the transport header.
+		if ip.FragmentOffset() == 0 {
+			transport = b[ip.HeaderLen():]
+		}
+
+	case 6:
+		ip := packet.IPv6(b)
+		if len(b) < packet.IPv6HeaderLen {
+			return
+		}
+		r.SrcAddr = append(net.IP(nil), ip.Src()...)
+		r.DstAddr = append(net.IP(nil), ip.Dst()...)
+		r.TOS = ip.TrafficClass()
+		next, rest := ip.NextHeader(), b[packet.IPv6HeaderLen:]
+	walk:
+		for packet.IsExtensionHeader(next) && len(rest) >= 8 {
+			hl := (int(rest[1]) + 1) * 8
+			switch next {
+			case packet.ProtocolFragment:
+				if packet.IPv6Fragment(rest).FragmentOffset() != 0 {
+					next, rest = rest[0], nil
+					break walk
+				}
+				hl = 8
+			case packet.ProtocolAH:
+				hl = (int(rest[1]) + 2) * 4
+			}
+			if hl > len(rest) {
+				next, rest = rest[0], nil
+				break
+			}
+			next, rest = rest[0], rest[hl:]
+		}
+		r.Protocol, transport = next, rest
+	}
+
+	switch r.Protocol {
+	case packet.ProtocolTCP:
+		if len(transport) >= packet.TCPMinLen {
+			tcp := packet.TCP(transport)
+			r.SrcPort, r.DstPort, r.TCPFlags = tcp.SrcPort(), tcp.DstPort(), tcp.Flags()
+		}
+	case packet.ProtocolUDP:
+		if len(transport) >= packet.UDPHeaderLen {
+			udp := packet.UDP(transport)
+			r.SrcPort, r.DstPort = udp.SrcPort(), udp.DstPort()
+		}
+	}
+}
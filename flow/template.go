@@ -0,0 +1,360 @@
+package flow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Set IDs with special meanings; IDs from 256 upwards identify data sets by the template describing them.
+const (
+	netflow9TemplateSet        = 0
+	netflow9OptionsTemplateSet = 1
+	ipfixTemplateSet           = 2
+	ipfixOptionsTemplateSet    = 3
+	minDataSet                 = 256
+)
+
+// Header lengths of the two template-based formats.
+const (
+	netflow9HeaderLen = 20
+	ipfixHeaderLen    = 16
+)
+
+// varLength is the field length that marks an IPFIX field as variable length, with its length in the record.
+const varLength = 0xffff
+
+// templateKey identifies a template, which is only meaningful in the observation domain of the exporter that sent it.
+type templateKey struct {
+	exporter string
+	domain   uint32
+	id       uint16
+}
+
+// domainKey identifies an observation domain of an exporter.
+type domainKey struct {
+	exporter string
+	domain   uint32
+}
+
+// templateField describes one field of a template.
+type templateField struct {
+	typ        uint16
+	enterprise uint32
+	length     uint16
+}
+
+// template describes the layout of the records in a data set.
+type template struct {
+	fields  []templateField
+	options bool // Records carry metadata about the exporter, rather than flows.
+}
+
+// recordLen returns the length of the record at the start of b.
+func (t *template) recordLen(b []byte) (int, error) {
+	n := 0
+	for _, f := range t.fields {
+		l := int(f.length)
+		if f.length == varLength {
+			// Variable length fields start with a one octet length, or 255 followed by a two octet length.
+			if len(b) < n+1 {
+				return 0, errors.New("variable length field truncated")
+			}
+			l, n = int(b[n]), n+1
+			if l == 255 {
+				if len(b) < n+2 {
+					return 0, errors.New("variable length field truncated")
+				}
+				l, n = int(binary.BigEndian.Uint16(b[n:])), n+2
+			}
+		}
+		n += l
+		if n > len(b) {
+			return 0, fmt.Errorf("record truncated: needs %d bytes, have %d", n, len(b))
+		}
+	}
+	return n, nil
+}
+
+// minRecordLen returns the shortest possible length of a record, used to recognise padding at the end of a set.
+func (t *template) minRecordLen() int {
+	n := 0
+	for _, f := range t.fields {
+		if f.length == varLength {
+			n++
+		} else {
+			n += int(f.length)
+		}
+	}
+	return n
+}
+
+// fieldValues splits a record, which must have been checked with recordLen, into the values of its fields.
+func (t *template) fieldValues(b []byte) []Field {
+	values := make([]Field, 0, len(t.fields))
+	for _, f := range t.fields {
+		l := int(f.length)
+		if f.length == varLength {
+			l, b = int(b[0]), b[1:]
+			if l == 255 {
+				l, b = int(binary.BigEndian.Uint16(b)), b[2:]
+			}
+		}
+		values = append(values, Field{Type: f.typ, Enterprise: f.enterprise, Value: b[:l:l]})
+		b = b[l:]
+	}
+	return values
+}
+
+// decodeNetFlow9 decodes a NetFlow v9 export packet, as described by RFC 3954.
+func (d *Decoder) decodeNetFlow9(exporter net.IP, b []byte) ([]Record, error) {
+	if len(b) < netflow9HeaderLen {
+		return nil, fmt.Errorf("netflow v9 header too short: %d bytes", len(b))
+	}
+	uptime := binary.BigEndian.Uint32(b[4:])
+	exported := time.Unix(int64(binary.BigEndian.Uint32(b[8:])), 0).UTC()
+	proto := Record{
+		Exporter:          exporter,
+		Version:           VersionNetFlow9,
+		ObservationDomain: binary.BigEndian.Uint32(b[16:]),
+		Exported:          exported,
+	}
+	boot := exported.Add(-time.Duration(uptime) * time.Millisecond)
+
+	var records []Record
+	for sets := b[netflow9HeaderLen:]; len(sets) >= 4; {
+		id, length := binary.BigEndian.Uint16(sets), int(binary.BigEndian.Uint16(sets[2:]))
+		if length < 4 || length > len(sets) {
+			return nil, fmt.Errorf("invalid netflow v9 flowset length %d", length)
+		}
+		body := sets[4:length]
+		sets = sets[length:]
+
+		var err error
+		switch {
+		case id == netflow9TemplateSet:
+			err = d.netflow9Templates(exporter, proto.ObservationDomain, body)
+		case id == netflow9OptionsTemplateSet:
+			err = d.netflow9OptionsTemplates(exporter, proto.ObservationDomain, body)
+		case id >= minDataSet:
+			records, err = d.data(records, &proto, id, body, boot)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// netflow9Templates learns the templates in a NetFlow v9 template flowset.
+func (d *Decoder) netflow9Templates(exporter net.IP, domain uint32, b []byte) error {
+	// Anything too short to be a template, or with an impossible ID, is padding.
+	for len(b) >= 4 {
+		id, count := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if id < minDataSet {
+			break
+		}
+		b = b[4:]
+		if len(b) < count*4 {
+			return fmt.Errorf("netflow v9 template %d truncated", id)
+		}
+		t := &template{fields: make([]templateField, count)}
+		for i := range t.fields {
+			t.fields[i] = templateField{
+				typ:    binary.BigEndian.Uint16(b[i*4:]),
+				length: binary.BigEndian.Uint16(b[i*4+2:]),
+			}
+		}
+		b = b[count*4:]
+		d.templates[templateKey{exporterKey(exporter), domain, id}] = t
+	}
+	return nil
+}
+
+// netflow9OptionsTemplates learns the templates in a NetFlow v9 options template flowset.
+func (d *Decoder) netflow9OptionsTemplates(exporter net.IP, domain uint32, b []byte) error {
+	for len(b) >= 6 {
+		id := binary.BigEndian.Uint16(b)
+		if id < minDataSet {
+			break
+		}
+		// The scope and option lengths are in octets, rather than a count of fields.
+		scopeLen, optionLen := int(binary.BigEndian.Uint16(b[2:])), int(binary.BigEndian.Uint16(b[4:]))
+		b = b[6:]
+		if (scopeLen+optionLen)%4 != 0 || len(b) < scopeLen+optionLen {
+			return fmt.Errorf("netflow v9 options template %d truncated", id)
+		}
+		count := (scopeLen + optionLen) / 4
+		t := &template{fields: make([]templateField, count), options: true}
+		for i := range t.fields {
+			t.fields[i] = templateField{
+				typ:    binary.BigEndian.Uint16(b[i*4:]),
+				length: binary.BigEndian.Uint16(b[i*4+2:]),
+			}
+		}
+		b = b[count*4:]
+		d.templates[templateKey{exporterKey(exporter), domain, id}] = t
+	}
+	return nil
+}
+
+// decodeIPFIX decodes an IPFIX message, as described by RFC 7011.
+func (d *Decoder) decodeIPFIX(exporter net.IP, b []byte) ([]Record, error) {
+	if len(b) < ipfixHeaderLen {
+		return nil, fmt.Errorf("ipfix header too short: %d bytes", len(b))
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < ipfixHeaderLen || length > len(b) {
+		return nil, fmt.Errorf("invalid ipfix message length %d for %d byte packet", length, len(b))
+	}
+	b = b[:length]
+	proto := Record{
+		Exporter:          exporter,
+		Version:           VersionIPFIX,
+		ObservationDomain: binary.BigEndian.Uint32(b[12:]),
+		Exported:          time.Unix(int64(binary.BigEndian.Uint32(b[4:])), 0).UTC(),
+	}
+
+	var records []Record
+	for sets := b[ipfixHeaderLen:]; len(sets) >= 4; {
+		id, length := binary.BigEndian.Uint16(sets), int(binary.BigEndian.Uint16(sets[2:]))
+		if length < 4 || length > len(sets) {
+			return nil, fmt.Errorf("invalid ipfix set length %d", length)
+		}
+		body := sets[4:length]
+		sets = sets[length:]
+
+		var err error
+		switch {
+		case id == ipfixTemplateSet, id == ipfixOptionsTemplateSet:
+			err = d.ipfixTemplates(exporter, proto.ObservationDomain, body, id == ipfixOptionsTemplateSet)
+		case id >= minDataSet:
+			// IPFIX has no notion of exporter uptime in its header, so only absolute times are understood.
+			records, err = d.data(records, &proto, id, body, time.Time{})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// ipfixTemplates learns the templates in an IPFIX template or options template set, and handles withdrawals.
+func (d *Decoder) ipfixTemplates(exporter net.IP, domain uint32, b []byte, options bool) error {
+	headerLen := 4
+	if options {
+		headerLen = 6
+	}
+
+	for len(b) >= headerLen {
+		id, count := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		b = b[headerLen:]
+
+		// A template with no fields withdraws it, and withdrawing the ID of the set withdraws every template.
+		if count == 0 {
+			switch {
+			case id == ipfixTemplateSet || id == ipfixOptionsTemplateSet:
+				d.withdrawAll(exporter, domain, options)
+			case id >= minDataSet:
+				delete(d.templates, templateKey{exporterKey(exporter), domain, id})
+			}
+			continue
+		}
+		if id < minDataSet {
+			return fmt.Errorf("invalid ipfix template id %d", id)
+		}
+
+		t := &template{fields: make([]templateField, count), options: options}
+		for i := range t.fields {
+			if len(b) < 4 {
+				return fmt.Errorf("ipfix template %d truncated", id)
+			}
+			f := templateField{typ: binary.BigEndian.Uint16(b), length: binary.BigEndian.Uint16(b[2:])}
+			b = b[4:]
+			// The top bit of the element ID indicates that an enterprise number follows.
+			if f.typ&0x8000 != 0 {
+				if len(b) < 4 {
+					return fmt.Errorf("ipfix template %d truncated", id)
+				}
+				f.typ &^= 0x8000
+				f.enterprise = binary.BigEndian.Uint32(b)
+				b = b[4:]
+			}
+			t.fields[i] = f
+		}
+		d.templates[templateKey{exporterKey(exporter), domain, id}] = t
+	}
+	return nil
+}
+
+// withdrawAll forgets every template, or every options template, of an observation domain.
+func (d *Decoder) withdrawAll(exporter net.IP, domain uint32, options bool) {
+	key := exporterKey(exporter)
+	for k, t := range d.templates {
+		if k.exporter == key && k.domain == domain && t.options == options {
+			delete(d.templates, k)
+		}
+	}
+}
+
+// data decodes the records in a data set, appending any flows to records. Options records are not returned, but the
+// sampling interval they carry is remembered and applied to later flows from the same observation domain.
+func (d *Decoder) data(records []Record, proto *Record, id uint16, b []byte, boot time.Time) ([]Record, error) {
+	t, ok := d.templates[templateKey{exporterKey(proto.Exporter), proto.ObservationDomain, id}]
+	if !ok {
+		d.stats.MissingTemplate++
+		return records, nil
+	}
+	domain := domainKey{exporterKey(proto.Exporter), proto.ObservationDomain}
+
+	// Sets may be padded at the end, which can be told apart from a record as it is shorter than any record could be.
+	minLen := t.minRecordLen()
+	if minLen == 0 {
+		return records, nil
+	}
+	for len(b) >= minLen {
+		n, err := t.recordLen(b)
+		if err != nil {
+			return nil, fmt.Errorf("data set %d: %w", id, err)
+		}
+		// The values refer to a copy of the record, so they outlive the packet buffer.
+		values := t.fieldValues(append([]byte(nil), b[:n]...))
+		b = b[n:]
+
+		if t.options {
+			for _, v := range values {
+				if v.Enterprise == 0 && isSamplingField(v.Type) {
+					d.sampling[domain] = uint32(uintValue(v.Value))
+				}
+			}
+			continue
+		}
+
+		r := *proto
+		r.Fields = values
+		for _, v := range values {
+			if v.Enterprise == 0 {
+				r.setField(v.Type, v.Value, boot)
+			}
+		}
+		if r.SamplingInterval == 0 {
+			r.SamplingInterval = d.sampling[domain]
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// isSamplingField reports whether the field holds a packet sampling interval.
+func isSamplingField(typ uint16) bool {
+	switch typ {
+	case FieldSamplingInterval, FieldSamplerRandomInterval, FieldSamplingPacketInterval:
+		return true
+	}
+	return false
+}
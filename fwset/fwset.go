@@ -0,0 +1,374 @@
+package fwset
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/aggregate"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// errNoSet is returned when the output of nft lists no set.
+var errNoSet = errors.New("no set in nft output")
+
+// Set is a named set of prefixes held by a firewall.
+type Set interface {
+	// Elements returns the prefixes in the set.
+	Elements(ctx context.Context) ([]*net.IPNet, error)
+
+	// Update adds and removes prefixes, as computed by Plan.
+	Update(ctx context.Context, add, remove []*net.IPNet) error
+}
+
+// Delta is the change needed to bring a set in line with a list of prefixes.
+type Delta struct {
+	Add    []*net.IPNet
+	Remove []*net.IPNet
+}
+
+// Empty reports whether the set is already up to date.
+func (d *Delta) Empty() bool {
+	return len(d.Add) == 0 && len(d.Remove) == 0
+}
+
+// Plan compares the elements of s with the aggregate of pfxs, and returns the prefixes to add and remove.
+func Plan(ctx context.Context, s Set, pfxs []*net.IPNet) (*Delta, error) {
+	// Aggregation sorts the prefixes in place, so it is given a copy.
+	expected, err := aggregate.IPNets(append([]*net.IPNet(nil), pfxs...))
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.Elements(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	have := make(map[string]bool, len(current))
+	for _, pfx := range current {
+		have[pfx.String()] = true
+	}
+	want := make(map[string]bool, len(expected))
+	delta := &Delta{}
+	for _, pfx := range expected {
+		want[pfx.String()] = true
+		if !have[pfx.String()] {
+			delta.Add = append(delta.Add, pfx)
+		}
+	}
+	for _, pfx := range current {
+		if !want[pfx.String()] {
+			delta.Remove = append(delta.Remove, pfx)
+		}
+	}
+	sortPrefixes(delta.Add)
+	sortPrefixes(delta.Remove)
+	return delta, nil
+}
+
+// Sync brings s in line with the aggregate of pfxs, making only the changes needed, and returns them.
+func Sync(ctx context.Context, s Set, pfxs []*net.IPNet) (*Delta, error) {
+	delta, err := Plan(ctx, s, pfxs)
+	if err != nil {
+		return nil, err
+	}
+	if delta.Empty() {
+		return delta, nil
+	}
+	if err := s.Update(ctx, delta.Add, delta.Remove); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// NFTSet is a named set in nftables, of type ipv4_addr or ipv6_addr with the interval flag, which is managed with the
+// nft command. Updates are made in a single transaction, so the set is never seen half updated.
+type NFTSet struct {
+	Family  string // The family of the table, such as inet, ip or ip6.
+	Table   string
+	Name    string
+	Command string // The path of the nft command, or nft if empty.
+}
+
+// command returns the nft command to run.
+func (s *NFTSet) command() string {
+	if s.Command == "" {
+		return "nft"
+	}
+	return s.Command
+}
+
+// Elements satisfies Set.
+func (s *NFTSet) Elements(ctx context.Context) ([]*net.IPNet, error) {
+	out, err := run(ctx, nil, s.command(), "-j", "list", "set", s.Family, s.Table, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	return parseNFT(out)
+}
+
+// Update satisfies Set. Removals are made before additions, as an interval set rejects overlapping elements, but as
+// both happen in one transaction, nothing passes unmatched in between.
+func (s *NFTSet) Update(ctx context.Context, add, remove []*net.IPNet) error {
+	var script bytes.Buffer
+	if len(remove) > 0 {
+		fmt.Fprintf(&script, "delete element %s %s %s { %s }\n", s.Family, s.Table, s.Name, elements(remove))
+	}
+	if len(add) > 0 {
+		fmt.Fprintf(&script, "add element %s %s %s { %s }\n", s.Family, s.Table, s.Name, elements(add))
+	}
+	_, err := run(ctx, script.Bytes(), s.command(), "-f", "-")
+	return err
+}
+
+// IPSet is a set of type hash:net managed with the ipset command.
+type IPSet struct {
+	Name    string
+	Command string // The path of the ipset command, or ipset if empty.
+}
+
+// command returns the ipset command to run.
+func (s *IPSet) command() string {
+	if s.Command == "" {
+		return "ipset"
+	}
+	return s.Command
+}
+
+// Elements satisfies Set.
+func (s *IPSet) Elements(ctx context.Context) ([]*net.IPNet, error) {
+	out, err := run(ctx, nil, s.command(), "save", s.Name)
+	if err != nil {
+		return nil, err
+	}
+	return parseIPSet(out, s.Name)
+}
+
+// Update satisfies Set. Additions are made before removals, as ipset has no transactions but allows overlapping
+// elements, so that nothing passes unmatched in between.
+func (s *IPSet) Update(ctx context.Context, add, remove []*net.IPNet) error {
+	var script bytes.Buffer
+	for _, pfx := range add {
+		fmt.Fprintf(&script, "add %s %s\n", s.Name, element(pfx))
+	}
+	for _, pfx := range remove {
+		fmt.Fprintf(&script, "del %s %s\n", s.Name, element(pfx))
+	}
+	_, err := run(ctx, script.Bytes(), s.command(), "-exist", "restore")
+	return err
+}
+
+// run runs a command with the given input, returning its output, or an error including what it printed on failure.
+func run(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+		}
+		return nil, fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// element formats a prefix as a set element, leaving out the length of single addresses.
+func element(pfx *net.IPNet) string {
+	if ones, bits := pfx.Mask.Size(); ones == bits {
+		return pfx.IP.String()
+	}
+	return pfx.String()
+}
+
+// elements formats prefixes as a comma-separated list of set elements.
+func elements(pfxs []*net.IPNet) string {
+	strs := make([]string, 0, len(pfxs))
+	for _, pfx := range pfxs {
+		strs = append(strs, element(pfx))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// parsePrefix parses a set element, which may be a single address.
+func parsePrefix(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, pfx, err := net.ParseCIDR(s)
+		return pfx, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid element %q", s)
+	}
+	return hostPrefix(ip), nil
+}
+
+// hostPrefix returns the prefix containing only ip.
+func hostPrefix(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+}
+
+// rangePrefixes returns the smallest list of prefixes covering the addresses from first to last inclusive, which must
+// be of the same family.
+func rangePrefixes(first, last net.IP) ([]*net.IPNet, error) {
+	if f4, l4 := first.To4(), last.To4(); f4 != nil && l4 != nil {
+		first, last = f4, l4
+	} else if first.To4() != nil || last.To4() != nil || first.To16() == nil || last.To16() == nil {
+		return nil, fmt.Errorf("invalid range %v-%v", first, last)
+	} else {
+		first, last = first.To16(), last.To16()
+	}
+	if bytes.Compare(first, last) > 0 {
+		return nil, fmt.Errorf("invalid range %v-%v", first, last)
+	}
+
+	bits := 8 * len(first)
+	var pfxs []*net.IPNet
+	ip := append(net.IP(nil), first...)
+	for {
+		// Take the largest block that starts at ip and does not extend past last.
+		ones := bits
+		for ones > 0 {
+			mask := net.CIDRMask(ones-1, bits)
+			if !ip.Mask(mask).Equal(ip) || bytes.Compare(broadcast(ip, mask), last) > 0 {
+				break
+			}
+			ones--
+		}
+		mask := net.CIDRMask(ones, bits)
+		pfxs = append(pfxs, &net.IPNet{IP: append(net.IP(nil), ip...), Mask: mask})
+
+		end := broadcast(ip, mask)
+		if bytes.Equal(end, last) {
+			return pfxs, nil
+		}
+		ip = end
+		for i := len(ip) - 1; i >= 0; i-- {
+			ip[i]++
+			if ip[i] != 0 {
+				break
+			}
+		}
+	}
+}
+
+// broadcast returns the last address of the block starting at ip with the given mask.
+func broadcast(ip net.IP, mask net.IPMask) net.IP {
+	end := make(net.IP, len(ip))
+	for i := range ip {
+		end[i] = ip[i] | ^mask[i]
+	}
+	return end
+}
+
+// sortPrefixes sorts prefixes by address, then by length, with IPv4 prefixes first.
+func sortPrefixes(pfxs []*net.IPNet) {
+	sort.Slice(pfxs, func(i, j int) bool {
+		a, b := pfxs[i], pfxs[j]
+		if v4a, v4b := a.IP.To4() != nil, b.IP.To4() != nil; v4a != v4b {
+			return v4a
+		}
+		if c := bytes.Compare(a.IP.To16(), b.IP.To16()); c != 0 {
+			return c < 0
+		}
+		onesA, _ := a.Mask.Size()
+		onesB, _ := b.Mask.Size()
+		return onesA < onesB
+	})
+}
+
+// parseNFT decodes the elements of a set listed by nft in JSON. Elements may be addresses, prefixes or ranges, which
+// are broken into prefixes, and may be wrapped in an object carrying their timeouts or counters.
+func parseNFT(b []byte) ([]*net.IPNet, error) {
+	var out struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []json.RawMessage `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("decode nft output: %w", err)
+	}
+	for _, obj := range out.Nftables {
+		if obj.Set == nil {
+			continue
+		}
+		var pfxs []*net.IPNet
+		for _, raw := range obj.Set.Elem {
+			elem, err := parseNFTElem(raw)
+			if err != nil {
+				return nil, err
+			}
+			pfxs = append(pfxs, elem...)
+		}
+		return pfxs, nil
+	}
+	return nil, errNoSet
+}
+
+// parseNFTElem decodes a single element of a set listed by nft.
+func parseNFTElem(raw json.RawMessage) ([]*net.IPNet, error) {
+	var addr string
+	if err := json.Unmarshal(raw, &addr); err == nil {
+		pfx, err := parsePrefix(addr)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.IPNet{pfx}, nil
+	}
+
+	var obj struct {
+		Prefix *struct {
+			Addr string `json:"addr"`
+			Len  int    `json:"len"`
+		} `json:"prefix"`
+		Range []string `json:"range"`
+		Elem  *struct {
+			Val json.RawMessage `json:"val"`
+		} `json:"elem"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("decode nft element %s: %w", raw, err)
+	}
+	switch {
+	case obj.Prefix != nil:
+		pfx, err := parsePrefix(fmt.Sprintf("%s/%d", obj.Prefix.Addr, obj.Prefix.Len))
+		if err != nil {
+			return nil, err
+		}
+		return []*net.IPNet{pfx}, nil
+	case len(obj.Range) == 2:
+		return rangePrefixes(net.ParseIP(obj.Range[0]), net.ParseIP(obj.Range[1]))
+	case obj.Elem != nil:
+		return parseNFTElem(obj.Elem.Val)
+	}
+	return nil, fmt.Errorf("unsupported nft element %s", raw)
+}
+
+// parseIPSet decodes the elements of the named set from the output of ipset save.
+func parseIPSet(b []byte, name string) ([]*net.IPNet, error) {
+	var pfxs []*net.IPNet
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "add" || fields[1] != name {
+			continue
+		}
+		pfx, err := parsePrefix(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	return pfxs, nil
+}
@@ -0,0 +1,197 @@
+package fwset
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func parsePrefixes(t *testing.T, strs ...string) []*net.IPNet {
+	t.Helper()
+	var pfxs []*net.IPNet
+	for _, s := range strs {
+		pfx, err := parsePrefix(s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	return pfxs
+}
+
+func prefixStrings(pfxs []*net.IPNet) []string {
+	var strs []string
+	for _, pfx := range pfxs {
+		strs = append(strs, pfx.String())
+	}
+	return strs
+}
+
+// fakeCommand writes a script standing in for nft or ipset, which prints listing for list and save commands, and
+// records the input of any other command. It returns the path of the script and of the recorded input.
+func fakeCommand(t *testing.T, listing string) (string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands need a shell")
+	}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "listing"), []byte(listing), 0o644); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	script := `#!/bin/sh
+case "$1" in
+-j|save) cat "` + dir + `/listing" ;;
+*) echo "$@" >> "` + dir + `/input"; cat >> "` + dir + `/input" ;;
+esac
+`
+	path := filepath.Join(dir, "command")
+	if err := ioutil.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	return path, filepath.Join(dir, "input")
+}
+
+func TestRangePrefixes(t *testing.T) {
+	tests := map[string]struct {
+		first, last string
+		want        []string
+	}{
+		"Single": {
+			first: "192.0.2.7",
+			last:  "192.0.2.7",
+			want:  []string{"192.0.2.7/32"},
+		},
+		"Aligned": {
+			first: "192.0.2.0",
+			last:  "192.0.3.255",
+			want:  []string{"192.0.2.0/23"},
+		},
+		"Unaligned": {
+			first: "192.0.2.1",
+			last:  "192.0.2.130",
+			want: []string{
+				"192.0.2.1/32", "192.0.2.2/31", "192.0.2.4/30", "192.0.2.8/29", "192.0.2.16/28", "192.0.2.32/27",
+				"192.0.2.64/26", "192.0.2.128/31", "192.0.2.130/32",
+			},
+		},
+		"All": {
+			first: "0.0.0.0",
+			last:  "255.255.255.255",
+			want:  []string{"0.0.0.0/0"},
+		},
+		"IPv6": {
+			first: "2001:db8::",
+			last:  "2001:db8:0:1::ffff",
+			want:  []string{"2001:db8::/64", "2001:db8:0:1::/112"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := rangePrefixes(net.ParseIP(test.first), net.ParseIP(test.last))
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, prefixStrings(got)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	if _, err := rangePrefixes(net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.1")); err == nil {
+		t.Fatalf("reversed range accepted")
+	}
+	if _, err := rangePrefixes(net.ParseIP("192.0.2.2"), net.ParseIP("2001:db8::")); err == nil {
+		t.Fatalf("mixed range accepted")
+	}
+}
+
+func TestNFTSet(t *testing.T) {
+	listing := `{"nftables": [{"metainfo": {"version": "1.0.6", "json_schema_version": 1}}, {"set": {
+		"family": "inet", "name": "blocklist", "table": "filter", "type": "ipv4_addr", "flags": ["interval"],
+		"elem": [
+			"192.0.2.1",
+			{"prefix": {"addr": "198.51.100.0", "len": 24}},
+			{"range": ["203.0.113.0", "203.0.113.191"]},
+			{"elem": {"val": {"prefix": {"addr": "10.0.0.0", "len": 8}}, "counter": {"packets": 0, "bytes": 0}}}
+		]
+	}}]}`
+	cmd, input := fakeCommand(t, listing)
+	s := &NFTSet{Family: "inet", Table: "filter", Name: "blocklist", Command: cmd}
+
+	got, err := s.Elements(context.Background())
+	if err != nil {
+		t.Fatalf("elements err: %v", err)
+	}
+	want := []string{"192.0.2.1/32", "198.51.100.0/24", "203.0.113.0/25", "203.0.113.128/26", "10.0.0.0/8"}
+	if diff := cmp.Diff(want, prefixStrings(got)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	delta, err := Sync(context.Background(), s, parsePrefixes(t,
+		"192.0.2.1", "198.51.100.0/25", "198.51.100.128/25", "203.0.113.0/24", "10.0.0.0/8", "10.1.0.0/16"))
+	if err != nil {
+		t.Fatalf("sync err: %v", err)
+	}
+	if diff := cmp.Diff([]string{"203.0.113.0/24"}, prefixStrings(delta.Add)); diff != "" {
+		t.Fatalf("add: %v", diff)
+	}
+	if diff := cmp.Diff([]string{"203.0.113.0/25", "203.0.113.128/26"}, prefixStrings(delta.Remove)); diff != "" {
+		t.Fatalf("remove: %v", diff)
+	}
+	b, err := ioutil.ReadFile(input)
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	wantInput := "-f -\n" +
+		"delete element inet filter blocklist { 203.0.113.0/25, 203.0.113.128/26 }\n" +
+		"add element inet filter blocklist { 203.0.113.0/24 }\n"
+	if diff := cmp.Diff(wantInput, string(b)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestIPSet(t *testing.T) {
+	listing := `create blocklist hash:net family inet6 hashsize 1024 maxelem 65536
+add blocklist 2001:db8::/32
+add blocklist 2001:db8:ffff::1
+add other 2001:db9::/32
+`
+	cmd, input := fakeCommand(t, listing)
+	s := &IPSet{Name: "blocklist", Command: cmd}
+
+	delta, err := Sync(context.Background(), s, parsePrefixes(t, "2001:db8::/32", "2001:db8:1::/48", "2001:db9::1"))
+	if err != nil {
+		t.Fatalf("sync err: %v", err)
+	}
+	if diff := cmp.Diff([]string{"2001:db9::1/128"}, prefixStrings(delta.Add)); diff != "" {
+		t.Fatalf("add: %v", diff)
+	}
+	if diff := cmp.Diff([]string{"2001:db8:ffff::1/128"}, prefixStrings(delta.Remove)); diff != "" {
+		t.Fatalf("remove: %v", diff)
+	}
+	b, err := ioutil.ReadFile(input)
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	wantInput := "-exist restore\nadd blocklist 2001:db9::1\ndel blocklist 2001:db8:ffff::1\n"
+	if diff := cmp.Diff(wantInput, string(b)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// Once up to date, nothing is run.
+	os.Remove(input)
+	s.Command, input = fakeCommand(t, "add blocklist 2001:db8::/32\nadd blocklist 2001:db9::1\n")
+	delta, err = Sync(context.Background(), s, parsePrefixes(t, "2001:db8::/32", "2001:db9::1"))
+	if err != nil || !delta.Empty() {
+		t.Fatalf("sync: got %+v, %v", delta, err)
+	}
+	if _, err := os.Stat(input); !os.IsNotExist(err) {
+		t.Fatalf("update run for an up to date set")
+	}
+}
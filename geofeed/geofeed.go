@@ -0,0 +1,73 @@
+package geofeed
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Entry is a single line of a geofeed, describing where the users of a prefix are located. Fields other than the
+// prefix may be empty.
+type Entry struct {
+	Prefix  *net.IPNet
+	Country string // ISO 3166-1 alpha-2 code, in upper case.
+	Region  string // ISO 3166-2 code, such as "GB-LND".
+	City    string
+	Postal  string // Deprecated by RFC 8805, and usually empty.
+}
+
+// Parse reads a self-published IP geolocation feed in the CSV format of RFC 8805. Comments and blank lines are
+// skipped, and a line with an invalid prefix causes an error identifying the line.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// Missing trailing fields are allowed, and treated as empty.
+		fields := strings.Split(text, ",")
+		for len(fields) < 5 {
+			fields = append(fields, "")
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		_, prefix, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			// A bare address is a host route.
+			ip := net.ParseIP(fields[0])
+			if ip == nil {
+				return nil, fmt.Errorf("line %d: invalid prefix %q", line, fields[0])
+			}
+			prefix = hostPrefix(ip)
+		}
+
+		entries = append(entries, Entry{
+			Prefix:  prefix,
+			Country: strings.ToUpper(fields[1]),
+			Region:  strings.ToUpper(fields[2]),
+			City:    fields[3],
+			Postal:  fields[4],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// hostPrefix returns the prefix covering only the supplied address.
+func hostPrefix(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
@@ -0,0 +1,70 @@
+package geofeed
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    []Entry
+		wantErr bool
+	}{
+		"RFC8805Example": {
+			input: "# Example from RFC 8805\n" +
+				"192.0.2.0/25,US,US-AL,,\n" +
+				"192.0.2.5,US,US-AL,Alabaster,\n" +
+				"192.0.2.128/25,PL,PL-MZ,,02-784\n" +
+				"2001:db8::/32,pl,,,\n" +
+				"\n" +
+				"2001:db8:cafe::/48,PL,PL-MZ,,02-784\n",
+			want: []Entry{
+				{Prefix: mustCIDR("192.0.2.0/25"), Country: "US", Region: "US-AL"},
+				{Prefix: mustCIDR("192.0.2.5/32"), Country: "US", Region: "US-AL", City: "Alabaster"},
+				{Prefix: mustCIDR("192.0.2.128/25"), Country: "PL", Region: "PL-MZ", Postal: "02-784"},
+				{Prefix: mustCIDR("2001:db8::/32"), Country: "PL"},
+				{Prefix: mustCIDR("2001:db8:cafe::/48"), Country: "PL", Region: "PL-MZ", Postal: "02-784"},
+			},
+		},
+		"MissingFields": {
+			input: "198.51.100.0/24, GB\n",
+			want:  []Entry{{Prefix: mustCIDR("198.51.100.0/24"), Country: "GB"}},
+		},
+		"InvalidPrefix": {
+			input:   "192.0.2.0/25,US\nnot-a-prefix,US\n",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tc.input))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				if !strings.Contains(err.Error(), "line 2") {
+					t.Fatalf("error does not identify line: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package hijack
+
+import (
+	"context"
+	"fmt"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/lpm"
+	"github.com/dotwaffle/inettools/rpki"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kind is the kind of an alert.
+type Kind int
+
+// Kinds of alerts.
+const (
+	// A watched prefix is announced by an origin not expected of it.
+	NewOrigin Kind = iota
+	// A prefix more specific than a watched one is announced, by an origin not expected of it or longer than expected.
+	MoreSpecific
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NewOrigin:
+		return "new-origin"
+	case MoreSpecific:
+		return "more-specific"
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Watch is a prefix to watch, and the announcements expected of it.
+type Watch struct {
+	Prefix *net.IPNet
+	// The ASes expected to originate the prefix and its more specifics. If empty, the origin of the first announcement
+	// of the prefix itself is expected.
+	Origins []uint32
+	// The length of the longest more specifics the expected origins announce, or the prefix's own length if zero.
+	MaxLength int
+}
+
+// Alert reports an unexpected announcement within a watched prefix.
+type Alert struct {
+	Kind     Kind
+	Watched  *net.IPNet // The watched prefix.
+	Expected []uint32   // The origins expected of it.
+	Prefix   *net.IPNet // The announced prefix.
+	Origin   uint32
+	ASPath   []uint32
+	Peer     net.IP // The peer the announcement was first seen from.
+	PeerAS   uint32
+	Time     time.Time
+	RPKI     rpki.State // The validation state of the announcement, or rpki.NotFound if the monitor has no ROAs.
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s: %v announced by AS%d within %v, expected from %v, rpki %v, path %v via %v",
+		a.Kind, a.Prefix, a.Origin, a.Watched, a.Expected, a.RPKI, a.ASPath, a.Peer)
+}
+
+// watch is a watched prefix, as stored in the table of a Monitor.
+type watch struct {
+	Watch
+	maxLen int
+}
+
+// Monitor watches BGP updates, such as from a route collector, for announcements of watched prefixes, and more
+// specifics of them, by unexpected origins. An alert is raised when an unexpected origin of a prefix first becomes
+// visible from any peer, and again if it reappears after every peer has withdrawn it. It is safe for concurrent use,
+// and prefixes may be watched while updates are being processed.
+type Monitor struct {
+	ROAs    *rpki.Table // The ROAs to validate alerted announcements against, if any.
+	OnAlert func(Alert) // If set, called by Run with each alert.
+
+	mu      sync.Mutex
+	watches *lpm.Table
+	visible map[string]map[string]uint32 // The origin of each watched prefix seen from each peer.
+}
+
+// NewMonitor returns a Monitor watching no prefixes.
+func NewMonitor() *Monitor {
+	return &Monitor{watches: lpm.New(), visible: map[string]map[string]uint32{}}
+}
+
+// Watch adds a prefix to those watched, replacing any identical prefix already watched.
+func (m *Monitor) Watch(w Watch) error {
+	ones, bits := w.Prefix.Mask.Size()
+	maxLen := w.MaxLength
+	if maxLen == 0 {
+		maxLen = ones
+	}
+	if maxLen < ones || maxLen > bits {
+		return fmt.Errorf("invalid max length %d of %v", w.MaxLength, w.Prefix)
+	}
+	w.Prefix = &net.IPNet{IP: w.Prefix.IP.Mask(w.Prefix.Mask), Mask: w.Prefix.Mask}
+	w.Origins = append([]uint32(nil), w.Origins...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.watches.Insert(w.Prefix, &watch{Watch: w, maxLen: maxLen})
+}
+
+// Process processes an update, returning the alerts it raises.
+func (m *Monitor) Process(u *bgp.Update) []Alert {
+	peer := u.Peer.String() + " AS" + strconv.FormatUint(uint64(u.PeerAS), 10)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, pfx := range u.Withdrawn {
+		key := pfx.String()
+		if peers, ok := m.visible[key]; ok {
+			delete(peers, peer)
+			if len(peers) == 0 {
+				delete(m.visible, key)
+			}
+		}
+	}
+
+	var alerts []Alert
+	for i := range u.Announced {
+		r := &u.Announced[i]
+		w := m.watch(r.Prefix)
+		if w == nil {
+			continue
+		}
+		key, origin := r.Prefix.String(), r.OriginAS()
+		peers := m.visible[key]
+		if peers == nil {
+			peers = map[string]uint32{}
+			m.visible[key] = peers
+		}
+		seen := false
+		for _, o := range peers {
+			seen = seen || o == origin
+		}
+		peers[peer] = origin
+		if seen {
+			continue
+		}
+
+		ones, _ := r.Prefix.Mask.Size()
+		watched, _ := w.Prefix.Mask.Size()
+		kind := MoreSpecific
+		if ones == watched {
+			if len(w.Origins) == 0 {
+				w.Origins = []uint32{origin}
+			}
+			kind = NewOrigin
+			if w.expects(origin) {
+				continue
+			}
+		} else if w.expects(origin) && ones <= w.maxLen {
+			continue
+		}
+
+		alert := Alert{
+			Kind:     kind,
+			Watched:  w.Prefix,
+			Expected: append([]uint32(nil), w.Origins...),
+			Prefix:   r.Prefix,
+			Origin:   origin,
+			ASPath:   r.ASPath,
+			Peer:     u.Peer,
+			PeerAS:   u.PeerAS,
+			Time:     u.Time,
+		}
+		if m.ROAs != nil {
+			alert.RPKI = m.ROAs.Validate(r.Prefix, origin)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// watch returns the most specific watch covering a prefix, or nil if there is none. It must be called with the lock
+// held.
+func (m *Monitor) watch(pfx *net.IPNet) *watch {
+	if pfx == nil {
+		return nil
+	}
+	ones, _ := pfx.Mask.Size()
+	entries, err := m.watches.Matches(pfx.IP)
+	if err != nil {
+		return nil
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if l, _ := entries[i].Prefix.Mask.Size(); l <= ones {
+			return entries[i].Value.(*watch)
+		}
+	}
+	return nil
+}
+
+// expects returns whether an AS is expected to originate the watched prefix.
+func (w *watch) expects(origin uint32) bool {
+	for _, o := range w.Origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Run processes the updates received from a channel, calling OnAlert with each alert, until the channel is closed or
+// the context is done.
+func (m *Monitor) Run(ctx context.Context, updates <-chan bgp.Update) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case u, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			for _, a := range m.Process(&u) {
+				if m.OnAlert != nil {
+					m.OnAlert(a)
+				}
+			}
+		}
+	}
+}
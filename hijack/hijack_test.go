@@ -0,0 +1,114 @@
+package hijack
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/rpki"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// announce returns an update from a peer announcing a prefix with an AS path.
+func announce(peer, pfx string, path ...uint32) bgp.Update {
+	return bgp.Update{Peer: net.ParseIP(peer), PeerAS: path[0],
+		Announced: []bgp.Route{{Prefix: mustCIDR(pfx), ASPath: path}}}
+}
+
+// withdraw returns an update from a peer withdrawing a prefix.
+func withdraw(peer string, peerAS uint32, pfx string) bgp.Update {
+	return bgp.Update{Peer: net.ParseIP(peer), PeerAS: peerAS, Withdrawn: []*net.IPNet{mustCIDR(pfx)}}
+}
+
+// summary is what the tests check of an alert.
+type summary struct {
+	Kind   Kind
+	Prefix string
+	Origin uint32
+	RPKI   rpki.State
+}
+
+func TestMonitor(t *testing.T) {
+	roas := rpki.NewTable()
+	if err := roas.Add(rpki.ROA{Prefix: mustCIDR("192.0.2.0/23"), MaxLength: 24, ASN: 64496}); err != nil {
+		t.Fatalf("add roa err: %v", err)
+	}
+	m := NewMonitor()
+	m.ROAs = roas
+	for _, w := range []Watch{
+		{Prefix: mustCIDR("192.0.2.0/23"), Origins: []uint32{64496}, MaxLength: 24},
+		{Prefix: mustCIDR("2001:db8::/32")},
+	} {
+		if err := m.Watch(w); err != nil {
+			t.Fatalf("watch err: %v", err)
+		}
+	}
+	if err := m.Watch(Watch{Prefix: mustCIDR("198.51.100.0/24"), MaxLength: 16}); err == nil {
+		t.Fatalf("got no error from a max length shorter than the prefix")
+	}
+
+	steps := []struct {
+		update bgp.Update
+		want   []summary
+	}{
+		// Expected announcements, and an unrelated one.
+		{announce("10.0.0.1", "192.0.2.0/23", 65001, 64496), nil},
+		{announce("10.0.0.1", "192.0.3.0/24", 65001, 64496), nil},
+		{announce("10.0.0.1", "198.51.100.0/24", 65001, 64666), nil},
+		// The origin of the IPv6 prefix is learned.
+		{announce("10.0.0.1", "2001:db8::/32", 65001, 64497), nil},
+		// A new origin of the prefix, seen again from another peer.
+		{announce("10.0.0.1", "192.0.2.0/23", 65001, 64666), []summary{{NewOrigin, "192.0.2.0/23", 64666, rpki.Invalid}}},
+		{announce("10.0.0.2", "192.0.2.0/23", 65002, 64666), nil},
+		// A more specific than expected from the expected origin, and one from another origin.
+		{announce("10.0.0.1", "192.0.2.128/25", 65001, 64496),
+			[]summary{{MoreSpecific, "192.0.2.128/25", 64496, rpki.Invalid}}},
+		{announce("10.0.0.1", "2001:db8:1::/48", 65001, 64666),
+			[]summary{{MoreSpecific, "2001:db8:1::/48", 64666, rpki.NotFound}}},
+		{announce("10.0.0.1", "2001:db8::/32", 65001, 64498), []summary{{NewOrigin, "2001:db8::/32", 64498, rpki.NotFound}}},
+		// Once withdrawn everywhere, a hijack reappearing is alerted again.
+		{withdraw("10.0.0.1", 65001, "192.0.2.0/23"), nil},
+		{announce("10.0.0.1", "192.0.2.0/23", 65001, 64666), nil},
+		{withdraw("10.0.0.1", 65001, "192.0.2.0/23"), nil},
+		{withdraw("10.0.0.2", 65002, "192.0.2.0/23"), nil},
+		{announce("10.0.0.3", "192.0.2.0/23", 65003, 64666), []summary{{NewOrigin, "192.0.2.0/23", 64666, rpki.Invalid}}},
+	}
+	for i, step := range steps {
+		var got []summary
+		for _, a := range m.Process(&step.update) {
+			got = append(got, summary{a.Kind, a.Prefix.String(), a.Origin, a.RPKI})
+		}
+		if diff := cmp.Diff(step.want, got); diff != "" {
+			t.Fatalf("step %d: %v", i, diff)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	m := NewMonitor()
+	if err := m.Watch(Watch{Prefix: mustCIDR("192.0.2.0/24"), Origins: []uint32{64496}}); err != nil {
+		t.Fatalf("watch err: %v", err)
+	}
+	var alerts []Alert
+	m.OnAlert = func(a Alert) { alerts = append(alerts, a) }
+
+	updates := make(chan bgp.Update, 2)
+	updates <- announce("10.0.0.1", "192.0.2.0/24", 65001, 64496)
+	updates <- announce("10.0.0.1", "192.0.2.0/25", 65001, 64666)
+	close(updates)
+	if err := m.Run(context.Background(), updates); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Kind != MoreSpecific || alerts[0].PeerAS != 65001 ||
+		!cmp.Equal(alerts[0].Expected, []uint32{64496}) {
+		t.Fatalf("got %v", alerts)
+	}
+}
@@ -0,0 +1,216 @@
+package httpprobe
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/dotwaffle/inettools/proxydial"
+	"github.com/dotwaffle/inettools/sockopt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the time allowed for a whole probe if the Prober does not say otherwise.
+const DefaultTimeout = 10 * time.Second
+
+// Timings breaks the time taken by a request down into its phases. Phases that did not happen, such as the DNS lookup
+// of an address literal or the TLS handshake of a plain HTTP request, are zero.
+type Timings struct {
+	DNS      time.Duration // Resolving the host name.
+	Connect  time.Duration // Establishing the TCP connection, to the proxy if there is one.
+	Proxy    time.Duration // Establishing the tunnel through the proxy, once connected to it.
+	TLS      time.Duration // The TLS handshake.
+	TTFB     time.Duration // From the request being written to the first byte of the response, mostly server think time.
+	Transfer time.Duration // From the first byte of the response to the last byte of the body.
+	Total    time.Duration // From the start of the probe to the end of the body.
+}
+
+// Result describes the outcome of a probe.
+type Result struct {
+	URL        string
+	Status     int
+	Proto      string               // The protocol of the response, such as HTTP/1.1 or HTTP/2.0.
+	Header     http.Header          // The header of the response.
+	RemoteAddr net.Addr             // The address connected to, which is the proxy's if there is one.
+	TLS        *tls.ConnectionState // The state of the TLS connection, or nil for plain HTTP.
+	Bytes      int64                // The length of the body read.
+	Timings    Timings
+
+	// TCPInfo is the state of the connection once the body had been read, giving the kernel's view of the RTT,
+	// congestion window and retransmissions alongside the timings above. It is nil where it is not available.
+	TCPInfo *TCPInfo
+}
+
+// Prober makes single HTTP(S) requests on fresh connections, timing each phase. The zero value makes GET requests
+// with the default timeout.
+type Prober struct {
+	Method    string        // GET or HEAD, or GET if empty.
+	Header    http.Header   // Added to each request.
+	Timeout   time.Duration // The time allowed for the whole probe, or DefaultTimeout if zero.
+	TLSConfig *tls.Config   // Used for HTTPS, or the default configuration if nil.
+	MaxBody   int64         // The most of the body read, or all of it if zero.
+	// Source is the address requests are sent from, or nil to let the host choose. Only addresses of the same family
+	// are connected to, and the source is checked against them and Socket.Device with sockopt.CheckSource.
+	Source net.IP
+	Socket sockopt.Options // Steers requests, such as by binding to a VRF device.
+	// Proxy tunnels requests through a proxy, such as a proxydial.SOCKS5, rather than connecting directly, in which
+	// case Source and Socket are unused, and the proxy's own dialer decides how to reach it.
+	Proxy proxydial.ContextDialer
+}
+
+// Probe makes a single request to url using a Prober with the default settings.
+func Probe(ctx context.Context, url string) (*Result, error) {
+	var p Prober
+	return p.Probe(ctx, url)
+}
+
+// Probe makes a single request to url on a new connection, and reads the body. Redirects are not followed, so that the
+// timings describe a single exchange; the status code shows whether one was offered. Proxies configured in the
+// environment are ignored, as the point is to measure the direct path, unless one is set as the Prober's Proxy.
+func (p *Prober) Probe(ctx context.Context, url string) (*Result, error) {
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := DefaultTimeout
+	if p.Timeout > 0 {
+		timeout = p.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Capture the TCP connection as it is dialed, beneath any TLS, so that TCP_INFO can be read from it later.
+	var (
+		mu     sync.Mutex
+		conn   net.Conn
+		tunnel time.Duration
+	)
+	dialer := net.Dialer{Control: p.Socket.Control}
+	if p.Source != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: p.Source}
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if p.Proxy != nil {
+				c, err := p.Proxy.DialContext(ctx, network, address)
+				if err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				conn = c
+				if pc, ok := c.(*proxydial.Conn); ok {
+					conn, tunnel = pc.Conn, pc.Handshake
+				}
+				mu.Unlock()
+				return c, nil
+			}
+			c, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			if err := sockopt.CheckSource(p.Source, c.RemoteAddr().(*net.TCPAddr).IP, p.Socket.Device); err != nil {
+				c.Close()
+				return nil, err
+			}
+			mu.Lock()
+			conn = c
+			mu.Unlock()
+			return c, nil
+		},
+		TLSClientConfig:   p.TLSConfig,
+		ForceAttemptHTTP2: true,
+	}
+	// Keep-alives are left enabled, so that the connection is still open to be inspected once the body has been read.
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var t struct {
+		dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, wrote, firstByte time.Time
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.dnsDone = time.Now() },
+		ConnectStart: func(string, string) {
+			// Several addresses may be tried in parallel; the phase starts with the first.
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.connectDone = time.Now()
+			}
+		},
+		TLSHandshakeStart:    func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.tlsDone = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.wrote = time.Now() },
+		GotFirstResponseByte: func() { t.firstByte = time.Now() },
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range p.Header {
+		req.Header[k] = v
+	}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body := io.Reader(res.Body)
+	if p.MaxBody > 0 {
+		body = io.LimitReader(body, p.MaxBody)
+	}
+	n, err := io.Copy(ioutil.Discard, body)
+	if err != nil {
+		return nil, err
+	}
+	end := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	result := &Result{
+		URL:    url,
+		Status: res.StatusCode,
+		Proto:  res.Proto,
+		Header: res.Header,
+		TLS:    res.TLS,
+		Bytes:  n,
+		Timings: Timings{
+			DNS:      between(t.dnsStart, t.dnsDone),
+			Connect:  between(t.connectStart, t.connectDone),
+			Proxy:    tunnel,
+			TLS:      between(t.tlsStart, t.tlsDone),
+			TTFB:     between(t.wrote, t.firstByte),
+			Transfer: between(t.firstByte, end),
+			Total:    end.Sub(start),
+		},
+	}
+	if conn != nil {
+		result.RemoteAddr = conn.RemoteAddr()
+		// The snapshot is a bonus, so failing to take one is not a reason to fail the probe.
+		result.TCPInfo, _ = snapshot(conn)
+	}
+	return result, nil
+}
+
+// between returns the time from start to end, or zero if either did not happen.
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
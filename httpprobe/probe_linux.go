@@ -0,0 +1,21 @@
+// +build linux
+
+package httpprobe
+
+import (
+	"github.com/dotwaffle/inettools/tcpinfo"
+	"net"
+	"syscall"
+)
+
+// TCPInfo is the TCP_INFO of a connection.
+type TCPInfo = syscall.TCPInfo
+
+// snapshot retrieves the TCP_INFO of a connection.
+func snapshot(conn net.Conn) (*TCPInfo, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, tcpinfo.ErrNotTCP
+	}
+	return tcpinfo.Get(tcpConn)
+}
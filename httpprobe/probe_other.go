@@ -0,0 +1,13 @@
+// +build !linux
+
+package httpprobe
+
+import (
+	"github.com/dotwaffle/inettools/tcpinfo"
+	"net"
+)
+
+// TCPInfo is empty on platforms other than Linux, where no snapshot can be taken.
+type TCPInfo struct{}
+
+func snapshot(net.Conn) (*TCPInfo, error) { return nil, tcpinfo.ErrUnsupportedPlatform }
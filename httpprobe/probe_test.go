@@ -0,0 +1,176 @@
+package httpprobe
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/proxydial"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	body := strings.Repeat("x", 100000)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			w.Header().Set("Location", "/")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		if r.Header.Get("X-Probe") != "yes" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(body))
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+	connect := &proxydial.HTTPConnect{Address: proxy.Listener.Addr().String()}
+
+	tests := map[string]struct {
+		prober    Prober
+		url       string
+		status    int
+		bytes     int64
+		tls       bool
+		dns       bool
+		proxied   bool
+		redirects bool
+	}{
+		"HTTP": {
+			url:    plain.URL,
+			status: http.StatusOK,
+			bytes:  int64(len(body)),
+		},
+		"HTTPS": {
+			prober: Prober{TLSConfig: secure.Client().Transport.(*http.Transport).TLSClientConfig},
+			url:    secure.URL,
+			status: http.StatusOK,
+			bytes:  int64(len(body)),
+			tls:    true,
+		},
+		"HEAD": {
+			prober: Prober{Method: http.MethodHead},
+			url:    plain.URL,
+			status: http.StatusOK,
+		},
+		"MaxBody": {
+			prober: Prober{MaxBody: 1000},
+			url:    plain.URL,
+			status: http.StatusOK,
+			bytes:  1000,
+		},
+		"Hostname": {
+			url:    strings.Replace(plain.URL, "127.0.0.1", "localhost", 1),
+			status: http.StatusOK,
+			bytes:  int64(len(body)),
+			dns:    true,
+		},
+		"Source": {
+			prober: Prober{Source: net.IPv4(127, 0, 0, 1)},
+			url:    strings.Replace(plain.URL, "127.0.0.1", "localhost", 1),
+			status: http.StatusOK,
+			bytes:  int64(len(body)),
+			dns:    true,
+		},
+		"Proxy": {
+			prober:  Prober{Proxy: connect},
+			url:     plain.URL,
+			status:  http.StatusOK,
+			bytes:   int64(len(body)),
+			proxied: true,
+		},
+		"ProxyHTTPS": {
+			prober: Prober{
+				TLSConfig: secure.Client().Transport.(*http.Transport).TLSClientConfig,
+				Proxy:     connect,
+			},
+			url:     secure.URL,
+			status:  http.StatusOK,
+			bytes:   int64(len(body)),
+			tls:     true,
+			proxied: true,
+		},
+		"NoRedirect": {
+			url:    plain.URL + "/moved",
+			status: http.StatusFound,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			tc.prober.Header = http.Header{"X-Probe": {"yes"}}
+			res, err := tc.prober.Probe(context.Background(), tc.url)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if res.Status != tc.status || res.Bytes != tc.bytes {
+				t.Fatalf("got status %d, %d bytes, want %d, %d bytes", res.Status, res.Bytes, tc.status, tc.bytes)
+			}
+			if (res.TLS != nil) != tc.tls || (res.Timings.TLS > 0) != tc.tls {
+				t.Errorf("got tls %v, handshake %v, want tls %v", res.TLS != nil, res.Timings.TLS, tc.tls)
+			}
+			if (res.Timings.DNS > 0) != tc.dns {
+				t.Errorf("got dns %v, want lookup %v", res.Timings.DNS, tc.dns)
+			}
+			if (res.Timings.Proxy > 0) != tc.proxied {
+				t.Errorf("got proxy %v, want tunnel %v", res.Timings.Proxy, tc.proxied)
+			}
+			tm := res.Timings
+			if tm.Connect <= 0 || tm.TTFB <= 0 || tm.Total < tm.DNS+tm.Connect+tm.Proxy+tm.TLS+tm.TTFB+tm.Transfer {
+				t.Errorf("inconsistent timings %+v", tm)
+			}
+			if tc.status == http.StatusOK && tm.TTFB < 20*time.Millisecond {
+				t.Errorf("ttfb %v shorter than the server delay", tm.TTFB)
+			}
+			if res.RemoteAddr == nil {
+				t.Errorf("no remote address")
+			}
+			if runtime.GOOS == "linux" && res.TCPInfo == nil {
+				t.Errorf("no tcp info")
+			}
+		})
+	}
+
+	t.Run("SourceNotLocal", func(t *testing.T) {
+		p := Prober{Source: net.IPv4(192, 0, 2, 1)}
+		if _, err := p.Probe(context.Background(), plain.URL); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		p := Prober{Timeout: 5 * time.Millisecond, Header: http.Header{"X-Probe": {"yes"}}}
+		if _, err := p.Probe(context.Background(), plain.URL); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Errors describing why a packet could not be delivered, as returned by Message.Err. The *Error it returns matches
+// one of these with errors.Is.
+var (
+	ErrNetworkUnreachable      = errors.New("network unreachable")
+	ErrHostUnreachable         = errors.New("host unreachable")
+	ErrProtocolUnreachable     = errors.New("protocol unreachable")
+	ErrPortUnreachable         = errors.New("port unreachable")
+	ErrAdministrativelyBlocked = errors.New("administratively prohibited")
+	ErrPacketTooBig            = errors.New("packet too big")
+	ErrSourceRouteFailed       = errors.New("source route failed")
+	ErrAddressUnreachable      = errors.New("address unreachable")
+	ErrTTLExceeded             = errors.New("ttl exceeded in transit")
+	ErrReassemblyTimeExceeded  = errors.New("fragment reassembly time exceeded")
+	ErrParameterProblem        = errors.New("parameter problem")
+	ErrUnreachable             = errors.New("destination unreachable")
+)
+
+// Error is an ICMP error message, presented as a Go error.
+type Error struct {
+	V6   bool
+	Type uint8
+	Code uint8
+	Kind error // One of the Err variables from this package.
+}
+
+func (e *Error) Error() string {
+	family := "icmp"
+	if e.V6 {
+		family = "icmpv6"
+	}
+	return fmt.Sprintf("%s: %v (type %d, code %d)", family, e.Kind, e.Type, e.Code)
+}
+
+// Unwrap returns the kind of the error, so that errors.Is can match it.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Err classifies an error message, returning nil if the message is not an error (such as an echo reply).
+func (m *Message) Err() error {
+	kind := m.kind()
+	if kind == nil {
+		return nil
+	}
+	return &Error{V6: m.V6, Type: m.Type, Code: m.Code, Kind: kind}
+}
+
+// kind maps the type and code of an error message to one of the Err variables.
+func (m *Message) kind() error {
+	if m.V6 {
+		switch m.Type {
+		case TypeV6DestinationUnreachable:
+			switch m.Code {
+			case 0:
+				return ErrNetworkUnreachable
+			case 1, 5, 6:
+				// Communication prohibited, failed ingress/egress policy, reject route.
+				return ErrAdministrativelyBlocked
+			case 3:
+				return ErrAddressUnreachable
+			case 4:
+				return ErrPortUnreachable
+			}
+			return ErrUnreachable
+		case TypeV6PacketTooBig:
+			return ErrPacketTooBig
+		case TypeV6TimeExceeded:
+			if m.Code == 1 {
+				return ErrReassemblyTimeExceeded
+			}
+			return ErrTTLExceeded
+		case TypeV6ParameterProblem:
+			return ErrParameterProblem
+		}
+		return nil
+	}
+
+	switch m.Type {
+	case TypeDestinationUnreachable:
+		switch m.Code {
+		case 0, 6, 11:
+			// Network unreachable, network unknown, network unreachable for TOS.
+			return ErrNetworkUnreachable
+		case 1, 7, 12:
+			// Host unreachable, host unknown, host unreachable for TOS.
+			return ErrHostUnreachable
+		case 2:
+			return ErrProtocolUnreachable
+		case 3:
+			return ErrPortUnreachable
+		case 4:
+			return ErrPacketTooBig
+		case 5:
+			return ErrSourceRouteFailed
+		case 9, 10, 13:
+			// Network prohibited, host prohibited, communication prohibited.
+			return ErrAdministrativelyBlocked
+		}
+		return ErrUnreachable
+	case TypeTimeExceeded:
+		if m.Code == 1 {
+			return ErrReassemblyTimeExceeded
+		}
+		return ErrTTLExceeded
+	case TypeParameterProblem:
+		return ErrParameterProblem
+	}
+	return nil
+}
+
+// MTU returns the MTU reported by a "fragmentation needed" or "packet too big" message, or zero for other messages.
+func (m *Message) MTU() int {
+	switch body := m.Body.(type) {
+	case *PacketTooBig:
+		return int(body.MTU)
+	case *DestinationUnreachable:
+		if !m.V6 && m.Code == 4 {
+			return int(body.NextHopMTU)
+		}
+	}
+	return 0
+}
+
+// Invoking is a summary of the packet that caused an error message, extracted from the copy of it included in the
+// message. It is usually used to match an error to the probe that triggered it.
+type Invoking struct {
+	Src      net.IP
+	Dst      net.IP
+	Protocol int
+	TTL      int    // The remaining TTL or hop limit when the packet was discarded, usually 0 or 1.
+	ID       uint16 // IPv4 identification, zero for IPv6.
+	Payload  []byte // The start of the transport header, typically at least 8 bytes: ports or ICMP ID and sequence.
+}
+
+// ParseInvoking decodes the IP header of the packet included in an error message. The IP version is taken from the
+// packet itself, as an ICMPv4 message could in principle carry any packet. IPv6 extension headers are skipped over.
+func ParseInvoking(b []byte) (*Invoking, error) {
+	if len(b) < 1 {
+		return nil, errors.New("empty invoking packet")
+	}
+
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < 20 {
+			return nil, fmt.Errorf("invoking ipv4 header too short: %d bytes", len(b))
+		}
+		ihl := int(b[0]&0x0f) * 4
+		if ihl < 20 || ihl > len(b) {
+			return nil, fmt.Errorf("invalid invoking ipv4 header length %d", ihl)
+		}
+		return &Invoking{
+			Src:      net.IP(b[12:16]),
+			Dst:      net.IP(b[16:20]),
+			Protocol: int(b[9]),
+			TTL:      int(b[8]),
+			ID:       binary.BigEndian.Uint16(b[4:]),
+			Payload:  b[ihl:],
+		}, nil
+
+	case 6:
+		if len(b) < 40 {
+			return nil, fmt.Errorf("invoking ipv6 header too short: %d bytes", len(b))
+		}
+		inv := &Invoking{
+			Src: net.IP(b[8:24]),
+			Dst: net.IP(b[24:40]),
+			TTL: int(b[7]),
+		}
+
+		// Walk any extension headers to find the upper-layer protocol.
+		next, rest := int(b[6]), b[40:]
+		for {
+			switch next {
+			case 0, 43, 60: // Hop-by-hop, routing, destination options.
+				if len(rest) < 8 {
+					return nil, errors.New("invoking ipv6 extension header truncated")
+				}
+				extLen := (int(rest[1]) + 1) * 8
+				if extLen > len(rest) {
+					return nil, errors.New("invoking ipv6 extension header truncated")
+				}
+				next, rest = int(rest[0]), rest[extLen:]
+				continue
+			case 44: // Fragment.
+				if len(rest) < 8 {
+					return nil, errors.New("invoking ipv6 fragment header truncated")
+				}
+				next, rest = int(rest[0]), rest[8:]
+				continue
+			}
+			break
+		}
+		inv.Protocol = next
+		inv.Payload = rest
+		return inv, nil
+	}
+
+	return nil, fmt.Errorf("unknown invoking ip version %d", b[0]>>4)
+}
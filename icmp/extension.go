@@ -0,0 +1,183 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/checksum"
+	"github.com/dotwaffle/inettools/packet"
+)
+
+// Extension object classes defined for ICMP multi-part messages.
+const (
+	ClassMPLSLabelStack       = 1 // RFC 4950
+	ClassInterfaceInformation = 2 // RFC 5837
+)
+
+// extensionVersion is the version of the extension structure defined by RFC 4884.
+const extensionVersion = 2
+
+// minOriginalLen is the minimum length of the original datagram field in a message carrying extensions.
+const minOriginalLen = 128
+
+// Extension is an object from the extension structure of an RFC 4884 multi-part message.
+type Extension struct {
+	Class uint8
+	CType uint8
+	Data  []byte
+}
+
+// MPLSLabel is a single entry from an MPLS label stack.
+type MPLSLabel = packet.MPLSLabel
+
+// MPLSLabels decodes an MPLS label stack extension object, as included by routers in errors generated for packets
+// they received with labels attached.
+func (e *Extension) MPLSLabels() ([]MPLSLabel, error) {
+	if e.Class != ClassMPLSLabelStack || e.CType != 1 {
+		return nil, fmt.Errorf("not an mpls label stack: class %d, c-type %d", e.Class, e.CType)
+	}
+	if len(e.Data)%packet.MPLSLabelLen != 0 {
+		return nil, fmt.Errorf("mpls label stack length %d not a multiple of 4", len(e.Data))
+	}
+
+	labels := make([]MPLSLabel, 0, len(e.Data)/packet.MPLSLabelLen)
+	for b := e.Data; len(b) >= packet.MPLSLabelLen; b = b[packet.MPLSLabelLen:] {
+		labels = append(labels, packet.ParseMPLSLabel(binary.BigEndian.Uint32(b)))
+	}
+	return labels, nil
+}
+
+// NewMPLSLabelStack builds an MPLS label stack extension object from the supplied labels, outermost first. The labels
+// are encoded as they are, as the stack quoted may be incomplete.
+func NewMPLSLabelStack(labels []MPLSLabel) Extension {
+	data := make([]byte, 0, len(labels)*packet.MPLSLabelLen)
+	for _, label := range labels {
+		entry := label.Entry()
+		data = append(data, byte(entry>>24), byte(entry>>16), byte(entry>>8), byte(entry))
+	}
+	return Extension{
+		Class: ClassMPLSLabelStack,
+		CType: 1,
+		Data:  data,
+	}
+}
+
+// marshalError appends the body of an error message: the remainder of the header, the original datagram, and any
+// extensions. The length of the original datagram is inserted into the remainder of the header if there are
+// extensions, as required by RFC 4884.
+func marshalError(b []byte, v6 bool, rest uint32, original []byte, extensions []Extension) ([]byte, error) {
+	if len(extensions) == 0 {
+		b = append(b, byte(rest>>24), byte(rest>>16), byte(rest>>8), byte(rest))
+		return append(b, original...), nil
+	}
+
+	// The original datagram must be padded to a whole number of words, and to at least 128 octets.
+	unit := 4
+	if v6 {
+		unit = 8
+	}
+	padded := len(original)
+	if padded < minOriginalLen {
+		padded = minOriginalLen
+	}
+	if padded%unit != 0 {
+		padded += unit - padded%unit
+	}
+	words := padded / unit
+	if words > 0xff {
+		return nil, fmt.Errorf("original datagram too long for extensions: %d bytes", len(original))
+	}
+	if v6 {
+		rest = rest&0x00ffffff | uint32(words)<<24
+	} else {
+		rest = rest&0xff00ffff | uint32(words)<<16
+	}
+	b = append(b, byte(rest>>24), byte(rest>>16), byte(rest>>8), byte(rest))
+	b = append(b, original...)
+	b = append(b, make([]byte, padded-len(original))...)
+
+	// Then the extension header, followed by each of the objects.
+	start := len(b)
+	b = append(b, extensionVersion<<4, 0, 0, 0)
+	for _, ext := range extensions {
+		objLen := 4 + len(ext.Data)
+		if objLen > 0xffff {
+			return nil, fmt.Errorf("extension object too long: %d bytes", len(ext.Data))
+		}
+		b = append(b, byte(objLen>>8), byte(objLen), ext.Class, ext.CType)
+		b = append(b, ext.Data...)
+	}
+	binary.BigEndian.PutUint16(b[start+2:], checksum.Checksum(b[start:], 0))
+
+	return b, nil
+}
+
+// parseError splits the body of an error message into the original datagram and any extensions. The body starts with
+// the four octets following the checksum, which hold the length of the original datagram if there are extensions.
+func parseError(rest []byte, v6 bool) ([]byte, []Extension, error) {
+	data := rest[4:]
+
+	unit, words := 4, int(rest[1])
+	if v6 {
+		unit, words = 8, int(rest[0])
+	}
+
+	// A compliant sender tells us where the original datagram ends.
+	if words > 0 {
+		originalLen := words * unit
+		if originalLen > len(data) {
+			return nil, nil, fmt.Errorf("original datagram length %d exceeds message", originalLen)
+		}
+		extensions, err := parseExtensions(data[originalLen:])
+		if err != nil {
+			return nil, nil, err
+		}
+		return data[:originalLen], extensions, nil
+	}
+
+	// Many routers predate RFC 4884, and instead always place extensions after a 128 octet original datagram without
+	// setting the length. If something that looks like a valid extension structure is there, assume it is one.
+	if len(data) > minOriginalLen {
+		if extensions, err := parseExtensions(data[minOriginalLen:]); err == nil && len(extensions) > 0 {
+			return data[:minOriginalLen], extensions, nil
+		}
+	}
+
+	return data, nil, nil
+}
+
+// parseExtensions decodes an extension structure, checking its version and checksum.
+func parseExtensions(b []byte) ([]Extension, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("extension structure too short: %d bytes", len(b))
+	}
+	if b[0]>>4 != extensionVersion {
+		return nil, fmt.Errorf("unknown extension version %d", b[0]>>4)
+	}
+	// A zero checksum means the sender did not compute one, which some implementations do.
+	if binary.BigEndian.Uint16(b[2:]) != 0 && checksum.Checksum(b, 0) != 0 {
+		return nil, errors.New("bad extension checksum")
+	}
+
+	var extensions []Extension
+	for objs := b[4:]; len(objs) > 0; {
+		if len(objs) < 4 {
+			return nil, fmt.Errorf("extension object header too short: %d bytes", len(objs))
+		}
+		objLen := int(binary.BigEndian.Uint16(objs))
+		if objLen < 4 || objLen > len(objs) {
+			return nil, fmt.Errorf("invalid extension object length %d", objLen)
+		}
+		extensions = append(extensions, Extension{
+			Class: objs[2],
+			CType: objs[3],
+			Data:  objs[4:objLen],
+		})
+		objs = objs[objLen:]
+	}
+
+	return extensions, nil
+}
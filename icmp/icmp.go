@@ -0,0 +1,269 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/checksum"
+	"net"
+)
+
+// Protocol numbers of ICMP and ICMPv6, as used in the IP header and when opening raw sockets.
+const (
+	ProtocolICMP   = 1
+	ProtocolICMPv6 = 58
+)
+
+// ICMPv4 message types.
+const (
+	TypeEchoReply              = 0
+	TypeDestinationUnreachable = 3
+	TypeEcho                   = 8
+	TypeTimeExceeded           = 11
+	TypeParameterProblem       = 12
+)
+
+// ICMPv6 message types.
+const (
+	TypeV6DestinationUnreachable = 1
+	TypeV6PacketTooBig           = 2
+	TypeV6TimeExceeded           = 3
+	TypeV6ParameterProblem       = 4
+	TypeV6Echo                   = 128
+	TypeV6EchoReply              = 129
+)
+
+// headerLen is the length of the fixed ICMP header: type, code, and checksum.
+const headerLen = 4
+
+// Message is an ICMP or ICMPv6 message.
+type Message struct {
+	V6       bool // Set for ICMPv6, whose type numbers and checksum differ from ICMPv4.
+	Type     uint8
+	Code     uint8
+	Checksum uint16 // Set by Parse, ignored by Marshal which computes it afresh.
+	Body     Body
+}
+
+// Body is the type-specific portion of a message, following the type, code and checksum.
+type Body interface {
+	// marshal appends the body to b, using v6 to select the family-specific layout where one is needed.
+	marshal(b []byte, v6 bool) ([]byte, error)
+}
+
+// Echo is the body of an echo request or reply.
+type Echo struct {
+	ID   uint16
+	Seq  uint16
+	Data []byte
+}
+
+func (e *Echo) marshal(b []byte, v6 bool) ([]byte, error) {
+	b = append(b, byte(e.ID>>8), byte(e.ID), byte(e.Seq>>8), byte(e.Seq))
+	return append(b, e.Data...), nil
+}
+
+// DestinationUnreachable is the body of a destination unreachable message. NextHopMTU is only meaningful for ICMPv4
+// "fragmentation needed" messages; ICMPv6 uses a separate PacketTooBig message instead.
+type DestinationUnreachable struct {
+	NextHopMTU uint16
+	Original   []byte // As much of the packet that caused the error as was included, starting at the IP header.
+	Extensions []Extension
+}
+
+func (d *DestinationUnreachable) marshal(b []byte, v6 bool) ([]byte, error) {
+	rest := uint32(0)
+	if !v6 {
+		rest = uint32(d.NextHopMTU)
+	}
+	return marshalError(b, v6, rest, d.Original, d.Extensions)
+}
+
+// TimeExceeded is the body of a time exceeded message, as sent by routers when the TTL or hop limit reaches zero.
+type TimeExceeded struct {
+	Original   []byte
+	Extensions []Extension
+}
+
+func (t *TimeExceeded) marshal(b []byte, v6 bool) ([]byte, error) {
+	return marshalError(b, v6, 0, t.Original, t.Extensions)
+}
+
+// ParameterProblem is the body of a parameter problem message. Pointer identifies the offending octet of the
+// original packet; ICMPv4 only has room for an 8-bit pointer.
+type ParameterProblem struct {
+	Pointer    uint32
+	Original   []byte
+	Extensions []Extension
+}
+
+func (p *ParameterProblem) marshal(b []byte, v6 bool) ([]byte, error) {
+	rest := p.Pointer
+	if v6 && len(p.Extensions) > 0 {
+		return nil, errors.New("icmpv6 parameter problem cannot carry extensions")
+	}
+	if !v6 {
+		if p.Pointer > 0xff {
+			return nil, fmt.Errorf("pointer %d too large for icmpv4", p.Pointer)
+		}
+		rest = p.Pointer << 24
+	}
+	return marshalError(b, v6, rest, p.Original, p.Extensions)
+}
+
+// PacketTooBig is the body of an ICMPv6 packet too big message.
+type PacketTooBig struct {
+	MTU      uint32
+	Original []byte
+}
+
+func (p *PacketTooBig) marshal(b []byte, v6 bool) ([]byte, error) {
+	if !v6 {
+		return nil, errors.New("packet too big is icmpv6 only")
+	}
+	b = append(b, byte(p.MTU>>24), byte(p.MTU>>16), byte(p.MTU>>8), byte(p.MTU))
+	return append(b, p.Original...), nil
+}
+
+// Raw is the body of a message of a type this package does not otherwise understand.
+type Raw struct {
+	Data []byte
+}
+
+func (r *Raw) marshal(b []byte, v6 bool) ([]byte, error) {
+	return append(b, r.Data...), nil
+}
+
+// Marshal encodes the message. ICMPv4 checksums are always computed. ICMPv6 checksums cover a pseudo-header, so they
+// are only computed if the source and destination addresses are supplied; otherwise the checksum is left as zero,
+// which suits raw sockets as the kernel always fills in the ICMPv6 checksum itself.
+func (m *Message) Marshal(src, dst net.IP) ([]byte, error) {
+	if m.Body == nil {
+		return nil, errors.New("nil body")
+	}
+
+	b := []byte{m.Type, m.Code, 0, 0}
+	b, err := m.Body.marshal(b, m.V6)
+	if err != nil {
+		return nil, err
+	}
+
+	var sum uint32
+	if m.V6 {
+		if src == nil || dst == nil {
+			return b, nil
+		}
+		src16, dst16 := src.To16(), dst.To16()
+		if src16 == nil || dst16 == nil {
+			return nil, errors.New("invalid pseudo-header address")
+		}
+		// The pseudo-header is the source, destination, upper-layer length, and next header.
+		sum = checksum.PseudoHeader(ProtocolICMPv6, src16, dst16, len(b))
+	}
+	csum := checksum.Checksum(b, sum)
+	binary.BigEndian.PutUint16(b[2:], csum)
+
+	return b, nil
+}
+
+// Parse decodes an ICMP message, starting at the ICMP header. The body is one of the types from this package, with
+// Raw used for types it does not understand. Slices in the body refer to the supplied buffer rather than copying it.
+func Parse(b []byte, v6 bool) (*Message, error) {
+	if len(b) < headerLen+4 {
+		return nil, fmt.Errorf("message too short: %d bytes", len(b))
+	}
+
+	m := &Message{
+		V6:       v6,
+		Type:     b[0],
+		Code:     b[1],
+		Checksum: binary.BigEndian.Uint16(b[2:]),
+	}
+	rest := b[headerLen:]
+
+	switch {
+	case !v6 && (m.Type == TypeEcho || m.Type == TypeEchoReply),
+		v6 && (m.Type == TypeV6Echo || m.Type == TypeV6EchoReply):
+		m.Body = &Echo{
+			ID:   binary.BigEndian.Uint16(rest),
+			Seq:  binary.BigEndian.Uint16(rest[2:]),
+			Data: rest[4:],
+		}
+
+	case !v6 && m.Type == TypeDestinationUnreachable, v6 && m.Type == TypeV6DestinationUnreachable:
+		original, extensions, err := parseError(rest, v6)
+		if err != nil {
+			return nil, err
+		}
+		body := &DestinationUnreachable{Original: original, Extensions: extensions}
+		if !v6 {
+			body.NextHopMTU = binary.BigEndian.Uint16(rest[2:])
+		}
+		m.Body = body
+
+	case !v6 && m.Type == TypeTimeExceeded, v6 && m.Type == TypeV6TimeExceeded:
+		original, extensions, err := parseError(rest, v6)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = &TimeExceeded{Original: original, Extensions: extensions}
+
+	case !v6 && m.Type == TypeParameterProblem:
+		original, extensions, err := parseError(rest, v6)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = &ParameterProblem{
+			Pointer:    uint32(rest[0]),
+			Original:   original,
+			Extensions: extensions,
+		}
+
+	case v6 && m.Type == TypeV6ParameterProblem:
+		// The ICMPv6 pointer fills the remainder of the header, leaving no room for an extension length.
+		m.Body = &ParameterProblem{
+			Pointer:  binary.BigEndian.Uint32(rest),
+			Original: rest[4:],
+		}
+
+	case v6 && (m.Type == TypeV6NeighborSolicitation || m.Type == TypeV6NeighborAdvertisement):
+		body, err := parseNeighbor(m.Type, rest)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = body
+
+	case v6 && (m.Type == TypeV6RouterSolicitation || m.Type == TypeV6RouterAdvertisement):
+		body, err := parseRouter(m.Type, rest)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = body
+
+	case v6 && m.Type == TypeV6PacketTooBig:
+		m.Body = &PacketTooBig{
+			MTU:      binary.BigEndian.Uint32(rest),
+			Original: rest[4:],
+		}
+
+	default:
+		m.Body = &Raw{Data: rest}
+	}
+
+	return m, nil
+}
+
+// Original returns the invoking packet included in an error message, or nil if the message is not an error.
+func (m *Message) Original() []byte {
+	switch body := m.Body.(type) {
+	case *DestinationUnreachable:
+		return body.Original
+	case *TimeExceeded:
+		return body.Original
+	case *ParameterProblem:
+		return body.Original
+	case *PacketTooBig:
+		return body.Original
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/dotwaffle/inettools/checksum"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// invokingIPv4 returns a minimal IPv4 header followed by a UDP header, as would be quoted in an error message.
+func invokingIPv4() []byte {
+	b := []byte{
+		0x45, 0x00, 0x00, 0x1c, 0x12, 0x34, 0x00, 0x00, 0x01, 17, 0x00, 0x00,
+		192, 0, 2, 1,
+		198, 51, 100, 1,
+		0x82, 0x9b, 0x82, 0x9c, 0x00, 0x08, 0x00, 0x00,
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	labels := []MPLSLabel{
+		{Label: 16001, TC: 0, TTL: 1},
+		{Label: 24005, TC: 5, BottomOfStack: true, TTL: 1},
+	}
+
+	tests := map[string]struct {
+		msg *Message
+	}{
+		"Echo": {
+			msg: &Message{Type: TypeEcho, Body: &Echo{ID: 0x1234, Seq: 7, Data: []byte("ping")}},
+		},
+		"EchoV6": {
+			msg: &Message{V6: true, Type: TypeV6Echo, Body: &Echo{ID: 0x1234, Seq: 7, Data: []byte("ping")}},
+		},
+		"FragmentationNeeded": {
+			msg: &Message{Type: TypeDestinationUnreachable, Code: 4, Body: &DestinationUnreachable{
+				NextHopMTU: 1400,
+				Original:   invokingIPv4(),
+			}},
+		},
+		"TimeExceededMPLS": {
+			msg: &Message{Type: TypeTimeExceeded, Body: &TimeExceeded{
+				Original:   invokingIPv4(),
+				Extensions: []Extension{NewMPLSLabelStack(labels)},
+			}},
+		},
+		"TimeExceededV6MPLS": {
+			msg: &Message{V6: true, Type: TypeV6TimeExceeded, Body: &TimeExceeded{
+				Original:   make([]byte, 48),
+				Extensions: []Extension{NewMPLSLabelStack(labels)},
+			}},
+		},
+		"PacketTooBig": {
+			msg: &Message{V6: true, Type: TypeV6PacketTooBig, Body: &PacketTooBig{MTU: 1280, Original: []byte{0x60}}},
+		},
+		"NeighborSolicitation": {
+			msg: &Message{V6: true, Type: TypeV6NeighborSolicitation, Body: &NeighborSolicitation{
+				Target:  net.ParseIP("fe80::1"),
+				Options: []NDPOption{LinkLayerOption(NDPOptionSourceLinkLayer, net.HardwareAddr{2, 0, 0, 0, 0, 1})},
+			}},
+		},
+		"NeighborAdvertisement": {
+			msg: &Message{V6: true, Type: TypeV6NeighborAdvertisement, Body: &NeighborAdvertisement{
+				Solicited: true,
+				Override:  true,
+				Target:    net.ParseIP("2001:db8::1"),
+				Options:   []NDPOption{LinkLayerOption(NDPOptionTargetLinkLayer, net.HardwareAddr{2, 0, 0, 0, 0, 2})},
+			}},
+		},
+		"RouterSolicitation": {
+			msg: &Message{V6: true, Type: TypeV6RouterSolicitation, Body: &RouterSolicitation{
+				Options: []NDPOption{LinkLayerOption(NDPOptionSourceLinkLayer, net.HardwareAddr{2, 0, 0, 0, 0, 1})},
+			}},
+		},
+		"RouterAdvertisement": {
+			msg: &Message{V6: true, Type: TypeV6RouterAdvertisement, Body: &RouterAdvertisement{
+				CurHopLimit:    64,
+				Other:          true,
+				Preference:     PreferenceHigh,
+				RouterLifetime: 1800 * time.Second,
+				ReachableTime:  30 * time.Second,
+				RetransTimer:   time.Second,
+				Options: []NDPOption{
+					LinkLayerOption(NDPOptionSourceLinkLayer, net.HardwareAddr{2, 0, 0, 0, 0, 1}),
+					RDNSSOption([]net.IP{net.ParseIP("2001:db8::53")}, time.Hour),
+				},
+			}},
+		},
+		"ParameterProblem": {
+			msg: &Message{Type: TypeParameterProblem, Body: &ParameterProblem{Pointer: 9,
+				Original: invokingIPv4()}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := tc.msg.Marshal(nil, nil)
+			if err != nil {
+				t.Fatalf("marshal err: %v", err)
+			}
+			if !tc.msg.V6 && checksum.Checksum(b, 0) != 0 {
+				t.Fatalf("bad checksum on %x", b)
+			}
+
+			got, err := Parse(b, tc.msg.V6)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+
+			// Padding added to the original datagram for extensions is not expected to survive.
+			want := tc.msg
+			if te, ok := want.Body.(*TimeExceeded); ok && len(te.Extensions) > 0 {
+				gotTE := got.Body.(*TimeExceeded)
+				if len(gotTE.Original) != 128 {
+					t.Fatalf("original datagram not padded to 128: %d", len(gotTE.Original))
+				}
+				gotTE.Original = gotTE.Original[:len(te.Original)]
+				gotLabels, err := gotTE.Extensions[0].MPLSLabels()
+				if err != nil {
+					t.Fatalf("labels err: %v", err)
+				}
+				if diff := cmp.Diff(labels, gotLabels); diff != "" {
+					t.Fatalf("%v", diff)
+				}
+			}
+			got.Checksum = 0
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestChecksumV6(t *testing.T) {
+	src, dst := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	msg := &Message{V6: true, Type: TypeV6Echo, Body: &Echo{ID: 1, Seq: 2, Data: []byte("abc")}}
+	b, err := msg.Marshal(src, dst)
+	if err != nil {
+		t.Fatalf("marshal err: %v", err)
+	}
+
+	// Summing the message along with the pseudo-header, including the checksum, should result in zero.
+	pseudo := append(append(append([]byte{}, src...), dst...), 0, 0, 0, byte(len(b)), 0, 0, 0, ProtocolICMPv6)
+	if csum := checksum.Checksum(b, checksum.Sum(pseudo, 0)); csum != 0 {
+		t.Fatalf("checksum does not verify: %04x", csum)
+	}
+}
+
+func TestLegacyExtensions(t *testing.T) {
+	// A router predating RFC 4884 pads the original datagram to 128 octets without setting the length field.
+	b := []byte{TypeTimeExceeded, 0, 0, 0, 0, 0, 0, 0}
+	original := make([]byte, 128)
+	copy(original, invokingIPv4())
+	b = append(b, original...)
+	ext := []byte{0x20, 0, 0, 0, 0, 8, ClassMPLSLabelStack, 1}
+	label := NewMPLSLabelStack([]MPLSLabel{{Label: 299792, BottomOfStack: true, TTL: 1}}).Data
+	ext = append(ext, label...)
+	binary.BigEndian.PutUint16(ext[2:], checksum.Checksum(ext, 0))
+	b = append(b, ext...)
+
+	msg, err := Parse(b, false)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	te := msg.Body.(*TimeExceeded)
+	if len(te.Original) != 128 || len(te.Extensions) != 1 {
+		t.Fatalf("got %d byte original and %d extensions, want 128 and 1", len(te.Original), len(te.Extensions))
+	}
+	labels, err := te.Extensions[0].MPLSLabels()
+	if err != nil || len(labels) != 1 || labels[0].Label != 299792 {
+		t.Fatalf("got labels %+v, err %v", labels, err)
+	}
+}
+
+func TestErr(t *testing.T) {
+	tests := map[string]struct {
+		msg  *Message
+		want error
+	}{
+		"EchoReply":     {&Message{Type: TypeEchoReply}, nil},
+		"PortV4":        {&Message{Type: TypeDestinationUnreachable, Code: 3}, ErrPortUnreachable},
+		"PortV6":        {&Message{V6: true, Type: TypeV6DestinationUnreachable, Code: 4}, ErrPortUnreachable},
+		"ProhibitedV4":  {&Message{Type: TypeDestinationUnreachable, Code: 13}, ErrAdministrativelyBlocked},
+		"TTLV4":         {&Message{Type: TypeTimeExceeded}, ErrTTLExceeded},
+		"ReassemblyV6":  {&Message{V6: true, Type: TypeV6TimeExceeded, Code: 1}, ErrReassemblyTimeExceeded},
+		"PacketTooBig6": {&Message{V6: true, Type: TypeV6PacketTooBig}, ErrPacketTooBig},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.msg.Err()
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseInvoking(t *testing.T) {
+	inv, err := ParseInvoking(invokingIPv4())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !inv.Src.Equal(net.ParseIP("192.0.2.1")) || !inv.Dst.Equal(net.ParseIP("198.51.100.1")) ||
+		inv.Protocol != 17 || inv.TTL != 1 || inv.ID != 0x1234 {
+		t.Fatalf("unexpected invoking packet: %+v", inv)
+	}
+	if dport := binary.BigEndian.Uint16(inv.Payload[2:]); dport != 33436 {
+		t.Fatalf("destination port: got %d, want 33436", dport)
+	}
+
+	// An IPv6 packet with a hop-by-hop options header before the UDP header.
+	b := make([]byte, 40+8+8)
+	b[0] = 0x60
+	b[6] = 0 // Hop-by-hop.
+	b[7] = 1
+	copy(b[8:], net.ParseIP("2001:db8::1"))
+	copy(b[24:], net.ParseIP("2001:db8::2"))
+	b[40] = 17 // Next header after hop-by-hop is UDP.
+	inv, err = ParseInvoking(b)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if inv.Protocol != 17 || len(inv.Payload) != 8 || !inv.Dst.Equal(net.ParseIP("2001:db8::2")) {
+		t.Fatalf("unexpected invoking packet: %+v", inv)
+	}
+}
+
+func TestRouterAdvertisement(t *testing.T) {
+	_, pfx, _ := net.ParseCIDR("2001:db8:1::/64")
+	ra := &RouterAdvertisement{Options: []NDPOption{
+		{Type: NDPOptionMTU, Data: []byte{0, 0, 0, 0, 0x05, 0xdc}},
+		(&PrefixInfo{Prefix: pfx, OnLink: true, Autonomous: true, ValidLifetime: Infinity,
+			PreferredLifetime: time.Hour}).Option(),
+		// A /48 route with high preference needs only the first 8 octets of the prefix.
+		{Type: NDPOptionRouteInfo, Data: []byte{48, 0x08, 0, 0, 0x0e, 0x10, 0x20, 0x01, 0x0d, 0xb8, 0, 2, 0, 0}},
+		RDNSSOption([]net.IP{net.ParseIP("2001:db8::53"), net.ParseIP("2001:db8::54")}, 10*time.Minute),
+		{Type: NDPOptionDNSSL, Data: append([]byte{0, 0, 0, 0, 0x02, 0x58},
+			"\x07example\x03com\x00\x03lab\x07example\x03net\x00\x00\x00\x00\x00\x00\x00\x00"...)},
+	}}
+
+	b, err := (&Message{V6: true, Type: TypeV6RouterAdvertisement, Body: ra}).Marshal(nil, nil)
+	if err != nil {
+		t.Fatalf("marshal err: %v", err)
+	}
+	m, err := Parse(b, true)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	got := m.Body.(*RouterAdvertisement)
+	if got.MTU() != 1500 {
+		t.Errorf("got mtu %d, want 1500", got.MTU())
+	}
+	if diff := cmp.Diff([]PrefixInfo{{Prefix: pfx, OnLink: true, Autonomous: true, ValidLifetime: Infinity,
+		PreferredLifetime: time.Hour}}, got.Prefixes()); diff != "" {
+		t.Errorf("%v", diff)
+	}
+	_, route, _ := net.ParseCIDR("2001:db8:2::/48")
+	if diff := cmp.Diff([]RouteInfo{{Prefix: route, Preference: PreferenceHigh, Lifetime: time.Hour}},
+		got.Routes()); diff != "" {
+		t.Errorf("%v", diff)
+	}
+	wantDNS := []DNSInfo{{Servers: []net.IP{net.ParseIP("2001:db8::53"), net.ParseIP("2001:db8::54")},
+		Lifetime: 10 * time.Minute}}
+	if diff := cmp.Diff(wantDNS, got.RDNSS()); diff != "" {
+		t.Errorf("%v", diff)
+	}
+	wantSearch := []DNSInfo{{Domains: []string{"example.com.", "lab.example.net."}, Lifetime: 10 * time.Minute}}
+	if diff := cmp.Diff(wantSearch, got.DNSSL()); diff != "" {
+		t.Errorf("%v", diff)
+	}
+}
@@ -0,0 +1,174 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ICMPv6 neighbor discovery message types, from RFC 4861.
+const (
+	TypeV6RouterSolicitation    = 133
+	TypeV6RouterAdvertisement   = 134
+	TypeV6NeighborSolicitation  = 135
+	TypeV6NeighborAdvertisement = 136
+)
+
+// Neighbor discovery option types.
+const (
+	NDPOptionSourceLinkLayer = 1
+	NDPOptionTargetLinkLayer = 2
+	NDPOptionPrefixInfo      = 3
+	NDPOptionRedirected      = 4
+	NDPOptionMTU             = 5
+)
+
+// NDPOption is an option carried by a neighbor discovery message. Data excludes the type and length octets, and
+// includes any padding up to the 8-octet boundary options are aligned to.
+type NDPOption struct {
+	Type uint8
+	Data []byte
+}
+
+// LinkLayerOption returns a source or target link-layer address option.
+func LinkLayerOption(typ uint8, addr net.HardwareAddr) NDPOption {
+	return NDPOption{Type: typ, Data: append([]byte(nil), addr...)}
+}
+
+// LinkLayerAddr returns the address carried by a link-layer address option, assuming a 6-octet Ethernet address as
+// the option does not say how long the address is.
+func (o *NDPOption) LinkLayerAddr() net.HardwareAddr {
+	if (o.Type != NDPOptionSourceLinkLayer && o.Type != NDPOptionTargetLinkLayer) || len(o.Data) < 6 {
+		return nil
+	}
+	return net.HardwareAddr(o.Data[:6])
+}
+
+// findLinkLayerAddr returns the address from the first option of the given type, or nil if there is none.
+func findLinkLayerAddr(opts []NDPOption, typ uint8) net.HardwareAddr {
+	for i := range opts {
+		if opts[i].Type == typ {
+			return opts[i].LinkLayerAddr()
+		}
+	}
+	return nil
+}
+
+// NeighborSolicitation is the body of a neighbor solicitation, which asks the owner of Target for its link-layer
+// address, or checks that nobody owns it during duplicate address detection.
+type NeighborSolicitation struct {
+	Target  net.IP
+	Options []NDPOption
+}
+
+// SourceLinkLayerAddr returns the link-layer address of the sender, or nil if it was not included.
+func (n *NeighborSolicitation) SourceLinkLayerAddr() net.HardwareAddr {
+	return findLinkLayerAddr(n.Options, NDPOptionSourceLinkLayer)
+}
+
+func (n *NeighborSolicitation) marshal(b []byte, v6 bool) ([]byte, error) {
+	if !v6 {
+		return nil, errors.New("neighbor solicitation is icmpv6 only")
+	}
+	target := n.Target.To16()
+	if target == nil {
+		return nil, fmt.Errorf("invalid target %v", n.Target)
+	}
+	b = append(b, 0, 0, 0, 0)
+	b = append(b, target...)
+	return marshalNDPOptions(b, n.Options)
+}
+
+// NeighborAdvertisement is the body of a neighbor advertisement, sent in answer to a solicitation or unprompted when a
+// link-layer address changes.
+type NeighborAdvertisement struct {
+	Router    bool // The sender is a router.
+	Solicited bool // Sent in response to a solicitation.
+	Override  bool // The advertisement should replace an existing cache entry.
+	Target    net.IP
+	Options   []NDPOption
+}
+
+// TargetLinkLayerAddr returns the link-layer address of the target, or nil if it was not included.
+func (n *NeighborAdvertisement) TargetLinkLayerAddr() net.HardwareAddr {
+	return findLinkLayerAddr(n.Options, NDPOptionTargetLinkLayer)
+}
+
+func (n *NeighborAdvertisement) marshal(b []byte, v6 bool) ([]byte, error) {
+	if !v6 {
+		return nil, errors.New("neighbor advertisement is icmpv6 only")
+	}
+	target := n.Target.To16()
+	if target == nil {
+		return nil, fmt.Errorf("invalid target %v", n.Target)
+	}
+	var flags uint8
+	if n.Router {
+		flags |= 0x80
+	}
+	if n.Solicited {
+		flags |= 0x40
+	}
+	if n.Override {
+		flags |= 0x20
+	}
+	b = append(b, flags, 0, 0, 0)
+	b = append(b, target...)
+	return marshalNDPOptions(b, n.Options)
+}
+
+// marshalNDPOptions appends options to b, padding each to a multiple of 8 octets.
+func marshalNDPOptions(b []byte, opts []NDPOption) ([]byte, error) {
+	for _, o := range opts {
+		l := (2 + len(o.Data) + 7) / 8
+		if l > 0xff {
+			return nil, fmt.Errorf("option %d too long: %d bytes", o.Type, len(o.Data))
+		}
+		b = append(b, o.Type, uint8(l))
+		b = append(b, o.Data...)
+		b = append(b, make([]byte, 8*l-2-len(o.Data))...)
+	}
+	return b, nil
+}
+
+// parseNDPOptions decodes the options following a neighbor discovery message. Options with a length of zero are
+// invalid, and RFC 4861 requires the whole message to be discarded.
+func parseNDPOptions(b []byte) ([]NDPOption, error) {
+	var opts []NDPOption
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, fmt.Errorf("truncated option: %d bytes", len(b))
+		}
+		l := 8 * int(b[1])
+		if l == 0 || l > len(b) {
+			return nil, fmt.Errorf("invalid option length %d", l)
+		}
+		opts = append(opts, NDPOption{Type: b[0], Data: b[2:l]})
+		b = b[l:]
+	}
+	return opts, nil
+}
+
+// parseNeighbor decodes the body of a neighbor solicitation or advertisement.
+func parseNeighbor(typ uint8, rest []byte) (Body, error) {
+	if len(rest) < 4+net.IPv6len {
+		return nil, fmt.Errorf("neighbor discovery message too short: %d bytes", len(rest))
+	}
+	target := net.IP(rest[4 : 4+net.IPv6len])
+	opts, err := parseNDPOptions(rest[4+net.IPv6len:])
+	if err != nil {
+		return nil, err
+	}
+	if typ == TypeV6NeighborSolicitation {
+		return &NeighborSolicitation{Target: target, Options: opts}, nil
+	}
+	flags := binary.BigEndian.Uint32(rest)
+	return &NeighborAdvertisement{
+		Router:    flags&(1<<31) != 0,
+		Solicited: flags&(1<<30) != 0,
+		Override:  flags&(1<<29) != 0,
+		Target:    target,
+		Options:   opts,
+	}, nil
+}
@@ -0,0 +1,287 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Router discovery option types, from RFC 4191 and RFC 8106.
+const (
+	NDPOptionRouteInfo = 24
+	NDPOptionRDNSS     = 25
+	NDPOptionDNSSL     = 31
+)
+
+// Infinity is the lifetime of prefixes and routes that do not expire, sent as all ones.
+const Infinity = time.Duration(0xffffffff) * time.Second
+
+// Preference is the preference of a default router or route, from RFC 4191.
+type Preference int8
+
+// Router preferences. The reserved value 2 is treated as medium.
+const (
+	PreferenceLow    Preference = -1
+	PreferenceMedium Preference = 0
+	PreferenceHigh   Preference = 1
+)
+
+// String returns low, medium, or high.
+func (p Preference) String() string {
+	switch p {
+	case PreferenceLow:
+		return "low"
+	case PreferenceHigh:
+		return "high"
+	}
+	return "medium"
+}
+
+// preference decodes the two bit preference at the given shift of b.
+func preference(b byte, shift uint) Preference {
+	switch (b >> shift) & 0x3 {
+	case 1:
+		return PreferenceHigh
+	case 3:
+		return PreferenceLow
+	}
+	return PreferenceMedium
+}
+
+// bits encodes the preference as the two bit value.
+func (p Preference) bits() byte {
+	switch p {
+	case PreferenceHigh:
+		return 1
+	case PreferenceLow:
+		return 3
+	}
+	return 0
+}
+
+// RouterSolicitation is the body of a router solicitation, which asks routers to advertise themselves now.
+type RouterSolicitation struct {
+	Options []NDPOption
+}
+
+func (r *RouterSolicitation) marshal(b []byte, v6 bool) ([]byte, error) {
+	if !v6 {
+		return nil, errors.New("router solicitation is icmpv6 only")
+	}
+	return marshalNDPOptions(append(b, 0, 0, 0, 0), r.Options)
+}
+
+// RouterAdvertisement is the body of a router advertisement, which announces a router and the configuration of the
+// link. A RouterLifetime of zero means the router is not a default router.
+type RouterAdvertisement struct {
+	CurHopLimit    uint8 // The hop limit hosts should use, or zero if unspecified.
+	Managed        bool  // Addresses are available from DHCPv6.
+	Other          bool  // Other configuration is available from DHCPv6.
+	Preference     Preference
+	RouterLifetime time.Duration
+	ReachableTime  time.Duration // Zero if unspecified.
+	RetransTimer   time.Duration // Zero if unspecified.
+	Options        []NDPOption
+}
+
+func (r *RouterAdvertisement) marshal(b []byte, v6 bool) ([]byte, error) {
+	if !v6 {
+		return nil, errors.New("router advertisement is icmpv6 only")
+	}
+	flags := r.Preference.bits() << 3
+	if r.Managed {
+		flags |= 0x80
+	}
+	if r.Other {
+		flags |= 0x40
+	}
+	b = append(b, r.CurHopLimit, flags, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-10:], uint16(r.RouterLifetime/time.Second))
+	binary.BigEndian.PutUint32(b[len(b)-8:], uint32(r.ReachableTime/time.Millisecond))
+	binary.BigEndian.PutUint32(b[len(b)-4:], uint32(r.RetransTimer/time.Millisecond))
+	return marshalNDPOptions(b, r.Options)
+}
+
+// parseRouter decodes the body of a router solicitation or advertisement.
+func parseRouter(typ uint8, rest []byte) (Body, error) {
+	if typ == TypeV6RouterSolicitation {
+		opts, err := parseNDPOptions(rest[4:])
+		if err != nil {
+			return nil, err
+		}
+		return &RouterSolicitation{Options: opts}, nil
+	}
+	if len(rest) < 12 {
+		return nil, fmt.Errorf("router advertisement too short: %d bytes", len(rest))
+	}
+	opts, err := parseNDPOptions(rest[12:])
+	if err != nil {
+		return nil, err
+	}
+	return &RouterAdvertisement{
+		CurHopLimit:    rest[0],
+		Managed:        rest[1]&0x80 != 0,
+		Other:          rest[1]&0x40 != 0,
+		Preference:     preference(rest[1], 3),
+		RouterLifetime: time.Duration(binary.BigEndian.Uint16(rest[2:])) * time.Second,
+		ReachableTime:  time.Duration(binary.BigEndian.Uint32(rest[4:])) * time.Millisecond,
+		RetransTimer:   time.Duration(binary.BigEndian.Uint32(rest[8:])) * time.Millisecond,
+		Options:        opts,
+	}, nil
+}
+
+// SourceLinkLayerAddr returns the link-layer address of the router, or nil if it was not included.
+func (r *RouterAdvertisement) SourceLinkLayerAddr() net.HardwareAddr {
+	return findLinkLayerAddr(r.Options, NDPOptionSourceLinkLayer)
+}
+
+// MTU returns the link MTU advertised, or zero if there is none.
+func (r *RouterAdvertisement) MTU() int {
+	for _, o := range r.Options {
+		if o.Type == NDPOptionMTU && len(o.Data) >= 6 {
+			return int(binary.BigEndian.Uint32(o.Data[2:]))
+		}
+	}
+	return 0
+}
+
+// PrefixInfo is a prefix information option, which announces a prefix that is on the link, or that hosts may form
+// addresses in with SLAAC.
+type PrefixInfo struct {
+	Prefix            *net.IPNet
+	OnLink            bool
+	Autonomous        bool // Hosts may form addresses in the prefix.
+	ValidLifetime     time.Duration
+	PreferredLifetime time.Duration
+}
+
+// Option encodes the prefix information as an option.
+func (p *PrefixInfo) Option() NDPOption {
+	data := make([]byte, 30)
+	ones, _ := p.Prefix.Mask.Size()
+	data[0] = uint8(ones)
+	if p.OnLink {
+		data[1] |= 0x80
+	}
+	if p.Autonomous {
+		data[1] |= 0x40
+	}
+	binary.BigEndian.PutUint32(data[2:], seconds(p.ValidLifetime))
+	binary.BigEndian.PutUint32(data[6:], seconds(p.PreferredLifetime))
+	copy(data[14:], p.Prefix.IP.To16())
+	return NDPOption{Type: NDPOptionPrefixInfo, Data: data}
+}
+
+// Prefixes returns the prefix information options.
+func (r *RouterAdvertisement) Prefixes() []PrefixInfo {
+	var pfxs []PrefixInfo
+	for _, o := range r.Options {
+		if o.Type != NDPOptionPrefixInfo || len(o.Data) < 30 || o.Data[0] > 128 {
+			continue
+		}
+		mask := net.CIDRMask(int(o.Data[0]), 128)
+		pfxs = append(pfxs, PrefixInfo{
+			Prefix:            &net.IPNet{IP: net.IP(o.Data[14:30]).Mask(mask), Mask: mask},
+			OnLink:            o.Data[1]&0x80 != 0,
+			Autonomous:        o.Data[1]&0x40 != 0,
+			ValidLifetime:     time.Duration(binary.BigEndian.Uint32(o.Data[2:])) * time.Second,
+			PreferredLifetime: time.Duration(binary.BigEndian.Uint32(o.Data[6:])) * time.Second,
+		})
+	}
+	return pfxs
+}
+
+// RouteInfo is a route information option, which announces a more specific route through the router.
+type RouteInfo struct {
+	Prefix     *net.IPNet
+	Preference Preference
+	Lifetime   time.Duration
+}
+
+// Routes returns the route information options.
+func (r *RouterAdvertisement) Routes() []RouteInfo {
+	var routes []RouteInfo
+	for _, o := range r.Options {
+		if o.Type != NDPOptionRouteInfo || len(o.Data) < 6 || o.Data[0] > 128 {
+			continue
+		}
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, o.Data[6:])
+		mask := net.CIDRMask(int(o.Data[0]), 128)
+		routes = append(routes, RouteInfo{
+			Prefix:     &net.IPNet{IP: ip.Mask(mask), Mask: mask},
+			Preference: preference(o.Data[1], 3),
+			Lifetime:   time.Duration(binary.BigEndian.Uint32(o.Data[2:])) * time.Second,
+		})
+	}
+	return routes
+}
+
+// DNSInfo is a recursive DNS server or DNS search list option.
+type DNSInfo struct {
+	Servers  []net.IP // The recursive DNS servers, from an RDNSS option.
+	Domains  []string // The search domains, from a DNSSL option.
+	Lifetime time.Duration
+}
+
+// RDNSSOption returns a recursive DNS server option.
+func RDNSSOption(servers []net.IP, lifetime time.Duration) NDPOption {
+	data := make([]byte, 6, 6+net.IPv6len*len(servers))
+	binary.BigEndian.PutUint32(data[2:], seconds(lifetime))
+	for _, ip := range servers {
+		data = append(data, ip.To16()...)
+	}
+	return NDPOption{Type: NDPOptionRDNSS, Data: data}
+}
+
+// RDNSS returns the recursive DNS server options.
+func (r *RouterAdvertisement) RDNSS() []DNSInfo {
+	var infos []DNSInfo
+	for _, o := range r.Options {
+		if o.Type != NDPOptionRDNSS || len(o.Data) < 6 {
+			continue
+		}
+		info := DNSInfo{Lifetime: time.Duration(binary.BigEndian.Uint32(o.Data[2:])) * time.Second}
+		for b := o.Data[6:]; len(b) >= net.IPv6len; b = b[net.IPv6len:] {
+			info.Servers = append(info.Servers, net.IP(b[:net.IPv6len]))
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// DNSSL returns the DNS search list options.
+func (r *RouterAdvertisement) DNSSL() []DNSInfo {
+	var infos []DNSInfo
+	for _, o := range r.Options {
+		if o.Type != NDPOptionDNSSL || len(o.Data) < 6 {
+			continue
+		}
+		info := DNSInfo{Lifetime: time.Duration(binary.BigEndian.Uint32(o.Data[2:])) * time.Second}
+		var labels []string
+		for b := o.Data[6:]; len(b) > 0 && 1+int(b[0]) <= len(b); b = b[1+int(b[0]):] {
+			if b[0] == 0 {
+				// Padding follows the last name as further zero octets, which end no name.
+				if len(labels) > 0 {
+					info.Domains = append(info.Domains, strings.Join(labels, ".")+".")
+				}
+				labels = nil
+				continue
+			}
+			labels = append(labels, string(b[1:1+b[0]]))
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// seconds converts a lifetime to whole seconds, saturating at Infinity.
+func seconds(d time.Duration) uint32 {
+	if d >= Infinity {
+		return 0xffffffff
+	}
+	return uint32(d / time.Second)
+}
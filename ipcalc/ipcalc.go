@@ -0,0 +1,157 @@
+package ipcalc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+)
+
+// MaxSplit is the largest number of subnets Split will return.
+const MaxSplit = 1 << 16
+
+// Info describes a prefix, and the address it was given with.
+type Info struct {
+	Address   net.IP     // The address given, which may have host bits set.
+	Prefix    *net.IPNet // The prefix, with host bits cleared.
+	Length    int        // The prefix length.
+	Bits      int        // The length of an address in bits: 32 or 128.
+	Mask      net.IPMask
+	Wildcard  net.IPMask // The inverse of the mask, as used by router access lists.
+	Network   net.IP
+	Broadcast net.IP   // The last address of an IPv4 prefix, or nil for IPv6, which has no broadcast.
+	First     net.IP   // The first usable host address.
+	Last      net.IP   // The last usable host address.
+	Addresses *big.Int // The number of addresses in the prefix.
+	Hosts     *big.Int // The number of usable host addresses.
+}
+
+// Parse parses an address with an optional prefix length, such as 192.0.2.10/24 or 2001:db8::1, where a bare address
+// is taken as a single host, and describes it.
+func Parse(s string) (*Info, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return New(ip4, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}), nil
+		}
+		return New(ip, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}), nil
+	}
+	ip, pfx, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return New(ip, pfx), nil
+}
+
+// New describes pfx, with ip as the address given, which may be nil.
+func New(ip net.IP, pfx *net.IPNet) *Info {
+	ones, bits := pfx.Mask.Size()
+	network := pfx.IP.Mask(pfx.Mask)
+	if ip == nil {
+		ip = network
+	}
+	if len(network) == net.IPv4len {
+		ip = ip.To4()
+	}
+	last := lastAddr(network, pfx.Mask)
+
+	info := &Info{
+		Address:   ip,
+		Prefix:    &net.IPNet{IP: network, Mask: pfx.Mask},
+		Length:    ones,
+		Bits:      bits,
+		Mask:      pfx.Mask,
+		Wildcard:  Wildcard(pfx.Mask),
+		Network:   network,
+		First:     network,
+		Last:      last,
+		Addresses: new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)),
+	}
+	info.Hosts = new(big.Int).Set(info.Addresses)
+	if bits == 8*net.IPv4len {
+		info.Broadcast = last
+		// The network and broadcast addresses are not usable by hosts, except on point-to-point /31s as described by
+		// RFC 3021, and single addresses.
+		if bits-ones >= 2 {
+			info.First = add(network, 1)
+			info.Last = add(last, -1)
+			info.Hosts.Sub(info.Hosts, big.NewInt(2))
+		}
+	}
+	return info
+}
+
+// Wildcard returns the inverse of a mask.
+func Wildcard(mask net.IPMask) net.IPMask {
+	w := make(net.IPMask, len(mask))
+	for i, b := range mask {
+		w[i] = ^b
+	}
+	return w
+}
+
+// Binary formats an address or mask in binary, with IPv4 octets separated by dots and IPv6 groups of 16 bits by
+// colons.
+func Binary(b []byte) string {
+	var sb strings.Builder
+	for i, octet := range b {
+		switch {
+		case i == 0:
+		case len(b) == net.IPv4len:
+			sb.WriteByte('.')
+		case i%2 == 0:
+			sb.WriteByte(':')
+		}
+		fmt.Fprintf(&sb, "%08b", octet)
+	}
+	return sb.String()
+}
+
+// Split divides pfx into subnets of the given length, returning an error if there would be more than MaxSplit.
+func Split(pfx *net.IPNet, length int) ([]*net.IPNet, error) {
+	ones, bits := pfx.Mask.Size()
+	if bits == 0 {
+		return nil, errors.New("invalid prefix")
+	}
+	if length < ones || length > bits {
+		return nil, fmt.Errorf("cannot split %v into /%d subnets", pfx, length)
+	}
+	if length-ones > 16 {
+		return nil, fmt.Errorf("splitting %v into /%d subnets gives more than %d", pfx, length, MaxSplit)
+	}
+
+	mask := net.CIDRMask(length, bits)
+	subnets := make([]*net.IPNet, 0, 1<<uint(length-ones))
+	ip := pfx.IP.Mask(pfx.Mask)
+	for i := 0; i < 1<<uint(length-ones); i++ {
+		subnets = append(subnets, &net.IPNet{IP: ip, Mask: mask})
+		ip = add(lastAddr(ip, mask), 1)
+	}
+	return subnets, nil
+}
+
+// lastAddr returns the last address of the prefix starting at network.
+func lastAddr(network net.IP, mask net.IPMask) net.IP {
+	last := make(net.IP, len(network))
+	for i := range network {
+		last[i] = network[i] | ^mask[i]
+	}
+	return last
+}
+
+// add returns ip plus delta, which is 1 or -1, wrapping around at the ends of the address space.
+func add(ip net.IP, delta int) net.IP {
+	out := append(net.IP(nil), ip...)
+	for i := len(out) - 1; i >= 0; i-- {
+		before := out[i]
+		out[i] += byte(delta)
+		if (delta > 0 && out[i] > before) || (delta < 0 && out[i] < before) {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package ipcalc
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	// summary flattens an Info into strings for comparison.
+	type summary struct {
+		Address, Prefix, Mask, Wildcard, Network, Broadcast, First, Last, Addresses, Hosts string
+	}
+	ipString := func(ip net.IP) string {
+		if ip == nil {
+			return ""
+		}
+		return ip.String()
+	}
+
+	tests := map[string]struct {
+		in   string
+		want summary
+	}{
+		"IPv4": {
+			in: "192.0.2.10/26",
+			want: summary{
+				Address: "192.0.2.10", Prefix: "192.0.2.0/26", Mask: "ffffffc0", Wildcard: "0000003f",
+				Network: "192.0.2.0", Broadcast: "192.0.2.63", First: "192.0.2.1", Last: "192.0.2.62",
+				Addresses: "64", Hosts: "62",
+			},
+		},
+		"PointToPoint": {
+			in: "198.51.100.7/31",
+			want: summary{
+				Address: "198.51.100.7", Prefix: "198.51.100.6/31", Mask: "fffffffe", Wildcard: "00000001",
+				Network: "198.51.100.6", Broadcast: "198.51.100.7", First: "198.51.100.6", Last: "198.51.100.7",
+				Addresses: "2", Hosts: "2",
+			},
+		},
+		"Host": {
+			in: "203.0.113.9",
+			want: summary{
+				Address: "203.0.113.9", Prefix: "203.0.113.9/32", Mask: "ffffffff", Wildcard: "00000000",
+				Network: "203.0.113.9", Broadcast: "203.0.113.9", First: "203.0.113.9", Last: "203.0.113.9",
+				Addresses: "1", Hosts: "1",
+			},
+		},
+		"IPv6": {
+			in: "2001:db8::1/64",
+			want: summary{
+				Address: "2001:db8::1", Prefix: "2001:db8::/64", Mask: "ffffffffffffffff0000000000000000",
+				Wildcard: "0000000000000000ffffffffffffffff", Network: "2001:db8::",
+				First: "2001:db8::", Last: "2001:db8::ffff:ffff:ffff:ffff",
+				Addresses: "18446744073709551616", Hosts: "18446744073709551616",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := Parse(test.in)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			got := summary{
+				Address: info.Address.String(), Prefix: info.Prefix.String(), Mask: info.Mask.String(),
+				Wildcard: info.Wildcard.String(), Network: info.Network.String(), Broadcast: ipString(info.Broadcast),
+				First: info.First.String(), Last: info.Last.String(), Addresses: info.Addresses.String(),
+				Hosts: info.Hosts.String(),
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	for _, in := range []string{"192.0.2.300", "192.0.2.0/33", "nonsense"} {
+		if _, err := Parse(in); err == nil {
+			t.Fatalf("%q: parsed", in)
+		}
+	}
+}
+
+func TestBinary(t *testing.T) {
+	if got, want := Binary(net.IP{192, 0, 2, 1}), "11000000.00000000.00000010.00000001"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	want := "0010000000000001:0000110110111000:0000000000000000:0000000000000000:" +
+		"0000000000000000:0000000000000000:0000000000000000:0000000000000001"
+	if got := Binary(net.ParseIP("2001:db8::1")); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	_, pfx, _ := net.ParseCIDR("192.0.2.0/24")
+	subnets, err := Split(pfx, 26)
+	if err != nil {
+		t.Fatalf("split err: %v", err)
+	}
+	var got []string
+	for _, s := range subnets {
+		got = append(got, s.String())
+	}
+	want := []string{"192.0.2.0/26", "192.0.2.64/26", "192.0.2.128/26", "192.0.2.192/26"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	subnets, err = Split(all, 16)
+	if err != nil || len(subnets) != MaxSplit || subnets[MaxSplit-1].String() != "255.255.0.0/16" {
+		t.Fatalf("split all: got %d subnets, %v", len(subnets), err)
+	}
+	if _, err := Split(all, 17); err == nil {
+		t.Fatalf("split into more than %d subnets accepted", MaxSplit)
+	}
+	for _, length := range []int{23, 33} {
+		if _, err := Split(pfx, length); err == nil {
+			t.Fatalf("split into /%d accepted", length)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ipcalc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// LinkEnd is one side of a point-to-point link.
+type LinkEnd struct {
+	Device string
+	Addr   net.IP
+}
+
+// Link is a numbered point-to-point link between two devices.
+type Link struct {
+	Index  int // The position of the link in the list, counting from one.
+	Prefix *net.IPNet
+	A, B   LinkEnd
+}
+
+// LinkAddrs returns the addresses of the A and B sides of a point-to-point prefix. On a /31 or /127 they are the two
+// addresses of the prefix, as described by RFC 3021 and RFC 6164. On a /30 or /126 they are the two in the middle,
+// avoiding the IPv4 network and broadcast addresses and the IPv6 subnet-router anycast address.
+func LinkAddrs(pfx *net.IPNet) (a, b net.IP, err error) {
+	ones, bits := pfx.Mask.Size()
+	if bits == 0 {
+		return nil, nil, errors.New("invalid prefix")
+	}
+	network := pfx.IP.Mask(pfx.Mask)
+	switch bits - ones {
+	case 1:
+		return network, add(network, 1), nil
+	case 2:
+		a = add(network, 1)
+		return a, add(a, 1), nil
+	}
+	return nil, nil, fmt.Errorf("%v is not a point-to-point prefix", pfx)
+}
+
+// Links numbers a link for each pair of devices, taking consecutive prefixes of a length from the start of a pool. A
+// length of zero means a /31 from an IPv4 pool or a /127 from an IPv6 one. The first device of each pair is the A side.
+func Links(pool *net.IPNet, length int, pairs [][2]string) ([]Link, error) {
+	ones, bits := pool.Mask.Size()
+	if bits == 0 {
+		return nil, errors.New("invalid pool")
+	}
+	if length == 0 {
+		length = bits - 1
+	}
+	if length < ones || (length != bits-1 && length != bits-2) {
+		return nil, fmt.Errorf("cannot number links with /%d prefixes from %v", length, pool)
+	}
+	if length-ones < 31 && len(pairs) > 1<<uint(length-ones) {
+		return nil, fmt.Errorf("%v has room for %d links, not %d", pool, 1<<uint(length-ones), len(pairs))
+	}
+
+	mask := net.CIDRMask(length, bits)
+	ip := pool.IP.Mask(pool.Mask)
+	links := make([]Link, 0, len(pairs))
+	for i, pair := range pairs {
+		pfx := &net.IPNet{IP: ip, Mask: mask}
+		a, b, err := LinkAddrs(pfx)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, Link{
+			Index:  i + 1,
+			Prefix: pfx,
+			A:      LinkEnd{Device: pair[0], Addr: a},
+			B:      LinkEnd{Device: pair[1], Addr: b},
+		})
+		ip = add(lastAddr(ip, mask), 1)
+	}
+	return links, nil
+}
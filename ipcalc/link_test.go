@@ -0,0 +1,126 @@
+package ipcalc
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestLinkAddrs(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		wantA   string
+		wantB   string
+		wantErr bool
+	}{
+		"IPv4": {
+			in:    "198.51.100.7/31",
+			wantA: "198.51.100.6",
+			wantB: "198.51.100.7",
+		},
+		"IPv6": {
+			in:    "2001:db8::a/127",
+			wantA: "2001:db8::a",
+			wantB: "2001:db8::b",
+		},
+		"IPv4Slash30": {
+			in:    "192.0.2.4/30",
+			wantA: "192.0.2.5",
+			wantB: "192.0.2.6",
+		},
+		"IPv6Slash126": {
+			in:    "2001:db8::/126",
+			wantA: "2001:db8::1",
+			wantB: "2001:db8::2",
+		},
+		"TooLarge": {
+			in:      "192.0.2.0/29",
+			wantErr: true,
+		},
+		"Host": {
+			in:      "192.0.2.1/32",
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, pfx, err := net.ParseCIDR(test.in)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			a, b, err := LinkAddrs(pfx)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if diff := cmp.Diff([]string{test.wantA, test.wantB}, []string{a.String(), b.String()}); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestLinks(t *testing.T) {
+	pairs := [][2]string{{"core1", "core2"}, {"core1", "edge1"}, {"core2", "edge1"}}
+	// summary flattens a Link into strings for comparison.
+	type summary struct {
+		Index                      int
+		Prefix, A, AAddr, B, BAddr string
+	}
+
+	tests := map[string]struct {
+		pool    string
+		length  int
+		want    []summary
+		wantErr bool
+	}{
+		"IPv4": {
+			pool: "10.255.0.0/29",
+			want: []summary{
+				{1, "10.255.0.0/31", "core1", "10.255.0.0", "core2", "10.255.0.1"},
+				{2, "10.255.0.2/31", "core1", "10.255.0.2", "edge1", "10.255.0.3"},
+				{3, "10.255.0.4/31", "core2", "10.255.0.4", "edge1", "10.255.0.5"},
+			},
+		},
+		"IPv6": {
+			pool:   "2001:db8:ff::/64",
+			length: 126,
+			want: []summary{
+				{1, "2001:db8:ff::/126", "core1", "2001:db8:ff::1", "core2", "2001:db8:ff::2"},
+				{2, "2001:db8:ff::4/126", "core1", "2001:db8:ff::5", "edge1", "2001:db8:ff::6"},
+				{3, "2001:db8:ff::8/126", "core2", "2001:db8:ff::9", "edge1", "2001:db8:ff::a"},
+			},
+		},
+		"Exhausted": {
+			pool:    "10.255.0.0/30",
+			wantErr: true,
+		},
+		"BadLength": {
+			pool:    "10.255.0.0/24",
+			length:  29,
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, pool, err := net.ParseCIDR(test.pool)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			links, err := Links(pool, test.length, pairs)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			var got []summary
+			for _, l := range links {
+				got = append(got, summary{l.Index, l.Prefix.String(), l.A.Device, l.A.Addr.String(), l.B.Device,
+					l.B.Addr.String()})
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
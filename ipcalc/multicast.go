@@ -0,0 +1,91 @@
+package ipcalc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// MulticastScope is the scope field of an IPv6 multicast address, as defined by RFC 4291 and RFC 7346.
+type MulticastScope uint8
+
+// IPv6 multicast scopes. Values that are not listed are unassigned, and may be defined by administrators.
+const (
+	ScopeReserved          MulticastScope = 0x0
+	ScopeInterfaceLocal    MulticastScope = 0x1
+	ScopeLinkLocal         MulticastScope = 0x2
+	ScopeRealmLocal        MulticastScope = 0x3
+	ScopeAdminLocal        MulticastScope = 0x4
+	ScopeSiteLocal         MulticastScope = 0x5
+	ScopeOrganizationLocal MulticastScope = 0x8
+	ScopeGlobal            MulticastScope = 0xe
+	ScopeReservedHigh      MulticastScope = 0xf
+)
+
+func (s MulticastScope) String() string {
+	switch s {
+	case ScopeReserved, ScopeReservedHigh:
+		return "reserved"
+	case ScopeInterfaceLocal:
+		return "interface-local"
+	case ScopeLinkLocal:
+		return "link-local"
+	case ScopeRealmLocal:
+		return "realm-local"
+	case ScopeAdminLocal:
+		return "admin-local"
+	case ScopeSiteLocal:
+		return "site-local"
+	case ScopeOrganizationLocal:
+		return "organization-local"
+	case ScopeGlobal:
+		return "global"
+	}
+	return "MulticastScope(" + strconv.Itoa(int(s)) + ")"
+}
+
+// IPv6MulticastScope returns the scope of an IPv6 multicast address.
+func IPv6MulticastScope(ip net.IP) (MulticastScope, error) {
+	if ip.To4() != nil || len(ip) != net.IPv6len || !ip.IsMulticast() {
+		return 0, fmt.Errorf("%v is not an ipv6 multicast address", ip)
+	}
+	return MulticastScope(ip[1] & 0x0f), nil
+}
+
+// Prefixes of the Ethernet addresses multicast groups are mapped to.
+var (
+	ipv4MulticastMAC = net.HardwareAddr{0x01, 0x00, 0x5e} // RFC 1112; the next bit is zero.
+	ipv6MulticastMAC = net.HardwareAddr{0x33, 0x33}       // RFC 2464.
+)
+
+// MulticastMAC returns the Ethernet address frames to a multicast group are sent to: 01:00:5e followed by the low 23
+// bits of an IPv4 group, or 33:33 followed by the low 32 bits of an IPv6 group. Groups differing only in the other
+// bits share an address, and are told apart only by the IP layer.
+func MulticastMAC(group net.IP) (net.HardwareAddr, error) {
+	if !group.IsMulticast() {
+		return nil, fmt.Errorf("%v is not a multicast address", group)
+	}
+	if ip4 := group.To4(); ip4 != nil {
+		return net.HardwareAddr{0x01, 0x00, 0x5e, ip4[1] & 0x7f, ip4[2], ip4[3]}, nil
+	}
+	return append(append(net.HardwareAddr{}, ipv6MulticastMAC...), group[12:]...), nil
+}
+
+// MulticastIPv4Groups returns the 32 IPv4 multicast groups that are sent to an Ethernet address, in order, as the 5
+// bits of a group that follow its first 4 are not carried in its address.
+func MulticastIPv4Groups(mac net.HardwareAddr) ([]net.IP, error) {
+	switch {
+	case len(mac) == 6 && bytes.HasPrefix(mac, ipv6MulticastMAC):
+		return nil, errors.New("ipv6 multicast mac address only carries the low 32 bits of its groups")
+	case len(mac) != 6 || !bytes.HasPrefix(mac, ipv4MulticastMAC) || mac[3]&0x80 != 0:
+		return nil, fmt.Errorf("%v is not an ipv4 multicast mac address", mac)
+	}
+	groups := make([]net.IP, 0, 32)
+	for high := 0; high < 32; high++ {
+		// The first octet is 224 to 239, and the high bit of the second is the other bit not carried.
+		groups = append(groups, net.IPv4(byte(224+high>>1), byte(high&1)<<7|mac[3], mac[4], mac[5]))
+	}
+	return groups, nil
+}
@@ -0,0 +1,95 @@
+package ipcalc
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestMulticastMAC(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		"AllHosts":       {in: "224.0.0.1", want: "01:00:5e:00:00:01"},
+		"HighBitDropped": {in: "239.129.2.3", want: "01:00:5e:01:02:03"},
+		"IPv6AllNodes":   {in: "ff02::1", want: "33:33:00:00:00:01"},
+		"SolicitedNode":  {in: "ff02::1:ff12:3456", want: "33:33:ff:12:34:56"},
+		"IPv4Unicast":    {in: "192.0.2.1", wantErr: true},
+		"IPv6Unicast":    {in: "2001:db8::1", wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := MulticastMAC(net.ParseIP(test.in))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && got.String() != test.want {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMulticastIPv4Groups(t *testing.T) {
+	mac, _ := net.ParseMAC("01:00:5e:01:02:03")
+	groups, err := MulticastIPv4Groups(mac)
+	if err != nil {
+		t.Fatalf("groups err: %v", err)
+	}
+	if len(groups) != 32 {
+		t.Fatalf("got %d groups", len(groups))
+	}
+	var got []string
+	for _, g := range groups[:3] {
+		got = append(got, g.String())
+	}
+	if diff := cmp.Diff([]string{"224.1.2.3", "224.129.2.3", "225.1.2.3"}, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	for _, g := range groups {
+		if back, _ := MulticastMAC(g); back.String() != mac.String() {
+			t.Fatalf("%v maps to %v", g, back)
+		}
+	}
+	if last := groups[31].String(); last != "239.129.2.3" {
+		t.Fatalf("got last group %v", last)
+	}
+
+	for _, s := range []string{"33:33:00:00:00:01", "01:00:5e:80:00:01", "00:00:5e:00:00:01"} {
+		mac, _ := net.ParseMAC(s)
+		if _, err := MulticastIPv4Groups(mac); err == nil {
+			t.Fatalf("%v: expected error", s)
+		}
+	}
+}
+
+func TestIPv6MulticastScope(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		"InterfaceLocal": {in: "ff01::1", want: "interface-local"},
+		"LinkLocal":      {in: "ff02::1", want: "link-local"},
+		"SiteLocal":      {in: "ff05::2", want: "site-local"},
+		"Organization":   {in: "ff18::1234", want: "organization-local"},
+		"Global":         {in: "ff3e:30:2001:db8::1", want: "global"},
+		"Reserved":       {in: "ff00::1", want: "reserved"},
+		"Unassigned":     {in: "ff06::1", want: "MulticastScope(6)"},
+		"IPv4":           {in: "224.0.0.1", wantErr: true},
+		"Unicast":        {in: "2001:db8::1", wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := IPv6MulticastScope(net.ParseIP(test.in))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && got.String() != test.want {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
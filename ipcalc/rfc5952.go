@@ -0,0 +1,156 @@
+package ipcalc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Violation is a way in which IPv6 address text departs from the canonical form of RFC 5952.
+type Violation struct {
+	Section string // The section of RFC 5952 whose rule is broken, such as "4.1".
+	Detail  string
+}
+
+// String formats the violation for display.
+func (v Violation) String() string {
+	return fmt.Sprintf("RFC 5952 section %s: %s", v.Section, v.Detail)
+}
+
+// mapped reports whether ip, in its 16 byte form, is an IPv4-mapped address.
+func mapped(ip net.IP) bool {
+	for _, b := range ip[:10] {
+		if b != 0 {
+			return false
+		}
+	}
+	return ip[10] == 0xff && ip[11] == 0xff
+}
+
+// zeroRun returns the position and length of the longest run of two or more zero fields, the first if there are
+// several, or a length of zero if there is none.
+func zeroRun(fields []uint16) (start, length int) {
+	for i := 0; i < len(fields); {
+		if fields[i] != 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < len(fields) && fields[j] == 0 {
+			j++
+		}
+		if j-i > length && j-i >= 2 {
+			start, length = i, j-i
+		}
+		i = j
+	}
+	return start, length
+}
+
+// FormatIPv6 returns the canonical text of ip as an IPv6 address, as set out by RFC 5952: lower case hexadecimal
+// without leading zeros, with the longest run of zero fields shortened to "::", and IPv4-mapped addresses, including
+// IPv4 addresses, ending in dotted decimal.
+func FormatIPv6(ip net.IP) string {
+	ip = ip.To16()
+	if ip == nil {
+		return ""
+	}
+	if mapped(ip) {
+		return "::ffff:" + ip[12:].String()
+	}
+	fields := make([]uint16, 8)
+	for i := range fields {
+		fields[i] = binary.BigEndian.Uint16(ip[2*i:])
+	}
+	start, length := zeroRun(fields)
+
+	var b strings.Builder
+	for i := 0; i < len(fields); i++ {
+		if length > 0 && i == start {
+			b.WriteString("::")
+			i += length - 1
+			continue
+		}
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), ":") {
+			b.WriteByte(':')
+		}
+		b.WriteString(strconv.FormatUint(uint64(fields[i]), 16))
+	}
+	return b.String()
+}
+
+// CanonicalizeIPv6 parses IPv6 address text, returning its canonical form and each way in which the text departs from
+// it, in the order of the sections of RFC 5952. It returns an error if s is not an IPv6 address.
+func CanonicalizeIPv6(s string) (string, []Violation, error) {
+	ip := net.ParseIP(s)
+	if ip == nil || !strings.Contains(s, ":") {
+		return "", nil, fmt.Errorf("invalid IPv6 address %q", s)
+	}
+
+	// Split the text into the fields before and after any "::", counting an embedded IPv4 address as two fields.
+	head, tail, compressed := s, "", false
+	if i := strings.Index(s, "::"); i >= 0 {
+		head, tail, compressed = s[:i], s[i+2:], true
+	}
+	var fields []string
+	count := func(part string) int {
+		if part == "" {
+			return 0
+		}
+		parts := strings.Split(part, ":")
+		fields = append(fields, parts...)
+		if strings.Contains(part, ".") {
+			return len(parts) + 1
+		}
+		return len(parts)
+	}
+	start := count(head)
+	omitted := 8 - start - count(tail)
+
+	var violations []Violation
+	for _, f := range fields {
+		if len(f) > 1 && f[0] == '0' && !strings.Contains(f, ".") {
+			violations = append(violations, Violation{"4.1", fmt.Sprintf("field %q has leading zeros", f)})
+		}
+	}
+
+	values := make([]uint16, 8)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(ip[2*i:])
+	}
+	runStart, runLength := zeroRun(values)
+	switch {
+	case compressed && omitted == 1:
+		violations = append(violations, Violation{"4.2.2", `"::" stands for a single zero field`})
+	case !compressed && runLength > 0, compressed && start >= runStart && start+omitted <= runStart+runLength &&
+		omitted < runLength:
+		violations = append(violations, Violation{"4.2.1", fmt.Sprintf("%d zero fields are not all shortened", runLength)})
+	case compressed && (start != runStart || omitted != runLength):
+		violations = append(violations, Violation{"4.2.3", `"::" does not shorten the first longest run of zero fields`})
+	}
+	if strings.ToLower(s) != s {
+		violations = append(violations, Violation{"4.3", "upper case hexadecimal digits"})
+	}
+	switch dotted := strings.Contains(s, "."); {
+	case mapped(ip) && !dotted:
+		violations = append(violations, Violation{"5", "IPv4-mapped address does not end in dotted decimal"})
+	case !mapped(ip) && dotted:
+		violations = append(violations, Violation{"5", "dotted decimal in an address that is not IPv4-mapped"})
+	}
+	return FormatIPv6(ip), violations, nil
+}
+
+// ParseIPv6Strict parses IPv6 address text, returning an error naming the first way in which it departs from the
+// canonical form of RFC 5952, if it does.
+func ParseIPv6Strict(s string) (net.IP, error) {
+	_, violations, err := CanonicalizeIPv6(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		return nil, fmt.Errorf("non-canonical IPv6 address %q: %v", s, violations[0])
+	}
+	return net.ParseIP(s), nil
+}
@@ -0,0 +1,77 @@
+package ipcalc
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestCanonicalizeIPv6(t *testing.T) {
+	tests := map[string]struct {
+		in       string
+		want     string
+		sections []string
+		wantErr  bool
+	}{
+		"Canonical":    {in: "2001:db8::1", want: "2001:db8::1"},
+		"LeadingZeros": {in: "2001:0db8::0001", want: "2001:db8::1", sections: []string{"4.1", "4.1"}},
+		"Uncompressed": {in: "2001:db8:0:0:0:0:0:1", want: "2001:db8::1", sections: []string{"4.2.1"}},
+		"PartlyCompressed": {
+			in:       "2001:db8:0:0::1",
+			want:     "2001:db8::1",
+			sections: []string{"4.2.1"},
+		},
+		"SingleField": {in: "2001:db8::1:1:1:1:1", want: "2001:db8:0:1:1:1:1:1", sections: []string{"4.2.2"}},
+		"ShorterRun": {
+			in:       "2001::1:0:0:0:1",
+			want:     "2001:0:0:1::1",
+			sections: []string{"4.2.3"},
+		},
+		"FirstOfEqual": {
+			in:       "2001:db8:0:0:1::1",
+			want:     "2001:db8::1:0:0:1",
+			sections: []string{"4.2.3"},
+		},
+		"UpperCase":   {in: "2001:DB8::A", want: "2001:db8::a", sections: []string{"4.3"}},
+		"Mapped":      {in: "::ffff:192.0.2.1", want: "::ffff:192.0.2.1"},
+		"MappedHex":   {in: "::ffff:c000:201", want: "::ffff:192.0.2.1", sections: []string{"5"}},
+		"Dotted":      {in: "64:ff9b::192.0.2.1", want: "64:ff9b::c000:201", sections: []string{"5"}},
+		"Unspecified": {in: "::", want: "::"},
+		"Several": {
+			in:       "2001:0DB8:0:0:0:0:0:1",
+			want:     "2001:db8::1",
+			sections: []string{"4.1", "4.2.1", "4.3"},
+		},
+		"IPv4":    {in: "192.0.2.1", wantErr: true},
+		"Invalid": {in: "2001:db8:::1", wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, violations, err := CanonicalizeIPv6(test.in)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			var sections []string
+			for _, v := range violations {
+				sections = append(sections, v.Section)
+			}
+			if diff := cmp.Diff(test.sections, sections); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+
+			// Canonical text must be accepted by the strict parser, and only canonical text.
+			if _, err := ParseIPv6Strict(test.in); (err != nil) != (len(violations) > 0) {
+				t.Fatalf("strict err: %v", err)
+			}
+			if _, err := ParseIPv6Strict(got); err != nil {
+				t.Fatalf("strict err: %v", err)
+			}
+		})
+	}
+}
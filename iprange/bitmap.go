@@ -0,0 +1,399 @@
+package iprange
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+	"sort"
+)
+
+// Addresses are held in chunks of 65536, one for each value of their high 16 bits. A chunk is held as a sorted array
+// of the low 16 bits of its addresses until that would take more memory than a bitmap of the whole chunk.
+const (
+	chunkSize  = 1 << 16
+	chunkWords = chunkSize / 64
+	maxArray   = chunkSize / 16
+)
+
+// chunk is the set of addresses of a Bitmap that share their high 16 bits.
+type chunk struct {
+	n     int      // Number of addresses in the chunk.
+	array []uint16 // Sorted low bits of the addresses, if bits is nil.
+	bits  []uint64 // Bitmap of the low bits of the addresses, if the chunk is dense.
+}
+
+// contains reports whether the chunk holds the address with the low bits lo.
+func (c *chunk) contains(lo uint16) bool {
+	if c.bits != nil {
+		return c.bits[lo/64]&(1<<(lo%64)) != 0
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= lo })
+	return i < len(c.array) && c.array[i] == lo
+}
+
+// toBits converts the chunk to a bitmap.
+func (c *chunk) toBits() {
+	c.bits = make([]uint64, chunkWords)
+	for _, lo := range c.array {
+		c.bits[lo/64] |= 1 << (lo % 64)
+	}
+	c.array = nil
+}
+
+// toArray converts the chunk to an array.
+func (c *chunk) toArray() {
+	c.array = make([]uint16, 0, c.n)
+	c.runs(func(first, last uint16) bool {
+		for lo := int(first); lo <= int(last); lo++ {
+			c.array = append(c.array, uint16(lo))
+		}
+		return true
+	})
+	c.bits = nil
+}
+
+// set sets or clears the bits from first to last, updating the count of addresses.
+func (c *chunk) set(first, last uint16, value bool) {
+	for w := int(first / 64); w <= int(last/64); w++ {
+		mask := ^uint64(0)
+		if w == int(first/64) {
+			mask &^= 1<<(first%64) - 1
+		}
+		if w == int(last/64) && last%64 != 63 {
+			mask &= 1<<(last%64+1) - 1
+		}
+		c.n -= bits.OnesCount64(c.bits[w])
+		if value {
+			c.bits[w] |= mask
+		} else {
+			c.bits[w] &^= mask
+		}
+		c.n += bits.OnesCount64(c.bits[w])
+	}
+}
+
+// add adds the addresses with low bits from first to last to the chunk.
+func (c *chunk) add(first, last uint16) {
+	if c.bits == nil && c.n+int(last-first)+1 > maxArray {
+		c.toBits()
+	}
+	if c.bits != nil {
+		c.set(first, last, true)
+		return
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= first })
+	j := sort.Search(len(c.array), func(j int) bool { return c.array[j] > last })
+	merged := make([]uint16, 0, len(c.array)-(j-i)+int(last-first)+1)
+	merged = append(merged, c.array[:i]...)
+	for lo := int(first); lo <= int(last); lo++ {
+		merged = append(merged, uint16(lo))
+	}
+	c.array = append(merged, c.array[j:]...)
+	c.n = len(c.array)
+}
+
+// remove removes the addresses with low bits from first to last from the chunk.
+func (c *chunk) remove(first, last uint16) {
+	if c.bits != nil {
+		c.set(first, last, false)
+		if c.n <= maxArray {
+			c.toArray()
+		}
+		return
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= first })
+	j := sort.Search(len(c.array), func(j int) bool { return c.array[j] > last })
+	c.array = append(c.array[:i], c.array[j:]...)
+	c.n = len(c.array)
+}
+
+// runs calls fn with each run of consecutive low bits in the chunk, in order, until it returns false.
+func (c *chunk) runs(fn func(first, last uint16) bool) bool {
+	if c.bits == nil {
+		for i := 0; i < len(c.array); {
+			j := i + 1
+			for j < len(c.array) && c.array[j] == c.array[j-1]+1 {
+				j++
+			}
+			if !fn(c.array[i], c.array[j-1]) {
+				return false
+			}
+			i = j
+		}
+		return true
+	}
+
+	// Find the next set bit, then the next clear bit after it, skipping whole words at a time.
+	next := func(from int, set bool) int {
+		for w := from / 64; w < chunkWords; w++ {
+			word := c.bits[w]
+			if !set {
+				word = ^word
+			}
+			if w == from/64 {
+				word &^= 1<<uint(from%64) - 1
+			}
+			if word != 0 {
+				return 64*w + bits.TrailingZeros64(word)
+			}
+		}
+		return chunkSize
+	}
+	for lo := next(0, true); lo < chunkSize; lo = next(lo, true) {
+		end := next(lo, false)
+		if !fn(uint16(lo), uint16(end-1)) {
+			return false
+		}
+		lo = end
+		if lo == chunkSize {
+			break
+		}
+	}
+	return true
+}
+
+// Bitmap is a set of IPv4 addresses held as bitmaps, in the manner of a roaring bitmap. Testing membership takes
+// constant time however the addresses are spread, and dense sets take as little as one bit per address, where a Set
+// takes 32 bytes for each of its ranges. A bitmap holding any address takes at least 512 KiB. The zero value is an
+// empty bitmap.
+type Bitmap struct {
+	chunks []*chunk // Indexed by the high 16 bits of the address, allocated when the first address is added.
+	n      uint64
+}
+
+// BitmapFromIPNets returns a bitmap of the addresses covered by the prefixes, which must be IPv4.
+func BitmapFromIPNets(pfxs []*net.IPNet) (*Bitmap, error) {
+	b := &Bitmap{}
+	for _, pfx := range pfxs {
+		if err := b.AddIPNet(pfx); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// bounds returns the bounds of r as 32 bit numbers, or an error if it is invalid or not IPv4.
+func (b *Bitmap) bounds(r Range) (first, last uint32, err error) {
+	_, _, v4, err := r.addrs()
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %v: %w", r, err)
+	}
+	if !v4 {
+		return 0, 0, fmt.Errorf("invalid range %v: not IPv4", r)
+	}
+	return binary.BigEndian.Uint32(r.First.To4()), binary.BigEndian.Uint32(r.Last.To4()), nil
+}
+
+// update calls fn with each chunk that r covers part of, and the low bits of the first and last addresses it covers.
+func (b *Bitmap) update(r Range, fn func(c *chunk, first, last uint16)) error {
+	first, last, err := b.bounds(r)
+	if err != nil {
+		return err
+	}
+	if b.chunks == nil {
+		b.chunks = make([]*chunk, chunkSize)
+	}
+	for hi := first >> 16; hi <= last>>16; hi++ {
+		lo, hiLast := uint16(0), uint16(chunkSize-1)
+		if hi == first>>16 {
+			lo = uint16(first)
+		}
+		if hi == last>>16 {
+			hiLast = uint16(last)
+		}
+		c := b.chunks[hi]
+		if c == nil {
+			c = &chunk{}
+		}
+		b.n -= uint64(c.n)
+		fn(c, lo, hiLast)
+		b.n += uint64(c.n)
+		if c.n == 0 {
+			c = nil
+		}
+		b.chunks[hi] = c
+	}
+	return nil
+}
+
+// Add adds the addresses of r, which must be IPv4, to the bitmap.
+func (b *Bitmap) Add(r Range) error {
+	return b.update(r, (*chunk).add)
+}
+
+// Remove removes the addresses of r, which must be IPv4, from the bitmap.
+func (b *Bitmap) Remove(r Range) error {
+	return b.update(r, (*chunk).remove)
+}
+
+// AddIPNet adds the addresses covered by an IPv4 prefix to the bitmap.
+func (b *Bitmap) AddIPNet(pfx *net.IPNet) error {
+	return b.Add(FromIPNet(pfx))
+}
+
+// RemoveIPNet removes the addresses covered by an IPv4 prefix from the bitmap.
+func (b *Bitmap) RemoveIPNet(pfx *net.IPNet) error {
+	return b.Remove(FromIPNet(pfx))
+}
+
+// Contains reports whether ip is in the bitmap.
+func (b *Bitmap) Contains(ip net.IP) bool {
+	ip4 := ip.To4()
+	if ip4 == nil || b.chunks == nil {
+		return false
+	}
+	a := binary.BigEndian.Uint32(ip4)
+	c := b.chunks[a>>16]
+	return c != nil && c.contains(uint16(a))
+}
+
+// Count returns the number of addresses in the bitmap.
+func (b *Bitmap) Count() uint64 {
+	return b.n
+}
+
+// Each calls fn with each range of consecutive addresses in the bitmap in order, until it returns false.
+func (b *Bitmap) Each(fn func(Range) bool) {
+	// Runs that end at the end of a chunk are held back, in case they continue into the next.
+	var first, last uint32
+	pending := false
+	emit := func() bool {
+		f, l := make(net.IP, net.IPv4len), make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(f, first)
+		binary.BigEndian.PutUint32(l, last)
+		return fn(Range{First: f, Last: l})
+	}
+	for hi, c := range b.chunks {
+		if c == nil {
+			continue
+		}
+		base := uint32(hi) << 16
+		ok := c.runs(func(lo, loLast uint16) bool {
+			if pending && base|uint32(lo) == last+1 {
+				last = base | uint32(loLast)
+				return true
+			}
+			if pending && !emit() {
+				return false
+			}
+			first, last, pending = base|uint32(lo), base|uint32(loLast), true
+			return true
+		})
+		if !ok {
+			return
+		}
+	}
+	if pending {
+		emit()
+	}
+}
+
+// Ranges returns the ranges of consecutive addresses in the bitmap, in order.
+func (b *Bitmap) Ranges() []Range {
+	var ranges []Range
+	b.Each(func(r Range) bool {
+		ranges = append(ranges, r)
+		return true
+	})
+	return ranges
+}
+
+// IPNets returns the smallest list of prefixes that covers exactly the addresses of the bitmap, in order.
+func (b *Bitmap) IPNets() []*net.IPNet {
+	var pfxs []*net.IPNet
+	b.Each(func(r Range) bool {
+		first, last, _, _ := r.addrs()
+		pfxs = ipNets(pfxs, first, last, true)
+		return true
+	})
+	return pfxs
+}
+
+// Set returns a Set of the addresses in the bitmap.
+func (b *Bitmap) Set() *Set {
+	s := &Set{}
+	b.Each(func(r Range) bool {
+		first, last, _, _ := r.addrs()
+		s.v4 = append(s.v4, span{first, last})
+		return true
+	})
+	return s
+}
+
+// Bitmap returns a Bitmap of the addresses in the set, or an error if it holds any IPv6 addresses.
+func (s *Set) Bitmap() (*Bitmap, error) {
+	if len(s.v6) > 0 {
+		return nil, errors.New("set holds IPv6 addresses")
+	}
+	b := &Bitmap{}
+	for _, sp := range s.v4 {
+		if err := b.Add(Range{First: sp.first.ip(true), Last: sp.last.ip(true)}); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Membership is a set of addresses to test addresses against, held as either a Set or a Bitmap.
+type Membership interface {
+	Contains(ip net.IP) bool
+	IPNets() []*net.IPNet
+}
+
+// Kind is a way of holding a set of addresses.
+type Kind string
+
+// Kinds of Membership.
+const (
+	KindAuto   Kind = "auto"   // Whichever of the others takes less memory.
+	KindRanges Kind = "ranges" // A Set, of sorted ranges, which takes logarithmic time to test membership.
+	KindBitmap Kind = "bitmap" // A Bitmap, which takes constant time to test membership, but only holds IPv4.
+)
+
+// NewMembership returns a set of the addresses covered by the prefixes, held in the given way. KindAuto chooses a
+// Bitmap if the prefixes are all IPv4 and it would take less memory than a Set, which it does for large sets of
+// scattered addresses.
+func NewMembership(pfxs []*net.IPNet, kind Kind) (Membership, error) {
+	switch kind {
+	case KindRanges:
+		return FromIPNets(pfxs), nil
+	case KindBitmap:
+		return BitmapFromIPNets(pfxs)
+	case KindAuto:
+		s := FromIPNets(pfxs)
+		if len(s.v6) > 0 || s.bitmapSize() >= 32*len(s.v4) {
+			return s, nil
+		}
+		return s.Bitmap()
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+}
+
+// bitmapSize estimates the bytes a Bitmap of the IPv4 addresses of the set would take.
+func (s *Set) bitmapSize() int {
+	counts := map[uint32]int{}
+	for _, sp := range s.v4 {
+		first, last := binary.BigEndian.Uint32(sp.first[12:]), binary.BigEndian.Uint32(sp.last[12:])
+		for hi := first >> 16; hi <= last>>16; hi++ {
+			lo, hiLast := hi<<16, hi<<16|(chunkSize-1)
+			if lo < first {
+				lo = first
+			}
+			if hiLast > last {
+				hiLast = last
+			}
+			counts[hi] += int(hiLast-lo) + 1
+		}
+	}
+	size := 8 * chunkSize
+	for _, n := range counts {
+		if n > maxArray {
+			n = maxArray
+		}
+		size += 2*n + 64
+	}
+	return size
+}
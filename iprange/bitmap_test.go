@@ -0,0 +1,208 @@
+package iprange
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestBitmap(t *testing.T) {
+	type op struct {
+		remove bool
+		r      string
+	}
+	tests := map[string]struct {
+		ops        []op
+		want       []string
+		wantCount  uint64
+		contains   []string
+		notContain []string
+		wantErr    bool
+	}{
+		"Sparse": {
+			ops: []op{
+				{r: "192.0.2.10-192.0.2.20"},
+				{r: "192.0.2.30-192.0.2.40"},
+				{r: "192.0.2.21-192.0.2.29"},
+				{r: "198.51.100.7"},
+			},
+			want:       []string{"192.0.2.10-192.0.2.40", "198.51.100.7-198.51.100.7"},
+			wantCount:  32,
+			contains:   []string{"192.0.2.10", "192.0.2.25", "198.51.100.7", "::ffff:192.0.2.40"},
+			notContain: []string{"192.0.2.41", "198.51.100.6", "2001:db8::"},
+		},
+		"Dense": {
+			ops: []op{
+				{r: "10.0.0.0/8"},
+				{remove: true, r: "10.1.2.0/24"},
+				{remove: true, r: "10.255.255.255"},
+				{r: "11.0.0.0/16"},
+			},
+			want:       []string{"10.0.0.0-10.1.1.255", "10.1.3.0-10.255.255.254", "11.0.0.0-11.0.255.255"},
+			wantCount:  1<<24 - 256 - 1 + 1<<16,
+			contains:   []string{"10.0.0.0", "10.1.1.255", "10.1.3.0", "11.0.255.255"},
+			notContain: []string{"10.1.2.3", "10.255.255.255", "11.1.0.0", "9.255.255.255"},
+		},
+		"BackToArray": {
+			ops: []op{
+				{r: "192.0.2.0-192.0.255.255"},
+				{remove: true, r: "192.0.3.0-192.0.255.255"},
+				{remove: true, r: "192.0.2.128/25"},
+			},
+			want:       []string{"192.0.2.0-192.0.2.127"},
+			wantCount:  128,
+			contains:   []string{"192.0.2.127"},
+			notContain: []string{"192.0.2.128", "192.0.3.0"},
+		},
+		"Edges": {
+			ops: []op{
+				{r: "0.0.0.0"},
+				{r: "255.255.255.0/24"},
+				{remove: true, r: "255.255.255.128/26"},
+			},
+			want:       []string{"0.0.0.0-0.0.0.0", "255.255.255.0-255.255.255.127", "255.255.255.192-255.255.255.255"},
+			wantCount:  193,
+			contains:   []string{"0.0.0.0", "255.255.255.255"},
+			notContain: []string{"0.0.0.1", "255.255.255.128"},
+		},
+		"IPv6": {
+			ops:     []op{{r: "2001:db8::/32"}},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var b Bitmap
+			for _, op := range test.ops {
+				r, err := Parse(op.r)
+				if err != nil {
+					t.Fatalf("parse err: %v", err)
+				}
+				if op.remove {
+					err = b.Remove(r)
+				} else {
+					err = b.Add(r)
+				}
+				if (err != nil) != test.wantErr {
+					t.Fatalf("%+v err: got %v, want error %v", op, err, test.wantErr)
+				}
+			}
+			if test.wantErr {
+				return
+			}
+
+			var ranges []string
+			for _, r := range b.Ranges() {
+				ranges = append(ranges, r.String())
+			}
+			if diff := cmp.Diff(test.want, ranges); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if diff := cmp.Diff(test.wantCount, b.Count()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			for _, ip := range test.contains {
+				if !b.Contains(net.ParseIP(ip)) {
+					t.Errorf("bitmap does not contain %s", ip)
+				}
+			}
+			for _, ip := range test.notContain {
+				if b.Contains(net.ParseIP(ip)) {
+					t.Errorf("bitmap contains %s", ip)
+				}
+			}
+
+			// The bitmap and its set must hold the same prefixes, and round trip through each other.
+			s := b.Set()
+			if diff := cmp.Diff(netStrs(s.IPNets()), netStrs(b.IPNets())); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			rt, err := s.Bitmap()
+			if err != nil {
+				t.Fatalf("bitmap err: %v", err)
+			}
+			if diff := cmp.Diff(netStrs(b.IPNets()), netStrs(rt.IPNets())); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestBitmapRandom(t *testing.T) {
+	// Scatter enough addresses through a few chunks that some become bitmaps, and check the bitmap agrees with a Set.
+	rng := rand.New(rand.NewSource(1))
+	var b Bitmap
+	var s Set
+	for i := 0; i < 20000; i++ {
+		first := 0xc0000000 | rng.Uint32()&0x3ffff
+		last := first + uint32(rng.Intn(8))
+		r := Range{First: make(net.IP, 4), Last: make(net.IP, 4)}
+		binary.BigEndian.PutUint32(r.First, first)
+		binary.BigEndian.PutUint32(r.Last, last)
+		if i%4 == 3 {
+			b.Remove(r)
+			s.Remove(r)
+		} else {
+			b.Add(r)
+			s.Add(r)
+		}
+	}
+	if diff := cmp.Diff(netStrs(s.IPNets()), netStrs(b.IPNets())); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	for i := 0; i < 10000; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, 0xc0000000|rng.Uint32()&0x3ffff)
+		if b.Contains(ip) != s.Contains(ip) {
+			t.Fatalf("bitmap and set disagree on %v", ip)
+		}
+	}
+}
+
+func TestNewMembership(t *testing.T) {
+	scattered := make([]*net.IPNet, 0, 100000)
+	for i := uint32(0); i < 100000; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, 0x0a000000|i*4)
+		scattered = append(scattered, &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+	}
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+
+	tests := map[string]struct {
+		pfxs    []*net.IPNet
+		kind    Kind
+		want    string
+		wantErr bool
+	}{
+		"AutoScattered": {pfxs: scattered, kind: KindAuto, want: "*iprange.Bitmap"},
+		"AutoFew":       {pfxs: []*net.IPNet{v4}, kind: KindAuto, want: "*iprange.Set"},
+		"AutoIPv6":      {pfxs: append([]*net.IPNet{v6}, scattered...), kind: KindAuto, want: "*iprange.Set"},
+		"Ranges":        {pfxs: scattered, kind: KindRanges, want: "*iprange.Set"},
+		"Bitmap":        {pfxs: []*net.IPNet{v4}, kind: KindBitmap, want: "*iprange.Bitmap"},
+		"BitmapIPv6":    {pfxs: []*net.IPNet{v6}, kind: KindBitmap, wantErr: true},
+		"Unknown":       {pfxs: []*net.IPNet{v4}, kind: Kind("trie"), wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := NewMembership(test.pfxs, test.kind)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, fmt.Sprintf("%T", m)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if !m.Contains(test.pfxs[len(test.pfxs)-1].IP) {
+				t.Fatalf("membership does not contain %v", test.pfxs[len(test.pfxs)-1])
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package iprange
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Class is the category of special-purpose addresses that a prefix falls into.
+type Class string
+
+// Classes of prefixes, as returned by Classify.
+const (
+	ClassGlobal        Class = "global"        // Global unicast addresses, with no special purpose.
+	ClassUnspecified   Class = "unspecified"   // The unspecified address, 0.0.0.0 or ::.
+	ClassLoopback      Class = "loopback"      // LoopbackPrefixes.
+	ClassDocumentation Class = "documentation" // DocumentationPrefixes.
+	ClassBenchmarking  Class = "benchmarking"  // BenchmarkingPrefixes.
+	ClassShared        Class = "shared"        // SharedPrefixes, used for carrier-grade NAT.
+	ClassPrivate       Class = "private"       // PrivatePrefixes.
+	ClassLinkLocal     Class = "link-local"    // LinkLocalPrefixes.
+	ClassMulticast     Class = "multicast"     // MulticastPrefixes.
+	ClassReserved      Class = "reserved"      // Other addresses that are reserved or unallocated, such as 240.0.0.0/4.
+)
+
+// ErrMixed is returned when a prefix straddles the boundary between classes or scopes.
+var ErrMixed = errors.New("prefix spans more than one class or scope")
+
+// reservedPrefixes are the addresses of ClassReserved: "this network", the IETF protocol assignments, the former class
+// E, the IPv6 discard prefix, and all IPv6 addresses outside 2000::/3 that are not covered by another class.
+var reservedPrefixes = []string{
+	"0.0.0.0/8", "192.0.0.0/24", "240.0.0.0/4",
+	"::/3", "100::/64", "4000::/2", "8000::/2", "c000::/3", "e000::/4", "f000::/5", "f800::/6", "fe00::/7",
+}
+
+// classSet is the set of addresses of a class.
+type classSet struct {
+	class Class
+	set   *Set
+}
+
+// classes are the sets of addresses of each class, other than ClassGlobal, with none in more than one.
+var classes = func() []classSet {
+	// Classes are listed in order of precedence, so that the well-known NAT64 prefix is taken to be global rather than
+	// reserved, and the unique local addresses private rather than reserved.
+	specs := []struct {
+		class Class
+		pfxs  []string
+	}{
+		{ClassUnspecified, []string{"0.0.0.0/32", "::/128"}},
+		{ClassLoopback, LoopbackPrefixes},
+		{ClassDocumentation, DocumentationPrefixes},
+		{ClassBenchmarking, BenchmarkingPrefixes},
+		{ClassShared, SharedPrefixes},
+		{ClassPrivate, PrivatePrefixes},
+		{ClassLinkLocal, LinkLocalPrefixes},
+		{ClassMulticast, MulticastPrefixes},
+		{ClassGlobal, []string{"64:ff9b::/96"}},
+		{ClassReserved, reservedPrefixes},
+	}
+	var classes []classSet
+	taken := &Set{}
+	for _, spec := range specs {
+		set := mustSet(spec.pfxs)
+		for _, r := range taken.Ranges() {
+			set.Remove(r)
+		}
+		for _, r := range set.Ranges() {
+			taken.Add(r)
+		}
+		if spec.class != ClassGlobal {
+			classes = append(classes, classSet{spec.class, set})
+		}
+	}
+	return classes
+}()
+
+// covers reports whether the set holds all of the addresses of r, and whether it holds any of them.
+func (s *Set) covers(r Range) (all, some bool) {
+	spans, first, last, err := s.family(r)
+	if err != nil {
+		return false, false
+	}
+	i := sort.Search(len(*spans), func(i int) bool { return !(*spans)[i].last.less(first) })
+	if i == len(*spans) || last.less((*spans)[i].first) {
+		return false, false
+	}
+	return !first.less((*spans)[i].first) && !(*spans)[i].last.less(last), true
+}
+
+// Classify returns the class that all of the addresses of pfx fall into, or an error wrapping ErrMixed if they fall
+// into more than one.
+func Classify(pfx *net.IPNet) (Class, error) {
+	r := FromIPNet(pfx)
+	if _, _, _, err := r.addrs(); err != nil {
+		return "", fmt.Errorf("invalid prefix %v: %w", pfx, err)
+	}
+	var partly []string
+	for _, c := range classes {
+		all, some := c.set.covers(r)
+		if all {
+			return c.class, nil
+		}
+		if some {
+			partly = append(partly, string(c.class))
+		}
+	}
+	if len(partly) > 0 {
+		return "", fmt.Errorf("%v is partly %s: %w", pfx, strings.Join(partly, ", partly "), ErrMixed)
+	}
+	return ClassGlobal, nil
+}
+
+// is reports whether all of pfx is of the given class.
+func is(pfx *net.IPNet, class Class) bool {
+	c, err := Classify(pfx)
+	return err == nil && c == class
+}
+
+// IsGlobalUnicast reports whether all of pfx is global unicast address space, with no special purpose.
+func IsGlobalUnicast(pfx *net.IPNet) bool {
+	return is(pfx, ClassGlobal)
+}
+
+// IsPrivate reports whether all of pfx is private address space.
+func IsPrivate(pfx *net.IPNet) bool {
+	return is(pfx, ClassPrivate)
+}
+
+// IsCGN reports whether all of pfx is the shared address space used for carrier-grade NAT.
+func IsCGN(pfx *net.IPNet) bool {
+	return is(pfx, ClassShared)
+}
+
+// IsDocumentation reports whether all of pfx is reserved for documentation.
+func IsDocumentation(pfx *net.IPNet) bool {
+	return is(pfx, ClassDocumentation)
+}
+
+// Scope is how far from its origin an address may be used.
+type Scope string
+
+// Scopes of prefixes, as returned by ScopeOf.
+const (
+	ScopeNone   Scope = "none"   // Not to be used on any network, such as documentation and reserved addresses.
+	ScopeHost   Scope = "host"   // Only within a host, such as loopback addresses.
+	ScopeLink   Scope = "link"   // Only on a single link, such as link-local addresses.
+	ScopeSite   Scope = "site"   // Only within a network or organisation, such as private addresses.
+	ScopeGlobal Scope = "global" // Anywhere.
+)
+
+// scopes are the scopes of each class. The scope of multicast addresses depends on the address.
+var scopes = map[Class]Scope{
+	ClassGlobal:        ScopeGlobal,
+	ClassUnspecified:   ScopeNone,
+	ClassLoopback:      ScopeHost,
+	ClassDocumentation: ScopeNone,
+	ClassBenchmarking:  ScopeSite,
+	ClassShared:        ScopeSite,
+	ClassPrivate:       ScopeSite,
+	ClassLinkLocal:     ScopeLink,
+	ClassReserved:      ScopeNone,
+}
+
+// multicastScopes are the scopes of IPv6 multicast addresses, indexed by the scope field of RFC 7346.
+var multicastScopes = [16]Scope{
+	1: ScopeHost, 2: ScopeLink, 3: ScopeSite, 4: ScopeSite, 5: ScopeSite, 8: ScopeSite, 14: ScopeGlobal,
+}
+
+// ipv4MulticastScopes are the IPv4 multicast prefixes that are not global: the local network control block of RFC
+// 5771, and the administratively scoped block of RFC 2365.
+var ipv4MulticastScopes = []struct {
+	scope Scope
+	set   *Set
+}{
+	{ScopeLink, mustSet([]string{"224.0.0.0/24"})},
+	{ScopeSite, mustSet([]string{"239.0.0.0/8"})},
+}
+
+// ScopeOf returns the scope that all of the addresses of pfx have, or an error wrapping ErrMixed if they have more
+// than one. IPv6 multicast scopes that are unassigned are taken to be ScopeNone.
+func ScopeOf(pfx *net.IPNet) (Scope, error) {
+	class, err := Classify(pfx)
+	if err != nil {
+		return "", err
+	}
+	if class != ClassMulticast {
+		return scopes[class], nil
+	}
+
+	if pfx.IP.To4() != nil {
+		r := FromIPNet(pfx)
+		for _, s := range ipv4MulticastScopes {
+			all, some := s.set.covers(r)
+			if all {
+				return s.scope, nil
+			}
+			if some {
+				return "", fmt.Errorf("%v is partly of %s scope: %w", pfx, s.scope, ErrMixed)
+			}
+		}
+		return ScopeGlobal, nil
+	}
+	if ones, _ := pfx.Mask.Size(); ones < 16 {
+		return "", fmt.Errorf("%v covers multicast addresses of every scope: %w", pfx, ErrMixed)
+	}
+	if scope := multicastScopes[pfx.IP[1]&0x0f]; scope != "" {
+		return scope, nil
+	}
+	return ScopeNone, nil
+}
@@ -0,0 +1,69 @@
+package iprange
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		want      Class
+		wantScope Scope
+		wantErr   bool
+	}{
+		"Global":        {input: "8.8.8.0/24", want: ClassGlobal, wantScope: ScopeGlobal},
+		"GlobalIPv6":    {input: "2001:4860::/32", want: ClassGlobal, wantScope: ScopeGlobal},
+		"NAT64":         {input: "64:ff9b::/96", want: ClassGlobal, wantScope: ScopeGlobal},
+		"Private":       {input: "10.20.0.0/16", want: ClassPrivate, wantScope: ScopeSite},
+		"ULA":           {input: "fd12:3456::/32", want: ClassPrivate, wantScope: ScopeSite},
+		"CGN":           {input: "100.64.0.0/10", want: ClassShared, wantScope: ScopeSite},
+		"Documentation": {input: "2001:db8:1::/48", want: ClassDocumentation, wantScope: ScopeNone},
+		"Benchmarking":  {input: "198.18.0.0/16", want: ClassBenchmarking, wantScope: ScopeSite},
+		"Loopback":      {input: "127.0.0.1/32", want: ClassLoopback, wantScope: ScopeHost},
+		"Unspecified":   {input: "::/128", want: ClassUnspecified, wantScope: ScopeNone},
+		"ThisNetwork":   {input: "0.1.0.0/16", want: ClassReserved, wantScope: ScopeNone},
+		"ClassE":        {input: "240.0.0.0/4", want: ClassReserved, wantScope: ScopeNone},
+		"Unallocated":   {input: "4000::/3", want: ClassReserved, wantScope: ScopeNone},
+		"LinkLocal":     {input: "fe80::/64", want: ClassLinkLocal, wantScope: ScopeLink},
+		"Multicast":     {input: "ff0e::/16", want: ClassMulticast, wantScope: ScopeGlobal},
+		"MulticastLink": {input: "224.0.0.0/24", want: ClassMulticast, wantScope: ScopeLink},
+		"MulticastSite": {input: "239.1.0.0/16", want: ClassMulticast, wantScope: ScopeSite},
+		"MulticastAny":  {input: "233.0.0.0/8", want: ClassMulticast, wantScope: ScopeGlobal},
+		"Straddle":      {input: "10.0.0.0/7", wantErr: true},
+		"Default":       {input: "0.0.0.0/0", wantErr: true},
+		"AllMulticast":  {input: "ff00::/8", want: ClassMulticast, wantErr: true},
+		"MulticastMix":  {input: "224.0.0.0/8", want: ClassMulticast, wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, pfx, err := net.ParseCIDR(test.input)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			class, classErr := Classify(pfx)
+			scope, err := ScopeOf(pfx)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrMixed) {
+				t.Fatalf("err: got %v, want ErrMixed", err)
+			}
+			if diff := cmp.Diff(test.want, class); diff != "" && classErr == nil {
+				t.Fatalf("%v", diff)
+			}
+			if diff := cmp.Diff(test.wantScope, scope); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if got := IsPrivate(pfx); got != (classErr == nil && test.want == ClassPrivate) {
+				t.Fatalf("IsPrivate: got %v", got)
+			}
+			if got := IsGlobalUnicast(pfx); got != (classErr == nil && test.want == ClassGlobal) {
+				t.Fatalf("IsGlobalUnicast: got %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package iprange
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/lpm"
+	"net"
+)
+
+// Pool is a set of allocated prefixes, which may be nested, such as an address plan of pools and the subnets
+// allocated from them, for finding where new addresses belong. It is not safe for concurrent modification.
+type Pool struct {
+	table *lpm.Table
+}
+
+// ErrExhausted is returned when there is no free prefix of the length asked for.
+var ErrExhausted = errors.New("no free prefix")
+
+// Fit is where an address belongs in a Pool.
+type Fit struct {
+	// Container is the smallest prefix of the pool containing the address, which is where it should be allocated
+	// from, or nil if no prefix does.
+	Container *net.IPNet
+	// Suggested is a new prefix containing the address that could be allocated, within Container and overlapping no
+	// other prefix of the pool, or nil if there is none of the length asked for.
+	Suggested *net.IPNet
+}
+
+// NewPool returns a pool of prefixes.
+func NewPool(pfxs []*net.IPNet) (*Pool, error) {
+	p := &Pool{table: lpm.New()}
+	for _, pfx := range pfxs {
+		if err := p.Add(pfx); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Add adds a prefix to the pool.
+func (p *Pool) Add(pfx *net.IPNet) error {
+	return p.table.Insert(pfx, nil)
+}
+
+// Remove removes a prefix from the pool, reporting whether it was present.
+func (p *Pool) Remove(pfx *net.IPNet) (bool, error) {
+	e, err := p.table.Remove(pfx)
+	return e != nil, err
+}
+
+// ClosestFit finds the smallest prefix of the pool containing an address, and suggests a new prefix of a length to
+// allocate for it: one within that prefix and overlapping no other. If length is zero, the largest such prefix is
+// suggested, which is the free block around the address.
+func (p *Pool) ClosestFit(ip net.IP, length int) (*Fit, error) {
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return nil, errors.New("invalid address")
+	}
+	if length < 0 || length > bits {
+		return nil, fmt.Errorf("invalid prefix length %d for %v", length, ip)
+	}
+
+	fit := &Fit{}
+	shortest := 1
+	e, err := p.table.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil {
+		fit.Container = e.Prefix
+		ones, _ := e.Prefix.Mask.Size()
+		shortest = ones + 1
+	}
+
+	lengths := []int{length}
+	if length == 0 {
+		lengths = lengths[:0]
+		for l := shortest; l <= bits; l++ {
+			lengths = append(lengths, l)
+		}
+	}
+	for _, l := range lengths {
+		if l < shortest {
+			break
+		}
+		candidate := &net.IPNet{IP: ip.Mask(net.CIDRMask(l, bits)), Mask: net.CIDRMask(l, bits)}
+		// Prefixes containing the candidate contain the address, so are the container or shorter, leaving only
+		// those within it to overlap.
+		within, err := p.table.Covered(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if len(within) == 0 {
+			fit.Suggested = candidate
+			break
+		}
+	}
+	return fit, nil
+}
+
+// Allocate adds the lowest free prefix of a length within another, which overlaps no prefix of the pool other than
+// those containing within, and returns it. Allocating from the same pool in the same order always gives the same
+// prefixes.
+func (p *Pool) Allocate(within *net.IPNet, length int) (*net.IPNet, error) {
+	ones, bits := within.Mask.Size()
+	if bits == 0 {
+		return nil, errors.New("invalid prefix")
+	}
+	if length < ones || length > bits {
+		return nil, fmt.Errorf("invalid prefix length %d within %v", length, within)
+	}
+	pfx, err := p.free(&net.IPNet{IP: within.IP.Mask(within.Mask), Mask: within.Mask}, length, true)
+	if err != nil {
+		return nil, err
+	}
+	if pfx == nil {
+		return nil, fmt.Errorf("/%d within %v: %w", length, within, ErrExhausted)
+	}
+	return pfx, p.Add(pfx)
+}
+
+// free returns the lowest prefix of a length within pfx that overlaps no prefix of the pool, or nil if there is none.
+// The pool may hold pfx itself only at the top of the search, where it is the prefix being allocated from, and so
+// cannot be allocated whole.
+func (p *Pool) free(pfx *net.IPNet, length int, top bool) (*net.IPNet, error) {
+	within, err := p.table.Covered(pfx)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := pfx.Mask.Size()
+	if len(within) > 0 {
+		// Covering prefixes are listed first, so pfx itself can only be the first.
+		if first, _ := within[0].Prefix.Mask.Size(); first == ones {
+			if !top || ones == length {
+				return nil, nil
+			}
+			within = within[1:]
+		}
+	}
+	if len(within) == 0 {
+		return &net.IPNet{IP: pfx.IP, Mask: net.CIDRMask(length, bits)}, nil
+	}
+	if ones == length {
+		return nil, nil
+	}
+	mask := net.CIDRMask(ones+1, bits)
+	upper := append(net.IP(nil), pfx.IP...)
+	upper[ones/8] |= 0x80 >> uint(ones%8)
+	for _, half := range []*net.IPNet{{IP: pfx.IP, Mask: mask}, {IP: upper, Mask: mask}} {
+		if found, err := p.free(half, length, false); found != nil || err != nil {
+			return found, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+package iprange
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestClosestFit(t *testing.T) {
+	var pfxs []*net.IPNet
+	for _, s := range []string{
+		"10.0.0.0/16", "10.0.1.0/24", "10.0.2.0/24", "10.0.4.0/22", "10.0.4.16/32", "2001:db8::/48", "2001:db8:0:1::/64",
+	} {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("parse err: %v", err)
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	pool, err := NewPool(pfxs)
+	if err != nil {
+		t.Fatalf("new pool err: %v", err)
+	}
+
+	tests := map[string]struct {
+		ip            string
+		length        int
+		wantContainer string
+		wantSuggested string
+		wantErr       bool
+	}{
+		"Subnet": {
+			ip:            "10.0.1.7",
+			length:        28,
+			wantContainer: "10.0.1.0/24",
+			wantSuggested: "10.0.1.0/28",
+		},
+		"Free": {
+			ip:            "10.0.3.9",
+			length:        24,
+			wantContainer: "10.0.0.0/16",
+			wantSuggested: "10.0.3.0/24",
+		},
+		"Largest": {
+			ip:            "10.0.3.9",
+			wantContainer: "10.0.0.0/16",
+			wantSuggested: "10.0.3.0/24",
+		},
+		"LargestHigh": {
+			ip:            "10.0.200.1",
+			wantContainer: "10.0.0.0/16",
+			wantSuggested: "10.0.128.0/17",
+		},
+		"Overlapping": {
+			ip:            "10.0.3.9",
+			length:        22,
+			wantContainer: "10.0.0.0/16",
+		},
+		"AroundHost": {
+			ip:            "10.0.4.17",
+			wantContainer: "10.0.4.0/22",
+			wantSuggested: "10.0.4.17/32",
+		},
+		"Allocated": {
+			ip:            "10.0.4.16",
+			wantContainer: "10.0.4.16/32",
+		},
+		"TooShort": {
+			ip:            "10.0.3.9",
+			length:        16,
+			wantContainer: "10.0.0.0/16",
+		},
+		"Outside": {
+			ip:            "192.0.2.1",
+			length:        24,
+			wantSuggested: "192.0.2.0/24",
+		},
+		"IPv6": {
+			ip:            "2001:db8:0:2::1",
+			length:        64,
+			wantContainer: "2001:db8::/48",
+			wantSuggested: "2001:db8:0:2::/64",
+		},
+		"IPv6Largest": {
+			ip:            "2001:db8:0:2::1",
+			wantContainer: "2001:db8::/48",
+			wantSuggested: "2001:db8:0:2::/63",
+		},
+		"InvalidLength": {
+			ip:      "10.0.3.9",
+			length:  33,
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fit, err := pool.ClosestFit(net.ParseIP(test.ip), test.length)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("closest fit err: %v", err)
+			}
+			got := [2]string{}
+			for i, pfx := range []*net.IPNet{fit.Container, fit.Suggested} {
+				if pfx != nil {
+					got[i] = pfx.String()
+				}
+			}
+			if diff := cmp.Diff([2]string{test.wantContainer, test.wantSuggested}, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package iprange
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// v4Offset is the number of bits preceding an IPv4 address in its 16 byte form.
+const v4Offset = 96
+
+// addr is an address in its 16 byte form, which is compared and incremented as a 128 bit number.
+type addr [net.IPv6len]byte
+
+// toAddr converts ip to its 16 byte form, reporting whether it is IPv4. A nil or invalid ip gives ok false.
+func toAddr(ip net.IP) (a addr, v4 bool, ok bool) {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return a, false, false
+	}
+	copy(a[:], ip16)
+	return a, ip.To4() != nil, true
+}
+
+// ip returns the address as a net.IP, in its 4 byte form for IPv4.
+func (a addr) ip(v4 bool) net.IP {
+	ip := append(net.IP(nil), a[:]...)
+	if v4 {
+		return ip.To4()
+	}
+	return ip
+}
+
+// less reports whether a is lower than b.
+func (a addr) less(b addr) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
+
+// next returns the address after a, and false if a is the last address.
+func (a addr) next() (addr, bool) {
+	for i := len(a) - 1; i >= 0; i-- {
+		a[i]++
+		if a[i] != 0 {
+			return a, true
+		}
+	}
+	return a, false
+}
+
+// prev returns the address before a, and false if a is the first address.
+func (a addr) prev() (addr, bool) {
+	for i := len(a) - 1; i >= 0; i-- {
+		a[i]--
+		if a[i] != 0xff {
+			return a, true
+		}
+	}
+	return a, false
+}
+
+// last returns the last address of the prefix of the given length, out of 128 bits, that starts at a.
+func (a addr) last(ones int) addr {
+	for i := ones; i < 8*len(a); i++ {
+		a[i/8] |= 0x80 >> uint(i%8)
+	}
+	return a
+}
+
+// trailingZeros returns the number of trailing zero bits in a.
+func (a addr) trailingZeros() int {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i] != 0 {
+			n := 8 * (len(a) - 1 - i)
+			for b := a[i]; b&1 == 0; b >>= 1 {
+				n++
+			}
+			return n
+		}
+	}
+	return 8 * len(a)
+}
+
+// Range is an inclusive range of addresses of a single family.
+type Range struct {
+	First net.IP
+	Last  net.IP
+}
+
+// Parse parses a range written as first-last, a prefix in CIDR notation, or a single address.
+func Parse(s string) (Range, error) {
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		r := Range{First: net.ParseIP(strings.TrimSpace(s[:i])), Last: net.ParseIP(strings.TrimSpace(s[i+1:]))}
+		if r.First == nil || r.Last == nil {
+			return Range{}, fmt.Errorf("invalid range %q", s)
+		}
+		if _, _, _, err := r.addrs(); err != nil {
+			return Range{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		return r.canonical(), nil
+	}
+	if strings.Contains(s, "/") {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			return Range{}, err
+		}
+		return FromIPNet(pfx), nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return Range{}, fmt.Errorf("invalid address %q", s)
+	}
+	return Range{First: ip, Last: ip}.canonical(), nil
+}
+
+// FromIPNet returns the range of addresses covered by a prefix.
+func FromIPNet(pfx *net.IPNet) Range {
+	first := pfx.IP.Mask(pfx.Mask)
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^pfx.Mask[i]
+	}
+	return Range{First: first, Last: last}
+}
+
+// canonical returns the range with IPv4 addresses in their 4 byte form.
+func (r Range) canonical() Range {
+	if ip4 := r.First.To4(); ip4 != nil {
+		return Range{First: ip4, Last: r.Last.To4()}
+	}
+	return r
+}
+
+// addrs validates the range, returning its bounds in 16 byte form, and whether it is IPv4.
+func (r Range) addrs() (first, last addr, v4 bool, err error) {
+	first, v4, ok := toAddr(r.First)
+	if !ok {
+		return first, last, false, errors.New("invalid first address")
+	}
+	last, lastV4, ok := toAddr(r.Last)
+	if !ok {
+		return first, last, false, errors.New("invalid last address")
+	}
+	if v4 != lastV4 {
+		return first, last, false, errors.New("mixed address families")
+	}
+	if last.less(first) {
+		return first, last, false, errors.New("last address before first")
+	}
+	return first, last, v4, nil
+}
+
+// String returns the range as first-last.
+func (r Range) String() string {
+	return r.First.String() + "-" + r.Last.String()
+}
+
+// Contains reports whether ip is within the range.
+func (r Range) Contains(ip net.IP) bool {
+	first, last, v4, err := r.addrs()
+	a, ipV4, ok := toAddr(ip)
+	return err == nil && ok && v4 == ipV4 && !a.less(first) && !last.less(a)
+}
+
+// IPNets returns the smallest list of prefixes that covers exactly the range, in order, or nil if the range is invalid.
+func (r Range) IPNets() []*net.IPNet {
+	first, last, v4, err := r.addrs()
+	if err != nil {
+		return nil
+	}
+	return ipNets(nil, first, last, v4)
+}
+
+// ipNets appends the prefixes covering first to last to pfxs. Each is the largest prefix that starts at the first
+// address not yet covered and does not extend beyond the last.
+func ipNets(pfxs []*net.IPNet, first, last addr, v4 bool) []*net.IPNet {
+	bits, offset := 8*net.IPv6len, 0
+	if v4 {
+		bits, offset = 8*net.IPv4len, v4Offset
+	}
+	for {
+		ones := 8*net.IPv6len - first.trailingZeros()
+		if ones < offset {
+			ones = offset
+		}
+		for last.less(first.last(ones)) {
+			ones++
+		}
+		pfxs = append(pfxs, &net.IPNet{IP: first.ip(v4), Mask: net.CIDRMask(ones-offset, bits)})
+		next, ok := first.last(ones).next()
+		if !ok || last.less(next) {
+			return pfxs
+		}
+		first = next
+	}
+}
+
+// span is a range held by a Set.
+type span struct {
+	first, last addr
+}
+
+// Set is a set of addresses of both families, held as sorted, disjoint ranges. Ranges that overlap or are adjacent
+// are merged as they are added. As in the net package, IPv4-mapped IPv6 addresses are taken as IPv4. The zero value is
+// an empty set.
+type Set struct {
+	v4, v6 []span
+}
+
+// FromIPNets returns a set of the addresses covered by the prefixes.
+func FromIPNets(pfxs []*net.IPNet) *Set {
+	s := &Set{}
+	for _, pfx := range pfxs {
+		s.Add(FromIPNet(pfx))
+	}
+	return s
+}
+
+// family returns the spans of the family of r, with the bounds of r.
+func (s *Set) family(r Range) (spans *[]span, first, last addr, err error) {
+	first, last, v4, err := r.addrs()
+	if err != nil {
+		return nil, first, last, fmt.Errorf("invalid range %v: %w", r, err)
+	}
+	if v4 {
+		return &s.v4, first, last, nil
+	}
+	return &s.v6, first, last, nil
+}
+
+// Add adds the addresses of r to the set.
+func (s *Set) Add(r Range) error {
+	spans, first, last, err := s.family(r)
+	if err != nil {
+		return err
+	}
+
+	// Find the spans that overlap or are adjacent to the new one, and replace them all with their union.
+	before, hasBefore := first.prev()
+	after, hasAfter := last.next()
+	i := sort.Search(len(*spans), func(i int) bool { return !hasBefore || !(*spans)[i].last.less(before) })
+	j := sort.Search(len(*spans), func(j int) bool { return hasAfter && after.less((*spans)[j].first) })
+	if i < j {
+		if (*spans)[i].first.less(first) {
+			first = (*spans)[i].first
+		}
+		if last.less((*spans)[j-1].last) {
+			last = (*spans)[j-1].last
+		}
+	}
+	merged := append([]span{{first, last}}, (*spans)[j:]...)
+	*spans = append((*spans)[:i], merged...)
+	return nil
+}
+
+// Remove removes the addresses of r from the set.
+func (s *Set) Remove(r Range) error {
+	spans, first, last, err := s.family(r)
+	if err != nil {
+		return err
+	}
+
+	// Find the spans that overlap the removed range, and replace them with what is left of the first and last.
+	i := sort.Search(len(*spans), func(i int) bool { return !(*spans)[i].last.less(first) })
+	j := sort.Search(len(*spans), func(j int) bool { return last.less((*spans)[j].first) })
+	if i >= j {
+		return nil
+	}
+	var left []span
+	if (*spans)[i].first.less(first) {
+		end, _ := first.prev()
+		left = append(left, span{(*spans)[i].first, end})
+	}
+	if last.less((*spans)[j-1].last) {
+		start, _ := last.next()
+		left = append(left, span{start, (*spans)[j-1].last})
+	}
+	left = append(left, (*spans)[j:]...)
+	*spans = append((*spans)[:i], left...)
+	return nil
+}
+
+// AddIPNet adds the addresses covered by a prefix to the set.
+func (s *Set) AddIPNet(pfx *net.IPNet) error {
+	return s.Add(FromIPNet(pfx))
+}
+
+// RemoveIPNet removes the addresses covered by a prefix from the set.
+func (s *Set) RemoveIPNet(pfx *net.IPNet) error {
+	return s.Remove(FromIPNet(pfx))
+}
+
+// Contains reports whether ip is in the set.
+func (s *Set) Contains(ip net.IP) bool {
+	a, v4, ok := toAddr(ip)
+	if !ok {
+		return false
+	}
+	spans := s.v6
+	if v4 {
+		spans = s.v4
+	}
+	i := sort.Search(len(spans), func(i int) bool { return !spans[i].last.less(a) })
+	return i < len(spans) && !a.less(spans[i].first)
+}
+
+// Len returns the number of ranges in the set.
+func (s *Set) Len() int {
+	return len(s.v4) + len(s.v6)
+}
+
+// Each calls fn with each range of the set in order, IPv4 first, until it returns false.
+func (s *Set) Each(fn func(Range) bool) {
+	for _, family := range []struct {
+		spans []span
+		v4    bool
+	}{{s.v4, true}, {s.v6, false}} {
+		for _, sp := range family.spans {
+			if !fn(Range{First: sp.first.ip(family.v4), Last: sp.last.ip(family.v4)}) {
+				return
+			}
+		}
+	}
+}
+
+// Ranges returns the ranges of the set in order, IPv4 first.
+func (s *Set) Ranges() []Range {
+	ranges := make([]Range, 0, s.Len())
+	s.Each(func(r Range) bool {
+		ranges = append(ranges, r)
+		return true
+	})
+	return ranges
+}
+
+// IPNets returns the smallest list of prefixes that covers exactly the addresses of the set, in order, IPv4 first.
+func (s *Set) IPNets() []*net.IPNet {
+	var pfxs []*net.IPNet
+	for _, sp := range s.v4 {
+		pfxs = ipNets(pfxs, sp.first, sp.last, true)
+	}
+	for _, sp := range s.v6 {
+		pfxs = ipNets(pfxs, sp.first, sp.last, false)
+	}
+	return pfxs
+}
+
+// Union returns a set of the addresses in either s or o.
+func (s *Set) Union(o *Set) *Set {
+	u := &Set{v4: append([]span(nil), s.v4...), v6: append([]span(nil), s.v6...)}
+	o.Each(func(r Range) bool {
+		u.Add(r)
+		return true
+	})
+	return u
+}
+
+// Difference returns a set of the addresses in s but not in o.
+func (s *Set) Difference(o *Set) *Set {
+	d := &Set{v4: append([]span(nil), s.v4...), v6: append([]span(nil), s.v6...)}
+	o.Each(func(r Range) bool {
+		d.Remove(r)
+		return true
+	})
+	return d
+}
+
+// Overlaps reports whether any address is in both s and o.
+func (s *Set) Overlaps(o *Set) bool {
+	return overlaps(s.v4, o.v4) || overlaps(s.v6, o.v6)
+}
+
+// overlaps reports whether any address is in both a and b.
+func overlaps(a, b []span) bool {
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].last.less(b[j].first):
+			i++
+		case b[j].last.less(a[i].first):
+			j++
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Superset reports whether every address in o is also in s.
+func (s *Set) Superset(o *Set) bool {
+	return superset(s.v4, o.v4) && superset(s.v6, o.v6)
+}
+
+// superset reports whether every address in b is also in a.
+func superset(a, b []span) bool {
+	i := 0
+	for _, sp := range b {
+		for i < len(a) && a[i].last.less(sp.first) {
+			i++
+		}
+		if i == len(a) || sp.first.less(a[i].first) || a[i].last.less(sp.last) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether s and o hold the same addresses.
+func (s *Set) Equal(o *Set) bool {
+	return superset(s.v4, o.v4) && superset(o.v4, s.v4) && superset(s.v6, o.v6) && superset(o.v6, s.v6)
+}
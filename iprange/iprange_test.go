@@ -0,0 +1,321 @@
+package iprange
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+// netStrs formats prefixes for comparison.
+func netStrs(pfxs []*net.IPNet) []string {
+	var strs []string
+	for _, pfx := range pfxs {
+		strs = append(strs, pfx.String())
+	}
+	return strs
+}
+
+func TestRange(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		want     string
+		wantNets []string
+		wantErr  bool
+	}{
+		"Range": {
+			input: "192.0.2.1 - 192.0.2.130",
+			want:  "192.0.2.1-192.0.2.130",
+			wantNets: []string{
+				"192.0.2.1/32", "192.0.2.2/31", "192.0.2.4/30", "192.0.2.8/29", "192.0.2.16/28", "192.0.2.32/27",
+				"192.0.2.64/26", "192.0.2.128/31", "192.0.2.130/32",
+			},
+		},
+		"Aligned": {
+			input:    "10.0.0.0-10.255.255.255",
+			want:     "10.0.0.0-10.255.255.255",
+			wantNets: []string{"10.0.0.0/8"},
+		},
+		"Everything": {
+			input:    "0.0.0.0-255.255.255.255",
+			want:     "0.0.0.0-255.255.255.255",
+			wantNets: []string{"0.0.0.0/0"},
+		},
+		"IPv6": {
+			input:    "2001:db8::-2001:db8:1:ffff:ffff:ffff:ffff:ffff",
+			want:     "2001:db8::-2001:db8:1:ffff:ffff:ffff:ffff:ffff",
+			wantNets: []string{"2001:db8::/47"},
+		},
+		"AllIPv6": {
+			input:    "::/0",
+			want:     "::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+			wantNets: []string{"::/0"},
+		},
+		"Prefix": {
+			input:    "198.51.100.7/24",
+			want:     "198.51.100.0-198.51.100.255",
+			wantNets: []string{"198.51.100.0/24"},
+		},
+		"Address": {
+			input:    "2001:db8::1",
+			want:     "2001:db8::1-2001:db8::1",
+			wantNets: []string{"2001:db8::1/128"},
+		},
+		"Backwards": {
+			input:   "192.0.2.9-192.0.2.1",
+			wantErr: true,
+		},
+		"Mixed": {
+			input:   "192.0.2.1-2001:db8::1",
+			wantErr: true,
+		},
+		"Invalid": {
+			input:   "192.0.2.1-bogus",
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := Parse(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, r.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if diff := cmp.Diff(test.wantNets, netStrs(r.IPNets())); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if !r.Contains(r.First) || !r.Contains(r.Last) {
+				t.Fatalf("range %v does not contain its bounds", r)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	type op struct {
+		remove bool
+		r      string
+	}
+	tests := map[string]struct {
+		ops        []op
+		want       []string
+		wantNets   []string
+		contains   []string
+		notContain []string
+	}{
+		"Merge": {
+			ops: []op{
+				{r: "192.0.2.10-192.0.2.20"},
+				{r: "192.0.2.30-192.0.2.40"},
+				{r: "192.0.2.21-192.0.2.29"},
+				{r: "192.0.2.0/28"},
+			},
+			want:       []string{"192.0.2.0-192.0.2.40"},
+			wantNets:   []string{"192.0.2.0/27", "192.0.2.32/29", "192.0.2.40/32"},
+			contains:   []string{"192.0.2.0", "192.0.2.25", "192.0.2.40"},
+			notContain: []string{"192.0.2.41", "192.0.1.255", "2001:db8::"},
+		},
+		"Disjoint": {
+			ops: []op{
+				{r: "2001:db8::/48"},
+				{r: "192.0.2.128/25"},
+				{r: "192.0.2.0/26"},
+				{r: "2001:db8:2::/48"},
+			},
+			want: []string{
+				"192.0.2.0-192.0.2.63",
+				"192.0.2.128-192.0.2.255",
+				"2001:db8::-2001:db8:0:ffff:ffff:ffff:ffff:ffff",
+				"2001:db8:2::-2001:db8:2:ffff:ffff:ffff:ffff:ffff",
+			},
+			wantNets:   []string{"192.0.2.0/26", "192.0.2.128/25", "2001:db8::/48", "2001:db8:2::/48"},
+			contains:   []string{"192.0.2.63", "192.0.2.128", "2001:db8:2::1"},
+			notContain: []string{"192.0.2.64", "2001:db8:1::1", "10.0.0.1"},
+		},
+		"Remove": {
+			ops: []op{
+				{r: "10.0.0.0/8"},
+				{remove: true, r: "10.1.2.0/24"},
+				{remove: true, r: "9.0.0.0-10.0.255.255"},
+				{remove: true, r: "10.255.255.255"},
+			},
+			want:       []string{"10.1.0.0-10.1.1.255", "10.1.3.0-10.255.255.254"},
+			contains:   []string{"10.1.1.255", "10.1.3.0"},
+			notContain: []string{"10.0.0.1", "10.1.2.3", "10.255.255.255"},
+		},
+		"RemoveSpanning": {
+			ops: []op{
+				{r: "192.0.2.0-192.0.2.10"},
+				{r: "192.0.2.20-192.0.2.30"},
+				{r: "192.0.2.40-192.0.2.50"},
+				{remove: true, r: "192.0.2.5-192.0.2.45"},
+				{remove: true, r: "2001:db8::/32"},
+			},
+			want:     []string{"192.0.2.0-192.0.2.4", "192.0.2.46-192.0.2.50"},
+			wantNets: []string{"192.0.2.0/30", "192.0.2.4/32", "192.0.2.46/31", "192.0.2.48/31", "192.0.2.50/32"},
+		},
+		"Edges": {
+			ops: []op{
+				{r: "::-::ffff"},
+				{r: "8000::/1"},
+				{remove: true, r: "::"},
+				{remove: true, r: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+				{r: "0.0.0.0"},
+				{r: "255.255.255.255"},
+			},
+			want: []string{
+				"0.0.0.0-0.0.0.0",
+				"255.255.255.255-255.255.255.255",
+				"::1-::ffff",
+				"8000::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe",
+			},
+			contains:   []string{"::1", "8000::", "0.0.0.0"},
+			notContain: []string{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "0.0.0.1"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var s Set
+			for _, op := range test.ops {
+				r, err := Parse(op.r)
+				if err != nil {
+					t.Fatalf("parse err: %v", err)
+				}
+				if op.remove {
+					err = s.Remove(r)
+				} else {
+					err = s.Add(r)
+				}
+				if err != nil {
+					t.Fatalf("%+v err: %v", op, err)
+				}
+			}
+
+			var ranges []string
+			for _, r := range s.Ranges() {
+				ranges = append(ranges, r.String())
+			}
+			if diff := cmp.Diff(test.want, ranges); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if test.wantNets != nil {
+				if diff := cmp.Diff(test.wantNets, netStrs(s.IPNets())); diff != "" {
+					t.Fatalf("%v", diff)
+				}
+			}
+
+			// Converting to prefixes and back gives the same set.
+			var roundTrip []string
+			for _, r := range FromIPNets(s.IPNets()).Ranges() {
+				roundTrip = append(roundTrip, r.String())
+			}
+			if diff := cmp.Diff(ranges, roundTrip); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			for _, ip := range test.contains {
+				if !s.Contains(net.ParseIP(ip)) {
+					t.Fatalf("set does not contain %s", ip)
+				}
+			}
+			for _, ip := range test.notContain {
+				if s.Contains(net.ParseIP(ip)) {
+					t.Fatalf("set contains %s", ip)
+				}
+			}
+		})
+	}
+}
+
+func TestSetRelations(t *testing.T) {
+	set := func(strs ...string) *Set {
+		s := &Set{}
+		for _, str := range strs {
+			r, err := Parse(str)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			s.Add(r)
+		}
+		return s
+	}
+	tests := map[string]struct {
+		a, b         *Set
+		wantUnion    []string
+		wantDiff     []string
+		wantOverlaps bool
+		wantSuper    bool
+		wantEqual    bool
+	}{
+		"Disjoint": {
+			a:         set("192.0.2.0/25"),
+			b:         set("192.0.2.128/25", "2001:db8::/32"),
+			wantUnion: []string{"192.0.2.0/24", "2001:db8::/32"},
+			wantDiff:  []string{"192.0.2.0/25"},
+		},
+		"Subset": {
+			a:         set("10.0.0.0/8", "2001:db8::/32"),
+			b:         set("10.1.0.0/16", "10.3.0.0/16", "2001:db8:1::/48"),
+			wantUnion: []string{"10.0.0.0/8", "2001:db8::/32"},
+			wantDiff: []string{
+				"10.0.0.0/16", "10.2.0.0/16", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11",
+				"10.64.0.0/10", "10.128.0.0/9", "2001:db8::/48", "2001:db8:2::/47", "2001:db8:4::/46",
+				"2001:db8:8::/45", "2001:db8:10::/44", "2001:db8:20::/43", "2001:db8:40::/42", "2001:db8:80::/41",
+				"2001:db8:100::/40", "2001:db8:200::/39", "2001:db8:400::/38", "2001:db8:800::/37",
+				"2001:db8:1000::/36", "2001:db8:2000::/35", "2001:db8:4000::/34", "2001:db8:8000::/33",
+			},
+			wantOverlaps: true,
+			wantSuper:    true,
+		},
+		"Partial": {
+			a:            set("10.0.0.0/9"),
+			b:            set("10.64.0.0/10", "10.128.0.0/9"),
+			wantUnion:    []string{"10.0.0.0/8"},
+			wantDiff:     []string{"10.0.0.0/10"},
+			wantOverlaps: true,
+		},
+		"Equal": {
+			a:            set("192.0.2.0/25", "192.0.2.128/25"),
+			b:            set("192.0.2.0/24"),
+			wantUnion:    []string{"192.0.2.0/24"},
+			wantOverlaps: true,
+			wantSuper:    true,
+			wantEqual:    true,
+		},
+		"Empty": {
+			a:         set("192.0.2.0/24"),
+			b:         set(),
+			wantUnion: []string{"192.0.2.0/24"},
+			wantDiff:  []string{"192.0.2.0/24"},
+			wantSuper: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(test.wantUnion, netStrs(test.a.Union(test.b).IPNets())); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if diff := cmp.Diff(test.wantDiff, netStrs(test.a.Difference(test.b).IPNets())); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if got := test.a.Overlaps(test.b); got != test.wantOverlaps {
+				t.Fatalf("Overlaps: got %v, want %v", got, test.wantOverlaps)
+			}
+			if got := test.b.Overlaps(test.a); got != test.wantOverlaps {
+				t.Fatalf("reverse Overlaps: got %v, want %v", got, test.wantOverlaps)
+			}
+			if got := test.a.Superset(test.b); got != test.wantSuper {
+				t.Fatalf("Superset: got %v, want %v", got, test.wantSuper)
+			}
+			if got := test.a.Equal(test.b); got != test.wantEqual {
+				t.Fatalf("Equal: got %v, want %v", got, test.wantEqual)
+			}
+		})
+	}
+}
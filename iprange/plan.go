@@ -0,0 +1,135 @@
+package iprange
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Requirement is a named group of prefixes of one length, such as loopbacks or point-to-point links.
+type Requirement struct {
+	Name   string
+	Length int // The length of each prefix.
+	Count  int // The number of prefixes needed now.
+}
+
+// String formats the requirement as it is parsed, such as "p2p:/31 x500".
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s:/%d x%d", r.Name, r.Length, r.Count)
+}
+
+// ParseRequirements parses requirements separated by commas or new lines, each written as name:/length followed by
+// an optional xcount, such as "loopbacks:/32 x200, p2p:/31 x500, lan:/24 x40". The count defaults to one.
+func ParseRequirements(s string) ([]Requirement, error) {
+	var reqs []Requirement
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		words := strings.Fields(field)
+		i := strings.LastIndex(words[0], ":/")
+		if i <= 0 || len(words) > 2 {
+			return nil, fmt.Errorf("invalid requirement %q", field)
+		}
+		req := Requirement{Name: words[0][:i], Count: 1}
+		var err error
+		if req.Length, err = strconv.Atoi(words[0][i+2:]); err != nil {
+			return nil, fmt.Errorf("invalid requirement %q: bad length", field)
+		}
+		if len(words) == 2 {
+			if !strings.HasPrefix(words[1], "x") {
+				return nil, fmt.Errorf("invalid requirement %q: count must be written as xN", field)
+			}
+			if req.Count, err = strconv.Atoi(words[1][1:]); err != nil || req.Count < 1 {
+				return nil, fmt.Errorf("invalid requirement %q: bad count", field)
+			}
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// Allocation is the block reserved for a requirement, and the prefixes assigned from the start of it.
+type Allocation struct {
+	Requirement
+	Block    *net.IPNet
+	Prefixes []*net.IPNet
+}
+
+// Plan is an address plan for a supernet.
+type Plan struct {
+	Supernet    *net.IPNet
+	Allocations []Allocation // In the order of the requirements.
+	Free        []*net.IPNet // The smallest list of prefixes covering the space not reserved for any requirement.
+}
+
+// NewPlan divides a supernet between requirements. Each is reserved a block with room for growth times its count
+// more prefixes, rounded up to a power of two, so 0.5 leaves room to grow by half and 0 only rounds up. Blocks are
+// allocated largest first, then in the order given, so each is aligned and the plan is the same for the same input.
+func NewPlan(supernet *net.IPNet, reqs []Requirement, growth float64) (*Plan, error) {
+	ones, bits := supernet.Mask.Size()
+	if bits == 0 {
+		return nil, errors.New("invalid supernet")
+	}
+	if growth < 0 {
+		return nil, fmt.Errorf("invalid growth %v", growth)
+	}
+	supernet = &net.IPNet{IP: supernet.IP.Mask(supernet.Mask), Mask: supernet.Mask}
+
+	blocks := make([]int, len(reqs))
+	for i, req := range reqs {
+		if req.Length < ones || req.Length > bits || req.Count < 1 {
+			return nil, fmt.Errorf("invalid requirement %v within %v", req, supernet)
+		}
+		want := math.Ceil(float64(req.Count) * (1 + growth))
+		blocks[i] = req.Length - int(math.Ceil(math.Log2(want)))
+		if blocks[i] < ones {
+			return nil, fmt.Errorf("%v needs a /%d, larger than %v", req, blocks[i], supernet)
+		}
+	}
+	order := make([]int, len(reqs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return blocks[order[i]] < blocks[order[j]] })
+
+	pool, err := NewPool([]*net.IPNet{supernet})
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Supernet: supernet, Allocations: make([]Allocation, len(reqs))}
+	var reserved []*net.IPNet
+	for _, i := range order {
+		// The pool holds the supernet as the prefix to allocate from, so a requirement alone may take all of it.
+		block := supernet
+		if blocks[i] > ones || len(reqs) > 1 {
+			if block, err = pool.Allocate(supernet, blocks[i]); err != nil {
+				return nil, fmt.Errorf("%v: %w", reqs[i], err)
+			}
+		}
+		plan.Allocations[i] = Allocation{Requirement: reqs[i], Block: block, Prefixes: subnets(block, reqs[i])}
+		reserved = append(reserved, block)
+	}
+	plan.Free = FromIPNets([]*net.IPNet{supernet}).Difference(FromIPNets(reserved)).IPNets()
+	return plan, nil
+}
+
+// subnets returns the first prefixes of a block, as many and as long as the requirement asks for.
+func subnets(block *net.IPNet, req Requirement) []*net.IPNet {
+	a, v4, _ := toAddr(block.IP)
+	bits, offset := 8*net.IPv6len, 0
+	if v4 {
+		bits, offset = 8*net.IPv4len, v4Offset
+	}
+	pfxs := make([]*net.IPNet, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		pfxs = append(pfxs, &net.IPNet{IP: a.ip(v4), Mask: net.CIDRMask(req.Length, bits)})
+		a, _ = a.last(req.Length + offset).next()
+	}
+	return pfxs
+}
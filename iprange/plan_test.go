@@ -0,0 +1,130 @@
+package iprange
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestParseRequirements(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    []Requirement
+		wantErr bool
+	}{
+		"Example": {
+			in: "loopbacks:/32 x200, p2p:/31 x500, lan:/24 x40",
+			want: []Requirement{
+				{Name: "loopbacks", Length: 32, Count: 200},
+				{Name: "p2p", Length: 31, Count: 500},
+				{Name: "lan", Length: 24, Count: 40},
+			},
+		},
+		"Lines": {
+			in:   "mgmt:/64\n\nusers:/56 x3\n",
+			want: []Requirement{{Name: "mgmt", Length: 64, Count: 1}, {Name: "users", Length: 56, Count: 3}},
+		},
+		"NoLength": {
+			in:      "lan x40",
+			wantErr: true,
+		},
+		"BadCount": {
+			in:      "lan:/24 40",
+			wantErr: true,
+		},
+		"ZeroCount": {
+			in:      "lan:/24 x0",
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseRequirements(test.in)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	_, supernet, _ := net.ParseCIDR("10.0.0.0/16")
+	reqs, err := ParseRequirements("loopbacks:/32 x200, p2p:/31 x500, lan:/24 x40")
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+
+	plan, err := NewPlan(supernet, reqs, 0.5)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	type summary struct {
+		Block       string
+		First, Last string
+		Count       int
+	}
+	var got []summary
+	for _, a := range plan.Allocations {
+		got = append(got, summary{a.Block.String(), a.Prefixes[0].String(), a.Prefixes[len(a.Prefixes)-1].String(),
+			len(a.Prefixes)})
+	}
+	want := []summary{
+		{"10.0.72.0/23", "10.0.72.0/32", "10.0.72.199/32", 200},
+		{"10.0.64.0/21", "10.0.64.0/31", "10.0.67.230/31", 500},
+		{"10.0.0.0/18", "10.0.0.0/24", "10.0.39.0/24", 40},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	var free []string
+	for _, pfx := range plan.Free {
+		free = append(free, pfx.String())
+	}
+	if diff := cmp.Diff([]string{"10.0.74.0/23", "10.0.76.0/22", "10.0.80.0/20", "10.0.96.0/19", "10.0.128.0/17"},
+		free); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	if _, err := NewPlan(supernet, reqs, 100); err == nil {
+		t.Fatalf("got no error for a plan too large")
+	}
+	if plan, err := NewPlan(supernet, reqs[2:], 4); err != nil || plan.Allocations[0].Block.String() != "10.0.0.0/16" {
+		t.Fatalf("got %v, %v, want the whole supernet", plan, err)
+	}
+	reqs = append(reqs, Requirement{Name: "big", Length: 17, Count: 2})
+	if _, err := NewPlan(supernet, reqs, 0); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("got %v, want %v", err, ErrExhausted)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	var pfxs []*net.IPNet
+	for _, s := range []string{"192.0.2.0/24", "192.0.2.0/26", "192.0.2.128/28"} {
+		_, pfx, _ := net.ParseCIDR(s)
+		pfxs = append(pfxs, pfx)
+	}
+	pool, err := NewPool(pfxs)
+	if err != nil {
+		t.Fatalf("new pool err: %v", err)
+	}
+	var got []string
+	for _, length := range []int{26, 28, 25, 27, 26} {
+		pfx, err := pool.Allocate(pfxs[0], length)
+		if err != nil {
+			got = append(got, err.Error())
+			continue
+		}
+		got = append(got, pfx.String())
+	}
+	want := []string{
+		"192.0.2.64/26", "192.0.2.144/28", "/25 within 192.0.2.0/24: no free prefix", "192.0.2.160/27",
+		"192.0.2.192/26",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
@@ -0,0 +1,161 @@
+package iprange
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// Defaults used by a SamplePolicy whose fields are not set.
+const (
+	DefaultSampleLen4 = 24
+	DefaultSampleLen6 = 48
+)
+
+// SamplePolicy describes how to choose representative addresses of a set, such as the targets of probes: a few
+// addresses from each block of a given size, such as one per /24, up to a limit.
+type SamplePolicy struct {
+	PrefixLen4 int // The length of the IPv4 blocks, or DefaultSampleLen4 if zero.
+	PrefixLen6 int // The length of the IPv6 blocks, or DefaultSampleLen6 if zero.
+	PerBlock   int // The addresses chosen from each block, or one if zero.
+	// The most addresses chosen, or no limit if zero. If there are more blocks than that allows, they are chosen
+	// evenly from across the set, counting the blocks of both families alike.
+	Max int
+	// If set, the blocks are chosen at random from evenly spaced strata, and the addresses at random from within them.
+	// Otherwise the choice is repeatable: evenly spaced blocks, and the lowest of their addresses, skipping the first of
+	// the block, which is rarely a host.
+	Rand *rand.Rand
+}
+
+// segment is the blocks of a span that are sampled from it, which excludes a first block shared with the span before.
+type segment struct {
+	v4          bool
+	first, last *big.Int // The first and last addresses of the span.
+	hostBits    uint     // Of the blocks.
+	firstBlock  *big.Int
+	count       *big.Int
+}
+
+// Sample chooses representative addresses of the set according to the policy, in order, IPv4 first. Each block is
+// sampled once, even if several of the set's ranges share it, and only from addresses in the set.
+func (s *Set) Sample(p SamplePolicy) ([]net.IP, error) {
+	len4, len6, perBlock := p.PrefixLen4, p.PrefixLen6, p.PerBlock
+	if len4 == 0 {
+		len4 = DefaultSampleLen4
+	}
+	if len6 == 0 {
+		len6 = DefaultSampleLen6
+	}
+	if perBlock <= 0 {
+		perBlock = 1
+	}
+	if len4 < 0 || len4 > 8*net.IPv4len || len6 < 0 || len6 > 8*net.IPv6len {
+		return nil, fmt.Errorf("invalid sample prefix lengths /%d and /%d", len4, len6)
+	}
+
+	var segments []segment
+	total := new(big.Int)
+	for _, family := range []struct {
+		spans    []span
+		v4       bool
+		hostBits uint
+	}{{s.v4, true, uint(8*net.IPv4len - len4)}, {s.v6, false, uint(8*net.IPv6len - len6)}} {
+		var prevBlock *big.Int
+		for _, sp := range family.spans {
+			seg := segment{v4: family.v4, hostBits: family.hostBits}
+			seg.first, seg.last = new(big.Int).SetBytes(sp.first[:]), new(big.Int).SetBytes(sp.last[:])
+			seg.firstBlock = new(big.Int).Rsh(seg.first, seg.hostBits)
+			lastBlock := new(big.Int).Rsh(seg.last, seg.hostBits)
+			if prevBlock != nil && seg.firstBlock.Cmp(prevBlock) == 0 {
+				seg.firstBlock.Add(seg.firstBlock, big.NewInt(1))
+			}
+			prevBlock = lastBlock
+			seg.count = new(big.Int).Sub(lastBlock, seg.firstBlock)
+			if seg.count.Add(seg.count, big.NewInt(1)).Sign() <= 0 {
+				continue
+			}
+			total.Add(total, seg.count)
+			segments = append(segments, seg)
+		}
+	}
+
+	// Choose k blocks, the ith from the ith of k equal strata of the blocks.
+	k := new(big.Int).Set(total)
+	if p.Max > 0 {
+		if limit := big.NewInt(int64((p.Max + perBlock - 1) / perBlock)); limit.Cmp(total) < 0 {
+			k = limit
+		}
+	}
+	var ips []net.IP
+	seg, base := 0, new(big.Int) // The segment holding the current block, and the index of its first block.
+	for i := new(big.Int); i.Cmp(k) < 0; i.Add(i, big.NewInt(1)) {
+		index := new(big.Int).Mul(i, total)
+		if p.Rand != nil {
+			index.Add(index, new(big.Int).Rand(p.Rand, total))
+		}
+		index.Div(index, k)
+		for new(big.Int).Add(base, segments[seg].count).Cmp(index) <= 0 {
+			base.Add(base, segments[seg].count)
+			seg++
+		}
+		block := new(big.Int).Sub(index, base)
+		ips = segments[seg].sample(block.Add(block, segments[seg].firstBlock), perBlock, p.Rand, ips)
+	}
+	if p.Max > 0 && len(ips) > p.Max {
+		ips = ips[:p.Max]
+	}
+	return ips, nil
+}
+
+// sample appends up to n addresses of the segment from the given block.
+func (seg *segment) sample(block *big.Int, n int, rnd *rand.Rand, ips []net.IP) []net.IP {
+	start := new(big.Int).Lsh(block, seg.hostBits)
+	lo, hi := new(big.Int).Set(start), new(big.Int).Lsh(big.NewInt(1), seg.hostBits)
+	hi.Add(hi, start).Sub(hi, big.NewInt(1))
+	if lo.Cmp(seg.first) < 0 {
+		lo.Set(seg.first)
+	}
+	if hi.Cmp(seg.last) > 0 {
+		hi.Set(seg.last)
+	}
+	size := new(big.Int).Sub(hi, lo)
+	size.Add(size, big.NewInt(1))
+	if size.Cmp(big.NewInt(int64(n))) <= 0 {
+		rnd = nil // Every address is chosen.
+	} else if lo.Cmp(start) == 0 {
+		// Skip the first address of the block.
+		lo.Add(lo, big.NewInt(1))
+		size.Sub(size, big.NewInt(1))
+	}
+
+	if rnd == nil {
+		for a := lo; n > 0 && a.Cmp(hi) <= 0; a.Add(a, big.NewInt(1)) {
+			ips = append(ips, seg.ip(a))
+			n--
+		}
+		return ips
+	}
+	seen := map[string]bool{}
+	var chosen []*big.Int
+	for len(chosen) < n {
+		a := new(big.Int).Rand(rnd, size)
+		if key := a.String(); !seen[key] {
+			seen[key] = true
+			chosen = append(chosen, a.Add(a, lo))
+		}
+	}
+	sort.Slice(chosen, func(i, j int) bool { return chosen[i].Cmp(chosen[j]) < 0 })
+	for _, a := range chosen {
+		ips = append(ips, seg.ip(a))
+	}
+	return ips
+}
+
+// ip converts an address to a net.IP of the segment's family.
+func (seg *segment) ip(a *big.Int) net.IP {
+	var b addr
+	a.FillBytes(b[:])
+	return b.ip(seg.v4)
+}
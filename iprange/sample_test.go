@@ -0,0 +1,114 @@
+package iprange
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	tests := map[string]struct {
+		ranges  []string
+		policy  SamplePolicy
+		want    []string
+		wantErr bool
+	}{
+		"PerBlock": {
+			ranges: []string{"192.0.2.0/23", "2001:db8::/47"},
+			want:   []string{"192.0.2.1", "192.0.3.1", "2001:db8::1", "2001:db8:1::1"},
+		},
+		"SharedBlock": {
+			// The ranges share 198.51.100.0/24, which is only sampled from the first.
+			ranges: []string{"198.51.100.10-198.51.100.20", "198.51.100.30-198.51.101.5"},
+			want:   []string{"198.51.100.10", "198.51.101.1"},
+		},
+		"Several": {
+			ranges: []string{"192.0.2.0/24", "203.0.113.7"},
+			policy: SamplePolicy{PerBlock: 3},
+			want:   []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "203.0.113.7"},
+		},
+		"Spread": {
+			ranges: []string{"10.0.0.0/16"},
+			policy: SamplePolicy{Max: 4},
+			want:   []string{"10.0.0.1", "10.0.64.1", "10.0.128.1", "10.0.192.1"},
+		},
+		"SpreadAcrossFamilies": {
+			ranges: []string{"10.0.0.0/23", "2001:db8::/46"},
+			policy: SamplePolicy{Max: 3, PerBlock: 2},
+			want:   []string{"10.0.0.1", "10.0.0.2", "2001:db8:1::1"},
+		},
+		"Lengths": {
+			ranges: []string{"192.0.2.0/30", "2001:db8::/126"},
+			policy: SamplePolicy{PrefixLen4: 32, PrefixLen6: 127},
+			want:   []string{"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3", "2001:db8::1", "2001:db8::3"},
+		},
+		"Empty": {},
+		"InvalidLength": {
+			policy:  SamplePolicy{PrefixLen4: 33},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &Set{}
+			for _, str := range test.ranges {
+				r, err := Parse(str)
+				if err != nil {
+					t.Fatalf("parse err: %v", err)
+				}
+				s.Add(r)
+			}
+			ips, err := s.Sample(test.policy)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("got err %v, want error %v", err, test.wantErr)
+			}
+			var got []string
+			for _, ip := range ips {
+				got = append(got, ip.String())
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestSampleRandom(t *testing.T) {
+	s := &Set{}
+	_, pfx, _ := net.ParseCIDR("2001:db8::/32")
+	s.AddIPNet(pfx)
+	_, pfx, _ = net.ParseCIDR("10.0.0.0/10")
+	s.AddIPNet(pfx)
+
+	ips, err := s.Sample(SamplePolicy{Max: 100, PerBlock: 2, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(ips) != 100 {
+		t.Fatalf("got %d addresses, want 100", len(ips))
+	}
+	// The /10 holds a fifth of the blocks, so a fifth of the addresses.
+	blocks := map[string]int{}
+	v4 := 0
+	for _, ip := range ips {
+		if !s.Contains(ip) {
+			t.Fatalf("got %v, outside the set", ip)
+		}
+		bits := 48
+		if ip.To4() != nil {
+			bits = 24
+			v4++
+		}
+		blocks[ip.Mask(net.CIDRMask(bits, 8*len(ip))).String()]++
+	}
+	if v4 != 20 {
+		t.Errorf("got %d IPv4 addresses, want 20", v4)
+	}
+	for block, n := range blocks {
+		if n != 2 {
+			t.Errorf("got %d addresses from %v, want 2", n, block)
+		}
+	}
+}
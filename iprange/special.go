@@ -0,0 +1,70 @@
+package iprange
+
+import "net"
+
+// Special-purpose prefixes of both families, as registered by IANA. Where a purpose has no IPv6 equivalent, only the
+// IPv4 prefixes are listed.
+var (
+	// PrivatePrefixes are the private-use prefixes of RFC 1918, and the unique local addresses of RFC 4193.
+	PrivatePrefixes = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+	// SharedPrefixes are the shared address space of RFC 6598, used for carrier-grade NAT.
+	SharedPrefixes = []string{"100.64.0.0/10"}
+	// DocumentationPrefixes are reserved for examples in documentation by RFC 5737, RFC 3849, and RFC 9637.
+	DocumentationPrefixes = []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32", "3fff::/20"}
+	// BenchmarkingPrefixes are reserved for benchmarking network devices by RFC 2544 and RFC 5180.
+	BenchmarkingPrefixes = []string{"198.18.0.0/15", "2001:2::/48"}
+	// MulticastPrefixes are the multicast ranges of RFC 5771 and RFC 4291.
+	MulticastPrefixes = []string{"224.0.0.0/4", "ff00::/8"}
+	// LinkLocalPrefixes are the link-local unicast ranges of RFC 3927 and RFC 4291.
+	LinkLocalPrefixes = []string{"169.254.0.0/16", "fe80::/10"}
+	// LoopbackPrefixes are the loopback ranges of RFC 1122 and RFC 4291.
+	LoopbackPrefixes = []string{"127.0.0.0/8", "::1/128"}
+)
+
+// Private returns a set of PrivatePrefixes.
+func Private() *Set {
+	return mustSet(PrivatePrefixes)
+}
+
+// Shared returns a set of SharedPrefixes.
+func Shared() *Set {
+	return mustSet(SharedPrefixes)
+}
+
+// Documentation returns a set of DocumentationPrefixes.
+func Documentation() *Set {
+	return mustSet(DocumentationPrefixes)
+}
+
+// Benchmarking returns a set of BenchmarkingPrefixes.
+func Benchmarking() *Set {
+	return mustSet(BenchmarkingPrefixes)
+}
+
+// Multicast returns a set of MulticastPrefixes.
+func Multicast() *Set {
+	return mustSet(MulticastPrefixes)
+}
+
+// LinkLocal returns a set of LinkLocalPrefixes.
+func LinkLocal() *Set {
+	return mustSet(LinkLocalPrefixes)
+}
+
+// Loopback returns a set of LoopbackPrefixes.
+func Loopback() *Set {
+	return mustSet(LoopbackPrefixes)
+}
+
+// mustSet returns a set of prefixes that are known to be valid, panicking if one is not.
+func mustSet(strs []string) *Set {
+	s := &Set{}
+	for _, str := range strs {
+		_, pfx, err := net.ParseCIDR(str)
+		if err != nil {
+			panic(err)
+		}
+		s.AddIPNet(pfx)
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package iprange
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSpecial(t *testing.T) {
+	tests := map[string]struct {
+		set        *Set
+		contains   []string
+		notContain []string
+	}{
+		"Private": {
+			set:        Private(),
+			contains:   []string{"10.1.2.3", "172.31.255.255", "192.168.0.1", "fd00::1"},
+			notContain: []string{"172.32.0.0", "100.64.0.1", "fe80::1"},
+		},
+		"Shared": {
+			set:        Shared(),
+			contains:   []string{"100.64.0.0", "100.127.255.255"},
+			notContain: []string{"100.128.0.0", "10.0.0.1"},
+		},
+		"Documentation": {
+			set:        Documentation(),
+			contains:   []string{"192.0.2.1", "198.51.100.1", "203.0.113.1", "2001:db8::1", "3fff:fff::1"},
+			notContain: []string{"192.0.3.1", "2001:db9::1"},
+		},
+		"Benchmarking": {
+			set:        Benchmarking(),
+			contains:   []string{"198.18.0.1", "198.19.255.255", "2001:2::1"},
+			notContain: []string{"198.20.0.0", "2001:2:1::1"},
+		},
+		"Multicast": {
+			set:        Multicast(),
+			contains:   []string{"224.0.0.1", "239.255.255.250", "ff02::1"},
+			notContain: []string{"240.0.0.1", "fe80::1"},
+		},
+		"LinkLocal": {
+			set:        LinkLocal(),
+			contains:   []string{"169.254.1.1", "fe80::1"},
+			notContain: []string{"169.255.0.0", "fec0::1"},
+		},
+		"Loopback": {
+			set:        Loopback(),
+			contains:   []string{"127.0.0.1", "::1"},
+			notContain: []string{"128.0.0.1", "::2"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, ip := range test.contains {
+				if !test.set.Contains(net.ParseIP(ip)) {
+					t.Errorf("set does not contain %s", ip)
+				}
+			}
+			for _, ip := range test.notContain {
+				if test.set.Contains(net.ParseIP(ip)) {
+					t.Errorf("set contains %s", ip)
+				}
+			}
+		})
+	}
+}
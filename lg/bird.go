@@ -0,0 +1,69 @@
+package lg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/bgp"
+	"net"
+	"strings"
+)
+
+// BIRD returns a BGP function that looks up routes from the BIRD daemon listening on the control socket at path, such
+// as /run/bird/bird.ctl. The session is restricted, as with birdc -r, so that only read-only commands are accepted.
+func BIRD(path string) BGPFunc {
+	return func(ctx context.Context, pfx *net.IPNet) ([]bgp.Route, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", path)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		r := bufio.NewReader(conn)
+		if _, err := birdReply(r); err != nil {
+			return nil, err
+		}
+		for _, cmd := range []string{"restrict", "show route all for " + pfx.String()} {
+			if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+				return nil, err
+			}
+			out, err := birdReply(r)
+			if err != nil && err.Error() == "Network not found" {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", cmd, err)
+			}
+			if strings.HasPrefix(cmd, "show") {
+				return bgp.ParseBIRD(bytes.NewReader(out))
+			}
+		}
+		return nil, nil
+	}
+}
+
+// birdReply reads the reply to a command from BIRD's control socket, up to the line ending it, a code followed by a
+// space. Codes from 8000 are errors.
+func birdReply(r *bufio.Reader) ([]byte, error) {
+	var out bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(line)
+		if len(line) < 5 || line[4] != ' ' || line[0] < '0' || line[0] > '9' {
+			continue
+		}
+		if line[0] >= '8' {
+			return nil, errors.New(strings.TrimSpace(line[5:]))
+		}
+		return out.Bytes(), nil
+	}
+}
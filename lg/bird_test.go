@@ -0,0 +1,84 @@
+package lg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeBIRD serves a BIRD control socket, answering show route commands with a single route.
+func fakeBIRD(t *testing.T) (string, <-chan string) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	cmds := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprint(conn, "0001 BIRD 2.0.8 ready.\n")
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					cmd := s.Text()
+					cmds <- cmd
+					switch {
+					case cmd == "restrict":
+						fmt.Fprint(conn, "0016 Access restricted\n")
+					case strings.HasSuffix(cmd, "198.51.100.0/24"):
+						fmt.Fprint(conn, "8001 Network not found\n")
+					case strings.HasSuffix(cmd, "::/0"):
+						fmt.Fprint(conn, "9001 syntax error, unexpected CF_SYM_UNDEFINED\n")
+					default:
+						fmt.Fprint(conn, "1007-Table master4:\n"+
+							" 192.0.2.0/24         unicast [peer1 12:00:00.000] * (100) [AS64497i]\n"+
+							"1008-\tType: BGP univ\n"+
+							"1012-\tBGP.origin: IGP\n"+
+							" \tBGP.as_path: 64496 64497\n"+
+							" \tBGP.next_hop: 198.51.100.1\n"+
+							"0000 \n")
+					}
+				}
+			}()
+		}
+	}()
+	return path, cmds
+}
+
+func TestBIRD(t *testing.T) {
+	path, cmds := fakeBIRD(t)
+	lookup := BIRD(path)
+
+	_, pfx, _ := net.ParseCIDR("192.0.2.1/32")
+	routes, err := lookup(context.Background(), pfx)
+	if err != nil {
+		t.Fatalf("lookup err: %v", err)
+	}
+	if len(routes) != 1 || routes[0].Prefix.String() != "192.0.2.0/24" || routes[0].OriginAS() != 64497 {
+		t.Fatalf("got %+v", routes)
+	}
+	for _, want := range []string{"restrict", "show route all for 192.0.2.1/32"} {
+		if got := <-cmds; got != want {
+			t.Fatalf("got command %q, want %q", got, want)
+		}
+	}
+
+	_, pfx, _ = net.ParseCIDR("198.51.100.0/24")
+	if routes, err := lookup(context.Background(), pfx); err != nil || len(routes) != 0 {
+		t.Fatalf("got %v, %v, want no routes", routes, err)
+	}
+	_, pfx, _ = net.ParseCIDR("::/0")
+	if _, err := lookup(context.Background(), pfx); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Fatalf("got %v, want a syntax error", err)
+	}
+}
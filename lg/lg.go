@@ -0,0 +1,325 @@
+package lg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/iprange"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Server whose fields are not set.
+const (
+	DefaultRate    = 1.0 / 10 // One request every ten seconds from each source.
+	DefaultBurst   = 3
+	DefaultTimeout = time.Minute
+)
+
+// Command is a command of the looking glass, which is also the path it is served at.
+type Command string
+
+// Commands of the looking glass.
+const (
+	CommandPing       Command = "ping"
+	CommandTraceroute Command = "traceroute"
+	CommandBGP        Command = "bgp"
+)
+
+// Errors returned by the looking glass, and the statuses they are served with.
+var (
+	ErrNotAllowed  = errors.New("command not allowed")
+	ErrRateLimited = errors.New("rate limited")
+	ErrBadTarget   = errors.New("target not allowed")
+)
+
+// PingFunc measures the round trip to a destination.
+type PingFunc func(ctx context.Context, dst net.IP) (*pathprobe.Hop, error)
+
+// TracerouteFunc traces the path to a destination.
+type TracerouteFunc func(ctx context.Context, dst net.IP) (*pathprobe.Report, error)
+
+// BGPFunc returns the routes covering an address, or to a prefix.
+type BGPFunc func(ctx context.Context, pfx *net.IPNet) ([]bgp.Route, error)
+
+// Server is a looking glass, serving the commands it has functions for as an HTTP/JSON API:
+//
+//	GET /                               lists the commands
+//	GET /ping?target=192.0.2.1          measures the round trip to a host
+//	GET /traceroute?target=example.com  traces the path to a host
+//	GET /bgp?target=192.0.2.0/24        looks up the routes to an address or prefix
+//
+// Requests are rate limited by their source address, IPv6 sources by their /64, and targets must be global unicast
+// addresses with no special purpose, or names that resolve to them. Errors are served as {"error": "..."}.
+type Server struct {
+	Ping       PingFunc
+	Traceroute TracerouteFunc
+	BGP        BGPFunc
+	Allowed    []Command // The commands served, or all those with functions if nil.
+
+	Rate    float64       // The rate of requests allowed from each source, per second, or DefaultRate if zero.
+	Burst   int           // The requests allowed at once from each source, or DefaultBurst if zero.
+	Timeout time.Duration // How long a command may take, or DefaultTimeout if zero.
+	// Whether to take the source of requests from the last address of the X-Forwarded-For header, as set by a
+	// trusted reverse proxy, rather than the address the request came from.
+	TrustForwarded bool
+	Resolver       *net.Resolver // Resolves target names, or net.DefaultResolver if nil.
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time // When the buckets were last swept of those that have refilled.
+}
+
+// bucket is a token bucket limiting the requests from a source.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// PathPing returns a ping function that traces the path to the destination with p, as ICMP echoes with every TTL, and
+// gives the statistics of the destination, which are those of an ordinary ping.
+func PathPing(p *pathprobe.Prober) PingFunc {
+	return func(ctx context.Context, dst net.IP) (*pathprobe.Hop, error) {
+		report, err := p.Run(ctx, dst)
+		if err != nil {
+			return nil, err
+		}
+		if !report.Reached {
+			// Nothing answered from the destination, so every echo was lost.
+			return &pathprobe.Hop{Sent: report.Rounds}, nil
+		}
+		return &report.Hops[len(report.Hops)-1], nil
+	}
+}
+
+// commands returns the commands served.
+func (s *Server) commands() []Command {
+	var cmds []Command
+	for _, c := range []struct {
+		cmd        Command
+		configured bool
+	}{
+		{CommandPing, s.Ping != nil},
+		{CommandTraceroute, s.Traceroute != nil},
+		{CommandBGP, s.BGP != nil},
+	} {
+		if !c.configured {
+			continue
+		}
+		allowed := s.Allowed == nil
+		for _, a := range s.Allowed {
+			allowed = allowed || a == c.cmd
+		}
+		if allowed {
+			cmds = append(cmds, c.cmd)
+		}
+	}
+	return cmds
+}
+
+// ServeHTTP serves the API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	cmds := s.commands()
+	name := strings.Trim(r.URL.Path, "/")
+	if name == "" {
+		writeJSON(w, http.StatusOK, map[string][]Command{"commands": cmds})
+		return
+	}
+	cmd := Command(name)
+	allowed := false
+	for _, c := range cmds {
+		allowed = allowed || c == cmd
+	}
+	if !allowed {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", ErrNotAllowed, name))
+		return
+	}
+
+	if wait := s.take(s.source(r), time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, ErrRateLimited)
+		return
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	target := r.URL.Query().Get("target")
+	var result interface{}
+	var err error
+	switch cmd {
+	case CommandPing, CommandTraceroute:
+		var dst net.IP
+		if dst, err = s.resolve(ctx, target); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if cmd == CommandPing {
+			result, err = s.ping(ctx, dst)
+		} else {
+			result, err = s.traceroute(ctx, dst)
+		}
+	case CommandBGP:
+		pfx, perr := parseTarget(target)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, perr)
+			return
+		}
+		result, err = s.lookup(ctx, pfx)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// source returns the key requests are rate limited by: the address of their source, or its /64 for IPv6.
+func (s *Server) source(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if s.TrustForwarded {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			addr = strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+	if ip.To4() == nil {
+		return ip.Mask(net.CIDRMask(64, 128)).String()
+	}
+	return ip.String()
+}
+
+// take takes a token from the bucket of a source, returning zero if there was one, or how long until there will be.
+func (s *Server) take(src string, now time.Time) time.Duration {
+	rate, burst := s.Rate, float64(s.Burst)
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	if burst <= 0 {
+		burst = DefaultBurst
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets == nil {
+		s.buckets = map[string]*bucket{}
+	}
+	b, ok := s.buckets[src]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[src] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	// Drop the buckets of other sources that have refilled, so that the map does not grow without bound. Sweeping
+	// once in the time a bucket takes to refill is enough for that, and keeps the cost of a request from growing with
+	// the number of sources.
+	if refill := time.Duration(burst / rate * float64(time.Second)); now.Sub(s.swept) >= refill {
+		s.swept = now
+		for k, o := range s.buckets {
+			if k != src && o.tokens+now.Sub(o.last).Seconds()*rate >= burst {
+				delete(s.buckets, k)
+			}
+		}
+	}
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// resolve returns the address of a target, which must be a global unicast address with no special purpose, or a name
+// that resolves to one, so that the looking glass cannot be used to probe private networks.
+func (s *Server) resolve(ctx context.Context, target string) (net.IP, error) {
+	if target == "" {
+		return nil, fmt.Errorf("%w: no target", ErrBadTarget)
+	}
+	ip := net.ParseIP(target)
+	if ip == nil {
+		resolver := s.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		addrs, err := resolver.LookupIPAddr(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if isGlobal(addr.IP) {
+				ip = addr.IP
+				break
+			}
+		}
+		if ip == nil {
+			return nil, fmt.Errorf("%w: %s has no global unicast address", ErrBadTarget, target)
+		}
+	}
+	if !isGlobal(ip) {
+		return nil, fmt.Errorf("%w: %s", ErrBadTarget, ip)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return ip, nil
+}
+
+// isGlobal reports whether an address is global unicast, and not in any of the special-purpose address registries.
+func isGlobal(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	bits := 8 * len(ip)
+	return iprange.IsGlobalUnicast(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+}
+
+// parseTarget parses the target of a BGP lookup, an address or a prefix.
+func parseTarget(target string) (*net.IPNet, error) {
+	if _, pfx, err := net.ParseCIDR(target); err == nil {
+		return pfx, nil
+	}
+	ip := net.ParseIP(target)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: %q is not an address or prefix", ErrBadTarget, target)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,251 @@
+package lg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newServer() *Server {
+	return &Server{
+		Ping: func(ctx context.Context, dst net.IP) (*pathprobe.Hop, error) {
+			return &pathprobe.Hop{Sent: 4, Received: 3, Mean: 10 * time.Millisecond}, nil
+		},
+		Traceroute: func(ctx context.Context, dst net.IP) (*pathprobe.Report, error) {
+			if dst.Equal(net.ParseIP("1.1.1.99")) {
+				return nil, errors.New("no route")
+			}
+			return &pathprobe.Report{Destination: dst, Rounds: 1, Reached: true, Hops: []pathprobe.Hop{
+				{TTL: 1, Addrs: []net.IP{net.ParseIP("198.51.100.1")}, Sent: 1, Received: 1, Last: time.Millisecond},
+				{TTL: 2, Addrs: []net.IP{dst}, Sent: 1, Received: 1, Last: 2 * time.Millisecond},
+			}}, nil
+		},
+		BGP: func(ctx context.Context, pfx *net.IPNet) ([]bgp.Route, error) {
+			_, route, _ := net.ParseCIDR("192.0.2.0/24")
+			return []bgp.Route{{
+				Prefix: route, Protocol: "peer1", Primary: true, NextHop: net.ParseIP("198.51.100.1"),
+				Origin: bgp.OriginIGP, ASPath: []uint32{64496, 64497}, Communities: []bgp.Community{{ASN: 64496, Value: 1}},
+			}}, nil
+		},
+		Rate:  1,
+		Burst: 100,
+	}
+}
+
+func get(t *testing.T, s *Server, target string, header http.Header) (int, map[string]interface{}, http.Header) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode err: %v: %s", err, w.Body)
+	}
+	return w.Code, body, w.Result().Header
+}
+
+func TestServer(t *testing.T) {
+	tests := map[string]struct {
+		allowed    []Command
+		target     string
+		wantStatus int
+		want       map[string]interface{}
+	}{
+		"Commands": {
+			target:     "/",
+			wantStatus: http.StatusOK,
+			want:       map[string]interface{}{"commands": []interface{}{"ping", "traceroute", "bgp"}},
+		},
+		"AllowedCommands": {
+			allowed:    []Command{CommandBGP},
+			target:     "/",
+			wantStatus: http.StatusOK,
+			want:       map[string]interface{}{"commands": []interface{}{"bgp"}},
+		},
+		"Ping": {
+			target:     "/ping?target=1.1.1.1",
+			wantStatus: http.StatusOK,
+			want: map[string]interface{}{
+				"target": "1.1.1.1", "sent": 4.0, "received": 3.0, "loss_percent": 25.0, "avg_ms": 10.0,
+				"best_ms": 0.0, "worst_ms": 0.0, "stddev_ms": 0.0,
+			},
+		},
+		"NotAllowed": {
+			allowed:    []Command{CommandBGP},
+			target:     "/ping?target=1.1.1.1",
+			wantStatus: http.StatusNotFound,
+			want:       map[string]interface{}{"error": "command not allowed: ping"},
+		},
+		"Unknown": {
+			target:     "/shell?target=reboot",
+			wantStatus: http.StatusNotFound,
+			want:       map[string]interface{}{"error": "command not allowed: shell"},
+		},
+		"Loopback": {
+			target:     "/ping?target=127.0.0.1",
+			wantStatus: http.StatusBadRequest,
+			want:       map[string]interface{}{"error": "target not allowed: 127.0.0.1"},
+		},
+		"Private": {
+			target:     "/ping?target=10.1.2.3",
+			wantStatus: http.StatusBadRequest,
+			want:       map[string]interface{}{"error": "target not allowed: 10.1.2.3"},
+		},
+		"UniqueLocal": {
+			target:     "/traceroute?target=fd00::1",
+			wantStatus: http.StatusBadRequest,
+			want:       map[string]interface{}{"error": "target not allowed: fd00::1"},
+		},
+		"NoTarget": {
+			target:     "/traceroute",
+			wantStatus: http.StatusBadRequest,
+			want:       map[string]interface{}{"error": "target not allowed: no target"},
+		},
+		"Failed": {
+			target:     "/traceroute?target=1.1.1.99",
+			wantStatus: http.StatusBadGateway,
+			want:       map[string]interface{}{"error": "no route"},
+		},
+		"BGP": {
+			target:     "/bgp?target=192.0.2.1",
+			wantStatus: http.StatusOK,
+			want: map[string]interface{}{"target": "192.0.2.1/32", "routes": []interface{}{map[string]interface{}{
+				"prefix": "192.0.2.0/24", "protocol": "peer1", "primary": true, "next_hop": "198.51.100.1",
+				"origin": "IGP", "as_path": []interface{}{64496.0, 64497.0}, "local_pref": 0.0, "med": 0.0,
+				"communities": []interface{}{"64496:1"},
+			}}},
+		},
+		"BGPBadTarget": {
+			target:     "/bgp?target=example.com",
+			wantStatus: http.StatusBadRequest,
+			want:       map[string]interface{}{"error": `target not allowed: "example.com" is not an address or prefix`},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newServer()
+			s.Allowed = test.allowed
+			status, body, _ := get(t, s, test.target, nil)
+			if status != test.wantStatus {
+				t.Fatalf("got status %d, want %d", status, test.wantStatus)
+			}
+			if diff := cmp.Diff(test.want, body); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestServerTraceroute(t *testing.T) {
+	status, body, _ := get(t, newServer(), "/traceroute?target=1.1.1.1", nil)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d: %v", status, body)
+	}
+	hops := body["hops"].([]interface{})
+	if len(hops) != 2 || body["reached"] != true {
+		t.Fatalf("got %v", body)
+	}
+	if got := hops[1].(map[string]interface{})["hosts"]; !cmp.Equal(got, []interface{}{"1.1.1.1"}) {
+		t.Fatalf("got hosts %v", got)
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	s := newServer()
+	s.Burst = 2
+	for i := 0; i < 2; i++ {
+		if status, body, _ := get(t, s, "/ping?target=1.1.1.1", nil); status != http.StatusOK {
+			t.Fatalf("got status %d: %v", status, body)
+		}
+	}
+	status, _, header := get(t, s, "/ping?target=1.1.1.1", nil)
+	if status != http.StatusTooManyRequests || header.Get("Retry-After") != "1" {
+		t.Fatalf("got status %d, retry after %q, want rate limiting", status, header.Get("Retry-After"))
+	}
+	// Listing the commands is not limited.
+	if status, _, _ := get(t, s, "/", nil); status != http.StatusOK {
+		t.Fatalf("got status %d listing commands", status)
+	}
+
+	// Behind a trusted proxy, the limit applies to the source it forwards for.
+	s.TrustForwarded = true
+	fwd := http.Header{"X-Forwarded-For": {"198.51.100.200, 2001:db8:1:2::1"}}
+	if status, _, _ := get(t, s, "/ping?target=1.1.1.1", fwd); status != http.StatusOK {
+		t.Fatalf("got status %d for a forwarded source", status)
+	}
+}
+
+func TestTake(t *testing.T) {
+	s := &Server{Rate: 0.5, Burst: 2}
+	now := time.Now()
+	for i, want := range []time.Duration{0, 0, 2 * time.Second} {
+		if got := s.take("a", now); got != want {
+			t.Fatalf("request %d: got wait %v, want %v", i, got, want)
+		}
+	}
+	if got := s.take("a", now.Add(time.Second)); got != time.Second {
+		t.Fatalf("got wait %v, want 1s", got)
+	}
+	if got := s.take("a", now.Add(2*time.Second)); got != 0 {
+		t.Fatalf("got wait %v after refilling", got)
+	}
+	// Other sources have buckets of their own.
+	if got := s.take("b", now); got != 0 {
+		t.Fatalf("got wait %v for another source", got)
+	}
+
+	// Buckets that have refilled are dropped, but only once in the time a bucket takes to refill: the first request
+	// swept at once, so the next sweep drops the bucket of b but not yet that of a, which refills after six seconds.
+	if got := s.take("c", now.Add(5*time.Second)); got != 0 || len(s.buckets) != 2 {
+		t.Fatalf("got wait %v with %d buckets, want 2 after a sweep", got, len(s.buckets))
+	}
+	if got := s.take("c", now.Add(8*time.Second)); got != 0 || len(s.buckets) != 2 {
+		t.Fatalf("got wait %v with %d buckets, want 2 before the next sweep", got, len(s.buckets))
+	}
+	if got := s.take("c", now.Add(9*time.Second)); got != 0 || len(s.buckets) != 1 {
+		t.Fatalf("got wait %v with %d buckets, want only that of the source after a sweep", got, len(s.buckets))
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := map[string]struct {
+		remote  string
+		forward string
+		trust   bool
+		want    string
+	}{
+		"IPv4":      {remote: "192.0.2.1:1234", want: "192.0.2.1"},
+		"IPv6":      {remote: "[2001:db8:1:2:3:4:5:6]:1234", want: "2001:db8:1:2::"},
+		"Untrusted": {remote: "192.0.2.1:1234", forward: "198.51.100.1", want: "192.0.2.1"},
+		"Forwarded": {
+			remote: "192.0.2.1:1234", forward: "203.0.113.9, 198.51.100.1", trust: true, want: "198.51.100.1",
+		},
+		"NotForwarded": {remote: "192.0.2.1:1234", trust: true, want: "192.0.2.1"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remote
+			if test.forward != "" {
+				req.Header.Set("X-Forwarded-For", test.forward)
+			}
+			s := &Server{TrustForwarded: test.trust}
+			if diff := cmp.Diff(test.want, s.source(req)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package lg
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"net"
+	"time"
+)
+
+// pingResult is the JSON form of a ping.
+type pingResult struct {
+	Target   string  `json:"target"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss_percent"`
+	Mean     float64 `json:"avg_ms"`
+	Best     float64 `json:"best_ms"`
+	Worst    float64 `json:"worst_ms"`
+	StdDev   float64 `json:"stddev_ms"`
+}
+
+// tracerouteResult is the JSON form of a traceroute.
+type tracerouteResult struct {
+	Target  string      `json:"target"`
+	Rounds  int         `json:"rounds"`
+	Reached bool        `json:"reached"`
+	Hops    []hopResult `json:"hops"`
+}
+
+// hopResult is the JSON form of a hop of a traceroute.
+type hopResult struct {
+	TTL      int      `json:"ttl"`
+	Hosts    []string `json:"hosts"`
+	Sent     int      `json:"sent"`
+	Received int      `json:"received"`
+	Loss     float64  `json:"loss_percent"`
+	Last     float64  `json:"last_ms"`
+	Mean     float64  `json:"avg_ms"`
+	Best     float64  `json:"best_ms"`
+	Worst    float64  `json:"worst_ms"`
+	StdDev   float64  `json:"stddev_ms"`
+	Error    string   `json:"error,omitempty"`
+	MPLS     []uint32 `json:"mpls,omitempty"`
+}
+
+// bgpResult is the JSON form of a BGP lookup.
+type bgpResult struct {
+	Target string        `json:"target"`
+	Routes []routeResult `json:"routes"`
+}
+
+// routeResult is the JSON form of a route.
+type routeResult struct {
+	Prefix              string   `json:"prefix"`
+	Protocol            string   `json:"protocol,omitempty"`
+	Primary             bool     `json:"primary"`
+	NextHop             string   `json:"next_hop,omitempty"`
+	Origin              string   `json:"origin"`
+	ASPath              []uint32 `json:"as_path"`
+	LocalPref           uint32   `json:"local_pref"`
+	MED                 uint32   `json:"med"`
+	Communities         []string `json:"communities,omitempty"`
+	LargeCommunities    []string `json:"large_communities,omitempty"`
+	ExtendedCommunities []string `json:"extended_communities,omitempty"`
+}
+
+// ping runs the ping command.
+func (s *Server) ping(ctx context.Context, dst net.IP) (*pingResult, error) {
+	hop, err := s.Ping(ctx, dst)
+	if err != nil {
+		return nil, err
+	}
+	return &pingResult{
+		Target:   dst.String(),
+		Sent:     hop.Sent,
+		Received: hop.Received,
+		Loss:     100 * hop.Loss(),
+		Mean:     millis(hop.Mean),
+		Best:     millis(hop.Best),
+		Worst:    millis(hop.Worst),
+		StdDev:   millis(hop.StdDev),
+	}, nil
+}
+
+// traceroute runs the traceroute command.
+func (s *Server) traceroute(ctx context.Context, dst net.IP) (*tracerouteResult, error) {
+	report, err := s.Traceroute(ctx, dst)
+	if err != nil {
+		return nil, err
+	}
+	result := &tracerouteResult{
+		Target:  dst.String(),
+		Rounds:  report.Rounds,
+		Reached: report.Reached,
+		Hops:    make([]hopResult, 0, len(report.Hops)),
+	}
+	for i := range report.Hops {
+		result.Hops = append(result.Hops, newHopResult(&report.Hops[i]))
+	}
+	return result, nil
+}
+
+// newHopResult converts a hop to its JSON form.
+func newHopResult(hop *pathprobe.Hop) hopResult {
+	h := hopResult{
+		TTL:      hop.TTL,
+		Hosts:    make([]string, 0, len(hop.Addrs)),
+		Sent:     hop.Sent,
+		Received: hop.Received,
+		Loss:     100 * hop.Loss(),
+		Last:     millis(hop.Last),
+		Mean:     millis(hop.Mean),
+		Best:     millis(hop.Best),
+		Worst:    millis(hop.Worst),
+		StdDev:   millis(hop.StdDev),
+	}
+	for _, addr := range hop.Addrs {
+		h.Hosts = append(h.Hosts, addr.String())
+	}
+	if hop.Err != nil {
+		h.Error = hop.Err.Error()
+	}
+	for _, label := range hop.MPLS {
+		h.MPLS = append(h.MPLS, label.Label)
+	}
+	return h
+}
+
+// lookup runs the BGP command.
+func (s *Server) lookup(ctx context.Context, pfx *net.IPNet) (*bgpResult, error) {
+	routes, err := s.BGP(ctx, pfx)
+	if err != nil {
+		return nil, err
+	}
+	result := &bgpResult{Target: pfx.String(), Routes: make([]routeResult, 0, len(routes))}
+	for i := range routes {
+		result.Routes = append(result.Routes, newRouteResult(&routes[i]))
+	}
+	return result, nil
+}
+
+// newRouteResult converts a route to its JSON form.
+func newRouteResult(r *bgp.Route) routeResult {
+	rr := routeResult{
+		Prefix:    r.Prefix.String(),
+		Protocol:  r.Protocol,
+		Primary:   r.Primary,
+		Origin:    string(r.Origin),
+		ASPath:    r.ASPath,
+		LocalPref: r.LocalPref,
+		MED:       r.MED,
+	}
+	if r.NextHop != nil {
+		rr.NextHop = r.NextHop.String()
+	}
+	for _, c := range r.Communities {
+		rr.Communities = append(rr.Communities, c.String())
+	}
+	for _, c := range r.LargeCommunities {
+		rr.LargeCommunities = append(rr.LargeCommunities, c.String())
+	}
+	for _, c := range r.ExtendedCommunities {
+		rr.ExtendedCommunities = append(rr.ExtendedCommunities, c.String())
+	}
+	return rr
+}
+
+// millis returns a duration in milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,127 @@
+package lldp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// cdpSNAP is the LLC and SNAP header that precedes CDP in an IEEE 802.3 frame.
+var cdpSNAP = []byte{0xaa, 0xaa, 0x03, 0x00, 0x00, 0x0c, 0x20, 0x00}
+
+// CDP TLV types.
+const (
+	cdpDeviceID   = 0x0001
+	cdpAddresses  = 0x0002
+	cdpPortID     = 0x0003
+	cdpCaps       = 0x0004
+	cdpVersion    = 0x0005
+	cdpPlatform   = 0x0006
+	cdpNativeVLAN = 0x000a
+	cdpMgmtAddrs  = 0x0016
+)
+
+// cdpCapabilities maps the CDP capability bits to the nearest LLDP capabilities.
+var cdpCapabilities = []struct {
+	bit uint32
+	cap Capabilities
+}{
+	{0x01, CapRouter},
+	{0x02, CapBridge}, // Transparent bridge.
+	{0x04, CapBridge}, // Source route bridge.
+	{0x08, CapBridge}, // Switch.
+	{0x10, CapStation},
+	{0x40, CapRepeater},
+	{0x80, CapTelephone},
+}
+
+// ParseCDP decodes a CDP packet, the payload of a frame following its LLC and SNAP headers. The checksum is not
+// verified. Addresses are taken as management addresses, unless the neighbor sends management addresses separately.
+func ParseCDP(b []byte) (*Neighbor, error) {
+	if len(b) < 4 {
+		return nil, errors.New("cdp header too short")
+	}
+	if b[0] != 1 && b[0] != 2 {
+		return nil, fmt.Errorf("unsupported cdp version %d", b[0])
+	}
+	n := &Neighbor{Protocol: ProtocolCDP, TTL: time.Duration(b[1]) * time.Second}
+	var addrs, mgmt []net.IP
+	for b = b[4:]; len(b) > 0; {
+		if len(b) < 4 {
+			return nil, errors.New("tlv truncated")
+		}
+		// The length includes the type and length themselves.
+		typ, length := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if length < 4 || len(b) < length {
+			return nil, fmt.Errorf("tlv %#04x truncated", typ)
+		}
+		v := b[4:length]
+		b = b[length:]
+
+		switch typ {
+		case cdpDeviceID:
+			n.ChassisID = string(v)
+		case cdpPortID:
+			n.PortID = string(v)
+		case cdpVersion:
+			n.SystemDescription = string(v)
+		case cdpPlatform:
+			n.Platform = string(v)
+		case cdpCaps:
+			if len(v) >= 4 {
+				bits := binary.BigEndian.Uint32(v)
+				for _, c := range cdpCapabilities {
+					if bits&c.bit != 0 {
+						n.Capabilities |= c.cap
+					}
+				}
+				n.Enabled = n.Capabilities
+			}
+		case cdpNativeVLAN:
+			if len(v) >= 2 {
+				n.VLAN = int(binary.BigEndian.Uint16(v))
+			}
+		case cdpAddresses:
+			addrs = cdpAddrs(v)
+		case cdpMgmtAddrs:
+			mgmt = cdpAddrs(v)
+		}
+	}
+	n.ManagementAddrs = mgmt
+	if len(mgmt) == 0 {
+		n.ManagementAddrs = addrs
+	}
+	return n, nil
+}
+
+// cdpAddrs decodes a list of addresses, skipping those that are neither IPv4 nor IPv6, and stopping at the first that
+// is truncated.
+func cdpAddrs(b []byte) []net.IP {
+	if len(b) < 4 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(b)
+	var ips []net.IP
+	for b = b[4:]; count > 0 && len(b) >= 2; count-- {
+		// Each address is a protocol type and the protocol, as an NLPID or an 802.2 header, then the address.
+		plen := int(b[1])
+		if len(b) < 2+plen+2 {
+			break
+		}
+		proto := b[2 : 2+plen]
+		alen := int(binary.BigEndian.Uint16(b[2+plen:]))
+		if len(b) < 4+plen+alen {
+			break
+		}
+		addr := b[4+plen : 4+plen+alen]
+		b = b[4+plen+alen:]
+		switch {
+		case len(proto) == 1 && proto[0] == 0xcc && alen == net.IPv4len,
+			len(proto) == 8 && binary.BigEndian.Uint16(proto[6:]) == 0x86dd && alen == net.IPv6len:
+			ips = append(ips, net.IP(append([]byte(nil), addr...)))
+		}
+	}
+	return ips
+}
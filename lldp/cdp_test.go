@@ -0,0 +1,82 @@
+package lldp
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// cdpTLV encodes a CDP TLV.
+func cdpTLV(typ uint16, v ...byte) []byte {
+	n := 4 + len(v)
+	return append([]byte{byte(typ >> 8), byte(typ), byte(n >> 8), byte(n)}, v...)
+}
+
+// cdpFrame encodes a CDP frame, whose IEEE 802.3 length field is not checked.
+func cdpFrame(tlvs ...[]byte) []byte {
+	payload := join(cdpSNAP, []byte{2, 180, 0, 0}, join(tlvs...))
+	return frame(CDPMulticast, uint16(len(payload)), payload)
+}
+
+func TestParseCDP(t *testing.T) {
+	ipv4 := []byte{0, 0, 0, 1, 1, 1, 0xcc, 0, 4, 192, 0, 2, 2}
+	ipv6 := append([]byte{0, 0, 0, 1, 2, 8, 0xaa, 0xaa, 0x03, 0, 0, 0, 0x86, 0xdd, 0, 16}, net.ParseIP("2001:db8::2")...)
+
+	tests := map[string]struct {
+		frame   []byte
+		want    *Neighbor
+		wantErr bool
+	}{
+		"Full": {
+			frame: cdpFrame(
+				cdpTLV(cdpDeviceID, []byte("rtr1.example.net")...),
+				cdpTLV(cdpAddresses, ipv4...),
+				cdpTLV(cdpPortID, []byte("GigabitEthernet0/1")...),
+				cdpTLV(cdpCaps, 0, 0, 0, 0x29),
+				cdpTLV(cdpVersion, []byte("IOS 15.2")...),
+				cdpTLV(cdpPlatform, []byte("cisco ISR4331")...),
+				cdpTLV(cdpNativeVLAN, 0, 10),
+				cdpTLV(cdpMgmtAddrs, ipv6...),
+			),
+			want: &Neighbor{
+				Protocol:          ProtocolCDP,
+				Source:            net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+				ChassisID:         "rtr1.example.net",
+				PortID:            "GigabitEthernet0/1",
+				SystemDescription: "IOS 15.2",
+				Platform:          "cisco ISR4331",
+				Capabilities:      CapRouter | CapBridge,
+				Enabled:           CapRouter | CapBridge,
+				ManagementAddrs:   []net.IP{net.ParseIP("2001:db8::2")},
+				VLAN:              10,
+				TTL:               3 * time.Minute,
+			},
+		},
+		"AddressesOnly": {
+			frame: cdpFrame(cdpTLV(cdpDeviceID, 'r'), cdpTLV(cdpAddresses, ipv4...)),
+			want: &Neighbor{
+				Protocol:        ProtocolCDP,
+				Source:          net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+				ChassisID:       "r",
+				ManagementAddrs: []net.IP{{192, 0, 2, 2}},
+				TTL:             3 * time.Minute,
+			},
+		},
+		"Truncated": {
+			frame:   cdpFrame(cdpTLV(cdpDeviceID, 'r')[:4]),
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseFrame(test.frame)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: %v, want error %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package lldp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/packet"
+	"net"
+	"strings"
+	"time"
+)
+
+// Multicast addresses that neighbor discovery frames are sent to.
+var (
+	// NearestBridge is where LLDP frames are sent, which bridges do not forward.
+	NearestBridge = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+	// CDPMulticast is where CDP frames are sent.
+	CDPMulticast = net.HardwareAddr{0x01, 0x00, 0x0c, 0xcc, 0xcc, 0xcc}
+)
+
+// LLDP TLV types, from IEEE 802.1AB.
+const (
+	tlvEnd         = 0
+	tlvChassisID   = 1
+	tlvPortID      = 2
+	tlvTTL         = 3
+	tlvPortDesc    = 4
+	tlvSystemName  = 5
+	tlvSystemDesc  = 6
+	tlvSystemCaps  = 7
+	tlvMgmtAddr    = 8
+	tlvOrgSpecific = 127
+)
+
+// Protocol is the protocol a neighbor was discovered by.
+type Protocol string
+
+// Discovery protocols.
+const (
+	ProtocolLLDP Protocol = "lldp"
+	ProtocolCDP  Protocol = "cdp"
+)
+
+// Capabilities are the functions of a neighbor, as a bit set in the order of the LLDP system capabilities TLV.
+type Capabilities uint16
+
+// Capabilities, from IEEE 802.1AB. CDP capabilities are mapped to the nearest of these.
+const (
+	CapOther Capabilities = 1 << iota
+	CapRepeater
+	CapBridge
+	CapWLANAccessPoint
+	CapRouter
+	CapTelephone
+	CapDOCSIS
+	CapStation
+	CapCVLAN
+	CapSVLAN
+	CapTPMR
+)
+
+// capNames are the names of the capabilities, in bit order.
+var capNames = []string{
+	"other", "repeater", "bridge", "wlan-ap", "router", "telephone", "docsis", "station", "c-vlan", "s-vlan", "tpmr",
+}
+
+// String lists the names of the capabilities, separated by commas, or returns none if there are none.
+func (c Capabilities) String() string {
+	var names []string
+	for i, name := range capNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Neighbor is what a neighbor announced about itself in a discovery frame. Fields it did not announce are left zero.
+type Neighbor struct {
+	Protocol Protocol
+	Source   net.HardwareAddr // The source address of the frame, when decoded from one by ParseFrame.
+	// The identity of the neighbor: for LLDP the chassis ID, formatted as a hardware or network address where it is
+	// one, and for CDP the device ID.
+	ChassisID string
+	// The port the frame was sent from, formatted as a hardware or network address where it is one.
+	PortID            string
+	PortDescription   string
+	SystemName        string
+	SystemDescription string // For CDP, the software version.
+	Platform          string // The hardware platform, only sent by CDP.
+	Capabilities      Capabilities
+	Enabled           Capabilities // The capabilities in use, which CDP does not distinguish.
+	ManagementAddrs   []net.IP
+	VLAN              int           // The native or port VLAN, or zero if not announced.
+	TTL               time.Duration // How long the information is valid for; zero means the neighbor is leaving.
+}
+
+// Name returns the system name of the neighbor, or its chassis ID if it has none.
+func (n *Neighbor) Name() string {
+	if n.SystemName != "" {
+		return n.SystemName
+	}
+	return n.ChassisID
+}
+
+// ParseFrame decodes an Ethernet frame carrying LLDP, optionally behind a VLAN tag, or CDP.
+func ParseFrame(frame []byte) (*Neighbor, error) {
+	eth := packet.Ethernet(frame)
+	if err := eth.Valid(); err != nil {
+		return nil, err
+	}
+	etherType, payload := eth.EtherType(), eth.Payload()
+	if etherType == packet.EtherTypeVLAN && len(payload) >= 4 {
+		etherType, payload = binary.BigEndian.Uint16(payload[2:]), payload[4:]
+	}
+	var n *Neighbor
+	var err error
+	switch {
+	case etherType == packet.EtherTypeLLDP:
+		n, err = ParseLLDP(payload)
+	case etherType <= 1500 && len(payload) >= len(cdpSNAP) && string(payload[:len(cdpSNAP)]) == string(cdpSNAP):
+		// An IEEE 802.3 length rather than an EtherType, followed by the LLC and SNAP headers of CDP.
+		n, err = ParseCDP(payload[len(cdpSNAP):])
+	default:
+		return nil, fmt.Errorf("not a discovery frame: ethertype %#04x", etherType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.Source = net.HardwareAddr(append([]byte(nil), eth.Src()...))
+	return n, nil
+}
+
+// ParseLLDP decodes an LLDP data unit, the payload of a frame. It must begin with the chassis ID, port ID and TTL.
+func ParseLLDP(b []byte) (*Neighbor, error) {
+	n := &Neighbor{Protocol: ProtocolLLDP}
+	i := 0
+	for ; len(b) > 0; i++ {
+		if len(b) < 2 {
+			return nil, errors.New("tlv truncated")
+		}
+		typ, length := int(b[0]>>1), int(binary.BigEndian.Uint16(b)&0x1ff)
+		if len(b) < 2+length {
+			return nil, fmt.Errorf("tlv %d truncated", typ)
+		}
+		v := b[2 : 2+length]
+		b = b[2+length:]
+		if i < 3 && typ != i+1 {
+			return nil, fmt.Errorf("tlv %d where tlv %d is required", typ, i+1)
+		}
+
+		switch typ {
+		case tlvEnd:
+			return n, nil
+		case tlvChassisID, tlvPortID:
+			if len(v) < 2 {
+				return nil, fmt.Errorf("tlv %d too short", typ)
+			}
+			if typ == tlvChassisID {
+				n.ChassisID = formatID(v[0], v[1:], 4, 5)
+			} else {
+				n.PortID = formatID(v[0], v[1:], 3, 4)
+			}
+		case tlvTTL:
+			if len(v) < 2 {
+				return nil, errors.New("ttl tlv too short")
+			}
+			n.TTL = time.Duration(binary.BigEndian.Uint16(v)) * time.Second
+		case tlvPortDesc:
+			n.PortDescription = string(v)
+		case tlvSystemName:
+			n.SystemName = string(v)
+		case tlvSystemDesc:
+			n.SystemDescription = string(v)
+		case tlvSystemCaps:
+			if len(v) >= 4 {
+				n.Capabilities = Capabilities(binary.BigEndian.Uint16(v))
+				n.Enabled = Capabilities(binary.BigEndian.Uint16(v[2:]))
+			}
+		case tlvMgmtAddr:
+			// The address is preceded by its length, which counts the subtype before it.
+			if len(v) >= 2 && int(v[0]) >= 1 && len(v) >= 1+int(v[0]) {
+				if ip := addressFamilyIP(v[1], v[2:1+int(v[0])]); ip != nil {
+					n.ManagementAddrs = append(n.ManagementAddrs, ip)
+				}
+			}
+		case tlvOrgSpecific:
+			// The port VLAN ID of IEEE 802.1.
+			if len(v) >= 6 && v[0] == 0x00 && v[1] == 0x80 && v[2] == 0xc2 && v[3] == 1 {
+				n.VLAN = int(binary.BigEndian.Uint16(v[4:]))
+			}
+		}
+	}
+	if i < 3 {
+		return nil, errors.New("missing mandatory tlvs")
+	}
+	return n, nil
+}
+
+// formatID formats a chassis or port ID by its subtype, as a hardware address or network address if the subtype is
+// that given for one, and otherwise as text.
+func formatID(subtype byte, id []byte, hwSubtype, netSubtype byte) string {
+	switch {
+	case subtype == hwSubtype && len(id) == 6:
+		return net.HardwareAddr(id).String()
+	case subtype == netSubtype && len(id) > 1:
+		if ip := addressFamilyIP(id[0], id[1:]); ip != nil {
+			return ip.String()
+		}
+	}
+	return string(id)
+}
+
+// addressFamilyIP returns an address given with its IANA address family, or nil if it is not IPv4 or IPv6.
+func addressFamilyIP(family byte, addr []byte) net.IP {
+	switch {
+	case family == 1 && len(addr) == net.IPv4len, family == 2 && len(addr) == net.IPv6len:
+		return net.IP(append([]byte(nil), addr...))
+	}
+	return nil
+}
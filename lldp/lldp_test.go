@@ -0,0 +1,136 @@
+package lldp
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// tlv encodes an LLDP TLV.
+func tlv(typ int, v ...byte) []byte {
+	return append([]byte{byte(typ<<1) | byte(len(v)>>8), byte(len(v))}, v...)
+}
+
+// frame prepends an Ethernet header to a payload.
+func frame(dst net.HardwareAddr, etherType uint16, payload []byte) []byte {
+	b := append([]byte(nil), dst...)
+	b = append(b, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, byte(etherType>>8), byte(etherType))
+	return append(b, payload...)
+}
+
+// join concatenates byte slices.
+func join(bs ...[]byte) []byte {
+	var b []byte
+	for _, p := range bs {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestParseLLDP(t *testing.T) {
+	mandatory := join(
+		tlv(tlvChassisID, 4, 0x00, 0x1b, 0x21, 0x3c, 0x4d, 0x5e),
+		tlv(tlvPortID, 5, 'x', 'e', '-', '0', '/', '0', '/', '1'),
+		tlv(tlvTTL, 0, 120),
+	)
+
+	tests := map[string]struct {
+		frame   []byte
+		want    *Neighbor
+		wantErr bool
+	}{
+		"Full": {
+			frame: frame(NearestBridge, 0x88cc, join(
+				mandatory,
+				tlv(tlvPortDesc, []byte("uplink to core")...),
+				tlv(tlvSystemName, []byte("sw1.example.net")...),
+				tlv(tlvSystemDesc, []byte("Example OS 1.0")...),
+				tlv(tlvSystemCaps, 0x00, 0x14, 0x00, 0x04),
+				tlv(tlvMgmtAddr, 5, 1, 192, 0, 2, 1, 2, 0, 0, 0, 1, 0),
+				tlv(tlvMgmtAddr, append([]byte{17, 2}, net.ParseIP("2001:db8::1")...)...),
+				tlv(tlvOrgSpecific, 0x00, 0x80, 0xc2, 1, 0x00, 100),
+				tlv(tlvEnd),
+			)),
+			want: &Neighbor{
+				Protocol:          ProtocolLLDP,
+				Source:            net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+				ChassisID:         "00:1b:21:3c:4d:5e",
+				PortID:            "xe-0/0/1",
+				PortDescription:   "uplink to core",
+				SystemName:        "sw1.example.net",
+				SystemDescription: "Example OS 1.0",
+				Capabilities:      CapBridge | CapRouter,
+				Enabled:           CapBridge,
+				ManagementAddrs:   []net.IP{{192, 0, 2, 1}, net.ParseIP("2001:db8::1")},
+				VLAN:              100,
+				TTL:               2 * time.Minute,
+			},
+		},
+		"VLANTagged": {
+			frame: frame(NearestBridge, 0x8100, join([]byte{0x00, 0x0a, 0x88, 0xcc}, mandatory)),
+			want: &Neighbor{
+				Protocol:  ProtocolLLDP,
+				Source:    net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+				ChassisID: "00:1b:21:3c:4d:5e",
+				PortID:    "xe-0/0/1",
+				TTL:       2 * time.Minute,
+			},
+		},
+		"NetworkAddressChassis": {
+			frame: frame(NearestBridge, 0x88cc, join(
+				tlv(tlvChassisID, 5, 1, 198, 51, 100, 7),
+				tlv(tlvPortID, 3, 0x00, 0x1b, 0x21, 0x3c, 0x4d, 0x5f),
+				tlv(tlvTTL, 0, 0),
+			)),
+			want: &Neighbor{
+				Protocol:  ProtocolLLDP,
+				Source:    net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+				ChassisID: "198.51.100.7",
+				PortID:    "00:1b:21:3c:4d:5f",
+			},
+		},
+		"OutOfOrder": {
+			frame:   frame(NearestBridge, 0x88cc, join(tlv(tlvPortID, 5, 'p'), tlv(tlvChassisID, 7, 'c'))),
+			wantErr: true,
+		},
+		"MissingTTL": {
+			frame:   frame(NearestBridge, 0x88cc, join(tlv(tlvChassisID, 7, 'c'), tlv(tlvPortID, 5, 'p'))),
+			wantErr: true,
+		},
+		"Truncated": {
+			frame:   frame(NearestBridge, 0x88cc, mandatory[:len(mandatory)-1]),
+			wantErr: true,
+		},
+		"NotDiscovery": {
+			frame:   frame(NearestBridge, 0x0800, mandatory),
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseFrame(test.frame)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: %v, want error %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := map[Capabilities]string{
+		0:                        "none",
+		CapRouter:                "router",
+		CapBridge | CapTelephone: "bridge,telephone",
+		CapOther | CapTPMR:       "other,tpmr",
+		CapStation | CapRepeater: "repeater,station",
+	}
+	for caps, want := range tests {
+		if got := caps.String(); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
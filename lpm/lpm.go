@@ -0,0 +1,124 @@
+package lpm
+
+import (
+	"errors"
+	"github.com/yl2chen/cidranger"
+	"net"
+)
+
+// Entry is a prefix stored in a Table, along with the value attached to it.
+type Entry struct {
+	Prefix *net.IPNet
+	Value  interface{}
+}
+
+// Network satisfies cidranger.RangerEntry.
+func (e *Entry) Network() net.IPNet {
+	return *e.Prefix
+}
+
+// Table maps CIDR prefixes to arbitrary values, and answers longest-prefix-match queries for addresses. It is not safe
+// for concurrent modification; callers sharing a Table between goroutines must provide their own locking.
+type Table struct {
+	ranger cidranger.Ranger
+}
+
+// New returns an empty Table.
+func New() *Table {
+	return &Table{
+		ranger: cidranger.NewPCTrieRanger(),
+	}
+}
+
+// Insert adds a prefix to the table, replacing the value of any identical prefix already present. Host bits set in
+// the supplied prefix are ignored.
+func (t *Table) Insert(pfx *net.IPNet, value interface{}) error {
+	if pfx == nil {
+		return errors.New("nil prefix")
+	}
+	network := &net.IPNet{
+		IP:   pfx.IP.Mask(pfx.Mask),
+		Mask: pfx.Mask,
+	}
+	return t.ranger.Insert(&Entry{Prefix: network, Value: value})
+}
+
+// Remove deletes the exact prefix from the table, returning the entry that was removed, or nil if it was not present.
+func (t *Table) Remove(pfx *net.IPNet) (*Entry, error) {
+	if pfx == nil {
+		return nil, errors.New("nil prefix")
+	}
+	removed, err := t.ranger.Remove(*pfx)
+	if err != nil || removed == nil {
+		return nil, err
+	}
+	return removed.(*Entry), nil
+}
+
+// Lookup returns the entry with the longest prefix containing the supplied address, or nil if no prefix matches.
+func (t *Table) Lookup(ip net.IP) (*Entry, error) {
+	entries, err := t.ranger.ContainingNetworks(ip)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	// The ranger returns containing networks in ascending prefix length order, so the longest match is last.
+	return entries[len(entries)-1].(*Entry), nil
+}
+
+// Matches returns every entry containing the supplied address, from the shortest prefix to the longest.
+func (t *Table) Matches(ip net.IP) ([]*Entry, error) {
+	entries, err := t.ranger.ContainingNetworks(ip)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Entry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.(*Entry))
+	}
+	return result, nil
+}
+
+// Covered returns every entry whose prefix is within the supplied prefix, including the prefix itself, with covering
+// prefixes listed before the prefixes they contain.
+func (t *Table) Covered(pfx *net.IPNet) ([]*Entry, error) {
+	if pfx == nil {
+		return nil, errors.New("nil prefix")
+	}
+	entries, err := t.ranger.CoveredNetworks(net.IPNet{IP: pfx.IP.Mask(pfx.Mask), Mask: pfx.Mask})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Entry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.(*Entry))
+	}
+	return result, nil
+}
+
+// Entries returns every entry in the table, IPv4 prefixes first, with covering prefixes listed before the prefixes they
+// contain.
+func (t *Table) Entries() ([]*Entry, error) {
+	ipv4, err := t.ranger.CoveredNetworks(*cidranger.AllIPv4)
+	if err != nil {
+		return nil, err
+	}
+	ipv6, err := t.ranger.CoveredNetworks(*cidranger.AllIPv6)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Entry, 0, len(ipv4)+len(ipv6))
+	for _, entry := range append(ipv4, ipv6...) {
+		result = append(result, entry.(*Entry))
+	}
+	return result, nil
+}
+
+// Len returns the number of prefixes in the table.
+func (t *Table) Len() int {
+	return t.ranger.Len()
+}
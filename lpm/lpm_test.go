@@ -0,0 +1,218 @@
+package lpm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	prefixes := map[string]string{
+		"0.0.0.0/0":      "default",
+		"192.0.2.0/24":   "doc",
+		"192.0.2.128/25": "doc-upper",
+		"2001:db8::/32":  "doc6",
+	}
+
+	tests := map[string]struct {
+		input string
+		want  string
+	}{
+		"Default": {
+			input: "198.51.100.1",
+			want:  "0.0.0.0/0=default",
+		},
+		"Shorter": {
+			input: "192.0.2.1",
+			want:  "192.0.2.0/24=doc",
+		},
+		"Longer": {
+			input: "192.0.2.200",
+			want:  "192.0.2.128/25=doc-upper",
+		},
+		"IPv6": {
+			input: "2001:db8::1",
+			want:  "2001:db8::/32=doc6",
+		},
+		"NoMatch": {
+			input: "2001:db9::1",
+			want:  "",
+		},
+	}
+
+	table := New()
+	for pfx, value := range prefixes {
+		_, ipNet, err := net.ParseCIDR(pfx)
+		if err != nil {
+			t.Fatalf("input: %s produced err: %v", pfx, err)
+		}
+		if err := table.Insert(ipNet, value); err != nil {
+			t.Fatalf("insert err: %v", err)
+		}
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			entry, err := table.Lookup(net.ParseIP(tc.input))
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			got := ""
+			if entry != nil {
+				got = entry.Prefix.String() + "=" + entry.Value.(string)
+			}
+
+			diff := cmp.Diff(tc.want, got)
+			if diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestCovered(t *testing.T) {
+	table := New()
+	for _, pfx := range []string{"0.0.0.0/0", "192.0.2.0/24", "192.0.2.128/25", "198.51.100.0/24", "2001:db8::/32"} {
+		_, ipNet, _ := net.ParseCIDR(pfx)
+		if err := table.Insert(ipNet, nil); err != nil {
+			t.Fatalf("insert err: %v", err)
+		}
+	}
+	_, within, _ := net.ParseCIDR("192.0.0.0/8")
+	entries, err := table.Covered(within)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Prefix.String())
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "192.0.2.128/25"}, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestInsertReplaces(t *testing.T) {
+	table := New()
+	_, ipNet, _ := net.ParseCIDR("192.0.2.1/24")
+	for _, value := range []int{1, 2} {
+		if err := table.Insert(ipNet, value); err != nil {
+			t.Fatalf("insert err: %v", err)
+		}
+	}
+	if table.Len() != 1 {
+		t.Fatalf("len: got %d, want 1", table.Len())
+	}
+
+	entries, err := table.Entries()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Prefix.String() != "192.0.2.0/24" || entries[0].Value.(int) != 2 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	removed, err := table.Remove(ipNet)
+	if err != nil {
+		t.Fatalf("remove err: %v", err)
+	}
+	if removed == nil || table.Len() != 0 {
+		t.Fatalf("remove did not remove: %+v, len %d", removed, table.Len())
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	table := New()
+	prefixes := []string{"0.0.0.0/0", "192.0.2.0/24", "192.0.2.128/25", "198.51.100.7/32", "::/0", "2001:db8::/33"}
+	for _, pfx := range prefixes {
+		_, ipNet, err := net.ParseCIDR(pfx)
+		if err != nil {
+			t.Fatalf("input: %s produced err: %v", pfx, err)
+		}
+		if err := table.Insert(ipNet, pfx); err != nil {
+			t.Fatalf("insert err: %v", err)
+		}
+	}
+	encode := func(v interface{}) ([]byte, error) { return []byte(v.(string)), nil }
+	decode := func(b []byte) (interface{}, error) { return string(b), nil }
+
+	var buf bytes.Buffer
+	if err := table.Marshal(&buf, encode); err != nil {
+		t.Fatalf("marshal err: %v", err)
+	}
+	b := buf.Bytes()
+	corrupt := append([]byte(nil), b...)
+	corrupt[20] ^= 1
+
+	tests := map[string]struct {
+		input   []byte
+		decode  func([]byte) (interface{}, error)
+		want    []string
+		wantErr bool
+	}{
+		"Values": {
+			input:  b,
+			decode: decode,
+			want: []string{
+				"0.0.0.0/0=0.0.0.0/0",
+				"192.0.2.0/24=192.0.2.0/24",
+				"192.0.2.128/25=192.0.2.128/25",
+				"198.51.100.7/32=198.51.100.7/32",
+				"::/0=::/0",
+				"2001:db8::/33=2001:db8::/33",
+			},
+		},
+		"NoValues": {
+			input: b,
+			want: []string{
+				"0.0.0.0/0=<nil>",
+				"192.0.2.0/24=<nil>",
+				"192.0.2.128/25=<nil>",
+				"198.51.100.7/32=<nil>",
+				"::/0=<nil>",
+				"2001:db8::/33=<nil>",
+			},
+		},
+		"Corrupt": {
+			input:   corrupt,
+			decode:  decode,
+			wantErr: true,
+		},
+		"Truncated": {
+			input:   b[:len(b)-1],
+			decode:  decode,
+			wantErr: true,
+		},
+		"BadMagic": {
+			input:   append([]byte("XPM"), b[3:]...),
+			decode:  decode,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Unmarshal(bytes.NewReader(tc.input), tc.decode)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			entries, err := got.Entries()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			var strs []string
+			for _, e := range entries {
+				strs = append(strs, fmt.Sprintf("%v=%v", e.Prefix, e.Value))
+			}
+			if diff := cmp.Diff(tc.want, strs); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package lpm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+)
+
+// The binary format starts with a header of the magic bytes, the format version, and the number of entries as a
+// uint32. Each entry is then its address length in bytes (4 or 16), its prefix length, the significant bytes of its
+// address, and its value as a uvarint length followed by the encoded value. A CRC-32 of everything before it ends the
+// table. Integers are big endian.
+const formatVersion = 1
+
+// magic starts every marshalled table.
+var magic = [4]byte{'L', 'P', 'M', 0}
+
+// maxValueLen limits the encoded length of a single value, so that a corrupt length cannot exhaust memory.
+const maxValueLen = 1 << 24
+
+// Marshal writes the table to w in a compact, versioned binary format, encoding each value with encode. If encode is
+// nil, the values are not written, and read back as nil.
+func (t *Table) Marshal(w io.Writer, encode func(value interface{}) ([]byte, error)) error {
+	entries, err := t.Entries()
+	if err != nil {
+		return err
+	}
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	header := make([]byte, 12)
+	copy(header, magic[:])
+	header[4] = formatVersion
+	binary.BigEndian.PutUint32(header[8:], uint32(len(entries)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 2+net.IPv6len+binary.MaxVarintLen64)
+	for _, e := range entries {
+		ones, bits := e.Prefix.Mask.Size()
+		ip := e.Prefix.IP.To4()
+		if bits == 8*net.IPv6len {
+			ip = e.Prefix.IP.To16()
+		}
+		var value []byte
+		if encode != nil {
+			if value, err = encode(e.Value); err != nil {
+				return fmt.Errorf("encode value of %v: %w", e.Prefix, err)
+			}
+		}
+		if len(value) > maxValueLen {
+			return fmt.Errorf("value of %v is %d bytes, more than the limit of %d", e.Prefix, len(value), maxValueLen)
+		}
+		buf[0], buf[1] = byte(len(ip)), byte(ones)
+		n := 2 + copy(buf[2:], ip[:(ones+7)/8])
+		n += binary.PutUvarint(buf[n:], uint64(len(value)))
+		if _, err := bw.Write(buf[:n]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(value); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// Unmarshal reads a table written by Marshal, decoding each value with decode. If decode is nil, the values are nil.
+// The slice passed to decode is reused for the next value, so decode must copy any part of it that it keeps.
+func Unmarshal(r io.Reader, decode func(b []byte) (interface{}, error)) (*Table, error) {
+	crc := crc32.NewIEEE()
+	br := bufio.NewReader(r)
+	tr := io.TeeReader(br, crc)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(tr, header); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if string(header[:4]) != string(magic[:]) {
+		return nil, errors.New("not a marshalled table")
+	}
+	if header[4] != formatVersion {
+		return nil, fmt.Errorf("unsupported format version %d", header[4])
+	}
+	count := binary.BigEndian.Uint32(header[8:])
+
+	t := New()
+	var value []byte
+	for i := uint32(0); i < count; i++ {
+		var head [2]byte
+		if _, err := io.ReadFull(tr, head[:]); err != nil {
+			return nil, fmt.Errorf("read entry %d: %w", i, err)
+		}
+		size, ones := int(head[0]), int(head[1])
+		if (size != net.IPv4len && size != net.IPv6len) || ones > 8*size {
+			return nil, fmt.Errorf("entry %d: invalid prefix length %d for %d byte address", i, ones, size)
+		}
+		ip := make(net.IP, size)
+		if _, err := io.ReadFull(tr, ip[:(ones+7)/8]); err != nil {
+			return nil, fmt.Errorf("read entry %d: %w", i, err)
+		}
+		n, err := binary.ReadUvarint(byteReader{tr})
+		if err != nil {
+			return nil, fmt.Errorf("read entry %d: %w", i, err)
+		}
+		if n > maxValueLen {
+			return nil, fmt.Errorf("entry %d: value of %d bytes is more than the limit of %d", i, n, maxValueLen)
+		}
+		if cap(value) < int(n) {
+			value = make([]byte, n)
+		}
+		value = value[:n]
+		if _, err := io.ReadFull(tr, value); err != nil {
+			return nil, fmt.Errorf("read entry %d: %w", i, err)
+		}
+
+		var v interface{}
+		if decode != nil {
+			if v, err = decode(value); err != nil {
+				return nil, fmt.Errorf("decode value of entry %d: %w", i, err)
+			}
+		}
+		if err := t.Insert(&net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 8*size)}, v); err != nil {
+			return nil, err
+		}
+	}
+
+	var sum uint32
+	if err := binary.Read(br, binary.BigEndian, &sum); err != nil {
+		return nil, fmt.Errorf("read checksum: %w", err)
+	}
+	if sum != crc.Sum32() {
+		return nil, errors.New("checksum mismatch")
+	}
+	return t, nil
+}
+
+// byteReader adapts an io.Reader to the io.ByteReader needed to read varints, reading a byte at a time.
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
@@ -0,0 +1,198 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Types of the values in the data section.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// maxDepth bounds the nesting of maps and arrays, so a corrupt database cannot exhaust the stack.
+const maxDepth = 64
+
+var errTruncated = errors.New("data truncated")
+
+// decoder decodes values from a data section, to which pointers are relative.
+type decoder struct {
+	data []byte
+}
+
+// decode decodes the value at an offset, returning it and the offset following it. Maps are decoded as
+// map[string]interface{}, arrays as []interface{}, unsigned integers of up to 64 bits as uint64, int32 as int64,
+// uint128 as *big.Int, double as float64, and float as float32.
+func (d *decoder) decode(offset, depth int) (interface{}, int, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		// A pointer is followed by the value after it, not the one it points to.
+		v, _, err := d.decode(size, depth+1)
+		return v, offset, err
+	}
+	if typ == typeMap || typ == typeArray {
+		return d.collection(typ, size, offset, depth)
+	}
+	if typ == typeBool {
+		return size != 0, offset, nil
+	}
+	if offset+size > len(d.data) {
+		return nil, 0, errTruncated
+	}
+	b, next := d.data[offset:offset+size], offset+size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > map[int]int{typeUint16: 2, typeUint32: 4, typeUint64: 8}[typ] {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		return uint64Of(b), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		return int64(int32(uint64Of(b))), next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d", size)
+		}
+		return new(big.Int).SetBytes(b), next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+}
+
+// collection decodes the entries of a map or array.
+func (d *decoder) collection(typ, size, offset, depth int) (interface{}, int, error) {
+	if typ == typeArray {
+		a := make([]interface{}, 0, minInt(size, len(d.data)))
+		for i := 0; i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, offset = append(a, v), next
+		}
+		return a, offset, nil
+	}
+	m := make(map[string]interface{}, minInt(size, len(d.data)))
+	for i := 0; i < size; i++ {
+		k, next, err := d.decode(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("map key of type %T", k)
+		}
+		if m[key], offset, err = d.decode(next, depth+1); err != nil {
+			return nil, 0, err
+		}
+	}
+	return m, offset, nil
+}
+
+// control decodes the control byte at an offset, and the extended type and size that may follow it, returning the
+// type and size of the value and the offset of its payload. For pointers, the size is the offset pointed to.
+func (d *decoder) control(offset int) (typ, size, next int, err error) {
+	if offset >= len(d.data) {
+		return 0, 0, 0, errTruncated
+	}
+	ctrl := d.data[offset]
+	offset++
+	typ = int(ctrl >> 5)
+
+	if typ == typePointer {
+		n := int(ctrl>>3&0x3) + 1
+		if offset+n > len(d.data) {
+			return 0, 0, 0, errTruncated
+		}
+		b := d.data[offset : offset+n]
+		switch n {
+		case 1:
+			size = int(ctrl&0x7)<<8 | int(b[0])
+		case 2:
+			size = (int(ctrl&0x7)<<16 | int(uint64Of(b))) + 2048
+		case 3:
+			size = (int(ctrl&0x7)<<24 | int(uint64Of(b))) + 526336
+		case 4:
+			size = int(uint64Of(b))
+		}
+		return typ, size, offset + n, nil
+	}
+
+	if typ == typeExtended {
+		if offset >= len(d.data) {
+			return 0, 0, 0, errTruncated
+		}
+		typ = 7 + int(d.data[offset])
+		offset++
+		if typ < typeInt32 {
+			return 0, 0, 0, fmt.Errorf("invalid extended type %d", typ)
+		}
+	}
+	size = int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.data) {
+			return 0, 0, 0, errTruncated
+		}
+		size = []int{29, 285, 65821}[n-1] + int(uint64Of(d.data[offset:offset+n]))
+		offset += n
+	}
+	return typ, size, offset, nil
+}
+
+// uint64Of returns the big-endian unsigned integer held in up to 8 octets.
+func uint64Of(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// minInt returns the lesser of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,223 @@
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// metadataMarker precedes the metadata at the end of a database.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// maxMetadataLen is how far from the end of a database the metadata marker is looked for.
+const maxMetadataLen = 128 * 1024
+
+// dataSeparatorLen is the length of the zeros between the search tree and the data section.
+const dataSeparatorLen = 16
+
+// Metadata describes a database.
+type Metadata struct {
+	DatabaseType string // Such as GeoLite2-Country or GeoLite2-ASN.
+	Description  map[string]string
+	Languages    []string
+	IPVersion    int // 4 if the database only holds IPv4 addresses, or 6 if it holds both.
+	NodeCount    int
+	RecordSize   int // The bits of each record of the search tree: 24, 28, or 32.
+	MajorVersion int
+	MinorVersion int
+	BuildTime    time.Time
+}
+
+// Reader looks addresses up in a MaxMind DB, the format of the GeoIP2 and GeoLite2 databases and those of several
+// other providers. The whole database is held in memory. It is safe for concurrent use.
+type Reader struct {
+	Metadata Metadata
+	tree     []byte
+	data     decoder
+	v4Start  int // The node holding the IPv4 addresses, at ::/96 of an IPv6 database.
+}
+
+// Open reads the database in a file.
+func Open(path string) (*Reader, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(b)
+}
+
+// NewReader returns a Reader of the database held in b, which must not be modified afterwards.
+func NewReader(b []byte) (*Reader, error) {
+	start := len(b) - maxMetadataLen
+	if start < 0 {
+		start = 0
+	}
+	i := bytes.LastIndex(b[start:], metadataMarker)
+	if i < 0 {
+		return nil, errors.New("not a maxmind db: no metadata")
+	}
+	metaStart := start + i + len(metadataMarker)
+	meta, _, err := (&decoder{data: b[metaStart:]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+
+	r := &Reader{}
+	md := &r.Metadata
+	md.DatabaseType, _ = m["database_type"].(string)
+	md.IPVersion = intOf(m["ip_version"])
+	md.NodeCount = intOf(m["node_count"])
+	md.RecordSize = intOf(m["record_size"])
+	md.MajorVersion = intOf(m["binary_format_major_version"])
+	md.MinorVersion = intOf(m["binary_format_minor_version"])
+	if epoch, ok := m["build_epoch"].(uint64); ok {
+		md.BuildTime = time.Unix(int64(epoch), 0).UTC()
+	}
+	if langs, ok := m["languages"].([]interface{}); ok {
+		for _, lang := range langs {
+			if s, ok := lang.(string); ok {
+				md.Languages = append(md.Languages, s)
+			}
+		}
+	}
+	if desc, ok := m["description"].(map[string]interface{}); ok {
+		md.Description = map[string]string{}
+		for lang, v := range desc {
+			md.Description[lang], _ = v.(string)
+		}
+	}
+
+	if md.MajorVersion != 2 {
+		return nil, fmt.Errorf("unsupported format version %d", md.MajorVersion)
+	}
+	if md.RecordSize != 24 && md.RecordSize != 28 && md.RecordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", md.RecordSize)
+	}
+	if md.IPVersion != 4 && md.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", md.IPVersion)
+	}
+	treeLen := md.NodeCount * md.RecordSize / 4
+	dataStart := treeLen + dataSeparatorLen
+	if md.NodeCount <= 0 || dataStart > start+i {
+		return nil, fmt.Errorf("invalid node count %d", md.NodeCount)
+	}
+	r.tree, r.data.data = b[:treeLen], b[dataStart:start+i]
+
+	if md.IPVersion == 6 {
+		for bit := 0; bit < 96 && r.v4Start < md.NodeCount; bit++ {
+			r.v4Start = r.record(r.v4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// intOf returns an unsigned integer from decoded data as an int, or zero if it is not one.
+func intOf(v interface{}) int {
+	u, _ := v.(uint64)
+	return int(u)
+}
+
+// record returns the left (0) or right (1) record of a node of the search tree.
+func (r *Reader) record(node, bit int) int {
+	switch r.Metadata.RecordSize {
+	case 24:
+		b := r.tree[node*6+bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return int(b[3]&0xf0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		}
+		return int(b[3]&0x0f)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6])
+	}
+	b := r.tree[node*8+bit*4:]
+	return int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+}
+
+// Result is the outcome of looking up an address.
+type Result struct {
+	// The network containing the address that the database describes alike, which is the network without data if the
+	// address was not found.
+	Network *net.IPNet
+	Data    interface{} // The data of the network, usually a map[string]interface{}, or nil if it was not found.
+}
+
+// Lookup looks up an address. Looking up an IPv6 address in an IPv4 database returns an error.
+func (r *Reader) Lookup(ip net.IP) (*Result, error) {
+	node, bits, v4 := 0, 8*net.IPv6len, ip.To4() != nil
+	if v4 {
+		ip, bits = ip.To4(), 8*net.IPv4len
+		if r.Metadata.IPVersion == 6 {
+			node = r.v4Start
+		}
+	} else if ip = ip.To16(); ip == nil {
+		return nil, fmt.Errorf("invalid ip address %v", ip)
+	} else if r.Metadata.IPVersion == 4 {
+		return nil, fmt.Errorf("ipv6 address %v in an ipv4 database", ip)
+	}
+
+	depth := 0
+	for ; depth < bits && node < r.Metadata.NodeCount; depth++ {
+		node = r.record(node, int(ip[depth/8]>>(7-uint(depth%8))&1))
+	}
+	res := &Result{Network: &net.IPNet{IP: ip.Mask(net.CIDRMask(depth, bits)), Mask: net.CIDRMask(depth, bits)}}
+	switch {
+	case node == r.Metadata.NodeCount:
+		return res, nil
+	case node < r.Metadata.NodeCount:
+		return nil, errors.New("search tree deeper than the address")
+	}
+	offset := node - r.Metadata.NodeCount - dataSeparatorLen
+	if offset < 0 || offset >= len(r.data.data) {
+		return nil, fmt.Errorf("invalid data pointer %d", node)
+	}
+	data, _, err := r.data.decode(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding data of %v: %w", res.Network, err)
+	}
+	res.Data = data
+	return res, nil
+}
+
+// Get returns the value at a path of map keys within the data, or nil if there is none.
+func (res *Result) Get(keys ...string) interface{} {
+	v := res.Data
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country of the address, in the schema of the GeoIP2 Country and
+// City databases: the country where it is located, or failing that, the country it is registered to.
+func (res *Result) Country() string {
+	if s, ok := res.Get("country", "iso_code").(string); ok {
+		return s
+	}
+	s, _ := res.Get("registered_country", "iso_code").(string)
+	return s
+}
+
+// ASN returns the number of the AS announcing the address, in the schema of the GeoLite2 ASN database, or zero.
+func (res *Result) ASN() uint32 {
+	asn, _ := res.Get("autonomous_system_number").(uint64)
+	return uint32(asn)
+}
+
+// Organization returns the name of the organisation of the AS announcing the address, in the schema of the GeoLite2
+// ASN database.
+func (res *Result) Organization() string {
+	s, _ := res.Get("autonomous_system_organization").(string)
+	return s
+}
@@ -0,0 +1,365 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// encode encodes a value of the data section.
+func encode(v interface{}) []byte {
+	var buf bytes.Buffer
+	ctrl := func(typ, size int) {
+		var ext []byte
+		if typ > 7 {
+			ext, typ = []byte{byte(typ - 7)}, typeExtended
+		}
+		switch {
+		case size < 29:
+			buf.WriteByte(byte(typ<<5 | size))
+			buf.Write(ext)
+		case size < 285:
+			buf.WriteByte(byte(typ<<5 | 29))
+			buf.Write(ext)
+			buf.WriteByte(byte(size - 29))
+		default:
+			buf.WriteByte(byte(typ<<5 | 30))
+			buf.Write(ext)
+			buf.Write([]byte{byte((size - 285) >> 8), byte(size - 285)})
+		}
+	}
+	unsigned := func(typ int, u uint64) {
+		var b []byte
+		for ; u > 0; u >>= 8 {
+			b = append([]byte{byte(u)}, b...)
+		}
+		ctrl(typ, len(b))
+		buf.Write(b)
+	}
+
+	switch v := v.(type) {
+	case string:
+		ctrl(typeString, len(v))
+		buf.WriteString(v)
+	case []byte:
+		ctrl(typeBytes, len(v))
+		buf.Write(v)
+	case uint16:
+		unsigned(typeUint16, uint64(v))
+	case uint32:
+		unsigned(typeUint32, uint64(v))
+	case uint64:
+		unsigned(typeUint64, v)
+	case int32:
+		unsigned(typeInt32, uint64(uint32(v)))
+	case *big.Int:
+		ctrl(typeUint128, len(v.Bytes()))
+		buf.Write(v.Bytes())
+	case float64:
+		ctrl(typeDouble, 8)
+		binary.Write(&buf, binary.BigEndian, math.Float64bits(v))
+	case float32:
+		ctrl(typeFloat, 4)
+		binary.Write(&buf, binary.BigEndian, math.Float32bits(v))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		ctrl(typeBool, size)
+	case []interface{}:
+		ctrl(typeArray, len(v))
+		for _, e := range v {
+			buf.Write(encode(e))
+		}
+	case map[string]interface{}:
+		ctrl(typeMap, len(v))
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.Write(encode(k))
+			buf.Write(encode(v[k]))
+		}
+	default:
+		panic(v)
+	}
+	return buf.Bytes()
+}
+
+// trieNode is a node of the search tree of a database being built.
+type trieNode struct {
+	child [2]*trieNode
+	data  interface{} // Of a leaf.
+}
+
+// build builds a database of the given record size holding the data of each prefix, with IPv4 prefixes at ::/96 of an
+// IPv6 database.
+func build(recordSize, ipVersion int, prefixes map[string]interface{}) []byte {
+	root := &trieNode{}
+	for s, data := range prefixes {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		ones, bits := pfx.Mask.Size()
+		ip := pfx.IP
+		if ipVersion == 6 && bits == 32 {
+			ip, ones = append(make(net.IP, 12), ip.To4()...), ones+96
+		}
+		n := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if n.child[bit] == nil {
+				n.child[bit] = &trieNode{}
+			}
+			n = n.child[bit]
+		}
+		n.data = data
+	}
+
+	// Number the internal nodes breadth first, and lay out the data of the leaves.
+	var nodes []*trieNode
+	numbers := map[*trieNode]int{}
+	offsets := map[*trieNode]int{}
+	var data bytes.Buffer
+	for queue := []*trieNode{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		if n.data != nil {
+			offsets[n] = data.Len()
+			data.Write(encode(n.data))
+			continue
+		}
+		numbers[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.child {
+			if c != nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	var tree bytes.Buffer
+	for _, n := range nodes {
+		var records [2]int
+		for i, c := range n.child {
+			switch {
+			case c == nil:
+				records[i] = len(nodes)
+			case c.data != nil:
+				records[i] = len(nodes) + dataSeparatorLen + offsets[c]
+			default:
+				records[i] = numbers[c]
+			}
+		}
+		l, r := records[0], records[1]
+		switch recordSize {
+		case 24:
+			tree.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			tree.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24<<4 | r>>24&0xf),
+				byte(r >> 16), byte(r >> 8), byte(r)})
+		case 32:
+			binary.Write(&tree, binary.BigEndian, [2]uint32{uint32(l), uint32(r)})
+		}
+	}
+
+	var b bytes.Buffer
+	b.Write(tree.Bytes())
+	b.Write(make([]byte, dataSeparatorLen))
+	b.Write(data.Bytes())
+	b.Write(metadataMarker)
+	b.Write(encode(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1600000000),
+		"database_type":               "Test",
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint16(ipVersion),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(recordSize),
+	}))
+	return b.Bytes()
+}
+
+func TestLookup(t *testing.T) {
+	prefixes := map[string]interface{}{
+		"1.1.1.0/24": map[string]interface{}{
+			"autonomous_system_number":       uint32(13335),
+			"autonomous_system_organization": "CLOUDFLARENET",
+		},
+		"81.2.69.0/24": map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom"}},
+		},
+		"2001:db8::/32": map[string]interface{}{
+			"registered_country": map[string]interface{}{"iso_code": "NL"},
+		},
+	}
+	type result struct {
+		Network      string
+		Country      string
+		ASN          uint32
+		Organization string
+	}
+	tests := map[string]struct {
+		ip   string
+		want result
+	}{
+		"ASN":        {"1.1.1.1", result{"1.1.1.0/24", "", 13335, "CLOUDFLARENET"}},
+		"Country":    {"81.2.69.160", result{"81.2.69.0/24", "GB", 0, ""}},
+		"Registered": {"2001:db8::1", result{"2001:db8::/32", "NL", 0, ""}},
+		"NotFound4":  {"1.1.2.1", result{Network: "1.1.2.0/23"}},
+		"NotFound6":  {"2001:db9::1", result{Network: "2001:db9::/32"}},
+		"Mapped":     {"::ffff:1.1.1.1", result{"1.1.1.0/24", "", 13335, "CLOUDFLARENET"}},
+	}
+
+	for _, size := range []int{24, 28, 32} {
+		r, err := NewReader(build(size, 6, prefixes))
+		if err != nil {
+			t.Fatalf("record size %d: %v", size, err)
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				res, err := r.Lookup(net.ParseIP(tc.ip))
+				if err != nil {
+					t.Fatalf("record size %d: %v", size, err)
+				}
+				got := result{res.Network.String(), res.Country(), res.ASN(), res.Organization()}
+				if diff := cmp.Diff(tc.want, got); diff != "" {
+					t.Fatalf("record size %d: %v", size, diff)
+				}
+			})
+		}
+	}
+}
+
+func TestIPv4Database(t *testing.T) {
+	r, err := NewReader(build(24, 4, map[string]interface{}{"192.0.2.0/25": map[string]interface{}{"x": true}}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	res, err := r.Lookup(net.ParseIP("192.0.2.1"))
+	if err != nil || res.Network.String() != "192.0.2.0/25" || res.Get("x") != true {
+		t.Fatalf("got %+v, err %v", res, err)
+	}
+	if _, err := r.Lookup(net.ParseIP("2001:db8::1")); err == nil {
+		t.Fatalf("got no error looking up ipv6 in an ipv4 database")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := ioutil.WriteFile(path, build(28, 6, nil), 0o644); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("open err: %v", err)
+	}
+	want := Metadata{
+		DatabaseType: "Test",
+		Description:  map[string]string{"en": "Test database"},
+		Languages:    []string{"en"},
+		IPVersion:    6,
+		NodeCount:    1,
+		RecordSize:   28,
+		MajorVersion: 2,
+		BuildTime:    time.Unix(1600000000, 0).UTC(),
+	}
+	if diff := cmp.Diff(want, r.Metadata); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	if _, err := NewReader([]byte("not a database")); err == nil {
+		t.Fatalf("got no error from a file that is not a database")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	long := string(bytes.Repeat([]byte("x"), 300))
+	tests := map[string]interface{}{
+		"String":     "hello",
+		"LongString": long,
+		"Bytes":      []byte{1, 2, 3},
+		"Uint16":     uint16(65535),
+		"Uint32":     uint32(4294967295),
+		"Uint64":     uint64(1) << 63,
+		"Int32":      int32(-5),
+		"Uint128":    new(big.Int).Lsh(big.NewInt(1), 100),
+		"Double":     3.25,
+		"Float":      float32(1.5),
+		"Bool":       true,
+		"Array":      []interface{}{"a", false},
+		"Map":        map[string]interface{}{"a": map[string]interface{}{"b": "c"}},
+	}
+	// What each value decodes to, where it is not the value itself.
+	decoded := map[string]interface{}{
+		"Uint16": uint64(65535),
+		"Uint32": uint64(4294967295),
+		"Uint64": uint64(1) << 63,
+		"Int32":  int64(-5),
+		"Array":  []interface{}{"a", false},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := encode(v)
+			got, next, err := (&decoder{data: b}).decode(0, 0)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if next != len(b) {
+				t.Fatalf("decoded %d of %d octets", next, len(b))
+			}
+			want, ok := decoded[name]
+			if !ok {
+				want = v
+			}
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *big.Int) bool { return a.Cmp(b) == 0 })); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	t.Run("Pointer", func(t *testing.T) {
+		// A map whose value points to the string at offset 0, followed by a pointer to the map itself.
+		data := encode("shared")
+		mapOffset := len(data)
+		data = append(data, 0xe1)
+		data = append(data, encode("key")...)
+		data = append(data, 0x20, 0x00)
+		data = append(data, 0x20, byte(mapOffset))
+		got, next, err := (&decoder{data: data}).decode(len(data)-2, 0)
+		if err != nil || next != len(data) {
+			t.Fatalf("got next %d, err %v", next, err)
+		}
+		if diff := cmp.Diff(map[string]interface{}{"key": "shared"}, got); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		b := encode(map[string]interface{}{"a": "bcd"})
+		if _, _, err := (&decoder{data: b[:len(b)-1]}).decode(0, 0); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		// An array holding a pointer to itself.
+		if _, _, err := (&decoder{data: []byte{0x01, 0x04, 0x20, 0x00}}).decode(0, 0); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+}
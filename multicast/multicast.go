@@ -0,0 +1,225 @@
+package multicast
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Defaults used by a Sender whose fields are not set.
+const (
+	DefaultCount    = 10
+	DefaultInterval = time.Second
+	DefaultTTL      = 1 // The TTL or hop limit of the kernel, which keeps traffic on the link.
+	DefaultSize     = 64
+)
+
+// magic identifies test packets.
+const magic = 0x4d435354
+
+// HeaderLen is the length of the header of a test packet, and so the smallest size a test packet can be.
+const HeaderLen = 16
+
+var (
+	// ErrNotMulticast is returned when an address that must be a multicast group is not one.
+	ErrNotMulticast = errors.New("not a multicast address")
+
+	// ErrUnsupportedPlatform is returned on platforms where group membership is not implemented.
+	ErrUnsupportedPlatform = errors.New("unsupported platform")
+)
+
+// Join joins the socket to a group on an interface, or on the interface the routing table chooses if iface is nil. The
+// kernel sends IGMP or MLD reports for the group on the interface while any socket is a member.
+func Join(conn *net.UDPConn, group net.IP, iface *net.Interface) error {
+	if !group.IsMulticast() {
+		return fmt.Errorf("%w: %v", ErrNotMulticast, group)
+	}
+	return setMembership(conn, group, iface, true)
+}
+
+// Leave removes the socket from a group it joined on an interface.
+func Leave(conn *net.UDPConn, group net.IP, iface *net.Interface) error {
+	if !group.IsMulticast() {
+		return fmt.Errorf("%w: %v", ErrNotMulticast, group)
+	}
+	return setMembership(conn, group, iface, false)
+}
+
+// Membership is the membership of a group on an interface, by one or more sockets or the kernel itself.
+type Membership struct {
+	Interface string
+	Index     int
+	Group     net.IP
+	Users     int // The number of memberships held, such as by sockets.
+}
+
+func (m Membership) String() string {
+	return fmt.Sprintf("%v on %s", m.Group, m.Interface)
+}
+
+// Memberships returns the groups the host is a member of, of both families, sorted by interface index and then group.
+func Memberships() ([]Membership, error) {
+	ms, err := memberships()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].Index != ms[j].Index {
+			return ms[i].Index < ms[j].Index
+		}
+		a, b := ms[i].Group.To16(), ms[j].Group.To16()
+		return string(a) < string(b)
+	})
+	return ms, nil
+}
+
+// parseIGMP parses the IPv4 memberships in the format of /proc/net/igmp on Linux, where each interface is followed by
+// indented lines for its groups. Groups are printed as 32 bit integers in the byte order of the host.
+func parseIGMP(r io.Reader) ([]Membership, error) {
+	var ms []Membership
+	var name string
+	var index int
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		fields := strings.Fields(line)
+		switch {
+		case n == 1 || len(fields) == 0:
+			continue
+		case !strings.HasPrefix(line, "\t\t"):
+			i, err := strconv.Atoi(fields[0])
+			if err != nil || len(fields) < 2 {
+				return nil, fmt.Errorf("invalid igmp interface on line %d: %q", n, line)
+			}
+			index, name = i, strings.TrimSuffix(fields[1], ":")
+		default:
+			v, err := strconv.ParseUint(fields[0], 16, 32)
+			if err != nil || len(fields) < 2 || name == "" {
+				return nil, fmt.Errorf("invalid igmp group on line %d: %q", n, line)
+			}
+			users, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid igmp users on line %d: %q", n, line)
+			}
+			group := make(net.IP, net.IPv4len)
+			*(*uint32)(unsafe.Pointer(&group[0])) = uint32(v)
+			ms = append(ms, Membership{Interface: name, Index: index, Group: group, Users: users})
+		}
+	}
+	return ms, s.Err()
+}
+
+// parseIGMP6 parses the IPv6 memberships in the format of /proc/net/igmp6 on Linux, one group on each line.
+func parseIGMP6(r io.Reader) ([]Membership, error) {
+	var ms []Membership
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid igmp6 membership on line %d: %q", n, s.Text())
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid igmp6 interface index on line %d: %q", n, s.Text())
+		}
+		group, err := hex.DecodeString(fields[2])
+		if err != nil || len(group) != net.IPv6len {
+			return nil, fmt.Errorf("invalid igmp6 group on line %d: %q", n, s.Text())
+		}
+		users, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid igmp6 users on line %d: %q", n, s.Text())
+		}
+		ms = append(ms, Membership{Interface: fields[1], Index: index, Group: net.IP(group), Users: users})
+	}
+	return ms, s.Err()
+}
+
+// Sender sends a stream of test packets to a group. Each carries a sequence number and the time it was sent, which
+// ParsePacket recovers, so that receivers can count loss and measure delay. The zero value is usable.
+type Sender struct {
+	Interface *net.Interface // The interface to send on, or the one the routing table chooses if nil.
+	TTL       int            // The TTL or hop limit, or DefaultTTL if zero.
+	Loopback  bool           // Whether the packets are also delivered to members on this host.
+	Count     int            // The number of packets, or DefaultCount if zero.
+	Interval  time.Duration  // The time between packets, or DefaultInterval if zero.
+	Size      int            // The size of the UDP payload, or DefaultSize if zero; at least HeaderLen.
+}
+
+// Send sends the test packets to a group and port, returning the number sent. It stops early if the context is done.
+func (s *Sender) Send(ctx context.Context, group *net.UDPAddr) (int, error) {
+	if !group.IP.IsMulticast() {
+		return 0, fmt.Errorf("%w: %v", ErrNotMulticast, group.IP)
+	}
+	ttl, count, interval, size := s.TTL, s.Count, s.Interval, s.Size
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if count <= 0 {
+		count = DefaultCount
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if size <= 0 {
+		size = DefaultSize
+	}
+	if size < HeaderLen {
+		return 0, fmt.Errorf("test packet size %d smaller than %d byte header", size, HeaderLen)
+	}
+
+	network := "udp4"
+	if group.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := setSendOptions(conn, group.IP.To4() == nil, s.Interface, ttl, s.Loopback); err != nil {
+		return 0, err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	b := make([]byte, size)
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+				return seq, ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		binary.BigEndian.PutUint32(b, magic)
+		binary.BigEndian.PutUint32(b[4:], uint32(seq))
+		binary.BigEndian.PutUint64(b[8:], uint64(time.Now().UnixNano()))
+		if _, err := conn.WriteToUDP(b, group); err != nil {
+			return seq, err
+		}
+	}
+	return count, nil
+}
+
+// ParsePacket returns the sequence number of a test packet sent by a Sender, and the time it was sent, failing if it
+// is not a test packet.
+func ParsePacket(b []byte) (uint32, time.Time, error) {
+	if len(b) < HeaderLen || binary.BigEndian.Uint32(b) != magic {
+		return 0, time.Time{}, errors.New("not a multicast test packet")
+	}
+	return binary.BigEndian.Uint32(b[4:]), time.Unix(0, int64(binary.BigEndian.Uint64(b[8:]))), nil
+}
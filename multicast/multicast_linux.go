@@ -0,0 +1,116 @@
+// +build linux
+
+package multicast
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// setMembership joins or leaves a group on an interface, or the one the routing table chooses if iface is nil.
+func setMembership(conn *net.UDPConn, group net.IP, iface *net.Interface, join bool) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	index := 0
+	if iface != nil {
+		index = iface.Index
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		if ip4 := group.To4(); ip4 != nil {
+			opt, name := syscall.IP_ADD_MEMBERSHIP, "setsockopt IP_ADD_MEMBERSHIP"
+			if !join {
+				opt, name = syscall.IP_DROP_MEMBERSHIP, "setsockopt IP_DROP_MEMBERSHIP"
+			}
+			mreq := &syscall.IPMreqn{Ifindex: int32(index)}
+			copy(mreq.Multiaddr[:], ip4)
+			serr = os.NewSyscallError(name, syscall.SetsockoptIPMreqn(int(fd), syscall.IPPROTO_IP, opt, mreq))
+			return
+		}
+		opt, name := syscall.IPV6_JOIN_GROUP, "setsockopt IPV6_JOIN_GROUP"
+		if !join {
+			opt, name = syscall.IPV6_LEAVE_GROUP, "setsockopt IPV6_LEAVE_GROUP"
+		}
+		mreq := &syscall.IPv6Mreq{Interface: uint32(index)}
+		copy(mreq.Multiaddr[:], group.To16())
+		serr = os.NewSyscallError(name, syscall.SetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IPV6, opt, mreq))
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// setSendOptions sets the interface, TTL and loopback of the multicast packets subsequently sent on conn.
+func setSendOptions(conn *net.UDPConn, v6 bool, iface *net.Interface, ttl int, loopback bool) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	loop := 0
+	if loopback {
+		loop = 1
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		s := int(fd)
+		if v6 {
+			if iface != nil {
+				serr = os.NewSyscallError("setsockopt IPV6_MULTICAST_IF",
+					syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, iface.Index))
+			}
+			if serr == nil {
+				serr = os.NewSyscallError("setsockopt IPV6_MULTICAST_HOPS",
+					syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, ttl))
+			}
+			if serr == nil {
+				serr = os.NewSyscallError("setsockopt IPV6_MULTICAST_LOOP",
+					syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_LOOP, loop))
+			}
+			return
+		}
+		if iface != nil {
+			serr = os.NewSyscallError("setsockopt IP_MULTICAST_IF", syscall.SetsockoptIPMreqn(s,
+				syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, &syscall.IPMreqn{Ifindex: int32(iface.Index)}))
+		}
+		if serr == nil {
+			serr = os.NewSyscallError("setsockopt IP_MULTICAST_TTL",
+				syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, ttl))
+		}
+		if serr == nil {
+			serr = os.NewSyscallError("setsockopt IP_MULTICAST_LOOP",
+				syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, loop))
+		}
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// memberships reads the memberships from /proc/net/igmp and /proc/net/igmp6, either of which is absent if its family
+// is disabled.
+func memberships() ([]Membership, error) {
+	var ms []Membership
+	for _, f := range []struct {
+		path  string
+		parse func(io.Reader) ([]Membership, error)
+	}{{"/proc/net/igmp", parseIGMP}, {"/proc/net/igmp6", parseIGMP6}} {
+		file, err := os.Open(f.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fms, err := f.parse(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, fms...)
+	}
+	return ms, nil
+}
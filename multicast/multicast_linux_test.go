@@ -0,0 +1,84 @@
+// +build linux
+
+package multicast
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// multicastInterface returns an interface that is up and supports multicast, skipping the test if there is none.
+func multicastInterface(t *testing.T) *net.Interface {
+	t.Helper()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("interfaces err: %v", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagLoopback == 0 {
+			iface := iface
+			return &iface
+		}
+	}
+	t.Skip("no multicast interface")
+	return nil
+}
+
+// member reports whether the host is a member of a group on an interface.
+func member(t *testing.T, group net.IP, iface *net.Interface) bool {
+	t.Helper()
+	ms, err := Memberships()
+	if err != nil {
+		t.Fatalf("memberships err: %v", err)
+	}
+	for _, m := range ms {
+		if m.Index == iface.Index && m.Group.Equal(group) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestJoinSend(t *testing.T) {
+	iface := multicastInterface(t)
+	group := &net.UDPAddr{IP: net.ParseIP("239.255.77.77")}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: 0})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer conn.Close()
+	group.Port = conn.LocalAddr().(*net.UDPAddr).Port
+
+	if err := Join(conn, group.IP, iface); err != nil {
+		t.Fatalf("join err: %v", err)
+	}
+	if !member(t, group.IP, iface) {
+		t.Fatalf("%v not joined on %s", group.IP, iface.Name)
+	}
+
+	s := &Sender{Interface: iface, Loopback: true, Count: 3, Interval: time.Millisecond, Size: 100}
+	if n, err := s.Send(context.Background(), group); n != 3 || err != nil {
+		t.Fatalf("sent %d packets, err %v", n, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	for want := uint32(0); want < 3; want++ {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read err: %v", err)
+		}
+		seq, sent, err := ParsePacket(buf[:n])
+		if err != nil || seq != want || n != 100 || time.Since(sent) > time.Second {
+			t.Fatalf("got packet %d of %d bytes sent at %v, err %v", seq, n, sent, err)
+		}
+	}
+
+	if err := Leave(conn, group.IP, iface); err != nil {
+		t.Fatalf("leave err: %v", err)
+	}
+	if member(t, group.IP, iface) {
+		t.Fatalf("%v still joined on %s", group.IP, iface.Name)
+	}
+}
@@ -0,0 +1,20 @@
+// +build !linux
+
+package multicast
+
+import "net"
+
+// setMembership is only implemented on Linux.
+func setMembership(*net.UDPConn, net.IP, *net.Interface, bool) error {
+	return ErrUnsupportedPlatform
+}
+
+// setSendOptions is only implemented on Linux.
+func setSendOptions(*net.UDPConn, bool, *net.Interface, int, bool) error {
+	return ErrUnsupportedPlatform
+}
+
+// memberships is only implemented on Linux, where they are listed in /proc.
+func memberships() ([]Membership, error) {
+	return nil, ErrUnsupportedPlatform
+}
@@ -0,0 +1,87 @@
+package multicast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestParseIGMP(t *testing.T) {
+	// Groups are printed in the byte order of the host.
+	group := net.IP{239, 1, 2, 3}
+	hostOrder := fmt.Sprintf("%08X", *(*uint32)(unsafe.Pointer(&group[0])))
+	allHosts := net.IP{224, 0, 0, 1}
+	allHostsOrder := fmt.Sprintf("%08X", *(*uint32)(unsafe.Pointer(&allHosts[0])))
+	in := "Idx\tDevice    : Count Querier\tGroup    Users Timer\tReporter\n" +
+		"1\tlo        :     1      V3\n" +
+		"\t\t\t\t" + allHostsOrder + "     1 0:00000000\t\t0\n" +
+		"4\teth0      :     2      V3\n" +
+		"\t\t\t\t" + hostOrder + "     2 0:00000000\t\t0\n" +
+		"\t\t\t\t" + allHostsOrder + "     1 0:00000000\t\t0\n"
+	got, err := parseIGMP(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	want := []Membership{
+		{Interface: "lo", Index: 1, Group: allHosts, Users: 1},
+		{Interface: "eth0", Index: 4, Group: group, Users: 2},
+		{Interface: "eth0", Index: 4, Group: allHosts, Users: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if _, err := parseIGMP(strings.NewReader("header\n\t\t\t\tnothex 1 0:0 0\n")); err == nil {
+		t.Fatalf("parsed an invalid group")
+	}
+}
+
+func TestParseIGMP6(t *testing.T) {
+	in := "1    lo              ff020000000000000000000000000001     1 0000000C 0\n" +
+		"4    eth0            ff0200000000000000000001ff000002     3 00000004 0\n"
+	got, err := parseIGMP6(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	want := []Membership{
+		{Interface: "lo", Index: 1, Group: net.ParseIP("ff02::1"), Users: 1},
+		{Interface: "eth0", Index: 4, Group: net.ParseIP("ff02::1:ff00:2"), Users: 3},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if _, err := parseIGMP6(strings.NewReader("1 lo ff02 1 0 0\n")); err == nil {
+		t.Fatalf("parsed a short group")
+	}
+}
+
+func TestNotMulticast(t *testing.T) {
+	if err := Join(nil, net.ParseIP("192.0.2.1"), nil); !errors.Is(err, ErrNotMulticast) {
+		t.Fatalf("got join err %v", err)
+	}
+	if err := Leave(nil, net.ParseIP("2001:db8::1"), nil); !errors.Is(err, ErrNotMulticast) {
+		t.Fatalf("got leave err %v", err)
+	}
+	s := &Sender{}
+	_, err := s.Send(context.Background(), &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 9})
+	if !errors.Is(err, ErrNotMulticast) {
+		t.Fatalf("got send err %v", err)
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	if _, _, err := ParsePacket(make([]byte, HeaderLen)); err == nil {
+		t.Fatalf("parsed a packet without the magic number")
+	}
+	if _, _, err := ParsePacket([]byte{0x4d, 0x43, 0x53, 0x54}); err == nil {
+		t.Fatalf("parsed a short packet")
+	}
+	s := &Sender{Size: HeaderLen - 1}
+	if _, err := s.Send(context.Background(), &net.UDPAddr{IP: net.ParseIP("239.1.2.3"), Port: 9}); err == nil {
+		t.Fatalf("sent packets smaller than the header")
+	}
+}
@@ -0,0 +1,227 @@
+package neighbor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// Defaults used by a Prober whose fields are not set.
+const (
+	DefaultTimeout  = time.Second
+	DefaultRetries  = 2
+	DefaultInterval = time.Millisecond
+)
+
+// MaxSweep is the largest number of addresses Sweep will probe, which rules out sweeping an IPv6 /64.
+const MaxSweep = 1 << 16
+
+// ARP operations.
+const (
+	arpRequest = 1
+	arpReply   = 2
+)
+
+// arpLen is the length of an ARP packet for IPv4 over Ethernet.
+const arpLen = 28
+
+var (
+	// ErrNoReply is returned by Probe when the address did not respond.
+	ErrNoReply = errors.New("no reply")
+
+	// ErrUnsupportedPlatform is returned on platforms where link-layer sockets are not implemented.
+	ErrUnsupportedPlatform = errors.New("unsupported platform")
+)
+
+// Reply is an answer from a neighbor, giving its link-layer address.
+type Reply struct {
+	IP  net.IP
+	MAC net.HardwareAddr
+	RTT time.Duration // From the most recent probe of the address to the reply.
+}
+
+// arpPacket is an ARP packet for IPv4 over Ethernet, the only combination in use.
+type arpPacket struct {
+	Op        uint16
+	SenderMAC net.HardwareAddr
+	SenderIP  net.IP
+	TargetMAC net.HardwareAddr
+	TargetIP  net.IP
+}
+
+// marshal encodes the packet.
+func (p *arpPacket) marshal() ([]byte, error) {
+	senderIP, targetIP := p.SenderIP.To4(), p.TargetIP.To4()
+	if len(p.SenderMAC) != 6 || len(p.TargetMAC) != 6 || senderIP == nil || targetIP == nil {
+		return nil, errors.New("arp needs ethernet and ipv4 addresses")
+	}
+	b := make([]byte, 8, arpLen)
+	binary.BigEndian.PutUint16(b, 1)          // Ethernet.
+	binary.BigEndian.PutUint16(b[2:], 0x0800) // IPv4.
+	b[4], b[5] = 6, 4
+	binary.BigEndian.PutUint16(b[6:], p.Op)
+	b = append(b, p.SenderMAC...)
+	b = append(b, senderIP...)
+	b = append(b, p.TargetMAC...)
+	return append(b, targetIP...), nil
+}
+
+// parseARP decodes an ARP packet, failing unless it is for IPv4 over Ethernet.
+func parseARP(b []byte) (*arpPacket, error) {
+	if len(b) < arpLen {
+		return nil, fmt.Errorf("arp packet too short: %d bytes", len(b))
+	}
+	if binary.BigEndian.Uint16(b) != 1 || binary.BigEndian.Uint16(b[2:]) != 0x0800 || b[4] != 6 || b[5] != 4 {
+		return nil, errors.New("not an ipv4 over ethernet arp packet")
+	}
+	return &arpPacket{
+		Op:        binary.BigEndian.Uint16(b[6:]),
+		SenderMAC: append(net.HardwareAddr(nil), b[8:14]...),
+		SenderIP:  append(net.IP(nil), b[14:18]...),
+		TargetMAC: append(net.HardwareAddr(nil), b[18:24]...),
+		TargetIP:  append(net.IP(nil), b[24:28]...),
+	}, nil
+}
+
+// SolicitedNodeMulticast returns the solicited-node multicast address of an IPv6 address, to which neighbor
+// solicitations for it are sent.
+func SolicitedNodeMulticast(ip net.IP) net.IP {
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return nil
+	}
+	return net.IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0xff, ip16[13], ip16[14], ip16[15]}
+}
+
+// multicastMAC returns the Ethernet address an IPv6 multicast address maps to.
+func multicastMAC(ip net.IP) net.HardwareAddr {
+	ip16 := ip.To16()
+	return net.HardwareAddr{0x33, 0x33, ip16[12], ip16[13], ip16[14], ip16[15]}
+}
+
+// Prober sends ARP requests and IPv6 neighbor solicitations on a single interface, which requires CAP_NET_RAW.
+type Prober struct {
+	Timeout  time.Duration // How long to wait for replies after the last probe, or DefaultTimeout if zero.
+	Retries  int           // How many more times to probe addresses that have not replied.
+	Interval time.Duration // The time between probes, or DefaultInterval if zero.
+
+	iface *net.Interface
+}
+
+// NewProber returns a Prober for the named interface, with the default timeout and retries.
+func NewProber(name string) (*Prober, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("%s: not an ethernet interface", name)
+	}
+	return &Prober{Timeout: DefaultTimeout, Retries: DefaultRetries, iface: iface}, nil
+}
+
+// Probe asks for the link-layer address of ip, returning ErrNoReply if it does not answer.
+func (p *Prober) Probe(ctx context.Context, ip net.IP) (*Reply, error) {
+	replies, err := p.resolve(ctx, []net.IP{ip}, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(replies) == 0 {
+		return nil, ErrNoReply
+	}
+	return &replies[0], nil
+}
+
+// Sweep probes every address in a prefix, except the network and broadcast addresses of IPv4 prefixes that have them,
+// and returns the replies in address order.
+func (p *Prober) Sweep(ctx context.Context, pfx *net.IPNet) ([]Reply, error) {
+	ones, bits := pfx.Mask.Size()
+	if bits == 0 {
+		return nil, fmt.Errorf("invalid prefix %v", pfx)
+	}
+	if bits-ones > 16 {
+		return nil, fmt.Errorf("prefix %v has more than %d addresses", pfx, MaxSweep)
+	}
+
+	var ips []net.IP
+	ip := pfx.IP.Mask(pfx.Mask)
+	for i := 0; i < 1<<uint(bits-ones); i++ {
+		ips = append(ips, ip)
+		next := append(net.IP(nil), ip...)
+		for j := len(next) - 1; j >= 0; j-- {
+			next[j]++
+			if next[j] != 0 {
+				break
+			}
+		}
+		ip = next
+	}
+	if bits == 8*net.IPv4len && bits-ones >= 2 {
+		ips = ips[1 : len(ips)-1]
+	}
+
+	replies, err := p.resolve(ctx, ips, false)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(replies, func(i, j int) bool { return bytes.Compare(replies[i].IP.To16(), replies[j].IP.To16()) < 0 })
+	return replies, nil
+}
+
+// Duplicate performs duplicate address detection for ip, as described by RFC 5227 for IPv4 and RFC 4862 for IPv6,
+// returning the reply of the neighbor already using it, or nil if nobody is. The probes do not reveal an address of
+// this host, so it is safe to check an address before configuring it.
+func (p *Prober) Duplicate(ctx context.Context, ip net.IP) (*Reply, error) {
+	replies, err := p.resolve(ctx, []net.IP{ip}, true)
+	if err != nil || len(replies) == 0 {
+		return nil, err
+	}
+	return &replies[0], nil
+}
+
+// settings returns the timeout, retries and interval with defaults applied.
+func (p *Prober) settings() (time.Duration, int, time.Duration) {
+	timeout, retries, interval := p.Timeout, p.Retries, p.Interval
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return timeout, retries, interval
+}
+
+// sourceAddr returns an address of the interface to send probes from: for IPv4, one on the same subnet as target if
+// possible, and for IPv6, the link-local address.
+func (p *Prober) sourceAddr(target net.IP) (net.IP, error) {
+	addrs, err := p.iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	v4 := target.To4() != nil
+	var fallback net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() != nil) != v4 {
+			continue
+		}
+		switch {
+		case v4 && ipNet.Contains(target), !v4 && ipNet.IP.IsLinkLocalUnicast():
+			return ipNet.IP, nil
+		case fallback == nil:
+			fallback = ipNet.IP
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("%s has no suitable source address for %v", p.iface.Name, target)
+	}
+	return fallback, nil
+}
@@ -0,0 +1,308 @@
+// +build linux
+
+package neighbor
+
+import (
+	"bytes"
+	"context"
+	"github.com/dotwaffle/inettools/icmp"
+	"github.com/dotwaffle/inettools/packet"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Ethertypes of the frames sent and received.
+const (
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+)
+
+// packetOutgoing is the packet type of frames sent by this host, which packet sockets also receive.
+const packetOutgoing = 4
+
+// htons converts a 16-bit value to network byte order, as packet sockets require of the protocol.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// linkConn is a packet socket bound to an interface, receiving and sending frames of a single ethertype without their
+// Ethernet headers, which the kernel handles.
+type linkConn struct {
+	f       *os.File
+	rc      syscall.RawConn
+	ifindex int
+	proto   uint16
+}
+
+// openLink opens a packet socket on iface for the given ethertype.
+func openLink(iface *net.Interface, proto uint16) (*linkConn, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK,
+		int(htons(proto)))
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(proto), Ifindex: iface.Index}); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	// A non-blocking descriptor is registered with the runtime poller, so reads block only the calling goroutine and
+	// are interrupted by Close.
+	f := os.NewFile(uintptr(fd), "packet")
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &linkConn{f: f, rc: rc, ifindex: iface.Index, proto: proto}, nil
+}
+
+// send transmits b in a frame to the given link-layer address.
+func (c *linkConn) send(b []byte, dst net.HardwareAddr) error {
+	sa := &syscall.SockaddrLinklayer{Protocol: htons(c.proto), Ifindex: c.ifindex, Halen: uint8(len(dst))}
+	copy(sa.Addr[:], dst)
+	var sendErr error
+	if err := c.rc.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendto(int(fd), b, 0, sa)
+		return sendErr != syscall.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return os.NewSyscallError("sendto", sendErr)
+}
+
+// recv receives the next frame sent by another host, returning its length and source link-layer address.
+func (c *linkConn) recv(b []byte) (int, net.HardwareAddr, error) {
+	for {
+		var n int
+		var from syscall.Sockaddr
+		var recvErr error
+		if err := c.rc.Read(func(fd uintptr) bool {
+			n, from, recvErr = syscall.Recvfrom(int(fd), b, 0)
+			return recvErr != syscall.EAGAIN
+		}); err != nil {
+			return 0, nil, err
+		}
+		if recvErr != nil {
+			return 0, nil, os.NewSyscallError("recvfrom", recvErr)
+		}
+		sa, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok || sa.Pkttype == packetOutgoing {
+			continue
+		}
+		return n, append(net.HardwareAddr(nil), sa.Addr[:sa.Halen]...), nil
+	}
+}
+
+// close closes the socket, interrupting any recv in progress.
+func (c *linkConn) close() error {
+	return c.f.Close()
+}
+
+// resolve probes each of ips, which must all be of the same family, and collects the replies. In duplicate address
+// detection mode, the probes use the unspecified address as their source, as the address being checked cannot yet be
+// used.
+func (p *Prober) resolve(ctx context.Context, ips []net.IP, dad bool) ([]Reply, error) {
+	if len(ips) == 0 {
+		return nil, nil
+	}
+	timeout, retries, interval := p.settings()
+	v4 := ips[0].To4() != nil
+
+	src := net.IPv4zero.To4()
+	proto := uint16(etherTypeARP)
+	if !v4 {
+		src, proto = net.IPv6unspecified, etherTypeIPv6
+	}
+	if !dad {
+		var err error
+		if src, err = p.sourceAddr(ips[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := openLink(p.iface, proto)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	var (
+		mu       sync.Mutex
+		sent     = make(map[string]time.Time, len(ips))
+		replies  = make(map[string]*Reply, len(ips))
+		complete = make(chan struct{})
+		finished = make(chan struct{})
+	)
+	for _, ip := range ips {
+		sent[string(ip.To16())] = time.Time{}
+	}
+
+	go func() {
+		defer close(finished)
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := conn.recv(buf)
+			now := time.Now()
+			if err != nil {
+				return
+			}
+			var ip net.IP
+			var mac net.HardwareAddr
+			if v4 {
+				ip, mac = p.parseARPReply(buf[:n], dad)
+			} else {
+				ip, mac = p.parseNDPReply(buf[:n], from, dad)
+			}
+			if ip == nil {
+				continue
+			}
+
+			mu.Lock()
+			key := string(ip.To16())
+			if at, ok := sent[key]; ok && replies[key] == nil {
+				replies[key] = &Reply{IP: ip, MAC: mac, RTT: now.Sub(at)}
+				if len(replies) == len(sent) {
+					close(complete)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+rounds:
+	for round := 0; round <= retries; round++ {
+		for _, ip := range ips {
+			key := string(ip.To16())
+			mu.Lock()
+			answered := replies[key] != nil
+			if !answered {
+				sent[key] = time.Now()
+			}
+			mu.Unlock()
+			if answered {
+				continue
+			}
+
+			if err := p.sendProbe(conn, src, ip, dad); err != nil {
+				return nil, err
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-timer.C:
+		case <-complete:
+			timer.Stop()
+			break rounds
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	conn.close()
+	<-finished
+	var result []Reply
+	for _, ip := range ips {
+		if r := replies[string(ip.To16())]; r != nil {
+			result = append(result, *r)
+		}
+	}
+	return result, nil
+}
+
+// sendProbe sends an ARP request or neighbor solicitation for target.
+func (p *Prober) sendProbe(conn *linkConn, src, target net.IP, dad bool) error {
+	if target.To4() != nil {
+		b, err := (&arpPacket{
+			Op:        arpRequest,
+			SenderMAC: p.iface.HardwareAddr,
+			SenderIP:  src,
+			TargetMAC: make(net.HardwareAddr, 6),
+			TargetIP:  target,
+		}).marshal()
+		if err != nil {
+			return err
+		}
+		return conn.send(b, net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	}
+
+	ns := &icmp.NeighborSolicitation{Target: target}
+	if !dad {
+		// A solicitation from the unspecified address must not carry a link-layer address, as nobody may cache it.
+		ns.Options = []icmp.NDPOption{icmp.LinkLayerOption(icmp.NDPOptionSourceLinkLayer, p.iface.HardwareAddr)}
+	}
+	dst := SolicitedNodeMulticast(target)
+	body, err := (&icmp.Message{V6: true, Type: icmp.TypeV6NeighborSolicitation, Body: ns}).Marshal(src, dst)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, packet.IPv6HeaderLen+len(body))
+	if err := packet.IPv6(b).Encode(&packet.IPv6Fields{
+		NextHeader: packet.ProtocolICMPv6,
+		HopLimit:   255,
+		Src:        src,
+		Dst:        dst,
+	}); err != nil {
+		return err
+	}
+	copy(b[packet.IPv6HeaderLen:], body)
+	return conn.send(b, multicastMAC(dst))
+}
+
+// parseARPReply returns the address and link-layer address of the neighbor that sent an ARP packet, if the packet
+// answers a probe. During duplicate address detection any packet claiming an address counts, including the probes of
+// another host checking the same address, as RFC 5227 requires.
+func (p *Prober) parseARPReply(b []byte, dad bool) (net.IP, net.HardwareAddr) {
+	arp, err := parseARP(b)
+	if err != nil || bytes.Equal(arp.SenderMAC, p.iface.HardwareAddr) {
+		return nil, nil
+	}
+	switch {
+	case arp.Op == arpReply:
+		return arp.SenderIP, arp.SenderMAC
+	case dad && arp.Op == arpRequest && !arp.SenderIP.IsUnspecified():
+		return arp.SenderIP, arp.SenderMAC
+	case dad && arp.Op == arpRequest:
+		return arp.TargetIP, arp.SenderMAC
+	}
+	return nil, nil
+}
+
+// parseNDPReply returns the target and link-layer address of a neighbor advertisement, falling back to the source of
+// the frame if the advertisement does not say. During duplicate address detection, a solicitation for the same address
+// from another host performing detection also counts, as RFC 4862 requires.
+func (p *Prober) parseNDPReply(b []byte, from net.HardwareAddr, dad bool) (net.IP, net.HardwareAddr) {
+	ip6 := packet.IPv6(b)
+	// Neighbor discovery messages are only valid if they cannot have been forwarded by a router.
+	if ip6.Valid() != nil || ip6.NextHeader() != packet.ProtocolICMPv6 || ip6.HopLimit() != 255 {
+		return nil, nil
+	}
+	m, err := icmp.Parse(ip6.Payload(), true)
+	if err != nil {
+		return nil, nil
+	}
+	switch body := m.Body.(type) {
+	case *icmp.NeighborAdvertisement:
+		mac := body.TargetLinkLayerAddr()
+		if mac == nil {
+			mac = from
+		}
+		return append(net.IP(nil), body.Target...), append(net.HardwareAddr(nil), mac...)
+	case *icmp.NeighborSolicitation:
+		if dad && ip6.Src().IsUnspecified() && !bytes.Equal(from, p.iface.HardwareAddr) {
+			return append(net.IP(nil), body.Target...), append(net.HardwareAddr(nil), from...)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,141 @@
+// +build linux
+
+package neighbor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// veth creates a pair of connected virtual interfaces, moving the peer into a network namespace of its own so that the
+// kernel treats it as another host, and runs the given ip commands to configure them. The test is skipped if that is
+// not permitted.
+func veth(t *testing.T, cmds ...string) (*net.Interface, net.HardwareAddr) {
+	t.Helper()
+	const local, peer, ns = "nbtest0", "nbtest1", "nbtest"
+	exec.Command("ip", "link", "del", local).Run()
+	exec.Command("ip", "netns", "del", ns).Run()
+	if out, err := exec.Command("ip", "netns", "add", ns).CombinedOutput(); err != nil {
+		t.Skipf("cannot create network namespace: %v: %s", err, out)
+	}
+	t.Cleanup(func() { exec.Command("ip", "netns", "del", ns).Run() })
+	out, err := exec.Command("ip", "link", "add", local, "type", "veth", "peer", "name", peer).CombinedOutput()
+	if err != nil {
+		t.Skipf("cannot create veth pair: %v: %s", err, out)
+	}
+	t.Cleanup(func() { exec.Command("ip", "link", "del", local).Run() })
+	peerIface, err := net.InterfaceByName(peer)
+	if err != nil {
+		t.Fatalf("interface err: %v", err)
+	}
+
+	cmds = append([]string{"link set " + peer + " netns " + ns}, cmds...)
+	cmds = append(cmds, "link set "+local+" up", "-n "+ns+" link set "+peer+" up")
+	for _, cmd := range cmds {
+		if out, err := exec.Command("ip", strings.Fields(cmd)...).CombinedOutput(); err != nil {
+			t.Fatalf("ip %s: %v: %s", cmd, err, out)
+		}
+	}
+	iface, err := net.InterfaceByName(local)
+	if err != nil {
+		t.Fatalf("interface err: %v", err)
+	}
+	return iface, peerIface.HardwareAddr
+}
+
+func TestProbe(t *testing.T) {
+	local, peerMAC := veth(t,
+		"addr add 198.51.100.1/29 dev nbtest0",
+		"-n nbtest addr add 198.51.100.2/29 dev nbtest1",
+		"addr add fe80::1/64 dev nbtest0 nodad",
+		"-n nbtest addr add 2001:db8::2/64 dev nbtest1 nodad",
+	)
+	p, err := NewProber(local.Name)
+	if err != nil {
+		t.Fatalf("prober err: %v", err)
+	}
+	p.Timeout = 200 * time.Millisecond
+	// Give the interfaces a moment to finish coming up.
+	time.Sleep(100 * time.Millisecond)
+
+	tests := map[string]struct {
+		ip      string
+		wantErr error
+	}{
+		"ARP": {
+			ip: "198.51.100.2",
+		},
+		"NDP": {
+			ip: "2001:db8::2",
+		},
+		"ARPNoReply": {
+			ip:      "198.51.100.3",
+			wantErr: ErrNoReply,
+		},
+		"NDPNoReply": {
+			ip:      "2001:db8::3",
+			wantErr: ErrNoReply,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reply, err := p.Probe(context.Background(), net.ParseIP(test.ip))
+			if errors.Is(err, syscall.EPERM) {
+				t.Skip("packet sockets require CAP_NET_RAW")
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err: got %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if reply.MAC.String() != peerMAC.String() {
+				t.Fatalf("mac: got %v, want %v", reply.MAC, peerMAC)
+			}
+			if !reply.IP.Equal(net.ParseIP(test.ip)) || reply.RTT <= 0 {
+				t.Fatalf("got %+v", reply)
+			}
+		})
+	}
+
+	t.Run("Sweep", func(t *testing.T) {
+		_, pfx, _ := net.ParseCIDR("198.51.100.0/29")
+		replies, err := p.Sweep(context.Background(), pfx)
+		if errors.Is(err, syscall.EPERM) {
+			t.Skip("packet sockets require CAP_NET_RAW")
+		}
+		if err != nil {
+			t.Fatalf("sweep err: %v", err)
+		}
+		if len(replies) != 1 || !replies[0].IP.Equal(net.IP{198, 51, 100, 2}) {
+			t.Fatalf("got %+v", replies)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		for ip, want := range map[string]bool{
+			"198.51.100.2": true,
+			"198.51.100.4": false,
+			"2001:db8::2":  true,
+			"2001:db8::4":  false,
+		} {
+			reply, err := p.Duplicate(context.Background(), net.ParseIP(ip))
+			if errors.Is(err, syscall.EPERM) {
+				t.Skip("packet sockets require CAP_NET_RAW")
+			}
+			if err != nil {
+				t.Fatalf("%s: err: %v", ip, err)
+			}
+			if (reply != nil) != want {
+				t.Fatalf("%s: got %+v, want duplicate %v", ip, reply, want)
+			}
+		}
+	})
+}
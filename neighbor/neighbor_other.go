@@ -0,0 +1,13 @@
+// +build !linux
+
+package neighbor
+
+import (
+	"context"
+	"net"
+)
+
+// resolve is only implemented on Linux, where packet sockets are available.
+func (p *Prober) resolve(context.Context, []net.IP, bool) ([]Reply, error) {
+	return nil, ErrUnsupportedPlatform
+}
@@ -0,0 +1,90 @@
+package neighbor
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestARP(t *testing.T) {
+	want := &arpPacket{
+		Op:        arpReply,
+		SenderMAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		SenderIP:  net.IP{192, 0, 2, 1},
+		TargetMAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		TargetIP:  net.IP{192, 0, 2, 2},
+	}
+	b, err := want.marshal()
+	if err != nil {
+		t.Fatalf("marshal err: %v", err)
+	}
+	if len(b) != arpLen {
+		t.Fatalf("len: got %d, want %d", len(b), arpLen)
+	}
+	got, err := parseARP(b)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	if _, err := parseARP(b[:arpLen-1]); err == nil {
+		t.Fatalf("short packet parsed")
+	}
+	b[3] = 0xdd
+	if _, err := parseARP(b); err == nil {
+		t.Fatalf("ipv6 arp packet parsed")
+	}
+	if _, err := (&arpPacket{SenderMAC: want.SenderMAC, TargetMAC: want.TargetMAC}).marshal(); err == nil {
+		t.Fatalf("packet without addresses marshalled")
+	}
+}
+
+func TestSolicitedNodeMulticast(t *testing.T) {
+	tests := map[string]struct {
+		ip      string
+		want    string
+		wantMAC string
+	}{
+		"Global": {
+			ip:      "2001:db8::12:3456:789a",
+			want:    "ff02::1:ff56:789a",
+			wantMAC: "33:33:ff:56:78:9a",
+		},
+		"LinkLocal": {
+			ip:      "fe80::fc:ff:fe00:1",
+			want:    "ff02::1:ff00:1",
+			wantMAC: "33:33:ff:00:00:01",
+		},
+		"IPv4": {
+			ip: "192.0.2.1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := SolicitedNodeMulticast(net.ParseIP(test.ip))
+			if test.want == "" {
+				if got != nil {
+					t.Fatalf("got %v, want nil", got)
+				}
+				return
+			}
+			if got.String() != test.want {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			if mac := multicastMAC(got).String(); mac != test.wantMAC {
+				t.Fatalf("mac: got %v, want %v", mac, test.wantMAC)
+			}
+		})
+	}
+}
+
+func TestSettings(t *testing.T) {
+	var p Prober
+	timeout, retries, interval := p.settings()
+	if timeout != DefaultTimeout || retries != 0 || interval != DefaultInterval {
+		t.Fatalf("got %v, %v, %v", timeout, retries, interval)
+	}
+}
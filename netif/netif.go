@@ -0,0 +1,181 @@
+package netif
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sort"
+	"time"
+)
+
+// ErrNoRoute is returned by RouteTo when there is no route to the destination.
+var ErrNoRoute = errors.New("no route")
+
+// Address is an address assigned to a local interface.
+type Address struct {
+	Interface string
+	Index     int        // The index of the interface.
+	IPNet     *net.IPNet // The address, with the mask of its subnet.
+	Peer      net.IP     // The remote address of a point-to-point link, if configured.
+
+	// The following are only reported on Linux.
+	Temporary         bool          // A privacy address, as described by RFC 8981.
+	Deprecated        bool          // Its preferred lifetime has expired, so it is not used for new connections.
+	Tentative         bool          // Duplicate address detection has not yet completed, so it is not usable.
+	DADFailed         bool          // Duplicate address detection found another host using it.
+	PreferredLifetime time.Duration // The remaining preferred lifetime, or zero if unlimited.
+	ValidLifetime     time.Duration // The remaining valid lifetime, or zero if unlimited.
+}
+
+// Usable reports whether the address can be used as the source of new connections.
+func (a *Address) Usable() bool {
+	return !a.Deprecated && !a.Tentative && !a.DADFailed
+}
+
+// Interface is a local network interface and its addresses.
+type Interface struct {
+	Index        int
+	Name         string
+	MTU          int
+	HardwareAddr net.HardwareAddr
+	Flags        net.Flags
+	Running      bool // The link is operationally up; on platforms other than Linux, this mirrors net.FlagUp.
+	Master       int  // The index of the bridge, bond or VRF the interface belongs to, or zero; only reported on Linux.
+	// The kind of virtual interface, such as "vrf", "bridge", "bond" or "vlan", or empty for physical interfaces;
+	// only reported on Linux.
+	Kind  string
+	Addrs []Address
+}
+
+// Inventory is a snapshot of the interfaces of the host and their addresses.
+type Inventory struct {
+	Interfaces []Interface
+}
+
+// Load takes a snapshot of the interfaces of the host, using netlink on Linux, which reports more detail, and the net
+// package elsewhere.
+func Load() (*Inventory, error) {
+	ifaces, err := load()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Index < ifaces[j].Index })
+	return &Inventory{Interfaces: ifaces}, nil
+}
+
+// ByName returns the named interface, or nil if there is none.
+func (inv *Inventory) ByName(name string) *Interface {
+	for i := range inv.Interfaces {
+		if inv.Interfaces[i].Name == name {
+			return &inv.Interfaces[i]
+		}
+	}
+	return nil
+}
+
+// ByIndex returns the interface with the given index, or nil if there is none.
+func (inv *Inventory) ByIndex(index int) *Interface {
+	for i := range inv.Interfaces {
+		if inv.Interfaces[i].Index == index {
+			return &inv.Interfaces[i]
+		}
+	}
+	return nil
+}
+
+// VRF returns the VRF device the named interface belongs to, which is itself if it is one, or nil if it is in the
+// default VRF or does not exist. Sockets bound to the VRF device use its routing table.
+func (inv *Inventory) VRF(name string) *Interface {
+	iface := inv.ByName(name)
+	for seen := 0; iface != nil && seen < len(inv.Interfaces); seen++ {
+		if iface.Kind == "vrf" {
+			return iface
+		}
+		// A VRF may be the master of a bridge or bond whose ports have it as their master in turn.
+		if iface.Master == 0 {
+			return nil
+		}
+		iface = inv.ByIndex(iface.Master)
+	}
+	return nil
+}
+
+// Addrs returns the addresses of every interface.
+func (inv *Inventory) Addrs() []Address {
+	var addrs []Address
+	for _, iface := range inv.Interfaces {
+		addrs = append(addrs, iface.Addrs...)
+	}
+	return addrs
+}
+
+// Local returns the local address equal to ip, or nil if ip is not assigned to this host.
+func (inv *Inventory) Local(ip net.IP) *Address {
+	for i := range inv.Interfaces {
+		for j, a := range inv.Interfaces[i].Addrs {
+			if a.IPNet.IP.Equal(ip) {
+				return &inv.Interfaces[i].Addrs[j]
+			}
+		}
+	}
+	return nil
+}
+
+// OnLink returns the local address whose subnet most specifically contains ip, which is how the host would reach ip
+// without a router, or nil if ip is not on any attached subnet. Among addresses on the same subnet, a usable one is
+// preferred.
+func (inv *Inventory) OnLink(ip net.IP) *Address {
+	var best *Address
+	bestOnes := -1
+	for i := range inv.Interfaces {
+		for j, a := range inv.Interfaces[i].Addrs {
+			contains := a.IPNet.Contains(ip) || (a.Peer != nil && a.Peer.Equal(ip))
+			if !contains {
+				continue
+			}
+			ones, _ := a.IPNet.Mask.Size()
+			if a.Peer != nil && a.Peer.Equal(ip) {
+				ones = 8 * len(a.IPNet.Mask)
+			}
+			if ones > bestOnes || (ones == bestOnes && !best.Usable() && a.Usable()) {
+				best, bestOnes = &inv.Interfaces[i].Addrs[j], ones
+			}
+		}
+	}
+	return best
+}
+
+// Within returns the local addresses that fall inside any of the prefixes, sorted by address.
+func (inv *Inventory) Within(pfxs []*net.IPNet) []Address {
+	var addrs []Address
+	for _, a := range inv.Addrs() {
+		for _, pfx := range pfxs {
+			if pfx.Contains(a.IPNet.IP) {
+				addrs = append(addrs, a)
+				break
+			}
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i].IPNet.IP.To16(), addrs[j].IPNet.IP.To16()) < 0
+	})
+	return addrs
+}
+
+// Route describes how the host would send traffic to a destination.
+type Route struct {
+	Interface string
+	Index     int    // The index of the outgoing interface.
+	Source    net.IP // The source address the host would choose.
+	Gateway   net.IP // The next hop, or nil if the destination is on-link; only reported on Linux.
+}
+
+// RouteTo asks the host which interface and source address it would use to send traffic to dst, consulting the routing
+// table with netlink on Linux. Elsewhere, the source address is found by connecting a UDP socket, which sends nothing,
+// and the interface by finding which one has that address.
+func RouteTo(dst net.IP) (*Route, error) {
+	if dst.To16() == nil {
+		return nil, errors.New("invalid destination")
+	}
+	return routeTo(dst)
+}
@@ -0,0 +1,320 @@
+// +build linux
+
+package netif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Address flags not defined by the syscall package.
+const (
+	ifaFTemporary  = 0x01
+	ifaFDADFailed  = 0x08
+	ifaFDeprecated = 0x20
+	ifaFTentative  = 0x40
+)
+
+// iflaInfoKind is IFLA_INFO_KIND, the attribute nested in IFLA_LINKINFO naming the kind of interface.
+const iflaInfoKind = 1
+
+// infiniteLifetime is the lifetime reported for addresses that do not expire.
+const infiniteLifetime = 0xffffffff
+
+// load builds the interface list from netlink dumps of the links and addresses of the host.
+func load() ([]Interface, error) {
+	msgs, err := dump(syscall.RTM_GETLINK)
+	if err != nil {
+		return nil, err
+	}
+	var ifaces []Interface
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWLINK || len(m.Data) < syscall.SizeofIfInfomsg {
+			continue
+		}
+		ifaces = append(ifaces, parseLink(&m))
+	}
+
+	if msgs, err = dump(syscall.RTM_GETADDR); err != nil {
+		return nil, err
+	}
+	byIndex := make(map[int]*Interface, len(ifaces))
+	for i := range ifaces {
+		byIndex[ifaces[i].Index] = &ifaces[i]
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		iface := byIndex[int(ifam.Index)]
+		if iface == nil {
+			continue
+		}
+		if a := parseAddr(&m, iface); a != nil {
+			iface.Addrs = append(iface.Addrs, *a)
+		}
+	}
+	return ifaces, nil
+}
+
+// dump requests a netlink dump of the given type for all address families.
+func dump(typ int) ([]syscall.NetlinkMessage, error) {
+	b, err := syscall.NetlinkRIB(typ, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	return msgs, nil
+}
+
+// parseLink decodes an RTM_NEWLINK message.
+func parseLink(m *syscall.NetlinkMessage) Interface {
+	ifim := (*syscall.IfInfomsg)(unsafe.Pointer(&m.Data[0]))
+	iface := Interface{
+		Index:   int(ifim.Index),
+		Flags:   linkFlags(ifim.Flags),
+		Running: ifim.Flags&syscall.IFF_RUNNING != 0,
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return iface
+	}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.IFLA_IFNAME:
+			if len(a.Value) > 0 {
+				iface.Name = string(a.Value[:len(a.Value)-1])
+			}
+		case syscall.IFLA_MTU:
+			iface.MTU = int(nativeUint32(a.Value))
+		case syscall.IFLA_MASTER:
+			iface.Master = int(nativeUint32(a.Value))
+		case syscall.IFLA_LINKINFO:
+			iface.Kind = linkKind(a.Value)
+		case syscall.IFLA_ADDRESS:
+			// Interfaces without a link-layer address, such as tunnels, report one of all zeroes.
+			for _, b := range a.Value {
+				if b != 0 {
+					iface.HardwareAddr = append(net.HardwareAddr(nil), a.Value...)
+					break
+				}
+			}
+		}
+	}
+	return iface
+}
+
+// linkKind extracts the kind of interface from the nested attributes of IFLA_LINKINFO.
+func linkKind(b []byte) string {
+	for len(b) >= syscall.SizeofRtAttr {
+		attr := (*syscall.RtAttr)(unsafe.Pointer(&b[0]))
+		if int(attr.Len) < syscall.SizeofRtAttr || int(attr.Len) > len(b) {
+			break
+		}
+		if attr.Type == iflaInfoKind {
+			value := b[syscall.SizeofRtAttr:attr.Len]
+			if i := bytes.IndexByte(value, 0); i >= 0 {
+				value = value[:i]
+			}
+			return string(value)
+		}
+		b = b[rtaAlign(int(attr.Len)):]
+	}
+	return ""
+}
+
+// rtaAlign rounds the length of an attribute up to the four octet alignment of the next.
+func rtaAlign(n int) int {
+	return (n + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+}
+
+// linkFlags converts the flags of a link to those used by the net package.
+func linkFlags(flags uint32) net.Flags {
+	var f net.Flags
+	if flags&syscall.IFF_UP != 0 {
+		f |= net.FlagUp
+	}
+	if flags&syscall.IFF_BROADCAST != 0 {
+		f |= net.FlagBroadcast
+	}
+	if flags&syscall.IFF_LOOPBACK != 0 {
+		f |= net.FlagLoopback
+	}
+	if flags&syscall.IFF_POINTOPOINT != 0 {
+		f |= net.FlagPointToPoint
+	}
+	if flags&syscall.IFF_MULTICAST != 0 {
+		f |= net.FlagMulticast
+	}
+	return f
+}
+
+// parseAddr decodes an RTM_NEWADDR message for an address of iface.
+func parseAddr(m *syscall.NetlinkMessage, iface *Interface) *Address {
+	ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return nil
+	}
+	var local, address net.IP
+	a := &Address{
+		Interface:  iface.Name,
+		Index:      iface.Index,
+		Temporary:  ifam.Flags&ifaFTemporary != 0,
+		Deprecated: ifam.Flags&ifaFDeprecated != 0,
+		Tentative:  ifam.Flags&ifaFTentative != 0,
+		DADFailed:  ifam.Flags&ifaFDADFailed != 0,
+	}
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case syscall.IFA_LOCAL:
+			local = append(net.IP(nil), attr.Value...)
+		case syscall.IFA_ADDRESS:
+			address = append(net.IP(nil), attr.Value...)
+		case syscall.IFA_CACHEINFO:
+			if len(attr.Value) >= 8 {
+				a.PreferredLifetime = lifetime(nativeUint32(attr.Value))
+				a.ValidLifetime = lifetime(nativeUint32(attr.Value[4:]))
+			}
+		}
+	}
+
+	// The local address is the one assigned to the interface; the address attribute is the same, except on
+	// point-to-point links where it is the remote end. IPv6 addresses usually only have the address attribute.
+	ip := local
+	if ip == nil {
+		ip = address
+	} else if address != nil && !address.Equal(local) {
+		a.Peer = address
+	}
+	if ip == nil {
+		return nil
+	}
+	a.IPNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(int(ifam.Prefixlen), 8*len(ip))}
+	return a
+}
+
+// lifetime converts an address lifetime in seconds to a duration, where zero means the address does not expire.
+func lifetime(secs uint32) time.Duration {
+	if secs == infiniteLifetime {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// nativeUint32 decodes a 32-bit attribute, which netlink sends in host byte order.
+func nativeUint32(b []byte) uint32 {
+	if len(b) < 4 {
+		return 0
+	}
+	return *(*uint32)(unsafe.Pointer(&b[0]))
+}
+
+// routeTo asks the kernel for the route it would use to reach dst, as `ip route get` does.
+func routeTo(dst net.IP) (*Route, error) {
+	family, addr := syscall.AF_INET6, dst.To16()
+	if ip4 := dst.To4(); ip4 != nil {
+		family, addr = syscall.AF_INET, ip4
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	attrLen := syscall.SizeofRtAttr + len(addr)
+	req := make([]byte, syscall.NLMSG_HDRLEN+syscall.SizeofRtMsg+(attrLen+syscall.RTA_ALIGNTO-1)&^(syscall.RTA_ALIGNTO-1))
+	*(*syscall.NlMsghdr)(unsafe.Pointer(&req[0])) = syscall.NlMsghdr{
+		Len:   uint32(len(req)),
+		Type:  syscall.RTM_GETROUTE,
+		Flags: syscall.NLM_F_REQUEST,
+		Seq:   1,
+	}
+	*(*syscall.RtMsg)(unsafe.Pointer(&req[syscall.NLMSG_HDRLEN])) = syscall.RtMsg{
+		Family:  uint8(family),
+		Dst_len: uint8(8 * len(addr)),
+	}
+	attr := req[syscall.NLMSG_HDRLEN+syscall.SizeofRtMsg:]
+	*(*syscall.RtAttr)(unsafe.Pointer(&attr[0])) = syscall.RtAttr{Len: uint16(attrLen), Type: syscall.RTA_DST}
+	copy(attr[syscall.SizeofRtAttr:], addr)
+
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError("sendto", err)
+	}
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, os.NewSyscallError("recvfrom", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, os.NewSyscallError("parsenetlinkmessage", err)
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != 1 {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, errors.New("short netlink error")
+				}
+				errno := syscall.Errno(-int32(nativeUint32(m.Data)))
+				if errno == syscall.ENETUNREACH || errno == syscall.EHOSTUNREACH {
+					return nil, fmt.Errorf("%w to %v: %v", ErrNoRoute, dst, errno)
+				}
+				return nil, os.NewSyscallError("rtm_getroute", errno)
+			case syscall.RTM_NEWROUTE:
+				return parseRoute(&m)
+			}
+		}
+	}
+}
+
+// parseRoute decodes the RTM_NEWROUTE message answering a route request.
+func parseRoute(m *syscall.NetlinkMessage) (*Route, error) {
+	if len(m.Data) < syscall.SizeofRtMsg {
+		return nil, errors.New("short route message")
+	}
+	rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+	switch rtm.Type {
+	case syscall.RTN_UNREACHABLE, syscall.RTN_PROHIBIT, syscall.RTN_BLACKHOLE:
+		return nil, ErrNoRoute
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkrouteattr", err)
+	}
+	r := &Route{}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.RTA_OIF:
+			r.Index = int(nativeUint32(a.Value))
+		case syscall.RTA_PREFSRC:
+			r.Source = append(net.IP(nil), a.Value...)
+		case syscall.RTA_GATEWAY:
+			r.Gateway = append(net.IP(nil), a.Value...)
+		}
+	}
+	if r.Index != 0 {
+		if iface, err := net.InterfaceByIndex(r.Index); err == nil {
+			r.Interface = iface.Name
+		}
+	}
+	return r, nil
+}
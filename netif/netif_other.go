@@ -0,0 +1,59 @@
+// +build !linux
+
+package netif
+
+import (
+	"fmt"
+	"net"
+)
+
+// load builds the interface list using the net package, which is all that is available on most platforms.
+func load() ([]Interface, error) {
+	netIfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make([]Interface, 0, len(netIfaces))
+	for _, ni := range netIfaces {
+		iface := Interface{
+			Index:        ni.Index,
+			Name:         ni.Name,
+			MTU:          ni.MTU,
+			HardwareAddr: ni.HardwareAddr,
+			Flags:        ni.Flags,
+			Running:      ni.Flags&net.FlagUp != 0,
+		}
+		addrs, err := ni.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				iface.Addrs = append(iface.Addrs, Address{Interface: ni.Name, Index: ni.Index, IPNet: ipNet})
+			}
+		}
+		ifaces = append(ifaces, iface)
+	}
+	return ifaces, nil
+}
+
+// routeTo finds the source address the host would use by connecting a UDP socket.
+func routeTo(dst net.IP) (*Route, error) {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: dst, Port: 9})
+	if err != nil {
+		// Connecting a UDP socket only fails when there is no route.
+		return nil, fmt.Errorf("%w to %v: %v", ErrNoRoute, dst, err)
+	}
+	src := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	r := &Route{Source: src}
+	inv, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if a := inv.Local(src); a != nil {
+		r.Interface, r.Index = a.Interface, a.Index
+	}
+	return r, nil
+}
@@ -0,0 +1,165 @@
+package netif
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+// ipNet parses an address in CIDR notation, keeping the address rather than the prefix.
+func ipNet(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	ip, pfx, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("parse %q: %v", s, err)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.IPNet{IP: ip, Mask: pfx.Mask}
+}
+
+func testInventory(t *testing.T) *Inventory {
+	return &Inventory{Interfaces: []Interface{
+		{Index: 1, Name: "lo", Flags: net.FlagUp | net.FlagLoopback, Addrs: []Address{
+			{Interface: "lo", Index: 1, IPNet: ipNet(t, "127.0.0.1/8")},
+			{Interface: "lo", Index: 1, IPNet: ipNet(t, "::1/128")},
+		}},
+		{Index: 2, Name: "eth0", Flags: net.FlagUp, Addrs: []Address{
+			{Interface: "eth0", Index: 2, IPNet: ipNet(t, "192.0.2.10/24")},
+			{Interface: "eth0", Index: 2, IPNet: ipNet(t, "2001:db8::10/64"), Deprecated: true},
+			{Interface: "eth0", Index: 2, IPNet: ipNet(t, "2001:db8::11/64"), Temporary: true},
+			{Interface: "eth0", Index: 2, IPNet: ipNet(t, "fe80::1/64")},
+		}},
+		{Index: 3, Name: "eth1", Flags: net.FlagUp, Addrs: []Address{
+			{Interface: "eth1", Index: 3, IPNet: ipNet(t, "192.0.2.130/25")},
+		}},
+		{Index: 4, Name: "ppp0", Flags: net.FlagUp | net.FlagPointToPoint, Addrs: []Address{
+			{Interface: "ppp0", Index: 4, IPNet: ipNet(t, "198.51.100.1/32"), Peer: net.IP{203, 0, 113, 1}},
+		}},
+	}}
+}
+
+func TestLookup(t *testing.T) {
+	inv := testInventory(t)
+	if iface := inv.ByName("eth1"); iface == nil || iface.Index != 3 {
+		t.Fatalf("by name: got %+v", iface)
+	}
+	if iface := inv.ByIndex(4); iface == nil || iface.Name != "ppp0" {
+		t.Fatalf("by index: got %+v", iface)
+	}
+	if inv.ByName("eth9") != nil || inv.ByIndex(9) != nil {
+		t.Fatalf("found missing interface")
+	}
+
+	tests := map[string]struct {
+		ip         string
+		wantLocal  string
+		wantOnLink string
+	}{
+		"Local": {
+			ip:         "192.0.2.10",
+			wantLocal:  "192.0.2.10/24",
+			wantOnLink: "192.0.2.10/24",
+		},
+		"MoreSpecific": {
+			ip:         "192.0.2.200",
+			wantOnLink: "192.0.2.130/25",
+		},
+		"PreferUsable": {
+			ip:         "2001:db8::99",
+			wantOnLink: "2001:db8::11/64",
+		},
+		"Peer": {
+			ip:         "203.0.113.1",
+			wantOnLink: "198.51.100.1/32",
+		},
+		"OffLink": {
+			ip: "198.51.100.2",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ip := net.ParseIP(test.ip)
+			var local, onLink string
+			if a := inv.Local(ip); a != nil {
+				local = a.IPNet.String()
+			}
+			if a := inv.OnLink(ip); a != nil {
+				onLink = a.IPNet.String()
+			}
+			if local != test.wantLocal {
+				t.Fatalf("local: got %q, want %q", local, test.wantLocal)
+			}
+			if onLink != test.wantOnLink {
+				t.Fatalf("on link: got %q, want %q", onLink, test.wantOnLink)
+			}
+		})
+	}
+}
+
+func TestWithin(t *testing.T) {
+	inv := testInventory(t)
+	var pfxs []*net.IPNet
+	for _, s := range []string{"192.0.2.0/24", "2001:db8::/32", "10.0.0.0/8"} {
+		_, pfx, _ := net.ParseCIDR(s)
+		pfxs = append(pfxs, pfx)
+	}
+	var got []string
+	for _, a := range inv.Within(pfxs) {
+		got = append(got, a.Interface+" "+a.IPNet.String())
+	}
+	want := []string{"eth0 192.0.2.10/24", "eth1 192.0.2.130/25", "eth0 2001:db8::10/64", "eth0 2001:db8::11/64"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestVRF(t *testing.T) {
+	inv := &Inventory{Interfaces: []Interface{
+		{Index: 1, Name: "lo"},
+		{Index: 2, Name: "eth0", Master: 5},
+		{Index: 3, Name: "eth1", Master: 4},
+		{Index: 4, Name: "br0", Kind: "bridge", Master: 5},
+		{Index: 5, Name: "mgmt", Kind: "vrf"},
+		{Index: 6, Name: "eth2", Master: 7},
+		{Index: 7, Name: "bond0", Kind: "bond"},
+	}}
+	tests := map[string]string{"eth0": "mgmt", "eth1": "mgmt", "mgmt": "mgmt", "lo": "", "eth2": "", "eth9": ""}
+	for name, want := range tests {
+		var got string
+		if vrf := inv.VRF(name); vrf != nil {
+			got = vrf.Name
+		}
+		if got != want {
+			t.Errorf("%s: got VRF %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	inv, err := Load()
+	if err != nil {
+		t.Fatalf("load err: %v", err)
+	}
+	a := inv.Local(net.IPv4(127, 0, 0, 1))
+	if a == nil {
+		a = inv.Local(net.IPv6loopback)
+	}
+	if a == nil {
+		t.Fatalf("no loopback address in %+v", inv.Interfaces)
+	}
+	iface := inv.ByIndex(a.Index)
+	if iface == nil || iface.Name != a.Interface || iface.Flags&net.FlagLoopback == 0 {
+		t.Fatalf("loopback interface: got %+v", iface)
+	}
+
+	r, err := RouteTo(a.IPNet.IP)
+	if err != nil {
+		t.Fatalf("route err: %v", err)
+	}
+	if r.Index != a.Index || r.Interface != a.Interface || !r.Source.Equal(a.IPNet.IP) {
+		t.Fatalf("route: got %+v, want via %v", r, a.Interface)
+	}
+}
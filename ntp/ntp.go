@@ -0,0 +1,288 @@
+package ntp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Client whose fields are not set.
+const (
+	DefaultTimeout = 2 * time.Second
+	DefaultVersion = 4
+)
+
+// Leap indicator values, warning of a leap second at the end of the current day.
+const (
+	LeapNone           = 0
+	LeapInsertSecond   = 1
+	LeapDeleteSecond   = 2
+	LeapUnsynchronized = 3 // The clock of the server is not synchronized, and its time should not be trusted.
+)
+
+// Association modes used in the header.
+const (
+	modeClient = 3
+	modeServer = 4
+)
+
+// headerLen is the length of an NTP header without extensions or authentication.
+const headerLen = 48
+
+// epochOffset is the number of seconds between the NTP epoch of 1900 and the Unix epoch of 1970.
+const epochOffset = 2208988800
+
+// ErrUnsynchronized is returned when a server reports that its own clock is not synchronized.
+var ErrUnsynchronized = errors.New("server not synchronized")
+
+// KissError is returned when a server answers with a Kiss-o'-Death packet, asking the client to stop or slow down.
+type KissError struct {
+	Server string
+	Code   string // Such as RATE, to slow down, or DENY, to stop.
+}
+
+// Error satisfies the error interface.
+func (e *KissError) Error() string {
+	return fmt.Sprintf("ntp: %s: kiss of death %q", e.Server, e.Code)
+}
+
+// Response describes the answer of a server, and the offset of the local clock measured from it.
+type Response struct {
+	Server         string
+	Time           time.Time     // The time of the server when it sent the response.
+	Offset         time.Duration // The amount to add to the local clock to match the server.
+	Delay          time.Duration // The round-trip time, less the time the server took to respond.
+	Stratum        uint8         // The distance from a reference clock, which is at stratum 0.
+	Leap           uint8
+	Version        uint8
+	Precision      time.Duration // The resolution of the server's clock.
+	Poll           time.Duration // The poll interval the server suggests.
+	RootDelay      time.Duration // The round-trip time from the server to its reference clock.
+	RootDispersion time.Duration // The error the server has accumulated relative to its reference clock.
+	ReferenceID    uint32
+	ReferenceTime  time.Time // When the server last set its clock.
+}
+
+// Reference returns the reference identifier in readable form: the name of the reference clock of a stratum 1 server,
+// or the address of the upstream server otherwise. For IPv6 upstreams the identifier is a hash, and is shown as such.
+func (r *Response) Reference() string {
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], r.ReferenceID)
+	if r.Stratum <= 1 {
+		return strings.TrimRight(string(id[:]), "\x00")
+	}
+	return net.IP(id[:]).String()
+}
+
+// RootDistance returns the worst-case error of the server's time relative to its reference clock, as seen from here,
+// which is what RFC 5905 uses to choose between servers.
+func (r *Response) RootDistance() time.Duration {
+	return r.RootDelay/2 + r.RootDispersion + r.Delay/2
+}
+
+// Client queries NTP servers. The zero value is usable.
+type Client struct {
+	Timeout time.Duration // The time allowed for each query, or DefaultTimeout if zero.
+	Version uint8         // The protocol version sent, or DefaultVersion if zero.
+}
+
+// Query asks server, a host with an optional port, for the time and measures the offset of the local clock, using a
+// Client with the default settings.
+func Query(ctx context.Context, server string) (*Response, error) {
+	var c Client
+	return c.Query(ctx, server)
+}
+
+// QueryAll queries several servers in parallel, using a Client with the default settings.
+func QueryAll(ctx context.Context, servers []string) []Result {
+	var c Client
+	return c.QueryAll(ctx, servers)
+}
+
+// Query asks server, a host with an optional port, for the time and measures the offset of the local clock. A server
+// that is not synchronized, or that sends a Kiss-o'-Death, results in an error.
+func (c *Client) Query(ctx context.Context, server string) (*Response, error) {
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(strings.Trim(server, "[]"), "123")
+	}
+	timeout := DefaultTimeout
+	if c.Timeout > 0 {
+		timeout = c.Timeout
+	}
+	version := uint8(DefaultVersion)
+	if c.Version > 0 {
+		version = c.Version
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	dl := time.Now().Add(timeout)
+	if ctxDl, ok := ctx.Deadline(); ok && ctxDl.Before(dl) {
+		dl = ctxDl
+	}
+	conn.SetDeadline(dl)
+
+	// The transmit timestamp of the request is only used to match the response, so a random value is sent rather than
+	// the local time, which avoids revealing the state of the local clock.
+	req := make([]byte, headerLen)
+	req[0] = version<<3 | modeClient
+	if _, err := rand.Read(req[40:48]); err != nil {
+		return nil, err
+	}
+
+	t1 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		t4 := time.Now()
+		if err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		// Ignore anything that does not echo the request, as it may be a late answer to an earlier query or spoofed.
+		if n < headerLen || string(buf[24:32]) != string(req[40:48]) {
+			continue
+		}
+		return parse(server, buf[:n], t1, t4)
+	}
+}
+
+// contextErr returns the error of ctx if it is done, as that explains a timeout better than the error it caused.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// parse decodes a response received at t4 to a request sent at t1, and computes the clock offset and delay.
+func parse(server string, b []byte, t1, t4 time.Time) (*Response, error) {
+	leap, version, mode := b[0]>>6, b[0]>>3&7, b[0]&7
+	if mode != modeServer {
+		return nil, fmt.Errorf("ntp: %s: unexpected mode %d", server, mode)
+	}
+	stratum := b[1]
+	refID := binary.BigEndian.Uint32(b[12:])
+	if stratum == 0 {
+		var code [4]byte
+		binary.BigEndian.PutUint32(code[:], refID)
+		return nil, &KissError{Server: server, Code: strings.TrimRight(string(code[:]), "\x00")}
+	}
+	if leap == LeapUnsynchronized || stratum > 15 {
+		return nil, fmt.Errorf("ntp: %s: %w", server, ErrUnsynchronized)
+	}
+
+	t2 := fromTimestamp(binary.BigEndian.Uint64(b[32:]), t1)
+	t3 := fromTimestamp(binary.BigEndian.Uint64(b[40:]), t1)
+	if t3.IsZero() {
+		return nil, fmt.Errorf("ntp: %s: response has no transmit time", server)
+	}
+
+	// The offset is the mean of the apparent offsets in each direction, which assumes the path is symmetric. The local
+	// times are stripped of their monotonic readings, which would otherwise be ignored, to make that explicit.
+	wall1, wall4 := t1.Round(0), t4.Round(0)
+	offset := (t2.Sub(wall1) + t3.Sub(wall4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+	if delay < 0 {
+		delay = 0
+	}
+
+	return &Response{
+		Server:         server,
+		Time:           t3,
+		Offset:         offset,
+		Delay:          delay,
+		Stratum:        stratum,
+		Leap:           leap,
+		Version:        version,
+		Precision:      log2Duration(int8(b[3])),
+		Poll:           log2Duration(int8(b[2])),
+		RootDelay:      fromShort(binary.BigEndian.Uint32(b[4:])),
+		RootDispersion: fromShort(binary.BigEndian.Uint32(b[8:])),
+		ReferenceID:    refID,
+		ReferenceTime:  fromTimestamp(binary.BigEndian.Uint64(b[16:]), t1),
+	}, nil
+}
+
+// fromTimestamp converts a 64-bit NTP timestamp to a time. The seconds wrap around every 136 years, so the era is taken
+// to be the one that puts the time closest to near. A zero timestamp means the time is unset.
+func fromTimestamp(ts uint64, near time.Time) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	nearSecs := near.Unix() + epochOffset
+	secs := nearSecs + int64(int32(uint32(ts>>32)-uint32(nearSecs)))
+	nsec := int64((ts & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(secs-epochOffset, nsec)
+}
+
+// fromShort converts a 32-bit NTP short format value, of seconds and a 16-bit fraction, to a duration.
+func fromShort(v uint32) time.Duration {
+	return time.Duration(uint64(v) * uint64(time.Second) >> 16)
+}
+
+// log2Duration converts an exponent of two in seconds, as used for precision and poll intervals, to a duration.
+func log2Duration(exp int8) time.Duration {
+	return time.Duration(math.Ldexp(float64(time.Second), int(exp)))
+}
+
+// Result is the outcome of querying one of several servers.
+type Result struct {
+	Server   string
+	Response *Response
+	Err      error
+}
+
+// QueryAll queries several servers in parallel, returning the results in the same order as the servers.
+func (c *Client) QueryAll(ctx context.Context, servers []string) []Result {
+	results := make([]Result, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			resp, err := c.Query(ctx, server)
+			results[i] = Result{Server: server, Response: resp, Err: err}
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// MedianOffset returns the median offset of the successful results, which is robust against a minority of servers
+// with the wrong time, or an error if there were none.
+func MedianOffset(results []Result) (time.Duration, error) {
+	var offsets []time.Duration
+	for _, r := range results {
+		if r.Err == nil && r.Response != nil {
+			offsets = append(offsets, r.Response.Offset)
+		}
+	}
+	if len(offsets) == 0 {
+		return 0, errors.New("no successful results")
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	mid := len(offsets) / 2
+	if len(offsets)%2 == 0 {
+		return (offsets[mid-1] + offsets[mid]) / 2, nil
+	}
+	return offsets[mid], nil
+}
@@ -0,0 +1,157 @@
+package ntp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// toTimestamp converts a time to a 64-bit NTP timestamp.
+func toTimestamp(t time.Time) uint64 {
+	secs := uint64(t.Unix()+epochOffset) & 0xffffffff
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+// testServer answers requests on a loopback port, with a clock that is skew ahead of the local one, and with the
+// stratum and leap indicator given.
+func testServer(t *testing.T, skew time.Duration, stratum, leap uint8, refID string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < headerLen {
+				continue
+			}
+			rx := time.Now().Add(skew)
+			resp := make([]byte, headerLen)
+			resp[0] = leap<<6 | 4<<3 | modeServer
+			resp[1] = stratum
+			resp[2] = 6
+			resp[3] = 0xec // 2^-20 seconds.
+			binary.BigEndian.PutUint32(resp[4:], 0x00008000)
+			binary.BigEndian.PutUint32(resp[8:], 0x00000800)
+			copy(resp[12:16], refID)
+			binary.BigEndian.PutUint64(resp[16:], toTimestamp(rx.Add(-time.Minute)))
+			copy(resp[24:32], buf[40:48])
+			binary.BigEndian.PutUint64(resp[32:], toTimestamp(rx))
+			binary.BigEndian.PutUint64(resp[40:], toTimestamp(time.Now().Add(skew)))
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Offset", func(t *testing.T) {
+		server := testServer(t, 3*time.Second, 1, LeapNone, "GPS")
+		resp, err := Query(ctx, server)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if d := resp.Offset - 3*time.Second; d < -50*time.Millisecond || d > 50*time.Millisecond {
+			t.Errorf("offset %v, want 3s", resp.Offset)
+		}
+		if resp.Delay < 0 || resp.Delay > 100*time.Millisecond {
+			t.Errorf("delay %v", resp.Delay)
+		}
+		if resp.Stratum != 1 || resp.Reference() != "GPS" || resp.Version != 4 {
+			t.Errorf("got stratum %d, reference %q, version %d", resp.Stratum, resp.Reference(), resp.Version)
+		}
+		if resp.RootDelay != 500*time.Millisecond || resp.RootDispersion != 31250*time.Microsecond {
+			t.Errorf("got root delay %v, dispersion %v", resp.RootDelay, resp.RootDispersion)
+		}
+		if resp.Poll != 64*time.Second || resp.Precision != 953*time.Nanosecond {
+			t.Errorf("got poll %v, precision %v", resp.Poll, resp.Precision)
+		}
+	})
+
+	t.Run("Upstream", func(t *testing.T) {
+		server := testServer(t, 0, 2, LeapNone, string([]byte{192, 0, 2, 1}))
+		resp, err := Query(ctx, server)
+		if err != nil || resp.Reference() != "192.0.2.1" {
+			t.Fatalf("got %+v, err %v", resp, err)
+		}
+	})
+
+	t.Run("KissOfDeath", func(t *testing.T) {
+		server := testServer(t, 0, 0, LeapNone, "RATE")
+		_, err := Query(ctx, server)
+		var kiss *KissError
+		if !errors.As(err, &kiss) || kiss.Code != "RATE" {
+			t.Fatalf("got %v, want kiss of death", err)
+		}
+	})
+
+	t.Run("Unsynchronized", func(t *testing.T) {
+		server := testServer(t, 0, 3, LeapUnsynchronized, "LOCL")
+		if _, err := Query(ctx, server); !errors.Is(err, ErrUnsynchronized) {
+			t.Fatalf("got %v, want unsynchronized", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer conn.Close()
+		c := &Client{Timeout: 50 * time.Millisecond}
+		var netErr net.Error
+		if _, err := c.Query(ctx, conn.LocalAddr().String()); !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("got %v, want timeout", err)
+		}
+	})
+}
+
+func TestQueryAll(t *testing.T) {
+	servers := []string{
+		testServer(t, time.Second, 2, LeapNone, "\x00\x00\x00\x00"),
+		testServer(t, 2*time.Second, 2, LeapNone, "\x00\x00\x00\x00"),
+		testServer(t, time.Hour, 2, LeapNone, "\x00\x00\x00\x00"),
+		testServer(t, 0, 0, LeapNone, "DENY"),
+	}
+	results := QueryAll(context.Background(), servers)
+	for i, r := range results {
+		if r.Server != servers[i] {
+			t.Fatalf("result %d is for %s, want %s", i, r.Server, servers[i])
+		}
+	}
+	if results[3].Err == nil {
+		t.Errorf("kiss of death not reported")
+	}
+
+	// The server an hour out is outvoted.
+	offset, err := MedianOffset(results)
+	if d := offset - 2*time.Second; err != nil || d < -50*time.Millisecond || d > 50*time.Millisecond {
+		t.Fatalf("median offset %v, err %v, want 2s", offset, err)
+	}
+	if _, err := MedianOffset(results[3:]); err == nil {
+		t.Fatalf("median of no results")
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	// Times either side of the 2036 rollover of the seconds field convert back when the local clock is nearby.
+	for _, s := range []string{"2000-01-01T00:00:00.5Z", "2036-02-07T06:28:15Z", "2036-02-07T06:28:17.25Z"} {
+		want, _ := time.Parse(time.RFC3339Nano, s)
+		near := want.Add(-24 * time.Hour)
+		if got := fromTimestamp(toTimestamp(want), near); !got.Equal(want) {
+			t.Errorf("%s: got %v", s, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// BFDHeaderLen is the length of a BFD control packet without an authentication section.
+const BFDHeaderLen = 24
+
+// UDP ports BFD control packets are sent to.
+const (
+	BFDPort         = 3784 // Single-hop sessions, RFC 5881.
+	BFDMultihopPort = 4784 // Multihop sessions, RFC 5883.
+	BFDEchoPort     = 3785 // Echo packets, RFC 5881.
+)
+
+// BFD control packet flags, in the low six bits of the second octet.
+const (
+	BFDFlagPoll       = 0x20 // The sender requests verification of a change of parameters.
+	BFDFlagFinal      = 0x10 // The sender answers a poll.
+	BFDFlagCPI        = 0x08 // Control plane independent: BFD does not share fate with the control plane.
+	BFDFlagAuth       = 0x04 // An authentication section is present.
+	BFDFlagDemand     = 0x02 // The sender wishes to use demand mode.
+	BFDFlagMultipoint = 0x01 // Reserved for point-to-multipoint extensions, and must be zero.
+)
+
+// bfdFlagsMask masks the flags in the second octet of a control packet.
+const bfdFlagsMask = 0x3f
+
+// bfdMinAuthLen is the length of the shortest authentication section, of only its type and length.
+const bfdMinAuthLen = 2
+
+// BFDState is the state of a BFD session.
+type BFDState uint8
+
+// BFD session states.
+const (
+	BFDAdminDown BFDState = 0
+	BFDDown      BFDState = 1
+	BFDInit      BFDState = 2
+	BFDUp        BFDState = 3
+)
+
+func (s BFDState) String() string {
+	switch s {
+	case BFDAdminDown:
+		return "admin-down"
+	case BFDDown:
+		return "down"
+	case BFDInit:
+		return "init"
+	case BFDUp:
+		return "up"
+	}
+	return "BFDState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// BFDDiag is the diagnostic code of a BFD session, giving the reason for its last change of state.
+type BFDDiag uint8
+
+// BFD diagnostic codes.
+const (
+	BFDDiagNone                  BFDDiag = 0
+	BFDDiagControlDetectExpired  BFDDiag = 1
+	BFDDiagEchoFailed            BFDDiag = 2
+	BFDDiagNeighborDown          BFDDiag = 3
+	BFDDiagForwardingPlaneReset  BFDDiag = 4
+	BFDDiagPathDown              BFDDiag = 5
+	BFDDiagConcatenatedPathDown  BFDDiag = 6
+	BFDDiagAdminDown             BFDDiag = 7
+	BFDDiagReverseConcatenatedPD BFDDiag = 8
+)
+
+func (d BFDDiag) String() string {
+	switch d {
+	case BFDDiagNone:
+		return "none"
+	case BFDDiagControlDetectExpired:
+		return "control-detection-time-expired"
+	case BFDDiagEchoFailed:
+		return "echo-function-failed"
+	case BFDDiagNeighborDown:
+		return "neighbor-signaled-session-down"
+	case BFDDiagForwardingPlaneReset:
+		return "forwarding-plane-reset"
+	case BFDDiagPathDown:
+		return "path-down"
+	case BFDDiagConcatenatedPathDown:
+		return "concatenated-path-down"
+	case BFDDiagAdminDown:
+		return "administratively-down"
+	case BFDDiagReverseConcatenatedPD:
+		return "reverse-concatenated-path-down"
+	}
+	return "BFDDiag(" + strconv.Itoa(int(d)) + ")"
+}
+
+// BFD is a view of a BFD control packet, as defined by RFC 5880.
+type BFD []byte
+
+// BFDFields holds the values written by BFD.Encode.
+type BFDFields struct {
+	Diag       BFDDiag
+	State      BFDState
+	Flags      uint8 // BFDFlagAuth is set if Auth is not empty.
+	DetectMult uint8
+	// The discriminators identifying the session at the sender and receiver; the receiver's is zero until it is
+	// learned.
+	MyDiscriminator   uint32
+	YourDiscriminator uint32
+	// The intervals, with microsecond precision.
+	DesiredMinTx      time.Duration
+	RequiredMinRx     time.Duration
+	RequiredMinEchoRx time.Duration
+	Auth              []byte // The authentication section, starting at its type octet.
+}
+
+// Valid checks that the buffer holds a control packet of version 1 as long as it claims to be, with the fields RFC 5880
+// requires a receiver to check set as they must be.
+func (b BFD) Valid() error {
+	if len(b) < BFDHeaderLen {
+		return fmt.Errorf("bfd control packet too short: %d bytes", len(b))
+	}
+	if v := b.Version(); v != 1 {
+		return fmt.Errorf("unsupported bfd version %d", v)
+	}
+	l := int(b.Length())
+	min := BFDHeaderLen
+	if b.Flags()&BFDFlagAuth != 0 {
+		min += bfdMinAuthLen
+	}
+	if l < min || l > len(b) {
+		return fmt.Errorf("invalid bfd length %d for %d byte buffer", l, len(b))
+	}
+	if b.Flags()&BFDFlagAuth != 0 && BFDHeaderLen+int(b[BFDHeaderLen+1]) > l {
+		return errors.New("bfd authentication section longer than packet")
+	}
+	switch {
+	case b.DetectMult() == 0:
+		return errors.New("bfd detect multiplier zero")
+	case b.Flags()&BFDFlagMultipoint != 0:
+		return errors.New("bfd multipoint flag set")
+	case b.MyDiscriminator() == 0:
+		return errors.New("bfd my discriminator zero")
+	case b.YourDiscriminator() == 0 && b.State() != BFDDown && b.State() != BFDAdminDown:
+		return fmt.Errorf("bfd your discriminator zero in state %v", b.State())
+	}
+	return nil
+}
+
+// Version returns the version of the protocol, which is 1 for a valid packet.
+func (b BFD) Version() int { return int(b[0] >> 5) }
+
+// Diag returns the diagnostic code.
+func (b BFD) Diag() BFDDiag { return BFDDiag(b[0] & 0x1f) }
+
+// State returns the state of the session at the sender.
+func (b BFD) State() BFDState { return BFDState(b[1] >> 6) }
+
+// Flags returns the flags.
+func (b BFD) Flags() uint8 { return b[1] & bfdFlagsMask }
+
+// DetectMult returns the detection time multiplier.
+func (b BFD) DetectMult() uint8 { return b[2] }
+
+// Length returns the length of the packet, including any authentication section.
+func (b BFD) Length() uint8 { return b[3] }
+
+// MyDiscriminator returns the discriminator of the session at the sender.
+func (b BFD) MyDiscriminator() uint32 { return binary.BigEndian.Uint32(b[4:]) }
+
+// YourDiscriminator returns the discriminator of the session at the receiver, or zero if it is not known.
+func (b BFD) YourDiscriminator() uint32 { return binary.BigEndian.Uint32(b[8:]) }
+
+// DesiredMinTx returns the minimum interval at which the sender wishes to send control packets.
+func (b BFD) DesiredMinTx() time.Duration { return microseconds(b[12:]) }
+
+// RequiredMinRx returns the minimum interval at which the sender can receive control packets.
+func (b BFD) RequiredMinRx() time.Duration { return microseconds(b[16:]) }
+
+// RequiredMinEchoRx returns the minimum interval at which the sender can receive echo packets, or zero if it cannot.
+func (b BFD) RequiredMinEchoRx() time.Duration { return microseconds(b[20:]) }
+
+// Auth returns the authentication section, if any.
+func (b BFD) Auth() []byte {
+	if b.Flags()&BFDFlagAuth == 0 {
+		return nil
+	}
+	return b[BFDHeaderLen:b.Length()]
+}
+
+// microseconds returns a duration held in microseconds.
+func microseconds(b []byte) time.Duration {
+	return time.Duration(binary.BigEndian.Uint32(b)) * time.Microsecond
+}
+
+// Encode writes the control packet described by f into the start of the buffer.
+func (b BFD) Encode(f *BFDFields) error {
+	l := BFDHeaderLen + len(f.Auth)
+	if l > 0xff || len(f.Auth) == 1 {
+		return fmt.Errorf("invalid bfd authentication section length %d", len(f.Auth))
+	}
+	if len(b) < l {
+		return fmt.Errorf("buffer too short for bfd control packet: %d bytes", len(b))
+	}
+	if f.Diag > 0x1f || f.State > BFDUp {
+		return fmt.Errorf("invalid bfd diagnostic %d or state %d", f.Diag, f.State)
+	}
+	for _, d := range []time.Duration{f.DesiredMinTx, f.RequiredMinRx, f.RequiredMinEchoRx} {
+		if d < 0 || d/time.Microsecond > 0xffffffff {
+			return fmt.Errorf("bfd interval %v out of range", d)
+		}
+	}
+	flags := f.Flags &^ BFDFlagAuth
+	if len(f.Auth) > 0 {
+		flags |= BFDFlagAuth
+	}
+	b[0] = 1<<5 | byte(f.Diag)
+	b[1] = byte(f.State)<<6 | flags&bfdFlagsMask
+	b[2] = f.DetectMult
+	b[3] = byte(l)
+	binary.BigEndian.PutUint32(b[4:], f.MyDiscriminator)
+	binary.BigEndian.PutUint32(b[8:], f.YourDiscriminator)
+	binary.BigEndian.PutUint32(b[12:], uint32(f.DesiredMinTx/time.Microsecond))
+	binary.BigEndian.PutUint32(b[16:], uint32(f.RequiredMinRx/time.Microsecond))
+	binary.BigEndian.PutUint32(b[20:], uint32(f.RequiredMinEchoRx/time.Microsecond))
+	copy(b[BFDHeaderLen:l], f.Auth)
+	return nil
+}
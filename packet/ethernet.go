@@ -0,0 +1,65 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// EthernetHeaderLen is the length of an Ethernet header without VLAN tags.
+const EthernetHeaderLen = 14
+
+// EtherTypes, which also identify the payload of GRE and Geneve packets.
+const (
+	EtherTypeIPv4                = 0x0800
+	EtherTypeARP                 = 0x0806
+	EtherTypeTransparentEthernet = 0x6558 // An Ethernet frame, as carried by GRE (NVGRE) and Geneve.
+	EtherTypeVLAN                = 0x8100
+	EtherTypeIPv6                = 0x86dd
+	EtherTypeMPLS                = 0x8847
+	EtherTypeLLDP                = 0x88cc
+)
+
+// Ethernet is a view of an Ethernet frame, starting at its header, as carried by VXLAN, Geneve, and some GRE tunnels.
+type Ethernet []byte
+
+// EthernetFields holds the values written by Ethernet.Encode.
+type EthernetFields struct {
+	Dst       net.HardwareAddr
+	Src       net.HardwareAddr
+	EtherType uint16
+}
+
+// Valid checks that the buffer is long enough to hold the header.
+func (b Ethernet) Valid() error {
+	if len(b) < EthernetHeaderLen {
+		return fmt.Errorf("ethernet header too short: %d bytes", len(b))
+	}
+	return nil
+}
+
+// Dst returns the destination address, referring to the underlying buffer.
+func (b Ethernet) Dst() net.HardwareAddr { return net.HardwareAddr(b[0:6]) }
+
+// Src returns the source address, referring to the underlying buffer.
+func (b Ethernet) Src() net.HardwareAddr { return net.HardwareAddr(b[6:12]) }
+
+// EtherType returns the type of the payload.
+func (b Ethernet) EtherType() uint16 { return binary.BigEndian.Uint16(b[12:]) }
+
+// Payload returns the data following the header. VLAN tags are not skipped.
+func (b Ethernet) Payload() []byte { return b[EthernetHeaderLen:] }
+
+// Encode writes the header described by f into the start of the buffer.
+func (b Ethernet) Encode(f *EthernetFields) error {
+	if len(b) < EthernetHeaderLen {
+		return fmt.Errorf("buffer too short for ethernet header: %d bytes", len(b))
+	}
+	if len(f.Dst) != 6 || len(f.Src) != 6 {
+		return fmt.Errorf("ethernet header needs 6 octet addresses")
+	}
+	copy(b[0:6], f.Dst)
+	copy(b[6:12], f.Src)
+	binary.BigEndian.PutUint16(b[12:], f.EtherType)
+	return nil
+}
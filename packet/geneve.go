@@ -0,0 +1,126 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// GeneveMinLen is the length of a Geneve header without options.
+const GeneveMinLen = 8
+
+// GenevePort is the UDP port Geneve is carried on.
+const GenevePort = 6081
+
+// Geneve flags, in the second octet of the header.
+const (
+	GeneveFlagOAM      = 0x80 // The packet is a control message.
+	GeneveFlagCritical = 0x40 // Options marked critical are present.
+)
+
+// Geneve is a view of a Geneve packet, starting at its header, as defined by RFC 8926.
+type Geneve []byte
+
+// GeneveFields holds the values written by Geneve.Encode.
+type GeneveFields struct {
+	Flags    uint8
+	Protocol uint16 // The EtherType of the payload, such as EtherTypeTransparentEthernet.
+	VNI      uint32
+	Options  []byte // Must be a multiple of 4 octets long; see AppendGeneveOptions.
+}
+
+// Valid checks that the buffer is long enough to hold the header it claims to have, and that it is version 0.
+func (b Geneve) Valid() error {
+	if len(b) < GeneveMinLen {
+		return fmt.Errorf("geneve header too short: %d bytes", len(b))
+	}
+	if v := b.Version(); v != 0 {
+		return fmt.Errorf("unsupported geneve version %d", v)
+	}
+	if hl := b.HeaderLen(); hl > len(b) {
+		return fmt.Errorf("geneve header length %d longer than %d byte buffer", hl, len(b))
+	}
+	return nil
+}
+
+// Version returns the version of the header, which is zero for a valid packet.
+func (b Geneve) Version() int { return int(b[0] >> 6) }
+
+// HeaderLen returns the length of the header, including options, in octets.
+func (b Geneve) HeaderLen() int { return GeneveMinLen + int(b[0]&0x3f)*4 }
+
+// Flags returns the flags.
+func (b Geneve) Flags() uint8 { return b[1] & 0xc0 }
+
+// Protocol returns the EtherType of the payload.
+func (b Geneve) Protocol() uint16 { return binary.BigEndian.Uint16(b[2:]) }
+
+// VNI returns the virtual network identifier.
+func (b Geneve) VNI() uint32 { return binary.BigEndian.Uint32(b[4:]) >> 8 }
+
+// SetVNI sets the virtual network identifier.
+func (b Geneve) SetVNI(vni uint32) { binary.BigEndian.PutUint32(b[4:], vni<<8) }
+
+// Options returns the options, if any.
+func (b Geneve) Options() []byte { return b[GeneveMinLen:b.HeaderLen()] }
+
+// Payload returns the data following the header.
+func (b Geneve) Payload() []byte { return b[b.HeaderLen():] }
+
+// Encode writes the header described by f into the start of the buffer. The buffer must be large enough to hold the
+// header and options.
+func (b Geneve) Encode(f *GeneveFields) error {
+	if len(f.Options)%4 != 0 || len(f.Options) > 0x3f*4 {
+		return fmt.Errorf("invalid geneve options length %d", len(f.Options))
+	}
+	hl := GeneveMinLen + len(f.Options)
+	if len(b) < hl {
+		return fmt.Errorf("buffer too short for geneve header: %d bytes", len(b))
+	}
+	if f.VNI > 0xffffff {
+		return fmt.Errorf("geneve vni %d larger than 24 bits", f.VNI)
+	}
+	b[0] = uint8(len(f.Options) / 4)
+	b[1] = f.Flags & 0xc0
+	binary.BigEndian.PutUint16(b[2:], f.Protocol)
+	b.SetVNI(f.VNI)
+	copy(b[GeneveMinLen:hl], f.Options)
+	return nil
+}
+
+// GeneveOption is a single Geneve option. Types with the high bit set are critical: a tunnel endpoint that does not
+// understand them must drop the packet.
+type GeneveOption struct {
+	Class uint16
+	Type  uint8
+	Data  []byte // Up to 124 octets.
+}
+
+// ParseGeneveOptions decodes Geneve options, such as those returned by Geneve.Options.
+func ParseGeneveOptions(b []byte) ([]GeneveOption, error) {
+	var opts []GeneveOption
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("geneve option truncated: %d bytes", len(b))
+		}
+		l := 4 + int(b[3]&0x1f)*4
+		if l > len(b) {
+			return nil, fmt.Errorf("invalid length %d for geneve option class %d type %d", l,
+				binary.BigEndian.Uint16(b), b[2])
+		}
+		opts = append(opts, GeneveOption{Class: binary.BigEndian.Uint16(b), Type: b[2], Data: b[4:l]})
+		b = b[l:]
+	}
+	return opts, nil
+}
+
+// AppendGeneveOptions appends the encoding of opts to b, suitable for GeneveFields.Options. Option data that is not a
+// multiple of 4 octets long is padded with zeros.
+func AppendGeneveOptions(b []byte, opts []GeneveOption) []byte {
+	for _, opt := range opts {
+		words := (len(opt.Data) + 3) / 4
+		b = append(b, byte(opt.Class>>8), byte(opt.Class), opt.Type, byte(words)&0x1f)
+		b = append(b, opt.Data...)
+		b = append(b, make([]byte, words*4-len(opt.Data))...)
+	}
+	return b
+}
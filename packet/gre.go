@@ -0,0 +1,164 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/dotwaffle/inettools/checksum"
+)
+
+// GREMinLen is the length of a GRE header without optional fields.
+const GREMinLen = 4
+
+// GRE flags, in the first octet of the header.
+const (
+	GREFlagChecksum = 0x80
+	GREFlagKey      = 0x20
+	GREFlagSequence = 0x10
+)
+
+// GRE is a view of a GRE packet, starting at its header, as defined by RFC 2784 with the key and sequence number
+// extensions of RFC 2890.
+type GRE []byte
+
+// GREFields holds the values written by GRE.Encode.
+type GREFields struct {
+	Protocol    uint16 // The EtherType of the payload.
+	Checksum    bool   // Whether to include a checksum.
+	HasKey      bool
+	Key         uint32
+	HasSequence bool
+	Sequence    uint32
+}
+
+// Valid checks that the buffer is long enough to hold the header it claims to have, and that it is version 0 with no
+// reserved flags set.
+func (b GRE) Valid() error {
+	if len(b) < GREMinLen {
+		return fmt.Errorf("gre header too short: %d bytes", len(b))
+	}
+	if v := b.Version(); v != 0 {
+		return fmt.Errorf("unsupported gre version %d", v)
+	}
+	if b[0]&0x4f != 0 || b[1]&0xf8 != 0 {
+		return fmt.Errorf("gre reserved flags set: %02x%02x", b[0], b[1])
+	}
+	if hl := b.HeaderLen(); hl > len(b) {
+		return fmt.Errorf("gre header length %d longer than %d byte buffer", hl, len(b))
+	}
+	return nil
+}
+
+// Version returns the version of the header, which is zero for a valid packet.
+func (b GRE) Version() int { return int(b[1] & 0x07) }
+
+// HasChecksum reports whether the header includes a checksum.
+func (b GRE) HasChecksum() bool { return b[0]&GREFlagChecksum != 0 }
+
+// HasKey reports whether the header includes a key.
+func (b GRE) HasKey() bool { return b[0]&GREFlagKey != 0 }
+
+// HasSequence reports whether the header includes a sequence number.
+func (b GRE) HasSequence() bool { return b[0]&GREFlagSequence != 0 }
+
+// Protocol returns the EtherType of the payload.
+func (b GRE) Protocol() uint16 { return binary.BigEndian.Uint16(b[2:]) }
+
+// HeaderLen returns the length of the header, including the optional fields.
+func (b GRE) HeaderLen() int {
+	l := GREMinLen
+	for _, present := range []bool{b.HasChecksum(), b.HasKey(), b.HasSequence()} {
+		if present {
+			l += 4
+		}
+	}
+	return l
+}
+
+// offset returns the offset of an optional field, which follow the fixed header in the order checksum, key, and
+// sequence number.
+func (b GRE) offset(flag uint8) int {
+	off := GREMinLen
+	for _, f := range []uint8{GREFlagChecksum, GREFlagKey} {
+		if f == flag {
+			break
+		}
+		if b[0]&f != 0 {
+			off += 4
+		}
+	}
+	return off
+}
+
+// Checksum returns the checksum, or zero if there is none.
+func (b GRE) Checksum() uint16 {
+	if !b.HasChecksum() {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b[GREMinLen:])
+}
+
+// Key returns the key, and whether there is one.
+func (b GRE) Key() (uint32, bool) {
+	if !b.HasKey() {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[b.offset(GREFlagKey):]), true
+}
+
+// Sequence returns the sequence number, and whether there is one.
+func (b GRE) Sequence() (uint32, bool) {
+	if !b.HasSequence() {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[b.offset(GREFlagSequence):]), true
+}
+
+// Payload returns the data following the header.
+func (b GRE) Payload() []byte { return b[b.HeaderLen():] }
+
+// ComputeChecksum calculates the checksum over the header and payload and stores it in the header, which must have a
+// checksum field.
+func (b GRE) ComputeChecksum() {
+	binary.BigEndian.PutUint16(b[GREMinLen:], 0)
+	binary.BigEndian.PutUint16(b[GREMinLen:], checksum.Checksum(b, 0))
+}
+
+// VerifyChecksum reports whether the checksum is correct. A packet without a checksum is accepted.
+func (b GRE) VerifyChecksum() bool {
+	return !b.HasChecksum() || checksum.Checksum(b, 0) == 0
+}
+
+// Encode writes the header described by f into the start of the buffer, and computes the checksum if there is one.
+// The payload must already be in place, following the header, and extends to the end of the buffer.
+func (b GRE) Encode(f *GREFields) error {
+	hl := GREMinLen
+	var flags uint8
+	for _, opt := range []struct {
+		present bool
+		flag    uint8
+	}{{f.Checksum, GREFlagChecksum}, {f.HasKey, GREFlagKey}, {f.HasSequence, GREFlagSequence}} {
+		if opt.present {
+			flags |= opt.flag
+			hl += 4
+		}
+	}
+	if len(b) < hl {
+		return fmt.Errorf("buffer too short for gre header: %d bytes", len(b))
+	}
+
+	b[0], b[1] = flags, 0
+	binary.BigEndian.PutUint16(b[2:], f.Protocol)
+	if f.Checksum {
+		binary.BigEndian.PutUint32(b[GREMinLen:], 0)
+	}
+	if f.HasKey {
+		binary.BigEndian.PutUint32(b[b.offset(GREFlagKey):], f.Key)
+	}
+	if f.HasSequence {
+		binary.BigEndian.PutUint32(b[b.offset(GREFlagSequence):], f.Sequence)
+	}
+	if f.Checksum {
+		b.ComputeChecksum()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package packet
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// HSRPHeaderLen is the length of an HSRP version 1 message.
+const HSRPHeaderLen = 20
+
+// HSRPPort is the UDP port HSRP is carried on.
+const HSRPPort = 1985
+
+// HSRP opcodes.
+const (
+	HSRPOpHello  = 0 // Sent periodically by routers that are active or standby, or becoming so.
+	HSRPOpCoup   = 1 // Sent by a router wishing to become active.
+	HSRPOpResign = 2 // Sent by an active router that no longer wishes to be.
+)
+
+// HSRPState is the state of a router in an HSRP group.
+type HSRPState uint8
+
+// HSRP states.
+const (
+	HSRPInitial HSRPState = 0
+	HSRPLearn   HSRPState = 1
+	HSRPListen  HSRPState = 2
+	HSRPSpeak   HSRPState = 4
+	HSRPStandby HSRPState = 8
+	HSRPActive  HSRPState = 16
+)
+
+func (s HSRPState) String() string {
+	switch s {
+	case HSRPInitial:
+		return "initial"
+	case HSRPLearn:
+		return "learn"
+	case HSRPListen:
+		return "listen"
+	case HSRPSpeak:
+		return "speak"
+	case HSRPStandby:
+		return "standby"
+	case HSRPActive:
+		return "active"
+	}
+	return "HSRPState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// HSRPDefaultAuth is the authentication data sent when none is configured.
+var HSRPDefaultAuth = [8]byte{'c', 'i', 's', 'c', 'o'}
+
+// HSRP is a view of an HSRP version 1 message, as defined by RFC 2281. Version 2, whose messages are TLVs sent to
+// 224.0.0.102, is not supported.
+type HSRP []byte
+
+// HSRPFields holds the values written by HSRP.Encode.
+type HSRPFields struct {
+	OpCode    uint8
+	State     HSRPState
+	HelloTime time.Duration // In whole seconds.
+	HoldTime  time.Duration // In whole seconds.
+	Priority  uint8
+	Group     uint8
+	Auth      [8]byte // The authentication data, in clear text; normally HSRPDefaultAuth.
+	VirtualIP net.IP  // May be zero in hellos of routers that have not learned it.
+}
+
+// Valid checks that the buffer is long enough to hold a message, and that it is version 0, as RFC 2281 numbers
+// version 1 of the protocol.
+func (b HSRP) Valid() error {
+	if len(b) < HSRPHeaderLen {
+		return fmt.Errorf("hsrp message too short: %d bytes", len(b))
+	}
+	if b.Version() != 0 {
+		return fmt.Errorf("unsupported hsrp version %d", b.Version())
+	}
+	return nil
+}
+
+// Version returns the version of the message format, which is zero for version 1 of the protocol.
+func (b HSRP) Version() int { return int(b[0]) }
+
+// OpCode returns the type of the message.
+func (b HSRP) OpCode() uint8 { return b[1] }
+
+// State returns the state of the sending router.
+func (b HSRP) State() HSRPState { return HSRPState(b[2]) }
+
+// HelloTime returns the interval between hellos, where the sender has it configured.
+func (b HSRP) HelloTime() time.Duration { return time.Duration(b[3]) * time.Second }
+
+// HoldTime returns how long a hello is valid for, where the sender has it configured.
+func (b HSRP) HoldTime() time.Duration { return time.Duration(b[4]) * time.Second }
+
+// Priority returns the priority of the sending router.
+func (b HSRP) Priority() uint8 { return b[5] }
+
+// Group returns the standby group.
+func (b HSRP) Group() uint8 { return b[6] }
+
+// Auth returns the authentication data, a clear-text password padded with zeros.
+func (b HSRP) Auth() []byte { return b[8:16] }
+
+// VirtualIP returns the virtual address of the group, referring to the underlying buffer.
+func (b HSRP) VirtualIP() net.IP { return net.IP(b[16:20]) }
+
+// Encode writes the message described by f into the start of the buffer.
+func (b HSRP) Encode(f *HSRPFields) error {
+	if len(b) < HSRPHeaderLen {
+		return fmt.Errorf("buffer too short for hsrp message: %d bytes", len(b))
+	}
+	hello, hold := f.HelloTime/time.Second, f.HoldTime/time.Second
+	if hello > 0xff || hold > 0xff || f.HelloTime%time.Second != 0 || f.HoldTime%time.Second != 0 {
+		return fmt.Errorf("hsrp hello time %v or hold time %v not whole seconds to 255", f.HelloTime, f.HoldTime)
+	}
+	vip := net.IPv4zero.To4()
+	if f.VirtualIP != nil {
+		if vip = f.VirtualIP.To4(); vip == nil {
+			return fmt.Errorf("hsrp virtual address %v is not ipv4", f.VirtualIP)
+		}
+	}
+	b[0], b[1], b[2], b[3], b[4] = 0, f.OpCode, byte(f.State), byte(hello), byte(hold)
+	b[5], b[6], b[7] = f.Priority, f.Group, 0
+	copy(b[8:16], f.Auth[:])
+	copy(b[16:20], vip)
+	return nil
+}
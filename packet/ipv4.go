@@ -0,0 +1,185 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/checksum"
+	"net"
+)
+
+// IPv4MinLen is the length of an IPv4 header without options.
+const IPv4MinLen = 20
+
+// IPv4 flags.
+const (
+	IPv4DontFragment  = 0x2
+	IPv4MoreFragments = 0x1
+)
+
+// IPv4 is a view of an IPv4 packet, starting at its header. Accessors read and setters write the underlying buffer
+// directly, so no copies are made; call Valid before using the accessors on untrusted input.
+type IPv4 []byte
+
+// IPv4Fields holds the values written by IPv4.Encode.
+type IPv4Fields struct {
+	TOS            uint8
+	TotalLen       uint16 // Zero means the length of the buffer.
+	ID             uint16
+	Flags          uint8
+	FragmentOffset uint16 // In units of 8 octets.
+	TTL            uint8
+	Protocol       uint8
+	Src            net.IP
+	Dst            net.IP
+	Options        []byte // Must be a multiple of 4 octets long.
+}
+
+// Valid checks that the buffer is long enough to hold the header it claims to have, and that the total length does
+// not exceed the buffer.
+func (b IPv4) Valid() error {
+	if len(b) < IPv4MinLen {
+		return fmt.Errorf("ipv4 header too short: %d bytes", len(b))
+	}
+	if b.Version() != 4 {
+		return fmt.Errorf("not ipv4: version %d", b.Version())
+	}
+	if hl := b.HeaderLen(); hl < IPv4MinLen || hl > len(b) {
+		return fmt.Errorf("invalid ipv4 header length %d", hl)
+	}
+	if tl := int(b.TotalLen()); tl < b.HeaderLen() || tl > len(b) {
+		return fmt.Errorf("invalid ipv4 total length %d for %d byte buffer", tl, len(b))
+	}
+	return nil
+}
+
+// Version returns the IP version, which is 4 for a valid packet.
+func (b IPv4) Version() int { return int(b[0] >> 4) }
+
+// HeaderLen returns the length of the header, including options, in octets.
+func (b IPv4) HeaderLen() int { return int(b[0]&0x0f) * 4 }
+
+// TOS returns the type of service octet, holding the DSCP and ECN bits.
+func (b IPv4) TOS() uint8 { return b[1] }
+
+// SetTOS sets the type of service octet.
+func (b IPv4) SetTOS(tos uint8) { b[1] = tos }
+
+// TotalLen returns the length of the packet, including the header.
+func (b IPv4) TotalLen() uint16 { return binary.BigEndian.Uint16(b[2:]) }
+
+// SetTotalLen sets the length of the packet, including the header.
+func (b IPv4) SetTotalLen(l uint16) { binary.BigEndian.PutUint16(b[2:], l) }
+
+// ID returns the identification field.
+func (b IPv4) ID() uint16 { return binary.BigEndian.Uint16(b[4:]) }
+
+// SetID sets the identification field.
+func (b IPv4) SetID(id uint16) { binary.BigEndian.PutUint16(b[4:], id) }
+
+// Flags returns the three flag bits.
+func (b IPv4) Flags() uint8 { return b[6] >> 5 }
+
+// FragmentOffset returns the fragment offset, in units of 8 octets.
+func (b IPv4) FragmentOffset() uint16 { return binary.BigEndian.Uint16(b[6:]) & 0x1fff }
+
+// SetFlagsFragmentOffset sets the flags and the fragment offset, which share a field.
+func (b IPv4) SetFlagsFragmentOffset(flags uint8, offset uint16) {
+	binary.BigEndian.PutUint16(b[6:], uint16(flags)<<13|offset&0x1fff)
+}
+
+// TTL returns the time to live.
+func (b IPv4) TTL() uint8 { return b[8] }
+
+// SetTTL sets the time to live. The header checksum must be updated afterwards.
+func (b IPv4) SetTTL(ttl uint8) { b[8] = ttl }
+
+// DecrementTTL decrements the time to live, as a router forwarding the packet would, and incrementally updates the
+// header checksum to match. It returns false, leaving the packet unchanged, if the time to live is already zero.
+func (b IPv4) DecrementTTL() bool {
+	if b[8] == 0 {
+		return false
+	}
+	word := binary.BigEndian.Uint16(b[8:])
+	b[8]--
+	b.SetChecksum(checksum.Update(b.Checksum(), word, binary.BigEndian.Uint16(b[8:])))
+	return true
+}
+
+// Protocol returns the protocol number of the payload.
+func (b IPv4) Protocol() uint8 { return b[9] }
+
+// SetProtocol sets the protocol number of the payload.
+func (b IPv4) SetProtocol(p uint8) { b[9] = p }
+
+// Checksum returns the header checksum.
+func (b IPv4) Checksum() uint16 { return binary.BigEndian.Uint16(b[10:]) }
+
+// SetChecksum sets the header checksum.
+func (b IPv4) SetChecksum(c uint16) { binary.BigEndian.PutUint16(b[10:], c) }
+
+// Src returns the source address, referring to the underlying buffer.
+func (b IPv4) Src() net.IP { return net.IP(b[12:16]) }
+
+// SetSrc sets the source address.
+func (b IPv4) SetSrc(ip net.IP) { copy(b[12:16], ip.To4()) }
+
+// Dst returns the destination address, referring to the underlying buffer.
+func (b IPv4) Dst() net.IP { return net.IP(b[16:20]) }
+
+// SetDst sets the destination address.
+func (b IPv4) SetDst(ip net.IP) { copy(b[16:20], ip.To4()) }
+
+// Options returns the header options, if any.
+func (b IPv4) Options() []byte { return b[IPv4MinLen:b.HeaderLen()] }
+
+// Payload returns the data following the header, up to the total length of the packet.
+func (b IPv4) Payload() []byte { return b[b.HeaderLen():b.TotalLen()] }
+
+// ComputeChecksum calculates the header checksum and stores it in the header.
+func (b IPv4) ComputeChecksum() {
+	b.SetChecksum(0)
+	b.SetChecksum(checksum.Checksum(b[:b.HeaderLen()], 0))
+}
+
+// VerifyChecksum reports whether the header checksum is correct.
+func (b IPv4) VerifyChecksum() bool {
+	return checksum.Checksum(b[:b.HeaderLen()], 0) == 0
+}
+
+// Encode writes the header described by f into the start of the buffer, and computes its checksum. The buffer must
+// be large enough to hold the header and options.
+func (b IPv4) Encode(f *IPv4Fields) error {
+	if len(f.Options)%4 != 0 || len(f.Options) > 40 {
+		return fmt.Errorf("invalid ipv4 options length %d", len(f.Options))
+	}
+	hl := IPv4MinLen + len(f.Options)
+	if len(b) < hl {
+		return fmt.Errorf("buffer too short for ipv4 header: %d bytes", len(b))
+	}
+	if f.Src.To4() == nil || f.Dst.To4() == nil {
+		return errors.New("ipv4 header needs ipv4 addresses")
+	}
+
+	totalLen := f.TotalLen
+	if totalLen == 0 {
+		if len(b) > 0xffff {
+			return fmt.Errorf("buffer too long for ipv4 packet: %d bytes", len(b))
+		}
+		totalLen = uint16(len(b))
+	}
+
+	b[0] = 4<<4 | uint8(hl/4)
+	b.SetTOS(f.TOS)
+	b.SetTotalLen(totalLen)
+	b.SetID(f.ID)
+	b.SetFlagsFragmentOffset(f.Flags, f.FragmentOffset)
+	b.SetTTL(f.TTL)
+	b.SetProtocol(f.Protocol)
+	b.SetSrc(f.Src)
+	b.SetDst(f.Dst)
+	copy(b[IPv4MinLen:hl], f.Options)
+	b.ComputeChecksum()
+
+	return nil
+}
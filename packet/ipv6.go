@@ -0,0 +1,199 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// IPv6HeaderLen is the length of the fixed IPv6 header.
+const IPv6HeaderLen = 40
+
+// IP protocol numbers, also used as IPv6 next header values.
+const (
+	ProtocolHopByHop = 0
+	ProtocolICMP     = 1
+	ProtocolIPIP     = 4 // IPv4 encapsulated in IP.
+	ProtocolTCP      = 6
+	ProtocolUDP      = 17
+	ProtocolIPv6     = 41 // IPv6 encapsulated in IP.
+	ProtocolRouting  = 43
+	ProtocolFragment = 44
+	ProtocolGRE      = 47
+	ProtocolESP      = 50
+	ProtocolAH       = 51
+	ProtocolICMPv6   = 58
+	ProtocolNoNext   = 59
+	ProtocolDstOpts  = 60
+	ProtocolVRRP     = 112
+)
+
+// IPv6 is a view of an IPv6 packet, starting at its fixed header. Accessors read and setters write the underlying
+// buffer directly, so no copies are made; call Valid before using the accessors on untrusted input.
+type IPv6 []byte
+
+// IPv6Fields holds the values written by IPv6.Encode.
+type IPv6Fields struct {
+	TrafficClass uint8
+	FlowLabel    uint32
+	PayloadLen   uint16 // Zero means the length of the buffer after the fixed header.
+	NextHeader   uint8
+	HopLimit     uint8
+	Src          net.IP
+	Dst          net.IP
+}
+
+// Valid checks that the buffer is long enough to hold the fixed header, and the payload length it claims to have.
+func (b IPv6) Valid() error {
+	if len(b) < IPv6HeaderLen {
+		return fmt.Errorf("ipv6 header too short: %d bytes", len(b))
+	}
+	if b.Version() != 6 {
+		return fmt.Errorf("not ipv6: version %d", b.Version())
+	}
+	if pl := int(b.PayloadLen()); IPv6HeaderLen+pl > len(b) {
+		return fmt.Errorf("invalid ipv6 payload length %d for %d byte buffer", pl, len(b))
+	}
+	return nil
+}
+
+// Version returns the IP version, which is 6 for a valid packet.
+func (b IPv6) Version() int { return int(b[0] >> 4) }
+
+// TrafficClass returns the traffic class octet, holding the DSCP and ECN bits.
+func (b IPv6) TrafficClass() uint8 { return uint8(binary.BigEndian.Uint16(b) >> 4) }
+
+// SetTrafficClass sets the traffic class octet.
+func (b IPv6) SetTrafficClass(tc uint8) {
+	binary.BigEndian.PutUint16(b, binary.BigEndian.Uint16(b)&0xf00f|uint16(tc)<<4)
+}
+
+// FlowLabel returns the 20-bit flow label.
+func (b IPv6) FlowLabel() uint32 { return binary.BigEndian.Uint32(b) & 0xfffff }
+
+// SetFlowLabel sets the 20-bit flow label.
+func (b IPv6) SetFlowLabel(fl uint32) {
+	binary.BigEndian.PutUint32(b, binary.BigEndian.Uint32(b)&0xfff00000|fl&0xfffff)
+}
+
+// PayloadLen returns the length of the packet following the fixed header, including any extension headers.
+func (b IPv6) PayloadLen() uint16 { return binary.BigEndian.Uint16(b[4:]) }
+
+// SetPayloadLen sets the length of the packet following the fixed header.
+func (b IPv6) SetPayloadLen(l uint16) { binary.BigEndian.PutUint16(b[4:], l) }
+
+// NextHeader returns the type of the header following the fixed header.
+func (b IPv6) NextHeader() uint8 { return b[6] }
+
+// SetNextHeader sets the type of the header following the fixed header.
+func (b IPv6) SetNextHeader(nh uint8) { b[6] = nh }
+
+// HopLimit returns the hop limit.
+func (b IPv6) HopLimit() uint8 { return b[7] }
+
+// SetHopLimit sets the hop limit.
+func (b IPv6) SetHopLimit(hl uint8) { b[7] = hl }
+
+// Src returns the source address, referring to the underlying buffer.
+func (b IPv6) Src() net.IP { return net.IP(b[8:24]) }
+
+// SetSrc sets the source address.
+func (b IPv6) SetSrc(ip net.IP) { copy(b[8:24], ip.To16()) }
+
+// Dst returns the destination address, referring to the underlying buffer.
+func (b IPv6) Dst() net.IP { return net.IP(b[24:40]) }
+
+// SetDst sets the destination address.
+func (b IPv6) SetDst(ip net.IP) { copy(b[24:40], ip.To16()) }
+
+// Payload returns the data following the fixed header, up to the payload length, including any extension headers.
+func (b IPv6) Payload() []byte { return b[IPv6HeaderLen : IPv6HeaderLen+int(b.PayloadLen())] }
+
+// Encode writes the fixed header described by f into the start of the buffer.
+func (b IPv6) Encode(f *IPv6Fields) error {
+	if len(b) < IPv6HeaderLen {
+		return fmt.Errorf("buffer too short for ipv6 header: %d bytes", len(b))
+	}
+	if f.Src.To16() == nil || f.Dst.To16() == nil || f.Src.To4() != nil || f.Dst.To4() != nil {
+		return errors.New("ipv6 header needs ipv6 addresses")
+	}
+
+	payloadLen := f.PayloadLen
+	if payloadLen == 0 {
+		if len(b)-IPv6HeaderLen > 0xffff {
+			return fmt.Errorf("buffer too long for ipv6 packet: %d bytes", len(b))
+		}
+		payloadLen = uint16(len(b) - IPv6HeaderLen)
+	}
+
+	binary.BigEndian.PutUint32(b, 6<<28|uint32(f.TrafficClass)<<20|f.FlowLabel&0xfffff)
+	b.SetPayloadLen(payloadLen)
+	b.SetNextHeader(f.NextHeader)
+	b.SetHopLimit(f.HopLimit)
+	b.SetSrc(f.Src)
+	b.SetDst(f.Dst)
+
+	return nil
+}
+
+// ExtensionHeader is an IPv6 extension header, as found by IPv6.Extensions.
+type ExtensionHeader struct {
+	Type uint8  // The next header value that identified this header.
+	Data []byte // The whole header, including its next header and length octets.
+}
+
+// NextHeader returns the type of the header following this one.
+func (e ExtensionHeader) NextHeader() uint8 { return e.Data[0] }
+
+// IsExtensionHeader reports whether the next header value identifies an extension header that Extensions walks over.
+func IsExtensionHeader(nh uint8) bool {
+	switch nh {
+	case ProtocolHopByHop, ProtocolRouting, ProtocolFragment, ProtocolDstOpts, ProtocolAH:
+		return true
+	}
+	return false
+}
+
+// Extensions walks the extension headers following the fixed header, returning them along with the upper-layer
+// protocol and its payload. Only the first fragment of a fragmented packet contains the upper-layer header, so for
+// any other fragment the protocol is returned with a payload that is only part of the upper-layer data.
+func (b IPv6) Extensions() (headers []ExtensionHeader, protocol uint8, payload []byte, err error) {
+	next, rest := b.NextHeader(), b.Payload()
+	for IsExtensionHeader(next) {
+		if len(rest) < 8 {
+			return nil, 0, nil, fmt.Errorf("ipv6 extension header %d truncated", next)
+		}
+
+		var hl int
+		switch next {
+		case ProtocolFragment:
+			hl = 8
+		case ProtocolAH:
+			// The authentication header length is in 4-octet units, minus 2.
+			hl = (int(rest[1]) + 2) * 4
+		default:
+			hl = (int(rest[1]) + 1) * 8
+		}
+		if hl > len(rest) {
+			return nil, 0, nil, fmt.Errorf("ipv6 extension header %d truncated", next)
+		}
+
+		headers = append(headers, ExtensionHeader{Type: next, Data: rest[:hl]})
+		next, rest = rest[0], rest[hl:]
+	}
+
+	return headers, next, rest, nil
+}
+
+// IPv6Fragment is a view of an IPv6 fragment extension header.
+type IPv6Fragment []byte
+
+// FragmentOffset returns the offset of this fragment, in units of 8 octets.
+func (f IPv6Fragment) FragmentOffset() uint16 { return binary.BigEndian.Uint16(f[2:]) >> 3 }
+
+// MoreFragments reports whether further fragments follow this one.
+func (f IPv6Fragment) MoreFragments() bool { return f[3]&0x1 != 0 }
+
+// ID returns the identification shared by all fragments of a packet.
+func (f IPv6Fragment) ID() uint32 { return binary.BigEndian.Uint32(f[4:]) }
@@ -0,0 +1,191 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// MPLSLabelLen is the length of an MPLS label stack entry.
+const MPLSLabelLen = 4
+
+// Special-purpose MPLS labels, reserved by RFC 3032 and later RFCs. Labels up to MaxReservedLabel are reserved.
+const (
+	LabelIPv4ExplicitNull = 0  // The stack must be popped, and the packet forwarded as IPv4.
+	LabelRouterAlert      = 1  // The packet must be delivered to the local software.
+	LabelIPv6ExplicitNull = 2  // The stack must be popped, and the packet forwarded as IPv6.
+	LabelImplicitNull     = 3  // Only signalled, asking the upstream router to pop the stack; never on the wire.
+	LabelEntropyIndicator = 7  // The following label is an entropy label, RFC 6790.
+	LabelGAL              = 13 // Generic associated channel label, RFC 5586.
+	LabelOAMAlert         = 14 // RFC 3429.
+	LabelExtension        = 15 // The following label is an extended special-purpose label, RFC 7274.
+
+	MaxReservedLabel = 15
+	MaxLabel         = 1<<20 - 1
+)
+
+// labelNames holds the names of special-purpose labels.
+var labelNames = map[uint32]string{
+	LabelIPv4ExplicitNull: "ipv4-explicit-null",
+	LabelRouterAlert:      "router-alert",
+	LabelIPv6ExplicitNull: "ipv6-explicit-null",
+	LabelImplicitNull:     "implicit-null",
+	LabelEntropyIndicator: "entropy-label-indicator",
+	LabelGAL:              "gal",
+	LabelOAMAlert:         "oam-alert",
+	LabelExtension:        "extension",
+}
+
+// LabelName returns the name of a special-purpose label, such as "ipv4-explicit-null", "reserved" for other labels up
+// to MaxReservedLabel, or the label in decimal.
+func LabelName(label uint32) string {
+	if name, ok := labelNames[label]; ok {
+		return name
+	}
+	if label <= MaxReservedLabel {
+		return "reserved"
+	}
+	return strconv.FormatUint(uint64(label), 10)
+}
+
+// MPLSLabel is a single entry from an MPLS label stack.
+type MPLSLabel struct {
+	Label         uint32
+	TC            uint8 // Traffic class, formerly known as EXP.
+	BottomOfStack bool
+	TTL           uint8
+}
+
+// ParseMPLSLabel decodes a label stack entry.
+func ParseMPLSLabel(entry uint32) MPLSLabel {
+	return MPLSLabel{
+		Label:         entry >> 12,
+		TC:            uint8(entry>>9) & 0x7,
+		BottomOfStack: entry&0x100 != 0,
+		TTL:           uint8(entry),
+	}
+}
+
+// Entry returns the encoding of the label as a label stack entry.
+func (l MPLSLabel) Entry() uint32 {
+	entry := (l.Label&MaxLabel)<<12 | uint32(l.TC&0x7)<<9 | uint32(l.TTL)
+	if l.BottomOfStack {
+		entry |= 0x100
+	}
+	return entry
+}
+
+func (l MPLSLabel) String() string {
+	s := fmt.Sprintf("%s tc %d ttl %d", LabelName(l.Label), l.TC, l.TTL)
+	if l.BottomOfStack {
+		s += " bottom"
+	}
+	return s
+}
+
+// MPLS is a view of an MPLS label stack, starting at its top entry, as defined by RFC 3032. Accessors read and setters
+// write the top entry.
+type MPLS []byte
+
+// Valid checks that the buffer holds a label stack ending in an entry marked bottom of stack.
+func (b MPLS) Valid() error {
+	if _, err := b.stackLen(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// stackLen returns the length of the label stack in octets.
+func (b MPLS) stackLen() (int, error) {
+	for off := 0; off+MPLSLabelLen <= len(b); off += MPLSLabelLen {
+		if b[off+2]&0x01 != 0 {
+			return off + MPLSLabelLen, nil
+		}
+	}
+	return 0, fmt.Errorf("mpls label stack without bottom of stack in %d byte buffer", len(b))
+}
+
+// Label returns the label of the top entry.
+func (b MPLS) Label() uint32 { return binary.BigEndian.Uint32(b) >> 12 }
+
+// SetLabel sets the label of the top entry, as a label swap does.
+func (b MPLS) SetLabel(label uint32) {
+	binary.BigEndian.PutUint32(b, binary.BigEndian.Uint32(b)&0xfff|(label&MaxLabel)<<12)
+}
+
+// TC returns the traffic class of the top entry, formerly known as EXP.
+func (b MPLS) TC() uint8 { return b[2] >> 1 & 0x7 }
+
+// SetTC sets the traffic class of the top entry.
+func (b MPLS) SetTC(tc uint8) { b[2] = b[2]&0xf1 | (tc&0x7)<<1 }
+
+// BottomOfStack reports whether the top entry is the last of the stack.
+func (b MPLS) BottomOfStack() bool { return b[2]&0x01 != 0 }
+
+// TTL returns the TTL of the top entry.
+func (b MPLS) TTL() uint8 { return b[3] }
+
+// SetTTL sets the TTL of the top entry.
+func (b MPLS) SetTTL(ttl uint8) { b[3] = ttl }
+
+// DecrementTTL decrements the TTL of the top entry, returning false if it was already zero or one, when a router must
+// drop the packet rather than forward it.
+func (b MPLS) DecrementTTL() bool {
+	if b[3] <= 1 {
+		return false
+	}
+	b[3]--
+	return true
+}
+
+// Pop returns the stack below the top entry, or nil if the top entry is the bottom of the stack.
+func (b MPLS) Pop() MPLS {
+	if b.BottomOfStack() {
+		return nil
+	}
+	return b[MPLSLabelLen:]
+}
+
+// Labels decodes the entries of the stack, top first.
+func (b MPLS) Labels() ([]MPLSLabel, error) {
+	n, err := b.stackLen()
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]MPLSLabel, 0, n/MPLSLabelLen)
+	for off := 0; off < n; off += MPLSLabelLen {
+		labels = append(labels, ParseMPLSLabel(binary.BigEndian.Uint32(b[off:])))
+	}
+	return labels, nil
+}
+
+// Payload returns the data following the bottom of the stack.
+func (b MPLS) Payload() []byte {
+	n, err := b.stackLen()
+	if err != nil {
+		return nil
+	}
+	return b[n:]
+}
+
+// MPLSStackLen returns the length of a label stack of n entries.
+func MPLSStackLen(n int) int { return n * MPLSLabelLen }
+
+// Encode writes a label stack of labels, top first, into the start of the buffer. The last label is marked the bottom
+// of the stack and the others are not, whatever their BottomOfStack fields hold.
+func (b MPLS) Encode(labels []MPLSLabel) error {
+	if len(labels) == 0 {
+		return fmt.Errorf("empty mpls label stack")
+	}
+	if len(b) < MPLSStackLen(len(labels)) {
+		return fmt.Errorf("buffer too short for mpls label stack: %d bytes", len(b))
+	}
+	for i, l := range labels {
+		if l.Label > MaxLabel {
+			return fmt.Errorf("mpls label %d larger than 20 bits", l.Label)
+		}
+		l.BottomOfStack = i == len(labels)-1
+		binary.BigEndian.PutUint32(b[i*MPLSLabelLen:], l.Entry())
+	}
+	return nil
+}
@@ -0,0 +1,651 @@
+package packet
+
+import (
+	"encoding/hex"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIPv4Checksum(t *testing.T) {
+	// A well-known example header, whose checksum is 0xb861.
+	b, _ := hex.DecodeString("450000730000400040110000c0a80001c0a800c7")
+	hdr := IPv4(append(b, make([]byte, 0x73-len(b))...))
+	if err := hdr.Valid(); err != nil {
+		t.Fatalf("valid err: %v", err)
+	}
+	hdr.ComputeChecksum()
+	if got := hdr.Checksum(); got != 0xb861 {
+		t.Fatalf("checksum: got %04x, want b861", got)
+	}
+	if !hdr.VerifyChecksum() {
+		t.Fatalf("checksum did not verify")
+	}
+
+	// Decrementing the TTL all the way down should keep the checksum correct at every step.
+	for hdr.TTL() > 0 {
+		if !hdr.DecrementTTL() || !hdr.VerifyChecksum() {
+			t.Fatalf("checksum did not verify with ttl %d", hdr.TTL())
+		}
+	}
+	if hdr.DecrementTTL() {
+		t.Fatalf("decremented ttl past zero")
+	}
+}
+
+func TestIPv4TCP(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.1"), net.ParseIP("198.51.100.2")
+	opts := []TCPOption{
+		{Kind: TCPOptionMSS, Data: []byte{0x05, 0xb4}},
+		{Kind: TCPOptionSACKPermitted},
+		{Kind: TCPOptionWindowScale, Data: []byte{7}},
+	}
+	payload := []byte("hello")
+
+	// The options need padding to a multiple of four octets, taking the TCP header to 32 octets.
+	buf := make([]byte, IPv4MinLen+TCPMinLen+12+len(payload))
+	copy(buf[IPv4MinLen+TCPMinLen+12:], payload)
+	seg := TCP(buf[IPv4MinLen:])
+	if err := seg.Encode(&TCPFields{
+		SrcPort: 49152,
+		DstPort: 443,
+		Seq:     0xdeadbeef,
+		Flags:   TCPFlagSYN | TCPFlagECE | TCPFlagCWR,
+		Window:  64240,
+		Options: AppendTCPOptions(nil, opts),
+	}, src, dst); err != nil {
+		t.Fatalf("tcp encode err: %v", err)
+	}
+	ip := IPv4(buf)
+	if err := ip.Encode(&IPv4Fields{
+		ID:       1,
+		Flags:    IPv4DontFragment,
+		TTL:      64,
+		Protocol: ProtocolTCP,
+		Src:      src,
+		Dst:      dst,
+	}); err != nil {
+		t.Fatalf("ip encode err: %v", err)
+	}
+
+	// Now decode it all again.
+	if err := ip.Valid(); err != nil {
+		t.Fatalf("ip valid err: %v", err)
+	}
+	if !ip.VerifyChecksum() || !ip.Src().Equal(src) || !ip.Dst().Equal(dst) || ip.TTL() != 64 ||
+		ip.Flags() != IPv4DontFragment || ip.Protocol() != ProtocolTCP {
+		t.Fatalf("unexpected ip header: %x", buf[:IPv4MinLen])
+	}
+	got := TCP(ip.Payload())
+	if err := got.Valid(); err != nil {
+		t.Fatalf("tcp valid err: %v", err)
+	}
+	if !got.VerifyChecksum(ip.Src(), ip.Dst()) {
+		t.Fatalf("tcp checksum did not verify")
+	}
+	if got.SrcPort() != 49152 || got.DstPort() != 443 || got.Seq() != 0xdeadbeef || got.HeaderLen() != 32 ||
+		got.Flags() != TCPFlagSYN|TCPFlagECE|TCPFlagCWR || got.Window() != 64240 {
+		t.Fatalf("unexpected tcp header: %x", []byte(got[:got.HeaderLen()]))
+	}
+	if string(got.Payload()) != "hello" {
+		t.Fatalf("payload: got %q", got.Payload())
+	}
+	gotOpts, err := ParseTCPOptions(got.Options())
+	if err != nil {
+		t.Fatalf("options err: %v", err)
+	}
+	// A nil and an empty option value are equivalent.
+	opts[1].Data = []byte{}
+	if diff := cmp.Diff(opts, gotOpts); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// Corrupting the payload should break the checksum.
+	got.Payload()[0] ^= 0xff
+	if got.VerifyChecksum(ip.Src(), ip.Dst()) {
+		t.Fatalf("tcp checksum verified despite corruption")
+	}
+}
+
+func TestIPv6ExtensionsUDP(t *testing.T) {
+	src, dst := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	payload := []byte("query")
+
+	// Fixed header, then a hop-by-hop options header padded to 8 octets, then a fragment header, then UDP.
+	buf := make([]byte, IPv6HeaderLen+8+8+UDPHeaderLen+len(payload))
+	hbh := buf[IPv6HeaderLen:]
+	hbh[0] = ProtocolFragment
+	hbh[2], hbh[3] = 1, 4 // PadN option filling the rest of the header.
+	frag := buf[IPv6HeaderLen+8:]
+	frag[0] = ProtocolUDP
+	frag[4], frag[5], frag[6], frag[7] = 0, 0, 0x12, 0x34
+	udpBuf := UDP(buf[IPv6HeaderLen+16:])
+	copy(udpBuf[UDPHeaderLen:], payload)
+	if err := udpBuf.Encode(&UDPFields{SrcPort: 5353, DstPort: 53}, src, dst); err != nil {
+		t.Fatalf("udp encode err: %v", err)
+	}
+	ip := IPv6(buf)
+	if err := ip.Encode(&IPv6Fields{
+		TrafficClass: 0xb8,
+		FlowLabel:    0x12345,
+		NextHeader:   ProtocolHopByHop,
+		HopLimit:     255,
+		Src:          src,
+		Dst:          dst,
+	}); err != nil {
+		t.Fatalf("ip encode err: %v", err)
+	}
+
+	if err := ip.Valid(); err != nil {
+		t.Fatalf("valid err: %v", err)
+	}
+	if ip.TrafficClass() != 0xb8 || ip.FlowLabel() != 0x12345 || ip.HopLimit() != 255 {
+		t.Fatalf("unexpected ipv6 header: %x", buf[:IPv6HeaderLen])
+	}
+	headers, proto, rest, err := ip.Extensions()
+	if err != nil {
+		t.Fatalf("extensions err: %v", err)
+	}
+	if len(headers) != 2 || headers[0].Type != ProtocolHopByHop || headers[1].Type != ProtocolFragment ||
+		proto != ProtocolUDP {
+		t.Fatalf("unexpected extension headers %+v, protocol %d", headers, proto)
+	}
+	if id := IPv6Fragment(headers[1].Data).ID(); id != 0x1234 {
+		t.Fatalf("fragment id: got %x, want 1234", id)
+	}
+
+	got := UDP(rest)
+	if err := got.Valid(); err != nil {
+		t.Fatalf("udp valid err: %v", err)
+	}
+	if !got.VerifyChecksum(src, dst) || got.SrcPort() != 5353 || got.DstPort() != 53 ||
+		string(got.Payload()) != "query" {
+		t.Fatalf("unexpected udp datagram: %x", []byte(got))
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	tests := map[string]interface{ Valid() error }{
+		"ShortIPv4":      IPv4(make([]byte, 10)),
+		"WrongVersion":   IPv4(append([]byte{0x65}, make([]byte, 19)...)),
+		"IPv4TotalLen":   IPv4(append([]byte{0x45, 0, 0xff, 0xff}, make([]byte, 16)...)),
+		"ShortIPv6":      IPv6(make([]byte, 39)),
+		"IPv6PayloadLen": IPv6(append([]byte{0x60, 0, 0, 0, 0, 1}, make([]byte, 34)...)),
+		"TCPHeaderLen":   TCP(append(make([]byte, 12), append([]byte{0xf0}, make([]byte, 7)...)...)),
+		"UDPLength":      UDP([]byte{0, 1, 0, 2, 0, 4, 0, 0}),
+		"ShortEthernet":  Ethernet(make([]byte, 13)),
+		"GREVersion":     GRE([]byte{0, 1, 0x08, 0}),
+		"GRERouting":     GRE([]byte{0x40, 0, 0x08, 0}),
+		"GREKeyMissing":  GRE([]byte{GREFlagKey, 0, 0x08, 0}),
+		"VXLANFlags":     VXLAN(make([]byte, 8)),
+		"GeneveVersion":  Geneve(append([]byte{0x40}, make([]byte, 7)...)),
+		"GeneveOptLen":   Geneve(append([]byte{0x01}, make([]byte, 7)...)),
+		"MPLSNoBottom":   MPLS([]byte{0, 1, 0, 64, 0, 2, 0, 64, 0}),
+		"VRRPVersion":    VRRP(append([]byte{0x41, 1, 100, 0}, make([]byte, 4)...)),
+		"VRRPAddresses":  VRRP(append([]byte{0x31, 1, 100, 2}, make([]byte, 8)...)),
+		"HSRPVersion":    HSRP(append([]byte{1}, make([]byte, 19)...)),
+		"BFDVersion":     BFD(append([]byte{0x40, 0xc0, 3, 24, 0, 0, 0, 1}, make([]byte, 16)...)),
+		"BFDLength":      BFD(append([]byte{0x20, 0x40, 3, 30, 0, 0, 0, 1}, make([]byte, 16)...)),
+		"SRHType":        SRH([]byte{0, 2, 0, 0, 0, 0, 0, 0}),
+		"SRHShort":       SRH([]byte{0, 2, 4, 0, 0, 0, 0, 0}),
+		"SRHLastEntry":   SRH(append([]byte{0, 2, 4, 0, 1, 0, 0, 0}, make([]byte, 16)...)),
+		"SRHLeft":        SRH(append([]byte{0, 2, 4, 1, 0, 0, 0, 0}, make([]byte, 16)...)),
+	}
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := v.Valid(); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestGRE(t *testing.T) {
+	// IPv4 in GRE with a checksum, key, and sequence number, in IPv4.
+	outerSrc, outerDst := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	innerSrc, innerDst := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	buf := make([]byte, IPv4MinLen+GREMinLen+12+IPv4MinLen+UDPHeaderLen)
+	inner := IPv4(buf[IPv4MinLen+GREMinLen+12:])
+	if err := UDP(inner[IPv4MinLen:]).Encode(&UDPFields{SrcPort: 1, DstPort: 2}, innerSrc, innerDst); err != nil {
+		t.Fatalf("udp encode err: %v", err)
+	}
+	if err := inner.Encode(&IPv4Fields{TTL: 64, Protocol: ProtocolUDP, Src: innerSrc, Dst: innerDst}); err != nil {
+		t.Fatalf("inner encode err: %v", err)
+	}
+	gre := GRE(buf[IPv4MinLen:])
+	if err := gre.Encode(&GREFields{
+		Protocol:    EtherTypeIPv4,
+		Checksum:    true,
+		HasKey:      true,
+		Key:         0xcafe,
+		HasSequence: true,
+		Sequence:    7,
+	}); err != nil {
+		t.Fatalf("gre encode err: %v", err)
+	}
+	outer := IPv4(buf)
+	if err := outer.Encode(&IPv4Fields{TTL: 64, Protocol: ProtocolGRE, Src: outerSrc, Dst: outerDst}); err != nil {
+		t.Fatalf("outer encode err: %v", err)
+	}
+
+	got := GRE(outer.Payload())
+	if err := got.Valid(); err != nil {
+		t.Fatalf("gre valid err: %v", err)
+	}
+	key, hasKey := got.Key()
+	seq, hasSeq := got.Sequence()
+	if !got.VerifyChecksum() || got.Protocol() != EtherTypeIPv4 || got.HeaderLen() != 16 || !hasKey ||
+		key != 0xcafe || !hasSeq || seq != 7 {
+		t.Fatalf("unexpected gre header: %x", []byte(got[:16]))
+	}
+	if ip := IPv4(got.Payload()); ip.Valid() != nil || !ip.Dst().Equal(innerDst) {
+		t.Fatalf("unexpected inner packet: %x", got.Payload())
+	}
+	got.Payload()[0] ^= 0xff
+	if got.VerifyChecksum() {
+		t.Fatalf("gre checksum verified despite corruption")
+	}
+
+	// A key alone follows the fixed header directly.
+	plain := GRE(make([]byte, 8))
+	if err := plain.Encode(&GREFields{Protocol: EtherTypeTransparentEthernet, HasKey: true, Key: 42}); err != nil {
+		t.Fatalf("gre encode err: %v", err)
+	}
+	if key, _ := plain.Key(); key != 42 || plain.HasChecksum() || plain.HasSequence() || !plain.VerifyChecksum() {
+		t.Fatalf("unexpected gre header: %x", []byte(plain))
+	}
+}
+
+func TestVXLAN(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	innerSrc, _ := net.ParseMAC("02:00:00:00:00:01")
+	innerDst, _ := net.ParseMAC("02:00:00:00:00:02")
+	buf := make([]byte, IPv4MinLen+UDPHeaderLen+VXLANHeaderLen+EthernetHeaderLen+4)
+	frame := Ethernet(buf[IPv4MinLen+UDPHeaderLen+VXLANHeaderLen:])
+	if err := frame.Encode(&EthernetFields{Dst: innerDst, Src: innerSrc, EtherType: EtherTypeARP}); err != nil {
+		t.Fatalf("ethernet encode err: %v", err)
+	}
+	if err := VXLAN(buf[IPv4MinLen+UDPHeaderLen:]).Encode(0x123456); err != nil {
+		t.Fatalf("vxlan encode err: %v", err)
+	}
+	udp := UDP(buf[IPv4MinLen:])
+	if err := udp.Encode(&UDPFields{SrcPort: 49152, DstPort: VXLANPort}, src, dst); err != nil {
+		t.Fatalf("udp encode err: %v", err)
+	}
+	if err := IPv4(buf).Encode(&IPv4Fields{TTL: 64, Protocol: ProtocolUDP, Src: src, Dst: dst}); err != nil {
+		t.Fatalf("ip encode err: %v", err)
+	}
+
+	got := VXLAN(UDP(IPv4(buf).Payload()).Payload())
+	if err := got.Valid(); err != nil {
+		t.Fatalf("vxlan valid err: %v", err)
+	}
+	if got.VNI() != 0x123456 {
+		t.Fatalf("vni: got %x, want 123456", got.VNI())
+	}
+	eth := Ethernet(got.Payload())
+	if eth.Valid() != nil || eth.Src().String() != innerSrc.String() || eth.Dst().String() != innerDst.String() ||
+		eth.EtherType() != EtherTypeARP || len(eth.Payload()) != 4 {
+		t.Fatalf("unexpected inner frame: %x", got.Payload())
+	}
+	if err := VXLAN(make([]byte, 8)).Encode(1 << 24); err == nil {
+		t.Fatalf("encoded a vni larger than 24 bits")
+	}
+}
+
+func TestGeneve(t *testing.T) {
+	opts := []GeneveOption{
+		{Class: 0x0102, Type: 0x80, Data: []byte{1, 2, 3, 4}},
+		{Class: 0xffff, Type: 1, Data: []byte{}},
+	}
+	encoded := AppendGeneveOptions(nil, opts)
+	buf := make([]byte, GeneveMinLen+len(encoded)+2)
+	copy(buf[GeneveMinLen+len(encoded):], "hi")
+	b := Geneve(buf)
+	if err := b.Encode(&GeneveFields{
+		Flags:    GeneveFlagCritical,
+		Protocol: EtherTypeTransparentEthernet,
+		VNI:      0xabcdef,
+		Options:  encoded,
+	}); err != nil {
+		t.Fatalf("geneve encode err: %v", err)
+	}
+
+	if err := b.Valid(); err != nil {
+		t.Fatalf("geneve valid err: %v", err)
+	}
+	if b.HeaderLen() != 20 || b.Flags() != GeneveFlagCritical || b.Protocol() != EtherTypeTransparentEthernet ||
+		b.VNI() != 0xabcdef || string(b.Payload()) != "hi" {
+		t.Fatalf("unexpected geneve header: %x", []byte(b))
+	}
+	got, err := ParseGeneveOptions(b.Options())
+	if err != nil {
+		t.Fatalf("options err: %v", err)
+	}
+	if diff := cmp.Diff(opts, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// Data is padded to a multiple of four octets.
+	if got := AppendGeneveOptions(nil, []GeneveOption{{Class: 1, Type: 2, Data: []byte{9}}}); len(got) != 8 {
+		t.Fatalf("got %d octets, want 8", len(got))
+	}
+	if _, err := ParseGeneveOptions([]byte{0, 1, 2, 1}); err == nil {
+		t.Fatalf("parsed a truncated option")
+	}
+	if err := b.Encode(&GeneveFields{Options: []byte{1, 2}}); err == nil {
+		t.Fatalf("encoded options that are not a multiple of four octets")
+	}
+}
+
+func TestSRH(t *testing.T) {
+	segs := []net.IP{net.ParseIP("2001:db8:1::1"), net.ParseIP("2001:db8:2::1"), net.ParseIP("2001:db8:3::100")}
+	tlvs := []SRHTLV{{Type: 5, Value: []byte{1, 2, 3}}}
+	encoded := AppendSRHTLVs(nil, tlvs)
+	if len(encoded) != 8 {
+		t.Fatalf("got %d octets of tlvs, want 8", len(encoded))
+	}
+
+	// IPv6 with a segment routing header, carrying UDP.
+	src := net.ParseIP("2001:db8::1")
+	hl := SRHLen(len(segs), len(encoded))
+	buf := make([]byte, IPv6HeaderLen+hl+UDPHeaderLen)
+	srh := SRH(buf[IPv6HeaderLen:])
+	if err := srh.Encode(&SRHFields{
+		NextHeader:   ProtocolUDP,
+		Segments:     segs,
+		SegmentsLeft: 2,
+		Tag:          7,
+		TLVs:         encoded,
+	}); err != nil {
+		t.Fatalf("srh encode err: %v", err)
+	}
+	ip := IPv6(buf)
+	if err := ip.Encode(&IPv6Fields{NextHeader: ProtocolRouting, HopLimit: 64, Src: src, Dst: segs[0]}); err != nil {
+		t.Fatalf("ip encode err: %v", err)
+	}
+	headers, proto, _, err := ip.Extensions()
+	if err != nil || len(headers) != 1 || headers[0].Type != ProtocolRouting || proto != ProtocolUDP {
+		t.Fatalf("got extension headers %+v, protocol %d, err %v", headers, proto, err)
+	}
+
+	got := SRH(headers[0].Data)
+	if err := got.Valid(); err != nil {
+		t.Fatalf("srh valid err: %v", err)
+	}
+	if got.HeaderLen() != hl || got.LastEntry() != 2 || got.SegmentsLeft() != 2 || got.Tag() != 7 ||
+		!got.ActiveSegment().Equal(segs[0]) || !got.Segment(0).Equal(segs[2]) {
+		t.Fatalf("unexpected segment routing header: %x", []byte(got))
+	}
+	if diff := cmp.Diff(segs, got.Segments()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	gotTLVs, err := ParseSRHTLVs(got.TLVs())
+	if err != nil {
+		t.Fatalf("tlvs err: %v", err)
+	}
+	if diff := cmp.Diff(tlvs, gotTLVs); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// Each endpoint advances to the next segment, until none are left.
+	for _, want := range segs[1:] {
+		if next := got.Advance(); !next.Equal(want) {
+			t.Fatalf("advanced to %v, want %v", next, want)
+		}
+	}
+	if next := got.Advance(); next != nil || got.SegmentsLeft() != 0 {
+		t.Fatalf("advanced beyond the last segment to %v", next)
+	}
+
+	if got := AppendSRHTLVs(nil, []SRHTLV{{Type: 5, Value: make([]byte, 5)}}); len(got) != 8 || got[7] != SRHTLVPad1 {
+		t.Fatalf("got tlvs %x, want one octet of padding", got)
+	}
+	if _, err := ParseSRHTLVs([]byte{5, 4, 1}); err == nil {
+		t.Fatalf("parsed a truncated tlv")
+	}
+	for name, f := range map[string]*SRHFields{
+		"NoSegments":   {},
+		"SegmentsLeft": {Segments: segs, SegmentsLeft: 3},
+		"IPv4":         {Segments: []net.IP{net.ParseIP("192.0.2.1")}},
+		"TLVPadding":   {Segments: segs, TLVs: []byte{5, 0}},
+	} {
+		if err := srh.Encode(f); err == nil {
+			t.Fatalf("%s: encoded an invalid header", name)
+		}
+	}
+}
+
+func TestMPLS(t *testing.T) {
+	labels := []MPLSLabel{
+		{Label: 16004, TC: 5, TTL: 64, BottomOfStack: true},
+		{Label: LabelEntropyIndicator, TTL: 0},
+		{Label: 299792, TC: 7, TTL: 255},
+	}
+	buf := make([]byte, MPLSStackLen(len(labels))+IPv4MinLen)
+	copy(buf[MPLSStackLen(len(labels)):], []byte{0x45})
+	b := MPLS(buf)
+	if err := b.Encode(labels); err != nil {
+		t.Fatalf("mpls encode err: %v", err)
+	}
+	if err := b.Valid(); err != nil {
+		t.Fatalf("mpls valid err: %v", err)
+	}
+	got, err := b.Labels()
+	if err != nil {
+		t.Fatalf("labels err: %v", err)
+	}
+	// Only the last label is marked the bottom of the stack.
+	want := []MPLSLabel{
+		{Label: 16004, TC: 5, TTL: 64},
+		{Label: LabelEntropyIndicator},
+		{Label: 299792, TC: 7, TTL: 255, BottomOfStack: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if len(b.Payload()) != IPv4MinLen || b.Payload()[0] != 0x45 {
+		t.Fatalf("unexpected payload %x", b.Payload())
+	}
+	if b.Label() != 16004 || b.TC() != 5 || b.TTL() != 64 || b.BottomOfStack() {
+		t.Fatalf("unexpected top entry %x", buf[:4])
+	}
+
+	// Swap the top label, and decrement its TTL.
+	b.SetLabel(24001)
+	b.SetTC(1)
+	if !b.DecrementTTL() || b.Label() != 24001 || b.TC() != 1 || b.TTL() != 63 {
+		t.Fatalf("unexpected top entry after swap %x", buf[:4])
+	}
+	b.SetTTL(1)
+	if b.DecrementTTL() {
+		t.Fatalf("decremented a ttl of one")
+	}
+
+	// Pop down to the bottom of the stack.
+	bottom := b.Pop().Pop()
+	if bottom.Label() != 299792 || !bottom.BottomOfStack() || bottom.Pop() != nil {
+		t.Fatalf("unexpected bottom entry %x", []byte(bottom))
+	}
+
+	if err := b.Encode([]MPLSLabel{{Label: MaxLabel + 1}}); err == nil {
+		t.Fatalf("encoded a label larger than 20 bits")
+	}
+	if err := b.Encode(nil); err == nil {
+		t.Fatalf("encoded an empty stack")
+	}
+
+	for label, want := range map[uint32]string{
+		LabelIPv4ExplicitNull: "ipv4-explicit-null",
+		LabelImplicitNull:     "implicit-null",
+		LabelGAL:              "gal",
+		4:                     "reserved",
+		16004:                 "16004",
+	} {
+		if got := LabelName(label); got != want {
+			t.Fatalf("label %d: got name %q, want %q", label, got, want)
+		}
+	}
+	if got := want[2].String(); got != "299792 tc 7 ttl 255 bottom" {
+		t.Fatalf("got %q", got)
+	}
+	if entry := want[2].Entry(); ParseMPLSLabel(entry) != want[2] || entry != 299792<<12|7<<9|0x100|255 {
+		t.Fatalf("got entry %x", entry)
+	}
+}
+
+func TestVRRP(t *testing.T) {
+	tests := map[string]struct {
+		fields   VRRPFields
+		src, dst net.IP
+	}{
+		"Version2": {
+			fields: VRRPFields{Version: 2, VRID: 10, Priority: 100, AdvertInterval: time.Second,
+				Addresses: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}},
+			src: net.ParseIP("192.0.2.3"),
+			dst: net.ParseIP("224.0.0.18"),
+		},
+		"Version3IPv6": {
+			fields: VRRPFields{Version: 3, VRID: 20, Priority: VRRPPriorityOwner, AdvertInterval: 50 * time.Millisecond,
+				Addresses: []net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::1")}},
+			src: net.ParseIP("fe80::2"),
+			dst: net.ParseIP("ff02::12"),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ipv6 := test.src.To4() == nil
+			b := VRRP(make([]byte, VRRPLen(test.fields.Version, len(test.fields.Addresses), ipv6)))
+			if err := b.Encode(&test.fields, test.src, test.dst); err != nil {
+				t.Fatalf("vrrp encode err: %v", err)
+			}
+			if err := b.Valid(); err != nil {
+				t.Fatalf("vrrp valid err: %v", err)
+			}
+			if b.Version() != test.fields.Version || b.VRID() != test.fields.VRID ||
+				b.Priority() != test.fields.Priority || b.AdvertInterval() != test.fields.AdvertInterval ||
+				!b.VerifyChecksum(test.src, test.dst) {
+				t.Fatalf("unexpected vrrp advertisement: %x", []byte(b))
+			}
+			var got []string
+			for _, addr := range b.Addresses(ipv6) {
+				got = append(got, addr.String())
+			}
+			var want []string
+			for _, addr := range test.fields.Addresses {
+				want = append(want, addr.String())
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			b.SetPriority(VRRPPriorityRelease)
+			if b.VerifyChecksum(test.src, test.dst) {
+				t.Fatalf("checksum still verifies after changing the priority")
+			}
+		})
+	}
+
+	b := VRRP(make([]byte, 64))
+	for name, f := range map[string]*VRRPFields{
+		"Version":    {Version: 1, Addresses: []net.IP{net.ParseIP("192.0.2.1")}, AdvertInterval: time.Second},
+		"NoAddress":  {Version: 3, AdvertInterval: time.Second},
+		"V2IPv6":     {Version: 2, Addresses: []net.IP{net.ParseIP("2001:db8::1")}, AdvertInterval: time.Second},
+		"Mixed":      {Version: 3, Addresses: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}},
+		"V2Interval": {Version: 2, Addresses: []net.IP{net.ParseIP("192.0.2.1")}, AdvertInterval: time.Millisecond},
+	} {
+		if err := b.Encode(f, net.ParseIP("192.0.2.3"), net.ParseIP("224.0.0.18")); err == nil {
+			t.Fatalf("%s: encoded an invalid advertisement", name)
+		}
+	}
+}
+
+func TestHSRP(t *testing.T) {
+	b := HSRP(make([]byte, HSRPHeaderLen))
+	if err := b.Encode(&HSRPFields{
+		OpCode:    HSRPOpHello,
+		State:     HSRPActive,
+		HelloTime: 3 * time.Second,
+		HoldTime:  10 * time.Second,
+		Priority:  110,
+		Group:     1,
+		Auth:      HSRPDefaultAuth,
+		VirtualIP: net.ParseIP("192.0.2.254"),
+	}); err != nil {
+		t.Fatalf("hsrp encode err: %v", err)
+	}
+	want := []byte{0, 0, 16, 3, 10, 110, 1, 0, 'c', 'i', 's', 'c', 'o', 0, 0, 0, 192, 0, 2, 254}
+	if diff := cmp.Diff(want, []byte(b)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if err := b.Valid(); err != nil {
+		t.Fatalf("hsrp valid err: %v", err)
+	}
+	if b.OpCode() != HSRPOpHello || b.State() != HSRPActive || b.State().String() != "active" ||
+		b.HelloTime() != 3*time.Second || b.HoldTime() != 10*time.Second || b.Priority() != 110 || b.Group() != 1 ||
+		string(b.Auth()[:5]) != "cisco" || !b.VirtualIP().Equal(net.ParseIP("192.0.2.254")) {
+		t.Fatalf("unexpected hsrp message: %x", []byte(b))
+	}
+	if got := HSRPState(3).String(); got != "HSRPState(3)" {
+		t.Fatalf("got %q", got)
+	}
+	if err := b.Encode(&HSRPFields{HelloTime: 1500 * time.Millisecond}); err == nil {
+		t.Fatalf("encoded a hello time that is not whole seconds")
+	}
+	if err := b.Encode(&HSRPFields{VirtualIP: net.ParseIP("2001:db8::1")}); err == nil {
+		t.Fatalf("encoded an ipv6 virtual address")
+	}
+}
+
+func TestBFD(t *testing.T) {
+	auth := []byte{1, 7, 1, 'p', 'a', 's', 's'} // Simple password authentication, key 1.
+	b := BFD(make([]byte, BFDHeaderLen+len(auth)))
+	if err := b.Encode(&BFDFields{
+		Diag:              BFDDiagControlDetectExpired,
+		State:             BFDUp,
+		Flags:             BFDFlagPoll,
+		DetectMult:        3,
+		MyDiscriminator:   0x11223344,
+		YourDiscriminator: 0x55667788,
+		DesiredMinTx:      300 * time.Millisecond,
+		RequiredMinRx:     300 * time.Millisecond,
+		Auth:              auth,
+	}); err != nil {
+		t.Fatalf("bfd encode err: %v", err)
+	}
+	if err := b.Valid(); err != nil {
+		t.Fatalf("bfd valid err: %v", err)
+	}
+	if b.Version() != 1 || b.Diag() != BFDDiagControlDetectExpired || b.State() != BFDUp ||
+		b.Flags() != BFDFlagPoll|BFDFlagAuth || b.DetectMult() != 3 || b.Length() != 31 ||
+		b.MyDiscriminator() != 0x11223344 || b.YourDiscriminator() != 0x55667788 ||
+		b.DesiredMinTx() != 300*time.Millisecond || b.RequiredMinRx() != 300*time.Millisecond ||
+		b.RequiredMinEchoRx() != 0 || string(b.Auth()) != string(auth) {
+		t.Fatalf("unexpected bfd control packet: %x", []byte(b))
+	}
+	if b.State().String() != "up" || b.Diag().String() != "control-detection-time-expired" {
+		t.Fatalf("got state %v, diag %v", b.State(), b.Diag())
+	}
+
+	invalid := map[string]*BFDFields{
+		"NoDetectMult":      {State: BFDDown, MyDiscriminator: 1},
+		"NoDiscriminator":   {State: BFDDown, DetectMult: 3},
+		"UpWithoutYours":    {State: BFDUp, DetectMult: 3, MyDiscriminator: 1},
+		"MultipointFlagSet": {State: BFDDown, Flags: BFDFlagMultipoint, DetectMult: 3, MyDiscriminator: 1},
+	}
+	for name, f := range invalid {
+		b := BFD(make([]byte, BFDHeaderLen))
+		if err := b.Encode(f); err != nil {
+			t.Fatalf("%s: encode err: %v", name, err)
+		}
+		if err := b.Valid(); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if err := b.Encode(&BFDFields{State: 4}); err == nil {
+		t.Fatalf("encoded an invalid state")
+	}
+	if err := b.Encode(&BFDFields{DesiredMinTx: -time.Second}); err == nil {
+		t.Fatalf("encoded a negative interval")
+	}
+}
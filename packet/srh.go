@@ -0,0 +1,199 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// SRHMinLen is the length of a segment routing header without segments or TLVs.
+const SRHMinLen = 8
+
+// RoutingTypeSRH is the routing type of a segment routing header, in a routing extension header.
+const RoutingTypeSRH = 4
+
+// SRH is a view of an IPv6 segment routing header, starting at its next header octet, as defined by RFC 8754. The
+// segment list is held in reverse: the first entry is the last segment of the path.
+type SRH []byte
+
+// SRHFields holds the values written by SRH.Encode.
+type SRHFields struct {
+	NextHeader uint8
+	// The segments of the path, in the order they are visited, which is the reverse of that of the segment list. The
+	// first is normally also the destination of the IPv6 header.
+	Segments []net.IP
+	// The number of segments still to be visited, which is normally len(Segments)-1, as the first segment is the
+	// destination of the IPv6 header.
+	SegmentsLeft uint8
+	Flags        uint8
+	Tag          uint16
+	TLVs         []byte // Must make the header a multiple of 8 octets long, padded as RFC 8754 describes.
+}
+
+// SRHLen returns the length of a segment routing header with a number of segments and octets of TLVs.
+func SRHLen(segments, tlvLen int) int { return SRHMinLen + segments*net.IPv6len + tlvLen }
+
+// Valid checks that the buffer is long enough to hold the header it claims to have, that it is a segment routing
+// header, and that its last entry and segments left fit in its segment list.
+func (b SRH) Valid() error {
+	if len(b) < SRHMinLen {
+		return fmt.Errorf("segment routing header too short: %d bytes", len(b))
+	}
+	if t := b.RoutingType(); t != RoutingTypeSRH {
+		return fmt.Errorf("routing type %d is not a segment routing header", t)
+	}
+	hl := b.HeaderLen()
+	if hl > len(b) {
+		return fmt.Errorf("segment routing header length %d longer than %d byte buffer", hl, len(b))
+	}
+	if n := int(b.LastEntry()) + 1; SRHLen(n, 0) > hl {
+		return fmt.Errorf("segment routing header of %d bytes too short for %d segments", hl, n)
+	}
+	if b.SegmentsLeft() > b.LastEntry() {
+		return fmt.Errorf("segments left %d beyond last entry %d", b.SegmentsLeft(), b.LastEntry())
+	}
+	return nil
+}
+
+// NextHeader returns the type of the header following this one.
+func (b SRH) NextHeader() uint8 { return b[0] }
+
+// HeaderLen returns the length of the header, including segments and TLVs, in octets.
+func (b SRH) HeaderLen() int { return (int(b[1]) + 1) * 8 }
+
+// RoutingType returns the routing type, which is RoutingTypeSRH for a segment routing header.
+func (b SRH) RoutingType() uint8 { return b[2] }
+
+// SegmentsLeft returns the number of segments still to be visited.
+func (b SRH) SegmentsLeft() uint8 { return b[3] }
+
+// SetSegmentsLeft sets the number of segments still to be visited.
+func (b SRH) SetSegmentsLeft(n uint8) { b[3] = n }
+
+// LastEntry returns the index of the last entry of the segment list, which holds the first segment of the path.
+func (b SRH) LastEntry() uint8 { return b[4] }
+
+// Flags returns the flags.
+func (b SRH) Flags() uint8 { return b[5] }
+
+// Tag returns the tag, marking packets as part of a class or group.
+func (b SRH) Tag() uint16 { return binary.BigEndian.Uint16(b[6:]) }
+
+// Segment returns entry i of the segment list, referring to the underlying buffer. Entry 0 is the last segment of the
+// path.
+func (b SRH) Segment(i int) net.IP {
+	off := SRHMinLen + i*net.IPv6len
+	return net.IP(b[off : off+net.IPv6len])
+}
+
+// ActiveSegment returns the segment being visited, the entry indexed by segments left, which the destination of the
+// IPv6 header should hold.
+func (b SRH) ActiveSegment() net.IP { return b.Segment(int(b.SegmentsLeft())) }
+
+// Segments returns the segments of the path, in the order they are visited, referring to the underlying buffer.
+func (b SRH) Segments() []net.IP {
+	n := int(b.LastEntry()) + 1
+	segs := make([]net.IP, n)
+	for i := range segs {
+		segs[i] = b.Segment(n - 1 - i)
+	}
+	return segs
+}
+
+// TLVs returns the TLVs following the segment list, if any.
+func (b SRH) TLVs() []byte { return b[SRHLen(int(b.LastEntry())+1, 0):b.HeaderLen()] }
+
+// Advance moves to the next segment, as a segment endpoint does, decrementing segments left and returning the new
+// active segment to write to the destination of the IPv6 header. It returns nil if no segments are left.
+func (b SRH) Advance() net.IP {
+	if b.SegmentsLeft() == 0 {
+		return nil
+	}
+	b.SetSegmentsLeft(b.SegmentsLeft() - 1)
+	return b.ActiveSegment()
+}
+
+// Encode writes the header described by f into the start of the buffer. The buffer must be at least
+// SRHLen(len(f.Segments), len(f.TLVs)) octets long.
+func (b SRH) Encode(f *SRHFields) error {
+	n := len(f.Segments)
+	if n == 0 {
+		return fmt.Errorf("invalid number of segments %d", n)
+	}
+	hl := SRHLen(n, len(f.TLVs))
+	if hl%8 != 0 || hl > 0x100*8 {
+		return fmt.Errorf("invalid segment routing header length %d", hl)
+	}
+	if len(b) < hl {
+		return fmt.Errorf("buffer too short for segment routing header: %d bytes", len(b))
+	}
+	if int(f.SegmentsLeft) >= n {
+		return fmt.Errorf("segments left %d beyond %d segments", f.SegmentsLeft, n)
+	}
+	b[0] = f.NextHeader
+	b[1] = uint8(hl/8 - 1)
+	b[2] = RoutingTypeSRH
+	b[3] = f.SegmentsLeft
+	b[4] = uint8(n - 1)
+	b[5] = f.Flags
+	binary.BigEndian.PutUint16(b[6:], f.Tag)
+	for i, seg := range f.Segments {
+		if seg.To16() == nil || seg.To4() != nil {
+			return fmt.Errorf("segment %v is not an ipv6 address", seg)
+		}
+		copy(b.Segment(n-1-i), seg.To16())
+	}
+	copy(b[SRHLen(n, 0):hl], f.TLVs)
+	return nil
+}
+
+// Types of segment routing header TLVs used for padding.
+const (
+	SRHTLVPad1 = 0 // A single octet of padding, with no length or value.
+	SRHTLVPadN = 4 // Padding of two or more octets.
+)
+
+// SRHTLV is a TLV of a segment routing header, such as the HMAC TLV.
+type SRHTLV struct {
+	Type  uint8
+	Value []byte // Up to 255 octets.
+}
+
+// ParseSRHTLVs decodes the TLVs of a segment routing header, such as those returned by SRH.TLVs, skipping padding.
+func ParseSRHTLVs(b []byte) ([]SRHTLV, error) {
+	var tlvs []SRHTLV
+	for len(b) > 0 {
+		if b[0] == SRHTLVPad1 {
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || 2+int(b[1]) > len(b) {
+			return nil, fmt.Errorf("segment routing header tlv %d truncated", b[0])
+		}
+		l := 2 + int(b[1])
+		if b[0] != SRHTLVPadN {
+			tlvs = append(tlvs, SRHTLV{Type: b[0], Value: b[2:l]})
+		}
+		b = b[l:]
+	}
+	return tlvs, nil
+}
+
+// AppendSRHTLVs appends the encoding of tlvs to b, suitable for SRHFields.TLVs, followed by the padding needed to make
+// them a multiple of 8 octets long.
+func AppendSRHTLVs(b []byte, tlvs []SRHTLV) []byte {
+	start := len(b)
+	for _, tlv := range tlvs {
+		b = append(b, tlv.Type, byte(len(tlv.Value)))
+		b = append(b, tlv.Value...)
+	}
+	switch pad := (8 - (len(b)-start)%8) % 8; pad {
+	case 0:
+	case 1:
+		b = append(b, SRHTLVPad1)
+	default:
+		b = append(b, SRHTLVPadN, byte(pad-2))
+		b = append(b, make([]byte, pad-2)...)
+	}
+	return b
+}
@@ -0,0 +1,206 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/dotwaffle/inettools/checksum"
+	"net"
+)
+
+// TCPMinLen is the length of a TCP header without options.
+const TCPMinLen = 20
+
+// TCP flags.
+const (
+	TCPFlagFIN = 0x01
+	TCPFlagSYN = 0x02
+	TCPFlagRST = 0x04
+	TCPFlagPSH = 0x08
+	TCPFlagACK = 0x10
+	TCPFlagURG = 0x20
+	TCPFlagECE = 0x40
+	TCPFlagCWR = 0x80
+)
+
+// TCP option kinds.
+const (
+	TCPOptionEnd           = 0
+	TCPOptionNOP           = 1
+	TCPOptionMSS           = 2
+	TCPOptionWindowScale   = 3
+	TCPOptionSACKPermitted = 4
+	TCPOptionSACK          = 5
+	TCPOptionTimestamps    = 8
+	TCPOptionFastOpen      = 34
+)
+
+// TCP is a view of a TCP segment, starting at its header. The segment is assumed to extend to the end of the buffer,
+// so the buffer should be sliced to the IP payload.
+type TCP []byte
+
+// TCPFields holds the values written by TCP.Encode.
+type TCPFields struct {
+	SrcPort uint16
+	DstPort uint16
+	Seq     uint32
+	Ack     uint32
+	Flags   uint8
+	Window  uint16
+	Urgent  uint16
+	Options []byte // Padded to a multiple of 4 octets with end of option list markers if necessary.
+}
+
+// Valid checks that the buffer is long enough to hold the header, including the options it claims to have.
+func (b TCP) Valid() error {
+	if len(b) < TCPMinLen {
+		return fmt.Errorf("tcp header too short: %d bytes", len(b))
+	}
+	if hl := b.HeaderLen(); hl < TCPMinLen || hl > len(b) {
+		return fmt.Errorf("invalid tcp header length %d", hl)
+	}
+	return nil
+}
+
+// SrcPort returns the source port.
+func (b TCP) SrcPort() uint16 { return binary.BigEndian.Uint16(b) }
+
+// SetSrcPort sets the source port.
+func (b TCP) SetSrcPort(p uint16) { binary.BigEndian.PutUint16(b, p) }
+
+// DstPort returns the destination port.
+func (b TCP) DstPort() uint16 { return binary.BigEndian.Uint16(b[2:]) }
+
+// SetDstPort sets the destination port.
+func (b TCP) SetDstPort(p uint16) { binary.BigEndian.PutUint16(b[2:], p) }
+
+// Seq returns the sequence number.
+func (b TCP) Seq() uint32 { return binary.BigEndian.Uint32(b[4:]) }
+
+// SetSeq sets the sequence number.
+func (b TCP) SetSeq(s uint32) { binary.BigEndian.PutUint32(b[4:], s) }
+
+// Ack returns the acknowledgement number.
+func (b TCP) Ack() uint32 { return binary.BigEndian.Uint32(b[8:]) }
+
+// SetAck sets the acknowledgement number.
+func (b TCP) SetAck(a uint32) { binary.BigEndian.PutUint32(b[8:], a) }
+
+// HeaderLen returns the length of the header, including options, in octets.
+func (b TCP) HeaderLen() int { return int(b[12]>>4) * 4 }
+
+// Flags returns the flags, as a combination of the TCPFlag constants.
+func (b TCP) Flags() uint8 { return b[13] }
+
+// SetFlags sets the flags.
+func (b TCP) SetFlags(f uint8) { b[13] = f }
+
+// Window returns the receive window, before any window scaling is applied.
+func (b TCP) Window() uint16 { return binary.BigEndian.Uint16(b[14:]) }
+
+// SetWindow sets the receive window.
+func (b TCP) SetWindow(w uint16) { binary.BigEndian.PutUint16(b[14:], w) }
+
+// Checksum returns the checksum.
+func (b TCP) Checksum() uint16 { return binary.BigEndian.Uint16(b[16:]) }
+
+// SetChecksum sets the checksum.
+func (b TCP) SetChecksum(c uint16) { binary.BigEndian.PutUint16(b[16:], c) }
+
+// Urgent returns the urgent pointer.
+func (b TCP) Urgent() uint16 { return binary.BigEndian.Uint16(b[18:]) }
+
+// SetUrgent sets the urgent pointer.
+func (b TCP) SetUrgent(u uint16) { binary.BigEndian.PutUint16(b[18:], u) }
+
+// Options returns the raw options, which can be decoded with ParseTCPOptions.
+func (b TCP) Options() []byte { return b[TCPMinLen:b.HeaderLen()] }
+
+// Payload returns the data following the header.
+func (b TCP) Payload() []byte { return b[b.HeaderLen():] }
+
+// ComputeChecksum calculates the checksum over the pseudo-header and segment, and stores it in the header.
+func (b TCP) ComputeChecksum(src, dst net.IP) {
+	b.SetChecksum(0)
+	b.SetChecksum(checksum.Checksum(b, checksum.PseudoHeader(ProtocolTCP, src, dst, len(b))))
+}
+
+// VerifyChecksum reports whether the checksum is correct.
+func (b TCP) VerifyChecksum(src, dst net.IP) bool {
+	return checksum.Checksum(b, checksum.PseudoHeader(ProtocolTCP, src, dst, len(b))) == 0
+}
+
+// Encode writes the header described by f into the start of the buffer, and computes the checksum over the
+// pseudo-header formed from src and dst. The payload must already be in place, directly after the options.
+func (b TCP) Encode(f *TCPFields, src, dst net.IP) error {
+	optLen := len(f.Options)
+	if optLen%4 != 0 {
+		optLen += 4 - optLen%4
+	}
+	if optLen > 40 {
+		return fmt.Errorf("tcp options too long: %d bytes", len(f.Options))
+	}
+	hl := TCPMinLen + optLen
+	if len(b) < hl {
+		return fmt.Errorf("buffer too short for tcp header: %d bytes", len(b))
+	}
+
+	b.SetSrcPort(f.SrcPort)
+	b.SetDstPort(f.DstPort)
+	b.SetSeq(f.Seq)
+	b.SetAck(f.Ack)
+	b[12] = uint8(hl/4) << 4
+	b.SetFlags(f.Flags)
+	b.SetWindow(f.Window)
+	b.SetUrgent(f.Urgent)
+	n := copy(b[TCPMinLen:hl], f.Options)
+	for i := TCPMinLen + n; i < hl; i++ {
+		b[i] = TCPOptionEnd
+	}
+	b.ComputeChecksum(src, dst)
+
+	return nil
+}
+
+// TCPOption is a single TCP option.
+type TCPOption struct {
+	Kind uint8
+	Data []byte // The option value, excluding the kind and length octets.
+}
+
+// ParseTCPOptions decodes TCP options, such as those returned by TCP.Options. Padding (no-operation and end of
+// option list) is not included in the result.
+func ParseTCPOptions(b []byte) ([]TCPOption, error) {
+	var opts []TCPOption
+	for len(b) > 0 {
+		switch b[0] {
+		case TCPOptionEnd:
+			return opts, nil
+		case TCPOptionNOP:
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 {
+			return nil, fmt.Errorf("tcp option %d truncated", b[0])
+		}
+		l := int(b[1])
+		if l < 2 || l > len(b) {
+			return nil, fmt.Errorf("invalid length %d for tcp option %d", l, b[0])
+		}
+		opts = append(opts, TCPOption{Kind: b[0], Data: b[2:l]})
+		b = b[l:]
+	}
+	return opts, nil
+}
+
+// AppendTCPOptions encodes TCP options, appending them to b. The result is not padded; TCP.Encode does that.
+func AppendTCPOptions(b []byte, opts []TCPOption) []byte {
+	for _, opt := range opts {
+		if opt.Kind == TCPOptionEnd || opt.Kind == TCPOptionNOP {
+			b = append(b, opt.Kind)
+			continue
+		}
+		b = append(b, opt.Kind, uint8(2+len(opt.Data)))
+		b = append(b, opt.Data...)
+	}
+	return b
+}
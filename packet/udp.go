@@ -0,0 +1,106 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/dotwaffle/inettools/checksum"
+	"net"
+)
+
+// UDPHeaderLen is the length of a UDP header.
+const UDPHeaderLen = 8
+
+// UDP is a view of a UDP datagram, starting at its header.
+type UDP []byte
+
+// UDPFields holds the values written by UDP.Encode.
+type UDPFields struct {
+	SrcPort uint16
+	DstPort uint16
+	Length  uint16 // Zero means the length of the buffer.
+}
+
+// Valid checks that the buffer is long enough to hold the header and the length it claims to have.
+func (b UDP) Valid() error {
+	if len(b) < UDPHeaderLen {
+		return fmt.Errorf("udp header too short: %d bytes", len(b))
+	}
+	if l := int(b.Length()); l < UDPHeaderLen || l > len(b) {
+		return fmt.Errorf("invalid udp length %d for %d byte buffer", l, len(b))
+	}
+	return nil
+}
+
+// SrcPort returns the source port.
+func (b UDP) SrcPort() uint16 { return binary.BigEndian.Uint16(b) }
+
+// SetSrcPort sets the source port.
+func (b UDP) SetSrcPort(p uint16) { binary.BigEndian.PutUint16(b, p) }
+
+// DstPort returns the destination port.
+func (b UDP) DstPort() uint16 { return binary.BigEndian.Uint16(b[2:]) }
+
+// SetDstPort sets the destination port.
+func (b UDP) SetDstPort(p uint16) { binary.BigEndian.PutUint16(b[2:], p) }
+
+// Length returns the length of the datagram, including the header.
+func (b UDP) Length() uint16 { return binary.BigEndian.Uint16(b[4:]) }
+
+// SetLength sets the length of the datagram, including the header.
+func (b UDP) SetLength(l uint16) { binary.BigEndian.PutUint16(b[4:], l) }
+
+// Checksum returns the checksum, where zero means no checksum was computed (only permitted over IPv4).
+func (b UDP) Checksum() uint16 { return binary.BigEndian.Uint16(b[6:]) }
+
+// SetChecksum sets the checksum.
+func (b UDP) SetChecksum(c uint16) { binary.BigEndian.PutUint16(b[6:], c) }
+
+// Payload returns the data following the header, up to the length of the datagram.
+func (b UDP) Payload() []byte { return b[UDPHeaderLen:b.Length()] }
+
+// ComputeChecksum calculates the checksum over the pseudo-header and datagram, and stores it in the header.
+func (b UDP) ComputeChecksum(src, dst net.IP) {
+	b.SetChecksum(0)
+	l := int(b.Length())
+	c := checksum.Checksum(b[:l], checksum.PseudoHeader(ProtocolUDP, src, dst, l))
+	// A computed checksum of zero is transmitted as all ones, as zero means no checksum.
+	if c == 0 {
+		c = 0xffff
+	}
+	b.SetChecksum(c)
+}
+
+// VerifyChecksum reports whether the checksum is correct. A zero checksum over IPv4 means none was computed, and is
+// accepted.
+func (b UDP) VerifyChecksum(src, dst net.IP) bool {
+	if b.Checksum() == 0 && src.To4() != nil {
+		return true
+	}
+	l := int(b.Length())
+	return checksum.Checksum(b[:l], checksum.PseudoHeader(ProtocolUDP, src, dst, l)) == 0
+}
+
+// Encode writes the header described by f into the start of the buffer, and computes the checksum over the
+// pseudo-header formed from src and dst. The payload must already be in place.
+func (b UDP) Encode(f *UDPFields, src, dst net.IP) error {
+	if len(b) < UDPHeaderLen {
+		return fmt.Errorf("buffer too short for udp header: %d bytes", len(b))
+	}
+	length := f.Length
+	if length == 0 {
+		if len(b) > 0xffff {
+			return fmt.Errorf("buffer too long for udp datagram: %d bytes", len(b))
+		}
+		length = uint16(len(b))
+	}
+	if int(length) < UDPHeaderLen || int(length) > len(b) {
+		return fmt.Errorf("invalid udp length %d for %d byte buffer", length, len(b))
+	}
+
+	b.SetSrcPort(f.SrcPort)
+	b.SetDstPort(f.DstPort)
+	b.SetLength(length)
+	b.ComputeChecksum(src, dst)
+
+	return nil
+}
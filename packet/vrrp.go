@@ -0,0 +1,205 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/checksum"
+	"net"
+	"time"
+)
+
+// VRRPHeaderLen is the length of a VRRP header, without addresses or, in version 2, authentication data.
+const VRRPHeaderLen = 8
+
+// vrrpAuthLen is the length of the authentication data following the addresses in version 2.
+const vrrpAuthLen = 8
+
+// VRRPTypeAdvertisement is the type of a VRRP advertisement, the only type defined.
+const VRRPTypeAdvertisement = 1
+
+// VRRP priorities with special meanings.
+const (
+	VRRPPriorityRelease = 0   // The master is stopping, and a backup should take over at once.
+	VRRPPriorityOwner   = 255 // The router owns the virtual addresses.
+)
+
+// VRRP is a view of a VRRP advertisement, starting at its header, as defined by RFC 3768 for version 2 and RFC 5798
+// for version 3. Version 2 only carries IPv4 addresses; version 3 carries addresses of the family of the IP header.
+type VRRP []byte
+
+// VRRPFields holds the values written by VRRP.Encode.
+type VRRPFields struct {
+	Version  int // 2 or 3.
+	VRID     uint8
+	Priority uint8
+	// The interval between advertisements, in whole seconds for version 2 and centiseconds for version 3.
+	AdvertInterval time.Duration
+	Addresses      []net.IP // The virtual addresses, all of one family.
+	AuthType       uint8    // Only in version 2, where RFC 3768 deprecates authentication; normally zero.
+}
+
+// VRRPLen returns the length of a VRRP advertisement of a version with n addresses, of IPv6 or IPv4.
+func VRRPLen(version, n int, ipv6 bool) int {
+	l := VRRPHeaderLen + n*net.IPv4len
+	if ipv6 {
+		l = VRRPHeaderLen + n*net.IPv6len
+	}
+	if version == 2 {
+		l += vrrpAuthLen
+	}
+	return l
+}
+
+// Valid checks that the buffer holds an advertisement of version 2 or 3, long enough for the IPv4 addresses it claims
+// to have.
+func (b VRRP) Valid() error {
+	if len(b) < VRRPHeaderLen {
+		return fmt.Errorf("vrrp header too short: %d bytes", len(b))
+	}
+	if v := b.Version(); v != 2 && v != 3 {
+		return fmt.Errorf("unsupported vrrp version %d", v)
+	}
+	if t := b.Type(); t != VRRPTypeAdvertisement {
+		return fmt.Errorf("unknown vrrp type %d", t)
+	}
+	if l := VRRPLen(b.Version(), int(b.CountAddresses()), false); l > len(b) {
+		return fmt.Errorf("vrrp advertisement of %d addresses longer than %d byte buffer", b.CountAddresses(), len(b))
+	}
+	return nil
+}
+
+// Version returns the version of the protocol.
+func (b VRRP) Version() int { return int(b[0] >> 4) }
+
+// Type returns the type of the packet, which is VRRPTypeAdvertisement for a valid packet.
+func (b VRRP) Type() uint8 { return b[0] & 0x0f }
+
+// VRID returns the virtual router identifier.
+func (b VRRP) VRID() uint8 { return b[1] }
+
+// Priority returns the priority of the sending router.
+func (b VRRP) Priority() uint8 { return b[2] }
+
+// SetPriority sets the priority of the sending router.
+func (b VRRP) SetPriority(p uint8) { b[2] = p }
+
+// CountAddresses returns the number of virtual addresses.
+func (b VRRP) CountAddresses() uint8 { return b[3] }
+
+// AuthType returns the authentication type in version 2, or zero in version 3.
+func (b VRRP) AuthType() uint8 {
+	if b.Version() != 2 {
+		return 0
+	}
+	return b[4]
+}
+
+// AdvertInterval returns the interval between advertisements.
+func (b VRRP) AdvertInterval() time.Duration {
+	if b.Version() == 2 {
+		return time.Duration(b[5]) * time.Second
+	}
+	return time.Duration(binary.BigEndian.Uint16(b[4:])&0x0fff) * 10 * time.Millisecond
+}
+
+// Checksum returns the checksum.
+func (b VRRP) Checksum() uint16 { return binary.BigEndian.Uint16(b[6:]) }
+
+// SetChecksum sets the checksum.
+func (b VRRP) SetChecksum(c uint16) { binary.BigEndian.PutUint16(b[6:], c) }
+
+// Addresses returns the virtual addresses, of IPv6 or IPv4, referring to the underlying buffer. Addresses that do not
+// fit in the buffer are omitted.
+func (b VRRP) Addresses(ipv6 bool) []net.IP {
+	size := net.IPv4len
+	if ipv6 {
+		size = net.IPv6len
+	}
+	var addrs []net.IP
+	for i, off := 0, VRRPHeaderLen; i < int(b.CountAddresses()) && off+size <= len(b); i, off = i+1, off+size {
+		addrs = append(addrs, net.IP(b[off:off+size]))
+	}
+	return addrs
+}
+
+// checksummed returns the part of the advertisement the checksum covers, and the initial sum: in version 3, that of
+// the pseudo-header formed from src and dst.
+func (b VRRP) checksummed(src, dst net.IP) ([]byte, uint32) {
+	l := VRRPLen(b.Version(), int(b.CountAddresses()), src.To4() == nil)
+	if l > len(b) {
+		l = len(b)
+	}
+	if b.Version() == 2 {
+		return b[:l], 0
+	}
+	return b[:l], checksum.PseudoHeader(ProtocolVRRP, src, dst, l)
+}
+
+// ComputeChecksum calculates the checksum, over the pseudo-header and advertisement in version 3 and only the
+// advertisement in version 2, and stores it in the header.
+func (b VRRP) ComputeChecksum(src, dst net.IP) {
+	b.SetChecksum(0)
+	data, initial := b.checksummed(src, dst)
+	b.SetChecksum(checksum.Checksum(data, initial))
+}
+
+// VerifyChecksum reports whether the checksum is correct.
+func (b VRRP) VerifyChecksum(src, dst net.IP) bool {
+	data, initial := b.checksummed(src, dst)
+	return checksum.Checksum(data, initial) == 0
+}
+
+// Encode writes the advertisement described by f into the start of the buffer, and computes the checksum, over the
+// pseudo-header formed from src and dst in version 3.
+func (b VRRP) Encode(f *VRRPFields, src, dst net.IP) error {
+	if f.Version != 2 && f.Version != 3 {
+		return fmt.Errorf("unsupported vrrp version %d", f.Version)
+	}
+	if len(f.Addresses) == 0 || len(f.Addresses) > 0xff {
+		return fmt.Errorf("invalid number of vrrp addresses %d", len(f.Addresses))
+	}
+	ipv6 := f.Addresses[0].To4() == nil
+	if ipv6 && f.Version == 2 {
+		return errors.New("vrrp version 2 only carries ipv4 addresses")
+	}
+	if l := VRRPLen(f.Version, len(f.Addresses), ipv6); len(b) < l {
+		return fmt.Errorf("buffer too short for vrrp advertisement: %d bytes", len(b))
+	}
+
+	b[0] = byte(f.Version)<<4 | VRRPTypeAdvertisement
+	b[1] = f.VRID
+	b[2] = f.Priority
+	b[3] = byte(len(f.Addresses))
+	if f.Version == 2 {
+		secs := f.AdvertInterval / time.Second
+		if secs < 1 || secs > 0xff || f.AdvertInterval%time.Second != 0 {
+			return fmt.Errorf("vrrp version 2 advertisement interval %v not whole seconds to 255", f.AdvertInterval)
+		}
+		b[4], b[5] = f.AuthType, byte(secs)
+	} else {
+		cs := f.AdvertInterval / (10 * time.Millisecond)
+		if cs < 1 || cs > 0xfff {
+			return fmt.Errorf("vrrp version 3 advertisement interval %v out of range", f.AdvertInterval)
+		}
+		binary.BigEndian.PutUint16(b[4:], uint16(cs))
+	}
+	off := VRRPHeaderLen
+	for _, addr := range f.Addresses {
+		ip := addr.To4()
+		if ipv6 {
+			ip = addr.To16()
+		}
+		if ip == nil || (addr.To4() == nil) != ipv6 {
+			return errors.New("vrrp addresses of mixed families")
+		}
+		off += copy(b[off:], ip)
+	}
+	if f.Version == 2 {
+		for i := off; i < off+vrrpAuthLen; i++ {
+			b[i] = 0
+		}
+	}
+	b.ComputeChecksum(src, dst)
+	return nil
+}
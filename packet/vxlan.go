@@ -0,0 +1,51 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// VXLANHeaderLen is the length of a VXLAN header.
+const VXLANHeaderLen = 8
+
+// VXLANPort is the UDP port VXLAN is carried on.
+const VXLANPort = 4789
+
+// vxlanFlagVNI is the flag marking the VNI as valid, which RFC 7348 requires.
+const vxlanFlagVNI = 0x08
+
+// VXLAN is a view of a VXLAN packet, starting at its header, carrying an Ethernet frame.
+type VXLAN []byte
+
+// Valid checks that the buffer is long enough to hold the header, and that the VNI is marked as valid.
+func (b VXLAN) Valid() error {
+	if len(b) < VXLANHeaderLen {
+		return fmt.Errorf("vxlan header too short: %d bytes", len(b))
+	}
+	if b[0]&vxlanFlagVNI == 0 {
+		return fmt.Errorf("vxlan vni flag not set: flags %02x", b[0])
+	}
+	return nil
+}
+
+// VNI returns the VXLAN network identifier.
+func (b VXLAN) VNI() uint32 { return binary.BigEndian.Uint32(b[4:]) >> 8 }
+
+// SetVNI sets the VXLAN network identifier.
+func (b VXLAN) SetVNI(vni uint32) { binary.BigEndian.PutUint32(b[4:], vni<<8) }
+
+// Payload returns the Ethernet frame following the header.
+func (b VXLAN) Payload() []byte { return b[VXLANHeaderLen:] }
+
+// Encode writes a header with a VNI into the start of the buffer.
+func (b VXLAN) Encode(vni uint32) error {
+	if len(b) < VXLANHeaderLen {
+		return fmt.Errorf("buffer too short for vxlan header: %d bytes", len(b))
+	}
+	if vni > 0xffffff {
+		return fmt.Errorf("vxlan vni %d larger than 24 bits", vni)
+	}
+	binary.BigEndian.PutUint32(b, vxlanFlagVNI<<24)
+	b.SetVNI(vni)
+	return nil
+}
@@ -0,0 +1,331 @@
+package passive
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/dotwaffle/inettools/pcap"
+	"io"
+	"net"
+	"time"
+)
+
+// maxPending bounds the segments awaiting acknowledgement in each direction, beyond which the oldest are forgotten.
+const maxPending = 4096
+
+// Direction is the traffic one end of a flow sent. Its RTT samples time segments from the capture point to their
+// acknowledgement by the other end, so they cover the path beyond the capture point, plus the delay of the receiver in
+// acknowledging; a capture on the sending host measures the whole round trip.
+type Direction struct {
+	Packets     int
+	DataPackets int   // The packets carrying data, or a SYN or FIN.
+	Bytes       int64 // The octets of data, including those retransmitted.
+	Retransmits int   // The data packets repeating sequence space already sent.
+	RTTSamples  int
+	MinRTT      time.Duration
+	MaxRTT      time.Duration
+	totalRTT    time.Duration
+}
+
+// MeanRTT returns the mean of the RTT samples, or zero if there are none.
+func (d *Direction) MeanRTT() time.Duration {
+	if d.RTTSamples == 0 {
+		return 0
+	}
+	return d.totalRTT / time.Duration(d.RTTSamples)
+}
+
+// RetransmitRate returns the fraction of data packets that were retransmissions, which estimates the loss rate.
+func (d *Direction) RetransmitRate() float64 {
+	if d.DataPackets == 0 {
+		return 0
+	}
+	return float64(d.Retransmits) / float64(d.DataPackets)
+}
+
+// sample records an RTT sample.
+func (d *Direction) sample(rtt time.Duration) {
+	if d.RTTSamples == 0 || rtt < d.MinRTT {
+		d.MinRTT = rtt
+	}
+	if rtt > d.MaxRTT {
+		d.MaxRTT = rtt
+	}
+	d.RTTSamples++
+	d.totalRTT += rtt
+}
+
+// Flow is a TCP connection seen in a capture.
+type Flow struct {
+	Client *net.TCPAddr // The end that sent the SYN, or if it was not captured, the sender of the first packet.
+	Server *net.TCPAddr
+	Start  time.Time
+	End    time.Time
+	// The time from the SYN to the acknowledgement of the SYN-ACK, which is the full round trip wherever the capture
+	// was made, or zero if the handshake was not captured or the SYN was retransmitted.
+	HandshakeRTT time.Duration
+	Forward      Direction // From the client to the server.
+	Reverse      Direction // From the server to the client.
+	Closed       bool      // A FIN or RST was seen.
+}
+
+// Duration returns the time between the first and last packets.
+func (f *Flow) Duration() time.Duration {
+	return f.End.Sub(f.Start)
+}
+
+// Throughput returns the mean rate of data in each direction, in bits per second, over the duration of the flow.
+func (f *Flow) Throughput() (forward, reverse float64) {
+	secs := f.Duration().Seconds()
+	if secs <= 0 {
+		return 0, 0
+	}
+	return float64(f.Forward.Bytes) * 8 / secs, float64(f.Reverse.Bytes) * 8 / secs
+}
+
+// String identifies the flow by its ends.
+func (f *Flow) String() string {
+	return fmt.Sprintf("%v -> %v", f.Client, f.Server)
+}
+
+// Analyzer estimates the RTT, retransmissions, and throughput of TCP flows from captured packets, without access to
+// their sockets. Sequence numbers are tracked as the packets arrive, so packets reordered before the capture point
+// count as retransmissions. The zero value is ready to use.
+type Analyzer struct {
+	conns map[key]*conn
+	flows []*Flow
+}
+
+// key identifies a flow by its ends, in the order of the client and server.
+type key struct {
+	clientIP, serverIP     [net.IPv6len]byte
+	clientPort, serverPort uint16
+}
+
+// conn is the state of a flow.
+type conn struct {
+	flow             *Flow
+	client, server   side
+	synAt            time.Time
+	synAckSeq        uint32
+	handshakeRetrans bool
+}
+
+// side is the sequence state of the traffic sent by one end.
+type side struct {
+	started bool
+	next    uint32 // The sequence number following the highest sent.
+	pending []sent
+}
+
+// sent is a segment awaiting acknowledgement.
+type sent struct {
+	end uint32
+	at  time.Time
+}
+
+// Add analyzes an IPv4 or IPv6 packet captured at the given time. Packets that are not TCP are ignored, and packets
+// truncated by the capture only need to include the TCP header.
+func (a *Analyzer) Add(at time.Time, ip []byte) error {
+	src, dst, tcp, dataLen, err := segment(ip)
+	if err != nil || tcp == nil {
+		return err
+	}
+	if a.conns == nil {
+		a.conns = map[key]*conn{}
+	}
+	k := key{clientPort: tcp.SrcPort(), serverPort: tcp.DstPort()}
+	copy(k.clientIP[:], src.To16())
+	copy(k.serverIP[:], dst.To16())
+	rk := key{clientIP: k.serverIP, serverIP: k.clientIP, clientPort: k.serverPort, serverPort: k.clientPort}
+
+	flags := tcp.Flags()
+	c, fromClient := a.conns[k], true
+	if c == nil {
+		if c = a.conns[rk]; c != nil {
+			fromClient = false
+		}
+	}
+	// A SYN-ACK seen before its SYN still shows which end is the server.
+	if c == nil && flags&(packet.TCPFlagSYN|packet.TCPFlagACK) == packet.TCPFlagSYN|packet.TCPFlagACK {
+		k, fromClient = rk, false
+	}
+	if c == nil {
+		c = &conn{flow: &Flow{Start: at}}
+		srcAddr, dstAddr := &net.TCPAddr{IP: src, Port: int(tcp.SrcPort())}, &net.TCPAddr{IP: dst, Port: int(tcp.DstPort())}
+		c.flow.Client, c.flow.Server = srcAddr, dstAddr
+		if !fromClient {
+			c.flow.Client, c.flow.Server = dstAddr, srcAddr
+		}
+		a.conns[k] = c
+		a.flows = append(a.flows, c.flow)
+	}
+	c.flow.End = at
+	if flags&(packet.TCPFlagFIN|packet.TCPFlagRST) != 0 {
+		c.flow.Closed = true
+	}
+
+	from, to, dir, toDir := &c.client, &c.server, &c.flow.Forward, &c.flow.Reverse
+	if !fromClient {
+		from, to, dir, toDir = &c.server, &c.client, &c.flow.Reverse, &c.flow.Forward
+	}
+	dir.Packets++
+	dir.Bytes += int64(dataLen)
+
+	seq, length := tcp.Seq(), uint32(dataLen)
+	if flags&packet.TCPFlagSYN != 0 {
+		length++
+	}
+	if flags&packet.TCPFlagFIN != 0 {
+		length++
+	}
+	if length > 0 {
+		dir.DataPackets++
+		// A keepalive repeats the last octet sent, and is not a retransmission.
+		keepalive := dataLen == 1 && seq == from.next-1 && flags&(packet.TCPFlagSYN|packet.TCPFlagFIN) == 0
+		switch {
+		case !from.started:
+			from.started, from.next = true, seq+length
+			from.push(seq+length, at)
+		case before(seq, from.next) && !keepalive:
+			// The segment repeats data already sent, so acknowledgements of it are ambiguous and not sampled, as
+			// described by Karn's algorithm.
+			dir.Retransmits++
+			from.forget(seq)
+			if flags&packet.TCPFlagSYN != 0 {
+				c.handshakeRetrans = true
+			}
+		case !before(seq, from.next):
+			from.next = seq + length
+			from.push(seq+length, at)
+		}
+	}
+
+	switch {
+	case fromClient && flags&(packet.TCPFlagSYN|packet.TCPFlagACK) == packet.TCPFlagSYN:
+		if c.synAt.IsZero() {
+			c.synAt = at
+		}
+	case !fromClient && flags&(packet.TCPFlagSYN|packet.TCPFlagACK) == packet.TCPFlagSYN|packet.TCPFlagACK:
+		c.synAckSeq = seq
+	case fromClient && flags&packet.TCPFlagACK != 0 && !c.synAt.IsZero() && c.flow.HandshakeRTT == 0 &&
+		!c.handshakeRetrans && to.started && tcp.Ack() == c.synAckSeq+1:
+		c.flow.HandshakeRTT = at.Sub(c.synAt)
+	}
+	if flags&packet.TCPFlagACK != 0 {
+		to.ack(tcp.Ack(), at, toDir)
+	}
+	return nil
+}
+
+// push records a segment awaiting acknowledgement.
+func (s *side) push(end uint32, at time.Time) {
+	if len(s.pending) == maxPending {
+		s.pending = s.pending[1:]
+	}
+	s.pending = append(s.pending, sent{end: end, at: at})
+}
+
+// forget discards the segments a retransmission from seq overlaps.
+func (s *side) forget(seq uint32) {
+	for i, p := range s.pending {
+		if before(seq, p.end) {
+			s.pending = s.pending[:i]
+			return
+		}
+	}
+}
+
+// ack takes an RTT sample from the latest segment an acknowledgement covers, and discards all those it covers.
+func (s *side) ack(ack uint32, at time.Time, d *Direction) {
+	n := 0
+	for n < len(s.pending) && !before(ack, s.pending[n].end) {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	d.sample(at.Sub(s.pending[n-1].at))
+	s.pending = s.pending[n:]
+}
+
+// before reports whether sequence number a precedes b, allowing for wrapping.
+func before(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// Flows returns the flows seen, in the order of their first packets.
+func (a *Analyzer) Flows() []*Flow {
+	return a.flows
+}
+
+// segment returns the addresses, TCP header, and length of the TCP data of a packet, or a nil header if the packet is
+// not TCP. The length is taken from the IP header, so the data need not have been captured.
+func segment(b []byte) (src, dst net.IP, tcp packet.TCP, dataLen int, err error) {
+	if len(b) == 0 {
+		return nil, nil, nil, 0, errors.New("empty packet")
+	}
+	var rest []byte
+	var ipLen int
+	switch b[0] >> 4 {
+	case 4:
+		ip := packet.IPv4(b)
+		if len(b) < packet.IPv4MinLen || ip.HeaderLen() < packet.IPv4MinLen || ip.HeaderLen() > len(b) {
+			return nil, nil, nil, 0, errors.New("ipv4 header truncated")
+		}
+		if ip.Protocol() != packet.ProtocolTCP || ip.FragmentOffset() != 0 {
+			return nil, nil, nil, 0, nil
+		}
+		src, dst, rest, ipLen = ip.Src(), ip.Dst(), b[ip.HeaderLen():], int(ip.TotalLen())-ip.HeaderLen()
+	case 6:
+		ip := packet.IPv6(b)
+		if len(b) < packet.IPv6HeaderLen {
+			return nil, nil, nil, 0, errors.New("ipv6 header truncated")
+		}
+		src, dst = ip.Src(), ip.Dst()
+		if ip.Valid() == nil {
+			// The whole packet was captured, so any extension headers can be walked.
+			_, proto, payload, err := ip.Extensions()
+			if err != nil || proto != packet.ProtocolTCP {
+				return nil, nil, nil, 0, err
+			}
+			rest, ipLen = payload, len(payload)
+		} else {
+			if ip.NextHeader() != packet.ProtocolTCP {
+				return nil, nil, nil, 0, nil
+			}
+			rest, ipLen = b[packet.IPv6HeaderLen:], int(ip.PayloadLen())
+		}
+	default:
+		return nil, nil, nil, 0, fmt.Errorf("unknown ip version %d", b[0]>>4)
+	}
+	tcp = packet.TCP(rest)
+	if err := tcp.Valid(); err != nil {
+		return nil, nil, nil, 0, err
+	}
+	if dataLen = ipLen - tcp.HeaderLen(); dataLen < 0 {
+		return nil, nil, nil, 0, errors.New("invalid ip length")
+	}
+	return net.IP(append([]byte(nil), src...)), net.IP(append([]byte(nil), dst...)), tcp, dataLen, nil
+}
+
+// ReadPcap analyzes the TCP flows in a pcap file. Packets that cannot be decoded are skipped.
+func ReadPcap(r io.Reader) ([]*Flow, error) {
+	pr, err := pcap.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var a Analyzer
+	for {
+		p, err := pr.Next()
+		if err == io.EOF {
+			return a.Flows(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ip, err := pr.LinkType.Network(p.Data); err == nil {
+			a.Add(p.Timestamp, ip)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package passive
+
+import (
+	"bytes"
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/dotwaffle/inettools/pcap"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// seg describes a captured TCP packet.
+type seg struct {
+	at       time.Duration // Since the start of the capture.
+	fromC    bool          // Sent by the client.
+	seq, ack uint32
+	flags    uint8
+	dataLen  int
+}
+
+// encode returns the packet as IPv4 or IPv6, with its data truncated by the capture if snap is set.
+func (s seg) encode(t *testing.T, client, server *net.TCPAddr, snap bool) []byte {
+	t.Helper()
+	src, dst := client, server
+	if !s.fromC {
+		src, dst = server, client
+	}
+	tcpLen := packet.TCPMinLen + s.dataLen
+	f := &packet.TCPFields{SrcPort: uint16(src.Port), DstPort: uint16(dst.Port), Seq: s.seq, Ack: s.ack, Flags: s.flags}
+	var b []byte
+	if src.IP.To4() != nil {
+		b = make([]byte, packet.IPv4MinLen+tcpLen)
+		if err := packet.TCP(b[packet.IPv4MinLen:]).Encode(f, src.IP, dst.IP); err != nil {
+			t.Fatalf("tcp encode err: %v", err)
+		}
+		err := packet.IPv4(b).Encode(&packet.IPv4Fields{TTL: 64, Protocol: packet.ProtocolTCP, Src: src.IP, Dst: dst.IP})
+		if err != nil {
+			t.Fatalf("ipv4 encode err: %v", err)
+		}
+	} else {
+		b = make([]byte, packet.IPv6HeaderLen+tcpLen)
+		if err := packet.TCP(b[packet.IPv6HeaderLen:]).Encode(f, src.IP, dst.IP); err != nil {
+			t.Fatalf("tcp encode err: %v", err)
+		}
+		f6 := &packet.IPv6Fields{NextHeader: packet.ProtocolTCP, HopLimit: 64, Src: src.IP, Dst: dst.IP}
+		if err := packet.IPv6(b).Encode(f6); err != nil {
+			t.Fatalf("ipv6 encode err: %v", err)
+		}
+	}
+	if snap {
+		return b[:len(b)-s.dataLen]
+	}
+	return b
+}
+
+func TestAnalyzer(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	ms := time.Millisecond
+	client4 := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 40000}
+	server4 := &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1).To4(), Port: 443}
+	client6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}
+	server6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 22}
+
+	tests := map[string]struct {
+		client, server *net.TCPAddr
+		segs           []seg
+		snap           bool
+		want           *Flow
+	}{
+		"Connection": {
+			client: client4,
+			server: server4,
+			segs: []seg{
+				{at: 0, fromC: true, seq: 1000, flags: packet.TCPFlagSYN},
+				{at: 10 * ms, seq: 5000, ack: 1001, flags: packet.TCPFlagSYN | packet.TCPFlagACK},
+				{at: 30 * ms, fromC: true, seq: 1001, ack: 5001, flags: packet.TCPFlagACK},
+				{at: 31 * ms, fromC: true, seq: 1001, ack: 5001, flags: packet.TCPFlagACK, dataLen: 100},
+				{at: 41 * ms, seq: 5001, ack: 1101, flags: packet.TCPFlagACK, dataLen: 1000},
+				{at: 42 * ms, seq: 6001, ack: 1101, flags: packet.TCPFlagACK, dataLen: 1000},
+				// A retransmission makes acknowledgements of either segment ambiguous.
+				{at: 43 * ms, seq: 5001, ack: 1101, flags: packet.TCPFlagACK, dataLen: 1000},
+				{at: 63 * ms, fromC: true, seq: 1101, ack: 7001, flags: packet.TCPFlagACK},
+				{at: 64 * ms, fromC: true, seq: 1101, ack: 7001, flags: packet.TCPFlagFIN | packet.TCPFlagACK},
+				{at: 74 * ms, seq: 7001, ack: 1102, flags: packet.TCPFlagFIN | packet.TCPFlagACK},
+				{at: 80 * ms, fromC: true, seq: 1102, ack: 7002, flags: packet.TCPFlagACK},
+			},
+			want: &Flow{
+				Client:       client4,
+				Server:       server4,
+				Start:        start,
+				End:          start.Add(80 * ms),
+				HandshakeRTT: 30 * ms,
+				Forward: Direction{
+					Packets: 6, DataPackets: 3, Bytes: 100,
+					RTTSamples: 3, MinRTT: 10 * ms, MaxRTT: 10 * ms, totalRTT: 30 * ms,
+				},
+				Reverse: Direction{
+					Packets: 5, DataPackets: 5, Bytes: 3000, Retransmits: 1,
+					RTTSamples: 2, MinRTT: 6 * ms, MaxRTT: 20 * ms, totalRTT: 26 * ms,
+				},
+				Closed: true,
+			},
+		},
+		"MidstreamTruncatedIPv6": {
+			client: client6,
+			server: server6,
+			snap:   true,
+			segs: []seg{
+				// The SYN-ACK identifies the server even though the SYN was not captured.
+				{at: 0, seq: 9000, ack: 2001, flags: packet.TCPFlagSYN | packet.TCPFlagACK},
+				{at: 5 * ms, fromC: true, seq: 2001, ack: 9001, flags: packet.TCPFlagACK, dataLen: 500},
+				{at: 6 * ms, fromC: true, seq: 2501, ack: 9001, flags: packet.TCPFlagACK, dataLen: 500},
+				{at: 15 * ms, seq: 9001, ack: 3001, flags: packet.TCPFlagACK},
+				// A keepalive is not a retransmission.
+				{at: 1015 * ms, fromC: true, seq: 3000, ack: 9001, flags: packet.TCPFlagACK, dataLen: 1},
+			},
+			want: &Flow{
+				Client: client6,
+				Server: server6,
+				Start:  start,
+				End:    start.Add(1015 * ms),
+				Forward: Direction{
+					Packets: 3, DataPackets: 3, Bytes: 1001,
+					RTTSamples: 1, MinRTT: 9 * ms, MaxRTT: 9 * ms, totalRTT: 9 * ms,
+				},
+				Reverse: Direction{
+					Packets: 2, DataPackets: 1,
+					RTTSamples: 1, MinRTT: 5 * ms, MaxRTT: 5 * ms, totalRTT: 5 * ms,
+				},
+			},
+		},
+		"RetransmittedSYN": {
+			client: client4,
+			server: server4,
+			segs: []seg{
+				{at: 0, fromC: true, seq: 1000, flags: packet.TCPFlagSYN},
+				{at: 1000 * ms, fromC: true, seq: 1000, flags: packet.TCPFlagSYN},
+				{at: 1010 * ms, seq: 5000, ack: 1001, flags: packet.TCPFlagSYN | packet.TCPFlagACK},
+				{at: 1020 * ms, fromC: true, seq: 1001, ack: 5001, flags: packet.TCPFlagACK},
+			},
+			want: &Flow{
+				Client:  client4,
+				Server:  server4,
+				Start:   start,
+				End:     start.Add(1020 * ms),
+				Forward: Direction{Packets: 3, DataPackets: 2, Retransmits: 1},
+				Reverse: Direction{
+					Packets: 1, DataPackets: 1,
+					RTTSamples: 1, MinRTT: 10 * ms, MaxRTT: 10 * ms, totalRTT: 10 * ms,
+				},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var a Analyzer
+			for _, s := range test.segs {
+				if err := a.Add(start.Add(s.at), s.encode(t, test.client, test.server, test.snap)); err != nil {
+					t.Fatalf("add err: %v", err)
+				}
+			}
+			flows := a.Flows()
+			if len(flows) != 1 {
+				t.Fatalf("got %d flows, want 1", len(flows))
+			}
+			if diff := cmp.Diff(test.want, flows[0], cmp.AllowUnexported(Direction{})); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestReadPcap(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	client := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 40000}
+	server := &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1).To4(), Port: 80}
+	eth := func(ip []byte) []byte {
+		return append([]byte{2, 0, 0, 0, 0, 2, 2, 0, 0, 0, 0, 1, 0x08, 0x00}, ip...)
+	}
+
+	var buf bytes.Buffer
+	w, err := pcap.NewWriter(&buf, pcap.LinkTypeEthernet, 0)
+	if err != nil {
+		t.Fatalf("writer err: %v", err)
+	}
+	packets := [][]byte{
+		eth(seg{fromC: true, seq: 1, flags: packet.TCPFlagSYN}.encode(t, client, server, false)),
+		// ARP is skipped.
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 2, 0, 0, 0, 0, 1, 0x08, 0x06, 0, 1},
+		eth(seg{seq: 100, ack: 2, flags: packet.TCPFlagSYN | packet.TCPFlagACK}.encode(t, client, server, false)),
+		eth(seg{fromC: true, seq: 2, ack: 101, flags: packet.TCPFlagACK, dataLen: 1250}.encode(t, client, server, false)),
+	}
+	for i, p := range packets {
+		at := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		if err := w.WritePacket(&pcap.Packet{Timestamp: at, Data: p}); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+	}
+
+	flows, err := ReadPcap(&buf)
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(flows))
+	}
+	f := flows[0]
+	if f.String() != "192.0.2.1:40000 -> 198.51.100.1:80" || f.HandshakeRTT != 300*time.Millisecond {
+		t.Fatalf("got %v with handshake rtt %v", f, f.HandshakeRTT)
+	}
+	// 1250 octets over 0.3 seconds.
+	if fwd, rev := f.Throughput(); fwd != 1250*8/0.3 || rev != 0 {
+		t.Fatalf("got throughput %v, %v", fwd, rev)
+	}
+}
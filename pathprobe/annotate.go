@@ -0,0 +1,114 @@
+package pathprobe
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/flow"
+	"github.com/dotwaffle/inettools/lpm"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Annotation describes an address that answered probes, for the people reading the path.
+type Annotation struct {
+	flow.Annotation        // The longest matching route and its origin AS, and whether the address is a bogon.
+	Name            string // The PTR name, without the trailing dot, or empty if there is none.
+	IXP             string // The name of the exchange whose peering LAN the address is on, if any.
+}
+
+// Annotator annotates the hops of path reports with the PTR names, origin ASNs, and bogon and exchange status of their
+// addresses. PTR names are cached, so a report can be annotated after every round without repeating lookups. It is safe
+// for concurrent use.
+type Annotator struct {
+	Resolver  *net.Resolver // Looks up PTR names, or net.DefaultResolver if nil.
+	SkipNames bool          // Do not look up PTR names.
+
+	routes *flow.Enricher
+	mu     sync.Mutex
+	ixps   *lpm.Table
+	names  map[string]*nameLookup
+}
+
+// nameLookup is a PTR lookup, which is done once for each address.
+type nameLookup struct {
+	done chan struct{}
+	name string
+}
+
+// NewAnnotator returns an Annotator finding the origin ASNs and bogons in routes, or only the default bogons if routes
+// is nil.
+func NewAnnotator(routes *flow.Enricher) *Annotator {
+	if routes == nil {
+		routes = flow.NewEnricher()
+	}
+	return &Annotator{routes: routes, ixps: lpm.New(), names: map[string]*nameLookup{}}
+}
+
+// AddIXP adds the peering LAN of an exchange.
+func (a *Annotator) AddIXP(pfx *net.IPNet, name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.ixps.Insert(pfx, name)
+}
+
+// Annotate sets the annotations of every hop of a report, looking up the names of all of their addresses in parallel.
+// Addresses whose names are still being looked up when the context is done are left without them, and the context's
+// error is returned.
+func (a *Annotator) Annotate(ctx context.Context, r *Report) error {
+	for i := range r.Hops {
+		hop := &r.Hops[i]
+		hop.Annotations = make([]Annotation, len(hop.Addrs))
+		for j, addr := range hop.Addrs {
+			hop.Annotations[j].Annotation = a.routes.Annotate(addr)
+			a.mu.Lock()
+			if entry, err := a.ixps.Lookup(addr); err == nil && entry != nil {
+				hop.Annotations[j].IXP = entry.Value.(string)
+			}
+			a.mu.Unlock()
+			if !a.SkipNames {
+				a.lookup(addr)
+			}
+		}
+	}
+	if a.SkipNames {
+		return nil
+	}
+
+	for i := range r.Hops {
+		hop := &r.Hops[i]
+		for j, addr := range hop.Addrs {
+			l := a.lookup(addr)
+			select {
+			case <-l.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			hop.Annotations[j].Name = l.name
+		}
+	}
+	return nil
+}
+
+// lookup returns the PTR lookup of an address, starting it if it has not been.
+func (a *Annotator) lookup(addr net.IP) *nameLookup {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	l, ok := a.names[addr.String()]
+	if ok {
+		return l
+	}
+	l = &nameLookup{done: make(chan struct{})}
+	a.names[addr.String()] = l
+	resolver := a.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	go func() {
+		defer close(l.done)
+		// A lookup that fails leaves the address without a name, as most router interfaces have none.
+		if names, err := resolver.LookupAddr(context.Background(), addr.String()); err == nil && len(names) > 0 {
+			l.name = strings.TrimSuffix(names[0], ".")
+		}
+	}()
+	return l
+}
@@ -0,0 +1,97 @@
+package pathprobe
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/flow"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// ptrResolver returns a resolver giving 198.51.100.1 a name, and every other address none, from a DNS server on the
+// loopback that counts the queries it answers.
+func ptrResolver(t *testing.T, queries *int32) *net.Resolver {
+	t.Helper()
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q, err := dnsutil.Unpack(buf[:n])
+			if err != nil || len(q.Questions) != 1 {
+				continue
+			}
+			atomic.AddInt32(queries, 1)
+			resp := &dnsutil.Message{ID: q.ID, Response: true, Questions: q.Questions, RCode: dnsutil.RCodeNameError}
+			if name := q.Questions[0].Name; name == "1.100.51.198.in-addr.arpa." {
+				resp.RCode = dnsutil.RCodeSuccess
+				resp.Answers = []dnsutil.RR{{Name: name, Type: dnsutil.TypePTR, Class: dnsutil.ClassINET, TTL: 60,
+					Data: &dnsutil.PTR{Host: "xe-0-0-0.r1.example."}}}
+			}
+			if b, err := resp.Pack(); err == nil {
+				server.WriteTo(b, addr)
+			}
+		}
+	}()
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", server.LocalAddr().String())
+		},
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	routes := flow.NewEnricher()
+	_, pfx, _ := net.ParseCIDR("198.51.100.0/25")
+	if err := routes.AddRoute(pfx, 64496); err != nil {
+		t.Fatalf("add route err: %v", err)
+	}
+	var queries int32
+	a := NewAnnotator(routes)
+	a.Resolver = ptrResolver(t, &queries)
+	_, ixp, _ := net.ParseCIDR("198.51.100.128/25")
+	if err := a.AddIXP(ixp, "EX-IX"); err != nil {
+		t.Fatalf("add ixp err: %v", err)
+	}
+
+	r := &Report{Hops: []Hop{
+		{TTL: 1, Addrs: []net.IP{net.ParseIP("10.0.0.1")}},
+		{TTL: 2},
+		{TTL: 3, Addrs: []net.IP{net.ParseIP("198.51.100.1"), net.ParseIP("198.51.100.130")}},
+	}}
+	for round := 0; round < 2; round++ {
+		if err := a.Annotate(context.Background(), r); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&queries); n != 3 {
+		t.Errorf("got %d queries, want 3", n)
+	}
+
+	want := [][]Annotation{
+		{{Annotation: flow.Annotation{Bogon: true}}},
+		{},
+		{
+			{Annotation: flow.Annotation{Prefix: pfx, ASN: 64496, Bogon: true}, Name: "xe-0-0-0.r1.example"},
+			{Annotation: flow.Annotation{Bogon: true}, IXP: "EX-IX"},
+		},
+	}
+	var got [][]Annotation
+	for _, hop := range r.Hops {
+		got = append(got, hop.Annotations)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
@@ -0,0 +1,158 @@
+package pathprobe
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Defaults used by a Monitor whose fields are not set.
+const (
+	DefaultMonitorInterval = 5 * time.Minute
+	DefaultRTTStep         = 20 * time.Millisecond
+)
+
+// Change is the difference between two reports of the path to a destination.
+type Change struct {
+	Previous *Report
+	Current  *Report
+	Hops     []HopChange // The hops whose addresses changed, in order of TTL.
+	RTTSteps []RTTStep   // The hops whose best round-trip time stepped up or down, in order of TTL.
+}
+
+// HopChange is a hop whose addresses changed. A hop the destination has since answered at a lower TTL, or had not
+// answered at, has no addresses in the report where it was absent.
+type HopChange struct {
+	TTL      int
+	Previous []net.IP
+	Current  []net.IP
+}
+
+// RTTStep is a hop whose best round-trip time changed by more than the step.
+type RTTStep struct {
+	TTL      int
+	Previous time.Duration
+	Current  time.Duration
+}
+
+// Reachability reports whether the destination answered in one report but not the other.
+func (c *Change) Reachability() bool {
+	return c.Previous.Reached != c.Current.Reached
+}
+
+// Diff compares two reports of the path to a destination, returning nil if nothing changed. Hops that did not answer
+// in either report are not compared, as routers often rate limit their answers. Hops are only considered to have
+// changed when none of their addresses are common to both reports, as a report may not see every path through ECMP.
+// Round-trip times are compared by the best of each hop, the least affected by queueing and the load on the routers,
+// and steps smaller than rttStep are ignored, as are all steps if it is not positive.
+func Diff(prev, cur *Report, rttStep time.Duration) *Change {
+	c := &Change{Previous: prev, Current: cur}
+	hops := len(prev.Hops)
+	if len(cur.Hops) > hops {
+		hops = len(cur.Hops)
+	}
+	for i := 0; i < hops; i++ {
+		p, pok := hop(prev, i)
+		q, qok := hop(cur, i)
+		if !pok || !qok {
+			continue
+		}
+		if p == nil || q == nil || !overlap(p.Addrs, q.Addrs) {
+			hc := HopChange{TTL: i + 1}
+			if p != nil {
+				hc.Previous = p.Addrs
+			}
+			if q != nil {
+				hc.Current = q.Addrs
+			}
+			if len(hc.Previous) > 0 || len(hc.Current) > 0 {
+				c.Hops = append(c.Hops, hc)
+			}
+			continue
+		}
+		if step := q.Best - p.Best; rttStep > 0 && (step >= rttStep || -step >= rttStep) {
+			c.RTTSteps = append(c.RTTSteps, RTTStep{TTL: i + 1, Previous: p.Best, Current: q.Best})
+		}
+	}
+	if len(c.Hops) == 0 && len(c.RTTSteps) == 0 && !c.Reachability() {
+		return nil
+	}
+	return c
+}
+
+// hop returns the hop of a report at an index, and whether it can be compared: it answered, or it is beyond the
+// destination, in which case it is nil.
+func hop(r *Report, i int) (*Hop, bool) {
+	if i >= len(r.Hops) {
+		return nil, r.Reached
+	}
+	h := &r.Hops[i]
+	return h, h.Received > 0
+}
+
+// overlap reports whether two sets of addresses have an address in common.
+func overlap(a, b []net.IP) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Equal(y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Monitor traces the path to a destination periodically, and reports how it changes from one trace to the next.
+type Monitor struct {
+	Prober   *Prober       // Traces the path, or a zero Prober if nil.
+	Interval time.Duration // The time between the starts of traces, or DefaultMonitorInterval if zero.
+	// The smallest change in the best round-trip time of a hop that is reported, or DefaultRTTStep if zero. Negative
+	// ignores round-trip times.
+	RTTStep time.Duration
+
+	// OnReport, if set, is called with each report, before it is compared with the last.
+	OnReport func(*Report)
+	// OnChange is called with each change in the path.
+	OnChange func(*Change)
+}
+
+// Run traces the path to dst until the context is done or a trace fails, returning the error. Each trace is compared
+// with the last that succeeded.
+func (m *Monitor) Run(ctx context.Context, dst net.IP) error {
+	p := m.Prober
+	if p == nil {
+		p = &Prober{}
+	}
+	interval, step := m.Interval, m.RTTStep
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	if step == 0 {
+		step = DefaultRTTStep
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *Report
+	for {
+		report, err := p.Run(ctx, dst)
+		if err != nil {
+			return err
+		}
+		if m.OnReport != nil {
+			m.OnReport(report)
+		}
+		if last != nil && m.OnChange != nil {
+			if c := Diff(last, report, step); c != nil {
+				m.OnChange(c)
+			}
+		}
+		last = report
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
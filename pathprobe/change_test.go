@@ -0,0 +1,105 @@
+package pathprobe
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// report returns a report of a path, where each hop is a list of addresses with the best round-trip time of the hop
+// in milliseconds, and a hop without addresses did not answer.
+func report(reached bool, hops ...[]string) *Report {
+	r := &Report{Reached: reached}
+	for i, addrs := range hops {
+		h := Hop{TTL: i + 1, Sent: 1}
+		for _, s := range addrs {
+			if ms, err := time.ParseDuration(s); err == nil {
+				h.Best = ms
+				continue
+			}
+			h.Addrs = append(h.Addrs, net.ParseIP(s))
+		}
+		if len(h.Addrs) > 0 {
+			h.Received = 1
+		}
+		r.Hops = append(r.Hops, h)
+	}
+	return r
+}
+
+func ips(strs ...string) []net.IP {
+	var addrs []net.IP
+	for _, s := range strs {
+		addrs = append(addrs, net.ParseIP(s))
+	}
+	return addrs
+}
+
+func TestDiff(t *testing.T) {
+	base := report(true, []string{"192.0.2.1", "1ms"}, []string{"192.0.2.2", "192.0.2.3", "5ms"},
+		[]string{"198.51.100.1", "10ms"})
+
+	tests := map[string]struct {
+		cur              *Report
+		wantHops         []HopChange
+		wantSteps        []RTTStep
+		wantReachability bool
+		wantNil          bool
+	}{
+		"Same": {
+			cur:     report(true, []string{"192.0.2.1", "2ms"}, []string{"192.0.2.3", "6ms"}, []string{"198.51.100.1", "12ms"}),
+			wantNil: true,
+		},
+		"Unanswered": {
+			cur:     report(true, []string{"192.0.2.1", "1ms"}, nil, []string{"198.51.100.1", "10ms"}),
+			wantNil: true,
+		},
+		"HopChanged": {
+			cur: report(true, []string{"192.0.2.1", "1ms"}, []string{"203.0.113.1", "5ms"},
+				[]string{"198.51.100.1", "10ms"}),
+			wantHops: []HopChange{{TTL: 2, Previous: ips("192.0.2.2", "192.0.2.3"), Current: ips("203.0.113.1")}},
+		},
+		"Longer": {
+			cur: report(true, []string{"192.0.2.1", "1ms"}, []string{"192.0.2.2", "5ms"},
+				[]string{"203.0.113.1", "8ms"}, []string{"198.51.100.1", "10ms"}),
+			wantHops: []HopChange{
+				{TTL: 3, Previous: ips("198.51.100.1"), Current: ips("203.0.113.1")},
+				{TTL: 4, Current: ips("198.51.100.1")},
+			},
+		},
+		"LatencyStep": {
+			cur: report(true, []string{"192.0.2.1", "1ms"}, []string{"192.0.2.2", "5ms"},
+				[]string{"198.51.100.1", "40ms"}),
+			wantSteps: []RTTStep{{TTL: 3, Previous: 10 * time.Millisecond, Current: 40 * time.Millisecond}},
+		},
+		"Lost": {
+			cur:              report(false, []string{"192.0.2.1", "1ms"}),
+			wantReachability: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := Diff(base, test.cur, 20*time.Millisecond)
+			if test.wantNil {
+				if c != nil {
+					t.Fatalf("got %+v, want no change", c)
+				}
+				return
+			}
+			if c == nil {
+				t.Fatalf("got no change")
+			}
+			if c.Reachability() != test.wantReachability {
+				t.Errorf("got reachability change %v, want %v", c.Reachability(), test.wantReachability)
+			}
+			if diff := cmp.Diff(test.wantHops, c.Hops); diff != "" {
+				t.Errorf("hops: %v", diff)
+			}
+			if diff := cmp.Diff(test.wantSteps, c.RTTSteps); diff != "" {
+				t.Errorf("steps: %v", diff)
+			}
+		})
+	}
+}
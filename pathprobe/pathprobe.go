@@ -0,0 +1,366 @@
+package pathprobe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/budget"
+	"github.com/dotwaffle/inettools/icmp"
+	"github.com/dotwaffle/inettools/sockopt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Prober whose fields are not set.
+const (
+	DefaultMaxHops  = 30
+	DefaultCount    = 10
+	DefaultInterval = time.Second
+	DefaultTimeout  = 2 * time.Second
+	DefaultSize     = 64
+)
+
+// echoLen is the length of an ICMP echo header, the smallest probe.
+const echoLen = 8
+
+// ErrUnsupportedPlatform is returned on platforms where the hop limit of probes cannot be set.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// Hop summarises the probes sent with one TTL. Hops that never answered have no addresses.
+type Hop struct {
+	TTL      int
+	Addrs    []net.IP // The addresses that answered, in the order they were first seen; more than one means ECMP.
+	Sent     int
+	Received int
+	Err      error            // The error reported by the last answer that was not a TTL expiry, such as unreachable.
+	MPLS     []icmp.MPLSLabel // The label stack from the last answer carrying RFC 4950 extensions.
+	// Annotations describe Addrs, in the same order, once the report has been annotated by an Annotator.
+	Annotations []Annotation
+
+	Last   time.Duration
+	Best   time.Duration
+	Worst  time.Duration
+	Mean   time.Duration
+	StdDev time.Duration
+
+	sum, sumSquares float64 // Of the round-trip times in nanoseconds, to update the mean and standard deviation.
+}
+
+// Loss returns the proportion of probes that were not answered.
+func (h *Hop) Loss() float64 {
+	if h.Sent == 0 {
+		return 0
+	}
+	return float64(h.Sent-h.Received) / float64(h.Sent)
+}
+
+// add records an answer to a probe.
+func (h *Hop) add(from net.IP, rtt time.Duration) {
+	seen := false
+	for _, addr := range h.Addrs {
+		seen = seen || addr.Equal(from)
+	}
+	if !seen {
+		h.Addrs = append(h.Addrs, from)
+	}
+	h.Received++
+	h.Last = rtt
+	if h.Received == 1 || rtt < h.Best {
+		h.Best = rtt
+	}
+	if rtt > h.Worst {
+		h.Worst = rtt
+	}
+	h.sum += float64(rtt)
+	h.sumSquares += float64(rtt) * float64(rtt)
+	mean := h.sum / float64(h.Received)
+	h.Mean = time.Duration(mean)
+	h.StdDev = time.Duration(math.Sqrt(math.Max(h.sumSquares/float64(h.Received)-mean*mean, 0)))
+}
+
+// Report is the state of a path probe, as of the end of a round.
+type Report struct {
+	Destination net.IP
+	Rounds      int
+	Reached     bool  // Whether the destination has answered.
+	Hops        []Hop // Indexed by TTL less one, ending at the destination once it has answered.
+}
+
+// Prober traces the path to a destination in rounds, as mtr does: each round sends an ICMP echo with each TTL up to
+// the destination, and the answers are gathered into per-hop statistics. It needs a raw ICMP socket, so on Linux the
+// CAP_NET_RAW capability. The zero value is usable.
+type Prober struct {
+	MaxHops  int           // The largest TTL probed, or DefaultMaxHops if zero.
+	Count    int           // The number of rounds, or DefaultCount if zero.
+	Interval time.Duration // The time between rounds, or DefaultInterval if zero.
+	Timeout  time.Duration // How long to wait for an answer, or DefaultTimeout if zero.
+	Size     int           // The size of each probe's ICMP message, or DefaultSize if zero.
+	// Source is the address the probes are sent from, or nil to let the host choose. It is checked against the
+	// destination and Socket.Device with sockopt.CheckSource.
+	Source net.IP
+	// Socket steers the probes, such as with a firewall mark or by binding to a VRF device.
+	Socket sockopt.Options
+	// Budget, if set, bounds the rate of the probes, and is typically shared with the other probers of the program.
+	Budget *budget.Budget
+
+	// Progress, if set, is called with a copy of the report after each round, before the next begins.
+	Progress func(*Report)
+}
+
+// pending is a probe awaiting an answer.
+type pending struct {
+	ttl  int
+	sent time.Time
+}
+
+// Run traces the path to dst. If the context is done before the last round, the report so far is returned along with
+// the context's error.
+func (p *Prober) Run(ctx context.Context, dst net.IP) (*Report, error) {
+	maxHops, count, interval, timeout, size := p.MaxHops, p.Count, p.Interval, p.Timeout, p.Size
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	if maxHops > 255 {
+		return nil, fmt.Errorf("max hops %d larger than 255", maxHops)
+	}
+	if count <= 0 {
+		count = DefaultCount
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if size == 0 {
+		size = DefaultSize
+	}
+	if size < echoLen {
+		return nil, fmt.Errorf("probe size %d smaller than the %d octet echo header", size, echoLen)
+	}
+
+	if err := sockopt.CheckSource(p.Source, dst, p.Socket.Device); err != nil {
+		return nil, err
+	}
+	var src string
+	if p.Source != nil {
+		src = p.Source.String()
+	}
+
+	v6 := dst.To4() == nil
+	network := "ip4:icmp"
+	if v6 {
+		network = "ip6:ipv6-icmp"
+	} else {
+		dst = dst.To4()
+	}
+	lc := net.ListenConfig{Control: p.Socket.Control}
+	pc, err := lc.ListenPacket(ctx, network, src)
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.IPConn)
+	defer conn.Close()
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	echo := &icmp.Echo{ID: binary.BigEndian.Uint16(id[:]), Data: make([]byte, size-echoLen)}
+	req := &icmp.Message{V6: v6, Type: icmp.TypeEcho, Body: echo}
+	if v6 {
+		req.Type = icmp.TypeV6Echo
+	}
+
+	report := &Report{Destination: dst, Hops: make([]Hop, maxHops)}
+	for i := range report.Hops {
+		report.Hops[i].TTL = i + 1
+	}
+	probes := map[uint16]pending{}
+	var mu sync.Mutex
+
+	// Answers are gathered until the socket is closed, after the last round.
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			now := time.Now()
+			if err != nil {
+				return
+			}
+			m, err := icmp.Parse(buf[:n], v6)
+			if err != nil {
+				continue
+			}
+			seq, ok := match(m, echo.ID)
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			if probe, ok := probes[seq]; ok && now.Sub(probe.sent) <= timeout {
+				delete(probes, seq)
+				answer(report, probe.ttl, addr.(*net.IPAddr).IP, now.Sub(probe.sent), m)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	// Probes unanswered by their deadline are forgotten, so that a late answer is not counted.
+	expire := func(now time.Time) {
+		for seq, probe := range probes {
+			if now.Sub(probe.sent) > timeout {
+				delete(probes, seq)
+			}
+		}
+	}
+
+	var seq uint16
+	start := time.Now()
+	for round := 0; round < count; round++ {
+		// Schedule from the start rather than the previous round, so that delays do not accumulate.
+		if wait := time.Until(start.Add(time.Duration(round) * interval)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				conn.Close()
+				<-received
+				return report.copy(), ctx.Err()
+			}
+		}
+
+		mu.Lock()
+		if round > 0 && p.Progress != nil {
+			p.Progress(report.copy())
+		}
+		expire(time.Now())
+		hops := len(report.Hops)
+		report.Rounds++
+		mu.Unlock()
+
+		for ttl := 1; ttl <= hops; ttl++ {
+			seq++
+			echo.Seq = seq
+			b, err := req.Marshal(nil, dst)
+			if err != nil {
+				return nil, err
+			}
+			if err := setHopLimit(conn, v6, ttl); err != nil {
+				return nil, err
+			}
+			if p.Budget != nil {
+				if err := p.Budget.Wait(ctx, dst); err != nil {
+					conn.Close()
+					<-received
+					return report.copy(), err
+				}
+			}
+			mu.Lock()
+			if ttl > len(report.Hops) {
+				// The destination answered a probe with a lower TTL during this round.
+				mu.Unlock()
+				break
+			}
+			probes[seq] = pending{ttl: ttl, sent: time.Now()}
+			report.Hops[ttl-1].Sent++
+			mu.Unlock()
+			// A failure to send, such as an unreachable route, is a loss like any other.
+			conn.WriteTo(b, &net.IPAddr{IP: dst})
+		}
+	}
+
+	select {
+	case <-time.After(timeout):
+	case <-ctx.Done():
+	}
+	conn.Close()
+	<-received
+	if p.Progress != nil {
+		p.Progress(report.copy())
+	}
+	return report.copy(), ctx.Err()
+}
+
+// match returns the sequence number of the probe an ICMP message answers, if it answers one with the given ID: either
+// an echo reply, or an error message quoting the echo.
+func match(m *icmp.Message, id uint16) (uint16, bool) {
+	v6 := m.V6
+	if echo, ok := m.Body.(*icmp.Echo); ok {
+		if (m.Type == icmp.TypeEchoReply && !v6 || m.Type == icmp.TypeV6EchoReply && v6) && echo.ID == id {
+			return echo.Seq, true
+		}
+		return 0, false
+	}
+	original := m.Original()
+	if original == nil {
+		return 0, false
+	}
+	inv, err := icmp.ParseInvoking(original)
+	if err != nil || len(inv.Payload) < echoLen {
+		return 0, false
+	}
+	if (inv.Payload[0] == icmp.TypeEcho && !v6 || inv.Payload[0] == icmp.TypeV6Echo && v6) &&
+		binary.BigEndian.Uint16(inv.Payload[4:]) == id {
+		return binary.BigEndian.Uint16(inv.Payload[6:]), true
+	}
+	return 0, false
+}
+
+// answer records the answer m from addr to a probe sent with the given TTL.
+func answer(report *Report, ttl int, addr net.IP, rtt time.Duration, m *icmp.Message) {
+	if ttl > len(report.Hops) {
+		// The destination has since answered a probe with a lower TTL.
+		return
+	}
+	hop := &report.Hops[ttl-1]
+	hop.add(addr, rtt)
+	if err := m.Err(); err != nil && !errors.Is(err, icmp.ErrTTLExceeded) {
+		hop.Err = err
+	}
+	var extensions []icmp.Extension
+	switch body := m.Body.(type) {
+	case *icmp.TimeExceeded:
+		extensions = body.Extensions
+	case *icmp.DestinationUnreachable:
+		extensions = body.Extensions
+	}
+	for _, ext := range extensions {
+		if labels, err := ext.MPLSLabels(); err == nil {
+			hop.MPLS = labels
+		}
+	}
+
+	// An echo reply or an unreachable from the destination ends the path; later hops were only ever the destination.
+	if addr.Equal(report.Destination) || hop.Err != nil {
+		report.Reached = report.Reached || addr.Equal(report.Destination)
+		report.Hops = report.Hops[:ttl]
+	}
+}
+
+// copy returns a copy of the report that does not share the hops.
+func (r *Report) copy() *Report {
+	c := *r
+	c.Hops = append([]Hop(nil), r.Hops...)
+	for i := range c.Hops {
+		c.Hops[i].Addrs = append([]net.IP(nil), c.Hops[i].Addrs...)
+		c.Hops[i].Annotations = append([]Annotation(nil), c.Hops[i].Annotations...)
+	}
+	if !c.Reached {
+		c.Hops = trim(c.Hops)
+	}
+	return &c
+}
+
+// trim removes the hops beyond the last that answered, which are not worth reporting when the destination was not
+// reached.
+func trim(hops []Hop) []Hop {
+	for len(hops) > 0 && hops[len(hops)-1].Received == 0 {
+		hops = hops[:len(hops)-1]
+	}
+	return hops
+}
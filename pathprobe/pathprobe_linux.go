@@ -0,0 +1,28 @@
+// +build linux
+
+package pathprobe
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// setHopLimit sets the TTL or hop limit of the packets subsequently sent on conn.
+func setHopLimit(conn *net.IPConn, v6 bool, ttl int) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	level, opt, name := syscall.IPPROTO_IP, syscall.IP_TTL, "setsockopt IP_TTL"
+	if v6 {
+		level, opt, name = syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, "setsockopt IPV6_UNICAST_HOPS"
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), level, opt, ttl)
+	}); err != nil {
+		return err
+	}
+	return os.NewSyscallError(name, serr)
+}
@@ -0,0 +1,166 @@
+// +build linux
+
+package pathprobe
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// chain builds a two hop path from the test's namespace, through a router in one network namespace to a host in
+// another. The test is skipped if that is not permitted.
+func chain(t *testing.T) {
+	t.Helper()
+	const router, host = "pptest1", "pptest2"
+	exec.Command("ip", "link", "del", "pptest0").Run()
+	for _, ns := range []string{router, host} {
+		exec.Command("ip", "netns", "del", ns).Run()
+		if out, err := exec.Command("ip", "netns", "add", ns).CombinedOutput(); err != nil {
+			t.Skipf("cannot create network namespace: %v: %s", err, out)
+		}
+		ns := ns
+		t.Cleanup(func() { exec.Command("ip", "netns", "del", ns).Run() })
+		// Duplicate address detection would leave the link-local addresses the routers need unusable for a while.
+		exec.Command("ip", "netns", "exec", ns, "sysctl", "-qw", "net.ipv6.conf.default.accept_dad=0").Run()
+	}
+	out, err := exec.Command("ip", "link", "add", "pptest0", "type", "veth", "peer", "name", "pptest1a").CombinedOutput()
+	if err != nil {
+		t.Skipf("cannot create veth pair: %v: %s", err, out)
+	}
+	t.Cleanup(func() { exec.Command("ip", "link", "del", "pptest0").Run() })
+
+	cmds := []string{
+		"link set pptest1a netns " + router,
+		"-n " + router + " link add pptest1b type veth peer name pptest2a",
+		"-n " + router + " link set pptest2a netns " + host,
+		"addr add 198.18.1.1/30 dev pptest0",
+		"addr add 2001:db8:1::1/64 dev pptest0 nodad",
+		"-n " + router + " addr add 198.18.1.2/30 dev pptest1a",
+		"-n " + router + " addr add 2001:db8:1::2/64 dev pptest1a nodad",
+		"-n " + router + " addr add 198.18.2.1/30 dev pptest1b",
+		"-n " + router + " addr add 2001:db8:2::1/64 dev pptest1b nodad",
+		"-n " + host + " addr add 198.18.2.2/30 dev pptest2a",
+		"-n " + host + " addr add 2001:db8:2::2/64 dev pptest2a nodad",
+		"link set pptest0 up",
+		"-n " + router + " link set pptest1a up",
+		"-n " + router + " link set pptest1b up",
+		"-n " + host + " link set pptest2a up",
+		"route add 198.18.2.0/30 via 198.18.1.2",
+		"route add 2001:db8:2::/64 via 2001:db8:1::2",
+		"-n " + host + " route add default via 198.18.2.1",
+		"-n " + host + " route add default via 2001:db8:2::1",
+	}
+	for _, cmd := range cmds {
+		if out, err := exec.Command("ip", strings.Fields(cmd)...).CombinedOutput(); err != nil {
+			t.Fatalf("ip %s: %v: %s", cmd, err, out)
+		}
+	}
+	for _, sysctl := range []string{"net.ipv4.ip_forward=1", "net.ipv6.conf.all.forwarding=1"} {
+		if out, err := exec.Command("ip", "netns", "exec", router, "sysctl", "-w", sysctl).CombinedOutput(); err != nil {
+			t.Fatalf("sysctl %s: %v: %s", sysctl, err, out)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	chain(t)
+	// Give the interfaces a moment to finish coming up.
+	time.Sleep(100 * time.Millisecond)
+
+	tests := map[string]struct {
+		dst       string
+		wantAddrs [][]string
+	}{
+		"IPv4": {
+			dst:       "198.18.2.2",
+			wantAddrs: [][]string{{"198.18.1.2"}, {"198.18.2.2"}},
+		},
+		"IPv6": {
+			dst:       "2001:db8:2::2",
+			wantAddrs: [][]string{{"2001:db8:1::2"}, {"2001:db8:2::2"}},
+		},
+		"Loopback": {
+			dst:       "127.0.0.1",
+			wantAddrs: [][]string{{"127.0.0.1"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var progress int
+			p := &Prober{
+				MaxHops:  8,
+				Count:    3,
+				Interval: 50 * time.Millisecond,
+				Timeout:  200 * time.Millisecond,
+				Progress: func(*Report) { progress++ },
+			}
+			report, err := p.Run(context.Background(), net.ParseIP(test.dst))
+			if errors.Is(err, syscall.EPERM) {
+				t.Skip("raw ICMP sockets require CAP_NET_RAW")
+			}
+			if err != nil {
+				t.Fatalf("run err: %v", err)
+			}
+			if !report.Reached || report.Rounds != 3 || progress != 3 {
+				t.Fatalf("got reached %v after %d rounds and %d progress reports, want reached after 3 of each",
+					report.Reached, report.Rounds, progress)
+			}
+			var addrs [][]string
+			for _, hop := range report.Hops {
+				var strs []string
+				for _, addr := range hop.Addrs {
+					strs = append(strs, addr.String())
+				}
+				addrs = append(addrs, strs)
+				if hop.Sent != 3 || hop.Received != 3 || hop.Best <= 0 || hop.Best > hop.Worst {
+					t.Fatalf("hop %d: got %d of %d answered, best %v, worst %v", hop.TTL, hop.Received, hop.Sent,
+						hop.Best, hop.Worst)
+				}
+			}
+			if diff := cmp.Diff(test.wantAddrs, addrs); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	chain(t)
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reports int
+	var changes []*Change
+	m := &Monitor{
+		Prober:   &Prober{MaxHops: 4, Count: 1, Timeout: 200 * time.Millisecond},
+		Interval: 50 * time.Millisecond,
+		OnReport: func(*Report) {
+			if reports++; reports == 2 {
+				cancel()
+				return
+			}
+			// The second trace finds no route to the host.
+			exec.Command("ip", "route", "del", "198.18.2.0/30").Run()
+		},
+		OnChange: func(c *Change) { changes = append(changes, c) },
+	}
+	err := m.Run(ctx, net.ParseIP("198.18.2.2"))
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("raw ICMP sockets require CAP_NET_RAW")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got err %v, want cancelled", err)
+	}
+	if len(changes) != 1 || !changes[0].Reachability() || changes[0].Current.Reached {
+		t.Fatalf("got changes %+v, want the destination lost", changes)
+	}
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package pathprobe
+
+import "net"
+
+// setHopLimit is only implemented on Linux.
+func setHopLimit(*net.IPConn, bool, int) error {
+	return ErrUnsupportedPlatform
+}
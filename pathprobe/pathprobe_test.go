@@ -0,0 +1,113 @@
+package pathprobe
+
+import (
+	"github.com/dotwaffle/inettools/icmp"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	const id = 0x1234
+	echo := func(v6 bool, typ uint8, id, seq uint16) []byte {
+		b, err := (&icmp.Message{V6: v6, Type: typ, Body: &icmp.Echo{ID: id, Seq: seq}}).Marshal(nil, nil)
+		if err != nil {
+			t.Fatalf("marshal err: %v", err)
+		}
+		return b
+	}
+	// The invoking packet is an IPv4 header with a TTL of one, followed by the echo request.
+	ipv4 := []byte{0x45, 0, 0, 28, 0, 0, 0, 0, 1, icmp.ProtocolICMP, 0, 0, 192, 0, 2, 1, 198, 51, 100, 1}
+	ipv6 := append([]byte{0x60, 0, 0, 0, 0, 8, icmp.ProtocolICMPv6, 1}, net.ParseIP("2001:db8::1")...)
+	ipv6 = append(ipv6, net.ParseIP("2001:db8::2")...)
+
+	tests := map[string]struct {
+		v6      bool
+		msg     *icmp.Message
+		wantSeq uint16
+		wantOK  bool
+	}{
+		"EchoReply": {
+			msg:     &icmp.Message{Type: icmp.TypeEchoReply, Body: &icmp.Echo{ID: id, Seq: 7}},
+			wantSeq: 7,
+			wantOK:  true,
+		},
+		"OtherID": {
+			msg: &icmp.Message{Type: icmp.TypeEchoReply, Body: &icmp.Echo{ID: id + 1, Seq: 7}},
+		},
+		"EchoRequest": {
+			msg: &icmp.Message{Type: icmp.TypeEcho, Body: &icmp.Echo{ID: id, Seq: 7}},
+		},
+		"TimeExceeded": {
+			msg: &icmp.Message{
+				Type: icmp.TypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Original: append(ipv4, echo(false, icmp.TypeEcho, id, 9)...)},
+			},
+			wantSeq: 9,
+			wantOK:  true,
+		},
+		"TimeExceededOtherID": {
+			msg: &icmp.Message{
+				Type: icmp.TypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Original: append(ipv4, echo(false, icmp.TypeEcho, id+1, 9)...)},
+			},
+		},
+		"V6EchoReply": {
+			v6:      true,
+			msg:     &icmp.Message{V6: true, Type: icmp.TypeV6EchoReply, Body: &icmp.Echo{ID: id, Seq: 3}},
+			wantSeq: 3,
+			wantOK:  true,
+		},
+		"V6Unreachable": {
+			v6: true,
+			msg: &icmp.Message{
+				V6:   true,
+				Type: icmp.TypeV6DestinationUnreachable,
+				Body: &icmp.DestinationUnreachable{Original: append(ipv6, echo(true, icmp.TypeV6Echo, id, 4)...)},
+			},
+			wantSeq: 4,
+			wantOK:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := test.msg.Marshal(nil, nil)
+			if err != nil {
+				t.Fatalf("marshal err: %v", err)
+			}
+			m, err := icmp.Parse(b, test.v6)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			seq, ok := match(m, id)
+			if diff := cmp.Diff([]interface{}{test.wantSeq, test.wantOK}, []interface{}{seq, ok}); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestHop(t *testing.T) {
+	h := &Hop{TTL: 1, Sent: 4}
+	for _, a := range []struct {
+		addr string
+		rtt  time.Duration
+	}{
+		{"192.0.2.1", 10 * time.Millisecond},
+		{"192.0.2.2", 30 * time.Millisecond},
+		{"192.0.2.1", 20 * time.Millisecond},
+	} {
+		h.add(net.ParseIP(a.addr), a.rtt)
+	}
+
+	got := []interface{}{
+		len(h.Addrs), h.Received, h.Loss(), h.Last, h.Best, h.Worst, h.Mean, h.StdDev.Round(time.Microsecond),
+	}
+	want := []interface{}{2, 3, 0.25, 20 * time.Millisecond, 10 * time.Millisecond, 30 * time.Millisecond,
+		20 * time.Millisecond, 8165 * time.Microsecond}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
@@ -0,0 +1,194 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/packet"
+	"io"
+	"time"
+)
+
+// DefaultSnapLen is the snapshot length written by a Writer given none, which is what tcpdump uses.
+const DefaultSnapLen = 262144
+
+// maxCapLen bounds the length of a packet record, so a corrupt file cannot cause a huge allocation.
+const maxCapLen = 1 << 26
+
+// Magic numbers of the file header, which are written in the byte order of the writer, and the lengths of the file
+// and record headers.
+const (
+	magicMicro   = 0xa1b2c3d4
+	magicNano    = 0xa1b23c4d
+	magicPcapNG  = 0x0a0d0d0a
+	headerLen    = 24
+	recordHdrLen = 16
+)
+
+// LinkType is the type of the link-layer header of each packet, from the tcpdump.org registry.
+type LinkType uint32
+
+// Link types.
+const (
+	LinkTypeNull     LinkType = 0   // A 4 octet address family in the byte order of the host, as on BSD loopback.
+	LinkTypeEthernet LinkType = 1   // Ethernet, possibly with VLAN tags.
+	LinkTypeRaw      LinkType = 101 // An IPv4 or IPv6 packet with no link-layer header.
+	LinkTypeLinuxSLL LinkType = 113 // The Linux cooked header, as captured on the any interface.
+)
+
+// Packet is a captured packet.
+type Packet struct {
+	Timestamp time.Time
+	Data      []byte // The captured octets, which are fewer than Length if the packet was truncated.
+	Length    int    // The length of the packet on the wire.
+}
+
+// Reader reads packets from a file in the classic pcap format, as written by tcpdump -w. The pcapng format is not
+// supported.
+type Reader struct {
+	LinkType LinkType
+	SnapLen  int
+	r        io.Reader
+	order    binary.ByteOrder
+	nano     bool
+	hdr      [recordHdrLen]byte
+}
+
+// NewReader reads the file header from r, and returns a Reader for the packets that follow.
+func NewReader(r io.Reader) (*Reader, error) {
+	var hdr [headerLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+	pr := &Reader{r: r}
+	switch magic := binary.LittleEndian.Uint32(hdr[:]); {
+	case magic == magicMicro || magic == magicNano:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[:]) == magicMicro || binary.BigEndian.Uint32(hdr[:]) == magicNano:
+		pr.order = binary.BigEndian
+	case magic == magicPcapNG:
+		return nil, errors.New("pcapng files are not supported")
+	default:
+		return nil, fmt.Errorf("not a pcap file: magic %#08x", magic)
+	}
+	pr.nano = pr.order.Uint32(hdr[:]) == magicNano
+	pr.SnapLen = int(pr.order.Uint32(hdr[16:]))
+	// The upper bits of the link type hold the FCS length, which is ignored.
+	pr.LinkType = LinkType(pr.order.Uint32(hdr[20:]) & 0x0fffffff)
+	return pr, nil
+}
+
+// Next returns the next packet, or io.EOF after the last.
+func (r *Reader) Next() (*Packet, error) {
+	if _, err := io.ReadFull(r.r, r.hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("packet record truncated")
+		}
+		return nil, err
+	}
+	sec, frac := r.order.Uint32(r.hdr[0:]), r.order.Uint32(r.hdr[4:])
+	capLen, length := r.order.Uint32(r.hdr[8:]), r.order.Uint32(r.hdr[12:])
+	if capLen > maxCapLen {
+		return nil, fmt.Errorf("invalid packet length %d", capLen)
+	}
+	p := &Packet{Data: make([]byte, capLen), Length: int(length)}
+	if _, err := io.ReadFull(r.r, p.Data); err != nil {
+		return nil, errors.New("packet data truncated")
+	}
+	if r.nano {
+		p.Timestamp = time.Unix(int64(sec), int64(frac))
+	} else {
+		p.Timestamp = time.Unix(int64(sec), int64(frac)*int64(time.Microsecond))
+	}
+	return p, nil
+}
+
+// Writer writes packets to a file in the classic pcap format, with microsecond timestamps.
+type Writer struct {
+	w       io.Writer
+	snapLen int
+}
+
+// NewWriter writes the file header to w, and returns a Writer for the packets. A snapLen of zero means
+// DefaultSnapLen, and longer packets are truncated to it.
+func NewWriter(w io.Writer, linkType LinkType, snapLen int) (*Writer, error) {
+	if snapLen <= 0 {
+		snapLen = DefaultSnapLen
+	}
+	var hdr [headerLen]byte
+	binary.LittleEndian.PutUint32(hdr[0:], magicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], uint32(snapLen))
+	binary.LittleEndian.PutUint32(hdr[20:], uint32(linkType))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, snapLen: snapLen}, nil
+}
+
+// WritePacket writes a packet. A Length of zero means the length of its data.
+func (w *Writer) WritePacket(p *Packet) error {
+	data := p.Data
+	if len(data) > w.snapLen {
+		data = data[:w.snapLen]
+	}
+	length := p.Length
+	if length == 0 {
+		length = len(p.Data)
+	}
+	var hdr [recordHdrLen]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(p.Timestamp.Unix()))
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(p.Timestamp.Nanosecond()/int(time.Microsecond)))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(length))
+	if _, err := w.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(data)
+	return err
+}
+
+// Network returns the IPv4 or IPv6 packet following the link-layer header of a captured packet, skipping any VLAN
+// tags. It returns an error for packets of other protocols, such as ARP.
+func (t LinkType) Network(data []byte) ([]byte, error) {
+	var etherType uint16
+	switch t {
+	case LinkTypeRaw:
+		return data, nil
+	case LinkTypeNull:
+		if len(data) < 4 {
+			return nil, errors.New("loopback header truncated")
+		}
+		// The family is in the byte order of the capturing host, and IPv6 has several values across the BSDs.
+		family := binary.LittleEndian.Uint32(data)
+		if family > 0xffff {
+			family = binary.BigEndian.Uint32(data)
+		}
+		switch family {
+		case 2, 24, 28, 30:
+			return data[4:], nil
+		}
+		return nil, fmt.Errorf("unsupported address family %d", family)
+	case LinkTypeEthernet:
+		eth := packet.Ethernet(data)
+		if err := eth.Valid(); err != nil {
+			return nil, err
+		}
+		etherType, data = eth.EtherType(), eth.Payload()
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, errors.New("linux cooked header truncated")
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	default:
+		return nil, fmt.Errorf("unsupported link type %d", t)
+	}
+	for etherType == packet.EtherTypeVLAN && len(data) >= 4 {
+		etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+	}
+	if etherType != packet.EtherTypeIPv4 && etherType != packet.EtherTypeIPv6 {
+		return nil, fmt.Errorf("unsupported ethertype %#04x", etherType)
+	}
+	return data, nil
+}
@@ -0,0 +1,154 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReadWrite(t *testing.T) {
+	packets := []*Packet{
+		{Timestamp: time.Unix(1600000000, 123456000), Data: []byte{1, 2, 3, 4}, Length: 4},
+		{Timestamp: time.Unix(1600000001, 0), Data: []byte{5, 6, 7, 8, 9, 10}, Length: 1500},
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, LinkTypeRaw, 6)
+	if err != nil {
+		t.Fatalf("writer err: %v", err)
+	}
+	for _, p := range packets {
+		if err := w.WritePacket(p); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+	}
+	// A packet longer than the snapshot length is truncated.
+	if err := w.WritePacket(&Packet{Timestamp: time.Unix(1600000002, 0), Data: make([]byte, 8)}); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("reader err: %v", err)
+	}
+	if r.LinkType != LinkTypeRaw || r.SnapLen != 6 {
+		t.Fatalf("got link type %d, snap length %d", r.LinkType, r.SnapLen)
+	}
+	var got []*Packet
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next err: %v", err)
+		}
+		got = append(got, p)
+	}
+	want := append(packets, &Packet{Timestamp: time.Unix(1600000002, 0), Data: make([]byte, 6), Length: 8})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestReader(t *testing.T) {
+	tests := map[string]struct {
+		file    string
+		want    *Packet
+		wantErr bool
+	}{
+		"BigEndianNano": {
+			file: "a1b23c4d00020004000000000000000000000400000000e5" +
+				"5f5e1000000003e8000000020000003c" + "abcd",
+			want: &Packet{Timestamp: time.Unix(1600000000, 1000), Data: []byte{0xab, 0xcd}, Length: 60},
+		},
+		"PcapNG": {
+			file:    "0a0d0d0a1c0000004d3c2b1a01000000ffffffffffffffff",
+			wantErr: true,
+		},
+		"TruncatedData": {
+			file:    "d4c3b2a1020004000000000000000000000004000100000000000000000000000400000004000000abcd",
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, _ := hex.DecodeString(test.file)
+			r, err := NewReader(bytes.NewReader(b))
+			var got *Packet
+			if err == nil {
+				got, err = r.Next()
+			}
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: %v, want error %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	ip := []byte{0x45, 0, 0, 20}
+	tests := map[string]struct {
+		linkType LinkType
+		data     []byte
+		want     []byte
+		wantErr  bool
+	}{
+		"Raw": {
+			linkType: LinkTypeRaw,
+			data:     ip,
+			want:     ip,
+		},
+		"Ethernet": {
+			linkType: LinkTypeEthernet,
+			data:     append(make([]byte, 12), append([]byte{0x08, 0x00}, ip...)...),
+			want:     ip,
+		},
+		"EthernetQinQ": {
+			linkType: LinkTypeEthernet,
+			data:     append(make([]byte, 12), append([]byte{0x81, 0, 0, 1, 0x81, 0, 0, 2, 0x86, 0xdd}, ip...)...),
+			want:     ip,
+		},
+		"EthernetARP": {
+			linkType: LinkTypeEthernet,
+			data:     append(make([]byte, 12), 0x08, 0x06, 0, 1),
+			wantErr:  true,
+		},
+		"LinuxSLL": {
+			linkType: LinkTypeLinuxSLL,
+			data:     append(append(make([]byte, 14), 0x08, 0x00), ip...),
+			want:     ip,
+		},
+		"NullLittleEndian": {
+			linkType: LinkTypeNull,
+			data:     append([]byte{30, 0, 0, 0}, ip...),
+			want:     ip,
+		},
+		"NullBigEndian": {
+			linkType: LinkTypeNull,
+			data:     append([]byte{0, 0, 0, 2}, ip...),
+			want:     ip,
+		},
+		"Unsupported": {
+			linkType: 105,
+			data:     ip,
+			wantErr:  true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.linkType.Network(test.data)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: %v, want error %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
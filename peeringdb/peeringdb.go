@@ -0,0 +1,433 @@
+package peeringdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Client whose fields are not set.
+const (
+	DefaultURL      = "https://www.peeringdb.com/api"
+	DefaultTimeout  = 30 * time.Second
+	DefaultCacheTTL = 6 * time.Hour
+)
+
+// ErrNotFound is returned when looking up an object that PeeringDB does not have.
+var ErrNotFound = errors.New("not found")
+
+// Peering policies of networks.
+const (
+	PolicyOpen        = "Open"
+	PolicySelective   = "Selective"
+	PolicyRestrictive = "Restrictive"
+	PolicyNo          = "No"
+)
+
+// Network is a network, identified by its ASN, and its peering policy.
+type Network struct {
+	ID              int       `json:"id"`
+	OrgID           int       `json:"org_id"`
+	Name            string    `json:"name"`
+	AKA             string    `json:"aka"`
+	ASN             uint32    `json:"asn"`
+	Website         string    `json:"website"`
+	LookingGlass    string    `json:"looking_glass"`
+	RouteServer     string    `json:"route_server"`
+	IRRASSet        string    `json:"irr_as_set"` // The AS-SET to build prefix filters from, such as "RIPE::AS-EXAMPLE".
+	InfoType        string    `json:"info_type"`  // Such as "NSP", "Content", or "Cable/DSL/ISP".
+	InfoPrefixes4   int       `json:"info_prefixes4"`
+	InfoPrefixes6   int       `json:"info_prefixes6"`
+	InfoTraffic     string    `json:"info_traffic"`
+	InfoRatio       string    `json:"info_ratio"`
+	InfoScope       string    `json:"info_scope"`
+	InfoUnicast     bool      `json:"info_unicast"`
+	InfoMulticast   bool      `json:"info_multicast"`
+	InfoIPv6        bool      `json:"info_ipv6"`
+	PolicyURL       string    `json:"policy_url"`
+	PolicyGeneral   string    `json:"policy_general"` // One of the Policy constants.
+	PolicyLocations string    `json:"policy_locations"`
+	PolicyRatio     bool      `json:"policy_ratio"`
+	PolicyContracts string    `json:"policy_contracts"`
+	Updated         time.Time `json:"updated"`
+}
+
+// IX is an internet exchange.
+type IX struct {
+	ID       int       `json:"id"`
+	OrgID    int       `json:"org_id"`
+	Name     string    `json:"name"`
+	NameLong string    `json:"name_long"`
+	City     string    `json:"city"`
+	Country  string    `json:"country"`
+	Region   string    `json:"region_continent"`
+	Media    string    `json:"media"`
+	Website  string    `json:"website"`
+	Updated  time.Time `json:"updated"`
+}
+
+// IXLAN is a peering LAN of an internet exchange.
+type IXLAN struct {
+	ID           int       `json:"id"`
+	IXID         int       `json:"ix_id"`
+	Name         string    `json:"name"`
+	Descr        string    `json:"descr"`
+	MTU          int       `json:"mtu"`
+	Dot1QSupport bool      `json:"dot1q_support"`
+	RSASN        uint32    `json:"rs_asn"` // The ASN of the route servers, or zero if there are none.
+	ARPSponge    string    `json:"arp_sponge"`
+	Updated      time.Time `json:"updated"`
+}
+
+// NetIXLAN is the presence of a network on a peering LAN.
+type NetIXLAN struct {
+	ID          int       `json:"id"`
+	NetID       int       `json:"net_id"`
+	IXID        int       `json:"ix_id"`
+	IXLANID     int       `json:"ixlan_id"`
+	Name        string    `json:"name"` // The name of the exchange.
+	ASN         uint32    `json:"asn"`
+	Speed       int       `json:"speed"` // In megabits per second.
+	IPAddr4     string    `json:"ipaddr4"`
+	IPAddr6     string    `json:"ipaddr6"`
+	IsRSPeer    bool      `json:"is_rs_peer"` // Whether the network peers with the route servers.
+	Operational bool      `json:"operational"`
+	Updated     time.Time `json:"updated"`
+}
+
+// Facility is a data centre or other building networks and exchanges are present in.
+type Facility struct {
+	ID        int       `json:"id"`
+	OrgID     int       `json:"org_id"`
+	Name      string    `json:"name"`
+	Website   string    `json:"website"`
+	CLLI      string    `json:"clli"`
+	Address1  string    `json:"address1"`
+	Address2  string    `json:"address2"`
+	City      string    `json:"city"`
+	State     string    `json:"state"`
+	Zipcode   string    `json:"zipcode"`
+	Country   string    `json:"country"`
+	Latitude  *float64  `json:"latitude"`
+	Longitude *float64  `json:"longitude"`
+	Updated   time.Time `json:"updated"`
+}
+
+// NetFac is the presence of a network in a facility.
+type NetFac struct {
+	ID       int       `json:"id"`
+	NetID    int       `json:"net_id"`
+	FacID    int       `json:"fac_id"`
+	Name     string    `json:"name"` // The name of the facility.
+	City     string    `json:"city"`
+	Country  string    `json:"country"`
+	LocalASN uint32    `json:"local_asn"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Client is a read-only client of the PeeringDB API. Responses are cached in memory, and in files if CacheDir is set,
+// so that repeated lookups do not run into the API's rate limits. The zero value queries PeeringDB anonymously.
+type Client struct {
+	URL      string        // The URL of the API, or DefaultURL if empty.
+	APIKey   string        // An API key, which raises the rate limits, or empty to query anonymously.
+	Client   *http.Client  // The client to query with, or http.DefaultClient if nil.
+	Timeout  time.Duration // How long a query may take, or DefaultTimeout if zero.
+	CacheTTL time.Duration // How long responses are cached for, or DefaultCacheTTL if zero; negative disables it.
+	// A directory responses are also cached in, so that they survive restarts, or empty to cache only in memory.
+	CacheDir string
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// cached is a cached response.
+type cached struct {
+	body    []byte
+	fetched time.Time
+}
+
+// Network returns the network with an ASN.
+func (c *Client) Network(ctx context.Context, asn uint32) (*Network, error) {
+	var nets []Network
+	if err := c.get(ctx, "net", url.Values{"asn": {strconv.FormatUint(uint64(asn), 10)}}, &nets); err != nil {
+		return nil, err
+	}
+	if len(nets) == 0 {
+		return nil, fmt.Errorf("%w: network AS%d", ErrNotFound, asn)
+	}
+	return &nets[0], nil
+}
+
+// IX returns the exchange with an ID.
+func (c *Client) IX(ctx context.Context, id int) (*IX, error) {
+	var ixs []IX
+	if err := c.getByID(ctx, "ix", id, &ixs); err != nil {
+		return nil, err
+	}
+	if len(ixs) == 0 {
+		return nil, fmt.Errorf("%w: ix %d", ErrNotFound, id)
+	}
+	return &ixs[0], nil
+}
+
+// IXLAN returns the peering LAN with an ID.
+func (c *Client) IXLAN(ctx context.Context, id int) (*IXLAN, error) {
+	var lans []IXLAN
+	if err := c.getByID(ctx, "ixlan", id, &lans); err != nil {
+		return nil, err
+	}
+	if len(lans) == 0 {
+		return nil, fmt.Errorf("%w: ixlan %d", ErrNotFound, id)
+	}
+	return &lans[0], nil
+}
+
+// Facility returns the facility with an ID.
+func (c *Client) Facility(ctx context.Context, id int) (*Facility, error) {
+	var facs []Facility
+	if err := c.getByID(ctx, "fac", id, &facs); err != nil {
+		return nil, err
+	}
+	if len(facs) == 0 {
+		return nil, fmt.Errorf("%w: facility %d", ErrNotFound, id)
+	}
+	return &facs[0], nil
+}
+
+// IXLANs returns the peering LANs of an exchange.
+func (c *Client) IXLANs(ctx context.Context, ixID int) ([]IXLAN, error) {
+	var lans []IXLAN
+	err := c.get(ctx, "ixlan", url.Values{"ix_id": {strconv.Itoa(ixID)}}, &lans)
+	return lans, err
+}
+
+// Presence returns the peering LANs a network is present on, with its addresses on each.
+func (c *Client) Presence(ctx context.Context, asn uint32) ([]NetIXLAN, error) {
+	var presence []NetIXLAN
+	err := c.get(ctx, "netixlan", url.Values{"asn": {strconv.FormatUint(uint64(asn), 10)}}, &presence)
+	return presence, err
+}
+
+// Members returns the networks present on a peering LAN.
+func (c *Client) Members(ctx context.Context, ixlanID int) ([]NetIXLAN, error) {
+	var members []NetIXLAN
+	err := c.get(ctx, "netixlan", url.Values{"ixlan_id": {strconv.Itoa(ixlanID)}}, &members)
+	return members, err
+}
+
+// Facilities returns the facilities a network is present in.
+func (c *Client) Facilities(ctx context.Context, asn uint32) ([]NetFac, error) {
+	var facs []NetFac
+	err := c.get(ctx, "netfac", url.Values{"local_asn": {strconv.FormatUint(uint64(asn), 10)}}, &facs)
+	return facs, err
+}
+
+// CommonIXs returns the exchange IDs where both networks are present, in the order the first network's presence is
+// listed, such as to find where two networks could peer.
+func (c *Client) CommonIXs(ctx context.Context, a, b uint32) ([]int, error) {
+	pa, err := c.Presence(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	pb, err := c.Presence(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	inB := map[int]bool{}
+	for _, p := range pb {
+		inB[p.IXID] = true
+	}
+	var ids []int
+	seen := map[int]bool{}
+	for _, p := range pa {
+		if inB[p.IXID] && !seen[p.IXID] {
+			seen[p.IXID] = true
+			ids = append(ids, p.IXID)
+		}
+	}
+	return ids, nil
+}
+
+// getByID queries for the object of a type with an ID.
+func (c *Client) getByID(ctx context.Context, typ string, id int, v interface{}) error {
+	return c.get(ctx, typ, url.Values{"id": {strconv.Itoa(id)}}, v)
+}
+
+// get queries for objects of a type, decoding the data of the response into v, from the cache if it is there.
+func (c *Client) get(ctx context.Context, typ string, query url.Values, v interface{}) error {
+	base := c.URL
+	if base == "" {
+		base = DefaultURL
+	}
+	u := strings.TrimSuffix(base, "/") + "/" + typ + "?" + query.Encode()
+
+	body, ok := c.cached(u)
+	if !ok {
+		var err error
+		if body, err = c.fetch(ctx, u); err != nil {
+			return err
+		}
+		c.store(u, body)
+	}
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("%s: %w", u, err)
+	}
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		return fmt.Errorf("%s: %w", u, err)
+	}
+	return nil
+}
+
+// fetch queries the API.
+func (c *Client) fetch(ctx context.Context, u string) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Api-Key "+c.APIKey)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Errors are explained in the meta object of the response.
+		var e struct {
+			Meta struct {
+				Error string `json:"error"`
+			} `json:"meta"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Meta.Error != "" {
+			return nil, fmt.Errorf("fetch %s: %s: %s", u, resp.Status, e.Meta.Error)
+		}
+		return nil, fmt.Errorf("fetch %s: %s", u, resp.Status)
+	}
+	return body, nil
+}
+
+// ttl returns how long responses are cached for, or zero if they are not.
+func (c *Client) ttl() time.Duration {
+	switch {
+	case c.CacheTTL < 0:
+		return 0
+	case c.CacheTTL == 0:
+		return DefaultCacheTTL
+	}
+	return c.CacheTTL
+}
+
+// cacheFile returns the name of the file a response is cached in.
+func (c *Client) cacheFile(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(c.CacheDir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// cached returns the cached response to a query, if there is one that has not expired.
+func (c *Client) cached(u string) ([]byte, bool) {
+	ttl := c.ttl()
+	if ttl == 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	entry, ok := c.cache[u]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetched) < ttl {
+		return entry.body, true
+	}
+	if c.CacheDir == "" {
+		return nil, false
+	}
+
+	f, err := os.Open(c.cacheFile(u))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || time.Since(fi.ModTime()) >= ttl {
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = map[string]cached{}
+	}
+	c.cache[u] = cached{body: body, fetched: fi.ModTime()}
+	c.mu.Unlock()
+	return body, true
+}
+
+// store caches the response to a query. Failing to write the cache file is not an error, as the response is still
+// cached in memory.
+func (c *Client) store(u string, body []byte) {
+	if c.ttl() == 0 {
+		return
+	}
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = map[string]cached{}
+	}
+	c.cache[u] = cached{body: body, fetched: time.Now()}
+	c.mu.Unlock()
+	if c.CacheDir == "" {
+		return
+	}
+
+	name := c.cacheFile(u)
+	tmp, err := ioutil.TempFile(c.CacheDir, filepath.Base(name)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return
+	}
+	if tmp.Close() == nil {
+		os.Rename(tmp.Name(), name)
+	}
+}
+
+// Flush empties the in-memory cache, so that responses are fetched again or read from the cache directory.
+func (c *Client) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache = nil
+}
@@ -0,0 +1,166 @@
+package peeringdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// responses are the API's responses to the queries made by the tests.
+var responses = map[string]string{
+	"/net?asn=64496": `{"meta":{},"data":[{"id":10,"asn":64496,"name":"Example Networks",` +
+		`"irr_as_set":"RIPE::AS-EXAMPLE","policy_general":"Open","info_prefixes4":20,"info_ipv6":true,` +
+		`"updated":"2021-06-01T12:00:00Z"}]}`,
+	"/net?asn=64511": `{"meta":{},"data":[]}`,
+	"/netixlan?asn=64496": `{"meta":{},"data":[` +
+		`{"id":1,"net_id":10,"ix_id":1,"ixlan_id":1,"name":"IX One","asn":64496,"speed":10000,` +
+		`"ipaddr4":"192.0.2.10","ipaddr6":"2001:db8::10","is_rs_peer":true,"operational":true},` +
+		`{"id":2,"net_id":10,"ix_id":2,"ixlan_id":2,"name":"IX Two","asn":64496,"speed":1000,` +
+		`"ipaddr4":"198.51.100.10"},` +
+		`{"id":3,"net_id":10,"ix_id":1,"ixlan_id":1,"name":"IX One","asn":64496,"speed":10000,"ipaddr4":"192.0.2.11"}]}`,
+	"/netixlan?asn=64497": `{"meta":{},"data":[` +
+		`{"id":4,"net_id":11,"ix_id":1,"ixlan_id":1,"name":"IX One","asn":64497,"ipaddr4":"192.0.2.20"},` +
+		`{"id":5,"net_id":11,"ix_id":3,"ixlan_id":3,"name":"IX Three","asn":64497,"ipaddr4":"203.0.113.20"}]}`,
+	"/ix?id=1":       `{"meta":{},"data":[{"id":1,"name":"IX One","city":"London","country":"GB"}]}`,
+	"/ixlan?ix_id=1": `{"meta":{},"data":[{"id":1,"ix_id":1,"mtu":1500,"rs_asn":64500}]}`,
+	"/netfac?local_asn=64496": `{"meta":{},"data":[{"id":7,"net_id":10,"fac_id":3,"name":"Example DC",` +
+		`"city":"London","country":"GB","local_asn":64496}]}`,
+	"/fac?id=3": `{"meta":{},"data":[{"id":3,"name":"Example DC","city":"London","country":"GB","latitude":51.5,` +
+		`"longitude":null}]}`,
+}
+
+func newServer(t *testing.T, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if r.Header.Get("Authorization") == "Api-Key bad" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"meta":{"error":"Invalid API key"},"data":[]}`)
+			return
+		}
+		body, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			t.Errorf("unexpected query %s", r.URL.RequestURI())
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestClient(t *testing.T) {
+	var hits int32
+	srv := newServer(t, &hits)
+	defer srv.Close()
+	c := &Client{URL: srv.URL}
+	ctx := context.Background()
+
+	n, err := c.Network(ctx, 64496)
+	if err != nil {
+		t.Fatalf("network err: %v", err)
+	}
+	if n.Name != "Example Networks" || n.IRRASSet != "RIPE::AS-EXAMPLE" || n.PolicyGeneral != PolicyOpen ||
+		n.InfoPrefixes4 != 20 || !n.InfoIPv6 || n.Updated.Year() != 2021 {
+		t.Fatalf("got %+v", n)
+	}
+	if _, err := c.Network(ctx, 64511); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrNotFound)
+	}
+
+	presence, err := c.Presence(ctx, 64496)
+	if err != nil {
+		t.Fatalf("presence err: %v", err)
+	}
+	if len(presence) != 3 || presence[0].IPAddr6 != "2001:db8::10" || !presence[0].IsRSPeer ||
+		presence[0].Speed != 10000 {
+		t.Fatalf("got %+v", presence)
+	}
+	common, err := c.CommonIXs(ctx, 64496, 64497)
+	if err != nil {
+		t.Fatalf("common err: %v", err)
+	}
+	if diff := cmp.Diff([]int{1}, common); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	ix, err := c.IX(ctx, 1)
+	if err != nil || ix.City != "London" {
+		t.Fatalf("got %+v, %v", ix, err)
+	}
+	lans, err := c.IXLANs(ctx, 1)
+	if err != nil || len(lans) != 1 || lans[0].RSASN != 64500 {
+		t.Fatalf("got %+v, %v", lans, err)
+	}
+	facs, err := c.Facilities(ctx, 64496)
+	if err != nil || len(facs) != 1 || facs[0].FacID != 3 {
+		t.Fatalf("got %+v, %v", facs, err)
+	}
+	fac, err := c.Facility(ctx, facs[0].FacID)
+	if err != nil || fac.Latitude == nil || *fac.Latitude != 51.5 || fac.Longitude != nil {
+		t.Fatalf("got %+v, %v", fac, err)
+	}
+
+	// Everything asked again comes from the cache.
+	before := atomic.LoadInt32(&hits)
+	if _, err := c.Presence(ctx, 64496); err != nil {
+		t.Fatalf("presence err: %v", err)
+	}
+	if _, err := c.Network(ctx, 64496); err != nil {
+		t.Fatalf("network err: %v", err)
+	}
+	if got := atomic.LoadInt32(&hits); got != before {
+		t.Fatalf("got %d queries, want none", got-before)
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	var hits int32
+	srv := newServer(t, &hits)
+	defer srv.Close()
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		client   *Client
+		wantHits int32
+	}{
+		"Fetch":    {client: &Client{URL: srv.URL, CacheDir: dir}, wantHits: 1},
+		"File":     {client: &Client{URL: srv.URL, CacheDir: dir}},
+		"Disabled": {client: &Client{URL: srv.URL, CacheDir: dir, CacheTTL: -1}, wantHits: 2},
+	}
+
+	// The tests share the cache directory, so run in order.
+	for _, name := range []string{"Fetch", "File", "Disabled"} {
+		test := tests[name]
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				if _, err := test.client.IX(ctx, 1); err != nil {
+					t.Fatalf("ix err: %v", err)
+				}
+			}
+			if got := atomic.LoadInt32(&hits); got != test.wantHits {
+				t.Fatalf("got %d queries, want %d", got, test.wantHits)
+			}
+			atomic.StoreInt32(&hits, 0)
+		})
+	}
+}
+
+func TestClientError(t *testing.T) {
+	var hits int32
+	srv := newServer(t, &hits)
+	defer srv.Close()
+	c := &Client{URL: srv.URL, APIKey: "bad"}
+	_, err := c.Network(context.Background(), 64496)
+	if err == nil {
+		t.Fatalf("got no error")
+	}
+	if want := "Invalid API key"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %v, want %q", err, want)
+	}
+}
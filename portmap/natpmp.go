@@ -0,0 +1,100 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// NAT-PMP opcodes.
+const (
+	natpmpExternalAddress = 0
+	natpmpMapUDP          = 1
+	natpmpMapTCP          = 2
+)
+
+// NATPMP is a NAT-PMP (RFC 6886) client. The zero value asks the default gateway.
+type NATPMP struct {
+	Gateway string        // The host and port of the server, or the default gateway if empty; the port defaults to 5351.
+	RTO     time.Duration // The wait before the first retransmission, or DefaultRTO if zero; it doubles after each.
+	Retries int           // The number of retransmissions, or DefaultRetries if zero.
+}
+
+// ExternalAddress returns the external address of the gateway.
+func (c *NATPMP) ExternalAddress(ctx context.Context) (net.IP, error) {
+	resp, err := c.exchange(ctx, []byte{0, natpmpExternalAddress}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IP(append([]byte(nil), resp[8:12]...)), nil
+}
+
+// Map asks for a mapping from an external port, or any if zero, to a port of the host, lasting for ttl, or
+// DefaultLifetime if zero. The external address is not returned, and must be asked for separately.
+func (c *NATPMP) Map(ctx context.Context, proto Protocol, port, external int, ttl time.Duration) (*Mapping, error) {
+	op, err := natpmpOpcode(proto)
+	if err != nil {
+		return nil, err
+	}
+	req := make([]byte, 12)
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:], uint16(port))
+	binary.BigEndian.PutUint16(req[6:], uint16(external))
+	binary.BigEndian.PutUint32(req[8:], seconds(ttl))
+	resp, err := c.exchange(ctx, req, 16)
+	if err != nil {
+		return nil, err
+	}
+	return &Mapping{
+		Protocol:     proto,
+		InternalPort: int(binary.BigEndian.Uint16(resp[8:])),
+		ExternalPort: int(binary.BigEndian.Uint16(resp[10:])),
+		Lifetime:     time.Duration(binary.BigEndian.Uint32(resp[12:])) * time.Second,
+	}, nil
+}
+
+// Unmap deletes a mapping.
+func (c *NATPMP) Unmap(ctx context.Context, m *Mapping) error {
+	op, err := natpmpOpcode(m.Protocol)
+	if err != nil {
+		return err
+	}
+	// A deletion has a zero lifetime and external port.
+	req := make([]byte, 12)
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:], uint16(m.InternalPort))
+	_, err = c.exchange(ctx, req, 16)
+	return err
+}
+
+// exchange sends a request and checks the response is successful and at least size octets.
+func (c *NATPMP) exchange(ctx context.Context, req []byte, size int) ([]byte, error) {
+	t := transport{server: c.Gateway, rto: c.RTO, retries: c.Retries}
+	resp, err := t.exchange(ctx, func(net.IP) []byte { return req })
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] != 0 {
+		return nil, &ResultError{Protocol: "nat-pmp", Code: 1}
+	}
+	if code := binary.BigEndian.Uint16(resp[2:]); code != 0 {
+		return nil, &ResultError{Protocol: "nat-pmp", Code: int(code)}
+	}
+	if len(resp) < size {
+		return nil, fmt.Errorf("nat-pmp response of %d octets is too short", len(resp))
+	}
+	return resp, nil
+}
+
+// natpmpOpcode returns the opcode mapping a protocol.
+func natpmpOpcode(protocol Protocol) (byte, error) {
+	switch protocol {
+	case UDP:
+		return natpmpMapUDP, nil
+	case TCP:
+		return natpmpMapTCP, nil
+	}
+	return 0, fmt.Errorf("unsupported protocol %q", protocol)
+}
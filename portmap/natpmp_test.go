@@ -0,0 +1,107 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeGateway serves NAT-PMP or PCP on a local port, answering each request with the response from handle, or
+// nothing if it is nil.
+func fakeGateway(t *testing.T, handle func(req []byte, src *net.UDPAddr) []byte) string {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1100)
+		for {
+			n, src, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if resp := handle(append([]byte(nil), buf[:n]...), src); resp != nil {
+				conn.WriteToUDP(resp, src)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// natpmpGateway answers NAT-PMP requests as a gateway with an external address of 192.0.2.1, mapping every request to
+// external port 40000 unless it asks for another, or with result code if it is not zero. Requests of other versions
+// are answered with an unsupported version result.
+func natpmpGateway(code uint16) func([]byte, *net.UDPAddr) []byte {
+	return func(req []byte, _ *net.UDPAddr) []byte {
+		resp := make([]byte, 16)
+		resp[1] = req[1] | 0x80
+		binary.BigEndian.PutUint16(resp[2:], code)
+		binary.BigEndian.PutUint32(resp[4:], 1234)
+		if req[0] != 0 {
+			binary.BigEndian.PutUint16(resp[2:], 1)
+			return resp[:8]
+		}
+		if req[1] == natpmpExternalAddress {
+			copy(resp[8:], net.IPv4(192, 0, 2, 1).To4())
+			return resp[:12]
+		}
+		external, lifetime := binary.BigEndian.Uint16(req[6:]), binary.BigEndian.Uint32(req[8:])
+		if external == 0 && lifetime != 0 {
+			external = 40000
+		}
+		copy(resp[8:10], req[4:6])
+		binary.BigEndian.PutUint16(resp[10:], external)
+		binary.BigEndian.PutUint32(resp[12:], lifetime)
+		return resp
+	}
+}
+
+func TestNATPMP(t *testing.T) {
+	c := &NATPMP{Gateway: fakeGateway(t, natpmpGateway(0)), RTO: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	ip, err := c.ExternalAddress(ctx)
+	if err != nil {
+		t.Fatalf("external address err: %v", err)
+	}
+	if diff := cmp.Diff("192.0.2.1", ip.String()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	m, err := c.Map(ctx, TCP, 8080, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("map err: %v", err)
+	}
+	want := &Mapping{Protocol: TCP, InternalPort: 8080, ExternalPort: 40000, Lifetime: time.Hour}
+	if diff := cmp.Diff(want, m, cmp.AllowUnexported(Mapping{})); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if err := c.Unmap(ctx, m); err != nil {
+		t.Fatalf("unmap err: %v", err)
+	}
+}
+
+func TestNATPMPErrors(t *testing.T) {
+	tests := map[string]struct {
+		handle func([]byte, *net.UDPAddr) []byte
+		want   error
+	}{
+		"NotAuthorized": {handle: natpmpGateway(2), want: ErrNotAuthorized},
+		"NoResources":   {handle: natpmpGateway(4), want: ErrNoResources},
+		"NoResponse":    {handle: func([]byte, *net.UDPAddr) []byte { return nil }, want: ErrNoResponse},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &NATPMP{Gateway: fakeGateway(t, test.handle), RTO: 10 * time.Millisecond, Retries: 1}
+			if _, err := c.Map(context.Background(), UDP, 5000, 5000, 0); !errors.Is(err, test.want) {
+				t.Fatalf("got err %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package portmap
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// pcpVersion is the version of PCP, following the versions of NAT-PMP.
+const pcpVersion = 2
+
+// pcpMap is the opcode of MAP requests.
+const pcpMap = 1
+
+// The lengths of PCP headers and MAP payloads.
+const (
+	pcpHeaderLen = 24
+	pcpMapLen    = 36
+)
+
+// PCP is a Port Control Protocol (RFC 6887) client, which can also map ports on IPv6 firewalls. PCP has no request
+// for the external address alone, which is instead returned with each mapping. The zero value asks the default
+// gateway.
+type PCP struct {
+	Gateway string        // The host and port of the server, or the default gateway if empty; the port defaults to 5351.
+	RTO     time.Duration // The wait before the first retransmission, or DefaultRTO if zero; it doubles after each.
+	Retries int           // The number of retransmissions, or DefaultRetries if zero.
+}
+
+// Map asks for a mapping from an external port, or any if zero, to a port of the host, lasting for ttl, or
+// DefaultLifetime if zero.
+func (c *PCP) Map(ctx context.Context, proto Protocol, port, external int, ttl time.Duration) (*Mapping, error) {
+	m := &Mapping{Protocol: proto, InternalPort: port, ExternalPort: external}
+	if _, err := rand.Read(m.nonce[:]); err != nil {
+		return nil, err
+	}
+	return c.mapping(ctx, m, seconds(ttl))
+}
+
+// Unmap deletes a mapping, which must have been made by this package for the request to be accepted.
+func (c *PCP) Unmap(ctx context.Context, m *Mapping) error {
+	_, err := c.mapping(ctx, m, 0)
+	return err
+}
+
+// mapping sends a MAP request for a mapping, returning the mapping assigned.
+func (c *PCP) mapping(ctx context.Context, m *Mapping, lifetime uint32) (*Mapping, error) {
+	var number byte
+	switch m.Protocol {
+	case TCP:
+		number = 6
+	case UDP:
+		number = 17
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", m.Protocol)
+	}
+	t := transport{server: c.Gateway, rto: c.RTO, retries: c.Retries}
+	resp, err := t.exchange(ctx, func(local net.IP) []byte {
+		req := make([]byte, pcpHeaderLen+pcpMapLen)
+		req[0], req[1] = pcpVersion, pcpMap
+		binary.BigEndian.PutUint32(req[4:], lifetime)
+		copy(req[8:24], local.To16())
+		p := req[pcpHeaderLen:]
+		copy(p, m.nonce[:])
+		p[12] = number
+		binary.BigEndian.PutUint16(p[16:], uint16(m.InternalPort))
+		binary.BigEndian.PutUint16(p[18:], uint16(m.ExternalPort))
+		// Suggest an external address of the same family as the host's, which is all zeros either way.
+		if local.To4() != nil {
+			copy(p[20:], net.IPv4zero.To16())
+		}
+		return req
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] != pcpVersion {
+		return nil, &ResultError{Protocol: "pcp", Code: 1}
+	}
+	if resp[3] != 0 {
+		return nil, &ResultError{Protocol: "pcp", Code: int(resp[3])}
+	}
+	if len(resp) < pcpHeaderLen+pcpMapLen {
+		return nil, fmt.Errorf("pcp response of %d octets is too short", len(resp))
+	}
+	p := resp[pcpHeaderLen:]
+	if !bytes.Equal(p[:12], m.nonce[:]) {
+		return nil, errors.New("pcp response nonce does not match request")
+	}
+	external := net.IP(append([]byte(nil), p[20:36]...))
+	if ip4 := external.To4(); ip4 != nil {
+		external = ip4
+	}
+	return &Mapping{
+		Protocol:     m.Protocol,
+		InternalPort: int(binary.BigEndian.Uint16(p[16:])),
+		ExternalPort: int(binary.BigEndian.Uint16(p[18:])),
+		External:     external,
+		Lifetime:     time.Duration(binary.BigEndian.Uint32(resp[4:])) * time.Second,
+		nonce:        m.nonce,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// pcpGateway answers PCP MAP requests as a gateway with an external address of 192.0.2.1, assigning external port
+// 40000, or with result code if it is not zero. It checks the client address is the source of the request.
+func pcpGateway(t *testing.T, code byte) func([]byte, *net.UDPAddr) []byte {
+	return func(req []byte, src *net.UDPAddr) []byte {
+		if len(req) != pcpHeaderLen+pcpMapLen || req[0] != pcpVersion || req[1] != pcpMap {
+			t.Errorf("got invalid request %x", req)
+			return nil
+		}
+		if client := net.IP(req[8:24]); !client.Equal(src.IP) {
+			t.Errorf("got client address %v, want %v", client, src.IP)
+		}
+		resp := make([]byte, len(req))
+		copy(resp, req)
+		resp[1] |= 0x80
+		resp[2], resp[3] = 0, code
+		binary.BigEndian.PutUint32(resp[8:], 1234)
+		for i := 12; i < pcpHeaderLen; i++ {
+			resp[i] = 0
+		}
+		p := resp[pcpHeaderLen:]
+		if binary.BigEndian.Uint32(req[4:]) != 0 {
+			binary.BigEndian.PutUint16(p[18:], 40000)
+		}
+		copy(p[20:], net.IPv4(192, 0, 2, 1).To16())
+		return resp
+	}
+}
+
+func TestPCP(t *testing.T) {
+	c := &PCP{Gateway: fakeGateway(t, pcpGateway(t, 0)), RTO: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	m, err := c.Map(ctx, UDP, 5000, 0, 90*time.Second)
+	if err != nil {
+		t.Fatalf("map err: %v", err)
+	}
+	want := &Mapping{
+		Protocol:     UDP,
+		InternalPort: 5000,
+		ExternalPort: 40000,
+		External:     net.IPv4(192, 0, 2, 1).To4(),
+		Lifetime:     90 * time.Second,
+	}
+	if m.nonce == [12]byte{} {
+		t.Fatalf("got zero nonce")
+	}
+	want.nonce = m.nonce
+	if diff := cmp.Diff(want, m, cmp.AllowUnexported(Mapping{})); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if err := c.Unmap(ctx, m); err != nil {
+		t.Fatalf("unmap err: %v", err)
+	}
+}
+
+func TestPCPErrors(t *testing.T) {
+	tests := map[string]struct {
+		handle func([]byte, *net.UDPAddr) []byte
+		want   error
+	}{
+		"NoResources": {handle: pcpGateway(t, 8), want: ErrNoResources},
+		// A NAT-PMP server answers with its own version.
+		"NATPMP": {handle: natpmpGateway(0), want: ErrUnsupportedVersion},
+		"NonceMismatch": {handle: func(req []byte, src *net.UDPAddr) []byte {
+			resp := pcpGateway(t, 0)(req, src)
+			resp[pcpHeaderLen] ^= 0xff
+			return resp
+		}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &PCP{Gateway: fakeGateway(t, test.handle), RTO: 10 * time.Millisecond, Retries: 1}
+			_, err := c.Map(context.Background(), TCP, 22, 0, 0)
+			if err == nil {
+				t.Fatalf("got no error")
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Fatalf("got err %v, want %v", err, test.want)
+			}
+		})
+	}
+}
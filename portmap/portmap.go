@@ -0,0 +1,187 @@
+package portmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/route"
+	"net"
+	"time"
+)
+
+// Defaults used by clients whose fields are not set.
+const (
+	DefaultPort     = "5351" // The port of NAT-PMP and PCP servers.
+	DefaultRTO      = 250 * time.Millisecond
+	DefaultRetries  = 4
+	DefaultLifetime = 2 * time.Hour
+)
+
+// Protocol is the transport protocol of a mapping.
+type Protocol string
+
+// Protocols that can be mapped.
+const (
+	TCP Protocol = "tcp"
+	UDP Protocol = "udp"
+)
+
+// Errors matched by ResultError, and returned by clients.
+var (
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	ErrNotAuthorized      = errors.New("not authorized")
+	ErrNoResources        = errors.New("out of resources")
+	ErrNoResponse         = errors.New("no response")
+	ErrNoGateway          = errors.New("no default gateway")
+)
+
+// Mapping is a port mapping on a gateway, forwarding a port of its external address to a port of the host.
+type Mapping struct {
+	Protocol     Protocol
+	InternalPort int
+	ExternalPort int           // The port assigned, which may not be the one asked for.
+	External     net.IP        // The external address, or nil if the protocol does not return it, as NAT-PMP does not.
+	Lifetime     time.Duration // How long the mapping lasts unless renewed by mapping it again.
+
+	nonce [12]byte // Identifies the PCP client that made the mapping, which must be repeated to renew or delete it.
+}
+
+// Mapper makes port mappings on a gateway.
+type Mapper interface {
+	// Map asks for a mapping from an external port, or any if zero, to a port of the host, lasting for ttl, or
+	// DefaultLifetime if zero.
+	Map(ctx context.Context, proto Protocol, port, external int, ttl time.Duration) (*Mapping, error)
+	// Unmap deletes a mapping.
+	Unmap(ctx context.Context, m *Mapping) error
+}
+
+// ResultError is returned when a NAT-PMP or PCP server refuses a request.
+type ResultError struct {
+	Protocol string
+	Code     int
+}
+
+// Error satisfies the error interface.
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("portmap: %s result code %d", e.Protocol, e.Code)
+}
+
+// Is allows the error to be matched against ErrUnsupportedVersion, ErrNotAuthorized and ErrNoResources with
+// errors.Is. The result codes of NAT-PMP and PCP are the same for these, except for running out of resources.
+func (e *ResultError) Is(target error) bool {
+	switch target {
+	case ErrUnsupportedVersion:
+		return e.Code == 1
+	case ErrNotAuthorized:
+		return e.Code == 2
+	case ErrNoResources:
+		return e.Protocol == "nat-pmp" && e.Code == 4 || e.Protocol == "pcp" && e.Code == 8
+	}
+	return false
+}
+
+// DefaultGateway returns the gateway of the IPv4 default route with the lowest metric, where NAT-PMP and PCP servers
+// are usually found.
+func DefaultGateway() (net.IP, error) {
+	routes, err := route.Read(nil)
+	if err != nil {
+		return nil, err
+	}
+	var best *route.Route
+	for i, r := range routes {
+		ones, _ := r.Prefix.Mask.Size()
+		if ones != 0 || r.Prefix.IP.To4() == nil || r.Gateway == nil {
+			continue
+		}
+		if best == nil || r.Metric < best.Metric {
+			best = &routes[i]
+		}
+	}
+	if best == nil {
+		return nil, ErrNoGateway
+	}
+	return best.Gateway, nil
+}
+
+// server returns the address of a NAT-PMP or PCP server, using the default gateway if none is given.
+func server(gateway string) (string, error) {
+	if gateway == "" {
+		ip, err := DefaultGateway()
+		if err != nil {
+			return "", err
+		}
+		gateway = ip.String()
+	}
+	if _, _, err := net.SplitHostPort(gateway); err != nil {
+		gateway = net.JoinHostPort(gateway, DefaultPort)
+	}
+	return gateway, nil
+}
+
+// transport sends requests to a NAT-PMP or PCP server, or the default gateway if there is none, retransmitting them
+// with a doubling timeout.
+type transport struct {
+	server  string
+	rto     time.Duration
+	retries int
+}
+
+// exchange sends a request until a response to its opcode arrives. The request is built from the address it is sent
+// from, which PCP requests include.
+func (t transport) exchange(ctx context.Context, build func(net.IP) []byte) ([]byte, error) {
+	rto, retries := t.rto, t.retries
+	if rto <= 0 {
+		rto = DefaultRTO
+	}
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+	addr, err := server(t.server)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	req := build(conn.LocalAddr().(*net.UDPAddr).IP)
+
+	buf := make([]byte, 1100)
+	for i := 0; i <= retries; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(rto << i)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			// Both protocols put the opcode in the second octet, with the top bit set in responses.
+			if n >= 4 && buf[1] == req[1]|0x80 {
+				return buf[:n], nil
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w from %s", ErrNoResponse, addr)
+}
+
+// seconds returns a lifetime in whole seconds, defaulting to DefaultLifetime.
+func seconds(lifetime time.Duration) uint32 {
+	if lifetime == 0 {
+		lifetime = DefaultLifetime
+	}
+	return uint32((lifetime + time.Second - 1) / time.Second)
+}
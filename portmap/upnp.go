@@ -0,0 +1,349 @@
+package portmap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the time allowed for SSDP discovery and each UPnP request.
+const DefaultTimeout = 5 * time.Second
+
+// ssdpAddress is where SSDP searches are sent.
+const ssdpAddress = "239.255.255.250:1900"
+
+// The WAN connection services of Internet Gateway Devices that map ports, in order of preference.
+var upnpServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// ErrNoIGD is returned when no Internet Gateway Device with a WAN connection service is found.
+var ErrNoIGD = errors.New("no internet gateway device found")
+
+// UPnPError is returned when a UPnP device refuses a request.
+type UPnPError struct {
+	Action      string
+	Code        int
+	Description string
+}
+
+// Error satisfies the error interface.
+func (e *UPnPError) Error() string {
+	return fmt.Sprintf("portmap: upnp %s: %d %s", e.Action, e.Code, e.Description)
+}
+
+// UPnP is a client of the WAN connection service of a UPnP Internet Gateway Device, as found by DiscoverUPnP or
+// NewUPnP.
+type UPnP struct {
+	URL         string        // The control URL of the service.
+	Service     string        // The type of the service.
+	Description string        // Describes the mappings made, as shown by the device.
+	Client      *http.Client  // The client to make requests with, or http.DefaultClient if nil.
+	Timeout     time.Duration // How long a request may take, or DefaultTimeout if zero.
+}
+
+// DiscoverUPnP searches the local network for an Internet Gateway Device with SSDP, returning a client for the first
+// that responds with a WAN connection service.
+func DiscoverUPnP(ctx context.Context) (*UPnP, error) {
+	return discoverUPnP(ctx, ssdpAddress)
+}
+
+// discoverUPnP sends SSDP searches to an address.
+func discoverUPnP(ctx context.Context, addr string) (*UPnP, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	dst, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for _, target := range []string{
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	} {
+		search := "M-SEARCH * HTTP/1.1\r\nHOST: " + ssdpAddress + "\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\nST: " +
+			target + "\r\n\r\n"
+		if _, err := conn.WriteToUDP([]byte(search), dst); err != nil {
+			return nil, err
+		}
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	seen := map[string]bool{}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil, ErrNoIGD
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" || seen[location] {
+			continue
+		}
+		seen[location] = true
+		if u, err := NewUPnP(ctx, location); err == nil {
+			return u, nil
+		}
+	}
+}
+
+// upnpDescription is the part of a device description needed to find its services.
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// upnpDevice is a device, with its services and embedded devices.
+type upnpDevice struct {
+	Services []struct {
+		Type       string `xml:"serviceType"`
+		ControlURL string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// service returns the type and control URL of the most preferred WAN connection service in a device or those
+// embedded in it, ranked by their index in upnpServices.
+func (d *upnpDevice) service(rank map[string]int) (string, string) {
+	var best, control string
+	for _, s := range d.Services {
+		if r, ok := rank[s.Type]; ok && (best == "" || r < rank[best]) {
+			best, control = s.Type, s.ControlURL
+		}
+	}
+	for i := range d.Devices {
+		if t, c := d.Devices[i].service(rank); t != "" && (best == "" || rank[t] < rank[best]) {
+			best, control = t, c
+		}
+	}
+	return best, control
+}
+
+// NewUPnP returns a client for the WAN connection service of the device described at a location, as advertised by
+// SSDP.
+func NewUPnP(ctx context.Context, location string) (*UPnP, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", location, resp.Status)
+	}
+	var desc upnpDescription
+	if err := xml.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", location, err)
+	}
+
+	rank := map[string]int{}
+	for i, s := range upnpServices {
+		rank[s] = i
+	}
+	service, control := desc.Device.service(rank)
+	if service == "" {
+		return nil, ErrNoIGD
+	}
+	base := location
+	if desc.URLBase != "" {
+		base = desc.URLBase
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(strings.TrimSpace(control))
+	if err != nil {
+		return nil, err
+	}
+	return &UPnP{URL: u.ResolveReference(ref).String(), Service: service}, nil
+}
+
+// ExternalAddress returns the external address of the gateway.
+func (c *UPnP) ExternalAddress(ctx context.Context) (net.IP, error) {
+	out, err := c.call(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(out["NewExternalIPAddress"])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid external address %q", out["NewExternalIPAddress"])
+	}
+	return ip, nil
+}
+
+// Map asks for a mapping from an external port to a port of the host, lasting for ttl, or DefaultLifetime if zero.
+// UPnP needs an external port, so the port of the host is used if it is zero. Some devices only accept mappings that
+// last forever, which a negative ttl asks for.
+func (c *UPnP) Map(ctx context.Context, proto Protocol, port, external int, ttl time.Duration) (*Mapping, error) {
+	if external == 0 {
+		external = port
+	}
+	var lease uint32
+	if ttl >= 0 {
+		lease = seconds(ttl)
+	}
+	local, err := c.localAddr()
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.call(ctx, "AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(external)},
+		{"NewProtocol", strings.ToUpper(string(proto))},
+		{"NewInternalPort", strconv.Itoa(port)},
+		{"NewInternalClient", local.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", c.Description},
+		{"NewLeaseDuration", strconv.FormatUint(uint64(lease), 10)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Mapping{
+		Protocol:     proto,
+		InternalPort: port,
+		ExternalPort: external,
+		Lifetime:     time.Duration(lease) * time.Second,
+	}, nil
+}
+
+// Unmap deletes a mapping.
+func (c *UPnP) Unmap(ctx context.Context, m *Mapping) error {
+	_, err := c.call(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(m.ExternalPort)},
+		{"NewProtocol", strings.ToUpper(string(m.Protocol))},
+	})
+	return err
+}
+
+// localAddr returns the address the host uses to reach the device, which mappings forward to.
+func (c *UPnP) localAddr() (net.IP, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// call invokes a SOAP action of the service with arguments in order, returning the output arguments.
+func (c *UPnP) call(ctx context.Context, action string, args [][2]string) (map[string]string, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:` + action + ` xmlns:u="`)
+	xml.EscapeText(&body, []byte(c.Service))
+	body.WriteString(`">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString("</u:" + action + "></s:Body></s:Envelope>")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, strings.NewReader(body.String()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+c.Service+"#"+action+`"`)
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	out, err := soapValues(b)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s response: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		code, err := strconv.Atoi(out["errorCode"])
+		if err != nil {
+			return nil, fmt.Errorf("upnp %s: %s", action, resp.Status)
+		}
+		return nil, &UPnPError{Action: action, Code: code, Description: out["errorDescription"]}
+	}
+	return out, nil
+}
+
+// soapValues returns the text of each element without children in a SOAP envelope, by local name, which is enough
+// to read the output arguments of responses and the details of faults.
+func soapValues(b []byte) (map[string]string, error) {
+	values := map[string]string{}
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var name, text string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			name, text = tok.Name.Local, ""
+		case xml.CharData:
+			text += string(tok)
+		case xml.EndElement:
+			if tok.Name.Local == name {
+				values[name] = strings.TrimSpace(text)
+			}
+			name = ""
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package portmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const upnpDescriptionXML = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <serviceList>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:Layer3Forwarding:1</serviceType>
+        <controlURL>/l3f</controlURL>
+      </service>
+    </serviceList>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANPPPConnection:1</serviceType>
+                <controlURL>/ppp</controlURL>
+              </service>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL> /ctl/IPConn </controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+const upnpFault = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <s:Fault>
+      <faultcode>s:Client</faultcode>
+      <faultstring>UPnPError</faultstring>
+      <detail>
+        <UPnPError xmlns="urn:schemas-upnp-org:control-1-0">
+          <errorCode>718</errorCode>
+          <errorDescription>ConflictInMappingEntry</errorDescription>
+        </UPnPError>
+      </detail>
+    </s:Fault>
+  </s:Body>
+</s:Envelope>`
+
+// fakeIGD serves a device description and a WAN IP connection service, recording the SOAP actions called.
+func fakeIGD(t *testing.T, actions *[]string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/desc.xml":
+			fmt.Fprint(w, upnpDescriptionXML)
+			return
+		case "/ctl/IPConn":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		values, err := soapValues(body)
+		if err != nil {
+			t.Errorf("invalid request %s: %v", body, err)
+		}
+		action := r.Header.Get("SOAPAction")
+		*actions = append(*actions, action)
+		switch {
+		case strings.HasSuffix(action, `#GetExternalIPAddress"`):
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">`+
+				`<s:Body><u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+				`<NewExternalIPAddress>192.0.2.1</NewExternalIPAddress></u:GetExternalIPAddressResponse>`+
+				`</s:Body></s:Envelope>`)
+		case strings.HasSuffix(action, `#AddPortMapping"`) && values["NewExternalPort"] == "80":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, upnpFault)
+		case strings.HasSuffix(action, `#AddPortMapping"`):
+			if values["NewInternalClient"] != "127.0.0.1" || values["NewProtocol"] != "TCP" {
+				t.Errorf("got request %v", values)
+			}
+		case strings.HasSuffix(action, `#DeletePortMapping"`):
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestUPnP(t *testing.T) {
+	var actions []string
+	s := fakeIGD(t, &actions)
+	ctx := context.Background()
+
+	c, err := NewUPnP(ctx, s.URL+"/desc.xml")
+	if err != nil {
+		t.Fatalf("new err: %v", err)
+	}
+	want := &UPnP{URL: s.URL + "/ctl/IPConn", Service: "urn:schemas-upnp-org:service:WANIPConnection:1"}
+	if diff := cmp.Diff(want, c); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	ip, err := c.ExternalAddress(ctx)
+	if err != nil {
+		t.Fatalf("external address err: %v", err)
+	}
+	if diff := cmp.Diff("192.0.2.1", ip.String()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	m, err := c.Map(ctx, TCP, 8080, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("map err: %v", err)
+	}
+	wantMapping := &Mapping{Protocol: TCP, InternalPort: 8080, ExternalPort: 8080, Lifetime: time.Hour}
+	if diff := cmp.Diff(wantMapping, m, cmp.AllowUnexported(Mapping{})); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if err := c.Unmap(ctx, m); err != nil {
+		t.Fatalf("unmap err: %v", err)
+	}
+
+	_, err = c.Map(ctx, TCP, 8080, 80, -1)
+	var upnpErr *UPnPError
+	if !errors.As(err, &upnpErr) || upnpErr.Code != 718 {
+		t.Fatalf("got err %v, want code 718", err)
+	}
+
+	wantActions := []string{}
+	for _, a := range []string{"GetExternalIPAddress", "AddPortMapping", "DeletePortMapping", "AddPortMapping"} {
+		wantActions = append(wantActions, `"urn:schemas-upnp-org:service:WANIPConnection:1#`+a+`"`)
+	}
+	if diff := cmp.Diff(wantActions, actions); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestDiscoverUPnP(t *testing.T) {
+	var actions []string
+	s := fakeIGD(t, &actions)
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, src, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(string(buf[:n]), "M-SEARCH * HTTP/1.1\r\n") {
+				continue
+			}
+			// A device that is not a gateway answers too.
+			conn.WriteToUDP([]byte("HTTP/1.1 200 OK\r\nLOCATION: "+s.URL+"/missing.xml\r\n\r\n"), src)
+			conn.WriteToUDP([]byte("HTTP/1.1 200 OK\r\nLOCATION: "+s.URL+"/desc.xml\r\n\r\n"), src)
+		}
+	}()
+
+	c, err := discoverUPnP(context.Background(), conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("discover err: %v", err)
+	}
+	if diff := cmp.Diff(s.URL+"/ctl/IPConn", c.URL); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
@@ -0,0 +1,193 @@
+package portrange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Range is an inclusive range of ports.
+type Range struct {
+	First uint16
+	Last  uint16
+}
+
+// String returns the range as first-last, or as a single port if it has only one.
+func (r Range) String() string {
+	if r.First == r.Last {
+		return strconv.Itoa(int(r.First))
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// Contains reports whether port is within the range.
+func (r Range) Contains(port uint16) bool {
+	return r.First <= port && port <= r.Last
+}
+
+// Mask is a port and a mask, matching the ports that equal the port in the bits set in the mask, as used by packet
+// filters that cannot match ranges.
+type Mask struct {
+	Port uint16
+	Mask uint16
+}
+
+// String returns the mask as port/mask in hexadecimal, as tc and nftables write them.
+func (m Mask) String() string {
+	return fmt.Sprintf("0x%04x/0x%04x", m.Port, m.Mask)
+}
+
+// Masks returns the smallest list of port and mask pairs that matches exactly the ports of the range, in order. Each is
+// the largest aligned block that starts at the first port not yet covered and does not extend beyond the last.
+func (r Range) Masks() []Mask {
+	var masks []Mask
+	first, last := uint32(r.First), uint32(r.Last)
+	for first <= last {
+		size := uint32(1)
+		for first%(2*size) == 0 && first+2*size-1 <= last && size < 1<<16 {
+			size *= 2
+		}
+		masks = append(masks, Mask{Port: uint16(first), Mask: uint16(^(size - 1))})
+		first += size
+	}
+	return masks
+}
+
+// List is a list of ranges of ports, which Merge and Parse return sorted, with none overlapping or adjacent.
+type List []Range
+
+// Merge returns the ranges sorted, with those that overlap or are adjacent merged, in the way prefixes are aggregated.
+// Ranges with their ports the wrong way round are reversed.
+func Merge(ranges []Range) List {
+	sorted := make([]Range, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Last < r.First {
+			r.First, r.Last = r.Last, r.First
+		}
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].First < sorted[j].First })
+	var merged List
+	for _, r := range sorted {
+		if n := len(merged); n > 0 && uint32(r.First) <= uint32(merged[n-1].Last)+1 {
+			if r.Last > merged[n-1].Last {
+				merged[n-1].Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Parse parses a list of ports and ranges separated by commas, such as "80,443,8000-8100", and merges them. Spaces are
+// ignored.
+func Parse(s string) (List, error) {
+	return parse(s, func(name string) (uint16, error) {
+		return 0, fmt.Errorf("invalid port %q", name)
+	})
+}
+
+// parse implements Parse, calling lookup for any port that is not a number.
+func parse(s string, lookup func(name string) (uint16, error)) (List, error) {
+	port := func(s string) (uint16, error) {
+		if s == "" {
+			return 0, errors.New("missing port")
+		}
+		if s[0] < '0' || s[0] > '9' {
+			return lookup(s)
+		}
+		n, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid port %q", s)
+		}
+		return uint16(n), nil
+	}
+
+	var ranges []Range
+	for _, field := range strings.Split(strings.ReplaceAll(s, " ", ""), ",") {
+		if field == "" {
+			continue
+		}
+		// Service names may contain hyphens themselves, so a field is only split into a range if it is not a name.
+		first, last := field, field
+		if i := strings.IndexByte(field, '-'); i >= 0 {
+			if _, err := port(field); err != nil {
+				first, last = field[:i], field[i+1:]
+			}
+		}
+		r := Range{}
+		var err error
+		if r.First, err = port(first); err != nil {
+			return nil, err
+		}
+		if r.Last, err = port(last); err != nil {
+			return nil, err
+		}
+		if r.Last < r.First {
+			return nil, fmt.Errorf("invalid range %q: last port before first", field)
+		}
+		ranges = append(ranges, r)
+	}
+	return Merge(ranges), nil
+}
+
+// String returns the list as ports and ranges separated by commas, as Parse reads it.
+func (l List) String() string {
+	strs := make([]string, 0, len(l))
+	for _, r := range l {
+		strs = append(strs, r.String())
+	}
+	return strings.Join(strs, ",")
+}
+
+// Contains reports whether port is within one of the ranges of the list, which must be sorted as Merge returns it.
+func (l List) Contains(port uint16) bool {
+	i := sort.Search(len(l), func(i int) bool { return l[i].Last >= port })
+	return i < len(l) && l[i].First <= port
+}
+
+// Masks returns the port and mask pairs that match exactly the ports of the list.
+func (l List) Masks() []Mask {
+	var masks []Mask
+	for _, r := range l {
+		masks = append(masks, r.Masks()...)
+	}
+	return masks
+}
+
+// Union returns a list of the ports in either l or o.
+func (l List) Union(o List) List {
+	return Merge(append(append([]Range(nil), l...), o...))
+}
+
+// Overlaps reports whether any port is in both l and o, which must be sorted as Merge returns them.
+func (l List) Overlaps(o List) bool {
+	for i, j := 0, 0; i < len(l) && j < len(o); {
+		switch {
+		case l[i].Last < o[j].First:
+			i++
+		case o[j].Last < l[i].First:
+			j++
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Superset reports whether every port in o is also in l, which must be sorted as Merge returns them.
+func (l List) Superset(o List) bool {
+	i := 0
+	for _, r := range o {
+		for i < len(l) && l[i].Last < r.First {
+			i++
+		}
+		if i == len(l) || r.First < l[i].First || l[i].Last < r.Last {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package portrange
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		"List":      {input: "80,443,8000-8100", want: "80,443,8000-8100"},
+		"Merge":     {input: "8050-8200, 443, 80, 8000-8100, 81-90, 442", want: "80-90,442-443,8000-8200"},
+		"Adjacent":  {input: "1-1023,1024-65535", want: "1-65535"},
+		"All":       {input: "0-65535", want: "0-65535"},
+		"Empty":     {input: "", want: ""},
+		"Backwards": {input: "100-90", wantErr: true},
+		"TooLarge":  {input: "65536", wantErr: true},
+		"Name":      {input: "http", wantErr: true},
+		"Missing":   {input: "80-", wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			l, err := Parse(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, l.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	l, err := Parse("22,80-90,443")
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	for port, want := range map[uint16]bool{0: false, 22: true, 23: false, 80: true, 85: true, 91: false, 443: true} {
+		if got := l.Contains(port); got != want {
+			t.Errorf("Contains(%d): got %v, want %v", port, got, want)
+		}
+	}
+}
+
+func TestMasks(t *testing.T) {
+	tests := map[string]struct {
+		input Range
+		want  []string
+	}{
+		"Single": {input: Range{443, 443}, want: []string{"0x01bb/0xffff"}},
+		"Aligned": {
+			input: Range{8000, 8063},
+			want:  []string{"0x1f40/0xffc0"},
+		},
+		"Unaligned": {
+			input: Range{1000, 1010},
+			want:  []string{"0x03e8/0xfff8", "0x03f0/0xfffe", "0x03f2/0xffff"},
+		},
+		"Ephemeral": {
+			input: Range{32768, 65535},
+			want:  []string{"0x8000/0x8000"},
+		},
+		"All": {
+			input: Range{0, 65535},
+			want:  []string{"0x0000/0x0000"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, m := range test.input.Masks() {
+				got = append(got, m.String())
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestRelations(t *testing.T) {
+	tests := map[string]struct {
+		a, b         string
+		wantUnion    string
+		wantOverlaps bool
+		wantSuper    bool
+	}{
+		"Disjoint": {a: "22,80", b: "443", wantUnion: "22,80,443"},
+		"Adjacent": {a: "80-89", b: "90-99", wantUnion: "80-99"},
+		"Subset":   {a: "1-1024", b: "22,80,443", wantUnion: "1-1024", wantOverlaps: true, wantSuper: true},
+		"Partial":  {a: "80-90", b: "85-95", wantUnion: "80-95", wantOverlaps: true},
+		"Empty":    {a: "80", b: "", wantUnion: "80", wantSuper: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			a, err := Parse(test.a)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			b, err := Parse(test.b)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			if diff := cmp.Diff(test.wantUnion, a.Union(b).String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if got := a.Overlaps(b); got != test.wantOverlaps {
+				t.Fatalf("Overlaps: got %v, want %v", got, test.wantOverlaps)
+			}
+			if got := a.Superset(b); got != test.wantSuper {
+				t.Fatalf("Superset: got %v, want %v", got, test.wantSuper)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package portrange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultServicesPath is where LoadServices reads the services database from by default.
+const DefaultServicesPath = "/etc/services"
+
+// service is a name and protocol, such as "https" and "tcp".
+type service struct {
+	name  string
+	proto string
+}
+
+// port is a port number and protocol.
+type port struct {
+	number uint16
+	proto  string
+}
+
+// Services maps service names to ports and back, in the manner of /etc/services.
+type Services struct {
+	ports map[service]uint16
+	names map[port]string
+}
+
+// ReadServices reads a services database in the format of /etc/services: a name, a port and protocol such as
+// "443/tcp", and any aliases, on each line, with comments starting with #. A port's name is the first given for it.
+func ReadServices(r io.Reader) (*Services, error) {
+	s := &Services{ports: map[service]uint16{}, names: map[port]string{}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing port", line)
+		}
+		i := strings.IndexByte(fields[1], '/')
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: invalid port %q", line, fields[1])
+		}
+		n, err := strconv.ParseUint(fields[1][:i], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid port %q", line, fields[1])
+		}
+		p := port{uint16(n), strings.ToLower(fields[1][i+1:])}
+		if _, ok := s.names[p]; !ok {
+			s.names[p] = fields[0]
+		}
+		for _, name := range append(fields[:1:1], fields[2:]...) {
+			svc := service{strings.ToLower(name), p.proto}
+			if _, ok := s.ports[svc]; !ok {
+				s.ports[svc] = p.number
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadServices reads the services database at path, or DefaultServicesPath if path is empty.
+func LoadServices(path string) (*Services, error) {
+	if path == "" {
+		path = DefaultServicesPath
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadServices(f)
+}
+
+// Port returns the port of the named service for a protocol such as "tcp", and whether it is known. Names are not
+// case sensitive, and aliases are accepted.
+func (s *Services) Port(name, proto string) (uint16, bool) {
+	n, ok := s.ports[service{strings.ToLower(name), strings.ToLower(proto)}]
+	return n, ok
+}
+
+// Name returns the name of the service on a port for a protocol such as "tcp", and whether it is known.
+func (s *Services) Name(number uint16, proto string) (string, bool) {
+	name, ok := s.names[port{number, strings.ToLower(proto)}]
+	return name, ok
+}
+
+// Parse parses a list of ports and ranges as the package level Parse does, also accepting the names of services for
+// the protocol, such as "http,https,8000-8100".
+func (s *Services) Parse(list, proto string) (List, error) {
+	return parse(list, func(name string) (uint16, error) {
+		n, ok := s.Port(name, proto)
+		if !ok {
+			return 0, fmt.Errorf("unknown %s service %q", proto, name)
+		}
+		return n, nil
+	})
+}
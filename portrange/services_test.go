@@ -0,0 +1,60 @@
+package portrange
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"strings"
+	"testing"
+)
+
+const services = `# Network services, Internet style
+ssh		22/tcp				# SSH Remote Login Protocol
+domain		53/tcp
+domain		53/udp
+http		80/tcp		www		# WorldWideWeb HTTP
+https		443/tcp
+ms-sql-s	1433/tcp
+http-alt	8080/tcp	webcache
+`
+
+func TestServices(t *testing.T) {
+	s, err := ReadServices(strings.NewReader(services))
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+
+	tests := map[string]struct {
+		input   string
+		proto   string
+		want    string
+		wantErr bool
+	}{
+		"Names":     {input: "https,http,ssh", proto: "tcp", want: "22,80,443"},
+		"Alias":     {input: "WWW,webcache", proto: "TCP", want: "80,8080"},
+		"Hyphen":    {input: "ms-sql-s,8000-8100", proto: "tcp", want: "1433,8000-8100"},
+		"NameRange": {input: "http-https", proto: "tcp", want: "80-443"},
+		"Protocol":  {input: "domain,https", proto: "udp", wantErr: true},
+		"Unknown":   {input: "gopher", proto: "tcp", wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			l, err := s.Parse(test.input, test.proto)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, l.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	if name, ok := s.Name(53, "udp"); !ok || name != "domain" {
+		t.Errorf("Name(53, udp): got %q, %v", name, ok)
+	}
+	if name, ok := s.Name(8080, "udp"); ok {
+		t.Errorf("Name(8080, udp): got %q, want none", name)
+	}
+}
@@ -0,0 +1,187 @@
+package prefixlist
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/aggregate"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// cacheVersion is hashed into every key, so that changing how lists are compiled or stored invalidates earlier entries.
+const cacheVersion = "prefixlist cache 1"
+
+// Cache holds compiled prefix lists keyed by a hash of their input, in memory and optionally in a directory, so that
+// identical lists compiled again, in this run or a later one, are not aggregated again. Entries are never evicted;
+// remove the directory to clear it. It is safe for concurrent use, and by more than one process.
+type Cache struct {
+	Dir string // The directory holding compiled lists across runs, or empty to hold them in memory only.
+
+	mu           sync.Mutex
+	mem          map[string][]*net.IPNet
+	hits, misses int
+}
+
+// CacheKey returns the key of a list compiled from prefixes less the excluded prefixes, and options, which are any
+// further settings that change the result. It depends on the order of the prefixes, so that computing it is cheap.
+func CacheKey(pfxs, excluded []*net.IPNet, options ...string) string {
+	h := sha256.New()
+	h.Write([]byte(cacheVersion))
+	write := func(tag byte, pfxs []*net.IPNet) {
+		for _, pfx := range pfxs {
+			ones, bits := pfx.Mask.Size()
+			ip := pfx.IP.To16()
+			if bits == 8*net.IPv4len {
+				ip = pfx.IP.To4()
+			}
+			h.Write([]byte{tag, byte(ones)})
+			h.Write(ip)
+		}
+	}
+	write('+', pfxs)
+	write('-', excluded)
+	for _, opt := range options {
+		fmt.Fprintf(h, "o%d:%s", len(opt), opt)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Compile aggregates prefixes less the excluded prefixes, as aggregate.Exclude does, reusing the result of an identical
+// earlier compilation if there is one. Options are any further settings the caller applied to the prefixes, such as
+// filters, which are part of the key.
+func (c *Cache) Compile(pfxs, excluded []*net.IPNet, options ...string) ([]*net.IPNet, error) {
+	key := CacheKey(pfxs, excluded, options...)
+	if compiled, ok, err := c.Get(key); err != nil || ok {
+		return compiled, err
+	}
+	compiled, err := aggregate.Exclude(pfxs, excluded)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Put(key, compiled); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// Get returns the list compiled with a key, and whether there is one. A corrupt file in the directory is treated as
+// missing.
+func (c *Cache) Get(key string) ([]*net.IPNet, bool, error) {
+	c.mu.Lock()
+	pfxs, ok := c.mem[key]
+	c.mu.Unlock()
+	if !ok && c.Dir != "" {
+		b, err := ioutil.ReadFile(c.path(key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+		if err == nil {
+			pfxs, ok = parseCached(b)
+		}
+		if ok {
+			c.mu.Lock()
+			c.remember(key, pfxs)
+			c.mu.Unlock()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok {
+		c.misses++
+		return nil, false, nil
+	}
+	c.hits++
+	return clonePrefixes(pfxs), true, nil
+}
+
+// Put stores the list compiled with a key, replacing any file in the directory atomically.
+func (c *Cache) Put(key string, pfxs []*net.IPNet) error {
+	c.mu.Lock()
+	c.remember(key, clonePrefixes(pfxs))
+	c.mu.Unlock()
+	if c.Dir == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n", cacheVersion)
+	for _, pfx := range pfxs {
+		fmt.Fprintln(&b, pfx)
+	}
+	// A trailer marks the file complete, so a truncated one is not mistaken for a shorter list.
+	fmt.Fprintf(&b, "# %d prefixes\n", len(pfxs))
+
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.Dir, key+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// Stats returns the number of lookups that found a compiled list, and the number that did not.
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// remember stores a compiled list in memory. The caller must hold c.mu.
+func (c *Cache) remember(key string, pfxs []*net.IPNet) {
+	if c.mem == nil {
+		c.mem = map[string][]*net.IPNet{}
+	}
+	c.mem[key] = pfxs
+}
+
+// path returns the path of the file holding the list compiled with a key.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key)
+}
+
+// parseCached parses a file written by Put, returning false if it is not complete.
+func parseCached(b []byte) ([]*net.IPNet, bool) {
+	pfxs := []*net.IPNet{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	if !s.Scan() || s.Text() != "# "+cacheVersion {
+		return nil, false
+	}
+	for s.Scan() {
+		text := s.Text()
+		if strings.HasPrefix(text, "# ") {
+			return pfxs, text == fmt.Sprintf("# %d prefixes", len(pfxs)) && !s.Scan()
+		}
+		_, pfx, err := net.ParseCIDR(text)
+		if err != nil {
+			return nil, false
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	return nil, false
+}
+
+// clonePrefixes returns a deep copy of prefixes, so that callers cannot modify those cached.
+func clonePrefixes(pfxs []*net.IPNet) []*net.IPNet {
+	clone := make([]*net.IPNet, len(pfxs))
+	for i, pfx := range pfxs {
+		clone[i] = &net.IPNet{IP: append(net.IP(nil), pfx.IP...), Mask: append(net.IPMask(nil), pfx.Mask...)}
+	}
+	return clone
+}
@@ -0,0 +1,103 @@
+package prefixlist
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func prefixStrings(pfxs []*net.IPNet) []string {
+	var strs []string
+	for _, pfx := range pfxs {
+		strs = append(strs, pfx.String())
+	}
+	return strs
+}
+
+func TestCache(t *testing.T) {
+	// Aggregation modifies its input, so each compilation is given a copy.
+	input := []string{"192.0.2.0/25", "192.0.2.128/25", "198.51.100.0/24", "2001:db8::/33", "2001:db8:8000::/33"}
+	pfxs, excluded := parsePrefixes(t, input...), parsePrefixes(t, "198.51.100.0/26")
+	want := []string{"192.0.2.0/24", "198.51.100.64/26", "198.51.100.128/25", "2001:db8::/32"}
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	c := &Cache{Dir: dir}
+	for i := 0; i < 3; i++ {
+		got, err := c.Compile(parsePrefixes(t, input...), excluded)
+		if err != nil {
+			t.Fatalf("compile err: %v", err)
+		}
+		if diff := cmp.Diff(want, prefixStrings(got)); diff != "" {
+			t.Fatalf("compile %d: %v", i, diff)
+		}
+		// Modifying a cached result must not modify the cached list.
+		if i > 0 {
+			got[0].IP[0] = 0
+		}
+	}
+	if hits, misses := c.Stats(); hits != 2 || misses != 1 {
+		t.Fatalf("got %d hits and %d misses, want 2 and 1", hits, misses)
+	}
+
+	// A new cache finds the list in the directory, rather than compiling it.
+	key := CacheKey(pfxs, excluded)
+	c = &Cache{Dir: dir}
+	got, ok, err := c.Get(key)
+	if err != nil || !ok {
+		t.Fatalf("get: got %v, %v", ok, err)
+	}
+	if diff := cmp.Diff(want, prefixStrings(got)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	// Truncated and corrupt files are treated as missing.
+	b, err := ioutil.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	for name, content := range map[string][]byte{
+		"Truncated": b[:len(b)-len("# 4 prefixes\n")],
+		"Corrupt":   []byte("# " + cacheVersion + "\nbogus\n# 1 prefixes\n"),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, key), content, 0o644); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+		if _, ok, err := (&Cache{Dir: dir}).Get(key); ok || err != nil {
+			t.Fatalf("%s: got %v, %v", name, ok, err)
+		}
+	}
+
+	// An empty list is cached as such.
+	c = &Cache{}
+	if err := c.Put("empty", nil); err != nil {
+		t.Fatalf("put err: %v", err)
+	}
+	if got, ok, err := c.Get("empty"); err != nil || !ok || len(got) != 0 {
+		t.Fatalf("get empty: got %v, %v, %v", got, ok, err)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	pfxs := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32")
+	key := CacheKey(pfxs, nil)
+	if got := CacheKey(parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"), nil); got != key {
+		t.Fatalf("keys of identical input differ")
+	}
+	for name, other := range map[string]string{
+		"Order":    CacheKey(parsePrefixes(t, "2001:db8::/32", "192.0.2.0/24"), nil),
+		"Length":   CacheKey(parsePrefixes(t, "192.0.2.0/25", "2001:db8::/32"), nil),
+		"Excluded": CacheKey(pfxs[:1], pfxs[1:]),
+		"Options":  CacheKey(pfxs, nil, "max-length4=24"),
+		"Split":    CacheKey(pfxs, nil, "a", "b"),
+		"Joined":   CacheKey(pfxs, nil, "ab"),
+	} {
+		if other == key {
+			t.Fatalf("%s: key unchanged", name)
+		}
+	}
+	if CacheKey(pfxs, nil, "a", "b") == CacheKey(pfxs, nil, "ab") {
+		t.Fatalf("options are ambiguous")
+	}
+}
@@ -0,0 +1,255 @@
+package prefixlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Entry is a prefix of a prefix list, with its sequence number in the syntaxes that have them.
+type Entry struct {
+	Seq    int
+	Prefix *net.IPNet
+	Deny   bool
+}
+
+// Number returns the entries of the prefix list Write renders for pfxs, numbered as it numbers them, with IPv4 and
+// IPv6 numbered separately.
+func Number(pfxs []*net.IPNet, opts *Options) []Entry {
+	var entries []Entry
+	v4, v6 := split(pfxs)
+	for _, list := range [][]*net.IPNet{v4, v6} {
+		for i, pfx := range list {
+			entries = append(entries, Entry{Seq: opts.seq(i), Prefix: pfx, Deny: opts != nil && opts.Deny})
+		}
+	}
+	return entries
+}
+
+// ParseIOS reads the entries of the IOS prefix lists with the given name, of both families, from configuration such
+// as the output of "show running-config | include prefix-list". Lines for other prefix lists, descriptions, and other
+// configuration are ignored. Entries matching a range of lengths with ge or le are not supported.
+func ParseIOS(r io.Reader, name string) ([]Entry, error) {
+	var entries []Entry
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		f := strings.Fields(s.Text())
+		if len(f) < 4 || (f[0] != "ip" && f[0] != "ipv6") || f[1] != "prefix-list" || f[2] != name {
+			continue
+		}
+		switch {
+		case f[3] == "description":
+			continue
+		case len(f) > 7 && (f[7] == "ge" || f[7] == "le"):
+			return nil, fmt.Errorf("line %d: ge and le are not supported", line)
+		case len(f) != 7 || f[3] != "seq" || (f[5] != "permit" && f[5] != "deny"):
+			return nil, fmt.Errorf("line %d: invalid prefix list entry %q", line, s.Text())
+		}
+		seq, err := strconv.Atoi(f[4])
+		if err != nil || seq <= 0 {
+			return nil, fmt.Errorf("line %d: invalid sequence number %q", line, f[4])
+		}
+		_, pfx, err := net.ParseCIDR(f[6])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if family := iosFamily(pfx); family != f[0] {
+			return nil, fmt.Errorf("line %d: %v in an %s prefix list", line, pfx, f[0])
+		}
+		entries = append(entries, Entry{Seq: seq, Prefix: pfx, Deny: f[5] == "deny"})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Delta is the changes that transform one prefix list into another.
+type Delta struct {
+	Added   []Entry // Entries for the prefixes of the new list that the old one lacks, with their new sequence numbers.
+	Removed []Entry // Entries of the old list that are not in the new one.
+	Entries []Entry // The new list, numbered as it is once the changes are made, to diff against next time.
+}
+
+// Diff returns the changes that transform the prefix list old into a list of pfxs, with the action and sequence
+// numbers given by opts. Entries that are in both lists keep their sequence numbers, so only the prefixes that changed
+// are touched.
+//
+// New prefixes are numbered to keep the list in the order of pfxs, spread across the gaps between the entries that are
+// kept, and never reusing a number that is removed. When a gap is too small they are numbered after the last entry;
+// the order of entries with the same action does not change what the list matches, so this only affects how it reads.
+func Diff(old []Entry, pfxs []*net.IPNet, opts *Options) *Delta {
+	d := &Delta{}
+	var oldV4, oldV6 []Entry
+	for _, e := range old {
+		if e.Prefix.IP.To4() != nil {
+			oldV4 = append(oldV4, e)
+		} else {
+			oldV6 = append(oldV6, e)
+		}
+	}
+	v4, v6 := split(pfxs)
+	d.diff(oldV4, v4, opts)
+	d.diff(oldV6, v6, opts)
+	return d
+}
+
+// diff adds the changes that transform the old list of a single family into a list of pfxs.
+func (d *Delta) diff(old []Entry, pfxs []*net.IPNet, opts *Options) {
+	deny := opts != nil && opts.Deny
+	wanted := map[string]bool{}
+	for _, pfx := range pfxs {
+		wanted[pfx.String()] = true
+	}
+
+	// Entries that are still wanted with the same action keep their sequence numbers; the rest are removed, along with
+	// any duplicates. No new entry takes a number in use by the old list.
+	kept := map[string]int{}
+	used := map[int]bool{}
+	highest := 0
+	for _, e := range old {
+		used[e.Seq] = true
+		if e.Seq > highest {
+			highest = e.Seq
+		}
+		key := e.Prefix.String()
+		if _, dup := kept[key]; dup || !wanted[key] || e.Deny != deny {
+			d.Removed = append(d.Removed, e)
+			continue
+		}
+		kept[key] = e.Seq
+	}
+
+	// Walk the new list, collecting runs of new prefixes, and number each run once the kept entry after it is known.
+	var entries, added []Entry
+	var run []*net.IPNet
+	prev := 0
+	number := func(next int) {
+		var seqs []int
+		if next > prev {
+			for j := range run {
+				low := prev
+				if len(seqs) > 0 {
+					low = seqs[len(seqs)-1]
+				}
+				seq := prev + (next-prev)*(j+1)/(len(run)+1)
+				if seq <= low {
+					seq = low + 1
+				}
+				for used[seq] {
+					seq++
+				}
+				if seq >= next {
+					for _, seq := range seqs {
+						delete(used, seq)
+					}
+					seqs = nil
+					break
+				}
+				seqs = append(seqs, seq)
+				used[seq] = true
+			}
+		}
+		for j := len(seqs); j < len(run); j++ {
+			seq := opts.seq(0)
+			if highest > 0 {
+				seq = highest + opts.step()
+			}
+			seqs = append(seqs, seq)
+			used[seq] = true
+			highest = seq
+		}
+		for j, pfx := range run {
+			added = append(added, Entry{Seq: seqs[j], Prefix: pfx, Deny: deny})
+		}
+		run = nil
+	}
+	seen := map[string]bool{}
+	for _, pfx := range pfxs {
+		key := pfx.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		seq, ok := kept[key]
+		if !ok {
+			run = append(run, pfx)
+			continue
+		}
+		number(seq)
+		entries = append(entries, Entry{Seq: seq, Prefix: pfx, Deny: deny})
+		prev = seq
+	}
+	number(0)
+
+	entries = append(entries, added...)
+	for _, list := range [][]Entry{entries, added} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Seq < list[j].Seq })
+	}
+	d.Added = append(d.Added, added...)
+	d.Entries = append(d.Entries, entries...)
+}
+
+// WriteDelta renders the changes of d in the given syntax: as configuration for IOS and Junos, or as prefixes marked +
+// or - for Plain. Entries are added before any are removed, so that a list is never left empty, which some routers
+// take to match everything. Options may be nil.
+func WriteDelta(w io.Writer, d *Delta, syntax Syntax, opts *Options) error {
+	// Junos and Plain lists have no actions or sequence numbers, so only prefixes that were not listed before are added,
+	// and only those that are not listed after are removed.
+	before, after := map[string]bool{}, map[string]bool{}
+	for _, e := range d.Removed {
+		before[e.Prefix.String()] = true
+	}
+	for _, e := range d.Entries {
+		after[e.Prefix.String()] = true
+	}
+
+	var lines []string
+	switch syntax {
+	case Plain:
+		for _, e := range d.Added {
+			if !before[e.Prefix.String()] {
+				lines = append(lines, fmt.Sprintf("+%v", e.Prefix))
+			}
+		}
+		for _, e := range d.Removed {
+			if !after[e.Prefix.String()] {
+				lines = append(lines, fmt.Sprintf("-%v", e.Prefix))
+			}
+		}
+	case IOS:
+		for _, e := range d.Added {
+			action := "permit"
+			if e.Deny {
+				action = "deny"
+			}
+			lines = append(lines, iosLine(opts.name(), e.Seq, action, e.Prefix))
+		}
+		for _, e := range d.Removed {
+			lines = append(lines, fmt.Sprintf("no %s prefix-list %s seq %d", iosFamily(e.Prefix), opts.name(), e.Seq))
+		}
+	case Junos:
+		for _, e := range d.Added {
+			if !before[e.Prefix.String()] {
+				lines = append(lines, fmt.Sprintf("set policy-options prefix-list %s %v", opts.name(), e.Prefix))
+			}
+		}
+		for _, e := range d.Removed {
+			if !after[e.Prefix.String()] {
+				lines = append(lines, fmt.Sprintf("delete policy-options prefix-list %s %v", opts.name(), e.Prefix))
+			}
+		}
+	default:
+		return fmt.Errorf("syntax %q cannot express changes", syntax)
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
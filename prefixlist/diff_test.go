@@ -0,0 +1,173 @@
+package prefixlist
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := map[string]struct {
+		old     string
+		pfxs    []string
+		opts    *Options
+		syntax  Syntax
+		want    string
+		wantNew string
+	}{
+		"Unchanged": {
+			old:     "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/24\n",
+			pfxs:    []string{"192.0.2.0/24"},
+			syntax:  IOS,
+			wantNew: "5 192.0.2.0/24",
+		},
+		"Gaps": {
+			old: "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/24\n" +
+				"ip prefix-list PREFIXES seq 10 permit 198.51.100.0/24\n" +
+				"ip prefix-list PREFIXES seq 15 permit 203.0.113.0/24\n",
+			pfxs:   []string{"10.0.0.0/8", "192.0.2.0/24", "192.0.3.0/24", "198.51.100.0/24", "203.0.113.0/24"},
+			syntax: IOS,
+			want: "ip prefix-list PREFIXES seq 2 permit 10.0.0.0/8\n" +
+				"ip prefix-list PREFIXES seq 7 permit 192.0.3.0/24\n",
+			wantNew: "2 10.0.0.0/8, 5 192.0.2.0/24, 7 192.0.3.0/24, 10 198.51.100.0/24, 15 203.0.113.0/24",
+		},
+		"Replace": {
+			old: "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/25\n" +
+				"ip prefix-list PREFIXES seq 10 permit 192.0.2.128/25\n" +
+				"ip prefix-list PREFIXES seq 15 permit 203.0.113.0/24\n" +
+				"ipv6 prefix-list PREFIXES seq 5 permit 2001:DB8::/32\n",
+			pfxs:   []string{"192.0.2.0/24", "203.0.113.0/24"},
+			syntax: IOS,
+			want: "ip prefix-list PREFIXES seq 7 permit 192.0.2.0/24\n" +
+				"no ip prefix-list PREFIXES seq 5\n" +
+				"no ip prefix-list PREFIXES seq 10\n" +
+				"no ipv6 prefix-list PREFIXES seq 5\n",
+			wantNew: "7 192.0.2.0/24, 15 203.0.113.0/24",
+		},
+		"Full": {
+			old: "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/24\n" +
+				"ip prefix-list PREFIXES seq 6 permit 192.0.4.0/24\n",
+			pfxs:   []string{"192.0.2.0/24", "192.0.3.0/24", "192.0.4.0/24", "192.0.5.0/24"},
+			syntax: IOS,
+			want: "ip prefix-list PREFIXES seq 11 permit 192.0.3.0/24\n" +
+				"ip prefix-list PREFIXES seq 16 permit 192.0.5.0/24\n",
+			wantNew: "5 192.0.2.0/24, 6 192.0.4.0/24, 11 192.0.3.0/24, 16 192.0.5.0/24",
+		},
+		"Empty": {
+			pfxs:   []string{"192.0.2.0/24", "2001:db8::/32", "198.51.100.0/24"},
+			opts:   &Options{Name: "BOGONS", Deny: true, SeqStart: 10, SeqStep: 10},
+			syntax: IOS,
+			want: "ip prefix-list BOGONS seq 10 deny 192.0.2.0/24\n" +
+				"ip prefix-list BOGONS seq 20 deny 198.51.100.0/24\n" +
+				"ipv6 prefix-list BOGONS seq 10 deny 2001:db8::/32\n",
+			wantNew: "10 192.0.2.0/24, 20 198.51.100.0/24, 10 2001:db8::/32",
+		},
+		"Action": {
+			old:    "ip prefix-list BOGONS seq 5 permit 192.0.2.0/24\n",
+			pfxs:   []string{"192.0.2.0/24"},
+			opts:   &Options{Name: "BOGONS", Deny: true},
+			syntax: IOS,
+			want: "ip prefix-list BOGONS seq 10 deny 192.0.2.0/24\n" +
+				"no ip prefix-list BOGONS seq 5\n",
+			wantNew: "10 192.0.2.0/24",
+		},
+		"Junos": {
+			old: "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/25\n" +
+				"ip prefix-list PREFIXES seq 10 deny 198.51.100.0/24\n" +
+				"ip prefix-list PREFIXES seq 15 permit 198.51.100.0/24\n",
+			pfxs:   []string{"192.0.2.0/24", "198.51.100.0/24"},
+			syntax: Junos,
+			want: "set policy-options prefix-list PREFIXES 192.0.2.0/24\n" +
+				"delete policy-options prefix-list PREFIXES 192.0.2.0/25\n",
+			wantNew: "7 192.0.2.0/24, 15 198.51.100.0/24",
+		},
+		"Plain": {
+			old:     "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/25\n",
+			pfxs:    []string{"2001:db8::/32"},
+			syntax:  Plain,
+			want:    "+2001:db8::/32\n-192.0.2.0/25\n",
+			wantNew: "5 2001:db8::/32",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			old, err := ParseIOS(strings.NewReader(test.old), test.opts.name())
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			d := Diff(old, parsePrefixes(t, test.pfxs...), test.opts)
+			var buf bytes.Buffer
+			if err := WriteDelta(&buf, d, test.syntax, test.opts); err != nil {
+				t.Fatalf("write err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+
+			var entries []string
+			for _, e := range d.Entries {
+				entries = append(entries, fmt.Sprintf("%d %v", e.Seq, e.Prefix))
+			}
+			if diff := cmp.Diff(test.wantNew, strings.Join(entries, ", ")); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+
+			// Diffing the new list against itself must find nothing to change.
+			if d := Diff(d.Entries, parsePrefixes(t, test.pfxs...), test.opts); len(d.Added)+len(d.Removed) > 0 {
+				t.Fatalf("changes remain: %+v", d)
+			}
+		})
+	}
+}
+
+func TestParseIOS(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		"Config": {
+			input: "ip prefix-list PREFIXES description customer routes\n" +
+				"ip prefix-list PREFIXES seq 5 permit 192.0.2.0/24\n" +
+				"ip prefix-list OTHER seq 5 permit 198.51.100.0/24\n" +
+				"ipv6 prefix-list PREFIXES seq 10 deny 2001:DB8::/32\n" +
+				"route-map IN permit 10\n",
+			want: []string{"5 permit 192.0.2.0/24", "10 deny 2001:db8::/32"},
+		},
+		"Range": {
+			input:   "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/24 le 32\n",
+			wantErr: true,
+		},
+		"Family": {
+			input:   "ip prefix-list PREFIXES seq 5 permit 2001:db8::/32\n",
+			wantErr: true,
+		},
+		"Seq": {
+			input:   "ip prefix-list PREFIXES seq five permit 192.0.2.0/24\n",
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			entries, err := ParseIOS(strings.NewReader(test.input), DefaultName)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, test.wantErr)
+			}
+			var got []string
+			for _, e := range entries {
+				action := "permit"
+				if e.Deny {
+					action = "deny"
+				}
+				got = append(got, fmt.Sprintf("%d %s %v", e.Seq, action, e.Prefix))
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package prefixlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Problem is a kind of problem found in a prefix file.
+type Problem string
+
+// Problems found by Lint. Canonicalize fixes all but Invalid and DefaultRoute, which need a human decision.
+const (
+	Invalid      Problem = "invalid"       // The entry is not a prefix or address.
+	HostBits     Problem = "host-bits"     // The address has bits set beyond the prefix length.
+	Duplicate    Problem = "duplicate"     // The entry repeats an earlier one, once both are canonical.
+	MixedCase    Problem = "mixed-case"    // An IPv6 address is written with upper case digits.
+	NonCanonical Problem = "non-canonical" // The entry is not written as RFC 5952 and net.IPNet.String would have it.
+	DefaultRoute Problem = "default-route" // The entry is a default route, which is rarely intended in a prefix list.
+)
+
+// Fixable reports whether Canonicalize fixes the problem.
+func (p Problem) Fixable() bool {
+	return p != Invalid && p != DefaultRoute
+}
+
+// Finding is a problem with an entry of a prefix file.
+type Finding struct {
+	Line    int     `json:"line"`
+	Entry   string  `json:"entry"` // The entry as written.
+	Problem Problem `json:"problem"`
+	Detail  string  `json:"detail"`
+	Fix     string  `json:"fix,omitempty"` // What Canonicalize replaces the entry with, or empty if it is removed or kept.
+}
+
+// String formats the finding for display.
+func (f Finding) String() string {
+	return fmt.Sprintf("line %d: %s: %s: %s", f.Line, f.Entry, f.Problem, f.Detail)
+}
+
+// Lint reads a prefix file and reports problems with its entries. The file is read as the aggregate command reads it:
+// one or more entries to a line, separated by spaces or commas, with comments starting with #.
+func Lint(r io.Reader) ([]Finding, error) {
+	return canonicalize(r, nil)
+}
+
+// Canonicalize copies a prefix file to w, fixing the problems Lint reports where it can: entries are rewritten in
+// canonical form, and duplicates are removed. Comments, blank lines, and unfixable entries are kept as they are. It
+// returns every finding, including those that were fixed.
+func Canonicalize(r io.Reader, w io.Writer) ([]Finding, error) {
+	return canonicalize(r, w)
+}
+
+// canonicalize implements Lint and Canonicalize, only writing the canonical file if w is not nil.
+func canonicalize(r io.Reader, w io.Writer) ([]Finding, error) {
+	var findings []Finding
+	seen := map[string]int{}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text, comment := s.Text(), ""
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text, comment = text[:i], text[i:]
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+
+		var kept []string
+		for _, field := range fields {
+			canonical, lineFindings := lintEntry(field)
+			if canonical != "" {
+				if first, ok := seen[canonical]; ok {
+					lineFindings = append(lineFindings, Finding{
+						Entry:   field,
+						Problem: Duplicate,
+						Detail:  fmt.Sprintf("duplicate of %s on line %d", canonical, first),
+					})
+					canonical = ""
+				} else {
+					seen[canonical] = line
+					kept = append(kept, canonical)
+				}
+			} else {
+				kept = append(kept, field)
+			}
+			for _, f := range lineFindings {
+				f.Line = line
+				if f.Problem.Fixable() && f.Problem != Duplicate {
+					f.Fix = canonical
+				}
+				findings = append(findings, f)
+			}
+		}
+		if w == nil {
+			continue
+		}
+
+		// Lines keep their comments, and the spacing before them, but lose any entries that were removed; lines left
+		// with nothing on them are dropped.
+		out := s.Text()
+		switch {
+		case len(fields) == 0:
+		case len(kept) > 0:
+			out = strings.Join(kept, ", ") + text[len(strings.TrimRight(text, " \t")):] + comment
+		case comment != "":
+			out = comment
+		default:
+			continue
+		}
+		if _, err := fmt.Fprintln(w, out); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// lintEntry checks a single entry, returning its canonical form, or an empty string if it is invalid, and the problems
+// found, without their line numbers.
+func lintEntry(entry string) (string, []Finding) {
+	// Exclusions, written with a leading !, are checked as the prefix they exclude, and stay exclusions once canonical.
+	if strings.HasPrefix(entry, "!") && !strings.HasPrefix(entry, "!!") {
+		canonical, findings := lintEntry(entry[1:])
+		for i := range findings {
+			findings[i].Entry = entry
+		}
+		if canonical != "" {
+			canonical = "!" + canonical
+		}
+		return canonical, findings
+	}
+
+	s := entry
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", []Finding{{Entry: entry, Problem: Invalid, Detail: "not a prefix or address"}}
+		}
+		if ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+	ip, pfx, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", []Finding{{Entry: entry, Problem: Invalid, Detail: "not a prefix or address"}}
+	}
+
+	canonical := pfx.String()
+	var findings []Finding
+	if !ip.Equal(pfx.IP) {
+		findings = append(findings, Finding{
+			Entry:   entry,
+			Problem: HostBits,
+			Detail:  fmt.Sprintf("host bits set, the prefix is %s", canonical),
+		})
+	}
+	if ip.To4() == nil && strings.ToLower(entry) != entry {
+		findings = append(findings, Finding{Entry: entry, Problem: MixedCase, Detail: "upper case in IPv6 address"})
+	}
+
+	// Once case is accounted for, anything else that differs is the way the address or length was written.
+	ones, _ := pfx.Mask.Size()
+	if written := fmt.Sprintf("%v/%d", ip, ones); strings.ToLower(entry) != written {
+		findings = append(findings, Finding{
+			Entry:   entry,
+			Problem: NonCanonical,
+			Detail:  fmt.Sprintf("written as %s rather than %s", strings.ToLower(entry), written),
+		})
+	}
+	if ones == 0 {
+		findings = append(findings, Finding{Entry: entry, Problem: DefaultRoute, Detail: "default route"})
+	}
+	return canonical, findings
+}
@@ -0,0 +1,99 @@
+package prefixlist
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := map[string]struct {
+		input        string
+		want         string
+		wantFindings []Finding
+	}{
+		"Clean": {
+			input: "# Customers\n192.0.2.0/24\n\n2001:db8::/32 # documentation\n",
+			want:  "# Customers\n192.0.2.0/24\n\n2001:db8::/32 # documentation\n",
+		},
+		"HostBits": {
+			input: "10.1.2.3/8   # host bits\n",
+			want:  "10.0.0.0/8   # host bits\n",
+			wantFindings: []Finding{
+				{1, "10.1.2.3/8", HostBits, "host bits set, the prefix is 10.0.0.0/8", "10.0.0.0/8"},
+			},
+		},
+		"IPv6": {
+			input: "2001:DB8::/32\n2001:db8:0:0::1/128, 2001:db8::/48\n",
+			want:  "2001:db8::/32\n2001:db8::1/128, 2001:db8::/48\n",
+			wantFindings: []Finding{
+				{1, "2001:DB8::/32", MixedCase, "upper case in IPv6 address", "2001:db8::/32"},
+				{2, "2001:db8:0:0::1/128", NonCanonical, "written as 2001:db8:0:0::1/128 rather than 2001:db8::1/128",
+					"2001:db8::1/128"},
+			},
+		},
+		"Duplicates": {
+			input: "192.0.2.0/24\n192.0.2.7/24, 198.51.100.0/24\n192.0.2.0/24 # again\n192.0.2.0/24\n",
+			want:  "192.0.2.0/24\n198.51.100.0/24\n# again\n",
+			wantFindings: []Finding{
+				{2, "192.0.2.7/24", HostBits, "host bits set, the prefix is 192.0.2.0/24", ""},
+				{2, "192.0.2.7/24", Duplicate, "duplicate of 192.0.2.0/24 on line 1", ""},
+				{3, "192.0.2.0/24", Duplicate, "duplicate of 192.0.2.0/24 on line 1", ""},
+				{4, "192.0.2.0/24", Duplicate, "duplicate of 192.0.2.0/24 on line 1", ""},
+			},
+		},
+		"Exclusions": {
+			input: "10.0.0.0/8\n!10.1.2.0/24, !10.1.3.7/24\n!10.1.2.0/24 # again\n!!10.1.4.0/24\n",
+			want:  "10.0.0.0/8\n!10.1.2.0/24, !10.1.3.0/24\n# again\n!!10.1.4.0/24\n",
+			wantFindings: []Finding{
+				{2, "!10.1.3.7/24", HostBits, "host bits set, the prefix is 10.1.3.0/24", "!10.1.3.0/24"},
+				{3, "!10.1.2.0/24", Duplicate, "duplicate of !10.1.2.0/24 on line 2", ""},
+				{4, "!!10.1.4.0/24", Invalid, "not a prefix or address", ""},
+			},
+		},
+		"Unfixable": {
+			input: "0.0.0.0/0\nbogus, 192.0.2.1\n",
+			want:  "0.0.0.0/0\nbogus, 192.0.2.1/32\n",
+			wantFindings: []Finding{
+				{1, "0.0.0.0/0", DefaultRoute, "default route", ""},
+				{2, "bogus", Invalid, "not a prefix or address", ""},
+				{2, "192.0.2.1", NonCanonical, "written as 192.0.2.1 rather than 192.0.2.1/32", "192.0.2.1/32"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			findings, err := Canonicalize(strings.NewReader(test.input), &out)
+			if err != nil {
+				t.Fatalf("canonicalize err: %v", err)
+			}
+			if diff := cmp.Diff(test.wantFindings, findings); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if diff := cmp.Diff(test.want, out.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+
+			// Linting finds the same problems, and canonical output has nothing left to fix.
+			findings, err = Lint(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("lint err: %v", err)
+			}
+			if diff := cmp.Diff(test.wantFindings, findings); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			findings, err = Lint(&out)
+			if err != nil {
+				t.Fatalf("lint err: %v", err)
+			}
+			for _, f := range findings {
+				if f.Problem.Fixable() {
+					t.Fatalf("canonical output has fixable finding %v", f)
+				}
+			}
+		})
+	}
+}
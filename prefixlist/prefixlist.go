@@ -0,0 +1,181 @@
+package prefixlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Syntax is an output format for a list of prefixes.
+type Syntax string
+
+// Supported syntaxes.
+const (
+	Plain Syntax = "plain" // One prefix per line.
+	JSON  Syntax = "json"  // An array of prefix strings.
+	IOS   Syntax = "ios"   // Cisco IOS and Arista EOS prefix lists.
+	Junos Syntax = "junos" // Juniper Junos policy-options prefix lists, as set commands.
+	BIRD  Syntax = "bird"  // BIRD 2 prefix set constants.
+)
+
+// Syntaxes lists the supported syntaxes.
+var Syntaxes = []Syntax{Plain, JSON, IOS, Junos, BIRD}
+
+// Defaults used by Options whose fields are not set.
+const (
+	DefaultName     = "PREFIXES"
+	DefaultSeqStart = 5
+	DefaultSeqStep  = 5
+)
+
+// Options control the rendering of router configuration.
+type Options struct {
+	Name     string // The name of the prefix list, or DefaultName if empty.
+	Deny     bool   // Deny the prefixes rather than permitting them, where the syntax has actions.
+	SeqStart int    // The first sequence number, or DefaultSeqStart if zero.
+	SeqStep  int    // The gap between sequence numbers, or DefaultSeqStep if zero.
+}
+
+// name returns the name of the prefix list.
+func (o *Options) name() string {
+	if o == nil || o.Name == "" {
+		return DefaultName
+	}
+	return o.Name
+}
+
+// action returns the action applied to the prefixes.
+func (o *Options) action() string {
+	if o != nil && o.Deny {
+		return "deny"
+	}
+	return "permit"
+}
+
+// seq returns the i'th sequence number.
+func (o *Options) seq(i int) int {
+	start := DefaultSeqStart
+	if o != nil && o.SeqStart > 0 {
+		start = o.SeqStart
+	}
+	return start + i*o.step()
+}
+
+// step returns the gap between sequence numbers.
+func (o *Options) step() int {
+	if o != nil && o.SeqStep > 0 {
+		return o.SeqStep
+	}
+	return DefaultSeqStep
+}
+
+// ParseSyntax returns the syntax with the given name.
+func ParseSyntax(s string) (Syntax, error) {
+	for _, syntax := range Syntaxes {
+		if string(syntax) == strings.ToLower(s) {
+			return syntax, nil
+		}
+	}
+	return "", fmt.Errorf("unknown syntax %q", s)
+}
+
+// Write renders pfxs in the given syntax. Options may be nil, and only affect router configuration syntaxes.
+func Write(w io.Writer, pfxs []*net.IPNet, syntax Syntax, opts *Options) error {
+	switch syntax {
+	case Plain:
+		for _, pfx := range pfxs {
+			if _, err := fmt.Fprintln(w, pfx); err != nil {
+				return err
+			}
+		}
+		return nil
+	case JSON:
+		strs := make([]string, 0, len(pfxs))
+		for _, pfx := range pfxs {
+			strs = append(strs, pfx.String())
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(strs)
+	case IOS:
+		return writeIOS(w, pfxs, opts)
+	case Junos:
+		for _, pfx := range pfxs {
+			if _, err := fmt.Fprintf(w, "set policy-options prefix-list %s %v\n", opts.name(), pfx); err != nil {
+				return err
+			}
+		}
+		return nil
+	case BIRD:
+		return writeBIRD(w, pfxs, opts)
+	}
+	return fmt.Errorf("unknown syntax %q", syntax)
+}
+
+// iosLine returns the IOS statement for pfx with sequence number seq; IPv4 and IPv6 prefix lists are separate
+// commands.
+func iosLine(name string, seq int, action string, pfx *net.IPNet) string {
+	return fmt.Sprintf("%s prefix-list %s seq %d %s %v", iosFamily(pfx), name, seq, action, pfx)
+}
+
+// iosFamily returns the IOS keyword for the address family of pfx.
+func iosFamily(pfx *net.IPNet) string {
+	if pfx.IP.To4() == nil {
+		return "ipv6"
+	}
+	return "ip"
+}
+
+// writeIOS renders prefix lists for IOS, numbering the IPv4 and IPv6 lists separately.
+func writeIOS(w io.Writer, pfxs []*net.IPNet, opts *Options) error {
+	v4, v6 := split(pfxs)
+	for _, list := range [][]*net.IPNet{v4, v6} {
+		for i, pfx := range list {
+			if _, err := fmt.Fprintln(w, iosLine(opts.name(), opts.seq(i), opts.action(), pfx)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeBIRD renders prefix set constants for BIRD. A set holds a single family, so when both are present they are
+// written as two sets, with the family appended to their names.
+func writeBIRD(w io.Writer, pfxs []*net.IPNet, opts *Options) error {
+	v4, v6 := split(pfxs)
+	sets := []struct {
+		name string
+		pfxs []*net.IPNet
+	}{{opts.name(), v4}, {opts.name(), v6}}
+	if len(v4) > 0 && len(v6) > 0 {
+		sets[0].name += "_V4"
+		sets[1].name += "_V6"
+	}
+	for _, set := range sets {
+		if len(set.pfxs) == 0 {
+			continue
+		}
+		strs := make([]string, 0, len(set.pfxs))
+		for _, pfx := range set.pfxs {
+			strs = append(strs, "\t"+pfx.String())
+		}
+		if _, err := fmt.Fprintf(w, "define %s = [\n%s\n];\n", set.name, strings.Join(strs, ",\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split separates IPv4 and IPv6 prefixes, keeping their order.
+func split(pfxs []*net.IPNet) (v4, v6 []*net.IPNet) {
+	for _, pfx := range pfxs {
+		if pfx.IP.To4() != nil {
+			v4 = append(v4, pfx)
+		} else {
+			v6 = append(v6, pfx)
+		}
+	}
+	return v4, v6
+}
@@ -0,0 +1,97 @@
+package prefixlist
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func parsePrefixes(t *testing.T, strs ...string) []*net.IPNet {
+	t.Helper()
+	var pfxs []*net.IPNet
+	for _, s := range strs {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	return pfxs
+}
+
+func TestWrite(t *testing.T) {
+	mixed := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32", "198.51.100.0/24")
+
+	tests := map[string]struct {
+		pfxs   []*net.IPNet
+		syntax Syntax
+		opts   *Options
+		want   string
+	}{
+		"Plain": {
+			pfxs:   mixed,
+			syntax: Plain,
+			want:   "192.0.2.0/24\n2001:db8::/32\n198.51.100.0/24\n",
+		},
+		"JSON": {
+			pfxs:   mixed[:2],
+			syntax: JSON,
+			want:   "[\n  \"192.0.2.0/24\",\n  \"2001:db8::/32\"\n]\n",
+		},
+		"JSONEmpty": {
+			syntax: JSON,
+			want:   "[]\n",
+		},
+		"IOS": {
+			pfxs:   mixed,
+			syntax: IOS,
+			want: "ip prefix-list PREFIXES seq 5 permit 192.0.2.0/24\n" +
+				"ip prefix-list PREFIXES seq 10 permit 198.51.100.0/24\n" +
+				"ipv6 prefix-list PREFIXES seq 5 permit 2001:db8::/32\n",
+		},
+		"IOSOptions": {
+			pfxs:   mixed[:1],
+			syntax: IOS,
+			opts:   &Options{Name: "BOGONS", Deny: true, SeqStart: 100, SeqStep: 10},
+			want:   "ip prefix-list BOGONS seq 100 deny 192.0.2.0/24\n",
+		},
+		"Junos": {
+			pfxs:   mixed[:2],
+			syntax: Junos,
+			opts:   &Options{Name: "CUSTOMERS"},
+			want: "set policy-options prefix-list CUSTOMERS 192.0.2.0/24\n" +
+				"set policy-options prefix-list CUSTOMERS 2001:db8::/32\n",
+		},
+		"BIRD": {
+			pfxs:   mixed[:1],
+			syntax: BIRD,
+			want:   "define PREFIXES = [\n\t192.0.2.0/24\n];\n",
+		},
+		"BIRDMixed": {
+			pfxs:   mixed,
+			syntax: BIRD,
+			want: "define PREFIXES_V4 = [\n\t192.0.2.0/24,\n\t198.51.100.0/24\n];\n" +
+				"define PREFIXES_V6 = [\n\t2001:db8::/32\n];\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, test.pfxs, test.syntax, test.opts); err != nil {
+				t.Fatalf("write err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	if err := Write(&bytes.Buffer{}, mixed, Syntax("xml"), nil); err == nil {
+		t.Fatalf("unknown syntax accepted")
+	}
+	if s, err := ParseSyntax("JunOS"); err != nil || s != Junos {
+		t.Fatalf("parse syntax: got %v, %v", s, err)
+	}
+}
@@ -0,0 +1,178 @@
+package prefixtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Format is an output format for a prefix tree.
+type Format string
+
+// Supported formats.
+const (
+	Text Format = "text" // One prefix per line, indented beneath the prefix that covers it.
+	JSON Format = "json" // An array of objects with the prefix and its children.
+	DOT  Format = "dot"  // A Graphviz digraph with an edge from each prefix to the prefixes it directly covers.
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{Text, JSON, DOT}
+
+// Node is a prefix in a tree, with the prefixes it directly covers.
+type Node struct {
+	Prefix   *net.IPNet
+	Children []*Node
+}
+
+// MarshalJSON encodes the node with its prefix in CIDR notation.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Prefix   string  `json:"prefix"`
+		Children []*Node `json:"children,omitempty"`
+	}{n.Prefix.String(), n.Children})
+}
+
+// Covered returns the fraction of the addresses in the prefix that are within its children.
+func (n *Node) Covered() float64 {
+	ones, _ := n.Prefix.Mask.Size()
+	var covered float64
+	for _, child := range n.Children {
+		childOnes, _ := child.Prefix.Mask.Size()
+		covered += math.Ldexp(1, ones-childOnes)
+	}
+	return covered
+}
+
+// Build nests prefixes beneath the longest other prefix that covers them, and returns the roots: the prefixes that no
+// other covers. Duplicates are removed, and the roots and each node's children are sorted by address, IPv4 first. To
+// show how prefixes aggregate, include their aggregates in pfxs.
+func Build(pfxs []*net.IPNet) []*Node {
+	nodes := make([]*Node, 0, len(pfxs))
+	for _, pfx := range pfxs {
+		ip := pfx.IP.Mask(pfx.Mask)
+		if ip == nil {
+			continue
+		}
+		nodes = append(nodes, &Node{Prefix: &net.IPNet{IP: ip, Mask: pfx.Mask}})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return less(nodes[i].Prefix, nodes[j].Prefix) })
+
+	var roots, stack []*Node
+	for i, n := range nodes {
+		if i > 0 && equal(nodes[i-1].Prefix, n.Prefix) {
+			continue
+		}
+		for len(stack) > 0 && !contains(stack[len(stack)-1].Prefix, n.Prefix) {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, n)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, n)
+		}
+		stack = append(stack, n)
+	}
+	return roots
+}
+
+// less orders IPv4 prefixes before IPv6 ones, then by address, then shorter prefixes first, so that every prefix
+// comes after those covering it.
+func less(a, b *net.IPNet) bool {
+	if len(a.IP) != len(b.IP) {
+		return len(a.IP) < len(b.IP)
+	}
+	if c := bytes.Compare(a.IP, b.IP); c != 0 {
+		return c < 0
+	}
+	aOnes, _ := a.Mask.Size()
+	bOnes, _ := b.Mask.Size()
+	return aOnes < bOnes
+}
+
+// equal reports whether two prefixes are the same.
+func equal(a, b *net.IPNet) bool {
+	return a.IP.Equal(b.IP) && bytes.Equal(a.Mask, b.Mask)
+}
+
+// contains reports whether outer covers inner.
+func contains(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == strings.ToLower(s) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+// Write renders the trees beneath roots in the given format.
+func Write(w io.Writer, roots []*Node, format Format) error {
+	switch format {
+	case Text:
+		return writeText(w, roots, 0)
+	case JSON:
+		if roots == nil {
+			roots = []*Node{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(roots)
+	case DOT:
+		return writeDOT(w, roots)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// writeText writes each node indented by two spaces a level, with the share of its addresses its children cover.
+func writeText(w io.Writer, nodes []*Node, depth int) error {
+	for _, n := range nodes {
+		line := strings.Repeat("  ", depth) + n.Prefix.String()
+		if len(n.Children) > 0 {
+			subnets := "subnets"
+			if len(n.Children) == 1 {
+				subnets = "subnet"
+			}
+			line += fmt.Sprintf(" (%d %s, %.2f%% covered)", len(n.Children), subnets, 100*n.Covered())
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if err := writeText(w, n.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDOT writes a digraph whose vertices are named by their prefixes.
+func writeDOT(w io.Writer, roots []*Node) error {
+	var b strings.Builder
+	b.WriteString("digraph prefixes {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, n := range nodes {
+			fmt.Fprintf(&b, "\t%q;\n", n.Prefix.String())
+			for _, child := range n.Children {
+				fmt.Fprintf(&b, "\t%q -> %q;\n", n.Prefix.String(), child.Prefix.String())
+			}
+			walk(n.Children)
+		}
+	}
+	walk(roots)
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,109 @@
+package prefixtree
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+// parse parses CIDR prefixes, panicking on errors.
+func parse(strs ...string) []*net.IPNet {
+	pfxs := make([]*net.IPNet, 0, len(strs))
+	for _, s := range strs {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	return pfxs
+}
+
+func TestWrite(t *testing.T) {
+	pfxs := parse("2001:db8::/32", "10.1.0.0/16", "10.0.0.0/8", "10.1.2.0/24", "10.1.0.0/16", "10.200.0.0/16",
+		"192.0.2.0/24", "10.1.3.0/24", "2001:db8:1::/48")
+	tests := map[string]struct {
+		pfxs   []*net.IPNet
+		format Format
+		want   string
+	}{
+		"Text": {
+			pfxs:   pfxs,
+			format: Text,
+			want: `10.0.0.0/8 (2 subnets, 0.78% covered)
+  10.1.0.0/16 (2 subnets, 0.78% covered)
+    10.1.2.0/24
+    10.1.3.0/24
+  10.200.0.0/16
+192.0.2.0/24
+2001:db8::/32 (1 subnet, 0.00% covered)
+  2001:db8:1::/48
+`,
+		},
+		"JSON": {
+			pfxs:   parse("10.0.0.0/8", "10.1.0.0/16", "192.0.2.0/24"),
+			format: JSON,
+			want: `[
+  {
+    "prefix": "10.0.0.0/8",
+    "children": [
+      {
+        "prefix": "10.1.0.0/16"
+      }
+    ]
+  },
+  {
+    "prefix": "192.0.2.0/24"
+  }
+]
+`,
+		},
+		"JSONEmpty": {
+			format: JSON,
+			want:   "[]\n",
+		},
+		"DOT": {
+			pfxs:   parse("10.1.0.0/16", "10.0.0.0/8", "10.2.0.0/16"),
+			format: DOT,
+			want: `digraph prefixes {
+	rankdir=LR;
+	node [shape=box];
+	"10.0.0.0/8";
+	"10.0.0.0/8" -> "10.1.0.0/16";
+	"10.0.0.0/8" -> "10.2.0.0/16";
+	"10.1.0.0/16";
+	"10.2.0.0/16";
+}
+`,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Write(&b, Build(tc.pfxs), tc.format); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, b.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestCovered(t *testing.T) {
+	roots := Build(parse("192.0.2.0/24", "192.0.2.0/25", "192.0.2.128/26", "192.0.2.128/27"))
+	if diff := cmp.Diff(0.75, roots[0].Covered()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := ParseFormat("DOT"); err != nil || format != DOT {
+		t.Fatalf("got %q, %v", format, err)
+	}
+	if _, err := ParseFormat("svg"); err == nil {
+		t.Fatalf("got no error")
+	}
+}
@@ -0,0 +1,107 @@
+package proxydial
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// HTTPConnect dials TCP connections through an HTTP proxy with the CONNECT method.
+type HTTPConnect struct {
+	Address string // The host and port of the proxy.
+	// TLS connects to the proxy over TLS, with TLSConfig, or the default configuration if it is nil. The proxy's host
+	// name is verified unless TLSConfig names another server.
+	TLS       bool
+	TLSConfig *tls.Config
+	Username  string        // Sent with basic authentication if not empty.
+	Password  string        // Sent with basic authentication if Username is not empty.
+	Header    http.Header   // Added to each CONNECT request, such as for other kinds of authentication.
+	Forward   ContextDialer // Dials the proxy, or a net.Dialer if nil.
+}
+
+// DialContext connects to an address through the proxy, returning a *Conn. The TLS handshake with the proxy counts
+// towards the handshake of the tunnel.
+func (h *HTTPConnect) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, connect, err := dialProxy(ctx, h.Forward, network, h.Address)
+	if err != nil {
+		return nil, err
+	}
+	var tunnel net.Conn
+	hs, err := handshake(ctx, conn, func() error {
+		var err error
+		tunnel, err = h.handshake(conn, address)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("http proxy %s: %w", h.Address, err)
+	}
+	return &Conn{Conn: tunnel, Proxy: h.Address, Connect: connect, Handshake: hs}, nil
+}
+
+// handshake sends the CONNECT request, over TLS if configured, returning the connection carrying the tunnel.
+func (h *HTTPConnect) handshake(conn net.Conn, address string) (net.Conn, error) {
+	if h.TLS {
+		config := &tls.Config{}
+		if h.TLSConfig != nil {
+			config = h.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(h.Address)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+		req.Header["Proxy-Authorization"] = req.Header["Authorization"]
+		delete(req.Header, "Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return nil, ErrAuthFailed
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("connect %s: %s", address, resp.Status)
+	}
+	// The server may have sent data of the tunnel along with the response.
+	if r.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose reads start with buffered data.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads the buffered data, then from the connection.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
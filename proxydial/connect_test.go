@@ -0,0 +1,124 @@
+package proxydial
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// connectServer is an HTTP proxy accepting CONNECT requests with the basic authentication "user:secret", which sends
+// greeting through the tunnel along with its response.
+func connectServer(t *testing.T, greeting string) *httptest.Server {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n" + greeting))
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestHTTPConnect(t *testing.T) {
+	echo := echoServer(t)
+	tests := map[string]struct {
+		dialer   HTTPConnect
+		tls      bool
+		greeting string
+		want     string
+		network  string
+		wantErr  error
+	}{
+		"Plain": {
+			dialer: HTTPConnect{Username: "user", Password: "secret"},
+			want:   "hello",
+		},
+		"Buffered": {
+			dialer:   HTTPConnect{Username: "user", Password: "secret"},
+			greeting: "hi ",
+			want:     "hi hello",
+		},
+		"TLS": {
+			dialer: HTTPConnect{Username: "user", Password: "secret", TLS: true},
+			tls:    true,
+			want:   "hello",
+		},
+		"Header": {
+			dialer: HTTPConnect{Header: http.Header{"Proxy-Authorization": {"Basic dXNlcjpzZWNyZXQ="}}},
+			want:   "hello",
+		},
+		"AuthFailed": {
+			dialer:  HTTPConnect{Username: "user", Password: "wrong"},
+			wantErr: ErrAuthFailed,
+		},
+		"UDP": {
+			network: "udp",
+			wantErr: ErrUnsupportedNetwork,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := connectServer(t, test.greeting)
+			d := test.dialer
+			if test.tls {
+				s.StartTLS()
+				d.TLSConfig = &tls.Config{RootCAs: s.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+			} else {
+				s.Start()
+			}
+			d.Address = s.Listener.Addr().String()
+			network := "tcp"
+			if test.network != "" {
+				network = test.network
+			}
+
+			conn, err := d.DialContext(context.Background(), network, echo)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("got err %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dial err: %v", err)
+			}
+			defer conn.Close()
+			if c := conn.(*Conn); c.Connect <= 0 || c.Handshake <= 0 {
+				t.Fatalf("got %+v", c)
+			}
+			conn.Write([]byte("hello"))
+			got := make([]byte, len(test.want))
+			if _, err := io.ReadFull(conn, got); err != nil {
+				t.Fatalf("read err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
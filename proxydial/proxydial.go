@@ -0,0 +1,123 @@
+package proxydial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ContextDialer dials connections, as a net.Dialer does. The dialers of this package are ContextDialers, so that they
+// can be chained, and used by the probes of other packages in place of a direct dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Errors returned while establishing tunnels.
+var (
+	ErrUnsupportedNetwork = errors.New("proxy only tunnels tcp")
+	ErrAuthFailed         = errors.New("proxy authentication failed")
+)
+
+// Conn is a connection tunnelled through a proxy, which records how long each phase of establishing it took.
+type Conn struct {
+	net.Conn // The connection to the proxy, carrying the tunnel once it is established.
+
+	Proxy     string        // The address of the proxy.
+	Connect   time.Duration // Connecting to the proxy.
+	Handshake time.Duration // Establishing the tunnel once connected, including any authentication.
+}
+
+// FromURL returns a dialer for a proxy URL: socks5:// for SOCKS5 resolving names locally, socks5h:// for SOCKS5
+// resolving names on the proxy, http:// for HTTP CONNECT, or https:// for HTTP CONNECT over TLS. User information in
+// the URL is used to authenticate. Connections to the proxy are dialed by forward, or a net.Dialer if it is nil.
+func FromURL(raw string, forward ContextDialer) (ContextDialer, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	username := u.User.Username()
+	password, _ := u.User.Password()
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		return &SOCKS5{
+			Address:   withPort(u, "1080"),
+			Username:  username,
+			Password:  password,
+			RemoteDNS: u.Scheme == "socks5h",
+			Forward:   forward,
+		}, nil
+	case "http", "https":
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		return &HTTPConnect{
+			Address:  withPort(u, port),
+			TLS:      u.Scheme == "https",
+			Username: username,
+			Password: password,
+			Forward:  forward,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+}
+
+// withPort returns the host and port of a URL, with a default port if it has none.
+func withPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// dialProxy connects to a proxy, returning the connection and how long it took.
+func dialProxy(ctx context.Context, forward ContextDialer, network, address string) (net.Conn, time.Duration, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, 0, fmt.Errorf("%w, not %s", ErrUnsupportedNetwork, network)
+	}
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	start := time.Now()
+	conn, err := forward.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, 0, err
+	}
+	return conn, time.Since(start), nil
+}
+
+// handshake runs f on a connection, bounded by the deadline of ctx, and closes the connection if it fails.
+func handshake(ctx context.Context, conn net.Conn, f func() error) (time.Duration, error) {
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	defer conn.SetDeadline(time.Time{})
+	// Cancelling the context interrupts the handshake by expiring the deadline.
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	start := time.Now()
+	if err := f(); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,160 @@
+package proxydial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 reply codes, from RFC 1928.
+var socks5Replies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "ttl expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// SOCKS5 dials TCP connections through a SOCKS5 proxy (RFC 1928), authenticating with a username and password (RFC
+// 1929) if one is set.
+type SOCKS5 struct {
+	Address  string // The host and port of the proxy.
+	Username string
+	Password string
+	// RemoteDNS sends host names to the proxy to resolve, rather than resolving them locally, as is needed where the
+	// names are only resolvable from the proxy.
+	RemoteDNS bool
+	Forward   ContextDialer // Dials the proxy, or a net.Dialer if nil.
+}
+
+// DialContext connects to an address through the proxy, returning a *Conn.
+func (s *SOCKS5) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+	if net.ParseIP(host) == nil && !s.RemoteDNS {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("no address for %s", host)
+		}
+		host = ips[0].IP.String()
+	}
+
+	conn, connect, err := dialProxy(ctx, s.Forward, network, s.Address)
+	if err != nil {
+		return nil, err
+	}
+	hs, err := handshake(ctx, conn, func() error {
+		return s.handshake(conn, host, uint16(port))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("socks5 proxy %s: %w", s.Address, err)
+	}
+	return &Conn{Conn: conn, Proxy: s.Address, Connect: connect, Handshake: hs}, nil
+}
+
+// handshake negotiates authentication and asks the proxy to connect to a host and port.
+func (s *SOCKS5) handshake(conn net.Conn, host string, port uint16) error {
+	methods := []byte{0x00}
+	if s.Username != "" {
+		methods = []byte{0x02}
+	}
+	if _, err := conn.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	var b [2]byte
+	if _, err := io.ReadFull(conn, b[:]); err != nil {
+		return err
+	}
+	if b[0] != 5 {
+		return fmt.Errorf("unsupported version %d", b[0])
+	}
+	switch b[1] {
+	case 0x00:
+	case 0x02:
+		if err := s.authenticate(conn); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: no acceptable method", ErrAuthFailed)
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host name %q is too long", host)
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else {
+		req = append(append(req, 4), ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		if msg, ok := socks5Replies[reply[1]]; ok {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("reply code %d", reply[1])
+	}
+	// The bound address follows, which is of no use for a connection.
+	var skip int
+	switch reply[3] {
+	case 1:
+		skip = net.IPv4len + 2
+	case 4:
+		skip = net.IPv6len + 2
+	case 3:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return err
+		}
+		skip = int(l[0]) + 2
+	default:
+		return fmt.Errorf("unsupported address type %d", reply[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, skip))
+	return err
+}
+
+// authenticate sends the username and password.
+func (s *SOCKS5) authenticate(conn net.Conn) error {
+	if len(s.Username) > 255 || len(s.Password) > 255 {
+		return errors.New("username or password too long")
+	}
+	req := append([]byte{1, byte(len(s.Username))}, s.Username...)
+	req = append(append(req, byte(len(s.Password))), s.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var b [2]byte
+	if _, err := io.ReadFull(conn, b[:]); err != nil {
+		return err
+	}
+	if b[1] != 0 {
+		return ErrAuthFailed
+	}
+	return nil
+}
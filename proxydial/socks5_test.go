@@ -0,0 +1,213 @@
+package proxydial
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// echoServer accepts connections and echoes what they send.
+func echoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// pipe copies between two connections until both directions are closed.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(b, a)
+		b.(*net.TCPConn).CloseWrite()
+		close(done)
+	}()
+	io.Copy(a, b)
+	a.(*net.TCPConn).CloseWrite()
+	<-done
+}
+
+// socks5Server is a SOCKS5 proxy requiring a username and password if user is not empty. It connects to the address
+// asked for, resolving "echo.test" to echo, and records the destinations asked for.
+func socks5Server(t *testing.T, user, password, echo string, asked chan<- string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 512)
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				methods := buf[2 : 2+buf[1]]
+				if _, err := io.ReadFull(conn, methods); err != nil {
+					return
+				}
+				method := byte(0)
+				if user != "" {
+					method = 2
+				}
+				conn.Write([]byte{5, method})
+				if user != "" {
+					io.ReadFull(conn, buf[:2])
+					u := make([]byte, buf[1])
+					io.ReadFull(conn, u)
+					io.ReadFull(conn, buf[:1])
+					p := make([]byte, buf[0])
+					io.ReadFull(conn, p)
+					if string(u) != user || string(p) != password {
+						conn.Write([]byte{1, 1})
+						return
+					}
+					conn.Write([]byte{1, 0})
+				}
+
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				var host string
+				switch buf[3] {
+				case 1:
+					io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 3:
+					io.ReadFull(conn, buf[:1])
+					name := make([]byte, buf[0])
+					io.ReadFull(conn, name)
+					host = string(name)
+				}
+				io.ReadFull(conn, buf[:2])
+				addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf))))
+				asked <- addr
+				if host == "echo.test" {
+					addr = echo
+				}
+				upstream, err := net.Dial("tcp", addr)
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{5, 0, 0, 3, 4, 'p', 'r', 'o', 'x', 0x10, 0x00})
+				pipe(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestSOCKS5(t *testing.T) {
+	echo := echoServer(t)
+	_, echoPort, _ := net.SplitHostPort(echo)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	closed.Close()
+
+	tests := map[string]struct {
+		dialer    SOCKS5
+		user      string
+		address   string
+		wantAsked string
+		fail      bool
+		wantErr   error
+	}{
+		"Address": {
+			address:   echo,
+			wantAsked: echo,
+		},
+		"RemoteDNS": {
+			dialer:    SOCKS5{RemoteDNS: true},
+			address:   "echo.test:" + echoPort,
+			wantAsked: "echo.test:" + echoPort,
+		},
+		"Auth": {
+			dialer:    SOCKS5{Username: "user", Password: "secret"},
+			user:      "user",
+			address:   echo,
+			wantAsked: echo,
+		},
+		"AuthFailed": {
+			dialer:  SOCKS5{Username: "user", Password: "wrong"},
+			user:    "user",
+			address: echo,
+			wantErr: ErrAuthFailed,
+		},
+		"NoAuth": {
+			user:    "user",
+			address: echo,
+			wantErr: ErrAuthFailed,
+		},
+		"Refused": {
+			address:   closed.Addr().String(),
+			wantAsked: closed.Addr().String(),
+			fail:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			asked := make(chan string, 1)
+			d := test.dialer
+			d.Address = socks5Server(t, test.user, "secret", echo, asked)
+			conn, err := d.DialContext(context.Background(), "tcp", test.address)
+			if test.wantAsked != "" {
+				if diff := cmp.Diff(test.wantAsked, <-asked); diff != "" {
+					t.Fatalf("%v", diff)
+				}
+			}
+			if test.fail || test.wantErr != nil {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+					t.Fatalf("got err %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dial err: %v", err)
+			}
+			defer conn.Close()
+			c := conn.(*Conn)
+			if c.Proxy != d.Address || c.Connect <= 0 || c.Handshake <= 0 {
+				t.Fatalf("got %+v", c)
+			}
+			conn.Write([]byte("hello"))
+			conn.(*Conn).Conn.(*net.TCPConn).CloseWrite()
+			got, _ := ioutil.ReadAll(conn)
+			if diff := cmp.Diff("hello", string(got)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Command is what a connection carrying a header is for.
+type Command byte
+
+// Commands.
+const (
+	// The connection was made by the proxy itself, such as for a health check, and the addresses are not a client's.
+	CommandLocal Command = 0
+	// The connection is relayed for a client, whose addresses are in the header.
+	CommandProxy Command = 1
+)
+
+// Types of TLVs in version 2 headers.
+const (
+	TLVALPN      = 0x01 // The application protocol negotiated by TLS.
+	TLVAuthority = 0x02 // The host name the client asked for, such as by TLS SNI.
+	TLVCRC32C    = 0x03 // A checksum of the header, verified when read and computed when written.
+	TLVNoop      = 0x04 // Padding.
+	TLVUniqueID  = 0x05 // An identifier of the connection, unique to the proxy.
+	TLVSSL       = 0x20 // Details of the TLS connection to the proxy.
+	TLVNetNS     = 0x30 // The network namespace the connection was accepted in.
+)
+
+// v2Signature begins every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1MaxLen is the longest version 1 header, including its CRLF.
+const v1MaxLen = 107
+
+// Errors returned while reading headers.
+var (
+	ErrNoHeader  = errors.New("no proxy protocol header")
+	ErrChecksum  = errors.New("proxy protocol header checksum mismatch")
+	ErrTruncated = errors.New("proxy protocol header truncated")
+)
+
+// Header is a PROXY protocol header, which a proxy sends before the data of a connection to pass on the addresses of
+// the client it relays.
+type Header struct {
+	Version int // 1 for the text format, or 2 for the binary format.
+	Command Command
+	// The addresses of the client and of the proxy it connected to, which are *net.TCPAddr, *net.UDPAddr, or
+	// *net.UnixAddr, or nil if the proxy did not know them or the command is CommandLocal.
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []TLV // Extensions of version 2 headers.
+}
+
+// TLV is a type-length-value extension of a version 2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// TLV returns the value of the first TLV of a type.
+func (h *Header) TLV(t byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Authority returns the host name the client asked for, or empty if the proxy did not pass it on.
+func (h *Header) Authority() string {
+	v, _ := h.TLV(TLVAuthority)
+	return string(v)
+}
+
+// ReadHeader reads a version 1 or 2 header from the start of a connection, returning ErrNoHeader, without consuming
+// anything, if it does not start with one. It only waits for as much data as it needs to tell.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	v1Prefix := []byte("PROXY ")
+	for n := 1; n <= len(v2Signature); n++ {
+		b, err := r.Peek(n)
+		if err == io.EOF && len(b) > 0 {
+			return nil, ErrTruncated
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case bytes.Equal(b, v2Signature):
+			return readV2(r)
+		case bytes.Equal(b, v1Prefix):
+			return readV1(r)
+		case !bytes.HasPrefix(v2Signature, b) && !bytes.HasPrefix(v1Prefix, b):
+			return nil, ErrNoHeader
+		}
+	}
+	return nil, ErrNoHeader
+}
+
+// readV1 reads a version 1 header, such as "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return nil, ErrTruncated
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			return parseV1(string(line[:len(line)-2]))
+		}
+	}
+	return nil, fmt.Errorf("proxy protocol header longer than %d octets", v1MaxLen)
+}
+
+// parseV1 parses the fields of a version 1 header.
+func parseV1(line string) (*Header, error) {
+	h := &Header{Version: 1, Command: CommandProxy}
+	fields := strings.Split(line, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, fmt.Errorf("invalid proxy protocol header %q", line)
+	}
+	var addrs [2]*net.TCPAddr
+	for i := range addrs {
+		ip := net.ParseIP(fields[2+i])
+		port, err := strconv.ParseUint(fields[4+i], 10, 16)
+		if ip == nil || err != nil || strings.Contains(fields[2+i], ":") != (fields[1] == "TCP6") {
+			return nil, fmt.Errorf("invalid proxy protocol header %q", line)
+		}
+		if fields[1] == "TCP4" {
+			ip = ip.To4()
+		}
+		addrs[i] = &net.TCPAddr{IP: ip, Port: int(port)}
+	}
+	h.Source, h.Destination = addrs[0], addrs[1]
+	return h, nil
+}
+
+// readV2 reads a version 2 header.
+func readV2(r *bufio.Reader) (*Header, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, ErrTruncated
+	}
+	b := make([]byte, 16+int(binary.BigEndian.Uint16(fixed[14:])))
+	copy(b, fixed)
+	if _, err := io.ReadFull(r, b[16:]); err != nil {
+		return nil, ErrTruncated
+	}
+	return parseV2(b)
+}
+
+// parseV2 parses a whole version 2 header.
+func parseV2(b []byte) (*Header, error) {
+	if b[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version %d", b[12]>>4)
+	}
+	h := &Header{Version: 2, Command: Command(b[12] & 0xf)}
+	if h.Command > CommandProxy {
+		return nil, fmt.Errorf("unsupported proxy protocol command %d", h.Command)
+	}
+	family, transport, body := b[13]>>4, b[13]&0xf, b[16:]
+
+	var n int
+	switch family {
+	case 0:
+	case 1:
+		n = 2*net.IPv4len + 4
+	case 2:
+		n = 2*net.IPv6len + 4
+	case 3:
+		n = 2 * 108
+	default:
+		return nil, fmt.Errorf("unsupported proxy protocol address family %d", family)
+	}
+	if len(body) < n {
+		return nil, ErrTruncated
+	}
+	addrs, tlvs := body[:n], body[n:]
+	if h.Command == CommandProxy {
+		h.Source, h.Destination = decodeAddrs(family, transport, addrs)
+	}
+
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 || 3+int(binary.BigEndian.Uint16(tlvs[1:])) > len(tlvs) {
+			return nil, ErrTruncated
+		}
+		l := int(binary.BigEndian.Uint16(tlvs[1:]))
+		h.TLVs = append(h.TLVs, TLV{Type: tlvs[0], Value: tlvs[3 : 3+l]})
+		if tlvs[0] == TLVCRC32C {
+			if l != 4 {
+				return nil, fmt.Errorf("invalid proxy protocol checksum length %d", l)
+			}
+			want := binary.BigEndian.Uint32(tlvs[3:])
+			// The checksum is computed with its own value zeroed.
+			zeroed := append([]byte(nil), b...)
+			off := len(b) - len(tlvs) + 3
+			copy(zeroed[off:off+4], []byte{0, 0, 0, 0})
+			if crc32.Checksum(zeroed, crc32.MakeTable(crc32.Castagnoli)) != want {
+				return nil, ErrChecksum
+			}
+		}
+		tlvs = tlvs[3+l:]
+	}
+	return h, nil
+}
+
+// decodeAddrs decodes the addresses of a version 2 header, returning nil for an unspecified family or transport.
+func decodeAddrs(family, transport byte, b []byte) (net.Addr, net.Addr) {
+	switch family {
+	case 1, 2:
+		l := net.IPv4len
+		if family == 2 {
+			l = net.IPv6len
+		}
+		src, dst := net.IP(b[:l]), net.IP(b[l:2*l])
+		sport, dport := int(binary.BigEndian.Uint16(b[2*l:])), int(binary.BigEndian.Uint16(b[2*l+2:]))
+		switch transport {
+		case 1:
+			return &net.TCPAddr{IP: src, Port: sport}, &net.TCPAddr{IP: dst, Port: dport}
+		case 2:
+			return &net.UDPAddr{IP: src, Port: sport}, &net.UDPAddr{IP: dst, Port: dport}
+		}
+	case 3:
+		network := "unix"
+		if transport == 2 {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Net: network, Name: unixPath(b[:108])}, &net.UnixAddr{Net: network, Name: unixPath(b[108:])}
+	}
+	return nil, nil
+}
+
+// unixPath returns a NUL-terminated path.
+func unixPath(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// Marshal encodes the header in its version, or version 1 if it is zero. Version 1 can only carry TCP addresses,
+// and no TLVs. If a version 2 header has a CRC32C TLV its value is computed.
+func (h *Header) Marshal() ([]byte, error) {
+	switch h.Version {
+	case 0, 1:
+		return h.marshalV1()
+	case 2:
+		return h.marshalV2()
+	}
+	return nil, fmt.Errorf("unsupported proxy protocol version %d", h.Version)
+}
+
+// WriteTo writes the encoded header, as a proxy does at the start of a connection.
+func (h *Header) WriteTo(w io.Writer) (int64, error) {
+	b, err := h.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// marshalV1 encodes a version 1 header.
+func (h *Header) marshalV1() ([]byte, error) {
+	if len(h.TLVs) > 0 {
+		return nil, errors.New("proxy protocol version 1 cannot carry tlvs")
+	}
+	if h.Command == CommandLocal || h.Source == nil || h.Destination == nil {
+		return []byte("PROXY UNKNOWN\r\n"), nil
+	}
+	src, ok1 := h.Source.(*net.TCPAddr)
+	dst, ok2 := h.Destination.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("proxy protocol version 1 cannot carry %s addresses", h.Source.Network())
+	}
+	family := "TCP4"
+	if src.IP.To4() == nil {
+		family = "TCP6"
+	}
+	if (dst.IP.To4() == nil) != (family == "TCP6") {
+		return nil, errors.New("proxy protocol addresses of different families")
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.IP, dst.IP, src.Port, dst.Port)), nil
+}
+
+// marshalV2 encodes a version 2 header.
+func (h *Header) marshalV2() ([]byte, error) {
+	b := append([]byte(nil), v2Signature...)
+	b = append(b, 0x20|byte(h.Command), 0, 0, 0)
+	if h.Command == CommandProxy && h.Source != nil && h.Destination != nil {
+		fam, addrs, err := encodeAddrs(h.Source, h.Destination)
+		if err != nil {
+			return nil, err
+		}
+		b[13] = fam
+		b = append(b, addrs...)
+	}
+	crc := -1
+	for _, tlv := range h.TLVs {
+		if tlv.Type == TLVCRC32C {
+			crc = len(b) + 3
+			tlv.Value = make([]byte, 4)
+		}
+		if len(tlv.Value) > 0xffff {
+			return nil, fmt.Errorf("proxy protocol tlv of %d octets is too long", len(tlv.Value))
+		}
+		b = append(b, tlv.Type, byte(len(tlv.Value)>>8), byte(len(tlv.Value)))
+		b = append(b, tlv.Value...)
+	}
+	if len(b)-16 > 0xffff {
+		return nil, fmt.Errorf("proxy protocol header of %d octets is too long", len(b))
+	}
+	binary.BigEndian.PutUint16(b[14:], uint16(len(b)-16))
+	if crc >= 0 {
+		binary.BigEndian.PutUint32(b[crc:], crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)))
+	}
+	return b, nil
+}
+
+// encodeAddrs encodes the addresses of a version 2 header, returning the family and transport octet.
+func encodeAddrs(src, dst net.Addr) (byte, []byte, error) {
+	var sip, dip net.IP
+	var sport, dport int
+	var transport byte
+	switch s := src.(type) {
+	case *net.TCPAddr:
+		d, ok := dst.(*net.TCPAddr)
+		if !ok {
+			return 0, nil, errors.New("proxy protocol addresses of different networks")
+		}
+		sip, dip, sport, dport, transport = s.IP, d.IP, s.Port, d.Port, 1
+	case *net.UDPAddr:
+		d, ok := dst.(*net.UDPAddr)
+		if !ok {
+			return 0, nil, errors.New("proxy protocol addresses of different networks")
+		}
+		sip, dip, sport, dport, transport = s.IP, d.IP, s.Port, d.Port, 2
+	case *net.UnixAddr:
+		d, ok := dst.(*net.UnixAddr)
+		if !ok {
+			return 0, nil, errors.New("proxy protocol addresses of different networks")
+		}
+		if len(s.Name) > 108 || len(d.Name) > 108 {
+			return 0, nil, errors.New("proxy protocol unix address too long")
+		}
+		transport = 1
+		if s.Net == "unixgram" {
+			transport = 2
+		}
+		b := make([]byte, 2*108)
+		copy(b, s.Name)
+		copy(b[108:], d.Name)
+		return 0x30 | transport, b, nil
+	default:
+		return 0, nil, fmt.Errorf("proxy protocol cannot carry %s addresses", src.Network())
+	}
+
+	family, l := byte(1), net.IPv4len
+	if sip.To4() == nil || dip.To4() == nil {
+		family, l = 2, net.IPv6len
+	}
+	b := make([]byte, 2*l+4)
+	if l == net.IPv4len {
+		copy(b, sip.To4())
+		copy(b[l:], dip.To4())
+	} else {
+		copy(b, sip.To16())
+		copy(b[l:], dip.To16())
+	}
+	binary.BigEndian.PutUint16(b[2*l:], uint16(sport))
+	binary.BigEndian.PutUint16(b[2*l+2:], uint16(dport))
+	return family<<4 | transport, b, nil
+}
@@ -0,0 +1,214 @@
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+)
+
+// v2TCP4 is a version 2 header relaying a TCP connection from 192.0.2.1:56324 to 198.51.100.1:443, with an authority.
+var v2TCP4 = "\r\n\r\n\x00\r\nQUIT\n" + "\x21\x11\x00\x1a" +
+	"\xc0\x00\x02\x01" + "\xc6\x33\x64\x01" + "\xdc\x04" + "\x01\xbb" +
+	"\x02\x00\x0b" + "example.com"
+
+func TestReadHeader(t *testing.T) {
+	tcp := func(ip string, port int) *net.TCPAddr {
+		return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+	}
+	tcp4 := func(ip string, port int) *net.TCPAddr {
+		return &net.TCPAddr{IP: net.ParseIP(ip).To4(), Port: port}
+	}
+	tests := map[string]struct {
+		input   string
+		want    *Header
+		wantErr error
+	}{
+		"V1TCP4": {
+			input: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n",
+			want: &Header{
+				Version:     1,
+				Command:     CommandProxy,
+				Source:      tcp4("192.0.2.1", 56324),
+				Destination: tcp4("198.51.100.1", 443),
+			},
+		},
+		"V1TCP6": {
+			input: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n",
+			want: &Header{
+				Version:     1,
+				Command:     CommandProxy,
+				Source:      tcp("2001:db8::1", 56324),
+				Destination: tcp("2001:db8::2", 443),
+			},
+		},
+		"V1Unknown": {
+			input: "PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n",
+			want:  &Header{Version: 1, Command: CommandProxy},
+		},
+		"V1FamilyMismatch": {input: "PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n"},
+		"V1BadPort":        {input: "PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n"},
+		"V1TooLong":        {input: "PROXY TCP4 " + strings.Repeat(" ", 100) + "\r\n"},
+		"V1Truncated":      {input: "PROXY TCP4 192.0.2.1", wantErr: ErrTruncated},
+		"V2TCP4": {
+			input: v2TCP4 + "data",
+			want: &Header{
+				Version:     2,
+				Command:     CommandProxy,
+				Source:      tcp4("192.0.2.1", 56324),
+				Destination: tcp4("198.51.100.1", 443),
+				TLVs:        []TLV{{Type: TLVAuthority, Value: []byte("example.com")}},
+			},
+		},
+		"V2Local": {
+			input: "\r\n\r\n\x00\r\nQUIT\n\x20\x00\x00\x00",
+			want:  &Header{Version: 2, Command: CommandLocal},
+		},
+		"V2Truncated":  {input: v2TCP4[:20], wantErr: ErrTruncated},
+		"V2BadVersion": {input: "\r\n\r\n\x00\r\nQUIT\n\x11\x00\x00\x00"},
+		"NoHeader":     {input: "GET / HTTP/1.1\r\n", wantErr: ErrNoHeader},
+		"NoHeaderCRLF": {input: "\r\n\r\nfoo", wantErr: ErrNoHeader},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReadHeader(bufio.NewReader(strings.NewReader(test.input)))
+			if test.want == nil {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+					t.Fatalf("got err %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestReadHeaderLeavesData(t *testing.T) {
+	for _, input := range []string{"PROXY UNKNOWN\r\n", v2TCP4, ""} {
+		r := bufio.NewReader(strings.NewReader(input + "data"))
+		if _, err := ReadHeader(r); err != nil && err != ErrNoHeader {
+			t.Fatalf("read err: %v", err)
+		}
+		rest, _ := r.ReadString(0)
+		if rest != "data" {
+			t.Fatalf("got %q after header, want \"data\"", rest)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	tests := map[string]struct {
+		header  *Header
+		want    string
+		wantErr bool
+	}{
+		"V1": {
+			header: &Header{
+				Command:     CommandProxy,
+				Source:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443},
+			},
+			want: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+		},
+		"V1Local": {
+			header: &Header{Version: 1, Command: CommandLocal},
+			want:   "PROXY UNKNOWN\r\n",
+		},
+		"V1UDP": {
+			header: &Header{
+				Version:     1,
+				Command:     CommandProxy,
+				Source:      &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53},
+				Destination: &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 53},
+			},
+			wantErr: true,
+		},
+		"V2": {
+			header: &Header{
+				Version:     2,
+				Command:     CommandProxy,
+				Source:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443},
+				TLVs:        []TLV{{Type: TLVAuthority, Value: []byte("example.com")}},
+			},
+			want: v2TCP4,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.header.Marshal()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("marshal err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestMarshalV2RoundTrip(t *testing.T) {
+	tests := map[string]*Header{
+		"UDP6": {
+			Source:      &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5353},
+			Destination: &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 53},
+		},
+		"Unix": {
+			Source:      &net.UnixAddr{Net: "unix", Name: "/run/client.sock"},
+			Destination: &net.UnixAddr{Net: "unix", Name: "/run/server.sock"},
+		},
+		"CRC32C": {
+			Source:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 1},
+			Destination: &net.TCPAddr{IP: net.ParseIP("192.0.2.2").To4(), Port: 2},
+			TLVs:        []TLV{{Type: TLVUniqueID, Value: []byte("abc")}, {Type: TLVCRC32C}},
+		},
+	}
+
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			h.Version, h.Command = 2, CommandProxy
+			b, err := h.Marshal()
+			if err != nil {
+				t.Fatalf("marshal err: %v", err)
+			}
+			got, err := ReadHeader(bufio.NewReader(strings.NewReader(string(b))))
+			if err != nil {
+				t.Fatalf("read err: %v", err)
+			}
+			// The checksum is filled in.
+			for i, tlv := range got.TLVs {
+				if tlv.Type == TLVCRC32C {
+					got.TLVs[i].Value = nil
+				}
+			}
+			if diff := cmp.Diff(h, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+
+			if name == "CRC32C" {
+				b[len(b)-10] ^= 0xff
+				if _, err := ReadHeader(bufio.NewReader(strings.NewReader(string(b)))); !errors.Is(err, ErrChecksum) {
+					t.Fatalf("got err %v, want %v", err, ErrChecksum)
+				}
+			}
+		})
+	}
+}
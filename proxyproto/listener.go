@@ -0,0 +1,110 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the time allowed for a connection to send its header, if the Listener does not say otherwise.
+const DefaultTimeout = 10 * time.Second
+
+// Listener wraps a net.Listener so that the connections it accepts have their PROXY protocol headers read, and report
+// the addresses of the clients the proxy relays rather than those of the proxy.
+type Listener struct {
+	net.Listener
+
+	Timeout time.Duration // The time allowed to read a header, or DefaultTimeout if zero.
+	// Optional accepts connections without a header as they are, rather than failing them. As the header is looked
+	// for in the first data, protocols where the server speaks first are delayed by Timeout.
+	Optional bool
+	// Trusted reports whether a connection from an address may send a header, or nil to trust every address. Headers
+	// from untrusted addresses are not read, so that they cannot spoof their address.
+	Trusted func(net.Addr) bool
+}
+
+// WrapListener returns a Listener reading the headers of the connections ln accepts, from every address.
+func WrapListener(ln net.Listener) *Listener {
+	return &Listener{Listener: ln}
+}
+
+// Accept waits for and returns the next connection. Connections from trusted addresses are returned wrapped in a
+// *Conn, which reads the header when it is first used, so that a slow client cannot hold up Accept.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.Trusted != nil && !l.Trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	timeout := l.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), timeout: timeout, optional: l.Optional}, nil
+}
+
+// Conn is a connection accepted by a Listener. Its header is read by the first call to Read, Header, LocalAddr, or
+// RemoteAddr; if that fails, reads return the error and the addresses are those of the proxy.
+type Conn struct {
+	net.Conn
+
+	r        *bufio.Reader
+	timeout  time.Duration
+	optional bool
+
+	once   sync.Once
+	header *Header
+	err    error
+}
+
+// NewConn returns a connection reading a header from the start of conn, which must be sent one within timeout.
+func NewConn(conn net.Conn, timeout time.Duration) *Conn {
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), timeout: timeout}
+}
+
+// Header returns the header of the connection, or nil if it is optional and there was none.
+func (c *Conn) Header() (*Header, error) {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.header, c.err = ReadHeader(c.r)
+		if !c.optional {
+			return
+		}
+		// A client waiting for the server to speak first has sent nothing, not even a header.
+		if ne, ok := c.err.(net.Error); c.err == ErrNoHeader || ok && ne.Timeout() && c.r.Buffered() == 0 {
+			c.err = nil
+		}
+	})
+	return c.header, c.err
+}
+
+// Read reads data following the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	if _, err := c.Header(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the address of the client from the header, or of the proxy if the header does not have it.
+func (c *Conn) RemoteAddr() net.Addr {
+	if h, err := c.Header(); err == nil && h != nil && h.Source != nil {
+		return h.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to from the header, or of the connection if the header does not
+// have it.
+func (c *Conn) LocalAddr() net.Addr {
+	if h, err := c.Header(); err == nil && h != nil && h.Destination != nil {
+		return h.Destination
+	}
+	return c.Conn.LocalAddr()
+}
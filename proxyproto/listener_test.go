@@ -0,0 +1,100 @@
+package proxyproto
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListener(t *testing.T) {
+	tests := map[string]struct {
+		send     string
+		optional bool
+		trusted  bool
+		want     string // The remote address.
+		wantData string
+		wantErr  error
+	}{
+		"V1": {
+			send:     "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello",
+			trusted:  true,
+			want:     "192.0.2.1:56324",
+			wantData: "hello",
+		},
+		"V2": {
+			send:     v2TCP4 + "hello",
+			trusted:  true,
+			want:     "192.0.2.1:56324",
+			wantData: "hello",
+		},
+		"Required": {
+			send:    "hello",
+			trusted: true,
+			wantErr: ErrNoHeader,
+		},
+		"Optional": {
+			send:     "hello",
+			optional: true,
+			trusted:  true,
+			wantData: "hello",
+		},
+		"Untrusted": {
+			send:     "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello",
+			wantData: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen err: %v", err)
+			}
+			ln := WrapListener(inner)
+			ln.Optional = test.optional
+			ln.Trusted = func(net.Addr) bool { return test.trusted }
+			defer ln.Close()
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("dial err: %v", err)
+			}
+			client.Write([]byte(test.send))
+			client.Close()
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatalf("accept err: %v", err)
+			}
+			defer conn.Close()
+			want := test.want
+			if want == "" {
+				want = client.LocalAddr().String()
+			}
+			if diff := cmp.Diff(want, conn.RemoteAddr().String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			data, err := ioutil.ReadAll(conn)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got err %v, want %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.wantData, string(data)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestConnOptionalServerFirst(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewConn(server, 10*time.Millisecond)
+	conn.optional = true
+	h, err := conn.Header()
+	if err != nil || h != nil {
+		t.Fatalf("got header %v err %v, want neither", h, err)
+	}
+}
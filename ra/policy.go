@@ -0,0 +1,110 @@
+package ra
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// Problem is a way a router advertisement departs from the policy for its link.
+type Problem string
+
+// Problems found by Policy.Check.
+const (
+	BadHopLimit   Problem = "bad-hop-limit"  // It arrived with a hop limit below 255, so it came from off the link.
+	UnknownRouter Problem = "unknown-router" // It came from an address or link-layer address the policy does not list.
+	UnknownPrefix Problem = "unknown-prefix" // It announces a prefix outside those of the policy.
+	UnknownDNS    Problem = "unknown-dns"    // It announces a recursive DNS server the policy does not list.
+	WrongFlags    Problem = "wrong-flags"    // Its managed or other configuration flags differ from the policy.
+)
+
+// Finding is a problem with a router advertisement.
+type Finding struct {
+	Problem Problem `json:"problem"`
+	Detail  string  `json:"detail"`
+}
+
+// String formats the finding as problem: detail.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Problem, f.Detail)
+}
+
+// Policy is what the legitimate routers of a link advertise, against which rogue advertisements can be found. Each
+// list left empty allows anything.
+type Policy struct {
+	Routers    []net.IP           // The addresses of the routers.
+	RouterMACs []net.HardwareAddr // The link-layer addresses of the routers, from the source link-layer option.
+	Prefixes   []*net.IPNet       // The prefixes the announced prefixes must be within.
+	DNS        []net.IP           // The recursive DNS servers.
+	// Whether to check the managed and other configuration flags against Managed and Other.
+	CheckFlags     bool
+	Managed, Other bool
+}
+
+// Check returns the ways an advertisement departs from the policy, or nil if it is allowed.
+func (p *Policy) Check(ad *Advertisement) []Finding {
+	var findings []Finding
+	add := func(problem Problem, format string, args ...interface{}) {
+		findings = append(findings, Finding{Problem: problem, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if ad.HopLimit >= 0 && ad.HopLimit != 255 {
+		add(BadHopLimit, "hop limit %d from %v", ad.HopLimit, ad.Router)
+	}
+	if len(p.Routers) > 0 && !containsIP(p.Routers, ad.Router) {
+		add(UnknownRouter, "router %v", ad.Router)
+	}
+	if len(p.RouterMACs) > 0 {
+		mac := ad.SourceLinkLayerAddr()
+		known := false
+		for _, allowed := range p.RouterMACs {
+			known = known || bytes.Equal(allowed, mac)
+		}
+		if !known {
+			add(UnknownRouter, "router %v with link-layer address %v", ad.Router, mac)
+		}
+	}
+	if len(p.Prefixes) > 0 {
+		for _, pi := range ad.Prefixes() {
+			if !within(p.Prefixes, pi.Prefix) {
+				add(UnknownPrefix, "prefix %v from %v", pi.Prefix, ad.Router)
+			}
+		}
+	}
+	if len(p.DNS) > 0 {
+		for _, info := range ad.RDNSS() {
+			for _, ip := range info.Servers {
+				if !containsIP(p.DNS, ip) {
+					add(UnknownDNS, "dns server %v from %v", ip, ad.Router)
+				}
+			}
+		}
+	}
+	if p.CheckFlags && (ad.Managed != p.Managed || ad.Other != p.Other) {
+		add(WrongFlags, "managed %v, other %v from %v, want managed %v, other %v", ad.Managed, ad.Other, ad.Router,
+			p.Managed, p.Other)
+	}
+	return findings
+}
+
+// containsIP reports whether ips holds ip.
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, allowed := range ips {
+		if allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether pfx is within one of pfxs.
+func within(pfxs []*net.IPNet, pfx *net.IPNet) bool {
+	ones, _ := pfx.Mask.Size()
+	for _, allowed := range pfxs {
+		allowedOnes, _ := allowed.Mask.Size()
+		if allowedOnes <= ones && allowed.Contains(pfx.IP) {
+			return true
+		}
+	}
+	return false
+}
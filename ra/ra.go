@@ -0,0 +1,131 @@
+package ra
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/icmp"
+	"github.com/dotwaffle/inettools/sockopt"
+	"net"
+	"time"
+)
+
+// Advertisement is a router advertisement received on an interface. The router advertisement's options are decoded
+// by its methods, such as Prefixes and RDNSS.
+type Advertisement struct {
+	Router    net.IP // The link-local address the advertisement was sent from.
+	Interface string // The interface it arrived on.
+	// The hop limit it arrived with, which must be 255 for a router on the link, or -1 if it is not known.
+	HopLimit int
+	Received time.Time
+	*icmp.RouterAdvertisement
+}
+
+// Listener captures router advertisements, which needs CAP_NET_RAW. The zero value listens on every interface, and
+// waits for routers to advertise unprompted.
+type Listener struct {
+	// The interface to listen on, or every interface if empty.
+	Interface string
+	// Send a router solicitation to prompt routers to advertise at once, rather than waiting for their next
+	// unsolicited advertisement. It needs Interface.
+	Solicit bool
+}
+
+// Listen calls fn with each router advertisement received, until fn returns false or the context is done.
+func (l *Listener) Listen(ctx context.Context, fn func(*Advertisement) bool) error {
+	if l.Solicit && l.Interface == "" {
+		return errors.New("soliciting needs an interface")
+	}
+	lc := net.ListenConfig{Control: (&sockopt.Options{Device: l.Interface}).Control}
+	pc, err := lc.ListenPacket(ctx, "ip6:ipv6-icmp", "::")
+	if err != nil {
+		return err
+	}
+	conn := pc.(*net.IPConn)
+	defer conn.Close()
+	if err := enableHopLimit(conn); err != nil {
+		return err
+	}
+
+	if l.Solicit {
+		if err := solicit(conn, l.Interface); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	buf, oob := make([]byte, 65535), make([]byte, 128)
+	for {
+		n, oobn, _, from, err := conn.ReadMsgIP(buf, oob)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		ad, err := parse(buf[:n], from, hopLimit(oob[:oobn]))
+		if err != nil {
+			continue
+		}
+		if ad.Interface == "" {
+			ad.Interface = l.Interface
+		}
+		if !fn(ad) {
+			return nil
+		}
+	}
+}
+
+// parse decodes an ICMPv6 message as a router advertisement, returning an error if it is anything else.
+func parse(b []byte, from *net.IPAddr, hops int) (*Advertisement, error) {
+	m, err := icmp.Parse(b, true)
+	if err != nil {
+		return nil, err
+	}
+	body, ok := m.Body.(*icmp.RouterAdvertisement)
+	if !ok || m.Code != 0 {
+		return nil, errors.New("not a router advertisement")
+	}
+	// The body refers to the buffer, which is reused for the next message.
+	body.Options = append([]icmp.NDPOption(nil), body.Options...)
+	for i := range body.Options {
+		body.Options[i].Data = append([]byte(nil), body.Options[i].Data...)
+	}
+	return &Advertisement{
+		Router:              from.IP,
+		Interface:           from.Zone,
+		HopLimit:            hops,
+		Received:            time.Now(),
+		RouterAdvertisement: body,
+	}, nil
+}
+
+// solicit sends a router solicitation to all routers on the link of an interface.
+func solicit(conn *net.IPConn, ifname string) error {
+	if err := setMulticastHops(conn, 255); err != nil {
+		return err
+	}
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return err
+	}
+	rs := &icmp.RouterSolicitation{}
+	if len(ifi.HardwareAddr) == 6 {
+		rs.Options = []icmp.NDPOption{icmp.LinkLayerOption(icmp.NDPOptionSourceLinkLayer, ifi.HardwareAddr)}
+	}
+	// The kernel fills in the checksum of ICMPv6 raw sockets.
+	b, err := (&icmp.Message{V6: true, Type: icmp.TypeV6RouterSolicitation, Body: rs}).Marshal(nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteToIP(b, &net.IPAddr{IP: net.ParseIP("ff02::2"), Zone: ifname})
+	return err
+}
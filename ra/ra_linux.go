@@ -0,0 +1,49 @@
+// +build linux
+
+package ra
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// enableHopLimit asks for the hop limit of each packet received on conn (IPV6_RECVHOPLIMIT).
+func enableHopLimit(conn *net.IPConn) error {
+	return setsockopt(conn, syscall.IPV6_RECVHOPLIMIT, 1, "setsockopt IPV6_RECVHOPLIMIT")
+}
+
+// setMulticastHops sets the hop limit of the multicast packets sent on conn (IPV6_MULTICAST_HOPS).
+func setMulticastHops(conn *net.IPConn, hops int) error {
+	return setsockopt(conn, syscall.IPV6_MULTICAST_HOPS, hops, "setsockopt IPV6_MULTICAST_HOPS")
+}
+
+// setsockopt sets an IPv6 socket option on conn.
+func setsockopt(conn *net.IPConn, opt, value int, name string) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, opt, value)
+	}); err != nil {
+		return err
+	}
+	return os.NewSyscallError(name, serr)
+}
+
+// hopLimit returns the hop limit from the control messages of a packet, or -1 if they do not hold it.
+func hopLimit(oob []byte) int {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return -1
+	}
+	for _, m := range msgs {
+		if m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_HOPLIMIT && len(m.Data) >= 4 {
+			return int(*(*int32)(unsafe.Pointer(&m.Data[0])))
+		}
+	}
+	return -1
+}
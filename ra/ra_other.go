@@ -0,0 +1,20 @@
+// +build !linux
+
+package ra
+
+import "net"
+
+// enableHopLimit is only implemented on Linux, so elsewhere the hop limit is not known.
+func enableHopLimit(conn *net.IPConn) error {
+	return nil
+}
+
+// setMulticastHops is only implemented on Linux, so elsewhere solicitations use the default hop limit.
+func setMulticastHops(conn *net.IPConn, hops int) error {
+	return nil
+}
+
+// hopLimit is only implemented on Linux.
+func hopLimit(oob []byte) int {
+	return -1
+}
@@ -0,0 +1,151 @@
+package ra
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/icmp"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// advertisement returns an encoded router advertisement announcing a prefix and a DNS server.
+func advertisement(t *testing.T, prefix, dns string, managed bool) []byte {
+	t.Helper()
+	_, pfx, err := net.ParseCIDR(prefix)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	b, err := (&icmp.Message{V6: true, Type: icmp.TypeV6RouterAdvertisement, Body: &icmp.RouterAdvertisement{
+		CurHopLimit:    64,
+		Managed:        managed,
+		RouterLifetime: 30 * time.Minute,
+		Options: []icmp.NDPOption{
+			icmp.LinkLayerOption(icmp.NDPOptionSourceLinkLayer, net.HardwareAddr{2, 0, 0x5e, 0, 0, 1}),
+			(&icmp.PrefixInfo{Prefix: pfx, OnLink: true, Autonomous: true, ValidLifetime: time.Hour,
+				PreferredLifetime: time.Hour}).Option(),
+			icmp.RDNSSOption([]net.IP{net.ParseIP(dns)}, time.Hour),
+		},
+	}}).Marshal(nil, nil)
+	if err != nil {
+		t.Fatalf("marshal err: %v", err)
+	}
+	return b
+}
+
+func TestPolicy(t *testing.T) {
+	_, site, _ := net.ParseCIDR("2001:db8:1::/48")
+	policy := &Policy{
+		Routers:    []net.IP{net.ParseIP("fe80::1")},
+		RouterMACs: []net.HardwareAddr{{2, 0, 0x5e, 0, 0, 1}},
+		Prefixes:   []*net.IPNet{site},
+		DNS:        []net.IP{net.ParseIP("2001:db8:1::53")},
+		CheckFlags: true,
+	}
+
+	tests := map[string]struct {
+		router  string
+		hops    int
+		prefix  string
+		dns     string
+		managed bool
+		want    []Finding
+	}{
+		"Allowed": {
+			router: "fe80::1",
+			hops:   255,
+			prefix: "2001:db8:1:10::/64",
+			dns:    "2001:db8:1::53",
+		},
+		"UnknownHopLimit": {
+			router: "fe80::1",
+			hops:   -1,
+			prefix: "2001:db8:1:10::/64",
+			dns:    "2001:db8:1::53",
+		},
+		"Rogue": {
+			router:  "fe80::bad",
+			hops:    254,
+			prefix:  "2001:db8:ff::/64",
+			dns:     "2001:db8:ff::53",
+			managed: true,
+			want: []Finding{
+				{Problem: BadHopLimit, Detail: "hop limit 254 from fe80::bad"},
+				{Problem: UnknownRouter, Detail: "router fe80::bad"},
+				{Problem: UnknownPrefix, Detail: "prefix 2001:db8:ff::/64 from fe80::bad"},
+				{Problem: UnknownDNS, Detail: "dns server 2001:db8:ff::53 from fe80::bad"},
+				{Problem: WrongFlags, Detail: "managed true, other false from fe80::bad, want managed false, other false"},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			from := &net.IPAddr{IP: net.ParseIP(test.router), Zone: "eth0"}
+			ad, err := parse(advertisement(t, test.prefix, test.dns, test.managed), from, test.hops)
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			if ad.Interface != "eth0" || ad.CurHopLimit != 64 || ad.RouterLifetime != 30*time.Minute {
+				t.Fatalf("got %+v", ad)
+			}
+			if diff := cmp.Diff(test.want, policy.Check(ad)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	t.Run("NotAdvertisement", func(t *testing.T) {
+		echo, _ := (&icmp.Message{V6: true, Type: icmp.TypeV6Echo, Body: &icmp.Echo{}}).Marshal(nil, nil)
+		if _, err := parse(echo, &net.IPAddr{IP: net.ParseIP("fe80::1")}, 255); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+}
+
+func TestListen(t *testing.T) {
+	sender, err := net.ListenPacket("ip6:ipv6-icmp", "::1")
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+		t.Skipf("%v", err)
+	}
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	defer sender.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got := make(chan *Advertisement, 1)
+	errc := make(chan error, 1)
+	l := &Listener{}
+	go func() {
+		errc <- l.Listen(ctx, func(ad *Advertisement) bool {
+			got <- ad
+			return false
+		})
+	}()
+
+	// The listener's socket may not be open yet, so the advertisement is repeated until it arrives.
+	b := advertisement(t, "2001:db8:1:10::/64", "2001:db8:1::53", false)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case ad := <-got:
+			if !ad.Router.Equal(net.IPv6loopback) || len(ad.Prefixes()) != 1 {
+				t.Fatalf("got %+v", ad)
+			}
+			if err := <-errc; err != nil {
+				t.Fatalf("listen err: %v", err)
+			}
+			return
+		case err := <-errc:
+			t.Fatalf("listen err: %v", err)
+		case <-ticker.C:
+			if _, err := sender.WriteTo(b, &net.IPAddr{IP: net.IPv6loopback}); err != nil {
+				t.Fatalf("write err: %v", err)
+			}
+		}
+	}
+}
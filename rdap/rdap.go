@@ -0,0 +1,446 @@
+package rdap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Client whose fields are not set.
+const (
+	DefaultBootstrapURL = "https://data.iana.org/rdap/"
+	DefaultWhoisServer  = "whois.iana.org"
+	DefaultTimeout      = 30 * time.Second
+	DefaultCacheTTL     = 6 * time.Hour
+)
+
+// maxParents bounds how many less specific networks are searched for an abuse contact.
+const maxParents = 8
+
+// ErrNotFound is returned when looking up an object that the registries do not have, or an abuse contact that none of
+// them knows.
+var ErrNotFound = errors.New("not found")
+
+// Link is a link from an RDAP object to a related one.
+type Link struct {
+	Rel  string `json:"rel"` // Such as "self" for the object itself, or "up" for a less specific network.
+	Href string `json:"href"`
+	Type string `json:"type"`
+}
+
+// Entity is a person or organisation, in one or more roles with respect to the object that holds it.
+type Entity struct {
+	Handle   string          `json:"handle"`
+	Roles    []string        `json:"roles"` // Such as "registrant", "technical", or "abuse".
+	VCard    json.RawMessage `json:"vcardArray"`
+	Entities []Entity        `json:"entities"`
+	Links    []Link          `json:"links"`
+}
+
+// HasRole returns whether the entity is in a role.
+func (e *Entity) HasRole(role string) bool {
+	for _, r := range e.Roles {
+		if strings.EqualFold(r, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the formatted name of the entity, from its vCard.
+func (e *Entity) Name() string {
+	if v := e.vcard("fn"); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Emails returns the email addresses of the entity, from its vCard.
+func (e *Entity) Emails() []string {
+	return e.vcard("email")
+}
+
+// vcard returns the text values of a property of the entity's jCard, as described by RFC 7095: an array of "vcard"
+// followed by an array of properties, each an array of name, parameters, type and value.
+func (e *Entity) vcard(name string) []string {
+	var card []json.RawMessage
+	if json.Unmarshal(e.VCard, &card) != nil || len(card) < 2 {
+		return nil
+	}
+	var props [][]json.RawMessage
+	if json.Unmarshal(card[1], &props) != nil {
+		return nil
+	}
+	var values []string
+	for _, prop := range props {
+		var propName, value string
+		if len(prop) < 4 || json.Unmarshal(prop[0], &propName) != nil || !strings.EqualFold(propName, name) {
+			continue
+		}
+		if json.Unmarshal(prop[3], &value) == nil && value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Network is the registration of a range of addresses.
+type Network struct {
+	Handle       string   `json:"handle"`
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Country      string   `json:"country"`
+	ParentHandle string   `json:"parentHandle"`
+	StartAddress string   `json:"startAddress"`
+	EndAddress   string   `json:"endAddress"`
+	Entities     []Entity `json:"entities"`
+	Links        []Link   `json:"links"`
+}
+
+// link returns the target of the network's first link with a relation, or empty if there is none.
+func (n *Network) link(rel string) string {
+	for _, l := range n.Links {
+		if strings.EqualFold(l.Rel, rel) && l.Href != "" {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// Contact is the abuse contact responsible for an address.
+type Contact struct {
+	Email   string
+	Name    string // The name of the contact, if known.
+	Handle  string // The handle of the contact, if known.
+	Network string // The handle of the network it is the contact of, if known.
+	Source  string // The URL of the RDAP object, or the whois server, it was found in.
+}
+
+// Client looks up the registrations of addresses in the RDAP services of the registries, found through the IANA
+// bootstrap registry, falling back to whois. Responses are cached in memory, as are abuse contacts by the range of
+// their network. The zero value is ready to use, and it is safe for concurrent use.
+type Client struct {
+	BootstrapURL string        // The base URL of the bootstrap registry, or DefaultBootstrapURL if empty.
+	WhoisServer  string        // The whois server first asked, as host or host:port, or DefaultWhoisServer if empty.
+	NoWhois      bool          // Whether to not fall back to whois.
+	Client       *http.Client  // The client to query RDAP with, or http.DefaultClient if nil.
+	Timeout      time.Duration // How long a query may take, or DefaultTimeout if zero.
+	CacheTTL     time.Duration // How long responses are cached for, or DefaultCacheTTL if zero; negative disables it.
+
+	mu       sync.Mutex
+	cache    map[string]cached
+	contacts []cachedContact
+}
+
+// cached is a cached response.
+type cached struct {
+	body    []byte
+	fetched time.Time
+}
+
+// cachedContact is the abuse contact of a range of addresses.
+type cachedContact struct {
+	first, last net.IP
+	contact     Contact
+	fetched     time.Time
+}
+
+// Network returns the most specific network registered containing an address.
+func (c *Client) Network(ctx context.Context, ip net.IP) (*Network, error) {
+	base, err := c.server(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	return c.network(ctx, strings.TrimSuffix(base, "/")+"/ip/"+ip.String())
+}
+
+// network returns the network at a URL.
+func (c *Client) network(ctx context.Context, u string) (*Network, error) {
+	body, err := c.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	var n Network
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	return &n, nil
+}
+
+// AbuseContact returns the abuse contact responsible for an address. The entities of its network in the abuse role
+// are searched first, including those nested within other entities, and fetched if their contact details are not
+// included; then those of less specific networks; and lastly, unless NoWhois is set, the whois servers, following
+// referrals from WhoisServer.
+func (c *Client) AbuseContact(ctx context.Context, ip net.IP) (*Contact, error) {
+	if contact, ok := c.cachedContact(ip); ok {
+		return contact, nil
+	}
+
+	n, err := c.Network(ctx, ip)
+	if err != nil && !errors.Is(err, ErrNotFound) && c.NoWhois {
+		return nil, err
+	}
+	// The contact is cached for the range of the most specific network, as those of its parent may have others.
+	specific := n
+	for depth := 0; err == nil && depth < maxParents; depth++ {
+		if contact := c.abuse(ctx, n.Entities, 0); contact != nil {
+			contact.Network = n.Handle
+			if contact.Source == "" {
+				contact.Source = n.link("self")
+			}
+			c.storeContact(specific, *contact)
+			return contact, nil
+		}
+		up := n.link("up")
+		if up == "" {
+			break
+		}
+		n, err = c.network(ctx, up)
+	}
+
+	if c.NoWhois {
+		return nil, fmt.Errorf("%w: abuse contact of %v", ErrNotFound, ip)
+	}
+	return c.whoisContact(ctx, ip)
+}
+
+// abuse returns the contact of the first entity in the abuse role with an email address, searching nested entities
+// after their parents.
+func (c *Client) abuse(ctx context.Context, entities []Entity, depth int) *Contact {
+	if depth > maxParents {
+		return nil
+	}
+	for i := range entities {
+		e := &entities[i]
+		if !e.HasRole("abuse") {
+			continue
+		}
+		source := ""
+		if len(e.Emails()) == 0 {
+			// Some registries only link to the details of the entities of a network.
+			for _, l := range e.Links {
+				if !strings.EqualFold(l.Rel, "self") {
+					continue
+				}
+				body, err := c.get(ctx, l.Href)
+				var full Entity
+				if err == nil && json.Unmarshal(body, &full) == nil {
+					e, source = &full, l.Href
+				}
+				break
+			}
+		}
+		if emails := e.Emails(); len(emails) > 0 {
+			return &Contact{Email: emails[0], Name: e.Name(), Handle: e.Handle, Source: source}
+		}
+	}
+	for i := range entities {
+		if contact := c.abuse(ctx, entities[i].Entities, depth+1); contact != nil {
+			return contact
+		}
+	}
+	return nil
+}
+
+// bootstrap is a bootstrap registry of RFC 9224, listing the base URLs of the services of ranges of addresses.
+type bootstrap struct {
+	Services [][][]string `json:"services"`
+}
+
+// server returns the base URL of the RDAP service of the registry of an address, preferring HTTPS.
+func (c *Client) server(ctx context.Context, ip net.IP) (string, error) {
+	base, file := c.BootstrapURL, "ipv6.json"
+	if base == "" {
+		base = DefaultBootstrapURL
+	}
+	if ip.To4() != nil {
+		file = "ipv4.json"
+	} else if ip.To16() == nil {
+		return "", fmt.Errorf("invalid ip address %v", ip)
+	}
+	u := strings.TrimSuffix(base, "/") + "/" + file
+	body, err := c.get(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	var reg bootstrap
+	if err := json.Unmarshal(body, &reg); err != nil {
+		return "", fmt.Errorf("%s: %w", u, err)
+	}
+
+	best, bestLen := "", -1
+	for _, svc := range reg.Services {
+		if len(svc) != 2 || len(svc[1]) == 0 {
+			continue
+		}
+		for _, s := range svc[0] {
+			_, pfx, err := net.ParseCIDR(s)
+			if err != nil || !pfx.Contains(ip) {
+				continue
+			}
+			if ones, _ := pfx.Mask.Size(); ones > bestLen {
+				if u := preferHTTPS(svc[1]); u != "" {
+					best, bestLen = u, ones
+				}
+			}
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("%w: rdap service for %v", ErrNotFound, ip)
+	}
+	return best, nil
+}
+
+// preferHTTPS returns the first HTTPS URL of a service, or failing that, the first HTTP one.
+func preferHTTPS(urls []string) string {
+	best := ""
+	for _, u := range urls {
+		switch {
+		case strings.HasPrefix(u, "https:"):
+			return u
+		case strings.HasPrefix(u, "http:") && best == "":
+			best = u
+		}
+	}
+	return best
+}
+
+// get fetches a URL, from the cache if it is there.
+func (c *Client) get(ctx context.Context, u string) ([]byte, error) {
+	if body, ok := c.cached(u); ok {
+		return body, nil
+	}
+	body, err := c.fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	c.store(u, body)
+	return body, nil
+}
+
+// fetch queries an RDAP service or bootstrap registry.
+func (c *Client) fetch(ctx context.Context, u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, u)
+	}
+	// Errors are explained in the title and description of the response.
+	var e struct {
+		Title       string   `json:"title"`
+		Description []string `json:"description"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Title != "" {
+		return nil, fmt.Errorf("fetch %s: %s: %s", u, resp.Status, strings.Join(append([]string{e.Title},
+			e.Description...), ": "))
+	}
+	return nil, fmt.Errorf("fetch %s: %s", u, resp.Status)
+}
+
+// timeout returns how long a query may take.
+func (c *Client) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// ttl returns how long responses are cached for, or zero if they are not.
+func (c *Client) ttl() time.Duration {
+	switch {
+	case c.CacheTTL < 0:
+		return 0
+	case c.CacheTTL == 0:
+		return DefaultCacheTTL
+	}
+	return c.CacheTTL
+}
+
+// cached returns the cached response for a key, if there is one that has not expired.
+func (c *Client) cached(key string) ([]byte, bool) {
+	ttl := c.ttl()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[key]
+	if !ok || time.Since(entry.fetched) >= ttl {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// store caches the response for a key.
+func (c *Client) store(key string, body []byte) {
+	if c.ttl() == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
+		c.cache = map[string]cached{}
+	}
+	c.cache[key] = cached{body: body, fetched: time.Now()}
+}
+
+// cachedContact returns the cached abuse contact of the range holding an address, if there is one that has not
+// expired.
+func (c *Client) cachedContact(ip net.IP) (*Contact, bool) {
+	ttl, ip := c.ttl(), ip.To16()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.contacts {
+		if bytes.Compare(ip, entry.first) >= 0 && bytes.Compare(ip, entry.last) <= 0 &&
+			time.Since(entry.fetched) < ttl {
+			contact := entry.contact
+			return &contact, true
+		}
+	}
+	return nil, false
+}
+
+// storeContact caches the abuse contact of the range of a network, replacing those of expired ranges.
+func (c *Client) storeContact(n *Network, contact Contact) {
+	first, last := net.ParseIP(n.StartAddress), net.ParseIP(n.EndAddress)
+	if c.ttl() == 0 || first == nil || last == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	live := c.contacts[:0]
+	for _, entry := range c.contacts {
+		if time.Since(entry.fetched) < c.ttl() {
+			live = append(live, entry)
+		}
+	}
+	c.contacts = append(live, cachedContact{first: first.To16(), last: last.To16(), contact: contact,
+		fetched: time.Now()})
+}
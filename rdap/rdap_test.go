@@ -0,0 +1,158 @@
+package rdap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// vcard returns the jCard of an entity with a name and email address.
+func vcard(name, email string) string {
+	return fmt.Sprintf(`["vcard",[["version",{},"text","4.0"],["fn",{},"text",%q],["email",{},"text",%q]]]`, name,
+		email)
+}
+
+// responses are the responses of the RDAP service to the queries made by the tests, with BASE standing for its URL.
+var responses = map[string]string{
+	"/ipv4.json": `{"services":[[["192.0.0.0/8","198.0.0.0/8","203.0.0.0/8"],["ftp://unused.example/","BASE/"]],` +
+		`[["198.51.100.0/24"],["BASE/more/"]]]}`,
+	// The abuse contact is nested within the organisation.
+	"/ip/192.0.2.1": `{"handle":"NET-192-0-2-0-1","startAddress":"192.0.2.0","endAddress":"192.0.2.255",` +
+		`"entities":[{"handle":"EXAMPLE","roles":["registrant"],"vcardArray":` + vcard("Example", "noc@example.com") +
+		`,"entities":[{"handle":"ABUSE-ARIN","roles":["abuse"],"vcardArray":` + vcard("Abuse", "abuse@example.com") +
+		`}]}],"links":[{"rel":"self","href":"BASE/ip/192.0.2.0"}]}`,
+	// The abuse contact's details must be fetched.
+	"/more/ip/198.51.100.1": `{"handle":"TEST-NET-2","startAddress":"198.51.100.0","endAddress":"198.51.100.255",` +
+		`"entities":[{"handle":"AB1","roles":["abuse","technical"],"links":[{"rel":"self","href":"BASE/entity/AB1"}]}]}`,
+	"/entity/AB1": `{"handle":"AB1","vcardArray":` + vcard("Abuse Desk", "abuse@test-net-2.example") + `}`,
+	// The abuse contact is that of the less specific network.
+	"/ip/203.0.113.1": `{"handle":"CHILD","entities":[{"handle":"T1","roles":["technical"],"vcardArray":` +
+		vcard("Tech", "tech@example.net") + `}],"links":[{"rel":"up","href":"BASE/ip/203.0.0.0/16"}]}`,
+	"/ip/203.0.0.0/16": `{"handle":"PARENT","entities":[{"handle":"A2","roles":["abuse"],"vcardArray":` +
+		vcard("", "abuse@example.net") + `}]}`,
+}
+
+func newServer(t *testing.T, hits *int32) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errorCode":404,"title":"Not Found"}`)
+			return
+		}
+		fmt.Fprint(w, strings.ReplaceAll(body, "BASE", srv.URL))
+	}))
+	return srv
+}
+
+// newWhoisServer returns the address of a whois server answering queries with a response, which may contain REFER,
+// standing for the address of next, the server it refers to.
+func newWhoisServer(t *testing.T, response, next string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if query, err := bufio.NewReader(conn).ReadString('\n'); err == nil && query == "192.0.3.200\r\n" {
+				fmt.Fprint(conn, strings.ReplaceAll(response, "REFER", next))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestAbuseContact(t *testing.T) {
+	var hits int32
+	srv := newServer(t, &hits)
+	defer srv.Close()
+	ripe := newWhoisServer(t, "% Information related to '192.0.2.0 - 192.0.2.255'\n\n"+
+		"% Abuse contact for '192.0.2.0 - 192.0.2.255' is 'abuse@whois.example'\n\ninetnum: 192.0.2.0 - 192.0.2.255\n",
+		"")
+	iana := newWhoisServer(t, "% IANA WHOIS server\n\nrefer:        REFER\n\ninetnum: 192.0.0.0 - 192.255.255.255\n",
+		ripe)
+	c := &Client{BootstrapURL: srv.URL, WhoisServer: iana}
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		ip   string
+		want Contact
+	}{
+		"Nested": {"192.0.2.1", Contact{Email: "abuse@example.com", Name: "Abuse", Handle: "ABUSE-ARIN",
+			Network: "NET-192-0-2-0-1", Source: srv.URL + "/ip/192.0.2.0"}},
+		"Fetched": {"198.51.100.1", Contact{Email: "abuse@test-net-2.example", Name: "Abuse Desk", Handle: "AB1",
+			Network: "TEST-NET-2", Source: srv.URL + "/entity/AB1"}},
+		"Parent": {"203.0.113.1", Contact{Email: "abuse@example.net", Handle: "A2", Network: "PARENT"}},
+		"Whois":  {"192.0.3.200", Contact{Email: "abuse@whois.example", Source: "whois://" + ripe}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := c.AbuseContact(ctx, net.ParseIP(tc.ip))
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if diff := cmp.Diff(&tc.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	t.Run("Cached", func(t *testing.T) {
+		before := atomic.LoadInt32(&hits)
+		got, err := c.AbuseContact(ctx, net.ParseIP("192.0.2.99"))
+		if err != nil || got.Email != "abuse@example.com" {
+			t.Fatalf("got %+v, err %v", got, err)
+		}
+		if after := atomic.LoadInt32(&hits); after != before {
+			t.Fatalf("made %d queries for an address in a cached range", after-before)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		c := &Client{BootstrapURL: srv.URL, NoWhois: true}
+		if _, err := c.AbuseContact(ctx, net.ParseIP("192.0.3.200")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v, want %v", err, ErrNotFound)
+		}
+		if _, err := c.AbuseContact(ctx, net.ParseIP("10.0.0.1")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestParseWhois(t *testing.T) {
+	tests := map[string]struct {
+		body         string
+		email, refer string
+	}{
+		"ARIN": {"NetRange: 192.0.2.0 - 192.0.2.255\nOrgAbuseEmail:  abuse@example.com\n" +
+			"ReferralServer:  rwhois://rwhois.example.com:4321\n", "abuse@example.com", ""},
+		"IANA":     {"refer:        whois.apnic.net\n", "", "whois.apnic.net"},
+		"Referral": {"ReferralServer: whois://whois.ripe.net/\n", "", "whois.ripe.net"},
+		"Mailbox": {"% comment: abuse-mailbox: wrong@example.com\nabuse-mailbox: right@example.com\n",
+			"right@example.com", ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			email, refer := parseWhois([]byte(tc.body))
+			if email != tc.email || refer != tc.refer {
+				t.Fatalf("got %q and %q, want %q and %q", email, refer, tc.email, tc.refer)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package rdap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// whoisPort is the port of whois servers, as assigned by RFC 3912.
+const whoisPort = "43"
+
+// maxWhoisLen bounds the length of a whois response.
+const maxWhoisLen = 1 << 20
+
+// abuseComment matches the comment RIPE and AFRINIC whois servers add to name the abuse contact of a network.
+var abuseComment = regexp.MustCompile(`(?i)^%\s*abuse contact for .* is '([^']+@[^']+)'`)
+
+// whoisContact finds the abuse contact of an address by asking WhoisServer and following its referrals.
+func (c *Client) whoisContact(ctx context.Context, ip net.IP) (*Contact, error) {
+	server := c.WhoisServer
+	if server == "" {
+		server = DefaultWhoisServer
+	}
+	seen := map[string]bool{}
+	for depth := 0; depth < maxParents && server != "" && !seen[server]; depth++ {
+		seen[server] = true
+		body, err := c.whois(ctx, server, ip.String())
+		if err != nil {
+			return nil, err
+		}
+		email, refer := parseWhois(body)
+		if email != "" {
+			return &Contact{Email: email, Source: "whois://" + server}, nil
+		}
+		server = refer
+	}
+	return nil, fmt.Errorf("%w: abuse contact of %v", ErrNotFound, ip)
+}
+
+// parseWhois returns the abuse email address in a whois response, and the server it refers to, if any.
+func parseWhois(body []byte) (email, refer string) {
+	s := bufio.NewScanner(bytes.NewReader(body))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if m := abuseComment.FindStringSubmatch(line); m != nil {
+			if email == "" {
+				email = m[1]
+			}
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 || strings.HasPrefix(line, "%") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])
+		switch key {
+		case "abuse-mailbox", "orgabuseemail", "abuse-email", "e-mail-abuse":
+			if email == "" && strings.Contains(value, "@") {
+				email = value
+			}
+		case "refer", "whois", "referralserver":
+			if refer != "" {
+				continue
+			}
+			// Referrals to servers other than whois, such as rwhois, cannot be followed.
+			if strings.Contains(value, "://") && !strings.HasPrefix(strings.ToLower(value), "whois://") {
+				continue
+			}
+			if i := strings.Index(value, "://"); i >= 0 {
+				value = value[i+len("://"):]
+			}
+			refer = strings.TrimSuffix(value, "/")
+		}
+	}
+	return email, refer
+}
+
+// whois sends a query to a whois server, from the cache if it is there.
+func (c *Client) whois(ctx context.Context, server, query string) ([]byte, error) {
+	key := "whois://" + server + "/" + query
+	if body, ok := c.cached(key); ok {
+		return body, nil
+	}
+
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(server, whoisPort)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Closing the connection unblocks the read if the context is cancelled before the deadline.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	if _, err := fmt.Fprintf(conn, "%s\r\n", query); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(&limitedReader{conn, maxWhoisLen})
+	if err != nil {
+		return nil, fmt.Errorf("whois %s: %w", server, err)
+	}
+	c.store(key, body)
+	return body, nil
+}
+
+// limitedReader reads from a connection until EOF or a limit, reporting reaching the limit as an error.
+type limitedReader struct {
+	conn net.Conn
+	n    int
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, fmt.Errorf("response longer than %d octets", maxWhoisLen)
+	}
+	if len(b) > r.n {
+		b = b[:r.n]
+	}
+	n, err := r.conn.Read(b)
+	r.n -= n
+	return n, err
+}
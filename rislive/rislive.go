@@ -0,0 +1,319 @@
+package rislive
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/bgp"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults used by a Client whose fields are not set.
+const (
+	DefaultURL               = "wss://ris-live.ripe.net/v1/ws/"
+	DefaultName              = "inettools"
+	DefaultTimeout           = 30 * time.Second
+	DefaultReconnectDelay    = time.Second
+	DefaultMaxReconnectDelay = time.Minute
+)
+
+// Filter selects the BGP updates received, as a RIS Live subscription. The zero value selects every update seen by
+// every collector.
+type Filter struct {
+	Host   string     // The route collector, such as "rrc00", or every collector if empty.
+	Peer   net.IP     // The peer of the collector, or every peer if nil.
+	Prefix *net.IPNet // The prefix announced or withdrawn, or every prefix if nil.
+	// Whether updates of prefixes more specific, or less specific, than Prefix are also selected.
+	MoreSpecific, LessSpecific bool
+	// The AS path, as a comma-separated list of ASNs optionally anchored by ^ at the peer and $ at the origin, such
+	// as "64496$" for routes originated by AS64496, or any path if empty.
+	Path string
+	// Whether only updates with announcements, or only those with withdrawals, are selected.
+	RequireAnnouncements, RequireWithdrawals bool
+}
+
+// OriginFilter returns a filter selecting the routes an AS originates.
+func OriginFilter(asn uint32) Filter {
+	return Filter{Path: strconv.FormatUint(uint64(asn), 10) + "$"}
+}
+
+// subscription is the data of a ris_subscribe message.
+func (f *Filter) subscription() map[string]interface{} {
+	s := map[string]interface{}{"type": "UPDATE"}
+	if f.Host != "" {
+		s["host"] = f.Host
+	}
+	if f.Peer != nil {
+		s["peer"] = f.Peer.String()
+	}
+	if f.Prefix != nil {
+		s["prefix"] = f.Prefix.String()
+		s["moreSpecific"] = f.MoreSpecific
+		s["lessSpecific"] = f.LessSpecific
+	}
+	if f.Path != "" {
+		s["path"] = f.Path
+	}
+	switch {
+	case f.RequireAnnouncements:
+		s["require"] = "announcements"
+	case f.RequireWithdrawals:
+		s["require"] = "withdrawals"
+	}
+	return s
+}
+
+// Client receives BGP updates from the route collectors of the RIPE NCC's Routing Information Service through the RIS
+// Live stream, reconnecting when the connection fails.
+type Client struct {
+	URL     string        // The URL of the stream, or DefaultURL if empty.
+	Name    string        // The name the client identifies itself to the stream by, or DefaultName if empty.
+	Filters []Filter      // The subscriptions, receiving the updates any of them select, or every update if empty.
+	Timeout time.Duration // How long connecting may take, or DefaultTimeout if zero.
+	// How long to wait before reconnecting, doubling after each failure up to MaxReconnectDelay; or
+	// DefaultReconnectDelay and DefaultMaxReconnectDelay if zero.
+	ReconnectDelay, MaxReconnectDelay time.Duration
+	TLSConfig                         *tls.Config // The TLS configuration for wss URLs, or the defaults if nil.
+	// If set, called with each error that causes the client to reconnect, and each error reported by the stream.
+	OnError func(error)
+}
+
+// Run streams updates to a channel until the context is done, returning its error. Updates are not received while
+// reconnecting, so some may be missed.
+func (c *Client) Run(ctx context.Context, updates chan<- bgp.Update) error {
+	delay, maxDelay := c.ReconnectDelay, c.MaxReconnectDelay
+	if delay <= 0 {
+		delay = DefaultReconnectDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxReconnectDelay
+	}
+
+	wait := delay
+	for {
+		received, err := c.stream(ctx, updates)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.OnError != nil {
+			c.OnError(err)
+		}
+		if received {
+			wait = delay
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if wait *= 2; wait > maxDelay {
+			wait = maxDelay
+		}
+	}
+}
+
+// stream connects, subscribes and streams updates until the connection fails, returning whether it received any
+// message.
+func (c *Client) stream(ctx context.Context, updates chan<- bgp.Update) (bool, error) {
+	u, err := c.url()
+	if err != nil {
+		return false, err
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	ws, err := dialWebSocket(dialCtx, u, c.TLSConfig)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	defer ws.Close()
+	// Closing the connection unblocks the read when the context is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ws.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	filters := c.Filters
+	if len(filters) == 0 {
+		filters = []Filter{{}}
+	}
+	for i := range filters {
+		msg, err := json.Marshal(map[string]interface{}{"type": "ris_subscribe", "data": filters[i].subscription()})
+		if err != nil {
+			return false, err
+		}
+		if err := ws.WriteText(msg); err != nil {
+			return false, err
+		}
+	}
+
+	received := false
+	for {
+		b, err := ws.ReadMessage()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		var msg struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(b, &msg); err != nil {
+			return received, fmt.Errorf("ris live: %w", err)
+		}
+		switch msg.Type {
+		case "ris_message":
+			update, err := parseUpdate(msg.Data)
+			if err != nil {
+				if c.OnError != nil {
+					c.OnError(err)
+				}
+				continue
+			}
+			if update == nil {
+				continue
+			}
+			select {
+			case updates <- *update:
+			case <-ctx.Done():
+				return received, ctx.Err()
+			}
+		case "ris_error":
+			var e struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(msg.Data, &e)
+			if c.OnError != nil {
+				c.OnError(fmt.Errorf("ris live: %s", e.Message))
+			}
+		}
+	}
+}
+
+// url returns the URL of the stream, identifying the client.
+func (c *Client) url() (string, error) {
+	base, name := c.URL, c.Name
+	if base == "" {
+		base = DefaultURL
+	}
+	if name == "" {
+		name = DefaultName
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("client", name)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// message is the data of a ris_message.
+type message struct {
+	Timestamp     float64           `json:"timestamp"`
+	Peer          string            `json:"peer"`
+	PeerASN       string            `json:"peer_asn"`
+	Host          string            `json:"host"`
+	Type          string            `json:"type"`
+	Path          []json.RawMessage `json:"path"`
+	Community     [][2]uint32       `json:"community"`
+	Origin        string            `json:"origin"`
+	MED           uint32            `json:"med"`
+	Announcements []struct {
+		NextHop  string   `json:"next_hop"`
+		Prefixes []string `json:"prefixes"`
+	} `json:"announcements"`
+	Withdrawals []string `json:"withdrawals"`
+}
+
+// parseUpdate parses the data of a ris_message, returning nil if it is not an UPDATE.
+func parseUpdate(data []byte) (*bgp.Update, error) {
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("ris live message: %w", err)
+	}
+	if m.Type != "UPDATE" {
+		return nil, nil
+	}
+	sec, frac := math.Modf(m.Timestamp)
+	u := &bgp.Update{
+		Time:      time.Unix(int64(sec), int64(frac*1e9)).UTC(),
+		Collector: m.Host,
+		Peer:      net.ParseIP(m.Peer),
+	}
+	if asn, err := strconv.ParseUint(m.PeerASN, 10, 32); err == nil {
+		u.PeerAS = uint32(asn)
+	}
+
+	// AS sets are flattened into the path.
+	var path []uint32
+	for _, seg := range m.Path {
+		var asn uint32
+		var set []uint32
+		switch {
+		case json.Unmarshal(seg, &asn) == nil:
+			path = append(path, asn)
+		case json.Unmarshal(seg, &set) == nil:
+			path = append(path, set...)
+		default:
+			return nil, fmt.Errorf("ris live message: invalid path segment %s", seg)
+		}
+	}
+	var communities []bgp.Community
+	for _, c := range m.Community {
+		if c[0] <= math.MaxUint16 && c[1] <= math.MaxUint16 {
+			communities = append(communities, bgp.Community{ASN: uint16(c[0]), Value: uint16(c[1])})
+		}
+	}
+	origin := bgp.OriginIncomplete
+	switch strings.ToUpper(m.Origin) {
+	case "IGP":
+		origin = bgp.OriginIGP
+	case "EGP":
+		origin = bgp.OriginEGP
+	}
+
+	for _, a := range m.Announcements {
+		// IPv6 next hops may list a global and a link-local address.
+		nextHop := net.ParseIP(strings.TrimSpace(strings.Split(a.NextHop, ",")[0]))
+		for _, s := range a.Prefixes {
+			_, pfx, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, fmt.Errorf("ris live message: %w", err)
+			}
+			u.Announced = append(u.Announced, bgp.Route{
+				Prefix:      pfx,
+				NextHop:     nextHop,
+				Origin:      origin,
+				ASPath:      path,
+				MED:         m.MED,
+				Communities: communities,
+			})
+		}
+	}
+	for _, s := range m.Withdrawals {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("ris live message: %w", err)
+		}
+		u.Withdrawn = append(u.Withdrawn, pfx)
+	}
+	return u, nil
+}
@@ -0,0 +1,181 @@
+package rislive
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dotwaffle/inettools/bgp"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// serverConn is the server end of a WebSocket, which sends unmasked frames.
+type serverConn struct {
+	*wsConn
+}
+
+// send sends a message, in fragments of up to n octets.
+func (c serverConn) send(msg string, n int) error {
+	op := byte(opText)
+	for {
+		frag := msg
+		if len(frag) > n {
+			frag = frag[:n]
+		}
+		msg = msg[len(frag):]
+		fin := byte(0)
+		if msg == "" {
+			fin = 0x80
+		}
+		if _, err := c.conn.Write(append([]byte{fin | op, byte(len(frag))}, frag...)); err != nil {
+			return err
+		}
+		if msg == "" {
+			return nil
+		}
+		op = opContinuation
+	}
+}
+
+// newServer returns a RIS Live server calling serve with each connection and the subscriptions it made.
+func newServer(t *testing.T, subscriptions int,
+	serve func(c serverConn, subs []map[string]interface{})) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("client") != "test" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("unexpected request %v %v", r.URL, r.Header)
+		}
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack err: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+		rw.Flush()
+
+		c := serverConn{&wsConn{conn: conn, r: bufio.NewReader(rw)}}
+		var subs []map[string]interface{}
+		for i := 0; i < subscriptions; i++ {
+			b, err := c.ReadMessage()
+			if err != nil {
+				t.Errorf("read err: %v", err)
+				return
+			}
+			var msg struct {
+				Type string                 `json:"type"`
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.Unmarshal(b, &msg); err != nil || msg.Type != "ris_subscribe" {
+				t.Errorf("got %s, err %v", b, err)
+			}
+			subs = append(subs, msg.Data)
+		}
+		serve(c, subs)
+	}))
+}
+
+const update = `{"type":"ris_message","data":{"timestamp":1600000000.25,"peer":"192.0.2.1","peer_asn":"64500",` +
+	`"id":"x","host":"rrc00","type":"UPDATE","path":[64500,64501,[64502,64503]],"community":[[64500,1]],` +
+	`"origin":"igp","announcements":[{"next_hop":"2001:db8::1,fe80::1","prefixes":["2001:db8:1::/48"]}],` +
+	`"withdrawals":["198.51.100.0/24"]}}`
+
+func TestClient(t *testing.T) {
+	var conns int32
+	var gotSubs []map[string]interface{}
+	srv := newServer(t, 2, func(c serverConn, subs []map[string]interface{}) {
+		if atomic.AddInt32(&conns, 1) == 1 {
+			gotSubs = subs
+			// A ping, an error, a keepalive that is not an update, and an update in fragments, before dropping the
+			// connection.
+			c.conn.Write([]byte{0x80 | opPing, 1, 'x'})
+			c.send(`{"type":"ris_error","data":{"message":"bad filter"}}`, 100)
+			c.send(`{"type":"ris_message","data":{"type":"KEEPALIVE","host":"rrc00"}}`, 100)
+			c.send(update, 50)
+			return
+		}
+		c.send(update, 100)
+		c.ReadMessage()
+	})
+	defer srv.Close()
+
+	var errs []string
+	errc := make(chan string, 10)
+	c := &Client{
+		URL:            "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws/",
+		Name:           "test",
+		Filters:        []Filter{{Prefix: mustCIDR("2001:db8::/32"), MoreSpecific: true}, OriginFilter(64496)},
+		ReconnectDelay: 10 * time.Millisecond,
+		OnError:        func(err error) { errc <- err.Error() },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	updates := make(chan bgp.Update)
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx, updates) }()
+
+	var got []bgp.Update
+	for len(got) < 2 {
+		select {
+		case u := <-updates:
+			got = append(got, u)
+		case <-ctx.Done():
+			t.Fatalf("got %d updates before timing out", len(got))
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("run err: %v", err)
+	}
+	close(errc)
+	for e := range errc {
+		errs = append(errs, e)
+	}
+
+	wantSubs := []map[string]interface{}{
+		{"type": "UPDATE", "prefix": "2001:db8::/32", "moreSpecific": true, "lessSpecific": false},
+		{"type": "UPDATE", "path": "64496$"},
+	}
+	if diff := cmp.Diff(wantSubs, gotSubs); diff != "" {
+		t.Fatalf("subscriptions: %v", diff)
+	}
+	want := bgp.Update{
+		Time:      time.Unix(1600000000, 250000000).UTC(),
+		Collector: "rrc00",
+		Peer:      net.ParseIP("192.0.2.1"),
+		PeerAS:    64500,
+		Announced: []bgp.Route{{
+			Prefix:      mustCIDR("2001:db8:1::/48"),
+			NextHop:     net.ParseIP("2001:db8::1"),
+			Origin:      bgp.OriginIGP,
+			ASPath:      []uint32{64500, 64501, 64502, 64503},
+			Communities: []bgp.Community{{ASN: 64500, Value: 1}},
+		}},
+		Withdrawn: []*net.IPNet{mustCIDR("198.51.100.0/24")},
+	}
+	for i := range got {
+		if diff := cmp.Diff(want, got[i]); diff != "" {
+			t.Fatalf("update %d: %v", i, diff)
+		}
+	}
+	if len(errs) < 2 || errs[0] != "ris live: bad filter" {
+		t.Fatalf("got errors %q", errs)
+	}
+}
@@ -0,0 +1,359 @@
+package route
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/aggregate"
+	"github.com/dotwaffle/inettools/lpm"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Routing tables with reserved numbers.
+const (
+	TableMain  = 254 // The table used when none is specified.
+	TableLocal = 255 // Routes to the addresses of the host, maintained by the kernel.
+)
+
+// Protocols recording what installed a route.
+const (
+	ProtocolKernel = 2 // Routes to connected subnets.
+	ProtocolBoot   = 3 // Routes installed by the administrator without a protocol, as by `ip route add`.
+	ProtocolStatic = 4 // Routes installed by the administrator to override routing daemons.
+)
+
+// Route types.
+const (
+	TypeUnicast     = 1
+	TypeLocal       = 2 // Traffic is delivered to the host itself.
+	TypeBlackhole   = 6 // Traffic is silently discarded.
+	TypeUnreachable = 7 // Traffic is discarded, and the sender told the destination is unreachable.
+	TypeProhibit    = 8 // Traffic is discarded, and the sender told it is administratively prohibited.
+)
+
+// ErrUnsupportedPlatform is returned on platforms where the routing table cannot be read.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// Route is an entry in a routing table of the kernel.
+type Route struct {
+	Prefix    *net.IPNet
+	Gateway   net.IP // The next hop, or nil if the prefix is on-link or the route does not forward.
+	Index     int    // The index of the outgoing interface, or zero if there is none.
+	Interface string
+	Source    net.IP // The preferred source address for traffic using the route, if set.
+	Table     int
+	Protocol  uint8
+	Type      uint8
+	Metric    int // Lower metrics are preferred between routes to the same prefix.
+}
+
+// Filter selects which routes Read returns. The zero value selects every route in the main table.
+type Filter struct {
+	Table     int    // The table to read, or TableMain if zero.
+	Protocol  uint8  // Only routes installed by this protocol, if not zero.
+	Type      uint8  // Only routes of this type, if not zero.
+	Interface string // Only routes out of this interface, if not empty.
+}
+
+// match reports whether r is selected by the filter.
+func (f *Filter) match(r *Route) bool {
+	table := f.Table
+	if table == 0 {
+		table = TableMain
+	}
+	return r.Table == table &&
+		(f.Protocol == 0 || r.Protocol == f.Protocol) &&
+		(f.Type == 0 || r.Type == f.Type) &&
+		(f.Interface == "" || r.Interface == f.Interface)
+}
+
+// Read returns the routes selected by f, which may be nil to read the main table, in the order the kernel lists them.
+func Read(f *Filter) ([]Route, error) {
+	if f == nil {
+		f = &Filter{}
+	}
+	return read(f)
+}
+
+// NewTable loads routes into a table for longest-prefix-match lookups, with each entry holding a *Route. Where several
+// routes share a prefix, the one with the lowest metric is kept, as that is the one the kernel uses.
+func NewTable(routes []Route) (*lpm.Table, error) {
+	best := make(map[string]*Route, len(routes))
+	var order []string
+	for i := range routes {
+		r := &routes[i]
+		if r.Prefix == nil {
+			return nil, errors.New("route without prefix")
+		}
+		key := r.Prefix.String()
+		if prev, ok := best[key]; !ok {
+			order = append(order, key)
+		} else if prev.Metric <= r.Metric {
+			continue
+		}
+		best[key] = r
+	}
+
+	t := lpm.New()
+	for _, key := range order {
+		if err := t.Insert(best[key].Prefix, best[key]); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// ReadTable reads the routes selected by f, which may be nil, into a table as NewTable does.
+func ReadTable(f *Filter) (*lpm.Table, error) {
+	routes, err := Read(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewTable(routes)
+}
+
+// Diff lists the differences between the prefixes installed in a table and those expected.
+type Diff struct {
+	Missing []*net.IPNet // Expected, but not installed.
+	Extra   []*net.IPNet // Installed, but not expected.
+}
+
+// Empty reports whether the installed prefixes match those expected.
+func (d *Diff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0
+}
+
+// Compare finds the drift between the prefixes installed in a table, such as one read with ReadTable, and the prefixes
+// expected, such as the output of aggregate.IPNets. Prefixes are compared exactly, so an expected prefix covered by a
+// shorter installed one is still missing; the table should be read with a Filter selecting only the routes expected to
+// be managed, or every unrelated route will be reported as extra. Both lists are sorted by address, then length.
+func Compare(installed *lpm.Table, expected []*net.IPNet) (*Diff, error) {
+	entries, err := installed.Entries()
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		have[e.Prefix.String()] = true
+	}
+
+	diff := &Diff{}
+	want := make(map[string]bool, len(expected))
+	for _, pfx := range expected {
+		if pfx == nil {
+			return nil, errors.New("nil prefix")
+		}
+		network := &net.IPNet{IP: pfx.IP.Mask(pfx.Mask), Mask: pfx.Mask}
+		key := network.String()
+		if want[key] {
+			continue
+		}
+		want[key] = true
+		if !have[key] {
+			diff.Missing = append(diff.Missing, network)
+		}
+	}
+	for _, e := range entries {
+		if !want[e.Prefix.String()] {
+			diff.Extra = append(diff.Extra, e.Prefix)
+		}
+	}
+
+	sortPrefixes(diff.Missing)
+	sortPrefixes(diff.Extra)
+	return diff, nil
+}
+
+// sortPrefixes sorts prefixes by address, then by length, with IPv4 prefixes first.
+func sortPrefixes(pfxs []*net.IPNet) {
+	sort.Slice(pfxs, func(i, j int) bool {
+		a, b := pfxs[i], pfxs[j]
+		if v4a, v4b := a.IP.To4() != nil, b.IP.To4() != nil; v4a != v4b {
+			return v4a
+		}
+		if c := bytes.Compare(a.IP.To16(), b.IP.To16()); c != 0 {
+			return c < 0
+		}
+		onesA, _ := a.Mask.Size()
+		onesB, _ := b.Mask.Size()
+		return onesA < onesB
+	})
+}
+
+// DefaultProtocol is the protocol used by a Programmer whose Protocol is zero. It is otherwise unused, so that the
+// routes a Programmer installs can be told apart from any others, and it only ever removes its own.
+const DefaultProtocol = 240
+
+// Op is an operation on a route.
+type Op int
+
+// Operations on routes.
+const (
+	Add Op = iota + 1
+	Delete
+)
+
+// String returns the name of the operation.
+func (o Op) String() string {
+	switch o {
+	case Add:
+		return "add"
+	case Delete:
+		return "delete"
+	}
+	return fmt.Sprintf("Op(%d)", int(o))
+}
+
+// Change is a route to be added or deleted.
+type Change struct {
+	Op    Op
+	Route Route
+}
+
+// String describes the change in the syntax of `ip route`.
+func (c Change) String() string {
+	r := &c.Route
+	var sb strings.Builder
+	sb.WriteString(c.Op.String())
+	switch r.Type {
+	case TypeBlackhole:
+		sb.WriteString(" blackhole")
+	case TypeUnreachable:
+		sb.WriteString(" unreachable")
+	case TypeProhibit:
+		sb.WriteString(" prohibit")
+	}
+	fmt.Fprintf(&sb, " %v", r.Prefix)
+	if r.Gateway != nil {
+		fmt.Fprintf(&sb, " via %v", r.Gateway)
+	}
+	if r.Interface != "" {
+		fmt.Fprintf(&sb, " dev %s", r.Interface)
+	}
+	fmt.Fprintf(&sb, " table %d proto %d metric %d", r.Table, r.Protocol, r.Metric)
+	return sb.String()
+}
+
+// Programmer keeps a set of routes in the kernel in line with a list of prefixes, all sharing the same next hop. A
+// blackhole type with no next hop suits remotely triggered blackholing and blocklists. Programming routes requires
+// CAP_NET_ADMIN.
+type Programmer struct {
+	Table     int    // The table to program, or TableMain if zero.
+	Protocol  uint8  // The protocol to mark routes with, or DefaultProtocol if zero.
+	Type      uint8  // The type of the routes, or TypeUnicast if zero.
+	Gateway   net.IP // The next hop of unicast routes, if any.
+	Interface string // The outgoing interface of unicast routes, if any.
+	Metric    int
+	DryRun    bool // Plan changes, but do not make them.
+}
+
+// route returns the route the programmer would install for pfx.
+func (p *Programmer) route(pfx *net.IPNet) Route {
+	r := Route{
+		Prefix:    pfx,
+		Table:     p.Table,
+		Protocol:  p.Protocol,
+		Type:      p.Type,
+		Metric:    p.Metric,
+		Gateway:   p.Gateway,
+		Interface: p.Interface,
+	}
+	if r.Table == 0 {
+		r.Table = TableMain
+	}
+	if r.Protocol == 0 {
+		r.Protocol = DefaultProtocol
+	}
+	if r.Type == 0 {
+		r.Type = TypeUnicast
+	}
+	if r.Type != TypeUnicast {
+		r.Gateway, r.Interface = nil, ""
+	}
+	return r
+}
+
+// Plan compares the routes the programmer has installed with the aggregate of pfxs, and returns the changes needed to
+// bring them in line. Routes installed with other protocols are left alone. A route whose next hop or type has changed
+// is deleted and added again.
+func (p *Programmer) Plan(pfxs []*net.IPNet) ([]Change, error) {
+	// Aggregation sorts the prefixes in place, so it is given a copy.
+	expected, err := aggregate.IPNets(append([]*net.IPNet(nil), pfxs...))
+	if err != nil {
+		return nil, err
+	}
+	proto := p.route(&net.IPNet{})
+	current, err := Read(&Filter{Table: proto.Table, Protocol: proto.Protocol})
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]Route, len(current))
+	for _, r := range current {
+		installed[r.Prefix.String()] = r
+	}
+
+	var changes []Change
+	seen := make(map[string]bool, len(expected))
+	for _, pfx := range expected {
+		want := p.route(pfx)
+		key := pfx.String()
+		seen[key] = true
+		if have, ok := installed[key]; ok {
+			if sameRoute(&have, &want) {
+				continue
+			}
+			changes = append(changes, Change{Op: Delete, Route: have})
+		}
+		changes = append(changes, Change{Op: Add, Route: want})
+	}
+	for _, r := range current {
+		if !seen[r.Prefix.String()] {
+			changes = append(changes, Change{Op: Delete, Route: r})
+		}
+	}
+	return changes, nil
+}
+
+// sameRoute reports whether an installed route already does what is wanted of it. The kernel substitutes its own
+// default for a zero metric on IPv6 routes, so any metric satisfies a zero one.
+func sameRoute(have, want *Route) bool {
+	return have.Type == want.Type && (want.Metric == 0 || have.Metric == want.Metric) &&
+		have.Gateway.Equal(want.Gateway) && (want.Interface == "" || have.Interface == want.Interface)
+}
+
+// Apply makes the changes in order, unless the programmer is in dry-run mode. If a change fails, those already made
+// are undone in reverse order, so that the table is left as it was found, and the error is returned.
+func (p *Programmer) Apply(changes []Change) error {
+	if p.DryRun {
+		return nil
+	}
+	for i, c := range changes {
+		if err := modify(c.Op, &c.Route); err != nil {
+			err = fmt.Errorf("%v: %w", c, err)
+			for j := i - 1; j >= 0; j-- {
+				undo := changes[j]
+				undo.Op = Add + Delete - undo.Op
+				if rbErr := modify(undo.Op, &undo.Route); rbErr != nil {
+					return fmt.Errorf("%w, and rollback failed: %v: %v", err, undo, rbErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync plans and applies the changes needed to route the aggregate of pfxs, returning the changes made, or that would
+// have been made in dry-run mode.
+func (p *Programmer) Sync(pfxs []*net.IPNet) ([]Change, error) {
+	changes, err := p.Plan(pfxs)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Apply(changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
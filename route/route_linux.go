@@ -0,0 +1,238 @@
+// +build linux
+
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// rtmFCloned marks IPv6 routes cloned into the route cache, which are not part of the table.
+const rtmFCloned = 0x200
+
+// read dumps the routing tables with netlink, keeping the routes selected by f.
+func read(f *Filter) ([]Route, error) {
+	b, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	names, err := interfaceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		r, ok := parseRoute(&m)
+		if !ok {
+			continue
+		}
+		r.Interface = names[r.Index]
+		if f.match(r) {
+			routes = append(routes, *r)
+		}
+	}
+	return routes, nil
+}
+
+// interfaceNames maps the indexes of the interfaces of the host to their names.
+func interfaceNames() (map[int]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string, len(ifaces))
+	for _, iface := range ifaces {
+		names[iface.Index] = iface.Name
+	}
+	return names, nil
+}
+
+// parseRoute decodes an RTM_NEWROUTE message, returning false for routes of other families and cached routes.
+func parseRoute(m *syscall.NetlinkMessage) (*Route, bool) {
+	rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+	var bits int
+	switch rtm.Family {
+	case syscall.AF_INET:
+		bits = 8 * net.IPv4len
+	case syscall.AF_INET6:
+		bits = 8 * net.IPv6len
+	default:
+		return nil, false
+	}
+	if rtm.Flags&rtmFCloned != 0 {
+		return nil, false
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return nil, false
+	}
+
+	r := &Route{
+		// A default route has no destination attribute, so the prefix starts out as all zeroes.
+		Prefix:   &net.IPNet{IP: make(net.IP, bits/8), Mask: net.CIDRMask(int(rtm.Dst_len), bits)},
+		Table:    int(rtm.Table),
+		Protocol: rtm.Protocol,
+		Type:     rtm.Type,
+	}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.RTA_DST:
+			if len(a.Value) == bits/8 {
+				r.Prefix.IP = net.IP(a.Value).Mask(r.Prefix.Mask)
+			}
+		case syscall.RTA_GATEWAY:
+			r.Gateway = append(net.IP(nil), a.Value...)
+		case syscall.RTA_OIF:
+			r.Index = int(nativeUint32(a.Value))
+		case syscall.RTA_PREFSRC:
+			r.Source = append(net.IP(nil), a.Value...)
+		case syscall.RTA_PRIORITY:
+			r.Metric = int(nativeUint32(a.Value))
+		case syscall.RTA_TABLE:
+			// Tables numbered above 255 do not fit in the header.
+			r.Table = int(nativeUint32(a.Value))
+		}
+	}
+	return r, true
+}
+
+// nativeUint32 decodes a 32-bit attribute, which netlink sends in host byte order.
+func nativeUint32(b []byte) uint32 {
+	if len(b) < 4 {
+		return 0
+	}
+	return *(*uint32)(unsafe.Pointer(&b[0]))
+}
+
+// modify adds or deletes a route with netlink, waiting for the kernel to acknowledge it.
+func modify(op Op, r *Route) error {
+	if r.Prefix == nil {
+		return errors.New("route without prefix")
+	}
+	family, dst := syscall.AF_INET6, r.Prefix.IP.To16()
+	if ip4 := r.Prefix.IP.To4(); ip4 != nil {
+		family, dst = syscall.AF_INET, ip4
+	}
+	ones, _ := r.Prefix.Mask.Size()
+	index := r.Index
+	if index == 0 && r.Interface != "" {
+		iface, err := net.InterfaceByName(r.Interface)
+		if err != nil {
+			return err
+		}
+		index = iface.Index
+	}
+
+	typ, flags := uint16(syscall.RTM_NEWROUTE), uint16(syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	if op == Add {
+		flags |= syscall.NLM_F_CREATE | syscall.NLM_F_EXCL
+	} else {
+		typ = syscall.RTM_DELROUTE
+	}
+	scope := uint8(syscall.RT_SCOPE_UNIVERSE)
+	if r.Type == TypeUnicast && r.Gateway == nil {
+		scope = syscall.RT_SCOPE_LINK
+	}
+
+	b := make([]byte, syscall.NLMSG_HDRLEN+syscall.SizeofRtMsg)
+	*(*syscall.RtMsg)(unsafe.Pointer(&b[syscall.NLMSG_HDRLEN])) = syscall.RtMsg{
+		Family:   uint8(family),
+		Dst_len:  uint8(ones),
+		Table:    syscall.RT_TABLE_UNSPEC,
+		Protocol: r.Protocol,
+		Scope:    scope,
+		Type:     r.Type,
+	}
+	b = appendAttr(b, syscall.RTA_DST, dst)
+	b = appendAttr(b, syscall.RTA_TABLE, nativeBytes(uint32(r.Table)))
+	b = appendAttr(b, syscall.RTA_PRIORITY, nativeBytes(uint32(r.Metric)))
+	if r.Gateway != nil {
+		gw := r.Gateway.To16()
+		if family == syscall.AF_INET {
+			gw = r.Gateway.To4()
+		}
+		if gw == nil {
+			return fmt.Errorf("gateway %v is not in the family of %v", r.Gateway, r.Prefix)
+		}
+		b = appendAttr(b, syscall.RTA_GATEWAY, gw)
+	}
+	if index != 0 {
+		b = appendAttr(b, syscall.RTA_OIF, nativeBytes(uint32(index)))
+	}
+	*(*syscall.NlMsghdr)(unsafe.Pointer(&b[0])) = syscall.NlMsghdr{
+		Len:   uint32(len(b)),
+		Type:  typ,
+		Flags: flags,
+		Seq:   1,
+	}
+	return request(b)
+}
+
+// appendAttr appends a netlink attribute to b, padded to the attribute alignment.
+func appendAttr(b []byte, typ uint16, value []byte) []byte {
+	attrLen := syscall.SizeofRtAttr + len(value)
+	attr := make([]byte, (attrLen+syscall.RTA_ALIGNTO-1)&^(syscall.RTA_ALIGNTO-1))
+	*(*syscall.RtAttr)(unsafe.Pointer(&attr[0])) = syscall.RtAttr{Len: uint16(attrLen), Type: typ}
+	copy(attr[syscall.SizeofRtAttr:], value)
+	return append(b, attr...)
+}
+
+// nativeBytes encodes a 32-bit attribute in host byte order.
+func nativeBytes(v uint32) []byte {
+	b := make([]byte, 4)
+	*(*uint32)(unsafe.Pointer(&b[0])) = v
+	return b
+}
+
+// request sends a netlink request and waits for its acknowledgement, returning the error the kernel reports.
+func request(b []byte) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	if err := syscall.Sendto(fd, b, 0, sa); err != nil {
+		return os.NewSyscallError("sendto", err)
+	}
+
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return os.NewSyscallError("recvfrom", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return os.NewSyscallError("parsenetlinkmessage", err)
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != 1 || m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			if len(m.Data) < 4 {
+				return errors.New("short netlink error")
+			}
+			// An error code of zero acknowledges success.
+			if errno := syscall.Errno(-int32(nativeUint32(m.Data))); errno != 0 {
+				return errno
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// +build linux
+
+package route
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// testTable is a routing table no rule points at, so that programming it does not affect the host.
+const testTable = 4242
+
+// installed returns the prefixes p has installed in the test table.
+func installed(t *testing.T, p *Programmer) []string {
+	t.Helper()
+	routes, err := Read(&Filter{Table: testTable, Protocol: DefaultProtocol})
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	var pfxs []*net.IPNet
+	for _, r := range routes {
+		pfxs = append(pfxs, r.Prefix)
+	}
+	sortPrefixes(pfxs)
+	return prefixStrings(pfxs)
+}
+
+func TestProgrammer(t *testing.T) {
+	p := &Programmer{Table: testTable, Type: TypeBlackhole}
+	t.Cleanup(func() { p.DryRun = false; p.Sync(nil) })
+
+	changes, err := p.Sync(parsePrefixes(t, "192.0.2.0/25", "192.0.2.128/25", "2001:db8::/32"))
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("programming routes requires CAP_NET_ADMIN")
+	}
+	if err != nil {
+		t.Fatalf("sync err: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("changes: got %v", changes)
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "2001:db8::/32"}, installed(t, p)); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	t.Run("DryRun", func(t *testing.T) {
+		p.DryRun = true
+		defer func() { p.DryRun = false }()
+		changes, err := p.Sync(parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"))
+		if err != nil {
+			t.Fatalf("sync err: %v", err)
+		}
+		var got []string
+		for _, c := range changes {
+			got = append(got, c.String())
+		}
+		want := []string{
+			"add blackhole 198.51.100.0/24 table 4242 proto 240 metric 0",
+			// The kernel attaches blackhole routes to the loopback interface, and sets a default IPv6 metric.
+			"delete blackhole 2001:db8::/32 dev lo table 4242 proto 240 metric 1024",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+		if diff := cmp.Diff([]string{"192.0.2.0/24", "2001:db8::/32"}, installed(t, p)); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		if _, err := p.Sync(parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24")); err != nil {
+			t.Fatalf("sync err: %v", err)
+		}
+		if diff := cmp.Diff([]string{"192.0.2.0/24", "198.51.100.0/24"}, installed(t, p)); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+		changes, err := p.Sync(parsePrefixes(t, "198.51.100.0/24", "192.0.2.0/24"))
+		if err != nil {
+			t.Fatalf("sync err: %v", err)
+		}
+		if len(changes) != 0 {
+			t.Fatalf("changes to an up to date table: %v", changes)
+		}
+		changes, err = p.Sync(parsePrefixes(t, "198.51.100.0/24", "192.0.2.0/24", "2001:db8::/32"))
+		if err != nil || len(changes) != 1 {
+			t.Fatalf("sync: got %v, %v", changes, err)
+		}
+		if changes, err = p.Sync(parsePrefixes(t, "198.51.100.0/24", "192.0.2.0/24", "2001:db8::/32")); len(changes) != 0 {
+			t.Fatalf("changes to an up to date table: %v, %v", changes, err)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		add := p.route(parsePrefixes(t, "203.0.113.0/24")[0])
+		// Adding a route that already exists fails, which should undo the addition before it.
+		changes := []Change{{Op: Add, Route: add}, {Op: Add, Route: p.route(parsePrefixes(t, "192.0.2.0/24")[0])}}
+		if err := p.Apply(changes); !errors.Is(err, syscall.EEXIST) {
+			t.Fatalf("err: got %v, want %v", err, syscall.EEXIST)
+		}
+		if diff := cmp.Diff([]string{"192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"}, installed(t, p)); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+}
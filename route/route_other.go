@@ -0,0 +1,13 @@
+// +build !linux
+
+package route
+
+// read is only implemented on Linux, where the routing table is read with netlink.
+func read(*Filter) ([]Route, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// modify is only implemented on Linux, where routes are programmed with netlink.
+func modify(Op, *Route) error {
+	return ErrUnsupportedPlatform
+}
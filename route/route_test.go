@@ -0,0 +1,135 @@
+package route
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func parsePrefixes(t *testing.T, strs ...string) []*net.IPNet {
+	t.Helper()
+	var pfxs []*net.IPNet
+	for _, s := range strs {
+		_, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+		pfxs = append(pfxs, pfx)
+	}
+	return pfxs
+}
+
+func prefixStrings(pfxs []*net.IPNet) []string {
+	var strs []string
+	for _, pfx := range pfxs {
+		strs = append(strs, pfx.String())
+	}
+	return strs
+}
+
+func TestNewTable(t *testing.T) {
+	pfxs := parsePrefixes(t, "0.0.0.0/0", "192.0.2.0/24", "192.0.2.0/24", "2001:db8::/32")
+	routes := []Route{
+		{Prefix: pfxs[0], Gateway: net.IP{192, 0, 2, 1}, Interface: "eth0", Metric: 100},
+		{Prefix: pfxs[1], Interface: "eth1", Metric: 200},
+		{Prefix: pfxs[2], Interface: "eth2", Metric: 50},
+		{Prefix: pfxs[3], Interface: "eth0", Type: TypeBlackhole},
+	}
+	table, err := NewTable(routes)
+	if err != nil {
+		t.Fatalf("new table err: %v", err)
+	}
+	if table.Len() != 3 {
+		t.Fatalf("len: got %d, want 3", table.Len())
+	}
+
+	tests := map[string]struct {
+		ip   string
+		want string
+	}{
+		"LowestMetric": {ip: "192.0.2.9", want: "eth2"},
+		"Default":      {ip: "198.51.100.1", want: "eth0"},
+		"IPv6":         {ip: "2001:db8::1", want: "eth0"},
+		"NoRoute":      {ip: "2001:db9::1"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := table.Lookup(net.ParseIP(test.ip))
+			if err != nil {
+				t.Fatalf("lookup err: %v", err)
+			}
+			var got string
+			if e != nil {
+				got = e.Value.(*Route).Interface
+			}
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := NewTable([]Route{{}}); err == nil {
+		t.Fatalf("route without prefix accepted")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	var routes []Route
+	for _, pfx := range parsePrefixes(t, "2001:db8:1::/48", "198.51.100.0/24", "192.0.2.0/25", "203.0.113.0/24") {
+		routes = append(routes, Route{Prefix: pfx, Type: TypeBlackhole})
+	}
+	installed, err := NewTable(routes)
+	if err != nil {
+		t.Fatalf("new table err: %v", err)
+	}
+
+	expected := parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24", "2001:db8:2::/48", "203.0.113.7/24")
+	diff, err := Compare(installed, expected)
+	if err != nil {
+		t.Fatalf("compare err: %v", err)
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/24", "2001:db8:2::/48"}, prefixStrings(diff.Missing)); diff != "" {
+		t.Fatalf("missing: %v", diff)
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/25", "2001:db8:1::/48"}, prefixStrings(diff.Extra)); diff != "" {
+		t.Fatalf("extra: %v", diff)
+	}
+	if diff.Empty() {
+		t.Fatalf("diff with drift is empty")
+	}
+
+	same, err := Compare(installed, parsePrefixes(t, "192.0.2.0/25", "198.51.100.0/24", "203.0.113.0/24",
+		"2001:db8:1::/48"))
+	if err != nil {
+		t.Fatalf("compare err: %v", err)
+	}
+	if !same.Empty() {
+		t.Fatalf("got %+v, want empty", same)
+	}
+}
+
+func TestRead(t *testing.T) {
+	routes, err := Read(&Filter{Table: TableLocal, Type: TypeLocal})
+	if errors.Is(err, ErrUnsupportedPlatform) {
+		t.Skip("reading the routing table is not supported")
+	}
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	table, err := NewTable(routes)
+	if err != nil {
+		t.Fatalf("new table err: %v", err)
+	}
+	e, err := table.Lookup(net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatalf("lookup err: %v", err)
+	}
+	if e == nil {
+		t.Fatalf("no local route for loopback in %+v", routes)
+	}
+	if r := e.Value.(*Route); r.Table != TableLocal || r.Type != TypeLocal || r.Interface == "" {
+		t.Fatalf("got %+v", r)
+	}
+}
@@ -0,0 +1,227 @@
+package rpki
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// Announcement is a prefix announced by an origin AS.
+type Announcement struct {
+	Prefix *net.IPNet
+	Origin uint32
+}
+
+// maxCompactDepth bounds how many lengths below a prefix Generate looks for more specifics to cover with a maximum
+// length, as each length doubles the prefixes that must be announced.
+const maxCompactDepth = 16
+
+// Generate returns the ROAs authorising a set of announcements and nothing more, sorted by prefix, IPv4 first, then
+// by ASN. As RFC 9319 recommends, a ROA's maximum length exceeds its prefix's only where every more specific prefix up
+// to that length is also announced by the same origin, so that it authorises no unannounced prefix that a forged-origin
+// hijack could use.
+func Generate(announced []Announcement) []ROA {
+	byOrigin := map[uint32]map[string]*net.IPNet{}
+	for _, a := range announced {
+		pfxs := byOrigin[a.Origin]
+		if pfxs == nil {
+			pfxs = map[string]*net.IPNet{}
+			byOrigin[a.Origin] = pfxs
+		}
+		pfx := &net.IPNet{IP: a.Prefix.IP.Mask(a.Prefix.Mask), Mask: a.Prefix.Mask}
+		pfxs[pfx.String()] = pfx
+	}
+
+	var roas []ROA
+	for origin, pfxs := range byOrigin {
+		sorted := make([]*net.IPNet, 0, len(pfxs))
+		for _, pfx := range pfxs {
+			sorted = append(sorted, pfx)
+		}
+		sortPrefixes(sorted)
+		covered := NewTable()
+		for _, pfx := range sorted {
+			if covered.Validate(pfx, origin) == Valid {
+				continue
+			}
+			ones, bits := pfx.Mask.Size()
+			maxLen := ones
+			for maxLen < bits && maxLen-ones < maxCompactDepth && allAnnounced(pfx, maxLen+1, pfxs) {
+				maxLen++
+			}
+			roa := ROA{Prefix: pfx, MaxLength: maxLen, ASN: origin}
+			covered.Add(roa)
+			roas = append(roas, roa)
+		}
+	}
+	sort.Slice(roas, func(i, j int) bool {
+		if c := comparePrefixes(roas[i].Prefix, roas[j].Prefix); c != 0 {
+			return c < 0
+		}
+		return roas[i].ASN < roas[j].ASN
+	})
+	return roas
+}
+
+// allAnnounced returns whether every prefix of a length within pfx is in pfxs.
+func allAnnounced(pfx *net.IPNet, length int, pfxs map[string]*net.IPNet) bool {
+	ones, bits := pfx.Mask.Size()
+	n := 1 << uint(length-ones)
+	if n > len(pfxs) {
+		return false
+	}
+	mask := net.CIDRMask(length, bits)
+	ip := make(net.IP, len(pfx.IP))
+	copy(ip, pfx.IP)
+	for i := 0; i < n; i++ {
+		if _, ok := pfxs[(&net.IPNet{IP: ip, Mask: mask}).String()]; !ok {
+			return false
+		}
+		// Step to the next prefix of the length, by adding one at its last bit.
+		for b := length - 1; b >= 0; b-- {
+			ip[b/8] ^= 0x80 >> uint(b%8)
+			if ip[b/8]&(0x80>>uint(b%8)) != 0 {
+				break
+			}
+		}
+	}
+	return true
+}
+
+// RiskKind is a kind of risk in a set of ROAs.
+type RiskKind int
+
+// Kinds of risks.
+const (
+	// A ROA's maximum length authorises more specific prefixes that are not announced, which a forged-origin hijack
+	// could announce and be valid.
+	UnannouncedMoreSpecifics RiskKind = iota
+	// A ROA authorises nothing announced, so it may be stale.
+	Unused
+	// An announcement is invalid, and is likely to be dropped by networks validating routes.
+	InvalidAnnouncement
+	// An announcement is not covered by any ROA.
+	UncoveredAnnouncement
+)
+
+func (k RiskKind) String() string {
+	switch k {
+	case UnannouncedMoreSpecifics:
+		return "unannounced-more-specifics"
+	case Unused:
+		return "unused"
+	case InvalidAnnouncement:
+		return "invalid-announcement"
+	case UncoveredAnnouncement:
+		return "uncovered-announcement"
+	}
+	return "RiskKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Risk is a problem with a set of ROAs, given the announcements they should authorise.
+type Risk struct {
+	Kind         RiskKind
+	ROA          *ROA          // The ROA at risk, for UnannouncedMoreSpecifics and Unused.
+	Announcement *Announcement // The announcement at risk, for InvalidAnnouncement and UncoveredAnnouncement.
+	// For UnannouncedMoreSpecifics, the number of prefixes the ROA authorises that are not announced by its AS, or
+	// math.MaxUint64 if there are more.
+	Unannounced uint64
+}
+
+func (r Risk) String() string {
+	switch r.Kind {
+	case UnannouncedMoreSpecifics:
+		return fmt.Sprintf("%v: AS%d %v-%d authorises %d unannounced prefixes", r.Kind, r.ROA.ASN, r.ROA.Prefix,
+			r.ROA.MaxLength, r.Unannounced)
+	case Unused:
+		return fmt.Sprintf("%v: AS%d %v-%d authorises nothing announced", r.Kind, r.ROA.ASN, r.ROA.Prefix,
+			r.ROA.MaxLength)
+	}
+	return fmt.Sprintf("%v: %v from AS%d", r.Kind, r.Announcement.Prefix, r.Announcement.Origin)
+}
+
+// Check returns the risks of a set of ROAs, given the announcements they should authorise: ROAs authorising
+// unannounced more specifics or nothing at all, in the order of the ROAs, followed by announcements that the ROAs make
+// invalid or do not cover, in the order of the announcements.
+func Check(roas []ROA, announced []Announcement) []Risk {
+	table := NewTable()
+	for _, roa := range roas {
+		table.Add(roa)
+	}
+	var risks []Risk
+	for i := range roas {
+		roa := &roas[i]
+		ones, bits := roa.Prefix.Mask.Size()
+		maxLen := roa.MaxLength
+		if maxLen == 0 {
+			maxLen = ones
+		}
+		// The announcements the ROA authorises, counted by length.
+		counted, used := map[string]bool{}, false
+		perLength := make([]uint64, bits+1)
+		for _, a := range announced {
+			l, _ := a.Prefix.Mask.Size()
+			if a.Origin != roa.ASN || l < ones || l > maxLen || !roa.Prefix.Contains(a.Prefix.IP) {
+				continue
+			}
+			if key := a.Prefix.String(); !counted[key] {
+				counted[key], used = true, true
+				perLength[l]++
+			}
+		}
+		if !used {
+			risks = append(risks, Risk{Kind: Unused, ROA: roa})
+			continue
+		}
+		var unannounced uint64
+		for l := ones; l <= maxLen && unannounced != math.MaxUint64; l++ {
+			if l-ones >= 63 {
+				unannounced = math.MaxUint64
+				break
+			}
+			missing := uint64(1)<<uint(l-ones) - perLength[l]
+			if unannounced+missing < unannounced {
+				unannounced = math.MaxUint64
+			} else {
+				unannounced += missing
+			}
+		}
+		if unannounced > 0 && maxLen > ones {
+			risks = append(risks, Risk{Kind: UnannouncedMoreSpecifics, ROA: roa, Unannounced: unannounced})
+		}
+	}
+	for i := range announced {
+		a := &announced[i]
+		switch table.Validate(a.Prefix, a.Origin) {
+		case Invalid:
+			risks = append(risks, Risk{Kind: InvalidAnnouncement, Announcement: a})
+		case NotFound:
+			risks = append(risks, Risk{Kind: UncoveredAnnouncement, Announcement: a})
+		}
+	}
+	return risks
+}
+
+// sortPrefixes sorts prefixes by family, IPv4 first, then address, then length.
+func sortPrefixes(pfxs []*net.IPNet) {
+	sort.Slice(pfxs, func(i, j int) bool { return comparePrefixes(pfxs[i], pfxs[j]) < 0 })
+}
+
+// comparePrefixes orders prefixes by family, IPv4 first, then address, then length.
+func comparePrefixes(a, b *net.IPNet) int {
+	if len(a.IP.To4()) != len(b.IP.To4()) {
+		if a.IP.To4() != nil {
+			return -1
+		}
+		return 1
+	}
+	if c := bytes.Compare(a.IP.To16(), b.IP.To16()); c != 0 {
+		return c
+	}
+	la, _ := a.Mask.Size()
+	lb, _ := b.Mask.Size()
+	return la - lb
+}
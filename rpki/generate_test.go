@@ -0,0 +1,109 @@
+package rpki
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"math"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := map[string]struct {
+		announced []Announcement
+		want      []ROA
+	}{
+		"exact": {
+			announced: []Announcement{
+				{Prefix: mustCIDR("2001:db8::/32"), Origin: 64496},
+				{Prefix: mustCIDR("192.0.2.0/24"), Origin: 64496},
+				{Prefix: mustCIDR("192.0.2.0/24"), Origin: 64497},
+				{Prefix: mustCIDR("192.0.2.0/24"), Origin: 64496},
+			},
+			want: []ROA{
+				{Prefix: mustCIDR("192.0.2.0/24"), MaxLength: 24, ASN: 64496},
+				{Prefix: mustCIDR("192.0.2.0/24"), MaxLength: 24, ASN: 64497},
+				{Prefix: mustCIDR("2001:db8::/32"), MaxLength: 32, ASN: 64496},
+			},
+		},
+		"every more specific announced": {
+			announced: []Announcement{
+				{Prefix: mustCIDR("198.51.100.0/24"), Origin: 64496},
+				{Prefix: mustCIDR("198.51.101.0/24"), Origin: 64496},
+				{Prefix: mustCIDR("198.51.100.0/23"), Origin: 64496},
+				{Prefix: mustCIDR("198.51.100.0/25"), Origin: 64496},
+			},
+			want: []ROA{
+				{Prefix: mustCIDR("198.51.100.0/23"), MaxLength: 24, ASN: 64496},
+				{Prefix: mustCIDR("198.51.100.0/25"), MaxLength: 25, ASN: 64496},
+			},
+		},
+		"more specifics from another origin": {
+			announced: []Announcement{
+				{Prefix: mustCIDR("198.51.100.0/23"), Origin: 64496},
+				{Prefix: mustCIDR("198.51.100.0/24"), Origin: 64496},
+				{Prefix: mustCIDR("198.51.101.0/24"), Origin: 64497},
+			},
+			want: []ROA{
+				{Prefix: mustCIDR("198.51.100.0/23"), MaxLength: 23, ASN: 64496},
+				{Prefix: mustCIDR("198.51.100.0/24"), MaxLength: 24, ASN: 64496},
+				{Prefix: mustCIDR("198.51.101.0/24"), MaxLength: 24, ASN: 64497},
+			},
+		},
+		"unaligned prefix": {
+			announced: []Announcement{{Prefix: mustCIDR("203.0.113.0/24"), Origin: 64496}},
+			want:      []ROA{{Prefix: mustCIDR("203.0.113.0/24"), MaxLength: 24, ASN: 64496}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Generate(test.announced)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	roas := []ROA{
+		{Prefix: mustCIDR("198.51.100.0/22"), MaxLength: 24, ASN: 64496},
+		{Prefix: mustCIDR("192.0.2.0/24"), MaxLength: 24, ASN: 64497},
+		{Prefix: mustCIDR("2001:db8::/32"), MaxLength: 128, ASN: 64496},
+		{Prefix: mustCIDR("203.0.113.0/24"), ASN: 64496},
+	}
+	announced := []Announcement{
+		{Prefix: mustCIDR("198.51.100.0/22"), Origin: 64496},
+		{Prefix: mustCIDR("198.51.100.0/24"), Origin: 64496},
+		{Prefix: mustCIDR("198.51.100.0/24"), Origin: 64496},
+		{Prefix: mustCIDR("192.0.2.0/24"), Origin: 64496},
+		{Prefix: mustCIDR("2001:db8::/32"), Origin: 64496},
+		{Prefix: mustCIDR("2001:db8:1::/48"), Origin: 64499},
+	}
+	got := Check(roas, announced)
+	var gotText []string
+	for _, r := range got {
+		gotText = append(gotText, r.String())
+	}
+	want := []string{
+		"unannounced-more-specifics: AS64496 198.51.100.0/22-24 authorises 5 unannounced prefixes",
+		"unused: AS64497 192.0.2.0/24-24 authorises nothing announced",
+		"unannounced-more-specifics: AS64496 2001:db8::/32-128 authorises 18446744073709551615 unannounced prefixes",
+		"unused: AS64496 203.0.113.0/24-0 authorises nothing announced",
+		"invalid-announcement: 192.0.2.0/24 from AS64496",
+		"invalid-announcement: 2001:db8:1::/48 from AS64499",
+	}
+	if diff := cmp.Diff(want, gotText); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if got[0].ROA != &roas[0] || got[4].Announcement != &announced[3] || got[2].Unannounced != math.MaxUint64 {
+		t.Fatalf("risks do not refer to their roas and announcements: %+v", got)
+	}
+
+	if got := Check(Generate(announced), announced); len(got) != 0 {
+		t.Fatalf("generated roas have risks: %v", got)
+	}
+	uncovered := Check(nil, announced[:1])
+	if len(uncovered) != 1 || uncovered[0].Kind != UncoveredAnnouncement {
+		t.Fatalf("got %v, want an uncovered announcement", uncovered)
+	}
+}
@@ -0,0 +1,226 @@
+package rpki
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/dotwaffle/inettools/lpm"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// State is the validation state of a route, as defined by RFC 6811.
+type State int
+
+// Validation states.
+const (
+	NotFound State = iota // No ROA covers the route's prefix.
+	Valid                 // A ROA covering the prefix authorises its origin and length.
+	Invalid               // ROAs cover the prefix, but none authorises its origin and length.
+)
+
+func (s State) String() string {
+	switch s {
+	case NotFound:
+		return "not-found"
+	case Valid:
+		return "valid"
+	case Invalid:
+		return "invalid"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ROA is a validated ROA payload: the authorisation of an AS to originate a prefix, and its more specifics up to a
+// length.
+type ROA struct {
+	Prefix      *net.IPNet
+	MaxLength   int
+	ASN         uint32 // AS0 authorises no AS to originate the prefix.
+	TrustAnchor string // The trust anchor the ROA was validated under, such as "ripe", if known.
+}
+
+// Table holds ROAs, and validates the origins of routes against them. It is safe for concurrent use.
+type Table struct {
+	mu   sync.RWMutex
+	roas *lpm.Table // Of the ROAs of each prefix, as a []ROA.
+	n    int
+}
+
+// NewTable returns an empty table.
+func NewTable() *Table {
+	return &Table{roas: lpm.New()}
+}
+
+// Add adds a ROA to the table. A ROA whose maximum length is zero is taken to allow only its prefix's own length.
+func (t *Table) Add(roa ROA) error {
+	ones, bits := roa.Prefix.Mask.Size()
+	if roa.MaxLength == 0 {
+		roa.MaxLength = ones
+	}
+	if roa.MaxLength < ones || roa.MaxLength > bits {
+		return fmt.Errorf("invalid max length %d of %v", roa.MaxLength, roa.Prefix)
+	}
+	roa.Prefix = &net.IPNet{IP: roa.Prefix.IP.Mask(roa.Prefix.Mask), Mask: roa.Prefix.Mask}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries, err := t.roas.Matches(roa.Prefix.IP)
+	if err != nil {
+		return err
+	}
+	var roas []ROA
+	if n := len(entries); n > 0 && entries[n-1].Prefix.String() == roa.Prefix.String() {
+		roas = entries[n-1].Value.([]ROA)
+		for _, r := range roas {
+			if r.ASN == roa.ASN && r.MaxLength == roa.MaxLength {
+				return nil
+			}
+		}
+	}
+	t.n++
+	return t.roas.Insert(roa.Prefix, append(roas[:len(roas):len(roas)], roa))
+}
+
+// Len returns the number of ROAs in the table.
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.n
+}
+
+// Covering returns the ROAs whose prefixes contain a prefix, least specific first.
+func (t *Table) Covering(pfx *net.IPNet) []ROA {
+	ones, _ := pfx.Mask.Size()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	entries, err := t.roas.Matches(pfx.IP)
+	if err != nil {
+		return nil
+	}
+	var roas []ROA
+	for _, e := range entries {
+		if l, _ := e.Prefix.Mask.Size(); l <= ones {
+			roas = append(roas, e.Value.([]ROA)...)
+		}
+	}
+	return roas
+}
+
+// Validate returns the validation state of a route to a prefix originated by an AS, following RFC 6811. The origin of
+// a route whose path ends in an AS set should be given as zero, which no ROA matches.
+func (t *Table) Validate(pfx *net.IPNet, origin uint32) State {
+	roas := t.Covering(pfx)
+	if len(roas) == 0 {
+		return NotFound
+	}
+	ones, _ := pfx.Mask.Size()
+	for _, roa := range roas {
+		if origin != 0 && roa.ASN == origin && ones <= roa.MaxLength {
+			return Valid
+		}
+	}
+	return Invalid
+}
+
+// Parse reads ROAs in the JSON format exported by Routinator, rpki-client, OctoRPKI and similar validators, of an
+// object whose "roas" array holds objects of an "asn", "prefix", "maxLength" and "ta"; or in the CSV format of
+// Routinator, of lines of an ASN, prefix, maximum length and trust anchor, after a header line. ASNs may be numbers or
+// strings, with or without the AS prefix.
+func Parse(r io.Reader) ([]ROA, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	for err == nil && (first[0] == ' ' || first[0] == '\t' || first[0] == '\r' || first[0] == '\n') {
+		br.ReadByte()
+		first, err = br.Peek(1)
+	}
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first[0] == '{' {
+		return parseJSON(br)
+	}
+	return parseCSV(br)
+}
+
+// parseJSON reads ROAs exported as JSON.
+func parseJSON(r io.Reader) ([]ROA, error) {
+	var export struct {
+		ROAs []struct {
+			ASN       json.RawMessage `json:"asn"`
+			Prefix    string          `json:"prefix"`
+			MaxLength int             `json:"maxLength"`
+			TA        string          `json:"ta"`
+		} `json:"roas"`
+	}
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	roas := make([]ROA, 0, len(export.ROAs))
+	for i, v := range export.ROAs {
+		asn := string(bytes.Trim(v.ASN, `"`))
+		roa, err := parseROA(asn, v.Prefix, strconv.Itoa(v.MaxLength), v.TA)
+		if err != nil {
+			return nil, fmt.Errorf("roa %d: %w", i, err)
+		}
+		roas = append(roas, roa)
+	}
+	return roas, nil
+}
+
+// parseCSV reads ROAs exported as CSV.
+func parseCSV(r io.Reader) ([]ROA, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var roas []ROA
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return roas, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && len(rec) > 0 && strings.EqualFold(rec[0], "ASN") {
+			continue
+		}
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: want an asn, prefix and max length", line)
+		}
+		ta := ""
+		if len(rec) > 3 {
+			ta = rec[3]
+		}
+		roa, err := parseROA(rec[0], rec[1], rec[2], ta)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		roas = append(roas, roa)
+	}
+}
+
+// parseROA parses the fields of a ROA.
+func parseROA(asn, prefix, maxLength, ta string) (ROA, error) {
+	roa := ROA{TrustAnchor: ta}
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(asn)), "AS"), 10, 32)
+	if err != nil {
+		return roa, fmt.Errorf("invalid asn %q", asn)
+	}
+	roa.ASN = uint32(n)
+	if _, roa.Prefix, err = net.ParseCIDR(strings.TrimSpace(prefix)); err != nil {
+		return roa, err
+	}
+	if roa.MaxLength, err = strconv.Atoi(strings.TrimSpace(maxLength)); err != nil {
+		return roa, fmt.Errorf("invalid max length %q", maxLength)
+	}
+	return roa, nil
+}
@@ -0,0 +1,93 @@
+package rpki
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"strings"
+	"testing"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestValidate(t *testing.T) {
+	table := NewTable()
+	for _, roa := range []ROA{
+		{Prefix: mustCIDR("192.0.2.0/24"), MaxLength: 24, ASN: 64496},
+		{Prefix: mustCIDR("198.51.100.0/22"), MaxLength: 24, ASN: 64497},
+		{Prefix: mustCIDR("198.51.100.0/22"), ASN: 64498},
+		{Prefix: mustCIDR("203.0.113.0/24"), ASN: 0},
+		{Prefix: mustCIDR("2001:db8::/32"), MaxLength: 48, ASN: 64499},
+		{Prefix: mustCIDR("192.0.2.0/24"), MaxLength: 24, ASN: 64496},
+	} {
+		if err := table.Add(roa); err != nil {
+			t.Fatalf("add err: %v", err)
+		}
+	}
+	if n := table.Len(); n != 5 {
+		t.Fatalf("got %d roas, want 5", n)
+	}
+	if err := table.Add(ROA{Prefix: mustCIDR("192.0.2.0/24"), MaxLength: 23}); err == nil {
+		t.Fatalf("got no error from a max length shorter than the prefix")
+	}
+
+	tests := map[string]struct {
+		prefix string
+		origin uint32
+		want   State
+	}{
+		"Valid":         {"192.0.2.0/24", 64496, Valid},
+		"WrongOrigin":   {"192.0.2.0/24", 64511, Invalid},
+		"TooLong":       {"192.0.2.0/25", 64496, Invalid},
+		"MoreSpecific":  {"198.51.101.0/24", 64497, Valid},
+		"SecondROA":     {"198.51.100.0/22", 64498, Valid},
+		"SecondTooLong": {"198.51.100.0/23", 64498, Invalid},
+		"AS0":           {"203.0.113.0/24", 0, Invalid},
+		"NotCovered":    {"192.0.0.0/16", 64496, NotFound},
+		"Unknown":       {"10.0.0.0/8", 64496, NotFound},
+		"IPv6":          {"2001:db8:1::/48", 64499, Valid},
+		"IPv6TooLong":   {"2001:db8:1::/64", 64499, Invalid},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := table.Validate(mustCIDR(tc.prefix), tc.origin); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	want := []ROA{
+		{Prefix: mustCIDR("192.0.2.0/24"), MaxLength: 24, ASN: 64496, TrustAnchor: "ripe"},
+		{Prefix: mustCIDR("2001:db8::/32"), MaxLength: 48, ASN: 64497, TrustAnchor: "arin"},
+	}
+	tests := map[string]string{
+		"JSON": `  {"metadata":{"generated":1},"roas":[` +
+			`{"asn":"AS64496","prefix":"192.0.2.0/24","maxLength":24,"ta":"ripe"},` +
+			`{"asn":64497,"prefix":"2001:db8::/32","maxLength":48,"ta":"arin"}]}`,
+		"CSV": "ASN,IP Prefix,Max Length,Trust Anchor\nAS64496,192.0.2.0/24,24,ripe\nAS64497,2001:db8::/32,48,arin\n",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+
+	for _, input := range []string{`{"roas":[{"asn":"ASx","prefix":"192.0.2.0/24"}]}`, "AS1,bogus,24\n", "AS1\n"} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Fatalf("%q: got no error", input)
+		}
+	}
+}
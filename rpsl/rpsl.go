@@ -0,0 +1,182 @@
+package rpsl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// valueColumn is the column values are aligned to, as in the objects returned by IRR databases.
+const valueColumn = 16
+
+// Attribute is an attribute of an RPSL object.
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// Object is an RPSL object, a list of attributes in order, the first naming its class and holding its key.
+type Object []Attribute
+
+// Class returns the class of the object, the name of its first attribute, or an empty string if it has none.
+func (o Object) Class() string {
+	if len(o) == 0 {
+		return ""
+	}
+	return o[0].Name
+}
+
+// Get returns the values of the attributes with a name, in order.
+func (o Object) Get(name string) []string {
+	var values []string
+	for _, a := range o {
+		if strings.EqualFold(a.Name, name) {
+			values = append(values, a.Value)
+		}
+	}
+	return values
+}
+
+// String returns the object in RPSL, with its values aligned and each line ending in a newline. Values of more than
+// one line are written as continuation lines.
+func (o Object) String() string {
+	var b strings.Builder
+	for _, a := range o {
+		name := a.Name + ":"
+		for i, line := range strings.Split(a.Value, "\n") {
+			if i > 0 {
+				name = "+"
+			}
+			line = strings.TrimRight(line, " \t\r")
+			if line == "" {
+				b.WriteString(strings.TrimRight(name, " ") + "\n")
+				continue
+			}
+			fmt.Fprintf(&b, "%-*s%s\n", valueColumn, name, line)
+		}
+	}
+	return b.String()
+}
+
+// Metadata holds the attributes common to generated objects. MntBy and Source are mandatory in every IRR database;
+// the others are included where given, except AdminC and TechC, which only as-sets have.
+type Metadata struct {
+	Descr   []string
+	AdminC  []string
+	TechC   []string
+	Remarks []string
+	MntBy   []string
+	Source  string
+	Extra   []Attribute // Any further attributes, such as notify or member-of, added before mnt-by.
+}
+
+// ErrInvalidName is returned for an as-set name that is not valid in RPSL.
+var ErrInvalidName = errors.New("invalid as-set name")
+
+// asSetName matches the names of as-sets, which start with AS-, or are hierarchical with at least one component that
+// does.
+var asSetName = regexp.MustCompile(`(?i)^((AS[0-9]+|AS-[A-Z0-9_-]+):)*AS-[A-Z0-9_-]+(:(AS[0-9]+|AS-[A-Z0-9_-]+))*$`)
+
+// validate returns an error if the mandatory attributes are missing.
+func (md *Metadata) validate() error {
+	if len(md.MntBy) == 0 || md.Source == "" {
+		return errors.New("mnt-by and source are mandatory")
+	}
+	return nil
+}
+
+// appendValues appends attributes with a name and each of values to an object.
+func appendValues(o Object, name string, values []string) Object {
+	for _, v := range values {
+		o = append(o, Attribute{Name: name, Value: v})
+	}
+	return o
+}
+
+// Route returns the route object, or route6 object for an IPv6 prefix, registering an origin for a prefix.
+func Route(pfx *net.IPNet, origin uint32, md Metadata) (Object, error) {
+	if err := md.validate(); err != nil {
+		return nil, err
+	}
+	class := "route"
+	if pfx.IP.To4() == nil {
+		class = "route6"
+	}
+	pfx = &net.IPNet{IP: pfx.IP.Mask(pfx.Mask), Mask: pfx.Mask}
+	o := Object{{Name: class, Value: pfx.String()}}
+	o = appendValues(o, "descr", md.Descr)
+	o = append(o, Attribute{Name: "origin", Value: "AS" + strconv.FormatUint(uint64(origin), 10)})
+	return md.finish(o), nil
+}
+
+// Routes returns the route and route6 objects registering an origin for prefixes, skipping duplicates.
+func Routes(pfxs []*net.IPNet, origin uint32, md Metadata) ([]Object, error) {
+	seen := map[string]bool{}
+	var objs []Object
+	for _, pfx := range pfxs {
+		o, err := Route(pfx, origin, md)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[o[0].Value] {
+			seen[o[0].Value] = true
+			objs = append(objs, o)
+		}
+	}
+	return objs, nil
+}
+
+// ASSet returns the as-set object with a name listing members, which are ASNs, with or without the AS prefix, or the
+// names of other as-sets. Members are listed once each, in order.
+func ASSet(name string, members []string, md Metadata) (Object, error) {
+	if err := md.validate(); err != nil {
+		return nil, err
+	}
+	if !asSetName.MatchString(name) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidName, name)
+	}
+	o := Object{{Name: "as-set", Value: strings.ToUpper(name)}}
+	o = appendValues(o, "descr", md.Descr)
+	seen := map[string]bool{}
+	for _, m := range members {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if _, err := strconv.ParseUint(m, 10, 32); err == nil {
+			m = "AS" + m
+		} else if _, err := strconv.ParseUint(strings.TrimPrefix(m, "AS"), 10, 32); err != nil &&
+			!asSetName.MatchString(m) {
+			return nil, fmt.Errorf("invalid member %q", m)
+		}
+		if !seen[m] {
+			seen[m] = true
+			o = append(o, Attribute{Name: "members", Value: m})
+		}
+	}
+	o = appendValues(o, "admin-c", md.AdminC)
+	o = appendValues(o, "tech-c", md.TechC)
+	return md.finish(o), nil
+}
+
+// finish appends the remaining attributes of the metadata to an object.
+func (md *Metadata) finish(o Object) Object {
+	o = appendValues(o, "remarks", md.Remarks)
+	o = append(o, md.Extra...)
+	o = appendValues(o, "mnt-by", md.MntBy)
+	return append(o, Attribute{Name: "source", Value: strings.ToUpper(md.Source)})
+}
+
+// Write writes objects in RPSL, separated by blank lines, as submitted to IRR databases by email or their APIs.
+func Write(w io.Writer, objs []Object) error {
+	bw := bufio.NewWriter(w)
+	for i, o := range objs {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		bw.WriteString(o.String())
+	}
+	return bw.Flush()
+}
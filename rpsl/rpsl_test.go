@@ -0,0 +1,123 @@
+package rpsl
+
+import (
+	"bytes"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestRoutes(t *testing.T) {
+	md := Metadata{
+		Descr:   []string{"Example network"},
+		AdminC:  []string{"EX1-RIPE"},
+		Remarks: []string{"announced to\ntransit and peers"},
+		MntBy:   []string{"MAINT-EXAMPLE"},
+		Source:  "radb",
+		Extra:   []Attribute{{Name: "notify", Value: "noc@example.net"}},
+	}
+	objs, err := Routes([]*net.IPNet{
+		{IP: net.ParseIP("192.0.2.1").To4(), Mask: net.CIDRMask(24, 32)},
+		mustCIDR("2001:db8::/32"),
+		mustCIDR("192.0.2.0/24"),
+	}, 64496, md)
+	if err != nil {
+		t.Fatalf("routes err: %v", err)
+	}
+	var b bytes.Buffer
+	if err := Write(&b, objs); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	want := `route:          192.0.2.0/24
+descr:          Example network
+origin:         AS64496
+remarks:        announced to
++               transit and peers
+notify:         noc@example.net
+mnt-by:         MAINT-EXAMPLE
+source:         RADB
+
+route6:         2001:db8::/32
+descr:          Example network
+origin:         AS64496
+remarks:        announced to
++               transit and peers
+notify:         noc@example.net
+mnt-by:         MAINT-EXAMPLE
+source:         RADB
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if got := objs[1].Class(); got != "route6" {
+		t.Fatalf("got class %q, want route6", got)
+	}
+	if diff := cmp.Diff([]string{"AS64496"}, objs[0].Get("Origin")); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	if _, err := Route(mustCIDR("192.0.2.0/24"), 64496, Metadata{Source: "RADB"}); err == nil {
+		t.Fatalf("got no error without mnt-by")
+	}
+}
+
+func TestASSet(t *testing.T) {
+	md := Metadata{AdminC: []string{"EX1-RIPE"}, TechC: []string{"EX2-RIPE"}, MntBy: []string{"MAINT-EXAMPLE"},
+		Source: "RIPE"}
+	tests := map[string]struct {
+		name    string
+		members []string
+		want    string
+		wantErr bool
+	}{
+		"Members": {
+			name:    "as-example",
+			members: []string{"64496", "AS64497", "as-customers", "AS64496", "AS64496:AS-DOWNSTREAM"},
+			want: `as-set:         AS-EXAMPLE
+members:        AS64496
+members:        AS64497
+members:        AS-CUSTOMERS
+members:        AS64496:AS-DOWNSTREAM
+admin-c:        EX1-RIPE
+tech-c:         EX2-RIPE
+mnt-by:         MAINT-EXAMPLE
+source:         RIPE
+`,
+		},
+		"Hierarchical": {
+			name: "AS64496:AS-CUSTOMERS",
+			want: `as-set:         AS64496:AS-CUSTOMERS
+admin-c:        EX1-RIPE
+tech-c:         EX2-RIPE
+mnt-by:         MAINT-EXAMPLE
+source:         RIPE
+`,
+		},
+		"InvalidName":   {name: "EXAMPLE", wantErr: true},
+		"InvalidMember": {name: "AS-EXAMPLE", members: []string{"EXAMPLE"}, wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, err := ASSet(test.name, test.members, md)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got err %v", err)
+			}
+			if diff := cmp.Diff(test.want, o.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+	if _, err := ASSet("EXAMPLE", nil, md); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("got err %v, want ErrInvalidName", err)
+	}
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/httpprobe"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"net"
+)
+
+// ErrNotReached is returned by a Path probe when the destination did not answer, along with the report.
+var ErrNotReached = errors.New("destination not reached")
+
+// HTTP returns a probe that fetches url, giving a *httpprobe.Result.
+func HTTP(p *httpprobe.Prober, url string) Probe {
+	return func(ctx context.Context) (interface{}, error) {
+		res, err := p.Probe(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+// DNS returns a probe that queries for name and qtype, giving the *dnsutil.Message in response. A response that is not
+// successful is a failure, but is still given.
+func DNS(c *dnsutil.Client, name string, qtype uint16) Probe {
+	return func(ctx context.Context) (interface{}, error) {
+		resp, err := c.Query(ctx, name, qtype)
+		if resp == nil {
+			return nil, err
+		}
+		return resp, err
+	}
+}
+
+// Path returns a probe that traces the path to dst, giving a *pathprobe.Report. A destination that does not answer is
+// a failure, but the report is still given.
+func Path(p *pathprobe.Prober, dst net.IP) Probe {
+	return func(ctx context.Context) (interface{}, error) {
+		report, err := p.Run(ctx, dst)
+		if err != nil {
+			return nil, err
+		}
+		if !report.Reached {
+			return report, ErrNotReached
+		}
+		return report, nil
+	}
+}
+
+// UDP returns a probe that measures the round trip to the udpprobe.Responder at address, giving a *udpprobe.Stats.
+func UDP(p *udpprobe.Prober, address string) Probe {
+	return func(ctx context.Context) (interface{}, error) {
+		stats, err := p.Run(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		return stats, nil
+	}
+}
@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Scheduler whose fields are not set.
+const (
+	DefaultInterval   = time.Minute
+	DefaultJitter     = 0.1 // A tenth of the interval either way.
+	DefaultMaxBackoff = time.Hour
+)
+
+// Errors returned by Add.
+var (
+	ErrDuplicate = errors.New("duplicate job")
+	ErrNoProbe   = errors.New("job has no probe")
+)
+
+// Probe makes a single measurement, returning its result, such as a *httpprobe.Result, or why it failed.
+type Probe func(ctx context.Context) (interface{}, error)
+
+// Job is a probe to run repeatedly.
+type Job struct {
+	Name     string        // Identifies the job, and must be unique within a scheduler.
+	Target   string        // What the job measures, for the results; it is not used by the scheduler.
+	Probe    Probe         // The measurement.
+	Interval time.Duration // The time between runs, or the scheduler's interval if zero.
+	Timeout  time.Duration // The time allowed for each run, or the interval if zero.
+}
+
+// Result is the outcome of a single run of a job.
+type Result struct {
+	Job      string
+	Target   string
+	Start    time.Time
+	Duration time.Duration
+	Value    interface{} // The result of the probe, if it succeeded.
+	Err      error       // Why the probe failed.
+	Failures int         // The number of consecutive failures, including this run, or zero if it succeeded.
+	Next     time.Time   // When the job will next run.
+}
+
+// Scheduler runs jobs at their intervals, each independently of the others, and sends their results on a channel.
+// Each run is offset from the interval by a random jitter, so that many agents or jobs do not measure in lockstep, and
+// a job that fails backs off exponentially until it succeeds again. The zero value is usable.
+type Scheduler struct {
+	Interval time.Duration // The interval of jobs that do not set one, or DefaultInterval if zero.
+	// The most each run is offset by, as a fraction of the interval, or DefaultJitter if zero. Negative disables it.
+	Jitter     float64
+	MaxBackoff time.Duration // The longest a failing job waits between runs, or DefaultMaxBackoff if zero.
+
+	mu      sync.Mutex
+	jobs    map[string]context.CancelFunc
+	pending []Job // Jobs added before Run.
+	run     func(Job)
+	rng     *rand.Rand
+}
+
+// Add schedules a job, whose first run is at a random point within its first interval. It may be called before or
+// while the scheduler is running.
+func (s *Scheduler) Add(job Job) error {
+	if job.Probe == nil {
+		return fmt.Errorf("%w: %s", ErrNoProbe, job.Name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs == nil {
+		s.jobs = map[string]context.CancelFunc{}
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, job.Name)
+	}
+	if s.run == nil {
+		s.jobs[job.Name] = nil
+		s.pending = append(s.pending, job)
+		return nil
+	}
+	s.run(job)
+	return nil
+}
+
+// Remove stops running a job, reporting whether there was one by that name. A run in progress is cancelled.
+func (s *Scheduler) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.jobs[name]
+	if !ok {
+		return false
+	}
+	if cancel != nil {
+		cancel()
+	} else {
+		for i, job := range s.pending {
+			if job.Name == name {
+				s.pending = append(s.pending[:i], s.pending[i+1:]...)
+				break
+			}
+		}
+	}
+	delete(s.jobs, name)
+	return true
+}
+
+// Jobs returns the names of the scheduled jobs.
+func (s *Scheduler) Jobs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Run runs the jobs until the context is done, sending each result on the returned channel, which is closed once
+// every job has stopped. Jobs wait for their results to be received, so the channel must be drained. Run must only be
+// called once.
+func (s *Scheduler) Run(ctx context.Context) <-chan Result {
+	results := make(chan Result)
+	var wg sync.WaitGroup
+
+	s.mu.Lock()
+	if s.jobs == nil {
+		s.jobs = map[string]context.CancelFunc{}
+	}
+	s.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	s.run = func(job Job) {
+		jobCtx, cancel := context.WithCancel(ctx)
+		s.jobs[job.Name] = cancel
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			s.loop(jobCtx, job, results)
+		}()
+	}
+	for _, job := range s.pending {
+		s.run(job)
+	}
+	s.pending = nil
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		// No more jobs can be started once the context is done, as they would stop at once.
+		s.mu.Lock()
+		s.run = func(Job) {}
+		s.mu.Unlock()
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// loop runs a job until its context is done.
+func (s *Scheduler) loop(ctx context.Context, job Job, results chan<- Result) {
+	interval := job.Interval
+	if interval <= 0 {
+		interval = s.Interval
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = interval
+	}
+
+	timer := time.NewTimer(time.Duration(s.random() * float64(interval)))
+	defer timer.Stop()
+	failures := 0
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+
+		res := Result{Job: job.Name, Target: job.Target, Start: time.Now()}
+		runCtx, cancel := context.WithTimeout(ctx, timeout)
+		res.Value, res.Err = job.Probe(runCtx)
+		cancel()
+		res.Duration = time.Since(res.Start)
+		if ctx.Err() != nil {
+			// The job was removed or the scheduler stopped during the run, which is not a failure of the target.
+			return
+		}
+
+		if res.Err != nil {
+			failures++
+		} else {
+			failures = 0
+		}
+		res.Failures = failures
+		wait := s.next(interval, failures)
+		res.Next = res.Start.Add(wait)
+		timer.Reset(time.Until(res.Next))
+
+		select {
+		case results <- res:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// next returns the time from the start of one run to the next: the interval, doubled for each consecutive failure up
+// to the maximum backoff, and offset by the jitter.
+func (s *Scheduler) next(interval time.Duration, failures int) time.Duration {
+	maxBackoff := s.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	wait := interval
+	for i := 0; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff && maxBackoff > interval {
+		wait = maxBackoff
+	}
+
+	jitter := s.Jitter
+	if jitter == 0 {
+		jitter = DefaultJitter
+	}
+	if jitter > 0 {
+		wait += time.Duration((2*s.random() - 1) * jitter * float64(wait))
+	}
+	return wait
+}
+
+// random returns a random number in [0, 1).
+func (s *Scheduler) random() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rng == nil {
+		s.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s.rng.Float64()
+}
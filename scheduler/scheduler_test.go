@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"github.com/google/go-cmp/cmp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	errDown := errors.New("down")
+	var calls int32
+	s := &Scheduler{Interval: 10 * time.Millisecond, Jitter: -1, MaxBackoff: 40 * time.Millisecond}
+	if err := s.Add(Job{Name: "ok", Target: "a", Probe: func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return "up", nil
+	}}); err != nil {
+		t.Fatalf("add err: %v", err)
+	}
+	nop := func(ctx context.Context) (interface{}, error) { return nil, nil }
+	if err := s.Add(Job{Name: "ok", Probe: nop}); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("got %v, want %v", err, ErrDuplicate)
+	}
+	if err := s.Add(Job{Name: "none"}); !errors.Is(err, ErrNoProbe) {
+		t.Fatalf("got %v, want %v", err, ErrNoProbe)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := s.Run(ctx)
+	// Jobs can be added while running.
+	if err := s.Add(Job{Name: "failing", Target: "b", Probe: func(ctx context.Context) (interface{}, error) {
+		return nil, errDown
+	}}); err != nil {
+		t.Fatalf("add err: %v", err)
+	}
+
+	var failures []int
+	var gaps []time.Duration
+	var last time.Time
+	for res := range results {
+		switch res.Job {
+		case "ok":
+			if res.Err != nil || res.Value != "up" || res.Failures != 0 || res.Target != "a" {
+				t.Fatalf("got %+v, want a success", res)
+			}
+			if !res.Next.Equal(res.Start.Add(10 * time.Millisecond)) {
+				t.Fatalf("got next run %v after start, want 10ms", res.Next.Sub(res.Start))
+			}
+		case "failing":
+			if !errors.Is(res.Err, errDown) {
+				t.Fatalf("got %v, want %v", res.Err, errDown)
+			}
+			if !last.IsZero() {
+				gaps = append(gaps, res.Start.Sub(last))
+			}
+			last = res.Start
+			failures = append(failures, res.Failures)
+			if len(failures) == 4 {
+				if !s.Remove("failing") {
+					t.Fatalf("job was not removed")
+				}
+				cancel()
+			}
+		}
+	}
+
+	if diff := cmp.Diff([]int{1, 2, 3, 4}, failures); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	// The waits are doubled after each failure, up to the maximum.
+	for i, min := range []time.Duration{20, 40, 40} {
+		if gaps[i] < min*time.Millisecond {
+			t.Fatalf("got wait %v after failure %d, want at least %vms", gaps[i], i+1, int(min))
+		}
+	}
+	if atomic.LoadInt32(&calls) == 0 {
+		t.Fatalf("got no runs of the successful job")
+	}
+	if diff := cmp.Diff([]string{"ok"}, s.Jobs()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if s.Remove("failing") {
+		t.Fatalf("removed a job twice")
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := map[string]struct {
+		jitter     float64
+		maxBackoff time.Duration
+		failures   int
+		min, max   time.Duration
+	}{
+		"Success":       {jitter: -1, min: time.Minute, max: time.Minute},
+		"Jitter":        {jitter: 0.5, min: 30 * time.Second, max: 90 * time.Second},
+		"DefaultJitter": {min: 54 * time.Second, max: 66 * time.Second},
+		"Backoff":       {jitter: -1, failures: 3, min: 8 * time.Minute, max: 8 * time.Minute},
+		"MaxBackoff":    {jitter: -1, failures: 100, min: time.Hour, max: time.Hour},
+		"LowMaxBackoff": {jitter: -1, maxBackoff: time.Second, failures: 2, min: time.Minute, max: time.Minute},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &Scheduler{Jitter: test.jitter, MaxBackoff: test.maxBackoff}
+			for i := 0; i < 100; i++ {
+				if got := s.next(time.Minute, test.failures); got < test.min || got > test.max {
+					t.Fatalf("got %v, want between %v and %v", got, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestUDP(t *testing.T) {
+	r, err := udpprobe.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer r.Close()
+
+	s := &Scheduler{Interval: 50 * time.Millisecond}
+	p := &udpprobe.Prober{Count: 3, Interval: time.Millisecond, Timeout: 100 * time.Millisecond}
+	if err := s.Add(Job{Name: "udp", Probe: UDP(p, r.Addr().String()), Timeout: time.Second}); err != nil {
+		t.Fatalf("add err: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := s.Run(ctx)
+	res := <-results
+	cancel()
+	for range results {
+	}
+	if res.Err != nil {
+		t.Fatalf("probe err: %v", res.Err)
+	}
+	stats, ok := res.Value.(*udpprobe.Stats)
+	if !ok || stats.Received != 3 {
+		t.Fatalf("got %+v, want 3 echoes", res.Value)
+	}
+}
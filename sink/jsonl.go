@@ -0,0 +1,48 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONLines writes records as newline-delimited JSON, one object per line.
+type JSONLines struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewJSONLines returns a sink writing to w, which it closes when it is closed if it is an io.Closer.
+func NewJSONLines(w io.Writer) *JSONLines {
+	buf := bufio.NewWriter(w)
+	return &JSONLines{w: w, buf: buf, enc: json.NewEncoder(buf)}
+}
+
+// Write writes the records, flushing them before returning.
+func (j *JSONLines) Write(ctx context.Context, records []Record) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, r := range records {
+		if err := j.enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return j.buf.Flush()
+}
+
+// Close flushes the records and closes the writer.
+func (j *JSONLines) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.buf.Flush()
+	if c, ok := j.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
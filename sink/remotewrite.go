@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultPrefix is the prefix of metric names sent by a RemoteWrite whose Prefix is not set.
+const DefaultPrefix = "inettools"
+
+// RemoteWrite sends records to a Prometheus remote-write endpoint, such as that of Prometheus, Mimir, or
+// VictoriaMetrics. Each metric of a record becomes a sample of the series named prefix_kind_metric, labelled with the
+// job, the target, and the labels of the record. Records are sent as soon as they are written.
+type RemoteWrite struct {
+	URL    string
+	Header http.Header  // Added to each request, such as for authorisation.
+	Client *http.Client // The client to send with, or http.DefaultClient if nil.
+	Prefix string       // The prefix of metric names, or DefaultPrefix if empty.
+}
+
+// Write sends the records in a single request.
+func (rw *RemoteWrite) Write(ctx context.Context, records []Record) error {
+	prefix := rw.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	var series []timeSeries
+	for _, r := range records {
+		series = append(series, toSeries(prefix, r)...)
+	}
+	if len(series) == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.URL,
+		bytes.NewReader(snappyEncode(marshalWriteRequest(series))))
+	if err != nil {
+		return err
+	}
+	for k, vs := range rw.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	client := rw.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Close does nothing, as records are not buffered.
+func (rw *RemoteWrite) Close() error {
+	return nil
+}
+
+// label is a label of a time series.
+type label struct {
+	name, value string
+}
+
+// timeSeries is a single sample of a time series.
+type timeSeries struct {
+	labels    []label // Sorted by name, as remote write requires.
+	value     float64
+	timestamp int64 // In milliseconds since the Unix epoch.
+}
+
+// toSeries returns a time series for each metric of a record, in order of name.
+func toSeries(prefix string, r Record) []timeSeries {
+	base := []label{{"job", r.Job}, {"target", r.Target}}
+	for name, value := range r.Labels {
+		if name = sanitize(name, false); name != "job" && name != "target" && name != "__name__" {
+			base = append(base, label{name, value})
+		}
+	}
+	names := make([]string, 0, len(r.Metrics))
+	for name := range r.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var series []timeSeries
+	for _, name := range names {
+		parts := []string{prefix, string(r.Kind), name}
+		if r.Kind == "" {
+			parts = []string{prefix, name}
+		}
+		labels := append([]label{{"__name__", sanitize(strings.Join(parts, "_"), true)}}, base...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+		series = append(series, timeSeries{
+			labels:    labels,
+			value:     r.Metrics[name],
+			timestamp: r.Time.UnixNano() / 1e6,
+		})
+	}
+	return series
+}
+
+// sanitize replaces the characters not allowed in Prometheus metric names, or label names if metric is false, with
+// underscores.
+func sanitize(name string, metric bool) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':' && metric, c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// marshalWriteRequest encodes a prometheus.WriteRequest protocol buffer, which is:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func marshalWriteRequest(series []timeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var msg []byte
+		for _, l := range ts.labels {
+			var lb []byte
+			lb = appendBytes(lb, 1, []byte(l.name))
+			lb = appendBytes(lb, 2, []byte(l.value))
+			msg = appendBytes(msg, 1, lb)
+		}
+		sample := appendTag(nil, 1, 1)
+		var value [8]byte
+		binary.LittleEndian.PutUint64(value[:], math.Float64bits(ts.value))
+		sample = append(sample, value[:]...)
+		sample = appendTag(sample, 2, 0)
+		sample = appendUvarint(sample, uint64(ts.timestamp))
+		msg = appendBytes(msg, 2, sample)
+		req = appendBytes(req, 1, msg)
+	}
+	return req
+}
+
+// appendTag appends the tag of a protocol buffer field.
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendUvarint(b, uint64(field<<3|wireType))
+}
+
+// appendBytes appends a length-delimited protocol buffer field.
+func appendBytes(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, 2)
+	b = appendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendUvarint appends a varint.
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// snappyEncode encodes b in the Snappy block format that remote write requires. It does not compress, writing b as
+// literals, which any decoder accepts; requests are small, and this avoids a dependency.
+func snappyEncode(b []byte) []byte {
+	out := appendUvarint(nil, uint64(len(b)))
+	for len(b) > 0 {
+		n := len(b)
+		if n > 65536 {
+			n = 65536
+		}
+		switch {
+		case n <= 60:
+			out = append(out, byte(n-1)<<2)
+		case n <= 256:
+			out = append(out, 60<<2, byte(n-1))
+		default:
+			out = append(out, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		out = append(out, b[:n]...)
+		b = b[n:]
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// snappyDecode decodes the literals written by snappyEncode.
+func snappyDecode(t *testing.T, b []byte) []byte {
+	n, l := binary.Uvarint(b)
+	b = b[l:]
+	var out []byte
+	for len(b) > 0 {
+		tag := b[0]
+		if tag&3 != 0 {
+			t.Fatalf("got tag %#x, want a literal", tag)
+		}
+		length := int(tag>>2) + 1
+		switch tag >> 2 {
+		case 60:
+			length, b = int(b[1])+1, b[1:]
+		case 61:
+			length, b = int(binary.LittleEndian.Uint16(b[1:]))+1, b[2:]
+		}
+		out = append(out, b[1:1+length]...)
+		b = b[1+length:]
+	}
+	if uint64(len(out)) != n {
+		t.Fatalf("got %d bytes, want %d", len(out), n)
+	}
+	return out
+}
+
+// fields splits an encoded protocol buffer message into its fields, keyed by number. Fixed64 and varint values are
+// returned as eight little-endian bytes.
+func fields(t *testing.T, b []byte) map[uint64][][]byte {
+	m := map[uint64][][]byte{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		var v []byte
+		switch tag & 7 {
+		case 0:
+			x, n := binary.Uvarint(b)
+			v, b = make([]byte, 8), b[n:]
+			binary.LittleEndian.PutUint64(v, x)
+		case 1:
+			v, b = b[:8], b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			v, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			t.Fatalf("got wire type %d", tag&7)
+		}
+		m[tag>>3] = append(m[tag>>3], v)
+	}
+	return m
+}
+
+// unmarshalWriteRequest decodes a write request into series of their labels and sample values.
+func unmarshalWriteRequest(t *testing.T, b []byte) []timeSeries {
+	var series []timeSeries
+	for _, msg := range fields(t, b)[1] {
+		f := fields(t, msg)
+		var ts timeSeries
+		for _, lb := range f[1] {
+			l := fields(t, lb)
+			ts.labels = append(ts.labels, label{string(l[1][0]), string(l[2][0])})
+		}
+		sample := fields(t, f[2][0])
+		ts.value = math.Float64frombits(binary.LittleEndian.Uint64(sample[1][0]))
+		ts.timestamp = int64(binary.LittleEndian.Uint64(sample[2][0]))
+		series = append(series, ts)
+	}
+	return series
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, n := range []int{0, 1, 60, 61, 256, 257, 65536, 100000} {
+		b := bytes.Repeat([]byte{'x'}, n)
+		if got := snappyDecode(t, snappyEncode(b)); !bytes.Equal(got, b) {
+			t.Fatalf("got %d bytes back from %d", len(got), n)
+		}
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorised", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	records := []Record{{
+		Time:    time.Unix(1, 5e6),
+		Kind:    KindUDP,
+		Job:     "udp",
+		Target:  "192.0.2.1:7",
+		Labels:  map[string]string{"site-name": "lon", "job": "ignored"},
+		Metrics: map[string]float64{"loss": 0.25, "success": 1},
+	}}
+	rw := &RemoteWrite{URL: srv.URL}
+	if err := rw.Write(context.Background(), records); err == nil {
+		t.Fatalf("got no error without authorisation")
+	}
+	rw.Header = http.Header{"Authorization": {"Bearer token"}}
+	if err := rw.Write(context.Background(), records); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	if got := header.Get("Content-Encoding"); got != "snappy" {
+		t.Fatalf("got content encoding %q, want snappy", got)
+	}
+
+	labels := func(name string) []label {
+		return []label{{"__name__", name}, {"job", "udp"}, {"site_name", "lon"}, {"target", "192.0.2.1:7"}}
+	}
+	want := []timeSeries{
+		{labels: labels("inettools_udp_loss"), value: 0.25, timestamp: 1005},
+		{labels: labels("inettools_udp_success"), value: 1, timestamp: 1005},
+	}
+	got := unmarshalWriteRequest(t, snappyDecode(t, body))
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(timeSeries{}, label{})); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]struct {
+		name   string
+		metric bool
+		want   string
+	}{
+		"Valid":        {name: "rtt_seconds", want: "rtt_seconds"},
+		"Dash":         {name: "site-name", want: "site_name"},
+		"LeadingDigit": {name: "1st", want: "_st"},
+		"MetricColon":  {name: "a:b", metric: true, want: "a:b"},
+		"LabelColon":   {name: "a:b", want: "a_b"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, sanitize(test.name, test.metric)); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
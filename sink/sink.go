@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/httpprobe"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/dotwaffle/inettools/scheduler"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"time"
+)
+
+// Kind is the kind of measurement a record holds.
+type Kind string
+
+// Kinds of measurement.
+const (
+	KindHTTP    Kind = "http"
+	KindDNS     Kind = "dns"
+	KindPath    Kind = "path"
+	KindUDP     Kind = "udp"
+	KindTCPInfo Kind = "tcpinfo"
+)
+
+// Record is a measurement in the schema shared by every sink, so that results from different probes can be stored
+// and analysed together. Metric names are in snake case with a unit suffix where they have one, durations are in
+// seconds, and proportions are fractions.
+type Record struct {
+	Time    time.Time          `json:"time"`
+	Kind    Kind               `json:"kind"`
+	Job     string             `json:"job,omitempty"`
+	Target  string             `json:"target"`
+	Labels  map[string]string  `json:"labels,omitempty"`
+	Metrics map[string]float64 `json:"metrics"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// Sink stores records.
+type Sink interface {
+	// Write stores records, in order.
+	Write(ctx context.Context, records []Record) error
+	// Close flushes any buffered records and releases the sink.
+	Close() error
+}
+
+// FromResult builds a record from a result of the scheduler. The metrics of results from the probes of the scheduler
+// package are extracted; every record has success, one if the probe succeeded and zero otherwise, and duration_seconds.
+func FromResult(res scheduler.Result) Record {
+	r := Record{
+		Time:    res.Start,
+		Job:     res.Job,
+		Target:  res.Target,
+		Metrics: map[string]float64{"success": 1, "duration_seconds": res.Duration.Seconds()},
+	}
+	if res.Err != nil {
+		r.Metrics["success"] = 0
+		r.Error = res.Err.Error()
+	}
+
+	switch v := res.Value.(type) {
+	case *httpprobe.Result:
+		r.Kind = KindHTTP
+		r.Labels = map[string]string{"proto": v.Proto}
+		r.Metrics["status_code"] = float64(v.Status)
+		r.Metrics["body_bytes"] = float64(v.Bytes)
+		r.Metrics["dns_seconds"] = v.Timings.DNS.Seconds()
+		r.Metrics["connect_seconds"] = v.Timings.Connect.Seconds()
+		r.Metrics["tls_seconds"] = v.Timings.TLS.Seconds()
+		r.Metrics["ttfb_seconds"] = v.Timings.TTFB.Seconds()
+		r.Metrics["transfer_seconds"] = v.Timings.Transfer.Seconds()
+		r.Metrics["total_seconds"] = v.Timings.Total.Seconds()
+	case *dnsutil.Message:
+		r.Kind = KindDNS
+		r.Labels = map[string]string{"rcode": dnsutil.RCodeString(v.RCode)}
+		r.Metrics["rcode"] = float64(v.RCode)
+		r.Metrics["answers"] = float64(len(v.Answers))
+	case *pathprobe.Report:
+		r.Kind = KindPath
+		r.Metrics["hops"] = float64(len(v.Hops))
+		r.Metrics["reached"] = 0
+		if v.Reached && len(v.Hops) > 0 {
+			hop := v.Hops[len(v.Hops)-1]
+			r.Metrics["reached"] = 1
+			r.Metrics["loss"] = hop.Loss()
+			r.Metrics["rtt_seconds"] = hop.Mean.Seconds()
+		}
+	case *udpprobe.Stats:
+		r.Kind = KindUDP
+		r.Metrics["sent"] = float64(v.Sent)
+		r.Metrics["received"] = float64(v.Received)
+		r.Metrics["duplicates"] = float64(v.Duplicates)
+		r.Metrics["reordered"] = float64(v.Reordered)
+		r.Metrics["loss"] = v.Loss()
+		r.Metrics["rtt_min_seconds"] = v.MinRTT.Seconds()
+		r.Metrics["rtt_mean_seconds"] = v.MeanRTT.Seconds()
+		r.Metrics["rtt_max_seconds"] = v.MaxRTT.Seconds()
+		r.Metrics["rtt_stddev_seconds"] = v.StdDevRTT.Seconds()
+		r.Metrics["forward_jitter_seconds"] = v.ForwardJitter.Seconds()
+		r.Metrics["reverse_jitter_seconds"] = v.ReverseJitter.Seconds()
+	}
+	return r
+}
+
+// Collect writes a record for each result until results is closed, such as by the context of Scheduler.Run being
+// done, returning the first error from the sink.
+func Collect(ctx context.Context, s Sink, results <-chan scheduler.Result) error {
+	for res := range results {
+		if err := s.Write(ctx, []Record{FromResult(res)}); err != nil {
+			// Drain the results so that the scheduler can stop.
+			go func() {
+				for range results {
+				}
+			}()
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/dotwaffle/inettools/dnsutil"
+	"github.com/dotwaffle/inettools/httpprobe"
+	"github.com/dotwaffle/inettools/pathprobe"
+	"github.com/dotwaffle/inettools/scheduler"
+	"github.com/dotwaffle/inettools/udpprobe"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+	"time"
+)
+
+func TestFromResult(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		value interface{}
+		err   error
+		want  Record
+	}{
+		"HTTP": {
+			value: &httpprobe.Result{Status: 200, Proto: "HTTP/2.0", Bytes: 1024, Timings: httpprobe.Timings{
+				DNS: time.Millisecond, Connect: 2 * time.Millisecond, TTFB: 4 * time.Millisecond, Total: 8 * time.Millisecond,
+			}},
+			want: Record{Kind: KindHTTP, Labels: map[string]string{"proto": "HTTP/2.0"}, Metrics: map[string]float64{
+				"success": 1, "duration_seconds": 0.5, "status_code": 200, "body_bytes": 1024, "dns_seconds": 0.001,
+				"connect_seconds": 0.002, "tls_seconds": 0, "ttfb_seconds": 0.004, "transfer_seconds": 0,
+				"total_seconds": 0.008,
+			}},
+		},
+		"DNS": {
+			value: &dnsutil.Message{RCode: dnsutil.RCodeNameError},
+			err:   errors.New("nxdomain"),
+			want: Record{Kind: KindDNS, Labels: map[string]string{"rcode": "NXDOMAIN"}, Error: "nxdomain",
+				Metrics: map[string]float64{"success": 0, "duration_seconds": 0.5, "rcode": 3, "answers": 0}},
+		},
+		"Path": {
+			value: &pathprobe.Report{Reached: true, Hops: []pathprobe.Hop{
+				{TTL: 1, Sent: 4, Received: 4},
+				{TTL: 2, Sent: 4, Received: 3, Mean: 20 * time.Millisecond},
+			}},
+			want: Record{Kind: KindPath, Metrics: map[string]float64{
+				"success": 1, "duration_seconds": 0.5, "hops": 2, "reached": 1, "loss": 0.25, "rtt_seconds": 0.02,
+			}},
+		},
+		"UDP": {
+			value: &udpprobe.Stats{Sent: 10, Received: 9, MeanRTT: 10 * time.Millisecond},
+			want: Record{Kind: KindUDP, Metrics: map[string]float64{
+				"success": 1, "duration_seconds": 0.5, "sent": 10, "received": 9, "duplicates": 0, "reordered": 0,
+				"loss": 0.1, "rtt_min_seconds": 0, "rtt_mean_seconds": 0.01, "rtt_max_seconds": 0,
+				"rtt_stddev_seconds": 0, "forward_jitter_seconds": 0, "reverse_jitter_seconds": 0,
+			}},
+		},
+		"Failed": {
+			err:  errors.New("timeout"),
+			want: Record{Error: "timeout", Metrics: map[string]float64{"success": 0, "duration_seconds": 0.5}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := FromResult(scheduler.Result{
+				Job: "job", Target: "target", Start: start, Duration: 500 * time.Millisecond,
+				Value: test.value, Err: test.err,
+			})
+			test.want.Time, test.want.Job, test.want.Target = start, "job", "target"
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	j := NewJSONLines(&buf)
+	records := []Record{
+		{Time: time.Unix(0, 0).UTC(), Kind: KindUDP, Target: "192.0.2.1:7", Metrics: map[string]float64{"loss": 0.5}},
+		{Time: time.Unix(1, 0).UTC(), Target: "192.0.2.2", Metrics: map[string]float64{"success": 0}, Error: "down"},
+	}
+	if err := j.Write(context.Background(), records); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("close err: %v", err)
+	}
+	want := `{"time":"1970-01-01T00:00:00Z","kind":"udp","target":"192.0.2.1:7","metrics":{"loss":0.5}}
+{"time":"1970-01-01T00:00:01Z","kind":"","target":"192.0.2.2","metrics":{"success":0},"error":"down"}
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+// memory is a sink that keeps records in memory.
+type memory struct {
+	records []Record
+	err     error
+}
+
+func (m *memory) Write(ctx context.Context, records []Record) error {
+	m.records = append(m.records, records...)
+	return m.err
+}
+
+func (m *memory) Close() error { return nil }
+
+func TestCollect(t *testing.T) {
+	results := make(chan scheduler.Result, 3)
+	results <- scheduler.Result{Job: "a"}
+	results <- scheduler.Result{Job: "b"}
+	results <- scheduler.Result{Job: "c"}
+	close(results)
+	m := &memory{}
+	if err := Collect(context.Background(), m, results); err != nil {
+		t.Fatalf("collect err: %v", err)
+	}
+	var got []string
+	for _, r := range m.records {
+		got = append(got, r.Job)
+	}
+	if diff := cmp.Diff([]string{"a", "b", "c"}, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	errFull := errors.New("full")
+	results = make(chan scheduler.Result)
+	go func() {
+		for i := 0; i < 3; i++ {
+			results <- scheduler.Result{}
+		}
+		close(results)
+	}()
+	if err := Collect(context.Background(), &memory{err: errFull}, results); !errors.Is(err, errFull) {
+		t.Fatalf("got %v, want %v", err, errFull)
+	}
+}
@@ -0,0 +1,95 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// schema creates the tables of SQL sinks: a row of results per record, with its labels and metrics in rows of their
+// own. Times are in nanoseconds since the Unix epoch.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS results (
+		id INTEGER PRIMARY KEY,
+		time INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		job TEXT NOT NULL,
+		target TEXT NOT NULL,
+		error TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS labels (
+		result_id INTEGER NOT NULL REFERENCES results (id),
+		name TEXT NOT NULL,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS metrics (
+		result_id INTEGER NOT NULL REFERENCES results (id),
+		name TEXT NOT NULL,
+		value REAL NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS results_time ON results (time)`,
+	`CREATE INDEX IF NOT EXISTS metrics_result ON metrics (result_id, name)`,
+}
+
+// SQL stores records in a SQLite database, or another that accepts its SQL, such as one opened with the
+// github.com/mattn/go-sqlite3 or modernc.org/sqlite drivers.
+type SQL struct {
+	db *sql.DB
+}
+
+// NewSQL returns a sink storing records in db, creating its tables if they do not exist. The sink closes db when it is
+// closed.
+func NewSQL(ctx context.Context, db *sql.DB) (*SQL, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("create schema: %w", err)
+		}
+	}
+	return &SQL{db: db}, nil
+}
+
+// Write stores the records in a single transaction.
+func (s *SQL) Write(ctx context.Context, records []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := insert(ctx, tx, r); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insert stores a record.
+func insert(ctx context.Context, tx *sql.Tx, r Record) error {
+	res, err := tx.ExecContext(ctx, "INSERT INTO results (time, kind, job, target, error) VALUES (?, ?, ?, ?, ?)",
+		r.Time.UnixNano(), string(r.Kind), r.Job, r.Target, r.Error)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for name, value := range r.Labels {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO labels (result_id, name, value) VALUES (?, ?, ?)",
+			id, name, value); err != nil {
+			return err
+		}
+	}
+	for name, value := range r.Metrics {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO metrics (result_id, name, value) VALUES (?, ?, ?)",
+			id, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a database driver that records the statements executed, as no SQL database is in the standard
+// library.
+type fakeDriver struct {
+	mu    sync.Mutex
+	execs []string
+	rows  int64
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.d, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *fakeConn) Commit() error                             { return nil }
+func (c *fakeConn) Rollback() error                           { return nil }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if strings.HasPrefix(s.query, "CREATE") {
+		return driver.RowsAffected(0), nil
+	}
+	table := strings.Fields(s.query)[2]
+	s.d.execs = append(s.d.execs, fmt.Sprintf("%s %v", table, args))
+	s.d.rows++
+	return fakeResult(s.d.rows), nil
+}
+
+// fakeResult is the result of an insert, whose ID is the count of rows inserted.
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) { return int64(r), nil }
+func (r fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func TestSQL(t *testing.T) {
+	d := &fakeDriver{}
+	sql.Register("sinktest", d)
+	db, err := sql.Open("sinktest", "")
+	if err != nil {
+		t.Fatalf("open err: %v", err)
+	}
+	s, err := NewSQL(context.Background(), db)
+	if err != nil {
+		t.Fatalf("new err: %v", err)
+	}
+	defer s.Close()
+
+	err = s.Write(context.Background(), []Record{{
+		Time:    time.Unix(1, 0),
+		Kind:    KindDNS,
+		Job:     "dns",
+		Target:  "example.com",
+		Labels:  map[string]string{"rcode": "NOERROR"},
+		Metrics: map[string]float64{"success": 1, "answers": 2},
+	}})
+	if err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	got := d.execs
+	// Labels and metrics are stored in no particular order.
+	sort.Strings(got[1:])
+	want := []string{
+		"results [1000000000 dns dns example.com ]",
+		"labels [1 rcode NOERROR]",
+		"metrics [1 answers 2]",
+		"metrics [1 success 1]",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
@@ -0,0 +1,30 @@
+// +build linux
+
+package sink
+
+import (
+	"syscall"
+	"time"
+)
+
+// FromTCPInfo builds a record from the TCP_INFO of a connection to target, such as that returned by tcpinfo.Get.
+func FromTCPInfo(t time.Time, target string, info *syscall.TCPInfo) Record {
+	return Record{
+		Time:   t,
+		Kind:   KindTCPInfo,
+		Target: target,
+		Metrics: map[string]float64{
+			"rtt_seconds":       float64(info.Rtt) / 1e6,
+			"rtt_var_seconds":   float64(info.Rttvar) / 1e6,
+			"rto_seconds":       float64(info.Rto) / 1e6,
+			"snd_cwnd":          float64(info.Snd_cwnd),
+			"snd_ssthresh":      float64(info.Snd_ssthresh),
+			"snd_mss_bytes":     float64(info.Snd_mss),
+			"rcv_mss_bytes":     float64(info.Rcv_mss),
+			"pmtu_bytes":        float64(info.Pmtu),
+			"unacked":           float64(info.Unacked),
+			"lost":              float64(info.Lost),
+			"retransmits_total": float64(info.Total_retrans),
+		},
+	}
+}
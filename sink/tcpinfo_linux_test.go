@@ -0,0 +1,22 @@
+// +build linux
+
+package sink
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFromTCPInfo(t *testing.T) {
+	now := time.Now()
+	r := FromTCPInfo(now, "192.0.2.1:443", &syscall.TCPInfo{Rtt: 12500, Snd_cwnd: 10, Total_retrans: 3})
+	if r.Kind != KindTCPInfo || r.Target != "192.0.2.1:443" || !r.Time.Equal(now) {
+		t.Fatalf("got %+v", r)
+	}
+	for name, want := range map[string]float64{"rtt_seconds": 0.0125, "snd_cwnd": 10, "retransmits_total": 3} {
+		if got := r.Metrics[name]; got != want {
+			t.Fatalf("got %s %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package sockdiag
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Protocols that can be listed.
+const (
+	TCP = 6
+	UDP = 17
+)
+
+// ErrUnsupportedPlatform is returned on platforms without sock_diag.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// State is the state of a socket, using the TCP state numbering for both protocols.
+type State uint8
+
+// Socket states.
+const (
+	Established State = iota + 1
+	SynSent
+	SynRecv
+	FinWait1
+	FinWait2
+	TimeWait
+	Close
+	CloseWait
+	LastAck
+	Listen
+	Closing
+	NewSynRecv
+)
+
+// stateNames holds the names of the states, as ss prints them.
+var stateNames = map[State]string{
+	Established: "ESTAB",
+	SynSent:     "SYN-SENT",
+	SynRecv:     "SYN-RECV",
+	FinWait1:    "FIN-WAIT-1",
+	FinWait2:    "FIN-WAIT-2",
+	TimeWait:    "TIME-WAIT",
+	Close:       "UNCONN",
+	CloseWait:   "CLOSE-WAIT",
+	LastAck:     "LAST-ACK",
+	Listen:      "LISTEN",
+	Closing:     "CLOSING",
+	NewSynRecv:  "NEW-SYN-RECV",
+}
+
+// String returns the name of the state, as ss prints it.
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", uint8(s))
+}
+
+// Addr is the address and port of one end of a socket.
+type Addr struct {
+	IP   net.IP
+	Port int
+}
+
+// String returns the address and port in host:port form.
+func (a Addr) String() string {
+	return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
+}
+
+// TCPInfo is the TCP_INFO of a socket, including the fields added since syscall.TCPInfo was defined. Fields the
+// running kernel does not report are zero. Times are in microseconds, unless noted otherwise.
+type TCPInfo struct {
+	State         uint8
+	CAState       uint8
+	Retransmits   uint8
+	Probes        uint8
+	Backoff       uint8
+	Options       uint8
+	WScale        uint8 // The send window scale in the low four bits, and the receive window scale in the high four.
+	Flags         uint8
+	RTO           uint32
+	ATO           uint32
+	SndMSS        uint32
+	RcvMSS        uint32
+	Unacked       uint32
+	Sacked        uint32
+	Lost          uint32
+	Retrans       uint32
+	Fackets       uint32
+	LastDataSent  uint32 // In milliseconds.
+	LastAckSent   uint32 // In milliseconds.
+	LastDataRecv  uint32 // In milliseconds.
+	LastAckRecv   uint32 // In milliseconds.
+	PMTU          uint32
+	RcvSsthresh   uint32
+	RTT           uint32
+	RTTVar        uint32
+	SndSsthresh   uint32
+	SndCwnd       uint32 // In segments.
+	AdvMSS        uint32
+	Reordering    uint32
+	RcvRTT        uint32
+	RcvSpace      uint32
+	TotalRetrans  uint32
+	PacingRate    uint64 // In bytes per second.
+	MaxPacingRate uint64 // In bytes per second.
+	BytesAcked    uint64
+	BytesReceived uint64
+	SegsOut       uint32
+	SegsIn        uint32
+	NotsentBytes  uint32
+	MinRTT        uint32
+	DataSegsIn    uint32
+	DataSegsOut   uint32
+	DeliveryRate  uint64 // In bytes per second.
+	BusyTime      uint64
+	RwndLimited   uint64
+	SndbufLimited uint64
+	Delivered     uint32
+	DeliveredCE   uint32
+	BytesSent     uint64
+	BytesRetrans  uint64
+	DSACKDups     uint32
+	ReordSeen     uint32
+	RcvOOOPack    uint32
+	SndWnd        uint32
+}
+
+// SmoothedRTT returns the smoothed round-trip time.
+func (i *TCPInfo) SmoothedRTT() time.Duration {
+	return time.Duration(i.RTT) * time.Microsecond
+}
+
+// MinimumRTT returns the lowest round-trip time seen, or zero if the kernel does not report it.
+func (i *TCPInfo) MinimumRTT() time.Duration {
+	return time.Duration(i.MinRTT) * time.Microsecond
+}
+
+// DeliveryRateBits returns the most recent estimate of the delivery rate, in bits per second.
+func (i *TCPInfo) DeliveryRateBits() float64 {
+	return 8 * float64(i.DeliveryRate)
+}
+
+// Socket is a socket listed by the kernel.
+type Socket struct {
+	Protocol   int
+	State      State
+	Local      Addr
+	Remote     Addr
+	Interface  int    // The index of the interface the socket is bound to, or zero.
+	UID        uint32 // The user owning the socket.
+	Inode      uint32
+	RecvQueue  uint32   // Bytes received but not yet read; for listening sockets, connections waiting to be accepted.
+	SendQueue  uint32   // Bytes sent but not yet acknowledged; for listening sockets, the backlog.
+	Congestion string   // The congestion control algorithm of TCP sockets.
+	Info       *TCPInfo // The TCP_INFO of TCP sockets, if it was requested.
+}
+
+// Filter selects which sockets List returns. The zero value selects every TCP socket, without TCP_INFO.
+type Filter struct {
+	Protocol int        // TCP or UDP, or TCP if zero.
+	States   []State    // Only sockets in these states, if any are given.
+	Prefix   *net.IPNet // Only sockets whose remote address is within this prefix, if set.
+	Port     int        // Only sockets with this local or remote port, if not zero.
+	Info     bool       // Request the TCP_INFO and congestion control algorithm of TCP sockets.
+}
+
+// protocol returns the protocol to list.
+func (f *Filter) protocol() int {
+	if f.Protocol == 0 {
+		return TCP
+	}
+	return f.Protocol
+}
+
+// stateMask returns the states to list as the bitmask the kernel expects.
+func (f *Filter) stateMask() uint32 {
+	if len(f.States) == 0 {
+		return 0xffffffff
+	}
+	var mask uint32
+	for _, s := range f.States {
+		mask |= 1 << s
+	}
+	return mask
+}
+
+// match reports whether the addresses of s are selected by the filter.
+func (f *Filter) match(s *Socket) bool {
+	if f.Prefix != nil && !f.Prefix.Contains(s.Remote.IP) {
+		return false
+	}
+	return f.Port == 0 || s.Local.Port == f.Port || s.Remote.Port == f.Port
+}
+
+// List returns the sockets selected by f, which may be nil, as ss does.
+func List(f *Filter) ([]Socket, error) {
+	if f == nil {
+		f = &Filter{}
+	}
+	if p := f.protocol(); p != TCP && p != UDP {
+		return nil, fmt.Errorf("unsupported protocol %d", p)
+	}
+	return list(f)
+}
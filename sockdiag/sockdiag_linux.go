@@ -0,0 +1,169 @@
+// +build linux
+
+package sockdiag
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Constants of the sock_diag netlink protocol not defined by the syscall package.
+const (
+	netlinkSockDiag   = 4
+	sockDiagByFamily  = 20
+	inetDiagInfo      = 2
+	inetDiagCong      = 4
+	inetDiagReqLen    = 56
+	inetDiagMsgLen    = 72
+	inetDiagSockIDLen = 48
+)
+
+// sizeofTCPInfo is the size of the TCP_INFO layout decoded, which the kernel may report less or more of.
+const sizeofTCPInfo = int(unsafe.Sizeof(TCPInfo{}))
+
+// list dumps the sockets of both families with sock_diag.
+func list(f *Filter) ([]Socket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkSockDiag)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	var sockets []Socket
+	for i, family := range []int{syscall.AF_INET, syscall.AF_INET6} {
+		seq := uint32(i + 1)
+		if err := syscall.Sendto(fd, request(f, family, seq), 0, sa); err != nil {
+			return nil, os.NewSyscallError("sendto", err)
+		}
+		if err := receive(fd, seq, func(m *syscall.NetlinkMessage) {
+			if s := parseSocket(f.protocol(), m.Data); s != nil && f.match(s) {
+				sockets = append(sockets, *s)
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return sockets, nil
+}
+
+// request builds a dump request for the sockets of one family.
+func request(f *Filter, family int, seq uint32) []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqLen)
+	*(*syscall.NlMsghdr)(unsafe.Pointer(&b[0])) = syscall.NlMsghdr{
+		Len:   uint32(len(b)),
+		Type:  sockDiagByFamily,
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP,
+		Seq:   seq,
+	}
+	req := b[syscall.NLMSG_HDRLEN:]
+	req[0] = byte(family)
+	req[1] = byte(f.protocol())
+	if f.Info && f.protocol() == TCP {
+		req[2] = 1<<(inetDiagInfo-1) | 1<<(inetDiagCong-1)
+	}
+	*(*uint32)(unsafe.Pointer(&req[4])) = f.stateMask()
+	return b
+}
+
+// receive reads the messages of a dump until it is done, calling fn for each socket.
+func receive(fd int, seq uint32, fn func(*syscall.NetlinkMessage)) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return os.NewSyscallError("recvfrom", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return os.NewSyscallError("parsenetlinkmessage", err)
+		}
+		for i := range msgs {
+			m := &msgs[i]
+			if m.Header.Seq != seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return errors.New("short netlink error")
+				}
+				if errno := syscall.Errno(-*(*int32)(unsafe.Pointer(&m.Data[0]))); errno != 0 {
+					return os.NewSyscallError("sock_diag", errno)
+				}
+				return nil
+			case sockDiagByFamily:
+				fn(m)
+			}
+		}
+	}
+}
+
+// parseSocket decodes an inet_diag_msg and its attributes.
+func parseSocket(protocol int, b []byte) *Socket {
+	if len(b) < inetDiagMsgLen {
+		return nil
+	}
+	family := b[0]
+	id := b[4 : 4+inetDiagSockIDLen]
+	s := &Socket{
+		Protocol:  protocol,
+		State:     State(b[1]),
+		Local:     Addr{IP: diagIP(family, id[4:20]), Port: int(binary.BigEndian.Uint16(id[0:2]))},
+		Remote:    Addr{IP: diagIP(family, id[20:36]), Port: int(binary.BigEndian.Uint16(id[2:4]))},
+		Interface: int(*(*uint32)(unsafe.Pointer(&id[36]))),
+		RecvQueue: *(*uint32)(unsafe.Pointer(&b[56])),
+		SendQueue: *(*uint32)(unsafe.Pointer(&b[60])),
+		UID:       *(*uint32)(unsafe.Pointer(&b[64])),
+		Inode:     *(*uint32)(unsafe.Pointer(&b[68])),
+	}
+
+	// The attributes follow the message, each aligned to four bytes.
+	for attrs := b[inetDiagMsgLen:]; len(attrs) >= syscall.SizeofRtAttr; {
+		attr := (*syscall.RtAttr)(unsafe.Pointer(&attrs[0]))
+		if int(attr.Len) < syscall.SizeofRtAttr || int(attr.Len) > len(attrs) {
+			break
+		}
+		value := attrs[syscall.SizeofRtAttr:attr.Len]
+		switch attr.Type {
+		case inetDiagInfo:
+			// Older kernels report less than the full layout, and newer ones more, so the value is copied into a
+			// buffer of the expected size, leaving missing fields zero.
+			buf := make([]byte, sizeofTCPInfo)
+			copy(buf, value)
+			info := *(*TCPInfo)(unsafe.Pointer(&buf[0]))
+			s.Info = &info
+		case inetDiagCong:
+			for i, c := range value {
+				if c == 0 {
+					value = value[:i]
+					break
+				}
+			}
+			s.Congestion = string(value)
+		}
+		next := (int(attr.Len) + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if next >= len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	return s
+}
+
+// diagIP decodes an address from a socket identifier, which is always 16 bytes long.
+func diagIP(family byte, b []byte) net.IP {
+	if family == syscall.AF_INET {
+		return append(net.IP(nil), b[:net.IPv4len]...)
+	}
+	return append(net.IP(nil), b[:net.IPv6len]...)
+}
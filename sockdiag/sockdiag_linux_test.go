@@ -0,0 +1,69 @@
+// +build linux
+
+package sockdiag
+
+import (
+	"net"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer conn.Close()
+	peer, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	defer peer.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	sockets, err := List(&Filter{Port: port, Info: true})
+	if err != nil {
+		t.Fatalf("list err: %v", err)
+	}
+	states := map[State]int{}
+	for _, s := range sockets {
+		states[s.State]++
+		if s.Info == nil || s.Info.SndCwnd == 0 || s.Congestion == "" {
+			t.Fatalf("socket %v -> %v: missing TCP_INFO or congestion control", s.Local, s.Remote)
+		}
+		if !s.Local.IP.Equal(net.IPv4(127, 0, 0, 1)) || s.Protocol != TCP {
+			t.Fatalf("socket %v -> %v: unexpected address or protocol %d", s.Local, s.Remote, s.Protocol)
+		}
+	}
+	if states[Listen] != 1 || states[Established] != 2 {
+		t.Fatalf("states: got %v, want one listening and two established", states)
+	}
+
+	sockets, err = List(&Filter{Port: port, States: []State{Listen}})
+	if err != nil {
+		t.Fatalf("list err: %v", err)
+	}
+	if len(sockets) != 1 || sockets[0].State != Listen || sockets[0].Info != nil {
+		t.Fatalf("listening: got %+v, want the listener without TCP_INFO", sockets)
+	}
+
+	pc, err := net.ListenPacket("udp", "[::1]:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer pc.Close()
+	sockets, err = List(&Filter{Protocol: UDP, Port: pc.LocalAddr().(*net.UDPAddr).Port})
+	if err != nil {
+		t.Fatalf("list err: %v", err)
+	}
+	if len(sockets) != 1 || sockets[0].State != Close || !sockets[0].Local.IP.Equal(net.IPv6loopback) {
+		t.Fatalf("udp: got %+v, want one unconnected socket on ::1", sockets)
+	}
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package sockdiag
+
+// list is only implemented on Linux, where sockets are listed with sock_diag.
+func list(*Filter) ([]Socket, error) {
+	return nil, ErrUnsupportedPlatform
+}
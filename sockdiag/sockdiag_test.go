@@ -0,0 +1,68 @@
+package sockdiag
+
+import (
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := map[string]struct {
+		value fmt.Stringer
+		want  string
+	}{
+		"Established": {Established, "ESTAB"},
+		"Close":       {Close, "UNCONN"},
+		"Unknown":     {State(42), "State(42)"},
+		"IPv4":        {Addr{IP: net.ParseIP("192.0.2.1").To4(), Port: 443}, "192.0.2.1:443"},
+		"IPv6":        {Addr{IP: net.ParseIP("2001:db8::1"), Port: 53}, "[2001:db8::1]:53"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, test.value.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	_, pfx, _ := net.ParseCIDR("192.0.2.0/24")
+	s := &Socket{
+		Local:  Addr{IP: net.ParseIP("198.51.100.1"), Port: 443},
+		Remote: Addr{IP: net.ParseIP("192.0.2.10"), Port: 50000},
+	}
+	_, other, _ := net.ParseCIDR("203.0.113.0/24")
+
+	tests := map[string]struct {
+		filter    Filter
+		want      bool
+		wantMask  uint32
+		wantProto int
+	}{
+		"Zero":        {filter: Filter{}, want: true, wantMask: 0xffffffff, wantProto: TCP},
+		"Prefix":      {filter: Filter{Prefix: pfx}, want: true, wantMask: 0xffffffff, wantProto: TCP},
+		"OtherPrefix": {filter: Filter{Prefix: other}, want: false, wantMask: 0xffffffff, wantProto: TCP},
+		"LocalPort":   {filter: Filter{Port: 443, Protocol: UDP}, want: true, wantMask: 0xffffffff, wantProto: UDP},
+		"RemotePort":  {filter: Filter{Port: 50000}, want: true, wantMask: 0xffffffff, wantProto: TCP},
+		"OtherPort":   {filter: Filter{Port: 80}, want: false, wantMask: 0xffffffff, wantProto: TCP},
+		"States": {
+			filter:    Filter{States: []State{Established, Listen}},
+			want:      true,
+			wantMask:  1<<1 | 1<<10,
+			wantProto: TCP,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := []interface{}{test.filter.match(s), test.filter.stateMask(), test.filter.protocol()}
+			want := []interface{}{test.want, test.wantMask, test.wantProto}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// ErrUnsupportedPlatform is returned on platforms where the options cannot be set.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// Options steer the traffic of a socket. The zero value changes nothing, and each field left zero is left as it is.
+type Options struct {
+	// The firewall mark (SO_MARK), which policy routing rules can match to select a routing table, and netfilter to
+	// classify traffic. Setting it requires CAP_NET_ADMIN.
+	Mark uint32
+	// The traffic class (IP_TOS or IPV6_TCLASS, depending on the family of the socket): the DSCP in the upper six
+	// bits, and ECN in the lower two, which the kernel manages itself for TCP.
+	TOS uint8
+	// The priority (SO_PRIORITY), which selects the queue of a multiqueue interface or the band of a priority
+	// queueing discipline. Priorities above 6 require CAP_NET_ADMIN.
+	Priority int
+	// The interface to bind to (SO_BINDTODEVICE), so that traffic is only sent and received through it. Binding to a
+	// VRF device instead uses the routing table of the VRF, as found with netif.Inventory.VRF.
+	Device string
+}
+
+// Control is suitable for use as a net.Dialer or net.ListenConfig Control function, and applies the options to the
+// socket before it connects or binds, which is required for Device to affect the choice of source address.
+func (o *Options) Control(network, address string, c syscall.RawConn) error {
+	var applyErr error
+	if err := c.Control(func(fd uintptr) {
+		applyErr = o.apply(int(fd))
+	}); err != nil {
+		return fmt.Errorf("rawConn control err: %w", err)
+	}
+	return applyErr
+}
+
+// Apply applies the options to an existing socket.
+func (o *Options) Apply(conn syscall.Conn) error {
+	if conn == nil {
+		return errors.New("nil conn")
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("rawConn err: %w", err)
+	}
+	return o.Control("", "", rawConn)
+}
+
+// zero reports whether the options change nothing.
+func (o *Options) zero() bool {
+	return *o == Options{}
+}
+
+// SetMark sets the firewall mark of a socket (SO_MARK).
+func SetMark(conn syscall.Conn, mark uint32) error {
+	return (&Options{Mark: mark}).Apply(conn)
+}
+
+// SetTOS sets the traffic class of a socket (IP_TOS or IPV6_TCLASS).
+func SetTOS(conn syscall.Conn, tos uint8) error {
+	return (&Options{TOS: tos}).Apply(conn)
+}
+
+// SetPriority sets the priority of a socket (SO_PRIORITY).
+func SetPriority(conn syscall.Conn, priority int) error {
+	return (&Options{Priority: priority}).Apply(conn)
+}
+
+// BindToDevice binds a socket to an interface or VRF device (SO_BINDTODEVICE).
+func BindToDevice(conn syscall.Conn, device string) error {
+	return (&Options{Device: device}).Apply(conn)
+}
+
+// Get retrieves the options currently set on a socket.
+func Get(conn syscall.Conn) (*Options, error) {
+	if conn == nil {
+		return nil, errors.New("nil conn")
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("rawConn err: %w", err)
+	}
+	var o *Options
+	var getErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		o, getErr = get(int(fd))
+	}); err != nil {
+		return nil, fmt.Errorf("rawConn control err: %w", err)
+	}
+	return o, getErr
+}
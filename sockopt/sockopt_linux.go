@@ -0,0 +1,113 @@
+// +build linux
+
+package sockopt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// soBindToIfIndex is SO_BINDTOIFINDEX, which is missing from syscall.
+const soBindToIfIndex = 0x3e
+
+// apply sets the options that are not zero on a socket.
+func (o *Options) apply(fd int) error {
+	if o.Mark != 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_MARK, int(o.Mark)); err != nil {
+			return fmt.Errorf("setsockopt SO_MARK: %w", err)
+		}
+	}
+	if o.TOS != 0 {
+		domain, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+		if err != nil {
+			return fmt.Errorf("getsockopt SO_DOMAIN: %w", err)
+		}
+		if domain == syscall.AF_INET6 {
+			if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, int(o.TOS)); err != nil {
+				return fmt.Errorf("setsockopt IPV6_TCLASS: %w", err)
+			}
+		}
+		// IPv6 sockets also use IP_TOS for IPv4 traffic sent to mapped addresses, so it is set on them too where the
+		// kernel allows it.
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS, int(o.TOS)); err != nil &&
+			domain != syscall.AF_INET6 {
+			return fmt.Errorf("setsockopt IP_TOS: %w", err)
+		}
+	}
+	if o.Priority != 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_PRIORITY, o.Priority); err != nil {
+			return fmt.Errorf("setsockopt SO_PRIORITY: %w", err)
+		}
+	}
+	if o.Device != "" {
+		if err := syscall.BindToDevice(fd, o.Device); err != nil {
+			return fmt.Errorf("setsockopt SO_BINDTODEVICE %s: %w", o.Device, err)
+		}
+	}
+	return nil
+}
+
+// get retrieves the options of a socket.
+func get(fd int) (*Options, error) {
+	o := &Options{}
+	mark, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_MARK)
+	if err != nil {
+		return nil, fmt.Errorf("getsockopt SO_MARK: %w", err)
+	}
+	o.Mark = uint32(mark)
+
+	domain, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+	if err != nil {
+		return nil, fmt.Errorf("getsockopt SO_DOMAIN: %w", err)
+	}
+	var tos int
+	if domain == syscall.AF_INET6 {
+		tos, err = syscall.GetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS)
+	} else {
+		tos, err = syscall.GetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getsockopt traffic class: %w", err)
+	}
+	o.TOS = uint8(tos)
+
+	if o.Priority, err = syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_PRIORITY); err != nil {
+		return nil, fmt.Errorf("getsockopt SO_PRIORITY: %w", err)
+	}
+
+	// The device is read by its index where the kernel allows it, which needs Linux 5.0, and otherwise by name.
+	index, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, soBindToIfIndex)
+	switch {
+	case errors.Is(err, syscall.ENOPROTOOPT):
+		if o.Device, err = boundDevice(fd); err != nil {
+			return nil, fmt.Errorf("getsockopt SO_BINDTODEVICE: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("getsockopt SO_BINDTOIFINDEX: %w", err)
+	case index != 0:
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil {
+			return nil, fmt.Errorf("bound device %d: %w", index, err)
+		}
+		o.Device = iface.Name
+	}
+	return o, nil
+}
+
+// boundDevice reads the name of the device a socket is bound to with SO_BINDTODEVICE. syscall has no wrapper for
+// reading a string option, so the name is read into the buffer of another that is at least IFNAMSIZ octets, as the
+// kernel requires.
+func boundDevice(fd int) (string, error) {
+	mreq, err := syscall.GetsockoptIPv6Mreq(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE)
+	if err != nil {
+		return "", err
+	}
+	name := mreq.Multiaddr[:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name), nil
+}
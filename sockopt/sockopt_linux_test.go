@@ -0,0 +1,117 @@
+// +build linux
+
+package sockopt
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	ctx := context.Background()
+	tests := map[string]struct {
+		network, address string
+		opts             Options
+	}{
+		"Zero": {network: "udp4", address: "127.0.0.1:0"},
+		"IPv4": {network: "udp4", address: "127.0.0.1:0", opts: Options{Mark: 7, TOS: 0xb8, Priority: 3}},
+		"IPv6": {network: "udp6", address: "[::1]:0", opts: Options{TOS: 0x20, Device: "lo"}},
+		"TCP":  {network: "tcp", address: "127.0.0.1:0", opts: Options{Mark: 0x100, Device: "lo"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			lc := net.ListenConfig{Control: test.opts.Control}
+			var conn syscall.Conn
+			if test.network == "tcp" {
+				ln, err := lc.Listen(ctx, test.network, test.address)
+				if err != nil {
+					skipPermission(t, err)
+					t.Fatalf("listen err: %v", err)
+				}
+				defer ln.Close()
+				conn = ln.(*net.TCPListener)
+			} else {
+				pc, err := lc.ListenPacket(ctx, test.network, test.address)
+				if err != nil {
+					skipPermission(t, err)
+					t.Fatalf("listen err: %v", err)
+				}
+				defer pc.Close()
+				conn = pc.(*net.UDPConn)
+			}
+
+			got, err := Get(conn)
+			if err != nil {
+				t.Fatalf("get err: %v", err)
+			}
+			if diff := cmp.Diff(test.opts, *got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestSetters(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer conn.Close()
+	if err := SetTOS(conn, 0x28); err != nil {
+		t.Fatalf("set tos err: %v", err)
+	}
+	if err := SetPriority(conn, 2); err != nil {
+		t.Fatalf("set priority err: %v", err)
+	}
+	if err := BindToDevice(conn, "no-such-device"); err == nil {
+		t.Fatalf("bind: got no error")
+	}
+	got, err := Get(conn)
+	if err != nil {
+		t.Fatalf("get err: %v", err)
+	}
+	if diff := cmp.Diff(Options{TOS: 0x28, Priority: 2}, *got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+// skipPermission skips the test if err is because the test lacks CAP_NET_ADMIN.
+func skipPermission(t *testing.T, err error) {
+	t.Helper()
+	if errors.Is(err, syscall.EPERM) {
+		t.Skipf("%v", err)
+	}
+}
+
+func TestBoundDevice(t *testing.T) {
+	// Kernels before 5.0 have no SO_BINDTOIFINDEX, so the device is read by name; test that directly.
+	for _, device := range []string{"", "lo"} {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer conn.Close()
+		if device != "" {
+			if err := BindToDevice(conn, device); err != nil {
+				skipPermission(t, err)
+				t.Fatalf("bind err: %v", err)
+			}
+		}
+		rawConn, err := conn.SyscallConn()
+		if err != nil {
+			t.Fatalf("raw conn err: %v", err)
+		}
+		var got string
+		if err := rawConn.Control(func(fd uintptr) { got, err = boundDevice(int(fd)) }); err != nil {
+			t.Fatalf("control err: %v", err)
+		}
+		if err != nil || got != device {
+			t.Fatalf("got device %q, err %v, want %q", got, err, device)
+		}
+	}
+}
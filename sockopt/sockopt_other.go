@@ -0,0 +1,16 @@
+// +build !linux
+
+package sockopt
+
+// apply is only implemented on Linux, so only options that change nothing can be applied elsewhere.
+func (o *Options) apply(fd int) error {
+	if o.zero() {
+		return nil
+	}
+	return ErrUnsupportedPlatform
+}
+
+// get is only implemented on Linux.
+func get(fd int) (*Options, error) {
+	return nil, ErrUnsupportedPlatform
+}
@@ -0,0 +1,48 @@
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/netif"
+	"net"
+)
+
+// Errors returned by CheckSource.
+var (
+	ErrFamilyMismatch = errors.New("source and destination address families differ")
+	ErrNotLocal       = errors.New("source address not assigned to this host")
+	ErrWrongDevice    = errors.New("source address not on device")
+)
+
+// CheckSource verifies that traffic to dst can be sent from src through device, either of which may be unset: that
+// src is of the same family as dst and is assigned to the host, and if device is set, that src is on it or, for a VRF
+// device, on one of its interfaces. Binding alone does not catch the last, as Linux accepts any local address on any
+// interface.
+func CheckSource(src, dst net.IP, device string) error {
+	if src == nil {
+		return nil
+	}
+	if (src.To4() == nil) != (dst.To4() == nil) {
+		return fmt.Errorf("%w: %v and %v", ErrFamilyMismatch, src, dst)
+	}
+	inv, err := netif.Load()
+	if err != nil {
+		return err
+	}
+	return checkSource(inv, src, device)
+}
+
+// checkSource does the work of CheckSource that depends on the interfaces of the host.
+func checkSource(inv *netif.Inventory, src net.IP, device string) error {
+	a := inv.Local(src)
+	if a == nil {
+		return fmt.Errorf("%w: %v", ErrNotLocal, src)
+	}
+	if device == "" || a.Interface == device {
+		return nil
+	}
+	if vrf := inv.VRF(a.Interface); vrf != nil && vrf.Name == device {
+		return nil
+	}
+	return fmt.Errorf("%w: %v is on %s, not %s", ErrWrongDevice, src, a.Interface, device)
+}
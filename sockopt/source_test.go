@@ -0,0 +1,57 @@
+package sockopt
+
+import (
+	"errors"
+	"github.com/dotwaffle/inettools/netif"
+	"net"
+	"testing"
+)
+
+func TestCheckSource(t *testing.T) {
+	ipNet := func(s string) *net.IPNet {
+		ip, pfx, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("parse err: %v", err)
+		}
+		pfx.IP = ip
+		return pfx
+	}
+	inv := &netif.Inventory{Interfaces: []netif.Interface{
+		{Index: 1, Name: "eth0", Addrs: []netif.Address{{Interface: "eth0", Index: 1, IPNet: ipNet("192.0.2.1/24")}}},
+		{Index: 2, Name: "eth1", Master: 3, Addrs: []netif.Address{
+			{Interface: "eth1", Index: 2, IPNet: ipNet("198.51.100.1/24")},
+		}},
+		{Index: 3, Name: "blue", Kind: "vrf"},
+	}}
+
+	tests := map[string]struct {
+		src     string
+		device  string
+		wantErr error
+	}{
+		"Local":       {src: "192.0.2.1"},
+		"OnDevice":    {src: "192.0.2.1", device: "eth0"},
+		"InVRF":       {src: "198.51.100.1", device: "blue"},
+		"NotLocal":    {src: "203.0.113.1", wantErr: ErrNotLocal},
+		"WrongDevice": {src: "192.0.2.1", device: "eth1", wantErr: ErrWrongDevice},
+		"WrongVRF":    {src: "192.0.2.1", device: "blue", wantErr: ErrWrongDevice},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := checkSource(inv, net.ParseIP(test.src), test.device); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+
+	if err := CheckSource(net.IPv4(127, 0, 0, 1), net.IPv6loopback, ""); !errors.Is(err, ErrFamilyMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrFamilyMismatch)
+	}
+	if err := CheckSource(nil, net.IPv6loopback, "eth0"); err != nil {
+		t.Fatalf("got %v, want no error without a source", err)
+	}
+	if err := CheckSource(net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2), ""); err != nil {
+		t.Fatalf("got %v, want loopback to be local", err)
+	}
+}
@@ -0,0 +1,211 @@
+package srv6
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Format is the structure of SRv6 SIDs, the lengths in bits of their fields, as advertised in the SID structure
+// sub-sub-TLV of RFC 9252. The locator is the block followed by the node; any bits after the argument are zero.
+type Format struct {
+	Block    int // The locator block, shared by the SIDs of a domain.
+	Node     int // The locator node, identifying a node within the block.
+	Function int
+	Argument int
+}
+
+// ErrFormat is returned for a format whose fields are too long.
+var ErrFormat = errors.New("invalid sid format")
+
+// ParseFormat parses a format as the lengths of the block, node, function and argument, separated by colons, such as
+// "32:16:16:0". The argument may be omitted, meaning zero.
+func ParseFormat(s string) (Format, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 3 {
+		parts = append(parts, "0")
+	}
+	if len(parts) != 4 {
+		return Format{}, fmt.Errorf("%w %q: want block:node:function[:argument]", ErrFormat, s)
+	}
+	var lens [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Format{}, fmt.Errorf("%w %q", ErrFormat, s)
+		}
+		lens[i] = n
+	}
+	f := Format{Block: lens[0], Node: lens[1], Function: lens[2], Argument: lens[3]}
+	return f, f.Validate()
+}
+
+func (f Format) String() string {
+	return fmt.Sprintf("%d:%d:%d:%d", f.Block, f.Node, f.Function, f.Argument)
+}
+
+// LocatorLen returns the length of the locator, the block and node.
+func (f Format) LocatorLen() int { return f.Block + f.Node }
+
+// Validate checks that the fields fit in an IPv6 address, and that the node, function and argument are at most 64 bits
+// long, so that they can be held in a uint64.
+func (f Format) Validate() error {
+	if f.Block < 0 || f.Node < 0 || f.Function < 0 || f.Argument < 0 {
+		return fmt.Errorf("%w %v: negative length", ErrFormat, f)
+	}
+	if f.Node > 64 || f.Function > 64 || f.Argument > 64 {
+		return fmt.Errorf("%w %v: node, function and argument must be at most 64 bits", ErrFormat, f)
+	}
+	if f.Block+f.Node+f.Function+f.Argument > 8*net.IPv6len {
+		return fmt.Errorf("%w %v: longer than 128 bits", ErrFormat, f)
+	}
+	return nil
+}
+
+// SID is an SRv6 SID split into its fields.
+type SID struct {
+	Block    *net.IPNet
+	Node     uint64
+	Function uint64
+	Argument uint64
+}
+
+// Locator returns the locator of a SID, the prefix of its block and node.
+func (s *SID) Locator(f Format) *net.IPNet {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, s.Block.IP.To16())
+	putBits(ip, f.Block, f.Node, s.Node)
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(f.LocatorLen(), 8*net.IPv6len)}
+}
+
+// Split splits a SID into its fields. The bits after the argument are ignored.
+func (f Format) Split(sid net.IP) (SID, error) {
+	if err := f.Validate(); err != nil {
+		return SID{}, err
+	}
+	ip := sid.To16()
+	if ip == nil || sid.To4() != nil {
+		return SID{}, fmt.Errorf("sid %v is not an ipv6 address", sid)
+	}
+	mask := net.CIDRMask(f.Block, 8*net.IPv6len)
+	off := f.Block
+	s := SID{Block: &net.IPNet{IP: ip.Mask(mask), Mask: mask}}
+	s.Node, off = getBits(ip, off, f.Node), off+f.Node
+	s.Function, off = getBits(ip, off, f.Function), off+f.Function
+	s.Argument = getBits(ip, off, f.Argument)
+	return s, nil
+}
+
+// SID returns the SID of a function and argument at a locator, which must be of the format's locator length.
+func (f Format) SID(locator *net.IPNet, function, argument uint64) (net.IP, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if ones, bits := locator.Mask.Size(); ones != f.LocatorLen() || bits != 8*net.IPv6len {
+		return nil, fmt.Errorf("locator %v is not an ipv6 /%d", locator, f.LocatorLen())
+	}
+	if !fits(function, f.Function) || !fits(argument, f.Argument) {
+		return nil, fmt.Errorf("function %d or argument %d too long for format %v", function, argument, f)
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, locator.IP.Mask(locator.Mask))
+	putBits(ip, f.LocatorLen(), f.Function, function)
+	putBits(ip, f.LocatorLen()+f.Function, f.Argument, argument)
+	return ip, nil
+}
+
+// NextCSID returns the destination following a SID holding a container of compressed SIDs, as the End behaviour with
+// the NEXT-CSID flavour of RFC 9800 computes it: the compressed SIDs after the block, each of the node and function
+// lengths, are shifted to consume the active one. It returns false if no compressed SIDs remain, so that the next SID
+// is taken from the segment routing header.
+func (f Format) NextCSID(sid net.IP) (net.IP, bool) {
+	ip := sid.To16()
+	l := f.Node + f.Function
+	if ip == nil || l == 0 || f.Block+2*l > 8*net.IPv6len {
+		return nil, false
+	}
+	next := make(net.IP, net.IPv6len)
+	copy(next, ip)
+	for i := f.Block; i < 8*net.IPv6len; i++ {
+		var bit uint64
+		if i+l < 8*net.IPv6len {
+			bit = getBits(ip, i+l, 1)
+		}
+		putBits(next, i, 1, bit)
+	}
+	if isZero(next, f.Block, l) {
+		return nil, false
+	}
+	return next, true
+}
+
+// PackCSIDs returns the segment list carrying compressed SIDs of the node and function lengths in the NEXT-CSID
+// flavour, in the order they are visited: the SIDs are packed into as few containers at a block as they fit, each the
+// block followed by as many compressed SIDs as fit in the rest of an address. Compressed SIDs must not be zero, as zero
+// marks the end of a container.
+func (f Format) PackCSIDs(block *net.IPNet, csids []uint64) ([]net.IP, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if ones, bits := block.Mask.Size(); ones != f.Block || bits != 8*net.IPv6len {
+		return nil, fmt.Errorf("block %v is not an ipv6 /%d", block, f.Block)
+	}
+	l := f.Node + f.Function
+	perContainer := 0
+	if l > 0 {
+		perContainer = (8*net.IPv6len - f.Block) / l
+	}
+	if perContainer == 0 {
+		return nil, fmt.Errorf("no compressed sids fit in a container of format %v", f)
+	}
+	var containers []net.IP
+	for i, csid := range csids {
+		if csid == 0 || !fits(csid, l) {
+			return nil, fmt.Errorf("invalid compressed sid %d for format %v", csid, f)
+		}
+		if i%perContainer == 0 {
+			ip := make(net.IP, net.IPv6len)
+			copy(ip, block.IP.Mask(block.Mask))
+			containers = append(containers, ip)
+		}
+		putBits(containers[len(containers)-1], f.Block+i%perContainer*l, l, csid)
+	}
+	return containers, nil
+}
+
+// fits returns whether v can be held in n bits.
+func fits(v uint64, n int) bool { return n >= 64 || v>>uint(n) == 0 }
+
+// getBits returns the n bits of ip starting at bit off, counting from the most significant.
+func getBits(ip net.IP, off, n int) uint64 {
+	var v uint64
+	for i := off; i < off+n; i++ {
+		v = v<<1 | uint64(ip[i/8]>>(7-uint(i%8))&1)
+	}
+	return v
+}
+
+// putBits sets the n bits of ip starting at bit off to the least significant n bits of v.
+func putBits(ip net.IP, off, n int, v uint64) {
+	for i := off + n - 1; i >= off; i-- {
+		mask := byte(1) << (7 - uint(i%8))
+		if v&1 != 0 {
+			ip[i/8] |= mask
+		} else {
+			ip[i/8] &^= mask
+		}
+		v >>= 1
+	}
+}
+
+// isZero returns whether the n bits of ip starting at bit off are all zero.
+func isZero(ip net.IP, off, n int) bool {
+	for i := off; i < off+n; i++ {
+		if ip[i/8]>>(7-uint(i%8))&1 != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package srv6
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		"Full":         {in: "32:16:16:0", want: Format{Block: 32, Node: 16, Function: 16}},
+		"NoArgument":   {in: "40:24:16", want: Format{Block: 40, Node: 24, Function: 16}},
+		"Argument":     {in: "48:16:16:8", want: Format{Block: 48, Node: 16, Function: 16, Argument: 8}},
+		"TooLong":      {in: "64:32:32:8", wantErr: true},
+		"LongFunction": {in: "32:0:65:0", wantErr: true},
+		"Negative":     {in: "32:-16:16:0", wantErr: true},
+		"Fields":       {in: "32:16", wantErr: true},
+		"NotNumber":    {in: "32:16:x:0", wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseFormat(test.in)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got err %v", err)
+			}
+			if err != nil && !errors.Is(err, ErrFormat) {
+				t.Fatalf("got err %v, want ErrFormat", err)
+			}
+			if diff := cmp.Diff(test.want, got); !test.wantErr && diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+	if got := (Format{Block: 32, Node: 16, Function: 16}).String(); got != "32:16:16:0" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestSID(t *testing.T) {
+	f := Format{Block: 40, Node: 24, Function: 16, Argument: 8}
+	sid := net.ParseIP("2001:db8:aa:1234:56e0:1200::")
+	got, err := f.Split(sid)
+	if err != nil {
+		t.Fatalf("split err: %v", err)
+	}
+	want := SID{Block: mustCIDR("2001:db8::/40"), Node: 0xaa1234, Function: 0x56e0, Argument: 0x12}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if loc := got.Locator(f); loc.String() != "2001:db8:aa:1234::/64" {
+		t.Fatalf("got locator %v", loc)
+	}
+
+	built, err := f.SID(got.Locator(f), 0x56e0, 0x34)
+	if err != nil {
+		t.Fatalf("sid err: %v", err)
+	}
+	if want := net.ParseIP("2001:db8:aa:1234:56e0:3400::"); !built.Equal(want) {
+		t.Fatalf("got sid %v, want %v", built, want)
+	}
+	if back, _ := f.Split(built); back.Argument != 0x34 || back.Function != 0x56e0 {
+		t.Fatalf("split %v to %+v", built, back)
+	}
+
+	if _, err := f.SID(mustCIDR("2001:db8::/48"), 1, 0); err == nil {
+		t.Fatalf("built a sid at a locator of the wrong length")
+	}
+	if _, err := f.SID(got.Locator(f), 0x10000, 0); err == nil {
+		t.Fatalf("built a sid with a function too long")
+	}
+	if _, err := f.Split(net.ParseIP("192.0.2.1")); err == nil {
+		t.Fatalf("split an ipv4 address")
+	}
+}
+
+func TestCSID(t *testing.T) {
+	// The NEXT-CSID flavour with a 32-bit block and 16-bit compressed SIDs, of a 16-bit node and no function.
+	f := Format{Block: 32, Node: 16}
+	block := mustCIDR("fc00:0::/32")
+	containers, err := f.PackCSIDs(block, []uint64{0x100, 0x200, 0x300, 0x400, 0x500, 0x600, 0x700})
+	if err != nil {
+		t.Fatalf("pack err: %v", err)
+	}
+	want := []net.IP{net.ParseIP("fc00:0:100:200:300:400:500:600"), net.ParseIP("fc00:0:700::")}
+	if diff := cmp.Diff(want, containers); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	var visited []string
+	for dst, ok := containers[0], true; ok; dst, ok = f.NextCSID(dst) {
+		visited = append(visited, dst.String())
+	}
+	wantVisited := []string{"fc00:0:100:200:300:400:500:600", "fc00:0:200:300:400:500:600:0",
+		"fc00:0:300:400:500:600::", "fc00:0:400:500:600::", "fc00:0:500:600::", "fc00:0:600::"}
+	if diff := cmp.Diff(wantVisited, visited); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	if _, err := f.PackCSIDs(block, []uint64{0}); err == nil {
+		t.Fatalf("packed a zero compressed sid")
+	}
+	if _, err := f.PackCSIDs(block, []uint64{0x10000}); err == nil {
+		t.Fatalf("packed a compressed sid too long")
+	}
+	if _, err := f.PackCSIDs(mustCIDR("fc00::/16"), []uint64{1}); err == nil {
+		t.Fatalf("packed at a block of the wrong length")
+	}
+}
@@ -0,0 +1,282 @@
+package stun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Defaults used by a Client whose fields are not set.
+const (
+	DefaultPort    = "3478"
+	DefaultRTO     = 500 * time.Millisecond
+	DefaultRetries = 2
+)
+
+// Errors returned by a Client.
+var (
+	ErrNoResponse     = errors.New("no response")
+	ErrNoOtherAddress = errors.New("server does not support nat behaviour discovery")
+)
+
+// Behavior is how a NAT maps or filters, as classified by RFC 4787.
+type Behavior string
+
+// Behaviours of NATs, from the most permissive.
+const (
+	// The same mapping is used, or packets are accepted, whatever the remote address and port.
+	EndpointIndependent Behavior = "endpoint-independent"
+	// A different mapping is used for, or packets are only accepted from, each remote address.
+	AddressDependent Behavior = "address-dependent"
+	// A different mapping is used for, or packets are only accepted from, each remote address and port.
+	AddressAndPortDependent Behavior = "address-and-port-dependent"
+)
+
+// NAT describes the NAT between a socket and a STUN server, as discovered by Client.Discover.
+type NAT struct {
+	Local     *net.UDPAddr // The address of the socket.
+	Mapped    *net.UDPAddr // The address the server saw requests come from.
+	Mapping   Behavior     // How the NAT maps, or empty if it could not be discovered.
+	Filtering Behavior     // How the NAT filters, or empty if it could not be discovered.
+}
+
+// Translated reports whether there is a NAT, which is to say the server saw a different address than the socket's.
+func (n *NAT) Translated() bool {
+	return !n.Local.IP.Equal(n.Mapped.IP) || n.Local.Port != n.Mapped.Port
+}
+
+// Traversable reports whether peers behind NATs like this can reach each other by UDP hole punching, which is when
+// mapping is endpoint-independent, so that the address learned from the server is the one peers see.
+func (n *NAT) Traversable() bool {
+	return n.Mapping == EndpointIndependent
+}
+
+// Client is a STUN client. The zero value is not usable, as it needs a server.
+type Client struct {
+	Server string // The host and port of the server; the port defaults to DefaultPort.
+	// The socket to send from, so that the address discovered is its mapping, as needed for hole punching, or nil to
+	// use a new socket for each call. Only the responses to the client's requests are read from it while it is used.
+	Conn    net.PacketConn
+	RTO     time.Duration // The wait before the first retransmission, or DefaultRTO if zero; it doubles after each.
+	Retries int           // The number of retransmissions, or DefaultRetries if zero.
+}
+
+// Bind returns the address the server sees the socket as, its public address if it is behind a NAT.
+func (c *Client) Bind(ctx context.Context) (*net.UDPAddr, error) {
+	server, err := c.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.conn(server)
+	if err != nil {
+		return nil, err
+	}
+	if c.Conn == nil {
+		defer conn.Close()
+	}
+	resp, err := c.roundTrip(ctx, conn, NewBindingRequest(), server)
+	if err != nil {
+		return nil, err
+	}
+	return resp.MappedAddress()
+}
+
+// Discover classifies the mapping and filtering behaviour of the NAT between the socket and the server, using the
+// tests of RFC 5780, which needs a server with a second address that supports them. Servers that do not return the
+// mapped address with ErrNoOtherAddress. Tests are retransmitted, so failing ones take the full retransmission time.
+func (c *Client) Discover(ctx context.Context) (*NAT, error) {
+	server, err := c.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.conn(server)
+	if err != nil {
+		return nil, err
+	}
+	if c.Conn == nil {
+		defer conn.Close()
+	}
+	nat := &NAT{Local: localAddr(conn, server)}
+
+	// Test I: the mapping to the server's primary address.
+	resp, err := c.roundTrip(ctx, conn, NewBindingRequest(), server)
+	if err != nil {
+		return nil, err
+	}
+	if nat.Mapped, err = resp.MappedAddress(); err != nil {
+		return nil, err
+	}
+	other, err := resp.Address(AttrOtherAddress)
+	if errors.Is(err, ErrNoAttribute) {
+		return nat, ErrNoOtherAddress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Mapping test II: the mapping to the other address with the primary port, and III: to the other address and port.
+	if !nat.Translated() {
+		nat.Mapping = EndpointIndependent
+	} else {
+		mapped2, err := c.mapped(ctx, conn, &net.UDPAddr{IP: other.IP, Port: server.Port})
+		if err != nil {
+			return nil, err
+		}
+		if equal(mapped2, nat.Mapped) {
+			nat.Mapping = EndpointIndependent
+		} else {
+			mapped3, err := c.mapped(ctx, conn, other)
+			if err != nil {
+				return nil, err
+			}
+			nat.Mapping = AddressAndPortDependent
+			if equal(mapped3, mapped2) {
+				nat.Mapping = AddressDependent
+			}
+		}
+	}
+
+	// Filtering test II: whether a response from the other address and port arrives, and III: from the other port. They
+	// use a new socket, as the mapping tests have let responses from the other address through the NAT.
+	fconn, err := listen(server)
+	if err != nil {
+		return nil, err
+	}
+	defer fconn.Close()
+	for _, test := range []struct {
+		change   byte
+		behavior Behavior
+	}{{ChangeIP | ChangePort, EndpointIndependent}, {ChangePort, AddressDependent}} {
+		req := NewBindingRequest()
+		req.Add(AttrChangeRequest, []byte{0, 0, 0, test.change})
+		_, err := c.roundTrip(ctx, fconn, req, server)
+		if err == nil {
+			nat.Filtering = test.behavior
+			return nat, nil
+		}
+		if !errors.Is(err, ErrNoResponse) {
+			return nil, err
+		}
+	}
+	nat.Filtering = AddressAndPortDependent
+	return nat, nil
+}
+
+// mapped returns the mapped address seen by a server at addr.
+func (c *Client) mapped(ctx context.Context, conn net.PacketConn, addr *net.UDPAddr) (*net.UDPAddr, error) {
+	resp, err := c.roundTrip(ctx, conn, NewBindingRequest(), addr)
+	if err != nil {
+		return nil, err
+	}
+	return resp.MappedAddress()
+}
+
+// resolve returns the address of the server.
+func (c *Client) resolve(ctx context.Context) (*net.UDPAddr, error) {
+	host, port, err := net.SplitHostPort(c.Server)
+	if err != nil {
+		host, port = c.Server, DefaultPort
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address for %s", host)
+	}
+	p, err := net.DefaultResolver.LookupPort(ctx, "udp", port)
+	if err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: addrs[0].IP, Port: p, Zone: addrs[0].Zone}, nil
+}
+
+// conn returns the socket to send from: the client's, or a new one.
+func (c *Client) conn(server *net.UDPAddr) (net.PacketConn, error) {
+	if c.Conn != nil {
+		return c.Conn, nil
+	}
+	return listen(server)
+}
+
+// listen returns a new socket of the server's family.
+func listen(server *net.UDPAddr) (net.PacketConn, error) {
+	network := "udp4"
+	if server.IP.To4() == nil {
+		network = "udp6"
+	}
+	return net.ListenPacket(network, ":0")
+}
+
+// localAddr returns the address of a socket, with the source address the host would use to reach the server if it
+// is bound to the unspecified address.
+func localAddr(conn net.PacketConn, server *net.UDPAddr) *net.UDPAddr {
+	local, _ := conn.LocalAddr().(*net.UDPAddr)
+	if local == nil {
+		return &net.UDPAddr{}
+	}
+	local = &net.UDPAddr{IP: local.IP, Port: local.Port, Zone: local.Zone}
+	if local.IP == nil || local.IP.IsUnspecified() {
+		if probe, err := net.DialUDP("udp", nil, server); err == nil {
+			local.IP = probe.LocalAddr().(*net.UDPAddr).IP
+			probe.Close()
+		}
+	}
+	return local
+}
+
+// roundTrip sends a request to an address, retransmitting it until a response with the same transaction ID arrives
+// from any address.
+func (c *Client) roundTrip(ctx context.Context, pc net.PacketConn, req *Message, to *net.UDPAddr) (*Message, error) {
+	rto, retries := c.RTO, c.Retries
+	if rto <= 0 {
+		rto = DefaultRTO
+	}
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+	defer pc.SetReadDeadline(time.Time{})
+
+	b := req.Marshal()
+	buf := make([]byte, 1500)
+	for i := 0; i <= retries; i++ {
+		if _, err := pc.WriteTo(b, to); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(rto << i)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		pc.SetReadDeadline(deadline)
+		for {
+			n, _, err := pc.ReadFrom(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			resp, err := Unmarshal(buf[:n])
+			if err != nil || !bytes.Equal(resp.TransactionID[:], req.TransactionID[:]) {
+				continue
+			}
+			if resp.Type == TypeBindingError {
+				code, reason := resp.ErrorCode()
+				return nil, fmt.Errorf("stun error %d: %s", code, reason)
+			}
+			return resp, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w from %v", ErrNoResponse, to)
+}
+
+// equal reports whether two addresses are the same.
+func equal(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
@@ -0,0 +1,226 @@
+package stun
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is a STUN server with two addresses and two ports, behind which sits a simulated NAT: it returns mapped
+// addresses as the NAT would have, and drops responses the NAT would have filtered.
+type fakeServer struct {
+	mapping   Behavior // How the NAT maps, or empty for no NAT.
+	filtering Behavior
+	noOther   bool // Whether to leave out OTHER-ADDRESS.
+	conns     [2][2]*net.UDPConn
+
+	mu sync.Mutex
+	// The addresses, and addresses and ports, sent to through each mapping.
+	sent map[string]map[string]bool
+}
+
+func newFakeServer(t *testing.T, mapping, filtering Behavior, noOther bool) *fakeServer {
+	s := &fakeServer{mapping: mapping, filtering: filtering, noOther: noOther, sent: map[string]map[string]bool{}}
+	ports := [2]int{}
+	for i, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+		for j := range ports {
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP(ip), Port: ports[j]})
+			if err != nil {
+				t.Fatalf("listen err: %v", err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			ports[j] = conn.LocalAddr().(*net.UDPAddr).Port
+			s.conns[i][j] = conn
+		}
+	}
+	for i := range s.conns {
+		for j := range s.conns[i] {
+			go s.serve(i, j)
+		}
+	}
+	return s
+}
+
+// addr returns the address of the primary socket.
+func (s *fakeServer) addr() string {
+	return s.conns[0][0].LocalAddr().String()
+}
+
+func (s *fakeServer) serve(i, j int) {
+	buf := make([]byte, 1500)
+	for {
+		n, src, err := s.conns[i][j].ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req, err := Unmarshal(buf[:n])
+		if err != nil || req.Type != TypeBindingRequest {
+			continue
+		}
+
+		mapped := src
+		if s.mapping != "" {
+			// The NAT maps to a different public address for each destination it depends on.
+			last := 1
+			switch s.mapping {
+			case AddressDependent:
+				last += i
+			case AddressAndPortDependent:
+				last += 2*i + j
+			}
+			mapped = &net.UDPAddr{IP: net.IPv4(192, 0, 2, byte(last)), Port: src.Port}
+		}
+		ri, rj := i, j
+		if v, ok := req.Get(AttrChangeRequest); ok && len(v) == 4 {
+			if v[3]&ChangeIP != 0 {
+				ri ^= 1
+			}
+			if v[3]&ChangePort != 0 {
+				rj ^= 1
+			}
+		}
+		if !s.permit(mapped, s.conns[i][j], s.conns[ri][rj]) {
+			continue
+		}
+
+		resp := &Message{Type: TypeBindingResponse, TransactionID: req.TransactionID}
+		resp.AddAddress(AttrXORMappedAddress, mapped)
+		if !s.noOther {
+			resp.AddAddress(AttrOtherAddress, s.conns[i^1][j^1].LocalAddr().(*net.UDPAddr))
+		}
+		s.conns[ri][rj].WriteToUDP(resp.Marshal(), src)
+	}
+}
+
+// permit records that a mapping sent to a socket, and reports whether the NAT lets through a response from another.
+func (s *fakeServer) permit(mapped *net.UDPAddr, to, from *net.UDPConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent := s.sent[mapped.String()]
+	if sent == nil {
+		sent = map[string]bool{}
+		s.sent[mapped.String()] = sent
+	}
+	dst, src := to.LocalAddr().(*net.UDPAddr), from.LocalAddr().(*net.UDPAddr)
+	sent[dst.IP.String()], sent[dst.String()] = true, true
+	switch s.filtering {
+	case AddressDependent:
+		return s.mapping == "" || sent[src.IP.String()]
+	case AddressAndPortDependent:
+		return s.mapping == "" || sent[src.String()]
+	}
+	return true
+}
+
+func TestDiscover(t *testing.T) {
+	tests := map[string]struct {
+		mapping, filtering Behavior
+		noOther            bool
+		want               *NAT
+		wantErr            error
+	}{
+		"NoNAT": {
+			filtering: AddressAndPortDependent,
+			want:      &NAT{Mapping: EndpointIndependent, Filtering: EndpointIndependent},
+		},
+		"FullCone": {
+			mapping:   EndpointIndependent,
+			filtering: EndpointIndependent,
+			want:      &NAT{Mapping: EndpointIndependent, Filtering: EndpointIndependent},
+		},
+		"RestrictedCone": {
+			mapping:   EndpointIndependent,
+			filtering: AddressDependent,
+			want:      &NAT{Mapping: EndpointIndependent, Filtering: AddressDependent},
+		},
+		"PortRestrictedCone": {
+			mapping:   EndpointIndependent,
+			filtering: AddressAndPortDependent,
+			want:      &NAT{Mapping: EndpointIndependent, Filtering: AddressAndPortDependent},
+		},
+		"AddressDependent": {
+			mapping:   AddressDependent,
+			filtering: AddressDependent,
+			want:      &NAT{Mapping: AddressDependent, Filtering: AddressDependent},
+		},
+		"Symmetric": {
+			mapping:   AddressAndPortDependent,
+			filtering: AddressAndPortDependent,
+			want:      &NAT{Mapping: AddressAndPortDependent, Filtering: AddressAndPortDependent},
+		},
+		"NoOtherAddress": {
+			mapping:   EndpointIndependent,
+			filtering: EndpointIndependent,
+			noOther:   true,
+			want:      &NAT{},
+			wantErr:   ErrNoOtherAddress,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newFakeServer(t, test.mapping, test.filtering, test.noOther)
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("listen err: %v", err)
+			}
+			defer conn.Close()
+			c := &Client{Server: s.addr(), Conn: conn, RTO: 20 * time.Millisecond, Retries: 1}
+
+			got, err := c.Discover(context.Background())
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got err %v, want %v", err, test.wantErr)
+			}
+			local := conn.LocalAddr().(*net.UDPAddr)
+			if diff := cmp.Diff(local.String(), got.Local.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+			if got.Translated() != (test.mapping != "") {
+				t.Fatalf("got translated %v, want %v", got.Translated(), test.mapping != "")
+			}
+			test.want.Local, test.want.Mapped = got.Local, got.Mapped
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	s := newFakeServer(t, EndpointIndependent, EndpointIndependent, false)
+	c := &Client{Server: s.addr(), RTO: 20 * time.Millisecond}
+	got, err := c.Bind(context.Background())
+	if err != nil {
+		t.Fatalf("bind err: %v", err)
+	}
+	if !got.IP.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Fatalf("got %v, want 192.0.2.1", got)
+	}
+}
+
+func TestBindNoResponse(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer conn.Close()
+	c := &Client{Server: conn.LocalAddr().String(), RTO: 10 * time.Millisecond, Retries: 1}
+	if _, err := c.Bind(context.Background()); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("got err %v, want %v", err, ErrNoResponse)
+	}
+}
+
+func TestResolveDefaultPort(t *testing.T) {
+	c := &Client{Server: "127.0.0.1"}
+	got, err := c.resolve(context.Background())
+	if err != nil {
+		t.Fatalf("resolve err: %v", err)
+	}
+	if diff := cmp.Diff("127.0.0.1:"+DefaultPort, got.String()); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
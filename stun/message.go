@@ -0,0 +1,216 @@
+package stun
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// MagicCookie is the fixed value in every STUN message, which distinguishes RFC 5389 and later messages from those
+// of RFC 3489, and is XORed with the addresses of XOR-MAPPED-ADDRESS.
+const MagicCookie = 0x2112a442
+
+// headerLen is the length of a message header.
+const headerLen = 20
+
+// Message types.
+const (
+	TypeBindingRequest  = 0x0001
+	TypeBindingResponse = 0x0101
+	TypeBindingError    = 0x0111
+)
+
+// Attribute types, from RFC 8489 and the NAT behaviour discovery attributes of RFC 5780.
+const (
+	AttrMappedAddress    = 0x0001
+	AttrChangeRequest    = 0x0003
+	AttrErrorCode        = 0x0009
+	AttrXORMappedAddress = 0x0020
+	AttrResponsePort     = 0x0027
+	AttrSoftware         = 0x8022
+	AttrFingerprint      = 0x8028
+	AttrResponseOrigin   = 0x802b
+	AttrOtherAddress     = 0x802c
+)
+
+// Flags of CHANGE-REQUEST, asking the server to respond from its other address or port.
+const (
+	ChangeIP   = 0x04
+	ChangePort = 0x02
+)
+
+// Errors returned while decoding messages.
+var (
+	ErrNotSTUN       = errors.New("not a stun message")
+	ErrNoAttribute   = errors.New("attribute not present")
+	ErrInvalidFamily = errors.New("invalid address family")
+)
+
+// Message is a STUN message.
+type Message struct {
+	Type          uint16
+	TransactionID [12]byte
+	Attributes    []Attribute
+}
+
+// Attribute is an attribute of a message.
+type Attribute struct {
+	Type  uint16
+	Value []byte
+}
+
+// NewBindingRequest returns a binding request with a random transaction ID.
+func NewBindingRequest() *Message {
+	m := &Message{Type: TypeBindingRequest}
+	rand.Read(m.TransactionID[:])
+	return m
+}
+
+// Marshal encodes the message.
+func (m *Message) Marshal() []byte {
+	b := make([]byte, headerLen, 128)
+	binary.BigEndian.PutUint16(b, m.Type)
+	binary.BigEndian.PutUint32(b[4:], MagicCookie)
+	copy(b[8:], m.TransactionID[:])
+	for _, attr := range m.Attributes {
+		var h [4]byte
+		binary.BigEndian.PutUint16(h[:], attr.Type)
+		binary.BigEndian.PutUint16(h[2:], uint16(len(attr.Value)))
+		b = append(b, h[:]...)
+		b = append(b, attr.Value...)
+		// Attributes are padded to a multiple of four octets.
+		b = append(b, make([]byte, (4-len(attr.Value)%4)%4)...)
+	}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)-headerLen))
+	return b
+}
+
+// Unmarshal decodes a message.
+func Unmarshal(b []byte) (*Message, error) {
+	if len(b) < headerLen || b[0]&0xc0 != 0 || binary.BigEndian.Uint32(b[4:]) != MagicCookie {
+		return nil, ErrNotSTUN
+	}
+	l := int(binary.BigEndian.Uint16(b[2:]))
+	if l%4 != 0 || headerLen+l > len(b) {
+		return nil, fmt.Errorf("invalid stun message length %d for %d byte buffer", l, len(b))
+	}
+	m := &Message{Type: binary.BigEndian.Uint16(b)}
+	copy(m.TransactionID[:], b[8:headerLen])
+	attrs := b[headerLen : headerLen+l]
+	for len(attrs) > 0 {
+		if len(attrs) < 4 {
+			return nil, errors.New("stun attribute truncated")
+		}
+		t, al := binary.BigEndian.Uint16(attrs), int(binary.BigEndian.Uint16(attrs[2:]))
+		padded := 4 + (al+3)/4*4
+		if padded > len(attrs) {
+			return nil, fmt.Errorf("invalid length %d for stun attribute %#04x", al, t)
+		}
+		m.Attributes = append(m.Attributes, Attribute{Type: t, Value: attrs[4 : 4+al]})
+		attrs = attrs[padded:]
+	}
+	return m, nil
+}
+
+// Get returns the value of the first attribute of a type.
+func (m *Message) Get(t uint16) ([]byte, bool) {
+	for _, attr := range m.Attributes {
+		if attr.Type == t {
+			return attr.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Add appends an attribute.
+func (m *Message) Add(t uint16, value []byte) {
+	m.Attributes = append(m.Attributes, Attribute{Type: t, Value: value})
+}
+
+// AddAddress appends an address attribute, XORed if it is XOR-MAPPED-ADDRESS.
+func (m *Message) AddAddress(t uint16, addr *net.UDPAddr) {
+	m.Add(t, m.encodeAddress(addr, t == AttrXORMappedAddress))
+}
+
+// Address returns the address held by an attribute, such as OTHER-ADDRESS. XOR-MAPPED-ADDRESS is un-XORed.
+func (m *Message) Address(t uint16) (*net.UDPAddr, error) {
+	v, ok := m.Get(t)
+	if !ok {
+		return nil, fmt.Errorf("%w: %#04x", ErrNoAttribute, t)
+	}
+	return m.decodeAddress(v, t == AttrXORMappedAddress)
+}
+
+// MappedAddress returns the address the server saw the request come from: XOR-MAPPED-ADDRESS, or MAPPED-ADDRESS from
+// servers that predate it.
+func (m *Message) MappedAddress() (*net.UDPAddr, error) {
+	addr, err := m.Address(AttrXORMappedAddress)
+	if errors.Is(err, ErrNoAttribute) {
+		return m.Address(AttrMappedAddress)
+	}
+	return addr, err
+}
+
+// ErrorCode returns the code and reason of an error response, or zero if it has none.
+func (m *Message) ErrorCode() (int, string) {
+	v, ok := m.Get(AttrErrorCode)
+	if !ok || len(v) < 4 {
+		return 0, ""
+	}
+	return int(v[2]&0x7)*100 + int(v[3]), string(v[4:])
+}
+
+// xor XORs a port followed by an address in place: the port with the top of the magic cookie, and the address with
+// the magic cookie followed by the transaction ID.
+func (m *Message) xor(b []byte) {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint32(key, MagicCookie)
+	copy(key[4:], m.TransactionID[:])
+	b[0] ^= key[0]
+	b[1] ^= key[1]
+	for i := range b[2:] {
+		b[2+i] ^= key[i]
+	}
+}
+
+// encodeAddress encodes an address attribute value.
+func (m *Message) encodeAddress(addr *net.UDPAddr, xor bool) []byte {
+	ip, family := addr.IP.To4(), byte(1)
+	if ip == nil {
+		ip, family = addr.IP.To16(), 2
+	}
+	v := make([]byte, 4+len(ip))
+	v[1] = family
+	binary.BigEndian.PutUint16(v[2:], uint16(addr.Port))
+	copy(v[4:], ip)
+	if xor {
+		m.xor(v[2:])
+	}
+	return v
+}
+
+// decodeAddress decodes an address attribute value.
+func (m *Message) decodeAddress(v []byte, xor bool) (*net.UDPAddr, error) {
+	if len(v) < 4 {
+		return nil, errors.New("stun address truncated")
+	}
+	var l int
+	switch v[1] {
+	case 1:
+		l = net.IPv4len
+	case 2:
+		l = net.IPv6len
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidFamily, v[1])
+	}
+	if len(v) != 4+l {
+		return nil, fmt.Errorf("invalid stun address length %d", len(v))
+	}
+	b := append([]byte(nil), v[2:]...)
+	if xor {
+		m.xor(b)
+	}
+	return &net.UDPAddr{IP: net.IP(b[2:]), Port: int(binary.BigEndian.Uint16(b))}, nil
+}
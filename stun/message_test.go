@@ -0,0 +1,125 @@
+package stun
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	m := NewBindingRequest()
+	m.Add(AttrSoftware, []byte("inettools"))
+	m.Add(AttrChangeRequest, []byte{0, 0, 0, ChangeIP | ChangePort})
+	b := m.Marshal()
+	if len(b)%4 != 0 {
+		t.Fatalf("got length %d, not padded", len(b))
+	}
+	got, err := Unmarshal(b)
+	if err != nil {
+		t.Fatalf("unmarshal err: %v", err)
+	}
+	if diff := cmp.Diff(m, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	valid := NewBindingRequest()
+	valid.Add(AttrSoftware, []byte("inettools"))
+	tests := map[string]struct {
+		input []byte
+		want  error
+	}{
+		"Short":     {input: make([]byte, 19), want: ErrNotSTUN},
+		"NoCookie":  {input: make([]byte, 20), want: ErrNotSTUN},
+		"Truncated": {input: valid.Marshal()[:28]},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Unmarshal(test.input)
+			if err == nil {
+				t.Fatalf("got no error")
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Fatalf("got err %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+	// The test vectors of RFC 5769.
+	id := [12]byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+	tests := map[string]struct {
+		attr  uint16
+		value []byte
+		want  *net.UDPAddr
+	}{
+		"XORIPv4": {
+			attr:  AttrXORMappedAddress,
+			value: []byte{0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43},
+			want:  &net.UDPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 32853},
+		},
+		"XORIPv6": {
+			attr: AttrXORMappedAddress,
+			value: []byte{
+				0x00, 0x02, 0xa1, 0x47, 0x01, 0x13, 0xa9, 0xfa, 0xa5, 0xd3, 0xf1, 0x79,
+				0xbc, 0x25, 0xf4, 0xb5, 0xbe, 0xd2, 0xb9, 0xd9,
+			},
+			want: &net.UDPAddr{IP: net.ParseIP("2001:db8:1234:5678:11:2233:4455:6677"), Port: 32853},
+		},
+		"Other": {
+			attr:  AttrOtherAddress,
+			value: []byte{0x00, 0x01, 0x0d, 0x96, 0xc6, 0x33, 0x64, 0x01},
+			want:  &net.UDPAddr{IP: net.ParseIP("198.51.100.1").To4(), Port: 3478},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &Message{Type: TypeBindingResponse, TransactionID: id}
+			m.Add(test.attr, test.value)
+			got, err := m.Address(test.attr)
+			if err != nil {
+				t.Fatalf("address err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+
+			// Encoding the address must give back the same value.
+			enc := &Message{TransactionID: id}
+			enc.AddAddress(test.attr, test.want)
+			if diff := cmp.Diff(test.value, enc.Attributes[0].Value); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
+
+func TestMappedAddressFallback(t *testing.T) {
+	m := &Message{Type: TypeBindingResponse}
+	want := &net.UDPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 32853}
+	m.AddAddress(AttrMappedAddress, want)
+	got, err := m.MappedAddress()
+	if err != nil {
+		t.Fatalf("mapped address err: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+	if _, err := (&Message{}).MappedAddress(); !errors.Is(err, ErrNoAttribute) {
+		t.Fatalf("got err %v, want %v", err, ErrNoAttribute)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	m := &Message{Type: TypeBindingError}
+	m.Add(AttrErrorCode, append([]byte{0, 0, 4, 20}, "Unknown Attribute"...))
+	code, reason := m.ErrorCode()
+	if code != 420 || reason != "Unknown Attribute" {
+		t.Fatalf("got %d %q, want 420 \"Unknown Attribute\"", code, reason)
+	}
+}
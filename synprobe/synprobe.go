@@ -0,0 +1,288 @@
+package synprobe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/budget"
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/dotwaffle/inettools/sockopt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Prober whose fields are not set.
+const (
+	DefaultTimeout  = time.Second
+	DefaultInterval = time.Millisecond
+)
+
+// The range of the source ports of probes, which is the default ephemeral range on Linux.
+const (
+	minPort = 32768
+	maxPort = 60999
+)
+
+// synWindow is the receive window advertised by probes, which is that of a Linux host before window scaling.
+const synWindow = 64240
+
+// ErrUnsupportedPlatform is returned on platforms where TCP segments cannot be sent and received on raw sockets.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// State is the state of a port, as shown by the answer to a SYN.
+type State int
+
+// States of ports.
+const (
+	Filtered State = iota // Nothing answered before the timeout.
+	Open                  // The host answered with a SYN-ACK.
+	Closed                // The host answered with a RST.
+)
+
+var stateNames = map[State]string{Filtered: "filtered", Open: "open", Closed: "closed"}
+
+// String returns the name of the state.
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Result is the outcome of probing a target.
+type Result struct {
+	Target *net.TCPAddr
+	State  State
+	RTT    time.Duration // From the SYN to its answer, or zero if it was not answered.
+	Err    error         // The error sending the SYN, such as no route to the target.
+}
+
+// Prober checks that TCP services are alive with half-open connections: it sends each target a SYN, and times the
+// SYN-ACK or RST that answers it, without completing the handshake. The service never accepts a connection, so nothing
+// reaches the application or its logs. The SYN-ACK reaches no socket on this host, so the kernel answers it with a
+// RST, and the server discards its half-open connection at once; a firewall that drops those RSTs leaves the server
+// retransmitting its SYN-ACK until it gives up.
+//
+// Segments are sent and received on raw sockets, so on Linux it needs the CAP_NET_RAW capability, and it is not
+// supported on other platforms. The zero value is usable.
+type Prober struct {
+	Timeout  time.Duration // How long to wait for an answer, or DefaultTimeout if zero.
+	Interval time.Duration // The time between SYNs, bounding the rate they are sent at, or DefaultInterval if zero.
+	// Source is the address the SYNs are sent from, or nil to let the route to each target choose. It is checked
+	// against the targets and Socket.Device with sockopt.CheckSource.
+	Source net.IP
+	// Socket steers the SYNs, such as with a firewall mark or by binding to a VRF device.
+	Socket sockopt.Options
+	// Budget, if set, bounds the rate of the SYNs, and is typically shared with the other probers of the program.
+	Budget *budget.Budget
+}
+
+// key identifies the answer to a probe, by the address and port of the target and the source port of the probe.
+type key struct {
+	ip            [net.IPv6len]byte
+	port, srcPort uint16
+}
+
+// probe is a SYN awaiting an answer.
+type probe struct {
+	index int // Of the target.
+	seq   uint32
+	sent  time.Time
+}
+
+// Run probes the targets, returning a result for each, in the same order. If the context is done before every
+// target has been probed, the results so far are returned along with the context's error.
+func (p *Prober) Run(ctx context.Context, targets []*net.TCPAddr) ([]Result, error) {
+	timeout, interval := p.Timeout, p.Interval
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	for _, target := range targets {
+		if target.Port <= 0 || target.Port > 65535 {
+			return nil, fmt.Errorf("invalid port %d of %v", target.Port, target.IP)
+		}
+		if err := sockopt.CheckSource(p.Source, target.IP, p.Socket.Device); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]Result, len(targets))
+	for i, target := range targets {
+		results[i].Target = target
+	}
+	probes := map[key]probe{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	// A socket for each address family is opened when the first target of that family is probed, and closed once the
+	// last answer is due, which ends its receiver.
+	var conns [2]*net.IPConn
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+		wg.Wait()
+	}()
+
+	receive := func(conn *net.IPConn) {
+		defer wg.Done()
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			now := time.Now()
+			if err != nil {
+				return
+			}
+			tcp := packet.TCP(buf[:n])
+			if tcp.Valid() != nil {
+				continue
+			}
+			k := key{port: tcp.SrcPort(), srcPort: tcp.DstPort()}
+			copy(k.ip[:], addr.(*net.IPAddr).IP.To16())
+			mu.Lock()
+			if pr, ok := probes[k]; ok && now.Sub(pr.sent) <= timeout {
+				if state, ok := answer(tcp, pr.seq); ok {
+					delete(probes, k)
+					results[pr.index].State, results[pr.index].RTT = state, now.Sub(pr.sent)
+				}
+			}
+			mu.Unlock()
+		}
+	}
+
+	var last time.Time
+	start := time.Now()
+	for i, target := range targets {
+		// Schedule from the start rather than the previous SYN, so that delays do not accumulate.
+		if wait := time.Until(start.Add(time.Duration(i) * interval)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return results, ctx.Err()
+			}
+		}
+
+		dst, family := target.IP.To4(), 0
+		if dst == nil {
+			dst, family = target.IP.To16(), 1
+		}
+		if conns[family] == nil {
+			conn, err := listen(ctx, &p.Socket, family == 1, p.Source)
+			if err != nil {
+				return nil, err
+			}
+			conn.SetReadBuffer(1 << 20)
+			conns[family] = conn
+			wg.Add(1)
+			go receive(conn)
+		}
+		src := p.Source
+		if src == nil {
+			var err error
+			if src, err = p.route(ctx, target); err != nil {
+				results[i].Err = err
+				continue
+			}
+		}
+
+		var r [6]byte
+		if _, err := rand.Read(r[:]); err != nil {
+			return nil, err
+		}
+		k := key{port: uint16(target.Port)}
+		copy(k.ip[:], dst.To16())
+		pr := probe{index: i, seq: binary.BigEndian.Uint32(r[2:])}
+		mu.Lock()
+		// Each probe of a target has its own source port, so that its answer can be told apart.
+		for k.srcPort = minPort + binary.BigEndian.Uint16(r[:])%(maxPort-minPort+1); ; k.srcPort++ {
+			if k.srcPort > maxPort {
+				k.srcPort = minPort
+			}
+			if _, ok := probes[k]; !ok {
+				break
+			}
+		}
+		mu.Unlock()
+
+		b, err := syn(src, dst, k.srcPort, k.port, pr.seq)
+		if err != nil {
+			return nil, err
+		}
+		if p.Budget != nil {
+			if err := p.Budget.Wait(ctx, dst); err != nil {
+				return results, err
+			}
+		}
+		mu.Lock()
+		pr.sent = time.Now()
+		probes[k] = pr
+		mu.Unlock()
+		if _, err := conns[family].WriteTo(b, &net.IPAddr{IP: dst}); err != nil {
+			mu.Lock()
+			delete(probes, k)
+			results[i].Err = err
+			mu.Unlock()
+			continue
+		}
+		last = pr.sent
+	}
+
+	if !last.IsZero() {
+		select {
+		case <-time.After(time.Until(last.Add(timeout))):
+		case <-ctx.Done():
+		}
+	}
+	return results, ctx.Err()
+}
+
+// route returns the source address the host would use to reach a target.
+func (p *Prober) route(ctx context.Context, target *net.TCPAddr) (net.IP, error) {
+	// Connecting a UDP socket chooses the route without sending anything.
+	d := net.Dialer{Control: p.Socket.Control}
+	conn, err := d.DialContext(ctx, "udp", target.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// syn returns a SYN segment from src to dst. It carries the options a host would usually send, so that middleboxes
+// treat it like any other.
+func syn(src, dst net.IP, srcPort, dstPort uint16, seq uint32) ([]byte, error) {
+	opts := packet.AppendTCPOptions(nil, []packet.TCPOption{
+		{Kind: packet.TCPOptionMSS, Data: []byte{0x05, 0xb4}},
+		{Kind: packet.TCPOptionSACKPermitted},
+	})
+	b := make([]byte, packet.TCPMinLen+8)
+	f := &packet.TCPFields{SrcPort: srcPort, DstPort: dstPort, Seq: seq, Flags: packet.TCPFlagSYN, Window: synWindow,
+		Options: opts}
+	if err := packet.TCP(b).Encode(f, src, dst); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// answer returns the state of a port shown by a segment answering a SYN with the given sequence number, if it is one.
+func answer(tcp packet.TCP, seq uint32) (State, bool) {
+	flags := tcp.Flags()
+	if flags&packet.TCPFlagACK == 0 || tcp.Ack() != seq+1 {
+		return 0, false
+	}
+	switch {
+	case flags&packet.TCPFlagRST != 0:
+		return Closed, true
+	case flags&packet.TCPFlagSYN != 0:
+		return Open, true
+	}
+	return 0, false
+}
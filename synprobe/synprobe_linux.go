@@ -0,0 +1,26 @@
+// +build linux
+
+package synprobe
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/sockopt"
+	"net"
+)
+
+// listen opens a raw TCP socket, which receives a copy of every TCP segment the host receives.
+func listen(ctx context.Context, opts *sockopt.Options, v6 bool, src net.IP) (*net.IPConn, error) {
+	network, addr := "ip4:tcp", ""
+	if v6 {
+		network = "ip6:tcp"
+	}
+	if src != nil {
+		addr = src.String()
+	}
+	lc := net.ListenConfig{Control: opts.Control}
+	pc, err := lc.ListenPacket(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return pc.(*net.IPConn), nil
+}
@@ -0,0 +1,52 @@
+// +build linux
+
+package synprobe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+	// A port that was just in use is very likely to still be closed.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	closed.Close()
+	open := ln.Addr().(*net.TCPAddr)
+
+	p := &Prober{Timeout: 200 * time.Millisecond}
+	results, err := p.Run(context.Background(), []*net.TCPAddr{open, closed.Addr().(*net.TCPAddr)})
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+		t.Skipf("cannot open raw socket: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for i, want := range []State{Open, Closed} {
+		r := results[i]
+		if r.Err != nil || r.State != want || r.RTT <= 0 || r.RTT > p.Timeout {
+			t.Errorf("%v: got state %v, rtt %v, err %v, want %v", r.Target, r.State, r.RTT, r.Err, want)
+		}
+	}
+
+	// The listener never sees a connection.
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if conn, err := ln.Accept(); err == nil {
+		conn.Close()
+		t.Errorf("connection accepted from %v", conn.RemoteAddr())
+	}
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package synprobe
+
+import (
+	"context"
+	"github.com/dotwaffle/inettools/sockopt"
+	"net"
+)
+
+// listen is only implemented on Linux, as the BSDs do not pass TCP segments to raw sockets.
+func listen(context.Context, *sockopt.Options, bool, net.IP) (*net.IPConn, error) {
+	return nil, ErrUnsupportedPlatform
+}
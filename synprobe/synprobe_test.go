@@ -0,0 +1,86 @@
+package synprobe
+
+import (
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+func TestSyn(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.1").To4(), net.ParseIP("198.51.100.1").To4()
+	b, err := syn(src, dst, 40000, 443, 0x01020304)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tcp := packet.TCP(b)
+	if err := tcp.Valid(); err != nil {
+		t.Fatalf("invalid segment: %v", err)
+	}
+	if !tcp.VerifyChecksum(src, dst) {
+		t.Errorf("checksum %#04x incorrect", tcp.Checksum())
+	}
+	if tcp.SrcPort() != 40000 || tcp.DstPort() != 443 || tcp.Seq() != 0x01020304 || tcp.Flags() != packet.TCPFlagSYN {
+		t.Errorf("got ports %d -> %d, seq %#x, flags %#x", tcp.SrcPort(), tcp.DstPort(), tcp.Seq(), tcp.Flags())
+	}
+	opts, err := packet.ParseTCPOptions(tcp.Options())
+	if err != nil {
+		t.Fatalf("options err: %v", err)
+	}
+	want := []packet.TCPOption{
+		{Kind: packet.TCPOptionMSS, Data: []byte{0x05, 0xb4}},
+		{Kind: packet.TCPOptionSACKPermitted, Data: []byte{}},
+	}
+	if diff := cmp.Diff(want, opts); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	const seq = 0xfffffffe
+	tests := map[string]struct {
+		flags     uint8
+		ack       uint32
+		wantState State
+		wantOK    bool
+	}{
+		"SynAck": {
+			flags:     packet.TCPFlagSYN | packet.TCPFlagACK,
+			ack:       seq + 1,
+			wantState: Open,
+			wantOK:    true,
+		},
+		"Rst": {
+			flags:     packet.TCPFlagRST | packet.TCPFlagACK,
+			ack:       seq + 1,
+			wantState: Closed,
+			wantOK:    true,
+		},
+		"OtherAck": {
+			flags: packet.TCPFlagSYN | packet.TCPFlagACK,
+			ack:   seq,
+		},
+		"RstWithoutAck": {
+			flags: packet.TCPFlagRST,
+			ack:   seq + 1,
+		},
+		"Ack": {
+			flags: packet.TCPFlagACK,
+			ack:   seq + 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := make([]byte, packet.TCPMinLen)
+			f := &packet.TCPFields{SrcPort: 443, DstPort: 40000, Ack: test.ack, Flags: test.flags}
+			if err := packet.TCP(b).Encode(f, nil, nil); err != nil {
+				t.Fatalf("encode err: %v", err)
+			}
+			state, ok := answer(packet.TCP(b), seq)
+			if state != test.wantState || ok != test.wantOK {
+				t.Fatalf("got %v, %v, want %v, %v", state, ok, test.wantState, test.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"bytes"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	tcpiOptECN     = 0x8  // TCPI_OPT_ECN
+	tcpiOptECNSeen = 0x10 // TCPI_OPT_ECN_SEEN
+
+	tcpCANameMax = 16 // TCP_CA_NAME_MAX
+)
+
+// tcpInfoECN is the start of TCP_INFO up to tcpi_delivered_ce, which was added in Linux 4.18 along with
+// tcpi_delivered, well after the fields known to syscall.TCPInfo.
+type tcpInfoECN struct {
+	syscall.TCPInfo
+	_           [88]byte
+	delivered   uint32
+	deliveredCE uint32
+}
+
+// GetECN retrieves whether ECN was negotiated on a connection, and how many delivered segments were marked.
+func GetECN(conn *net.TCPConn) (ECN, error) {
+	if conn == nil {
+		return ECN{}, ErrNilConn
+	}
+
+	// Older kernels fill less of the structure, leaving the counters zero.
+	info := tcpInfoECN{}
+	if err := control(conn, "getsockopt TCP_INFO", syscall.IPPROTO_TCP, func(fd uintptr) error {
+		return getsockoptPtr(fd, syscall.IPPROTO_TCP, syscall.TCP_INFO, unsafe.Pointer(&info), unsafe.Sizeof(info))
+	}); err != nil {
+		return ECN{}, err
+	}
+
+	return ECN{
+		Negotiated:  info.Options&tcpiOptECN != 0,
+		Seen:        info.Options&tcpiOptECNSeen != 0,
+		Delivered:   info.delivered,
+		DeliveredCE: info.deliveredCE,
+	}, nil
+}
+
+// SetCongestion selects the congestion control algorithm of a connection (TCP_CONGESTION). Unprivileged processes may
+// only select those listed in net.ipv4.tcp_allowed_congestion_control.
+func SetCongestion(conn syscall.Conn, name string) error {
+	return control(conn, "setsockopt TCP_CONGESTION", syscall.IPPROTO_TCP, func(fd uintptr) error {
+		return syscall.SetsockoptString(int(fd), syscall.IPPROTO_TCP, syscall.TCP_CONGESTION, name)
+	})
+}
+
+// Congestion returns the congestion control algorithm of a connection (TCP_CONGESTION).
+func Congestion(conn syscall.Conn) (string, error) {
+	var name [tcpCANameMax]byte
+	if err := control(conn, "getsockopt TCP_CONGESTION", syscall.IPPROTO_TCP, func(fd uintptr) error {
+		return getsockoptPtr(fd, syscall.IPPROTO_TCP, syscall.TCP_CONGESTION, unsafe.Pointer(&name[0]),
+			uintptr(len(name)))
+	}); err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		return string(name[:i]), nil
+	}
+	return string(name[:]), nil
+}
+
+// ECNControl returns a function suitable for use as a net.Dialer or net.ListenConfig Control function, which requests
+// ECN on connections by selecting a congestion control algorithm that requires it, such as dctcp or prague for L4S,
+// or DefaultECNCongestion if congestion is empty. Linux has no per-socket switch for ECN: other connections negotiate
+// it according to the net.ipv4.tcp_ecn sysctl and the ecn feature of their route.
+func ECNControl(congestion string) func(network, address string, c syscall.RawConn) error {
+	if congestion == "" {
+		congestion = DefaultECNCongestion
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		return rawControl(c, "setsockopt TCP_CONGESTION", syscall.IPPROTO_TCP, func(fd uintptr) error {
+			return syscall.SetsockoptString(int(fd), syscall.IPPROTO_TCP, syscall.TCP_CONGESTION, congestion)
+		})
+	}
+}
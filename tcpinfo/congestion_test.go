@@ -0,0 +1,76 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCongestion(t *testing.T) {
+	conn := loopbackConn(t)
+	if err := SetCongestion(conn, "reno"); err != nil {
+		t.Fatalf("set err: %v", err)
+	}
+	got, err := Congestion(conn)
+	if err != nil || got != "reno" {
+		t.Fatalf("got %q, err %v", got, err)
+	}
+	if err := SetCongestion(conn, "no-such-algorithm"); err == nil {
+		t.Fatalf("got no error")
+	}
+}
+
+func TestGetECN(t *testing.T) {
+	// The client asks for ECN if the sysctl says to, or its congestion control requires it; the server agrees unless
+	// the sysctl disables ECN altogether.
+	sysctl, err := ioutil.ReadFile("/proc/sys/net/ipv4/tcp_ecn")
+	if err != nil {
+		t.Skipf("read sysctl err: %v", err)
+	}
+	mode := strings.TrimSpace(string(sysctl))
+
+	t.Run("Default", func(t *testing.T) {
+		conn := loopbackConn(t)
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+		ecn, err := GetECN(conn)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if want := mode == "1"; ecn.Negotiated != want {
+			t.Fatalf("got %+v with tcp_ecn %s, want negotiated %v", ecn, mode, want)
+		}
+		if ecn.DeliveredCE != 0 || ecn.CEFraction() != 0 {
+			t.Fatalf("got %+v, want no CE marks on loopback", ecn)
+		}
+	})
+
+	t.Run("Control", func(t *testing.T) {
+		if mode == "0" {
+			t.Skipf("ECN disabled by sysctl")
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer ln.Close()
+		d := net.Dialer{Control: ECNControl("")}
+		conn, err := d.DialContext(context.Background(), "tcp", ln.Addr().String())
+		if err != nil {
+			t.Skipf("dial with %s err: %v", DefaultECNCongestion, err)
+		}
+		defer conn.Close()
+		ecn, err := GetECN(conn.(*net.TCPConn))
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !ecn.Negotiated {
+			t.Fatalf("got %+v, want negotiated", ecn)
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package tcpinfo
+
+// DefaultECNCongestion is the congestion control algorithm ECNControl selects if none is given.
+const DefaultECNCongestion = "dctcp"
+
+// ECN describes the use of Explicit Congestion Notification on a connection, as reported by TCP_INFO.
+type ECN struct {
+	Negotiated bool // Both ends agreed to use ECN during the handshake.
+	Seen       bool // At least one segment received carried an ECN codepoint, so the path does not bleach it.
+	// The number of segments the peer has acknowledged, and how many of them it reported as marked Congestion
+	// Experienced on the way, by setting ECE. Both are zero on kernels before 4.18, which do not report them.
+	Delivered   uint32
+	DeliveredCE uint32
+}
+
+// CEFraction returns the proportion of delivered segments that were marked Congestion Experienced, the signal that
+// L4S congestion controllers respond to.
+func (e *ECN) CEFraction() float64 {
+	if e.Delivered == 0 {
+		return 0
+	}
+	return float64(e.DeliveredCE) / float64(e.Delivered)
+}
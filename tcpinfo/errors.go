@@ -0,0 +1,61 @@
+package tcpinfo
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var (
+	// ErrNilConn is returned when a nil connection is supplied.
+	ErrNilConn = errors.New("nil conn")
+
+	// ErrClosed matches errors caused by the connection having already been closed, which callers polling
+	// connections usually want to treat as the end of the connection rather than a failure.
+	ErrClosed = errors.New("connection closed")
+
+	// ErrNotTCP matches errors caused by attempting a TCP operation on a socket that is not a TCP socket.
+	ErrNotTCP = errors.New("not a tcp socket")
+
+	// ErrUnsupportedPlatform is returned by functions that are not implemented on the current platform.
+	ErrUnsupportedPlatform = errors.New("unsupported platform")
+)
+
+// Error records a failed operation on a socket. The underlying cause, usually a syscall.Errno, is preserved for
+// errors.Is and errors.As, and the error also matches ErrClosed or ErrNotTCP when appropriate.
+type Error struct {
+	Op  string // The operation that failed, such as "getsockopt TCP_INFO".
+	Err error  // The underlying cause.
+
+	notTCP bool
+}
+
+// newError wraps err as an *Error, classifying it by the socket option level the operation was performed at.
+func newError(op string, level int, err error) *Error {
+	return &Error{
+		Op:  op,
+		Err: err,
+		notTCP: level == syscall.IPPROTO_TCP &&
+			(errors.Is(err, syscall.ENOPROTOOPT) || errors.Is(err, syscall.EOPNOTSUPP)),
+	}
+}
+
+func (e *Error) Error() string {
+	return "tcpinfo: " + e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches ErrClosed or ErrNotTCP.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrClosed:
+		return errors.Is(e.Err, net.ErrClosed) || errors.Is(e.Err, syscall.EBADF)
+	case ErrNotTCP:
+		return e.notTCP
+	}
+	return false
+}
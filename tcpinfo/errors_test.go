@@ -0,0 +1,54 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("Closed", func(t *testing.T) {
+		conn := loopbackConn(t)
+		conn.Close()
+
+		_, err := Get(conn)
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("got %v, want ErrClosed", err)
+		}
+	})
+
+	t.Run("NotTCP", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer conn.Close()
+
+		err = SetNoDelay(conn.(*net.UDPConn), true)
+		if !errors.Is(err, ErrNotTCP) {
+			t.Fatalf("got %v, want ErrNotTCP", err)
+		}
+		if errors.Is(err, ErrClosed) {
+			t.Fatalf("got %v, which should not match ErrClosed", err)
+		}
+
+		// The errno itself should still be available to callers.
+		var errno syscall.Errno
+		if !errors.As(err, &errno) {
+			t.Fatalf("got %v, want errno to be preserved", err)
+		}
+		var tcpErr *Error
+		if !errors.As(err, &tcpErr) || tcpErr.Op != "setsockopt TCP_NODELAY" {
+			t.Fatalf("got %#v, want *Error for setsockopt TCP_NODELAY", err)
+		}
+	})
+
+	t.Run("NilConn", func(t *testing.T) {
+		if _, err := Get(nil); !errors.Is(err, ErrNilConn) {
+			t.Fatalf("got %v, want ErrNilConn", err)
+		}
+	})
+}
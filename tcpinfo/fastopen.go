@@ -0,0 +1,20 @@
+package tcpinfo
+
+// FastOpenFailure is why a client's attempt to use TCP Fast Open failed.
+type FastOpenFailure string
+
+// Reasons TCP Fast Open can fail, as reported by the kernel since Linux 5.5.
+const (
+	FastOpenOK                FastOpenFailure = ""                   // No failure was recorded.
+	FastOpenCookieUnavailable FastOpenFailure = "cookie-unavailable" // No cookie was cached for the server.
+	FastOpenDataNotAcked      FastOpenFailure = "data-not-acked"     // The server did not accept the data.
+	FastOpenSYNRetransmitted  FastOpenFailure = "syn-retransmitted"  // The SYN with data was lost or dropped.
+)
+
+// FastOpen describes the use of TCP Fast Open (RFC 7413) on a connection, as reported by TCP_INFO.
+type FastOpen struct {
+	// Used reports whether data sent in the SYN was accepted, so saving a round trip: for a client, that the server
+	// acknowledged the data it sent, and for a server, that it accepted the connection with the data.
+	Used          bool
+	ClientFailure FastOpenFailure // Why the client could not use it, if it tried.
+}
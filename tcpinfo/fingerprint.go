@@ -0,0 +1,184 @@
+package tcpinfo
+
+import (
+	"encoding/binary"
+	"github.com/dotwaffle/inettools/packet"
+	"strconv"
+	"strings"
+)
+
+// Fingerprint is a coarse, p0f-style description of the TCP/IP stack that sent a SYN, from the parts of its headers
+// that differ between operating systems and are rarely changed by middleboxes.
+type Fingerprint struct {
+	Version     int    // The IP version, 4 or 6.
+	TTL         uint8  // The TTL or hop limit as received.
+	InitialTTL  uint8  // The likely initial TTL: the smallest of 32, 64, 128, and 255 that is at least the TTL.
+	IPOptions   int    // The length of IPv4 options, or zero.
+	MSS         int    // The maximum segment size, or -1 if there is no MSS option.
+	Window      uint16 // The window size.
+	WindowScale int    // The window scale, or -1 if there is no window scale option.
+	// The kinds of TCP options in the order they were sent, in p0f notation: mss, ws, sok, sack, ts, nop, eol+N for
+	// an end of options list followed by N octets of padding, and ?N for other kinds.
+	Options []string
+	// Unusual header values, in p0f notation: df and id+ for IPv4 packets with don't fragment set and a non-zero ID,
+	// id- for those without and a zero ID, ecn for ECN flags, flow for an IPv6 flow label, seq- for a zero sequence
+	// number, ack+ for an acknowledgment number without the flag, uptr+ for an urgent pointer without the flag, urgf+
+	// and pushf+ for those flags, ts1- for a zero timestamp, ts2+ for a non-zero timestamp echo, opt+ for data after
+	// the end of options, exws for a window scale above 14, and bad for options that cannot be parsed.
+	Quirks  []string
+	Payload bool // Whether the SYN carried data, as with TCP Fast Open; a saved SYN does not include it.
+}
+
+// ParseFingerprint derives the fingerprint of the stack that sent a SYN, from its IPv4 or IPv6 header followed by its
+// TCP header, as returned by TCP_SAVED_SYN. IPv6 extension headers are not supported.
+func ParseFingerprint(b []byte) (*Fingerprint, error) {
+	version, header, tcp, err := splitSYN(b)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fingerprint{Version: version}
+	if version == 4 {
+		ip := packet.IPv4(header)
+		f.TTL, f.IPOptions = ip.TTL(), ip.HeaderLen()-packet.IPv4MinLen
+		df := ip.Flags()&packet.IPv4DontFragment != 0
+		if df {
+			f.Quirks = append(f.Quirks, "df")
+		}
+		switch {
+		case df && ip.ID() != 0:
+			f.Quirks = append(f.Quirks, "id+")
+		case !df && ip.ID() == 0:
+			f.Quirks = append(f.Quirks, "id-")
+		}
+		if ip.TOS()&0x3 != 0 {
+			f.Quirks = append(f.Quirks, "ecn")
+		}
+		f.Payload = int(ip.TotalLen()) > len(b)
+	} else {
+		ip := packet.IPv6(header)
+		f.TTL = ip.HopLimit()
+		if ip.TrafficClass()&0x3 != 0 {
+			f.Quirks = append(f.Quirks, "ecn")
+		}
+		if ip.FlowLabel() != 0 {
+			f.Quirks = append(f.Quirks, "flow")
+		}
+		f.Payload = int(ip.PayloadLen()) > len(tcp)
+	}
+	f.Payload = f.Payload || len(tcp) > tcp.HeaderLen()
+
+	f.InitialTTL = 255
+	for _, ttl := range []uint8{32, 64, 128} {
+		if f.TTL <= ttl {
+			f.InitialTTL = ttl
+			break
+		}
+	}
+
+	flags := tcp.Flags()
+	for _, q := range []struct {
+		name string
+		set  bool
+	}{
+		{"ecn", flags&(packet.TCPFlagECE|packet.TCPFlagCWR) != 0 && !f.hasQuirk("ecn")},
+		{"seq-", tcp.Seq() == 0},
+		{"ack+", flags&packet.TCPFlagACK == 0 && tcp.Ack() != 0},
+		{"uptr+", flags&packet.TCPFlagURG == 0 && tcp.Urgent() != 0},
+		{"urgf+", flags&packet.TCPFlagURG != 0},
+		{"pushf+", flags&packet.TCPFlagPSH != 0},
+	} {
+		if q.set {
+			f.Quirks = append(f.Quirks, q.name)
+		}
+	}
+
+	f.Window, f.MSS, f.WindowScale = tcp.Window(), -1, -1
+	f.parseOptions(tcp.Options())
+	return f, nil
+}
+
+// hasQuirk reports whether the fingerprint has a quirk.
+func (f *Fingerprint) hasQuirk(name string) bool {
+	for _, q := range f.Quirks {
+		if q == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOptions records the layout and values of TCP options, and the quirks they show.
+func (f *Fingerprint) parseOptions(b []byte) {
+	for len(b) > 0 {
+		kind := b[0]
+		switch kind {
+		case packet.TCPOptionEnd:
+			f.Options = append(f.Options, "eol+"+strconv.Itoa(len(b)-1))
+			for _, c := range b[1:] {
+				if c != 0 {
+					f.Quirks = append(f.Quirks, "opt+")
+					break
+				}
+			}
+			return
+		case packet.TCPOptionNOP:
+			f.Options = append(f.Options, "nop")
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || int(b[1]) < 2 || int(b[1]) > len(b) {
+			f.Quirks = append(f.Quirks, "bad")
+			return
+		}
+		data := b[2:b[1]]
+		b = b[b[1]:]
+		switch {
+		case kind == packet.TCPOptionMSS && len(data) == 2:
+			f.Options = append(f.Options, "mss")
+			f.MSS = int(binary.BigEndian.Uint16(data))
+		case kind == packet.TCPOptionWindowScale && len(data) == 1:
+			f.Options = append(f.Options, "ws")
+			f.WindowScale = int(data[0])
+			if f.WindowScale > 14 {
+				f.Quirks = append(f.Quirks, "exws")
+			}
+		case kind == packet.TCPOptionSACKPermitted:
+			f.Options = append(f.Options, "sok")
+		case kind == packet.TCPOptionSACK:
+			f.Options = append(f.Options, "sack")
+		case kind == packet.TCPOptionTimestamps && len(data) == 8:
+			f.Options = append(f.Options, "ts")
+			if binary.BigEndian.Uint32(data) == 0 {
+				f.Quirks = append(f.Quirks, "ts1-")
+			}
+			if binary.BigEndian.Uint32(data[4:]) != 0 {
+				f.Quirks = append(f.Quirks, "ts2+")
+			}
+		default:
+			f.Options = append(f.Options, "?"+strconv.Itoa(int(kind)))
+		}
+	}
+}
+
+// String formats the fingerprint as a p0f signature, version:ittl:olen:mss:wsize,scale:olayout:quirks:pclass, such as
+// "4:64:0:1460:mss*44,7:mss,sok,ts,nop,ws:df,id+:0". The window is written as a multiple of the MSS where it is one.
+func (f *Fingerprint) String() string {
+	mss, scale, window := "*", "*", strconv.Itoa(int(f.Window))
+	if f.MSS >= 0 {
+		mss = strconv.Itoa(f.MSS)
+		if f.MSS > 0 && f.Window != 0 && int(f.Window)%f.MSS == 0 {
+			window = "mss*" + strconv.Itoa(int(f.Window)/f.MSS)
+		}
+	}
+	if f.WindowScale >= 0 {
+		scale = strconv.Itoa(f.WindowScale)
+	}
+	pclass := "0"
+	if f.Payload {
+		pclass = "+"
+	}
+	return strings.Join([]string{
+		strconv.Itoa(f.Version), strconv.Itoa(int(f.InitialTTL)), strconv.Itoa(f.IPOptions), mss,
+		window + "," + scale, strings.Join(f.Options, ","), strings.Join(f.Quirks, ","), pclass,
+	}, ":")
+}
@@ -0,0 +1,102 @@
+package tcpinfo
+
+import (
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+)
+
+// syn builds the headers of a SYN with the given TCP options, as TCP_SAVED_SYN returns them.
+func syn(t *testing.T, v6 bool, ttl uint8, id uint16, flags uint8, window uint16, opts []byte) []byte {
+	t.Helper()
+	optLen := (len(opts) + 3) / 4 * 4
+	tcpLen := packet.TCPMinLen + optLen
+	var b []byte
+	var src, dst net.IP
+	if v6 {
+		b = make([]byte, packet.IPv6HeaderLen+tcpLen)
+		src, dst = net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+		if err := packet.IPv6(b).Encode(&packet.IPv6Fields{
+			FlowLabel: 0x12345, NextHeader: packet.ProtocolTCP, HopLimit: ttl, Src: src, Dst: dst,
+		}); err != nil {
+			t.Fatalf("encode err: %v", err)
+		}
+	} else {
+		b = make([]byte, packet.IPv4MinLen+tcpLen)
+		src, dst = net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4()
+		if err := packet.IPv4(b).Encode(&packet.IPv4Fields{
+			ID: id, Flags: packet.IPv4DontFragment, TTL: ttl, Protocol: packet.ProtocolTCP, Src: src, Dst: dst,
+		}); err != nil {
+			t.Fatalf("encode err: %v", err)
+		}
+	}
+	if err := packet.TCP(b[len(b)-tcpLen:]).Encode(&packet.TCPFields{
+		SrcPort: 40000, DstPort: 443, Seq: 1, Flags: flags, Window: window, Options: opts,
+	}, src, dst); err != nil {
+		t.Fatalf("encode err: %v", err)
+	}
+	return b
+}
+
+func TestParseFingerprint(t *testing.T) {
+	linux := []byte{2, 4, 0x05, 0xb4, 4, 2, 8, 10, 0, 0, 0, 1, 0, 0, 0, 0, 1, 3, 3, 7}
+	windows := []byte{2, 4, 0x05, 0xb4, 1, 3, 3, 8, 1, 1, 4, 2}
+
+	tests := map[string]struct {
+		input   []byte
+		want    string
+		wantErr bool
+	}{
+		"Linux": {
+			input: syn(t, false, 61, 0x1234, packet.TCPFlagSYN, 64240, linux),
+			want:  "4:64:0:1460:mss*44,7:mss,sok,ts,nop,ws:df,id+:0",
+		},
+		"Windows": {
+			input: syn(t, false, 120, 0x1234, packet.TCPFlagSYN, 64240, windows),
+			want:  "4:128:0:1460:mss*44,8:mss,nop,ws,nop,nop,sok:df,id+:0",
+		},
+		"IPv6": {
+			input: syn(t, true, 64, 0, packet.TCPFlagSYN|packet.TCPFlagECE|packet.TCPFlagCWR, 65535, linux[:4]),
+			want:  "6:64:0:1460:65535,*:mss:flow,ecn:0",
+		},
+		"Quirks": {
+			input: syn(t, false, 250, 0, packet.TCPFlagSYN|packet.TCPFlagPSH, 1024,
+				[]byte{3, 3, 15, 8, 10, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 5}),
+			want: "4:255:0:*:1024,15:ws,ts,eol+2:df,pushf+,exws,ts1-,ts2+,opt+:0",
+		},
+		"BadOptions": {
+			input: syn(t, false, 64, 1, packet.TCPFlagSYN, 1024, []byte{2, 9, 0, 0}),
+			want:  "4:64:0:*:1024,*::df,id+,bad:0",
+		},
+		"NotSYN": {
+			input:   syn(t, false, 64, 1, packet.TCPFlagACK, 1024, nil),
+			wantErr: true,
+		},
+		"Truncated": {
+			input:   syn(t, false, 64, 1, packet.TCPFlagSYN, 1024, linux)[:30],
+			wantErr: true,
+		},
+		"Empty": {
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := ParseFingerprint(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			if diff := cmp.Diff(test.want, f.String()); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Summary is the TCP_INFO of a connection accepted by a Listener, taken either periodically or as it is closed.
+type Summary struct {
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	Accepted   time.Time
+	Sampled    time.Time
+	Final      bool // Set when the sample was taken as the connection was closed.
+	Info       syscall.TCPInfo
+}
+
+// Listener wraps a net.Listener so that every TCP connection it accepts is instrumented, reporting its TCP_INFO to a
+// callback when the connection is closed, and optionally at regular intervals while it remains open.
+type Listener struct {
+	net.Listener
+
+	callback func(Summary)
+	registry *Registry // The connections to sample periodically, or nil if they are not.
+
+	mu    sync.Mutex
+	conns map[*net.TCPConn]*Conn // The connections in the registry, or nil once the listener is closed.
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// WrapListener instruments ln, calling callback with a Summary for each accepted connection as it is closed. If
+// interval is non-zero, every open connection is also sampled that often; connections are then tracked until they are
+// closed, or until the listener is, so those that are dropped without being closed are held until the listener is
+// closed. The callback may be called concurrently from multiple goroutines, and should return quickly as it delays
+// the closing of connections.
+func WrapListener(ln net.Listener, callback func(Summary), interval time.Duration) *Listener {
+	l := &Listener{
+		Listener: ln,
+		callback: callback,
+		done:     make(chan struct{}),
+	}
+	if interval > 0 {
+		l.registry = NewRegistry()
+		l.conns = make(map[*net.TCPConn]*Conn)
+		go l.sample(interval)
+	}
+	return l
+}
+
+// sample periodically reports on every open connection until the listener is closed.
+func (l *Listener) sample(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var samples []Sample
+	for {
+		select {
+		case <-l.done:
+			return
+		case now := <-ticker.C:
+			samples = l.registry.Snapshot(samples[:0])
+			for _, s := range samples {
+				l.mu.Lock()
+				c, ok := l.conns[s.Conn]
+				if s.Err != nil && errors.Is(s.Err, ErrClosed) {
+					// Closed without going through the Conn, so the registry has already stopped tracking it.
+					delete(l.conns, s.Conn)
+				}
+				l.mu.Unlock()
+				if !ok || s.Err != nil {
+					continue
+				}
+				l.callback(Summary{
+					LocalAddr:  s.Conn.LocalAddr(),
+					RemoteAddr: s.Conn.RemoteAddr(),
+					Accepted:   c.accepted,
+					Sampled:    now,
+					Info:       s.Info,
+				})
+			}
+		}
+	}
+}
+
+// Accept waits for and returns the next connection. TCP connections are returned wrapped in a *Conn, which reports
+// its statistics as it is closed, so callers that need the *net.TCPConn should take it from the TCPConn field; any
+// other kind of connection is returned as is.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return conn, nil
+	}
+
+	c := &Conn{TCPConn: tcpConn, listener: l, accepted: time.Now()}
+	if l.registry != nil {
+		l.mu.Lock()
+		if l.conns != nil {
+			// Failing to track the connection is no reason to refuse it, it just won't be sampled periodically.
+			if l.registry.Add(tcpConn) == nil {
+				l.conns[tcpConn] = c
+			}
+		}
+		l.mu.Unlock()
+	}
+	return c, nil
+}
+
+// Close stops periodic sampling, stops tracking the connections already accepted, and closes the underlying listener.
+// Those connections are otherwise unaffected, and will still report their final statistics when closed.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		if l.registry != nil {
+			l.mu.Lock()
+			for conn := range l.conns {
+				l.registry.Remove(conn)
+			}
+			l.conns = nil
+			l.mu.Unlock()
+		}
+	})
+	return l.Listener.Close()
+}
+
+// Conn is a TCP connection accepted by a Listener.
+type Conn struct {
+	*net.TCPConn
+
+	listener  *Listener
+	accepted  time.Time
+	closeOnce sync.Once
+}
+
+// Close samples the connection a final time, reports it to the listener's callback, and then closes it.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		l := c.listener
+		if l.registry != nil {
+			l.registry.Remove(c.TCPConn)
+			l.mu.Lock()
+			delete(l.conns, c.TCPConn)
+			l.mu.Unlock()
+		}
+
+		info, err := Get(c.TCPConn)
+		if err != nil {
+			return
+		}
+		l.callback(Summary{
+			LocalAddr:  c.LocalAddr(),
+			RemoteAddr: c.RemoteAddr(),
+			Accepted:   c.accepted,
+			Sampled:    time.Now(),
+			Final:      true,
+			Info:       *info,
+		})
+	})
+	return c.TCPConn.Close()
+}
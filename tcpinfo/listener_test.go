@@ -0,0 +1,125 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+
+	var mu sync.Mutex
+	var summaries []Summary
+	ln := WrapListener(inner, func(s Summary) {
+		mu.Lock()
+		defer mu.Unlock()
+		summaries = append(summaries, s)
+	}, 10*time.Millisecond)
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer client.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	if _, ok := conn.(*Conn); !ok {
+		t.Fatalf("accepted %T, want *Conn", conn)
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+
+	// Give the periodic sampler a chance to run, then close the connection to trigger the final summary.
+	time.Sleep(50 * time.Millisecond)
+	if err := conn.Close(); err != nil {
+		t.Fatalf("close err: %v", err)
+	}
+	// Closing a second time must not report the connection again.
+	conn.Close()
+	ln.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var periodic, final int
+	for _, s := range summaries {
+		if s.RemoteAddr.String() != client.LocalAddr().String() {
+			t.Fatalf("summary for unexpected remote %v", s.RemoteAddr)
+		}
+		if s.Final {
+			final++
+		} else {
+			periodic++
+		}
+	}
+	if periodic == 0 || final != 1 {
+		t.Fatalf("got %d periodic and %d final summaries, want >0 and 1", periodic, final)
+	}
+	if last := summaries[len(summaries)-1]; !last.Final || last.Info.Snd_cwnd == 0 {
+		t.Fatalf("final summary should be last and populated: %+v", last)
+	}
+}
+
+func TestListenerTracking(t *testing.T) {
+	accept := func(ln *Listener) *Conn {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("dial err: %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("accept err: %v", err)
+		}
+		return conn.(*Conn)
+	}
+	tracked := func(ln *Listener) int {
+		ln.mu.Lock()
+		defer ln.mu.Unlock()
+		return len(ln.conns)
+	}
+	newListener := func(interval time.Duration) *Listener {
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		ln := WrapListener(inner, func(Summary) {}, interval)
+		t.Cleanup(func() { ln.Close() })
+		return ln
+	}
+
+	// Without periodic sampling, nothing is tracked.
+	ln := newListener(0)
+	accept(ln)
+	if ln.registry != nil || ln.conns != nil {
+		t.Fatalf("connections tracked without periodic sampling")
+	}
+
+	// A connection closed behind the back of its Conn is forgotten at the next sample, and the rest once the listener
+	// is closed.
+	ln = newListener(10 * time.Millisecond)
+	accept(ln).TCPConn.Close()
+	accept(ln)
+	if got := tracked(ln); got != 2 {
+		t.Fatalf("tracking %d connections, want 2", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := tracked(ln); got != 1 {
+		t.Fatalf("tracking %d connections after sampling, want 1", got)
+	}
+	ln.Close()
+	if got, n := tracked(ln), ln.registry.Len(); got != 0 || n != 0 {
+		t.Fatalf("tracking %d connections, %d in the registry, after closing the listener", got, n)
+	}
+}
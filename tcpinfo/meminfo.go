@@ -0,0 +1,103 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// soMemInfo is SO_MEMINFO, which is missing from the syscall package.
+const soMemInfo = 0x37
+
+// MemInfo is the socket memory accounting reported by SO_MEMINFO, in bytes.
+type MemInfo struct {
+	RmemAlloc  uint32 // Memory allocated to data in the receive queue.
+	RcvBuf     uint32 // The receive buffer limit, as also returned by SO_RCVBUF.
+	WmemAlloc  uint32 // Memory allocated to data in the transmit queue that has not yet left the host.
+	SndBuf     uint32 // The send buffer limit, as also returned by SO_SNDBUF.
+	FwdAlloc   uint32 // Memory reserved for the socket in advance, but not yet used.
+	WmemQueued uint32 // Memory allocated to data queued for sending, including unacknowledged data.
+	OptMem     uint32 // Memory used for socket options and ancillary data.
+	Backlog    uint32 // Memory used by the backlog of packets received while the socket was locked.
+	Drops      uint32 // Packets dropped before reaching the socket, available from Linux 4.7 onwards.
+}
+
+// RecvUtilization returns the proportion of the receive buffer currently in use.
+func (m *MemInfo) RecvUtilization() float64 {
+	if m.RcvBuf == 0 {
+		return 0
+	}
+	return float64(m.RmemAlloc) / float64(m.RcvBuf)
+}
+
+// SendUtilization returns the proportion of the send buffer currently in use by queued data.
+func (m *MemInfo) SendUtilization() float64 {
+	if m.SndBuf == 0 {
+		return 0
+	}
+	return float64(m.WmemQueued) / float64(m.SndBuf)
+}
+
+// GetMemInfo retrieves the socket memory accounting (SO_MEMINFO) of the socket underlying conn.
+func GetMemInfo(conn syscall.Conn) (*MemInfo, error) {
+	// Leave room for more fields than we know about, as the kernel truncates to the length we supply. Any fields an
+	// older kernel does not know about are left as zero.
+	var fields [16]uint32
+
+	// Instruct the kernel to deliver the SO_MEMINFO data into the array provided.
+	if err := control(conn, "getsockopt SO_MEMINFO", syscall.SOL_SOCKET, func(fd uintptr) error {
+		return getsockoptPtr(fd, syscall.SOL_SOCKET, soMemInfo, unsafe.Pointer(&fields), unsafe.Sizeof(fields))
+	}); err != nil {
+		return nil, err
+	}
+
+	return &MemInfo{
+		RmemAlloc:  fields[0],
+		RcvBuf:     fields[1],
+		WmemAlloc:  fields[2],
+		SndBuf:     fields[3],
+		FwdAlloc:   fields[4],
+		WmemQueued: fields[5],
+		OptMem:     fields[6],
+		Backlog:    fields[7],
+		Drops:      fields[8],
+	}, nil
+}
+
+// GetWithMemInfo retrieves both the TCP_INFO and the socket memory accounting of a connection, so that buffer sizing
+// can be judged against the state of the connection at the same moment.
+func GetWithMemInfo(conn *net.TCPConn) (*syscall.TCPInfo, *MemInfo, error) {
+	info, err := Get(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	memInfo, err := GetMemInfo(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, memInfo, nil
+}
+
+// SetSendBuffer sets the send buffer size (SO_SNDBUF). The kernel doubles the requested value to allow for
+// bookkeeping overhead, and setting it disables send buffer autotuning for the socket.
+func SetSendBuffer(conn syscall.Conn, bytes int) error {
+	return setsockoptInt(conn, syscall.SOL_SOCKET, syscall.SO_SNDBUF, bytes)
+}
+
+// SendBuffer returns the send buffer size (SO_SNDBUF).
+func SendBuffer(conn syscall.Conn) (int, error) {
+	return getsockoptInt(conn, syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+}
+
+// SetRecvBuffer sets the receive buffer size (SO_RCVBUF). The kernel doubles the requested value to allow for
+// bookkeeping overhead, and setting it disables receive buffer autotuning for the socket.
+func SetRecvBuffer(conn syscall.Conn, bytes int) error {
+	return setsockoptInt(conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF, bytes)
+}
+
+// RecvBuffer returns the receive buffer size (SO_RCVBUF).
+func RecvBuffer(conn syscall.Conn) (int, error) {
+	return getsockoptInt(conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+}
@@ -0,0 +1,395 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Constants for Multipath TCP (RFC 8684), which Linux has supported since 5.6.
+const (
+	ipprotoMPTCP = 262 // IPPROTO_MPTCP
+	solMPTCP     = 284 // SOL_MPTCP
+
+	mptcpInfo         = 1 // MPTCP_INFO
+	mptcpTCPInfo      = 2 // MPTCP_TCPINFO
+	mptcpSubflowAddrs = 3 // MPTCP_SUBFLOW_ADDRS
+
+	sizeofSockaddrStorage = 128 // sizeof(struct sockaddr_storage)
+
+	mptcpInfoFlagFallback          = 0x1 // MPTCP_INFO_FLAG_FALLBACK
+	mptcpInfoFlagRemoteKeyReceived = 0x2 // MPTCP_INFO_FLAG_REMOTE_KEY_RECEIVED
+
+	// mptcpMaxSubflows bounds the subflows retrieved, well above the kernel's limit of eight per connection.
+	mptcpMaxSubflows = 16
+)
+
+// ErrNotMPTCP matches errors caused by attempting an MPTCP operation on a socket that is plain TCP.
+var ErrNotMPTCP = errors.New("not an mptcp socket")
+
+// mptcpInfoRaw is struct mptcp_info, as of Linux 6.10; older kernels fill less of it.
+type mptcpInfoRaw struct {
+	subflows           uint8
+	addAddrSignal      uint8
+	addAddrAccepted    uint8
+	subflowsMax        uint8
+	addAddrSignalMax   uint8
+	addAddrAcceptedMax uint8
+	flags              uint32
+	token              uint32
+	writeSeq           uint64
+	sndUna             uint64
+	rcvNxt             uint64
+	localAddrUsed      uint8
+	localAddrMax       uint8
+	csumEnabled        uint8
+	retransmits        uint32
+	bytesRetrans       uint64
+	bytesSent          uint64
+	bytesReceived      uint64
+	bytesAcked         uint64
+	subflowsTotal      uint8
+	_                  [3]uint8
+	lastDataSent       uint32
+	lastDataRecv       uint32
+	lastAckRecv        uint32
+}
+
+// mptcpSubflowData is struct mptcp_subflow_data, the header of the MPTCP_TCPINFO and MPTCP_SUBFLOW_ADDRS options.
+type mptcpSubflowData struct {
+	sizeSubflowData uint32
+	numSubflows     uint32
+	sizeKernel      uint32
+	sizeUser        uint32
+}
+
+// subflowAddrs is struct mptcp_subflow_addrs: the local and remote addresses, each a sockaddr_storage.
+type subflowAddrs struct {
+	local  [sizeofSockaddrStorage]byte
+	remote [sizeofSockaddrStorage]byte
+}
+
+// MPTCPInfo is the state of an MPTCP connection as a whole, as reported by MPTCP_INFO. Fields the running kernel does
+// not report are zero.
+type MPTCPInfo struct {
+	Subflows           int  // The number of subflows, other than the initial one.
+	SubflowsMax        int  // The limit on additional subflows.
+	SubflowsTotal      int  // The number of subflows, including the initial one; zero before Linux 6.10.
+	AddAddrSignal      int  // Addresses announced to the peer.
+	AddAddrSignalMax   int  // The limit on addresses announced.
+	AddAddrAccepted    int  // Addresses announced by the peer and accepted.
+	AddAddrAcceptedMax int  // The limit on addresses accepted.
+	LocalAddrUsed      int  // Local addresses used by subflows.
+	LocalAddrMax       int  // The limit on local addresses used.
+	Fallback           bool // The connection fell back to plain TCP, such as because the peer does not support MPTCP.
+	RemoteKeyReceived  bool // The peer's key was received, completing the MPTCP handshake.
+	ChecksumEnabled    bool
+	Token              uint32 // The local token identifying the connection.
+	WriteSeq           uint64 // The data sequence number of the next octet to be written.
+	SndUna             uint64 // The data sequence number of the first unacknowledged octet.
+	RcvNxt             uint64 // The data sequence number of the next octet expected.
+	Retransmits        uint32
+	BytesRetrans       uint64
+	BytesSent          uint64
+	BytesReceived      uint64
+	BytesAcked         uint64
+	LastDataSent       time.Duration // The time since data was last sent, on any subflow.
+	LastDataRecv       time.Duration // The time since data was last received, on any subflow.
+	LastAckRecv        time.Duration // The time since an acknowledgement was last received, on any subflow.
+}
+
+// MPTCPSubflow is a single TCP connection carrying part of an MPTCP connection.
+type MPTCPSubflow struct {
+	Local  *net.TCPAddr
+	Remote *net.TCPAddr
+	Info   *syscall.TCPInfo
+}
+
+// MPTCPAvailable reports whether the kernel supports MPTCP and has it enabled by the net.mptcp.enabled sysctl.
+func MPTCPAvailable() bool {
+	if b, err := ioutil.ReadFile("/proc/sys/net/mptcp/enabled"); err != nil || strings.TrimSpace(string(b)) != "1" {
+		return false
+	}
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, ipprotoMPTCP)
+	if err != nil {
+		return false
+	}
+	syscall.Close(fd)
+	return true
+}
+
+// mptcpSocket creates a non-blocking MPTCP socket for addr.
+func mptcpSocket(addr *net.TCPAddr) (int, syscall.Sockaddr, error) {
+	family := syscall.AF_INET
+	if addr.IP.To4() == nil && addr.IP != nil {
+		family = syscall.AF_INET6
+	}
+	if addr.IP == nil {
+		addr = &net.TCPAddr{IP: net.IPv4zero, Port: addr.Port}
+	}
+	sa, err := sockaddr(family, addr)
+	if err != nil {
+		return -1, nil, err
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, ipprotoMPTCP)
+	if err != nil {
+		return -1, nil, fmt.Errorf("socket: %w", err)
+	}
+	return fd, sa, nil
+}
+
+// DialMPTCP connects to address, a host and port, over MPTCP, which falls back to plain TCP if the peer or the path
+// does not support it. The kernel's path manager decides which additional subflows to open.
+func DialMPTCP(ctx context.Context, network, address string) (*net.TCPConn, error) {
+	addr, err := net.ResolveTCPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	fd, sa, err := mptcpSocket(addr)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), "mptcp")
+	defer file.Close()
+
+	// The socket is non-blocking, so the connection completes once it becomes writable, which the runtime poller
+	// waits for, honouring the deadline of the context.
+	if err := syscall.Connect(fd, sa); err != nil && err != syscall.EINPROGRESS {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		file.SetWriteDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			file.SetWriteDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	rawConn, err := file.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("rawConn err: %w", err)
+	}
+	var connErr error
+	if err := rawConn.Write(func(fd uintptr) bool {
+		errno, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ERROR)
+		switch {
+		case err != nil:
+			connErr = err
+		case syscall.Errno(errno) == syscall.EINPROGRESS || syscall.Errno(errno) == syscall.EALREADY:
+			return false
+		case errno != 0:
+			connErr = syscall.Errno(errno)
+		}
+		return true
+	}); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if connErr != nil {
+		return nil, fmt.Errorf("connect: %w", connErr)
+	}
+
+	return fileTCPConn(file)
+}
+
+// ListenMPTCP listens for MPTCP connections on address, also accepting plain TCP connections from peers that do not
+// support MPTCP.
+func ListenMPTCP(network, address string) (*net.TCPListener, error) {
+	addr, err := net.ResolveTCPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	fd, sa, err := mptcpSocket(addr)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), "mptcp")
+	defer file.Close()
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return nil, fmt.Errorf("setsockopt SO_REUSEADDR: %w", err)
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return nil, fmt.Errorf("bind: %w", err)
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	// FileListener duplicates the descriptor, so ours is closed on return.
+	ln, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("file listener: %w", err)
+	}
+	tcpLn, ok := ln.(*net.TCPListener)
+	if !ok {
+		ln.Close()
+		return nil, errors.New("file listener is not tcp")
+	}
+	return tcpLn, nil
+}
+
+// fileTCPConn hands a connected socket over to the runtime poller.
+func fileTCPConn(file *os.File) (*net.TCPConn, error) {
+	// FileConn duplicates the descriptor, so the file is closed by the caller.
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, fmt.Errorf("file conn: %w", err)
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("file conn is not tcp")
+	}
+	return tcpConn, nil
+}
+
+// mptcpError classifies the failure of an MPTCP socket option: plain TCP sockets do not know the option level.
+func mptcpError(err error) error {
+	if errors.Is(err, syscall.ENOPROTOOPT) || errors.Is(err, syscall.EOPNOTSUPP) {
+		return fmt.Errorf("%w: %v", ErrNotMPTCP, err)
+	}
+	return err
+}
+
+// GetMPTCPInfo retrieves the MPTCP_INFO of a connection created by DialMPTCP or accepted from ListenMPTCP.
+func GetMPTCPInfo(conn *net.TCPConn) (*MPTCPInfo, error) {
+	if conn == nil {
+		return nil, ErrNilConn
+	}
+	raw := mptcpInfoRaw{}
+	if err := control(conn, "getsockopt MPTCP_INFO", solMPTCP, func(fd uintptr) error {
+		return getsockoptPtr(fd, solMPTCP, mptcpInfo, unsafe.Pointer(&raw), unsafe.Sizeof(raw))
+	}); err != nil {
+		return nil, mptcpError(err)
+	}
+
+	ms := func(v uint32) time.Duration { return time.Duration(v) * time.Millisecond }
+	return &MPTCPInfo{
+		Subflows:           int(raw.subflows),
+		SubflowsMax:        int(raw.subflowsMax),
+		SubflowsTotal:      int(raw.subflowsTotal),
+		AddAddrSignal:      int(raw.addAddrSignal),
+		AddAddrSignalMax:   int(raw.addAddrSignalMax),
+		AddAddrAccepted:    int(raw.addAddrAccepted),
+		AddAddrAcceptedMax: int(raw.addAddrAcceptedMax),
+		LocalAddrUsed:      int(raw.localAddrUsed),
+		LocalAddrMax:       int(raw.localAddrMax),
+		Fallback:           raw.flags&mptcpInfoFlagFallback != 0,
+		RemoteKeyReceived:  raw.flags&mptcpInfoFlagRemoteKeyReceived != 0,
+		ChecksumEnabled:    raw.csumEnabled != 0,
+		Token:              raw.token,
+		WriteSeq:           raw.writeSeq,
+		SndUna:             raw.sndUna,
+		RcvNxt:             raw.rcvNxt,
+		Retransmits:        raw.retransmits,
+		BytesRetrans:       raw.bytesRetrans,
+		BytesSent:          raw.bytesSent,
+		BytesReceived:      raw.bytesReceived,
+		BytesAcked:         raw.bytesAcked,
+		LastDataSent:       ms(raw.lastDataSent),
+		LastDataRecv:       ms(raw.lastDataRecv),
+		LastAckRecv:        ms(raw.lastAckRecv),
+	}, nil
+}
+
+// getSubflowData retrieves an array of per-subflow structures of size bytes each, returning the number of subflows
+// and the array.
+func getSubflowData(fd uintptr, opt int, size uintptr) (int, []byte, error) {
+	hdr := unsafe.Sizeof(mptcpSubflowData{})
+	buf := make([]byte, hdr+mptcpMaxSubflows*size)
+	data := (*mptcpSubflowData)(unsafe.Pointer(&buf[0]))
+	data.sizeSubflowData = uint32(hdr)
+	data.sizeUser = uint32(size)
+	if err := getsockoptPtr(fd, solMPTCP, opt, unsafe.Pointer(&buf[0]), uintptr(len(buf))); err != nil {
+		return 0, nil, err
+	}
+	n := int(data.numSubflows)
+	if n > mptcpMaxSubflows {
+		n = mptcpMaxSubflows
+	}
+	return n, buf[hdr:], nil
+}
+
+// GetMPTCPSubflows retrieves the addresses and TCP_INFO of each subflow of an MPTCP connection (MPTCP_SUBFLOW_ADDRS
+// and MPTCP_TCPINFO), which requires Linux 5.16. A connection that fell back to plain TCP has no subflows.
+func GetMPTCPSubflows(conn *net.TCPConn) ([]MPTCPSubflow, error) {
+	if conn == nil {
+		return nil, ErrNilConn
+	}
+
+	var subflows []MPTCPSubflow
+	if err := control(conn, "getsockopt MPTCP_TCPINFO", solMPTCP, func(fd uintptr) error {
+		size := unsafe.Sizeof(syscall.TCPInfo{})
+		n, infos, err := getSubflowData(fd, mptcpTCPInfo, size)
+		if err != nil {
+			return err
+		}
+		subflows = make([]MPTCPSubflow, n)
+		for i := range subflows {
+			info := *(*syscall.TCPInfo)(unsafe.Pointer(&infos[uintptr(i)*size]))
+			subflows[i].Info = &info
+		}
+		return nil
+	}); err != nil {
+		return nil, mptcpError(err)
+	}
+
+	if err := control(conn, "getsockopt MPTCP_SUBFLOW_ADDRS", solMPTCP, func(fd uintptr) error {
+		size := unsafe.Sizeof(subflowAddrs{})
+		n, addrs, err := getSubflowData(fd, mptcpSubflowAddrs, size)
+		if err != nil {
+			return err
+		}
+		// A subflow may have come or gone between the two calls, in which case the addresses are not matched up.
+		if n != len(subflows) {
+			return nil
+		}
+		for i := range subflows {
+			a := (*subflowAddrs)(unsafe.Pointer(&addrs[uintptr(i)*size]))
+			subflows[i].Local, subflows[i].Remote = rawTCPAddr(a.local[:]), rawTCPAddr(a.remote[:])
+		}
+		return nil
+	}); err != nil {
+		return nil, mptcpError(err)
+	}
+
+	return subflows, nil
+}
+
+// rawTCPAddr converts a sockaddr_storage, returning nil if it is not an IP address.
+func rawTCPAddr(b []byte) *net.TCPAddr {
+	rsa := (*syscall.RawSockaddrAny)(unsafe.Pointer(&b[0]))
+	switch rsa.Addr.Family {
+	case syscall.AF_INET:
+		sa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		return &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: int(port[0])<<8 | int(port[1])}
+	case syscall.AF_INET6:
+		sa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		addr := &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: int(port[0])<<8 | int(port[1])}
+		if sa.Scope_id != 0 {
+			if ifi, err := net.InterfaceByIndex(int(sa.Scope_id)); err == nil {
+				addr.Zone = ifi.Name
+			}
+		}
+		return addr
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestMPTCP(t *testing.T) {
+	if !MPTCPAvailable() {
+		t.Skipf("mptcp unavailable")
+	}
+	ctx := context.Background()
+
+	ln, err := ListenMPTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+	client, err := DialMPTCP(ctx, "tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer client.Close()
+	server, err := ln.AcceptTCP()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	defer server.Close()
+
+	// Exchange data in both directions, so that the handshake has completed on both sides.
+	buf := make([]byte, 5)
+	for _, c := range [][2]*net.TCPConn{{client, server}, {server, client}} {
+		if _, err := c[0].Write([]byte("hello")); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+		if _, err := io.ReadFull(c[1], buf); err != nil || string(buf) != "hello" {
+			t.Fatalf("got %q, err %v", buf, err)
+		}
+	}
+
+	info, err := GetMPTCPInfo(client)
+	if err != nil {
+		t.Fatalf("info err: %v", err)
+	}
+	if info.Fallback || !info.RemoteKeyReceived || info.Token == 0 {
+		t.Errorf("got %+v, want an established MPTCP connection", info)
+	}
+
+	subflows, err := GetMPTCPSubflows(client)
+	if err != nil {
+		t.Skipf("subflows err: %v", err)
+	}
+	if len(subflows) != 1 {
+		t.Fatalf("got %d subflows, want 1", len(subflows))
+	}
+	if s := subflows[0]; s.Local.String() != client.LocalAddr().String() ||
+		s.Remote.String() != client.RemoteAddr().String() || s.Info.State != 1 {
+		t.Errorf("got subflow %v -> %v in state %d, want %v -> %v established", s.Local, s.Remote, s.Info.State,
+			client.LocalAddr(), client.RemoteAddr())
+	}
+}
+
+func TestMPTCPNotMPTCP(t *testing.T) {
+	conn := loopbackConn(t)
+	if _, err := GetMPTCPInfo(conn); !errors.Is(err, ErrNotMPTCP) {
+		t.Fatalf("got %v, want %v", err, ErrNotMPTCP)
+	}
+}
+
+func TestDialMPTCPRefused(t *testing.T) {
+	if !MPTCPAvailable() {
+		t.Skipf("mptcp unavailable")
+	}
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+	if _, err := DialMPTCP(context.Background(), "tcp4", address); err == nil {
+		t.Fatalf("got no error")
+	}
+}
@@ -0,0 +1,55 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"net"
+	"syscall"
+)
+
+// MSS describes the maximum segment sizes in use on a connection, as reported by TCP_INFO.
+type MSS struct {
+	Advertised uint32 // The MSS advertised to the peer.
+	Send       uint32 // The effective MSS used when sending, after clamping and PMTU discovery.
+	Receive    uint32 // The MSS estimated from the largest segment received from the peer.
+	PathMTU    uint32 // The path MTU currently in use towards the peer.
+}
+
+// MSSFromTCPInfo extracts the maximum segment sizes from already retrieved TCP_INFO.
+func MSSFromTCPInfo(info *syscall.TCPInfo) MSS {
+	return MSS{
+		Advertised: info.Advmss,
+		Send:       info.Snd_mss,
+		Receive:    info.Rcv_mss,
+		PathMTU:    info.Pmtu,
+	}
+}
+
+// GetMSS retrieves the maximum segment sizes in use on an established connection.
+func GetMSS(conn *net.TCPConn) (MSS, error) {
+	info, err := Get(conn)
+	if err != nil {
+		return MSS{}, err
+	}
+	return MSSFromTCPInfo(info), nil
+}
+
+// SetMaxSeg clamps the MSS of the connection (TCP_MAXSEG). Setting it on a listener clamps the MSS advertised by
+// connections accepted afterwards; to clamp the MSS advertised by an outgoing connection use MaxSegControl instead.
+func SetMaxSeg(conn syscall.Conn, mss int) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, mss)
+}
+
+// MaxSegControl returns a function suitable for use as a net.Dialer or net.ListenConfig Control function, which clamps
+// the MSS (TCP_MAXSEG) before the SYN is sent so that the clamped value is advertised during the handshake.
+func MaxSegControl(mss int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return rawSetsockoptInt(c, syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, mss)
+	}
+}
+
+// MaxSeg returns the current MSS clamp of the connection (TCP_MAXSEG). Before the connection is established this is
+// the configured clamp (or the default), afterwards it is the effective send MSS.
+func MaxSeg(conn syscall.Conn) (int, error) {
+	return getsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_MAXSEG)
+}
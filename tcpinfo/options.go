@@ -0,0 +1,113 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"syscall"
+	"time"
+)
+
+// Socket options missing from the syscall package. Their values are identical across all Linux architectures.
+const (
+	tcpUserTimeout  = 0x12 // TCP_USER_TIMEOUT
+	tcpNotSentLowat = 0x19 // TCP_NOTSENT_LOWAT
+)
+
+// boolToInt converts a boolean option value into the form expected by setsockopt.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// SetUserTimeout sets TCP_USER_TIMEOUT, the maximum time transmitted data may remain unacknowledged before the kernel
+// forcibly closes the connection. A zero duration restores the system default.
+func SetUserTimeout(conn syscall.Conn, d time.Duration) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, tcpUserTimeout, int(d/time.Millisecond))
+}
+
+// UserTimeout returns the current TCP_USER_TIMEOUT, with zero meaning the system default is in use.
+func UserTimeout(conn syscall.Conn) (time.Duration, error) {
+	ms, err := getsockoptInt(conn, syscall.IPPROTO_TCP, tcpUserTimeout)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// SetKeepAlive enables or disables the sending of keepalive probes (SO_KEEPALIVE).
+func SetKeepAlive(conn syscall.Conn, enabled bool) error {
+	return setsockoptInt(conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, boolToInt(enabled))
+}
+
+// KeepAlive reports whether keepalive probes are enabled (SO_KEEPALIVE).
+func KeepAlive(conn syscall.Conn) (bool, error) {
+	v, err := getsockoptInt(conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+	return v != 0, err
+}
+
+// SetKeepAliveIdle sets how long the connection must be idle before keepalive probes are sent (TCP_KEEPIDLE). The
+// kernel only has per-second granularity, so the duration is truncated to whole seconds.
+func SetKeepAliveIdle(conn syscall.Conn, d time.Duration) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, int(d/time.Second))
+}
+
+// KeepAliveIdle returns how long the connection must be idle before keepalive probes are sent (TCP_KEEPIDLE).
+func KeepAliveIdle(conn syscall.Conn) (time.Duration, error) {
+	s, err := getsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+	return time.Duration(s) * time.Second, err
+}
+
+// SetKeepAliveInterval sets the time between individual keepalive probes (TCP_KEEPINTVL). The kernel only has
+// per-second granularity, so the duration is truncated to whole seconds.
+func SetKeepAliveInterval(conn syscall.Conn, d time.Duration) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, int(d/time.Second))
+}
+
+// KeepAliveInterval returns the time between individual keepalive probes (TCP_KEEPINTVL).
+func KeepAliveInterval(conn syscall.Conn) (time.Duration, error) {
+	s, err := getsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL)
+	return time.Duration(s) * time.Second, err
+}
+
+// SetKeepAliveCount sets the number of unanswered keepalive probes before the connection is dropped (TCP_KEEPCNT).
+func SetKeepAliveCount(conn syscall.Conn, n int) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, n)
+}
+
+// KeepAliveCount returns the number of unanswered keepalive probes before the connection is dropped (TCP_KEEPCNT).
+func KeepAliveCount(conn syscall.Conn) (int, error) {
+	return getsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT)
+}
+
+// SetNoDelay enables or disables Nagle's algorithm (TCP_NODELAY), with true meaning segments are sent immediately.
+func SetNoDelay(conn syscall.Conn, enabled bool) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, boolToInt(enabled))
+}
+
+// NoDelay reports whether Nagle's algorithm is disabled (TCP_NODELAY).
+func NoDelay(conn syscall.Conn) (bool, error) {
+	v, err := getsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	return v != 0, err
+}
+
+// SetQuickAck enables or disables quickack mode (TCP_QUICKACK). The kernel may leave quickack mode of its own accord,
+// so callers wanting it permanently must set it again after each read.
+func SetQuickAck(conn syscall.Conn, enabled bool) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_QUICKACK, boolToInt(enabled))
+}
+
+// QuickAck reports whether the connection is currently in quickack mode (TCP_QUICKACK).
+func QuickAck(conn syscall.Conn) (bool, error) {
+	v, err := getsockoptInt(conn, syscall.IPPROTO_TCP, syscall.TCP_QUICKACK)
+	return v != 0, err
+}
+
+// SetNotSentLowat limits the number of unsent bytes queued in the socket (TCP_NOTSENT_LOWAT), after which the socket
+// stops reporting itself as writable.
+func SetNotSentLowat(conn syscall.Conn, bytes int) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, tcpNotSentLowat, bytes)
+}
+
+// NotSentLowat returns the limit on unsent bytes queued in the socket (TCP_NOTSENT_LOWAT).
+func NotSentLowat(conn syscall.Conn) (int, error) {
+	return getsockoptInt(conn, syscall.IPPROTO_TCP, tcpNotSentLowat)
+}
@@ -0,0 +1,58 @@
+// +build !linux
+
+package tcpinfo
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// The socket option helpers are only implemented on Linux; elsewhere they return ErrUnsupportedPlatform so that
+// callers can still be built, and decide at runtime what to do without them.
+
+func SetUserTimeout(conn syscall.Conn, d time.Duration) error         { return ErrUnsupportedPlatform }
+func UserTimeout(conn syscall.Conn) (time.Duration, error)            { return 0, ErrUnsupportedPlatform }
+func SetKeepAlive(conn syscall.Conn, enabled bool) error              { return ErrUnsupportedPlatform }
+func KeepAlive(conn syscall.Conn) (bool, error)                       { return false, ErrUnsupportedPlatform }
+func SetKeepAliveIdle(conn syscall.Conn, d time.Duration) error       { return ErrUnsupportedPlatform }
+func KeepAliveIdle(conn syscall.Conn) (time.Duration, error)          { return 0, ErrUnsupportedPlatform }
+func SetKeepAliveInterval(conn syscall.Conn, d time.Duration) error   { return ErrUnsupportedPlatform }
+func KeepAliveInterval(conn syscall.Conn) (time.Duration, error)      { return 0, ErrUnsupportedPlatform }
+func SetKeepAliveCount(conn syscall.Conn, n int) error                { return ErrUnsupportedPlatform }
+func KeepAliveCount(conn syscall.Conn) (int, error)                   { return 0, ErrUnsupportedPlatform }
+func SetNoDelay(conn syscall.Conn, enabled bool) error                { return ErrUnsupportedPlatform }
+func NoDelay(conn syscall.Conn) (bool, error)                         { return false, ErrUnsupportedPlatform }
+func SetQuickAck(conn syscall.Conn, enabled bool) error               { return ErrUnsupportedPlatform }
+func QuickAck(conn syscall.Conn) (bool, error)                        { return false, ErrUnsupportedPlatform }
+func SetNotSentLowat(conn syscall.Conn, bytes int) error              { return ErrUnsupportedPlatform }
+func NotSentLowat(conn syscall.Conn) (int, error)                     { return 0, ErrUnsupportedPlatform }
+func SetMaxSeg(conn syscall.Conn, mss int) error                      { return ErrUnsupportedPlatform }
+func MaxSeg(conn syscall.Conn) (int, error)                           { return 0, ErrUnsupportedPlatform }
+func SetSendBuffer(conn syscall.Conn, bytes int) error                { return ErrUnsupportedPlatform }
+func SendBuffer(conn syscall.Conn) (int, error)                       { return 0, ErrUnsupportedPlatform }
+func SetRecvBuffer(conn syscall.Conn, bytes int) error                { return ErrUnsupportedPlatform }
+func RecvBuffer(conn syscall.Conn) (int, error)                       { return 0, ErrUnsupportedPlatform }
+func SetSaveSYN(conn syscall.Conn, enabled bool) error                { return ErrUnsupportedPlatform }
+func SaveSYNControl(network, address string, c syscall.RawConn) error { return ErrUnsupportedPlatform }
+func GetFingerprint(conn *net.TCPConn) (*Fingerprint, error)          { return nil, ErrUnsupportedPlatform }
+func SavedSYN(conn *net.TCPConn) ([]byte, error)                      { return nil, ErrUnsupportedPlatform }
+func GetSYN(conn *net.TCPConn) (*SYN, error)                          { return nil, ErrUnsupportedPlatform }
+func GetECN(conn *net.TCPConn) (ECN, error)                           { return ECN{}, ErrUnsupportedPlatform }
+func SetCongestion(conn syscall.Conn, name string) error              { return ErrUnsupportedPlatform }
+func Congestion(conn syscall.Conn) (string, error)                    { return "", ErrUnsupportedPlatform }
+func ECNControl(congestion string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error { return ErrUnsupportedPlatform }
+}
+func SetFastOpen(conn syscall.Conn, qlen int) error { return ErrUnsupportedPlatform }
+func FastOpenControl(qlen int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error { return ErrUnsupportedPlatform }
+}
+func FastOpenConnectControl(network, address string, c syscall.RawConn) error {
+	return ErrUnsupportedPlatform
+}
+func DialFastOpen(ctx context.Context, d *net.Dialer, network, address string, data []byte) (*net.TCPConn, error) {
+	return nil, ErrUnsupportedPlatform
+}
+func GetFastOpen(conn *net.TCPConn) (FastOpen, error) { return FastOpen{}, ErrUnsupportedPlatform }
@@ -0,0 +1,159 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// loopbackConn returns the client side of an established TCP connection over the loopback interface.
+func loopbackConn(t *testing.T) *net.TCPConn {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	// The kernel completes the handshake before Accept is called, so there is no need for a separate goroutine.
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	peer, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	return conn.(*net.TCPConn)
+}
+
+func TestOptions(t *testing.T) {
+	conn := loopbackConn(t)
+
+	t.Run("UserTimeout", func(t *testing.T) {
+		if err := SetUserTimeout(conn, 1500*time.Millisecond); err != nil {
+			t.Fatalf("set err: %v", err)
+		}
+		got, err := UserTimeout(conn)
+		if err != nil || got != 1500*time.Millisecond {
+			t.Fatalf("got %v, err %v", got, err)
+		}
+	})
+
+	t.Run("KeepAlive", func(t *testing.T) {
+		if err := SetKeepAlive(conn, true); err != nil {
+			t.Fatalf("set err: %v", err)
+		}
+		if err := SetKeepAliveIdle(conn, 30*time.Second); err != nil {
+			t.Fatalf("set idle err: %v", err)
+		}
+		if err := SetKeepAliveInterval(conn, 5*time.Second); err != nil {
+			t.Fatalf("set interval err: %v", err)
+		}
+		if err := SetKeepAliveCount(conn, 3); err != nil {
+			t.Fatalf("set count err: %v", err)
+		}
+
+		if got, err := KeepAlive(conn); err != nil || !got {
+			t.Fatalf("enabled: got %v, err %v", got, err)
+		}
+		if got, err := KeepAliveIdle(conn); err != nil || got != 30*time.Second {
+			t.Fatalf("idle: got %v, err %v", got, err)
+		}
+		if got, err := KeepAliveInterval(conn); err != nil || got != 5*time.Second {
+			t.Fatalf("interval: got %v, err %v", got, err)
+		}
+		if got, err := KeepAliveCount(conn); err != nil || got != 3 {
+			t.Fatalf("count: got %v, err %v", got, err)
+		}
+	})
+
+	t.Run("NoDelay", func(t *testing.T) {
+		for _, want := range []bool{false, true} {
+			if err := SetNoDelay(conn, want); err != nil {
+				t.Fatalf("set err: %v", err)
+			}
+			if got, err := NoDelay(conn); err != nil || got != want {
+				t.Fatalf("got %v, want %v, err %v", got, want, err)
+			}
+		}
+	})
+
+	t.Run("NotSentLowat", func(t *testing.T) {
+		if err := SetNotSentLowat(conn, 16384); err != nil {
+			t.Fatalf("set err: %v", err)
+		}
+		if got, err := NotSentLowat(conn); err != nil || got != 16384 {
+			t.Fatalf("got %v, err %v", got, err)
+		}
+	})
+
+	t.Run("NilConn", func(t *testing.T) {
+		if err := SetNoDelay(nil, true); err == nil {
+			t.Fatalf("expected error for nil conn")
+		}
+	})
+}
+
+func TestMaxSegControl(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+
+	dialer := net.Dialer{Control: MaxSegControl(1200)}
+	conn, err := dialer.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer conn.Close()
+
+	peer, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	defer peer.Close()
+
+	// The peer should only ever send segments that fit within the clamped MSS that was advertised to it.
+	mss, err := GetMSS(peer.(*net.TCPConn))
+	if err != nil {
+		t.Fatalf("get mss err: %v", err)
+	}
+	if mss.Send == 0 || mss.Send > 1200 {
+		t.Fatalf("peer send mss: got %d, want 1..1200", mss.Send)
+	}
+}
+
+func TestMemInfo(t *testing.T) {
+	conn := loopbackConn(t)
+
+	if err := SetRecvBuffer(conn, 65536); err != nil {
+		t.Fatalf("set err: %v", err)
+	}
+	rcvBuf, err := RecvBuffer(conn)
+	if err != nil {
+		t.Fatalf("get err: %v", err)
+	}
+
+	info, memInfo, err := GetWithMemInfo(conn)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info == nil {
+		t.Fatalf("nil tcp info")
+	}
+	if int(memInfo.RcvBuf) != rcvBuf {
+		t.Fatalf("meminfo rcvbuf: got %d, want %d", memInfo.RcvBuf, rcvBuf)
+	}
+	if memInfo.RecvUtilization() != 0 {
+		t.Fatalf("idle socket utilization: got %v, want 0", memInfo.RecvUtilization())
+	}
+}
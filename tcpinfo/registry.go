@@ -0,0 +1,153 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Sample is the TCP_INFO of a single connection, as retrieved by GetAll or a Registry snapshot.
+type Sample struct {
+	Conn *net.TCPConn
+	Info syscall.TCPInfo
+	Err  error
+}
+
+// GetAll retrieves the TCP_INFO of every supplied connection. Failures are reported per connection in the Err field
+// of the corresponding sample, so that one closed connection does not prevent the others being sampled.
+func GetAll(conns []*net.TCPConn) []Sample {
+	samples := make([]Sample, len(conns))
+	for i, conn := range conns {
+		samples[i].Conn = conn
+		info, err := Get(conn)
+		if err != nil {
+			samples[i].Err = err
+			continue
+		}
+		samples[i].Info = *info
+	}
+	return samples
+}
+
+// registryEntry caches everything needed to sample a connection, so that repeated sampling does not allocate.
+type registryEntry struct {
+	conn    *net.TCPConn
+	rawConn syscall.RawConn
+	info    syscall.TCPInfo
+	err     error
+	fn      func(fd uintptr)
+}
+
+// Registry tracks a set of connections, typically every connection held open by a server, so that their TCP_INFO can
+// be sampled together at regular intervals. Sampling reuses buffers from previous snapshots, making it much cheaper
+// than calling Get for each connection. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	entries []*registryEntry
+	index   map[*net.TCPConn]int
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		index: make(map[*net.TCPConn]int),
+	}
+}
+
+// Add starts tracking a connection. Adding a connection that is already tracked has no effect.
+func (r *Registry) Add(conn *net.TCPConn) error {
+	if conn == nil {
+		return ErrNilConn
+	}
+
+	// Fetch the underlying raw connection once, rather than on every snapshot.
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return newError("syscallconn", syscall.IPPROTO_TCP, err)
+	}
+
+	entry := &registryEntry{
+		conn:    conn,
+		rawConn: rawConn,
+	}
+	entry.fn = func(fd uintptr) {
+		entry.err = getsockoptPtr(fd, syscall.IPPROTO_TCP, syscall.TCP_INFO, unsafe.Pointer(&entry.info),
+			unsafe.Sizeof(entry.info))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.index[conn]; ok {
+		return nil
+	}
+	r.index[conn] = len(r.entries)
+	r.entries = append(r.entries, entry)
+
+	return nil
+}
+
+// Remove stops tracking a connection.
+func (r *Registry) Remove(conn *net.TCPConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remove(conn)
+}
+
+// remove stops tracking a connection, moving the last entry into its place. The caller must hold the lock.
+func (r *Registry) remove(conn *net.TCPConn) {
+	i, ok := r.index[conn]
+	if !ok {
+		return
+	}
+	last := len(r.entries) - 1
+	r.entries[i] = r.entries[last]
+	r.index[r.entries[i].conn] = i
+	r.entries[last] = nil
+	r.entries = r.entries[:last]
+	delete(r.index, conn)
+}
+
+// Len returns the number of connections being tracked.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// Snapshot samples every tracked connection, appending the results to dst and returning the extended slice. Passing
+// the previous snapshot truncated to zero length (dst[:0]) reuses its memory. Connections found to have been closed
+// are reported one last time, with an error matching ErrClosed, and are then no longer tracked.
+func (r *Registry) Snapshot(dst []Sample) []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var closed []*net.TCPConn
+	for _, entry := range r.entries {
+		var err error
+		if controlErr := entry.rawConn.Control(entry.fn); controlErr != nil {
+			err = newError("getsockopt TCP_INFO", syscall.IPPROTO_TCP, controlErr)
+		} else if entry.err != nil {
+			err = newError("getsockopt TCP_INFO", syscall.IPPROTO_TCP, entry.err)
+		}
+		if err != nil {
+			if errors.Is(err, ErrClosed) {
+				closed = append(closed, entry.conn)
+			}
+			dst = append(dst, Sample{Conn: entry.conn, Err: err})
+			continue
+		}
+
+		dst = append(dst, Sample{Conn: entry.conn, Info: entry.info})
+	}
+
+	// Stop tracking the closed connections only once iteration has finished, as removal reorders the entries.
+	for _, conn := range closed {
+		r.remove(conn)
+	}
+
+	return dst
+}
@@ -0,0 +1,110 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	conns := []*net.TCPConn{loopbackConn(t), loopbackConn(t), loopbackConn(t)}
+	for _, conn := range conns {
+		if err := r.Add(conn); err != nil {
+			t.Fatalf("add err: %v", err)
+		}
+	}
+	// Adding the same connection twice should not track it twice.
+	if err := r.Add(conns[0]); err != nil || r.Len() != 3 {
+		t.Fatalf("duplicate add: len %d, err %v", r.Len(), err)
+	}
+
+	samples := r.Snapshot(nil)
+	if len(samples) != 3 {
+		t.Fatalf("got %d samples, want 3", len(samples))
+	}
+	for _, s := range samples {
+		if s.Err != nil || s.Info.State != 1 { // TCP_ESTABLISHED
+			t.Fatalf("sample for %v: state %d, err %v", s.Conn.LocalAddr(), s.Info.State, s.Err)
+		}
+	}
+
+	// A closed connection should be reported once, then forgotten.
+	conns[1].Close()
+	samples = r.Snapshot(samples[:0])
+	var closed int
+	for _, s := range samples {
+		if errors.Is(s.Err, ErrClosed) {
+			closed++
+		}
+	}
+	if closed != 1 || r.Len() != 2 {
+		t.Fatalf("got %d closed samples and %d tracked, want 1 and 2", closed, r.Len())
+	}
+
+	// Snapshots into a reused slice should not allocate.
+	allocs := testing.AllocsPerRun(100, func() {
+		samples = r.Snapshot(samples[:0])
+	})
+	if allocs != 0 {
+		t.Fatalf("snapshot allocated %v times, want 0", allocs)
+	}
+
+	r.Remove(conns[0])
+	if r.Len() != 1 {
+		t.Fatalf("len after remove: got %d, want 1", r.Len())
+	}
+}
+
+func benchmarkConns(b *testing.B, n int) []*net.TCPConn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("listen err: %v", err)
+	}
+	b.Cleanup(func() { ln.Close() })
+
+	conns := make([]*net.TCPConn, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			b.Fatalf("dial err: %v", err)
+		}
+		peer, err := ln.Accept()
+		if err != nil {
+			b.Fatalf("accept err: %v", err)
+		}
+		b.Cleanup(func() {
+			conn.Close()
+			peer.Close()
+		})
+		conns = append(conns, conn.(*net.TCPConn))
+	}
+	return conns
+}
+
+func BenchmarkGetAll(b *testing.B) {
+	conns := benchmarkConns(b, 100)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		GetAll(conns)
+	}
+}
+
+func BenchmarkRegistrySnapshot(b *testing.B) {
+	conns := benchmarkConns(b, 100)
+	r := NewRegistry()
+	for _, conn := range conns {
+		if err := r.Add(conn); err != nil {
+			b.Fatal(err)
+		}
+	}
+	var samples []Sample
+	b.ResetTimer()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		samples = r.Snapshot(samples[:0])
+	}
+}
@@ -0,0 +1,397 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// TCP repair socket options and ioctls missing from the syscall package.
+const (
+	tcpRepair        = 0x13 // TCP_REPAIR
+	tcpRepairQueue   = 0x14 // TCP_REPAIR_QUEUE
+	tcpQueueSeq      = 0x15 // TCP_QUEUE_SEQ
+	tcpRepairOptions = 0x16 // TCP_REPAIR_OPTIONS
+	tcpTimestamp     = 0x18 // TCP_TIMESTAMP
+	tcpRepairWindow  = 0x1d // TCP_REPAIR_WINDOW
+
+	tcpRecvQueue = 1 // TCP_RECV_QUEUE
+	tcpSendQueue = 2 // TCP_SEND_QUEUE
+
+	siocInQ     = 0x541b // SIOCINQ
+	siocOutQ    = 0x5411 // SIOCOUTQ
+	siocOutQNSD = 0x894b // SIOCOUTQNSD
+
+	tcpiOptTimestamps = 0x1 // TCPI_OPT_TIMESTAMPS
+	tcpiOptSACK       = 0x2 // TCPI_OPT_SACK
+	tcpiOptWScale     = 0x4 // TCPI_OPT_WSCALE
+
+	tcpOptMaxSeg    = 2 // TCPOPT_MAXSEG
+	tcpOptWindow    = 3 // TCPOPT_WINDOW
+	tcpOptSACKPerm  = 4 // TCPOPT_SACK_PERM
+	tcpOptTimestamp = 8 // TCPOPT_TIMESTAMP
+)
+
+// RepairWindow is the window state of a connection, as reported by TCP_REPAIR_WINDOW.
+type RepairWindow struct {
+	SndWl1    uint32
+	SndWnd    uint32
+	MaxWindow uint32
+	RcvWnd    uint32
+	RcvWup    uint32
+}
+
+// RepairState is everything needed to re-create an established connection on another socket, potentially in
+// another process or on another host that has taken over the local address.
+type RepairState struct {
+	Local  *net.TCPAddr
+	Remote *net.TCPAddr
+
+	// SendSeq is the sequence number of the first byte of SendQueue, and RecvSeq that of the first byte of RecvQueue.
+	SendSeq uint32
+	RecvSeq uint32
+
+	// SendQueue holds data written by the application but not yet acknowledged by the peer, the last NotSent bytes
+	// of which have never been transmitted. RecvQueue holds data received but not yet read by the application.
+	SendQueue []byte
+	NotSent   int
+	RecvQueue []byte
+
+	// Options negotiated during the handshake.
+	MSS        uint32
+	SACK       bool
+	Timestamps bool
+	WScale     bool
+	SendWScale uint8
+	RecvWScale uint8
+
+	// Timestamp is the current TCP timestamp clock of the socket, only meaningful if Timestamps is set.
+	Timestamp uint32
+
+	// Window is the window state, or nil if the kernel does not support TCP_REPAIR_WINDOW (before Linux 4.8).
+	Window *RepairWindow
+}
+
+// repairIoctl retrieves an integer via ioctl, used for the queue lengths.
+func repairIoctl(fd uintptr, req uintptr) (int, error) {
+	var v int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(&v))); errno != 0 {
+		return 0, errno
+	}
+	return int(v), nil
+}
+
+// repairPeekQueue reads the entire contents of a queue without consuming it. The socket must be in repair mode.
+func repairPeekQueue(fd uintptr, queue int, length int) (seq uint32, data []byte, err error) {
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpRepairQueue, queue); err != nil {
+		return 0, nil, fmt.Errorf("select queue %d: %w", queue, err)
+	}
+	if err := getsockoptPtr(fd, syscall.IPPROTO_TCP, tcpQueueSeq, unsafe.Pointer(&seq),
+		unsafe.Sizeof(seq)); err != nil {
+		return 0, nil, fmt.Errorf("queue %d seq: %w", queue, err)
+	}
+	if length == 0 {
+		return seq, nil, nil
+	}
+
+	data = make([]byte, length)
+	n, _, err := syscall.Recvfrom(int(fd), data, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+	if err != nil {
+		return 0, nil, fmt.Errorf("queue %d peek: %w", queue, err)
+	}
+	if n != length {
+		return 0, nil, fmt.Errorf("queue %d peek: got %d bytes, want %d", queue, n, length)
+	}
+
+	return seq, data, nil
+}
+
+// Export freezes an established connection using TCP_REPAIR and extracts the state needed to re-create it with
+// Import. This requires CAP_NET_ADMIN. On success the connection is left in repair mode, so closing it afterwards
+// discards it silently rather than notifying the peer; on failure repair mode is switched off again.
+func Export(conn *net.TCPConn) (*RepairState, error) {
+	if conn == nil {
+		return nil, ErrNilConn
+	}
+	local, ok := conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, errors.New("conn has no local address")
+	}
+	remote, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, errors.New("conn has no remote address")
+	}
+
+	// Grab the negotiated options before freezing the connection.
+	info, err := Get(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RepairState{
+		Local:      local,
+		Remote:     remote,
+		MSS:        info.Snd_mss,
+		SACK:       info.Options&tcpiOptSACK != 0,
+		Timestamps: info.Options&tcpiOptTimestamps != 0,
+		WScale:     info.Options&tcpiOptWScale != 0,
+	}
+	state.SendWScale, state.RecvWScale = windowScales(info)
+
+	if err := control(conn, "export", syscall.IPPROTO_TCP, func(fd uintptr) error {
+		return exportRepair(fd, state)
+	}); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// exportRepair does the work of Export once the file descriptor is available.
+func exportRepair(fd uintptr, state *RepairState) (err error) {
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpRepair, 1); err != nil {
+		return fmt.Errorf("enter repair mode: %w", err)
+	}
+	// If anything goes wrong, leave repair mode so that the connection carries on as it was.
+	defer func() {
+		if err != nil {
+			syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpRepair, 0)
+		}
+	}()
+
+	// Measure the queues now that the connection is frozen.
+	inQ, err := repairIoctl(fd, siocInQ)
+	if err != nil {
+		return fmt.Errorf("recv queue length: %w", err)
+	}
+	outQ, err := repairIoctl(fd, siocOutQ)
+	if err != nil {
+		return fmt.Errorf("send queue length: %w", err)
+	}
+	notSent, err := repairIoctl(fd, siocOutQNSD)
+	if err != nil {
+		return fmt.Errorf("send queue unsent length: %w", err)
+	}
+	state.NotSent = notSent
+
+	// The queue sequence numbers are those following the last byte of each queue, but callers want the first.
+	recvSeq, recvQueue, err := repairPeekQueue(fd, tcpRecvQueue, inQ)
+	if err != nil {
+		return err
+	}
+	state.RecvSeq = recvSeq - uint32(inQ)
+	state.RecvQueue = recvQueue
+
+	sendSeq, sendQueue, err := repairPeekQueue(fd, tcpSendQueue, outQ)
+	if err != nil {
+		return err
+	}
+	state.SendSeq = sendSeq - uint32(outQ)
+	state.SendQueue = sendQueue
+
+	if state.Timestamps {
+		if err := getsockoptPtr(fd, syscall.IPPROTO_TCP, tcpTimestamp, unsafe.Pointer(&state.Timestamp),
+			unsafe.Sizeof(state.Timestamp)); err != nil {
+			return fmt.Errorf("timestamp: %w", err)
+		}
+	}
+
+	// The window state is only available on newer kernels, so its absence is not fatal.
+	window := &RepairWindow{}
+	if err := getsockoptPtr(fd, syscall.IPPROTO_TCP, tcpRepairWindow, unsafe.Pointer(window),
+		unsafe.Sizeof(*window)); err == nil {
+		state.Window = window
+	}
+
+	return nil
+}
+
+// Import re-creates a connection from the state extracted by Export, without any packets being exchanged with the
+// peer. This requires CAP_NET_ADMIN, and the local address of the state must be available to bind to, so the exported
+// connection must have been closed first if it was on the same host.
+func Import(state *RepairState) (*net.TCPConn, error) {
+	if state == nil || state.Local == nil || state.Remote == nil {
+		return nil, errors.New("incomplete repair state")
+	}
+	if state.NotSent < 0 || state.NotSent > len(state.SendQueue) {
+		return nil, fmt.Errorf("invalid unsent length %d for send queue of %d bytes", state.NotSent,
+			len(state.SendQueue))
+	}
+
+	family := syscall.AF_INET
+	if state.Local.IP.To4() == nil {
+		family = syscall.AF_INET6
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, syscall.IPPROTO_TCP)
+	if err != nil {
+		return nil, fmt.Errorf("socket: %w", err)
+	}
+	file := os.NewFile(uintptr(fd), "tcprepair")
+	defer file.Close()
+
+	if err := importRepair(fd, family, state); err != nil {
+		return nil, err
+	}
+
+	// Leave repair mode, making the connection live. The unsent data is then written normally so that the kernel
+	// transmits it, whereas the data already sent was placed in the queue silently.
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpRepair, 0); err != nil {
+		return nil, fmt.Errorf("leave repair mode: %w", err)
+	}
+	if state.NotSent > 0 {
+		if _, err := syscall.Write(fd, state.SendQueue[len(state.SendQueue)-state.NotSent:]); err != nil {
+			return nil, fmt.Errorf("write unsent data: %w", err)
+		}
+	}
+
+	// Hand the socket over to the runtime poller; FileConn duplicates the descriptor, so ours is closed on return.
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, fmt.Errorf("file conn: %w", err)
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("file conn is not tcp")
+	}
+
+	return tcpConn, nil
+}
+
+// importRepair does the work of Import while the new socket is in repair mode.
+func importRepair(fd int, family int, state *RepairState) error {
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpRepair, 1); err != nil {
+		return fmt.Errorf("enter repair mode: %w", err)
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return fmt.Errorf("reuseaddr: %w", err)
+	}
+
+	// Restore the sequence numbers, which must be done before connecting.
+	for _, q := range []struct {
+		queue int
+		seq   uint32
+	}{
+		{tcpRecvQueue, state.RecvSeq},
+		{tcpSendQueue, state.SendSeq},
+	} {
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpRepairQueue, q.queue); err != nil {
+			return fmt.Errorf("select queue %d: %w", q.queue, err)
+		}
+		seq := q.seq
+		if err := setsockoptPtr(uintptr(fd), syscall.IPPROTO_TCP, tcpQueueSeq, unsafe.Pointer(&seq),
+			unsafe.Sizeof(seq)); err != nil {
+			return fmt.Errorf("queue %d seq: %w", q.queue, err)
+		}
+	}
+
+	// In repair mode, binding and connecting simply set up the addresses without sending anything.
+	local, err := sockaddr(family, state.Local)
+	if err != nil {
+		return err
+	}
+	remote, err := sockaddr(family, state.Remote)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Bind(fd, local); err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+	if err := syscall.Connect(fd, remote); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	// Restore the options negotiated in the original handshake.
+	type repairOpt struct {
+		code uint32
+		val  uint32
+	}
+	opts := []repairOpt{{tcpOptMaxSeg, state.MSS}}
+	if state.WScale {
+		opts = append(opts, repairOpt{tcpOptWindow, uint32(state.SendWScale) | uint32(state.RecvWScale)<<16})
+	}
+	if state.SACK {
+		opts = append(opts, repairOpt{tcpOptSACKPerm, 0})
+	}
+	if state.Timestamps {
+		opts = append(opts, repairOpt{tcpOptTimestamp, 0})
+	}
+	if err := setsockoptPtr(uintptr(fd), syscall.IPPROTO_TCP, tcpRepairOptions, unsafe.Pointer(&opts[0]),
+		uintptr(len(opts))*unsafe.Sizeof(opts[0])); err != nil {
+		return fmt.Errorf("options: %w", err)
+	}
+	if state.Timestamps {
+		ts := state.Timestamp
+		if err := setsockoptPtr(uintptr(fd), syscall.IPPROTO_TCP, tcpTimestamp, unsafe.Pointer(&ts),
+			unsafe.Sizeof(ts)); err != nil {
+			return fmt.Errorf("timestamp: %w", err)
+		}
+	}
+
+	// Refill the queues. Writes in repair mode go straight into the selected queue without being transmitted.
+	sent := state.SendQueue[:len(state.SendQueue)-state.NotSent]
+	for _, q := range []struct {
+		queue int
+		data  []byte
+	}{
+		{tcpRecvQueue, state.RecvQueue},
+		{tcpSendQueue, sent},
+	} {
+		if len(q.data) == 0 {
+			continue
+		}
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpRepairQueue, q.queue); err != nil {
+			return fmt.Errorf("select queue %d: %w", q.queue, err)
+		}
+		for data := q.data; len(data) > 0; {
+			n, err := syscall.Write(fd, data)
+			if err != nil {
+				return fmt.Errorf("fill queue %d: %w", q.queue, err)
+			}
+			data = data[n:]
+		}
+	}
+
+	if state.Window != nil {
+		window := *state.Window
+		if err := setsockoptPtr(uintptr(fd), syscall.IPPROTO_TCP, tcpRepairWindow, unsafe.Pointer(&window),
+			unsafe.Sizeof(window)); err != nil {
+			return fmt.Errorf("window: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// sockaddr converts a TCP address into the form needed by the raw socket calls.
+func sockaddr(family int, addr *net.TCPAddr) (syscall.Sockaddr, error) {
+	if family == syscall.AF_INET {
+		ip := addr.IP.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("address family mismatch: %v", addr)
+		}
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip)
+		return sa, nil
+	}
+
+	ip := addr.IP.To16()
+	if ip == nil || addr.IP.To4() != nil {
+		return nil, fmt.Errorf("address family mismatch: %v", addr)
+	}
+	sa := &syscall.SockaddrInet6{Port: addr.Port}
+	copy(sa.Addr[:], ip)
+	if addr.Zone != "" {
+		ifi, err := net.InterfaceByName(addr.Zone)
+		if err != nil {
+			return nil, fmt.Errorf("zone %q: %w", addr.Zone, err)
+		}
+		sa.ZoneId = uint32(ifi.Index)
+	}
+	return sa, nil
+}
@@ -0,0 +1,87 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRepairRoundTrip(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	peer, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	defer peer.Close()
+
+	// Leave some data unread in the receive queue of the connection being migrated.
+	if _, err := peer.Write([]byte("queued")); err != nil {
+		t.Fatalf("peer write err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	state, err := Export(conn.(*net.TCPConn))
+	if errors.Is(err, syscall.EPERM) {
+		conn.Close()
+		t.Skip("TCP_REPAIR requires CAP_NET_ADMIN")
+	}
+	if err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+	if string(state.RecvQueue) != "queued" {
+		t.Fatalf("recv queue: got %q, want %q", state.RecvQueue, "queued")
+	}
+
+	// Closing a socket in repair mode does not notify the peer, freeing the address for the new socket.
+	conn.Close()
+
+	migrated, err := Import(state)
+	if err != nil {
+		t.Fatalf("import err: %v", err)
+	}
+	defer migrated.Close()
+
+	// The restored receive queue should be readable, and new data should flow in both directions.
+	buf := make([]byte, len("queued"))
+	if _, err := io.ReadFull(migrated, buf); err != nil || string(buf) != "queued" {
+		t.Fatalf("migrated read: got %q, err %v", buf, err)
+	}
+	if _, err := migrated.Write([]byte("hello")); err != nil {
+		t.Fatalf("migrated write err: %v", err)
+	}
+	buf = make([]byte, len("hello"))
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(peer, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("peer read: got %q, err %v", buf, err)
+	}
+}
+
+func TestWindowScales(t *testing.T) {
+	conn := loopbackConn(t)
+	info, err := Get(conn)
+	if err != nil {
+		t.Fatalf("get err: %v", err)
+	}
+	if info.Options&tcpiOptWScale == 0 {
+		t.Skip("window scaling not negotiated")
+	}
+	// Both ends of a loopback connection are the same kernel, so scale their windows alike.
+	send, recv := windowScales(info)
+	if send != recv || send == 0 || send > 14 {
+		t.Fatalf("got send scale %d and receive scale %d", send, recv)
+	}
+}
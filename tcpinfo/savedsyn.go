@@ -0,0 +1,108 @@
+package tcpinfo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/dotwaffle/inettools/packet"
+	"net"
+)
+
+// SYN is the SYN that opened an accepted connection, as saved by the kernel with TCP_SAVE_SYN.
+type SYN struct {
+	Header  []byte // The IP header, followed by the TCP header, as received.
+	Version int    // The IP version, 4 or 6.
+	Src     net.IP
+	Dst     net.IP
+	SrcPort uint16
+	DstPort uint16
+	TTL     uint8 // The TTL or hop limit.
+	Window  uint16
+	Options []packet.TCPOption // The TCP options in the order they were sent, without padding.
+
+	MSS           int  // The maximum segment size, or -1 if there is no MSS option.
+	WindowScale   int  // The window scale, or -1 if there is no window scale option.
+	SACKPermitted bool // Whether selective acknowledgments were offered.
+	Timestamps    bool // Whether timestamps were offered, in which case TSVal and TSEcr hold them.
+	TSVal         uint32
+	TSEcr         uint32
+	FastOpen      bool // Whether a TCP Fast Open option, with or without a cookie, was sent.
+}
+
+// splitSYN splits the headers of a SYN into the IP and TCP headers, checking that both are complete.
+func splitSYN(b []byte) (version int, ip []byte, tcp packet.TCP, err error) {
+	if len(b) == 0 {
+		return 0, nil, nil, fmt.Errorf("empty syn")
+	}
+	switch version = int(b[0] >> 4); version {
+	case 4:
+		hl := packet.IPv4(b).HeaderLen()
+		if len(b) < packet.IPv4MinLen || hl < packet.IPv4MinLen || hl > len(b) {
+			return 0, nil, nil, fmt.Errorf("ipv4 header truncated")
+		}
+		ip, tcp = b[:hl], packet.TCP(b[hl:])
+	case 6:
+		if len(b) < packet.IPv6HeaderLen {
+			return 0, nil, nil, fmt.Errorf("ipv6 header truncated")
+		}
+		if nh := packet.IPv6(b).NextHeader(); nh != packet.ProtocolTCP {
+			return 0, nil, nil, fmt.Errorf("unsupported ipv6 next header %d", nh)
+		}
+		ip, tcp = b[:packet.IPv6HeaderLen], packet.TCP(b[packet.IPv6HeaderLen:])
+	default:
+		return 0, nil, nil, fmt.Errorf("invalid ip version %d", version)
+	}
+	if err := tcp.Valid(); err != nil {
+		return 0, nil, nil, err
+	}
+	if tcp.Flags()&packet.TCPFlagSYN == 0 {
+		return 0, nil, nil, fmt.Errorf("not a syn")
+	}
+	return version, ip, tcp, nil
+}
+
+// ParseSYN parses the IPv4 or IPv6 header and TCP header of a SYN, as returned by TCP_SAVED_SYN. IPv6 extension
+// headers are not supported.
+func ParseSYN(b []byte) (*SYN, error) {
+	version, ip, tcp, err := splitSYN(b)
+	if err != nil {
+		return nil, err
+	}
+	s := &SYN{
+		Header:      b,
+		Version:     version,
+		SrcPort:     tcp.SrcPort(),
+		DstPort:     tcp.DstPort(),
+		Window:      tcp.Window(),
+		MSS:         -1,
+		WindowScale: -1,
+	}
+	if version == 4 {
+		s.Src, s.Dst, s.TTL = packet.IPv4(ip).Src(), packet.IPv4(ip).Dst(), packet.IPv4(ip).TTL()
+	} else {
+		s.Src, s.Dst, s.TTL = packet.IPv6(ip).Src(), packet.IPv6(ip).Dst(), packet.IPv6(ip).HopLimit()
+	}
+	if s.Options, err = packet.ParseTCPOptions(tcp.Options()); err != nil {
+		return nil, err
+	}
+	for _, opt := range s.Options {
+		switch {
+		case opt.Kind == packet.TCPOptionMSS && len(opt.Data) == 2:
+			s.MSS = int(binary.BigEndian.Uint16(opt.Data))
+		case opt.Kind == packet.TCPOptionWindowScale && len(opt.Data) == 1:
+			s.WindowScale = int(opt.Data[0])
+		case opt.Kind == packet.TCPOptionSACKPermitted:
+			s.SACKPermitted = true
+		case opt.Kind == packet.TCPOptionTimestamps && len(opt.Data) == 8:
+			s.Timestamps = true
+			s.TSVal, s.TSEcr = binary.BigEndian.Uint32(opt.Data), binary.BigEndian.Uint32(opt.Data[4:])
+		case opt.Kind == packet.TCPOptionFastOpen:
+			s.FastOpen = true
+		}
+	}
+	return s, nil
+}
+
+// Fingerprint derives the fingerprint of the stack that sent the SYN.
+func (s *SYN) Fingerprint() (*Fingerprint, error) {
+	return ParseFingerprint(s.Header)
+}
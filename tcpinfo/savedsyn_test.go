@@ -0,0 +1,58 @@
+package tcpinfo
+
+import (
+	"github.com/dotwaffle/inettools/packet"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestParseSYN(t *testing.T) {
+	tests := map[string]struct {
+		input   []byte
+		want    *SYN
+		wantErr bool
+	}{
+		"Full": {
+			input: syn(t, false, 64, 1, packet.TCPFlagSYN, 64240,
+				[]byte{2, 4, 0x05, 0xb4, 4, 2, 8, 10, 0, 0, 0, 7, 0, 0, 0, 0, 1, 3, 3, 7, 34, 2}),
+			want: &SYN{
+				Version: 4, SrcPort: 40000, DstPort: 443, TTL: 64, Window: 64240,
+				MSS: 1460, WindowScale: 7, SACKPermitted: true, Timestamps: true, TSVal: 7, FastOpen: true,
+			},
+		},
+		"NoOptions": {
+			input: syn(t, true, 255, 0, packet.TCPFlagSYN, 512, nil),
+			want: &SYN{
+				Version: 6, SrcPort: 40000, DstPort: 443, TTL: 255, Window: 512, MSS: -1, WindowScale: -1,
+			},
+		},
+		"BadOptions": {
+			input:   syn(t, false, 64, 1, packet.TCPFlagSYN, 1024, []byte{2, 9, 0, 0}),
+			wantErr: true,
+		},
+		"NotSYN": {
+			input:   syn(t, true, 64, 1, packet.TCPFlagRST, 1024, nil),
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := ParseSYN(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse err: %v", err)
+			}
+			// The addresses and options are checked by the packet package.
+			s.Header, s.Src, s.Dst, s.Options = nil, nil, nil, nil
+			if diff := cmp.Diff(test.want, s); diff != "" {
+				t.Fatalf("%v", diff)
+			}
+		})
+	}
+}
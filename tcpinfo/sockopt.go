@@ -0,0 +1,120 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Names of the socket options used by the package, so that errors describe which option failed.
+var optNames = map[[2]int]string{
+	{syscall.SOL_SOCKET, syscall.SO_KEEPALIVE}:   "SO_KEEPALIVE",
+	{syscall.SOL_SOCKET, syscall.SO_RCVBUF}:      "SO_RCVBUF",
+	{syscall.SOL_SOCKET, syscall.SO_SNDBUF}:      "SO_SNDBUF",
+	{syscall.SOL_SOCKET, soMemInfo}:              "SO_MEMINFO",
+	{syscall.IPPROTO_TCP, syscall.TCP_INFO}:      "TCP_INFO",
+	{syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT}:   "TCP_KEEPCNT",
+	{syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE}:  "TCP_KEEPIDLE",
+	{syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL}: "TCP_KEEPINTVL",
+	{syscall.IPPROTO_TCP, syscall.TCP_MAXSEG}:    "TCP_MAXSEG",
+	{syscall.IPPROTO_TCP, syscall.TCP_NODELAY}:   "TCP_NODELAY",
+	{syscall.IPPROTO_TCP, syscall.TCP_QUICKACK}:  "TCP_QUICKACK",
+	{syscall.IPPROTO_TCP, tcpUserTimeout}:        "TCP_USER_TIMEOUT",
+	{syscall.IPPROTO_TCP, tcpNotSentLowat}:       "TCP_NOTSENT_LOWAT",
+	{syscall.IPPROTO_TCP, tcpSaveSYN}:            "TCP_SAVE_SYN",
+	{syscall.IPPROTO_TCP, tcpSavedSYN}:           "TCP_SAVED_SYN",
+}
+
+// optName returns a human readable name for a socket option.
+func optName(level, opt int) string {
+	if name, ok := optNames[[2]int{level, opt}]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d/%d", level, opt)
+}
+
+// control runs fn against the file descriptor underlying conn, wrapping any failure in an *Error describing op. The
+// level is the socket option level op is performed at, used to recognise errors caused by a socket not being TCP.
+func control(conn syscall.Conn, op string, level int, fn func(fd uintptr) error) error {
+	if conn == nil {
+		return ErrNilConn
+	}
+
+	// Fetch the underlying raw connection.
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return newError(op, level, err)
+	}
+
+	return rawControl(rawConn, op, level, fn)
+}
+
+// rawControl is control for an already retrieved raw connection, such as the one passed to a net.Dialer or
+// net.ListenConfig Control function.
+func rawControl(rawConn syscall.RawConn, op string, level int, fn func(fd uintptr) error) error {
+	var fnErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		fnErr = fn(fd)
+	}); err != nil {
+		return newError(op, level, err)
+	}
+	if fnErr != nil {
+		return newError(op, level, fnErr)
+	}
+
+	return nil
+}
+
+// setsockoptInt sets an integer socket option on the socket underlying conn.
+func setsockoptInt(conn syscall.Conn, level, opt, value int) error {
+	return control(conn, "setsockopt "+optName(level, opt), level, func(fd uintptr) error {
+		return syscall.SetsockoptInt(int(fd), level, opt, value)
+	})
+}
+
+// rawSetsockoptInt sets an integer socket option on a raw connection.
+func rawSetsockoptInt(rawConn syscall.RawConn, level, opt, value int) error {
+	return rawControl(rawConn, "setsockopt "+optName(level, opt), level, func(fd uintptr) error {
+		return syscall.SetsockoptInt(int(fd), level, opt, value)
+	})
+}
+
+// getsockoptInt retrieves an integer socket option from the socket underlying conn.
+func getsockoptInt(conn syscall.Conn, level, opt int) (int, error) {
+	var value int
+	err := control(conn, "getsockopt "+optName(level, opt), level, func(fd uintptr) error {
+		var err error
+		value, err = syscall.GetsockoptInt(int(fd), level, opt)
+		return err
+	})
+	return value, err
+}
+
+// getsockoptPtr retrieves a fixed-size socket option from a file descriptor into the memory pointed to by ptr. The
+// kernel truncates the option to size if it is larger.
+func getsockoptPtr(fd uintptr, level, opt int, ptr unsafe.Pointer, size uintptr) error {
+	_, err := getsockoptLen(fd, level, opt, ptr, size)
+	return err
+}
+
+// getsockoptLen is getsockoptPtr for options of varying size, returning the size the kernel delivered.
+func getsockoptLen(fd uintptr, level, opt int, ptr unsafe.Pointer, size uintptr) (uintptr, error) {
+	// The kernel takes the size as a socklen_t, which is 32 bits everywhere.
+	n := uint32(size)
+	if _, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, uintptr(level), uintptr(opt), uintptr(ptr),
+		uintptr(unsafe.Pointer(&n)), 0); errno != 0 {
+		return 0, errno
+	}
+	return uintptr(n), nil
+}
+
+// setsockoptPtr sets a fixed-size socket option on a file descriptor from the memory pointed to by ptr.
+func setsockoptPtr(fd uintptr, level, opt int, ptr unsafe.Pointer, size uintptr) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, fd, uintptr(level), uintptr(opt), uintptr(ptr), size,
+		0); errno != 0 {
+		return errno
+	}
+	return nil
+}
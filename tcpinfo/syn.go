@@ -0,0 +1,79 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// Socket options for saving SYNs, missing from the syscall package.
+const (
+	tcpSaveSYN  = 27 // TCP_SAVE_SYN
+	tcpSavedSYN = 28 // TCP_SAVED_SYN
+)
+
+// maxSavedSYN is the largest saved SYN retrieved: an IPv6 header with extension headers, and a TCP header with
+// options.
+const maxSavedSYN = 512
+
+// SetSaveSYN enables or disables the saving of the SYN of each connection accepted by a listener (TCP_SAVE_SYN), for
+// GetSYN and GetFingerprint. Connections accepted before it is enabled have no saved SYN.
+func SetSaveSYN(conn syscall.Conn, enabled bool) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, tcpSaveSYN, boolToInt(enabled))
+}
+
+// SaveSYNControl is a net.ListenConfig Control function that enables TCP_SAVE_SYN before the listener starts, so that
+// the SYN of every connection it accepts is saved. Accepting connections from a listener with SYNs saved costs some
+// memory for each until the SYN is retrieved or the connection is closed.
+func SaveSYNControl(network, address string, c syscall.RawConn) error {
+	return rawSetsockoptInt(c, syscall.IPPROTO_TCP, tcpSaveSYN, 1)
+}
+
+// SavedSYN retrieves the IP and TCP headers of the SYN that opened an accepted connection (TCP_SAVED_SYN). The kernel
+// frees the saved SYN once it is retrieved, so it can only be retrieved once; afterwards, or if it was never saved,
+// the error matches syscall.ENOENT.
+func SavedSYN(conn *net.TCPConn) ([]byte, error) {
+	if conn == nil {
+		return nil, ErrNilConn
+	}
+	buf := make([]byte, maxSavedSYN)
+	var size uintptr
+	if err := control(conn, "getsockopt "+optName(syscall.IPPROTO_TCP, tcpSavedSYN), syscall.IPPROTO_TCP,
+		func(fd uintptr) error {
+			var err error
+			if size, err = getsockoptLen(fd, syscall.IPPROTO_TCP, tcpSavedSYN, unsafe.Pointer(&buf[0]),
+				uintptr(len(buf))); err != nil {
+				return err
+			}
+			if size == 0 {
+				return syscall.ENOENT
+			}
+			return nil
+		}); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+// GetFingerprint retrieves the saved SYN of a connection accepted by a listener with TCP_SAVE_SYN enabled, and derives
+// the fingerprint of the stack that sent it. As the saved SYN is freed once retrieved, only one of GetFingerprint and
+// GetSYN can be called for each connection; to have both, call GetSYN and then SYN.Fingerprint.
+func GetFingerprint(conn *net.TCPConn) (*Fingerprint, error) {
+	syn, err := SavedSYN(conn)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFingerprint(syn)
+}
+
+// GetSYN retrieves and parses the saved SYN of a connection accepted by a listener with TCP_SAVE_SYN enabled. It can
+// only be called once for each connection.
+func GetSYN(conn *net.TCPConn) (*SYN, error) {
+	syn, err := SavedSYN(conn)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSYN(syn)
+}
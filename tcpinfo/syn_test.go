@@ -0,0 +1,84 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestGetFingerprint(t *testing.T) {
+	lc := net.ListenConfig{Control: SaveSYNControl}
+	ln, err := lc.Listen(context.Background(), "tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer client.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	defer conn.Close()
+
+	f, err := GetFingerprint(conn.(*net.TCPConn))
+	if err != nil {
+		t.Fatalf("fingerprint err: %v", err)
+	}
+	if f.Version != 4 || f.InitialTTL != 64 || f.MSS <= 0 {
+		t.Errorf("got %v, want an IPv4 SYN from a Linux stack", f)
+	}
+
+	// The saved SYN is freed once it has been retrieved.
+	if _, err := GetFingerprint(conn.(*net.TCPConn)); !errors.Is(err, syscall.ENOENT) {
+		t.Errorf("second fingerprint: got %v, want %v", err, syscall.ENOENT)
+	}
+}
+
+func TestGetSYN(t *testing.T) {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("listen err: %v", err)
+	}
+	defer ln.Close()
+	if err := SetSaveSYN(ln.(*net.TCPListener), true); err != nil {
+		t.Fatalf("save syn err: %v", err)
+	}
+
+	client, err := net.Dial("tcp6", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer client.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err: %v", err)
+	}
+	defer conn.Close()
+
+	s, err := GetSYN(conn.(*net.TCPConn))
+	if err != nil {
+		t.Fatalf("syn err: %v", err)
+	}
+	if !s.Src.Equal(net.IPv6loopback) || int(s.SrcPort) != client.LocalAddr().(*net.TCPAddr).Port {
+		t.Errorf("got SYN from [%v]:%d, want %v", s.Src, s.SrcPort, client.LocalAddr())
+	}
+	if s.MSS <= 0 || !s.SACKPermitted {
+		t.Errorf("got MSS %d and SACK permitted %v, want the options of a Linux stack", s.MSS, s.SACKPermitted)
+	}
+	f, err := s.Fingerprint()
+	if err != nil {
+		t.Fatalf("fingerprint err: %v", err)
+	}
+	if f.Version != 6 {
+		t.Errorf("got version %d, want 6", f.Version)
+	}
+}
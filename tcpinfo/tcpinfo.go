@@ -3,40 +3,58 @@
 package tcpinfo
 
 import (
-	"errors"
-	"fmt"
 	"net"
 	"syscall"
 	"unsafe"
 )
 
+// Get retrieves the TCP_INFO of a connection. If the connection has already been closed, the error returned matches
+// ErrClosed, allowing it to be told apart from genuine failures with errors.Is.
 func Get(conn *net.TCPConn) (*syscall.TCPInfo, error) {
 	if conn == nil {
-		return nil, errors.New("nil conn")
-	}
-
-	// Fetch the underlying raw connection.
-	rawConn, err := conn.SyscallConn()
-	if err != nil {
-		return nil, fmt.Errorf("rawConn err: %v", err)
+		return nil, ErrNilConn
 	}
 
 	tcpInfo := syscall.TCPInfo{}
-	tcpInfoSize := unsafe.Sizeof(tcpInfo)
-	var errno syscall.Errno
 
 	// Instruct the kernel to deliver the TCP_INFO data into the data structure provided.
-	if err := rawConn.Control(func(fd uintptr) {
-		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.SOL_TCP, syscall.TCP_INFO,
-			uintptr(unsafe.Pointer(&tcpInfo)), uintptr(unsafe.Pointer(&tcpInfoSize)), 0)
+	if err := control(conn, "getsockopt TCP_INFO", syscall.IPPROTO_TCP, func(fd uintptr) error {
+		return getsockoptPtr(fd, syscall.IPPROTO_TCP, syscall.TCP_INFO, unsafe.Pointer(&tcpInfo),
+			unsafe.Sizeof(tcpInfo))
 	}); err != nil {
-		return nil, fmt.Errorf("rawConn control err: %v", err)
+		return nil, err
 	}
 
-	// Perhaps the syscall failed, if it did then wrap it so that the caller might do something with it.
-	if errno != 0 {
-		return nil, fmt.Errorf("syscall errno: %w", errno)
+	return &tcpInfo, nil
+}
+
+// tcpInfoHead is the start of struct tcp_info, which is laid out the same on every architecture. syscall.TCPInfo does
+// not name the bitfields following the options on all of them, so they are read through this instead.
+type tcpInfoHead struct {
+	State, CAState, Retransmits, Probes, Backoff, Options uint8
+	// Bitfields holds tcpi_snd_wscale:4 and tcpi_rcv_wscale:4, then tcpi_delivery_rate_app_limited:1 and
+	// tcpi_fastopen_client_fail:2.
+	Bitfields [2]uint8
+}
+
+// bigEndian reports whether the host is big endian, on which C compilers allocate bitfields from the most significant
+// bit of a byte rather than the least.
+var bigEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 0
+}()
+
+// bitfield returns the n bits of the bitfield at bit off of the bitfields in b, counting off in the order the compiler
+// allocates them.
+func bitfield(b uint8, off, n uint) uint8 {
+	if bigEndian {
+		off = 8 - off - n
 	}
+	return b >> off & (1<<n - 1)
+}
 
-	return &tcpInfo, nil
+// windowScales returns tcpi_snd_wscale and tcpi_rcv_wscale from already retrieved TCP_INFO.
+func windowScales(info *syscall.TCPInfo) (send, recv uint8) {
+	head := (*tcpInfoHead)(unsafe.Pointer(info))
+	return bitfield(head.Bitfields[0], 0, 4), bitfield(head.Bitfields[0], 4, 4)
 }
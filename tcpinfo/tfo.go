@@ -0,0 +1,98 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	tcpFastOpen        = 0x17 // TCP_FASTOPEN
+	tcpFastOpenConnect = 0x1e // TCP_FASTOPEN_CONNECT
+
+	tcpiOptSYNData = 0x20 // TCPI_OPT_SYN_DATA
+)
+
+// fastOpenFailures maps the tcpi_fastopen_client_fail values to failures.
+var fastOpenFailures = [...]FastOpenFailure{
+	FastOpenOK, FastOpenCookieUnavailable, FastOpenDataNotAcked, FastOpenSYNRetransmitted,
+}
+
+// SetFastOpen enables TCP Fast Open on a listener (TCP_FASTOPEN), allowing up to qlen connections at a time to be
+// accepted with data before their handshake completes. A qlen of zero disables it. The server must also be enabled
+// by the net.ipv4.tcp_fastopen sysctl.
+func SetFastOpen(conn syscall.Conn, qlen int) error {
+	return setsockoptInt(conn, syscall.IPPROTO_TCP, tcpFastOpen, qlen)
+}
+
+// FastOpenControl returns a function suitable for use as a net.ListenConfig Control function, which enables TCP Fast
+// Open on the listener as with SetFastOpen.
+func FastOpenControl(qlen int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return rawSetsockoptInt(c, syscall.IPPROTO_TCP, tcpFastOpen, qlen)
+	}
+}
+
+// FastOpenConnectControl is suitable for use as a net.Dialer Control function, and enables TCP Fast Open on outgoing
+// connections (TCP_FASTOPEN_CONNECT). Connecting then returns at once without sending the SYN, which is instead sent
+// with the first data written, if the kernel has a cookie cached for the server; otherwise the first connection to it
+// fetches one with an ordinary handshake. The client must also be enabled by the net.ipv4.tcp_fastopen sysctl.
+func FastOpenConnectControl(network, address string, c syscall.RawConn) error {
+	return rawSetsockoptInt(c, syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+}
+
+// DialFastOpen connects to address using TCP Fast Open, sending data in the SYN where possible, which makes this
+// equivalent to sendto with MSG_FASTOPEN. The dialer may be nil; its own Control function, if any, is run first.
+func DialFastOpen(ctx context.Context, d *net.Dialer, network, address string, data []byte) (*net.TCPConn, error) {
+	var dialer net.Dialer
+	if d != nil {
+		dialer = *d
+	}
+	control := dialer.Control
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		return FastOpenConnectControl(network, address, c)
+	}
+
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		conn.Close()
+		return nil, ErrNotTCP
+	}
+	if _, err := tcpConn.Write(data); err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	return tcpConn, nil
+}
+
+// FastOpenFromTCPInfo extracts the use of TCP Fast Open from already retrieved TCP_INFO.
+func FastOpenFromTCPInfo(info *syscall.TCPInfo) FastOpen {
+	// tcpi_fastopen_client_fail is two bits of the byte following the window scales, after
+	// tcpi_delivery_rate_app_limited.
+	head := (*tcpInfoHead)(unsafe.Pointer(info))
+	return FastOpen{
+		Used:          info.Options&tcpiOptSYNData != 0,
+		ClientFailure: fastOpenFailures[bitfield(head.Bitfields[1], 1, 2)],
+	}
+}
+
+// GetFastOpen retrieves whether TCP Fast Open was used on a connection.
+func GetFastOpen(conn *net.TCPConn) (FastOpen, error) {
+	info, err := Get(conn)
+	if err != nil {
+		return FastOpen{}, err
+	}
+	return FastOpenFromTCPInfo(info), nil
+}
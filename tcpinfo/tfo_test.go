@@ -0,0 +1,70 @@
+// +build linux
+
+package tcpinfo
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFastOpen(t *testing.T) {
+	sysctl, err := ioutil.ReadFile("/proc/sys/net/ipv4/tcp_fastopen")
+	if err != nil {
+		t.Skipf("read sysctl err: %v", err)
+	}
+	mode, err := strconv.Atoi(strings.TrimSpace(string(sysctl)))
+	if err != nil {
+		t.Fatalf("parse sysctl err: %v", err)
+	}
+	if mode&1 == 0 {
+		t.Skipf("client disabled by sysctl")
+	}
+
+	ctx := context.Background()
+	lc := net.ListenConfig{Control: FastOpenControl(16)}
+	ln, err := lc.Listen(ctx, "tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer ln.Close()
+
+	// The first connection fetches a cookie, if the server is enabled, and the second uses it.
+	for i := 0; i < 2; i++ {
+		client, err := DialFastOpen(ctx, nil, "tcp4", ln.Addr().String(), []byte("hello"))
+		if err != nil {
+			t.Fatalf("dial err: %v", err)
+		}
+		defer client.Close()
+		server, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("accept err: %v", err)
+		}
+		defer server.Close()
+		buf := make([]byte, 5)
+		if _, err := server.Read(buf); err != nil || string(buf) != "hello" {
+			t.Fatalf("got %q, err %v", buf, err)
+		}
+
+		got, err := GetFastOpen(client)
+		if err != nil {
+			t.Fatalf("client err: %v", err)
+		}
+		if want := i == 1 && mode&2 != 0; got.Used != want {
+			t.Errorf("connection %d: got client %+v, want used %v", i, got, want)
+		}
+		if i == 0 && got.ClientFailure != FastOpenOK && got.ClientFailure != FastOpenCookieUnavailable {
+			t.Errorf("connection %d: got client failure %q", i, got.ClientFailure)
+		}
+		got, err = GetFastOpen(server.(*net.TCPConn))
+		if err != nil {
+			t.Fatalf("server err: %v", err)
+		}
+		if want := i == 1 && mode&2 != 0; got.Used != want {
+			t.Errorf("connection %d: got server %+v, want used %v", i, got, want)
+		}
+	}
+}
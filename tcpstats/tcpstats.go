@@ -0,0 +1,234 @@
+package tcpstats
+
+import (
+	"errors"
+	"github.com/dotwaffle/inettools/lpm"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a single observation of a TCP connection's quality, typically taken from TCP_INFO.
+type Sample struct {
+	Remote      net.IP
+	RTT         time.Duration
+	Retransmits uint32 // Total segments retransmitted over the lifetime of the connection.
+}
+
+// PrefixStats summarises the samples whose remote address matched a single destination prefix.
+type PrefixStats struct {
+	Prefix         *net.IPNet
+	ASN            uint32
+	Connections    int
+	MedianRTT      time.Duration
+	Retransmits    uint64  // Sum of retransmitted segments across all connections.
+	RetransmitRate float64 // Proportion of connections that retransmitted at least one segment.
+}
+
+// ASNStats summarises the samples whose remote address matched any prefix originated by a single ASN.
+type ASNStats struct {
+	ASN            uint32
+	Prefixes       int
+	Connections    int
+	MedianRTT      time.Duration
+	Retransmits    uint64
+	RetransmitRate float64
+}
+
+// group accumulates the samples for a single prefix.
+type group struct {
+	prefix         *net.IPNet
+	asn            uint32
+	rtts           []time.Duration
+	retransmits    uint64
+	retransmitting int
+}
+
+// Aggregator groups TCP samples by the longest matching destination prefix. It is safe for concurrent use.
+type Aggregator struct {
+	mu        sync.Mutex
+	table     *lpm.Table
+	groups    []*group
+	byPrefix  map[string]*group
+	unmatched int
+}
+
+// NewAggregator returns an Aggregator with no prefixes; add some with AddPrefix before adding samples.
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		table:    lpm.New(),
+		byPrefix: map[string]*group{},
+	}
+}
+
+// AddPrefix registers a destination prefix, and the ASN originating it (zero if unknown), that samples will be
+// grouped by. Registering an identical prefix again replaces its ASN, but keeps any samples already collected.
+func (a *Aggregator) AddPrefix(pfx *net.IPNet, asn uint32) error {
+	if pfx == nil {
+		return errors.New("nil prefix")
+	}
+	network := &net.IPNet{
+		IP:   pfx.IP.Mask(pfx.Mask),
+		Mask: pfx.Mask,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// If the prefix is already present, just update the ASN in-place so no samples are lost. The table only finds the
+	// longest match, which may be a more specific prefix, so the groups are looked up by prefix instead.
+	if g, ok := a.byPrefix[network.String()]; ok {
+		g.asn = asn
+		return nil
+	}
+
+	g := &group{
+		prefix: network,
+		asn:    asn,
+	}
+	if err := a.table.Insert(network, g); err != nil {
+		return err
+	}
+	a.groups = append(a.groups, g)
+	a.byPrefix[network.String()] = g
+
+	return nil
+}
+
+// Add records a sample against the longest prefix containing its remote address. Samples that do not match any
+// prefix are counted, but otherwise discarded.
+func (a *Aggregator) Add(s Sample) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, err := a.table.Lookup(s.Remote)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		a.unmatched++
+		return nil
+	}
+
+	g := entry.Value.(*group)
+	g.rtts = append(g.rtts, s.RTT)
+	g.retransmits += uint64(s.Retransmits)
+	if s.Retransmits > 0 {
+		g.retransmitting++
+	}
+
+	return nil
+}
+
+// Unmatched returns the number of samples that did not match any registered prefix.
+func (a *Aggregator) Unmatched() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.unmatched
+}
+
+// Reset discards all collected samples, keeping the registered prefixes.
+func (a *Aggregator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, g := range a.groups {
+		g.rtts = nil
+		g.retransmits = 0
+		g.retransmitting = 0
+	}
+	a.unmatched = 0
+}
+
+// ByPrefix returns the statistics for every prefix that has received at least one sample, sorted by the number of
+// connections (most first), then by prefix.
+func (a *Aggregator) ByPrefix() []PrefixStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]PrefixStats, 0, len(a.groups))
+	for _, g := range a.groups {
+		if len(g.rtts) == 0 {
+			continue
+		}
+		result = append(result, PrefixStats{
+			Prefix:         g.prefix,
+			ASN:            g.asn,
+			Connections:    len(g.rtts),
+			MedianRTT:      median(g.rtts),
+			Retransmits:    g.retransmits,
+			RetransmitRate: float64(g.retransmitting) / float64(len(g.rtts)),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Connections != result[j].Connections {
+			return result[i].Connections > result[j].Connections
+		}
+		return result[i].Prefix.String() < result[j].Prefix.String()
+	})
+
+	return result
+}
+
+// ByASN returns the statistics for every ASN that has received at least one sample, sorted by the number of
+// connections (most first), then by ASN. Samples against prefixes with an unknown (zero) ASN are grouped together.
+func (a *Aggregator) ByASN() []ASNStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Merge the per-prefix groups into per-ASN groups.
+	merged := make(map[uint32]*group)
+	prefixes := make(map[uint32]int)
+	for _, g := range a.groups {
+		if len(g.rtts) == 0 {
+			continue
+		}
+		m, ok := merged[g.asn]
+		if !ok {
+			m = &group{asn: g.asn}
+			merged[g.asn] = m
+		}
+		m.rtts = append(m.rtts, g.rtts...)
+		m.retransmits += g.retransmits
+		m.retransmitting += g.retransmitting
+		prefixes[g.asn]++
+	}
+
+	result := make([]ASNStats, 0, len(merged))
+	for asn, m := range merged {
+		result = append(result, ASNStats{
+			ASN:            asn,
+			Prefixes:       prefixes[asn],
+			Connections:    len(m.rtts),
+			MedianRTT:      median(m.rtts),
+			Retransmits:    m.retransmits,
+			RetransmitRate: float64(m.retransmitting) / float64(len(m.rtts)),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Connections != result[j].Connections {
+			return result[i].Connections > result[j].Connections
+		}
+		return result[i].ASN < result[j].ASN
+	})
+
+	return result
+}
+
+// median returns the median of the supplied durations, without modifying the slice.
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(ds))
+	copy(sorted, ds)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
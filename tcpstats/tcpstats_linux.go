@@ -0,0 +1,19 @@
+// +build linux
+
+package tcpstats
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// FromTCPInfo builds a Sample from the remote address of a connection and the TCP_INFO retrieved from it, such as
+// that returned by tcpinfo.Get.
+func FromTCPInfo(remote net.IP, info *syscall.TCPInfo) Sample {
+	return Sample{
+		Remote:      remote,
+		RTT:         time.Duration(info.Rtt) * time.Microsecond,
+		Retransmits: info.Total_retrans,
+	}
+}
@@ -0,0 +1,121 @@
+package tcpstats
+
+import (
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator()
+	for pfx, asn := range map[string]uint32{
+		"192.0.2.0/24":   64496,
+		"192.0.2.128/25": 64497,
+		"2001:db8::/32":  64496,
+	} {
+		_, ipNet, err := net.ParseCIDR(pfx)
+		if err != nil {
+			t.Fatalf("input: %s produced err: %v", pfx, err)
+		}
+		if err := a.AddPrefix(ipNet, asn); err != nil {
+			t.Fatalf("add prefix err: %v", err)
+		}
+	}
+
+	samples := []Sample{
+		{Remote: net.ParseIP("192.0.2.1"), RTT: 10 * time.Millisecond},
+		{Remote: net.ParseIP("192.0.2.2"), RTT: 30 * time.Millisecond, Retransmits: 2},
+		{Remote: net.ParseIP("192.0.2.3"), RTT: 20 * time.Millisecond},
+		{Remote: net.ParseIP("192.0.2.200"), RTT: 50 * time.Millisecond, Retransmits: 1},
+		{Remote: net.ParseIP("2001:db8::1"), RTT: 40 * time.Millisecond},
+		{Remote: net.ParseIP("198.51.100.1"), RTT: 5 * time.Millisecond},
+	}
+	for _, s := range samples {
+		if err := a.Add(s); err != nil {
+			t.Fatalf("add err: %v", err)
+		}
+	}
+
+	t.Run("ByPrefix", func(t *testing.T) {
+		type result struct {
+			Prefix      string
+			ASN         uint32
+			Connections int
+			MedianRTT   time.Duration
+			Retransmits uint64
+			Rate        float64
+		}
+		want := []result{
+			{"192.0.2.0/24", 64496, 3, 20 * time.Millisecond, 2, 1.0 / 3},
+			{"192.0.2.128/25", 64497, 1, 50 * time.Millisecond, 1, 1},
+			{"2001:db8::/32", 64496, 1, 40 * time.Millisecond, 0, 0},
+		}
+		got := make([]result, 0)
+		for _, s := range a.ByPrefix() {
+			got = append(got, result{s.Prefix.String(), s.ASN, s.Connections, s.MedianRTT, s.Retransmits,
+				s.RetransmitRate})
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("ByASN", func(t *testing.T) {
+		want := []ASNStats{
+			{ASN: 64496, Prefixes: 2, Connections: 4, MedianRTT: 25 * time.Millisecond, Retransmits: 2,
+				RetransmitRate: 0.25},
+			{ASN: 64497, Prefixes: 1, Connections: 1, MedianRTT: 50 * time.Millisecond, Retransmits: 1,
+				RetransmitRate: 1},
+		}
+		if diff := cmp.Diff(want, a.ByASN()); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+
+	t.Run("Unmatched", func(t *testing.T) {
+		if got := a.Unmatched(); got != 1 {
+			t.Fatalf("got %d, want 1", got)
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		a.Reset()
+		if got := a.ByPrefix(); len(got) != 0 {
+			t.Fatalf("got %d prefixes after reset, want 0", len(got))
+		}
+	})
+}
+
+func TestAddPrefixAgain(t *testing.T) {
+	// Registering a prefix again after a more specific one must still find the samples it already has.
+	a := NewAggregator()
+	for _, add := range []struct {
+		pfx    string
+		asn    uint32
+		remote string
+	}{
+		{"192.0.2.0/24", 64496, ""},
+		{"192.0.2.0/25", 64497, "192.0.2.200"},
+		{"192.0.2.0/24", 64498, "192.0.2.201"},
+	} {
+		_, ipNet, _ := net.ParseCIDR(add.pfx)
+		if err := a.AddPrefix(ipNet, add.asn); err != nil {
+			t.Fatalf("add prefix err: %v", err)
+		}
+		if add.remote != "" {
+			if err := a.Add(Sample{Remote: net.ParseIP(add.remote), RTT: time.Millisecond}); err != nil {
+				t.Fatalf("add err: %v", err)
+			}
+		}
+	}
+
+	var got []string
+	for _, s := range a.ByPrefix() {
+		got = append(got, fmt.Sprintf("%v %d %d", s.Prefix, s.ASN, s.Connections))
+	}
+	if diff := cmp.Diff([]string{"192.0.2.0/24 64498 2"}, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+}
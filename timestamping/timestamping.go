@@ -0,0 +1,64 @@
+package timestamping
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrUnsupportedPlatform is returned on platforms where the kernel cannot timestamp packets.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// Flags select which packets are timestamped, and by what.
+type Flags uint
+
+const (
+	// RX timestamps datagrams as they are received, before they are queued on the socket.
+	RX Flags = 1 << iota
+	// TX timestamps datagrams as they are handed to the network interface, reported separately by Read.
+	TX
+	// Hardware adds the timestamps taken by the network interface itself, where it supports them and hardware
+	// timestamping has been enabled on it, such as with hwstamp_ctl.
+	Hardware
+)
+
+// Kind is the point at which a packet was timestamped.
+type Kind string
+
+// Kinds of timestamp.
+const (
+	KindReceived     Kind = "received"
+	KindScheduled    Kind = "scheduled"    // Entered the queueing discipline of the interface.
+	KindSent         Kind = "sent"         // Handed to the network interface, or sent by it for hardware timestamps.
+	KindAcknowledged Kind = "acknowledged" // Acknowledged by the peer, for TCP.
+)
+
+// Timestamp is the time the kernel or network interface saw a packet.
+type Timestamp struct {
+	Kind     Kind
+	Software time.Time // Taken by the kernel, or zero if there is none.
+	Hardware time.Time // Taken by the network interface in its own clock, or zero if there is none.
+	// For transmit timestamps, the number of datagrams sent on the socket before the one timestamped, counting from
+	// when timestamping was enabled.
+	ID uint32
+}
+
+// Time returns the most precise of the times, the hardware one if there is one.
+func (t *Timestamp) Time() time.Time {
+	if !t.Hardware.IsZero() {
+		return t.Hardware
+	}
+	return t.Software
+}
+
+// Message is the result of Read: either a datagram that was received, or a transmit timestamp for one that was sent.
+type Message struct {
+	N         int          // The length of the datagram received, or zero for a transmit timestamp.
+	Addr      *net.UDPAddr // The source of the datagram received, or nil for a transmit timestamp.
+	Timestamp Timestamp    // The timestamp, whose Kind is empty if the kernel did not provide one.
+}
+
+// Sent reports whether the message is a transmit timestamp rather than a datagram.
+func (m *Message) Sent() bool {
+	return m.Timestamp.Kind != "" && m.Timestamp.Kind != KindReceived
+}
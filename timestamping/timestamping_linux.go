@@ -0,0 +1,222 @@
+// +build linux
+
+package timestamping
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SOF_TIMESTAMPING_* flags from linux/net_tstamp.h.
+const (
+	sofTxHardware  = 1 << 0
+	sofTxSoftware  = 1 << 1
+	sofRxHardware  = 1 << 2
+	sofRxSoftware  = 1 << 3
+	sofSoftware    = 1 << 4
+	sofRawHardware = 1 << 6
+	sofOptID       = 1 << 7
+	sofOptTSOnly   = 1 << 11
+)
+
+// soEEOriginTimestamping is the origin of an extended error that carries a transmit timestamp rather than an error.
+const soEEOriginTimestamping = 4
+
+// tstampKinds maps the SCM_TSTAMP_* values in an extended error to the kind of timestamp.
+var tstampKinds = map[uint32]Kind{
+	0: KindSent,
+	1: KindScheduled,
+	2: KindAcknowledged,
+}
+
+// scmTimestamping is struct scm_timestamping: the software timestamp, a deprecated one, and the raw hardware one.
+type scmTimestamping struct {
+	ts [3]syscall.Timespec
+}
+
+// sockExtendedErr is struct sock_extended_err, which accompanies a transmit timestamp on the error queue.
+type sockExtendedErr struct {
+	errno  uint32
+	origin uint8
+	typ    uint8
+	code   uint8
+	pad    uint8
+	info   uint32
+	data   uint32
+}
+
+// oobSize is enough out-of-band space for a timestamp and the extended error that describes it.
+var oobSize = syscall.CmsgSpace(int(unsafe.Sizeof(scmTimestamping{}))) +
+	syscall.CmsgSpace(int(unsafe.Sizeof(sockExtendedErr{})))
+
+// Enable instructs the kernel to timestamp the datagrams a socket receives or sends (SO_TIMESTAMPING), which can then
+// be read with Read. Transmit timestamps are numbered by the datagram they belong to, and carry no copy of it.
+func Enable(conn syscall.Conn, flags Flags) error {
+	if conn == nil {
+		return errors.New("nil conn")
+	}
+
+	opt := sofSoftware
+	if flags&Hardware != 0 {
+		opt |= sofRawHardware
+	}
+	if flags&RX != 0 {
+		opt |= sofRxSoftware
+		if flags&Hardware != 0 {
+			opt |= sofRxHardware
+		}
+	}
+	if flags&TX != 0 {
+		opt |= sofTxSoftware | sofOptID | sofOptTSOnly
+		if flags&Hardware != 0 {
+			opt |= sofTxHardware
+		}
+	}
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("rawConn err: %w", err)
+	}
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TIMESTAMPING, opt)
+	}); err != nil {
+		return fmt.Errorf("rawConn control err: %w", err)
+	}
+	if sockErr != nil {
+		return fmt.Errorf("setsockopt SO_TIMESTAMPING: %w", sockErr)
+	}
+	return nil
+}
+
+// Read waits for either a datagram, which it reads into b, or a transmit timestamp, which are preferred so that a busy
+// socket cannot hold them back. It honours the read deadline of conn, but must not be called concurrently with other
+// reads from it.
+func Read(conn syscall.Conn, b []byte) (*Message, error) {
+	if conn == nil {
+		return nil, errors.New("nil conn")
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("rawConn err: %w", err)
+	}
+
+	oob := make([]byte, oobSize)
+	var m *Message
+	var readErr error
+	if err := rawConn.Read(func(fd uintptr) bool {
+		for {
+			// Anything else on the error queue, such as an ICMP error with IP_RECVERR set, is skipped.
+			_, oobn, _, _, err := syscall.Recvmsg(int(fd), nil, oob, syscall.MSG_ERRQUEUE)
+			if err == syscall.EAGAIN {
+				break
+			}
+			if err != nil {
+				readErr = fmt.Errorf("recvmsg MSG_ERRQUEUE: %w", err)
+				return true
+			}
+			if m, readErr = parseTX(oob[:oobn]); m != nil || readErr != nil {
+				return true
+			}
+		}
+
+		n, oobn, _, from, err := syscall.Recvmsg(int(fd), b, oob, 0)
+		if err == syscall.EAGAIN {
+			return false
+		}
+		if err != nil {
+			readErr = fmt.Errorf("recvmsg: %w", err)
+			return true
+		}
+		m = &Message{N: n, Addr: udpAddr(from)}
+		if ts, ok, err := parseTimestamp(oob[:oobn]); err != nil {
+			readErr = err
+		} else if ok {
+			m.Timestamp = ts
+			m.Timestamp.Kind = KindReceived
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return m, readErr
+}
+
+// parseTX extracts a transmit timestamp from the out-of-band data of a message on the error queue, returning nil if it
+// is not one.
+func parseTX(oob []byte) (*Message, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("parse control message: %w", err)
+	}
+	var ee *sockExtendedErr
+	for _, msg := range msgs {
+		if (msg.Header.Level == syscall.SOL_IP && msg.Header.Type == syscall.IP_RECVERR) ||
+			(msg.Header.Level == syscall.SOL_IPV6 && msg.Header.Type == syscall.IPV6_RECVERR) {
+			if len(msg.Data) < int(unsafe.Sizeof(sockExtendedErr{})) {
+				return nil, fmt.Errorf("short extended error: %d bytes", len(msg.Data))
+			}
+			ee = (*sockExtendedErr)(unsafe.Pointer(&msg.Data[0]))
+		}
+	}
+	if ee == nil || ee.origin != soEEOriginTimestamping {
+		return nil, nil
+	}
+	ts, ok, err := parseTimestamp(oob)
+	if err != nil || !ok {
+		return nil, err
+	}
+	ts.Kind, ts.ID = tstampKinds[ee.info], ee.data
+	if ts.Kind == "" {
+		return nil, nil
+	}
+	return &Message{Timestamp: ts}, nil
+}
+
+// parseTimestamp extracts the times from the SCM_TIMESTAMPING message in out-of-band data, if there is one.
+func parseTimestamp(oob []byte) (Timestamp, bool, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return Timestamp{}, false, fmt.Errorf("parse control message: %w", err)
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level != syscall.SOL_SOCKET || msg.Header.Type != syscall.SO_TIMESTAMPING {
+			continue
+		}
+		if len(msg.Data) < int(unsafe.Sizeof(scmTimestamping{})) {
+			return Timestamp{}, false, fmt.Errorf("short SCM_TIMESTAMPING message: %d bytes", len(msg.Data))
+		}
+		scm := (*scmTimestamping)(unsafe.Pointer(&msg.Data[0]))
+		return Timestamp{Software: timespec(scm.ts[0]), Hardware: timespec(scm.ts[2])}, true, nil
+	}
+	return Timestamp{}, false, nil
+}
+
+// timespec converts a timespec to a time, or the zero time if it is zero, as the kernel leaves those it did not take.
+func timespec(ts syscall.Timespec) time.Time {
+	if ts.Sec == 0 && ts.Nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts.Unix())
+}
+
+// udpAddr converts the source address of a datagram.
+func udpAddr(sa syscall.Sockaddr) *net.UDPAddr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.UDPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		var zone string
+		if sa.ZoneId != 0 {
+			if ifi, err := net.InterfaceByIndex(int(sa.ZoneId)); err == nil {
+				zone = ifi.Name
+			}
+		}
+		return &net.UDPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port, Zone: zone}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// +build linux
+
+package timestamping
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadTimestamps(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer server.Close()
+	client, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer client.Close()
+
+	if err := Enable(server, RX); err != nil {
+		t.Fatalf("enable err: %v", err)
+	}
+	if err := Enable(client, TX); err != nil {
+		t.Fatalf("enable err: %v", err)
+	}
+	before := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Write([]byte("probe")); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	client.SetReadDeadline(deadline)
+	server.SetReadDeadline(deadline)
+
+	// Each datagram sent should be reported in order, and no datagram should be read on the client.
+	for i := uint32(0); i < 2; i++ {
+		m, err := Read(client, make([]byte, 16))
+		if err != nil {
+			t.Fatalf("client read err: %v", err)
+		}
+		if !m.Sent() || m.Timestamp.Kind != KindSent || m.Timestamp.ID != i || m.N != 0 {
+			t.Fatalf("got %+v, want transmit timestamp %d", m, i)
+		}
+		if ts := m.Timestamp.Time(); ts.Before(before) || time.Since(ts) > time.Minute {
+			t.Fatalf("got transmit time %v, want after %v", ts, before)
+		}
+	}
+
+	buf := make([]byte, 16)
+	m, err := Read(server, buf)
+	if err != nil {
+		t.Fatalf("server read err: %v", err)
+	}
+	if m.Sent() || m.Timestamp.Kind != KindReceived || string(buf[:m.N]) != "probe" {
+		t.Fatalf("got %+v %q, want received probe", m, buf[:m.N])
+	}
+	if m.Addr.String() != client.LocalAddr().String() {
+		t.Fatalf("got source %v, want %v", m.Addr, client.LocalAddr())
+	}
+	if ts := m.Timestamp.Time(); ts.Before(before) || time.Since(ts) > time.Minute {
+		t.Fatalf("got receive time %v, want after %v", ts, before)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer conn.Close()
+	if err := Enable(conn, RX|TX); err != nil {
+		t.Fatalf("enable err: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := Read(conn, make([]byte, 16)); err == nil {
+		t.Fatalf("got no error")
+	}
+}
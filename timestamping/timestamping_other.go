@@ -0,0 +1,11 @@
+// +build !linux
+
+package timestamping
+
+import "syscall"
+
+// Timestamping is only implemented on Linux; elsewhere the functions return ErrUnsupportedPlatform so that callers can
+// fall back to timing packets themselves.
+
+func Enable(conn syscall.Conn, flags Flags) error        { return ErrUnsupportedPlatform }
+func Read(conn syscall.Conn, b []byte) (*Message, error) { return nil, ErrUnsupportedPlatform }
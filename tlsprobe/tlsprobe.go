@@ -0,0 +1,268 @@
+package tlsprobe
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/proxydial"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the time allowed for each handshake if the Prober does not say otherwise.
+const DefaultTimeout = 10 * time.Second
+
+// versionNames are the names of the TLS versions.
+var versionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// VersionName returns the name of a TLS version, such as "TLS 1.3".
+func VersionName(version uint16) string {
+	if s, ok := versionNames[version]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// Certificate summarises a certificate presented by a server.
+type Certificate struct {
+	Subject            string
+	Issuer             string
+	SerialNumber       string
+	NotBefore          time.Time
+	NotAfter           time.Time
+	DNSNames           []string
+	IPAddresses        []net.IP
+	KeyAlgorithm       string
+	SignatureAlgorithm string
+	IsCA               bool
+	SHA256             [sha256.Size]byte // The fingerprint of the whole certificate.
+
+	Raw *x509.Certificate // The parsed certificate, for anything not summarised above.
+}
+
+// newCertificate summarises a parsed certificate.
+func newCertificate(c *x509.Certificate) Certificate {
+	return Certificate{
+		Subject:            c.Subject.String(),
+		Issuer:             c.Issuer.String(),
+		SerialNumber:       c.SerialNumber.Text(16),
+		NotBefore:          c.NotBefore,
+		NotAfter:           c.NotAfter,
+		DNSNames:           c.DNSNames,
+		IPAddresses:        c.IPAddresses,
+		KeyAlgorithm:       c.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: c.SignatureAlgorithm.String(),
+		IsCA:               c.IsCA,
+		SHA256:             sha256.Sum256(c.Raw),
+		Raw:                c,
+	}
+}
+
+// ExpiresIn returns the time left before the certificate expires, which is negative if it already has.
+func (c *Certificate) ExpiresIn(now time.Time) time.Duration {
+	return c.NotAfter.Sub(now)
+}
+
+// Result describes a completed handshake and the certificates the server presented.
+type Result struct {
+	Address     string
+	ServerName  string // The name sent in the SNI extension and verified against.
+	Version     uint16
+	CipherSuite uint16
+	ALPN        string // The application protocol negotiated, if any.
+	OCSPStapled bool   // The server stapled an OCSP response.
+	Handshake   time.Duration
+	Chain       []Certificate // The certificates as sent by the server, leaf first.
+
+	// VerifyErr is why the chain could not be verified against the roots and the server name, or nil if it could. A
+	// chain that fails verification is still reported, as diagnosing that is often the point.
+	VerifyErr error
+}
+
+// VersionName returns the name of the negotiated version.
+func (r *Result) VersionName() string {
+	return VersionName(r.Version)
+}
+
+// CipherSuiteName returns the name of the negotiated cipher suite.
+func (r *Result) CipherSuiteName() string {
+	return tls.CipherSuiteName(r.CipherSuite)
+}
+
+// Expiry returns the earliest expiry time of the certificates in the chain, which is when the chain stops working.
+func (r *Result) Expiry() time.Time {
+	var earliest time.Time
+	for _, c := range r.Chain {
+		if earliest.IsZero() || c.NotAfter.Before(earliest) {
+			earliest = c.NotAfter
+		}
+	}
+	return earliest
+}
+
+// Prober performs TLS handshakes against servers to inspect them. The zero value uses the system roots and the default
+// versions and cipher suites of crypto/tls.
+type Prober struct {
+	ServerName   string         // Sent in the SNI extension, or the host part of the address if empty.
+	ALPN         []string       // Application protocols to offer, such as "h2" and "http/1.1".
+	RootCAs      *x509.CertPool // Used to verify the chain, or the system roots if nil.
+	Timeout      time.Duration  // The time allowed for each handshake, or DefaultTimeout if zero.
+	MinVersion   uint16         // Offered versions, or the defaults of crypto/tls if zero.
+	MaxVersion   uint16
+	CipherSuites []uint16 // Offered TLS 1.2 and earlier cipher suites, or the defaults if nil.
+	// Proxy tunnels connections through a proxy, such as a proxydial.SOCKS5, rather than connecting directly. The
+	// handshake is timed from when the tunnel is established.
+	Proxy proxydial.ContextDialer
+}
+
+// Probe performs a handshake with address, a host and port, using a Prober with the default settings.
+func Probe(ctx context.Context, address string) (*Result, error) {
+	var p Prober
+	return p.Probe(ctx, address)
+}
+
+// Probe performs a handshake with address, a host and port, and reports what was negotiated and the certificates the
+// server presented. An error is only returned if the handshake fails, not if the certificates are untrusted.
+func (p *Prober) Probe(ctx context.Context, address string) (*Result, error) {
+	serverName := p.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		serverName = host
+	}
+	config := &tls.Config{
+		ServerName: serverName,
+		NextProtos: p.ALPN,
+		MinVersion: p.MinVersion,
+		MaxVersion: p.MaxVersion,
+		// The chain is verified separately, so that an untrusted one can still be inspected.
+		InsecureSkipVerify: true,
+		CipherSuites:       p.CipherSuites,
+	}
+
+	timeout := DefaultTimeout
+	if p.Timeout > 0 {
+		timeout = p.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer proxydial.ContextDialer = &net.Dialer{}
+	if p.Proxy != nil {
+		dialer = p.Proxy
+	}
+	raw, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer raw.Close()
+	dl, _ := ctx.Deadline()
+	raw.SetDeadline(dl)
+	conn := tls.Client(raw, config)
+	start := time.Now()
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	handshake := time.Since(start)
+	state := conn.ConnectionState()
+
+	result := &Result{
+		Address:     address,
+		ServerName:  serverName,
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		ALPN:        state.NegotiatedProtocol,
+		OCSPStapled: len(state.OCSPResponse) > 0,
+		Handshake:   handshake,
+	}
+	for _, c := range state.PeerCertificates {
+		result.Chain = append(result.Chain, newCertificate(c))
+	}
+	result.VerifyErr = verify(state.PeerCertificates, serverName, p.RootCAs)
+	return result, nil
+}
+
+// verify checks a chain as sent by a server against the roots and the server name.
+func verify(certs []*x509.Certificate, serverName string, roots *x509.CertPool) error {
+	if len(certs) == 0 {
+		return errors.New("no certificates")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// Support records whether a server accepted a handshake restricted to a single version or cipher suite.
+type Support struct {
+	Version     uint16
+	CipherSuite uint16 // Zero when testing versions.
+	Err         error  // Why the handshake failed, or nil if the server accepted it.
+}
+
+// Supported reports whether the server accepted the handshake.
+func (s *Support) Supported() bool {
+	return s.Err == nil
+}
+
+// TestVersions attempts a handshake restricted to each of the given versions in turn, which shows whether a server
+// still accepts outdated versions, or has yet to enable new ones.
+func (p *Prober) TestVersions(ctx context.Context, address string, versions []uint16) []Support {
+	results := make([]Support, len(versions))
+	for i, v := range versions {
+		q := *p
+		q.MinVersion, q.MaxVersion = v, v
+		results[i] = Support{Version: v}
+		if _, err := q.Probe(ctx, address); err != nil {
+			results[i].Err = err
+		}
+	}
+	return results
+}
+
+// TestCipherSuites attempts a TLS 1.2 handshake restricted to each of the given cipher suites in turn. The cipher
+// suites of TLS 1.3 cannot be restricted, so are not tested.
+func (p *Prober) TestCipherSuites(ctx context.Context, address string, suites []uint16) []Support {
+	results := make([]Support, len(suites))
+	for i, s := range suites {
+		q := *p
+		q.MinVersion, q.MaxVersion, q.CipherSuites = tls.VersionTLS12, tls.VersionTLS12, []uint16{s}
+		results[i] = Support{Version: tls.VersionTLS12, CipherSuite: s}
+		if _, err := q.Probe(ctx, address); err != nil {
+			results[i].Err = err
+		}
+	}
+	return results
+}
+
+// Describe returns a one line description of the handshake, such as might be logged by a monitoring check.
+func (r *Result) Describe() string {
+	parts := []string{r.VersionName(), r.CipherSuiteName()}
+	if r.ALPN != "" {
+		parts = append(parts, "alpn "+r.ALPN)
+	}
+	if len(r.Chain) > 0 {
+		parts = append(parts, "expires "+r.Expiry().UTC().Format(time.RFC3339))
+	}
+	if r.VerifyErr != nil {
+		parts = append(parts, "unverified: "+r.VerifyErr.Error())
+	}
+	return strings.Join(parts, ", ")
+}
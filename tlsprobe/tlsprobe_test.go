@@ -0,0 +1,193 @@
+package tlsprobe
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/dotwaffle/inettools/proxydial"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// testCert returns a self-signed certificate for example.com and 127.0.0.1, valid for a day.
+func testCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key err: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(0xbeef),
+		Subject:               pkix.Name{CommonName: "example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		DNSNames:              []string{"example.com"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate err: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate err: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+// testServer accepts TLS connections on a loopback port until the test ends, completing the handshake and nothing
+// more.
+func testServer(t *testing.T, config *tls.Config) string {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestProbe(t *testing.T) {
+	cert, parsed := testCert(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+	address := testServer(t, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+		MinVersion:   tls.VersionTLS12,
+	})
+	ctx := context.Background()
+
+	t.Run("Trusted", func(t *testing.T) {
+		p := &Prober{RootCAs: roots, ALPN: []string{"http/1.1"}}
+		res, err := p.Probe(ctx, address)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if res.VerifyErr != nil || res.Version != tls.VersionTLS13 || res.ALPN != "http/1.1" ||
+			res.ServerName != "127.0.0.1" {
+			t.Fatalf("got %+v", res)
+		}
+		if len(res.Chain) != 1 {
+			t.Fatalf("got %d certificates, want 1", len(res.Chain))
+		}
+		c := res.Chain[0]
+		if diff := cmp.Diff([]string{"example.com"}, c.DNSNames); diff != "" {
+			t.Errorf("%v", diff)
+		}
+		if c.SerialNumber != "beef" || c.KeyAlgorithm != "ECDSA" || !c.IsCA || !res.Expiry().Equal(parsed.NotAfter) {
+			t.Errorf("got %+v", c)
+		}
+		if d := c.ExpiresIn(time.Now()); d < 23*time.Hour || d > 24*time.Hour {
+			t.Errorf("expires in %v", d)
+		}
+	})
+
+	t.Run("WrongName", func(t *testing.T) {
+		p := &Prober{RootCAs: roots, ServerName: "example.net"}
+		res, err := p.Probe(ctx, address)
+		if err != nil || res.VerifyErr == nil {
+			t.Fatalf("got %+v, err %v, want a verification error", res, err)
+		}
+	})
+
+	t.Run("Untrusted", func(t *testing.T) {
+		res, err := Probe(ctx, address)
+		if err != nil || res.VerifyErr == nil || len(res.Chain) != 1 {
+			t.Fatalf("got %+v, err %v, want a verification error", res, err)
+		}
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer ln.Close()
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil || req.Method != http.MethodConnect {
+				return
+			}
+			upstream, err := net.Dial("tcp", req.Host)
+			if err != nil {
+				return
+			}
+			defer upstream.Close()
+			conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+
+		p := &Prober{RootCAs: roots, Proxy: &proxydial.HTTPConnect{Address: ln.Addr().String()}}
+		res, err := p.Probe(ctx, address)
+		if err != nil || res.VerifyErr != nil {
+			t.Fatalf("got %+v, err %v", res, err)
+		}
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		var p Prober
+		var got []bool
+		for _, s := range p.TestVersions(ctx, address, []uint16{tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}) {
+			got = append(got, s.Supported())
+		}
+		if diff := cmp.Diff([]bool{false, true, true}, got); diff != "" {
+			t.Fatalf("%v", diff)
+		}
+	})
+}
+
+func TestCipherSuites(t *testing.T) {
+	cert, _ := testCert(t)
+	address := testServer(t, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+
+	var p Prober
+	suites := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305}
+	var got []bool
+	for _, s := range p.TestCipherSuites(context.Background(), address, suites) {
+		got = append(got, s.Supported())
+	}
+	if diff := cmp.Diff([]bool{true, false}, got); diff != "" {
+		t.Fatalf("%v", diff)
+	}
+
+	p.MaxVersion = tls.VersionTLS12
+	res, err := p.Probe(context.Background(), address)
+	if err != nil || res.VersionName() != "TLS 1.2" ||
+		res.CipherSuiteName() != "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256" {
+		t.Fatalf("got %+v, err %v", res, err)
+	}
+}
@@ -0,0 +1,170 @@
+// +build linux
+
+package udpinfo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/tcpinfo"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// OOBSize is the size of the out-of-band buffer needed to receive the drop counter alongside a datagram.
+var OOBSize = syscall.CmsgSpace(4)
+
+// Error records a failed operation on a socket. The underlying cause is preserved for errors.Is and errors.As, and
+// the error also matches tcpinfo.ErrClosed when the socket had already been closed.
+type Error struct {
+	Op  string // The operation that failed, such as "setsockopt SO_RXQ_OVFL".
+	Err error  // The underlying cause.
+}
+
+func (e *Error) Error() string {
+	return "udpinfo: " + e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches tcpinfo.ErrClosed.
+func (e *Error) Is(target error) bool {
+	return target == tcpinfo.ErrClosed && (errors.Is(e.Err, net.ErrClosed) || errors.Is(e.Err, syscall.EBADF))
+}
+
+// Stats describes the receive pressure and drops of a UDP socket.
+type Stats struct {
+	RecvQueued uint32 // Memory allocated to datagrams waiting to be read, in bytes.
+	RecvBuffer uint32 // The receive buffer limit, in bytes.
+	SendQueued uint32 // Memory allocated to datagrams waiting to be transmitted, in bytes.
+	SendBuffer uint32 // The send buffer limit, in bytes.
+	Drops      uint32 // Datagrams dropped before reaching the socket, usually because the receive buffer was full.
+}
+
+// RecvPressure returns the proportion of the receive buffer currently in use; as it approaches one, datagrams will
+// start to be dropped.
+func (s *Stats) RecvPressure() float64 {
+	if s.RecvBuffer == 0 {
+		return 0
+	}
+	return float64(s.RecvQueued) / float64(s.RecvBuffer)
+}
+
+// Get retrieves the drop counter and buffer utilization of a UDP socket. Unlike the counter delivered alongside each
+// datagram, this does not require EnableDropCounter.
+func Get(conn *net.UDPConn) (*Stats, error) {
+	if conn == nil {
+		return nil, tcpinfo.ErrNilConn
+	}
+	memInfo, err := tcpinfo.GetMemInfo(conn)
+	if err != nil {
+		// Report the failure as our own, rather than with the prefix of the package that happened to perform it.
+		var tcpErr *tcpinfo.Error
+		if errors.As(err, &tcpErr) {
+			return nil, &Error{Op: tcpErr.Op, Err: tcpErr.Err}
+		}
+		return nil, err
+	}
+	return &Stats{
+		RecvQueued: memInfo.RmemAlloc,
+		RecvBuffer: memInfo.RcvBuf,
+		SendQueued: memInfo.WmemAlloc,
+		SendBuffer: memInfo.SndBuf,
+		Drops:      memInfo.Drops,
+	}, nil
+}
+
+// EnableDropCounter instructs the kernel to deliver the socket's cumulative drop counter (SO_RXQ_OVFL) alongside each
+// datagram received, which can then be read with ReadMsg or extracted with ParseDropCount.
+func EnableDropCounter(conn *net.UDPConn) error {
+	if conn == nil {
+		return tcpinfo.ErrNilConn
+	}
+
+	const op = "setsockopt SO_RXQ_OVFL"
+
+	// Fetch the underlying raw connection.
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return &Error{Op: op, Err: err}
+	}
+
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RXQ_OVFL, 1)
+	}); err != nil {
+		return &Error{Op: op, Err: err}
+	}
+	if sockErr != nil {
+		return &Error{Op: op, Err: sockErr}
+	}
+
+	return nil
+}
+
+// ParseDropCount extracts the cumulative drop counter from the out-of-band data received with a datagram. The
+// boolean is false if the counter was not present, which the kernel does until the first drop has occurred.
+func ParseDropCount(oob []byte) (uint32, bool, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse control message: %w", err)
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level != syscall.SOL_SOCKET || msg.Header.Type != syscall.SO_RXQ_OVFL {
+			continue
+		}
+		if len(msg.Data) < 4 {
+			return 0, false, fmt.Errorf("short SO_RXQ_OVFL message: %d bytes", len(msg.Data))
+		}
+		return *(*uint32)(unsafe.Pointer(&msg.Data[0])), true, nil
+	}
+	return 0, false, nil
+}
+
+// DropCounter reads datagrams from a socket with the drop counter enabled, keeping track of how many datagrams were
+// dropped between those that were read.
+type DropCounter struct {
+	conn *net.UDPConn
+	oob  []byte
+	last uint32
+}
+
+// NewDropCounter enables the drop counter on conn, and returns a DropCounter reading from it.
+func NewDropCounter(conn *net.UDPConn) (*DropCounter, error) {
+	if err := EnableDropCounter(conn); err != nil {
+		return nil, err
+	}
+	return &DropCounter{
+		conn: conn,
+		oob:  make([]byte, OOBSize),
+	}, nil
+}
+
+// ReadMsg reads a single datagram into b, returning its length and source, along with the number of datagrams the
+// kernel dropped between the previously read datagram and this one being queued.
+func (d *DropCounter) ReadMsg(b []byte) (n int, addr *net.UDPAddr, dropped uint32, err error) {
+	n, oobn, _, addr, err := d.conn.ReadMsgUDP(b, d.oob)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	total, ok, err := ParseDropCount(d.oob[:oobn])
+	if err != nil {
+		return n, addr, 0, err
+	}
+	if ok {
+		// The counter is cumulative and wraps, so unsigned subtraction gives the right answer across the wrap.
+		dropped = total - d.last
+		d.last = total
+	}
+
+	return n, addr, dropped, nil
+}
+
+// Total returns the cumulative number of drops reported by the kernel as of the last datagram read.
+func (d *DropCounter) Total() uint32 {
+	return d.last
+}
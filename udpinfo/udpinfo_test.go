@@ -0,0 +1,100 @@
+// +build linux
+
+package udpinfo
+
+import (
+	"errors"
+	"github.com/dotwaffle/inettools/tcpinfo"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrops(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.SetReadBuffer(4096); err != nil {
+		t.Fatalf("set read buffer err: %v", err)
+	}
+
+	counter, err := NewDropCounter(conn)
+	if err != nil {
+		t.Fatalf("drop counter err: %v", err)
+	}
+
+	sender, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer sender.Close()
+
+	// Overflow the tiny receive buffer without reading anything.
+	payload := make([]byte, 1000)
+	for i := 0; i < 100; i++ {
+		if _, err := sender.Write(payload); err != nil {
+			t.Fatalf("write err: %v", err)
+		}
+	}
+
+	stats, err := Get(conn)
+	if err != nil {
+		t.Fatalf("get err: %v", err)
+	}
+	if stats.Drops == 0 || stats.RecvQueued == 0 || stats.RecvPressure() == 0 {
+		t.Fatalf("expected drops and receive pressure: %+v", stats)
+	}
+
+	// The counter is attached to each datagram as it is queued, so the datagrams queued before the buffer filled
+	// carry no drops, whereas the next datagram to arrive carries all of them.
+	buf := make([]byte, 2000)
+	for {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		_, _, dropped, err := counter.ReadMsg(buf)
+		if err != nil {
+			break
+		}
+		if dropped != 0 {
+			t.Fatalf("queued datagram reported %d drops, want 0", dropped)
+		}
+	}
+	if _, err := sender.Write(payload); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, dropped, err := counter.ReadMsg(buf)
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	if n != len(payload) {
+		t.Fatalf("read %d bytes, want %d", n, len(payload))
+	}
+	if dropped != stats.Drops || counter.Total() != stats.Drops {
+		t.Fatalf("dropped %d (total %d), want %d", dropped, counter.Total(), stats.Drops)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Get(nil); !errors.Is(err, tcpinfo.ErrNilConn) {
+		t.Fatalf("got err %v, want ErrNilConn", err)
+	}
+	if err := EnableDropCounter(nil); !errors.Is(err, tcpinfo.ErrNilConn) {
+		t.Fatalf("got err %v, want ErrNilConn", err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err: %v", err)
+	}
+	conn.Close()
+	if err := EnableDropCounter(conn); !errors.Is(err, tcpinfo.ErrClosed) || !strings.HasPrefix(err.Error(), "udpinfo: ") {
+		t.Fatalf("got err %v, want udpinfo ErrClosed", err)
+	}
+	if _, err := Get(conn); !errors.Is(err, tcpinfo.ErrClosed) || !strings.HasPrefix(err.Error(), "udpinfo: ") {
+		t.Fatalf("got err %v, want udpinfo ErrClosed", err)
+	}
+}
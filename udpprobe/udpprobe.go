@@ -0,0 +1,425 @@
+package udpprobe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dotwaffle/inettools/budget"
+	"github.com/dotwaffle/inettools/sockopt"
+	"github.com/dotwaffle/inettools/timestamping"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults used by a Prober whose fields are not set. They resemble a G.711 voice call, sending a packet every 20ms.
+const (
+	DefaultCount    = 100
+	DefaultInterval = 20 * time.Millisecond
+	DefaultSize     = 172 // 160 octets of audio and a 12 octet RTP header.
+	DefaultTimeout  = time.Second
+)
+
+// magic identifies probe packets.
+const magic = 0x55445050
+
+// HeaderLen is the length of the header of a probe packet, and so the smallest size a probe can be.
+const HeaderLen = 32
+
+// header is the start of a probe packet: the magic number, the sequence number, the time the prober sent it, and the
+// times the responder received and returned it, as Unix times in nanoseconds.
+type header struct {
+	seq                          uint32
+	clientTx, serverRx, serverTx int64
+}
+
+// marshal writes the header to the start of b.
+func (h *header) marshal(b []byte) {
+	binary.BigEndian.PutUint32(b, magic)
+	binary.BigEndian.PutUint32(b[4:], h.seq)
+	binary.BigEndian.PutUint64(b[8:], uint64(h.clientTx))
+	binary.BigEndian.PutUint64(b[16:], uint64(h.serverRx))
+	binary.BigEndian.PutUint64(b[24:], uint64(h.serverTx))
+}
+
+// unmarshal reads the header from the start of b, failing if it is not a probe packet.
+func (h *header) unmarshal(b []byte) error {
+	if len(b) < HeaderLen || binary.BigEndian.Uint32(b) != magic {
+		return errors.New("not a probe packet")
+	}
+	h.seq = binary.BigEndian.Uint32(b[4:])
+	h.clientTx = int64(binary.BigEndian.Uint64(b[8:]))
+	h.serverRx = int64(binary.BigEndian.Uint64(b[16:]))
+	h.serverTx = int64(binary.BigEndian.Uint64(b[24:]))
+	return nil
+}
+
+// Responder echoes probe packets back to their sender, adding the times it received and returned them.
+type Responder struct {
+	conn       net.PacketConn
+	timestamps *net.UDPConn // The socket, if the kernel timestamps the probes it receives.
+
+	mu  sync.Mutex
+	err error
+}
+
+// Listen opens a UDP socket on address and starts responding to probes on it.
+func Listen(address string) (*Responder, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewResponder(conn), nil
+}
+
+// NewResponder starts responding to probes received on conn. Where conn is a UDP socket on a platform that supports
+// it, the times probes are received are taken by the kernel, so exclude the time they spent queued on the socket.
+func NewResponder(conn net.PacketConn) *Responder {
+	r := &Responder{conn: conn}
+	if udpConn, ok := conn.(*net.UDPConn); ok && timestamping.Enable(udpConn, timestamping.RX) == nil {
+		r.timestamps = udpConn
+	}
+	go r.run()
+	return r
+}
+
+// read reads a datagram, returning the time it was received.
+func (r *Responder) read(b []byte) (int, net.Addr, time.Time, error) {
+	if r.timestamps == nil {
+		n, addr, err := r.conn.ReadFrom(b)
+		return n, addr, time.Now(), err
+	}
+	m, err := timestamping.Read(r.timestamps, b)
+	if err != nil {
+		return 0, nil, time.Time{}, err
+	}
+	rx := m.Timestamp.Software
+	if rx.IsZero() {
+		rx = time.Now()
+	}
+	return m.N, m.Addr, rx, nil
+}
+
+// run echoes probes until the socket is closed or fails. Anything that is not a probe is ignored, so that the
+// responder cannot be used to reflect arbitrary traffic.
+func (r *Responder) run() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, rx, err := r.read(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				r.mu.Lock()
+				r.err = err
+				r.mu.Unlock()
+			}
+			return
+		}
+		var h header
+		if h.unmarshal(buf[:n]) != nil {
+			continue
+		}
+		h.serverRx = rx.UnixNano()
+		h.serverTx = time.Now().UnixNano()
+		h.marshal(buf)
+		r.conn.WriteTo(buf[:n], addr)
+	}
+}
+
+// Addr returns the address of the socket.
+func (r *Responder) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// Err returns the error that stopped the responder, or nil if it is still running or was stopped by Close.
+func (r *Responder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close stops the responder by closing its socket.
+func (r *Responder) Close() error {
+	return r.conn.Close()
+}
+
+// Sample is the fate of a single probe.
+type Sample struct {
+	Seq  uint32
+	Sent time.Time // When the probe was sent, by the kernel if Prober.Timestamps is set.
+	Lost bool      // No echo arrived in time.
+
+	// For probes that were echoed, the round-trip time less the time the responder held the probe, and the apparent
+	// one-way transit times. The transit times include the offset between the two clocks, so are only meaningful as
+	// absolute values if the clocks are synchronized, but their variation is meaningful regardless.
+	RTT            time.Duration
+	ForwardTransit time.Duration
+	ReverseTransit time.Duration
+
+	// When the probe arrived at and left the responder, and when its echo arrived here, as Unix times in nanoseconds.
+	serverRx, serverTx, recvd int64
+}
+
+// measure computes the round-trip and transit times of a probe that was echoed.
+func (s *Sample) measure() {
+	sent := s.Sent.UnixNano()
+	s.RTT = time.Duration(s.recvd - sent - (s.serverTx - s.serverRx))
+	s.ForwardTransit = time.Duration(s.serverRx - sent)
+	s.ReverseTransit = time.Duration(s.recvd - s.serverTx)
+}
+
+// Stats summarises a run of probes. Jitter is the interarrival jitter of RFC 3550, the smoothed mean deviation of the
+// spacing of packets on arrival from their spacing on departure, measured separately in each direction.
+type Stats struct {
+	Sent       int
+	Received   int
+	Duplicates int // Echoes received for probes that had already been echoed.
+	Reordered  int // Echoes that arrived after the echo of a later probe.
+
+	MinRTT    time.Duration
+	MeanRTT   time.Duration
+	MaxRTT    time.Duration
+	StdDevRTT time.Duration
+
+	ForwardJitter time.Duration
+	ReverseJitter time.Duration
+
+	Samples []Sample // In order of sequence number.
+}
+
+// Loss returns the proportion of probes that were not echoed.
+func (s *Stats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) / float64(s.Sent)
+}
+
+// Prober sends a stream of probes to a Responder at a fixed rate. The zero value is usable.
+type Prober struct {
+	Count    int           // The number of probes sent, or DefaultCount if zero.
+	Interval time.Duration // The time between probes, or DefaultInterval if zero.
+	Size     int           // The size of each probe, at least HeaderLen, or DefaultSize if zero.
+	Timeout  time.Duration // How long to wait for echoes after the last probe, or DefaultTimeout if zero.
+	// Whether the times probes are sent and echoes received are taken by the kernel (SO_TIMESTAMPING) rather than
+	// here, excluding scheduling and queueing delays on this host. It is only supported on Linux.
+	Timestamps bool
+	// Source is the address the probes are sent from, or nil to let the host choose. It is checked against the
+	// responder and Socket.Device with sockopt.CheckSource.
+	Source net.IP
+	// Socket steers the probes, such as with a traffic class or by binding to a VRF device.
+	Socket sockopt.Options
+	// Budget, if set, bounds the rate of the probes, and is typically shared with the other probers of the program.
+	Budget *budget.Budget
+}
+
+// Run sends probes to the responder at address, a host and port, and summarises the echoes.
+func (p *Prober) Run(ctx context.Context, address string) (*Stats, error) {
+	count, interval, size, timeout := p.Count, p.Interval, p.Size, p.Timeout
+	if count <= 0 {
+		count = DefaultCount
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if size == 0 {
+		size = DefaultSize
+	}
+	if size < HeaderLen {
+		return nil, fmt.Errorf("probe size %d smaller than the %d octet header", size, HeaderLen)
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	d := net.Dialer{Control: p.Socket.Control}
+	if p.Source != nil {
+		d.LocalAddr = &net.UDPAddr{IP: p.Source}
+	}
+	conn, err := d.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := sockopt.CheckSource(p.Source, conn.RemoteAddr().(*net.UDPAddr).IP, p.Socket.Device); err != nil {
+		return nil, err
+	}
+	udpConn := conn.(*net.UDPConn)
+	if p.Timestamps {
+		if err := timestamping.Enable(udpConn, timestamping.RX|timestamping.TX); err != nil {
+			return nil, err
+		}
+	}
+
+	samples := make([]Sample, count)
+	for i := range samples {
+		samples[i].Seq = uint32(i)
+		samples[i].Lost = true
+	}
+
+	// Receive echoes while sending, until the timeout after the last probe.
+	stats := &Stats{Sent: count, Samples: samples}
+	var mu sync.Mutex
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		buf := make([]byte, 65535)
+		highest := -1
+		for {
+			n, now, err := p.read(udpConn, buf, samples, &mu)
+			if err != nil {
+				return
+			}
+			if n < 0 {
+				continue
+			}
+			var h header
+			if h.unmarshal(buf[:n]) != nil || int(h.seq) >= count {
+				continue
+			}
+
+			mu.Lock()
+			s := &samples[h.seq]
+			switch {
+			case s.Sent.IsZero():
+				// An echo cannot arrive before its probe was sent; this must be left over from something else.
+			case !s.Lost:
+				stats.Duplicates++
+			default:
+				// The times are measured once all are known, as a kernel send time may be read after the echo.
+				s.Lost = false
+				s.serverRx, s.serverTx, s.recvd = h.serverRx, h.serverTx, now.UnixNano()
+				stats.Received++
+				if int(h.seq) < highest {
+					stats.Reordered++
+				} else {
+					highest = int(h.seq)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	buf := make([]byte, size)
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		// Schedule from the start rather than the previous probe, so that delays do not accumulate.
+		if wait := time.Until(start.Add(time.Duration(i) * interval)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				conn.Close()
+				<-received
+				return nil, ctx.Err()
+			}
+		}
+		if p.Budget != nil {
+			if err := p.Budget.Wait(ctx, conn.RemoteAddr().(*net.UDPAddr).IP); err != nil {
+				conn.Close()
+				<-received
+				return nil, err
+			}
+		}
+		mu.Lock()
+		samples[i].Sent = time.Now()
+		h := header{seq: uint32(i), clientTx: samples[i].Sent.UnixNano()}
+		mu.Unlock()
+		h.marshal(buf)
+		// A failure to send, such as an ICMP unreachable reported on the socket, is a loss like any other.
+		conn.Write(buf)
+	}
+
+	select {
+	case <-time.After(timeout):
+	case <-ctx.Done():
+	}
+	conn.Close()
+	<-received
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range samples {
+		if !samples[i].Lost {
+			samples[i].measure()
+		}
+	}
+	summarise(stats)
+	return stats, nil
+}
+
+// read reads an echo, returning its length and the time it was received. With kernel timestamps, it also records the
+// times probes were sent as they are reported, returning a negative length for them.
+func (p *Prober) read(conn *net.UDPConn, b []byte, samples []Sample, mu *sync.Mutex) (int, time.Time, error) {
+	if !p.Timestamps {
+		n, err := conn.Read(b)
+		return n, time.Now(), err
+	}
+	m, err := timestamping.Read(conn, b)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	// Hardware timestamps are not used, as they are taken by the clock of the network interface.
+	ts := m.Timestamp.Software
+	if m.Sent() {
+		// Each probe is one datagram, so the transmit timestamp IDs are their sequence numbers.
+		if m.Timestamp.Kind == timestamping.KindSent && !ts.IsZero() && int(m.Timestamp.ID) < len(samples) {
+			mu.Lock()
+			samples[m.Timestamp.ID].Sent = ts
+			mu.Unlock()
+		}
+		return -1, time.Time{}, nil
+	}
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return m.N, ts, nil
+}
+
+// summarise computes the RTT and jitter statistics from the samples.
+func summarise(stats *Stats) {
+	var echoed []*Sample
+	for i := range stats.Samples {
+		if !stats.Samples[i].Lost {
+			echoed = append(echoed, &stats.Samples[i])
+		}
+	}
+	if len(echoed) == 0 {
+		return
+	}
+
+	var sum, sumSquares float64
+	stats.MinRTT = echoed[0].RTT
+	for _, s := range echoed {
+		if s.RTT < stats.MinRTT {
+			stats.MinRTT = s.RTT
+		}
+		if s.RTT > stats.MaxRTT {
+			stats.MaxRTT = s.RTT
+		}
+		sum += float64(s.RTT)
+		sumSquares += float64(s.RTT) * float64(s.RTT)
+	}
+	mean := sum / float64(len(echoed))
+	stats.MeanRTT = time.Duration(mean)
+	stats.StdDevRTT = time.Duration(math.Sqrt(math.Max(sumSquares/float64(len(echoed))-mean*mean, 0)))
+
+	// Jitter is computed over consecutive packets in the order they arrived, at the responder for the forward
+	// direction and back here for the reverse.
+	sort.Slice(echoed, func(i, j int) bool { return echoed[i].serverRx < echoed[j].serverRx })
+	stats.ForwardJitter = jitter(echoed, func(s *Sample) time.Duration { return s.ForwardTransit })
+	sort.Slice(echoed, func(i, j int) bool { return echoed[i].recvd < echoed[j].recvd })
+	stats.ReverseJitter = jitter(echoed, func(s *Sample) time.Duration { return s.ReverseTransit })
+}
+
+// jitter computes the interarrival jitter of RFC 3550 section 6.4.1 over samples in order of arrival.
+func jitter(samples []*Sample, transit func(*Sample) time.Duration) time.Duration {
+	var j float64
+	for i := 1; i < len(samples); i++ {
+		d := math.Abs(float64(transit(samples[i]) - transit(samples[i-1])))
+		j += (d - j) / 16
+	}
+	return time.Duration(j)
+}
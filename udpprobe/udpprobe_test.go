@@ -0,0 +1,181 @@
+package udpprobe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/dotwaffle/inettools/budget"
+	"github.com/dotwaffle/inettools/timestamping"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// impairedConn drops the echoes of every fifth probe, and delays the echo of every seventh until after the next.
+type impairedConn struct {
+	net.PacketConn
+
+	mu   sync.Mutex
+	held []byte
+}
+
+func (c *impairedConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq := binary.BigEndian.Uint32(b[4:])
+	switch {
+	case seq%5 == 0:
+		return len(b), nil
+	case seq%7 == 0:
+		c.held = append([]byte(nil), b...)
+		return len(b), nil
+	}
+	n, err := c.PacketConn.WriteTo(b, addr)
+	if c.held != nil {
+		c.PacketConn.WriteTo(c.held, addr)
+		c.held = nil
+	}
+	return n, err
+}
+
+func TestProber(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Clean", func(t *testing.T) {
+		r, err := Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer r.Close()
+
+		p := &Prober{Count: 50, Interval: 2 * time.Millisecond, Size: 200, Timeout: 100 * time.Millisecond}
+		start := time.Now()
+		stats, err := p.Run(ctx, r.Addr().String())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 98*time.Millisecond+100*time.Millisecond {
+			t.Errorf("took %v, less than the schedule", elapsed)
+		}
+		if stats.Sent != 50 || stats.Received != 50 || stats.Reordered != 0 || stats.Duplicates != 0 {
+			t.Fatalf("got %+v", stats)
+		}
+		if stats.MinRTT <= 0 || stats.MinRTT > stats.MeanRTT || stats.MeanRTT > stats.MaxRTT {
+			t.Fatalf("got rtt min %v, mean %v, max %v", stats.MinRTT, stats.MeanRTT, stats.MaxRTT)
+		}
+		for i, s := range stats.Samples {
+			if s.Seq != uint32(i) || s.Lost || s.RTT <= 0 {
+				t.Fatalf("sample %d is %+v", i, s)
+			}
+		}
+	})
+
+	t.Run("Impaired", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		r := NewResponder(&impairedConn{PacketConn: conn})
+		defer r.Close()
+
+		p := &Prober{Count: 30, Interval: time.Millisecond, Timeout: 100 * time.Millisecond}
+		stats, err := p.Run(ctx, r.Addr().String())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		// Probes 0, 5, 10, 15, 20 and 25 are dropped, and 7, 14, 21 and 28 are delayed until after the next one echoed.
+		if stats.Received != 24 || stats.Reordered != 4 {
+			t.Fatalf("got %d received, %d reordered, want 24 and 4", stats.Received, stats.Reordered)
+		}
+		if loss := stats.Loss(); loss != 0.2 {
+			t.Fatalf("got loss %v", loss)
+		}
+		if !stats.Samples[5].Lost || stats.Samples[6].Lost {
+			t.Fatalf("got samples %+v, %+v", stats.Samples[5], stats.Samples[6])
+		}
+	})
+
+	t.Run("Timestamps", func(t *testing.T) {
+		r, err := Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer r.Close()
+
+		p := &Prober{Count: 20, Interval: time.Millisecond, Timeout: 100 * time.Millisecond, Timestamps: true}
+		start := time.Now()
+		stats, err := p.Run(ctx, r.Addr().String())
+		if errors.Is(err, timestamping.ErrUnsupportedPlatform) {
+			t.Skipf("%v", err)
+		}
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if stats.Received != 20 || stats.MinRTT <= 0 {
+			t.Fatalf("got %+v", stats)
+		}
+		for i, s := range stats.Samples {
+			if s.Sent.Before(start) || s.RTT <= 0 || s.RTT > time.Second {
+				t.Fatalf("sample %d is %+v", i, s)
+			}
+		}
+	})
+
+	t.Run("Source", func(t *testing.T) {
+		r, err := Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer r.Close()
+
+		p := &Prober{Count: 5, Interval: time.Millisecond, Timeout: 100 * time.Millisecond, Source: net.IPv4(127, 0, 0, 1)}
+		stats, err := p.Run(ctx, r.Addr().String())
+		if err != nil || stats.Received != 5 {
+			t.Fatalf("got %+v, err %v", stats, err)
+		}
+		p.Source = net.IPv4(192, 0, 2, 1)
+		if _, err := p.Run(ctx, r.Addr().String()); err == nil {
+			t.Fatalf("got no error from a source that is not local")
+		}
+	})
+
+	t.Run("Budget", func(t *testing.T) {
+		r, err := Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err: %v", err)
+		}
+		defer r.Close()
+
+		// The budget allows a probe every 20ms, however short the interval.
+		b := &budget.Budget{PerDestination: budget.Limit{Rate: 50}}
+		p := &Prober{Count: 5, Interval: time.Millisecond, Timeout: 10 * time.Millisecond, Budget: b}
+		start := time.Now()
+		stats, err := p.Run(ctx, r.Addr().String())
+		if err != nil || stats.Received != 5 {
+			t.Fatalf("got %+v, err %v", stats, err)
+		}
+		if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+			t.Fatalf("took %v, less than the budget allows", elapsed)
+		}
+	})
+
+	t.Run("Small", func(t *testing.T) {
+		p := &Prober{Size: HeaderLen - 1}
+		if _, err := p.Run(ctx, "127.0.0.1:9"); err == nil {
+			t.Fatalf("got no error")
+		}
+	})
+}
+
+func TestJitter(t *testing.T) {
+	// Transit times alternating by 16ms converge on a jitter of 16ms.
+	var samples []*Sample
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, &Sample{ForwardTransit: time.Duration(i%2) * 16 * time.Millisecond})
+	}
+	got := jitter(samples, func(s *Sample) time.Duration { return s.ForwardTransit })
+	if d := got - 16*time.Millisecond; d < -time.Microsecond || d > time.Microsecond {
+		t.Fatalf("got %v, want 16ms", got)
+	}
+}